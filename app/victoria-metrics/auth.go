@@ -0,0 +1,160 @@
+package main
+
+import (
+	"crypto/subtle"
+	"flag"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// Note that -httpAuth.*Token flags don't protect /health, /ping, /favicon.ico, /-/flags, /metrics, /debug/pprof/* and /debug/profiles/*
+// endpoints, since they are served by lib/httpserver before calling requestHandler. These endpoints are protected
+// by -flagsAuthKey, -metricsAuthKey and -pprofAuthKey flags instead.
+var (
+	httpAuthReadToken = flag.String("httpAuth.readToken", "", "Optional token for authorizing requests to read endpoints such as /api/v1/query, /api/v1/export or /federate. "+
+		"The token must be passed via 'Authorization: Bearer <token>' header or via Basic Auth password. "+
+		"Requests to read endpoints are allowed without the token if the flag is empty. The token doesn't protect /metrics, /debug/pprof/* and /debug/profiles/* endpoints - "+
+		"use -metricsAuthKey and -pprofAuthKey for them. See also -httpAuth.writeToken and -httpAuth.adminToken")
+	httpAuthWriteToken = flag.String("httpAuth.writeToken", "", "Optional token for authorizing requests to write endpoints such as /api/v1/write or /api/v1/import. "+
+		"The token must be passed via 'Authorization: Bearer <token>' header or via Basic Auth password. "+
+		"Requests to write endpoints are allowed without the token if the flag is empty. See also -httpAuth.readToken and -httpAuth.adminToken")
+	httpAuthAdminToken = flag.String("httpAuth.adminToken", "", "Optional token for authorizing requests to admin endpoints such as /api/v1/admin/tsdb/delete_series, "+
+		"/snapshot/*, /internal/* and /-/reload. The token also authorizes requests to read and write endpoints. "+
+		"The token must be passed via 'Authorization: Bearer <token>' header or via Basic Auth password. "+
+		"Requests to admin endpoints are allowed without the token if the flag is empty. See also -httpAuth.readToken and -httpAuth.writeToken")
+)
+
+// checkAuthTokenFlags verifies -httpAuth.*Token flags.
+func checkAuthTokenFlags() {
+	if err := getAuthTokenFlagsError(); err != nil {
+		logger.Fatalf("%s", err)
+	}
+}
+
+func getAuthTokenFlagsError() error {
+	if !isAuthTokenEnabled() {
+		return nil
+	}
+	if flag.Lookup("httpAuth.username").Value.String() != "" {
+		return fmt.Errorf("-httpAuth.readToken, -httpAuth.writeToken and -httpAuth.adminToken cannot be used together with -httpAuth.username")
+	}
+	return nil
+}
+
+func isAuthTokenEnabled() bool {
+	return len(*httpAuthReadToken) > 0 || len(*httpAuthWriteToken) > 0 || len(*httpAuthAdminToken) > 0
+}
+
+type requestKind int
+
+const (
+	requestKindRead requestKind = iota
+	requestKindWrite
+	requestKindAdmin
+)
+
+func (rk requestKind) String() string {
+	switch rk {
+	case requestKindWrite:
+		return "write"
+	case requestKindAdmin:
+		return "admin"
+	default:
+		return "read"
+	}
+}
+
+// getRequestKind returns the kind of the endpoint for the given path.
+//
+// All the endpoints, which aren't known as write or admin endpoints, are treated as read endpoints.
+func getRequestKind(path string) requestKind {
+	path = strings.Replace(path, "//", "/", -1)
+	switch {
+	case strings.HasPrefix(path, "/prometheus/"):
+		path = path[len("/prometheus"):]
+	case strings.HasPrefix(path, "/graphite/"):
+		path = path[len("/graphite"):]
+	}
+	switch {
+	case strings.HasPrefix(path, "/api/v1/admin/"),
+		strings.HasPrefix(path, "/snapshot"),
+		strings.HasPrefix(path, "/internal/"),
+		path == "/-/reload",
+		path == "/tags/delSeries":
+		return requestKindAdmin
+	case path == "/api/v1/write",
+		path == "/api/v1/import" || strings.HasPrefix(path, "/api/v1/import/"),
+		strings.HasPrefix(path, "/influx/"),
+		path == "/write",
+		path == "/api/v2/write",
+		path == "/query",
+		path == "/tags/tagSeries",
+		path == "/tags/tagMultiSeries":
+		return requestKindWrite
+	default:
+		return requestKindRead
+	}
+}
+
+// getAuthToken returns auth token from r.
+//
+// The token may be passed either via `Authorization: Bearer <token>` header or via Basic Auth password.
+func getAuthToken(r *http.Request) string {
+	if _, password, ok := r.BasicAuth(); ok {
+		return password
+	}
+	const prefix = "Bearer "
+	if ah := r.Header.Get("Authorization"); strings.HasPrefix(ah, prefix) {
+		return ah[len(prefix):]
+	}
+	return ""
+}
+
+// checkAuthToken verifies whether r is authorized to access the requested endpoint according to -httpAuth.*Token flags.
+//
+// It writes an error response to w and returns false if r isn't authorized.
+func checkAuthToken(w http.ResponseWriter, r *http.Request) bool {
+	if !isAuthTokenEnabled() {
+		return true
+	}
+	rk := getRequestKind(r.URL.Path)
+	var requiredToken string
+	switch rk {
+	case requestKindWrite:
+		requiredToken = *httpAuthWriteToken
+	case requestKindAdmin:
+		requiredToken = *httpAuthAdminToken
+	default:
+		requiredToken = *httpAuthReadToken
+	}
+	if len(requiredToken) == 0 {
+		return true
+	}
+	token := getAuthToken(r)
+	if isTokenEqual(token, requiredToken) || (len(*httpAuthAdminToken) > 0 && isTokenEqual(token, *httpAuthAdminToken)) {
+		return true
+	}
+	if len(token) == 0 {
+		authTokenMissingErrors.Inc()
+		w.Header().Set("WWW-Authenticate", `Basic realm="VictoriaMetrics"`)
+		http.Error(w, "missing auth token", http.StatusUnauthorized)
+		return false
+	}
+	authTokenInvalidErrors.Inc()
+	http.Error(w, "the provided auth token doesn't allow access to "+rk.String()+" endpoints", http.StatusForbidden)
+	return false
+}
+
+// isTokenEqual compares token with expectedToken in constant time in order to prevent from timing attacks.
+func isTokenEqual(token, expectedToken string) bool {
+	return subtle.ConstantTimeCompare([]byte(token), []byte(expectedToken)) == 1
+}
+
+var (
+	authTokenMissingErrors = metrics.NewCounter(`vm_http_request_errors_total{path="*", reason="missing_auth_token"}`)
+	authTokenInvalidErrors = metrics.NewCounter(`vm_http_request_errors_total{path="*", reason="invalid_auth_token"}`)
+)
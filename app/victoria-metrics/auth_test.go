@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestGetRequestKind(t *testing.T) {
+	f := func(path string, rkExpected requestKind) {
+		t.Helper()
+		rk := getRequestKind(path)
+		if rk != rkExpected {
+			t.Fatalf("unexpected request kind for %q; got %s; want %s", path, rk, rkExpected)
+		}
+	}
+	f("/", requestKindRead)
+	f("/api/v1/query", requestKindRead)
+	f("/prometheus/api/v1/query_range", requestKindRead)
+	f("/api/v1/export", requestKindRead)
+	f("/api/v1/label/job/values", requestKindRead)
+	f("/federate", requestKindRead)
+	f("/graphite/metrics/find", requestKindRead)
+	f("/api/v1/importer", requestKindRead)
+
+	f("/api/v1/write", requestKindWrite)
+	f("/prometheus/api/v1/write", requestKindWrite)
+	f("/api/v1/import", requestKindWrite)
+	f("/api/v1/import/prometheus", requestKindWrite)
+	f("//api/v1/import/native", requestKindWrite)
+	f("/influx/write", requestKindWrite)
+	f("/write", requestKindWrite)
+	f("/api/v2/write", requestKindWrite)
+	f("/graphite/tags/tagSeries", requestKindWrite)
+
+	f("/api/v1/admin/tsdb/delete_series", requestKindAdmin)
+	f("/prometheus/api/v1/admin/tsdb/snapshot", requestKindAdmin)
+	f("/snapshot/create", requestKindAdmin)
+	f("/snapshot/delete_all", requestKindAdmin)
+	f("/internal/force_merge", requestKindAdmin)
+	f("/internal/resetRollupResultCache", requestKindAdmin)
+	f("/-/reload", requestKindAdmin)
+	f("/graphite/tags/delSeries", requestKindAdmin)
+}
@@ -10,10 +10,13 @@ import (
 	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/common"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/relabel"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/promql"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmstorage"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/buildinfo"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/configcheck"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/envflag"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
@@ -21,26 +24,46 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/procutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/pushmetrics"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/tracing"
 )
 
 var (
 	httpListenAddr    = flag.String("httpListenAddr", ":8428", "TCP address to listen for http connections")
 	minScrapeInterval = flag.Duration("dedup.minScrapeInterval", 0, "Remove superflouos samples from time series if they are located closer to each other than this duration. "+
 		"This may be useful for reducing overhead when multiple identically configured Prometheus instances write data to the same VictoriaMetrics. "+
-		"Deduplication is disabled if the -dedup.minScrapeInterval is 0")
-	dryRun = flag.Bool("dryRun", false, "Whether to check only -promscrape.config and then exit. "+
+		"Deduplication is disabled if the -dedup.minScrapeInterval is 0. The flag may be changed at runtime via /-/flags page")
+	dryRun = flag.Bool("dryRun", false, "Whether to check only -promscrape.config and -rollupViews.config and then exit. "+
 		"Unknown config entries are allowed in -promscrape.config by default. This can be changed with -promscrape.config.strictParse")
 )
 
+func init() {
+	flagutil.RegisterHotFlag("dedup.minScrapeInterval", checkMinScrapeInterval, func() {
+		storage.SetMinScrapeIntervalForDeduplication(*minScrapeInterval)
+	})
+}
+
+func checkMinScrapeInterval() error {
+	if *minScrapeInterval < 0 {
+		return fmt.Errorf("the value cannot be negative; got %s", *minScrapeInterval)
+	}
+	return nil
+}
+
 func main() {
 	// Write flags and help message to stdout, since it is easier to grep or pipe.
 	flag.CommandLine.SetOutput(os.Stdout)
 	flag.Usage = usage
+	isCheckFlags := configcheck.IsSubcommand("check-flags")
 	envflag.Parse()
 	buildinfo.Init()
 	logger.Init()
 
+	if isCheckFlags {
+		r := checkFlags()
+		r.WriteAndExit()
+	}
 	if promscrape.IsDryRun() {
 		*dryRun = true
 	}
@@ -48,25 +71,36 @@ func main() {
 		if err := promscrape.CheckConfig(); err != nil {
 			logger.Fatalf("error when checking -promscrape.config: %s", err)
 		}
-		logger.Infof("-promscrape.config is ok; exitting with 0 status code")
+		if len(*rollupViewsConfig) > 0 {
+			if _, err := loadRollupViews(*rollupViewsConfig); err != nil {
+				logger.Fatalf("error when checking -rollupViews.config: %s", err)
+			}
+		}
+		logger.Infof("config files are ok; exitting with 0 status code")
 		return
 	}
 
+	checkAuthTokenFlags()
+
 	logger.Infof("starting VictoriaMetrics at %q...", *httpListenAddr)
 	startTime := time.Now()
-	storage.SetMinScrapeIntervalForDeduplication(*minScrapeInterval)
+	tracing.Init()
+	pushmetrics.Init()
 	vmstorage.Init(promql.ResetRollupResultCacheIfNeeded)
 	vmselect.Init()
 	vminsert.Init()
 	startSelfScraper()
+	startRollupViews()
 
 	go httpserver.Serve(*httpListenAddr, requestHandler)
 	logger.Infof("started VictoriaMetrics in %.3f seconds", time.Since(startTime).Seconds())
 
 	sig := procutil.WaitForSigterm()
 	logger.Infof("received signal %s", sig)
+	pushmetrics.Stop()
 
 	stopSelfScraper()
+	stopRollupViews()
 
 	logger.Infof("gracefully shutting down webservice at %q", *httpListenAddr)
 	startTime = time.Now()
@@ -78,13 +112,53 @@ func main() {
 
 	vmstorage.Stop()
 	vmselect.Stop()
+	tracing.Stop()
 
 	fs.MustStopDirRemover()
 
 	logger.Infof("the VictoriaMetrics has been stopped in %.3f seconds", time.Since(startTime).Seconds())
 }
 
+// checkFlags checks command-line flags and config files referred by them without starting VictoriaMetrics.
+//
+// See `victoria-metrics check-flags` subcommand.
+func checkFlags() *configcheck.Report {
+	var r configcheck.Report
+	if err := getAuthTokenFlagsError(); err != nil {
+		r.AddError("-httpAuth.username", err)
+	}
+	if err := checkMinScrapeInterval(); err != nil {
+		r.AddError("-dedup.minScrapeInterval", err)
+	}
+	vmstorage.CheckFlags(&r)
+	if flag.Lookup("promscrape.config").Value.String() != "" {
+		if err := promscrape.CheckConfig(); err != nil {
+			r.AddError("-promscrape.config", err)
+		} else if ufs, err := promscrape.FindUnsupportedFields(); err != nil {
+			r.AddError("-promscrape.config", err)
+		} else {
+			for _, uf := range ufs {
+				r.AddWarning("-promscrape.config", "unsupported field: %s", uf)
+			}
+		}
+	}
+	if len(*rollupViewsConfig) > 0 {
+		if _, err := loadRollupViews(*rollupViewsConfig); err != nil {
+			r.AddError("-rollupViews.config", err)
+		}
+	}
+	if err := relabel.CheckDropRulesConfig(); err != nil {
+		r.AddError("-dropRulesConfig", err)
+	}
+	common.CheckTimestampLimits(&r)
+	r.AddRedundantFlagWarnings()
+	return &r
+}
+
 func requestHandler(w http.ResponseWriter, r *http.Request) bool {
+	if !checkAuthToken(w, r) {
+		return true
+	}
 	if r.URL.Path == "/" {
 		fmt.Fprintf(w, "<h2>Single-node VictoriaMetrics.</h2></br>")
 		fmt.Fprintf(w, "See docs at <a href='https://victoriametrics.github.io/'>https://victoriametrics.github.io/</a></br>")
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/promql"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/envtemplate"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/VictoriaMetrics/metricsql"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	rollupViewsConfig = flag.String("rollupViews.config", "", "Optional path to file with rollup views. Rollup views are evaluated continuously "+
+		"and their results are stored as regular time series under the given names. "+
+		"See https://victoriametrics.github.io/#rollup-views")
+	rollupViewsEvaluationDelay = flag.Duration("rollupViews.evaluationDelay", 30*time.Second, "Delay for rollup views evaluation. "+
+		"The delay is needed because the most recent samples may be incomplete at the moment of evaluation. See also -search.latencyOffset")
+)
+
+// rollupView is a single entry in -rollupViews.config file.
+type rollupView struct {
+	// Name is the metric name for the stored results.
+	Name string `yaml:"name"`
+
+	// Expr is MetricsQL expression to evaluate.
+	Expr string `yaml:"expr"`
+
+	// Interval is the interval between evaluations.
+	Interval time.Duration `yaml:"interval"`
+
+	// Labels are optional labels to add to the stored results.
+	Labels map[string]string `yaml:"labels,omitempty"`
+
+	evaluations     *metrics.Counter
+	evaluationErrs  *metrics.Counter
+	samplesWritten  *metrics.Counter
+	evaluationDelay time.Duration
+}
+
+func loadRollupViews(path string) ([]*rollupView, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read rollup views from %q: %w", path, err)
+	}
+	data = envtemplate.Replace(data)
+	rvs, err := parseRollupViews(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse rollup views from %q: %w", path, err)
+	}
+	return rvs, nil
+}
+
+func parseRollupViews(data []byte) ([]*rollupView, error) {
+	var rvs []*rollupView
+	if err := yaml.UnmarshalStrict(data, &rvs); err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool, len(rvs))
+	for i, rv := range rvs {
+		if rv == nil {
+			return nil, fmt.Errorf("rollup view #%d cannot be empty", i+1)
+		}
+		if len(rv.Name) == 0 {
+			return nil, fmt.Errorf("missing `name` for rollup view #%d", i+1)
+		}
+		if names[rv.Name] {
+			return nil, fmt.Errorf("duplicate rollup view name %q", rv.Name)
+		}
+		names[rv.Name] = true
+		if _, err := metricsql.Parse(rv.Expr); err != nil {
+			return nil, fmt.Errorf("cannot parse `expr` for rollup view %q: %w", rv.Name, err)
+		}
+		if rv.Interval <= 0 {
+			return nil, fmt.Errorf("`interval` for rollup view %q must be positive; got %s", rv.Name, rv.Interval)
+		}
+		if _, ok := rv.Labels["__name__"]; ok {
+			return nil, fmt.Errorf("`labels` for rollup view %q cannot contain `__name__`; use `name` instead", rv.Name)
+		}
+	}
+	return rvs, nil
+}
+
+var rollupViewsStopCh chan struct{}
+var rollupViewsWG sync.WaitGroup
+
+func startRollupViews() {
+	rollupViewsStopCh = make(chan struct{})
+	if len(*rollupViewsConfig) == 0 {
+		return
+	}
+	rvs, err := loadRollupViews(*rollupViewsConfig)
+	if err != nil {
+		logger.Fatalf("cannot load -rollupViews.config: %s", err)
+	}
+	for _, rv := range rvs {
+		rv.evaluations = metrics.GetOrCreateCounter(fmt.Sprintf(`vm_rollup_view_evaluations_total{view=%q}`, rv.Name))
+		rv.evaluationErrs = metrics.GetOrCreateCounter(fmt.Sprintf(`vm_rollup_view_evaluation_errors_total{view=%q}`, rv.Name))
+		rv.samplesWritten = metrics.GetOrCreateCounter(fmt.Sprintf(`vm_rollup_view_samples_written_total{view=%q}`, rv.Name))
+		rv.evaluationDelay = *rollupViewsEvaluationDelay
+		rollupViewsWG.Add(1)
+		go func(rv *rollupView) {
+			defer rollupViewsWG.Done()
+			rv.run(rollupViewsStopCh)
+		}(rv)
+	}
+	logger.Infof("started %d rollup views from -rollupViews.config=%q", len(rvs), *rollupViewsConfig)
+}
+
+func stopRollupViews() {
+	close(rollupViewsStopCh)
+	rollupViewsWG.Wait()
+}
+
+func (rv *rollupView) run(stopCh <-chan struct{}) {
+	t := time.NewTicker(rv.Interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case currentTime := <-t.C:
+			mrs, err := rv.eval(currentTime)
+			rv.evaluations.Inc()
+			if err != nil {
+				rv.evaluationErrs.Inc()
+				logger.Errorf("cannot evaluate rollup view %q: %s", rv.Name, err)
+				continue
+			}
+			vmstorage.AddRows(mrs)
+			rv.samplesWritten.Add(len(mrs))
+		}
+	}
+}
+
+// eval evaluates rv at the currentTime and returns the rows to store.
+//
+// The evaluation timestamp is shifted by rv.evaluationDelay and is aligned to rv.Interval.
+func (rv *rollupView) eval(currentTime time.Time) ([]storage.MetricRow, error) {
+	step := rv.Interval.Milliseconds()
+	ts := currentTime.Add(-rv.evaluationDelay).UnixNano() / 1e6
+	ts -= ts % step
+	ec := promql.EvalConfig{
+		Start:            ts,
+		End:              ts,
+		Step:             step,
+		QuotedRemoteAddr: strconv.Quote("rollupView:" + rv.Name),
+		Deadline:         searchutils.NewDeadline(currentTime, rv.Interval, "interval in -rollupViews.config"),
+	}
+	result, err := promql.Exec(&ec, rv.Expr, true)
+	if err != nil {
+		return nil, err
+	}
+	var mrs []storage.MetricRow
+	var labels []prompb.Label
+	for i := range result {
+		r := &result[i]
+		if len(r.Values) == 0 || math.IsNaN(r.Values[0]) {
+			continue
+		}
+		labels = rv.appendLabels(labels[:0], &r.MetricName)
+		mrs = append(mrs, storage.MetricRow{
+			MetricNameRaw: storage.MarshalMetricNameRaw(nil, labels),
+			Timestamp:     ts,
+			Value:         r.Values[0],
+		})
+	}
+	return mrs, nil
+}
+
+// appendLabels appends labels for the stored series with the given mn to dst.
+//
+// The metric name is substituted with rv.Name, while rv.Labels override labels from mn.
+func (rv *rollupView) appendLabels(dst []prompb.Label, mn *storage.MetricName) []prompb.Label {
+	dst = addLabel(dst, "", rv.Name)
+	for i := range mn.Tags {
+		tag := &mn.Tags[i]
+		if _, ok := rv.Labels[string(tag.Key)]; ok {
+			continue
+		}
+		dst = append(dst, prompb.Label{
+			Name:  tag.Key,
+			Value: tag.Value,
+		})
+	}
+	for name, value := range rv.Labels {
+		dst = addLabel(dst, name, value)
+	}
+	return dst
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+)
+
+func TestParseRollupViewsSuccess(t *testing.T) {
+	rvs, err := parseRollupViews([]byte(`
+- name: job:requests:rate5m
+  expr: sum(rate(requests_total[5m])) by (job)
+  interval: 1m
+  labels:
+    source: rollup
+- name: up:avg
+  expr: avg(up)
+  interval: 30s
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(rvs) != 2 {
+		t.Fatalf("unexpected number of rollup views; got %d; want 2", len(rvs))
+	}
+	rv := rvs[0]
+	if rv.Name != "job:requests:rate5m" || rv.Interval != time.Minute || rv.Labels["source"] != "rollup" {
+		t.Fatalf("unexpected rollup view: %+v", rv)
+	}
+	if rvs[1].Interval != 30*time.Second {
+		t.Fatalf("unexpected interval; got %s; want 30s", rvs[1].Interval)
+	}
+}
+
+func TestParseRollupViewsFailure(t *testing.T) {
+	f := func(data string) {
+		t.Helper()
+		if _, err := parseRollupViews([]byte(data)); err == nil {
+			t.Fatalf("expecting non-nil error for\n%s", data)
+		}
+	}
+	// Unknown field
+	f(`[{name: foo, expr: up, interval: 1m, foo: bar}]`)
+	// Missing name
+	f(`[{expr: up, interval: 1m}]`)
+	// Duplicate name
+	f(`[{name: foo, expr: up, interval: 1m}, {name: foo, expr: up, interval: 1m}]`)
+	// Invalid expr
+	f(`[{name: foo, expr: "sum(", interval: 1m}]`)
+	// Missing interval
+	f(`[{name: foo, expr: up}]`)
+	// __name__ in labels
+	f(`[{name: foo, expr: up, interval: 1m, labels: {__name__: bar}}]`)
+	// Empty item
+	f(`[null]`)
+}
+
+func TestRollupViewAppendLabels(t *testing.T) {
+	rv := &rollupView{
+		Name: "job:up:avg",
+		Labels: map[string]string{
+			"env": "prod",
+		},
+	}
+	mn := &storage.MetricName{
+		MetricGroup: []byte("up"),
+		Tags: []storage.Tag{
+			{Key: []byte("env"), Value: []byte("dev")},
+			{Key: []byte("job"), Value: []byte("foo")},
+		},
+	}
+	labels := rv.appendLabels(nil, mn)
+	var result []string
+	for _, label := range labels {
+		result = append(result, string(label.Name)+"="+string(label.Value))
+	}
+	resultExpected := []string{"=job:up:avg", "job=foo", "env=prod"}
+	if len(result) != len(resultExpected) {
+		t.Fatalf("unexpected labels; got %q; want %q", result, resultExpected)
+	}
+	for i := range result {
+		if result[i] != resultExpected[i] {
+			t.Fatalf("unexpected labels; got %q; want %q", result, resultExpected)
+		}
+	}
+}
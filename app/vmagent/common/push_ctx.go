@@ -17,6 +17,9 @@ type PushCtx struct {
 
 	// Samples contains flat list of all the samples used in WriteRequest.
 	Samples []prompbmarshal.Sample
+
+	// Exemplars contains flat list of all the exemplars used in WriteRequest.
+	Exemplars []prompbmarshal.Exemplar
 }
 
 // Reset resets ctx.
@@ -26,13 +29,25 @@ func (ctx *PushCtx) Reset() {
 		ts := &tss[i]
 		ts.Labels = nil
 		ts.Samples = nil
+		ts.Exemplars = nil
 	}
 	ctx.WriteRequest.Timeseries = ctx.WriteRequest.Timeseries[:0]
 
+	mms := ctx.WriteRequest.Metadata
+	for i := range mms {
+		mms[i] = prompbmarshal.MetricMetadata{}
+	}
+	ctx.WriteRequest.Metadata = mms[:0]
+
 	promrelabel.CleanLabels(ctx.Labels)
 	ctx.Labels = ctx.Labels[:0]
 
 	ctx.Samples = ctx.Samples[:0]
+
+	for i := range ctx.Exemplars {
+		ctx.Exemplars[i] = prompbmarshal.Exemplar{}
+	}
+	ctx.Exemplars = ctx.Exemplars[:0]
 }
 
 // GetPushCtx returns PushCtx from pool.
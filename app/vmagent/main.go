@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -20,6 +21,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmagent/remotewrite"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmagent/vmimport"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/buildinfo"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/configcheck"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/envflag"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
@@ -31,6 +33,9 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/procutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/common"
+	promremotewriteparser "github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/promremotewrite"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/pushmetrics"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/tracing"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/writeconcurrencylimiter"
 	"github.com/VictoriaMetrics/metrics"
 )
@@ -47,7 +52,7 @@ var (
 		"Usually :4242 must be set. Doesn't work if empty")
 	opentsdbHTTPListenAddr = flag.String("opentsdbHTTPListenAddr", "", "TCP address to listen for OpentTSDB HTTP put requests. Usually :4242 must be set. Doesn't work if empty")
 	dryRun                 = flag.Bool("dryRun", false, "Whether to check only config files without running vmagent. The following files are checked: "+
-		"-promscrape.config, -remoteWrite.relabelConfig, -remoteWrite.urlRelabelConfig . "+
+		"-promscrape.config, -remoteWrite.relabelConfig, -remoteWrite.urlRelabelConfig, -remoteWrite.streamAggr.config . "+
 		"Unknown config entries are allowed in -promscrape.config by default. This can be changed with -promscrape.config.strictParse")
 )
 
@@ -62,11 +67,17 @@ func main() {
 	// Write flags and help message to stdout, since it is easier to grep or pipe.
 	flag.CommandLine.SetOutput(os.Stdout)
 	flag.Usage = usage
+	isCheckConfig := configcheck.IsSubcommand("check-config")
 	envflag.Parse()
 	remotewrite.InitSecretFlags()
 	buildinfo.Init()
 	logger.Init()
 
+	if isCheckConfig {
+		r := checkConfig()
+		r.WriteAndExit()
+	}
+
 	if promscrape.IsDryRun() {
 		if err := promscrape.CheckConfig(); err != nil {
 			logger.Fatalf("error when checking -promscrape.config: %s", err)
@@ -78,6 +89,9 @@ func main() {
 		if err := remotewrite.CheckRelabelConfigs(); err != nil {
 			logger.Fatalf("error when checking relabel configs: %s", err)
 		}
+		if err := remotewrite.CheckStreamAggrConfig(); err != nil {
+			logger.Fatalf("error when checking -remoteWrite.streamAggr.config: %s", err)
+		}
 		if err := promscrape.CheckConfig(); err != nil {
 			logger.Fatalf("error when checking -promscrape.config: %s", err)
 		}
@@ -87,6 +101,8 @@ func main() {
 
 	logger.Infof("starting vmagent at %q...", *httpListenAddr)
 	startTime := time.Now()
+	tracing.Init()
+	pushmetrics.Init()
 	remotewrite.Init()
 	common.StartUnmarshalWorkers()
 	writeconcurrencylimiter.Init()
@@ -112,6 +128,7 @@ func main() {
 
 	sig := procutil.WaitForSigterm()
 	logger.Infof("received signal %s", sig)
+	pushmetrics.Stop()
 
 	startTime = time.Now()
 	if len(*httpListenAddr) > 0 {
@@ -138,10 +155,40 @@ func main() {
 	}
 	common.StopUnmarshalWorkers()
 	remotewrite.Stop()
+	tracing.Stop()
 
 	logger.Infof("successfully stopped vmagent in %.3f seconds", time.Since(startTime).Seconds())
 }
 
+// checkConfig checks config files and command-line flags without starting vmagent.
+//
+// See `vmagent check-config` subcommand.
+func checkConfig() *configcheck.Report {
+	var r configcheck.Report
+	if flag.Lookup("remoteWrite.url").Value.String() == "" {
+		r.AddWarning("-remoteWrite.url", "at least one -remoteWrite.url must be set when running vmagent")
+	}
+	if err := remotewrite.CheckRelabelConfigs(); err != nil {
+		r.AddError("-remoteWrite.relabelConfig", err)
+	}
+	if err := remotewrite.CheckStreamAggrConfig(); err != nil {
+		r.AddError("-remoteWrite.streamAggr.config", err)
+	}
+	if flag.Lookup("promscrape.config").Value.String() != "" {
+		if err := promscrape.CheckConfig(); err != nil {
+			r.AddError("-promscrape.config", err)
+		} else if ufs, err := promscrape.FindUnsupportedFields(); err != nil {
+			r.AddError("-promscrape.config", err)
+		} else {
+			for _, uf := range ufs {
+				r.AddWarning("-promscrape.config", "unsupported field: %s", uf)
+			}
+		}
+	}
+	r.AddRedundantFlagWarnings()
+	return &r
+}
+
 func requestHandler(w http.ResponseWriter, r *http.Request) bool {
 	if r.URL.Path == "/" {
 		fmt.Fprintf(w, "vmagent - see docs at https://victoriametrics.github.io/vmagent.html")
@@ -150,6 +197,10 @@ func requestHandler(w http.ResponseWriter, r *http.Request) bool {
 	path := strings.Replace(r.URL.Path, "//", "/", -1)
 	switch path {
 	case "/api/v1/write":
+		if promremotewriteparser.WriteVMProtoVersion(w, r) {
+			// The client checks whether VictoriaMetrics remote write protocol is supported.
+			return true
+		}
 		prometheusWriteRequests.Inc()
 		if err := promremotewrite.InsertHandler(r); err != nil {
 			prometheusWriteErrors.Inc()
@@ -217,10 +268,40 @@ func requestHandler(w http.ResponseWriter, r *http.Request) bool {
 		promscrapeAPIV1TargetsRequests.Inc()
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
 		state := r.FormValue("state")
-		promscrape.WriteAPIV1Targets(w, state)
+		scrapePool := r.FormValue("scrapePool")
+		promscrape.WriteAPIV1Targets(w, state, scrapePool)
+		return true
+	case "/api/v1/targets/metadata":
+		promscrapeAPIV1TargetsMetadataRequests.Inc()
+		if err := promscrape.WriteAPIV1TargetsMetadata(w, r); err != nil {
+			promscrapeAPIV1TargetsMetadataErrors.Inc()
+			httpserver.Errorf(w, r, "%s", err)
+			return true
+		}
+		return true
+	case "/api/v1/targets/resolved":
+		promscrapeAPIV1TargetsResolvedRequests.Inc()
+		if err := promscrape.WriteAPIV1TargetsResolved(w, r); err != nil {
+			promscrapeAPIV1TargetsResolvedErrors.Inc()
+			httpserver.Errorf(w, r, "%s", err)
+			return true
+		}
+		return true
+	case "/remotewrite/queues":
+		remoteWriteQueuesRequests.Inc()
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		remotewrite.WriteQueuesJSON(w)
+		return true
+	case "/remotewrite/queues/pause", "/remotewrite/queues/resume", "/remotewrite/queues/drop":
+		remoteWriteQueuesControlRequests.Inc()
+		if err := controlRemoteWriteQueue(w, r, path); err != nil {
+			remoteWriteQueuesControlErrors.Inc()
+			httpserver.Errorf(w, r, "error in %q: %s", r.URL.Path, err)
+		}
 		return true
 	case "/-/reload":
 		promscrapeConfigReloadRequests.Inc()
+		httpserver.LogAuditEvent(r, "config_reload", "")
 		procutil.SelfSIGHUP()
 		w.WriteHeader(http.StatusOK)
 		return true
@@ -262,9 +343,48 @@ var (
 	promscrapeTargetsRequests      = metrics.NewCounter(`vmagent_http_requests_total{path="/targets"}`)
 	promscrapeAPIV1TargetsRequests = metrics.NewCounter(`vmagent_http_requests_total{path="/api/v1/targets"}`)
 
+	promscrapeAPIV1TargetsMetadataRequests = metrics.NewCounter(`vmagent_http_requests_total{path="/api/v1/targets/metadata"}`)
+	promscrapeAPIV1TargetsMetadataErrors   = metrics.NewCounter(`vmagent_http_request_errors_total{path="/api/v1/targets/metadata"}`)
+	promscrapeAPIV1TargetsResolvedRequests = metrics.NewCounter(`vmagent_http_requests_total{path="/api/v1/targets/resolved"}`)
+	promscrapeAPIV1TargetsResolvedErrors   = metrics.NewCounter(`vmagent_http_request_errors_total{path="/api/v1/targets/resolved"}`)
+
 	promscrapeConfigReloadRequests = metrics.NewCounter(`vmagent_http_requests_total{path="/-/reload"}`)
+
+	remoteWriteQueuesRequests        = metrics.NewCounter(`vmagent_http_requests_total{path="/remotewrite/queues"}`)
+	remoteWriteQueuesControlRequests = metrics.NewCounter(`vmagent_http_requests_total{path="/remotewrite/queues/*"}`)
+	remoteWriteQueuesControlErrors   = metrics.NewCounter(`vmagent_http_request_errors_total{path="/remotewrite/queues/*"}`)
 )
 
+// controlRemoteWriteQueue pauses, resumes or drops the queue for -remoteWrite.url set via `url` query arg depending on the given path.
+func controlRemoteWriteQueue(w http.ResponseWriter, r *http.Request, path string) error {
+	urlStr := r.FormValue("url")
+	urlIdx, err := strconv.Atoi(urlStr)
+	if err != nil {
+		return fmt.Errorf("cannot parse `url` query arg %q: %w; it must contain 1-based index of -remoteWrite.url", urlStr, err)
+	}
+	var droppedBytes uint64
+	switch path {
+	case "/remotewrite/queues/pause":
+		err = remotewrite.PauseQueue(urlIdx)
+	case "/remotewrite/queues/resume":
+		err = remotewrite.ResumeQueue(urlIdx)
+	default:
+		droppedBytes, err = remotewrite.DropQueue(urlIdx)
+	}
+	if err != nil {
+		return err
+	}
+	action := strings.ReplaceAll(strings.TrimPrefix(path, "/"), "/", "_")
+	httpserver.LogAuditEvent(r, action, "url=%d, droppedBytes=%d", urlIdx, droppedBytes)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if path == "/remotewrite/queues/drop" {
+		fmt.Fprintf(w, `{"status":"success","droppedBytes":%d}`, droppedBytes)
+		return nil
+	}
+	fmt.Fprintf(w, `{"status":"success"}`)
+	return nil
+}
+
 func usage() {
 	const s = `
 vmagent collects metrics data via popular data ingestion protocols and routes it to VictoriaMetrics.
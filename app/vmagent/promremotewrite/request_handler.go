@@ -26,13 +26,13 @@ func InsertHandler(req *http.Request) error {
 		return err
 	}
 	return writeconcurrencylimiter.Do(func() error {
-		return parser.ParseStream(req, func(tss []prompb.TimeSeries) error {
-			return insertRows(tss, extraLabels)
+		return parser.ParseStream(req, func(tss []prompb.TimeSeries, mms []prompb.MetricMetadata) error {
+			return insertRows(tss, mms, extraLabels)
 		})
 	})
 }
 
-func insertRows(timeseries []prompb.TimeSeries, extraLabels []prompbmarshal.Label) error {
+func insertRows(timeseries []prompb.TimeSeries, mms []prompb.MetricMetadata, extraLabels []prompbmarshal.Label) error {
 	ctx := common.GetPushCtx()
 	defer common.PutPushCtx(ctx)
 
@@ -40,6 +40,7 @@ func insertRows(timeseries []prompb.TimeSeries, extraLabels []prompbmarshal.Labe
 	tssDst := ctx.WriteRequest.Timeseries[:0]
 	labels := ctx.Labels[:0]
 	samples := ctx.Samples[:0]
+	exemplars := ctx.Exemplars[:0]
 	for i := range timeseries {
 		ts := &timeseries[i]
 		rowsTotal += len(ts.Samples)
@@ -60,14 +61,44 @@ func insertRows(timeseries []prompb.TimeSeries, extraLabels []prompbmarshal.Labe
 				Timestamp: sample.Timestamp,
 			})
 		}
+		exemplarsLen := len(exemplars)
+		for i := range ts.Exemplars {
+			exemplar := &ts.Exemplars[i]
+			exemplarLabelsLen := len(labels)
+			for j := range exemplar.Labels {
+				label := &exemplar.Labels[j]
+				labels = append(labels, prompbmarshal.Label{
+					Name:  bytesutil.ToUnsafeString(label.Name),
+					Value: bytesutil.ToUnsafeString(label.Value),
+				})
+			}
+			exemplars = append(exemplars, prompbmarshal.Exemplar{
+				Labels:    labels[exemplarLabelsLen:],
+				Value:     exemplar.Value,
+				Timestamp: exemplar.Timestamp,
+			})
+		}
 		tssDst = append(tssDst, prompbmarshal.TimeSeries{
-			Labels:  labels[labelsLen:],
-			Samples: samples[samplesLen:],
+			Labels:    labels[labelsLen : labelsLen+len(ts.Labels)+len(extraLabels)],
+			Samples:   samples[samplesLen:],
+			Exemplars: exemplars[exemplarsLen:],
 		})
 	}
 	ctx.WriteRequest.Timeseries = tssDst
+	mmsDst := ctx.WriteRequest.Metadata[:0]
+	for i := range mms {
+		mm := &mms[i]
+		mmsDst = append(mmsDst, prompbmarshal.MetricMetadata{
+			Type:             prompbmarshal.MetricMetadata_MetricType(mm.Type),
+			MetricFamilyName: bytesutil.ToUnsafeString(mm.MetricFamilyName),
+			Help:             bytesutil.ToUnsafeString(mm.Help),
+			Unit:             bytesutil.ToUnsafeString(mm.Unit),
+		})
+	}
+	ctx.WriteRequest.Metadata = mmsDst
 	ctx.Labels = labels
 	ctx.Samples = samples
+	ctx.Exemplars = exemplars
 	remotewrite.Push(&ctx.WriteRequest)
 	rowsInserted.Add(rowsTotal)
 	rowsPerInsert.Update(float64(rowsTotal))
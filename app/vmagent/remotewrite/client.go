@@ -4,20 +4,27 @@ import (
 	"bytes"
 	"crypto/tls"
 	"encoding/base64"
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding/zstd"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/persistentqueue"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timerpool"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/tracing"
 	"github.com/VictoriaMetrics/metrics"
+	"github.com/golang/snappy"
 )
 
 var (
@@ -37,6 +44,16 @@ var (
 		"By default system CA is used. If multiple args are set, then they are applied independently for the corresponding -remoteWrite.url")
 	tlsServerName = flagutil.NewArray("remoteWrite.tlsServerName", "Optional TLS server name to use for connections to -remoteWrite.url. "+
 		"By default the server name from -remoteWrite.url is used. If multiple args are set, then they are applied independently for the corresponding -remoteWrite.url")
+	spiffeWorkloadAPISocket = flagutil.NewArray("remoteWrite.spiffeWorkloadAPISocket", "Optional path to SPIFFE Workload API unix socket such as /run/spire/sockets/agent.sock "+
+		"for obtaining auto-rotated client certificate and trust bundle to use when connecting to -remoteWrite.url. "+
+		"See https://victoriametrics.github.io/vmagent.html#workload-identity . If multiple args are set, then they are applied independently for the corresponding -remoteWrite.url")
+	consulConnectService = flagutil.NewArray("remoteWrite.consulConnect.service", "Optional service name for obtaining auto-rotated client certificate and trust bundle "+
+		"from Consul Connect to use when connecting to -remoteWrite.url. See https://victoriametrics.github.io/vmagent.html#workload-identity . "+
+		"If multiple args are set, then they are applied independently for the corresponding -remoteWrite.url")
+	consulConnectServer = flagutil.NewArray("remoteWrite.consulConnect.server", "Optional Consul agent address for -remoteWrite.consulConnect.service. By default localhost:8500 is used. "+
+		"If multiple args are set, then they are applied independently for the corresponding -remoteWrite.url")
+	consulConnectToken = flagutil.NewArray("remoteWrite.consulConnect.token", "Optional Consul ACL token for -remoteWrite.consulConnect.service. "+
+		"If multiple args are set, then they are applied independently for the corresponding -remoteWrite.url")
 
 	basicAuthUsername = flagutil.NewArray("remoteWrite.basicAuth.username", "Optional basic auth username to use for -remoteWrite.url. "+
 		"If multiple args are set, then they are applied independently for the corresponding -remoteWrite.url")
@@ -44,6 +61,28 @@ var (
 		"If multiple args are set, then they are applied independently for the corresponding -remoteWrite.url")
 	bearerToken = flagutil.NewArray("remoteWrite.bearerToken", "Optional bearer auth token to use for -remoteWrite.url. "+
 		"If multiple args are set, then they are applied independently for the corresponding -remoteWrite.url")
+
+	adaptiveConcurrency = flagutil.NewArrayBool("remoteWrite.adaptiveConcurrency", "Whether to adjust the number of concurrent requests to the corresponding -remoteWrite.url "+
+		"depending on the remote storage response latency and errors. The number of concurrent requests is limited by -remoteWrite.queues in this case. "+
+		"See https://victoriametrics.github.io/vmagent.html#adaptive-concurrency")
+	adaptiveConcurrencyTargetLatency = flagutil.NewArrayDuration("remoteWrite.adaptiveConcurrency.targetLatency", "Optional target latency for requests "+
+		"to the corresponding -remoteWrite.url if -remoteWrite.adaptiveConcurrency is set. The number of concurrent requests is decreased when the latency exceeds this value. "+
+		"By default only errors, 429 and 5xx responses lead to the decrease")
+
+	forcePromProto = flagutil.NewArrayBool("remoteWrite.forcePromProto", "Whether to force Prometheus remote write protocol for sending data "+
+		"to the corresponding -remoteWrite.url . See https://victoriametrics.github.io/vmagent.html#victoriametrics-remote-write-protocol")
+	forceVMProto = flagutil.NewArrayBool("remoteWrite.forceVMProto", "Whether to force VictoriaMetrics remote write protocol for sending data "+
+		"to the corresponding -remoteWrite.url . See https://victoriametrics.github.io/vmagent.html#victoriametrics-remote-write-protocol")
+	vmProtoCompressLevel = flag.Int("remoteWrite.vmProtoCompressLevel", 0, "The compression level for VictoriaMetrics remote write protocol. "+
+		"Higher values reduce network traffic at the cost of higher CPU usage. Negative values reduce CPU usage at the cost of increased network traffic. "+
+		"See https://victoriametrics.github.io/vmagent.html#victoriametrics-remote-write-protocol")
+
+	maxBlockAge = flagutil.NewArrayDuration("remoteWrite.maxBlockAge", "Optional maximum age for the buffered data before sending it to the corresponding -remoteWrite.url. "+
+		"Blocks with the newest sample older than this age are dropped instead of sending them. By default the buffered data is sent regardless of its age. "+
+		"See https://victoriametrics.github.io/vmagent.html#dropping-stale-buffered-data")
+	maxRetries = flagutil.NewArrayInt("remoteWrite.maxRetries", "Optional maximum number of retries for sending a block of data to the corresponding -remoteWrite.url. "+
+		"The block is dropped after the given number of unsuccessful retries. By default the number of retries is unlimited. "+
+		"See https://victoriametrics.github.io/vmagent.html#dropping-stale-buffered-data")
 )
 
 type client struct {
@@ -53,8 +92,27 @@ type client struct {
 	fq             *persistentqueue.FastQueue
 	hc             *http.Client
 
+	// maxBlockAge is the maximum age for blocks to send. Older blocks are dropped. Zero value disables the limit.
+	maxBlockAge time.Duration
+
+	// maxRetries is the maximum number of retries for sending a block. Zero value disables the limit.
+	maxRetries int
+
 	rl rateLimiter
 
+	// cl limits the number of concurrent requests to remote storage if -remoteWrite.adaptiveConcurrency is set.
+	cl *concurrencyLimiter
+
+	// isVMProto is set to 1 if the remote storage supports VictoriaMetrics remote write protocol.
+	isVMProto uint32
+
+	// sl limits the number of samples and labels per request to remote storage.
+	sl *sendLimits
+
+	// tenantLabel is the label for obtaining tenant for the sent block. Empty value disables passing tenant in tenantHeader.
+	tenantLabel  string
+	tenantHeader string
+
 	bytesSent       *metrics.Counter
 	blocksSent      *metrics.Counter
 	requestDuration *metrics.Histogram
@@ -62,6 +120,15 @@ type client struct {
 	errorsCount     *metrics.Counter
 	packetsDropped  *metrics.Counter
 	retriesCount    *metrics.Counter
+	blocksSplit     *metrics.Counter
+
+	// readOnlyRetriesCount is the number of retries because of 507 responses from remote storage in read-only mode.
+	readOnlyRetriesCount *metrics.Counter
+
+	blocksDroppedMaxBlockAge  *metrics.Counter
+	samplesDroppedMaxBlockAge *metrics.Counter
+	blocksDroppedMaxRetries   *metrics.Counter
+	samplesDroppedMaxRetries  *metrics.Counter
 
 	wg     sync.WaitGroup
 	stopCh chan struct{}
@@ -117,21 +184,35 @@ func newClient(argIdx int, remoteWriteURL, sanitizedURL string, fq *persistentqu
 			Transport: tr,
 			Timeout:   sendTimeout.GetOptionalArgOrDefault(argIdx, time.Minute),
 		},
-		stopCh: make(chan struct{}),
+		maxBlockAge: maxBlockAge.GetOptionalArgOrDefault(argIdx, 0),
+		maxRetries:  maxRetries.GetOptionalArgOrDefault(argIdx, 0),
+		sl:          newSendLimits(argIdx, sanitizedURL),
+		tenantLabel: tenantLabels.GetOptionalArg(argIdx),
+		stopCh:      make(chan struct{}),
+	}
+	if c.tenantLabel != "" {
+		c.tenantHeader = tenantHeaders.GetOptionalArg(argIdx)
+		if c.tenantHeader == "" {
+			c.tenantHeader = "X-Scope-OrgID"
+		}
+		logger.Infof("splitting series per tenant by %q label for -remoteWrite.url=%q; the tenant is passed in %q header", c.tenantLabel, sanitizedURL, c.tenantHeader)
 	}
 	if bytesPerSec := rateLimit.GetOptionalArgOrDefault(argIdx, 0); bytesPerSec > 0 {
 		logger.Infof("applying %d bytes per second rate limit for -remoteWrite.url=%q", bytesPerSec, sanitizedURL)
 		c.rl.perSecondLimit = int64(bytesPerSec)
 	}
-	c.rl.limitReached = metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_remote_write_rate_limit_reached_total{url=%q}`, c.sanitizedURL))
-
-	c.bytesSent = metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_remotewrite_bytes_sent_total{url=%q}`, c.sanitizedURL))
-	c.blocksSent = metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_remotewrite_blocks_sent_total{url=%q}`, c.sanitizedURL))
-	c.requestDuration = metrics.GetOrCreateHistogram(fmt.Sprintf(`vmagent_remotewrite_duration_seconds{url=%q}`, c.sanitizedURL))
-	c.requestsOKCount = metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_remotewrite_requests_total{url=%q, status_code="2XX"}`, c.sanitizedURL))
-	c.errorsCount = metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_remotewrite_errors_total{url=%q}`, c.sanitizedURL))
-	c.packetsDropped = metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_remotewrite_packets_dropped_total{url=%q}`, c.sanitizedURL))
-	c.retriesCount = metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_remotewrite_retries_count_total{url=%q}`, c.sanitizedURL))
+	c.initMetrics()
+	if adaptiveConcurrency.GetOptionalArg(argIdx) {
+		targetLatency := adaptiveConcurrencyTargetLatency.GetOptionalArgOrDefault(argIdx, 0)
+		logger.Infof("enabling adaptive concurrency for -remoteWrite.url=%q with the maximum concurrency %d and the target latency %s",
+			c.sanitizedURL, concurrency, targetLatency)
+		c.cl = newConcurrencyLimiter(concurrency, targetLatency)
+		_ = metrics.GetOrCreateGauge(fmt.Sprintf(`vmagent_remotewrite_concurrency_limit{url=%q}`, c.sanitizedURL), func() float64 {
+			return float64(c.cl.getLimit())
+		})
+		c.cl.limitDecreases = metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_remotewrite_concurrency_limit_decreases_total{url=%q}`, c.sanitizedURL))
+	}
+	c.initVMProto(argIdx)
 	for i := 0; i < concurrency; i++ {
 		c.wg.Add(1)
 		go func() {
@@ -143,8 +224,28 @@ func newClient(argIdx int, remoteWriteURL, sanitizedURL string, fq *persistentqu
 	return c
 }
 
+func (c *client) initMetrics() {
+	c.rl.limitReached = metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_remote_write_rate_limit_reached_total{url=%q}`, c.sanitizedURL))
+	c.bytesSent = metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_remotewrite_bytes_sent_total{url=%q}`, c.sanitizedURL))
+	c.blocksSent = metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_remotewrite_blocks_sent_total{url=%q}`, c.sanitizedURL))
+	c.requestDuration = metrics.GetOrCreateHistogram(fmt.Sprintf(`vmagent_remotewrite_duration_seconds{url=%q}`, c.sanitizedURL))
+	c.requestsOKCount = metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_remotewrite_requests_total{url=%q, status_code="2XX"}`, c.sanitizedURL))
+	c.errorsCount = metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_remotewrite_errors_total{url=%q}`, c.sanitizedURL))
+	c.packetsDropped = metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_remotewrite_packets_dropped_total{url=%q}`, c.sanitizedURL))
+	c.retriesCount = metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_remotewrite_retries_count_total{url=%q}`, c.sanitizedURL))
+	c.readOnlyRetriesCount = metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_remotewrite_read_only_retries_total{url=%q}`, c.sanitizedURL))
+	c.blocksSplit = metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_remotewrite_blocks_split_total{url=%q}`, c.sanitizedURL))
+	c.blocksDroppedMaxBlockAge = metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_remotewrite_blocks_dropped_total{url=%q, reason="max_block_age"}`, c.sanitizedURL))
+	c.samplesDroppedMaxBlockAge = metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_remotewrite_samples_dropped_total{url=%q, reason="max_block_age"}`, c.sanitizedURL))
+	c.blocksDroppedMaxRetries = metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_remotewrite_blocks_dropped_total{url=%q, reason="max_retries"}`, c.sanitizedURL))
+	c.samplesDroppedMaxRetries = metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_remotewrite_samples_dropped_total{url=%q, reason="max_retries"}`, c.sanitizedURL))
+}
+
 func (c *client) MustStop() {
 	close(c.stopCh)
+	if c.cl != nil {
+		c.cl.unblockAll()
+	}
 	c.wg.Wait()
 	logger.Infof("stopped client for -remoteWrite.url=%q", c.sanitizedURL)
 }
@@ -156,8 +257,18 @@ func getTLSConfig(argIdx int) (*tls.Config, error) {
 		KeyFile:            tlsKeyFile.GetOptionalArg(argIdx),
 		ServerName:         tlsServerName.GetOptionalArg(argIdx),
 		InsecureSkipVerify: tlsInsecureSkipVerify.GetOptionalArg(argIdx),
+
+		SPIFFEWorkloadAPISocket: spiffeWorkloadAPISocket.GetOptionalArg(argIdx),
+	}
+	if service := consulConnectService.GetOptionalArg(argIdx); service != "" {
+		c.ConsulConnect = &promauth.ConsulConnectConfig{
+			Server:  consulConnectServer.GetOptionalArg(argIdx),
+			Service: service,
+			Token:   consulConnectToken.GetOptionalArg(argIdx),
+		}
 	}
-	if c.CAFile == "" && c.CertFile == "" && c.KeyFile == "" && c.ServerName == "" && !c.InsecureSkipVerify {
+	if c.CAFile == "" && c.CertFile == "" && c.KeyFile == "" && c.ServerName == "" && !c.InsecureSkipVerify &&
+		c.SPIFFEWorkloadAPISocket == "" && c.ConsulConnect == nil {
 		return nil, nil
 	}
 	cfg, err := promauth.NewConfig(".", nil, "", "", c)
@@ -173,8 +284,12 @@ func (c *client) runWorker() {
 	var block []byte
 	ch := make(chan bool, 1)
 	for {
+		if !c.cl.acquire() {
+			return
+		}
 		block, ok = c.fq.MustReadBlock(block[:0])
 		if !ok {
+			c.cl.release()
 			return
 		}
 		go func() {
@@ -182,6 +297,7 @@ func (c *client) runWorker() {
 		}()
 		select {
 		case ok := <-ch:
+			c.cl.release()
 			if ok {
 				// The block has been sent successfully
 				continue
@@ -190,6 +306,7 @@ func (c *client) runWorker() {
 			c.fq.MustWriteBlock(block)
 			return
 		case <-c.stopCh:
+			c.cl.release()
 			// c must be stopped. Wait for a while in the hope the block will be sent.
 			graceDuration := 5 * time.Second
 			select {
@@ -208,13 +325,32 @@ func (c *client) runWorker() {
 }
 
 // sendBlock returns false only if c.stopCh is closed.
-// Otherwise it tries sending the block to remote storage indefinitely.
+// Otherwise it tries sending the block to remote storage until success or until the block is dropped
+// because of c.maxBlockAge or c.maxRetries limits.
 func (c *client) sendBlock(block []byte) bool {
+	// Obtain block stats only once, since decoding the block may be expensive.
+	// The stats are re-used during retries.
+	bs, err := getBlockStats(block)
+	if err != nil {
+		// The block may be corrupted in the persistent queue, e.g. after unclean shutdown or disk errors.
+		// It cannot be sent to remote storage, so drop it instead of retrying it forever.
+		logger.Errorf("dropping invalid block with size %d bytes for %q: %s", len(block), c.sanitizedURL, err)
+		c.packetsDropped.Inc()
+		return true
+	}
+	if c.isTooOldBlock(&bs) {
+		c.dropTooOldBlock(block, &bs)
+		return true
+	}
 	c.rl.register(len(block), c.stopCh)
 	retryDuration := time.Second
 	retriesCount := 0
 	c.bytesSent.Add(len(block))
 	c.blocksSent.Inc()
+	tenant := ""
+	if c.tenantLabel != "" {
+		tenant, _ = getBlockTenant(block, c.tenantLabel)
+	}
 
 again:
 	req, err := http.NewRequest("POST", c.remoteWriteURL, bytes.NewBuffer(block))
@@ -224,17 +360,44 @@ again:
 	h := req.Header
 	h.Set("User-Agent", "vmagent")
 	h.Set("Content-Type", "application/x-protobuf")
-	h.Set("Content-Encoding", "snappy")
+	if isZstdBlock(block) {
+		h.Set("Content-Encoding", "zstd")
+	} else {
+		h.Set("Content-Encoding", "snappy")
+	}
 	h.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
 	if c.authHeader != "" {
 		req.Header.Set("Authorization", c.authHeader)
 	}
+	if tenant != "" {
+		h.Set(c.tenantHeader, tenant)
+	}
+
+	span := tracing.StartClientSpan("remotewrite.send")
+	span.SetAttribute("url", c.sanitizedURL)
+	span.SetIntAttribute("block_size_bytes", int64(len(block)))
+	span.SetIntAttribute("retries", int64(retriesCount))
+	span.InjectHeader(h)
 
 	startTime := time.Now()
 	resp, err := c.hc.Do(req)
 	c.requestDuration.UpdateDuration(startTime)
+	if err != nil {
+		span.SetError(err)
+	} else {
+		span.SetIntAttribute("http.status_code", int64(resp.StatusCode))
+		if resp.StatusCode/100 != 2 {
+			span.SetError(fmt.Errorf("unexpected status code %d", resp.StatusCode))
+		}
+	}
+	span.End()
 	if err != nil {
 		c.errorsCount.Inc()
+		c.cl.registerOverload()
+		retriesCount++
+		if c.mustDropBlockOnRetry(block, &bs, retriesCount) {
+			return true
+		}
 		retryDuration *= 2
 		if retryDuration > time.Minute {
 			retryDuration = time.Minute
@@ -256,9 +419,52 @@ again:
 	if statusCode/100 == 2 {
 		_ = resp.Body.Close()
 		c.requestsOKCount.Inc()
+		c.cl.registerSuccess(time.Since(startTime))
+		c.sl.registerSuccess()
 		return true
 	}
+	if statusCode == 429 || statusCode/100 == 5 {
+		// The remote storage is overloaded.
+		c.cl.registerOverload()
+	}
 	metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_remotewrite_requests_total{url=%q, status_code="%d"}`, c.sanitizedURL, statusCode)).Inc()
+	if statusCode == 415 && isZstdBlock(block) {
+		// The remote storage doesn't support VictoriaMetrics remote write protocol anymore.
+		// Switch to Prometheus remote write protocol and re-send the block with snappy compression.
+		_ = resp.Body.Close()
+		atomic.StoreUint32(&c.isVMProto, 0)
+		logger.Warnf("the remote storage at %q doesn't support VictoriaMetrics remote write protocol; switching to Prometheus remote write protocol", c.sanitizedURL)
+		b, err := repackZstdBlockToSnappy(block)
+		if err != nil {
+			logger.Errorf("dropping a block with size %d bytes for %q: %s", len(block), c.sanitizedURL, err)
+			c.packetsDropped.Inc()
+			return true
+		}
+		block = b
+		goto again
+	}
+	if statusCode == http.StatusRequestEntityTooLarge {
+		// The block exceeds request size limits at the remote storage.
+		// Decrease the number of samples per request for the subsequent blocks
+		// and return the block to the queue in smaller parts.
+		body, _ := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		c.sl.registerTooLarge()
+		ok, err := splitBlock(block, c.fq.MustWriteBlock)
+		if err != nil {
+			logger.Errorf("dropping a block with size %d bytes for %q: %s", len(block), c.sanitizedURL, err)
+			c.packetsDropped.Inc()
+			return true
+		}
+		if ok {
+			c.blocksSplit.Inc()
+			return true
+		}
+		logger.Errorf("dropping a block with size %d bytes, since %q responds with %d status code to it and the block cannot be split further; "+
+			"response body=%q", len(block), c.sanitizedURL, statusCode, body)
+		c.packetsDropped.Inc()
+		return true
+	}
 	if statusCode == 409 {
 		// Just drop block on 409 status code like Prometheus does.
 		// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/873
@@ -272,6 +478,21 @@ again:
 
 	// Unexpected status code returned
 	retriesCount++
+	if statusCode == http.StatusInsufficientStorage {
+		// The remote storage is in read-only mode because of low free disk space.
+		// Do not drop the block according to -remoteWrite.maxRetries, since the remote storage
+		// automatically switches back to read-write mode when free disk space becomes available.
+		// The block remains buffered until then.
+		c.readOnlyRetriesCount.Inc()
+		if c.isTooOldBlock(&bs) {
+			_ = resp.Body.Close()
+			c.dropTooOldBlock(block, &bs)
+			return true
+		}
+	} else if c.mustDropBlockOnRetry(block, &bs, retriesCount) {
+		_ = resp.Body.Close()
+		return true
+	}
 	retryDuration *= 2
 	if retryDuration > time.Minute {
 		retryDuration = time.Minute
@@ -296,6 +517,180 @@ again:
 	goto again
 }
 
+// mustDropBlockOnRetry returns true if the block must be dropped after the given number of unsuccessful retries
+// because of c.maxBlockAge or c.maxRetries limits.
+func (c *client) mustDropBlockOnRetry(block []byte, bs *blockStats, retriesCount int) bool {
+	if c.isTooOldBlock(bs) {
+		c.dropTooOldBlock(block, bs)
+		return true
+	}
+	if c.maxRetries > 0 && retriesCount > c.maxRetries {
+		logger.Errorf("dropping a block with size %d bytes and %d samples after %d unsuccessful retries for sending it to %q according to -remoteWrite.maxRetries=%d",
+			len(block), bs.samples, retriesCount-1, c.sanitizedURL, c.maxRetries)
+		c.blocksDroppedMaxRetries.Inc()
+		c.samplesDroppedMaxRetries.Add(bs.samples)
+		return true
+	}
+	return false
+}
+
+// isTooOldBlock returns true if the newest sample in the block with the given stats is older than c.maxBlockAge.
+func (c *client) isTooOldBlock(bs *blockStats) bool {
+	if c.maxBlockAge <= 0 {
+		return false
+	}
+	if bs.maxTimestamp == 0 {
+		// The block doesn't contain samples.
+		return false
+	}
+	minTimestamp := time.Now().Add(-c.maxBlockAge).UnixNano() / 1e6
+	return bs.maxTimestamp < minTimestamp
+}
+
+func (c *client) dropTooOldBlock(block []byte, bs *blockStats) {
+	logger.Errorf("dropping a block with size %d bytes and %d samples for %q, since it is older than -remoteWrite.maxBlockAge=%s",
+		len(block), bs.samples, c.sanitizedURL, c.maxBlockAge)
+	c.blocksDroppedMaxBlockAge.Inc()
+	c.samplesDroppedMaxBlockAge.Add(bs.samples)
+}
+
+// blockStats contains stats for the block sent to remote storage.
+type blockStats struct {
+	// samples is the number of samples in the block.
+	samples int
+
+	// maxTimestamp is the maximum timestamp in milliseconds for samples in the block.
+	maxTimestamp int64
+}
+
+// getBlockStats returns stats for the given block.
+//
+// The block must contain snappy-compressed or zstd-compressed WriteRequest.
+func getBlockStats(block []byte) (blockStats, error) {
+	var bs blockStats
+	bb := blockStatsBufPool.Get()
+	defer blockStatsBufPool.Put(bb)
+	var err error
+	bb.B, err = decompressBlock(bb.B, block)
+	if err != nil {
+		return bs, err
+	}
+	wr := blockStatsWriteRequestPool.Get().(*prompb.WriteRequest)
+	defer func() {
+		wr.Reset()
+		blockStatsWriteRequestPool.Put(wr)
+	}()
+	if err := wr.Unmarshal(bb.B); err != nil {
+		return bs, fmt.Errorf("cannot unmarshal WriteRequest from block with size %d bytes: %w", len(bb.B), err)
+	}
+	for _, ts := range wr.Timeseries {
+		bs.samples += len(ts.Samples)
+		for _, s := range ts.Samples {
+			if s.Timestamp > bs.maxTimestamp {
+				bs.maxTimestamp = s.Timestamp
+			}
+		}
+	}
+	return bs, nil
+}
+
+var blockStatsBufPool bytesutil.ByteBufferPool
+
+// initVMProto determines whether to use VictoriaMetrics remote write protocol for sending data to c.
+func (c *client) initVMProto(argIdx int) {
+	if forcePromProto.GetOptionalArg(argIdx) {
+		return
+	}
+	if forceVMProto.GetOptionalArg(argIdx) {
+		atomic.StoreUint32(&c.isVMProto, 1)
+		return
+	}
+	if !c.checkVMProto() {
+		logger.Infof("using Prometheus remote write protocol for sending data to -remoteWrite.url=%q", c.sanitizedURL)
+		return
+	}
+	logger.Infof("using VictoriaMetrics remote write protocol for sending data to -remoteWrite.url=%q", c.sanitizedURL)
+	atomic.StoreUint32(&c.isVMProto, 1)
+}
+
+// checkVMProto returns true if the remote storage supports VictoriaMetrics remote write protocol.
+func (c *client) checkVMProto() bool {
+	u := c.remoteWriteURL
+	if strings.Contains(u, "?") {
+		u += "&"
+	} else {
+		u += "?"
+	}
+	u += "get_vm_proto_version=1"
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		logger.Panicf("BUG: unexected error from http.NewRequest(%q): %s", c.sanitizedURL, err)
+	}
+	req.Header.Set("User-Agent", "vmagent")
+	if c.authHeader != "" {
+		req.Header.Set("Authorization", c.authHeader)
+	}
+	resp, err := c.hc.Do(req)
+	if err != nil {
+		logger.Errorf("cannot check whether VictoriaMetrics remote write protocol is supported by -remoteWrite.url=%q: %s", c.sanitizedURL, err)
+		return false
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return false
+	}
+	return string(body) == "1"
+}
+
+// useVMProto returns true if the data must be sent to c via VictoriaMetrics remote write protocol.
+func (c *client) useVMProto() bool {
+	return atomic.LoadUint32(&c.isVMProto) != 0
+}
+
+// zstdMagic is the magic number at the start of zstd frames.
+//
+// Snappy-compressed blocks cannot start with these bytes, since they must start with the literal after the length header.
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+func isZstdBlock(block []byte) bool {
+	return bytes.HasPrefix(block, zstdMagic)
+}
+
+// decompressBlock decompresses the block into dst buffer and returns the result.
+//
+// The block is read from the persistent queue, so it may be corrupted.
+func decompressBlock(dst, block []byte) ([]byte, error) {
+	var err error
+	if isZstdBlock(block) {
+		dst, err = zstd.Decompress(dst[:0], block)
+	} else {
+		dst, err = snappy.Decode(dst[:cap(dst)], block)
+	}
+	if err != nil {
+		return dst, fmt.Errorf("cannot decompress block with size %d bytes: %w", len(block), err)
+	}
+	return dst, nil
+}
+
+// repackZstdBlockToSnappy converts zstd-compressed block to snappy-compressed block.
+func repackZstdBlockToSnappy(block []byte) ([]byte, error) {
+	bb := blockStatsBufPool.Get()
+	defer blockStatsBufPool.Put(bb)
+	var err error
+	bb.B, err = decompressBlock(bb.B, block)
+	if err != nil {
+		return nil, err
+	}
+	return snappy.Encode(nil, bb.B), nil
+}
+
+var blockStatsWriteRequestPool = &sync.Pool{
+	New: func() interface{} {
+		return &prompb.WriteRequest{}
+	},
+}
+
 type rateLimiter struct {
 	perSecondLimit int64
 
@@ -331,3 +726,128 @@ func (rl *rateLimiter) register(dataLen int, stopCh <-chan struct{}) {
 	}
 	rl.budget -= int64(dataLen)
 }
+
+// concurrencyLimiter limits the number of concurrent requests to remote storage.
+//
+// It adjusts the limit according to AIMD algorithm: the limit is increased by one after every limit successful requests
+// and it is halved on errors, 429 or 5xx responses and requests exceeding targetLatency.
+//
+// All the methods are no-op for nil concurrencyLimiter.
+type concurrencyLimiter struct {
+	mu   sync.Mutex
+	cond sync.Cond
+
+	maxLimit      int
+	targetLatency time.Duration
+
+	limit     int
+	active    int
+	successes int
+
+	// lastDecreaseTime is the last time the limit has been decreased.
+	// It is used for preventing from multiple decreases on simultaneous errors from concurrent requests.
+	lastDecreaseTime time.Time
+
+	mustStop bool
+
+	limitDecreases *metrics.Counter
+}
+
+func newConcurrencyLimiter(maxLimit int, targetLatency time.Duration) *concurrencyLimiter {
+	cl := &concurrencyLimiter{
+		maxLimit:      maxLimit,
+		targetLatency: targetLatency,
+		limit:         maxLimit,
+	}
+	cl.cond.L = &cl.mu
+	return cl
+}
+
+// acquire blocks until the number of active requests becomes smaller than the limit.
+//
+// It returns false if cl is stopped.
+func (cl *concurrencyLimiter) acquire() bool {
+	if cl == nil {
+		return true
+	}
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	for cl.active >= cl.limit && !cl.mustStop {
+		cl.cond.Wait()
+	}
+	if cl.mustStop {
+		return false
+	}
+	cl.active++
+	return true
+}
+
+// release must be called after the request acquired with acquire is complete.
+func (cl *concurrencyLimiter) release() {
+	if cl == nil {
+		return
+	}
+	cl.mu.Lock()
+	cl.active--
+	cl.cond.Signal()
+	cl.mu.Unlock()
+}
+
+func (cl *concurrencyLimiter) unblockAll() {
+	cl.mu.Lock()
+	cl.mustStop = true
+	cl.cond.Broadcast()
+	cl.mu.Unlock()
+}
+
+func (cl *concurrencyLimiter) getLimit() int {
+	cl.mu.Lock()
+	n := cl.limit
+	cl.mu.Unlock()
+	return n
+}
+
+// registerSuccess registers successful request with the given duration.
+func (cl *concurrencyLimiter) registerSuccess(d time.Duration) {
+	if cl == nil {
+		return
+	}
+	if cl.targetLatency > 0 && d > cl.targetLatency {
+		cl.registerOverload()
+		return
+	}
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	cl.successes++
+	if cl.successes < cl.limit || cl.limit >= cl.maxLimit {
+		return
+	}
+	// Additive increase.
+	cl.successes = 0
+	cl.limit++
+	cl.cond.Signal()
+}
+
+// registerOverload registers a sign of remote storage overload such as error, 429 or 5xx response or too big latency.
+func (cl *concurrencyLimiter) registerOverload() {
+	if cl == nil {
+		return
+	}
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	cl.successes = 0
+	now := time.Now()
+	if now.Sub(cl.lastDecreaseTime) < time.Second {
+		return
+	}
+	cl.lastDecreaseTime = now
+	if cl.limit <= 1 {
+		return
+	}
+	// Multiplicative decrease.
+	cl.limit /= 2
+	cl.limitDecreases.Inc()
+}
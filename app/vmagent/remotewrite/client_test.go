@@ -0,0 +1,497 @@
+package remotewrite
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding/zstd"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/golang/snappy"
+)
+
+func TestCheckVMProto(t *testing.T) {
+	f := func(statusCode int, body string, resultExpected bool) {
+		t.Helper()
+		var query string
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query = r.URL.RawQuery
+			w.WriteHeader(statusCode)
+			fmt.Fprintf(w, "%s", body)
+		}))
+		defer s.Close()
+
+		c := newTestClient(s.URL + "/api/v1/write?extra_label=foo=bar")
+		c.initVMProto(0)
+		if c.useVMProto() != resultExpected {
+			t.Fatalf("unexpected useVMProto result; got %v; want %v", c.useVMProto(), resultExpected)
+		}
+		if query != "extra_label=foo=bar&get_vm_proto_version=1" {
+			t.Fatalf("unexpected query string: %q", query)
+		}
+	}
+
+	// The remote storage supports VictoriaMetrics remote write protocol.
+	f(200, "1", true)
+
+	// The remote storage doesn't support VictoriaMetrics remote write protocol.
+	f(200, "", false)
+	f(200, "2", false)
+	f(204, "", false)
+	f(400, "1", false)
+	f(404, "", false)
+}
+
+func TestCheckVMProtoUnavailable(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	remoteWriteURL := s.URL + "/api/v1/write"
+	s.Close()
+
+	c := newTestClient(remoteWriteURL)
+	c.initVMProto(0)
+	if c.useVMProto() {
+		t.Fatalf("VictoriaMetrics remote write protocol mustn't be used for unavailable remote storage")
+	}
+}
+
+func TestClientSendBlockUnsupportedMediaType(t *testing.T) {
+	var encodings []string
+	var body []byte
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := r.Header.Get("Content-Encoding")
+		encodings = append(encodings, encoding)
+		if encoding == "zstd" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("cannot read request body: %s", err)
+		}
+		body = data
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer s.Close()
+
+	c := newTestClient(s.URL + "/api/v1/write")
+	atomic.StoreUint32(&c.isVMProto, 1)
+	wr := &prompbmarshal.WriteRequest{
+		Timeseries: []prompbmarshal.TimeSeries{{
+			Labels:  []prompbmarshal.Label{{Name: "__name__", Value: "a"}},
+			Samples: []prompbmarshal.Sample{{Value: 1, Timestamp: 2}},
+		}},
+	}
+	var block []byte
+	pushWriteRequest(wr, func(b []byte) {
+		block = append([]byte{}, b...)
+	}, true)
+	if !isZstdBlock(block) {
+		t.Fatalf("expecting zstd-compressed block")
+	}
+	if !c.sendBlock(block) {
+		t.Fatalf("unexpected false result from sendBlock")
+	}
+	if len(encodings) != 2 || encodings[0] != "zstd" || encodings[1] != "snappy" {
+		t.Fatalf("unexpected Content-Encoding headers for sent requests: %q; want [zstd snappy]", encodings)
+	}
+	if c.useVMProto() {
+		t.Fatalf("VictoriaMetrics remote write protocol must be disabled after 415 response")
+	}
+	data, err := snappy.Decode(nil, body)
+	if err != nil {
+		t.Fatalf("cannot decode snappy-compressed block: %s", err)
+	}
+	dataExpected := prompbmarshal.MarshalWriteRequest(nil, wr)
+	if string(data) != string(dataExpected) {
+		t.Fatalf("unexpected block contents after repacking to snappy;\ngot\n%X\nwant\n%X", data, dataExpected)
+	}
+}
+
+func TestClientSendBlockInvalid(t *testing.T) {
+	requests := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer s.Close()
+
+	c := newTestClient(s.URL + "/api/v1/write")
+	packetsDropped := c.packetsDropped.Get()
+	f := func(block []byte) {
+		t.Helper()
+		if !c.sendBlock(block) {
+			t.Fatalf("unexpected false result from sendBlock")
+		}
+		if requests != 0 {
+			t.Fatalf("invalid block mustn't be sent to remote storage")
+		}
+		if n := c.packetsDropped.Get(); n != packetsDropped+1 {
+			t.Fatalf("unexpected number of dropped packets; got %d; want %d", n, packetsDropped+1)
+		}
+		packetsDropped++
+	}
+
+	// Invalid snappy block
+	f([]byte("foobar"))
+
+	// Invalid zstd block
+	f(append(append([]byte{}, zstdMagic...), "foobar"...))
+
+	// Valid snappy block with invalid WriteRequest
+	f(snappy.Encode(nil, []byte("foobar")))
+}
+
+func TestGetBlockStats(t *testing.T) {
+	f := func(tss []prompbmarshal.TimeSeries, isVMRemoteWrite bool, bsExpected blockStats) {
+		t.Helper()
+		var block []byte
+		pushWriteRequest(&prompbmarshal.WriteRequest{
+			Timeseries: tss,
+		}, func(b []byte) {
+			block = append([]byte{}, b...)
+		}, isVMRemoteWrite)
+		bs, err := getBlockStats(block)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if bs != bsExpected {
+			t.Fatalf("unexpected block stats; got %+v; want %+v", bs, bsExpected)
+		}
+	}
+	tss := []prompbmarshal.TimeSeries{
+		{
+			Labels:  []prompbmarshal.Label{{Name: "__name__", Value: "a"}},
+			Samples: []prompbmarshal.Sample{{Value: 1, Timestamp: 2000}, {Value: 2, Timestamp: 1000}},
+		},
+		{
+			Labels:  []prompbmarshal.Label{{Name: "__name__", Value: "b"}},
+			Samples: []prompbmarshal.Sample{{Value: 3, Timestamp: 3000}},
+		},
+		{
+			Labels: []prompbmarshal.Label{{Name: "__name__", Value: "c"}},
+		},
+	}
+	bsExpected := blockStats{
+		samples:      3,
+		maxTimestamp: 3000,
+	}
+	f(tss, false, bsExpected)
+	f(tss, true, bsExpected)
+
+	// Invalid blocks
+	fFailure := func(block []byte) {
+		t.Helper()
+		if _, err := getBlockStats(block); err == nil {
+			t.Fatalf("expecting non-nil error for block %q", block)
+		}
+	}
+	fFailure([]byte("foobar"))
+	fFailure(snappy.Encode(nil, []byte("foobar")))
+}
+
+func TestClientIsTooOldBlock(t *testing.T) {
+	f := func(maxBlockAge time.Duration, bs blockStats, resultExpected bool) {
+		t.Helper()
+		c := &client{
+			maxBlockAge: maxBlockAge,
+		}
+		if result := c.isTooOldBlock(&bs); result != resultExpected {
+			t.Fatalf("unexpected isTooOldBlock result for maxBlockAge=%s, bs=%+v; got %v; want %v", maxBlockAge, bs, result, resultExpected)
+		}
+	}
+	now := time.Now().UnixNano() / 1e6
+	hour := time.Hour.Milliseconds()
+
+	// The limit is disabled
+	f(0, blockStats{samples: 1, maxTimestamp: now - 1000*hour}, false)
+
+	// Fresh blocks
+	f(time.Hour, blockStats{samples: 1, maxTimestamp: now}, false)
+	f(time.Hour, blockStats{samples: 1, maxTimestamp: now - hour/2}, false)
+
+	// Blocks without samples
+	f(time.Hour, blockStats{}, false)
+
+	// Too old blocks
+	f(time.Hour, blockStats{samples: 1, maxTimestamp: now - 2*hour}, true)
+	f(time.Minute, blockStats{samples: 10, maxTimestamp: now - hour}, true)
+}
+
+func TestClientMustDropBlockOnRetry(t *testing.T) {
+	c := newTestClient("http://localhost:1234/api/v1/write")
+	c.maxBlockAge = time.Hour
+	c.maxRetries = 3
+	blocksDroppedMaxRetries := c.blocksDroppedMaxRetries.Get()
+	samplesDroppedMaxRetries := c.samplesDroppedMaxRetries.Get()
+	blocksDroppedMaxBlockAge := c.blocksDroppedMaxBlockAge.Get()
+	samplesDroppedMaxBlockAge := c.samplesDroppedMaxBlockAge.Get()
+	now := time.Now().UnixNano() / 1e6
+	block := []byte("block contents aren't used")
+	f := func(bs blockStats, retriesCount int, resultExpected bool) {
+		t.Helper()
+		if result := c.mustDropBlockOnRetry(block, &bs, retriesCount); result != resultExpected {
+			t.Fatalf("unexpected mustDropBlockOnRetry result for bs=%+v, retriesCount=%d; got %v; want %v", bs, retriesCount, result, resultExpected)
+		}
+	}
+	fresh := blockStats{samples: 5, maxTimestamp: now}
+	old := blockStats{samples: 7, maxTimestamp: now - 2*time.Hour.Milliseconds()}
+
+	f(fresh, 1, false)
+	f(fresh, 3, false)
+	f(fresh, 4, true)
+	if n := c.blocksDroppedMaxRetries.Get() - blocksDroppedMaxRetries; n != 1 {
+		t.Fatalf("unexpected number of blocks dropped because of max retries; got %d; want 1", n)
+	}
+	if n := c.samplesDroppedMaxRetries.Get() - samplesDroppedMaxRetries; n != 5 {
+		t.Fatalf("unexpected number of samples dropped because of max retries; got %d; want 5", n)
+	}
+
+	f(old, 1, true)
+	if n := c.blocksDroppedMaxBlockAge.Get() - blocksDroppedMaxBlockAge; n != 1 {
+		t.Fatalf("unexpected number of blocks dropped because of max block age; got %d; want 1", n)
+	}
+	if n := c.samplesDroppedMaxBlockAge.Get() - samplesDroppedMaxBlockAge; n != 7 {
+		t.Fatalf("unexpected number of samples dropped because of max block age; got %d; want 7", n)
+	}
+}
+
+func TestClientSendBlockMaxBlockAge(t *testing.T) {
+	requests := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer s.Close()
+
+	c := newTestClient(s.URL + "/api/v1/write")
+	c.maxBlockAge = time.Hour
+	f := func(timestamp int64, requestsExpected int, blocksDroppedExpected uint64) {
+		t.Helper()
+		wr := &prompbmarshal.WriteRequest{
+			Timeseries: []prompbmarshal.TimeSeries{{
+				Labels:  []prompbmarshal.Label{{Name: "__name__", Value: "a"}},
+				Samples: []prompbmarshal.Sample{{Value: 1, Timestamp: timestamp}, {Value: 2, Timestamp: timestamp - 1000}},
+			}},
+		}
+		var block []byte
+		pushWriteRequest(wr, func(b []byte) {
+			block = append([]byte{}, b...)
+		}, false)
+		if !c.sendBlock(block) {
+			t.Fatalf("unexpected false result from sendBlock")
+		}
+		if requests != requestsExpected {
+			t.Fatalf("unexpected number of requests; got %d; want %d", requests, requestsExpected)
+		}
+		if n := c.blocksDroppedMaxBlockAge.Get(); n != blocksDroppedExpected {
+			t.Fatalf("unexpected number of dropped blocks; got %d; want %d", n, blocksDroppedExpected)
+		}
+	}
+	now := time.Now().UnixNano() / 1e6
+
+	// The fresh block must be sent
+	f(now, 1, 0)
+
+	// The too old block must be dropped without sending
+	f(now-2*time.Hour.Milliseconds(), 1, 1)
+	if n := c.samplesDroppedMaxBlockAge.Get(); n != 2 {
+		t.Fatalf("unexpected number of dropped samples; got %d; want 2", n)
+	}
+}
+
+func TestDecompressBlock(t *testing.T) {
+	data := []byte("foobar baz")
+	f := func(block []byte) {
+		t.Helper()
+		result, err := decompressBlock([]byte("prefix"), block)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if string(result) != string(data) {
+			t.Fatalf("unexpected result; got %q; want %q", result, data)
+		}
+	}
+	f(snappy.Encode(nil, data))
+	f(zstd.CompressLevel(nil, data, 1))
+
+	fFailure := func(block []byte) {
+		t.Helper()
+		if _, err := decompressBlock(nil, block); err == nil {
+			t.Fatalf("expecting non-nil error for block %q", block)
+		}
+	}
+	fFailure([]byte("foobar"))
+	fFailure(append(append([]byte{}, zstdMagic...), "foobar"...))
+}
+
+func newTestClient(remoteWriteURL string) *client {
+	c := &client{
+		sanitizedURL:   remoteWriteURL,
+		remoteWriteURL: remoteWriteURL,
+		hc:             &http.Client{},
+		sl:             newSendLimits(0, remoteWriteURL),
+		stopCh:         make(chan struct{}),
+	}
+	c.initMetrics()
+	return c
+}
+
+func TestConcurrencyLimiter(t *testing.T) {
+	type step struct {
+		// action is one of "success", "slow", "overload" or "wait".
+		action string
+
+		// limitExpected is the expected limit after the action.
+		limitExpected int
+	}
+	f := func(maxLimit int, steps []step) {
+		t.Helper()
+		cl := newConcurrencyLimiter(maxLimit, time.Second)
+		cl.limitDecreases = metrics.GetOrCreateCounter(`vmagent_remotewrite_concurrency_limit_decreases_total{url="test"}`)
+		if n := cl.getLimit(); n != maxLimit {
+			t.Fatalf("unexpected initial limit; got %d; want %d", n, maxLimit)
+		}
+		for i, st := range steps {
+			switch st.action {
+			case "success":
+				cl.registerSuccess(time.Millisecond)
+			case "slow":
+				cl.registerSuccess(2 * time.Second)
+			case "overload":
+				cl.registerOverload()
+			case "wait":
+				// Allow the next decrease without waiting for a second.
+				cl.lastDecreaseTime = time.Time{}
+			default:
+				t.Fatalf("BUG: unexpected action %q", st.action)
+			}
+			if n := cl.getLimit(); n != st.limitExpected {
+				t.Fatalf("unexpected limit after step #%d (%s); got %d; want %d", i, st.action, n, st.limitExpected)
+			}
+		}
+	}
+	successes := func(n, limitExpected int) []step {
+		steps := make([]step, n)
+		for i := range steps {
+			steps[i] = step{"success", limitExpected}
+		}
+		return steps
+	}
+	join := func(a ...[]step) []step {
+		var steps []step
+		for _, s := range a {
+			steps = append(steps, s...)
+		}
+		return steps
+	}
+
+	// The limit cannot exceed maxLimit
+	f(4, successes(100, 4))
+
+	// Halving on 429 and 5xx responses. The limit mustn't be decreased more frequently than once per second.
+	f(8, []step{
+		{"overload", 4},
+		{"overload", 4},
+		{"wait", 4},
+		{"overload", 2},
+	})
+
+	// Requests exceeding the target latency are registered as overload.
+	f(8, []step{
+		{"slow", 4},
+		{"slow", 4},
+	})
+
+	// The limit cannot drop below 1
+	f(2, []step{
+		{"overload", 1},
+		{"wait", 1},
+		{"overload", 1},
+		{"wait", 1},
+		{"slow", 1},
+	})
+
+	// Additive increase: the limit is increased by one after the limit successful requests in a row.
+	f(8, join(
+		[]step{{"overload", 4}},
+		successes(3, 4),
+		[]step{{"success", 5}},
+		successes(4, 5),
+		[]step{{"success", 6}},
+	))
+
+	// Overload resets the number of successful requests in a row.
+	f(8, join(
+		[]step{{"overload", 4}},
+		successes(3, 4),
+		[]step{{"wait", 4}, {"overload", 2}},
+		successes(1, 2),
+		[]step{{"success", 3}},
+	))
+}
+
+func TestConcurrencyLimiterReleaseWhileShrinking(t *testing.T) {
+	cl := newConcurrencyLimiter(4, 0)
+	cl.limitDecreases = metrics.GetOrCreateCounter(`vmagent_remotewrite_concurrency_limit_decreases_total{url="test"}`)
+	for i := 0; i < 4; i++ {
+		if !cl.acquire() {
+			t.Fatalf("unexpected false result from acquire")
+		}
+	}
+
+	// Shrink the limit while all the 4 requests are active.
+	cl.registerOverload()
+	if n := cl.getLimit(); n != 2 {
+		t.Fatalf("unexpected limit; got %d; want 2", n)
+	}
+
+	acquiredCh := make(chan struct{})
+	go func() {
+		if cl.acquire() {
+			acquiredCh <- struct{}{}
+		}
+	}()
+	isAcquired := func() bool {
+		select {
+		case <-acquiredCh:
+			return true
+		case <-time.After(50 * time.Millisecond):
+			return false
+		}
+	}
+
+	// The new request must wait until the number of active requests drops below the new limit.
+	cl.release()
+	if isAcquired() {
+		t.Fatalf("the request mustn't be acquired with 3 active requests and the limit 2")
+	}
+	cl.release()
+	if isAcquired() {
+		t.Fatalf("the request mustn't be acquired with 2 active requests and the limit 2")
+	}
+	cl.release()
+	if !isAcquired() {
+		t.Fatalf("the request must be acquired with 1 active request and the limit 2")
+	}
+
+	// The number of active requests reached the limit, so the next request must wait.
+	// Stopped limiter must unblock waiting requests.
+	stoppedCh := make(chan bool)
+	go func() {
+		stoppedCh <- cl.acquire()
+	}()
+	cl.unblockAll()
+	select {
+	case ok := <-stoppedCh:
+		if ok {
+			t.Fatalf("unexpected true result from acquire after unblockAll")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timeout when waiting for unblocking acquire")
+	}
+}
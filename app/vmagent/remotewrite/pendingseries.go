@@ -8,8 +8,10 @@ import (
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/decimal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding/zstd"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/persistentqueue"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
@@ -25,7 +27,7 @@ var (
 		"It shouldn't exceed -maxInsertRequestSize from VictoriaMetrics")
 )
 
-// the maximum number of rows to send per each block.
+// the default maximum number of rows to send per each block. It may be overridden via -remoteWrite.maxSamplesPerSend.
 const maxRowsPerBlock = 10000
 
 type pendingSeries struct {
@@ -36,11 +38,14 @@ type pendingSeries struct {
 	periodicFlusherWG sync.WaitGroup
 }
 
-func newPendingSeries(pushBlock func(block []byte), significantFigures, roundDigits int) *pendingSeries {
+func newPendingSeries(pushBlock func(block []byte), useVMProto func() bool, significantFigures, roundDigits int, sl *sendLimits, tenantLabel string) *pendingSeries {
 	var ps pendingSeries
 	ps.wr.pushBlock = pushBlock
+	ps.wr.useVMProto = useVMProto
 	ps.wr.significantFigures = significantFigures
 	ps.wr.roundDigits = roundDigits
+	ps.wr.sl = sl
+	ps.wr.tenantLabel = tenantLabel
 	ps.stopCh = make(chan struct{})
 	ps.periodicFlusherWG.Add(1)
 	go func() {
@@ -61,6 +66,12 @@ func (ps *pendingSeries) Push(tss []prompbmarshal.TimeSeries) {
 	ps.mu.Unlock()
 }
 
+func (ps *pendingSeries) PushMetadata(mms []prompbmarshal.MetricMetadata) {
+	ps.mu.Lock()
+	ps.wr.pushMetadata(mms)
+	ps.mu.Unlock()
+}
+
 func (ps *pendingSeries) periodicFlusher() {
 	flushSeconds := int64(flushInterval.Seconds())
 	if flushSeconds <= 0 {
@@ -91,30 +102,43 @@ type writeRequest struct {
 	// pushBlock is called when whe write request is ready to be sent.
 	pushBlock func(block []byte)
 
+	// useVMProto must return true if the block must be compressed with zstd according to VictoriaMetrics remote write protocol.
+	useVMProto func() bool
+
 	// How many significant figures must be left before sending the writeRequest to pushBlock.
 	significantFigures int
 
 	// How many decimal digits after point must be left before sending the writeRequest to pushBlock.
 	roundDigits int
 
+	// sl limits the number of samples and labels per block passed to pushBlock.
+	sl *sendLimits
+
+	// tenantLabel is the label for splitting series per tenant. Empty value disables the splitting.
+	tenantLabel string
+
 	wr prompbmarshal.WriteRequest
 
 	tss []prompbmarshal.TimeSeries
 
-	labels  []prompbmarshal.Label
-	samples []prompbmarshal.Sample
-	buf     []byte
+	labels    []prompbmarshal.Label
+	samples   []prompbmarshal.Sample
+	exemplars []prompbmarshal.Exemplar
+	metadata  []prompbmarshal.MetricMetadata
+	buf       []byte
 }
 
 func (wr *writeRequest) reset() {
-	// Do not reset pushBlock, significantFigures and roundDigits, since they are re-used.
+	// Do not reset pushBlock, useVMProto, significantFigures, roundDigits, sl and tenantLabel, since they are re-used.
 
 	wr.wr.Timeseries = nil
+	wr.wr.Metadata = nil
 
 	for i := range wr.tss {
 		ts := &wr.tss[i]
 		ts.Labels = nil
 		ts.Samples = nil
+		ts.Exemplars = nil
 	}
 	wr.tss = wr.tss[:0]
 
@@ -122,14 +146,26 @@ func (wr *writeRequest) reset() {
 	wr.labels = wr.labels[:0]
 
 	wr.samples = wr.samples[:0]
+
+	for i := range wr.exemplars {
+		wr.exemplars[i] = prompbmarshal.Exemplar{}
+	}
+	wr.exemplars = wr.exemplars[:0]
+
+	for i := range wr.metadata {
+		wr.metadata[i] = prompbmarshal.MetricMetadata{}
+	}
+	wr.metadata = wr.metadata[:0]
+
 	wr.buf = wr.buf[:0]
 }
 
 func (wr *writeRequest) flush() {
 	wr.wr.Timeseries = wr.tss
+	wr.wr.Metadata = wr.metadata
 	wr.adjustSampleValues()
 	atomic.StoreUint64(&wr.lastFlushTime, fasttime.UnixTimestamp())
-	pushWriteRequest(&wr.wr, wr.pushBlock)
+	pushWriteRequestChunks(&wr.wr, wr.pushBlock, wr.useVMProto(), wr.sl, wr.tenantLabel)
 	wr.reset()
 }
 
@@ -154,7 +190,7 @@ func (wr *writeRequest) push(src []prompbmarshal.TimeSeries) {
 	for i := range src {
 		tssDst = append(tssDst, prompbmarshal.TimeSeries{})
 		wr.copyTimeSeries(&tssDst[len(tssDst)-1], &src[i])
-		if len(wr.samples) >= maxRowsPerBlock {
+		if len(wr.samples) >= wr.sl.maxSamples {
 			wr.tss = tssDst
 			wr.flush()
 			tssDst = wr.tss
@@ -163,6 +199,30 @@ func (wr *writeRequest) push(src []prompbmarshal.TimeSeries) {
 	wr.tss = tssDst
 }
 
+func (wr *writeRequest) pushMetadata(src []prompbmarshal.MetricMetadata) {
+	for i := range src {
+		wr.copyMetadata(&src[i])
+		if len(wr.metadata) >= maxRowsPerBlock {
+			wr.flush()
+		}
+	}
+}
+
+func (wr *writeRequest) copyMetadata(src *prompbmarshal.MetricMetadata) {
+	buf := wr.buf
+	copyString := func(s string) string {
+		buf = append(buf, s...)
+		return bytesutil.ToUnsafeString(buf[len(buf)-len(s):])
+	}
+	wr.metadata = append(wr.metadata, prompbmarshal.MetricMetadata{
+		Type:             src.Type,
+		MetricFamilyName: copyString(src.MetricFamilyName),
+		Help:             copyString(src.Help),
+		Unit:             copyString(src.Unit),
+	})
+	wr.buf = buf
+}
+
 func (wr *writeRequest) copyTimeSeries(dst, src *prompbmarshal.TimeSeries) {
 	labelsDst := wr.labels
 	labelsLen := len(wr.labels)
@@ -183,13 +243,37 @@ func (wr *writeRequest) copyTimeSeries(dst, src *prompbmarshal.TimeSeries) {
 	samplesDst = append(samplesDst, src.Samples...)
 	dst.Samples = samplesDst[len(samplesDst)-len(src.Samples):]
 
+	exemplarsDst := wr.exemplars
+	exemplarsLen := len(exemplarsDst)
+	for i := range src.Exemplars {
+		srcExemplar := &src.Exemplars[i]
+		exemplarLabelsLen := len(labelsDst)
+		for j := range srcExemplar.Labels {
+			labelsDst = append(labelsDst, prompbmarshal.Label{})
+			dstLabel := &labelsDst[len(labelsDst)-1]
+			srcLabel := &srcExemplar.Labels[j]
+
+			buf = append(buf, srcLabel.Name...)
+			dstLabel.Name = bytesutil.ToUnsafeString(buf[len(buf)-len(srcLabel.Name):])
+			buf = append(buf, srcLabel.Value...)
+			dstLabel.Value = bytesutil.ToUnsafeString(buf[len(buf)-len(srcLabel.Value):])
+		}
+		exemplarsDst = append(exemplarsDst, prompbmarshal.Exemplar{
+			Labels:    labelsDst[exemplarLabelsLen:],
+			Value:     srcExemplar.Value,
+			Timestamp: srcExemplar.Timestamp,
+		})
+	}
+	dst.Exemplars = exemplarsDst[exemplarsLen:]
+
 	wr.samples = samplesDst
 	wr.labels = labelsDst
+	wr.exemplars = exemplarsDst
 	wr.buf = buf
 }
 
-func pushWriteRequest(wr *prompbmarshal.WriteRequest, pushBlock func(block []byte)) {
-	if len(wr.Timeseries) == 0 {
+func pushWriteRequest(wr *prompbmarshal.WriteRequest, pushBlock func(block []byte), isVMRemoteWrite bool) {
+	if len(wr.Timeseries) == 0 && len(wr.Metadata) == 0 {
 		// Nothing to push
 		return
 	}
@@ -197,7 +281,11 @@ func pushWriteRequest(wr *prompbmarshal.WriteRequest, pushBlock func(block []byt
 	bb.B = prompbmarshal.MarshalWriteRequest(bb.B[:0], wr)
 	if len(bb.B) <= maxUnpackedBlockSize.N {
 		zb := snappyBufPool.Get()
-		zb.B = snappy.Encode(zb.B[:cap(zb.B)], bb.B)
+		if isVMRemoteWrite {
+			zb.B = zstd.CompressLevel(zb.B[:0], bb.B, *vmProtoCompressLevel)
+		} else {
+			zb.B = snappy.Encode(zb.B[:cap(zb.B)], bb.B)
+		}
 		writeRequestBufPool.Put(bb)
 		if len(zb.B) <= persistentqueue.MaxBlockSize {
 			pushBlock(zb.B)
@@ -213,12 +301,30 @@ func pushWriteRequest(wr *prompbmarshal.WriteRequest, pushBlock func(block []byt
 
 	// Too big block. Recursively split it into smaller parts.
 	timeseries := wr.Timeseries
+	metadata := wr.Metadata
+	if len(timeseries) == 0 {
+		if len(metadata) == 1 {
+			logger.Errorf("dropping too big metadata for metric %q; its size exceeds -remoteWrite.maxBlockSize=%d bytes",
+				metadata[0].MetricFamilyName, maxUnpackedBlockSize.N)
+			return
+		}
+		n := len(metadata) / 2
+		wr.Metadata = metadata[:n]
+		pushWriteRequest(wr, pushBlock, isVMRemoteWrite)
+		wr.Metadata = metadata[n:]
+		pushWriteRequest(wr, pushBlock, isVMRemoteWrite)
+		wr.Metadata = metadata
+		return
+	}
+	// Send metadata only with the first part.
 	n := len(timeseries) / 2
 	wr.Timeseries = timeseries[:n]
-	pushWriteRequest(wr, pushBlock)
+	pushWriteRequest(wr, pushBlock, isVMRemoteWrite)
+	wr.Metadata = nil
 	wr.Timeseries = timeseries[n:]
-	pushWriteRequest(wr, pushBlock)
+	pushWriteRequest(wr, pushBlock, isVMRemoteWrite)
 	wr.Timeseries = timeseries
+	wr.Metadata = metadata
 }
 
 var (
@@ -0,0 +1,66 @@
+package remotewrite
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+// WriteQueuesJSON writes the state of persistent queues for all the -remoteWrite.url to w in JSON format.
+func WriteQueuesJSON(w io.Writer) {
+	fmt.Fprintf(w, `{"status":"success","data":[`)
+	for i, rwctx := range rwctxs {
+		fq := rwctx.fq
+		fmt.Fprintf(w, `{"url":%d,"sanitizedURL":%q,"path":%q,"pendingBytes":%d,"inmemoryBlocks":%d,"paused":%v}`,
+			rwctx.idx+1, rwctx.c.sanitizedURL, rwctx.path, fq.GetPendingBytes(), fq.GetInmemoryQueueLen(), fq.IsPaused())
+		if i+1 < len(rwctxs) {
+			fmt.Fprintf(w, `,`)
+		}
+	}
+	fmt.Fprintf(w, `]}`)
+}
+
+// PauseQueue pauses sending data to the -remoteWrite.url with the given 1-based urlIdx.
+//
+// The data for the paused -remoteWrite.url is buffered at -remoteWrite.tmpDataPath until ResumeQueue call.
+func PauseQueue(urlIdx int) error {
+	rwctx, err := getRemoteWriteCtx(urlIdx)
+	if err != nil {
+		return err
+	}
+	rwctx.fq.Pause()
+	logger.Infof("paused sending data to -remoteWrite.url=%q", rwctx.c.sanitizedURL)
+	return nil
+}
+
+// ResumeQueue resumes sending data to the -remoteWrite.url with the given 1-based urlIdx after PauseQueue call.
+func ResumeQueue(urlIdx int) error {
+	rwctx, err := getRemoteWriteCtx(urlIdx)
+	if err != nil {
+		return err
+	}
+	rwctx.fq.Resume()
+	logger.Infof("resumed sending data to -remoteWrite.url=%q", rwctx.c.sanitizedURL)
+	return nil
+}
+
+// DropQueue drops the pending data for the -remoteWrite.url with the given 1-based urlIdx.
+//
+// It returns the number of dropped bytes.
+func DropQueue(urlIdx int) (uint64, error) {
+	rwctx, err := getRemoteWriteCtx(urlIdx)
+	if err != nil {
+		return 0, err
+	}
+	n := rwctx.fq.MustDropPendingBlocks()
+	logger.Infof("dropped %d pending bytes for -remoteWrite.url=%q", n, rwctx.c.sanitizedURL)
+	return n, nil
+}
+
+func getRemoteWriteCtx(urlIdx int) (*remoteWriteCtx, error) {
+	if urlIdx < 1 || urlIdx > len(rwctxs) {
+		return nil, fmt.Errorf("url=%d is out of range; it must be in the range [1..%d]", urlIdx, len(rwctxs))
+	}
+	return rwctxs[urlIdx-1], nil
+}
@@ -6,13 +6,16 @@ import (
 	"sync"
 	"sync/atomic"
 
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/cgroup"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/memory"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/persistentqueue"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/procutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/streamaggr"
 	"github.com/VictoriaMetrics/metrics"
 	xxhash "github.com/cespare/xxhash/v2"
 )
@@ -37,10 +40,21 @@ var (
 		"Examples: -remoteWrite.roundDigits=2 would round 1.236 to 1.24, while -remoteWrite.roundDigits=-1 would round 126.78 to 130. "+
 		"By default digits rounding is disabled. Set it to 100 for disabling it for a particular remote storage. "+
 		"This option may be used for improving data compression for the stored metrics")
+	shardByURL = flag.Bool("remoteWrite.shardByURL", false, "Whether to shard outgoing series across all the remote storage systems enumerated via -remoteWrite.url . "+
+		"By default the data is replicated across all the -remoteWrite.url . See https://victoriametrics.github.io/vmagent.html#sharding-among-remote-storages")
+	shardByURLLabels = flagutil.NewArray("remoteWrite.shardByURL.labels", "Optional list of labels, which must be used for sharding outgoing series among -remoteWrite.url "+
+		"if -remoteWrite.shardByURL is set. By default all the labels are used for sharding in order to gain even distribution of series over the -remoteWrite.url systems")
+	streamAggrConfig = flag.String("remoteWrite.streamAggr.config", "", "Optional path to file with stream aggregation config. "+
+		"See https://victoriametrics.github.io/vmagent.html#stream-aggregation . See also -remoteWrite.streamAggr.keepInput")
+	streamAggrKeepInput = flag.Bool("remoteWrite.streamAggr.keepInput", false, "Whether to keep input samples matching -remoteWrite.streamAggr.config. "+
+		"By default only the aggregated samples are sent to -remoteWrite.url for the matching input series")
 )
 
 var rwctxs []*remoteWriteCtx
 
+// sas contains stream aggregators configured via -remoteWrite.streamAggr.config.
+var sas *streamaggr.Aggregators
+
 // Contains the current relabelConfigs.
 var allRelabelConfigs atomic.Value
 
@@ -97,6 +111,13 @@ func Init() {
 		rwctxs = append(rwctxs, rwctx)
 	}
 
+	if *streamAggrConfig != "" {
+		sas, err = streamaggr.LoadFromFile(*streamAggrConfig, pushAggregateSeries)
+		if err != nil {
+			logger.Fatalf("cannot load -remoteWrite.streamAggr.config: %s", err)
+		}
+	}
+
 	// Start config reloader.
 	sighupCh := procutil.NewSighupChan()
 	configReloaderWG.Add(1)
@@ -130,6 +151,10 @@ func Stop() {
 	close(stopCh)
 	configReloaderWG.Wait()
 
+	// Stop stream aggregators before remote write contexts, so the remaining aggregated data is sent to remote storage.
+	sas.MustStop()
+	sas = nil
+
 	for _, rwctx := range rwctxs {
 		rwctx.MustStop()
 	}
@@ -138,9 +163,13 @@ func Stop() {
 
 // Push sends wr to remote storage systems set via `-remoteWrite.url`.
 //
-// Note that wr may be modified by Push due to relabeling and rounding.
+// Note that wr may be modified by Push due to relabeling, stream aggregation and rounding.
 func Push(wr *prompbmarshal.WriteRequest) {
 	var rctx *relabelCtx
+	var matchIdxs *bytesutil.ByteBuffer
+	if sas != nil {
+		matchIdxs = matchIdxsPool.Get()
+	}
 	rcs := allRelabelConfigs.Load().(*relabelConfigs)
 	pcsGlobal := rcs.global
 	if pcsGlobal.Len() > 0 || len(labelsGlobal) > 0 {
@@ -170,22 +199,164 @@ func Push(wr *prompbmarshal.WriteRequest) {
 			tssBlock = rctx.applyRelabeling(tssBlock, labelsGlobal, pcsGlobal)
 			globalRelabelMetricsDropped.Add(tssBlockLen - len(tssBlock))
 		}
-		for _, rwctx := range rwctxs {
-			rwctx.Push(tssBlock)
+		if sas != nil {
+			matchIdxs.B = sas.Push(tssBlock, matchIdxs.B)
+			if !*streamAggrKeepInput {
+				tssBlock = dropAggregatedSeries(tssBlock, matchIdxs.B)
+			}
 		}
+		pushBlockToRemoteStorages(tssBlock)
 		if rctx != nil {
 			rctx.reset()
 		}
 	}
+	if len(wr.Metadata) > 0 {
+		pushMetadataToRemoteStorages(wr.Metadata)
+	}
 	if rctx != nil {
 		putRelabelCtx(rctx)
 	}
+	if matchIdxs != nil {
+		matchIdxsPool.Put(matchIdxs)
+	}
+}
+
+var matchIdxsPool bytesutil.ByteBufferPool
+
+// dropAggregatedSeries drops series from tss, which are marked in matchIdxs, and returns the result.
+func dropAggregatedSeries(tss []prompbmarshal.TimeSeries, matchIdxs []byte) []prompbmarshal.TimeSeries {
+	dst := tss[:0]
+	for i, match := range matchIdxs {
+		if match == 0 {
+			dst = append(dst, tss[i])
+		}
+	}
+	return dst
+}
+
+// pushAggregateSeries sends the aggregated series from stream aggregators to -remoteWrite.url.
+func pushAggregateSeries(tss []prompbmarshal.TimeSeries) {
+	pushBlockToRemoteStorages(tss)
+}
+
+// pushBlockToRemoteStorages sends tss to -remoteWrite.url.
+//
+// tss is replicated among all the -remoteWrite.url unless -remoteWrite.shardByURL is set.
+func pushBlockToRemoteStorages(tss []prompbmarshal.TimeSeries) {
+	if len(rwctxs) == 1 || !*shardByURL {
+		for _, rwctx := range rwctxs {
+			rwctx.Push(tss)
+		}
+		return
+	}
+
+	// Shard tss among rwctxs by labels hash, so samples for the same series go to the same remote storage.
+	v := tssShardsPool.Get().(*[][]prompbmarshal.TimeSeries)
+	tssByURL := *v
+	if n := len(rwctxs) - cap(tssByURL); n > 0 {
+		tssByURL = append(tssByURL[:cap(tssByURL)], make([][]prompbmarshal.TimeSeries, n)...)
+	}
+	tssByURL = tssByURL[:len(rwctxs)]
+	for _, ts := range tss {
+		h := getLabelsHash(ts.Labels, *shardByURLLabels)
+		idx := getShardIdx(h, len(tssByURL))
+		tssByURL[idx] = append(tssByURL[idx], ts)
+	}
+	for i, rwctx := range rwctxs {
+		if len(tssByURL[i]) > 0 {
+			rwctx.Push(tssByURL[i])
+		}
+		tssByURL[i] = prompbmarshal.ResetTimeSeries(tssByURL[i])
+	}
+	*v = tssByURL
+	tssShardsPool.Put(v)
+}
+
+// pushMetadataToRemoteStorages sends mms to -remoteWrite.url.
+//
+// mms is replicated among all the -remoteWrite.url even if -remoteWrite.shardByURL is set,
+// since every remote storage needs metadata for the metrics it stores.
+func pushMetadataToRemoteStorages(mms []prompbmarshal.MetricMetadata) {
+	for _, rwctx := range rwctxs {
+		rwctx.PushMetadata(mms)
+	}
+}
+
+var tssShardsPool = &sync.Pool{
+	New: func() interface{} {
+		var a [][]prompbmarshal.TimeSeries
+		return &a
+	},
+}
+
+// getLabelsHash returns hash for the given labels.
+//
+// Only labels with names from shardLabels are taken into account if shardLabels isn't empty.
+func getLabelsHash(labels []prompbmarshal.Label, shardLabels []string) uint64 {
+	bb := labelsHashBufPool.Get()
+	b := bb.B[:0]
+	for _, label := range labels {
+		if len(shardLabels) > 0 && !hasString(shardLabels, label.Name) {
+			continue
+		}
+		// Prefix names and values with their lengths, so distinct label sets cannot result in the same byte string.
+		// For example, {foo="bar"} and {foob="ar"} must have distinct hashes.
+		b = encoding.MarshalVarUint64(b, uint64(len(label.Name)))
+		b = append(b, label.Name...)
+		b = encoding.MarshalVarUint64(b, uint64(len(label.Value)))
+		b = append(b, label.Value...)
+	}
+	h := xxhash.Sum64(b)
+	bb.B = b
+	labelsHashBufPool.Put(bb)
+	return h
+}
+
+var labelsHashBufPool bytesutil.ByteBufferPool
+
+// getShardIdx returns shard index in the range [0 ... shards) for the given hash h.
+//
+// It uses jump consistent hash from https://arxiv.org/abs/1406.2294 , so only 1/shards of hashes
+// are moved to the new shard when the number of shards is increased by one.
+func getShardIdx(h uint64, shards int) int {
+	b := int64(-1)
+	j := int64(0)
+	for j < int64(shards) {
+		b = j
+		h = h*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((h>>33)+1)))
+	}
+	return int(b)
+}
+
+func hasString(a []string, s string) bool {
+	for _, x := range a {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckStreamAggrConfig checks -remoteWrite.streamAggr.config.
+func CheckStreamAggrConfig() error {
+	if *streamAggrConfig == "" {
+		return nil
+	}
+	pushNoop := func(tss []prompbmarshal.TimeSeries) {}
+	sas, err := streamaggr.LoadFromFile(*streamAggrConfig, pushNoop)
+	if err != nil {
+		return fmt.Errorf("cannot load -remoteWrite.streamAggr.config: %w", err)
+	}
+	sas.MustStop()
+	return nil
 }
 
 var globalRelabelMetricsDropped = metrics.NewCounter("vmagent_remotewrite_global_relabel_metrics_dropped_total")
 
 type remoteWriteCtx struct {
 	idx        int
+	path       string
 	fq         *persistentqueue.FastQueue
 	c          *client
 	pss        []*pendingSeries
@@ -209,13 +380,20 @@ func newRemoteWriteCtx(argIdx int, remoteWriteURL string, maxInmemoryBlocks int,
 	rd := roundDigits.GetOptionalArgOrDefault(argIdx, 100)
 	pss := make([]*pendingSeries, *queues)
 	for i := range pss {
-		pss[i] = newPendingSeries(fq.MustWriteBlock, sf, rd)
+		pss[i] = newPendingSeries(fq.MustWriteBlock, c.useVMProto, sf, rd, c.sl, c.tenantLabel)
 	}
+	_ = metrics.GetOrCreateGauge(fmt.Sprintf(`vmagent_remotewrite_queue_paused{path=%q, url=%q}`, path, sanitizedURL), func() float64 {
+		if fq.IsPaused() {
+			return 1
+		}
+		return 0
+	})
 	return &remoteWriteCtx{
-		idx: argIdx,
-		fq:  fq,
-		c:   c,
-		pss: pss,
+		idx:  argIdx,
+		path: path,
+		fq:   fq,
+		c:    c,
+		pss:  pss,
 
 		relabelMetricsDropped: metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_remotewrite_relabel_metrics_dropped_total{path=%q, url=%q}`, path, sanitizedURL)),
 	}
@@ -263,6 +441,12 @@ func (rwctx *remoteWriteCtx) Push(tss []prompbmarshal.TimeSeries) {
 	}
 }
 
+func (rwctx *remoteWriteCtx) PushMetadata(mms []prompbmarshal.MetricMetadata) {
+	pss := rwctx.pss
+	idx := atomic.AddUint64(&rwctx.pssNextIdx, 1) % uint64(len(pss))
+	pss[idx].PushMetadata(mms)
+}
+
 var tssRelabelPool = &sync.Pool{
 	New: func() interface{} {
 		a := []prompbmarshal.TimeSeries{}
@@ -0,0 +1,92 @@
+package remotewrite
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+)
+
+func TestGetLabelsHashDistinct(t *testing.T) {
+	f := func(a, b []prompbmarshal.Label) {
+		t.Helper()
+		if getLabelsHash(a, nil) == getLabelsHash(b, nil) {
+			t.Fatalf("expecting distinct hashes for %v and %v", a, b)
+		}
+	}
+	f([]prompbmarshal.Label{{Name: "foo", Value: "bar"}}, []prompbmarshal.Label{{Name: "foob", Value: "ar"}})
+	f([]prompbmarshal.Label{{Name: "ab", Value: "c"}}, []prompbmarshal.Label{{Name: "a", Value: "bc"}})
+	f([]prompbmarshal.Label{{Name: "a", Value: "b"}, {Name: "c", Value: "d"}}, []prompbmarshal.Label{{Name: "a", Value: "bc"}, {Name: "", Value: "d"}})
+	f([]prompbmarshal.Label{{Name: "a", Value: ""}}, []prompbmarshal.Label{{Name: "", Value: "a"}})
+}
+
+func TestGetLabelsHashShardLabels(t *testing.T) {
+	labels := []prompbmarshal.Label{
+		{Name: "__name__", Value: "foo"},
+		{Name: "instance", Value: "host1"},
+		{Name: "job", Value: "node"},
+	}
+	labelsOtherInstance := []prompbmarshal.Label{
+		{Name: "__name__", Value: "bar"},
+		{Name: "instance", Value: "host1"},
+		{Name: "job", Value: "other"},
+	}
+	shardLabels := []string{"instance"}
+	if h1, h2 := getLabelsHash(labels, shardLabels), getLabelsHash(labelsOtherInstance, shardLabels); h1 != h2 {
+		t.Fatalf("expecting equal hashes for series with the same instance label; got %d and %d", h1, h2)
+	}
+	if h1, h2 := getLabelsHash(labels, nil), getLabelsHash(labelsOtherInstance, nil); h1 == h2 {
+		t.Fatalf("expecting distinct hashes for distinct series when shard labels are empty")
+	}
+}
+
+func TestGetShardIdxDistribution(t *testing.T) {
+	const seriesCount = 100000
+	for _, shards := range []int{1, 2, 3, 5, 10} {
+		counts := make([]int, shards)
+		for i := 0; i < seriesCount; i++ {
+			h := getLabelsHash(newTestLabels(i), nil)
+			idx := getShardIdx(h, shards)
+			if idx < 0 || idx >= shards {
+				t.Fatalf("shard index %d out of range [0..%d)", idx, shards)
+			}
+			counts[idx]++
+		}
+		expected := seriesCount / shards
+		for idx, n := range counts {
+			if n < expected*9/10 || n > expected*11/10 {
+				t.Fatalf("uneven distribution among %d shards; shard #%d got %d series; want %d +-10%%; counts: %d", shards, idx, n, expected, counts)
+			}
+		}
+	}
+}
+
+func TestGetShardIdxConsistency(t *testing.T) {
+	const seriesCount = 100000
+	for _, shards := range []int{1, 2, 3, 5, 10} {
+		moved := 0
+		for i := 0; i < seriesCount; i++ {
+			h := getLabelsHash(newTestLabels(i), nil)
+			idxOld := getShardIdx(h, shards)
+			idxNew := getShardIdx(h, shards+1)
+			if idxOld == idxNew {
+				continue
+			}
+			if idxNew != shards {
+				t.Fatalf("series #%d moved from shard #%d to the existing shard #%d when increasing shards from %d to %d", i, idxOld, idxNew, shards, shards+1)
+			}
+			moved++
+		}
+		expected := seriesCount / (shards + 1)
+		if moved < expected*9/10 || moved > expected*11/10 {
+			t.Fatalf("unexpected number of moved series when increasing shards from %d to %d; got %d; want %d +-10%%", shards, shards+1, moved, expected)
+		}
+	}
+}
+
+func newTestLabels(i int) []prompbmarshal.Label {
+	return []prompbmarshal.Label{
+		{Name: "__name__", Value: "metric"},
+		{Name: "instance", Value: fmt.Sprintf("host-%d", i)},
+	}
+}
@@ -0,0 +1,303 @@
+package remotewrite
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	maxSamplesPerSend = flagutil.NewArrayInt("remoteWrite.maxSamplesPerSend", "Optional maximum number of samples per request to the corresponding -remoteWrite.url. "+
+		"By default up to 10000 samples are sent per request. The limit is decreased automatically when the remote storage responds with 413 Request Entity Too Large. "+
+		"See https://victoriametrics.github.io/vmagent.html#limiting-request-size")
+	maxLabelsPerSend = flagutil.NewArrayInt("remoteWrite.maxLabelsPerSend", "Optional maximum number of labels for all the series per request to the corresponding -remoteWrite.url. "+
+		"By default the number of labels per request isn't limited. See https://victoriametrics.github.io/vmagent.html#limiting-request-size")
+	tenantLabels = flagutil.NewArray("remoteWrite.tenantLabel", "Optional label for splitting series per tenant before sending them to the corresponding -remoteWrite.url. "+
+		"Series with distinct values for this label are sent in distinct requests with the label value in the header set via -remoteWrite.tenantHeader. "+
+		"See https://victoriametrics.github.io/vmagent.html#multitenancy-via-http-header")
+	tenantHeaders = flagutil.NewArray("remoteWrite.tenantHeader", "HTTP header for passing tenant to the corresponding -remoteWrite.url if -remoteWrite.tenantLabel is set. "+
+		"By default X-Scope-OrgID header is used, which is supported by Cortex and Mimir")
+)
+
+// sendLimits limits the number of samples and labels per request to remote storage.
+//
+// The samples limit is adjusted according to AIMD algorithm: it is halved on 413 Request Entity Too Large responses
+// and it is increased by 1/16 of the configured limit after every 16 successful requests.
+type sendLimits struct {
+	mu sync.Mutex
+
+	// maxSamples is the configured limit on the number of samples per request.
+	maxSamples int
+
+	// maxLabels is the limit on the number of labels per request. Zero value disables the limit.
+	maxLabels int
+
+	// samplesLimit is the current limit on the number of samples per request.
+	samplesLimit int
+	successes    int
+
+	// lastDecreaseTime is the last time samplesLimit has been decreased.
+	// It is used for preventing from multiple decreases on 413 responses for concurrent requests.
+	lastDecreaseTime time.Time
+
+	limitDecreases *metrics.Counter
+}
+
+func newSendLimits(argIdx int, sanitizedURL string) *sendLimits {
+	maxSamples := maxSamplesPerSend.GetOptionalArgOrDefault(argIdx, 0)
+	if maxSamples <= 0 {
+		maxSamples = maxRowsPerBlock
+	}
+	maxLabels := maxLabelsPerSend.GetOptionalArgOrDefault(argIdx, 0)
+	if maxLabels < 0 {
+		maxLabels = 0
+	}
+	sl := &sendLimits{
+		maxSamples:   maxSamples,
+		maxLabels:    maxLabels,
+		samplesLimit: maxSamples,
+	}
+	_ = metrics.GetOrCreateGauge(fmt.Sprintf(`vmagent_remotewrite_max_samples_per_send{url=%q}`, sanitizedURL), func() float64 {
+		return float64(sl.getSamplesLimit())
+	})
+	sl.limitDecreases = metrics.GetOrCreateCounter(fmt.Sprintf(`vmagent_remotewrite_max_samples_per_send_decreases_total{url=%q}`, sanitizedURL))
+	return sl
+}
+
+// getSamplesLimit returns the current limit on the number of samples per request.
+func (sl *sendLimits) getSamplesLimit() int {
+	sl.mu.Lock()
+	n := sl.samplesLimit
+	sl.mu.Unlock()
+	return n
+}
+
+// registerSuccess registers successfully sent request.
+func (sl *sendLimits) registerSuccess() {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	if sl.samplesLimit >= sl.maxSamples {
+		return
+	}
+	sl.successes++
+	if sl.successes < 16 {
+		return
+	}
+	// Additive increase.
+	sl.successes = 0
+	n := sl.maxSamples / 16
+	if n < 1 {
+		n = 1
+	}
+	sl.samplesLimit += n
+	if sl.samplesLimit > sl.maxSamples {
+		sl.samplesLimit = sl.maxSamples
+	}
+}
+
+// registerTooLarge registers 413 Request Entity Too Large response from remote storage.
+func (sl *sendLimits) registerTooLarge() {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	sl.successes = 0
+	now := time.Now()
+	if now.Sub(sl.lastDecreaseTime) < time.Second {
+		return
+	}
+	sl.lastDecreaseTime = now
+	if sl.samplesLimit <= 1 {
+		return
+	}
+	// Multiplicative decrease.
+	sl.samplesLimit /= 2
+	sl.limitDecreases.Inc()
+}
+
+// pushWriteRequestChunks pushes wr to pushBlock in chunks, which don't exceed sl limits.
+//
+// If tenantLabel isn't empty, then series in wr are re-ordered, so every chunk contains series for a single tenant.
+// Metadata is sent with the first chunk.
+func pushWriteRequestChunks(wr *prompbmarshal.WriteRequest, pushBlock func(block []byte), isVMRemoteWrite bool, sl *sendLimits, tenantLabel string) {
+	timeseries := wr.Timeseries
+	metadata := wr.Metadata
+	if len(tenantLabel) > 0 {
+		sort.SliceStable(timeseries, func(i, j int) bool {
+			return getLabelValue(timeseries[i].Labels, tenantLabel) < getLabelValue(timeseries[j].Labels, tenantLabel)
+		})
+	}
+	samplesLimit := sl.getSamplesLimit()
+	start := 0
+	samples := 0
+	labels := 0
+	tenant := ""
+	for i := range timeseries {
+		ts := &timeseries[i]
+		if i > start {
+			mustFlush := samples+len(ts.Samples) > samplesLimit ||
+				sl.maxLabels > 0 && labels+len(ts.Labels) > sl.maxLabels ||
+				len(tenantLabel) > 0 && getLabelValue(ts.Labels, tenantLabel) != tenant
+			if mustFlush {
+				wr.Timeseries = timeseries[start:i]
+				pushWriteRequest(wr, pushBlock, isVMRemoteWrite)
+				wr.Metadata = nil
+				start = i
+				samples = 0
+				labels = 0
+			}
+		}
+		if i == start && len(tenantLabel) > 0 {
+			tenant = getLabelValue(ts.Labels, tenantLabel)
+		}
+		samples += len(ts.Samples)
+		labels += len(ts.Labels)
+	}
+	wr.Timeseries = timeseries[start:]
+	pushWriteRequest(wr, pushBlock, isVMRemoteWrite)
+	wr.Timeseries = timeseries
+	wr.Metadata = metadata
+}
+
+func getLabelValue(labels []prompbmarshal.Label, name string) string {
+	for _, label := range labels {
+		if label.Name == name {
+			return label.Value
+		}
+	}
+	return ""
+}
+
+// getBlockTenant returns the value for tenantLabel from the first series in the given block.
+//
+// The block must contain snappy-compressed or zstd-compressed WriteRequest with series for a single tenant.
+func getBlockTenant(block []byte, tenantLabel string) (string, error) {
+	bb := blockStatsBufPool.Get()
+	defer blockStatsBufPool.Put(bb)
+	var err error
+	bb.B, err = decompressBlock(bb.B, block)
+	if err != nil {
+		return "", err
+	}
+	wr := blockStatsWriteRequestPool.Get().(*prompb.WriteRequest)
+	defer func() {
+		wr.Reset()
+		blockStatsWriteRequestPool.Put(wr)
+	}()
+	if err := wr.Unmarshal(bb.B); err != nil {
+		return "", fmt.Errorf("cannot unmarshal WriteRequest from block with size %d bytes: %w", len(bb.B), err)
+	}
+	if len(wr.Timeseries) == 0 {
+		return "", nil
+	}
+	for _, label := range wr.Timeseries[0].Labels {
+		if string(label.Name) == tenantLabel {
+			return string(label.Value), nil
+		}
+	}
+	return "", nil
+}
+
+// splitBlock splits the given block into two halves and passes them to pushBlock.
+//
+// It returns false if the block cannot be split, since it contains a single series or a single metadata entry.
+func splitBlock(block []byte, pushBlock func(block []byte)) (bool, error) {
+	bb := blockStatsBufPool.Get()
+	defer blockStatsBufPool.Put(bb)
+	var err error
+	bb.B, err = decompressBlock(bb.B, block)
+	if err != nil {
+		return false, err
+	}
+	wrSrc := blockStatsWriteRequestPool.Get().(*prompb.WriteRequest)
+	defer func() {
+		wrSrc.Reset()
+		blockStatsWriteRequestPool.Put(wrSrc)
+	}()
+	if err := wrSrc.Unmarshal(bb.B); err != nil {
+		return false, fmt.Errorf("cannot unmarshal WriteRequest from block with size %d bytes: %w", len(bb.B), err)
+	}
+	if len(wrSrc.Timeseries) <= 1 && len(wrSrc.Metadata) <= 1 {
+		return false, nil
+	}
+	var wr prompbmarshal.WriteRequest
+	convertWriteRequest(&wr, wrSrc)
+	isVMRemoteWrite := isZstdBlock(block)
+
+	// Send metadata only with the first part.
+	timeseries := wr.Timeseries
+	metadata := wr.Metadata
+	if len(timeseries) <= 1 {
+		n := len(metadata) / 2
+		wr.Metadata = metadata[:n]
+		pushWriteRequest(&wr, pushBlock, isVMRemoteWrite)
+		wr.Timeseries = nil
+		wr.Metadata = metadata[n:]
+		pushWriteRequest(&wr, pushBlock, isVMRemoteWrite)
+		return true, nil
+	}
+	n := len(timeseries) / 2
+	wr.Timeseries = timeseries[:n]
+	pushWriteRequest(&wr, pushBlock, isVMRemoteWrite)
+	wr.Metadata = nil
+	wr.Timeseries = timeseries[n:]
+	pushWriteRequest(&wr, pushBlock, isVMRemoteWrite)
+	return true, nil
+}
+
+// convertWriteRequest converts src to dst.
+//
+// dst refers to src contents, so it cannot be used after src is changed.
+func convertWriteRequest(dst *prompbmarshal.WriteRequest, src *prompb.WriteRequest) {
+	convertLabels := func(labels []prompb.Label) []prompbmarshal.Label {
+		result := make([]prompbmarshal.Label, len(labels))
+		for i, label := range labels {
+			result[i] = prompbmarshal.Label{
+				Name:  bytesutil.ToUnsafeString(label.Name),
+				Value: bytesutil.ToUnsafeString(label.Value),
+			}
+		}
+		return result
+	}
+	tss := make([]prompbmarshal.TimeSeries, len(src.Timeseries))
+	for i := range src.Timeseries {
+		tsSrc := &src.Timeseries[i]
+		ts := &tss[i]
+		ts.Labels = convertLabels(tsSrc.Labels)
+		ts.Samples = make([]prompbmarshal.Sample, len(tsSrc.Samples))
+		for j, s := range tsSrc.Samples {
+			ts.Samples[j] = prompbmarshal.Sample{
+				Value:     s.Value,
+				Timestamp: s.Timestamp,
+			}
+		}
+		ts.Exemplars = make([]prompbmarshal.Exemplar, len(tsSrc.Exemplars))
+		for j := range tsSrc.Exemplars {
+			e := &tsSrc.Exemplars[j]
+			ts.Exemplars[j] = prompbmarshal.Exemplar{
+				Labels:    convertLabels(e.Labels),
+				Value:     e.Value,
+				Timestamp: e.Timestamp,
+			}
+		}
+	}
+	mms := make([]prompbmarshal.MetricMetadata, len(src.Metadata))
+	for i := range src.Metadata {
+		mm := &src.Metadata[i]
+		mms[i] = prompbmarshal.MetricMetadata{
+			Type:             prompbmarshal.MetricMetadata_MetricType(mm.Type),
+			MetricFamilyName: bytesutil.ToUnsafeString(mm.MetricFamilyName),
+			Help:             bytesutil.ToUnsafeString(mm.Help),
+			Unit:             bytesutil.ToUnsafeString(mm.Unit),
+		}
+	}
+	dst.Timeseries = tss
+	dst.Metadata = mms
+}
@@ -0,0 +1,233 @@
+package remotewrite
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+func TestSendLimitsAdaptive(t *testing.T) {
+	sl := &sendLimits{
+		maxSamples:   1000,
+		samplesLimit: 1000,
+	}
+	sl.limitDecreases = metrics.GetOrCreateCounter(`vmagent_remotewrite_max_samples_per_send_decreases_total{url="test"}`)
+
+	sl.registerTooLarge()
+	if n := sl.getSamplesLimit(); n != 500 {
+		t.Fatalf("unexpected limit after 413 response; got %d; want 500", n)
+	}
+	// The limit mustn't be decreased more frequently than once per second.
+	sl.registerTooLarge()
+	if n := sl.getSamplesLimit(); n != 500 {
+		t.Fatalf("unexpected limit after the second 413 response; got %d; want 500", n)
+	}
+	for i := 0; i < 15; i++ {
+		sl.registerSuccess()
+	}
+	if n := sl.getSamplesLimit(); n != 500 {
+		t.Fatalf("unexpected limit after 15 successful requests; got %d; want 500", n)
+	}
+	sl.registerSuccess()
+	if n := sl.getSamplesLimit(); n != 562 {
+		t.Fatalf("unexpected limit after 16 successful requests; got %d; want 562", n)
+	}
+	for i := 0; i < 1000; i++ {
+		sl.registerSuccess()
+	}
+	if n := sl.getSamplesLimit(); n != 1000 {
+		t.Fatalf("the limit cannot exceed the configured value; got %d; want 1000", n)
+	}
+}
+
+func TestPushWriteRequestChunks(t *testing.T) {
+	f := func(tss []prompbmarshal.TimeSeries, maxSamples, maxLabels int, tenantLabel string, resultExpected []string) {
+		t.Helper()
+		sl := &sendLimits{
+			maxSamples:   maxSamples,
+			maxLabels:    maxLabels,
+			samplesLimit: maxSamples,
+		}
+		wr := &prompbmarshal.WriteRequest{
+			Timeseries: tss,
+		}
+		var result []string
+		pushBlock := func(block []byte) {
+			names, tenant := getTestBlockContents(t, block, tenantLabel)
+			result = append(result, fmt.Sprintf("%s%v", tenant, names))
+		}
+		pushWriteRequestChunks(wr, pushBlock, false, sl, tenantLabel)
+		if !reflect.DeepEqual(result, resultExpected) {
+			t.Fatalf("unexpected blocks;\ngot\n%q\nwant\n%q", result, resultExpected)
+		}
+	}
+	newSeries := func(name string, samples int, labels ...string) prompbmarshal.TimeSeries {
+		ts := prompbmarshal.TimeSeries{
+			Labels: []prompbmarshal.Label{{
+				Name:  "__name__",
+				Value: name,
+			}},
+		}
+		for i := 0; i < len(labels); i += 2 {
+			ts.Labels = append(ts.Labels, prompbmarshal.Label{
+				Name:  labels[i],
+				Value: labels[i+1],
+			})
+		}
+		for i := 0; i < samples; i++ {
+			ts.Samples = append(ts.Samples, prompbmarshal.Sample{
+				Value:     float64(i),
+				Timestamp: int64(i),
+			})
+		}
+		return ts
+	}
+
+	// No splitting
+	f([]prompbmarshal.TimeSeries{
+		newSeries("a", 2),
+		newSeries("b", 3),
+	}, 100, 0, "", []string{"[a b]"})
+
+	// Split by samples
+	f([]prompbmarshal.TimeSeries{
+		newSeries("a", 2),
+		newSeries("b", 3),
+		newSeries("c", 1),
+		newSeries("d", 10),
+	}, 5, 0, "", []string{"[a b]", "[c]", "[d]"})
+
+	// Split by labels
+	f([]prompbmarshal.TimeSeries{
+		newSeries("a", 1, "foo", "bar"),
+		newSeries("b", 1),
+		newSeries("c", 1, "foo", "bar", "x", "y"),
+	}, 100, 3, "", []string{"[a b]", "[c]"})
+
+	// Split by tenant
+	f([]prompbmarshal.TimeSeries{
+		newSeries("a", 1, "tenant", "t2"),
+		newSeries("b", 1, "tenant", "t1"),
+		newSeries("c", 1),
+		newSeries("d", 1, "tenant", "t2"),
+		newSeries("e", 1, "tenant", "t1"),
+		newSeries("f", 1, "tenant", "t1"),
+	}, 2, 0, "tenant", []string{"[c]", "t1[b e]", "t1[f]", "t2[a d]"})
+}
+
+func TestSplitBlock(t *testing.T) {
+	var blocks [][]byte
+	pushBlock := func(block []byte) {
+		blocks = append(blocks, append([]byte{}, block...))
+	}
+	wr := &prompbmarshal.WriteRequest{
+		Timeseries: []prompbmarshal.TimeSeries{
+			{
+				Labels:  []prompbmarshal.Label{{Name: "__name__", Value: "a"}},
+				Samples: []prompbmarshal.Sample{{Value: 1, Timestamp: 2}},
+			},
+			{
+				Labels:  []prompbmarshal.Label{{Name: "__name__", Value: "b"}},
+				Samples: []prompbmarshal.Sample{{Value: 3, Timestamp: 4}},
+			},
+			{
+				Labels:  []prompbmarshal.Label{{Name: "__name__", Value: "c"}},
+				Samples: []prompbmarshal.Sample{{Value: 5, Timestamp: 6}},
+			},
+		},
+	}
+	pushWriteRequest(wr, pushBlock, true)
+	if len(blocks) != 1 {
+		t.Fatalf("unexpected number of blocks; got %d; want 1", len(blocks))
+	}
+	block := blocks[0]
+	blocks = nil
+	ok, err := splitBlock(block, pushBlock)
+	if err != nil {
+		t.Fatalf("unexpected error when splitting block: %s", err)
+	}
+	if !ok {
+		t.Fatalf("cannot split block with 3 series")
+	}
+	var result [][]string
+	for _, b := range blocks {
+		if !isZstdBlock(b) {
+			t.Fatalf("the split block must preserve zstd compression")
+		}
+		names, _ := getTestBlockContents(t, b, "")
+		result = append(result, names)
+	}
+	resultExpected := [][]string{{"a"}, {"b", "c"}}
+	if !reflect.DeepEqual(result, resultExpected) {
+		t.Fatalf("unexpected split blocks; got %q; want %q", result, resultExpected)
+	}
+
+	// A block with a single series cannot be split.
+	blocks = nil
+	ok, err = splitBlock(newSingleSeriesBlock(t), pushBlock)
+	if err != nil {
+		t.Fatalf("unexpected error when splitting block with a single series: %s", err)
+	}
+	if ok {
+		t.Fatalf("expecting false from splitBlock for a block with a single series")
+	}
+	if len(blocks) != 0 {
+		t.Fatalf("unexpected blocks pushed for a block with a single series: %d", len(blocks))
+	}
+
+	// An invalid block cannot be split.
+	if _, err := splitBlock([]byte("foobar"), pushBlock); err == nil {
+		t.Fatalf("expecting non-nil error when splitting invalid block")
+	}
+	if len(blocks) != 0 {
+		t.Fatalf("unexpected blocks pushed for invalid block: %d", len(blocks))
+	}
+}
+
+func newSingleSeriesBlock(t *testing.T) []byte {
+	t.Helper()
+	var block []byte
+	wr := &prompbmarshal.WriteRequest{
+		Timeseries: []prompbmarshal.TimeSeries{{
+			Labels:  []prompbmarshal.Label{{Name: "__name__", Value: "a"}},
+			Samples: []prompbmarshal.Sample{{Value: 1, Timestamp: 2}},
+		}},
+	}
+	pushWriteRequest(wr, func(b []byte) {
+		block = append([]byte{}, b...)
+	}, false)
+	return block
+}
+
+// getTestBlockContents returns metric names for series in the block and the tenant for the block.
+func getTestBlockContents(t *testing.T, block []byte, tenantLabel string) ([]string, string) {
+	t.Helper()
+	data, err := decompressBlock(nil, block)
+	if err != nil {
+		t.Fatalf("cannot decompress block: %s", err)
+	}
+	var wr prompb.WriteRequest
+	if err := wr.Unmarshal(data); err != nil {
+		t.Fatalf("cannot unmarshal block: %s", err)
+	}
+	var names []string
+	for _, ts := range wr.Timeseries {
+		for _, label := range ts.Labels {
+			if string(label.Name) == "__name__" {
+				names = append(names, string(label.Value))
+			}
+		}
+	}
+	tenant := ""
+	if tenantLabel != "" {
+		tenant, err = getBlockTenant(block, tenantLabel)
+		if err != nil {
+			t.Fatalf("cannot obtain tenant for block: %s", err)
+		}
+	}
+	return names, tenant
+}
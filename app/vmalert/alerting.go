@@ -19,15 +19,16 @@ import (
 
 // AlertingRule is basic alert entity
 type AlertingRule struct {
-	Type        datasource.Type
-	RuleID      uint64
-	Name        string
-	Expr        string
-	For         time.Duration
-	Labels      map[string]string
-	Annotations map[string]string
-	GroupID     uint64
-	GroupName   string
+	Type          datasource.Type
+	RuleID        uint64
+	Name          string
+	Expr          string
+	For           time.Duration
+	KeepFiringFor time.Duration
+	Labels        map[string]string
+	Annotations   map[string]string
+	GroupID       uint64
+	GroupName     string
 
 	// guard status fields
 	mu sync.RWMutex
@@ -35,6 +36,8 @@ type AlertingRule struct {
 	alerts map[uint64]*notifier.Alert
 	// stores last moment of time Exec was called
 	lastExecTime time.Time
+	// stores the duration of the last Exec call
+	lastExecDuration time.Duration
 	// stores last error that happened in Exec func
 	// resets on every successful Exec
 	// may be used as Health state
@@ -51,17 +54,18 @@ type alertingRuleMetrics struct {
 
 func newAlertingRule(group *Group, cfg config.Rule) *AlertingRule {
 	ar := &AlertingRule{
-		Type:        cfg.Type,
-		RuleID:      cfg.ID,
-		Name:        cfg.Alert,
-		Expr:        cfg.Expr,
-		For:         cfg.For.Duration(),
-		Labels:      cfg.Labels,
-		Annotations: cfg.Annotations,
-		GroupID:     group.ID(),
-		GroupName:   group.Name,
-		alerts:      make(map[uint64]*notifier.Alert),
-		metrics:     &alertingRuleMetrics{},
+		Type:          cfg.Type,
+		RuleID:        cfg.ID,
+		Name:          cfg.Alert,
+		Expr:          cfg.Expr,
+		For:           cfg.For.Duration(),
+		KeepFiringFor: cfg.KeepFiringFor.Duration(),
+		Labels:        cfg.Labels,
+		Annotations:   cfg.Annotations,
+		GroupID:       group.ID(),
+		GroupName:     group.Name,
+		alerts:        make(map[uint64]*notifier.Alert),
+		metrics:       &alertingRuleMetrics{},
 	}
 
 	labels := fmt.Sprintf(`alertname=%q, group=%q, id="%d"`, ar.Name, group.Name, ar.ID())
@@ -121,13 +125,15 @@ func (ar *AlertingRule) ID() uint64 {
 
 // Exec executes AlertingRule expression via the given Querier.
 // Based on the Querier results AlertingRule maintains notifier.Alerts
-func (ar *AlertingRule) Exec(ctx context.Context, q datasource.Querier, series bool) ([]prompbmarshal.TimeSeries, error) {
+func (ar *AlertingRule) Exec(ctx context.Context, q datasource.Querier, ts time.Time, series bool) ([]prompbmarshal.TimeSeries, error) {
+	start := time.Now()
 	qMetrics, err := q.Query(ctx, ar.Expr, ar.Type)
 	ar.mu.Lock()
 	defer ar.mu.Unlock()
 
 	ar.lastExecError = err
-	ar.lastExecTime = time.Now()
+	ar.lastExecTime = ts
+	ar.lastExecDuration = time.Since(start)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute query %q: %w", ar.Expr, err)
 	}
@@ -193,10 +199,22 @@ func (ar *AlertingRule) Exec(ctx context.Context, q datasource.Querier, series b
 				delete(ar.alerts, h)
 				continue
 			}
+			if a.State == notifier.StateFiring && ar.KeepFiringFor > 0 {
+				// keep the alert firing for KeepFiringFor
+				// in order to tolerate brief gaps in data
+				if a.KeepFiringSince.IsZero() {
+					a.KeepFiringSince = ar.lastExecTime
+				}
+				if ar.lastExecTime.Sub(a.KeepFiringSince) < ar.KeepFiringFor {
+					continue
+				}
+			}
 			a.State = notifier.StateInactive
+			a.KeepFiringSince = time.Time{}
 			continue
 		}
-		if a.State == notifier.StatePending && time.Since(a.Start) >= ar.For {
+		a.KeepFiringSince = time.Time{}
+		if a.State == notifier.StatePending && ts.Sub(a.Start) >= ar.For {
 			a.State = notifier.StateFiring
 			alertsFired.Inc()
 		}
@@ -207,6 +225,68 @@ func (ar *AlertingRule) Exec(ctx context.Context, q datasource.Querier, series b
 	return nil, nil
 }
 
+// ExecRange executes AlertingRule expression on the given time range via the given Querier
+// and returns ALERTS and ALERTS_FOR_STATE time series for every evaluation step.
+// The state of active alerts is preserved between ExecRange calls,
+// so the consecutive time ranges may be passed for evaluation.
+// ExecRange is supposed to be used only in replay mode.
+func (ar *AlertingRule) ExecRange(ctx context.Context, q datasource.Querier, start, end time.Time, step time.Duration) ([]prompbmarshal.TimeSeries, error) {
+	series, err := q.QueryRange(ctx, ar.Expr, ar.Type, start, end, step)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query %q: %w", ar.Expr, err)
+	}
+	// templates with queries are evaluated at the current time,
+	// so they can't be used for the historical data.
+	qFn := func(query string) ([]datasource.Metric, error) {
+		return nil, fmt.Errorf("`query` template isn't supported in replay mode")
+	}
+
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+
+	var result []prompbmarshal.TimeSeries
+	for _, s := range series {
+		labels, err := expandLabels(s, qFn, ar)
+		if err != nil {
+			return nil, fmt.Errorf("failed to expand labels: %s", err)
+		}
+		for k, v := range labels {
+			s.SetLabel(k, v)
+		}
+		h := hash(s)
+		a, ok := ar.alerts[h]
+		if !ok {
+			a = &notifier.Alert{
+				GroupID: ar.GroupID,
+				Name:    ar.Name,
+				Labels:  ar.alertLabels(s),
+				Expr:    ar.Expr,
+				ID:      h,
+			}
+			ar.alerts[h] = a
+		}
+		for i := range s.Timestamps {
+			at := time.Unix(s.Timestamps[i], 0)
+			// the alert becomes active on the first data point
+			// and after every gap in the data points.
+			// Firing alerts tolerate gaps shorter than KeepFiringFor.
+			// a.End holds the timestamp of the previous data point.
+			gap := at.Sub(a.End)
+			if gap > step && !(a.State == notifier.StateFiring && gap <= step+ar.KeepFiringFor) {
+				a.Start = at
+			}
+			a.End = at
+			a.Value = s.Values[i]
+			a.State = notifier.StatePending
+			if at.Sub(a.Start) >= ar.For {
+				a.State = notifier.StateFiring
+			}
+			result = append(result, ar.alertToTimeSeries(a, at)...)
+		}
+	}
+	return result, nil
+}
+
 func expandLabels(m datasource.Metric, q notifier.QueryFn, ar *AlertingRule) (map[string]string, error) {
 	metricLabels := make(map[string]string)
 	for _, l := range m.Labels {
@@ -242,6 +322,7 @@ func (ar *AlertingRule) UpdateWith(r Rule) error {
 	}
 	ar.Expr = nr.Expr
 	ar.For = nr.For
+	ar.KeepFiringFor = nr.KeepFiringFor
 	ar.Labels = nr.Labels
 	ar.Annotations = nr.Annotations
 	return nil
@@ -270,24 +351,29 @@ func (ar *AlertingRule) newAlert(m datasource.Metric, start time.Time, qFn notif
 	a := &notifier.Alert{
 		GroupID: ar.GroupID,
 		Name:    ar.Name,
-		Labels:  map[string]string{},
+		Labels:  ar.alertLabels(m),
 		Value:   m.Value,
 		Start:   start,
 		Expr:    ar.Expr,
 	}
+	var err error
+	a.Annotations, err = a.ExecTemplate(qFn, ar.Annotations)
+	return a, err
+}
+
+func (ar *AlertingRule) alertLabels(m datasource.Metric) map[string]string {
+	labels := map[string]string{}
 	// label defined here to make override possible by
 	// time series labels.
-	a.Labels[alertGroupNameLabel] = ar.GroupName
+	labels[alertGroupNameLabel] = ar.GroupName
 	for _, l := range m.Labels {
 		// drop __name__ to be consistent with Prometheus alerting
 		if l.Name == "__name__" {
 			continue
 		}
-		a.Labels[l.Name] = l.Value
+		labels[l.Name] = l.Value
 	}
-	var err error
-	a.Annotations, err = a.ExecTemplate(qFn, ar.Annotations)
-	return a, err
+	return labels
 }
 
 // AlertAPI generates APIAlert object from alert by its id(hash)
@@ -310,17 +396,62 @@ func (ar *AlertingRule) RuleAPI() APIAlertingRule {
 	}
 	return APIAlertingRule{
 		// encode as strings to avoid rounding
-		ID:          fmt.Sprintf("%d", ar.ID()),
-		GroupID:     fmt.Sprintf("%d", ar.GroupID),
-		Type:        ar.Type.String(),
-		Name:        ar.Name,
-		Expression:  ar.Expr,
-		For:         ar.For.String(),
-		LastError:   lastErr,
-		LastExec:    ar.lastExecTime,
-		Labels:      ar.Labels,
-		Annotations: ar.Annotations,
+		ID:            fmt.Sprintf("%d", ar.ID()),
+		GroupID:       fmt.Sprintf("%d", ar.GroupID),
+		Type:          ar.Type.String(),
+		Name:          ar.Name,
+		Expression:    ar.Expr,
+		For:           ar.For.String(),
+		KeepFiringFor: ar.KeepFiringFor.String(),
+		LastError:     lastErr,
+		LastExec:      ar.lastExecTime,
+		Labels:        ar.Labels,
+		Annotations:   ar.Annotations,
+	}
+}
+
+// PromRuleAPI returns Rule representation in form
+// of Prometheus-compatible APIPromRule
+func (ar *AlertingRule) PromRuleAPI() APIPromRule {
+	ar.mu.RLock()
+	defer ar.mu.RUnlock()
+
+	r := APIPromRule{
+		// encode as strings to avoid rounding
+		ID:             fmt.Sprintf("%d", ar.ID()),
+		GroupID:        fmt.Sprintf("%d", ar.GroupID),
+		Type:           "alerting",
+		DatasourceType: ar.Type.String(),
+		Name:           ar.Name,
+		Query:          ar.Expr,
+		Duration:       ar.For.Seconds(),
+		Labels:         ar.Labels,
+		Annotations:    ar.Annotations,
+		State:          notifier.StateInactive.String(),
+		Health:         ruleHealth(ar.lastExecTime, ar.lastExecError),
+		LastEvaluation: ar.lastExecTime,
+		EvaluationTime: ar.lastExecDuration.Seconds(),
+	}
+	if ar.lastExecError != nil {
+		r.LastError = ar.lastExecError.Error()
+	}
+	for _, a := range ar.alerts {
+		if a.State == notifier.StateInactive {
+			continue
+		}
+		switch {
+		case a.State == notifier.StateFiring:
+			r.State = notifier.StateFiring.String()
+		case r.State != notifier.StateFiring.String():
+			r.State = notifier.StatePending.String()
+		}
+		r.Alerts = append(r.Alerts, ar.newAlertAPI(*a))
 	}
+	// sort alerts for deterministic output
+	sort.Slice(r.Alerts, func(i, j int) bool {
+		return r.Alerts[i].ID < r.Alerts[j].ID
+	})
+	return r
 }
 
 // AlertsAPI generates list of APIAlert objects from existing alerts
@@ -414,6 +545,9 @@ func (ar *AlertingRule) Restore(ctx context.Context, q datasource.Querier, lookb
 	for k, v := range labels {
 		labelsFilter += fmt.Sprintf(",%s=%q", k, v)
 	}
+	// alerts with the same name may exist in distinct groups,
+	// so filter by group name as well
+	labelsFilter += fmt.Sprintf(",%s=%q", alertGroupNameLabel, ar.GroupName)
 
 	// Get the last data point in range via MetricsQL `last_over_time`.
 	// We don't use plain PromQL since Prometheus doesn't support
@@ -29,6 +29,15 @@ type Group struct {
 	Interval    time.Duration `yaml:"interval,omitempty"`
 	Rules       []Rule        `yaml:"rules"`
 	Concurrency int           `yaml:"concurrency"`
+	// EvalDelay defines the delay for rules evaluation,
+	// so rules are evaluated at now()-EvalDelay in order to account for late-arriving data.
+	EvalDelay PromDuration `yaml:"eval_delay,omitempty"`
+	// EvalOffset defines the offset within the group interval at which rules are evaluated.
+	// The group start is spread randomly within the interval if EvalOffset isn't set.
+	EvalOffset *PromDuration `yaml:"eval_offset,omitempty"`
+	// RemoteWrite contains names of remote write destinations for the group results.
+	// Results are written to all the configured destinations if empty.
+	RemoteWrite []string `yaml:"remote_write,omitempty"`
 	// Checksum stores the hash of yaml definition for this group.
 	// May be used to detect any changes like rules re-ordering etc.
 	Checksum string
@@ -75,6 +84,27 @@ func (g *Group) Validate(validateAnnotations, validateExpressions bool) error {
 		return fmt.Errorf("group %q can't contain no rules", g.Name)
 	}
 
+	if g.EvalDelay.Duration() < 0 {
+		return fmt.Errorf("eval_delay can't be negative; got %s", g.EvalDelay.Duration())
+	}
+	if g.Concurrency < 0 {
+		return fmt.Errorf("concurrency can't be negative; got %d", g.Concurrency)
+	}
+	if g.EvalOffset != nil {
+		offset := g.EvalOffset.Duration()
+		if offset < 0 {
+			return fmt.Errorf("eval_offset can't be negative; got %s", offset)
+		}
+		if g.Interval > 0 && offset >= g.Interval {
+			return fmt.Errorf("eval_offset=%s must be smaller than interval=%s", offset, g.Interval)
+		}
+	}
+	for _, name := range g.RemoteWrite {
+		if name == "" {
+			return fmt.Errorf("remote_write can't contain empty names")
+		}
+	}
+
 	uniqueRules := map[uint64]struct{}{}
 	for _, r := range g.Rules {
 		ruleName := r.Record
@@ -114,14 +144,17 @@ func (g *Group) Validate(validateAnnotations, validateExpressions bool) error {
 // Rule describes entity that represent either
 // recording rule or alerting rule.
 type Rule struct {
-	ID          uint64
-	Type        datasource.Type   `yaml:"type,omitempty"`
-	Record      string            `yaml:"record,omitempty"`
-	Alert       string            `yaml:"alert,omitempty"`
-	Expr        string            `yaml:"expr"`
-	For         PromDuration      `yaml:"for"`
-	Labels      map[string]string `yaml:"labels,omitempty"`
-	Annotations map[string]string `yaml:"annotations,omitempty"`
+	ID     uint64
+	Type   datasource.Type `yaml:"type,omitempty"`
+	Record string          `yaml:"record,omitempty"`
+	Alert  string          `yaml:"alert,omitempty"`
+	Expr   string          `yaml:"expr"`
+	For    PromDuration    `yaml:"for"`
+	// KeepFiringFor defines how long the alert must keep firing
+	// after its expression stops returning results.
+	KeepFiringFor PromDuration      `yaml:"keep_firing_for,omitempty"`
+	Labels        map[string]string `yaml:"labels,omitempty"`
+	Annotations   map[string]string `yaml:"annotations,omitempty"`
 
 	// Catches all undefined fields and must be empty after parsing.
 	XXX map[string]interface{} `yaml:",inline"`
@@ -158,6 +191,11 @@ func (pd *PromDuration) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	return nil
 }
 
+// IsZero implements yaml.IsZeroer interface.
+func (pd PromDuration) IsZero() bool {
+	return pd.milliseconds == 0
+}
+
 // Duration returns duration for pd.
 func (pd *PromDuration) Duration() time.Duration {
 	return time.Duration(pd.milliseconds) * time.Millisecond
@@ -211,6 +249,12 @@ func (r *Rule) Validate() error {
 	if r.Expr == "" {
 		return fmt.Errorf("expression can't be empty")
 	}
+	if r.KeepFiringFor.Duration() < 0 {
+		return fmt.Errorf("keep_firing_for can't be negative; got %s", r.KeepFiringFor.Duration())
+	}
+	if r.Record != "" && !r.KeepFiringFor.IsZero() {
+		return fmt.Errorf("keep_firing_for can be set only for alerting rules")
+	}
 	return checkOverflow(r.XXX, "rule")
 }
 
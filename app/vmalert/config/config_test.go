@@ -82,6 +82,15 @@ func TestRule_Validate(t *testing.T) {
 	if err := (&Rule{Alert: "alert", Expr: "test>0"}).Validate(); err != nil {
 		t.Errorf("expected valid rule; got %s", err)
 	}
+	if err := (&Rule{Alert: "alert", Expr: "test>0", KeepFiringFor: NewPromDuration(time.Minute)}).Validate(); err != nil {
+		t.Errorf("expected valid rule; got %s", err)
+	}
+	if err := (&Rule{Record: "record", Expr: "test", KeepFiringFor: NewPromDuration(time.Minute)}).Validate(); err == nil {
+		t.Errorf("expected keep_firing_for error for recording rule")
+	}
+	if err := (&Rule{Alert: "alert", Expr: "test>0", KeepFiringFor: NewPromDuration(-time.Minute)}).Validate(); err == nil {
+		t.Errorf("expected negative keep_firing_for error")
+	}
 }
 
 func TestGroup_Validate(t *testing.T) {
@@ -100,6 +109,55 @@ func TestGroup_Validate(t *testing.T) {
 			group:  &Group{Name: "test"},
 			expErr: "contain no rules",
 		},
+		{
+			group: &Group{Name: "test",
+				EvalDelay: NewPromDuration(-time.Minute),
+				Rules: []Rule{
+					{
+						Record: "record",
+						Expr:   "up",
+					},
+				},
+			},
+			expErr: "eval_delay can't be negative",
+		},
+		{
+			group: &Group{Name: "test",
+				RemoteWrite: []string{"foo", ""},
+				Rules: []Rule{
+					{
+						Record: "record",
+						Expr:   "up",
+					},
+				},
+			},
+			expErr: "remote_write can't contain empty names",
+		},
+		{
+			group: &Group{Name: "test",
+				Interval:   time.Minute,
+				EvalOffset: func() *PromDuration { d := NewPromDuration(2 * time.Minute); return &d }(),
+				Rules: []Rule{
+					{
+						Record: "record",
+						Expr:   "up",
+					},
+				},
+			},
+			expErr: "must be smaller than interval",
+		},
+		{
+			group: &Group{Name: "test",
+				Concurrency: -1,
+				Rules: []Rule{
+					{
+						Record: "record",
+						Expr:   "up",
+					},
+				},
+			},
+			expErr: "concurrency can't be negative",
+		},
 		{
 			group: &Group{Name: "test",
 				Rules: []Rule{
@@ -2,6 +2,7 @@ package datasource
 
 import (
 	"context"
+	"time"
 )
 
 // Querier interface wraps Query method which
@@ -9,6 +10,13 @@ import (
 // as result
 type Querier interface {
 	Query(ctx context.Context, query string, engine Type) ([]Metric, error)
+	// QueryRange executes the given query on the [start...end] time range
+	// with the given step and returns Metrics with filled
+	// Timestamps and Values fields.
+	QueryRange(ctx context.Context, query string, engine Type, start, end time.Time, step time.Duration) ([]Metric, error)
+	// WithEvalDelay returns a copy of Querier, which evaluates
+	// instant queries at now()-evalDelay instead of now().
+	WithEvalDelay(evalDelay time.Duration) Querier
 }
 
 // Metric is the basic entity which should be return by datasource
@@ -17,6 +25,10 @@ type Metric struct {
 	Labels    []Label
 	Timestamp int64
 	Value     float64
+
+	// Timestamps and Values are set only for results of range queries.
+	Timestamps []int64
+	Values     []float64
 }
 
 // SetLabel adds or updates existing one label
@@ -18,6 +18,7 @@ type response struct {
 		Result     []struct {
 			Labels map[string]string `json:"metric"`
 			TV     [2]interface{}    `json:"value"`
+			Values [][2]interface{}  `json:"values"`
 		} `json:"result"`
 	} `json:"data"`
 	ErrorType string `json:"errorType"`
@@ -45,6 +46,34 @@ func (r response) metrics() ([]Metric, error) {
 	return ms, nil
 }
 
+func (r response) rangeMetrics() ([]Metric, error) {
+	var ms []Metric
+	for _, res := range r.Data.Result {
+		var m Metric
+		for k, v := range res.Labels {
+			m.AddLabel(k, v)
+		}
+		for _, tv := range res.Values {
+			ts, ok := tv[0].(float64)
+			if !ok {
+				return nil, fmt.Errorf("metric %v, unable to parse timestamp from %v", res.Labels, tv[0])
+			}
+			s, ok := tv[1].(string)
+			if !ok {
+				return nil, fmt.Errorf("metric %v, unable to parse value from %v", res.Labels, tv[1])
+			}
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil {
+				return nil, fmt.Errorf("metric %v, unable to parse float64 from %s: %w", res.Labels, s, err)
+			}
+			m.Timestamps = append(m.Timestamps, int64(ts))
+			m.Values = append(m.Values, f)
+		}
+		ms = append(ms, m)
+	}
+	return ms, nil
+}
+
 type graphiteResponse []graphiteResponseTarget
 
 type graphiteResponseTarget struct {
@@ -81,9 +110,11 @@ type VMStorage struct {
 	appendTypePrefix bool
 	lookBack         time.Duration
 	queryStep        time.Duration
+	evalDelay        time.Duration
 }
 
 const queryPath = "/api/v1/query"
+const queryRangePath = "/api/v1/query_range"
 const graphitePath = "/render"
 
 const prometheusPrefix = "/prometheus"
@@ -102,6 +133,14 @@ func NewVMStorage(baseURL, basicAuthUser, basicAuthPass string, lookBack time.Du
 	}
 }
 
+// WithEvalDelay returns a copy of s, which evaluates instant queries at now()-evalDelay.
+// evalDelay overrides the lookBack for Prometheus queries.
+func (s *VMStorage) WithEvalDelay(evalDelay time.Duration) Querier {
+	ns := *s
+	ns.evalDelay = evalDelay
+	return &ns
+}
+
 // Query reads metrics from datasource by given query and type
 func (s *VMStorage) Query(ctx context.Context, query string, dataSourceType Type) ([]Metric, error) {
 	switch dataSourceType.name {
@@ -114,6 +153,26 @@ func (s *VMStorage) Query(ctx context.Context, query string, dataSourceType Type
 	}
 }
 
+// QueryRange executes the given query on the [start...end] time range with the given step.
+// Only Prometheus datasource type is supported.
+func (s *VMStorage) QueryRange(ctx context.Context, query string, dataSourceType Type, start, end time.Time, step time.Duration) ([]Metric, error) {
+	switch dataSourceType.name {
+	case "", prometheusType:
+	default:
+		return nil, fmt.Errorf("range queries are not supported for engine %q", dataSourceType)
+	}
+	if start.IsZero() {
+		return nil, fmt.Errorf("start param is missing")
+	}
+	if end.IsZero() {
+		return nil, fmt.Errorf("end param is missing")
+	}
+	setReqParams := func(r *http.Request, query string) {
+		s.setPrometheusRangeReqParams(r, query, start, end, step)
+	}
+	return s.queryDataSource(ctx, query, setReqParams, parsePrometheusRangeResponse)
+}
+
 func (s *VMStorage) queryDataSource(
 	ctx context.Context,
 	query string,
@@ -148,7 +207,11 @@ func (s *VMStorage) setPrometheusReqParams(r *http.Request, query string) {
 	r.URL.Path += queryPath
 	q := r.URL.Query()
 	q.Set("query", query)
-	if s.lookBack > 0 {
+	switch {
+	case s.evalDelay > 0:
+		ts := time.Now().Add(-s.evalDelay)
+		q.Set("time", fmt.Sprintf("%d", ts.Unix()))
+	case s.lookBack > 0:
 		lookBack := time.Now().Add(-s.lookBack)
 		q.Set("time", fmt.Sprintf("%d", lookBack.Unix()))
 	}
@@ -158,6 +221,21 @@ func (s *VMStorage) setPrometheusReqParams(r *http.Request, query string) {
 	r.URL.RawQuery = q.Encode()
 }
 
+func (s *VMStorage) setPrometheusRangeReqParams(r *http.Request, query string, start, end time.Time, step time.Duration) {
+	if s.appendTypePrefix {
+		r.URL.Path += prometheusPrefix
+	}
+	r.URL.Path += queryRangePath
+	q := r.URL.Query()
+	q.Set("query", query)
+	q.Set("start", fmt.Sprintf("%d", start.Unix()))
+	q.Set("end", fmt.Sprintf("%d", end.Unix()))
+	if step > 0 {
+		q.Set("step", step.String())
+	}
+	r.URL.RawQuery = q.Encode()
+}
+
 func (s *VMStorage) setGraphiteReqParams(r *http.Request, query string) {
 	if s.appendTypePrefix {
 		r.URL.Path += graphitePrefix
@@ -167,17 +245,23 @@ func (s *VMStorage) setGraphiteReqParams(r *http.Request, query string) {
 	q.Set("format", "json")
 	q.Set("target", query)
 	from := "-5min"
+	until := "now"
+	if s.evalDelay > 0 {
+		ts := time.Now().Add(-s.evalDelay)
+		from = strconv.FormatInt(ts.Add(-5*time.Minute).Unix(), 10)
+		until = strconv.FormatInt(ts.Unix(), 10)
+	}
 	if s.lookBack > 0 {
-		lookBack := time.Now().Add(-s.lookBack)
+		lookBack := time.Now().Add(-s.lookBack - s.evalDelay)
 		from = strconv.FormatInt(lookBack.Unix(), 10)
 	}
 	q.Set("from", from)
-	q.Set("until", "now")
+	q.Set("until", until)
 	r.URL.RawQuery = q.Encode()
 }
 
 const (
-	statusSuccess, statusError, rtVector = "success", "error", "vector"
+	statusSuccess, statusError, rtVector, rtMatrix = "success", "error", "vector", "matrix"
 )
 
 func parsePrometheusResponse(req *http.Request, resp *http.Response) ([]Metric, error) {
@@ -197,6 +281,23 @@ func parsePrometheusResponse(req *http.Request, resp *http.Response) ([]Metric,
 	return r.metrics()
 }
 
+func parsePrometheusRangeResponse(req *http.Request, resp *http.Response) ([]Metric, error) {
+	r := &response{}
+	if err := json.NewDecoder(resp.Body).Decode(r); err != nil {
+		return nil, fmt.Errorf("error parsing prometheus metrics for %s: %w", req.URL, err)
+	}
+	if r.Status == statusError {
+		return nil, fmt.Errorf("response error, query: %s, errorType: %s, error: %s", req.URL, r.ErrorType, r.Error)
+	}
+	if r.Status != statusSuccess {
+		return nil, fmt.Errorf("unknown status: %s, Expected success or error ", r.Status)
+	}
+	if r.Data.ResultType != rtMatrix {
+		return nil, fmt.Errorf("unknown result type:%s. Expected matrix", r.Data.ResultType)
+	}
+	return r.rangeMetrics()
+}
+
 func parseGraphiteResponse(req *http.Request, resp *http.Response) ([]Metric, error) {
 	r := &graphiteResponse{}
 	if err := json.NewDecoder(resp.Body).Decode(r); err != nil {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strconv"
 	"testing"
 	"time"
@@ -125,3 +126,86 @@ func TestVMSelectQuery(t *testing.T) {
 		t.Fatalf("unexpected metric %+v want %+v", m[0], expected)
 	}
 }
+
+func TestVMSelectQueryRange(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(_ http.ResponseWriter, _ *http.Request) {
+		t.Errorf("should not be called")
+	})
+	c := -1
+	start, end := time.Unix(1583786140, 0), time.Unix(1583786160, 0)
+	mux.HandleFunc("/api/v1/query_range", func(w http.ResponseWriter, r *http.Request) {
+		c++
+		q := r.URL.Query()
+		if q.Get("query") != query {
+			t.Errorf("expected %s in query param, got %s", query, q.Get("query"))
+		}
+		if q.Get("start") != strconv.FormatInt(start.Unix(), 10) {
+			t.Errorf("unexpected 'start' query param: %q", q.Get("start"))
+		}
+		if q.Get("end") != strconv.FormatInt(end.Unix(), 10) {
+			t.Errorf("unexpected 'end' query param: %q", q.Get("end"))
+		}
+		if q.Get("step") != "10s" {
+			t.Errorf("unexpected 'step' query param: %q", q.Get("step"))
+		}
+		switch c {
+		case 0:
+			w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+		case 1:
+			w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"__name__":"vm_rows"},"values":[[1583786140,"1"],[1583786150,"2"],[1583786160,"3"]]}]}}`))
+		}
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	am := NewVMStorage(srv.URL, basicAuthName, basicAuthPass, 0, 0, false, srv.Client())
+	if _, err := am.QueryRange(ctx, queryRender, NewGraphiteType(), start, end, 10*time.Second); err == nil {
+		t.Fatalf("expected unsupported engine error got nil")
+	}
+	if _, err := am.QueryRange(ctx, query, NewPrometheusType(), time.Time{}, end, 10*time.Second); err == nil {
+		t.Fatalf("expected missing start error got nil")
+	}
+	if _, err := am.QueryRange(ctx, query, NewPrometheusType(), start, end, 10*time.Second); err == nil {
+		t.Fatalf("expected non-matrix resultType error got nil")
+	}
+	m, err := am.QueryRange(ctx, query, NewPrometheusType(), start, end, 10*time.Second)
+	if err != nil {
+		t.Fatalf("unexpected %s", err)
+	}
+	if len(m) != 1 {
+		t.Fatalf("expected 1 metric got %d in %+v", len(m), m)
+	}
+	expected := Metric{
+		Labels:     []Label{{Value: "vm_rows", Name: "__name__"}},
+		Timestamps: []int64{1583786140, 1583786150, 1583786160},
+		Values:     []float64{1, 2, 3},
+	}
+	if !reflect.DeepEqual(m[0], expected) {
+		t.Fatalf("unexpected metric %+v want %+v", m[0], expected)
+	}
+}
+
+func TestVMSelectQueryWithEvalDelay(t *testing.T) {
+	const evalDelay = time.Hour
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/query", func(w http.ResponseWriter, r *http.Request) {
+		ts, err := strconv.ParseInt(r.URL.Query().Get("time"), 10, 64)
+		if err != nil {
+			t.Errorf("failed to parse 'time' query param: %s", err)
+		}
+		expected := time.Now().Add(-evalDelay).Unix()
+		if ts > expected || ts < expected-60 {
+			t.Errorf("unexpected 'time' query param; got %d; want %d", ts, expected)
+		}
+		w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	// evalDelay must override lookBack
+	s := NewVMStorage(srv.URL, "", "", time.Minute, 0, false, srv.Client())
+	if _, err := s.WithEvalDelay(evalDelay).Query(ctx, query, NewPrometheusType()); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
@@ -25,8 +25,18 @@ type Group struct {
 	Type        datasource.Type
 	Interval    time.Duration
 	Concurrency int
+	EvalDelay   time.Duration
+	// EvalOffset is the offset within the Interval at which the group
+	// is evaluated. Nil means the offset is derived from the group ID.
+	EvalOffset  *time.Duration
+	RemoteWrite []string
 	Checksum    string
 
+	// lastEvaluation is the start time of the last group evaluation
+	lastEvaluation time.Time
+	// lastEvaluationDuration is the duration of the last group evaluation
+	lastEvaluationDuration time.Duration
+
 	doneCh     chan struct{}
 	finishedCh chan struct{}
 	// channel accepts new Group obj
@@ -56,11 +66,17 @@ func newGroup(cfg config.Group, defaultInterval time.Duration, labels map[string
 		File:        cfg.File,
 		Interval:    cfg.Interval,
 		Concurrency: cfg.Concurrency,
+		EvalDelay:   cfg.EvalDelay.Duration(),
+		RemoteWrite: cfg.RemoteWrite,
 		Checksum:    cfg.Checksum,
 		doneCh:      make(chan struct{}),
 		finishedCh:  make(chan struct{}),
 		updateCh:    make(chan *Group),
 	}
+	if cfg.EvalOffset != nil {
+		offset := cfg.EvalOffset.Duration()
+		g.EvalOffset = &offset
+	}
 	g.metrics = newGroupMetrics(g.Name, g.File)
 	if g.Interval == 0 {
 		g.Interval = defaultInterval
@@ -162,6 +178,9 @@ func (g *Group) updateWith(newGroup *Group) error {
 	}
 	g.Type = newGroup.Type
 	g.Concurrency = newGroup.Concurrency
+	g.EvalDelay = newGroup.EvalDelay
+	g.EvalOffset = newGroup.EvalOffset
+	g.RemoteWrite = newGroup.RemoteWrite
 	g.Checksum = newGroup.Checksum
 	g.Rules = newRules
 	return nil
@@ -189,18 +208,12 @@ func (g *Group) close() {
 
 var skipRandSleepOnGroupStart bool
 
-func (g *Group) start(ctx context.Context, querier datasource.Querier, nts []notifier.Notifier, rw *remotewrite.Client) {
+func (g *Group) start(ctx context.Context, querier datasource.Querier, nts func() []notifier.Notifier, rw *remotewrite.Clients) {
 	defer func() { close(g.finishedCh) }()
 
 	// Spread group rules evaluation over time in order to reduce load on VictoriaMetrics.
 	if !skipRandSleepOnGroupStart {
-		randSleep := uint64(float64(g.Interval) * (float64(uint32(g.ID())) / (1 << 32)))
-		sleepOffset := uint64(time.Now().UnixNano()) % uint64(g.Interval)
-		if randSleep < sleepOffset {
-			randSleep += uint64(g.Interval)
-		}
-		randSleep -= sleepOffset
-		sleepTimer := time.NewTimer(time.Duration(randSleep))
+		sleepTimer := time.NewTimer(g.startDelay(time.Now()))
 		select {
 		case <-ctx.Done():
 			sleepTimer.Stop()
@@ -213,7 +226,7 @@ func (g *Group) start(ctx context.Context, querier datasource.Querier, nts []not
 	}
 
 	logger.Infof("group %q started; interval=%v; concurrency=%d", g.Name, g.Interval, g.Concurrency)
-	e := &executor{querier, nts, rw}
+	e := &executor{g.getQuerier(querier), nts, g.getRemoteWrite(rw)}
 	t := time.NewTicker(g.Interval)
 	defer t.Stop()
 	for {
@@ -237,6 +250,8 @@ func (g *Group) start(ctx context.Context, querier datasource.Querier, nts []not
 				t.Stop()
 				t = time.NewTicker(g.Interval)
 			}
+			e.querier = g.getQuerier(querier)
+			e.rw = g.getRemoteWrite(rw)
 			g.mu.Unlock()
 			logger.Infof("group %q re-started; interval=%v; concurrency=%d", g.Name, g.Interval, g.Concurrency)
 		case <-t.C:
@@ -251,14 +266,55 @@ func (g *Group) start(ctx context.Context, querier datasource.Querier, nts []not
 			}
 
 			g.metrics.iterationDuration.UpdateDuration(iterationStart)
+			g.mu.Lock()
+			g.lastEvaluation = iterationStart
+			g.lastEvaluationDuration = time.Since(iterationStart)
+			g.mu.Unlock()
 		}
 	}
 }
 
+// startDelay returns the duration to wait since now before the first group evaluation,
+// so the group is evaluated at the same offset within every interval.
+//
+// The offset is set via EvalOffset. Otherwise, it is derived from the group ID,
+// so groups are evenly spread within the interval and do not hit the datasource simultaneously.
+func (g *Group) startDelay(now time.Time) time.Duration {
+	interval := uint64(g.Interval)
+	offset := uint64(float64(interval) * (float64(uint32(g.ID())) / (1 << 32)))
+	if g.EvalOffset != nil {
+		offset = uint64(*g.EvalOffset) % interval
+	}
+	nowOffset := uint64(now.UnixNano()) % interval
+	if offset < nowOffset {
+		offset += interval
+	}
+	return time.Duration(offset - nowOffset)
+}
+
+// getQuerier returns q adjusted to the group params.
+func (g *Group) getQuerier(q datasource.Querier) datasource.Querier {
+	if g.EvalDelay > 0 {
+		return q.WithEvalDelay(g.EvalDelay)
+	}
+	return q
+}
+
+// getRemoteWrite returns remote write destinations for the group results.
+func (g *Group) getRemoteWrite(rw *remotewrite.Clients) *remotewrite.Clients {
+	selected, err := rw.Select(g.RemoteWrite)
+	if err != nil {
+		// g.RemoteWrite is validated before the group is started or updated
+		logger.Panicf("BUG: group %q: %s", g.Name, err)
+	}
+	return selected
+}
+
 type executor struct {
-	querier   datasource.Querier
-	notifiers []notifier.Notifier
-	rw        *remotewrite.Client
+	querier datasource.Querier
+	// notifiers returns the current list of notifiers to send alerts to
+	notifiers func() []notifier.Notifier
+	rw        *remotewrite.Clients
 }
 
 func (e *executor) execConcurrently(ctx context.Context, rules []Rule, concurrency int, interval time.Duration) chan error {
@@ -310,7 +366,7 @@ func (e *executor) exec(ctx context.Context, rule Rule, returnSeries bool, inter
 		execDuration.UpdateDuration(execStart)
 	}()
 
-	tss, err := rule.Exec(ctx, e.querier, returnSeries)
+	tss, err := rule.Exec(ctx, e.querier, execStart, returnSeries)
 	if err != nil {
 		execErrors.Inc()
 		return fmt.Errorf("rule %q: failed to execute: %w", rule, err)
@@ -351,7 +407,7 @@ func (e *executor) exec(ctx context.Context, rule Rule, returnSeries bool, inter
 
 	alertsSent.Add(len(alerts))
 	errGr := new(utils.ErrGroup)
-	for _, nt := range e.notifiers {
+	for _, nt := range e.notifiers() {
 		if err := nt.Send(ctx, alerts); err != nil {
 			alertsSendErrors.Inc()
 			errGr.Add(fmt.Errorf("rule %q: failed to send alerts: %w", rule, err))
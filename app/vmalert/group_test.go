@@ -195,7 +195,7 @@ func TestGroupStart(t *testing.T) {
 	fs.add(m1)
 	fs.add(m2)
 	go func() {
-		g.start(context.Background(), fs, []notifier.Notifier{fn}, nil)
+		g.start(context.Background(), fs, func() []notifier.Notifier { return []notifier.Notifier{fn} }, nil)
 		close(finished)
 	}()
 
@@ -221,3 +221,36 @@ func TestGroupStart(t *testing.T) {
 	g.close()
 	<-finished
 }
+
+func TestGroupStartDelay(t *testing.T) {
+	g := &Group{
+		Name:     "group",
+		Interval: time.Minute,
+	}
+	f := func(now time.Time, offset *time.Duration, exp time.Duration) {
+		t.Helper()
+		g.EvalOffset = offset
+		if delay := g.startDelay(now); delay != exp {
+			t.Fatalf("expected delay %s; got %s", exp, delay)
+		}
+	}
+	offset := func(d time.Duration) *time.Duration { return &d }
+	ts := time.Date(2021, 1, 1, 10, 0, 20, 0, time.UTC)
+	f(ts, offset(30*time.Second), 10*time.Second)
+	f(ts, offset(0), 40*time.Second)
+	f(ts, offset(20*time.Second), 0)
+	f(ts, offset(10*time.Second), 50*time.Second)
+	// offset bigger than interval is wrapped
+	f(ts, offset(90*time.Second), 10*time.Second)
+
+	// the offset derived from the group ID must be stable
+	// and must be within the interval
+	g.EvalOffset = nil
+	d1, d2 := g.startDelay(ts), g.startDelay(ts.Add(time.Second))
+	if d1 < 0 || d1 >= g.Interval {
+		t.Fatalf("delay %s is out of interval %s", d1, g.Interval)
+	}
+	if d1 != d2+time.Second && d1+g.Interval != d2+time.Second {
+		t.Fatalf("expected the same evaluation offset; got delays %s and %s", d1, d2)
+	}
+}
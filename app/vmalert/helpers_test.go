@@ -7,6 +7,7 @@ import (
 	"sort"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/datasource"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/notifier"
@@ -49,6 +50,14 @@ func (fq *fakeQuerier) Query(_ context.Context, _ string, _ datasource.Type) ([]
 	return cp, nil
 }
 
+func (fq *fakeQuerier) QueryRange(ctx context.Context, q string, engine datasource.Type, _, _ time.Time, _ time.Duration) ([]datasource.Metric, error) {
+	return fq.Query(ctx, q, engine)
+}
+
+func (fq *fakeQuerier) WithEvalDelay(_ time.Duration) datasource.Querier {
+	return fq
+}
+
 type fakeNotifier struct {
 	sync.Mutex
 	alerts []notifier.Alert
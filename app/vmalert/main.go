@@ -15,13 +15,16 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/notifier"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/remoteread"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/remotewrite"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/utils"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/buildinfo"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/configcheck"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/envflag"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/procutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/pushmetrics"
 	"github.com/VictoriaMetrics/metrics"
 )
 
@@ -34,6 +37,14 @@ Examples:
 absolute path to all .yaml files in root.
 Rule files may contain %{ENV_VAR} placeholders, which are substituted by the corresponding env vars.`)
 
+	ruleTemplatesPath = flagutil.NewArray("rule.templates", `Path or glob pattern to location with go template definitions
+for rules annotations templating. Flag can be specified multiple times.
+Examples:
+ -rule.templates="/path/to/file". Path to a single file with go templates
+ -rule.templates="dir/*.tpl" -rule.templates="/*.tpl". Relative path to all .tpl files in "dir" folder,
+absolute path to all .tpl files in root.
+Templates are reloaded together with rules.`)
+
 	httpListenAddr     = flag.String("httpListenAddr", ":8880", "Address to listen for http connections")
 	evaluationInterval = flag.Duration("evaluationInterval", time.Minute, "How often to evaluate the rules")
 
@@ -47,6 +58,8 @@ eg. 'explore?orgId=1&left=[\"now-1h\",\"now\",\"VictoriaMetrics\",{\"expr\": \"{
 
 	remoteReadLookBack = flag.Duration("remoteRead.lookback", time.Hour, "Lookback defines how far to look into past for alerts timeseries."+
 		" For example, if lookback=1h then range from now() to now()-1h will be scanned.")
+	remoteReadIgnoreRestoreErrors = flag.Bool("remoteRead.ignoreRestoreErrors", true, "Whether to ignore errors from remote storage when restoring alerts state on startup. "+
+		"If set to false, vmalert fails to start when alerts state cannot be restored from -remoteRead.url")
 
 	dryRun = flag.Bool("dryRun", false, "Whether to check only config files without running vmalert. The rules file are validated. The `-rule` flag must be specified.")
 )
@@ -55,13 +68,31 @@ func main() {
 	// Write flags and help message to stdout, since it is easier to grep or pipe.
 	flag.CommandLine.SetOutput(os.Stdout)
 	flag.Usage = usage
+	isCheckRules := configcheck.IsSubcommand("check-rules")
 	envflag.Parse()
 	buildinfo.Init()
+	if isUnittestMode() {
+		// the embedded storage and flags dump are too verbose for the tests output
+		_ = flag.Set("loggerLevel", "ERROR")
+	}
 	logger.Init()
 
+	if isUnittestMode() {
+		if !unitRule(*unittestFile...) {
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	if isCheckRules {
+		r := checkRules()
+		r.WriteAndExit()
+	}
 	if *dryRun {
 		u, _ := url.Parse("https://victoriametrics.com/")
 		notifier.InitTemplateFunc(u)
+		if err := notifier.LoadTemplates(*ruleTemplatesPath); err != nil {
+			logger.Fatalf("cannot load templates: %s", err)
+		}
 		groups, err := config.Parse(*rulePath, true, true)
 		if err != nil {
 			logger.Fatalf(err.Error())
@@ -71,6 +102,12 @@ func main() {
 		}
 		return
 	}
+	if isReplayMode() {
+		if err := runReplay(); err != nil {
+			logger.Fatalf("replay failed: %s", err)
+		}
+		return
+	}
 	ctx, cancel := context.WithCancel(context.Background())
 	manager, err := newManager(ctx)
 	if err != nil {
@@ -89,6 +126,12 @@ func main() {
 			<-sigHup
 			configReloads.Inc()
 			logger.Infof("SIGHUP received. Going to reload rules %q ...", *rulePath)
+			if err := notifier.LoadTemplates(*ruleTemplatesPath); err != nil {
+				configReloadErrors.Inc()
+				configSuccess.Set(0)
+				logger.Errorf("error while reloading templates: %s", err)
+				continue
+			}
 			if err := manager.update(ctx, *rulePath, *validateTemplates, *validateExpressions, false); err != nil {
 				configReloadErrors.Inc()
 				configSuccess.Set(0)
@@ -101,16 +144,19 @@ func main() {
 		}
 	}()
 
+	pushmetrics.Init()
 	rh := &requestHandler{m: manager}
 	go httpserver.Serve(*httpListenAddr, rh.handler)
 
 	sig := procutil.WaitForSigterm()
 	logger.Infof("service received signal %s", sig)
+	pushmetrics.Stop()
 	if err := httpserver.Stop(*httpListenAddr); err != nil {
 		logger.Fatalf("cannot stop the webservice: %s", err)
 	}
 	cancel()
 	manager.close()
+	notifier.Stop()
 }
 
 var (
@@ -130,6 +176,9 @@ func newManager(ctx context.Context) (*manager, error) {
 		return nil, fmt.Errorf("failed to init `external.url`: %w", err)
 	}
 	notifier.InitTemplateFunc(eu)
+	if err := notifier.LoadTemplates(*ruleTemplatesPath); err != nil {
+		return nil, fmt.Errorf("failed to load templates: %w", err)
+	}
 	aug, err := getAlertURLGenerator(eu, *externalAlertSource, *validateTemplates)
 	if err != nil {
 		return nil, fmt.Errorf("failed to init `external.alert.source`: %w", err)
@@ -143,7 +192,6 @@ func newManager(ctx context.Context) (*manager, error) {
 		groups:    make(map[uint64]*Group),
 		querier:   q,
 		notifiers: nts,
-		labels:    map[string]string{},
 	}
 	rw, err := remotewrite.Init(ctx)
 	if err != nil {
@@ -157,6 +205,15 @@ func newManager(ctx context.Context) (*manager, error) {
 	}
 	manager.rr = rr
 
+	manager.labels, err = getExternalLabels()
+	if err != nil {
+		return nil, err
+	}
+	return manager, nil
+}
+
+func getExternalLabels() (map[string]string, error) {
+	labels := make(map[string]string)
 	for _, s := range *externalLabels {
 		if len(s) == 0 {
 			continue
@@ -165,9 +222,46 @@ func newManager(ctx context.Context) (*manager, error) {
 		if n < 0 {
 			return nil, fmt.Errorf("missing '=' in `-label`. It must contain label in the form `name=value`; got %q", s)
 		}
-		manager.labels[s[:n]] = s[n+1:]
+		labels[s[:n]] = s[n+1:]
 	}
-	return manager, nil
+	return labels, nil
+}
+
+// runReplay evaluates rules on the time range set via -replay.* flags
+// and writes the results to -remoteWrite.url.
+func runReplay() error {
+	eu, err := getExternalURL(*externalURL, *httpListenAddr, httpserver.IsTLS())
+	if err != nil {
+		return fmt.Errorf("failed to init `external.url`: %w", err)
+	}
+	notifier.InitTemplateFunc(eu)
+	if err := notifier.LoadTemplates(*ruleTemplatesPath); err != nil {
+		return fmt.Errorf("failed to load templates: %w", err)
+	}
+	groupsCfg, err := config.Parse(*rulePath, *validateTemplates, *validateExpressions)
+	if err != nil {
+		return fmt.Errorf("cannot parse configuration file: %w", err)
+	}
+	q, err := datasource.Init()
+	if err != nil {
+		return fmt.Errorf("failed to init datasource: %w", err)
+	}
+	labels, err := getExternalLabels()
+	if err != nil {
+		return err
+	}
+	rw, err := remotewrite.Init(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to init remoteWrite: %w", err)
+	}
+	if rw == nil {
+		return fmt.Errorf("remoteWrite.url can't be empty in replay mode")
+	}
+	replayErr := replay(groupsCfg, q, rw, labels)
+	if err := rw.Close(); err != nil {
+		return fmt.Errorf("cannot stop the remotewrite: %w", err)
+	}
+	return replayErr
 }
 
 func getExternalURL(externalURL, httpListenAddr string, isSecure bool) (*url.URL, error) {
@@ -214,6 +308,38 @@ func getAlertURLGenerator(externalURL *url.URL, externalAlertSource string, vali
 	}, nil
 }
 
+// checkRules checks rule and template files without starting vmalert.
+//
+// See `vmalert check-rules` subcommand.
+func checkRules() *configcheck.Report {
+	var r configcheck.Report
+	if flag.Lookup("datasource.url").Value.String() == "" {
+		r.AddWarning("-datasource.url", "-datasource.url must be set when running vmalert")
+	}
+	u, _ := url.Parse("https://victoriametrics.com/")
+	notifier.InitTemplateFunc(u)
+	if err := notifier.LoadTemplates(*ruleTemplatesPath); err != nil {
+		r.AddError("-rule.templates", err)
+		return &r
+	}
+	groups, err := config.Parse(*rulePath, true, true)
+	if err != nil {
+		if eg, ok := err.(*utils.ErrGroup); ok {
+			for _, err := range eg.Errors() {
+				r.AddError("-rule", err)
+			}
+		} else {
+			r.AddError("-rule", err)
+		}
+		return &r
+	}
+	if len(groups) == 0 {
+		r.AddError("-rule", fmt.Errorf("no rules found at %q; please specify path to file(s) with alerting and/or recording rules using `-rule` flag", *rulePath))
+	}
+	r.AddRedundantFlagWarnings()
+	return &r
+}
+
 func usage() {
 	const s = `
 vmalert processes alerts and recording rules.
@@ -16,9 +16,9 @@ import (
 // manager controls group states
 type manager struct {
 	querier   datasource.Querier
-	notifiers []notifier.Notifier
+	notifiers func() []notifier.Notifier
 
-	rw *remotewrite.Client
+	rw *remotewrite.Clients
 	rr datasource.Querier
 
 	wg     sync.WaitGroup
@@ -63,10 +63,13 @@ func (m *manager) close() {
 	m.wg.Wait()
 }
 
-func (m *manager) startGroup(ctx context.Context, group *Group, restore bool) {
+func (m *manager) startGroup(ctx context.Context, group *Group, restore bool) error {
 	if restore && m.rr != nil {
 		err := group.Restore(ctx, m.rr, *remoteReadLookBack, m.labels)
 		if err != nil {
+			if !*remoteReadIgnoreRestoreErrors {
+				return fmt.Errorf("failed to restore state for group %q: %w", group.Name, err)
+			}
 			logger.Errorf("error while restoring state for group %q: %s", group.Name, err)
 		}
 	}
@@ -78,6 +81,7 @@ func (m *manager) startGroup(ctx context.Context, group *Group, restore bool) {
 		m.wg.Done()
 	}()
 	m.groups[id] = group
+	return nil
 }
 
 func (m *manager) update(ctx context.Context, path []string, validateTpl, validateExpr, restore bool) error {
@@ -87,6 +91,12 @@ func (m *manager) update(ctx context.Context, path []string, validateTpl, valida
 		return fmt.Errorf("cannot parse configuration file: %w", err)
 	}
 
+	for _, cfg := range groupsCfg {
+		if _, err := m.rw.Select(cfg.RemoteWrite); err != nil {
+			return fmt.Errorf("invalid `remote_write` for group %q: %w", cfg.Name, err)
+		}
+	}
+
 	groupsRegistry := make(map[uint64]*Group)
 	for _, cfg := range groupsCfg {
 		ng := newGroup(cfg, *evaluationInterval, m.labels)
@@ -116,7 +126,10 @@ func (m *manager) update(ctx context.Context, path []string, validateTpl, valida
 		}
 	}
 	for _, ng := range groupsRegistry {
-		m.startGroup(ctx, ng, restore)
+		if err := m.startGroup(ctx, ng, restore); err != nil {
+			m.groupsMu.Unlock()
+			return err
+		}
 	}
 	m.groupsMu.Unlock()
 
@@ -134,6 +147,30 @@ func (m *manager) update(ctx context.Context, path []string, validateTpl, valida
 	return nil
 }
 
+func (g *Group) toPromAPI() APIPromGroup {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	pg := APIPromGroup{
+		// encode as string to avoid rounding
+		ID:             fmt.Sprintf("%d", g.ID()),
+		Name:           g.Name,
+		File:           g.File,
+		Interval:       g.Interval.Seconds(),
+		LastEvaluation: g.lastEvaluation,
+		EvaluationTime: g.lastEvaluationDuration.Seconds(),
+	}
+	for _, r := range g.Rules {
+		switch v := r.(type) {
+		case *AlertingRule:
+			pg.Rules = append(pg.Rules, v.PromRuleAPI())
+		case *RecordingRule:
+			pg.Rules = append(pg.Rules, v.PromRuleAPI())
+		}
+	}
+	return pg
+}
+
 func (g *Group) toAPI() APIGroup {
 	g.mu.RLock()
 	defer g.mu.RUnlock()
@@ -146,6 +183,11 @@ func (g *Group) toAPI() APIGroup {
 		File:        g.File,
 		Interval:    g.Interval.String(),
 		Concurrency: g.Concurrency,
+		EvalDelay:   g.EvalDelay.String(),
+		RemoteWrite: g.RemoteWrite,
+	}
+	if g.EvalOffset != nil {
+		ag.EvalOffset = g.EvalOffset.String()
 	}
 	for _, r := range g.Rules {
 		switch v := r.(type) {
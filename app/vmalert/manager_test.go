@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"math/rand"
 	"net/url"
 	"os"
@@ -12,6 +13,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/datasource"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/notifier"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/remotewrite"
 )
 
 func TestMain(m *testing.M) {
@@ -39,7 +41,7 @@ func TestManagerUpdateConcurrent(t *testing.T) {
 	m := &manager{
 		groups:    make(map[uint64]*Group),
 		querier:   &fakeQuerier{},
-		notifiers: []notifier.Notifier{&fakeNotifier{}},
+		notifiers: func() []notifier.Notifier { return []notifier.Notifier{&fakeNotifier{}} },
 	}
 	paths := []string{
 		"config/testdata/dir/rules0-good.rules",
@@ -72,6 +74,78 @@ func TestManagerUpdateConcurrent(t *testing.T) {
 	wg.Wait()
 }
 
+// TestManagerRestoreErrors tests that restore errors
+// prevent manager from starting only if they aren't ignored
+func TestManagerRestoreErrors(t *testing.T) {
+	defaultIgnoreRestoreErrors := *remoteReadIgnoreRestoreErrors
+	defer func() { *remoteReadIgnoreRestoreErrors = defaultIgnoreRestoreErrors }()
+
+	f := func(ignoreErrors bool) error {
+		t.Helper()
+		*remoteReadIgnoreRestoreErrors = ignoreErrors
+		rr := &fakeQuerier{}
+		rr.setErr(fmt.Errorf("remote read error"))
+		m := &manager{
+			groups:    make(map[uint64]*Group),
+			querier:   &fakeQuerier{},
+			notifiers: func() []notifier.Notifier { return []notifier.Notifier{&fakeNotifier{}} },
+			rr:        rr,
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer func() {
+			cancel()
+			m.close()
+		}()
+		return m.start(ctx, []string{"config/testdata/rules0-good.rules"}, true, true)
+	}
+	if err := f(true); err != nil {
+		t.Fatalf("expected restore errors to be ignored; got %s", err)
+	}
+	if err := f(false); err == nil {
+		t.Fatalf("expected to get restore error")
+	}
+}
+
+func TestManagerRemoteWriteDestinations(t *testing.T) {
+	f := func(rw *remotewrite.Clients, expErr bool) {
+		t.Helper()
+		m := &manager{
+			groups:    make(map[uint64]*Group),
+			querier:   &fakeQuerier{},
+			notifiers: func() []notifier.Notifier { return []notifier.Notifier{&fakeNotifier{}} },
+			rw:        rw,
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer func() {
+			cancel()
+			m.wg.Wait()
+		}()
+		err := m.start(ctx, []string{"config/testdata/rules4-good.rules"}, true, true)
+		if expErr && err == nil {
+			t.Fatalf("expected to get an error")
+		}
+		if !expErr && err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	newClients := func(names ...string) *remotewrite.Clients {
+		clients := make([]*remotewrite.Client, len(names))
+		for i := range names {
+			clients[i] = &remotewrite.Client{}
+		}
+		cs, err := remotewrite.NewClients(names, clients)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return cs
+	}
+	// remote write isn't configured
+	f(nil, true)
+	// unknown destination
+	f(newClients("short-term"), true)
+	f(newClients("short-term", "long-term"), false)
+}
+
 // TestManagerUpdate tests sequential configuration
 // updates.
 func TestManagerUpdate(t *testing.T) {
@@ -25,6 +25,11 @@ type Alert struct {
 	End   time.Time
 	Value float64
 	ID    uint64
+
+	// KeepFiringSince is the time when the alert expression stopped returning results
+	// while the alert was kept firing because of `keep_firing_for` param.
+	// It is zero if the alert expression returns results.
+	KeepFiringSince time.Time
 }
 
 // AlertState type indicates the Alert state
@@ -106,7 +111,10 @@ func templateAnnotations(annotations map[string]string, data AlertTplData, funcs
 }
 
 func templateAnnotation(dst io.Writer, text string, data AlertTplData, funcs template.FuncMap) error {
-	t := template.New("").Funcs(funcs).Option("missingkey=zero")
+	t, err := newTemplate(funcs)
+	if err != nil {
+		return err
+	}
 	tpl, err := t.Parse(text)
 	if err != nil {
 		return fmt.Errorf("error parsing annotation: %w", err)
@@ -74,6 +74,27 @@ func TestAlert_ExecTemplate(t *testing.T) {
 				"desc":    "bar 1;garply 2;",
 			},
 		},
+		{
+			name: "functions",
+			alert: &Alert{
+				Value:  1536,
+				Labels: map[string]string{"instance": "localhost:8428"},
+			},
+			annotations: map[string]string{
+				"bytes":    "{{ $value | humanizeBytes }}",
+				"time":     `{{ (1e9 | toTime).Format "2006-01-02" }}`,
+				"duration": `{{ parseDuration "1h5m" }}`,
+				"host":     "{{ $labels.instance | stripPort }}",
+				"sorted":   `{{ range query "bar" | sortByLabel "baz" }}{{ . | label "baz" }};{{ end }}`,
+			},
+			expTpl: map[string]string{
+				"bytes":    "1.5KiB",
+				"time":     "2001-09-09",
+				"duration": "3900",
+				"host":     "localhost",
+				"sorted":   "fred;qux;",
+			},
+		},
 	}
 
 	qFn := func(q string) ([]datasource.Metric, error) {
@@ -112,3 +133,39 @@ func TestAlert_ExecTemplate(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadTemplates(t *testing.T) {
+	defer func() {
+		if err := LoadTemplates(nil); err != nil {
+			t.Fatalf("cannot reset templates: %s", err)
+		}
+	}()
+
+	if err := LoadTemplates([]string{"testdata/templates/*.bad.tmpl"}); err == nil {
+		t.Fatalf("expected to get an error on bad templates")
+	}
+	if err := LoadTemplates([]string{"testdata/templates/*.good.tmpl"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	alert := &Alert{Labels: map[string]string{"instance": "localhost"}}
+	tpl, err := alert.ExecTemplate(nil, map[string]string{
+		"summary": `{{ template "instanceDown" . }}`,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if exp := "Instance localhost is down"; tpl["summary"] != exp {
+		t.Fatalf("expected %q; got %q", exp, tpl["summary"])
+	}
+	if err := ValidateTemplates(map[string]string{"summary": `{{ template "unknown" . }}`}); err == nil {
+		t.Fatalf("expected to get an error for undefined template")
+	}
+
+	// failed reload must keep previously loaded templates
+	if err := LoadTemplates([]string{"testdata/templates/*.bad.tmpl"}); err == nil {
+		t.Fatalf("expected to get an error on bad templates")
+	}
+	if err := ValidateTemplates(map[string]string{"summary": `{{ template "instanceDown" . }}`}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
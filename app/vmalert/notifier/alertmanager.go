@@ -15,6 +15,8 @@ type AlertManager struct {
 	alertURL      string
 	basicAuthUser string
 	basicAuthPass string
+	// authorization is an optional `Authorization` header value
+	authorization string
 	argFunc       AlertURLGenerator
 	client        *http.Client
 }
@@ -33,6 +35,9 @@ func (am *AlertManager) Send(ctx context.Context, alerts []Alert) error {
 	if am.basicAuthPass != "" {
 		req.SetBasicAuth(am.basicAuthUser, am.basicAuthPass)
 	}
+	if am.authorization != "" {
+		req.Header.Set("Authorization", am.authorization)
+	}
 	resp, err := am.client.Do(req)
 	if err != nil {
 		return err
@@ -0,0 +1,110 @@
+package notifier
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/envtemplate"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape/discovery/consul"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape/discovery/dns"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape/discovery/kubernetes"
+	"gopkg.in/yaml.v2"
+)
+
+// Config contains configuration for notifiers defined
+// in the file passed via `-notifier.config` flag.
+//
+// The format is similar to `alerting.alertmanagers` section of Prometheus config.
+// See https://prometheus.io/docs/prometheus/latest/configuration/configuration/#alertmanager_config
+type Config struct {
+	// Scheme defines the HTTP scheme for notifier addresses
+	Scheme string `yaml:"scheme,omitempty"`
+	// PathPrefix is added to URL path before adding alertManagerPath value
+	PathPrefix string `yaml:"path_prefix,omitempty"`
+	// Timeout is a per-target timeout for sending alerts
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+
+	BasicAuth       *promauth.BasicAuthConfig `yaml:"basic_auth,omitempty"`
+	BearerToken     string                    `yaml:"bearer_token,omitempty"`
+	BearerTokenFile string                    `yaml:"bearer_token_file,omitempty"`
+	TLSConfig       *promauth.TLSConfig       `yaml:"tls_config,omitempty"`
+
+	StaticConfigs       []StaticConfig        `yaml:"static_configs,omitempty"`
+	ConsulSDConfigs     []consul.SDConfig     `yaml:"consul_sd_configs,omitempty"`
+	DNSSDConfigs        []dns.SDConfig        `yaml:"dns_sd_configs,omitempty"`
+	KubernetesSDConfigs []kubernetes.SDConfig `yaml:"kubernetes_sd_configs,omitempty"`
+
+	// RelabelConfigs are applied to the discovered targets
+	// before building notifier addresses from them.
+	RelabelConfigs []promrelabel.RelabelConfig `yaml:"relabel_configs,omitempty"`
+
+	// baseDir is the directory of the config file.
+	// It is used for resolving relative paths in the config.
+	baseDir string
+
+	authCfg              *promauth.Config
+	parsedRelabelConfigs *promrelabel.ParsedConfigs
+}
+
+// StaticConfig contains list of statically defined targets
+type StaticConfig struct {
+	Targets []string `yaml:"targets"`
+}
+
+// defaultTimeout is the default timeout for sending alerts to a single target.
+const defaultTimeout = 10 * time.Second
+
+func parseConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %q: %w", path, err)
+	}
+	data = envtemplate.Replace(data)
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("cannot parse %q: %w", path, err)
+	}
+	baseDir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain abs path for %q: %w", path, err)
+	}
+	if err := cfg.init(baseDir); err != nil {
+		return nil, fmt.Errorf("invalid config %q: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func (cfg *Config) init(baseDir string) error {
+	cfg.baseDir = baseDir
+	if cfg.Scheme == "" {
+		cfg.Scheme = "http"
+	}
+	if cfg.Scheme != "http" && cfg.Scheme != "https" {
+		return fmt.Errorf("unexpected `scheme`: %q; supported values: http or https", cfg.Scheme)
+	}
+	if cfg.Timeout < 0 {
+		return fmt.Errorf("`timeout` cannot be negative; got %s", cfg.Timeout)
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if len(cfg.StaticConfigs) == 0 && len(cfg.ConsulSDConfigs) == 0 &&
+		len(cfg.DNSSDConfigs) == 0 && len(cfg.KubernetesSDConfigs) == 0 {
+		return fmt.Errorf("at least one of `static_configs`, `consul_sd_configs`, `dns_sd_configs` or `kubernetes_sd_configs` must be set")
+	}
+	ac, err := promauth.NewConfig(baseDir, cfg.BasicAuth, cfg.BearerToken, cfg.BearerTokenFile, cfg.TLSConfig)
+	if err != nil {
+		return fmt.Errorf("cannot parse auth config: %w", err)
+	}
+	cfg.authCfg = ac
+	prcs, err := promrelabel.ParseRelabelConfigs(cfg.RelabelConfigs)
+	if err != nil {
+		return fmt.Errorf("cannot parse `relabel_configs`: %w", err)
+	}
+	cfg.parsedRelabelConfigs = prcs
+	return nil
+}
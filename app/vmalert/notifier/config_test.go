@@ -0,0 +1,64 @@
+package notifier
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseConfig_Success(t *testing.T) {
+	files, err := filepath.Glob("testdata/*.good.yaml")
+	if err != nil {
+		t.Fatalf("cannot list test files: %s", err)
+	}
+	if len(files) == 0 {
+		t.Fatalf("expecting non-empty list of test files")
+	}
+	for _, f := range files {
+		if _, err := parseConfig(f); err != nil {
+			t.Fatalf("unexpected error when parsing %q: %s", f, err)
+		}
+	}
+}
+
+func TestParseConfig_Failure(t *testing.T) {
+	f := func(path, expErr string) {
+		t.Helper()
+		_, err := parseConfig(path)
+		if err == nil {
+			t.Fatalf("expecting non-nil error for %q", path)
+		}
+		if !strings.Contains(err.Error(), expErr) {
+			t.Fatalf("expecting error for %q to contain %q; got %q", path, expErr, err)
+		}
+	}
+	f("testdata/non-existing.yaml", "cannot read")
+	f("testdata/unknownFields.bad.yaml", "field foo not found")
+	f("testdata/scheme.bad.yaml", "unexpected `scheme`")
+	f("testdata/empty.bad.yaml", "at least one of")
+	f("testdata/relabel.bad.yaml", "cannot parse `relabel_configs`")
+}
+
+func TestParseConfig_Defaults(t *testing.T) {
+	cfg, err := parseConfig("testdata/static.good.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if cfg.Scheme != "http" {
+		t.Fatalf("unexpected default scheme %q", cfg.Scheme)
+	}
+	if cfg.Timeout != defaultTimeout {
+		t.Fatalf("unexpected default timeout %s", cfg.Timeout)
+	}
+
+	cfg, err = parseConfig("testdata/consul.good.yaml")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if cfg.authCfg.Authorization != "Basic Zm9vOmJhcg==" {
+		t.Fatalf("unexpected authorization %q", cfg.authCfg.Authorization)
+	}
+	if cfg.parsedRelabelConfigs.Len() != 1 {
+		t.Fatalf("expecting 1 relabel config; got %d", cfg.parsedRelabelConfigs.Len())
+	}
+}
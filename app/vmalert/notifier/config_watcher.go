@@ -0,0 +1,234 @@
+package notifier
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape/discovery/consul"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape/discovery/dns"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape/discovery/kubernetes"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// configWatcher periodically discovers notifier targets
+// according to Config and keeps the list of notifiers up to date.
+type configWatcher struct {
+	cfg   *Config
+	genFn AlertURLGenerator
+
+	// discoverFn returns labels for discovered targets.
+	// It is overridden in tests.
+	discoverFn func(cfg *Config) []map[string]string
+
+	mu sync.RWMutex
+	// notifiers contains AlertManager per each discovered alerts URL
+	notifiers map[string]*AlertManager
+
+	wg     sync.WaitGroup
+	stopCh chan struct{}
+}
+
+func newWatcher(cfg *Config, gen AlertURLGenerator) *configWatcher {
+	return &configWatcher{
+		cfg:        cfg,
+		genFn:      gen,
+		discoverFn: discoverTargets,
+		notifiers:  make(map[string]*AlertManager),
+		stopCh:     make(chan struct{}),
+	}
+}
+
+// start performs the initial discovery and starts
+// background re-discovery with the given interval.
+func (cw *configWatcher) start(interval time.Duration) {
+	cw.refresh()
+	if interval <= 0 {
+		return
+	}
+	cw.wg.Add(1)
+	go func() {
+		defer cw.wg.Done()
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-cw.stopCh:
+				return
+			case <-t.C:
+				cw.refresh()
+			}
+		}
+	}()
+}
+
+func (cw *configWatcher) stop() {
+	close(cw.stopCh)
+	cw.wg.Wait()
+}
+
+// getNotifiers returns the list of currently discovered notifiers sorted by address.
+func (cw *configWatcher) getNotifiers() []Notifier {
+	cw.mu.RLock()
+	defer cw.mu.RUnlock()
+	addrs := make([]string, 0, len(cw.notifiers))
+	for addr := range cw.notifiers {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	nts := make([]Notifier, 0, len(addrs))
+	for _, addr := range addrs {
+		nts = append(nts, cw.notifiers[addr])
+	}
+	return nts
+}
+
+var (
+	discoveryRefreshes = metrics.NewCounter(`vmalert_notifier_discovery_refreshes_total`)
+	discoveryErrors    = metrics.NewCounter(`vmalert_notifier_discovery_errors_total`)
+)
+
+// refresh re-discovers targets and updates the list of notifiers.
+// AlertManager objects for already known addresses are preserved,
+// so their connections are re-used.
+func (cw *configWatcher) refresh() {
+	discoveryRefreshes.Inc()
+	addrs := cw.getAddrs(cw.discoverFn(cw.cfg))
+
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+	notifiers := make(map[string]*AlertManager, len(addrs))
+	for _, addr := range addrs {
+		if am, ok := cw.notifiers[addr]; ok {
+			notifiers[addr] = am
+			continue
+		}
+		notifiers[addr] = cw.newAlertManager(addr)
+	}
+	for addr := range notifiers {
+		if _, ok := cw.notifiers[addr]; !ok {
+			logger.Infof("notifier %q added", addr)
+		}
+	}
+	for addr := range cw.notifiers {
+		if _, ok := notifiers[addr]; !ok {
+			logger.Infof("notifier %q removed", addr)
+		}
+	}
+	cw.notifiers = notifiers
+}
+
+func (cw *configWatcher) newAlertManager(addr string) *AlertManager {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	if strings.HasPrefix(addr, "https") {
+		tr.TLSClientConfig = cw.cfg.authCfg.NewTLSConfig()
+	}
+	am := NewAlertManager(addr, "", "", cw.genFn, &http.Client{
+		Transport: tr,
+		Timeout:   cw.cfg.Timeout,
+	})
+	am.authorization = cw.cfg.authCfg.Authorization
+	return am
+}
+
+// getAddrs returns notifier addresses for the given target labels
+// after applying relabeling from cw.cfg.
+func (cw *configWatcher) getAddrs(targetLabels []map[string]string) []string {
+	var addrs []string
+	seen := make(map[string]bool)
+	for _, m := range targetLabels {
+		addr, err := cw.getAddr(m)
+		if err != nil {
+			discoveryErrors.Inc()
+			logger.Errorf("skipping notifier target %v: %s", m, err)
+			continue
+		}
+		if addr == "" || seen[addr] {
+			continue
+		}
+		seen[addr] = true
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	return addrs
+}
+
+// getAddr returns notifier address for the target with the given labels.
+// Empty address is returned if the target has been dropped during relabeling.
+func (cw *configWatcher) getAddr(m map[string]string) (string, error) {
+	labels := make([]prompbmarshal.Label, 0, len(m)+2)
+	for k, v := range m {
+		labels = append(labels, prompbmarshal.Label{Name: k, Value: v})
+	}
+	if _, ok := m["__scheme__"]; !ok {
+		labels = append(labels, prompbmarshal.Label{Name: "__scheme__", Value: cw.cfg.Scheme})
+	}
+	if _, ok := m["__alerts_path__"]; !ok {
+		labels = append(labels, prompbmarshal.Label{Name: "__alerts_path__", Value: cw.cfg.PathPrefix})
+	}
+	promrelabel.SortLabels(labels)
+	labels = cw.cfg.parsedRelabelConfigs.Apply(labels, 0, false)
+
+	address := promrelabel.GetLabelValueByName(labels, "__address__")
+	if address == "" {
+		return "", nil
+	}
+	if strings.Contains(address, "/") {
+		return "", fmt.Errorf("`__address__` cannot contain `/`; got %q", address)
+	}
+	scheme := promrelabel.GetLabelValueByName(labels, "__scheme__")
+	if scheme == "" {
+		scheme = "http"
+	}
+	path := promrelabel.GetLabelValueByName(labels, "__alerts_path__")
+	if path != "" && !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return fmt.Sprintf("%s://%s%s", scheme, address, strings.TrimSuffix(path, "/")), nil
+}
+
+// discoverTargets returns labels for targets from all the configured
+// static and service discovery configs.
+// Errors are logged, so failed discovery doesn't affect other targets.
+func discoverTargets(cfg *Config) []map[string]string {
+	var ms []map[string]string
+	for _, sc := range cfg.StaticConfigs {
+		for _, target := range sc.Targets {
+			ms = append(ms, map[string]string{"__address__": target})
+		}
+	}
+	for i := range cfg.ConsulSDConfigs {
+		labels, err := consul.GetLabels(&cfg.ConsulSDConfigs[i], cfg.baseDir)
+		if err != nil {
+			discoveryErrors.Inc()
+			logger.Errorf("error when discovering notifier targets via `consul_sd_configs` #%d: %s", i+1, err)
+			continue
+		}
+		ms = append(ms, labels...)
+	}
+	for i := range cfg.DNSSDConfigs {
+		labels, err := dns.GetLabels(&cfg.DNSSDConfigs[i])
+		if err != nil {
+			discoveryErrors.Inc()
+			logger.Errorf("error when discovering notifier targets via `dns_sd_configs` #%d: %s", i+1, err)
+			continue
+		}
+		ms = append(ms, labels...)
+	}
+	for i := range cfg.KubernetesSDConfigs {
+		labels, err := kubernetes.GetLabels(&cfg.KubernetesSDConfigs[i], cfg.baseDir)
+		if err != nil {
+			discoveryErrors.Inc()
+			logger.Errorf("error when discovering notifier targets via `kubernetes_sd_configs` #%d: %s", i+1, err)
+			continue
+		}
+		ms = append(ms, labels...)
+	}
+	return ms
+}
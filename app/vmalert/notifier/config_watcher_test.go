@@ -0,0 +1,129 @@
+package notifier
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
+)
+
+func TestConfigWatcherGetAddrs(t *testing.T) {
+	f := func(cfg *Config, targetLabels []map[string]string, expAddrs []string) {
+		t.Helper()
+		if err := cfg.init("."); err != nil {
+			t.Fatalf("cannot init config: %s", err)
+		}
+		cw := newWatcher(cfg, nil)
+		addrs := cw.getAddrs(targetLabels)
+		if !reflect.DeepEqual(addrs, expAddrs) {
+			t.Fatalf("unexpected addrs;\ngot\n%q\nwant\n%q", addrs, expAddrs)
+		}
+	}
+	static := []StaticConfig{{Targets: []string{"localhost:9093"}}}
+
+	f(&Config{StaticConfigs: static}, []map[string]string{
+		{"__address__": "localhost:9093"},
+		{"__address__": "localhost:9095"},
+		// duplicates must be removed
+		{"__address__": "localhost:9093"},
+		// targets without address must be dropped
+		{"__meta_foo": "bar"},
+		// targets with path in address must be dropped
+		{"__address__": "localhost:9093/foo"},
+	}, []string{"http://localhost:9093", "http://localhost:9095"})
+
+	f(&Config{StaticConfigs: static, Scheme: "https", PathPrefix: "/alertmanager/"}, []map[string]string{
+		{"__address__": "localhost:9093"},
+	}, []string{"https://localhost:9093/alertmanager"})
+
+	keepProd := "prod"
+	replacement := "$1:9093"
+	f(&Config{
+		StaticConfigs: static,
+		RelabelConfigs: []promrelabel.RelabelConfig{
+			{
+				SourceLabels: []string{"__meta_env"},
+				Regex:        &keepProd,
+				Action:       "keep",
+			},
+			{
+				SourceLabels: []string{"__meta_host"},
+				TargetLabel:  "__address__",
+				Replacement:  &replacement,
+			},
+		},
+	}, []map[string]string{
+		{"__address__": "10.0.0.1:80", "__meta_env": "prod", "__meta_host": "am1"},
+		{"__address__": "10.0.0.2:80", "__meta_env": "dev", "__meta_host": "am2"},
+		{"__address__": "10.0.0.3:80", "__meta_env": "prod", "__meta_host": "am3", "__scheme__": "https"},
+	}, []string{"http://am1:9093", "https://am3:9093"})
+}
+
+func TestConfigWatcherRefresh(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/prefix"+alertManagerPath {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer foo" {
+			t.Errorf("unexpected Authorization header %q", auth)
+		}
+		atomic.AddInt32(&requests, 1)
+	}))
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "http://")
+
+	cfg := &Config{
+		PathPrefix:    "/prefix",
+		BearerToken:   "foo",
+		StaticConfigs: []StaticConfig{{Targets: []string{addr}}},
+	}
+	if err := cfg.init("."); err != nil {
+		t.Fatalf("cannot init config: %s", err)
+	}
+	cw := newWatcher(cfg, func(alert Alert) string { return "" })
+	targets := []map[string]string{{"__address__": addr}}
+	cw.discoverFn = func(_ *Config) []map[string]string { return targets }
+	cw.start(0)
+	defer cw.stop()
+
+	nts := cw.getNotifiers()
+	if len(nts) != 1 {
+		t.Fatalf("expecting 1 notifier; got %d", len(nts))
+	}
+	am := nts[0]
+	if err := am.Send(context.Background(), []Alert{{Name: "alert", Start: time.Now()}}); err != nil {
+		t.Fatalf("unexpected error when sending alerts: %s", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Fatalf("expecting 1 request; got %d", n)
+	}
+
+	// the existing notifier must be preserved on refresh
+	targets = append(targets, map[string]string{"__address__": "localhost:9093"})
+	cw.refresh()
+	nts = cw.getNotifiers()
+	if len(nts) != 2 {
+		t.Fatalf("expecting 2 notifiers; got %d", len(nts))
+	}
+	if nts[0] != am {
+		t.Fatalf("expecting notifier for %q to be preserved", addr)
+	}
+
+	// vanished targets must be removed
+	targets = targets[1:]
+	cw.refresh()
+	nts = cw.getNotifiers()
+	if len(nts) != 1 {
+		t.Fatalf("expecting 1 notifier; got %d", len(nts))
+	}
+	if got := nts[0].(*AlertManager).alertURL; got != "http://localhost:9093/prefix"+alertManagerPath {
+		t.Fatalf("unexpected alert URL %q", got)
+	}
+}
@@ -1,15 +1,22 @@
 package notifier
 
 import (
+	"flag"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/utils"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 )
 
 var (
-	addrs             = flagutil.NewArray("notifier.url", "Prometheus alertmanager URL. Required parameter. e.g. http://127.0.0.1:9093")
+	configPath = flag.String("notifier.config", "", "Path to configuration file for notifiers. "+
+		"The file may contain static targets and service discovery configs for Consul, DNS and Kubernetes. "+
+		"It can't be used together with -notifier.url. See https://victoriametrics.github.io/vmalert.html#notifier-configuration-file")
+	sdCheckInterval = flag.Duration("notifier.sdCheckInterval", 30*time.Second, "Interval for re-discovering notifier targets from -notifier.config")
+
+	addrs             = flagutil.NewArray("notifier.url", "Prometheus alertmanager URL, e.g. http://127.0.0.1:9093. Required parameter if -notifier.config isn't set")
 	basicAuthUsername = flagutil.NewArray("notifier.basicAuth.username", "Optional basic auth username for -notifier.url")
 	basicAuthPassword = flagutil.NewArray("notifier.basicAuth.password", "Optional basic auth password for -notifier.url")
 
@@ -22,10 +29,28 @@ var (
 		"By default the server name from -notifier.url is used")
 )
 
-// Init creates a Notifier object based on provided flags.
-func Init(gen AlertURLGenerator) ([]Notifier, error) {
+// cw is used for discovering notifiers from -notifier.config file.
+var cw *configWatcher
+
+// Init returns a function for obtaining the current list of notifiers based on provided flags.
+//
+// The list is static if notifiers are configured via -notifier.url,
+// while it is periodically updated if -notifier.config is set.
+func Init(gen AlertURLGenerator) (func() []Notifier, error) {
+	if *configPath != "" {
+		if len(*addrs) > 0 {
+			return nil, fmt.Errorf("only one of -notifier.url or -notifier.config can be set")
+		}
+		cfg, err := parseConfig(*configPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse -notifier.config: %w", err)
+		}
+		cw = newWatcher(cfg, gen)
+		cw.start(*sdCheckInterval)
+		return cw.getNotifiers, nil
+	}
 	if len(*addrs) == 0 {
-		return nil, fmt.Errorf("at least one `-notifier.url` must be set")
+		return nil, fmt.Errorf("at least one `-notifier.url` or `-notifier.config` must be set")
 	}
 
 	var notifiers []Notifier
@@ -40,6 +65,12 @@ func Init(gen AlertURLGenerator) ([]Notifier, error) {
 		am := NewAlertManager(addr, user, pass, gen, &http.Client{Transport: tr})
 		notifiers = append(notifiers, am)
 	}
+	return func() []Notifier { return notifiers }, nil
+}
 
-	return notifiers, nil
+// Stop stops notifiers discovery started by Init.
+func Stop() {
+	if cw != nil {
+		cw.stop()
+	}
 }
@@ -0,0 +1,64 @@
+package notifier
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+var (
+	masterTmplMu sync.RWMutex
+	// masterTmpl contains templates loaded from -rule.templates files.
+	// Annotations are executed against its clone, so they may refer
+	// to the loaded templates via {{ template "name" . }}.
+	masterTmpl = template.New("")
+)
+
+// LoadTemplates parses templates from files matching the given path patterns.
+// Previously loaded templates are replaced only if all the files are parsed successfully.
+//
+// InitTemplateFunc must be called before LoadTemplates.
+func LoadTemplates(pathPatterns []string) error {
+	var files []string
+	for _, pattern := range pathPatterns {
+		if pattern == "" {
+			continue
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		files = append(files, matches...)
+	}
+	sort.Strings(files)
+
+	tmpl := template.New("").Funcs(tmplFunc).Option("missingkey=zero")
+	if len(files) > 0 {
+		var err error
+		if tmpl, err = tmpl.ParseFiles(files...); err != nil {
+			return fmt.Errorf("cannot parse templates from %s: %w", strings.Join(files, ", "), err)
+		}
+	}
+
+	masterTmplMu.Lock()
+	masterTmpl = tmpl
+	masterTmplMu.Unlock()
+	return nil
+}
+
+// newTemplate returns a template for annotation execution
+// with access to templates loaded via LoadTemplates.
+func newTemplate(funcs template.FuncMap) (*template.Template, error) {
+	masterTmplMu.RLock()
+	tmpl, err := masterTmpl.Clone()
+	masterTmplMu.RUnlock()
+	if err != nil {
+		return nil, fmt.Errorf("cannot clone templates: %w", err)
+	}
+	// the annotation is parsed into a separate template in order
+	// to not override templates with empty name from the loaded files
+	return tmpl.New("annotation").Funcs(funcs).Option("missingkey=zero"), nil
+}
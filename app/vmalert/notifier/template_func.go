@@ -17,8 +17,10 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"net"
 	"net/url"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
@@ -26,6 +28,7 @@ import (
 	textTpl "text/template"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/datasource"
+	"github.com/VictoriaMetrics/metricsql"
 )
 
 // QueryFn is used to wrap a call to datasource into simple-to-use function
@@ -155,6 +158,47 @@ func InitTemplateFunc(externalURL *url.URL) {
 			t := TimeFromUnixNano(int64(v * 1e9)).Time().UTC()
 			return fmt.Sprint(t)
 		},
+		"humanizeBytes": func(v float64) string {
+			if math.Abs(v) < 1024 || math.IsNaN(v) || math.IsInf(v, 0) {
+				return fmt.Sprintf("%.4gB", v)
+			}
+			prefix := ""
+			for _, p := range []string{"Ki", "Mi", "Gi", "Ti", "Pi", "Ei", "Zi", "Yi"} {
+				if math.Abs(v) < 1024 {
+					break
+				}
+				prefix = p
+				v /= 1024
+			}
+			return fmt.Sprintf("%.4g%sB", v, prefix)
+		},
+		"toTime": func(v float64) (time.Time, error) {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return time.Time{}, fmt.Errorf("cannot convert %v to time", v)
+			}
+			return TimeFromUnixNano(int64(v * 1e9)).Time().UTC(), nil
+		},
+		"parseDuration": func(s string) (float64, error) {
+			ms, err := metricsql.DurationValue(s, 0)
+			if err != nil {
+				return 0, err
+			}
+			return float64(ms) / 1e3, nil
+		},
+		"stripPort": func(hostPort string) string {
+			host, _, err := net.SplitHostPort(hostPort)
+			if err != nil {
+				return hostPort
+			}
+			return host
+		},
+		"sortByLabel": func(label string, metrics []datasource.Metric) []datasource.Metric {
+			sorted := append([]datasource.Metric{}, metrics...)
+			sort.SliceStable(sorted, func(i, j int) bool {
+				return sorted[i].Label(label) < sorted[j].Label(label)
+			})
+			return sorted
+		},
 		"pathPrefix": func() string {
 			return externalURL.Path
 		},
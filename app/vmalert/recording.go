@@ -29,6 +29,8 @@ type RecordingRule struct {
 	mu sync.RWMutex
 	// stores last moment of time Exec was called
 	lastExecTime time.Time
+	// stores the duration of the last Exec call
+	lastExecDuration time.Duration
 	// stores last error that happened in Exec func
 	// resets on every successful Exec
 	// may be used as Health state
@@ -82,16 +84,18 @@ func (rr *RecordingRule) Close() {
 }
 
 // Exec executes RecordingRule expression via the given Querier.
-func (rr *RecordingRule) Exec(ctx context.Context, q datasource.Querier, series bool) ([]prompbmarshal.TimeSeries, error) {
+func (rr *RecordingRule) Exec(ctx context.Context, q datasource.Querier, ts time.Time, series bool) ([]prompbmarshal.TimeSeries, error) {
 	if !series {
 		return nil, nil
 	}
 
+	start := time.Now()
 	qMetrics, err := q.Query(ctx, rr.Expr, rr.Type)
 	rr.mu.Lock()
 	defer rr.mu.Unlock()
 
-	rr.lastExecTime = time.Now()
+	rr.lastExecTime = ts
+	rr.lastExecDuration = time.Since(start)
 	rr.lastExecError = err
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute query %q: %w", rr.Expr, err)
@@ -112,6 +116,26 @@ func (rr *RecordingRule) Exec(ctx context.Context, q datasource.Querier, series
 	return tss, nil
 }
 
+// ExecRange executes RecordingRule expression on the given time range via the given Querier.
+func (rr *RecordingRule) ExecRange(ctx context.Context, q datasource.Querier, start, end time.Time, step time.Duration) ([]prompbmarshal.TimeSeries, error) {
+	series, err := q.QueryRange(ctx, rr.Expr, rr.Type, start, end, step)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute query %q: %w", rr.Expr, err)
+	}
+	duplicates := make(map[uint64]struct{}, len(series))
+	var tss []prompbmarshal.TimeSeries
+	for _, s := range series {
+		ts := rr.toTimeSeriesRange(s)
+		h := hashTimeSeries(ts)
+		if _, ok := duplicates[h]; ok {
+			return nil, errDuplicate
+		}
+		duplicates[h] = struct{}{}
+		tss = append(tss, ts)
+	}
+	return tss, nil
+}
+
 func hashTimeSeries(ts prompbmarshal.TimeSeries) uint64 {
 	hash := fnv.New64a()
 	labels := ts.Labels
@@ -127,6 +151,19 @@ func hashTimeSeries(ts prompbmarshal.TimeSeries) uint64 {
 }
 
 func (rr *RecordingRule) toTimeSeries(m datasource.Metric, timestamp time.Time) prompbmarshal.TimeSeries {
+	return newTimeSeries(m.Value, rr.seriesLabels(m), timestamp)
+}
+
+func (rr *RecordingRule) toTimeSeriesRange(m datasource.Metric) prompbmarshal.TimeSeries {
+	timestamps := make([]int64, len(m.Timestamps))
+	for i, ts := range m.Timestamps {
+		// convert seconds to milliseconds
+		timestamps[i] = ts * 1e3
+	}
+	return newTimeSeriesPB(m.Values, timestamps, rr.seriesLabels(m))
+}
+
+func (rr *RecordingRule) seriesLabels(m datasource.Metric) map[string]string {
 	labels := make(map[string]string)
 	for _, l := range m.Labels {
 		labels[l.Name] = l.Value
@@ -136,7 +173,7 @@ func (rr *RecordingRule) toTimeSeries(m datasource.Metric, timestamp time.Time)
 	for k, v := range rr.Labels {
 		labels[k] = v
 	}
-	return newTimeSeries(m.Value, labels, timestamp)
+	return labels
 }
 
 // UpdateWith copies all significant fields.
@@ -152,6 +189,31 @@ func (rr *RecordingRule) UpdateWith(r Rule) error {
 	return nil
 }
 
+// PromRuleAPI returns Rule representation in form
+// of Prometheus-compatible APIPromRule
+func (rr *RecordingRule) PromRuleAPI() APIPromRule {
+	rr.mu.RLock()
+	defer rr.mu.RUnlock()
+
+	r := APIPromRule{
+		// encode as strings to avoid rounding
+		ID:             fmt.Sprintf("%d", rr.ID()),
+		GroupID:        fmt.Sprintf("%d", rr.GroupID),
+		Type:           "recording",
+		DatasourceType: rr.Type.String(),
+		Name:           rr.Name,
+		Query:          rr.Expr,
+		Labels:         rr.Labels,
+		Health:         ruleHealth(rr.lastExecTime, rr.lastExecError),
+		LastEvaluation: rr.lastExecTime,
+		EvaluationTime: rr.lastExecDuration.Seconds(),
+	}
+	if rr.lastExecError != nil {
+		r.LastError = rr.lastExecError.Error()
+	}
+	return r
+}
+
 // RuleAPI returns Rule representation in form
 // of APIRecordingRule
 func (rr *RecordingRule) RuleAPI() APIRecordingRule {
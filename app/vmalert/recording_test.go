@@ -76,7 +76,7 @@ func TestRecoridngRule_ToTimeSeries(t *testing.T) {
 		t.Run(tc.rule.Name, func(t *testing.T) {
 			fq := &fakeQuerier{}
 			fq.add(tc.metrics...)
-			tss, err := tc.rule.Exec(context.TODO(), fq, true)
+			tss, err := tc.rule.Exec(context.TODO(), fq, time.Now(), true)
 			if err != nil {
 				t.Fatalf("unexpected Exec err: %s", err)
 			}
@@ -96,7 +96,7 @@ func TestRecoridngRule_ToTimeSeriesNegative(t *testing.T) {
 	expErr := "connection reset by peer"
 	fq.setErr(errors.New(expErr))
 
-	_, err := rr.Exec(context.TODO(), fq, true)
+	_, err := rr.Exec(context.TODO(), fq, time.Now(), true)
 	if err == nil {
 		t.Fatalf("expected to get err; got nil")
 	}
@@ -111,7 +111,7 @@ func TestRecoridngRule_ToTimeSeriesNegative(t *testing.T) {
 	fq.add(metricWithValueAndLabels(t, 1, "__name__", "foo", "job", "foo"))
 	fq.add(metricWithValueAndLabels(t, 2, "__name__", "foo", "job", "bar"))
 
-	_, err = rr.Exec(context.TODO(), fq, true)
+	_, err = rr.Exec(context.TODO(), fq, time.Now(), true)
 	if err == nil {
 		t.Fatalf("expected to get err; got nil")
 	}
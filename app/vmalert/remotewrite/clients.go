@@ -0,0 +1,96 @@
+package remotewrite
+
+import (
+	"fmt"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/utils"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+)
+
+// Clients is a set of remote write destinations.
+//
+// Time series pushed to Clients are written to every destination in the set.
+type Clients struct {
+	names   []string
+	clients []*Client
+}
+
+// NewClients returns a set of remote write destinations for the given clients.
+//
+// names[i] is the name of clients[i]. Names are used for selecting
+// a subset of destinations via Select.
+func NewClients(names []string, clients []*Client) (*Clients, error) {
+	if len(names) != len(clients) {
+		return nil, fmt.Errorf("the number of names (%d) must match the number of clients (%d)", len(names), len(clients))
+	}
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate remote write destination name %q", name)
+		}
+		seen[name] = true
+	}
+	return &Clients{
+		names:   names,
+		clients: clients,
+	}, nil
+}
+
+// Push adds timeseries into queues of all the destinations in cs.
+func (cs *Clients) Push(s prompbmarshal.TimeSeries) error {
+	errGr := new(utils.ErrGroup)
+	for i, c := range cs.clients {
+		if err := c.Push(s); err != nil {
+			errGr.Add(fmt.Errorf("remote write destination %q: %w", cs.names[i], err))
+		}
+	}
+	return errGr.Err()
+}
+
+// Close stops all the clients in cs and waits for all goroutines to exit.
+//
+// Close must be called only on Clients returned from Init,
+// since Clients returned from Select share the underlying clients.
+func (cs *Clients) Close() error {
+	errGr := new(utils.ErrGroup)
+	for i, c := range cs.clients {
+		if err := c.Close(); err != nil {
+			errGr.Add(fmt.Errorf("remote write destination %q: %w", cs.names[i], err))
+		}
+	}
+	return errGr.Err()
+}
+
+// Select returns a subset of destinations with the given names.
+//
+// All the destinations are returned if names is empty.
+// Nil is returned for nil cs and empty names.
+func (cs *Clients) Select(names []string) (*Clients, error) {
+	if len(names) == 0 {
+		return cs, nil
+	}
+	if cs == nil {
+		return nil, fmt.Errorf("remote write destinations %q are set, while -remoteWrite.url is empty", names)
+	}
+	selected := &Clients{}
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		idx := -1
+		for i, n := range cs.names {
+			if n == name {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			return nil, fmt.Errorf("unknown remote write destination %q; available destinations: %q", name, cs.names)
+		}
+		selected.names = append(selected.names, cs.names[idx])
+		selected.clients = append(selected.clients, cs.clients[idx])
+	}
+	return selected, nil
+}
@@ -0,0 +1,101 @@
+package remotewrite
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+)
+
+func TestClients_Select(t *testing.T) {
+	newTestClients := func(names ...string) *Clients {
+		t.Helper()
+		clients := make([]*Client, len(names))
+		for i := range names {
+			clients[i] = &Client{}
+		}
+		cs, err := NewClients(names, clients)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return cs
+	}
+	f := func(cs *Clients, names, expNames []string) {
+		t.Helper()
+		selected, err := cs.Select(names)
+		if err != nil {
+			t.Fatalf("unexpected error when selecting %q: %s", names, err)
+		}
+		var gotNames []string
+		if selected != nil {
+			gotNames = selected.names
+		}
+		if !reflect.DeepEqual(gotNames, expNames) {
+			t.Fatalf("unexpected selected destinations; got %q; want %q", gotNames, expNames)
+		}
+	}
+	cs := newTestClients("foo", "bar", "baz")
+	f(nil, nil, nil)
+	f(cs, nil, []string{"foo", "bar", "baz"})
+	f(cs, []string{"bar"}, []string{"bar"})
+	f(cs, []string{"baz", "foo", "baz"}, []string{"baz", "foo"})
+
+	if _, err := cs.Select([]string{"foo", "unknown"}); err == nil {
+		t.Fatalf("expecting non-nil error for unknown destination")
+	}
+	var nilClients *Clients
+	if _, err := nilClients.Select([]string{"foo"}); err == nil {
+		t.Fatalf("expecting non-nil error when selecting from empty destinations")
+	}
+	if _, err := NewClients([]string{"foo", "foo"}, []*Client{{}, {}}); err == nil {
+		t.Fatalf("expecting non-nil error for duplicate names")
+	}
+	if _, err := NewClients([]string{"foo"}, nil); err == nil {
+		t.Fatalf("expecting non-nil error for mismatched names and clients")
+	}
+}
+
+func TestClients_Push(t *testing.T) {
+	srv1, srv2 := newRWServer(), newRWServer()
+	defer srv1.Close()
+	defer srv2.Close()
+	var clients []*Client
+	for _, addr := range []string{srv1.URL, srv2.URL} {
+		c, err := NewClient(context.Background(), Config{Addr: addr})
+		if err != nil {
+			t.Fatalf("failed to create client: %s", err)
+		}
+		clients = append(clients, c)
+	}
+	cs, err := NewClients([]string{"first", "second"}, clients)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	second, err := cs.Select([]string{"second"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ts := prompbmarshal.TimeSeries{
+		Samples: []prompbmarshal.Sample{{
+			Value:     1,
+			Timestamp: time.Now().Unix(),
+		}},
+	}
+	if err := cs.Push(ts); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := second.Push(ts); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := cs.Close(); err != nil {
+		t.Fatalf("failed to close clients: %s", err)
+	}
+	if got := srv1.accepted(); got != 1 {
+		t.Fatalf("expected 1 series at the first destination; got %d", got)
+	}
+	if got := srv2.accepted(); got != 2 {
+		t.Fatalf("expected 2 series at the second destination; got %d", got)
+	}
+}
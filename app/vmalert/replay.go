@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/config"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/datasource"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/remotewrite"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+)
+
+var (
+	replayFrom = flag.String("replay.timeFrom", "", "The time filter in RFC3339 format to select time series with timestamp equal or higher than provided value. "+
+		"E.g. '2020-01-01T20:07:00Z'. Enables replay mode. See https://victoriametrics.github.io/vmalert.html#rules-backfilling")
+	replayTo = flag.String("replay.timeTo", "", "The time filter in RFC3339 format to select time series with timestamp equal or lower than provided value. "+
+		"E.g. '2020-01-01T20:07:00Z'. Defaults to the current time in replay mode")
+	replayRulesDelay = flag.Duration("replay.rulesDelay", time.Second, "Delay between rules evaluation within the group in replay mode. "+
+		"Could be important if there are chained rules inside of the group and processing need to wait for previous rule results "+
+		"to be persisted by remote storage before evaluating the next rule. Keep it equal or bigger than -remoteWrite.flushInterval")
+	replayMaxDatapoints = flag.Int("replay.maxDatapointsPerQuery", 1e3, "Max number of data points expected in one request in replay mode. "+
+		"The higher the value, the less requests will be made during replay")
+	replayRuleRetryAttempts = flag.Int("replay.ruleRetryAttempts", 5, "Defines how many retries to make before giving up on rule if request for it returns an error")
+)
+
+// isReplayMode returns true if vmalert must run in replay mode.
+func isReplayMode() bool {
+	return *replayFrom != "" || *replayTo != ""
+}
+
+func replay(groupsCfg []config.Group, q datasource.Querier, rw *remotewrite.Clients, labels map[string]string) error {
+	if *replayMaxDatapoints < 1 {
+		return fmt.Errorf("replay.maxDatapointsPerQuery can't be lower than 1")
+	}
+	tFrom, err := time.Parse(time.RFC3339, *replayFrom)
+	if err != nil {
+		return fmt.Errorf("failed to parse %q: %w", *replayFrom, err)
+	}
+	tTo := time.Now()
+	if *replayTo != "" {
+		tTo, err = time.Parse(time.RFC3339, *replayTo)
+		if err != nil {
+			return fmt.Errorf("failed to parse %q: %w", *replayTo, err)
+		}
+	}
+	if !tTo.After(tFrom) {
+		return fmt.Errorf("replay.timeTo=%v must be bigger than replay.timeFrom=%v", tTo, tFrom)
+	}
+	logger.Infof("replay mode: from %v to %v; max data points per request: %d", tFrom, tTo, *replayMaxDatapoints)
+
+	var total int
+	for _, cfg := range groupsCfg {
+		grw, err := rw.Select(cfg.RemoteWrite)
+		if err != nil {
+			return fmt.Errorf("invalid `remote_write` for group %q: %w", cfg.Name, err)
+		}
+		ng := newGroup(cfg, *evaluationInterval, labels)
+		n, err := ng.replay(tFrom, tTo, q, grw)
+		if err != nil {
+			return fmt.Errorf("cannot replay group %q: %w", ng.Name, err)
+		}
+		total += n
+	}
+	logger.Infof("replay finished; imported %d samples", total)
+	return nil
+}
+
+// replay evaluates group rules on the [start...end] time range
+// and pushes the results to rw. It returns the number of pushed samples.
+func (g *Group) replay(start, end time.Time, q datasource.Querier, rw *remotewrite.Clients) (int, error) {
+	ri := newRangeIterator(start, end, g.Interval, *replayMaxDatapoints)
+	logger.Infof("replaying group %q with interval %v: %d requests per rule", g.Name, g.Interval, ri.steps())
+	var total int
+	for i, rule := range g.Rules {
+		if i > 0 {
+			// wait for the previous rule results to be persisted,
+			// since the next rule may depend on them
+			time.Sleep(*replayRulesDelay)
+		}
+		ri.reset()
+		for ri.next() {
+			n, err := replayRule(rule, ri.s, ri.e, g.Interval, q, rw)
+			if err != nil {
+				return total, fmt.Errorf("cannot replay rule %q: %w", rule, err)
+			}
+			total += n
+		}
+	}
+	return total, nil
+}
+
+func replayRule(rule Rule, start, end time.Time, step time.Duration, q datasource.Querier, rw *remotewrite.Clients) (int, error) {
+	var err error
+	var tss []prompbmarshal.TimeSeries
+	for i := 0; i < *replayRuleRetryAttempts; i++ {
+		tss, err = rule.ExecRange(context.Background(), q, start, end, step)
+		if err == nil {
+			break
+		}
+		logger.Errorf("attempt %d to execute rule %q on time range %v-%v failed: %s", i+1, rule, start, end, err)
+		time.Sleep(time.Second)
+	}
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	for _, ts := range tss {
+		if err := pushWithRetry(rw, ts); err != nil {
+			return n, err
+		}
+		n += len(ts.Samples)
+	}
+	return n, nil
+}
+
+// pushWithRetry retries pushing ts to rw until the remote write queue has free space.
+func pushWithRetry(rw *remotewrite.Clients, ts prompbmarshal.TimeSeries) error {
+	deadline := time.Now().Add(time.Minute)
+	for {
+		err := rw.Push(ts)
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("cannot push time series to remote write: %w", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// rangeIterator splits the [start...end] time range into sub-ranges
+// containing at most maxPoints evaluation points with the given step.
+// Sub-ranges don't overlap, so every evaluation point is visited only once.
+type rangeIterator struct {
+	start, end time.Time
+	step       time.Duration
+	maxPoints  int
+
+	iter int
+	s, e time.Time
+}
+
+func newRangeIterator(start, end time.Time, step time.Duration, maxPoints int) *rangeIterator {
+	return &rangeIterator{
+		start:     start,
+		end:       end,
+		step:      step,
+		maxPoints: maxPoints,
+	}
+}
+
+// steps returns the number of sub-ranges.
+func (ri *rangeIterator) steps() int {
+	points := int(ri.end.Sub(ri.start)/ri.step) + 1
+	return (points + ri.maxPoints - 1) / ri.maxPoints
+}
+
+func (ri *rangeIterator) reset() {
+	ri.iter = 0
+}
+
+func (ri *rangeIterator) next() bool {
+	chunk := ri.step * time.Duration(ri.maxPoints)
+	ri.s = ri.start.Add(chunk * time.Duration(ri.iter))
+	if ri.s.After(ri.end) {
+		return false
+	}
+	ri.e = ri.s.Add(chunk - ri.step)
+	if ri.e.After(ri.end) {
+		ri.e = ri.end
+	}
+	ri.iter++
+	return true
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/datasource"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+)
+
+func TestRangeIterator(t *testing.T) {
+	f := func(start, end time.Time, step time.Duration, maxPoints int, expected [][2]time.Time) {
+		t.Helper()
+		ri := newRangeIterator(start, end, step, maxPoints)
+		if n := ri.steps(); n != len(expected) {
+			t.Fatalf("unexpected number of steps; got %d; want %d", n, len(expected))
+		}
+		var got [][2]time.Time
+		for ri.next() {
+			got = append(got, [2]time.Time{ri.s, ri.e})
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Fatalf("unexpected ranges;\ngot\n%v\nwant\n%v", got, expected)
+		}
+	}
+	start := time.Unix(0, 0)
+	at := func(seconds int) time.Time {
+		return start.Add(time.Duration(seconds) * time.Second)
+	}
+
+	// single range
+	f(start, at(30), 10*time.Second, 10, [][2]time.Time{{at(0), at(30)}})
+	// ranges don't overlap
+	f(start, at(60), 10*time.Second, 3, [][2]time.Time{
+		{at(0), at(20)},
+		{at(30), at(50)},
+		{at(60), at(60)},
+	})
+	// end isn't aligned to step
+	f(start, at(55), 10*time.Second, 2, [][2]time.Time{
+		{at(0), at(10)},
+		{at(20), at(30)},
+		{at(40), at(50)},
+	})
+}
+
+func TestRecordingRule_ExecRange(t *testing.T) {
+	fq := &fakeQuerier{}
+	fq.add(datasource.Metric{
+		Labels:     []datasource.Label{{Name: "job", Value: "foo"}},
+		Timestamps: []int64{1, 2},
+		Values:     []float64{10, 20},
+	})
+	rr := &RecordingRule{Name: "job:foo", Labels: map[string]string{"source": "test"}}
+	tss, err := rr.ExecRange(context.Background(), fq, time.Unix(1, 0), time.Unix(2, 0), time.Second)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []prompbmarshal.TimeSeries{
+		newTimeSeriesPB([]float64{10, 20}, []int64{1000, 2000}, map[string]string{
+			"__name__": "job:foo",
+			"job":      "foo",
+			"source":   "test",
+		}),
+	}
+	if err := compareTimeSeries(t, expected, tss); err != nil {
+		t.Fatalf("timeseries mismatch: %s", err)
+	}
+
+	fq.add(datasource.Metric{
+		Labels:     []datasource.Label{{Name: "job", Value: "foo"}},
+		Timestamps: []int64{1},
+		Values:     []float64{1},
+	})
+	if _, err := rr.ExecRange(context.Background(), fq, time.Unix(1, 0), time.Unix(2, 0), time.Second); err == nil {
+		t.Fatalf("expected to get duplicate error")
+	}
+}
+
+func TestAlertingRule_ExecRange(t *testing.T) {
+	step := time.Minute
+	at := func(minutes int64) int64 {
+		return minutes * 60
+	}
+	alertsSeries := func(state string, ts int64) prompbmarshal.TimeSeries {
+		return newTimeSeriesPB([]float64{1}, []int64{ts * 1e3}, map[string]string{
+			"__name__":          alertMetricName,
+			alertNameLabel:      "test",
+			alertStateLabel:     state,
+			alertGroupNameLabel: "",
+			"job":               "foo",
+		})
+	}
+	forStateSeries := func(activeAt, ts int64) prompbmarshal.TimeSeries {
+		return newTimeSeriesPB([]float64{float64(activeAt)}, []int64{ts * 1e3}, map[string]string{
+			"__name__":          alertForStateMetricName,
+			alertNameLabel:      "test",
+			alertGroupNameLabel: "",
+			"job":               "foo",
+		})
+	}
+
+	fq := &fakeQuerier{}
+	fq.add(datasource.Metric{
+		Labels:     []datasource.Label{{Name: "__name__", Value: "up"}, {Name: "job", Value: "foo"}},
+		Timestamps: []int64{at(0), at(1), at(2), at(4)},
+		Values:     []float64{1, 1, 1, 1},
+	})
+	ar := newTestAlertingRule("test", 2*step)
+	tss, err := ar.ExecRange(context.Background(), fq, time.Unix(at(0), 0), time.Unix(at(4), 0), step)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected := []prompbmarshal.TimeSeries{
+		alertsSeries("pending", at(0)), forStateSeries(at(0), at(0)),
+		alertsSeries("pending", at(1)), forStateSeries(at(0), at(1)),
+		alertsSeries("firing", at(2)), forStateSeries(at(0), at(2)),
+		// the gap in data points resets the alert
+		alertsSeries("pending", at(4)), forStateSeries(at(4), at(4)),
+	}
+	if err := compareTimeSeries(t, expected, tss); err != nil {
+		t.Fatalf("timeseries mismatch: %s", err)
+	}
+
+	// the alert state must be preserved between calls
+	fq.reset()
+	fq.add(datasource.Metric{
+		Labels:     []datasource.Label{{Name: "job", Value: "foo"}},
+		Timestamps: []int64{at(5), at(6)},
+		Values:     []float64{1, 1},
+	})
+	tss, err = ar.ExecRange(context.Background(), fq, time.Unix(at(5), 0), time.Unix(at(6), 0), step)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expected = []prompbmarshal.TimeSeries{
+		alertsSeries("pending", at(5)), forStateSeries(at(4), at(5)),
+		alertsSeries("firing", at(6)), forStateSeries(at(4), at(6)),
+	}
+	if err := compareTimeSeries(t, expected, tss); err != nil {
+		t.Fatalf("timeseries mismatch: %s", err)
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/datasource"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
@@ -16,9 +17,14 @@ type Rule interface {
 	// identifying this Rule among others.
 	ID() uint64
 	// Exec executes the rule with given context
-	// and Querier. If returnSeries is true, Exec
-	// may return TimeSeries as result of execution
-	Exec(ctx context.Context, q datasource.Querier, returnSeries bool) ([]prompbmarshal.TimeSeries, error)
+	// and Querier at the given timestamp ts.
+	// If returnSeries is true, Exec may return
+	// TimeSeries as result of execution
+	Exec(ctx context.Context, q datasource.Querier, ts time.Time, returnSeries bool) ([]prompbmarshal.TimeSeries, error)
+	// ExecRange executes the rule on the given time range
+	// with the given step and returns TimeSeries
+	// for backfilling. It doesn't change the Rule state.
+	ExecRange(ctx context.Context, q datasource.Querier, start, end time.Time, step time.Duration) ([]prompbmarshal.TimeSeries, error)
 	// UpdateWith performs modification of current Rule
 	// with fields of the given Rule.
 	UpdateWith(Rule) error
@@ -28,3 +34,14 @@ type Rule interface {
 }
 
 var errDuplicate = errors.New("result contains metrics with the same labelset after applying rule labels")
+
+// ruleHealth returns the health of the rule according to its last evaluation.
+func ruleHealth(lastExecTime time.Time, lastExecError error) string {
+	if lastExecTime.IsZero() {
+		return "unknown"
+	}
+	if lastExecError != nil {
+		return "err"
+	}
+	return "ok"
+}
@@ -0,0 +1,483 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/config"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/datasource"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmalert/notifier"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/promql"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	"gopkg.in/yaml.v2"
+)
+
+var unittestFile = flagutil.NewArray("unittestFile", `Path to the unit test files. When set, vmalert starts in unit test mode
+and performs only tests on configured files. Examples:
+ -unittestFile="./unittest/testfile.yaml,./unittest/testfile2.yaml".
+See https://victoriametrics.github.io/vmalert.html#unit-testing-for-rules`)
+
+// testStartTime is the timestamp of the first input series value and the first rules evaluation.
+// It isn't set to the Unix epoch, since zero date has special meaning in the per-day inverted index.
+var testStartTime = time.Unix(1e9, 0).UTC()
+
+// unitTestFile holds the contents of a single unit test file.
+type unitTestFile struct {
+	RuleFiles          []string            `yaml:"rule_files"`
+	EvaluationInterval config.PromDuration `yaml:"evaluation_interval"`
+	GroupEvalOrder     []string            `yaml:"group_eval_order"`
+	Tests              []testGroup         `yaml:"tests"`
+}
+
+// testGroup is a group of input series and tests associated with it.
+type testGroup struct {
+	Name              string              `yaml:"name"`
+	Interval          config.PromDuration `yaml:"interval"`
+	InputSeries       []series            `yaml:"input_series"`
+	AlertRuleTests    []alertTestCase     `yaml:"alert_rule_test"`
+	MetricsqlExprTest []metricsqlTestCase `yaml:"metricsql_expr_test"`
+	// PromqlExprTest is an alias to MetricsqlExprTest for compatibility with promtool test files.
+	PromqlExprTest []metricsqlTestCase `yaml:"promql_expr_test"`
+	ExternalLabels map[string]string   `yaml:"external_labels"`
+}
+
+// alertTestCase holds alert_rule_test cases defined in the test file
+type alertTestCase struct {
+	EvalTime  config.PromDuration `yaml:"eval_time"`
+	Alertname string              `yaml:"alertname"`
+	ExpAlerts []expAlert          `yaml:"exp_alerts"`
+}
+
+// expAlert holds exp_alerts defined in the test file
+type expAlert struct {
+	ExpLabels      map[string]string `yaml:"exp_labels"`
+	ExpAnnotations map[string]string `yaml:"exp_annotations"`
+}
+
+// metricsqlTestCase holds metricsql_expr_test cases defined in the test file
+type metricsqlTestCase struct {
+	Expr       string              `yaml:"expr"`
+	EvalTime   config.PromDuration `yaml:"eval_time"`
+	ExpSamples []expSample         `yaml:"exp_samples"`
+}
+
+// expSample holds exp_samples defined in the test file
+type expSample struct {
+	Labels string  `yaml:"labels"`
+	Value  float64 `yaml:"value"`
+}
+
+// isUnittestMode returns true if vmalert must run in unit test mode.
+func isUnittestMode() bool {
+	return len(*unittestFile) > 0
+}
+
+// unitRule runs unit tests from the given files and returns false if any of them fail.
+func unitRule(files ...string) bool {
+	eu, err := getExternalURL(*externalURL, *httpListenAddr, httpserver.IsTLS())
+	if err != nil {
+		fmt.Printf("failed to init `external.url`: %s\n", err)
+		return false
+	}
+	notifier.InitTemplateFunc(eu)
+	if err := notifier.LoadTemplates(*ruleTemplatesPath); err != nil {
+		fmt.Printf("failed to load templates: %s\n", err)
+		return false
+	}
+
+	storagePath, err := ioutil.TempDir("", "vmalert-unittest")
+	if err != nil {
+		fmt.Printf("cannot create temporary directory for the storage: %s\n", err)
+		return false
+	}
+	defer func() { _ = os.RemoveAll(storagePath) }()
+	_ = flag.Set("storageDataPath", storagePath)
+	// input series start at testStartTime, so the retention must cover it
+	_ = flag.Set("retentionPeriod", "100y")
+	netstorage.InitTmpBlocksDir(filepath.Join(storagePath, "tmp"))
+
+	passed := true
+	for _, f := range files {
+		fmt.Printf("\nUnit Testing: %s\n", f)
+		if errs := ruleUnitTest(f); len(errs) > 0 {
+			fmt.Println("  FAILED")
+			for _, err := range errs {
+				fmt.Printf("    %s\n", err)
+			}
+			passed = false
+			continue
+		}
+		fmt.Println("  SUCCESS")
+	}
+	return passed
+}
+
+func ruleUnitTest(filename string) []error {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return []error{fmt.Errorf("failed to read file: %w", err)}
+	}
+	var f unitTestFile
+	if err := yaml.UnmarshalStrict(b, &f); err != nil {
+		return []error{fmt.Errorf("failed to parse file: %w", err)}
+	}
+	// rule files are relative to the test file
+	for i, rf := range f.RuleFiles {
+		if !filepath.IsAbs(rf) {
+			f.RuleFiles[i] = filepath.Join(filepath.Dir(filename), rf)
+		}
+	}
+	evalInterval := f.EvaluationInterval.Duration()
+	if evalInterval <= 0 {
+		evalInterval = time.Minute
+	}
+	groupOrder := make(map[string]int, len(f.GroupEvalOrder))
+	for i, name := range f.GroupEvalOrder {
+		groupOrder[name] = i
+	}
+
+	var errs []error
+	for _, tg := range f.Tests {
+		for _, err := range tg.test(f.RuleFiles, evalInterval, groupOrder) {
+			if tg.Name != "" {
+				err = fmt.Errorf("group %q: %w", tg.Name, err)
+			}
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// test runs tg tests against rules from ruleFiles.
+func (tg *testGroup) test(ruleFiles []string, evalInterval time.Duration, groupOrder map[string]int) []error {
+	vmstorage.InitWithoutMetrics(func(mrs []storage.MetricRow) {})
+	defer func() {
+		vmstorage.Stop()
+		_ = os.RemoveAll(*vmstorage.DataPath)
+	}()
+
+	interval := tg.Interval.Duration()
+	if interval <= 0 {
+		interval = evalInterval
+	}
+	if err := writeInputSeries(tg.InputSeries, interval); err != nil {
+		return []error{err}
+	}
+
+	groups, err := tg.getGroups(ruleFiles, evalInterval, groupOrder)
+	if err != nil {
+		return []error{err}
+	}
+
+	alertTests := append([]alertTestCase{}, tg.AlertRuleTests...)
+	sort.SliceStable(alertTests, func(i, j int) bool {
+		return alertTests[i].EvalTime.Duration() < alertTests[j].EvalTime.Duration()
+	})
+	exprTests := append(append([]metricsqlTestCase{}, tg.MetricsqlExprTest...), tg.PromqlExprTest...)
+	var maxEvalTime time.Duration
+	for _, at := range alertTests {
+		if d := at.EvalTime.Duration(); d > maxEvalTime {
+			maxEvalTime = d
+		}
+	}
+	for _, et := range exprTests {
+		if d := et.EvalTime.Duration(); d > maxEvalTime {
+			maxEvalTime = d
+		}
+	}
+
+	var errs []error
+	q := &unittestQuerier{}
+	alertIdx := 0
+	for offset := time.Duration(0); offset <= maxEvalTime; offset += evalInterval {
+		ts := testStartTime.Add(offset)
+		for _, g := range groups {
+			if offset%g.Interval != 0 {
+				continue
+			}
+			for _, rule := range g.Rules {
+				q.ts = ts
+				tss, err := rule.Exec(context.Background(), g.getQuerier(q), ts, true)
+				if err != nil {
+					errs = append(errs, fmt.Errorf("failed to execute rule %q from group %q at %v: %w", rule, g.Name, offset, err))
+					continue
+				}
+				if err := writeTimeSeries(tss); err != nil {
+					return append(errs, err)
+				}
+			}
+		}
+		// check alerts, which must be evaluated before the next evaluation
+		for alertIdx < len(alertTests) && alertTests[alertIdx].EvalTime.Duration() < offset+evalInterval {
+			if err := alertTests[alertIdx].check(groups); err != nil {
+				errs = append(errs, err)
+			}
+			alertIdx++
+		}
+	}
+
+	for _, et := range exprTests {
+		if err := et.check(q); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// getGroups returns groups from ruleFiles ordered according to groupOrder.
+func (tg *testGroup) getGroups(ruleFiles []string, evalInterval time.Duration, groupOrder map[string]int) ([]*Group, error) {
+	groupsCfg, err := config.Parse(ruleFiles, *validateTemplates, true)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse rule files: %w", err)
+	}
+	var groups []*Group
+	for _, cfg := range groupsCfg {
+		groups = append(groups, newGroup(cfg, evalInterval, tg.ExternalLabels))
+	}
+	for name := range groupOrder {
+		found := false
+		for _, g := range groups {
+			if g.Name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("group %q from group_eval_order isn't found in rule files", name)
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		oi, okI := groupOrder[groups[i].Name]
+		oj, okJ := groupOrder[groups[j].Name]
+		if okI && okJ {
+			return oi < oj
+		}
+		// groups missing in group_eval_order are evaluated last
+		return okI && !okJ
+	})
+	return groups, nil
+}
+
+// check compares firing alerts for at.Alertname with the expected alerts.
+func (at *alertTestCase) check(groups []*Group) error {
+	var got []expAlert
+	for _, g := range groups {
+		for _, rule := range g.Rules {
+			ar, ok := rule.(*AlertingRule)
+			if !ok || ar.Name != at.Alertname {
+				continue
+			}
+			for _, a := range ar.alerts {
+				if a.State != notifier.StateFiring {
+					continue
+				}
+				labels := make(map[string]string, len(a.Labels)+1)
+				for k, v := range a.Labels {
+					labels[k] = v
+				}
+				labels[alertNameLabel] = ar.Name
+				got = append(got, expAlert{ExpLabels: labels, ExpAnnotations: a.Annotations})
+			}
+		}
+	}
+
+	exp := make([]expAlert, len(at.ExpAlerts))
+	for i, ea := range at.ExpAlerts {
+		labels := make(map[string]string, len(ea.ExpLabels)+1)
+		for k, v := range ea.ExpLabels {
+			labels[k] = v
+		}
+		labels[alertNameLabel] = at.Alertname
+		exp[i] = expAlert{ExpLabels: labels, ExpAnnotations: ea.ExpAnnotations}
+	}
+	// alertgroup label is added by vmalert, so it is compared only if it is expected explicitly
+	for i := range got {
+		if len(exp) == 0 {
+			break
+		}
+		if _, ok := exp[0].ExpLabels[alertGroupNameLabel]; !ok {
+			delete(got[i].ExpLabels, alertGroupNameLabel)
+		}
+	}
+	sortExpAlerts(got)
+	sortExpAlerts(exp)
+	if !equalExpAlerts(got, exp) {
+		return fmt.Errorf("alertname: %s, time: %s,\n        exp: %s,\n        got: %s",
+			at.Alertname, at.EvalTime.Duration(), formatExpAlerts(exp), formatExpAlerts(got))
+	}
+	return nil
+}
+
+func sortExpAlerts(as []expAlert) {
+	sort.Slice(as, func(i, j int) bool {
+		return formatLabels(as[i].ExpLabels) < formatLabels(as[j].ExpLabels)
+	})
+}
+
+func equalExpAlerts(a, b []expAlert) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !reflect.DeepEqual(a[i].ExpLabels, b[i].ExpLabels) {
+			return false
+		}
+		if len(a[i].ExpAnnotations) == 0 && len(b[i].ExpAnnotations) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(a[i].ExpAnnotations, b[i].ExpAnnotations) {
+			return false
+		}
+	}
+	return true
+}
+
+func formatExpAlerts(as []expAlert) string {
+	var a []string
+	for _, ea := range as {
+		a = append(a, fmt.Sprintf("{labels: %s, annotations: %s}", formatLabels(ea.ExpLabels), formatLabels(ea.ExpAnnotations)))
+	}
+	return "[" + strings.Join(a, ", ") + "]"
+}
+
+func formatLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var a []string
+	for _, k := range keys {
+		a = append(a, fmt.Sprintf("%s=%q", k, labels[k]))
+	}
+	return "{" + strings.Join(a, ", ") + "}"
+}
+
+type parsedSample struct {
+	labels string
+	value  float64
+}
+
+// check compares et.Expr results at et.EvalTime with the expected samples.
+func (et *metricsqlTestCase) check(q *unittestQuerier) error {
+	q.ts = testStartTime.Add(et.EvalTime.Duration())
+	metrics, err := q.Query(context.Background(), et.Expr, datasource.NewPrometheusType())
+	if err != nil {
+		return fmt.Errorf("expr: %q, time: %s, err: %w", et.Expr, et.EvalTime.Duration(), err)
+	}
+	var got []parsedSample
+	for _, m := range metrics {
+		labels := make(map[string]string, len(m.Labels))
+		for _, l := range m.Labels {
+			labels[l.Name] = l.Value
+		}
+		got = append(got, parsedSample{labels: formatLabels(labels), value: m.Value})
+	}
+	var exp []parsedSample
+	for _, s := range et.ExpSamples {
+		labels, err := parseSeriesLabels(s.Labels)
+		if err != nil {
+			return fmt.Errorf("expr: %q, time: %s, cannot parse expected labels %q: %w", et.Expr, et.EvalTime.Duration(), s.Labels, err)
+		}
+		exp = append(exp, parsedSample{labels: formatLabels(labels), value: s.Value})
+	}
+	sort.Slice(got, func(i, j int) bool { return got[i].labels < got[j].labels })
+	sort.Slice(exp, func(i, j int) bool { return exp[i].labels < exp[j].labels })
+	if !equalSamples(got, exp) {
+		return fmt.Errorf("expr: %q, time: %s,\n        exp: %v,\n        got: %v",
+			et.Expr, et.EvalTime.Duration(), exp, got)
+	}
+	return nil
+}
+
+func equalSamples(a, b []parsedSample) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].labels != b[i].labels {
+			return false
+		}
+		if !almostEqual(a[i].value, b[i].value) {
+			return false
+		}
+	}
+	return true
+}
+
+func almostEqual(a, b float64) bool {
+	if math.IsNaN(a) || math.IsNaN(b) {
+		return math.IsNaN(a) && math.IsNaN(b)
+	}
+	if a == b {
+		return true
+	}
+	return math.Abs(a-b) <= 1e-9*math.Max(math.Abs(a), math.Abs(b))
+}
+
+// unittestQuerier evaluates instant queries at ts via the embedded storage.
+type unittestQuerier struct {
+	ts time.Time
+}
+
+// unittestQueryStep is the default step for instant queries in /api/v1/query.
+const unittestQueryStep = 5 * time.Minute
+
+// Query implements datasource.Querier interface.
+func (q *unittestQuerier) Query(_ context.Context, query string, engine datasource.Type) ([]datasource.Metric, error) {
+	if engine.String() != datasource.NewPrometheusType().String() {
+		return nil, fmt.Errorf("%q rules aren't supported in unit tests", engine)
+	}
+	ts := q.ts.UnixNano() / 1e6
+	ec := &promql.EvalConfig{
+		Start:    ts,
+		End:      ts,
+		Step:     unittestQueryStep.Milliseconds(),
+		Deadline: searchutils.NewDeadline(time.Now(), time.Minute, ""),
+	}
+	results, err := promql.Exec(ec, query, true)
+	if err != nil {
+		return nil, err
+	}
+	metrics := make([]datasource.Metric, 0, len(results))
+	for _, r := range results {
+		if len(r.Values) == 0 {
+			continue
+		}
+		var m datasource.Metric
+		if len(r.MetricName.MetricGroup) > 0 {
+			m.AddLabel("__name__", string(r.MetricName.MetricGroup))
+		}
+		for _, tag := range r.MetricName.Tags {
+			m.AddLabel(string(tag.Key), string(tag.Value))
+		}
+		m.Timestamp = r.Timestamps[len(r.Timestamps)-1] / 1e3
+		m.Value = r.Values[len(r.Values)-1]
+		metrics = append(metrics, m)
+	}
+	return metrics, nil
+}
+
+// QueryRange implements datasource.Querier interface.
+func (q *unittestQuerier) QueryRange(_ context.Context, _ string, _ datasource.Type, _, _ time.Time, _ time.Duration) ([]datasource.Metric, error) {
+	return nil, fmt.Errorf("range queries aren't supported in unit tests")
+}
+
+// WithEvalDelay implements datasource.Querier interface.
+func (q *unittestQuerier) WithEvalDelay(evalDelay time.Duration) datasource.Querier {
+	return &unittestQuerier{ts: q.ts.Add(-evalDelay)}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	"github.com/VictoriaMetrics/metricsql"
+)
+
+// series holds input_series defined in the test file
+type series struct {
+	Series string `yaml:"series"`
+	Values string `yaml:"values"`
+}
+
+// sequenceValue is an omittable value in a sequence of time series values.
+type sequenceValue struct {
+	Value   float64
+	Omitted bool
+}
+
+// writeInputSeries writes input series to the storage.
+// The i-th value of every series gets testStartTime+i*interval timestamp.
+func writeInputSeries(input []series, interval time.Duration) error {
+	var mrs []storage.MetricRow
+	for _, s := range input {
+		labels, err := parseSeriesLabels(s.Series)
+		if err != nil {
+			return fmt.Errorf("failed to parse series %q: %w", s.Series, err)
+		}
+		vals, err := parseInputValue(s.Values)
+		if err != nil {
+			return fmt.Errorf("failed to parse values %q of series %q: %w", s.Values, s.Series, err)
+		}
+		metricNameRaw := storage.MarshalMetricNameRaw(nil, toPrompbLabels(labels))
+		for i, v := range vals {
+			if v.Omitted {
+				continue
+			}
+			mrs = append(mrs, storage.MetricRow{
+				MetricNameRaw: metricNameRaw,
+				Timestamp:     testStartTime.Add(interval*time.Duration(i)).UnixNano() / 1e6,
+				Value:         v.Value,
+			})
+		}
+	}
+	return addRows(mrs)
+}
+
+// writeTimeSeries writes tss produced by rules to the storage,
+// so they become visible to the subsequent rules and tests.
+func writeTimeSeries(tss []prompbmarshal.TimeSeries) error {
+	var mrs []storage.MetricRow
+	for _, ts := range tss {
+		labels := make(map[string]string, len(ts.Labels))
+		for _, l := range ts.Labels {
+			labels[l.Name] = l.Value
+		}
+		metricNameRaw := storage.MarshalMetricNameRaw(nil, toPrompbLabels(labels))
+		for _, s := range ts.Samples {
+			mrs = append(mrs, storage.MetricRow{
+				MetricNameRaw: metricNameRaw,
+				Timestamp:     s.Timestamp,
+				Value:         s.Value,
+			})
+		}
+	}
+	return addRows(mrs)
+}
+
+func addRows(mrs []storage.MetricRow) error {
+	if len(mrs) == 0 {
+		return nil
+	}
+	if err := vmstorage.AddRows(mrs); err != nil {
+		return fmt.Errorf("cannot add rows to the storage: %w", err)
+	}
+	// make the added rows visible for search
+	vmstorage.Storage.DebugFlush()
+	return nil
+}
+
+func toPrompbLabels(labels map[string]string) []prompb.Label {
+	result := make([]prompb.Label, 0, len(labels))
+	for k, v := range labels {
+		result = append(result, prompb.Label{
+			Name:  []byte(k),
+			Value: []byte(v),
+		})
+	}
+	return result
+}
+
+// parseSeriesLabels parses series in the form `metric_name{label="value", ...}`.
+func parseSeriesLabels(s string) (map[string]string, error) {
+	labels := make(map[string]string)
+	if strings.TrimSpace(s) == "{}" {
+		return labels, nil
+	}
+	expr, err := metricsql.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	me, ok := expr.(*metricsql.MetricExpr)
+	if !ok {
+		return nil, fmt.Errorf("expecting series selector; got %q", expr.AppendString(nil))
+	}
+	for _, lf := range me.LabelFilters {
+		if lf.IsRegexp || lf.IsNegative {
+			return nil, fmt.Errorf("only `=` label matchers are allowed; got %q", lf.AppendString(nil))
+		}
+		labels[lf.Label] = lf.Value
+	}
+	return labels, nil
+}
+
+// parseInputValue parses input values in the Prometheus expanding notation.
+// 'a+bxn' becomes 'a a+b a+(2*b) a+(3*b) … a+(n*b)', 'a-bxn' becomes 'a a-b a-(2*b) a-(3*b) … a-(n*b)'
+// and 'axn' becomes 'a a a … a' (n+1 times). '_' represents a missing value, while '_xn' represents n missing values.
+//
+// 'stale' markers aren't supported by the storage, so they are treated as missing values.
+func parseInputValue(input string) ([]sequenceValue, error) {
+	var res []sequenceValue
+	for _, item := range strings.Fields(input) {
+		switch {
+		case item == "_" || item == "stale":
+			res = append(res, sequenceValue{Omitted: true})
+		case strings.HasPrefix(item, "_x"):
+			n, err := strconv.Atoi(item[len("_x"):])
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("cannot parse %q: invalid repeat count", item)
+			}
+			for i := 0; i < n; i++ {
+				res = append(res, sequenceValue{Omitted: true})
+			}
+		case strings.Contains(item, "x"):
+			vals, err := expandSequence(item)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, vals...)
+		default:
+			v, err := strconv.ParseFloat(item, 64)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse %q: %w", item, err)
+			}
+			res = append(res, sequenceValue{Value: v})
+		}
+	}
+	return res, nil
+}
+
+// expandSequence expands `a+bxn`, `a-bxn` and `axn` items.
+func expandSequence(item string) ([]sequenceValue, error) {
+	n := strings.LastIndexByte(item, 'x')
+	count, err := strconv.Atoi(item[n+1:])
+	if err != nil || count < 0 {
+		return nil, fmt.Errorf("cannot parse %q: invalid repeat count", item)
+	}
+	expr := item[:n]
+	var delta float64
+	// search for the operator after the first char, since the first char may be a sign,
+	// and skip signs of the exponent such as in `1e-3`.
+	for i := 1; i < len(expr); i++ {
+		c := expr[i]
+		if c != '+' && c != '-' {
+			continue
+		}
+		if prev := expr[i-1]; prev == 'e' || prev == 'E' {
+			continue
+		}
+		delta, err = strconv.ParseFloat(expr[i+1:], 64)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse %q: %w", item, err)
+		}
+		if c == '-' {
+			delta = -delta
+		}
+		expr = expr[:i]
+		break
+	}
+	start, err := strconv.ParseFloat(expr, 64)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse %q: %w", item, err)
+	}
+	res := make([]sequenceValue, 0, count+1)
+	for i := 0; i <= count; i++ {
+		res = append(res, sequenceValue{Value: start + delta*float64(i)})
+	}
+	return res, nil
+}
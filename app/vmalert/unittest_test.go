@@ -0,0 +1,76 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUnitRule(t *testing.T) {
+	f := func(files []string, expPassed bool) {
+		t.Helper()
+		if passed := unitRule(files...); passed != expPassed {
+			t.Fatalf("unexpected result for %v; got %v; want %v", files, passed, expPassed)
+		}
+	}
+	f([]string{"./unittest/testdata/test1.yaml"}, true)
+	f([]string{"./unittest/testdata/failed.yaml"}, false)
+	f([]string{"./unittest/testdata/test1.yaml", "./unittest/testdata/failed.yaml"}, false)
+	f([]string{"./unittest/testdata/non-existing.yaml"}, false)
+}
+
+func TestParseInputValue(t *testing.T) {
+	f := func(input string, exp []sequenceValue) {
+		t.Helper()
+		got, err := parseInputValue(input)
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %s", input, err)
+		}
+		if !reflect.DeepEqual(got, exp) {
+			t.Fatalf("unexpected result for %q;\ngot\n%v\nwant\n%v", input, got, exp)
+		}
+	}
+	f("", nil)
+	f("1", []sequenceValue{{Value: 1}})
+	f("1 _ 3 stale", []sequenceValue{{Value: 1}, {Omitted: true}, {Value: 3}, {Omitted: true}})
+	f("_x2", []sequenceValue{{Omitted: true}, {Omitted: true}})
+	f("1+1x2", []sequenceValue{{Value: 1}, {Value: 2}, {Value: 3}})
+	f("10-2x2", []sequenceValue{{Value: 10}, {Value: 8}, {Value: 6}})
+	f("-1+1x1", []sequenceValue{{Value: -1}, {Value: 0}})
+	f("5x2", []sequenceValue{{Value: 5}, {Value: 5}, {Value: 5}})
+	f("1e3+1e-1x1", []sequenceValue{{Value: 1000}, {Value: 1000.1}})
+	f("1 _x1 2+0x1", []sequenceValue{{Value: 1}, {Omitted: true}, {Value: 2}, {Value: 2}})
+
+	for _, input := range []string{"a", "1+ax2", "1+1xa", "_xa", "1+1x-1"} {
+		if _, err := parseInputValue(input); err == nil {
+			t.Fatalf("expecting non-nil error for %q", input)
+		}
+	}
+}
+
+func TestParseSeriesLabels(t *testing.T) {
+	f := func(s string, exp map[string]string, expErr bool) {
+		t.Helper()
+		got, err := parseSeriesLabels(s)
+		if expErr {
+			if err == nil {
+				t.Fatalf("expecting non-nil error for %q", s)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("unexpected error for %q: %s", s, err)
+		}
+		if !reflect.DeepEqual(got, exp) {
+			t.Fatalf("unexpected labels for %q; got %v; want %v", s, got, exp)
+		}
+	}
+	f("{}", map[string]string{}, false)
+	f("up", map[string]string{"__name__": "up"}, false)
+	f(`up{job="vmalert", instance="localhost:8880"}`, map[string]string{
+		"__name__": "up",
+		"job":      "vmalert",
+		"instance": "localhost:8880",
+	}, false)
+	f(`up{job=~"vm.*"}`, nil, true)
+	f(`sum(up)`, nil, true)
+}
@@ -8,11 +8,18 @@ import (
 )
 
 func newTimeSeries(value float64, labels map[string]string, timestamp time.Time) prompbmarshal.TimeSeries {
+	return newTimeSeriesPB([]float64{value}, []int64{timestamp.UnixNano() / 1e6}, labels)
+}
+
+// newTimeSeriesPB creates prompbmarshal.TimeSeries with the given values and timestamps in milliseconds.
+func newTimeSeriesPB(values []float64, timestamps []int64, labels map[string]string) prompbmarshal.TimeSeries {
 	ts := prompbmarshal.TimeSeries{}
-	ts.Samples = append(ts.Samples, prompbmarshal.Sample{
-		Value:     value,
-		Timestamp: timestamp.UnixNano() / 1e6,
-	})
+	for i := range values {
+		ts.Samples = append(ts.Samples, prompbmarshal.Sample{
+			Value:     values[i],
+			Timestamp: timestamps[i],
+		})
+	}
 	keys := make([]string, 0, len(labels))
 	for k := range labels {
 		keys = append(keys, k)
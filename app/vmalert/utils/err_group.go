@@ -26,6 +26,14 @@ func (eg *ErrGroup) Err() error {
 	return eg
 }
 
+// Errors returns all the errors accumulated in the group.
+func (eg *ErrGroup) Errors() []error {
+	if eg == nil {
+		return nil
+	}
+	return eg.errs
+}
+
 // Error satisfies Error interface
 func (eg *ErrGroup) Error() string {
 	if len(eg.errs) == 0 {
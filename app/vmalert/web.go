@@ -7,9 +7,9 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
-	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/procutil"
 )
 
@@ -18,6 +18,9 @@ type requestHandler struct {
 }
 
 var pathList = [][]string{
+	{"/vmalert/groups", "UI with all loaded groups and rules"},
+	{"/vmalert/alerts", "UI with all pending and firing alerts"},
+	{"/api/v1/rules", "list all loaded groups and rules in Prometheus-compatible format"},
 	{"/api/v1/groups", "list all loaded groups and rules"},
 	{"/api/v1/alerts", "list all active alerts"},
 	{"/api/v1/groupID/alertID/status", "get alert status by ID"},
@@ -34,6 +37,26 @@ func (rh *requestHandler) handler(w http.ResponseWriter, r *http.Request) bool {
 			fmt.Fprintf(w, "<a href='%s'>%q</a> - %s<br/>", p, p, doc)
 		}
 		return true
+	case "/vmalert", "/vmalert/":
+		http.Redirect(w, r, "/vmalert/groups", http.StatusFound)
+		return true
+	case "/vmalert/groups":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		WriteListGroups(w, rh.listPromGroups(""))
+		return true
+	case "/vmalert/alerts":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		WriteListAlerts(w, rh.listPromGroups("alert"))
+		return true
+	case "/api/v1/rules":
+		data, err := rh.listRules(r.FormValue("type"))
+		if err != nil {
+			httpserver.Errorf(w, r, "error in %q: %s", r.URL.Path, err)
+			return true
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write(data)
+		return true
 	case "/api/v1/groups":
 		data, err := rh.listGroups()
 		if err != nil {
@@ -53,7 +76,7 @@ func (rh *requestHandler) handler(w http.ResponseWriter, r *http.Request) bool {
 		w.Write(data)
 		return true
 	case "/-/reload":
-		logger.Infof("api config reload was called, sending sighup")
+		httpserver.LogAuditEvent(r, "config_reload", "")
 		procutil.SelfSIGHUP()
 		w.WriteHeader(http.StatusOK)
 		return true
@@ -104,6 +127,68 @@ func (rh *requestHandler) listGroups() ([]byte, error) {
 	return b, nil
 }
 
+type listRulesResponse struct {
+	Data struct {
+		Groups []APIPromGroup `json:"groups"`
+	} `json:"data"`
+	Status string `json:"status"`
+}
+
+// listRules returns groups and rules in the format compatible
+// with Prometheus /api/v1/rules. The optional ruleType filter
+// accepts "alert" or "record" values.
+func (rh *requestHandler) listRules(ruleType string) ([]byte, error) {
+	if ruleType != "" && ruleType != "alert" && ruleType != "record" {
+		return nil, badRequest(fmt.Errorf(`unsupported type %q; expected "alert" or "record"`, ruleType))
+	}
+	lr := listRulesResponse{Status: "success"}
+	lr.Data.Groups = rh.listPromGroups(ruleType)
+	if lr.Data.Groups == nil {
+		// Prometheus returns an empty list instead of null
+		lr.Data.Groups = []APIPromGroup{}
+	}
+	b, err := json.Marshal(lr)
+	if err != nil {
+		return nil, &httpserver.ErrorWithStatusCode{
+			Err:        fmt.Errorf(`error encoding list of rules: %w`, err),
+			StatusCode: http.StatusInternalServerError,
+		}
+	}
+	return b, nil
+}
+
+// listPromGroups returns groups sorted by name. Only rules matching
+// ruleType are returned if it is set. Groups without matching rules are skipped.
+func (rh *requestHandler) listPromGroups(ruleType string) []APIPromGroup {
+	rh.m.groupsMu.RLock()
+	defer rh.m.groupsMu.RUnlock()
+
+	var groups []APIPromGroup
+	for _, g := range rh.m.groups {
+		pg := g.toPromAPI()
+		if ruleType != "" {
+			rules := pg.Rules[:0]
+			for _, r := range pg.Rules {
+				if (ruleType == "alert") == (r.Type == "alerting") {
+					rules = append(rules, r)
+				}
+			}
+			if len(rules) == 0 {
+				continue
+			}
+			pg.Rules = rules
+		}
+		groups = append(groups, pg)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].Name != groups[j].Name {
+			return groups[i].Name < groups[j].Name
+		}
+		return groups[i].File < groups[j].File
+	})
+	return groups
+}
+
 type listAlertsResponse struct {
 	Data struct {
 		Alerts []*APIAlert `json:"alerts"`
@@ -168,6 +253,23 @@ func (rh *requestHandler) alert(path string) ([]byte, error) {
 	return json.Marshal(resp)
 }
 
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func humanizeAgo(t time.Time) string {
+	d := time.Since(t)
+	if d < 0 {
+		return "just now"
+	}
+	return fmt.Sprintf("%s ago", d.Truncate(time.Millisecond))
+}
+
 func uint64FromPath(path string) (uint64, error) {
 	s := strings.TrimRight(path, "/")
 	return strconv.ParseUint(s, 10, 0)
@@ -14,12 +14,13 @@ func TestHandler(t *testing.T) {
 	ar := &AlertingRule{
 		Name: "alert",
 		alerts: map[uint64]*notifier.Alert{
-			0: {},
+			0: {State: notifier.StateFiring},
 		},
 	}
+	rr := &RecordingRule{Name: "record"}
 	g := &Group{
 		Name:  "group",
-		Rules: []Rule{ar},
+		Rules: []Rule{ar, rr},
 	}
 	m := &manager{groups: make(map[uint64]*Group)}
 	m.groups[0] = g
@@ -61,6 +62,36 @@ func TestHandler(t *testing.T) {
 			t.Errorf("expected 1 group got %d", length)
 		}
 	})
+	t.Run("/api/v1/rules", func(t *testing.T) {
+		f := func(ruleType string, expRules int) {
+			t.Helper()
+			lr := listRulesResponse{}
+			getResp(ts.URL+"/api/v1/rules?type="+ruleType, &lr, 200)
+			if length := len(lr.Data.Groups); length != 1 {
+				t.Fatalf("expected 1 group got %d", length)
+			}
+			if length := len(lr.Data.Groups[0].Rules); length != expRules {
+				t.Fatalf("expected %d rules got %d", expRules, length)
+			}
+		}
+		f("", 2)
+		f("alert", 1)
+		f("record", 1)
+
+		lr := listRulesResponse{}
+		getResp(ts.URL+"/api/v1/rules?type=alert", &lr, 200)
+		r := lr.Data.Groups[0].Rules[0]
+		if r.State != "firing" || len(r.Alerts) != 1 {
+			t.Errorf("expected rule to have 1 firing alert; got state %q and %d alerts", r.State, len(r.Alerts))
+		}
+		getResp(ts.URL+"/api/v1/rules?type=foo", nil, 400)
+	})
+	t.Run("/vmalert/groups", func(t *testing.T) {
+		getResp(ts.URL+"/vmalert/groups", nil, 200)
+	})
+	t.Run("/vmalert/alerts", func(t *testing.T) {
+		getResp(ts.URL+"/vmalert/alerts", nil, 200)
+	})
 	t.Run("/api/v1/0/0/status", func(t *testing.T) {
 		alert := &APIAlert{}
 		getResp(ts.URL+"/api/v1/0/0/status", alert, 200)
@@ -26,22 +26,26 @@ type APIGroup struct {
 	File           string             `json:"file"`
 	Interval       string             `json:"interval"`
 	Concurrency    int                `json:"concurrency"`
+	EvalDelay      string             `json:"eval_delay"`
+	EvalOffset     string             `json:"eval_offset,omitempty"`
+	RemoteWrite    []string           `json:"remote_write,omitempty"`
 	AlertingRules  []APIAlertingRule  `json:"alerting_rules"`
 	RecordingRules []APIRecordingRule `json:"recording_rules"`
 }
 
 // APIAlertingRule represents AlertingRule for WEB view
 type APIAlertingRule struct {
-	ID          string            `json:"id"`
-	Name        string            `json:"name"`
-	Type        string            `json:"type"`
-	GroupID     string            `json:"group_id"`
-	Expression  string            `json:"expression"`
-	For         string            `json:"for"`
-	LastError   string            `json:"last_error"`
-	LastExec    time.Time         `json:"last_exec"`
-	Labels      map[string]string `json:"labels"`
-	Annotations map[string]string `json:"annotations"`
+	ID            string            `json:"id"`
+	Name          string            `json:"name"`
+	Type          string            `json:"type"`
+	GroupID       string            `json:"group_id"`
+	Expression    string            `json:"expression"`
+	For           string            `json:"for"`
+	KeepFiringFor string            `json:"keep_firing_for"`
+	LastError     string            `json:"last_error"`
+	LastExec      time.Time         `json:"last_exec"`
+	Labels        map[string]string `json:"labels"`
+	Annotations   map[string]string `json:"annotations"`
 }
 
 // APIRecordingRule represents RecordingRule for WEB view
@@ -55,3 +59,45 @@ type APIRecordingRule struct {
 	LastExec   time.Time         `json:"last_exec"`
 	Labels     map[string]string `json:"labels"`
 }
+
+// APIPromGroup represents Group in Prometheus-compatible
+// format for /api/v1/rules response.
+// See https://prometheus.io/docs/prometheus/latest/querying/api/#rules
+type APIPromGroup struct {
+	Name string `json:"name"`
+	ID   string `json:"id"`
+	File string `json:"file"`
+	// Interval is group evaluation interval in seconds
+	Interval float64 `json:"interval"`
+	// EvaluationTime is the duration of the last group evaluation in seconds
+	EvaluationTime float64       `json:"evaluationTime"`
+	LastEvaluation time.Time     `json:"lastEvaluation"`
+	Rules          []APIPromRule `json:"rules"`
+}
+
+// APIPromRule represents AlertingRule or RecordingRule in
+// Prometheus-compatible format for /api/v1/rules response.
+type APIPromRule struct {
+	// State is set only for alerting rules: firing, pending or inactive
+	State string `json:"state,omitempty"`
+	Name  string `json:"name"`
+	Query string `json:"query"`
+	// Duration is `for` param of alerting rule in seconds
+	Duration    float64           `json:"duration,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Alerts      []*APIAlert       `json:"alerts,omitempty"`
+	// Health is one of ok, err or unknown if rule wasn't evaluated yet
+	Health    string `json:"health"`
+	LastError string `json:"lastError"`
+	// EvaluationTime is the duration of the last rule evaluation in seconds
+	EvaluationTime float64   `json:"evaluationTime"`
+	LastEvaluation time.Time `json:"lastEvaluation"`
+	// Type is either alerting or recording
+	Type string `json:"type"`
+
+	ID      string `json:"id"`
+	GroupID string `json:"group_id"`
+	// DatasourceType is the type of rule expression: prometheus or graphite
+	DatasourceType string `json:"datasourceType"`
+}
@@ -28,18 +28,36 @@ type AuthConfig struct {
 
 // UserInfo is user information read from authConfigPath
 type UserInfo struct {
-	Username  string   `yaml:"username"`
-	Password  string   `yaml:"password"`
-	URLPrefix string   `yaml:"url_prefix"`
-	URLMap    []URLMap `yaml:"url_map"`
+	Username  string    `yaml:"username"`
+	Password  string    `yaml:"password,omitempty"`
+	URLPrefix URLPrefix `yaml:"url_prefix,omitempty"`
+	URLMap    []URLMap  `yaml:"url_map,omitempty"`
+	Disabled  bool      `yaml:"disabled,omitempty"`
 
-	requests *metrics.Counter
+	LoadBalancingPolicy string `yaml:"load_balancing_policy,omitempty"`
+
+	IPFilters       *IPFilters `yaml:"ip_filters,omitempty"`
+	ClientCertNames []string   `yaml:"client_cert_names,omitempty"`
+
+	MaxConcurrentRequests int     `yaml:"max_concurrent_requests,omitempty"`
+	RequestsPerSecond     float64 `yaml:"requests_per_second,omitempty"`
+	RequestsBurst         int     `yaml:"requests_burst,omitempty"`
+
+	requests     *metrics.Counter
+	limits       *userLimits
+	tenantLimits *tenantLimits
+
+	// defaultRoute is the route for requests routed via URLPrefix.
+	defaultRoute *route
 }
 
 // URLMap is a mapping from source paths to target urls.
 type URLMap struct {
-	SrcPaths  []string `yaml:"src_paths"`
-	URLPrefix string   `yaml:"url_prefix"`
+	SrcPaths  []string  `yaml:"src_paths"`
+	URLPrefix URLPrefix `yaml:"url_prefix"`
+
+	// routes contains routes for SrcPaths.
+	routes []*route
 }
 
 func initAuthConfig() {
@@ -72,17 +90,32 @@ func authConfigReloader() {
 			return
 		case <-sighupCh:
 			logger.Infof("SIGHUP received; loading -auth.config=%q", *authConfigPath)
-			m, err := readAuthConfig(*authConfigPath)
-			if err != nil {
-				logger.Errorf("failed to load -auth.config=%q; using the last successfully loaded config; error: %s", *authConfigPath, err)
-				continue
+			if err := reloadAuthConfig(); err != nil {
+				logger.Errorf("%s", err)
 			}
-			authConfig.Store(m)
-			logger.Infof("Successfully reloaded -auth.config=%q", *authConfigPath)
 		}
 	}
 }
 
+// reloadAuthConfig reloads auth config from -auth.config.
+//
+// The last successfully loaded config remains active on error.
+func reloadAuthConfig() error {
+	authConfigUpdateLock.Lock()
+	defer authConfigUpdateLock.Unlock()
+
+	m, err := readAuthConfig(*authConfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to load -auth.config=%q; using the last successfully loaded config; error: %w", *authConfigPath, err)
+	}
+	authConfig.Store(m)
+	logger.Infof("Successfully reloaded -auth.config=%q", *authConfigPath)
+	return nil
+}
+
+// authConfigUpdateLock serializes updates of -auth.config file and of authConfig.
+var authConfigUpdateLock sync.Mutex
+
 var authConfig atomic.Value
 var authConfigWG sync.WaitGroup
 var stopCh chan struct{}
@@ -111,19 +144,21 @@ func parseAuthConfig(data []byte) (map[string]*UserInfo, error) {
 		return nil, fmt.Errorf("`users` section cannot be empty in AuthConfig")
 	}
 	m := make(map[string]*UserInfo, len(uis))
+	clientCertNames := make(map[string]string)
 	for i := range uis {
 		ui := &uis[i]
 		if m[ui.Username] != nil {
 			return nil, fmt.Errorf("duplicate username found; username: %q", ui.Username)
 		}
 		if len(ui.URLPrefix) > 0 {
-			urlPrefix, err := sanitizeURLPrefix(ui.URLPrefix)
+			urlPrefix, err := sanitizeURLPrefixes(ui.URLPrefix)
 			if err != nil {
 				return nil, err
 			}
 			ui.URLPrefix = urlPrefix
 		}
-		for _, e := range ui.URLMap {
+		for i := range ui.URLMap {
+			e := &ui.URLMap[i]
 			if len(e.SrcPaths) == 0 {
 				return nil, fmt.Errorf("missing `src_paths`")
 			}
@@ -132,7 +167,7 @@ func parseAuthConfig(data []byte) (map[string]*UserInfo, error) {
 					return nil, fmt.Errorf("`src_path`=%q must start with `/`", path)
 				}
 			}
-			urlPrefix, err := sanitizeURLPrefix(e.URLPrefix)
+			urlPrefix, err := sanitizeURLPrefixes(e.URLPrefix)
 			if err != nil {
 				return nil, err
 			}
@@ -141,12 +176,55 @@ func parseAuthConfig(data []byte) (map[string]*UserInfo, error) {
 		if len(ui.URLMap) == 0 && len(ui.URLPrefix) == 0 {
 			return nil, fmt.Errorf("missing `url_prefix`")
 		}
+		if ui.MaxConcurrentRequests < 0 {
+			return nil, fmt.Errorf("`max_concurrent_requests` cannot be negative; got %d", ui.MaxConcurrentRequests)
+		}
+		if ui.RequestsPerSecond < 0 {
+			return nil, fmt.Errorf("`requests_per_second` cannot be negative; got %g", ui.RequestsPerSecond)
+		}
+		if ui.RequestsBurst < 0 {
+			return nil, fmt.Errorf("`requests_burst` cannot be negative; got %d", ui.RequestsBurst)
+		}
+		if err := validateLoadBalancingPolicy(ui.LoadBalancingPolicy); err != nil {
+			return nil, err
+		}
+		ui.limits = newUserLimits(ui, "")
+		ui.tenantLimits = &tenantLimits{
+			m: make(map[string]*userLimits),
+		}
+		if ui.IPFilters != nil {
+			if err := ui.IPFilters.init(); err != nil {
+				return nil, fmt.Errorf("invalid `ip_filters` for username %q: %w", ui.Username, err)
+			}
+		}
+		for _, name := range ui.ClientCertNames {
+			if username, ok := clientCertNames[name]; ok {
+				return nil, fmt.Errorf("duplicate `client_cert_names` entry %q found for usernames %q and %q", name, username, ui.Username)
+			}
+			clientCertNames[name] = ui.Username
+		}
 		ui.requests = metrics.GetOrCreateCounter(fmt.Sprintf(`vmauth_user_requests_total{username=%q}`, ui.Username))
+		ui.initRoutes()
 		m[ui.Username] = ui
 	}
 	return m, nil
 }
 
+func sanitizeURLPrefixes(up URLPrefix) (URLPrefix, error) {
+	if len(up) == 0 {
+		return nil, fmt.Errorf("missing `url_prefix`")
+	}
+	result := make(URLPrefix, len(up))
+	for i, urlPrefix := range up {
+		s, err := sanitizeURLPrefix(urlPrefix)
+		if err != nil {
+			return nil, err
+		}
+		result[i] = s
+	}
+	return result, nil
+}
+
 func sanitizeURLPrefix(urlPrefix string) (string, error) {
 	// Remove trailing '/' from urlPrefix
 	for strings.HasSuffix(urlPrefix, "/") {
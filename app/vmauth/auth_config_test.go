@@ -79,6 +79,40 @@ users:
   - url_prefix: http://foobar
 `)
 
+	// Negative limits
+	f(`
+users:
+- username: a
+  url_prefix: http://foobar
+  max_concurrent_requests: -1
+`)
+	f(`
+users:
+- username: a
+  url_prefix: http://foobar
+  requests_per_second: -1.5
+`)
+
+	// Invalid ip_filters
+	f(`
+users:
+- username: a
+  url_prefix: http://foobar
+  ip_filters:
+    allow_list: [foobar]
+`)
+
+	// Duplicate client_cert_names
+	f(`
+users:
+- username: a
+  url_prefix: http://foobar
+  client_cert_names: [foo]
+- username: b
+  url_prefix: http://foobar
+  client_cert_names: [foo]
+`)
+
 	// src_path not starting with `/`
 	f(`
 users:
@@ -112,7 +146,7 @@ users:
 		"foo": {
 			Username:  "foo",
 			Password:  "bar",
-			URLPrefix: "http://aaa:343/bbb",
+			URLPrefix: URLPrefix{"http://aaa:343/bbb"},
 		},
 	})
 
@@ -126,11 +160,29 @@ users:
 `, map[string]*UserInfo{
 		"foo": {
 			Username:  "foo",
-			URLPrefix: "http://foo",
+			URLPrefix: URLPrefix{"http://foo"},
 		},
 		"bar": {
 			Username:  "bar",
-			URLPrefix: "https://bar/x",
+			URLPrefix: URLPrefix{"https://bar/x"},
+		},
+	})
+
+	// User with limits
+	f(`
+users:
+- username: foo
+  url_prefix: http://foo
+  max_concurrent_requests: 10
+  requests_per_second: 5.5
+  requests_burst: 20
+`, map[string]*UserInfo{
+		"foo": {
+			Username:              "foo",
+			URLPrefix:             URLPrefix{"http://foo"},
+			MaxConcurrentRequests: 10,
+			RequestsPerSecond:     5.5,
+			RequestsBurst:         20,
 		},
 	})
 
@@ -149,11 +201,11 @@ users:
 			URLMap: []URLMap{
 				{
 					SrcPaths:  []string{"/api/v1/query", "/api/v1/query_range"},
-					URLPrefix: "http://vmselect/select/0/prometheus",
+					URLPrefix: URLPrefix{"http://vmselect/select/0/prometheus"},
 				},
 				{
 					SrcPaths:  []string{"/api/v1/write"},
-					URLPrefix: "http://vminsert/insert/0/prometheus",
+					URLPrefix: URLPrefix{"http://vminsert/insert/0/prometheus"},
 				},
 			},
 		},
@@ -163,5 +215,11 @@ users:
 func removeMetrics(m map[string]*UserInfo) {
 	for _, info := range m {
 		info.requests = nil
+		info.limits = nil
+		info.tenantLimits = nil
+		info.defaultRoute = nil
+		for i := range info.URLMap {
+			info.URLMap[i].routes = nil
+		}
 	}
 }
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+	"gopkg.in/yaml.v2"
+)
+
+var (
+	healthCheckInterval = flag.Duration("backend.healthCheckInterval", 5*time.Second, "Interval for active health checks of backends from `url_prefix` lists. "+
+		"Health checks are disabled if zero value is passed. See https://victoriametrics.github.io/vmauth.html#load-balancing")
+	healthCheckPath    = flag.String("backend.healthCheckPath", "/health", "Path for active health checks of backends. It is requested at the backend host root")
+	healthCheckTimeout = flag.Duration("backend.healthCheckTimeout", 2*time.Second, "Timeout for active health checks of backends")
+	ejectDuration      = flag.Duration("backend.ejectDuration", 10*time.Second, "The duration for ejecting a backend from load balancing after connection errors")
+)
+
+// URLPrefix represents `url_prefix` option. It may contain either a single url or a list of urls.
+type URLPrefix []string
+
+// UnmarshalYAML implements yaml.Unmarshaler
+func (up *URLPrefix) UnmarshalYAML(f func(interface{}) error) error {
+	var v interface{}
+	if err := f(&v); err != nil {
+		return err
+	}
+	switch x := v.(type) {
+	case string:
+		*up = URLPrefix{x}
+	case []interface{}:
+		a := make([]string, 0, len(x))
+		for _, item := range x {
+			s, ok := item.(string)
+			if !ok {
+				return fmt.Errorf("`url_prefix` list must contain only strings; got %#v", item)
+			}
+			a = append(a, s)
+		}
+		*up = a
+	default:
+		return fmt.Errorf("unexpected type for `url_prefix`: %T; want string or list of strings", v)
+	}
+	return nil
+}
+
+// MarshalYAML implements yaml.Marshaler
+func (up URLPrefix) MarshalYAML() (interface{}, error) {
+	if len(up) == 1 {
+		return up[0], nil
+	}
+	return []string(up), nil
+}
+
+var _ yaml.Marshaler = URLPrefix{}
+
+// Supported load balancing policies for backends from `url_prefix` lists.
+const (
+	loadBalancingPolicyRoundRobin     = "round_robin"
+	loadBalancingPolicyLeastLoaded    = "least_loaded"
+	loadBalancingPolicyFirstAvailable = "first_available"
+)
+
+func validateLoadBalancingPolicy(policy string) error {
+	switch policy {
+	case "", loadBalancingPolicyRoundRobin, loadBalancingPolicyLeastLoaded, loadBalancingPolicyFirstAvailable:
+		return nil
+	default:
+		return fmt.Errorf("unsupported `load_balancing_policy: %q`; supported values: %s, %s, %s", policy,
+			loadBalancingPolicyRoundRobin, loadBalancingPolicyLeastLoaded, loadBalancingPolicyFirstAvailable)
+	}
+}
+
+// backendURL represents a single backend from `url_prefix`.
+//
+// backendURL objects are shared among all the users with the same backend,
+// so the backend health is tracked across users and config reloads.
+type backendURL struct {
+	// urlPrefix is sanitized url prefix for the backend.
+	urlPrefix string
+
+	// brokenDeadline is unix timestamp in seconds until the backend is considered broken.
+	brokenDeadline uint64
+
+	concurrentRequests int32
+
+	ejections *metrics.Counter
+}
+
+func (bu *backendURL) isBroken() bool {
+	return fasttime.UnixTimestamp() < atomic.LoadUint64(&bu.brokenDeadline)
+}
+
+func (bu *backendURL) setBroken(d time.Duration) {
+	if !bu.isBroken() {
+		bu.ejections.Inc()
+	}
+	atomic.StoreUint64(&bu.brokenDeadline, fasttime.UnixTimestamp()+uint64(d.Seconds()+1))
+}
+
+func (bu *backendURL) setHealthy() {
+	atomic.StoreUint64(&bu.brokenDeadline, 0)
+}
+
+func getBackendURL(urlPrefix string) *backendURL {
+	backendURLsLock.Lock()
+	defer backendURLsLock.Unlock()
+
+	bu := backendURLs[urlPrefix]
+	if bu == nil {
+		bu = &backendURL{
+			urlPrefix: urlPrefix,
+			ejections: metrics.GetOrCreateCounter(fmt.Sprintf(`vmauth_backend_ejections_total{backend=%q}`, urlPrefix)),
+		}
+		_ = metrics.GetOrCreateGauge(fmt.Sprintf(`vmauth_backend_up{backend=%q}`, urlPrefix), func() float64 {
+			if bu.isBroken() {
+				return 0
+			}
+			return 1
+		})
+		backendURLs[urlPrefix] = bu
+	}
+	return bu
+}
+
+var (
+	backendURLs     = make(map[string]*backendURL)
+	backendURLsLock sync.Mutex
+)
+
+// backendPool selects backends according to load balancing policy.
+type backendPool struct {
+	policy   string
+	backends []*backendURL
+
+	// n is used for round-robin selection of backends.
+	n uint32
+}
+
+func newBackendPool(up URLPrefix, policy string) *backendPool {
+	backends := make([]*backendURL, len(up))
+	for i, urlPrefix := range up {
+		backends[i] = getBackendURL(urlPrefix)
+	}
+	if policy == "" {
+		policy = loadBalancingPolicyRoundRobin
+	}
+	return &backendPool{
+		policy:   policy,
+		backends: backends,
+	}
+}
+
+// getBackendIndexes returns indexes for bp.backends in the order they must be tried for the next request.
+//
+// Healthy backends are returned first in the order defined by the load balancing policy.
+// Broken backends are returned at the end, so they are tried only if all the healthy backends fail.
+func (bp *backendPool) getBackendIndexes() []int {
+	backends := bp.backends
+	start := 0
+	if bp.policy != loadBalancingPolicyFirstAvailable && len(backends) > 1 {
+		start = int((atomic.AddUint32(&bp.n, 1) - 1) % uint32(len(backends)))
+	}
+	healthy := make([]int, 0, len(backends))
+	var broken []int
+	for i := range backends {
+		idx := (start + i) % len(backends)
+		if backends[idx].isBroken() {
+			broken = append(broken, idx)
+		} else {
+			healthy = append(healthy, idx)
+		}
+	}
+	if bp.policy == loadBalancingPolicyLeastLoaded && len(healthy) > 1 {
+		minIdx := 0
+		minLoad := atomic.LoadInt32(&backends[healthy[0]].concurrentRequests)
+		for i := 1; i < len(healthy); i++ {
+			if load := atomic.LoadInt32(&backends[healthy[i]].concurrentRequests); load < minLoad {
+				minIdx = i
+				minLoad = load
+			}
+		}
+		healthy[0], healthy[minIdx] = healthy[minIdx], healthy[0]
+	}
+	return append(healthy, broken...)
+}
+
+var healthCheckWG sync.WaitGroup
+
+func startHealthChecks() {
+	if *healthCheckInterval <= 0 {
+		return
+	}
+	healthCheckWG.Add(1)
+	go func() {
+		defer healthCheckWG.Done()
+		ticker := time.NewTicker(*healthCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+				checkBackendsHealth()
+			}
+		}
+	}()
+}
+
+func stopHealthChecks() {
+	healthCheckWG.Wait()
+}
+
+var healthCheckClient = &http.Client{
+	Timeout: *healthCheckTimeout,
+}
+
+// checkBackendsHealth checks the health of backends from `url_prefix` lists in the current config.
+//
+// Backends from `url_prefix` with a single url aren't checked, since there are no alternatives to them.
+func checkBackendsHealth() {
+	healthCheckClient.Timeout = *healthCheckTimeout
+	ac := authConfig.Load().(map[string]*UserInfo)
+	checked := make(map[*backendURL]bool)
+	var wg sync.WaitGroup
+	for _, bp := range getBackendPools(ac) {
+		if len(bp.backends) < 2 {
+			continue
+		}
+		for _, bu := range bp.backends {
+			if checked[bu] {
+				continue
+			}
+			checked[bu] = true
+			wg.Add(1)
+			go func(bu *backendURL) {
+				defer wg.Done()
+				if err := checkBackendHealth(bu); err != nil {
+					healthCheckErrors.Inc()
+					if !bu.isBroken() {
+						logger.Warnf("ejecting backend %q because of failed health check: %s", bu.urlPrefix, err)
+					}
+					bu.setBroken(*healthCheckInterval)
+					return
+				}
+				bu.setHealthy()
+			}(bu)
+		}
+	}
+	wg.Wait()
+}
+
+var healthCheckErrors = metrics.NewCounter(`vmauth_backend_health_check_errors_total`)
+
+func checkBackendHealth(bu *backendURL) error {
+	u, err := url.Parse(bu.urlPrefix)
+	if err != nil {
+		return fmt.Errorf("cannot parse %q: %w", bu.urlPrefix, err)
+	}
+	u.Path = *healthCheckPath
+	u.RawQuery = ""
+	resp, err := healthCheckClient.Get(u.String())
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code from %q: %d", u, resp.StatusCode)
+	}
+	return nil
+}
+
+func getBackendPools(ac map[string]*UserInfo) []*backendPool {
+	var bps []*backendPool
+	for _, ui := range ac {
+		if ui.defaultRoute != nil {
+			bps = append(bps, ui.defaultRoute.bp)
+		}
+		for _, e := range ui.URLMap {
+			for _, rt := range e.routes {
+				bps = append(bps, rt.bp)
+			}
+		}
+	}
+	return bps
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBackendPoolGetBackendIndexes(t *testing.T) {
+	f := func(bp *backendPool, expectedIdxs []int) {
+		t.Helper()
+		idxs := bp.getBackendIndexes()
+		if !reflect.DeepEqual(idxs, expectedIdxs) {
+			t.Fatalf("unexpected backend indexes; got %v; want %v", idxs, expectedIdxs)
+		}
+	}
+	up := URLPrefix{"http://lb-test-a", "http://lb-test-b", "http://lb-test-c"}
+
+	// round_robin
+	bp := newBackendPool(up, "")
+	f(bp, []int{0, 1, 2})
+	f(bp, []int{1, 2, 0})
+	f(bp, []int{2, 0, 1})
+	f(bp, []int{0, 1, 2})
+
+	// first_available
+	bp = newBackendPool(up, loadBalancingPolicyFirstAvailable)
+	f(bp, []int{0, 1, 2})
+	f(bp, []int{0, 1, 2})
+
+	// least_loaded
+	bp = newBackendPool(up, loadBalancingPolicyLeastLoaded)
+	atomic.AddInt32(&bp.backends[0].concurrentRequests, 2)
+	atomic.AddInt32(&bp.backends[1].concurrentRequests, 1)
+	f(bp, []int{2, 1, 0})
+	atomic.AddInt32(&bp.backends[0].concurrentRequests, -2)
+	atomic.AddInt32(&bp.backends[1].concurrentRequests, -1)
+
+	// Broken backends are returned at the end
+	bp = newBackendPool(up, loadBalancingPolicyFirstAvailable)
+	bp.backends[0].setBroken(time.Minute)
+	f(bp, []int{1, 2, 0})
+	bp.backends[0].setHealthy()
+	f(bp, []int{0, 1, 2})
+}
+
+func TestURLPrefixUnmarshal(t *testing.T) {
+	m, err := parseAuthConfig([]byte(`
+users:
+- username: foo
+  url_prefix:
+  - http://node1:8428/
+  - http://node2:8428
+  load_balancing_policy: least_loaded
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ui := m["foo"]
+	if !reflect.DeepEqual(ui.URLPrefix, URLPrefix{"http://node1:8428", "http://node2:8428"}) {
+		t.Fatalf("unexpected url_prefix: %q", ui.URLPrefix)
+	}
+	if len(ui.defaultRoute.bp.backends) != 2 || ui.defaultRoute.bp.policy != loadBalancingPolicyLeastLoaded {
+		t.Fatalf("unexpected backend pool: %+v", ui.defaultRoute.bp)
+	}
+
+	for _, s := range []string{
+		`
+users:
+- username: foo
+  url_prefix: []
+`,
+		`
+users:
+- username: foo
+  url_prefix: [123]
+`,
+		`
+users:
+- username: foo
+  url_prefix: [http://foo, ftp://bar]
+`,
+		`
+users:
+- username: foo
+  url_prefix: http://foo
+  load_balancing_policy: random
+`,
+	} {
+		if _, err := parseAuthConfig([]byte(s)); err == nil {
+			t.Fatalf("expecting non-nil error for config\n%s", s)
+		}
+	}
+}
+
+func TestProxyRequestRetry(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	// The first backend refuses connections
+	deadSrv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	deadURL := deadSrv.URL
+	deadSrv.Close()
+
+	ui := &UserInfo{
+		Username:            "retry-test",
+		URLPrefix:           URLPrefix{deadURL, srv.URL},
+		LoadBalancingPolicy: loadBalancingPolicyFirstAvailable,
+	}
+	ui.initRoutes()
+	targets, err := ui.defaultRoute.getTargets("/api/v1/query", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "http://vmauth/api/v1/query", nil)
+	w := httptest.NewRecorder()
+	proxyRequest(w, r, targets)
+	if w.Code != http.StatusOK || w.Body.String() != "ok" {
+		t.Fatalf("unexpected response; code=%d, body=%q", w.Code, w.Body.String())
+	}
+	if !targets[0].bu.isBroken() {
+		t.Fatalf("expecting the dead backend to be ejected")
+	}
+	if n := targets[1].rs.requests.Get(); n == 0 {
+		t.Fatalf("expecting non-zero requests for the healthy backend")
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"crypto/x509"
+	"net/http"
+)
+
+// getUserInfoFromClientCert returns user info for the verified client certificate from r.
+//
+// The user is matched by `client_cert_names` against certificate Subject Common Name
+// and Subject Alternative Names. nil is returned if no users match the certificate.
+func getUserInfoFromClientCert(ac map[string]*UserInfo, r *http.Request) *UserInfo {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	names := getClientCertNames(r.TLS.VerifiedChains[0][0])
+	// Names are checked in the order they appear in the certificate.
+	// Every name may belong to a single user, so the result is deterministic.
+	for _, name := range names {
+		for _, ui := range ac {
+			for _, certName := range ui.ClientCertNames {
+				if name == certName {
+					return ui
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func getClientCertNames(cert *x509.Certificate) []string {
+	var names []string
+	if len(cert.Subject.CommonName) > 0 {
+		names = append(names, cert.Subject.CommonName)
+	}
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	for _, u := range cert.URIs {
+		names = append(names, u.String())
+	}
+	return names
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestGetUserInfoFromClientCert(t *testing.T) {
+	m, err := parseAuthConfig([]byte(`
+users:
+- username: foo
+  url_prefix: http://foo
+  client_cert_names: ["foo.example.com"]
+- username: bar
+  url_prefix: http://bar
+  client_cert_names: ["spiffe://example.org/bar", "bar@example.com"]
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	f := func(cert *x509.Certificate, expectedUsername string) {
+		t.Helper()
+		r := &http.Request{}
+		if cert != nil {
+			r.TLS = &tls.ConnectionState{
+				VerifiedChains: [][]*x509.Certificate{{cert}},
+			}
+		}
+		ui := getUserInfoFromClientCert(m, r)
+		username := ""
+		if ui != nil {
+			username = ui.Username
+		}
+		if username != expectedUsername {
+			t.Fatalf("unexpected username; got %q; want %q", username, expectedUsername)
+		}
+	}
+	spiffeURL, err := url.Parse("spiffe://example.org/bar")
+	if err != nil {
+		t.Fatalf("cannot parse url: %s", err)
+	}
+
+	f(nil, "")
+	f(&x509.Certificate{Subject: pkix.Name{CommonName: "foo.example.com"}}, "foo")
+	f(&x509.Certificate{DNSNames: []string{"baz", "foo.example.com"}}, "foo")
+	f(&x509.Certificate{URIs: []*url.URL{spiffeURL}}, "bar")
+	f(&x509.Certificate{EmailAddresses: []string{"bar@example.com"}}, "bar")
+	f(&x509.Certificate{Subject: pkix.Name{CommonName: "unknown"}}, "")
+}
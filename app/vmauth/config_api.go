@@ -0,0 +1,185 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/metrics"
+	"gopkg.in/yaml.v2"
+)
+
+var configAPIAuthKey = flag.String("configAPIAuthKey", "", "Auth key for config API at /-/reload and /-/config/* pages. It must be passed via authKey query arg. "+
+	"The config API is disabled if the flag is empty. See https://victoriametrics.github.io/vmauth.html#config-api")
+
+// configAPIHandler serves config API requests.
+//
+// It returns false if r.URL.Path doesn't belong to config API.
+func configAPIHandler(w http.ResponseWriter, r *http.Request) bool {
+	path := r.URL.Path
+	if path != "/-/reload" && !strings.HasPrefix(path, "/-/config/") {
+		return false
+	}
+	configAPIRequests.Inc()
+	if len(*configAPIAuthKey) == 0 {
+		http.Error(w, "config API is disabled; it can be enabled with -configAPIAuthKey command-line flag", http.StatusForbidden)
+		return true
+	}
+	if r.FormValue("authKey") != *configAPIAuthKey {
+		http.Error(w, "The provided authKey doesn't match -configAPIAuthKey", http.StatusUnauthorized)
+		return true
+	}
+	if err := processConfigAPIRequest(w, r); err != nil {
+		configAPIErrors.Inc()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+	return true
+}
+
+// maxUserConfigSize is the maximum size of user config, which can be passed to config API.
+const maxUserConfigSize = 1024 * 1024
+
+var (
+	configAPIRequests = metrics.NewCounter(`vmauth_config_api_requests_total`)
+	configAPIErrors   = metrics.NewCounter(`vmauth_config_api_errors_total`)
+)
+
+func processConfigAPIRequest(w http.ResponseWriter, r *http.Request) error {
+	switch r.URL.Path {
+	case "/-/reload":
+		httpserver.LogAuditEvent(r, "config_reload", "")
+		if err := reloadAuthConfig(); err != nil {
+			return err
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	case "/-/config/users":
+		switch r.Method {
+		case http.MethodGet:
+			data, err := ioutil.ReadFile(*authConfigPath)
+			if err != nil {
+				return fmt.Errorf("cannot read -auth.config=%q: %w", *authConfigPath, err)
+			}
+			w.Header().Set("Content-Type", "application/yaml")
+			_, _ = w.Write(data)
+			return nil
+		case http.MethodPost, http.MethodPut:
+			data, err := ioutil.ReadAll(io.LimitReader(r.Body, maxUserConfigSize))
+			if err != nil {
+				return fmt.Errorf("cannot read request body: %w", err)
+			}
+			var ui UserInfo
+			if err := yaml.UnmarshalStrict(data, &ui); err != nil {
+				return fmt.Errorf("cannot parse user from request body: %w", err)
+			}
+			if err := updateAuthConfig(func(ac *AuthConfig) error {
+				return upsertUser(ac, &ui)
+			}); err != nil {
+				return err
+			}
+			httpserver.LogAuditEvent(r, "config_upsert_user", "username=%q", ui.Username)
+		case http.MethodDelete:
+			username := r.FormValue("username")
+			if err := updateAuthConfig(func(ac *AuthConfig) error {
+				return deleteUser(ac, username)
+			}); err != nil {
+				return err
+			}
+			httpserver.LogAuditEvent(r, "config_delete_user", "username=%q", username)
+		default:
+			return fmt.Errorf("unsupported method %q for %q; supported methods: GET, POST, PUT, DELETE", r.Method, r.URL.Path)
+		}
+	case "/-/config/users/enable", "/-/config/users/disable":
+		if r.Method != http.MethodPost {
+			return fmt.Errorf("unsupported method %q for %q; supported methods: POST", r.Method, r.URL.Path)
+		}
+		username := r.FormValue("username")
+		disabled := strings.HasSuffix(r.URL.Path, "/disable")
+		if err := updateAuthConfig(func(ac *AuthConfig) error {
+			return setUserDisabled(ac, username, disabled)
+		}); err != nil {
+			return err
+		}
+		httpserver.LogAuditEvent(r, "config_set_user_disabled", "username=%q, disabled=%v", username, disabled)
+	default:
+		return fmt.Errorf("unsupported path requested: %q", r.URL.Path)
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// updateAuthConfig applies f to -auth.config, validates the updated config,
+// atomically persists it to -auth.config file and then applies it.
+//
+// The config is read without substituting %{ENV_VAR} placeholders,
+// so they are preserved in the persisted config.
+func updateAuthConfig(f func(ac *AuthConfig) error) error {
+	authConfigUpdateLock.Lock()
+	defer authConfigUpdateLock.Unlock()
+
+	path := *authConfigPath
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("cannot read -auth.config=%q: %w", path, err)
+	}
+	var ac AuthConfig
+	if err := yaml.UnmarshalStrict(data, &ac); err != nil {
+		return fmt.Errorf("cannot parse -auth.config=%q: %w", path, err)
+	}
+	if err := f(&ac); err != nil {
+		return err
+	}
+	data, err = yaml.Marshal(&ac)
+	if err != nil {
+		return fmt.Errorf("cannot marshal updated auth config: %w", err)
+	}
+	m, err := parseAuthConfig(data)
+	if err != nil {
+		return fmt.Errorf("invalid auth config after the update: %w", err)
+	}
+	tmpPath := path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return fmt.Errorf("cannot write updated auth config to %q: %w", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("cannot move %q to %q: %w", tmpPath, path, err)
+	}
+	authConfig.Store(m)
+	return nil
+}
+
+func upsertUser(ac *AuthConfig, ui *UserInfo) error {
+	for i := range ac.Users {
+		if ac.Users[i].Username == ui.Username {
+			ac.Users[i] = *ui
+			return nil
+		}
+	}
+	ac.Users = append(ac.Users, *ui)
+	return nil
+}
+
+func deleteUser(ac *AuthConfig, username string) error {
+	for i := range ac.Users {
+		if ac.Users[i].Username == username {
+			ac.Users = append(ac.Users[:i], ac.Users[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot find username %q", username)
+}
+
+func setUserDisabled(ac *AuthConfig, username string, disabled bool) error {
+	for i := range ac.Users {
+		if ac.Users[i].Username == username {
+			ac.Users[i].Disabled = disabled
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot find username %q", username)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUpdateAuthConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vmauth-config-api")
+	if err != nil {
+		t.Fatalf("cannot create temporary dir: %s", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+	path := filepath.Join(dir, "auth.yml")
+	if err := ioutil.WriteFile(path, []byte(`
+users:
+- username: foo
+  password: "%{VMAUTH_TEST_PASSWORD}"
+  url_prefix: http://foo
+`), 0600); err != nil {
+		t.Fatalf("cannot write config: %s", err)
+	}
+	origPath := *authConfigPath
+	*authConfigPath = path
+	defer func() {
+		*authConfigPath = origPath
+	}()
+
+	// Add a user
+	if err := updateAuthConfig(func(ac *AuthConfig) error {
+		return upsertUser(ac, &UserInfo{
+			Username:  "bar",
+			URLPrefix: URLPrefix{"http://bar"},
+		})
+	}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	m := authConfig.Load().(map[string]*UserInfo)
+	if len(m) != 2 || m["bar"] == nil {
+		t.Fatalf("expecting users foo and bar; got %v", m)
+	}
+
+	// Disable the user
+	if err := updateAuthConfig(func(ac *AuthConfig) error {
+		return setUserDisabled(ac, "bar", true)
+	}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	m = authConfig.Load().(map[string]*UserInfo)
+	if !m["bar"].Disabled {
+		t.Fatalf("expecting disabled user bar")
+	}
+
+	// Invalid update must be rejected without changing the config
+	if err := updateAuthConfig(func(ac *AuthConfig) error {
+		return upsertUser(ac, &UserInfo{
+			Username:  "baz",
+			URLPrefix: URLPrefix{"ftp://baz"},
+		})
+	}); err == nil {
+		t.Fatalf("expecting non-nil error for invalid url_prefix")
+	}
+	if err := updateAuthConfig(func(ac *AuthConfig) error {
+		return deleteUser(ac, "missing")
+	}); err == nil {
+		t.Fatalf("expecting non-nil error when deleting missing user")
+	}
+
+	// Delete the user
+	if err := updateAuthConfig(func(ac *AuthConfig) error {
+		return deleteUser(ac, "bar")
+	}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	m = authConfig.Load().(map[string]*UserInfo)
+	if len(m) != 1 || m["foo"] == nil {
+		t.Fatalf("expecting a single user foo; got %v", m)
+	}
+
+	// Env var placeholders must be preserved in the persisted config
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("cannot read config: %s", err)
+	}
+	if !strings.Contains(string(data), "%{VMAUTH_TEST_PASSWORD}") {
+		t.Fatalf("missing env var placeholder in the persisted config:\n%s", data)
+	}
+	if strings.Contains(string(data), "baz") {
+		t.Fatalf("unexpected user baz in the persisted config:\n%s", data)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// IPFilters contains allow and deny lists of IP addresses and CIDR networks for a user.
+type IPFilters struct {
+	AllowList []string `yaml:"allow_list,omitempty"`
+	DenyList  []string `yaml:"deny_list,omitempty"`
+
+	allowNets []*net.IPNet
+	denyNets  []*net.IPNet
+}
+
+func (ipf *IPFilters) init() error {
+	allowNets, err := parseIPNets(ipf.AllowList)
+	if err != nil {
+		return fmt.Errorf("cannot parse `allow_list`: %w", err)
+	}
+	denyNets, err := parseIPNets(ipf.DenyList)
+	if err != nil {
+		return fmt.Errorf("cannot parse `deny_list`: %w", err)
+	}
+	ipf.allowNets = allowNets
+	ipf.denyNets = denyNets
+	return nil
+}
+
+// parseIPNets parses IP addresses and CIDR networks from a.
+func parseIPNets(a []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, s := range a {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("cannot parse IP address %q", s)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip = ip4
+				bits = 8 * net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{
+				IP:   ip,
+				Mask: net.CIDRMask(bits, bits),
+			})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse CIDR network %q: %w", s, err)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+// isAllowed returns true if ip is allowed by ipf.
+//
+// deny_list has priority over allow_list. All the IPs are allowed if allow_list is empty.
+func (ipf *IPFilters) isAllowed(ip net.IP) bool {
+	if ipf == nil {
+		return true
+	}
+	for _, n := range ipf.denyNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	if len(ipf.allowNets) == 0 {
+		return true
+	}
+	for _, n := range ipf.allowNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// getRemoteIP returns IP address of the client, which sent r.
+func getRemoteIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
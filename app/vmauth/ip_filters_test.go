@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIPFiltersIsAllowed(t *testing.T) {
+	f := func(ipf *IPFilters, ip string, expectedAllowed bool) {
+		t.Helper()
+		if err := ipf.init(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if allowed := ipf.isAllowed(net.ParseIP(ip)); allowed != expectedAllowed {
+			t.Fatalf("unexpected isAllowed(%q); got %v; want %v", ip, allowed, expectedAllowed)
+		}
+	}
+	// Empty filters
+	f(&IPFilters{}, "1.2.3.4", true)
+
+	// allow_list
+	ipf := &IPFilters{
+		AllowList: []string{"10.0.0.0/8", "192.168.1.1", "fe80::/10"},
+	}
+	f(ipf, "10.1.2.3", true)
+	f(ipf, "192.168.1.1", true)
+	f(ipf, "192.168.1.2", false)
+	f(ipf, "fe80::1", true)
+	f(ipf, "::1", false)
+
+	// deny_list has priority over allow_list
+	ipf = &IPFilters{
+		AllowList: []string{"10.0.0.0/8"},
+		DenyList:  []string{"10.0.0.0/24"},
+	}
+	f(ipf, "10.0.0.5", false)
+	f(ipf, "10.0.1.5", true)
+
+	// deny_list only
+	f(&IPFilters{DenyList: []string{"1.2.3.4"}}, "1.2.3.4", false)
+	f(&IPFilters{DenyList: []string{"1.2.3.4"}}, "1.2.3.5", true)
+}
+
+func TestIPFiltersInitFailure(t *testing.T) {
+	f := func(ipf *IPFilters) {
+		t.Helper()
+		if err := ipf.init(); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+	f(&IPFilters{AllowList: []string{"foobar"}})
+	f(&IPFilters{AllowList: []string{"1.2.3.4/33"}})
+	f(&IPFilters{DenyList: []string{"1.2.3"}})
+}
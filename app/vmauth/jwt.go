@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/jwt"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+var (
+	oidcIssuerURL = flag.String("oidc.issuerURL", "", "OIDC issuer URL for validating JWT bearer tokens. JWKS url is discovered via <issuerURL>/.well-known/openid-configuration "+
+		"unless -oidc.jwksURL is set. The `iss` claim in tokens must match the issuer URL. JWT validation is disabled if both -oidc.issuerURL and -oidc.jwksURL are empty. "+
+		"See https://victoriametrics.github.io/vmauth.html#jwt-authentication")
+	oidcJWKSURL       = flag.String("oidc.jwksURL", "", "Optional url for fetching JSON Web Key Set used for validating JWT bearer tokens. See also -oidc.issuerURL")
+	oidcAudience      = flag.String("oidc.audience", "", "Optional audience, which must be present in the `aud` claim of JWT bearer tokens")
+	oidcUsernameClaim = flag.String("oidc.usernameClaim", "sub", "JWT claim containing username from -auth.config. If the claim contains a list of strings such as `groups`, "+
+		"then the first item matching a username from -auth.config is used")
+	oidcTenantClaim         = flag.String("oidc.tenantClaim", "", "Optional JWT claim containing tenant id. The tenant id is substituted instead of {tenant} placeholder in `url_prefix`")
+	oidcJWKSRefreshInterval = flag.Duration("oidc.jwksRefreshInterval", time.Hour, "Interval for refreshing JSON Web Key Set from -oidc.jwksURL")
+)
+
+var jwtVerifierInstance *jwt.Verifier
+
+func initJWTVerifier() {
+	if len(*oidcIssuerURL) == 0 && len(*oidcJWKSURL) == 0 {
+		return
+	}
+	v, err := jwt.NewVerifier(&jwt.VerifierConfig{
+		Issuer:          *oidcIssuerURL,
+		JWKSURL:         *oidcJWKSURL,
+		Audience:        *oidcAudience,
+		RefreshInterval: *oidcJWKSRefreshInterval,
+	})
+	if err != nil {
+		logger.Fatalf("cannot initialize JWT verifier: %s", err)
+	}
+	jwtVerifierInstance = v
+}
+
+// getUserInfoFromJWT returns user info and tenant id for the given JWT token.
+func getUserInfoFromJWT(ac map[string]*UserInfo, token string) (*UserInfo, string, error) {
+	claims, err := jwtVerifierInstance.Verify(token, time.Now())
+	if err != nil {
+		return nil, "", err
+	}
+	return getUserInfoFromClaims(ac, claims, *oidcUsernameClaim, *oidcTenantClaim)
+}
+
+func getUserInfoFromClaims(ac map[string]*UserInfo, claims jwt.Claims, usernameClaim, tenantClaim string) (*UserInfo, string, error) {
+	var ui *UserInfo
+	for _, username := range claims.GetStrings(usernameClaim) {
+		if ui = ac[username]; ui != nil {
+			break
+		}
+	}
+	if ui == nil {
+		return nil, "", fmt.Errorf("cannot find username from %q claim in config", usernameClaim)
+	}
+	if len(tenantClaim) == 0 {
+		return ui, "", nil
+	}
+	tenant, err := claims.GetTenant(tenantClaim)
+	if err != nil {
+		return nil, "", err
+	}
+	return ui, tenant, nil
+}
+
+// tenantPlaceholder is substituted by tenant id from JWT in `url_prefix`.
+const tenantPlaceholder = "{tenant}"
+
+// substituteTenant substitutes tenantPlaceholder in targetURL for requests routed to backend.
+func substituteTenant(targetURL, backend, tenant string) (string, error) {
+	if !strings.Contains(backend, tenantPlaceholder) {
+		return targetURL, nil
+	}
+	if len(tenant) == 0 {
+		return "", fmt.Errorf("missing tenant for `url_prefix: %q`; the tenant must be passed via -oidc.tenantClaim claim in JWT", backend)
+	}
+	if !jwt.IsValidTenant(tenant) {
+		return "", fmt.Errorf("invalid tenant %q; it must be in the form `accountID` or `accountID:projectID`", tenant)
+	}
+	return strings.Replace(targetURL, tenantPlaceholder, tenant, 1), nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/jwt"
+)
+
+func TestGetUserInfoFromClaims(t *testing.T) {
+	ac := map[string]*UserInfo{
+		"alice":  {Username: "alice"},
+		"team-a": {Username: "team-a"},
+	}
+	claims := jwt.Claims{
+		"sub":    "alice",
+		"groups": []interface{}{"foo", "team-a"},
+		"tenant": "42",
+	}
+	f := func(usernameClaim, tenantClaim, expectedUsername, expectedTenant string) {
+		t.Helper()
+		ui, tenant, err := getUserInfoFromClaims(ac, claims, usernameClaim, tenantClaim)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if ui.Username != expectedUsername {
+			t.Fatalf("unexpected username; got %q; want %q", ui.Username, expectedUsername)
+		}
+		if tenant != expectedTenant {
+			t.Fatalf("unexpected tenant; got %q; want %q", tenant, expectedTenant)
+		}
+	}
+	f("sub", "", "alice", "")
+	f("groups", "tenant", "team-a", "42")
+
+	if _, _, err := getUserInfoFromClaims(ac, claims, "missing", ""); err == nil {
+		t.Fatalf("expecting non-nil error for missing username claim")
+	}
+	if _, _, err := getUserInfoFromClaims(ac, claims, "sub", "groups"); err == nil {
+		t.Fatalf("expecting non-nil error for multiple tenants")
+	}
+	if _, _, err := getUserInfoFromClaims(ac, claims, "sub", "sub"); err == nil {
+		t.Fatalf("expecting non-nil error for invalid tenant")
+	}
+}
+
+func TestSubstituteTenant(t *testing.T) {
+	f := func(targetURL, backend, tenant, expectedURL string) {
+		t.Helper()
+		u, err := substituteTenant(targetURL, backend, tenant)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if u != expectedURL {
+			t.Fatalf("unexpected url; got %q; want %q", u, expectedURL)
+		}
+	}
+	f("http://vmselect/api/v1/query", "http://vmselect", "", "http://vmselect/api/v1/query")
+	f("http://vmselect/select/{tenant}/prometheus/api/v1/query", "http://vmselect/select/{tenant}/prometheus", "42", "http://vmselect/select/42/prometheus/api/v1/query")
+	f("http://vmselect/select/{tenant}/prometheus/api/v1/query", "http://vmselect/select/{tenant}/prometheus", "42:3", "http://vmselect/select/42:3/prometheus/api/v1/query")
+
+	for _, tenant := range []string{"", "foo", "../1", "1:2:3"} {
+		if _, err := substituteTenant("http://vmselect/select/{tenant}/api/v1/query", "http://vmselect/select/{tenant}", tenant); err == nil {
+			t.Fatalf("expecting non-nil error for tenant %q", tenant)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// userLimits limits the number of concurrent requests and the request rate for a single user.
+type userLimits struct {
+	concurrencyLimitCh chan struct{}
+	rl                 *rateLimiter
+
+	concurrencyLimitReached *metrics.Counter
+	rateLimitReached        *metrics.Counter
+}
+
+// newUserLimits returns limits for ui and the given tenant.
+//
+// nil is returned if ui has no limits.
+func newUserLimits(ui *UserInfo, tenant string) *userLimits {
+	if ui.MaxConcurrentRequests <= 0 && ui.RequestsPerSecond <= 0 {
+		return nil
+	}
+	var ul userLimits
+	if ui.MaxConcurrentRequests > 0 {
+		ul.concurrencyLimitCh = make(chan struct{}, ui.MaxConcurrentRequests)
+	}
+	if ui.RequestsPerSecond > 0 {
+		ul.rl = newRateLimiter(ui.RequestsPerSecond, ui.RequestsBurst)
+	}
+	labels := fmt.Sprintf(`username=%q`, ui.Username)
+	if len(tenant) > 0 {
+		labels += fmt.Sprintf(`,tenant=%q`, tenant)
+	}
+	ul.concurrencyLimitReached = metrics.GetOrCreateCounter(fmt.Sprintf(`vmauth_user_concurrent_requests_limit_reached_total{%s}`, labels))
+	ul.rateLimitReached = metrics.GetOrCreateCounter(fmt.Sprintf(`vmauth_user_rate_limit_reached_total{%s}`, labels))
+	return &ul
+}
+
+// tenantLimits holds per-tenant limits for a single user.
+type tenantLimits struct {
+	mu sync.Mutex
+	m  map[string]*userLimits
+}
+
+// getLimits returns limits for requests from ui with the given tenant.
+//
+// Users authenticated via JWT with -oidc.tenantClaim have distinct limits per each tenant,
+// so a single tenant cannot exhaust the limits for other tenants mapped to the same user.
+func (ui *UserInfo) getLimits(tenant string) *userLimits {
+	if len(tenant) == 0 || ui.limits == nil {
+		return ui.limits
+	}
+	tl := ui.tenantLimits
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	ul := tl.m[tenant]
+	if ul == nil {
+		ul = newUserLimits(ui, tenant)
+		tl.m[tenant] = ul
+	}
+	return ul
+}
+
+// beginRequest must be called before proxying the request.
+//
+// It returns non-nil error if the request must be rejected.
+// endRequest must be called after the request is proxied if beginRequest returns nil error.
+func (ul *userLimits) beginRequest() error {
+	if ul == nil {
+		return nil
+	}
+	if ul.rl != nil && !ul.rl.allow(time.Now()) {
+		ul.rateLimitReached.Inc()
+		return fmt.Errorf("rate limit of %.3f requests per second is exceeded", ul.rl.perSecond)
+	}
+	if ul.concurrencyLimitCh != nil {
+		select {
+		case ul.concurrencyLimitCh <- struct{}{}:
+		default:
+			ul.concurrencyLimitReached.Inc()
+			return fmt.Errorf("the number of concurrent requests exceeds %d", cap(ul.concurrencyLimitCh))
+		}
+	}
+	return nil
+}
+
+func (ul *userLimits) endRequest() {
+	if ul == nil || ul.concurrencyLimitCh == nil {
+		return
+	}
+	<-ul.concurrencyLimitCh
+}
+
+// rateLimiter implements token bucket algorithm.
+type rateLimiter struct {
+	perSecond float64
+	burst     float64
+
+	mu             sync.Mutex
+	tokens         float64
+	lastUpdateTime time.Time
+}
+
+func newRateLimiter(perSecond float64, burst int) *rateLimiter {
+	if burst <= 0 {
+		burst = 1
+	}
+	return &rateLimiter{
+		perSecond: perSecond,
+		burst:     float64(burst),
+		tokens:    float64(burst),
+	}
+}
+
+// allow returns true if the request at currentTime fits the rate limit.
+func (rl *rateLimiter) allow(currentTime time.Time) bool {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if !rl.lastUpdateTime.IsZero() {
+		d := currentTime.Sub(rl.lastUpdateTime).Seconds()
+		if d > 0 {
+			rl.tokens += d * rl.perSecond
+			if rl.tokens > rl.burst {
+				rl.tokens = rl.burst
+			}
+		}
+	}
+	rl.lastUpdateTime = currentTime
+	if rl.tokens < 1 {
+		return false
+	}
+	rl.tokens--
+	return true
+}
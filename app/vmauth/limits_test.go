@@ -0,0 +1,97 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	rl := newRateLimiter(2, 3)
+	f := func(offset time.Duration, expectedAllow bool) {
+		t.Helper()
+		currentTime := time.Unix(1000, 0).Add(offset)
+		if allow := rl.allow(currentTime); allow != expectedAllow {
+			t.Fatalf("unexpected allow at %s; got %v; want %v", offset, allow, expectedAllow)
+		}
+	}
+	// The burst is available from the start
+	f(0, true)
+	f(0, true)
+	f(0, true)
+	f(0, false)
+
+	// A single token is added every 500ms
+	f(400*time.Millisecond, false)
+	f(500*time.Millisecond, true)
+	f(500*time.Millisecond, false)
+
+	// The number of tokens cannot exceed the burst
+	f(time.Hour, true)
+	f(time.Hour, true)
+	f(time.Hour, true)
+	f(time.Hour, false)
+}
+
+func TestUserLimitsConcurrency(t *testing.T) {
+	ul := newUserLimits(&UserInfo{
+		Username:              "foo",
+		MaxConcurrentRequests: 2,
+	}, "")
+	for i := 0; i < 2; i++ {
+		if err := ul.beginRequest(); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	}
+	if err := ul.beginRequest(); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+	ul.endRequest()
+	if err := ul.beginRequest(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestUserLimitsNoLimits(t *testing.T) {
+	ul := newUserLimits(&UserInfo{
+		Username: "foo",
+	}, "")
+	if ul != nil {
+		t.Fatalf("expecting nil limits for user without limits")
+	}
+	if err := ul.beginRequest(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ul.endRequest()
+}
+
+func TestUserInfoGetLimitsPerTenant(t *testing.T) {
+	ui := &UserInfo{
+		Username:              "foo",
+		MaxConcurrentRequests: 1,
+	}
+	ui.limits = newUserLimits(ui, "")
+	ui.tenantLimits = &tenantLimits{
+		m: make(map[string]*userLimits),
+	}
+	if err := ui.getLimits("").beginRequest(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := ui.getLimits("").beginRequest(); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+
+	// Limits for tenants are independent of each other and of limits for requests without tenant
+	if err := ui.getLimits("42").beginRequest(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := ui.getLimits("42").beginRequest(); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+	if err := ui.getLimits("42:1").beginRequest(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ui.getLimits("42").endRequest()
+	if err := ui.getLimits("42").beginRequest(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
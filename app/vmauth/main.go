@@ -2,10 +2,10 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"net/http"
-	"net/http/httputil"
-	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/buildinfo"
@@ -14,10 +14,12 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/procutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/pushmetrics"
 )
 
 var (
 	httpListenAddr = flag.String("httpListenAddr", ":8427", "TCP address to listen for http connections")
+	statsAuthKey   = flag.String("statsAuthKey", "", "Auth key for /-/stats page. It must be passed via authKey query arg. The page is available without auth if the flag is empty")
 )
 
 func main() {
@@ -29,12 +31,17 @@ func main() {
 	logger.Init()
 	logger.Infof("starting vmauth at %q...", *httpListenAddr)
 	startTime := time.Now()
+	pushmetrics.Init()
 	initAuthConfig()
+	initJWTVerifier()
+	startHealthChecks()
+	initResponseCache()
 	go httpserver.Serve(*httpListenAddr, requestHandler)
 	logger.Infof("started vmauth in %.3f seconds", time.Since(startTime).Seconds())
 
 	sig := procutil.WaitForSigterm()
 	logger.Infof("received signal %s", sig)
+	pushmetrics.Stop()
 
 	startTime = time.Now()
 	logger.Infof("gracefully shutting down webservice at %q", *httpListenAddr)
@@ -43,56 +50,97 @@ func main() {
 	}
 	logger.Infof("successfully shut down the webservice in %.3f seconds", time.Since(startTime).Seconds())
 	stopAuthConfig()
+	stopHealthChecks()
 	logger.Infof("successfully stopped vmauth in %.3f seconds", time.Since(startTime).Seconds())
 }
 
 func requestHandler(w http.ResponseWriter, r *http.Request) bool {
-	username, password, ok := r.BasicAuth()
-	if !ok {
-		w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
-		http.Error(w, "missing `Authorization: Basic *` header", http.StatusUnauthorized)
+	if r.URL.Path == "/-/stats" {
+		if len(*statsAuthKey) > 0 && r.FormValue("authKey") != *statsAuthKey {
+			http.Error(w, "The provided authKey doesn't match -statsAuthKey", http.StatusUnauthorized)
+			return true
+		}
+		statsHandler(w)
+		return true
+	}
+	if configAPIHandler(w, r) {
 		return true
 	}
 	ac := authConfig.Load().(map[string]*UserInfo)
-	ui := ac[username]
-	if ui == nil || ui.Password != password {
-		httpserver.Errorf(w, r, "cannot find the provided username %q or password in config", username)
+	ui, tenant, err := getUserInfo(ac, r)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Basic realm="Restricted"`)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return true
+	}
+	if !ui.IPFilters.isAllowed(getRemoteIP(r)) {
+		http.Error(w, fmt.Sprintf("access for username %q is denied from %s", ui.Username, r.RemoteAddr), http.StatusForbidden)
+		return true
+	}
+	if ui.Disabled {
+		http.Error(w, fmt.Sprintf("username %q is disabled", ui.Username), http.StatusForbidden)
 		return true
 	}
 	ui.requests.Inc()
-	targetURL, err := createTargetURL(ui, r.URL)
+	// Apply limits before serving the response from cache, so the cache cannot be used for bypassing the limits.
+	ul := ui.getLimits(tenant)
+	if err := ul.beginRequest(); err != nil {
+		http.Error(w, fmt.Sprintf("too many requests for username %q: %s", ui.Username, err), http.StatusTooManyRequests)
+		return true
+	}
+	defer ul.endRequest()
+	cacheKey := getResponseCacheKey(ui, r, tenant)
+	if len(cacheKey) > 0 {
+		if writeCachedResponse(w, cacheKey) {
+			return true
+		}
+		crw := &cachingResponseWriter{
+			ResponseWriter: w,
+		}
+		defer crw.storeResponse(cacheKey)
+		w = crw
+	}
+	rt, requestURI, err := createTargetURL(ui, r.URL)
 	if err != nil {
 		httpserver.Errorf(w, r, "cannot determine targetURL: %s", err)
 		return true
 	}
-	if _, err := url.Parse(targetURL); err != nil {
-		httpserver.Errorf(w, r, "invalid targetURL=%q: %s", targetURL, err)
+	targets, err := rt.getTargets(requestURI, tenant)
+	if err != nil {
+		httpserver.Errorf(w, r, "cannot determine targetURL: %s", err)
 		return true
 	}
-	r.Header.Set("vm-target-url", targetURL)
-	reverseProxy.ServeHTTP(w, r)
+	// Pass the authenticated username to backends, so they could log it in audit log.
+	// This also overrides the header value passed by the client.
+	r.Header.Set(httpserver.VMAuthUserHeader, ui.Username)
+	proxyRequest(w, r, targets)
 	return true
 }
 
-var reverseProxy = &httputil.ReverseProxy{
-	Director: func(r *http.Request) {
-		targetURL := r.Header.Get("vm-target-url")
-		target, err := url.Parse(targetURL)
+// getUserInfo returns user info and tenant id for r.
+//
+// The user is authenticated either via Basic Auth or via JWT bearer token if -oidc.* flags are set.
+func getUserInfo(ac map[string]*UserInfo, r *http.Request) (*UserInfo, string, error) {
+	authHeader := r.Header.Get("Authorization")
+	if jwtVerifierInstance != nil && strings.HasPrefix(authHeader, "Bearer ") {
+		ui, tenant, err := getUserInfoFromJWT(ac, authHeader[len("Bearer "):])
 		if err != nil {
-			logger.Panicf("BUG: unexpected error when parsing targetURL=%q: %s", targetURL, err)
+			return nil, "", fmt.Errorf("cannot authenticate JWT: %w", err)
+		}
+		return ui, tenant, nil
+	}
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		if ui := getUserInfoFromClientCert(ac, r); ui != nil {
+			return ui, "", nil
 		}
-		r.URL = target
-	},
-	Transport: func() *http.Transport {
-		tr := http.DefaultTransport.(*http.Transport).Clone()
-		// Automatic compression must be disabled in order to fix https://github.com/VictoriaMetrics/VictoriaMetrics/issues/535
-		tr.DisableCompression = true
-		// Disable HTTP/2.0, since VictoriaMetrics components don't support HTTP/2.0 (because there is no sense in this).
-		tr.ForceAttemptHTTP2 = false
-		return tr
-	}(),
-	FlushInterval: time.Second,
-	ErrorLog:      logger.StdErrorLogger(),
+		return nil, "", fmt.Errorf("missing `Authorization: Basic *` header")
+	}
+	ui := ac[username]
+	if ui == nil || ui.Password != password {
+		return nil, "", fmt.Errorf("cannot find the provided username %q or password in config", username)
+	}
+	return ui, "", nil
 }
 
 func usage() {
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// proxyState holds the state of a single proxied request.
+type proxyState struct {
+	targets []*proxyTarget
+
+	// idx is the index of the currently used target.
+	idx int
+
+	readBytes    int
+	writtenBytes int
+	statusCode   int
+}
+
+type proxyStateKeyType struct{}
+
+var proxyStateKey proxyStateKeyType
+
+// proxyRequest proxies r to targets and updates stats for the used target.
+//
+// The next target is tried on connection errors if the request can be safely retried.
+func proxyRequest(w http.ResponseWriter, r *http.Request, targets []*proxyTarget) {
+	startTime := time.Now()
+	ps := &proxyState{
+		targets: targets,
+	}
+	if r.Body != nil {
+		r.Body = &statsReadCloser{
+			ReadCloser: r.Body,
+			ps:         ps,
+		}
+	}
+	sw := &statsResponseWriter{
+		ResponseWriter: w,
+		ps:             ps,
+	}
+	bu := targets[0].bu
+	atomic.AddInt32(&bu.concurrentRequests, 1)
+	r = r.WithContext(context.WithValue(r.Context(), proxyStateKey, ps))
+	r.Header.Set("vm-target-url", targets[0].url)
+	reverseProxy.ServeHTTP(sw, r)
+
+	t := targets[ps.idx]
+	atomic.AddInt32(&t.bu.concurrentRequests, -1)
+	rs := t.rs
+	rs.requests.Inc()
+	if ps.statusCode >= 400 {
+		rs.requestErrors.Inc()
+	}
+	rs.readBytes.Add(ps.readBytes)
+	rs.writtenBytes.Add(ps.writtenBytes)
+	d := time.Since(startTime).Seconds()
+	rs.requestDuration.Add(d)
+	rs.requestLatency.Update(d)
+}
+
+type statsReadCloser struct {
+	io.ReadCloser
+	ps *proxyState
+}
+
+func (src *statsReadCloser) Read(p []byte) (int, error) {
+	n, err := src.ReadCloser.Read(p)
+	src.ps.readBytes += n
+	return n, err
+}
+
+type statsResponseWriter struct {
+	http.ResponseWriter
+	ps *proxyState
+}
+
+func (srw *statsResponseWriter) WriteHeader(statusCode int) {
+	srw.ps.statusCode = statusCode
+	srw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (srw *statsResponseWriter) Write(p []byte) (int, error) {
+	if srw.ps.statusCode == 0 {
+		srw.ps.statusCode = http.StatusOK
+	}
+	n, err := srw.ResponseWriter.Write(p)
+	srw.ps.writtenBytes += n
+	return n, err
+}
+
+// Flush implements http.Flusher, which is used by reverseProxy for periodic flushing of responses.
+func (srw *statsResponseWriter) Flush() {
+	if fw, ok := srw.ResponseWriter.(http.Flusher); ok {
+		fw.Flush()
+	}
+}
+
+// retryTransport retries requests on the next targets from proxyState on connection errors.
+type retryTransport struct {
+	tr http.RoundTripper
+}
+
+func (rt *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := rt.tr.RoundTrip(req)
+	ps, ok := req.Context().Value(proxyStateKey).(*proxyState)
+	if !ok {
+		return resp, err
+	}
+	for err != nil && req.Context().Err() == nil {
+		t := ps.targets[ps.idx]
+		t.bu.setBroken(*ejectDuration)
+		if ps.idx+1 >= len(ps.targets) || !canRetryRequest(req) {
+			break
+		}
+		logger.Warnf("cannot proxy request to %q: %s; retrying the request at the next backend", t.bu.urlPrefix, err)
+		proxyRetries.Inc()
+		atomic.AddInt32(&t.bu.concurrentRequests, -1)
+		ps.idx++
+		t = ps.targets[ps.idx]
+		atomic.AddInt32(&t.bu.concurrentRequests, 1)
+		u, errParse := url.Parse(t.url)
+		if errParse != nil {
+			logger.Panicf("BUG: unexpected error when parsing targetURL=%q: %s", t.url, errParse)
+		}
+		req.URL = u
+		req.Host = ""
+		resp, err = rt.tr.RoundTrip(req)
+	}
+	return resp, err
+}
+
+var proxyRetries = metrics.NewCounter(`vmauth_backend_retries_total`)
+
+// canRetryRequest returns true if req has no body, so it can be safely sent to another backend.
+func canRetryRequest(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody
+}
+
+var reverseProxy = &httputil.ReverseProxy{
+	Director: func(r *http.Request) {
+		targetURL := r.Header.Get("vm-target-url")
+		target, err := url.Parse(targetURL)
+		if err != nil {
+			logger.Panicf("BUG: unexpected error when parsing targetURL=%q: %s", targetURL, err)
+		}
+		r.URL = target
+	},
+	Transport: &retryTransport{
+		tr: func() *http.Transport {
+			tr := http.DefaultTransport.(*http.Transport).Clone()
+			// Automatic compression must be disabled in order to fix https://github.com/VictoriaMetrics/VictoriaMetrics/issues/535
+			tr.DisableCompression = true
+			// Disable HTTP/2.0, since VictoriaMetrics components don't support HTTP/2.0 (because there is no sense in this).
+			tr.ForceAttemptHTTP2 = false
+			return tr
+		}(),
+	},
+	FlushInterval: time.Second,
+	ErrorLog:      logger.StdErrorLogger(),
+}
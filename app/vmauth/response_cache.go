@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/fastcache"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	responseCacheSize = flagutil.NewBytes("responseCache.size", 0, "The maximum size of in-memory cache for responses from idempotent query endpoints. "+
+		"The cache is disabled by default. See https://victoriametrics.github.io/vmauth.html#response-cache")
+	responseCacheTTL             = flag.Duration("responseCache.ttl", 10*time.Second, "Time to live for responses in the cache. See -responseCache.size")
+	responseCacheMaxResponseSize = flagutil.NewBytes("responseCache.maxResponseSize", 1024*1024, "The maximum size of a single response, which may be cached. See -responseCache.size")
+	responseCachePaths           = flagutil.NewArray("responseCache.path", "Path for GET requests, which may be cached. By default /api/v1/query_range responses are cached. See -responseCache.size")
+)
+
+var responseCache *fastcache.Cache
+
+func initResponseCache() {
+	if responseCacheSize.N <= 0 {
+		return
+	}
+	responseCache = fastcache.New(responseCacheSize.N)
+	metrics.NewGauge(`vmauth_response_cache_size_bytes`, func() float64 {
+		var s fastcache.Stats
+		responseCache.UpdateStats(&s)
+		return float64(s.BytesSize)
+	})
+	metrics.NewGauge(`vmauth_response_cache_entries`, func() float64 {
+		var s fastcache.Stats
+		responseCache.UpdateStats(&s)
+		return float64(s.EntriesCount)
+	})
+}
+
+var (
+	responseCacheHits   = metrics.NewCounter(`vmauth_response_cache_hits_total`)
+	responseCacheMisses = metrics.NewCounter(`vmauth_response_cache_misses_total`)
+)
+
+func isCacheablePath(path string) bool {
+	if len(*responseCachePaths) == 0 {
+		return path == "/api/v1/query_range"
+	}
+	for _, p := range *responseCachePaths {
+		if path == p {
+			return true
+		}
+	}
+	return false
+}
+
+// getResponseCacheKey returns cache key for r sent by ui.
+//
+// Empty key is returned if the response for r cannot be cached.
+func getResponseCacheKey(ui *UserInfo, r *http.Request, tenant string) []byte {
+	if responseCache == nil || r.Method != http.MethodGet || !isCacheablePath(r.URL.Path) {
+		return nil
+	}
+	if r.Header.Get("Cache-Control") == "no-cache" {
+		return nil
+	}
+	var key []byte
+	key = encoding.MarshalBytes(key, []byte(ui.Username))
+	key = encoding.MarshalBytes(key, []byte(tenant))
+	key = encoding.MarshalBytes(key, []byte(r.Header.Get("Accept-Encoding")))
+	key = append(key, r.URL.RequestURI()...)
+	return key
+}
+
+// cachedResponse is a response stored in responseCache.
+type cachedResponse struct {
+	deadline        uint64
+	contentType     string
+	contentEncoding string
+	body            []byte
+}
+
+func (cr *cachedResponse) marshal(dst []byte) []byte {
+	dst = encoding.MarshalUint64(dst, cr.deadline)
+	dst = encoding.MarshalBytes(dst, []byte(cr.contentType))
+	dst = encoding.MarshalBytes(dst, []byte(cr.contentEncoding))
+	dst = append(dst, cr.body...)
+	return dst
+}
+
+func (cr *cachedResponse) unmarshal(src []byte) error {
+	if len(src) < 8 {
+		return fmt.Errorf("too short cached response; got %d bytes; want at least 8 bytes", len(src))
+	}
+	cr.deadline = encoding.UnmarshalUint64(src)
+	src = src[8:]
+	tail, ct, err := encoding.UnmarshalBytes(src)
+	if err != nil {
+		return fmt.Errorf("cannot unmarshal content type: %w", err)
+	}
+	cr.contentType = string(ct)
+	tail, ce, err := encoding.UnmarshalBytes(tail)
+	if err != nil {
+		return fmt.Errorf("cannot unmarshal content encoding: %w", err)
+	}
+	cr.contentEncoding = string(ce)
+	cr.body = tail
+	return nil
+}
+
+// writeCachedResponse writes the cached response for key to w.
+//
+// It returns false if there is no valid cached response for the key.
+func writeCachedResponse(w http.ResponseWriter, key []byte) bool {
+	data := responseCache.GetBig(nil, key)
+	if len(data) == 0 {
+		responseCacheMisses.Inc()
+		return false
+	}
+	var cr cachedResponse
+	if err := cr.unmarshal(data); err != nil || uint64(time.Now().UnixNano()) > cr.deadline {
+		responseCacheMisses.Inc()
+		return false
+	}
+	responseCacheHits.Inc()
+	h := w.Header()
+	if len(cr.contentType) > 0 {
+		h.Set("Content-Type", cr.contentType)
+	}
+	if len(cr.contentEncoding) > 0 {
+		h.Set("Content-Encoding", cr.contentEncoding)
+	}
+	h.Set("X-Vmauth-Cache", "hit")
+	_, _ = w.Write(cr.body)
+	return true
+}
+
+// cachingResponseWriter captures successful responses for storing them in responseCache.
+type cachingResponseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	buf        bytes.Buffer
+	overflow   bool
+}
+
+func (crw *cachingResponseWriter) WriteHeader(statusCode int) {
+	crw.statusCode = statusCode
+	crw.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (crw *cachingResponseWriter) Write(p []byte) (int, error) {
+	if crw.statusCode == 0 {
+		crw.statusCode = http.StatusOK
+	}
+	if !crw.overflow {
+		if crw.buf.Len()+len(p) > responseCacheMaxResponseSize.N {
+			crw.overflow = true
+			crw.buf.Reset()
+		} else {
+			crw.buf.Write(p)
+		}
+	}
+	return crw.ResponseWriter.Write(p)
+}
+
+// Flush implements http.Flusher
+func (crw *cachingResponseWriter) Flush() {
+	if fw, ok := crw.ResponseWriter.(http.Flusher); ok {
+		fw.Flush()
+	}
+}
+
+// storeResponse stores the response captured by crw under the given key.
+func (crw *cachingResponseWriter) storeResponse(key []byte) {
+	if crw.overflow || crw.statusCode != http.StatusOK {
+		return
+	}
+	h := crw.Header()
+	cr := &cachedResponse{
+		deadline:        uint64(time.Now().Add(*responseCacheTTL).UnixNano()),
+		contentType:     h.Get("Content-Type"),
+		contentEncoding: h.Get("Content-Encoding"),
+		body:            crw.buf.Bytes(),
+	}
+	responseCache.SetBig(key, cr.marshal(nil))
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/VictoriaMetrics/fastcache"
+)
+
+func TestCachedResponseMarshalUnmarshal(t *testing.T) {
+	cr := &cachedResponse{
+		deadline:        12345,
+		contentType:     "application/json",
+		contentEncoding: "gzip",
+		body:            []byte(`{"status":"success"}`),
+	}
+	data := cr.marshal(nil)
+	var cr2 cachedResponse
+	if err := cr2.unmarshal(data); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !reflect.DeepEqual(cr, &cr2) {
+		t.Fatalf("unexpected unmarshaled response; got\n%+v\nwant\n%+v", &cr2, cr)
+	}
+	if err := cr2.unmarshal(data[:5]); err == nil {
+		t.Fatalf("expecting non-nil error for too short data")
+	}
+}
+
+func TestResponseCache(t *testing.T) {
+	responseCache = fastcache.New(1024 * 1024)
+	defer func() {
+		responseCache = nil
+	}()
+	ui := &UserInfo{
+		Username: "foo",
+	}
+
+	// Non-cacheable requests
+	r := httptest.NewRequest(http.MethodGet, "http://vmauth/api/v1/query?query=up", nil)
+	if key := getResponseCacheKey(ui, r, ""); len(key) > 0 {
+		t.Fatalf("unexpected cache key for %q", r.URL)
+	}
+	r = httptest.NewRequest(http.MethodPost, "http://vmauth/api/v1/query_range?query=up", nil)
+	if key := getResponseCacheKey(ui, r, ""); len(key) > 0 {
+		t.Fatalf("unexpected cache key for POST request")
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "http://vmauth/api/v1/query_range?query=up&start=1&end=2", nil)
+	key := getResponseCacheKey(ui, r, "")
+	if len(key) == 0 {
+		t.Fatalf("expecting non-empty cache key for %q", r.URL)
+	}
+	w := httptest.NewRecorder()
+	if writeCachedResponse(w, key) {
+		t.Fatalf("unexpected cache hit for empty cache")
+	}
+
+	// Store the response
+	crw := &cachingResponseWriter{
+		ResponseWriter: w,
+	}
+	crw.Header().Set("Content-Type", "application/json")
+	_, _ = crw.Write([]byte(`{"status":"success"}`))
+	crw.storeResponse(key)
+
+	w = httptest.NewRecorder()
+	if !writeCachedResponse(w, key) {
+		t.Fatalf("expecting cache hit")
+	}
+	if w.Body.String() != `{"status":"success"}` || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected cached response; body=%q, headers=%v", w.Body.String(), w.Header())
+	}
+
+	// Other users must not get the cached response
+	key = getResponseCacheKey(&UserInfo{Username: "bar"}, r, "")
+	if writeCachedResponse(httptest.NewRecorder(), key) {
+		t.Fatalf("unexpected cache hit for another user")
+	}
+
+	// Error responses aren't cached
+	crw = &cachingResponseWriter{
+		ResponseWriter: httptest.NewRecorder(),
+	}
+	crw.WriteHeader(http.StatusBadGateway)
+	_, _ = crw.Write([]byte("error"))
+	crw.storeResponse(key)
+	if writeCachedResponse(httptest.NewRecorder(), key) {
+		t.Fatalf("unexpected cache hit for error response")
+	}
+}
+
+func TestRequestHandlerCachedResponseLimits(t *testing.T) {
+	responseCache = fastcache.New(1024 * 1024)
+	defer func() {
+		responseCache = nil
+	}()
+	m, err := parseAuthConfig([]byte(`
+users:
+- username: foo
+  password: bar
+  url_prefix: http://backend
+  max_concurrent_requests: 1
+`))
+	if err != nil {
+		t.Fatalf("cannot parse auth config: %s", err)
+	}
+	origAuthConfig := authConfig.Load()
+	authConfig.Store(m)
+	defer authConfig.Store(origAuthConfig)
+
+	newRequest := func() *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "http://vmauth/api/v1/query_range?query=up&start=1&end=2", nil)
+		r.SetBasicAuth("foo", "bar")
+		return r
+	}
+	ui := m["foo"]
+	crw := &cachingResponseWriter{
+		ResponseWriter: httptest.NewRecorder(),
+	}
+	_, _ = crw.Write([]byte(`{"status":"success"}`))
+	crw.storeResponse(getResponseCacheKey(ui, newRequest(), ""))
+
+	// Cached response mustn't be returned if the user exceeds the limits.
+	ul := ui.getLimits("")
+	if err := ul.beginRequest(); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	w := httptest.NewRecorder()
+	requestHandler(w, newRequest())
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("unexpected response code; got %d; want %d; body: %q", w.Code, http.StatusTooManyRequests, w.Body.String())
+	}
+	ul.endRequest()
+
+	// Cached response must be returned when the limits aren't exceeded.
+	w = httptest.NewRecorder()
+	requestHandler(w, newRequest())
+	if w.Code != http.StatusOK || w.Body.String() != `{"status":"success"}` {
+		t.Fatalf("unexpected response; code=%d, body=%q", w.Code, w.Body.String())
+	}
+
+	// Cached response mustn't be returned to disabled user.
+	ui.Disabled = true
+	w = httptest.NewRecorder()
+	requestHandler(w, newRequest())
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("unexpected response code for disabled user; got %d; want %d", w.Code, http.StatusForbidden)
+	}
+}
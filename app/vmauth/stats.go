@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// routeStats holds request statistics for a single (username, backend, path) route.
+//
+// path is either a `src_paths` entry from `url_map` or `*` for requests routed via `url_prefix`.
+type routeStats struct {
+	username string
+	backend  string
+	path     string
+
+	requests        *metrics.Counter
+	requestErrors   *metrics.Counter
+	requestDuration *metrics.FloatCounter
+	requestLatency  *metrics.Histogram
+	readBytes       *metrics.Counter
+	writtenBytes    *metrics.Counter
+}
+
+func newRouteStats(username, backend, path string) *routeStats {
+	labels := fmt.Sprintf(`username=%q, backend=%q, path=%q`, username, backend, path)
+	return &routeStats{
+		username: username,
+		backend:  backend,
+		path:     path,
+
+		requests:        metrics.GetOrCreateCounter(fmt.Sprintf(`vmauth_route_requests_total{%s}`, labels)),
+		requestErrors:   metrics.GetOrCreateCounter(fmt.Sprintf(`vmauth_route_request_errors_total{%s}`, labels)),
+		requestDuration: metrics.GetOrCreateFloatCounter(fmt.Sprintf(`vmauth_route_request_duration_seconds_total{%s}`, labels)),
+		requestLatency:  metrics.GetOrCreateHistogram(fmt.Sprintf(`vmauth_route_request_duration_seconds{%s}`, labels)),
+		readBytes:       metrics.GetOrCreateCounter(fmt.Sprintf(`vmauth_route_read_bytes_total{%s}`, labels)),
+		writtenBytes:    metrics.GetOrCreateCounter(fmt.Sprintf(`vmauth_route_written_bytes_total{%s}`, labels)),
+	}
+}
+
+// getStats returns stats for the backend with the given idx at rt.
+//
+// It returns catch-all stats with `*` path if rt has no stats for the backend, so the returned stats are never nil.
+func (rt *route) getStats(idx int, bu *backendURL) *routeStats {
+	if idx < len(rt.stats) && rt.stats[idx] != nil {
+		return rt.stats[idx]
+	}
+	return newRouteStats(rt.username, bu.urlPrefix, "*")
+}
+
+// routeStatsJSON is a JSON representation of routeStats returned from /-/stats page.
+type routeStatsJSON struct {
+	Username                    string  `json:"username"`
+	Backend                     string  `json:"backend"`
+	Path                        string  `json:"path"`
+	Requests                    uint64  `json:"requests"`
+	RequestErrors               uint64  `json:"requestErrors"`
+	RequestDurationSecondsTotal float64 `json:"requestDurationSecondsTotal"`
+	ReadBytes                   uint64  `json:"readBytes"`
+	WrittenBytes                uint64  `json:"writtenBytes"`
+}
+
+func (rs *routeStats) toJSON() routeStatsJSON {
+	return routeStatsJSON{
+		Username:                    rs.username,
+		Backend:                     rs.backend,
+		Path:                        rs.path,
+		Requests:                    rs.requests.Get(),
+		RequestErrors:               rs.requestErrors.Get(),
+		RequestDurationSecondsTotal: rs.requestDuration.Get(),
+		ReadBytes:                   rs.readBytes.Get(),
+		WrittenBytes:                rs.writtenBytes.Get(),
+	}
+}
+
+// getAllRouteStats returns stats for all the routes from m sorted by username, path and backend.
+func getAllRouteStats(m map[string]*UserInfo) []routeStatsJSON {
+	var result []routeStatsJSON
+	for _, ui := range m {
+		for _, e := range ui.URLMap {
+			for _, rt := range e.routes {
+				for _, rs := range rt.stats {
+					result = append(result, rs.toJSON())
+				}
+			}
+		}
+		if ui.defaultRoute != nil {
+			for _, rs := range ui.defaultRoute.stats {
+				result = append(result, rs.toJSON())
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := &result[i], &result[j]
+		if a.Username != b.Username {
+			return a.Username < b.Username
+		}
+		if a.Path != b.Path {
+			return a.Path < b.Path
+		}
+		return a.Backend < b.Backend
+	})
+	return result
+}
+
+func statsHandler(w http.ResponseWriter) {
+	ac := authConfig.Load().(map[string]*UserInfo)
+	data, err := json.Marshal(map[string]interface{}{
+		"status": "success",
+		"data":   getAllRouteStats(ac),
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("cannot marshal stats: %s", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
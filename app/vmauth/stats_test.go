@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestGetAllRouteStats(t *testing.T) {
+	m, err := parseAuthConfig([]byte(`
+users:
+- username: foo
+  url_map:
+  - src_paths: ["/api/v1/query", "/api/v1/query_range"]
+    url_prefix: http://vmselect/select/0/prometheus
+  url_prefix: http://default
+- username: bar
+  url_prefix: http://bar
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	u, err := url.Parse("/api/v1/query_range?query=up")
+	if err != nil {
+		t.Fatalf("cannot parse url: %s", err)
+	}
+	rt, _, err := createTargetURL(m["foo"], u)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	rs := rt.stats[0]
+	if rs.path != "/api/v1/query_range" {
+		t.Fatalf("unexpected route path; got %q; want %q", rs.path, "/api/v1/query_range")
+	}
+	rs.requests.Inc()
+	rs.readBytes.Add(123)
+
+	stats := getAllRouteStats(m)
+	expected := []routeStatsJSON{
+		{Username: "bar", Backend: "http://bar", Path: "*"},
+		{Username: "foo", Backend: "http://default", Path: "*"},
+		{Username: "foo", Backend: "http://vmselect/select/0/prometheus", Path: "/api/v1/query"},
+		{Username: "foo", Backend: "http://vmselect/select/0/prometheus", Path: "/api/v1/query_range"},
+	}
+	if len(stats) != len(expected) {
+		t.Fatalf("unexpected number of routes; got %d; want %d", len(stats), len(expected))
+	}
+	for i, e := range expected {
+		s := stats[i]
+		if s.Username != e.Username || s.Backend != e.Backend || s.Path != e.Path {
+			t.Fatalf("unexpected route at position #%d; got\n%+v\nwant\n%+v", i, s, e)
+		}
+	}
+	if s := stats[3]; s.Requests != rs.requests.Get() || s.ReadBytes != rs.readBytes.Get() {
+		t.Fatalf("unexpected stats for %q; got %+v", rs.path, s)
+	}
+}
+
+func TestRouteGetStats(t *testing.T) {
+	m, err := parseAuthConfig([]byte(`
+users:
+- username: foo
+  url_prefix: http://default
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	rt := m["foo"].defaultRoute
+	bu := rt.bp.backends[0]
+	if rs := rt.getStats(0, bu); rs != rt.stats[0] {
+		t.Fatalf("unexpected stats for the existing backend; got %+v; want %+v", rs, rt.stats[0])
+	}
+
+	// Catch-all stats must be returned for unknown backends.
+	rt.stats = nil
+	rs := rt.getStats(0, bu)
+	if rs == nil {
+		t.Fatalf("expecting non-nil catch-all stats")
+	}
+	if rs.username != "foo" || rs.backend != "http://default" || rs.path != "*" {
+		t.Fatalf("unexpected catch-all stats; got username=%q, backend=%q, path=%q", rs.username, rs.backend, rs.path)
+	}
+	countBefore := rs.requests.Get()
+	rs.requests.Inc()
+	if n := rt.getStats(0, bu).requests.Get() - countBefore; n != 1 {
+		t.Fatalf("catch-all stats must be shared among calls; got %d requests; want 1", n)
+	}
+}
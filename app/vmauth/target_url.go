@@ -7,10 +7,54 @@ import (
 	"strings"
 )
 
-func createTargetURL(ui *UserInfo, uOrig *url.URL) (string, error) {
+// route contains backends for requests matching a single `src_paths` entry or `url_prefix`.
+type route struct {
+	username string
+	path     string
+	bp       *backendPool
+
+	// stats contains per-backend stats for the route. It is parallel to bp.backends.
+	stats []*routeStats
+}
+
+func newRoute(username, path string, bp *backendPool) *route {
+	stats := make([]*routeStats, len(bp.backends))
+	for i, bu := range bp.backends {
+		stats[i] = newRouteStats(username, bu.urlPrefix, path)
+	}
+	return &route{
+		username: username,
+		path:     path,
+		bp:       bp,
+		stats:    stats,
+	}
+}
+
+// initRoutes initializes routes for ui.
+//
+// It must be called after ui.URLPrefix and ui.URLMap are sanitized.
+func (ui *UserInfo) initRoutes() {
+	for i := range ui.URLMap {
+		e := &ui.URLMap[i]
+		bp := newBackendPool(e.URLPrefix, ui.LoadBalancingPolicy)
+		e.routes = make([]*route, len(e.SrcPaths))
+		for j, path := range e.SrcPaths {
+			e.routes[j] = newRoute(ui.Username, path, bp)
+		}
+	}
+	if len(ui.URLPrefix) > 0 {
+		bp := newBackendPool(ui.URLPrefix, ui.LoadBalancingPolicy)
+		ui.defaultRoute = newRoute(ui.Username, "*", bp)
+	}
+}
+
+// createTargetURL returns the route for uOrig according to ui routing rules.
+//
+// It also returns the request uri, which must be appended to url prefixes of the route backends.
+func createTargetURL(ui *UserInfo, uOrig *url.URL) (*route, string, error) {
 	u, err := url.Parse(uOrig.String())
 	if err != nil {
-		return "", fmt.Errorf("cannot make a copy of %q: %w", u, err)
+		return nil, "", fmt.Errorf("cannot make a copy of %q: %w", u, err)
 	}
 	// Prevent from attacks with using `..` in r.URL.Path
 	u.Path = path.Clean(u.Path)
@@ -18,14 +62,45 @@ func createTargetURL(ui *UserInfo, uOrig *url.URL) (string, error) {
 		u.Path = "/" + u.Path
 	}
 	for _, e := range ui.URLMap {
-		for _, path := range e.SrcPaths {
+		for i, path := range e.SrcPaths {
 			if u.Path == path {
-				return e.URLPrefix + u.RequestURI(), nil
+				return e.routes[i], u.RequestURI(), nil
 			}
 		}
 	}
-	if len(ui.URLPrefix) > 0 {
-		return ui.URLPrefix + u.RequestURI(), nil
+	if ui.defaultRoute != nil {
+		return ui.defaultRoute, u.RequestURI(), nil
+	}
+	return nil, "", fmt.Errorf("missing route for %q", u)
+}
+
+// proxyTarget is a target for proxied request.
+type proxyTarget struct {
+	url string
+	bu  *backendURL
+	rs  *routeStats
+}
+
+// getTargets returns targets for the request with the given requestURI and tenant.
+//
+// Targets are returned in the order they must be tried according to load balancing policy.
+func (rt *route) getTargets(requestURI, tenant string) ([]*proxyTarget, error) {
+	idxs := rt.bp.getBackendIndexes()
+	targets := make([]*proxyTarget, 0, len(idxs))
+	for _, idx := range idxs {
+		bu := rt.bp.backends[idx]
+		targetURL, err := substituteTenant(bu.urlPrefix+requestURI, bu.urlPrefix, tenant)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := url.Parse(targetURL); err != nil {
+			return nil, fmt.Errorf("invalid targetURL=%q: %w", targetURL, err)
+		}
+		targets = append(targets, &proxyTarget{
+			url: targetURL,
+			bu:  bu,
+			rs:  rt.getStats(idx, bu),
+		})
 	}
-	return "", fmt.Errorf("missing route for %q", u)
+	return targets, nil
 }
@@ -12,32 +12,34 @@ func TestCreateTargetURLSuccess(t *testing.T) {
 		if err != nil {
 			t.Fatalf("cannot parse %q: %s", requestURI, err)
 		}
-		target, err := createTargetURL(ui, u)
+		ui.initRoutes()
+		rt, requestURI, err := createTargetURL(ui, u)
 		if err != nil {
 			t.Fatalf("unexpected error: %s", err)
 		}
+		target := rt.bp.backends[0].urlPrefix + requestURI
 		if target != expectedTarget {
 			t.Fatalf("unexpected target; got %q; want %q", target, expectedTarget)
 		}
 	}
 	// Simple routing with `url_prefix`
 	f(&UserInfo{
-		URLPrefix: "http://foo.bar",
+		URLPrefix: URLPrefix{"http://foo.bar"},
 	}, "", "http://foo.bar/.")
 	f(&UserInfo{
-		URLPrefix: "http://foo.bar",
+		URLPrefix: URLPrefix{"http://foo.bar"},
 	}, "/", "http://foo.bar/")
 	f(&UserInfo{
-		URLPrefix: "http://foo.bar",
+		URLPrefix: URLPrefix{"http://foo.bar"},
 	}, "a/b?c=d", "http://foo.bar/a/b?c=d")
 	f(&UserInfo{
-		URLPrefix: "https://sss:3894/x/y",
+		URLPrefix: URLPrefix{"https://sss:3894/x/y"},
 	}, "/z", "https://sss:3894/x/y/z")
 	f(&UserInfo{
-		URLPrefix: "https://sss:3894/x/y",
+		URLPrefix: URLPrefix{"https://sss:3894/x/y"},
 	}, "/../../aaa", "https://sss:3894/x/y/aaa")
 	f(&UserInfo{
-		URLPrefix: "https://sss:3894/x/y",
+		URLPrefix: URLPrefix{"https://sss:3894/x/y"},
 	}, "/./asd/../../aaa?a=d&s=s/../d", "https://sss:3894/x/y/aaa?a=d&s=s/../d")
 
 	// Complex routing with `url_map`
@@ -45,14 +47,14 @@ func TestCreateTargetURLSuccess(t *testing.T) {
 		URLMap: []URLMap{
 			{
 				SrcPaths:  []string{"/api/v1/query"},
-				URLPrefix: "http://vmselect/0/prometheus",
+				URLPrefix: URLPrefix{"http://vmselect/0/prometheus"},
 			},
 			{
 				SrcPaths:  []string{"/api/v1/write"},
-				URLPrefix: "http://vminsert/0/prometheus",
+				URLPrefix: URLPrefix{"http://vminsert/0/prometheus"},
 			},
 		},
-		URLPrefix: "http://default-server",
+		URLPrefix: URLPrefix{"http://default-server"},
 	}
 	f(ui, "/api/v1/query?query=up", "http://vmselect/0/prometheus/api/v1/query?query=up")
 	f(ui, "/api/v1/write", "http://vminsert/0/prometheus/api/v1/write")
@@ -66,12 +68,13 @@ func TestCreateTargetURLFailure(t *testing.T) {
 		if err != nil {
 			t.Fatalf("cannot parse %q: %s", requestURI, err)
 		}
-		target, err := createTargetURL(ui, u)
+		ui.initRoutes()
+		rt, requestURI, err := createTargetURL(ui, u)
 		if err == nil {
 			t.Fatalf("expecting non-nil error")
 		}
-		if target != "" {
-			t.Fatalf("unexpected target=%q; want empty string", target)
+		if rt != nil || requestURI != "" {
+			t.Fatalf("unexpected route for %q; want nil", requestURI)
 		}
 	}
 	f(&UserInfo{}, "/foo/bar")
@@ -79,7 +82,7 @@ func TestCreateTargetURLFailure(t *testing.T) {
 		URLMap: []URLMap{
 			{
 				SrcPaths:  []string{"/api/v1/query"},
-				URLPrefix: "http://foobar/baz",
+				URLPrefix: URLPrefix{"http://foobar/baz"},
 			},
 		},
 	}, "/api/v1/write")
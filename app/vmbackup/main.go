@@ -25,9 +25,12 @@ var (
 	snapshotDeleteURL = flag.String("snapshot.deleteURL", "", "VictoriaMetrics delete snapshot url. Optional. Will be generated from -snapshot.createURL if not provided. "+
 		"All created snaphosts will be automatically deleted. Example: http://victoriametrics:8428/snaphsot/delete")
 	dst = flag.String("dst", "", "Where to put the backup on the remote storage. "+
-		"Example: gcs://bucket/path/to/backup/dir, s3://bucket/path/to/backup/dir or fs:///path/to/local/backup/dir\n"+
+		"Example: gcs://bucket/path/to/backup/dir, s3://bucket/path/to/backup/dir, azblob://container/path/to/backup/dir, sftp://user@host/path/to/backup/dir or fs:///path/to/local/backup/dir\n"+
 		"-dst can point to the previous backup. In this case incremental backup is performed, i.e. only changed data is uploaded")
-	origin            = flag.String("origin", "", "Optional origin directory on the remote storage with old backup for server-side copying when performing full backup. This speeds up full backups")
+	origin         = flag.String("origin", "", "Optional origin directory on the remote storage with old backup for server-side copying when performing full backup. This speeds up full backups")
+	previousBackup = flag.String("previousBackup", "", "Optional path to the previous backup on the remote storage. If set, then only the data missing in the previous backup is uploaded to -dst, "+
+		"while the rest of data is referenced from the previous backup via manifest file. The previous backup must be kept while it is referenced by newer backups. "+
+		"Example: gcs://bucket/path/to/previous/backup/dir, s3://bucket/path/to/previous/backup/dir or fs:///path/to/previous/backup/dir")
 	concurrency       = flag.Int("concurrency", 10, "The number of concurrent workers. Higher concurrency may reduce backup duration")
 	maxBytesPerSecond = flagutil.NewBytes("maxBytesPerSecond", 0, "The maximum upload speed. There is no limit if it is set to 0")
 )
@@ -36,10 +39,21 @@ func main() {
 	// Write flags and help message to stdout, since it is easier to grep or pipe.
 	flag.CommandLine.SetOutput(os.Stdout)
 	flag.Usage = usage
+	isVerify := len(os.Args) > 1 && os.Args[1] == verifyCommand
+	if isVerify {
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
 	envflag.Parse()
 	buildinfo.Init()
 	logger.Init()
 
+	if isVerify {
+		if err := runVerify(); err != nil {
+			logger.Fatalf("%s", err)
+		}
+		return
+	}
+
 	if len(*snapshotCreateURL) > 0 {
 		logger.Infof("Snapshots enabled")
 		logger.Infof("Snapshot create url %s", *snapshotCreateURL)
@@ -50,7 +64,14 @@ func main() {
 			}
 		}
 		logger.Infof("Snapshot delete url %s", *snapshotDeleteURL)
-
+	}
+	if *scheduleEnable {
+		if err := runScheduler(); err != nil {
+			logger.Fatalf("%s", err)
+		}
+		return
+	}
+	if len(*snapshotCreateURL) > 0 {
 		name, err := snapshot.Create(*snapshotCreateURL)
 		if err != nil {
 			logger.Fatalf("cannot create snapshot: %s", err)
@@ -68,7 +89,10 @@ func main() {
 		}()
 	}
 
-	srcFS, err := newSrcFS()
+	if err := checkPreviousBackup(); err != nil {
+		logger.Fatalf("%s", err)
+	}
+	srcFS, err := newSrcFS(*snapshotName)
 	if err != nil {
 		logger.Fatalf("%s", err)
 	}
@@ -81,10 +105,11 @@ func main() {
 		logger.Fatalf("%s", err)
 	}
 	a := &actions.Backup{
-		Concurrency: *concurrency,
-		Src:         srcFS,
-		Dst:         dstFS,
-		Origin:      originFS,
+		Concurrency:  *concurrency,
+		Src:          srcFS,
+		Dst:          dstFS,
+		Origin:       originFS,
+		PreviousPath: *previousBackup,
 	}
 	if err := a.Run(); err != nil {
 		logger.Fatalf("cannot create backup: %s", err)
@@ -99,16 +124,31 @@ func usage() {
 vmbackup performs backups for VictoriaMetrics data from instant snapshots to gcs, s3
 or local filesystem. Backed up data can be restored with vmrestore.
 
+Run "vmbackup verify -dst=..." for verifying the backup at -dst.
+
 See the docs at https://victoriametrics.github.io/vbackup.html .
 `
 	flagutil.Usage(s)
 }
 
-func newSrcFS() (*fslocal.FS, error) {
-	if len(*snapshotName) == 0 {
+func checkPreviousBackup() error {
+	if len(*previousBackup) == 0 {
+		return nil
+	}
+	if len(*origin) > 0 {
+		return fmt.Errorf("`-origin` cannot be used together with `-previousBackup`")
+	}
+	if strings.TrimRight(*previousBackup, "/") == strings.TrimRight(*dst, "/") {
+		return fmt.Errorf("`-previousBackup` must differ from `-dst`; got %q", *dst)
+	}
+	return nil
+}
+
+func newSrcFS(snapshotName string) (*fslocal.FS, error) {
+	if len(snapshotName) == 0 {
 		return nil, fmt.Errorf("`-snapshotName` or `-snapshot.createURL` must be provided")
 	}
-	snapshotPath := *storageDataPath + "/snapshots/" + *snapshotName
+	snapshotPath := *storageDataPath + "/snapshots/" + snapshotName
 
 	// Verify the snapshot exists.
 	f, err := os.Open(snapshotPath)
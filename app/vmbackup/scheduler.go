@@ -0,0 +1,301 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmbackup/snapshot"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/actions"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/common"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/fscommon"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/fsnil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/procutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/pushmetrics"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	scheduleEnable = flag.Bool("schedule.enable", false, "Whether to run vmbackup as a daemon, which makes backups every hour. "+
+		"The latest backup is stored at -dst/latest, while hourly, daily and weekly backups are stored at -dst/hourly/<YYYY-MM-DDTHH>, "+
+		"-dst/daily/<YYYY-MM-DD> and -dst/weekly/<YYYY-Www> via server-side copy from -dst/latest. -snapshot.createURL must be set in this mode. "+
+		"See also -schedule.keepLastHourly, -schedule.keepLastDaily and -schedule.keepLastWeekly")
+	keepLastHourly = flag.Int("schedule.keepLastHourly", 0, "The number of the last hourly backups to keep in -schedule.enable mode. Hourly backups aren't made if set to 0")
+	keepLastDaily  = flag.Int("schedule.keepLastDaily", 0, "The number of the last daily backups to keep in -schedule.enable mode. Daily backups aren't made if set to 0")
+	keepLastWeekly = flag.Int("schedule.keepLastWeekly", 0, "The number of the last weekly backups to keep in -schedule.enable mode. Weekly backups aren't made if set to 0")
+	httpListenAddr = flag.String("httpListenAddr", ":8420", "TCP address for exporting metrics at /metrics page in -schedule.enable mode")
+)
+
+// backupTier represents a set of backups made with the same period.
+type backupTier struct {
+	// name is the name of the tier. It is used as a directory name for tier backups at -dst.
+	name string
+
+	// keepLast is the number of the last backups to keep for the tier.
+	keepLast int
+
+	// backupName returns the name of the tier backup for the given time.
+	backupName func(t time.Time) string
+}
+
+func getBackupTiers() []*backupTier {
+	return []*backupTier{
+		{
+			name:     "hourly",
+			keepLast: *keepLastHourly,
+			backupName: func(t time.Time) string {
+				return t.UTC().Format("2006-01-02T15")
+			},
+		},
+		{
+			name:     "daily",
+			keepLast: *keepLastDaily,
+			backupName: func(t time.Time) string {
+				return t.UTC().Format("2006-01-02")
+			},
+		},
+		{
+			name:     "weekly",
+			keepLast: *keepLastWeekly,
+			backupName: func(t time.Time) string {
+				year, week := t.UTC().ISOWeek()
+				return fmt.Sprintf("%d-W%02d", year, week)
+			},
+		},
+	}
+}
+
+// runScheduler makes backups every hour until SIGTERM is received.
+func runScheduler() error {
+	if len(*snapshotCreateURL) == 0 {
+		return fmt.Errorf("`-snapshot.createURL` must be set in `-schedule.enable` mode")
+	}
+	if len(*snapshotName) > 0 {
+		return fmt.Errorf("`-snapshotName` cannot be used in `-schedule.enable` mode, since snapshots are created via `-snapshot.createURL`")
+	}
+	if len(*origin) > 0 || len(*previousBackup) > 0 {
+		return fmt.Errorf("`-origin` and `-previousBackup` cannot be used in `-schedule.enable` mode")
+	}
+	if len(*dst) == 0 {
+		return fmt.Errorf("`-dst` cannot be empty")
+	}
+	tiers := getBackupTiers()
+	for _, t := range tiers {
+		if t.keepLast < 0 {
+			return fmt.Errorf("`-schedule.keepLast*` flags cannot be negative; got %d for %s backups", t.keepLast, t.name)
+		}
+	}
+
+	pushmetrics.Init()
+	go httpserver.Serve(*httpListenAddr, func(w http.ResponseWriter, r *http.Request) bool {
+		// /metrics is served by httpserver by default
+		return false
+	})
+	stopCh := make(chan struct{})
+	go func() {
+		sig := procutil.WaitForSigterm()
+		logger.Infof("received signal %s; stopping the scheduler after the current backup is complete", sig)
+		close(stopCh)
+	}()
+
+	logger.Infof("starting backups scheduler; backups are made every hour at %s", *dst)
+	for {
+		now := time.Now()
+		startTime := now
+		if err := runScheduledBackup(now, tiers); err != nil {
+			backupErrorsTotal.Inc()
+			lastBackupSuccessful.Set(0)
+			logger.Errorf("cannot make scheduled backup: %s", err)
+		} else {
+			lastBackupSuccessful.Set(1)
+			lastBackupTimestamp.Set(uint64(startTime.Unix()))
+			logger.Infof("scheduled backup is complete in %.3f seconds", time.Since(startTime).Seconds())
+		}
+		backupDuration.UpdateDuration(startTime)
+
+		next := now.Truncate(time.Hour).Add(time.Hour)
+		t := time.NewTimer(time.Until(next))
+		select {
+		case <-stopCh:
+			t.Stop()
+			pushmetrics.Stop()
+			if err := httpserver.Stop(*httpListenAddr); err != nil {
+				return fmt.Errorf("cannot stop http server: %w", err)
+			}
+			return nil
+		case <-t.C:
+		}
+	}
+}
+
+func runScheduledBackup(now time.Time, tiers []*backupTier) error {
+	backupsTotal.Inc()
+	name, err := snapshot.Create(*snapshotCreateURL)
+	if err != nil {
+		return fmt.Errorf("cannot create snapshot: %w", err)
+	}
+	defer func() {
+		if err := snapshot.Delete(*snapshotDeleteURL, name); err != nil {
+			logger.Errorf("cannot delete snapshot %q: %s", name, err)
+		}
+	}()
+	srcFS, err := newSrcFS(name)
+	if err != nil {
+		return err
+	}
+	defer srcFS.MustStop()
+	srcParts, err := srcFS.ListParts()
+	if err != nil {
+		return fmt.Errorf("cannot list parts at %s: %w", srcFS, err)
+	}
+
+	latestFS, err := actions.NewRemoteFS(joinPath(*dst, "latest"))
+	if err != nil {
+		return fmt.Errorf("cannot open the latest backup: %w", err)
+	}
+	defer latestFS.MustStop()
+	b := &actions.Backup{
+		Concurrency: *concurrency,
+		Src:         srcFS,
+		Dst:         latestFS,
+		Origin:      &fsnil.FS{},
+	}
+	if err := b.Run(); err != nil {
+		return fmt.Errorf("cannot make the latest backup: %w", err)
+	}
+	lastBackupSize.Set(getPartsSize(srcParts))
+
+	for _, t := range tiers {
+		if t.keepLast == 0 {
+			continue
+		}
+		path := joinPath(*dst, t.name, t.backupName(now))
+		dstFS, err := actions.NewRemoteFS(path)
+		if err != nil {
+			return fmt.Errorf("cannot open %s backup: %w", t.name, err)
+		}
+		ok, err := dstFS.HasFile(fscommon.BackupCompleteFilename)
+		if err != nil {
+			dstFS.MustStop()
+			return err
+		}
+		if !ok {
+			// Use server-side copy from the latest backup, since it contains the same data.
+			b := &actions.Backup{
+				Concurrency: *concurrency,
+				Src:         srcFS,
+				Dst:         dstFS,
+				Origin:      latestFS,
+			}
+			if err := b.Run(); err != nil {
+				dstFS.MustStop()
+				return fmt.Errorf("cannot make %s backup: %w", t.name, err)
+			}
+		}
+		dstFS.MustStop()
+		if err := applyRetention(t); err != nil {
+			return fmt.Errorf("cannot apply retention for %s backups: %w", t.name, err)
+		}
+	}
+	return nil
+}
+
+// applyRetention deletes the oldest backups for t, so only t.keepLast backups remain.
+func applyRetention(t *backupTier) error {
+	tierFS, err := actions.NewRemoteFS(joinPath(*dst, t.name))
+	if err != nil {
+		return err
+	}
+	parts, err := tierFS.ListParts()
+	tierFS.MustStop()
+	if err != nil {
+		return err
+	}
+	for _, name := range getBackupsToDelete(getBackupNames(parts), t.keepLast) {
+		path := joinPath(*dst, t.name, name)
+		logger.Infof("deleting %s backup %s according to -schedule.keepLast%s=%d", t.name, path, strings.Title(t.name), t.keepLast)
+		if err := deleteBackup(path); err != nil {
+			return err
+		}
+		deletedBackupsTotal.Inc()
+	}
+	return nil
+}
+
+// getBackupNames returns sorted names of backups for parts listed at the tier directory.
+func getBackupNames(parts []common.Part) []string {
+	m := make(map[string]struct{})
+	for _, p := range parts {
+		n := strings.IndexByte(p.Path, '/')
+		if n <= 0 {
+			continue
+		}
+		m[p.Path[:n]] = struct{}{}
+	}
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// getBackupsToDelete returns backups, which must be deleted from the sorted names in order to keep the last keepLast backups.
+func getBackupsToDelete(names []string, keepLast int) []string {
+	if len(names) <= keepLast {
+		return nil
+	}
+	return names[:len(names)-keepLast]
+}
+
+func deleteBackup(path string) error {
+	fs, err := actions.NewRemoteFS(path)
+	if err != nil {
+		return err
+	}
+	defer fs.MustStop()
+	// Delete `backup complete` file at first, so the backup is considered incomplete if the deletion fails.
+	if err := fs.DeleteFile(fscommon.BackupCompleteFilename); err != nil {
+		return fmt.Errorf("cannot delete `backup complete` file at %s: %w", fs, err)
+	}
+	parts, err := fs.ListParts()
+	if err != nil {
+		return fmt.Errorf("cannot list parts at %s: %w", fs, err)
+	}
+	for _, p := range parts {
+		if err := fs.DeletePart(p); err != nil {
+			return fmt.Errorf("cannot delete %s from %s: %w", &p, fs, err)
+		}
+	}
+	if err := fs.DeleteFile(fscommon.BackupManifestFilename); err != nil {
+		return fmt.Errorf("cannot delete manifest file at %s: %w", fs, err)
+	}
+	return fs.RemoveEmptyDirs()
+}
+
+func getPartsSize(parts []common.Part) uint64 {
+	n := uint64(0)
+	for _, p := range parts {
+		n += p.Size
+	}
+	return n
+}
+
+func joinPath(path string, elems ...string) string {
+	return strings.TrimRight(path, "/") + "/" + strings.Join(elems, "/")
+}
+
+var (
+	backupsTotal         = metrics.NewCounter(`vmbackup_scheduler_backups_total`)
+	backupErrorsTotal    = metrics.NewCounter(`vmbackup_scheduler_backup_errors_total`)
+	deletedBackupsTotal  = metrics.NewCounter(`vmbackup_scheduler_deleted_backups_total`)
+	backupDuration       = metrics.NewSummary(`vmbackup_scheduler_backup_duration_seconds`)
+	lastBackupSuccessful = metrics.NewCounter(`vmbackup_scheduler_last_backup_successful`)
+	lastBackupTimestamp  = metrics.NewCounter(`vmbackup_scheduler_last_backup_success_timestamp_seconds`)
+	lastBackupSize       = metrics.NewCounter(`vmbackup_scheduler_last_backup_size_bytes`)
+)
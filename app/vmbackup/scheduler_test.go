@@ -0,0 +1,53 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/common"
+)
+
+func TestGetBackupNames(t *testing.T) {
+	parts := []common.Part{
+		{Path: "2021-01-02/data/small/part1"},
+		{Path: "2021-01-01/data/small/part1"},
+		{Path: "2021-01-02/indexdb/part2"},
+		{Path: "unexpected_file"},
+	}
+	names := getBackupNames(parts)
+	expNames := []string{"2021-01-01", "2021-01-02"}
+	if !reflect.DeepEqual(names, expNames) {
+		t.Fatalf("unexpected backup names; got %q; want %q", names, expNames)
+	}
+}
+
+func TestGetBackupsToDelete(t *testing.T) {
+	f := func(names []string, keepLast int, exp []string) {
+		t.Helper()
+		got := getBackupsToDelete(names, keepLast)
+		if !reflect.DeepEqual(got, exp) {
+			t.Fatalf("unexpected backups to delete for keepLast=%d; got %q; want %q", keepLast, got, exp)
+		}
+	}
+	names := []string{"2021-01-01", "2021-01-02", "2021-01-03"}
+	f(nil, 1, nil)
+	f(names, 3, nil)
+	f(names, 5, nil)
+	f(names, 2, []string{"2021-01-01"})
+	f(names, 1, []string{"2021-01-01", "2021-01-02"})
+}
+
+func TestBackupTierNames(t *testing.T) {
+	ts := time.Date(2021, 1, 4, 15, 30, 0, 0, time.UTC)
+	expNames := map[string]string{
+		"hourly": "2021-01-04T15",
+		"daily":  "2021-01-04",
+		"weekly": "2021-W01",
+	}
+	for _, tier := range getBackupTiers() {
+		if name := tier.backupName(ts); name != expNames[tier.name] {
+			t.Fatalf("unexpected backup name for %s tier; got %q; want %q", tier.name, name, expNames[tier.name])
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/actions"
+)
+
+var (
+	verifyChunksPerPart = flag.Int("verify.chunksPerPart", 1, "The number of randomly selected chunks to verify per each part in `vmbackup verify` mode. "+
+		"Chunks are downloaded via ranged reads, so only a small share of the backup is downloaded. "+
+		"Set it to 0 for verifying only the presence and sizes of parts. See also -verify.full")
+	verifyFull = flag.Bool("verify.full", false, "Whether to verify checksums for all the chunks in `vmbackup verify` mode. "+
+		"This downloads the whole backup")
+)
+
+// verifyCommand is the name of the command for verifying backups, e.g. `vmbackup verify -dst=...`.
+const verifyCommand = "verify"
+
+func runVerify() error {
+	if len(*dst) == 0 {
+		return fmt.Errorf("`-dst` cannot be empty")
+	}
+	if *verifyChunksPerPart < 0 {
+		return fmt.Errorf("`-verify.chunksPerPart` cannot be negative; got %d", *verifyChunksPerPart)
+	}
+	dstFS, err := newDstFS()
+	if err != nil {
+		return err
+	}
+	defer dstFS.MustStop()
+	chunksPerPart := *verifyChunksPerPart
+	if *verifyFull {
+		chunksPerPart = -1
+	}
+	v := &actions.Verify{
+		Concurrency:   *concurrency,
+		Src:           dstFS,
+		ChunksPerPart: chunksPerPart,
+	}
+	if err := v.Run(); err != nil {
+		return fmt.Errorf("backup verification failed: %w", err)
+	}
+	return nil
+}
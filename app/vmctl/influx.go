@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"regexp"
+	"strings"
 	"sync"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmctl/influx"
@@ -12,13 +14,14 @@ import (
 )
 
 type influxProcessor struct {
-	ic        *influx.Client
+	ic        influx.Reader
 	im        *vm.Importer
 	cc        int
 	separator string
+	mapping   []measurementMapping
 }
 
-func newInfluxProcessor(ic *influx.Client, im *vm.Importer, cc int, separator string) *influxProcessor {
+func newInfluxProcessor(ic influx.Reader, im *vm.Importer, cc int, separator string, mapping []measurementMapping) *influxProcessor {
 	if cc < 1 {
 		cc = 1
 	}
@@ -27,9 +30,52 @@ func newInfluxProcessor(ic *influx.Client, im *vm.Importer, cc int, separator st
 		im:        im,
 		cc:        cc,
 		separator: separator,
+		mapping:   mapping,
 	}
 }
 
+// measurementMapping maps measurements matching re to metric name prefixes
+type measurementMapping struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+// parseMeasurementMapping parses mapping rules in the form `regexp=replacement`
+func parseMeasurementMapping(rules []string) ([]measurementMapping, error) {
+	var mapping []measurementMapping
+	for _, rule := range rules {
+		n := strings.LastIndex(rule, "=")
+		if n < 0 {
+			return nil, fmt.Errorf("missing `=` in measurement mapping rule %q; it must have the form `regexp=replacement`", rule)
+		}
+		re, err := regexp.Compile("^(?:" + rule[:n] + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse regexp in measurement mapping rule %q: %s", rule, err)
+		}
+		mapping = append(mapping, measurementMapping{
+			re:          re,
+			replacement: rule[n+1:],
+		})
+	}
+	return mapping, nil
+}
+
+// metricName returns metric name for the given measurement and field.
+//
+// The first matching mapping rule is applied to the measurement.
+func (ip *influxProcessor) metricName(measurement, field string) string {
+	for _, m := range ip.mapping {
+		if m.re.MatchString(measurement) {
+			measurement = m.re.ReplaceAllString(measurement, m.replacement)
+			break
+		}
+	}
+	if measurement == "" {
+		return field
+	}
+	return fmt.Sprintf("%s%s%s", measurement, ip.separator, field)
+}
+
 func (ip *influxProcessor) run(silent bool) error {
 	series, err := ip.ic.Explore()
 	if err != nil {
@@ -98,12 +144,7 @@ func (ip *influxProcessor) do(s *influx.Series) error {
 	defer func() {
 		_ = cr.Close()
 	}()
-	var name string
-	if s.Measurement != "" {
-		name = fmt.Sprintf("%s%s%s", s.Measurement, ip.separator, s.Field)
-	} else {
-		name = s.Field
-	}
+	name := ip.metricName(s.Measurement, s.Field)
 
 	labels := make([]vm.LabelPair, len(s.LabelPairs))
 	var containsDBLabel bool
@@ -33,9 +33,38 @@ type Config struct {
 	Retention string
 	ChunkSize int
 
+	// Org, Bucket and Token are used by InfluxDB 2.x client
+	Org    string
+	Bucket string
+	Token  string
+
 	Filter Filter
 }
 
+// Reader reads series from InfluxDB.
+//
+// It is implemented by Client for InfluxDB 1.x and by ClientV2 for InfluxDB 2.x
+type Reader interface {
+	// Explore returns all the series to import
+	Explore() ([]*Series, error)
+
+	// FetchDataPoints returns datapoints for s
+	FetchDataPoints(s *Series) (Response, error)
+
+	// Database returns database name, which is used as `db` label value
+	Database() string
+}
+
+// Response reads datapoints for a single series in chunks
+type Response interface {
+	// Next reads the next chunk of datapoints.
+	// Returns io.EOF when time series was read entirely.
+	Next() ([]int64, []float64, error)
+
+	// Close closes the response
+	Close() error
+}
+
 // Filter contains configuration for filtering
 // the timeseries
 type Filter struct {
@@ -245,7 +274,7 @@ func (cr *ChunkedResponse) Next() ([]int64, []float64, error) {
 
 // FetchDataPoints performs SELECT request to fetch
 // datapoints for particular field.
-func (c *Client) FetchDataPoints(s *Series) (*ChunkedResponse, error) {
+func (c *Client) FetchDataPoints(s *Series) (Response, error) {
 	iq := influx.Query{
 		Command:         s.fetchQuery(c.filterTime),
 		Database:        c.database,
@@ -0,0 +1,462 @@
+package influx
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ClientV2 represents InfluxDB 2.x client,
+// which reads data via Flux queries
+type ClientV2 struct {
+	addr   string
+	org    string
+	bucket string
+	token  string
+	c      *http.Client
+
+	chunkSize int
+
+	filterSeries string
+	timeStart    string
+	timeEnd      string
+}
+
+// Bucket represents InfluxDB 2.x bucket
+type Bucket struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// NewClientV2 creates and returns InfluxDB 2.x client
+// configured with passed Config
+func NewClientV2(cfg Config) (*ClientV2, error) {
+	if cfg.Org == "" {
+		return nil, fmt.Errorf("org must be set for InfluxDB 2.x")
+	}
+	timeStart, err := fluxTime(cfg.Filter.TimeStart, "1970-01-01T00:00:00Z")
+	if err != nil {
+		return nil, err
+	}
+	timeEnd, err := fluxTime(cfg.Filter.TimeEnd, "")
+	if err != nil {
+		return nil, err
+	}
+	chunkSize := cfg.ChunkSize
+	if chunkSize < 1 {
+		chunkSize = 10e3
+	}
+	c := &ClientV2{
+		addr:         strings.TrimRight(cfg.Addr, "/"),
+		org:          cfg.Org,
+		bucket:       cfg.Bucket,
+		token:        cfg.Token,
+		c:            &http.Client{},
+		chunkSize:    chunkSize,
+		filterSeries: cfg.Filter.Series,
+		timeStart:    timeStart,
+		timeEnd:      timeEnd,
+	}
+	if err := c.ping(); err != nil {
+		return nil, fmt.Errorf("ping failed: %s", err)
+	}
+
+	buckets, err := c.Buckets()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list buckets: %s", err)
+	}
+	var names []string
+	for _, b := range buckets {
+		if b.Name == c.bucket {
+			return c, nil
+		}
+		names = append(names, b.Name)
+	}
+	sort.Strings(names)
+	if c.bucket == "" {
+		return nil, fmt.Errorf("bucket must be set for InfluxDB 2.x; available buckets in org %q: %q", c.org, names)
+	}
+	return nil, fmt.Errorf("cannot find bucket %q in org %q; available buckets: %q", c.bucket, c.org, names)
+}
+
+// Database returns bucket name
+func (c *ClientV2) Database() string {
+	return c.bucket
+}
+
+func fluxTime(s, defaultValue string) (string, error) {
+	if s == "" {
+		return defaultValue, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse %q: %s", s, err)
+	}
+	return t.UTC().Format(time.RFC3339Nano), nil
+}
+
+var fluxStringEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `${`, `\${`)
+
+func fluxString(s string) string {
+	return `"` + fluxStringEscaper.Replace(s) + `"`
+}
+
+func (c *ClientV2) ping() error {
+	req, err := http.NewRequest("GET", c.addr+"/health", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	return nil
+}
+
+// Buckets returns all the buckets in the configured org
+func (c *ClientV2) Buckets() ([]Bucket, error) {
+	const limit = 100
+	var buckets []Bucket
+	for offset := 0; ; offset += limit {
+		args := url.Values{}
+		args.Set("org", c.org)
+		args.Set("limit", strconv.Itoa(limit))
+		args.Set("offset", strconv.Itoa(offset))
+		req, err := http.NewRequest("GET", c.addr+"/api/v2/buckets?"+args.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.do(req)
+		if err != nil {
+			return nil, err
+		}
+		var r struct {
+			Buckets []Bucket `json:"buckets"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&r)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse buckets list: %s", err)
+		}
+		buckets = append(buckets, r.Buckets...)
+		if len(r.Buckets) < limit {
+			return buckets, nil
+		}
+	}
+}
+
+func (c *ClientV2) do(req *http.Request) (*http.Response, error) {
+	if c.token != "" {
+		req.Header.Set("Authorization", "Token "+c.token)
+	}
+	resp, err := c.c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("unexpected response code %d for %s %q; response body: %q", resp.StatusCode, req.Method, req.URL.Path, body)
+	}
+	return resp, nil
+}
+
+// query sends Flux query q and returns reader for the resulting annotated CSV
+func (c *ClientV2) query(q string) (*fluxReader, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"query": q,
+		"type":  "flux",
+		"dialect": map[string]interface{}{
+			"header":      true,
+			"annotations": []string{"datatype"},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	args := url.Values{}
+	args.Set("org", c.org)
+	req, err := http.NewRequest("POST", c.addr+"/api/v2/query?"+args.Encode(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/csv")
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("query %q err: %s", q, err)
+	}
+	return newFluxReader(resp.Body), nil
+}
+
+func (c *ClientV2) fromRange() string {
+	f := &strings.Builder{}
+	fmt.Fprintf(f, "from(bucket: %s) |> range(start: %s", fluxString(c.bucket), c.timeStart)
+	if c.timeEnd != "" {
+		fmt.Fprintf(f, ", stop: %s", c.timeEnd)
+	}
+	f.WriteString(")")
+	return f.String()
+}
+
+func (c *ClientV2) exploreQuery() string {
+	f := &strings.Builder{}
+	f.WriteString(c.fromRange())
+	if c.filterSeries != "" {
+		fmt.Fprintf(f, " |> filter(fn: (r) => %s)", c.filterSeries)
+	}
+	// Every table in the response corresponds to a single series,
+	// so the first point from every table is enough for collecting all the series.
+	f.WriteString(` |> first() |> drop(columns: ["_start", "_stop", "_time"])`)
+	return f.String()
+}
+
+func (s Series) fluxFetchQuery(fromRange string) string {
+	f := &strings.Builder{}
+	f.WriteString(fromRange)
+	fmt.Fprintf(f, " |> filter(fn: (r) => r._measurement == %s and r._field == %s", fluxString(s.Measurement), fluxString(s.Field))
+	for _, pair := range s.LabelPairs {
+		fmt.Fprintf(f, " and r[%s] == %s", fluxString(pair.Name), fluxString(pair.Value))
+	}
+	f.WriteString(`) |> drop(columns: ["_start", "_stop"])`)
+	return f.String()
+}
+
+// Explore collects all the series with numeric values in the configured bucket.
+func (c *ClientV2) Explore() ([]*Series, error) {
+	log.Printf("Exploring scheme for bucket %q", c.bucket)
+	q := c.exploreQuery()
+	log.Printf("fetching series: %s", q)
+	fr, err := c.query(q)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get series: %s", err)
+	}
+	defer func() { _ = fr.Close() }()
+
+	var result []*Series
+	var skipped int
+	for {
+		row, err := fr.Next()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("failed to read series: %s", err)
+		}
+		if !fr.isNumericValue() {
+			skipped++
+			continue
+		}
+		s := &Series{
+			Measurement: fr.value(row, "_measurement"),
+			Field:       fr.value(row, "_field"),
+			LabelPairs:  fr.labelPairs(row),
+		}
+		result = append(result, s)
+	}
+	if skipped > 0 {
+		log.Printf("found %d series; skipped %d series with non-numeric values", len(result), skipped)
+	} else {
+		log.Printf("found %d series", len(result))
+	}
+	return result, nil
+}
+
+// FetchDataPoints performs Flux query to fetch
+// datapoints for particular series.
+func (c *ClientV2) FetchDataPoints(s *Series) (Response, error) {
+	q := s.fluxFetchQuery(c.fromRange())
+	fr, err := c.query(q)
+	if err != nil {
+		return nil, err
+	}
+	labels := make(map[string]string, len(s.LabelPairs))
+	for _, lp := range s.LabelPairs {
+		labels[lp.Name] = lp.Value
+	}
+	return &fluxResponse{
+		fr:        fr,
+		labels:    labels,
+		chunkSize: c.chunkSize,
+	}, nil
+}
+
+// fluxResponse reads datapoints for a single series from Flux query response.
+type fluxResponse struct {
+	fr        *fluxReader
+	labels    map[string]string
+	chunkSize int
+}
+
+// Close closes fr.
+func (fr *fluxResponse) Close() error {
+	return fr.fr.Close()
+}
+
+// Next reads the next chunk of datapoints.
+// Returns io.EOF when time series was read entirely.
+func (fr *fluxResponse) Next() ([]int64, []float64, error) {
+	var timestamps []int64
+	var values []float64
+	for len(timestamps) < fr.chunkSize {
+		row, err := fr.fr.Next()
+		if err != nil {
+			if err == io.EOF && len(timestamps) > 0 {
+				break
+			}
+			return nil, nil, err
+		}
+		// Filter by tags matches series with additional tags too, so skip them.
+		if !fr.fr.hasLabels(row, fr.labels) {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339Nano, fr.fr.value(row, "_time"))
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot parse timestamp: %s", err)
+		}
+		v, err := strconv.ParseFloat(fr.fr.value(row, "_value"), 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot parse value: %s", err)
+		}
+		timestamps = append(timestamps, t.UnixNano()/1e6)
+		values = append(values, v)
+	}
+	return timestamps, values, nil
+}
+
+// fluxReader reads rows from annotated CSV returned by Flux query
+type fluxReader struct {
+	body io.ReadCloser
+	r    *csv.Reader
+
+	datatypes []string
+	columns   map[string]int
+	tags      []string
+}
+
+func newFluxReader(body io.ReadCloser) *fluxReader {
+	r := csv.NewReader(body)
+	r.FieldsPerRecord = -1
+	r.ReuseRecord = true
+	return &fluxReader{
+		body: body,
+		r:    r,
+	}
+}
+
+// Close closes fr.
+func (fr *fluxReader) Close() error {
+	return fr.body.Close()
+}
+
+// Next returns the next data row.
+// Returns io.EOF when all the rows are read.
+func (fr *fluxReader) Next() ([]string, error) {
+	for {
+		row, err := fr.r.Read()
+		if err != nil {
+			return nil, err
+		}
+		if len(row) > 0 && row[0] == "#datatype" {
+			fr.datatypes = append(fr.datatypes[:0], row...)
+			header, err := fr.r.Read()
+			if err != nil {
+				return nil, fmt.Errorf("cannot read header after datatype annotation: %s", err)
+			}
+			fr.setHeader(header)
+			continue
+		}
+		if fr.columns == nil {
+			return nil, fmt.Errorf("missing header in Flux response")
+		}
+		if idx, ok := fr.columns["error"]; ok && idx < len(row) {
+			return nil, fmt.Errorf("Flux query error: %s", row[idx])
+		}
+		return row, nil
+	}
+}
+
+// systemColumns contains columns, which aren't tags
+var systemColumns = map[string]bool{
+	"":             true,
+	"result":       true,
+	"table":        true,
+	"_start":       true,
+	"_stop":        true,
+	"_time":        true,
+	"_value":       true,
+	"_field":       true,
+	"_measurement": true,
+}
+
+func (fr *fluxReader) setHeader(header []string) {
+	fr.columns = make(map[string]int, len(header))
+	fr.tags = fr.tags[:0]
+	for i, name := range header {
+		fr.columns[name] = i
+		if !systemColumns[name] {
+			fr.tags = append(fr.tags, name)
+		}
+	}
+	sort.Strings(fr.tags)
+}
+
+func (fr *fluxReader) value(row []string, column string) string {
+	idx, ok := fr.columns[column]
+	if !ok || idx >= len(row) {
+		return ""
+	}
+	return row[idx]
+}
+
+func (fr *fluxReader) isNumericValue() bool {
+	idx, ok := fr.columns["_value"]
+	if !ok || idx >= len(fr.datatypes) {
+		return false
+	}
+	switch fr.datatypes[idx] {
+	case "double", "long", "unsignedLong":
+		return true
+	default:
+		return false
+	}
+}
+
+func (fr *fluxReader) labelPairs(row []string) []LabelPair {
+	var lps []LabelPair
+	for _, tag := range fr.tags {
+		if v := fr.value(row, tag); v != "" {
+			lps = append(lps, LabelPair{
+				Name:  tag,
+				Value: v,
+			})
+		}
+	}
+	return lps
+}
+
+func (fr *fluxReader) hasLabels(row []string, labels map[string]string) bool {
+	n := 0
+	for _, tag := range fr.tags {
+		v := fr.value(row, tag)
+		if v == "" {
+			continue
+		}
+		if labels[tag] != v {
+			return false
+		}
+		n++
+	}
+	return n == len(labels)
+}
@@ -0,0 +1,143 @@
+package influx
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestFluxFetchQuery(t *testing.T) {
+	f := func(s Series, expected string) {
+		t.Helper()
+		got := s.fluxFetchQuery(`from(bucket: "b") |> range(start: 1970-01-01T00:00:00Z)`)
+		if got != expected {
+			t.Fatalf("unexpected query;\ngot\n%s\nwant\n%s", got, expected)
+		}
+	}
+	f(Series{
+		Measurement: "cpu",
+		Field:       "value",
+	}, `from(bucket: "b") |> range(start: 1970-01-01T00:00:00Z) |> filter(fn: (r) => r._measurement == "cpu" and r._field == "value") |> drop(columns: ["_start", "_stop"])`)
+	f(Series{
+		Measurement: "cpu",
+		Field:       "value",
+		LabelPairs: []LabelPair{
+			{Name: "foo", Value: `b"a\r${x}`},
+			{Name: "baz", Value: "qux"},
+		},
+	}, `from(bucket: "b") |> range(start: 1970-01-01T00:00:00Z) |> filter(fn: (r) => r._measurement == "cpu" and r._field == "value" and r["foo"] == "b\"a\\r\${x}" and r["baz"] == "qux") |> drop(columns: ["_start", "_stop"])`)
+}
+
+func TestClientV2(t *testing.T) {
+	const exploreResponse = `#datatype,string,long,double,string,string,string
+,result,table,_value,_field,_measurement,host
+,_result,0,1,usage,cpu,h1
+,_result,1,2,usage,cpu,h2
+
+#datatype,string,long,string,string,string,string
+,result,table,_value,_field,_measurement,host
+,_result,2,foo,status,cpu,h1
+
+#datatype,string,long,long,string,string,string,string
+,result,table,_value,_field,_measurement,host,region
+,_result,3,3,usage,cpu,h1,eu
+`
+	const fetchResponse = `#datatype,string,long,dateTime:RFC3339,double,string,string,string,string
+,result,table,_time,_value,_field,_measurement,host,region
+,_result,0,2020-01-01T00:00:00Z,1,usage,cpu,h1,
+,_result,0,2020-01-01T00:00:01Z,2,usage,cpu,h1,
+,_result,0,2020-01-01T00:00:02.5Z,3,usage,cpu,h1,
+,_result,1,2020-01-01T00:00:00Z,10,usage,cpu,h1,eu
+`
+	var queries []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" && r.Header.Get("Authorization") != "Token secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/health":
+		case "/api/v2/buckets":
+			_, _ = io.WriteString(w, `{"buckets":[{"id":"1","name":"_monitoring"},{"id":"2","name":"telegraf"}]}`)
+		case "/api/v2/query":
+			var req struct {
+				Query string `json:"query"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				t.Errorf("cannot parse query request: %s", err)
+			}
+			queries = append(queries, req.Query)
+			if len(queries) == 1 {
+				_, _ = io.WriteString(w, exploreResponse)
+			} else {
+				_, _ = io.WriteString(w, fetchResponse)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := Config{
+		Addr:      srv.URL,
+		Org:       "org",
+		Token:     "secret",
+		ChunkSize: 2,
+	}
+	if _, err := NewClientV2(cfg); err == nil {
+		t.Fatalf("expecting non-nil error for missing bucket")
+	}
+	cfg.Bucket = "missing"
+	if _, err := NewClientV2(cfg); err == nil {
+		t.Fatalf("expecting non-nil error for unknown bucket")
+	}
+	cfg.Bucket = "telegraf"
+	c, err := NewClientV2(cfg)
+	if err != nil {
+		t.Fatalf("cannot create client: %s", err)
+	}
+
+	series, err := c.Explore()
+	if err != nil {
+		t.Fatalf("cannot explore series: %s", err)
+	}
+	expectedSeries := []*Series{
+		{Measurement: "cpu", Field: "usage", LabelPairs: []LabelPair{{Name: "host", Value: "h1"}}},
+		{Measurement: "cpu", Field: "usage", LabelPairs: []LabelPair{{Name: "host", Value: "h2"}}},
+		{Measurement: "cpu", Field: "usage", LabelPairs: []LabelPair{{Name: "host", Value: "h1"}, {Name: "region", Value: "eu"}}},
+	}
+	if !reflect.DeepEqual(series, expectedSeries) {
+		t.Fatalf("unexpected series;\ngot\n%v\nwant\n%v", series, expectedSeries)
+	}
+
+	// The response contains the series with additional region tag, which must be skipped.
+	resp, err := c.FetchDataPoints(series[0])
+	if err != nil {
+		t.Fatalf("cannot fetch datapoints: %s", err)
+	}
+	defer func() { _ = resp.Close() }()
+	var timestamps []int64
+	var values []float64
+	for {
+		ts, vs, err := resp.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("cannot read datapoints: %s", err)
+		}
+		timestamps = append(timestamps, ts...)
+		values = append(values, vs...)
+	}
+	expectedTimestamps := []int64{1577836800000, 1577836801000, 1577836802500}
+	if !reflect.DeepEqual(timestamps, expectedTimestamps) {
+		t.Fatalf("unexpected timestamps; got %v; want %v", timestamps, expectedTimestamps)
+	}
+	expectedValues := []float64{1, 2, 3}
+	if !reflect.DeepEqual(values, expectedValues) {
+		t.Fatalf("unexpected values; got %v; want %v", values, expectedValues)
+	}
+}
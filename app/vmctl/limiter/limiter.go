@@ -0,0 +1,46 @@
+package limiter
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter limits the rate of requests to the source database.
+//
+// Nil Limiter doesn't limit requests.
+type Limiter struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// New returns Limiter, which allows up to perSecond requests per second.
+//
+// Nil is returned if perSecond isn't positive.
+func New(perSecond float64) *Limiter {
+	if perSecond <= 0 {
+		return nil
+	}
+	return &Limiter{
+		interval: time.Duration(float64(time.Second) / perSecond),
+	}
+}
+
+// Wait blocks until the next request is allowed.
+func (l *Limiter) Wait() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	d := l.next.Sub(now)
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+	if d > 0 {
+		time.Sleep(d)
+	}
+}
@@ -0,0 +1,33 @@
+package limiter
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	var l *Limiter
+	l.Wait()
+	if New(0) != nil {
+		t.Fatalf("expecting nil limiter for zero rate")
+	}
+
+	l = New(100)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				l.Wait()
+			}
+		}()
+	}
+	wg.Wait()
+	// 20 requests at 100 req/s must take at least 190ms
+	if d := time.Since(start); d < 190*time.Millisecond {
+		t.Fatalf("requests weren't limited; took %s", d)
+	}
+}
@@ -10,9 +10,14 @@ import (
 	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmctl/influx"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmctl/opentsdb"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmctl/prometheus"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmctl/promscale"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmctl/thanos"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmctl/verify"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmctl/vm"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/buildinfo"
+	"github.com/cheggaaa/pb/v3"
 	"github.com/urfave/cli/v2"
 )
 
@@ -36,6 +41,9 @@ func main() {
 						Password:  c.String(influxPassword),
 						Database:  c.String(influxDB),
 						Retention: c.String(influxRetention),
+						Org:       c.String(influxOrg),
+						Bucket:    c.String(influxBucket),
+						Token:     c.String(influxToken),
 						Filter: influx.Filter{
 							Series:    c.String(influxFilterSeries),
 							TimeStart: c.String(influxFilterTimeStart),
@@ -43,9 +51,27 @@ func main() {
 						},
 						ChunkSize: c.Int(influxChunkSize),
 					}
-					influxClient, err := influx.NewClient(iCfg)
+					var influxClient influx.Reader
+					if iCfg.Token != "" {
+						fmt.Println("InfluxDB 2.x mode")
+						cl, err := influx.NewClientV2(iCfg)
+						if err != nil {
+							return fmt.Errorf("failed to create influx client: %s", err)
+						}
+						influxClient = cl
+					} else {
+						if iCfg.Database == "" {
+							return fmt.Errorf("flag %q must be set for InfluxDB 1.x; set %q for InfluxDB 2.x", influxDB, influxToken)
+						}
+						cl, err := influx.NewClient(iCfg)
+						if err != nil {
+							return fmt.Errorf("failed to create influx client: %s", err)
+						}
+						influxClient = cl
+					}
+					mapping, err := parseMeasurementMapping(c.StringSlice(influxMeasurementMapping))
 					if err != nil {
-						return fmt.Errorf("failed to create influx client: %s", err)
+						return err
 					}
 
 					vmCfg := initConfigVM(c)
@@ -55,7 +81,7 @@ func main() {
 					}
 
 					processor := newInfluxProcessor(influxClient, importer,
-						c.Int(influxConcurrency), c.String(influxMeasurementFieldSeparator))
+						c.Int(influxConcurrency), c.String(influxMeasurementFieldSeparator), mapping)
 					return processor.run(c.Bool(globalSilent))
 				},
 			},
@@ -93,6 +119,169 @@ func main() {
 					return pp.run(c.Bool(globalSilent))
 				},
 			},
+			{
+				Name:  "thanos",
+				Usage: "Migrate timeseries from Thanos, Cortex or Mimir block storage",
+				Flags: mergeFlags(globalFlags, thanosFlags, vmFlags),
+				Action: func(c *cli.Context) error {
+					fmt.Println("Thanos import mode")
+
+					vmCfg := initConfigVM(c)
+					// verify VM is reachable before reading blocks
+					importer, err := vm.NewImporter(vmCfg)
+					if err != nil {
+						return fmt.Errorf("failed to create VM importer: %s", err)
+					}
+					importer.Close()
+
+					thanosCfg := thanos.Config{
+						Src:              c.String(thanosSrc),
+						CredsFilePath:    c.String(thanosCredsFilePath),
+						CustomS3Endpoint: c.String(thanosCustomS3Endpoint),
+						TmpDir:           c.String(thanosTmpDir),
+						CheckpointFile:   c.String(thanosCheckpointFile),
+						Filter: thanos.Filter{
+							TimeMin:    c.String(thanosFilterTimeStart),
+							TimeMax:    c.String(thanosFilterTimeEnd),
+							Label:      c.String(thanosFilterLabel),
+							LabelValue: c.String(thanosFilterLabelValue),
+						},
+					}
+					cl, err := thanos.NewClient(thanosCfg)
+					if err != nil {
+						return fmt.Errorf("failed to create thanos client: %s", err)
+					}
+					tp := thanosProcessor{
+						cl:             cl,
+						vmCfg:          vmCfg,
+						cc:             c.Int(thanosConcurrency),
+						externalLabels: c.Bool(thanosExternalLabels),
+					}
+					return tp.run(c.Bool(globalSilent))
+				},
+			},
+			{
+				Name:  "opentsdb",
+				Usage: "Migrate timeseries from OpenTSDB",
+				Flags: mergeFlags(globalFlags, otsdbFlags, vmFlags),
+				Action: func(c *cli.Context) error {
+					fmt.Println("OpenTSDB import mode")
+
+					otsdbCfg := opentsdb.Config{
+						Addr:       c.String(otsdbAddr),
+						User:       c.String(otsdbUser),
+						Password:   c.String(otsdbPassword),
+						Filters:    c.StringSlice(otsdbFilters),
+						Limit:      c.Int(otsdbQueryLimit),
+						TimeStart:  c.String(otsdbFilterTimeStart),
+						TimeEnd:    c.String(otsdbFilterTimeEnd),
+						QueryChunk: c.Duration(otsdbQueryChunk),
+						RateLimit:  c.Float64(otsdbRateLimit),
+					}
+					otsdbClient, err := opentsdb.NewClient(otsdbCfg)
+					if err != nil {
+						return fmt.Errorf("failed to create opentsdb client: %s", err)
+					}
+
+					vmCfg := initConfigVM(c)
+					importer, err := vm.NewImporter(vmCfg)
+					if err != nil {
+						return fmt.Errorf("failed to create VM importer: %s", err)
+					}
+
+					processor := newOtsdbProcessor(otsdbClient, importer, c.Int(otsdbConcurrency))
+					return processor.run(c.Bool(globalSilent))
+				},
+			},
+			{
+				Name:  "promscale",
+				Usage: "Migrate timeseries from Promscale (TimescaleDB)",
+				Flags: mergeFlags(globalFlags, promscaleFlags, vmFlags),
+				Action: func(c *cli.Context) error {
+					fmt.Println("Promscale import mode")
+
+					psCfg := promscale.Config{
+						ConnString: c.String(promscaleConnString),
+						ChunkSize:  c.Int(promscaleChunkSize),
+						RateLimit:  c.Float64(promscaleRateLimit),
+						Filter: promscale.Filter{
+							Metric:    c.String(promscaleFilterMetric),
+							TimeStart: c.String(promscaleFilterTimeStart),
+							TimeEnd:   c.String(promscaleFilterTimeEnd),
+						},
+					}
+					psClient, err := promscale.NewClient(psCfg)
+					if err != nil {
+						return fmt.Errorf("failed to create promscale client: %s", err)
+					}
+					defer func() {
+						_ = psClient.Close()
+					}()
+
+					vmCfg := initConfigVM(c)
+					importer, err := vm.NewImporter(vmCfg)
+					if err != nil {
+						return fmt.Errorf("failed to create VM importer: %s", err)
+					}
+
+					processor := newPromscaleProcessor(psClient, importer, c.Int(promscaleConcurrency))
+					return processor.run(c.Bool(globalSilent))
+				},
+			},
+			{
+				Name:  "verify",
+				Usage: "Verify migrated data by comparing randomly sampled series at the source and VictoriaMetrics",
+				Flags: mergeFlags(globalFlags, verifyFlags),
+				Action: func(c *cli.Context) error {
+					fmt.Println("Verify migration mode")
+
+					verifyCfg := verify.Config{
+						Src: verify.Endpoint{
+							Addr:     c.String(verifySrcAddr),
+							User:     c.String(verifySrcUser),
+							Password: c.String(verifySrcPassword),
+						},
+						Dst: verify.Endpoint{
+							Addr:     c.String(verifyDstAddr),
+							User:     c.String(verifyDstUser),
+							Password: c.String(verifyDstPassword),
+						},
+						Match:              c.String(verifyFilterMatch),
+						TimeStart:          c.String(verifyFilterTimeStart),
+						TimeEnd:            c.String(verifyFilterTimeEnd),
+						Series:             c.Int(verifySeries),
+						Window:             c.Duration(verifyWindow),
+						WindowsPerSeries:   c.Int(verifyWindowsPerSeries),
+						SignificantFigures: c.Int(verifySignificantFigures),
+						RoundDigits:        c.Int(verifyRoundDigits),
+						DstExtraLabels:     c.StringSlice(verifyDstExtraLabel),
+						Concurrency:        c.Int(verifyConcurrency),
+					}
+					v, err := verify.NewVerifier(verifyCfg)
+					if err != nil {
+						return fmt.Errorf("failed to create verifier: %s", err)
+					}
+					windows, err := v.Explore()
+					if err != nil {
+						return fmt.Errorf("explore failed: %s", err)
+					}
+					if len(windows) < 1 {
+						return fmt.Errorf("found no timeseries to verify")
+					}
+					question := fmt.Sprintf("Found %d time ranges to verify. Continue?", len(windows))
+					if !c.Bool(globalSilent) && !prompt(question) {
+						return nil
+					}
+					bar := pb.StartNew(len(windows))
+					report := v.Verify(windows, func() { bar.Increment() })
+					bar.Finish()
+					log.Print(report)
+					if len(report.Divergences) > 0 {
+						return fmt.Errorf("found %d diverged time ranges; see the report above for details", len(report.Divergences))
+					}
+					return nil
+				},
+			},
 			{
 				Name:  "vm-native",
 				Usage: "Migrate time series between VictoriaMetrics installations via native binary format",
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sync"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmctl/opentsdb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmctl/vm"
+	"github.com/cheggaaa/pb/v3"
+)
+
+type otsdbProcessor struct {
+	oc *opentsdb.Client
+	im *vm.Importer
+	cc int
+}
+
+func newOtsdbProcessor(oc *opentsdb.Client, im *vm.Importer, cc int) *otsdbProcessor {
+	if cc < 1 {
+		cc = 1
+	}
+	return &otsdbProcessor{
+		oc: oc,
+		im: im,
+		cc: cc,
+	}
+}
+
+func (op *otsdbProcessor) run(silent bool) error {
+	series, err := op.oc.Explore()
+	if err != nil {
+		return fmt.Errorf("explore query failed: %s", err)
+	}
+	if len(series) < 1 {
+		return fmt.Errorf("found no timeseries to import")
+	}
+
+	question := fmt.Sprintf("Found %d timeseries to import. Continue?", len(series))
+	if !silent && !prompt(question) {
+		return nil
+	}
+
+	bar := pb.StartNew(len(series))
+	seriesCh := make(chan *opentsdb.Series)
+	errCh := make(chan error)
+	op.im.ResetStats()
+
+	var wg sync.WaitGroup
+	wg.Add(op.cc)
+	for i := 0; i < op.cc; i++ {
+		go func() {
+			defer wg.Done()
+			for s := range seriesCh {
+				if err := op.do(s); err != nil {
+					errCh <- fmt.Errorf("request failed for %q: %s", s.Metric, err)
+					return
+				}
+				bar.Increment()
+			}
+		}()
+	}
+
+	// any error breaks the import
+	for _, s := range series {
+		select {
+		case otsdbErr := <-errCh:
+			return fmt.Errorf("opentsdb error: %s", otsdbErr)
+		case vmErr := <-op.im.Errors():
+			return fmt.Errorf("Import process failed: \n%s", wrapErr(vmErr))
+		case seriesCh <- s:
+		}
+	}
+
+	close(seriesCh)
+	wg.Wait()
+	op.im.Close()
+	// drain import errors channel
+	for vmErr := range op.im.Errors() {
+		return fmt.Errorf("Import process failed: \n%s", wrapErr(vmErr))
+	}
+	bar.Finish()
+	log.Println("Import finished!")
+	log.Print(op.im.Stats())
+	return nil
+}
+
+func (op *otsdbProcessor) do(s *opentsdb.Series) error {
+	r := op.oc.FetchDataPoints(s)
+	labels := make([]vm.LabelPair, len(s.Tags))
+	for i, lp := range s.Tags {
+		labels[i] = vm.LabelPair{
+			Name:  lp.Name,
+			Value: lp.Value,
+		}
+	}
+	for {
+		timestamps, values, err := r.Next()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("failed to fetch datapoints: %s", err)
+		}
+		// skip empty results
+		if len(timestamps) < 1 {
+			continue
+		}
+		op.im.Input() <- &vm.TimeSeries{
+			Name:       s.Metric,
+			LabelPairs: labels,
+			Timestamps: timestamps,
+			Values:     values,
+		}
+	}
+}
@@ -0,0 +1,403 @@
+package opentsdb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmctl/limiter"
+)
+
+// Client represents OpenTSDB HTTP API client
+type Client struct {
+	addr     string
+	user     string
+	password string
+	c        *http.Client
+	rl       *limiter.Limiter
+
+	filters    []string
+	limit      int
+	start      int64
+	end        int64
+	queryChunk int64
+}
+
+// Config contains fields required
+// for Client configuration
+type Config struct {
+	Addr     string
+	User     string
+	Password string
+
+	// Filters contains metric name prefixes for selecting metrics to migrate.
+	// All the metrics are selected if Filters is empty
+	Filters []string
+	// Limit is the max number of metrics per filter
+	// and the max number of series per metric
+	Limit int
+
+	// TimeStart and TimeEnd limit the time range of migrated data.
+	// TimeStart is required. TimeEnd defaults to the current time
+	TimeStart string
+	TimeEnd   string
+	// QueryChunk is the time range fetched by a single query
+	QueryChunk time.Duration
+
+	// RateLimit is the max number of requests per second to OpenTSDB.
+	// Requests aren't limited if RateLimit isn't positive
+	RateLimit float64
+}
+
+// Series holds the time series
+type Series struct {
+	Metric string
+	Tags   []LabelPair
+}
+
+// LabelPair is the key-value record
+// of time series tag
+type LabelPair struct {
+	Name  string
+	Value string
+}
+
+// NewClient creates and returns OpenTSDB client
+// configured with passed Config
+func NewClient(cfg Config) (*Client, error) {
+	if cfg.TimeStart == "" {
+		return nil, fmt.Errorf("time start must be set")
+	}
+	start, err := time.Parse(time.RFC3339, cfg.TimeStart)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %q: %s", cfg.TimeStart, err)
+	}
+	end := time.Now()
+	if cfg.TimeEnd != "" {
+		end, err = time.Parse(time.RFC3339, cfg.TimeEnd)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %q: %s", cfg.TimeEnd, err)
+		}
+	}
+	if end.Before(start) {
+		return nil, fmt.Errorf("time end %s must be bigger than time start %s", end.Format(time.RFC3339), start.Format(time.RFC3339))
+	}
+	queryChunk := cfg.QueryChunk
+	if queryChunk < time.Millisecond {
+		queryChunk = 24 * time.Hour
+	}
+	limit := cfg.Limit
+	if limit < 1 {
+		limit = 1e3
+	}
+	filters := cfg.Filters
+	if len(filters) == 0 {
+		filters = []string{""}
+	}
+	c := &Client{
+		addr:       strings.TrimRight(cfg.Addr, "/"),
+		user:       cfg.User,
+		password:   cfg.Password,
+		c:          &http.Client{},
+		rl:         limiter.New(cfg.RateLimit),
+		filters:    filters,
+		limit:      limit,
+		start:      start.UnixNano() / 1e6,
+		end:        end.UnixNano() / 1e6,
+		queryChunk: int64(queryChunk / time.Millisecond),
+	}
+	if err := c.ping(); err != nil {
+		return nil, fmt.Errorf("ping failed: %s", err)
+	}
+	return c, nil
+}
+
+func (c *Client) ping() error {
+	req, err := http.NewRequest("GET", c.addr+"/api/version", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	return nil
+}
+
+// Explore returns all the series matching the configured filters
+func (c *Client) Explore() ([]*Series, error) {
+	var series []*Series
+	seen := make(map[string]bool)
+	for _, filter := range c.filters {
+		log.Printf("fetching metrics with prefix %q", filter)
+		metrics, err := c.FindMetrics(filter)
+		if err != nil {
+			return nil, fmt.Errorf("cannot find metrics with prefix %q: %s", filter, err)
+		}
+		for _, metric := range metrics {
+			if seen[metric] {
+				continue
+			}
+			seen[metric] = true
+			ss, err := c.FindSeries(metric)
+			if err != nil {
+				return nil, fmt.Errorf("cannot find series for metric %q: %s", metric, err)
+			}
+			series = append(series, ss...)
+		}
+	}
+	log.Printf("found %d series for %d metrics", len(series), len(seen))
+	return series, nil
+}
+
+// FindMetrics returns metric names starting with prefix
+func (c *Client) FindMetrics(prefix string) ([]string, error) {
+	args := url.Values{}
+	args.Set("type", "metrics")
+	args.Set("q", prefix)
+	args.Set("max", strconv.Itoa(c.limit))
+	req, err := http.NewRequest("GET", c.addr+"/api/suggest?"+args.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var metrics []string
+	if err := json.NewDecoder(resp.Body).Decode(&metrics); err != nil {
+		return nil, fmt.Errorf("cannot parse metrics list: %s", err)
+	}
+	if len(metrics) >= c.limit {
+		log.Printf("found %d metrics with prefix %q, which reaches the limit; some metrics may be skipped", len(metrics), prefix)
+	}
+	return metrics, nil
+}
+
+// FindSeries returns all the series for the given metric
+func (c *Client) FindSeries(metric string) ([]*Series, error) {
+	args := url.Values{}
+	args.Set("m", metric)
+	args.Set("limit", strconv.Itoa(c.limit))
+	req, err := http.NewRequest("GET", c.addr+"/api/search/lookup?"+args.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var r struct {
+		Results []struct {
+			Metric string            `json:"metric"`
+			Tags   map[string]string `json:"tags"`
+		} `json:"results"`
+		TotalResults int `json:"totalResults"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return nil, fmt.Errorf("cannot parse lookup response: %s", err)
+	}
+	if r.TotalResults > len(r.Results) {
+		log.Printf("metric %q has %d series, while only %d series are returned due to limit; some series will be skipped",
+			metric, r.TotalResults, len(r.Results))
+	}
+	series := make([]*Series, 0, len(r.Results))
+	for _, res := range r.Results {
+		series = append(series, &Series{
+			Metric: res.Metric,
+			Tags:   labelPairs(res.Tags),
+		})
+	}
+	return series, nil
+}
+
+func labelPairs(tags map[string]string) []LabelPair {
+	lps := make([]LabelPair, 0, len(tags))
+	for k, v := range tags {
+		lps = append(lps, LabelPair{
+			Name:  k,
+			Value: v,
+		})
+	}
+	sort.Slice(lps, func(i, j int) bool {
+		return lps[i].Name < lps[j].Name
+	})
+	return lps
+}
+
+// Response reads datapoints for a single series
+// with a separate query per each time chunk
+type Response struct {
+	c     *Client
+	s     *Series
+	start int64
+}
+
+// FetchDataPoints returns Response for reading datapoints for s
+func (c *Client) FetchDataPoints(s *Series) *Response {
+	return &Response{
+		c:     c,
+		s:     s,
+		start: c.start,
+	}
+}
+
+// Next returns datapoints for the next time chunk.
+// Returns io.EOF when time series was read entirely.
+func (r *Response) Next() ([]int64, []float64, error) {
+	if r.start > r.c.end {
+		return nil, nil, io.EOF
+	}
+	end := r.start + r.c.queryChunk - 1
+	if end > r.c.end {
+		end = r.c.end
+	}
+	timestamps, values, err := r.c.query(r.s, r.start, end)
+	if err != nil {
+		return nil, nil, err
+	}
+	r.start = end + 1
+	return timestamps, values, nil
+}
+
+type queryFilter struct {
+	Type    string `json:"type"`
+	Tagk    string `json:"tagk"`
+	Filter  string `json:"filter"`
+	GroupBy bool   `json:"groupBy"`
+}
+
+type subQuery struct {
+	Aggregator string        `json:"aggregator"`
+	Metric     string        `json:"metric"`
+	Filters    []queryFilter `json:"filters"`
+}
+
+type queryRequest struct {
+	Start        int64      `json:"start"`
+	End          int64      `json:"end"`
+	MsResolution bool       `json:"msResolution"`
+	Queries      []subQuery `json:"queries"`
+}
+
+type queryResult struct {
+	Metric string             `json:"metric"`
+	Tags   map[string]string  `json:"tags"`
+	Dps    map[string]float64 `json:"dps"`
+}
+
+func newQueryRequest(s *Series, start, end int64) queryRequest {
+	sq := subQuery{
+		Aggregator: "none",
+		Metric:     s.Metric,
+		Filters:    []queryFilter{},
+	}
+	for _, lp := range s.Tags {
+		sq.Filters = append(sq.Filters, queryFilter{
+			Type:    "literal_or",
+			Tagk:    lp.Name,
+			Filter:  lp.Value,
+			GroupBy: true,
+		})
+	}
+	return queryRequest{
+		Start:        start,
+		End:          end,
+		MsResolution: true,
+		Queries:      []subQuery{sq},
+	}
+}
+
+// query returns sorted datapoints for s on the time range [start..end] in milliseconds
+func (c *Client) query(s *Series, start, end int64) ([]int64, []float64, error) {
+	body, err := json.Marshal(newQueryRequest(s, start, end))
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := http.NewRequest("POST", c.addr+"/api/query", bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("query %s err: %s", body, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var results []queryResult
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return nil, nil, fmt.Errorf("cannot parse query response: %s", err)
+	}
+	for _, res := range results {
+		// Tag filters match series with additional tags too,
+		// so select only the series with exactly the same tags.
+		if len(res.Tags) != len(s.Tags) || !hasTags(res.Tags, s.Tags) {
+			continue
+		}
+		return parseDps(res.Dps)
+	}
+	return nil, nil, nil
+}
+
+func hasTags(tags map[string]string, lps []LabelPair) bool {
+	for _, lp := range lps {
+		if v, ok := tags[lp.Name]; !ok || v != lp.Value {
+			return false
+		}
+	}
+	return true
+}
+
+func parseDps(dps map[string]float64) ([]int64, []float64, error) {
+	type point struct {
+		ts    int64
+		value float64
+	}
+	points := make([]point, 0, len(dps))
+	for k, v := range dps {
+		ts, err := strconv.ParseInt(k, 10, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("cannot parse timestamp %q: %s", k, err)
+		}
+		points = append(points, point{ts: ts, value: v})
+	}
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].ts < points[j].ts
+	})
+	timestamps := make([]int64, len(points))
+	values := make([]float64, len(points))
+	for i, p := range points {
+		timestamps[i] = p.ts
+		values[i] = p.value
+	}
+	return timestamps, values, nil
+}
+
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	c.rl.Wait()
+	if c.user != "" {
+		req.SetBasicAuth(c.user, c.password)
+	}
+	resp, err := c.c.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("unexpected response code %d for %s %q; response body: %q", resp.StatusCode, req.Method, req.URL.Path, body)
+	}
+	return resp, nil
+}
@@ -0,0 +1,124 @@
+package opentsdb
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestClient(t *testing.T) {
+	var queries []queryRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, ok := r.BasicAuth(); !ok || u != "user" || p != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/version":
+			_, _ = w.Write([]byte(`{"version":"2.4.0"}`))
+		case "/api/suggest":
+			if q := r.URL.Query().Get("q"); q != "sys." {
+				t.Errorf("unexpected suggest prefix %q", q)
+			}
+			_, _ = w.Write([]byte(`["sys.cpu","sys.mem"]`))
+		case "/api/search/lookup":
+			switch r.URL.Query().Get("m") {
+			case "sys.cpu":
+				_, _ = w.Write([]byte(`{"results":[{"metric":"sys.cpu","tags":{"host":"h1","dc":"eu"}}],"totalResults":1}`))
+			case "sys.mem":
+				_, _ = w.Write([]byte(`{"results":[{"metric":"sys.mem","tags":{}}],"totalResults":1}`))
+			}
+		case "/api/query":
+			var q queryRequest
+			if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+				t.Errorf("cannot parse query: %s", err)
+			}
+			queries = append(queries, q)
+			if q.Start != 1577836800000 {
+				_, _ = w.Write([]byte(`[]`))
+				return
+			}
+			_, _ = w.Write([]byte(`[
+{"metric":"sys.cpu","tags":{"host":"h1","dc":"eu","core":"0"},"dps":{"1577836800000":100}},
+{"metric":"sys.cpu","tags":{"host":"h1","dc":"eu"},"dps":{"1577836810000":2,"1577836800000":1}}
+]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	c, err := NewClient(Config{
+		Addr:       srv.URL,
+		User:       "user",
+		Password:   "pass",
+		Filters:    []string{"sys."},
+		TimeStart:  "2020-01-01T00:00:00Z",
+		TimeEnd:    "2020-01-01T02:00:00Z",
+		QueryChunk: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("cannot create client: %s", err)
+	}
+
+	series, err := c.Explore()
+	if err != nil {
+		t.Fatalf("explore failed: %s", err)
+	}
+	expSeries := []*Series{
+		{Metric: "sys.cpu", Tags: []LabelPair{{Name: "dc", Value: "eu"}, {Name: "host", Value: "h1"}}},
+		{Metric: "sys.mem", Tags: []LabelPair{}},
+	}
+	if !reflect.DeepEqual(series, expSeries) {
+		t.Fatalf("unexpected series;\ngot\n%v\nwant\n%v", series, expSeries)
+	}
+
+	r := c.FetchDataPoints(series[0])
+	var timestamps []int64
+	var values []float64
+	for {
+		ts, vs, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		timestamps = append(timestamps, ts...)
+		values = append(values, vs...)
+	}
+	if !reflect.DeepEqual(timestamps, []int64{1577836800000, 1577836810000}) {
+		t.Fatalf("unexpected timestamps: %v", timestamps)
+	}
+	if !reflect.DeepEqual(values, []float64{1, 2}) {
+		t.Fatalf("unexpected values: %v", values)
+	}
+
+	// two hours are split into 3 queries, since the end is inclusive
+	if len(queries) != 3 {
+		t.Fatalf("unexpected number of queries; got %d; want 3", len(queries))
+	}
+	expQuery := queryRequest{
+		Start:        1577840400000,
+		End:          1577843999999,
+		MsResolution: true,
+		Queries: []subQuery{{
+			Aggregator: "none",
+			Metric:     "sys.cpu",
+			Filters: []queryFilter{
+				{Type: "literal_or", Tagk: "dc", Filter: "eu", GroupBy: true},
+				{Type: "literal_or", Tagk: "host", Filter: "h1", GroupBy: true},
+			},
+		}},
+	}
+	if !reflect.DeepEqual(queries[1], expQuery) {
+		t.Fatalf("unexpected query;\ngot\n%+v\nwant\n%+v", queries[1], expQuery)
+	}
+	if queries[2].Start != 1577844000000 || queries[2].End != 1577844000000 {
+		t.Fatalf("unexpected time range for the last query: [%d..%d]", queries[2].Start, queries[2].End)
+	}
+}
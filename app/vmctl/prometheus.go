@@ -8,6 +8,8 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmctl/prometheus"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmctl/vm"
 	"github.com/cheggaaa/pb/v3"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage"
 	"github.com/prometheus/prometheus/tsdb"
 )
 
@@ -90,23 +92,43 @@ func (pp *prometheusProcessor) do(b tsdb.BlockReader) error {
 	if err != nil {
 		return fmt.Errorf("failed to read block: %s", err)
 	}
+	if err := importSeriesSet(ss, pp.im, nil); err != nil {
+		return fmt.Errorf("failed to import block %v: %s", b.Meta().ULID, err)
+	}
+	return nil
+}
+
+// importSeriesSet sends series from ss to im.
+//
+// extraLabels are added to every series unless the series already has a label with the same name.
+func importSeriesSet(ss storage.SeriesSet, im *vm.Importer, extraLabels labels.Labels) error {
 	for ss.Next() {
 		var name string
-		var labels []vm.LabelPair
+		var labelPairs []vm.LabelPair
 		series := ss.At()
 
-		for _, label := range series.Labels() {
+		seriesLabels := series.Labels()
+		for _, label := range seriesLabels {
 			if label.Name == "__name__" {
 				name = label.Value
 				continue
 			}
-			labels = append(labels, vm.LabelPair{
+			labelPairs = append(labelPairs, vm.LabelPair{
 				Name:  label.Name,
 				Value: label.Value,
 			})
 		}
 		if name == "" {
-			return fmt.Errorf("failed to find `__name__` label in labelset for block %v", b.Meta().ULID)
+			return fmt.Errorf("failed to find `__name__` label in labelset %s", seriesLabels)
+		}
+		for _, label := range extraLabels {
+			if seriesLabels.Has(label.Name) {
+				continue
+			}
+			labelPairs = append(labelPairs, vm.LabelPair{
+				Name:  label.Name,
+				Value: label.Value,
+			})
 		}
 
 		var timestamps []int64
@@ -120,9 +142,9 @@ func (pp *prometheusProcessor) do(b tsdb.BlockReader) error {
 		if err := it.Err(); err != nil {
 			return err
 		}
-		pp.im.Input() <- &vm.TimeSeries{
+		im.Input() <- &vm.TimeSeries{
 			Name:       name,
-			LabelPairs: labels,
+			LabelPairs: labelPairs,
 			Timestamps: timestamps,
 			Values:     values,
 		}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sync"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmctl/promscale"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmctl/vm"
+	"github.com/cheggaaa/pb/v3"
+)
+
+type promscaleProcessor struct {
+	pc *promscale.Client
+	im *vm.Importer
+	cc int
+}
+
+func newPromscaleProcessor(pc *promscale.Client, im *vm.Importer, cc int) *promscaleProcessor {
+	if cc < 1 {
+		cc = 1
+	}
+	return &promscaleProcessor{
+		pc: pc,
+		im: im,
+		cc: cc,
+	}
+}
+
+func (pp *promscaleProcessor) run(silent bool) error {
+	series, err := pp.pc.Explore()
+	if err != nil {
+		return fmt.Errorf("explore query failed: %s", err)
+	}
+	if len(series) < 1 {
+		return fmt.Errorf("found no timeseries to import")
+	}
+
+	question := fmt.Sprintf("Found %d timeseries to import. Continue?", len(series))
+	if !silent && !prompt(question) {
+		return nil
+	}
+
+	bar := pb.StartNew(len(series))
+	seriesCh := make(chan *promscale.Series)
+	errCh := make(chan error)
+	pp.im.ResetStats()
+
+	var wg sync.WaitGroup
+	wg.Add(pp.cc)
+	for i := 0; i < pp.cc; i++ {
+		go func() {
+			defer wg.Done()
+			for s := range seriesCh {
+				if err := pp.do(s); err != nil {
+					errCh <- fmt.Errorf("request failed for %q with series_id=%d: %s", s.Metric, s.ID, err)
+					return
+				}
+				bar.Increment()
+			}
+		}()
+	}
+
+	// any error breaks the import
+	for _, s := range series {
+		select {
+		case psErr := <-errCh:
+			return fmt.Errorf("promscale error: %s", psErr)
+		case vmErr := <-pp.im.Errors():
+			return fmt.Errorf("Import process failed: \n%s", wrapErr(vmErr))
+		case seriesCh <- s:
+		}
+	}
+
+	close(seriesCh)
+	wg.Wait()
+	pp.im.Close()
+	// drain import errors channel
+	for vmErr := range pp.im.Errors() {
+		return fmt.Errorf("Import process failed: \n%s", wrapErr(vmErr))
+	}
+	bar.Finish()
+	log.Println("Import finished!")
+	log.Print(pp.im.Stats())
+	return nil
+}
+
+func (pp *promscaleProcessor) do(s *promscale.Series) error {
+	r, err := pp.pc.FetchDataPoints(s)
+	if err != nil {
+		return fmt.Errorf("failed to fetch datapoints: %s", err)
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+	labels := make([]vm.LabelPair, len(s.LabelPairs))
+	for i, lp := range s.LabelPairs {
+		labels[i] = vm.LabelPair{
+			Name:  lp.Name,
+			Value: lp.Value,
+		}
+	}
+	for {
+		timestamps, values, err := r.Next()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("failed to fetch datapoints: %s", err)
+		}
+		// skip empty results
+		if len(timestamps) < 1 {
+			continue
+		}
+		pp.im.Input() <- &vm.TimeSeries{
+			Name:       s.Metric,
+			LabelPairs: labels,
+			Timestamps: timestamps,
+			Values:     values,
+		}
+	}
+}
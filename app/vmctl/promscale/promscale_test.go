@@ -0,0 +1,52 @@
+package promscale
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFetchQuery(t *testing.T) {
+	f := func(c *Client, s *Series, expected string) {
+		t.Helper()
+		got := c.fetchQuery(s)
+		if got != expected {
+			t.Fatalf("unexpected query;\ngot\n%s\nwant\n%s", got, expected)
+		}
+	}
+	s := &Series{
+		ID:     42,
+		Metric: "cpu_usage",
+		table:  `cpu"usage`,
+	}
+	f(&Client{}, s, `DECLARE vmctl_cursor NO SCROLL CURSOR FOR SELECT time, value FROM prom_data."cpu""usage" WHERE series_id = 42 ORDER BY time`)
+
+	start, _ := time.Parse(time.RFC3339, "2020-01-01T00:00:00Z")
+	end, _ := time.Parse(time.RFC3339, "2020-01-02T00:00:00+02:00")
+	f(&Client{timeStart: start}, s, `DECLARE vmctl_cursor NO SCROLL CURSOR FOR SELECT time, value FROM prom_data."cpu""usage" `+
+		`WHERE series_id = 42 AND time >= '2020-01-01T00:00:00Z'::timestamptz ORDER BY time`)
+	f(&Client{timeStart: start, timeEnd: end}, s, `DECLARE vmctl_cursor NO SCROLL CURSOR FOR SELECT time, value FROM prom_data."cpu""usage" `+
+		`WHERE series_id = 42 AND time >= '2020-01-01T00:00:00Z'::timestamptz AND time <= '2020-01-02T00:00:00+02:00'::timestamptz ORDER BY time`)
+}
+
+func TestParseLabels(t *testing.T) {
+	f := func(s string, expected []LabelPair) {
+		t.Helper()
+		got, err := parseLabels(s)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(got, expected) {
+			t.Fatalf("unexpected labels;\ngot\n%v\nwant\n%v", got, expected)
+		}
+	}
+	f(`{"__name__": "cpu_usage"}`, []LabelPair{})
+	f(`{"job": "node", "__name__": "cpu_usage", "instance": "localhost:9100"}`, []LabelPair{
+		{Name: "instance", Value: "localhost:9100"},
+		{Name: "job", Value: "node"},
+	})
+
+	if _, err := parseLabels(`{"foo"`); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+}
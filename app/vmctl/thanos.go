@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmctl/thanos"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmctl/vm"
+	"github.com/cheggaaa/pb/v3"
+)
+
+type thanosProcessor struct {
+	// thanos client lists, downloads and reads
+	// blocks from the object storage
+	cl *thanos.Client
+	// vmCfg is the config for importers.
+	// A separate importer is created per each block,
+	// so the block is marked as imported in the checkpoint file
+	// only after all its data is flushed to VM
+	vmCfg vm.Config
+	// cc stands for concurrency
+	// and defines number of concurrently
+	// running block readers
+	cc int
+	// externalLabels defines whether Thanos external labels
+	// from block meta must be added to imported timeseries
+	externalLabels bool
+}
+
+func (tp *thanosProcessor) run(silent bool) error {
+	blocks, err := tp.cl.Explore()
+	if err != nil {
+		return fmt.Errorf("explore failed: %s", err)
+	}
+	if len(blocks) < 1 {
+		return fmt.Errorf("found no blocks to import")
+	}
+	question := fmt.Sprintf("Found %d blocks to import. Continue?", len(blocks))
+	if !silent && !prompt(question) {
+		return nil
+	}
+
+	bar := pb.StartNew(len(blocks))
+	blocksCh := make(chan *thanos.Block)
+	errCh := make(chan error, tp.cc)
+
+	var wg sync.WaitGroup
+	wg.Add(tp.cc)
+	for i := 0; i < tp.cc; i++ {
+		go func() {
+			defer wg.Done()
+			for b := range blocksCh {
+				if err := tp.do(b); err != nil {
+					errCh <- fmt.Errorf("import failed for block %q: %s", b.Dir, err)
+					return
+				}
+				bar.Increment()
+			}
+		}()
+	}
+
+	// any error breaks the import
+	for _, b := range blocks {
+		select {
+		case err := <-errCh:
+			close(blocksCh)
+			wg.Wait()
+			return err
+		case blocksCh <- b:
+		}
+	}
+
+	close(blocksCh)
+	wg.Wait()
+	close(errCh)
+	for err := range errCh {
+		return err
+	}
+	bar.Finish()
+	log.Println("Import finished!")
+	return nil
+}
+
+func (tp *thanosProcessor) do(b *thanos.Block) error {
+	tb, err := tp.cl.Download(b)
+	if err != nil {
+		return fmt.Errorf("failed to download block: %s", err)
+	}
+	defer func() {
+		if err := tp.cl.Remove(tb); err != nil {
+			log.Printf("failed to remove temporary files for block %q: %s", b.Dir, err)
+		}
+	}()
+	q, ss, err := tp.cl.Read(tb)
+	if err != nil {
+		return fmt.Errorf("failed to read block: %s", err)
+	}
+	defer func() { _ = q.Close() }()
+	im, err := vm.NewImporter(tp.vmCfg)
+	if err != nil {
+		return fmt.Errorf("failed to create VM importer: %s", err)
+	}
+	var extraLabels = b.ExternalLabels
+	if !tp.externalLabels {
+		extraLabels = nil
+	}
+	// collect import errors in background, so importer workers never block on sending them
+	var vmErr *vm.ImportError
+	vmErrDone := make(chan struct{})
+	go func() {
+		defer close(vmErrDone)
+		for err := range im.Errors() {
+			if vmErr == nil {
+				vmErr = err
+			}
+		}
+	}()
+	err = importSeriesSet(ss, im, extraLabels)
+	// wait for all buffers to flush
+	im.Close()
+	<-vmErrDone
+	if err != nil {
+		return err
+	}
+	if vmErr != nil {
+		return fmt.Errorf("Import process failed: \n%s", wrapErr(vmErr))
+	}
+	return tp.cl.MarkImported(b)
+}
@@ -0,0 +1,247 @@
+package thanos
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+// bucket provides access to objects in the object storage.
+type bucket interface {
+	// List returns names for all the objects in the bucket.
+	//
+	// Names are relative to the bucket root.
+	List() ([]string, error)
+
+	// Download writes the contents of the object with the given name to w.
+	Download(name string, w io.Writer) error
+
+	// String returns human-readable description for the bucket.
+	String() string
+}
+
+// newBucket returns bucket for the given src.
+//
+// src may have the following forms: s3://bucket/path, gcs://bucket/path, gs://bucket/path or fs:///path.
+func newBucket(src, credsFilePath, customS3Endpoint string) (bucket, error) {
+	n := strings.Index(src, "://")
+	if n < 0 {
+		return nil, fmt.Errorf("missing scheme in %q; supported schemes: s3://, gcs://, gs://, fs://", src)
+	}
+	scheme := src[:n]
+	path := src[n+len("://"):]
+	if scheme == "fs" {
+		if !filepath.IsAbs(path) {
+			return nil, fmt.Errorf("path must be absolute for fs://; got %q", path)
+		}
+		return &fsBucket{dir: filepath.Clean(path)}, nil
+	}
+	n = strings.Index(path, "/")
+	bkt, dir := path, ""
+	if n >= 0 {
+		bkt, dir = path[:n], strings.Trim(path[n+1:], "/")
+	}
+	if len(bkt) == 0 {
+		return nil, fmt.Errorf("bucket name cannot be empty in %q", src)
+	}
+	if len(dir) > 0 {
+		dir += "/"
+	}
+	switch scheme {
+	case "s3":
+		return newS3Bucket(bkt, dir, credsFilePath, customS3Endpoint)
+	case "gcs", "gs":
+		return newGCSBucket(bkt, dir, credsFilePath)
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q in %q; supported schemes: s3://, gcs://, gs://, fs://", scheme, src)
+	}
+}
+
+type fsBucket struct {
+	dir string
+}
+
+func (b *fsBucket) List() ([]string, error) {
+	var names []string
+	err := filepath.Walk(b.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		name, err := filepath.Rel(b.dir, path)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(name))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot list files at %q: %s", b.dir, err)
+	}
+	return names, nil
+}
+
+func (b *fsBucket) Download(name string, w io.Writer) error {
+	path := filepath.Join(b.dir, filepath.FromSlash(name))
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, f)
+	_ = f.Close()
+	if err != nil {
+		return fmt.Errorf("cannot read %q: %s", path, err)
+	}
+	return nil
+}
+
+func (b *fsBucket) String() string {
+	return fmt.Sprintf("fs://%s", b.dir)
+}
+
+type s3Bucket struct {
+	bucket string
+	dir    string
+	s3     *s3.S3
+}
+
+func newS3Bucket(bkt, dir, credsFilePath, customEndpoint string) (*s3Bucket, error) {
+	opts := session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+	}
+	if len(credsFilePath) > 0 {
+		opts.SharedConfigFiles = []string{credsFilePath}
+	}
+	sess, err := session.NewSessionWithOptions(opts)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create S3 session: %s", err)
+	}
+	if len(customEndpoint) > 0 {
+		sess.Config.WithEndpoint(customEndpoint)
+		// Disable prefixing endpoint with bucket name
+		sess.Config.WithS3ForcePathStyle(true)
+	} else {
+		region, err := s3manager.GetBucketRegion(context.Background(), sess, bkt, "us-west-2")
+		if err != nil {
+			return nil, fmt.Errorf("cannot determine region for bucket %q: %s", bkt, err)
+		}
+		sess.Config.WithRegion(region)
+	}
+	return &s3Bucket{
+		bucket: bkt,
+		dir:    dir,
+		s3:     s3.New(sess),
+	}, nil
+}
+
+func (b *s3Bucket) List() ([]string, error) {
+	input := &s3.ListObjectsV2Input{
+		Bucket: aws.String(b.bucket),
+		Prefix: aws.String(b.dir),
+	}
+	var names []string
+	err := b.s3.ListObjectsV2Pages(input, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, o := range page.Contents {
+			names = append(names, strings.TrimPrefix(*o.Key, b.dir))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cannot list objects at %s: %s", b, err)
+	}
+	return names, nil
+}
+
+func (b *s3Bucket) Download(name string, w io.Writer) error {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(b.dir + name),
+	}
+	o, err := b.s3.GetObject(input)
+	if err != nil {
+		return fmt.Errorf("cannot open %q at %s: %s", name, b, err)
+	}
+	_, err = io.Copy(w, o.Body)
+	_ = o.Body.Close()
+	if err != nil {
+		return fmt.Errorf("cannot download %q from %s: %s", name, b, err)
+	}
+	return nil
+}
+
+func (b *s3Bucket) String() string {
+	return fmt.Sprintf("s3://%s/%s", b.bucket, b.dir)
+}
+
+type gcsBucket struct {
+	bucket string
+	dir    string
+	bkt    *storage.BucketHandle
+}
+
+func newGCSBucket(bkt, dir, credsFilePath string) (*gcsBucket, error) {
+	var opts []option.ClientOption
+	if len(credsFilePath) > 0 {
+		opts = append(opts, option.WithCredentialsFile(credsFilePath))
+	}
+	client, err := storage.NewClient(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create gcs client: %s", err)
+	}
+	return &gcsBucket{
+		bucket: bkt,
+		dir:    dir,
+		bkt:    client.Bucket(bkt),
+	}, nil
+}
+
+func (b *gcsBucket) List() ([]string, error) {
+	q := &storage.Query{
+		Prefix: b.dir,
+	}
+	if err := q.SetAttrSelection([]string{"Name"}); err != nil {
+		return nil, fmt.Errorf("cannot set attributes selection: %s", err)
+	}
+	it := b.bkt.Objects(context.Background(), q)
+	var names []string
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			return names, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("cannot list objects at %s: %s", b, err)
+		}
+		names = append(names, strings.TrimPrefix(attrs.Name, b.dir))
+	}
+}
+
+func (b *gcsBucket) Download(name string, w io.Writer) error {
+	r, err := b.bkt.Object(b.dir + name).NewReader(context.Background())
+	if err != nil {
+		return fmt.Errorf("cannot open %q at %s: %s", name, b, err)
+	}
+	_, err = io.Copy(w, r)
+	_ = r.Close()
+	if err != nil {
+		return fmt.Errorf("cannot download %q from %s: %s", name, b, err)
+	}
+	return nil
+}
+
+func (b *gcsBucket) String() string {
+	return fmt.Sprintf("gcs://%s/%s", b.bucket, b.dir)
+}
@@ -0,0 +1,383 @@
+package thanos
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/storage"
+	"github.com/prometheus/prometheus/tsdb"
+)
+
+// Config contains a list of params needed
+// for reading blocks from Thanos, Cortex or Mimir block storage
+type Config struct {
+	// Src is the path to blocks in the object storage,
+	// e.g. s3://bucket/path, gcs://bucket/path or fs:///path
+	Src string
+
+	// CredsFilePath is an optional path to file with GCS or S3 credentials
+	CredsFilePath string
+
+	// CustomS3Endpoint is an optional custom S3 endpoint for S3-compatible storages
+	CustomS3Endpoint string
+
+	// TmpDir is the directory for temporary storing downloaded blocks
+	TmpDir string
+
+	// CheckpointFile is an optional path to file with the list of already imported blocks
+	CheckpointFile string
+
+	Filter Filter
+}
+
+// Filter contains configuration for filtering
+// the timeseries
+type Filter struct {
+	TimeMin    string
+	TimeMax    string
+	Label      string
+	LabelValue string
+}
+
+// Block contains information about a block in the object storage
+type Block struct {
+	// Dir is the block dir relative to Config.Src
+	Dir string
+
+	Meta tsdb.BlockMeta
+
+	// ExternalLabels contains Thanos external labels for the block
+	ExternalLabels labels.Labels
+
+	// files contains names for block files relative to Dir
+	files []string
+}
+
+// Client reads blocks from Thanos, Cortex or Mimir block storage
+type Client struct {
+	bkt    bucket
+	tmpDir string
+	filter filter
+
+	checkpointFile string
+	checkpointLock sync.Mutex
+	imported       map[string]bool
+}
+
+type filter struct {
+	min, max   int64
+	label      string
+	labelValue string
+}
+
+func (f filter) inRange(min, max int64) bool {
+	fmin, fmax := f.min, f.max
+	if fmax == 0 {
+		fmax = max
+	}
+	return min <= fmax && fmin <= max
+}
+
+// NewClient creates and validates new Client
+// with given Config
+func NewClient(cfg Config) (*Client, error) {
+	bkt, err := newBucket(cfg.Src, cfg.CredsFilePath, cfg.CustomS3Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open block storage %q: %s", cfg.Src, err)
+	}
+	min, max, err := parseTime(cfg.Filter.TimeMin, cfg.Filter.TimeMax)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse time in filter: %s", err)
+	}
+	tmpDir := cfg.TmpDir
+	if tmpDir == "" {
+		tmpDir = os.TempDir()
+	}
+	c := &Client{
+		bkt:    bkt,
+		tmpDir: tmpDir,
+		filter: filter{
+			min:        min,
+			max:        max,
+			label:      cfg.Filter.Label,
+			labelValue: cfg.Filter.LabelValue,
+		},
+		checkpointFile: cfg.CheckpointFile,
+		imported:       make(map[string]bool),
+	}
+	if c.checkpointFile != "" {
+		if err := c.readCheckpoint(); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// blockDirRegexp matches block dirs named by ULID.
+var blockDirRegexp = regexp.MustCompile(`^[0-9A-HJKMNP-TV-Z]{26}$`)
+
+// Explore lists blocks in the object storage and returns blocks
+// to import.
+// Explore skips blocks marked for deletion, downsampled blocks,
+// blocks already imported according to the checkpoint file
+// and blocks outside the time range from filter.
+// It does not take into account label filters.
+func (c *Client) Explore() ([]*Block, error) {
+	names, err := c.bkt.List()
+	if err != nil {
+		return nil, err
+	}
+	deletionMarks := make(map[string]bool)
+	blocks := make(map[string]*Block)
+	for _, name := range names {
+		if strings.HasPrefix(name, "markers/") && strings.HasSuffix(name, "-deletion-mark.json") {
+			// Cortex and Mimir store deletion marks in the global markers dir.
+			id := strings.TrimSuffix(strings.TrimPrefix(name, "markers/"), "-deletion-mark.json")
+			deletionMarks[id] = true
+			continue
+		}
+		n := strings.Index(name, "/")
+		if n < 0 || !blockDirRegexp.MatchString(name[:n]) {
+			continue
+		}
+		dir, file := name[:n], name[n+1:]
+		if file == "deletion-mark.json" {
+			deletionMarks[dir] = true
+			continue
+		}
+		b := blocks[dir]
+		if b == nil {
+			b = &Block{Dir: dir}
+			blocks[dir] = b
+		}
+		b.files = append(b.files, file)
+	}
+
+	s := &Stats{
+		Filtered: c.filter.min != 0 || c.filter.max != 0 || c.filter.label != "",
+		Blocks:   len(blocks),
+	}
+	var blocksToImport []*Block
+	for dir, b := range blocks {
+		if deletionMarks[dir] {
+			s.DeletedBlocks++
+			continue
+		}
+		if c.isImported(dir) {
+			s.ImportedBlocks++
+			continue
+		}
+		downsampled, err := c.readMeta(b)
+		if err != nil {
+			return nil, err
+		}
+		if downsampled {
+			// Downsampled blocks contain aggregated chunks, which cannot be read as raw samples.
+			s.DownsampledBlocks++
+			continue
+		}
+		meta := b.Meta
+		if !c.filter.inRange(meta.MinTime, meta.MaxTime) {
+			s.SkippedBlocks++
+			continue
+		}
+		if s.MinTime == 0 || meta.MinTime < s.MinTime {
+			s.MinTime = meta.MinTime
+		}
+		if s.MaxTime == 0 || meta.MaxTime > s.MaxTime {
+			s.MaxTime = meta.MaxTime
+		}
+		s.Samples += meta.Stats.NumSamples
+		s.Series += meta.Stats.NumSeries
+		blocksToImport = append(blocksToImport, b)
+	}
+	sort.Slice(blocksToImport, func(i, j int) bool {
+		return blocksToImport[i].Meta.MinTime < blocksToImport[j].Meta.MinTime
+	})
+	fmt.Println(s)
+	return blocksToImport, nil
+}
+
+// blockMeta is the contents of meta.json file for the block.
+type blockMeta struct {
+	tsdb.BlockMeta
+
+	// Thanos contains metadata added by Thanos
+	Thanos struct {
+		Labels     map[string]string `json:"labels"`
+		Downsample struct {
+			Resolution int64 `json:"resolution"`
+		} `json:"downsample"`
+	} `json:"thanos"`
+}
+
+// readMeta reads meta.json for b and returns true if b is downsampled.
+func (c *Client) readMeta(b *Block) (bool, error) {
+	var bb bytes.Buffer
+	if err := c.bkt.Download(path.Join(b.Dir, "meta.json"), &bb); err != nil {
+		return false, fmt.Errorf("failed to read meta.json for block %q: %s", b.Dir, err)
+	}
+	var meta blockMeta
+	if err := json.Unmarshal(bb.Bytes(), &meta); err != nil {
+		return false, fmt.Errorf("failed to parse meta.json for block %q: %s", b.Dir, err)
+	}
+	b.Meta = meta.BlockMeta
+	b.ExternalLabels = labels.FromMap(meta.Thanos.Labels)
+	return meta.Thanos.Downsample.Resolution > 0, nil
+}
+
+// Download downloads b into temporary dir and opens it.
+//
+// The returned block must be closed and removed with Remove call.
+func (c *Client) Download(b *Block) (*tsdb.Block, error) {
+	dir := filepath.Join(c.tmpDir, b.Dir)
+	if err := os.RemoveAll(dir); err != nil {
+		return nil, fmt.Errorf("failed to remove stale dir %q: %s", dir, err)
+	}
+	for _, file := range b.files {
+		dstPath := filepath.Join(dir, filepath.FromSlash(file))
+		if err := c.downloadFile(path.Join(b.Dir, file), dstPath); err != nil {
+			_ = os.RemoveAll(dir)
+			return nil, err
+		}
+	}
+	tb, err := tsdb.OpenBlock(nil, dir, nil)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return nil, fmt.Errorf("failed to open block %q: %s", b.Dir, err)
+	}
+	return tb, nil
+}
+
+func (c *Client) downloadFile(name, dstPath string) error {
+	if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
+		return fmt.Errorf("failed to create dir for %q: %s", dstPath, err)
+	}
+	f, err := os.Create(dstPath)
+	if err != nil {
+		return fmt.Errorf("failed to create %q: %s", dstPath, err)
+	}
+	w := bufio.NewWriterSize(f, 1024*1024)
+	err = c.bkt.Download(name, w)
+	if err == nil {
+		err = w.Flush()
+	}
+	if errClose := f.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return fmt.Errorf("failed to download %q from %s: %s", name, c.bkt, err)
+	}
+	return nil
+}
+
+// Remove closes tb returned from Download and removes its files.
+func (c *Client) Remove(tb *tsdb.Block) error {
+	if err := tb.Close(); err != nil {
+		return err
+	}
+	return os.RemoveAll(tb.Dir())
+}
+
+// Read reads the given BlockReader according to configured
+// time and label filters.
+//
+// The returned querier must be closed after reading the returned series.
+func (c *Client) Read(block tsdb.BlockReader) (storage.Querier, storage.SeriesSet, error) {
+	minTime, maxTime := block.Meta().MinTime, block.Meta().MaxTime
+	if c.filter.min != 0 {
+		minTime = c.filter.min
+	}
+	if c.filter.max != 0 {
+		maxTime = c.filter.max
+	}
+	q, err := tsdb.NewBlockQuerier(block, minTime, maxTime)
+	if err != nil {
+		return nil, nil, err
+	}
+	ss := q.Select(false, nil, labels.MustNewMatcher(labels.MatchRegexp, c.filter.label, c.filter.labelValue))
+	return q, ss, nil
+}
+
+// MarkImported records b as imported in the checkpoint file,
+// so it is skipped on the next run.
+func (c *Client) MarkImported(b *Block) error {
+	c.checkpointLock.Lock()
+	defer c.checkpointLock.Unlock()
+	c.imported[b.Dir] = true
+	if c.checkpointFile == "" {
+		return nil
+	}
+	f, err := os.OpenFile(c.checkpointFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open checkpoint file: %s", err)
+	}
+	_, err = fmt.Fprintln(f, b.Dir)
+	if err == nil {
+		err = f.Sync()
+	}
+	if errClose := f.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write checkpoint file %q: %s", c.checkpointFile, err)
+	}
+	return nil
+}
+
+func (c *Client) isImported(dir string) bool {
+	c.checkpointLock.Lock()
+	defer c.checkpointLock.Unlock()
+	return c.imported[dir]
+}
+
+func (c *Client) readCheckpoint() error {
+	data, err := ioutil.ReadFile(c.checkpointFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read checkpoint file: %s", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			c.imported[line] = true
+		}
+	}
+	return nil
+}
+
+func parseTime(start, end string) (int64, int64, error) {
+	var s, e int64
+	if start == "" && end == "" {
+		return 0, 0, nil
+	}
+	if start != "" {
+		v, err := time.Parse(time.RFC3339, start)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to parse %q: %s", start, err)
+		}
+		s = v.UnixNano() / int64(time.Millisecond)
+	}
+	if end != "" {
+		v, err := time.Parse(time.RFC3339, end)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to parse %q: %s", end, err)
+		}
+		e = v.UnixNano() / int64(time.Millisecond)
+	}
+	return s, e, nil
+}
@@ -0,0 +1,198 @@
+package thanos
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/tsdb"
+)
+
+func TestInRange(t *testing.T) {
+	testCases := []struct {
+		filterMin, filterMax int64
+		blockMin, blockMax   int64
+		expected             bool
+	}{
+		{0, 0, 1, 2, true},
+		{0, 3, 1, 2, true},
+		{0, 3, 4, 5, false},
+		{3, 0, 1, 2, false},
+		{3, 0, 2, 4, true},
+		{3, 10, 1, 2, false},
+		{3, 10, 1, 4, true},
+		{3, 10, 5, 9, true},
+		{3, 10, 9, 12, true},
+		{3, 10, 12, 15, false},
+	}
+	for _, tc := range testCases {
+		f := filter{
+			min: tc.filterMin,
+			max: tc.filterMax,
+		}
+		got := f.inRange(tc.blockMin, tc.blockMax)
+		if got != tc.expected {
+			t.Fatalf("got %v; expected %v: %v", got, tc.expected, tc)
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "vmctl-thanos")
+	if err != nil {
+		t.Fatalf("cannot create temporary dir: %s", err)
+	}
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+
+	bucketDir := filepath.Join(tmpDir, "bucket")
+	writeBlock := func(ts int64, metas ...string) string {
+		t.Helper()
+		w, err := tsdb.NewBlockWriter(nopLogger{}, bucketDir, tsdb.DefaultBlockDuration)
+		if err != nil {
+			t.Fatalf("cannot create block writer: %s", err)
+		}
+		app := w.Appender(context.Background())
+		for _, name := range metas {
+			if _, err := app.Add(labels.FromStrings("__name__", name, "job", "test"), ts, 1); err != nil {
+				t.Fatalf("cannot add sample: %s", err)
+			}
+		}
+		if err := app.Commit(); err != nil {
+			t.Fatalf("cannot commit samples: %s", err)
+		}
+		id, err := w.Flush(context.Background())
+		if err != nil {
+			t.Fatalf("cannot flush block: %s", err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("cannot close block writer: %s", err)
+		}
+		return id.String()
+	}
+	addThanosMeta := func(id string, thanosMeta string) {
+		t.Helper()
+		path := filepath.Join(bucketDir, id, "meta.json")
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("cannot read meta.json: %s", err)
+		}
+		var meta map[string]interface{}
+		if err := json.Unmarshal(data, &meta); err != nil {
+			t.Fatalf("cannot parse meta.json: %s", err)
+		}
+		var tm interface{}
+		if err := json.Unmarshal([]byte(thanosMeta), &tm); err != nil {
+			t.Fatalf("cannot parse thanos meta: %s", err)
+		}
+		meta["thanos"] = tm
+		data, _ = json.Marshal(meta)
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatalf("cannot write meta.json: %s", err)
+		}
+	}
+
+	id1 := writeBlock(1000, "foo", "bar")
+	addThanosMeta(id1, `{"labels":{"cluster":"a"},"downsample":{"resolution":0}}`)
+	id2 := writeBlock(tsdb.DefaultBlockDuration*2, "foo")
+	deleted := writeBlock(1000, "deleted")
+	if err := ioutil.WriteFile(filepath.Join(bucketDir, deleted, "deletion-mark.json"), []byte(`{}`), 0644); err != nil {
+		t.Fatalf("cannot write deletion mark: %s", err)
+	}
+	downsampled := writeBlock(1000, "downsampled")
+	addThanosMeta(downsampled, `{"downsample":{"resolution":300000}}`)
+
+	newClient := func(f Filter) *Client {
+		t.Helper()
+		c, err := NewClient(Config{
+			Src:            "fs://" + bucketDir,
+			TmpDir:         filepath.Join(tmpDir, "tmp"),
+			CheckpointFile: filepath.Join(tmpDir, "checkpoint"),
+			Filter:         f,
+		})
+		if err != nil {
+			t.Fatalf("cannot create client: %s", err)
+		}
+		return c
+	}
+	explore := func(c *Client) []string {
+		t.Helper()
+		blocks, err := c.Explore()
+		if err != nil {
+			t.Fatalf("cannot explore blocks: %s", err)
+		}
+		var ids []string
+		for _, b := range blocks {
+			ids = append(ids, b.Dir)
+		}
+		return ids
+	}
+	equal := func(a, b []string) bool {
+		if len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if a[i] != b[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	c := newClient(Filter{LabelValue: ".*"})
+	blocks, err := c.Explore()
+	if err != nil {
+		t.Fatalf("cannot explore blocks: %s", err)
+	}
+	if len(blocks) != 2 || blocks[0].Dir != id1 || blocks[1].Dir != id2 {
+		t.Fatalf("unexpected blocks; got %v; want [%s %s]", blocks, id1, id2)
+	}
+	if got := blocks[0].ExternalLabels.String(); got != `{cluster="a"}` {
+		t.Fatalf("unexpected external labels; got %s; want %s", got, `{cluster="a"}`)
+	}
+
+	// Read the first block with label filter.
+	c = newClient(Filter{Label: "__name__", LabelValue: "foo"})
+	tb, err := c.Download(blocks[0])
+	if err != nil {
+		t.Fatalf("cannot download block: %s", err)
+	}
+	q, ss, err := c.Read(tb)
+	if err != nil {
+		t.Fatalf("cannot read block: %s", err)
+	}
+	var series []string
+	for ss.Next() {
+		series = append(series, ss.At().Labels().String())
+	}
+	if err := ss.Err(); err != nil {
+		t.Fatalf("cannot read series: %s", err)
+	}
+	if err := q.Close(); err != nil {
+		t.Fatalf("cannot close querier: %s", err)
+	}
+	if !equal(series, []string{`{__name__="foo", job="test"}`}) {
+		t.Fatalf("unexpected series read; got %q", series)
+	}
+	if err := c.Remove(tb); err != nil {
+		t.Fatalf("cannot remove block: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "tmp", id1)); !os.IsNotExist(err) {
+		t.Fatalf("expecting temporary block dir to be removed; got %v", err)
+	}
+
+	// Imported blocks must be skipped on the next run.
+	if err := c.MarkImported(blocks[0]); err != nil {
+		t.Fatalf("cannot mark block as imported: %s", err)
+	}
+	if ids := explore(newClient(Filter{LabelValue: ".*"})); !equal(ids, []string{id2}) {
+		t.Fatalf("unexpected blocks after checkpoint; got %q; want %q", ids, []string{id2})
+	}
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Log(...interface{}) error { return nil }
@@ -0,0 +1,465 @@
+package verify
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/decimal"
+	"github.com/cespare/xxhash/v2"
+)
+
+// Config contains fields required for migration verification
+type Config struct {
+	// Src and Dst must support Prometheus querying API
+	Src Endpoint
+	Dst Endpoint
+
+	// Match is the series selector for series to verify
+	Match string
+	// TimeStart and TimeEnd limit the verified time range.
+	// TimeStart is required. TimeEnd defaults to the current time
+	TimeStart string
+	TimeEnd   string
+
+	// Series is the number of randomly sampled series to verify.
+	// All the series are verified if Series isn't positive
+	Series int
+	// Window is the duration of verified time ranges
+	Window time.Duration
+	// WindowsPerSeries is the number of randomly selected time ranges per each sampled series
+	WindowsPerSeries int
+
+	// SignificantFigures and RoundDigits must match the values
+	// used during migration, so source values are rounded in the same way
+	SignificantFigures int
+	RoundDigits        int
+
+	// DstExtraLabels contains `name=value` labels added to series during migration
+	DstExtraLabels []string
+
+	// Concurrency is the number of concurrently verified time ranges
+	Concurrency int
+}
+
+// Endpoint contains address and credentials of Prometheus querying API
+type Endpoint struct {
+	Addr     string
+	User     string
+	Password string
+}
+
+// Report contains verification results
+type Report struct {
+	// Series is the number of verified series
+	Series int
+	// Windows is the number of verified time ranges
+	Windows int
+
+	SrcSamples int
+	DstSamples int
+
+	// Divergences contains time ranges with different data at source and destination
+	Divergences []Divergence
+}
+
+// Divergence describes time range with different data at source and destination
+type Divergence struct {
+	Series string
+	Start  int64
+	End    int64
+	Src    Result
+	Dst    Result
+}
+
+// Result contains summary for samples in time range
+type Result struct {
+	Samples  int
+	Checksum uint64
+	Err      error
+}
+
+// String returns human-readable verification report
+func (r *Report) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Verification report:\n")
+	fmt.Fprintf(&sb, "  verified series: %d;\n", r.Series)
+	fmt.Fprintf(&sb, "  verified time ranges: %d;\n", r.Windows)
+	fmt.Fprintf(&sb, "  source samples: %d;\n", r.SrcSamples)
+	fmt.Fprintf(&sb, "  destination samples: %d;\n", r.DstSamples)
+	fmt.Fprintf(&sb, "  diverged time ranges: %d.\n", len(r.Divergences))
+	for _, d := range r.Divergences {
+		fmt.Fprintf(&sb, "%s for time range %s - %s:\n",
+			d.Series, time.Unix(0, d.Start*1e6).UTC().Format(time.RFC3339), time.Unix(0, d.End*1e6).UTC().Format(time.RFC3339))
+		fmt.Fprintf(&sb, "  source: %s;\n", d.Src)
+		fmt.Fprintf(&sb, "  destination: %s.\n", d.Dst)
+	}
+	return sb.String()
+}
+
+// String returns human-readable result
+func (r Result) String() string {
+	if r.Err != nil {
+		return fmt.Sprintf("error: %s", r.Err)
+	}
+	return fmt.Sprintf("%d samples, checksum %016x", r.Samples, r.Checksum)
+}
+
+// Window is a time range of a single series to verify
+type Window struct {
+	Labels map[string]string
+	Start  int64
+	End    int64
+}
+
+// Verifier verifies data migrated to Dst from Src
+type Verifier struct {
+	cfg         Config
+	src         *client
+	dst         *client
+	start       int64
+	end         int64
+	extraLabels map[string]string
+	series      int
+}
+
+// NewVerifier creates and returns Verifier
+// configured with passed Config
+func NewVerifier(cfg Config) (*Verifier, error) {
+	if cfg.TimeStart == "" {
+		return nil, fmt.Errorf("time start must be set")
+	}
+	start, err := time.Parse(time.RFC3339, cfg.TimeStart)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %q: %s", cfg.TimeStart, err)
+	}
+	end := time.Now()
+	if cfg.TimeEnd != "" {
+		end, err = time.Parse(time.RFC3339, cfg.TimeEnd)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %q: %s", cfg.TimeEnd, err)
+		}
+	}
+	if !end.After(start) {
+		return nil, fmt.Errorf("time end %s must be bigger than time start %s", end.Format(time.RFC3339), start.Format(time.RFC3339))
+	}
+	extraLabels, err := parseExtraLabels(cfg.DstExtraLabels)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Concurrency < 1 {
+		cfg.Concurrency = 1
+	}
+	return &Verifier{
+		cfg:         cfg,
+		src:         newClient(cfg.Src),
+		dst:         newClient(cfg.Dst),
+		start:       start.UnixNano() / 1e6,
+		end:         end.UnixNano() / 1e6,
+		extraLabels: extraLabels,
+	}, nil
+}
+
+// Explore samples series from Src and returns randomly selected time ranges to verify
+func (v *Verifier) Explore() ([]Window, error) {
+	series, err := v.src.series(v.cfg.Match, v.start, v.end)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch series from source: %s", err)
+	}
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	if v.cfg.Series > 0 && v.cfg.Series < len(series) {
+		rnd.Shuffle(len(series), func(i, j int) {
+			series[i], series[j] = series[j], series[i]
+		})
+		series = series[:v.cfg.Series]
+	}
+	v.series = len(series)
+	return selectWindows(rnd, series, v.start, v.end, int64(v.cfg.Window/time.Millisecond), v.cfg.WindowsPerSeries), nil
+}
+
+// Verify compares data for windows at Src and Dst and returns verification report.
+//
+// onWindow is called after every verified window if it isn't nil.
+func (v *Verifier) Verify(windows []Window, onWindow func()) *Report {
+	report := &Report{
+		Series:  v.series,
+		Windows: len(windows),
+	}
+	var mu sync.Mutex
+	windowsCh := make(chan Window)
+	var wg sync.WaitGroup
+	for i := 0; i < v.cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for w := range windowsCh {
+				srcResult := v.src.result(w.Labels, nil, w.Start, w.End, v.cfg.SignificantFigures, v.cfg.RoundDigits)
+				dstResult := v.dst.result(w.Labels, v.extraLabels, w.Start, w.End, 0, 100)
+				mu.Lock()
+				report.SrcSamples += srcResult.Samples
+				report.DstSamples += dstResult.Samples
+				if srcResult != dstResult {
+					report.Divergences = append(report.Divergences, Divergence{
+						Series: selector(w.Labels, nil),
+						Start:  w.Start,
+						End:    w.End,
+						Src:    srcResult,
+						Dst:    dstResult,
+					})
+				}
+				mu.Unlock()
+				if onWindow != nil {
+					onWindow()
+				}
+			}
+		}()
+	}
+	for _, w := range windows {
+		windowsCh <- w
+	}
+	close(windowsCh)
+	wg.Wait()
+	sort.Slice(report.Divergences, func(i, j int) bool {
+		a, b := report.Divergences[i], report.Divergences[j]
+		if a.Series != b.Series {
+			return a.Series < b.Series
+		}
+		return a.Start < b.Start
+	})
+	return report
+}
+
+// selectWindows returns windowsPerSeries random time ranges with windowSize duration within [start..end] for every series.
+//
+// A single [start..end] time range is returned per each series if windowSize covers the whole time range.
+func selectWindows(rnd *rand.Rand, series []map[string]string, start, end, windowSize int64, windowsPerSeries int) []Window {
+	if windowsPerSeries < 1 {
+		windowsPerSeries = 1
+	}
+	var windows []Window
+	for _, labels := range series {
+		if windowSize <= 0 || windowSize >= end-start {
+			windows = append(windows, Window{
+				Labels: labels,
+				Start:  start,
+				End:    end,
+			})
+			continue
+		}
+		for i := 0; i < windowsPerSeries; i++ {
+			ws := start + rnd.Int63n(end-start-windowSize+1)
+			windows = append(windows, Window{
+				Labels: labels,
+				Start:  ws,
+				End:    ws + windowSize,
+			})
+		}
+	}
+	return windows
+}
+
+func parseExtraLabels(labels []string) (map[string]string, error) {
+	m := make(map[string]string, len(labels))
+	for _, l := range labels {
+		n := strings.IndexByte(l, '=')
+		if n < 1 {
+			return nil, fmt.Errorf("cannot parse extra label %q; it must have the form `name=value`", l)
+		}
+		m[l[:n]] = l[n+1:]
+	}
+	return m, nil
+}
+
+// selector returns series selector for labels with additional extraLabels.
+//
+// extraLabels override labels with the same names.
+func selector(labels, extraLabels map[string]string) string {
+	m := make(map[string]string, len(labels)+len(extraLabels))
+	for k, v := range labels {
+		m[k] = v
+	}
+	for k, v := range extraLabels {
+		m[k] = v
+	}
+	names := make([]string, 0, len(m))
+	for k := range m {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var sb strings.Builder
+	sb.WriteString("{")
+	for i, k := range names {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		fmt.Fprintf(&sb, "%s=%s", k, strconv.Quote(m[k]))
+	}
+	sb.WriteString("}")
+	return sb.String()
+}
+
+type client struct {
+	Endpoint
+	c *http.Client
+}
+
+func newClient(e Endpoint) *client {
+	e.Addr = strings.TrimRight(e.Addr, "/")
+	return &client{
+		Endpoint: e,
+		c:        &http.Client{},
+	}
+}
+
+// series returns label sets for series matching match on the time range [start..end]
+func (c *client) series(match string, start, end int64) ([]map[string]string, error) {
+	args := url.Values{}
+	args.Set("match[]", match)
+	args.Set("start", fmt.Sprintf("%.3f", float64(start)/1e3))
+	args.Set("end", fmt.Sprintf("%.3f", float64(end)/1e3))
+	var series []map[string]string
+	if err := c.get("/api/v1/series", args, &series); err != nil {
+		return nil, err
+	}
+	return series, nil
+}
+
+type matrix struct {
+	ResultType string `json:"resultType"`
+	Result     []struct {
+		Metric map[string]string    `json:"metric"`
+		Values [][2]json.RawMessage `json:"values"`
+	} `json:"result"`
+}
+
+// result returns Result for raw samples of the series with the given labels and extraLabels on the time range (start..end]
+func (c *client) result(labels, extraLabels map[string]string, start, end int64, significantFigures, roundDigits int) Result {
+	args := url.Values{}
+	args.Set("query", fmt.Sprintf("%s[%dms]", selector(labels, extraLabels), end-start))
+	args.Set("time", fmt.Sprintf("%.3f", float64(end)/1e3))
+	var m matrix
+	if err := c.get("/api/v1/query", args, &m); err != nil {
+		return Result{Err: err}
+	}
+	if m.ResultType != "matrix" {
+		return Result{Err: fmt.Errorf("unexpected result type %q; want %q", m.ResultType, "matrix")}
+	}
+	var r Result
+	found := false
+	for _, ts := range m.Result {
+		// The selector matches series with additional labels too,
+		// so select only the series with exactly the same labels.
+		if !equalLabels(ts.Metric, labels, extraLabels) {
+			continue
+		}
+		if found {
+			return Result{Err: fmt.Errorf("found multiple series with the same labels")}
+		}
+		found = true
+		h := xxhash.New()
+		var buf [16]byte
+		for _, v := range ts.Values {
+			timestamp, value, err := parseSample(v)
+			if err != nil {
+				return Result{Err: err}
+			}
+			if significantFigures > 0 {
+				value = decimal.RoundToSignificantFigures(value, significantFigures)
+			}
+			if roundDigits < 100 {
+				value = decimal.RoundToDecimalDigits(value, roundDigits)
+			}
+			binary.BigEndian.PutUint64(buf[:8], uint64(timestamp))
+			binary.BigEndian.PutUint64(buf[8:], math.Float64bits(value))
+			_, _ = h.Write(buf[:])
+		}
+		r.Samples = len(ts.Values)
+		r.Checksum = h.Sum64()
+	}
+	return r
+}
+
+func equalLabels(m, labels, extraLabels map[string]string) bool {
+	n := len(labels)
+	for k := range extraLabels {
+		if _, ok := labels[k]; !ok {
+			n++
+		}
+	}
+	if len(m) != n {
+		return false
+	}
+	for k, v := range m {
+		expected, ok := extraLabels[k]
+		if !ok {
+			expected, ok = labels[k]
+		}
+		if !ok || v != expected {
+			return false
+		}
+	}
+	return true
+}
+
+func parseSample(v [2]json.RawMessage) (int64, float64, error) {
+	ts, err := strconv.ParseFloat(string(v[0]), 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("cannot parse timestamp %s: %s", v[0], err)
+	}
+	var s string
+	if err := json.Unmarshal(v[1], &s); err != nil {
+		return 0, 0, fmt.Errorf("cannot parse value %s: %s", v[1], err)
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("cannot parse value %q: %s", s, err)
+	}
+	return int64(math.Round(ts * 1e3)), value, nil
+}
+
+func (c *client) get(path string, args url.Values, dst interface{}) error {
+	req, err := http.NewRequest("GET", c.Addr+path+"?"+args.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	if c.User != "" {
+		req.SetBasicAuth(c.User, c.Password)
+	}
+	resp, err := c.c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("cannot read response from %q: %s", c.Addr, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response code %d for %q at %q; response body: %q", resp.StatusCode, path, c.Addr, body)
+	}
+	var r struct {
+		Status string          `json:"status"`
+		Error  string          `json:"error"`
+		Data   json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &r); err != nil {
+		return fmt.Errorf("cannot parse response from %q: %s", c.Addr, err)
+	}
+	if r.Status != "success" {
+		return fmt.Errorf("unexpected status %q for %q at %q: %s", r.Status, path, c.Addr, r.Error)
+	}
+	if err := json.Unmarshal(r.Data, dst); err != nil {
+		return fmt.Errorf("cannot parse data from %q: %s", c.Addr, err)
+	}
+	return nil
+}
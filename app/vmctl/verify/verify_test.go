@@ -0,0 +1,164 @@
+package verify
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testSeries struct {
+	labels     map[string]string
+	timestamps []int64
+	values     []string
+}
+
+// newTestServer returns Prometheus querying API server, which returns all the samples
+// for all the series regardless of the query args
+func newTestServer(t *testing.T, series []testSeries) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/series":
+			var data []map[string]string
+			for _, s := range series {
+				data = append(data, s.labels)
+			}
+			b, _ := json.Marshal(data)
+			fmt.Fprintf(w, `{"status":"success","data":%s}`, b)
+		case "/api/v1/query":
+			query := r.URL.Query().Get("query")
+			var result []string
+			for _, s := range series {
+				// emulate selector matching by the metric name only
+				if !strings.Contains(query, `__name__="`+s.labels["__name__"]+`"`) {
+					continue
+				}
+				metric, _ := json.Marshal(s.labels)
+				var values []string
+				for i, ts := range s.timestamps {
+					values = append(values, fmt.Sprintf(`[%.3f,"%s"]`, float64(ts)/1e3, s.values[i]))
+				}
+				result = append(result, fmt.Sprintf(`{"metric":%s,"values":[%s]}`, metric, strings.Join(values, ",")))
+			}
+			fmt.Fprintf(w, `{"status":"success","data":{"resultType":"matrix","result":[%s]}}`, strings.Join(result, ","))
+		default:
+			t.Errorf("unexpected request path %q", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestVerifier(t *testing.T) {
+	src := newTestServer(t, []testSeries{
+		{
+			labels:     map[string]string{"__name__": "foo", "job": "a"},
+			timestamps: []int64{1577836800000, 1577836810000},
+			values:     []string{"1.234", "2"},
+		},
+		{
+			labels:     map[string]string{"__name__": "bar", "job": "a"},
+			timestamps: []int64{1577836800000, 1577836810000},
+			values:     []string{"3", "4"},
+		},
+		{
+			labels:     map[string]string{"__name__": "baz"},
+			timestamps: []int64{1577836800000},
+			values:     []string{"5"},
+		},
+	})
+	defer src.Close()
+	dst := newTestServer(t, []testSeries{
+		{
+			labels:     map[string]string{"__name__": "foo", "job": "a", "env": "prod"},
+			timestamps: []int64{1577836800000, 1577836810000},
+			values:     []string{"1.2", "2"},
+		},
+		{
+			// missing sample
+			labels:     map[string]string{"__name__": "bar", "job": "a", "env": "prod"},
+			timestamps: []int64{1577836800000},
+			values:     []string{"3"},
+		},
+		{
+			// series without extra label mustn't be matched
+			labels:     map[string]string{"__name__": "baz"},
+			timestamps: []int64{1577836800000},
+			values:     []string{"5"},
+		},
+	})
+	defer dst.Close()
+
+	v, err := NewVerifier(Config{
+		Src:            Endpoint{Addr: src.URL},
+		Dst:            Endpoint{Addr: dst.URL},
+		Match:          `{__name__!=""}`,
+		TimeStart:      "2020-01-01T00:00:00Z",
+		TimeEnd:        "2020-01-01T01:00:00Z",
+		RoundDigits:    1,
+		DstExtraLabels: []string{"env=prod"},
+		Concurrency:    2,
+	})
+	if err != nil {
+		t.Fatalf("cannot create verifier: %s", err)
+	}
+	windows, err := v.Explore()
+	if err != nil {
+		t.Fatalf("explore failed: %s", err)
+	}
+	if len(windows) != 3 {
+		t.Fatalf("unexpected number of windows; got %d; want 3", len(windows))
+	}
+	verified := 0
+	report := v.Verify(windows, func() { verified++ })
+	if verified != 3 {
+		t.Fatalf("unexpected number of verified windows; got %d; want 3", verified)
+	}
+	if report.Series != 3 || report.SrcSamples != 5 || report.DstSamples != 3 {
+		t.Fatalf("unexpected report:\n%s", report)
+	}
+	if len(report.Divergences) != 2 {
+		t.Fatalf("unexpected number of divergences; got %d; want 2; report:\n%s", len(report.Divergences), report)
+	}
+	d := report.Divergences[0]
+	if d.Series != `{__name__="bar",job="a"}` || d.Src.Samples != 2 || d.Dst.Samples != 1 {
+		t.Fatalf("unexpected divergence: %+v", d)
+	}
+	d = report.Divergences[1]
+	if d.Series != `{__name__="baz"}` || d.Src.Samples != 1 || d.Dst.Samples != 0 {
+		t.Fatalf("unexpected divergence: %+v", d)
+	}
+}
+
+func TestSelectWindows(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	series := []map[string]string{{"__name__": "foo"}, {"__name__": "bar"}}
+
+	windows := selectWindows(rnd, series, 1000, 2000, 0, 3)
+	if len(windows) != 2 || windows[0].Start != 1000 || windows[0].End != 2000 {
+		t.Fatalf("expecting a single window for the whole time range per series; got %+v", windows)
+	}
+
+	windows = selectWindows(rnd, series, 1000, 2000, 100, 3)
+	if len(windows) != 6 {
+		t.Fatalf("unexpected number of windows; got %d; want 6", len(windows))
+	}
+	for _, w := range windows {
+		if w.Start < 1000 || w.End > 2000 || w.End-w.Start != 100 {
+			t.Fatalf("unexpected window: %+v", w)
+		}
+	}
+}
+
+func TestSelector(t *testing.T) {
+	f := func(labels, extraLabels map[string]string, expected string) {
+		t.Helper()
+		if got := selector(labels, extraLabels); got != expected {
+			t.Fatalf("unexpected selector; got %s; want %s", got, expected)
+		}
+	}
+	f(map[string]string{"__name__": "foo"}, nil, `{__name__="foo"}`)
+	f(map[string]string{"__name__": "foo", "job": `a"b`}, map[string]string{"env": "prod", "job": "c"}, `{__name__="foo",env="prod",job="c"}`)
+}
@@ -180,6 +180,18 @@ func (im *Importer) startWorker(batchSize, significantFigures, roundDigits int)
 	for {
 		select {
 		case <-im.close:
+			// Pick up timeseries remaining in the input,
+			// so they aren't lost on Close.
+		drainLoop:
+			for {
+				select {
+				case ts := <-im.input:
+					roundValues(ts, significantFigures, roundDigits)
+					batch = append(batch, ts)
+				default:
+					break drainLoop
+				}
+			}
 			if err := im.Import(batch); err != nil {
 				im.errors <- &ImportError{
 					Batch: batch,
@@ -194,16 +206,7 @@ func (im *Importer) startWorker(batchSize, significantFigures, roundDigits int)
 				waitForBatch = time.Now()
 			}
 
-			if significantFigures > 0 {
-				for i, v := range ts.Values {
-					ts.Values[i] = decimal.RoundToSignificantFigures(v, significantFigures)
-				}
-			}
-			if roundDigits < 100 {
-				for i, v := range ts.Values {
-					ts.Values[i] = decimal.RoundToDecimalDigits(v, roundDigits)
-				}
-			}
+			roundValues(ts, significantFigures, roundDigits)
 
 			batch = append(batch, ts)
 			dataPoints += len(ts.Values)
@@ -229,6 +232,19 @@ func (im *Importer) startWorker(batchSize, significantFigures, roundDigits int)
 	}
 }
 
+func roundValues(ts *TimeSeries, significantFigures, roundDigits int) {
+	if significantFigures > 0 {
+		for i, v := range ts.Values {
+			ts.Values[i] = decimal.RoundToSignificantFigures(v, significantFigures)
+		}
+	}
+	if roundDigits < 100 {
+		for i, v := range ts.Values {
+			ts.Values[i] = decimal.RoundToDecimalDigits(v, roundDigits)
+		}
+	}
+}
+
 const (
 	// TODO: make configurable
 	backoffRetries     = 5
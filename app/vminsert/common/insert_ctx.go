@@ -1,12 +1,15 @@
 package common
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/ingeststats"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/relabel"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmstorage"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
@@ -20,6 +23,19 @@ type InsertCtx struct {
 	metricNamesBuf []byte
 
 	relabelCtx relabel.Ctx
+
+	exemplar storage.Exemplar
+
+	// tl contains timestamp limits for the protocol set via SetProtocol.
+	// It is nil if timestamp limits are disabled.
+	tl *timestampLimits
+}
+
+// SetProtocol sets the ingestion protocol for the rows written into ctx.
+//
+// The protocol is used for selecting timestamp limits. It must be one of `type` label values in `vm_rows_inserted_total` metric.
+func (ctx *InsertCtx) SetProtocol(protocol string) {
+	ctx.tl = timestampLimitsByProtocol[protocol]
 }
 
 // Reset resets ctx for future fill with rowsLen rows.
@@ -42,6 +58,14 @@ func (ctx *InsertCtx) Reset(rowsLen int) {
 	ctx.mrs = ctx.mrs[:0]
 	ctx.metricNamesBuf = ctx.metricNamesBuf[:0]
 	ctx.relabelCtx.Reset()
+
+	tags := ctx.exemplar.Tags
+	for i := range tags {
+		tag := &tags[i]
+		tag.Key = nil
+		tag.Value = nil
+	}
+	ctx.exemplar.Tags = tags[:0]
 }
 
 func (ctx *InsertCtx) marshalMetricNameRaw(prefix []byte, labels []prompb.Label) []byte {
@@ -69,7 +93,43 @@ func (ctx *InsertCtx) WriteDataPointExt(metricNameRaw []byte, labels []prompb.La
 	return metricNameRaw, err
 }
 
+// WriteExemplar writes exemplar with the given exemplarLabels, value and timestamp for the time series with the given metricNameRaw and labels.
+//
+// It returns metricNameRaw for the given labels if len(metricNameRaw) == 0.
+// The exemplar is ignored if exemplars storage is disabled via -exemplars.maxCount.
+func (ctx *InsertCtx) WriteExemplar(metricNameRaw []byte, labels, exemplarLabels []prompb.Label, value float64, timestamp int64) ([]byte, error) {
+	if !vmstorage.ExemplarsEnabled() {
+		return metricNameRaw, nil
+	}
+	if len(metricNameRaw) == 0 {
+		metricNameRaw = ctx.marshalMetricNameRaw(nil, labels)
+	}
+	e := &ctx.exemplar
+	tags := e.Tags[:0]
+	for i := range exemplarLabels {
+		label := &exemplarLabels[i]
+		tags = append(tags, storage.Tag{
+			Key:   label.Name,
+			Value: label.Value,
+		})
+	}
+	e.Tags = tags
+	e.Value = value
+	e.Timestamp = timestamp
+	if err := vmstorage.AddExemplar(metricNameRaw, e); err != nil {
+		return metricNameRaw, fmt.Errorf("cannot store exemplar: %w", err)
+	}
+	return metricNameRaw, nil
+}
+
 func (ctx *InsertCtx) addRow(metricNameRaw []byte, timestamp int64, value float64) error {
+	if ctx.tl != nil {
+		ts, ok := ctx.tl.adjustTimestamp(timestamp, int64(fasttime.UnixTimestamp())*1000)
+		if !ok {
+			return nil
+		}
+		timestamp = ts
+	}
 	mrs := ctx.mrs
 	if cap(mrs) > len(mrs) {
 		mrs = mrs[:len(mrs)+1]
@@ -133,12 +193,21 @@ func (ctx *InsertCtx) ApplyRelabeling() {
 // FlushBufs flushes buffered rows to the underlying storage.
 func (ctx *InsertCtx) FlushBufs() error {
 	err := vmstorage.AddRows(ctx.mrs)
+	if err == nil {
+		ingeststats.RegisterRows(ctx.mrs)
+	}
 	ctx.Reset(0)
 	if err == nil {
 		return nil
 	}
+	statusCode := http.StatusServiceUnavailable
+	if errors.Is(err, storage.ErrReadOnly) {
+		// Use distinct status code, so clients such as vmagent could buffer data
+		// until the storage switches back to read-write mode.
+		statusCode = http.StatusInsufficientStorage
+	}
 	return &httpserver.ErrorWithStatusCode{
 		Err:        fmt.Errorf("cannot store metrics: %w", err),
-		StatusCode: http.StatusServiceUnavailable,
+		StatusCode: statusCode,
 	}
 }
@@ -26,6 +26,7 @@ func GetInsertCtx() *InsertCtx {
 // ctx cannot be used after the call.
 func PutInsertCtx(ctx *InsertCtx) {
 	ctx.Reset(0)
+	ctx.tl = nil
 	select {
 	case insertCtxPoolCh <- ctx:
 	default:
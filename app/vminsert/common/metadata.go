@@ -0,0 +1,12 @@
+package common
+
+import (
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmstorage"
+)
+
+// AddMetadata stores metadata for the given metricFamilyName received from the given source.
+//
+// The source is the ingestion protocol such as `promscrape` or `promremotewrite`.
+func AddMetadata(metricFamilyName, metricType, help, unit, source string) {
+	vmstorage.AddMetadata(metricFamilyName, metricType, help, unit, source)
+}
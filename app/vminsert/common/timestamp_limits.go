@@ -0,0 +1,257 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/configcheck"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/VictoriaMetrics/metricsql"
+)
+
+var (
+	maxSampleAge = flagutil.NewArray("insert.maxSampleAge", "Optional maximum age for ingested samples. Samples with older timestamps are rejected or clamped "+
+		"depending on -insert.outOfRangeTimestampsAction. The limit may be overridden per ingestion protocol with protocol=duration syntax, "+
+		"e.g. -insert.maxSampleAge=30d -insert.maxSampleAge=graphite=1d . Zero value disables the limit. "+
+		"See https://victoriametrics.github.io/#out-of-range-timestamps")
+	maxFutureOffset = flagutil.NewArray("insert.maxFutureOffset", "Optional maximum offset into the future for timestamps of ingested samples. "+
+		"Samples with bigger timestamps are rejected or clamped depending on -insert.outOfRangeTimestampsAction. "+
+		"The limit may be overridden per ingestion protocol with protocol=duration syntax, e.g. -insert.maxFutureOffset=1h -insert.maxFutureOffset=influx=5m . "+
+		"Zero value disables the limit. See https://victoriametrics.github.io/#out-of-range-timestamps")
+	outOfRangeTimestampsAction = flagutil.NewArray("insert.outOfRangeTimestampsAction", "What to do with samples outside -insert.maxSampleAge and -insert.maxFutureOffset. "+
+		"Supported values: reject, clamp. Rejected samples are dropped, while clamped samples are stored with the timestamp set to the nearest allowed value. "+
+		"The action may be overridden per ingestion protocol with protocol=action syntax, e.g. -insert.outOfRangeTimestampsAction=reject -insert.outOfRangeTimestampsAction=promscrape=clamp . "+
+		"Default action is reject. See https://victoriametrics.github.io/#out-of-range-timestamps")
+)
+
+// protocols contains ingestion protocols, which may be passed to InsertCtx.SetProtocol.
+//
+// The names match `type` label values in `vm_rows_inserted_total` metric.
+var protocols = []string{
+	"csvimport",
+	"graphite",
+	"influx",
+	"native",
+	"opentsdb",
+	"opentsdbhttp",
+	"prometheus",
+	"promremotewrite",
+	"promscrape",
+	"vmimport",
+}
+
+// InitTimestampLimits initializes per-protocol timestamp limits from command-line flags.
+func InitTimestampLimits() {
+	m, err := parseTimestampLimits(*maxSampleAge, *maxFutureOffset, *outOfRangeTimestampsAction)
+	if err != nil {
+		logger.Fatalf("cannot initialize timestamp limits: %s", err)
+	}
+	timestampLimitsByProtocol = m
+}
+
+// CheckTimestampLimits checks -insert.maxSampleAge, -insert.maxFutureOffset and -insert.outOfRangeTimestampsAction flags.
+//
+// The found errors are added to r.
+func CheckTimestampLimits(r *configcheck.Report) {
+	if _, err := parsePerProtocolValues(*maxSampleAge, parseTimestampLimitDuration); err != nil {
+		r.AddError("-insert.maxSampleAge", err)
+	}
+	if _, err := parsePerProtocolValues(*maxFutureOffset, parseTimestampLimitDuration); err != nil {
+		r.AddError("-insert.maxFutureOffset", err)
+	}
+	if _, err := parsePerProtocolValues(*outOfRangeTimestampsAction, parseOutOfRangeTimestampsAction); err != nil {
+		r.AddError("-insert.outOfRangeTimestampsAction", err)
+	}
+}
+
+// timestampLimitsByProtocol contains timestamp limits per each protocol with enabled limits.
+//
+// It is initialized by InitTimestampLimits and isn't modified after that.
+var timestampLimitsByProtocol map[string]*timestampLimits
+
+// timestampLimits contains limits on sample timestamps for a single ingestion protocol.
+type timestampLimits struct {
+	protocol string
+
+	// maxAgeMsecs is the maximum age of sample in milliseconds. Zero means no limit.
+	maxAgeMsecs int64
+
+	// maxFutureOffsetMsecs is the maximum offset of sample timestamp into the future in milliseconds. Zero means no limit.
+	maxFutureOffsetMsecs int64
+
+	// clamp is set to true if out of range timestamps must be clamped instead of rejecting the corresponding samples.
+	clamp bool
+
+	tooOld *metrics.Counter
+	tooNew *metrics.Counter
+
+	// lastWarnTime is the last time in seconds when the warning about out of range timestamp has been logged.
+	lastWarnTime uint64
+}
+
+func parseTimestampLimits(maxAges, maxFutureOffsets, actions []string) (map[string]*timestampLimits, error) {
+	ages, err := parsePerProtocolValues(maxAges, parseTimestampLimitDuration)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse -insert.maxSampleAge: %w", err)
+	}
+	offsets, err := parsePerProtocolValues(maxFutureOffsets, parseTimestampLimitDuration)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse -insert.maxFutureOffset: %w", err)
+	}
+	clamps, err := parsePerProtocolValues(actions, parseOutOfRangeTimestampsAction)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse -insert.outOfRangeTimestampsAction: %w", err)
+	}
+	m := make(map[string]*timestampLimits)
+	for _, protocol := range protocols {
+		tl := &timestampLimits{
+			protocol:             protocol,
+			maxAgeMsecs:          ages.get(protocol),
+			maxFutureOffsetMsecs: offsets.get(protocol),
+			clamp:                clamps.get(protocol) == 1,
+		}
+		if tl.maxAgeMsecs == 0 && tl.maxFutureOffsetMsecs == 0 {
+			continue
+		}
+		action := "reject"
+		if tl.clamp {
+			action = "clamp"
+		}
+		tl.tooOld = metrics.GetOrCreateCounter(fmt.Sprintf(`vm_rows_out_of_range_timestamp_total{type=%q,reason="too_old",action=%q}`, protocol, action))
+		tl.tooNew = metrics.GetOrCreateCounter(fmt.Sprintf(`vm_rows_out_of_range_timestamp_total{type=%q,reason="too_new",action=%q}`, protocol, action))
+		m[protocol] = tl
+	}
+	return m, nil
+}
+
+func parseTimestampLimitDuration(s string) (int64, error) {
+	if s == "0" {
+		return 0, nil
+	}
+	msecs, err := metricsql.PositiveDurationValue(s, 0)
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse duration %q: %w", s, err)
+	}
+	return msecs, nil
+}
+
+// parseOutOfRangeTimestampsAction returns 1 for clamp action and 0 for reject action.
+func parseOutOfRangeTimestampsAction(s string) (int64, error) {
+	switch s {
+	case "reject":
+		return 0, nil
+	case "clamp":
+		return 1, nil
+	default:
+		return 0, fmt.Errorf("unsupported action %q; supported actions: reject, clamp", s)
+	}
+}
+
+// perProtocolValues contains the default value and optional per-protocol overrides.
+type perProtocolValues struct {
+	defaultValue int64
+	overrides    map[string]int64
+}
+
+func (ppv *perProtocolValues) get(protocol string) int64 {
+	if v, ok := ppv.overrides[protocol]; ok {
+		return v
+	}
+	return ppv.defaultValue
+}
+
+// parsePerProtocolValues parses values in the form `value` or `protocol=value` with the given parseValue func.
+func parsePerProtocolValues(a []string, parseValue func(s string) (int64, error)) (*perProtocolValues, error) {
+	ppv := &perProtocolValues{
+		overrides: make(map[string]int64),
+	}
+	hasDefault := false
+	for _, s := range a {
+		n := strings.IndexByte(s, '=')
+		if n < 0 {
+			if hasDefault {
+				return nil, fmt.Errorf("duplicate default value %q; use protocol=value syntax for per-protocol values", s)
+			}
+			v, err := parseValue(s)
+			if err != nil {
+				return nil, err
+			}
+			ppv.defaultValue = v
+			hasDefault = true
+			continue
+		}
+		protocol := s[:n]
+		if !isKnownProtocol(protocol) {
+			return nil, fmt.Errorf("unknown protocol %q in %q; supported protocols: %s", protocol, s, strings.Join(protocols, ", "))
+		}
+		if _, ok := ppv.overrides[protocol]; ok {
+			return nil, fmt.Errorf("duplicate value for protocol %q", protocol)
+		}
+		v, err := parseValue(s[n+1:])
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse value for protocol %q: %w", protocol, err)
+		}
+		ppv.overrides[protocol] = v
+	}
+	return ppv, nil
+}
+
+func isKnownProtocol(protocol string) bool {
+	for _, p := range protocols {
+		if p == protocol {
+			return true
+		}
+	}
+	return false
+}
+
+// adjustTimestamp verifies whether timestamp is within tl limits relative to currentTimestamp.
+//
+// It returns false if the sample with the given timestamp must be rejected.
+// Otherwise it returns the timestamp, which may be clamped to tl limits.
+func (tl *timestampLimits) adjustTimestamp(timestamp, currentTimestamp int64) (int64, bool) {
+	if tl.maxAgeMsecs > 0 {
+		minTimestamp := currentTimestamp - tl.maxAgeMsecs
+		if timestamp < minTimestamp {
+			tl.tooOld.Inc()
+			tl.logWarn(timestamp, "older than -insert.maxSampleAge")
+			if !tl.clamp {
+				return 0, false
+			}
+			return minTimestamp, true
+		}
+	}
+	if tl.maxFutureOffsetMsecs > 0 {
+		maxTimestamp := currentTimestamp + tl.maxFutureOffsetMsecs
+		if timestamp > maxTimestamp {
+			tl.tooNew.Inc()
+			tl.logWarn(timestamp, "bigger than -insert.maxFutureOffset")
+			if !tl.clamp {
+				return 0, false
+			}
+			return maxTimestamp, true
+		}
+	}
+	return timestamp, true
+}
+
+// logWarn logs a warning about out of range timestamp at most once per 10 seconds per protocol.
+func (tl *timestampLimits) logWarn(timestamp int64, reason string) {
+	currentTime := fasttime.UnixTimestamp()
+	lastWarnTime := atomic.LoadUint64(&tl.lastWarnTime)
+	if currentTime < lastWarnTime+10 || !atomic.CompareAndSwapUint64(&tl.lastWarnTime, lastWarnTime, currentTime) {
+		return
+	}
+	action := "rejecting"
+	if tl.clamp {
+		action = "clamping"
+	}
+	logger.Warnf("%s sample with timestamp %s ingested via %s protocol, since the timestamp is %s; "+
+		"see vm_rows_out_of_range_timestamp_total metric for the number of such samples",
+		action, time.Unix(0, timestamp*1e6).UTC().Format(time.RFC3339), tl.protocol, reason)
+}
@@ -0,0 +1,76 @@
+package common
+
+import (
+	"testing"
+)
+
+func TestParseTimestampLimitsFailure(t *testing.T) {
+	f := func(maxAges, maxFutureOffsets, actions []string) {
+		t.Helper()
+		if _, err := parseTimestampLimits(maxAges, maxFutureOffsets, actions); err == nil {
+			t.Fatalf("expecting non-nil error for maxAges=%q, maxFutureOffsets=%q, actions=%q", maxAges, maxFutureOffsets, actions)
+		}
+	}
+	// Invalid duration
+	f([]string{"foo"}, nil, nil)
+	f(nil, []string{"-1h"}, nil)
+	f(nil, []string{"influx=bar"}, nil)
+	// Unknown protocol
+	f([]string{"foo=1h"}, nil, nil)
+	// Duplicate values
+	f([]string{"1h", "2h"}, nil, nil)
+	f([]string{"influx=1h", "influx=2h"}, nil, nil)
+	// Invalid action
+	f([]string{"1h"}, nil, []string{"drop"})
+	f([]string{"1h"}, nil, []string{"graphite=foo"})
+}
+
+func TestTimestampLimitsAdjustTimestamp(t *testing.T) {
+	m, err := parseTimestampLimits([]string{"1h", "graphite=0"}, []string{"influx=5m"}, []string{"reject", "promscrape=clamp"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if tl := m["graphite"]; tl != nil {
+		t.Fatalf("expecting disabled limits for graphite; got %+v", tl)
+	}
+
+	const currentTimestamp = 1600000000000
+	f := func(protocol string, timestamp, timestampExpected int64, okExpected bool) {
+		t.Helper()
+		tl := m[protocol]
+		if tl == nil {
+			t.Fatalf("missing limits for %q", protocol)
+		}
+		ts, ok := tl.adjustTimestamp(timestamp, currentTimestamp)
+		if ok != okExpected {
+			t.Fatalf("unexpected ok for protocol=%q, timestamp=%d; got %v; want %v", protocol, timestamp, ok, okExpected)
+		}
+		if ok && ts != timestampExpected {
+			t.Fatalf("unexpected timestamp for protocol=%q, timestamp=%d; got %d; want %d", protocol, timestamp, ts, timestampExpected)
+		}
+	}
+
+	// Timestamps within limits
+	f("influx", currentTimestamp, currentTimestamp, true)
+	f("influx", currentTimestamp-3600e3, currentTimestamp-3600e3, true)
+	f("influx", currentTimestamp+300e3, currentTimestamp+300e3, true)
+
+	// Rejected timestamps
+	f("influx", currentTimestamp-3600e3-1, 0, false)
+	f("influx", currentTimestamp+300e3+1, 0, false)
+
+	// -insert.maxFutureOffset isn't set for promremotewrite
+	f("promremotewrite", 4294967295000, 4294967295000, true)
+	f("promremotewrite", currentTimestamp-3600e3-1, 0, false)
+
+	// Clamped timestamps
+	f("promscrape", currentTimestamp-10*3600e3, currentTimestamp-3600e3, true)
+	f("promscrape", currentTimestamp+10*3600e3, currentTimestamp+10*3600e3, true)
+
+	if n := m["influx"].tooOld.Get(); n != 1 {
+		t.Fatalf("unexpected number of too old samples for influx; got %d; want 1", n)
+	}
+	if n := m["influx"].tooNew.Get(); n != 1 {
+		t.Fatalf("unexpected number of too new samples for influx; got %d; want 1", n)
+	}
+}
@@ -35,6 +35,7 @@ func insertRows(rows []parser.Row, extraLabels []prompbmarshal.Label) error {
 	defer common.PutInsertCtx(ctx)
 
 	ctx.Reset(len(rows))
+	ctx.SetProtocol("csvimport")
 	hasRelabeling := relabel.HasRelabeling()
 	for i := range rows {
 		r := &rows[i]
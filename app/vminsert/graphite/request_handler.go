@@ -29,6 +29,7 @@ func insertRows(rows []parser.Row) error {
 	defer common.PutInsertCtx(ctx)
 
 	ctx.Reset(len(rows))
+	ctx.SetProtocol("graphite")
 	hasRelabeling := relabel.HasRelabeling()
 	for i := range rows {
 		r := &rows[i]
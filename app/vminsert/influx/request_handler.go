@@ -71,6 +71,7 @@ func insertRows(db string, rows []parser.Row, extraLabels []prompbmarshal.Label)
 	}
 	ic := &ctx.Common
 	ic.Reset(rowsLen)
+	ic.SetProtocol("influx")
 	rowsTotal := 0
 	hasRelabeling := relabel.HasRelabeling()
 	for i := range rows {
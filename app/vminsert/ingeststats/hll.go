@@ -0,0 +1,62 @@
+package ingeststats
+
+import (
+	"math"
+	"math/bits"
+)
+
+const (
+	hllPrecision = 10
+	hllRegisters = 1 << hllPrecision
+)
+
+// hll is HyperLogLog cardinality estimator with the standard error of ~3%.
+//
+// See http://algo.inria.fr/flajolet/Publications/FlFuGaMe07.pdf
+type hll struct {
+	registers [hllRegisters]uint8
+}
+
+func (h *hll) reset() {
+	h.registers = [hllRegisters]uint8{}
+}
+
+// add adds item with the given hash to h.
+func (h *hll) add(hash uint64) {
+	idx := hash >> (64 - hllPrecision)
+	// Set the guard bit in order to limit the maximum rank.
+	w := hash<<hllPrecision | 1<<(hllPrecision-1)
+	rank := uint8(bits.LeadingZeros64(w)) + 1
+	if rank > h.registers[idx] {
+		h.registers[idx] = rank
+	}
+}
+
+// merge merges src into h.
+func (h *hll) merge(src *hll) {
+	for i, rank := range src.registers {
+		if rank > h.registers[i] {
+			h.registers[i] = rank
+		}
+	}
+}
+
+// estimate returns the estimated number of unique items added to h.
+func (h *hll) estimate() uint64 {
+	const m = float64(hllRegisters)
+	sum := 0.0
+	zeros := 0
+	for _, rank := range h.registers {
+		sum += 1 / float64(uint64(1)<<rank)
+		if rank == 0 {
+			zeros++
+		}
+	}
+	alpha := 0.7213 / (1 + 1.079/m)
+	e := alpha * m * m / sum
+	if e <= 2.5*m && zeros > 0 {
+		// Use linear counting for small cardinalities.
+		e = m * math.Log(m/float64(zeros))
+	}
+	return uint64(e + 0.5)
+}
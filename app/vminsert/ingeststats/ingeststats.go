@@ -0,0 +1,347 @@
+package ingeststats
+
+import (
+	"container/heap"
+	"flag"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	xxhash "github.com/cespare/xxhash/v2"
+)
+
+var (
+	maxMetrics = flag.Int("insert.ingestionStats.maxMetrics", 1000, "The maximum number of metric names to track in ingestion stats at `/api/v1/status/ingestion`. "+
+		"Metric names with the lowest number of ingested samples are evicted when the limit is reached. Zero value disables ingestion stats tracking")
+	interval = flag.Duration("insert.ingestionStats.interval", 5*time.Minute, "The interval for calculating ingestion rate and active series in ingestion stats at `/api/v1/status/ingestion`. "+
+		"Stats are calculated over the current and the previous intervals")
+)
+
+var (
+	isTracker *ingestionStatsTracker
+	initOnce  sync.Once
+)
+
+// Enabled returns true if ingestion stats tracking is enabled.
+func Enabled() bool {
+	return *maxMetrics > 0
+}
+
+// RegisterRows registers successfully ingested mrs in ingestion stats.
+func RegisterRows(mrs []storage.MetricRow) {
+	if !Enabled() || len(mrs) == 0 {
+		return
+	}
+	initOnce.Do(initIngestionStats)
+	br := getBatchRows()
+	br.collect(mrs)
+	isTracker.registerBatch(br, time.Now())
+	putBatchRows(br)
+}
+
+// WriteJSONIngestionStats writes ingestion stats for topN metric names to w in json format.
+func WriteJSONIngestionStats(w io.Writer, topN int) {
+	initOnce.Do(initIngestionStats)
+	isTracker.writeJSONIngestionStats(w, topN, time.Now())
+}
+
+func initIngestionStats() {
+	n := *maxMetrics
+	if n <= 0 {
+		n = 1
+	} else {
+		logger.Infof("enabled ingestion stats tracking at `/api/v1/status/ingestion` with -insert.ingestionStats.maxMetrics=%d, -insert.ingestionStats.interval=%s",
+			*maxMetrics, *interval)
+	}
+	isTracker = newIngestionStatsTracker(n, *interval, time.Now())
+}
+
+// batchRows contains per-metric stats for a batch of ingested rows.
+type batchRows struct {
+	m       map[string]int
+	metrics []batchMetric
+}
+
+type batchMetric struct {
+	metricGroup  []byte
+	samples      uint64
+	seriesHashes []uint64
+}
+
+func (br *batchRows) reset() {
+	for k := range br.m {
+		delete(br.m, k)
+	}
+	for i := range br.metrics {
+		bm := &br.metrics[i]
+		bm.metricGroup = nil
+		bm.seriesHashes = bm.seriesHashes[:0]
+	}
+	br.metrics = br.metrics[:0]
+}
+
+// collect groups mrs by metric name.
+//
+// br refers to mrs after the call, so mrs mustn't be changed while br is in use.
+func (br *batchRows) collect(mrs []storage.MetricRow) {
+	var prevMetricNameRaw []byte
+	idx := -1
+	for i := range mrs {
+		mr := &mrs[i]
+		if idx >= 0 && string(mr.MetricNameRaw) == string(prevMetricNameRaw) {
+			// Fast path - samples for the same series usually go in a row.
+			br.metrics[idx].samples++
+			continue
+		}
+		prevMetricNameRaw = mr.MetricNameRaw
+		metricGroup, err := storage.GetMetricGroupFromRaw(mr.MetricNameRaw)
+		if err != nil {
+			logger.Panicf("BUG: cannot obtain metric name from MetricNameRaw=%X: %s", mr.MetricNameRaw, err)
+		}
+		n, ok := br.m[bytesutil.ToUnsafeString(metricGroup)]
+		if !ok {
+			if cap(br.metrics) > len(br.metrics) {
+				br.metrics = br.metrics[:len(br.metrics)+1]
+			} else {
+				br.metrics = append(br.metrics, batchMetric{})
+			}
+			n = len(br.metrics) - 1
+			bm := &br.metrics[n]
+			bm.metricGroup = metricGroup
+			bm.samples = 0
+			br.m[bytesutil.ToUnsafeString(metricGroup)] = n
+		}
+		idx = n
+		bm := &br.metrics[idx]
+		bm.samples++
+		bm.seriesHashes = append(bm.seriesHashes, xxhash.Sum64(mr.MetricNameRaw))
+	}
+}
+
+func getBatchRows() *batchRows {
+	v := batchRowsPool.Get()
+	if v == nil {
+		return &batchRows{
+			m: make(map[string]int),
+		}
+	}
+	return v.(*batchRows)
+}
+
+func putBatchRows(br *batchRows) {
+	br.reset()
+	batchRowsPool.Put(br)
+}
+
+var batchRowsPool sync.Pool
+
+// ingestionStatsTracker tracks per-metric ingestion stats.
+//
+// It uses Space-Saving algorithm for tracking top metric names by the number of ingested samples
+// in bounded memory and HyperLogLog for estimating the number of active series per metric name.
+type ingestionStatsTracker struct {
+	mu         sync.Mutex
+	maxMetrics int
+	interval   time.Duration
+
+	// prev contains stats for the previous interval. It is nil if there was no ingestion during the previous interval.
+	prev *generation
+
+	// curr contains stats for the current interval.
+	curr *generation
+}
+
+type generation struct {
+	startTime time.Time
+	samples   uint64
+	series    hll
+
+	m map[string]*metricStat
+	h metricStatHeap
+}
+
+type metricStat struct {
+	metric  string
+	samples uint64
+	series  hll
+
+	// heapIdx is the index of metricStat in generation.h.
+	heapIdx int
+}
+
+func newIngestionStatsTracker(maxMetrics int, interval time.Duration, currentTime time.Time) *ingestionStatsTracker {
+	return &ingestionStatsTracker{
+		maxMetrics: maxMetrics,
+		interval:   interval,
+		curr:       newGeneration(currentTime),
+	}
+}
+
+func newGeneration(startTime time.Time) *generation {
+	return &generation{
+		startTime: startTime,
+		m:         make(map[string]*metricStat),
+	}
+}
+
+// rotate starts new generation if the current generation is older than ist.interval.
+//
+// ist.mu must be locked by the caller.
+func (ist *ingestionStatsTracker) rotate(currentTime time.Time) {
+	d := currentTime.Sub(ist.curr.startTime)
+	if d < ist.interval {
+		return
+	}
+	if d < 2*ist.interval {
+		ist.prev = ist.curr
+	} else {
+		ist.prev = nil
+	}
+	ist.curr = newGeneration(currentTime)
+}
+
+func (ist *ingestionStatsTracker) registerBatch(br *batchRows, currentTime time.Time) {
+	ist.mu.Lock()
+	defer ist.mu.Unlock()
+
+	ist.rotate(currentTime)
+	g := ist.curr
+	for i := range br.metrics {
+		bm := &br.metrics[i]
+		g.samples += bm.samples
+		for _, h := range bm.seriesHashes {
+			g.series.add(h)
+		}
+		ms := g.m[bytesutil.ToUnsafeString(bm.metricGroup)]
+		if ms == nil {
+			if len(g.m) < ist.maxMetrics {
+				ms = &metricStat{}
+				heap.Push(&g.h, ms)
+			} else {
+				// Replace the metric with the minimum number of samples according to Space-Saving algorithm.
+				// The new metric inherits samples from the evicted metric, so its samples may be overestimated.
+				ms = g.h[0]
+				delete(g.m, ms.metric)
+				ms.series.reset()
+			}
+			ms.metric = string(bm.metricGroup)
+			g.m[ms.metric] = ms
+		}
+		ms.samples += bm.samples
+		for _, h := range bm.seriesHashes {
+			ms.series.add(h)
+		}
+		heap.Fix(&g.h, ms.heapIdx)
+	}
+}
+
+type ingestionStatRecord struct {
+	metric       string
+	samples      uint64
+	activeSeries uint64
+}
+
+func (ist *ingestionStatsTracker) writeJSONIngestionStats(w io.Writer, topN int, currentTime time.Time) {
+	ist.mu.Lock()
+	ist.rotate(currentTime)
+	startTime := ist.curr.startTime
+	gs := []*generation{ist.curr}
+	if ist.prev != nil {
+		startTime = ist.prev.startTime
+		gs = append(gs, ist.prev)
+	}
+	var totalSamples uint64
+	var totalSeries hll
+	m := make(map[string]*metricStat)
+	for _, g := range gs {
+		totalSamples += g.samples
+		totalSeries.merge(&g.series)
+		for metric, ms := range g.m {
+			e := m[metric]
+			if e == nil {
+				e = &metricStat{
+					metric: metric,
+				}
+				m[metric] = e
+			}
+			e.samples += ms.samples
+			e.series.merge(&ms.series)
+		}
+	}
+	ist.mu.Unlock()
+
+	records := make([]ingestionStatRecord, 0, len(m))
+	for _, e := range m {
+		records = append(records, ingestionStatRecord{
+			metric:       e.metric,
+			samples:      e.samples,
+			activeSeries: e.series.estimate(),
+		})
+	}
+	windowSeconds := currentTime.Sub(startTime).Seconds()
+	if windowSeconds <= 0 {
+		windowSeconds = 1e-3
+	}
+
+	if topN < 0 {
+		topN = 0
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].samples != records[j].samples {
+			return records[i].samples > records[j].samples
+		}
+		return records[i].metric < records[j].metric
+	})
+	topBySamples := append([]ingestionStatRecord{}, records[:minInt(topN, len(records))]...)
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].activeSeries != records[j].activeSeries {
+			return records[i].activeSeries > records[j].activeSeries
+		}
+		return records[i].metric < records[j].metric
+	})
+	topByActiveSeries := records[:minInt(topN, len(records))]
+	writeingestionStatsResponse(w, topN, ist.interval, windowSeconds, totalSamples, totalSeries.estimate(), topBySamples, topByActiveSeries)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// metricStatHeap is a min-heap of metricStat items ordered by the number of samples.
+type metricStatHeap []*metricStat
+
+func (h *metricStatHeap) Len() int {
+	return len(*h)
+}
+
+func (h *metricStatHeap) Less(i, j int) bool {
+	a := *h
+	return a[i].samples < a[j].samples
+}
+
+func (h *metricStatHeap) Swap(i, j int) {
+	a := *h
+	a[i], a[j] = a[j], a[i]
+	a[i].heapIdx = i
+	a[j].heapIdx = j
+}
+
+func (h *metricStatHeap) Push(x interface{}) {
+	ms := x.(*metricStat)
+	ms.heapIdx = len(*h)
+	*h = append(*h, ms)
+}
+
+func (h *metricStatHeap) Pop() interface{} {
+	a := *h
+	ms := a[len(a)-1]
+	*h = a[:len(a)-1]
+	return ms
+}
@@ -0,0 +1,162 @@
+package ingeststats
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	xxhash "github.com/cespare/xxhash/v2"
+)
+
+func newMetricRows(metric string, seriesCount, samplesPerSeries int) []storage.MetricRow {
+	var mrs []storage.MetricRow
+	for i := 0; i < seriesCount; i++ {
+		labels := []prompb.Label{
+			{Name: []byte("__name__"), Value: []byte(metric)},
+			{Name: []byte("instance"), Value: []byte(fmt.Sprintf("host-%d", i))},
+		}
+		metricNameRaw := storage.MarshalMetricNameRaw(nil, labels)
+		for j := 0; j < samplesPerSeries; j++ {
+			mrs = append(mrs, storage.MetricRow{
+				MetricNameRaw: metricNameRaw,
+				Timestamp:     int64(j) * 1000,
+				Value:         float64(j),
+			})
+		}
+	}
+	return mrs
+}
+
+type testStats struct {
+	WindowSeconds     float64
+	TotalSamples      uint64
+	SamplesPerSecond  float64
+	ActiveSeries      uint64
+	TopBySamples      []testStatRecord
+	TopByActiveSeries []testStatRecord
+}
+
+type testStatRecord struct {
+	Metric           string
+	Samples          uint64
+	SamplesPerSecond float64
+	ActiveSeries     uint64
+}
+
+func (ist *ingestionStatsTracker) registerRows(mrs []storage.MetricRow, currentTime time.Time) {
+	br := getBatchRows()
+	br.collect(mrs)
+	ist.registerBatch(br, currentTime)
+	putBatchRows(br)
+}
+
+func (ist *ingestionStatsTracker) getStats(t *testing.T, topN int, currentTime time.Time) *testStats {
+	t.Helper()
+	var bb bytes.Buffer
+	ist.writeJSONIngestionStats(&bb, topN, currentTime)
+	var ts testStats
+	if err := json.Unmarshal(bb.Bytes(), &ts); err != nil {
+		t.Fatalf("cannot parse ingestion stats %s: %s", bb.Bytes(), err)
+	}
+	return &ts
+}
+
+// isApproxEqual returns true if the estimated number of series n is close to expected.
+func isApproxEqual(n, expected uint64) bool {
+	return math.Abs(float64(n)-float64(expected)) <= 0.05*float64(expected)
+}
+
+func TestIngestionStatsTracker(t *testing.T) {
+	startTime := time.Unix(1600000000, 0)
+	ist := newIngestionStatsTracker(2, time.Minute, startTime)
+	ist.registerRows(newMetricRows("foo", 10, 3), startTime)
+	ist.registerRows(newMetricRows("bar", 100, 1), startTime)
+	ist.registerRows(newMetricRows("baz", 1, 1), startTime)
+
+	ts := ist.getStats(t, 10, startTime.Add(10*time.Second))
+	if ts.WindowSeconds != 10 || ts.TotalSamples != 131 || !isApproxEqual(ts.ActiveSeries, 111) {
+		t.Fatalf("unexpected totals: %+v", ts)
+	}
+	if len(ts.TopBySamples) != 2 {
+		t.Fatalf("unexpected number of metrics; got %d; want 2", len(ts.TopBySamples))
+	}
+	r := ts.TopBySamples[0]
+	if r.Metric != "bar" || r.Samples != 100 || r.SamplesPerSecond != 10 || !isApproxEqual(r.ActiveSeries, 100) {
+		t.Fatalf("unexpected top metric by samples: %+v", r)
+	}
+	// baz must replace foo with the overestimated number of samples, since the tracker is limited to 2 metrics.
+	r = ts.TopBySamples[1]
+	if r.Metric != "baz" || r.Samples != 31 || r.ActiveSeries != 1 {
+		t.Fatalf("unexpected second metric by samples: %+v", r)
+	}
+	if ts.TopByActiveSeries[0].Metric != "bar" {
+		t.Fatalf("unexpected top metric by active series: %+v", ts.TopByActiveSeries[0])
+	}
+
+	// Stats for the previous interval must be included.
+	ist.registerRows(newMetricRows("bar", 50, 1), startTime.Add(70*time.Second))
+	ts = ist.getStats(t, 1, startTime.Add(80*time.Second))
+	if ts.WindowSeconds != 80 || ts.TotalSamples != 181 || len(ts.TopBySamples) != 1 {
+		t.Fatalf("unexpected stats after rotation: %+v", ts)
+	}
+	if r := ts.TopBySamples[0]; r.Metric != "bar" || r.Samples != 150 || !isApproxEqual(r.ActiveSeries, 100) {
+		t.Fatalf("unexpected top metric by samples after rotation: %+v", r)
+	}
+
+	// Stats older than two intervals must be dropped.
+	ts = ist.getStats(t, 10, startTime.Add(200*time.Second))
+	if ts.WindowSeconds != 0.001 || ts.TotalSamples != 0 || len(ts.TopBySamples) != 0 {
+		t.Fatalf("unexpected stats after dropping old intervals: %+v", ts)
+	}
+}
+
+func TestIngestionStatsTrackerSpecialChars(t *testing.T) {
+	startTime := time.Unix(1600000000, 0)
+	ist := newIngestionStatsTracker(10, time.Minute, startTime)
+	metric := "foo\"bar\\baz\x01<"
+	ist.registerRows(newMetricRows(metric, 3, 1), startTime)
+
+	// getStats fails if the response isn't valid JSON.
+	ts := ist.getStats(t, 10, startTime.Add(10*time.Second))
+	if len(ts.TopBySamples) != 1 || ts.TopBySamples[0].Metric != metric {
+		t.Fatalf("unexpected top metrics by samples: %+v", ts.TopBySamples)
+	}
+	if len(ts.TopByActiveSeries) != 1 || ts.TopByActiveSeries[0].Metric != metric {
+		t.Fatalf("unexpected top metrics by active series: %+v", ts.TopByActiveSeries)
+	}
+}
+
+func TestHLL(t *testing.T) {
+	f := func(n int) {
+		t.Helper()
+		var h hll
+		for i := 0; i < n; i++ {
+			h.add(xxhash.Sum64String(fmt.Sprintf("series_%d", i)))
+			// Duplicate items mustn't change the estimate.
+			h.add(xxhash.Sum64String(fmt.Sprintf("series_%d", i/2)))
+		}
+		estimate := h.estimate()
+		if math.Abs(float64(estimate)-float64(n)) > 0.1*float64(n) {
+			t.Fatalf("too big estimation error for n=%d; got %d", n, estimate)
+		}
+	}
+	f(1)
+	f(10)
+	f(1000)
+	f(100000)
+
+	var h1, h2 hll
+	for i := 0; i < 1000; i++ {
+		h1.add(xxhash.Sum64String(fmt.Sprintf("a_%d", i)))
+		h2.add(xxhash.Sum64String(fmt.Sprintf("b_%d", i)))
+	}
+	h1.merge(&h2)
+	if estimate := h1.estimate(); estimate < 1800 || estimate > 2200 {
+		t.Fatalf("unexpected estimate after merge; got %d; want ~2000", estimate)
+	}
+}
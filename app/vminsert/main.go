@@ -4,12 +4,15 @@ import (
 	"flag"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync/atomic"
 
+	vminsertCommon "github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/common"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/csvimport"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/graphite"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/influx"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/ingeststats"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/native"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/opentsdb"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/opentsdbhttp"
@@ -26,6 +29,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/procutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/common"
+	promremotewriteparser "github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/promremotewrite"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/writeconcurrencylimiter"
 	"github.com/VictoriaMetrics/metrics"
@@ -52,6 +56,7 @@ var (
 // Init initializes vminsert.
 func Init() {
 	relabel.Init()
+	vminsertCommon.InitTimestampLimits()
 	storage.SetMaxLabelsPerTimeseries(*maxLabelsPerTimeseries)
 	common.StartUnmarshalWorkers()
 	writeconcurrencylimiter.Init()
@@ -93,6 +98,10 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 	path := strings.Replace(r.URL.Path, "//", "/", -1)
 	switch path {
 	case "/prometheus/api/v1/write", "/api/v1/write":
+		if promremotewriteparser.WriteVMProtoVersion(w, r) {
+			// The client checks whether VictoriaMetrics remote write protocol is supported.
+			return true
+		}
 		prometheusWriteRequests.Inc()
 		if err := promremotewrite.InsertHandler(r); err != nil {
 			prometheusWriteErrors.Inc()
@@ -152,6 +161,14 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 		influxQueryRequests.Inc()
 		fmt.Fprintf(w, `{"results":[{"series":[{"values":[]}]}]}`)
 		return true
+	case "/prometheus/api/v1/status/ingestion", "/api/v1/status/ingestion":
+		ingestionStatsRequests.Inc()
+		if err := writeIngestionStats(w, r); err != nil {
+			ingestionStatsErrors.Inc()
+			httpserver.Errorf(w, r, "error in %q: %s", r.URL.Path, err)
+			return true
+		}
+		return true
 	case "/prometheus/targets", "/targets":
 		promscrapeTargetsRequests.Inc()
 		promscrape.WriteHumanReadableTargetsStatus(w, r)
@@ -160,10 +177,28 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 		promscrapeAPIV1TargetsRequests.Inc()
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
 		state := r.FormValue("state")
-		promscrape.WriteAPIV1Targets(w, state)
+		scrapePool := r.FormValue("scrapePool")
+		promscrape.WriteAPIV1Targets(w, state, scrapePool)
+		return true
+	case "/prometheus/api/v1/targets/metadata", "/api/v1/targets/metadata":
+		promscrapeAPIV1TargetsMetadataRequests.Inc()
+		if err := promscrape.WriteAPIV1TargetsMetadata(w, r); err != nil {
+			promscrapeAPIV1TargetsMetadataErrors.Inc()
+			httpserver.Errorf(w, r, "%s", err)
+			return true
+		}
+		return true
+	case "/prometheus/api/v1/targets/resolved", "/api/v1/targets/resolved":
+		promscrapeAPIV1TargetsResolvedRequests.Inc()
+		if err := promscrape.WriteAPIV1TargetsResolved(w, r); err != nil {
+			promscrapeAPIV1TargetsResolvedErrors.Inc()
+			httpserver.Errorf(w, r, "%s", err)
+			return true
+		}
 		return true
 	case "/prometheus/-/reload", "/-/reload":
 		promscrapeConfigReloadRequests.Inc()
+		httpserver.LogAuditEvent(r, "config_reload", "")
 		procutil.SelfSIGHUP()
 		w.WriteHeader(http.StatusNoContent)
 		return true
@@ -183,6 +218,23 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 	}
 }
 
+func writeIngestionStats(w http.ResponseWriter, r *http.Request) error {
+	if !ingeststats.Enabled() {
+		return fmt.Errorf("ingestion stats tracking is disabled via `-insert.ingestionStats.maxMetrics=0`")
+	}
+	topN := 20
+	if s := r.FormValue("topN"); len(s) > 0 {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("cannot parse `topN` arg %q: %w", s, err)
+		}
+		topN = n
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	ingeststats.WriteJSONIngestionStats(w, topN)
+	return nil
+}
+
 var (
 	prometheusWriteRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/write", protocol="promremotewrite"}`)
 	prometheusWriteErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/write", protocol="promremotewrite"}`)
@@ -204,9 +256,17 @@ var (
 
 	influxQueryRequests = metrics.NewCounter(`vm_http_requests_total{path="/query", protocol="influx"}`)
 
+	ingestionStatsRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/status/ingestion"}`)
+	ingestionStatsErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/status/ingestion"}`)
+
 	promscrapeTargetsRequests      = metrics.NewCounter(`vm_http_requests_total{path="/targets"}`)
 	promscrapeAPIV1TargetsRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/targets"}`)
 
+	promscrapeAPIV1TargetsMetadataRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/targets/metadata"}`)
+	promscrapeAPIV1TargetsMetadataErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/targets/metadata"}`)
+	promscrapeAPIV1TargetsResolvedRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/targets/resolved"}`)
+	promscrapeAPIV1TargetsResolvedErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/targets/resolved"}`)
+
 	promscrapeConfigReloadRequests = metrics.NewCounter(`vm_http_requests_total{path="/-/reload"}`)
 
 	_ = metrics.NewGauge(`vm_metrics_with_dropped_labels_total`, func() float64 {
@@ -46,6 +46,7 @@ func insertRows(block *parser.Block, extraLabels []prompbmarshal.Label) error {
 
 	ic := &ctx.Common
 	ic.Reset(rowsLen)
+	ic.SetProtocol("native")
 	hasRelabeling := relabel.HasRelabeling()
 	mn := &block.MetricName
 	ic.Labels = ic.Labels[:0]
@@ -40,6 +40,7 @@ func insertRows(rows []parser.Row, extraLabels []prompbmarshal.Label) error {
 	defer common.PutInsertCtx(ctx)
 
 	ctx.Reset(len(rows))
+	ctx.SetProtocol("prometheus")
 	hasRelabeling := relabel.HasRelabeling()
 	for i := range rows {
 		r := &rows[i]
@@ -2,7 +2,9 @@ package prompush
 
 import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/common"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
 	"github.com/VictoriaMetrics/metrics"
 )
@@ -19,6 +21,11 @@ func Push(wr *prompbmarshal.WriteRequest) {
 	ctx := common.GetInsertCtx()
 	defer common.PutInsertCtx(ctx)
 
+	for i := range wr.Metadata {
+		mm := &wr.Metadata[i]
+		common.AddMetadata(mm.MetricFamilyName, prompb.MetricType(mm.Type).String(), mm.Help, mm.Unit, "promscrape")
+	}
+
 	tss := wr.Timeseries
 	for len(tss) > 0 {
 		// Process big tss in smaller blocks in order to reduce maxmimum memory usage
@@ -48,7 +55,9 @@ func push(ctx *common.InsertCtx, tss []prompbmarshal.TimeSeries) {
 		rowsLen += len(tss[i].Samples)
 	}
 	ctx.Reset(rowsLen)
+	ctx.SetProtocol("promscrape")
 	rowsTotal := 0
+	var exemplarLabels []prompb.Label
 	for i := range tss {
 		ts := &tss[i]
 		rowsTotal += len(ts.Samples)
@@ -72,6 +81,22 @@ func push(ctx *common.InsertCtx, tss []prompbmarshal.TimeSeries) {
 				return
 			}
 		}
+		for i := range ts.Exemplars {
+			e := &ts.Exemplars[i]
+			exemplarLabels = exemplarLabels[:0]
+			for j := range e.Labels {
+				label := &e.Labels[j]
+				exemplarLabels = append(exemplarLabels, prompb.Label{
+					Name:  bytesutil.ToUnsafeBytes(label.Name),
+					Value: bytesutil.ToUnsafeBytes(label.Value),
+				})
+			}
+			metricNameRaw, err = ctx.WriteExemplar(metricNameRaw, ctx.Labels, exemplarLabels, e.Value, e.Timestamp)
+			if err != nil {
+				logger.Errorf("cannot write promscrape exemplar to storage: %s", err)
+				return
+			}
+		}
 	}
 	rowsInserted.Add(rowsTotal)
 	rowsPerInsert.Update(float64(rowsTotal))
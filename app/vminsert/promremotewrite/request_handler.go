@@ -5,6 +5,7 @@ import (
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/common"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vminsert/relabel"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
 	parserCommon "github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/common"
@@ -25,12 +26,21 @@ func InsertHandler(req *http.Request) error {
 		return err
 	}
 	return writeconcurrencylimiter.Do(func() error {
-		return parser.ParseStream(req, func(tss []prompb.TimeSeries) error {
+		return parser.ParseStream(req, func(tss []prompb.TimeSeries, mms []prompb.MetricMetadata) error {
+			insertMetadata(mms)
 			return insertRows(tss, extraLabels)
 		})
 	})
 }
 
+func insertMetadata(mms []prompb.MetricMetadata) {
+	for i := range mms {
+		mm := &mms[i]
+		common.AddMetadata(bytesutil.ToUnsafeString(mm.MetricFamilyName), mm.Type.String(),
+			bytesutil.ToUnsafeString(mm.Help), bytesutil.ToUnsafeString(mm.Unit), "promremotewrite")
+	}
+}
+
 func insertRows(timeseries []prompb.TimeSeries, extraLabels []prompbmarshal.Label) error {
 	ctx := common.GetInsertCtx()
 	defer common.PutInsertCtx(ctx)
@@ -40,6 +50,7 @@ func insertRows(timeseries []prompb.TimeSeries, extraLabels []prompbmarshal.Labe
 		rowsLen += len(timeseries[i].Samples)
 	}
 	ctx.Reset(rowsLen)
+	ctx.SetProtocol("promremotewrite")
 	rowsTotal := 0
 	hasRelabeling := relabel.HasRelabeling()
 	for i := range timeseries {
@@ -71,6 +82,14 @@ func insertRows(timeseries []prompb.TimeSeries, extraLabels []prompbmarshal.Labe
 				return err
 			}
 		}
+		exemplars := ts.Exemplars
+		for i := range exemplars {
+			e := &exemplars[i]
+			metricNameRaw, err = ctx.WriteExemplar(metricNameRaw, ctx.Labels, e.Labels, e.Value, e.Timestamp)
+			if err != nil {
+				return err
+			}
+		}
 	}
 	rowsInserted.Add(rowsTotal)
 	rowsPerInsert.Update(float64(rowsTotal))
@@ -0,0 +1,237 @@
+package relabel
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sync/atomic"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/envtemplate"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/procutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/VictoriaMetrics/metricsql"
+	"gopkg.in/yaml.v2"
+)
+
+var dropRulesConfig = flag.String("dropRulesConfig", "", "Optional path to a file with rules for dropping ingested samples before writing them to the storage. "+
+	"The file is re-read on SIGHUP signal and on /-/reload request. See https://victoriametrics.github.io/#dropping-ingested-samples")
+
+// initDropRules loads -dropRulesConfig and starts watching for SIGHUP signals for reloading it.
+func initDropRules() {
+	drs, err := loadDropRules()
+	if err != nil {
+		logger.Fatalf("cannot load -dropRulesConfig: %s", err)
+	}
+	drsGlobal.Store(drs)
+	atomic.StoreUint64(&dropRulesConfigSuccess, 1)
+	atomic.StoreUint64(&dropRulesConfigTimestamp, fasttime.UnixTimestamp())
+	if len(*dropRulesConfig) == 0 {
+		return
+	}
+	sighupCh := procutil.NewSighupChan()
+	go func() {
+		for range sighupCh {
+			logger.Infof("received SIGHUP; reloading -dropRulesConfig=%q...", *dropRulesConfig)
+			dropRulesConfigReloads.Inc()
+			drs, err := loadDropRules()
+			if err != nil {
+				dropRulesConfigReloadErrors.Inc()
+				atomic.StoreUint64(&dropRulesConfigSuccess, 0)
+				logger.Errorf("cannot load the updated -dropRulesConfig: %s; preserving the previous config", err)
+				continue
+			}
+			drsGlobal.Store(drs)
+			atomic.StoreUint64(&dropRulesConfigSuccess, 1)
+			atomic.StoreUint64(&dropRulesConfigTimestamp, fasttime.UnixTimestamp())
+			logger.Infof("successfully reloaded -dropRulesConfig=%q with %d rules", *dropRulesConfig, len(drs.rules))
+		}
+	}()
+}
+
+// CheckDropRulesConfig checks -dropRulesConfig for errors.
+func CheckDropRulesConfig() error {
+	_, err := loadDropRules()
+	return err
+}
+
+var (
+	dropRulesConfigReloads      = metrics.NewCounter(`vm_drop_rules_config_reloads_total`)
+	dropRulesConfigReloadErrors = metrics.NewCounter(`vm_drop_rules_config_reloads_errors_total`)
+
+	dropRulesConfigSuccess   uint64
+	dropRulesConfigTimestamp uint64
+
+	_ = metrics.NewGauge(`vm_drop_rules_config_last_reload_successful`, func() float64 {
+		return float64(atomic.LoadUint64(&dropRulesConfigSuccess))
+	})
+	_ = metrics.NewGauge(`vm_drop_rules_config_last_reload_success_timestamp_seconds`, func() float64 {
+		return float64(atomic.LoadUint64(&dropRulesConfigTimestamp))
+	})
+)
+
+var drsGlobal atomic.Value
+
+// dropRuleConfig represents a single rule from -dropRulesConfig.
+type dropRuleConfig struct {
+	// Name is the rule name, which is used in `vm_drop_rule_matches_total{rule="<name>"}` metric.
+	Name string `yaml:"name"`
+
+	// Match is a series selector such as `{__name__=~"foo_.+",job="bar"}`.
+	//
+	// Samples for series matching the selector are dropped.
+	Match string `yaml:"match"`
+}
+
+type dropRules struct {
+	rules []*dropRule
+}
+
+type dropRule struct {
+	name    string
+	filters []dropRuleFilter
+
+	// matches counts the number of dropped time series entries.
+	matches *metrics.Counter
+}
+
+type dropRuleFilter struct {
+	label      string
+	value      string
+	isNegative bool
+
+	// re is set for regexp filters.
+	re *regexp.Regexp
+}
+
+func loadDropRules() (*dropRules, error) {
+	if len(*dropRulesConfig) == 0 {
+		return &dropRules{}, nil
+	}
+	data, err := ioutil.ReadFile(*dropRulesConfig)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read -dropRulesConfig=%q: %w", *dropRulesConfig, err)
+	}
+	data = envtemplate.Replace(data)
+	drs, err := parseDropRules(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse -dropRulesConfig=%q: %w", *dropRulesConfig, err)
+	}
+	return drs, nil
+}
+
+func parseDropRules(data []byte) (*dropRules, error) {
+	var drcs []dropRuleConfig
+	if err := yaml.UnmarshalStrict(data, &drcs); err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool, len(drcs))
+	rules := make([]*dropRule, 0, len(drcs))
+	for i := range drcs {
+		drc := &drcs[i]
+		if len(drc.Name) == 0 {
+			return nil, fmt.Errorf("missing `name` in rule #%d", i+1)
+		}
+		if names[drc.Name] {
+			return nil, fmt.Errorf("duplicate rule name %q; rule names must be unique", drc.Name)
+		}
+		names[drc.Name] = true
+		filters, err := parseDropRuleFilters(drc.Match)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse `match` for rule %q: %w", drc.Name, err)
+		}
+		rules = append(rules, &dropRule{
+			name:    drc.Name,
+			filters: filters,
+			matches: metrics.GetOrCreateCounter(fmt.Sprintf(`vm_drop_rule_matches_total{rule=%q}`, drc.Name)),
+		})
+	}
+	return &dropRules{
+		rules: rules,
+	}, nil
+}
+
+func parseDropRuleFilters(s string) ([]dropRuleFilter, error) {
+	expr, err := metricsql.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	me, ok := expr.(*metricsql.MetricExpr)
+	if !ok {
+		return nil, fmt.Errorf("expecting series selector; got %q", expr.AppendString(nil))
+	}
+	if len(me.LabelFilters) == 0 {
+		return nil, fmt.Errorf("series selector cannot be empty")
+	}
+	filters := make([]dropRuleFilter, 0, len(me.LabelFilters))
+	for _, lf := range me.LabelFilters {
+		f := dropRuleFilter{
+			label:      lf.Label,
+			value:      lf.Value,
+			isNegative: lf.IsNegative,
+		}
+		if lf.IsRegexp {
+			re, err := metricsql.CompileRegexpAnchored(lf.Value)
+			if err != nil {
+				return nil, fmt.Errorf("cannot compile regexp %q for label %q: %w", lf.Value, lf.Label, err)
+			}
+			f.re = re
+		}
+		filters = append(filters, f)
+	}
+	return filters, nil
+}
+
+// hasDropRules returns true if -dropRulesConfig contains at least a single rule.
+func hasDropRules() bool {
+	drs := drsGlobal.Load().(*dropRules)
+	return len(drs.rules) > 0
+}
+
+// shouldDrop returns true if labels match at least a single rule in drs.
+//
+// The first matching rule counter is incremented.
+func (drs *dropRules) shouldDrop(labels []prompb.Label) bool {
+	for _, dr := range drs.rules {
+		if dr.match(labels) {
+			dr.matches.Inc()
+			return true
+		}
+	}
+	return false
+}
+
+func (dr *dropRule) match(labels []prompb.Label) bool {
+	for i := range dr.filters {
+		if !dr.filters[i].match(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *dropRuleFilter) match(labels []prompb.Label) bool {
+	// Missing label is equivalent to label with empty value like in Prometheus.
+	value := ""
+	for _, label := range labels {
+		name := bytesutil.ToUnsafeString(label.Name)
+		if len(name) == 0 {
+			name = "__name__"
+		}
+		if name == f.label {
+			value = bytesutil.ToUnsafeString(label.Value)
+			break
+		}
+	}
+	var ok bool
+	if f.re != nil {
+		ok = f.re.MatchString(value)
+	} else {
+		ok = value == f.value
+	}
+	return ok != f.isNegative
+}
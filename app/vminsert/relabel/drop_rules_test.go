@@ -0,0 +1,91 @@
+package relabel
+
+import (
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+)
+
+func TestParseDropRulesFailure(t *testing.T) {
+	f := func(data string) {
+		t.Helper()
+		if _, err := parseDropRules([]byte(data)); err == nil {
+			t.Fatalf("expecting non-nil error for %q", data)
+		}
+	}
+	// Invalid yaml
+	f(`foo`)
+	// Unknown field
+	f(`
+- name: foo
+  match: bar
+  foo: baz
+`)
+	// Missing name
+	f(`
+- match: bar
+`)
+	// Duplicate names
+	f(`
+- name: foo
+  match: bar
+- name: foo
+  match: baz
+`)
+	// Missing match
+	f(`
+- name: foo
+`)
+	// Invalid selector
+	f(`
+- name: foo
+  match: 'sum(bar)'
+`)
+	// Invalid regexp
+	f(`
+- name: foo
+  match: '{job=~"("}'
+`)
+}
+
+func TestDropRulesShouldDrop(t *testing.T) {
+	drs, err := parseDropRules([]byte(`
+- name: cardinality-bomb
+  match: '{__name__=~"http_requests_.+",path!=""}'
+- name: tenant-foo
+  match: '{tenant="foo",env!~"prod|staging"}'
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	f := func(labels []prompb.Label, resultExpected bool) {
+		t.Helper()
+		result := drs.shouldDrop(labels)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for %v; got %v; want %v", labels, result, resultExpected)
+		}
+	}
+	newLabels := func(kvs ...string) []prompb.Label {
+		var labels []prompb.Label
+		for i := 0; i < len(kvs); i += 2 {
+			labels = append(labels, prompb.Label{
+				Name:  []byte(kvs[i]),
+				Value: []byte(kvs[i+1]),
+			})
+		}
+		return labels
+	}
+
+	// Empty name is equivalent to __name__
+	f(newLabels("", "http_requests_total", "path", "/foo"), true)
+	f(newLabels("__name__", "http_requests_total", "path", "/foo"), true)
+	f(newLabels("", "http_requests_total"), false)
+	f(newLabels("", "http_requests", "path", "/foo"), false)
+
+	// Missing label matches empty value
+	f(newLabels("", "foo", "tenant", "foo"), true)
+	f(newLabels("", "foo", "tenant", "foo", "env", "dev"), true)
+	f(newLabels("", "foo", "tenant", "foo", "env", "prod"), false)
+	f(newLabels("", "foo", "tenant", "bar"), false)
+	f(nil, false)
+}
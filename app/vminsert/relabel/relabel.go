@@ -6,6 +6,7 @@ import (
 	"sync/atomic"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/procutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
@@ -19,11 +20,14 @@ var relabelConfig = flag.String("relabelConfig", "", "Optional path to a file wi
 
 // Init must be called after flag.Parse and before using the relabel package.
 func Init() {
+	initDropRules()
 	pcs, err := loadRelabelConfig()
 	if err != nil {
 		logger.Fatalf("cannot load relabelConfig: %s", err)
 	}
-	pcsGlobal.Store(pcs)
+	pcGlobal.Store(newParsedConfig(pcs))
+	atomic.StoreUint64(&configSuccess, 1)
+	atomic.StoreUint64(&configTimestamp, fasttime.UnixTimestamp())
 	if len(*relabelConfig) == 0 {
 		return
 	}
@@ -31,18 +35,58 @@ func Init() {
 	go func() {
 		for range sighupCh {
 			logger.Infof("received SIGHUP; reloading -relabelConfig=%q...", *relabelConfig)
+			configReloads.Inc()
 			pcs, err := loadRelabelConfig()
 			if err != nil {
+				configReloadErrors.Inc()
+				atomic.StoreUint64(&configSuccess, 0)
 				logger.Errorf("cannot load the updated relabelConfig: %s; preserving the previous config", err)
 				continue
 			}
-			pcsGlobal.Store(pcs)
+			pcGlobal.Store(newParsedConfig(pcs))
+			atomic.StoreUint64(&configSuccess, 1)
+			atomic.StoreUint64(&configTimestamp, fasttime.UnixTimestamp())
 			logger.Infof("successfully reloaded -relabelConfig=%q", *relabelConfig)
 		}
 	}()
 }
 
-var pcsGlobal atomic.Value
+var (
+	configReloads      = metrics.NewCounter(`vm_relabel_config_reloads_total`)
+	configReloadErrors = metrics.NewCounter(`vm_relabel_config_reloads_errors_total`)
+
+	configSuccess   uint64
+	configTimestamp uint64
+
+	_ = metrics.NewGauge(`vm_relabel_config_last_reload_successful`, func() float64 {
+		return float64(atomic.LoadUint64(&configSuccess))
+	})
+	_ = metrics.NewGauge(`vm_relabel_config_last_reload_success_timestamp_seconds`, func() float64 {
+		return float64(atomic.LoadUint64(&configTimestamp))
+	})
+)
+
+var pcGlobal atomic.Value
+
+// parsedConfig holds the parsed -relabelConfig together with per-rule match counters.
+type parsedConfig struct {
+	pcs *promrelabel.ParsedConfigs
+
+	// ruleMatches contains counters for the number of samples matching every rule in pcs.
+	ruleMatches []*metrics.Counter
+}
+
+func newParsedConfig(pcs *promrelabel.ParsedConfigs) *parsedConfig {
+	n := pcs.Len()
+	ruleMatches := make([]*metrics.Counter, n)
+	for i := range ruleMatches {
+		ruleMatches[i] = metrics.GetOrCreateCounter(fmt.Sprintf(`vm_relabel_rule_matches_total{rule="%d"}`, i+1))
+	}
+	return &parsedConfig{
+		pcs:         pcs,
+		ruleMatches: ruleMatches,
+	}
+}
 
 func loadRelabelConfig() (*promrelabel.ParsedConfigs, error) {
 	if len(*relabelConfig) == 0 {
@@ -55,33 +99,80 @@ func loadRelabelConfig() (*promrelabel.ParsedConfigs, error) {
 	return pcs, nil
 }
 
-// HasRelabeling returns true if there is global relabeling.
+// HasRelabeling returns true if there is global relabeling or there are drop rules from -dropRulesConfig.
 func HasRelabeling() bool {
-	pcs := pcsGlobal.Load().(*promrelabel.ParsedConfigs)
-	return pcs.Len() > 0
+	pc := pcGlobal.Load().(*parsedConfig)
+	return pc.pcs.Len() > 0 || hasDropRules()
 }
 
 // Ctx holds relabeling context.
 type Ctx struct {
 	// tmpLabels is used during ApplyRelabeling call.
 	tmpLabels []prompbmarshal.Label
+
+	// pc is the config used for counting matches.
+	pc *parsedConfig
+
+	// matches contains the number of matches per each rule in pc since the last flushMatches call.
+	//
+	// It is used for reducing contention on global counters.
+	matches []uint64
 }
 
 // Reset resets ctx.
 func (ctx *Ctx) Reset() {
+	ctx.flushMatches()
 	promrelabel.CleanLabels(ctx.tmpLabels)
 	ctx.tmpLabels = ctx.tmpLabels[:0]
 }
 
+func (ctx *Ctx) flushMatches() {
+	if ctx.pc == nil {
+		return
+	}
+	for i, n := range ctx.matches {
+		if n > 0 {
+			ctx.pc.ruleMatches[i].Add(int(n))
+		}
+	}
+	ctx.pc = nil
+	ctx.matches = ctx.matches[:0]
+}
+
+func (ctx *Ctx) setConfig(pc *parsedConfig) {
+	if ctx.pc == pc {
+		return
+	}
+	// The config has been changed - flush matches for the previous config.
+	ctx.flushMatches()
+	ctx.pc = pc
+	n := pc.pcs.Len()
+	if cap(ctx.matches) < n {
+		ctx.matches = make([]uint64, n)
+	}
+	ctx.matches = ctx.matches[:n]
+	for i := range ctx.matches {
+		ctx.matches[i] = 0
+	}
+}
+
 // ApplyRelabeling applies relabeling to the given labels and returns the result.
 //
+// Empty result is returned if the labels match drop rules from -dropRulesConfig.
+// Drop rules are applied before relabeling rules, so they match the original labels.
+//
 // The returned labels are valid until the next call to ApplyRelabeling.
 func (ctx *Ctx) ApplyRelabeling(labels []prompb.Label) []prompb.Label {
-	pcs := pcsGlobal.Load().(*promrelabel.ParsedConfigs)
-	if pcs.Len() == 0 {
+	drs := drsGlobal.Load().(*dropRules)
+	if drs.shouldDrop(labels) {
+		return labels[:0]
+	}
+	pc := pcGlobal.Load().(*parsedConfig)
+	if pc.pcs.Len() == 0 {
 		// There are no relabeling rules.
 		return labels
 	}
+	ctx.setConfig(pc)
 	// Convert src to prompbmarshal.Label format suitable for relabeling.
 	tmpLabels := ctx.tmpLabels[:0]
 	for _, label := range labels {
@@ -97,7 +188,7 @@ func (ctx *Ctx) ApplyRelabeling(labels []prompb.Label) []prompb.Label {
 	}
 
 	// Apply relabeling
-	tmpLabels = pcs.Apply(tmpLabels, 0, true)
+	tmpLabels = pc.pcs.ApplyCountMatches(tmpLabels, 0, true, ctx.matches)
 	ctx.tmpLabels = tmpLabels
 	if len(tmpLabels) == 0 {
 		metricsDropped.Inc()
@@ -224,7 +224,7 @@ func MetricsIndexHandler(startTime time.Time, w http.ResponseWriter, r *http.Req
 
 // metricsFind searches for label values that match the given query.
 func metricsFind(tr storage.TimeRange, label, query string, delimiter byte, isExpand bool, deadline searchutils.Deadline) ([]string, error) {
-	n := strings.IndexAny(query, "*{[")
+	n := strings.IndexAny(query, "*?{[")
 	if n < 0 || n == len(query)-1 && strings.HasSuffix(query, "*") {
 		expandTail := n >= 0
 		if expandTail {
@@ -364,7 +364,7 @@ func getRegexpStringForQuery(query string, delimiter byte, isSubquery bool) (str
 	var tail string
 	quotedDelimiter := regexp.QuoteMeta(string([]byte{delimiter}))
 	for {
-		n := strings.IndexAny(query, "*{[,}")
+		n := strings.IndexAny(query, "*?{[,}")
 		if n < 0 {
 			a = append(a, regexp.QuoteMeta(query))
 			tail = ""
@@ -383,6 +383,9 @@ func getRegexpStringForQuery(query string, delimiter byte, isSubquery bool) (str
 		case '*':
 			a = append(a, "[^"+quotedDelimiter+"]*")
 			query = query[1:]
+		case '?':
+			a = append(a, "[^"+quotedDelimiter+"]")
+			query = query[1:]
 		case '{':
 			var opts []string
 			for {
@@ -412,7 +415,7 @@ func getRegexpStringForQuery(query string, delimiter byte, isSubquery bool) (str
 				tail = ""
 				goto end
 			}
-			a = append(a, query[:n+1])
+			a = append(a, getRegexpStringForCharClass(query[1:n], quotedDelimiter))
 			query = query[n+1:]
 		}
 	}
@@ -428,6 +431,16 @@ end:
 	return s, tail
 }
 
+// getRegexpStringForCharClass returns regexp string for `[chars]` character class from Graphite query.
+//
+// `[!chars]` and `[^chars]` are converted to negated character class, which doesn't match the delimiter.
+func getRegexpStringForCharClass(chars, quotedDelimiter string) string {
+	if strings.HasPrefix(chars, "!") || strings.HasPrefix(chars, "^") {
+		return "[^" + chars[1:] + quotedDelimiter + "]"
+	}
+	return "[" + chars + "]"
+}
+
 type regexpCacheEntry struct {
 	re  *regexp.Regexp
 	err error
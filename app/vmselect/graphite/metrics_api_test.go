@@ -36,6 +36,12 @@ func TestGetRegexpForQuery(t *testing.T) {
 	f("foo{ba,r", '.', `^foo\{ba,r\.?$`)
 	f("[a-z]", '.', `^[a-z]\.?$`)
 	f("{foo,x*,x{y,a*b}c}a", '.', `^(?:foo|x[^\.]*|x(?:y|a[^\.]*b)c)a\.?$`)
+	f("foo.ba?", '.', `^foo\.ba[^\.]\.?$`)
+	f("foo_?_bar", '_', `^foo_[^_]_bar_?$`)
+	f("foo.[!ab]", '.', `^foo\.[^ab\.]\.?$`)
+	f("foo.[^0-9]x", '.', `^foo\.[^0-9\.]x\.?$`)
+	f("foo.{a?,[!b]c}", '.', `^foo\.(?:a[^\.]|[^b\.]c)\.?$`)
+	f("host[0-9][0-9].cpu", '.', `^host[0-9][0-9]\.cpu\.?$`)
 }
 
 func TestSortPaths(t *testing.T) {
@@ -50,7 +50,10 @@ func Init() {
 	tmpDirPath := *vmstorage.DataPath + "/tmp"
 	fs.RemoveDirContents(tmpDirPath)
 	netstorage.InitTmpBlocksDir(tmpDirPath)
+	promql.InitSpillDir(tmpDirPath)
 	promql.InitRollupResultCache(*vmstorage.DataPath + "/cache/rollupResult")
+	prometheus.InitLabelValuesCache()
+	prometheus.InitQueryRules()
 
 	concurrencyCh = make(chan struct{}, *maxConcurrentRequests)
 }
@@ -63,8 +66,9 @@ func Stop() {
 var concurrencyCh chan struct{}
 
 var (
-	concurrencyLimitReached = metrics.NewCounter(`vm_concurrent_select_limit_reached_total`)
-	concurrencyLimitTimeout = metrics.NewCounter(`vm_concurrent_select_limit_timeout_total`)
+	concurrencyLimitReached  = metrics.NewCounter(`vm_concurrent_select_limit_reached_total`)
+	concurrencyLimitTimeout  = metrics.NewCounter(`vm_concurrent_select_limit_timeout_total`)
+	concurrencyLimitCanceled = metrics.NewCounter(`vm_search_canceled_total{layer="queue"}`)
 
 	_ = metrics.NewGauge(`vm_concurrent_select_capacity`, func() float64 {
 		return float64(cap(concurrencyCh))
@@ -93,6 +97,11 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 		case concurrencyCh <- struct{}{}:
 			timerpool.Put(t)
 			defer func() { <-concurrencyCh }()
+		case <-r.Context().Done():
+			// The client closed the connection while the request was waiting in the queue.
+			timerpool.Put(t)
+			concurrencyLimitCanceled.Inc()
+			return true
 		case <-t.C:
 			timerpool.Put(t)
 			concurrencyLimitTimeout.Inc()
@@ -114,6 +123,7 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 			sendPrometheusError(w, r, fmt.Errorf("invalid authKey=%q for %q", r.FormValue("authKey"), path))
 			return true
 		}
+		httpserver.LogAuditEvent(r, "reset_rollup_result_cache", "")
 		promql.ResetRollupResultCache()
 		return true
 	}
@@ -163,6 +173,15 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 			return true
 		}
 		return true
+	case "/api/v1/query_batch":
+		queryBatchRequests.Inc()
+		httpserver.EnableCORS(w, r)
+		if err := prometheus.QueryBatchHandler(startTime, w, r); err != nil {
+			queryBatchErrors.Inc()
+			sendPrometheusError(w, r, err)
+			return true
+		}
+		return true
 	case "/api/v1/query_range":
 		queryRangeRequests.Inc()
 		httpserver.EnableCORS(w, r)
@@ -190,6 +209,24 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 			return true
 		}
 		return true
+	case "/api/v1/query_exemplars":
+		queryExemplarsRequests.Inc()
+		httpserver.EnableCORS(w, r)
+		if err := prometheus.QueryExemplarsHandler(startTime, w, r); err != nil {
+			queryExemplarsErrors.Inc()
+			sendPrometheusError(w, r, err)
+			return true
+		}
+		return true
+	case "/api/v1/metadata":
+		metadataRequests.Inc()
+		httpserver.EnableCORS(w, r)
+		if err := prometheus.MetadataHandler(startTime, w, r); err != nil {
+			metadataErrors.Inc()
+			sendPrometheusError(w, r, err)
+			return true
+		}
+		return true
 	case "/api/v1/labels":
 		labelsRequests.Inc()
 		httpserver.EnableCORS(w, r)
@@ -216,6 +253,29 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 			return true
 		}
 		return true
+	case "/api/v1/status/disk_usage":
+		statusDiskUsageRequests.Inc()
+		if err := prometheus.DiskUsageHandler(startTime, w, r); err != nil {
+			statusDiskUsageErrors.Inc()
+			sendPrometheusError(w, r, err)
+			return true
+		}
+		return true
+	case "/api/v1/status/buildinfo":
+		statusBuildInfoRequests.Inc()
+		httpserver.EnableCORS(w, r)
+		prometheus.BuildInfoHandler(w, r)
+		return true
+	case "/api/v1/status/flags":
+		statusFlagsRequests.Inc()
+		httpserver.EnableCORS(w, r)
+		prometheus.FlagsHandler(w, r)
+		return true
+	case "/api/v1/status/runtimeinfo":
+		statusRuntimeInfoRequests.Inc()
+		httpserver.EnableCORS(w, r)
+		prometheus.RuntimeInfoHandler(w, r)
+		return true
 	case "/api/v1/status/active_queries":
 		statusActiveQueriesRequests.Inc()
 		promql.WriteActiveQueries(w)
@@ -252,6 +312,14 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 			return true
 		}
 		return true
+	case "/api/v1/read":
+		remoteReadRequests.Inc()
+		if err := prometheus.RemoteReadHandler(startTime, w, r); err != nil {
+			remoteReadErrors.Inc()
+			httpserver.Errorf(w, r, "error in %q: %s", r.URL.Path, err)
+			return true
+		}
+		return true
 	case "/federate":
 		federateRequests.Inc()
 		if err := prometheus.FederateHandler(startTime, w, r); err != nil {
@@ -362,12 +430,6 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
 		fmt.Fprintf(w, "%s", `{"status":"success","data":{"alerts":[]}}`)
 		return true
-	case "/api/v1/metadata":
-		// Return dumb placeholder
-		metadataRequests.Inc()
-		w.Header().Set("Content-Type", "application/json; charset=utf-8")
-		fmt.Fprintf(w, "%s", `{"status":"success","data":{}}`)
-		return true
 	case "/api/v1/admin/tsdb/delete_series":
 		deleteRequests.Inc()
 		authKey := r.FormValue("authKey")
@@ -419,6 +481,9 @@ var (
 	queryRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/query"}`)
 	queryErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/query"}`)
 
+	queryBatchRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/query_batch"}`)
+	queryBatchErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/query_batch"}`)
+
 	queryRangeRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/query_range"}`)
 	queryRangeErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/query_range"}`)
 
@@ -428,6 +493,12 @@ var (
 	seriesCountRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/series/count"}`)
 	seriesCountErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/series/count"}`)
 
+	queryExemplarsRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/query_exemplars"}`)
+	queryExemplarsErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/query_exemplars"}`)
+
+	metadataRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/metadata"}`)
+	metadataErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/metadata"}`)
+
 	labelsRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/labels"}`)
 	labelsErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/labels"}`)
 
@@ -439,6 +510,13 @@ var (
 
 	statusActiveQueriesRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/status/active_queries"}`)
 
+	statusBuildInfoRequests   = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/status/buildinfo"}`)
+	statusFlagsRequests       = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/status/flags"}`)
+	statusRuntimeInfoRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/status/runtimeinfo"}`)
+
+	statusDiskUsageRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/status/disk_usage"}`)
+	statusDiskUsageErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/status/disk_usage"}`)
+
 	topQueriesRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/status/top_queries"}`)
 	topQueriesErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/status/top_queries"}`)
 
@@ -454,6 +532,9 @@ var (
 	exportNativeRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/export/native"}`)
 	exportNativeErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/export/native"}`)
 
+	remoteReadRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/read"}`)
+	remoteReadErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/api/v1/read"}`)
+
 	federateRequests = metrics.NewCounter(`vm_http_requests_total{path="/federate"}`)
 	federateErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/federate"}`)
 
@@ -490,7 +571,6 @@ var (
 	graphiteTagsDelSeriesRequests = metrics.NewCounter(`vm_http_requests_total{path="/tags/delSeries"}`)
 	graphiteTagsDelSeriesErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/tags/delSeries"}`)
 
-	rulesRequests    = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/rules"}`)
-	alertsRequests   = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/alerts"}`)
-	metadataRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/metadata"}`)
+	rulesRequests  = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/rules"}`)
+	alertsRequests = metrics.NewCounter(`vm_http_requests_total{path="/api/v1/alerts"}`)
 )
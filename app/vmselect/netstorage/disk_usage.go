@@ -0,0 +1,130 @@
+package netstorage
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	"github.com/cespare/xxhash/v2"
+)
+
+// DiskUsage contains estimated disk usage for a group of time series.
+type DiskUsage struct {
+	// Series is the number of time series in the group.
+	Series uint64
+
+	// Samples is the number of samples in the group.
+	Samples uint64
+
+	// DataBytes is the size of compressed samples on disk for the group.
+	DataBytes uint64
+
+	// IndexBytes is the estimated size of indexdb entries for the group.
+	IndexBytes uint64
+}
+
+// EstimateDiskUsage estimates disk usage for time series matching sq.
+//
+// The returned map contains estimations per each value of groupBy label. The map contains a single entry with empty key if groupBy is empty.
+// Only sampleRatio share of the matching time series is scanned if sampleRatio is smaller than 1. The results are scaled accordingly.
+// Data blocks aren't read from disk, since their sizes are available in block headers.
+// IndexBytes are estimated proportionally to the number of series in the group from the total indexdb size.
+func EstimateDiskUsage(sq *storage.SearchQuery, groupBy string, sampleRatio float64, deadline searchutils.Deadline) (map[string]*DiskUsage, error) {
+	if deadline.Exceeded() {
+		return nil, fmt.Errorf("timeout exceeded before starting the query processing: %s", deadline.String())
+	}
+	if sampleRatio <= 0 || sampleRatio > 1 {
+		return nil, fmt.Errorf("sampleRatio must be in the range (0..1]; got %g", sampleRatio)
+	}
+	tr := storage.TimeRange{
+		MinTimestamp: sq.MinTimestamp,
+		MaxTimestamp: sq.MaxTimestamp,
+	}
+	release, err := vmstorage.CheckTimeRange(tr)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	tfss, err := setupTfss(tr, sq.TagFilterss, deadline)
+	if err != nil {
+		return nil, err
+	}
+
+	vmstorage.WG.Add(1)
+	defer vmstorage.WG.Done()
+
+	sr := getStorageSearch()
+	defer putStorageSearch(sr)
+	sr.Init(vmstorage.Storage, tfss, tr, getMaxMetricsPerSearch(), deadline.Deadline(), deadline.CancelCh())
+
+	maxHash := uint64(math.MaxUint64)
+	if sampleRatio < 1 {
+		maxHash = uint64(sampleRatio * math.MaxUint64)
+	}
+	dus := make(map[string]*DiskUsage)
+	seriesSeen := make(map[string]map[uint64]struct{})
+	var mn storage.MetricName
+	blocksRead := 0
+	for sr.NextMetricBlock() {
+		blocksRead++
+		if deadline.Exceeded() {
+			return nil, fmt.Errorf("timeout exceeded while fetching data block #%d from storage: %s", blocksRead, deadline.String())
+		}
+		metricName := sr.MetricBlockRef.MetricName
+		h := xxhash.Sum64(metricName)
+		if h > maxHash {
+			continue
+		}
+		group := ""
+		if len(groupBy) > 0 {
+			if err := mn.Unmarshal(metricName); err != nil {
+				return nil, fmt.Errorf("cannot unmarshal metricName for block #%d: %w", blocksRead, err)
+			}
+			group = string(mn.GetTagValue(groupBy))
+		}
+		du := dus[group]
+		if du == nil {
+			du = &DiskUsage{}
+			dus[group] = du
+			seriesSeen[group] = make(map[uint64]struct{})
+		}
+		if _, ok := seriesSeen[group][h]; !ok {
+			seriesSeen[group][h] = struct{}{}
+			du.Series++
+		}
+		br := sr.MetricBlockRef.BlockRef
+		du.Samples += uint64(br.RowsCount())
+		du.DataBytes += br.SizeBytes()
+	}
+	if err := sr.Error(); err != nil {
+		if errors.Is(err, storage.ErrDeadlineExceeded) {
+			return nil, fmt.Errorf("timeout exceeded during the query: %s", deadline.String())
+		}
+		if errors.Is(err, storage.ErrSearchCanceled) {
+			return nil, fmt.Errorf("the query has been stopped: %s", deadline.String())
+		}
+		return nil, fmt.Errorf("search error after reading %d data blocks: %w", blocksRead, err)
+	}
+
+	var m storage.Metrics
+	vmstorage.Storage.UpdateMetrics(&m)
+	indexSizeBytes := m.IndexDBMetrics.SizeBytes
+	totalSeries, err := vmstorage.GetSeriesCount(deadline.Deadline())
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain the total number of series: %w", err)
+	}
+	for _, du := range dus {
+		if sampleRatio < 1 {
+			du.Series = uint64(float64(du.Series) / sampleRatio)
+			du.Samples = uint64(float64(du.Samples) / sampleRatio)
+			du.DataBytes = uint64(float64(du.DataBytes) / sampleRatio)
+		}
+		if totalSeries > 0 {
+			du.IndexBytes = uint64(float64(indexSizeBytes) * float64(du.Series) / float64(totalSeries))
+		}
+	}
+	return dus, nil
+}
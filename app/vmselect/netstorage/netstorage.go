@@ -15,6 +15,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/cgroup"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
 	"github.com/VictoriaMetrics/metrics"
@@ -24,9 +25,28 @@ var (
 	maxTagKeysPerSearch          = flag.Int("search.maxTagKeys", 100e3, "The maximum number of tag keys returned from /api/v1/labels")
 	maxTagValuesPerSearch        = flag.Int("search.maxTagValues", 100e3, "The maximum number of tag values returned from /api/v1/label/<label_name>/values")
 	maxTagValueSuffixesPerSearch = flag.Int("search.maxTagValueSuffixesPerSearch", 100e3, "The maximum number of tag value suffixes returned from /metrics/find")
-	maxMetricsPerSearch          = flag.Int("search.maxUniqueTimeseries", 300e3, "The maximum number of unique time series each search can scan")
+	maxMetricsPerSearch          = flag.Int("search.maxUniqueTimeseries", 300e3, "The maximum number of unique time series each search can scan. "+
+		"The flag may be changed at runtime via /-/flags page")
 )
 
+// maxMetricsPerSearchValue contains -search.maxUniqueTimeseries value, which may be changed at runtime.
+var maxMetricsPerSearchValue int64
+
+func init() {
+	flagutil.RegisterHotFlag("search.maxUniqueTimeseries", func() error {
+		if *maxMetricsPerSearch < 0 {
+			return fmt.Errorf("the value cannot be negative; got %d", *maxMetricsPerSearch)
+		}
+		return nil
+	}, func() {
+		atomic.StoreInt64(&maxMetricsPerSearchValue, int64(*maxMetricsPerSearch))
+	})
+}
+
+func getMaxMetricsPerSearch() int {
+	return int(atomic.LoadInt64(&maxMetricsPerSearchValue))
+}
+
 // Result is a single timeseries result.
 //
 // ProcessSearchQuery returns Result slice.
@@ -59,6 +79,9 @@ type Results struct {
 	packedTimeseries []packedTimeseries
 	sr               *storage.Search
 	tbf              *tmpBlocksFile
+
+	// release must be called when rss is no longer needed, so the partitions fetched from cold storage could be offloaded back.
+	release func()
 }
 
 // Len returns the number of results in rss.
@@ -76,6 +99,8 @@ func (rss *Results) mustClose() {
 	rss.sr = nil
 	putTmpBlocksFile(rss.tbf)
 	rss.tbf = nil
+	rss.release()
+	rss.release = nil
 }
 
 var timeseriesWorkCh = make(chan *timeseriesWork, gomaxprocs*16)
@@ -707,6 +732,32 @@ func GetSeriesCount(deadline searchutils.Deadline) (uint64, error) {
 	return n, nil
 }
 
+// SearchExemplars returns exemplars on the given tr for time series matching the given tagFilterss.
+func SearchExemplars(tr storage.TimeRange, tagFilterss [][]storage.TagFilter, deadline searchutils.Deadline) ([]storage.ExemplarSeries, error) {
+	if deadline.Exceeded() {
+		return nil, fmt.Errorf("timeout exceeded before starting the query processing: %s", deadline.String())
+	}
+	tfss, err := setupTfss(tr, tagFilterss, deadline)
+	if err != nil {
+		return nil, err
+	}
+	ess, err := vmstorage.SearchExemplars(tfss, tr)
+	if err != nil {
+		return nil, fmt.Errorf("error during exemplars search: %w", err)
+	}
+	return ess, nil
+}
+
+// SearchMetadata returns metadata for the given metric.
+//
+// Metadata for all the metrics is returned if metric is empty. Up to limit entries are returned if limit > 0.
+func SearchMetadata(metric string, limit int, deadline searchutils.Deadline) ([]storage.MetricMetadata, error) {
+	if deadline.Exceeded() {
+		return nil, fmt.Errorf("timeout exceeded before starting the query processing: %s", deadline.String())
+	}
+	return vmstorage.SearchMetadata(metric, limit), nil
+}
+
 func getStorageSearch() *storage.Search {
 	v := ssPool.Get()
 	if v == nil {
@@ -736,9 +787,11 @@ func ExportBlocks(sq *storage.SearchQuery, deadline searchutils.Deadline, f func
 		MinTimestamp: sq.MinTimestamp,
 		MaxTimestamp: sq.MaxTimestamp,
 	}
-	if err := vmstorage.CheckTimeRange(tr); err != nil {
+	release, err := vmstorage.CheckTimeRange(tr)
+	if err != nil {
 		return err
 	}
+	defer release()
 	tfss, err := setupTfss(tr, sq.TagFilterss, deadline)
 	if err != nil {
 		return err
@@ -749,7 +802,7 @@ func ExportBlocks(sq *storage.SearchQuery, deadline searchutils.Deadline, f func
 
 	sr := getStorageSearch()
 	defer putStorageSearch(sr)
-	sr.Init(vmstorage.Storage, tfss, tr, *maxMetricsPerSearch, deadline.Deadline())
+	sr.Init(vmstorage.Storage, tfss, tr, getMaxMetricsPerSearch(), deadline.Deadline(), deadline.CancelCh())
 
 	// Start workers that call f in parallel on available CPU cores.
 	gomaxprocs := cgroup.AvailableCPUs()
@@ -810,6 +863,9 @@ func ExportBlocks(sq *storage.SearchQuery, deadline searchutils.Deadline, f func
 		if errors.Is(err, storage.ErrDeadlineExceeded) {
 			return fmt.Errorf("timeout exceeded during the query: %s", deadline.String())
 		}
+		if errors.Is(err, storage.ErrSearchCanceled) {
+			return fmt.Errorf("the query has been stopped: %s", deadline.String())
+		}
 		return fmt.Errorf("search error after reading %d data blocks: %w", blocksRead, err)
 	}
 	return nil
@@ -842,15 +898,17 @@ func SearchMetricNames(sq *storage.SearchQuery, deadline searchutils.Deadline) (
 		MinTimestamp: sq.MinTimestamp,
 		MaxTimestamp: sq.MaxTimestamp,
 	}
-	if err := vmstorage.CheckTimeRange(tr); err != nil {
+	release, err := vmstorage.CheckTimeRange(tr)
+	if err != nil {
 		return nil, err
 	}
+	defer release()
 	tfss, err := setupTfss(tr, sq.TagFilterss, deadline)
 	if err != nil {
 		return nil, err
 	}
 
-	mns, err := vmstorage.SearchMetricNames(tfss, tr, *maxMetricsPerSearch, deadline.Deadline())
+	mns, err := vmstorage.SearchMetricNames(tfss, tr, getMaxMetricsPerSearch(), deadline.Deadline(), deadline.CancelCh())
 	if err != nil {
 		return nil, fmt.Errorf("cannot find metric names: %w", err)
 	}
@@ -870,11 +928,13 @@ func ProcessSearchQuery(sq *storage.SearchQuery, fetchData bool, deadline search
 		MinTimestamp: sq.MinTimestamp,
 		MaxTimestamp: sq.MaxTimestamp,
 	}
-	if err := vmstorage.CheckTimeRange(tr); err != nil {
+	release, err := vmstorage.CheckTimeRange(tr)
+	if err != nil {
 		return nil, err
 	}
 	tfss, err := setupTfss(tr, sq.TagFilterss, deadline)
 	if err != nil {
+		release()
 		return nil, err
 	}
 
@@ -882,7 +942,7 @@ func ProcessSearchQuery(sq *storage.SearchQuery, fetchData bool, deadline search
 	defer vmstorage.WG.Done()
 
 	sr := getStorageSearch()
-	maxSeriesCount := sr.Init(vmstorage.Storage, tfss, tr, *maxMetricsPerSearch, deadline.Deadline())
+	maxSeriesCount := sr.Init(vmstorage.Storage, tfss, tr, getMaxMetricsPerSearch(), deadline.Deadline(), deadline.CancelCh())
 	m := make(map[string][]blockRef, maxSeriesCount)
 	orderedMetricNames := make([]string, 0, maxSeriesCount)
 	blocksRead := 0
@@ -893,6 +953,7 @@ func ProcessSearchQuery(sq *storage.SearchQuery, fetchData bool, deadline search
 		if deadline.Exceeded() {
 			putTmpBlocksFile(tbf)
 			putStorageSearch(sr)
+			release()
 			return nil, fmt.Errorf("timeout exceeded while fetching data block #%d from storage: %s", blocksRead, deadline.String())
 		}
 		buf = sr.MetricBlockRef.BlockRef.Marshal(buf[:0])
@@ -900,6 +961,7 @@ func ProcessSearchQuery(sq *storage.SearchQuery, fetchData bool, deadline search
 		if err != nil {
 			putTmpBlocksFile(tbf)
 			putStorageSearch(sr)
+			release()
 			return nil, fmt.Errorf("cannot write %d bytes to temporary file: %w", len(buf), err)
 		}
 		metricName := sr.MetricBlockRef.MetricName
@@ -922,14 +984,19 @@ func ProcessSearchQuery(sq *storage.SearchQuery, fetchData bool, deadline search
 	if err := sr.Error(); err != nil {
 		putTmpBlocksFile(tbf)
 		putStorageSearch(sr)
+		release()
 		if errors.Is(err, storage.ErrDeadlineExceeded) {
 			return nil, fmt.Errorf("timeout exceeded during the query: %s", deadline.String())
 		}
+		if errors.Is(err, storage.ErrSearchCanceled) {
+			return nil, fmt.Errorf("the query has been stopped: %s", deadline.String())
+		}
 		return nil, fmt.Errorf("search error after reading %d data blocks: %w", blocksRead, err)
 	}
 	if err := tbf.Finalize(); err != nil {
 		putTmpBlocksFile(tbf)
 		putStorageSearch(sr)
+		release()
 		return nil, fmt.Errorf("cannot finalize temporary file: %w", err)
 	}
 
@@ -947,6 +1014,7 @@ func ProcessSearchQuery(sq *storage.SearchQuery, fetchData bool, deadline search
 	rss.packedTimeseries = pts
 	rss.sr = sr
 	rss.tbf = tbf
+	rss.release = release
 	return &rss, nil
 }
 
@@ -963,13 +1031,14 @@ func setupTfss(tr storage.TimeRange, tagFilterss [][]storage.TagFilter, deadline
 			tf := &tagFilters[i]
 			if string(tf.Key) == "__graphite__" {
 				query := tf.Value
-				paths, err := vmstorage.SearchGraphitePaths(tr, query, *maxMetricsPerSearch, deadline.Deadline())
+				maxMetrics := getMaxMetricsPerSearch()
+				paths, err := vmstorage.SearchGraphitePaths(tr, query, maxMetrics, deadline.Deadline())
 				if err != nil {
 					return nil, fmt.Errorf("error when searching for Graphite paths for query %q: %w", query, err)
 				}
-				if len(paths) >= *maxMetricsPerSearch {
+				if len(paths) >= maxMetrics {
 					return nil, fmt.Errorf("more than -search.maxUniqueTimeseries=%d time series match Graphite query %q; "+
-						"either narrow down the query or increase -search.maxUniqueTimeseries command-line flag value", *maxMetricsPerSearch, query)
+						"either narrow down the query or increase -search.maxUniqueTimeseries command-line flag value", maxMetrics, query)
 				}
 				tfs.AddGraphiteQuery(query, paths, tf.IsNegative)
 				continue
@@ -0,0 +1,117 @@
+package prometheus
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/bufferedwriter"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// DiskUsageHandler processes /api/v1/status/disk_usage request.
+//
+// It estimates disk space occupied by time series matching `match[]` args on the [start ... end] time range.
+func DiskUsageHandler(startTime time.Time, w http.ResponseWriter, r *http.Request) error {
+	ct := startTime.UnixNano() / 1e6
+	if err := r.ParseForm(); err != nil {
+		return fmt.Errorf("cannot parse form values: %w", err)
+	}
+	start, err := searchutils.GetTime(r, "start", 0)
+	if err != nil {
+		return err
+	}
+	end, err := searchutils.GetTime(r, "end", ct)
+	if err != nil {
+		return err
+	}
+	matches := getMatchesFromRequest(r)
+	if len(matches) == 0 {
+		matches = []string{`{__name__!=""}`}
+	}
+	tagFilterss, err := getTagFilterssFromMatches(matches)
+	if err != nil {
+		return err
+	}
+	etf, err := getEnforcedTagFiltersFromRequest(r)
+	if err != nil {
+		return err
+	}
+	tagFilterss = addEnforcedFiltersToTagFilterss(tagFilterss, etf)
+	groupBy := r.FormValue("group_by")
+	sampleRatio := 1.0
+	if s := r.FormValue("sample"); len(s) > 0 {
+		sampleRatio, err = strconv.ParseFloat(s, 64)
+		if err != nil || sampleRatio <= 0 || sampleRatio > 1 {
+			return fmt.Errorf("`sample` arg must be a number in the range (0..1]; got %q", s)
+		}
+	}
+	topN := 10
+	if s := r.FormValue("topN"); len(s) > 0 {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("cannot parse `topN` arg %q: it must be a positive integer", s)
+		}
+		topN = n
+	}
+	deadline := searchutils.GetDeadlineForExport(r, startTime)
+
+	sq := storage.NewSearchQuery(start, end, tagFilterss)
+	dus, err := netstorage.EstimateDiskUsage(sq, groupBy, sampleRatio, deadline)
+	if err != nil {
+		return fmt.Errorf("cannot estimate disk usage for match[]=%q on the time range (start=%d, end=%d): %w", matches, start, end, err)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	bw := bufferedwriter.Get(w)
+	defer bufferedwriter.Put(bw)
+	writeDiskUsageResponse(bw, dus, groupBy, sampleRatio, topN)
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	diskUsageDuration.UpdateDuration(startTime)
+	return nil
+}
+
+var diskUsageDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/status/disk_usage"}`)
+
+type diskUsageGroup struct {
+	name string
+	du   *netstorage.DiskUsage
+}
+
+func (dug *diskUsageGroup) totalBytes() uint64 {
+	return dug.du.DataBytes + dug.du.IndexBytes
+}
+
+// writeDiskUsageResponse writes topN groups from dus with the biggest disk usage to w.
+func writeDiskUsageResponse(w io.Writer, dus map[string]*netstorage.DiskUsage, groupBy string, sampleRatio float64, topN int) {
+	groups := make([]diskUsageGroup, 0, len(dus))
+	var total netstorage.DiskUsage
+	for name, du := range dus {
+		groups = append(groups, diskUsageGroup{
+			name: name,
+			du:   du,
+		})
+		total.Series += du.Series
+		total.Samples += du.Samples
+		total.DataBytes += du.DataBytes
+		total.IndexBytes += du.IndexBytes
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		a, b := groups[i].totalBytes(), groups[j].totalBytes()
+		if a != b {
+			return a > b
+		}
+		return groups[i].name < groups[j].name
+	})
+	if len(groups) > topN {
+		groups = groups[:topN]
+	}
+	writediskUsageResponse(w, groupBy, sampleRatio, &total, groups)
+}
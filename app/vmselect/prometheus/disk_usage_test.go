@@ -0,0 +1,36 @@
+package prometheus
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
+)
+
+func TestWriteDiskUsageResponse(t *testing.T) {
+	f := func(dus map[string]*netstorage.DiskUsage, groupBy string, topN int, resultExpected string) {
+		t.Helper()
+		var bb bytes.Buffer
+		writeDiskUsageResponse(&bb, dus, groupBy, 1, topN)
+		if bb.String() != resultExpected {
+			t.Fatalf("unexpected response\ngot\n%s\nwant\n%s", bb.String(), resultExpected)
+		}
+	}
+	f(nil, "", 10, `{"status":"success","data":{"groupBy":"","sampleRatio":1,`+
+		`"total":{"series":0,"samples":0,"dataBytes":0,"indexBytes":0,"totalBytes":0,"bytesPerSample":0.000},"groups":[]}}`)
+	f(map[string]*netstorage.DiskUsage{
+		"foo": {Series: 1, Samples: 10, DataBytes: 20, IndexBytes: 5},
+		"bar": {Series: 2, Samples: 40, DataBytes: 30, IndexBytes: 10},
+		"baz": {Series: 1, Samples: 4, DataBytes: 1, IndexBytes: 5},
+	}, "job", 2, `{"status":"success","data":{"groupBy":"job","sampleRatio":1,`+
+		`"total":{"series":4,"samples":54,"dataBytes":51,"indexBytes":20,"totalBytes":71,"bytesPerSample":0.944},"groups":[`+
+		`{"value":"bar","usage":{"series":2,"samples":40,"dataBytes":30,"indexBytes":10,"totalBytes":40,"bytesPerSample":0.750}},`+
+		`{"value":"foo","usage":{"series":1,"samples":10,"dataBytes":20,"indexBytes":5,"totalBytes":25,"bytesPerSample":2.000}}]}}`)
+
+	// Group names must be properly encoded as JSON strings
+	f(map[string]*netstorage.DiskUsage{
+		"a\"b\\c\x01<": {Series: 1, Samples: 2, DataBytes: 3, IndexBytes: 4},
+	}, `job"`, 10, `{"status":"success","data":{"groupBy":"job\"","sampleRatio":1,`+
+		`"total":{"series":1,"samples":2,"dataBytes":3,"indexBytes":4,"totalBytes":7,"bytesPerSample":1.500},"groups":[`+
+		`{"value":"a\"b\\c\u0001\u003c","usage":{"series":1,"samples":2,"dataBytes":3,"indexBytes":4,"totalBytes":7,"bytesPerSample":1.500}}]}}`)
+}
@@ -0,0 +1,185 @@
+package prometheus
+
+import (
+	"flag"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	"github.com/VictoriaMetrics/fastcache"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	labelValuesCacheSize = flagutil.NewBytes("search.labelValuesCacheSize", 0, "The maximum size in bytes for the cache of /api/v1/label/.../values responses. "+
+		"The cache is disabled by default. Enabling the cache may significantly reduce CPU usage when Grafana dashboards with many template variables are frequently refreshed. "+
+		"See also -search.labelValuesCacheTTL")
+	labelValuesCacheTTL = flag.Duration("search.labelValuesCacheTTL", time.Minute, "The maximum duration for caching /api/v1/label/.../values responses if -search.labelValuesCacheSize is set. "+
+		"Label values for newly added time series may be missing in responses for up to this duration. The start and end query args are aligned to this duration "+
+		"in order to improve cache hit rate")
+)
+
+// InitLabelValuesCache initializes the cache for /api/v1/label/.../values responses.
+//
+// The cache is automatically reset on indexdb rotation, so vmstorage must be initialized before calling InitLabelValuesCache.
+func InitLabelValuesCache() {
+	if labelValuesCacheSize.N <= 0 {
+		return
+	}
+	labelValuesCacheV.Store(fastcache.New(labelValuesCacheSize.N))
+	vmstorage.AddIndexDBRotationHook(ResetLabelValuesCache)
+}
+
+// ResetLabelValuesCache resets the cache for /api/v1/label/.../values responses.
+//
+// It must be called when label values may disappear from the storage, e.g. after series deletion or indexdb rotation.
+func ResetLabelValuesCache() {
+	c := getLabelValuesCache()
+	if c == nil {
+		return
+	}
+	labelValuesCacheResets.Inc()
+	c.Reset()
+	logger.Infof("labelValues cache has been cleared")
+}
+
+var labelValuesCacheV atomic.Value
+
+func getLabelValuesCache() *fastcache.Cache {
+	v := labelValuesCacheV.Load()
+	if v == nil {
+		return nil
+	}
+	return v.(*fastcache.Cache)
+}
+
+// alignLabelValuesTimeRange aligns start and end to -search.labelValuesCacheTTL if the cache is enabled.
+//
+// The aligned time range covers the original time range, so the response may contain
+// additional label values from the adjacent time ranges. This is OK, since label values are selected
+// with per-day granularity for the majority of requests anyway.
+func alignLabelValuesTimeRange(start, end int64) (int64, int64) {
+	if getLabelValuesCache() == nil {
+		return start, end
+	}
+	step := labelValuesCacheTTL.Milliseconds()
+	if step < 1000 {
+		step = 1000
+	}
+	start -= start % step
+	if n := end % step; n != 0 {
+		end += step - n
+	}
+	return start, end
+}
+
+func marshalLabelValuesCacheKey(dst []byte, labelName string, matches []string, etf []storage.TagFilter, start, end int64) []byte {
+	dst = encoding.MarshalBytes(dst, bytesutil.ToUnsafeBytes(labelName))
+	dst = encoding.MarshalVarUint64(dst, uint64(len(matches)))
+	for _, match := range matches {
+		dst = encoding.MarshalBytes(dst, bytesutil.ToUnsafeBytes(match))
+	}
+	dst = encoding.MarshalVarUint64(dst, uint64(len(etf)))
+	for i := range etf {
+		dst = etf[i].Marshal(dst)
+	}
+	dst = encoding.MarshalInt64(dst, start)
+	dst = encoding.MarshalInt64(dst, end)
+	return dst
+}
+
+// getCachedLabelValues returns label values for the given key from the cache.
+//
+// false is returned if the cache is disabled or if it doesn't contain non-expired entry for the given key.
+func getCachedLabelValues(key []byte) ([]string, bool) {
+	c := getLabelValuesCache()
+	if c == nil {
+		return nil, false
+	}
+	labelValuesCacheRequests.Inc()
+	bb := labelValuesBufPool.Get()
+	defer labelValuesBufPool.Put(bb)
+	bb.B = c.GetBig(bb.B[:0], key)
+	if len(bb.B) < 8 {
+		labelValuesCacheMisses.Inc()
+		return nil, false
+	}
+	deadline := encoding.UnmarshalUint64(bb.B)
+	if fasttime.UnixTimestamp() >= deadline {
+		labelValuesCacheMisses.Inc()
+		return nil, false
+	}
+	src := bb.B[8:]
+	var labelValues []string
+	for len(src) > 0 {
+		tail, v, err := encoding.UnmarshalBytes(src)
+		if err != nil {
+			logger.Panicf("BUG: cannot unmarshal label value from labelValues cache: %s", err)
+		}
+		labelValues = append(labelValues, string(v))
+		src = tail
+	}
+	return labelValues, true
+}
+
+// putCachedLabelValues puts labelValues for the given key to the cache.
+func putCachedLabelValues(key []byte, labelValues []string) {
+	c := getLabelValuesCache()
+	if c == nil || *labelValuesCacheTTL <= 0 {
+		return
+	}
+	bb := labelValuesBufPool.Get()
+	defer labelValuesBufPool.Put(bb)
+	deadline := fasttime.UnixTimestamp() + uint64(labelValuesCacheTTL.Seconds())
+	bb.B = encoding.MarshalUint64(bb.B[:0], deadline)
+	for _, labelValue := range labelValues {
+		bb.B = encoding.MarshalBytes(bb.B, bytesutil.ToUnsafeBytes(labelValue))
+	}
+	c.SetBig(key, bb.B)
+}
+
+var labelValuesBufPool bytesutil.ByteBufferPool
+
+var (
+	labelValuesCacheRequests = metrics.NewCounter(`vm_cache_requests_total{type="prometheus/labelValues"}`)
+	labelValuesCacheMisses   = metrics.NewCounter(`vm_cache_misses_total{type="prometheus/labelValues"}`)
+	labelValuesCacheResets   = metrics.NewCounter(`vm_cache_resets_total{type="prometheus/labelValues"}`)
+)
+
+var (
+	labelValuesCacheStats           fastcache.Stats
+	labelValuesCacheStatsLock       sync.Mutex
+	labelValuesCacheStatsLastUpdate uint64
+)
+
+func getLabelValuesCacheStats() fastcache.Stats {
+	labelValuesCacheStatsLock.Lock()
+	defer labelValuesCacheStatsLock.Unlock()
+
+	if fasttime.UnixTimestamp()-labelValuesCacheStatsLastUpdate < 2 {
+		return labelValuesCacheStats
+	}
+	var fcs fastcache.Stats
+	if c := getLabelValuesCache(); c != nil {
+		c.UpdateStats(&fcs)
+	}
+	labelValuesCacheStats = fcs
+	labelValuesCacheStatsLastUpdate = fasttime.UnixTimestamp()
+	return labelValuesCacheStats
+}
+
+var (
+	_ = metrics.NewGauge(`vm_cache_entries{type="prometheus/labelValues"}`, func() float64 {
+		return float64(getLabelValuesCacheStats().EntriesCount)
+	})
+	_ = metrics.NewGauge(`vm_cache_size_bytes{type="prometheus/labelValues"}`, func() float64 {
+		return float64(getLabelValuesCacheStats().BytesSize)
+	})
+)
@@ -0,0 +1,72 @@
+package prometheus
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	"github.com/VictoriaMetrics/fastcache"
+)
+
+func TestLabelValuesCache(t *testing.T) {
+	// The cache is disabled by default.
+	if start, end := alignLabelValuesTimeRange(1234, 5678); start != 1234 || end != 5678 {
+		t.Fatalf("unexpected time range alignment for disabled cache: [%d, %d]", start, end)
+	}
+	key := marshalLabelValuesCacheKey(nil, "job", nil, nil, 0, 0)
+	putCachedLabelValues(key, []string{"foo"})
+	if _, ok := getCachedLabelValues(key); ok {
+		t.Fatalf("unexpected cache hit for disabled cache")
+	}
+
+	labelValuesCacheV.Store(fastcache.New(1024 * 1024))
+	defer labelValuesCacheV.Store((*fastcache.Cache)(nil))
+
+	ttl := *labelValuesCacheTTL
+	*labelValuesCacheTTL = 10 * time.Second
+	defer func() {
+		*labelValuesCacheTTL = ttl
+	}()
+	if start, end := alignLabelValuesTimeRange(12345, 56789); start != 10000 || end != 60000 {
+		t.Fatalf("unexpected aligned time range; got [%d, %d]; want [10000, 60000]", start, end)
+	}
+	if start, end := alignLabelValuesTimeRange(20000, 30000); start != 20000 || end != 30000 {
+		t.Fatalf("unexpected aligned time range; got [%d, %d]; want [20000, 30000]", start, end)
+	}
+
+	etf := []storage.TagFilter{{Key: []byte("tenant"), Value: []byte("a")}}
+	key1 := marshalLabelValuesCacheKey(nil, "instance", []string{`up{job="foo"}`}, etf, 10000, 60000)
+	key2 := marshalLabelValuesCacheKey(nil, "instance", []string{`up{job="bar"}`}, etf, 10000, 60000)
+	if _, ok := getCachedLabelValues(key1); ok {
+		t.Fatalf("unexpected cache hit for missing entry")
+	}
+	putCachedLabelValues(key1, []string{"host1", "host2"})
+	putCachedLabelValues(key2, nil)
+	labelValues, ok := getCachedLabelValues(key1)
+	if !ok {
+		t.Fatalf("missing cache entry for key1")
+	}
+	if !reflect.DeepEqual(labelValues, []string{"host1", "host2"}) {
+		t.Fatalf("unexpected label values; got %q; want %q", labelValues, []string{"host1", "host2"})
+	}
+	labelValues, ok = getCachedLabelValues(key2)
+	if !ok {
+		t.Fatalf("missing cache entry for key2")
+	}
+	if len(labelValues) != 0 {
+		t.Fatalf("unexpected label values; got %q; want empty", labelValues)
+	}
+
+	ResetLabelValuesCache()
+	if _, ok := getCachedLabelValues(key1); ok {
+		t.Fatalf("unexpected cache hit after the reset")
+	}
+
+	// Entries mustn't be cached with zero TTL.
+	*labelValuesCacheTTL = 0
+	putCachedLabelValues(key1, []string{"host1"})
+	if _, ok := getCachedLabelValues(key1); ok {
+		t.Fatalf("unexpected cache hit for expired entry")
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/promql"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/querystats"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmstorage"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/cgroup"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
@@ -24,6 +25,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/tracing"
 	"github.com/VictoriaMetrics/metrics"
 	"github.com/VictoriaMetrics/metricsql"
 	"github.com/valyala/fastjson/fastfloat"
@@ -43,6 +45,8 @@ var (
 		"See also '-search.maxLookback' flag, which has the same meaning due to historical reasons")
 	maxStepForPointsAdjustment = flag.Duration("search.maxStepForPointsAdjustment", time.Minute, "The maximum step when /api/v1/query_range handler adjusts "+
 		"points with timestamps closer than -search.latencyOffset to the current time. The adjustment is needed because such points may contain incomplete data")
+	autoAdjustStep = flag.Bool("search.autoAdjustStep", false, "Whether to automatically increase step for /api/v1/query_range requests, which would return more than "+
+		"-search.maxPointsPerTimeseries points per series. By default such requests are rejected. The adjusted step is returned in X-VictoriaMetrics-Adjusted-Step response header")
 )
 
 // Default step used if not set.
@@ -272,7 +276,7 @@ func ExportHandler(startTime time.Time, w http.ResponseWriter, r *http.Request)
 	if err != nil {
 		return err
 	}
-	format := r.FormValue("format")
+	format := getResponseFormat(r)
 	maxRowsPerLine := int(fastfloat.ParseInt64BestEffort(r.FormValue("max_rows_per_line")))
 	reduceMemUsage := searchutils.GetBool(r, "reduce_mem_usage")
 	deadline := searchutils.GetDeadlineForExport(r, startTime)
@@ -283,7 +287,8 @@ func ExportHandler(startTime time.Time, w http.ResponseWriter, r *http.Request)
 	if err != nil {
 		return err
 	}
-	if err := exportHandler(w, matches, etf, start, end, format, maxRowsPerLine, reduceMemUsage, deadline); err != nil {
+	setColdStorageHeader(w, start, end)
+	if err := exportHandler(w, matches, etf, start, end, format, getCSVFieldNames(r), maxRowsPerLine, reduceMemUsage, deadline); err != nil {
 		return fmt.Errorf("error when exporting data for queries=%q on the time range (start=%d, end=%d): %w", matches, start, end, err)
 	}
 	exportDuration.UpdateDuration(startTime)
@@ -292,7 +297,8 @@ func ExportHandler(startTime time.Time, w http.ResponseWriter, r *http.Request)
 
 var exportDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/export"}`)
 
-func exportHandler(w http.ResponseWriter, matches []string, etf []storage.TagFilter, start, end int64, format string, maxRowsPerLine int, reduceMemUsage bool, deadline searchutils.Deadline) error {
+func exportHandler(w http.ResponseWriter, matches []string, etf []storage.TagFilter, start, end int64, format string, csvFieldNames []string,
+	maxRowsPerLine int, reduceMemUsage bool, deadline searchutils.Deadline) error {
 	writeResponseFunc := WriteExportStdResponse
 	writeLineFunc := func(xb *exportBlock, resultsCh chan<- *quicktemplate.ByteBuffer) {
 		bb := quicktemplate.AcquireByteBuffer()
@@ -314,6 +320,22 @@ func exportHandler(w http.ResponseWriter, matches []string, etf []storage.TagFil
 			WriteExportPromAPILine(bb, xb)
 			resultsCh <- bb
 		}
+	} else if format == responseFormatCSV {
+		contentType = "text/csv; charset=utf-8"
+		writeLineFunc = func(xb *exportBlock, resultsCh chan<- *quicktemplate.ByteBuffer) {
+			bb := quicktemplate.AcquireByteBuffer()
+			WriteExportCSVLine(bb, xb, csvFieldNames)
+			resultsCh <- bb
+		}
+	} else if format == responseFormatNDJSON {
+		contentType = "application/x-ndjson"
+	} else if format == responseFormatMsgpack {
+		contentType = "application/msgpack"
+		writeLineFunc = func(xb *exportBlock, resultsCh chan<- *quicktemplate.ByteBuffer) {
+			bb := quicktemplate.AcquireByteBuffer()
+			bb.B = appendMsgpackSeries(bb.B, xb.mn, xb.values, xb.timestamps)
+			resultsCh <- bb
+		}
 	}
 	if maxRowsPerLine > 0 {
 		writeLineFuncOrig := writeLineFunc
@@ -455,8 +477,10 @@ func DeleteHandler(startTime time.Time, r *http.Request) error {
 	if err != nil {
 		return fmt.Errorf("cannot delete time series: %w", err)
 	}
+	httpserver.LogAuditEvent(r, "delete_series", "match[]=%q, deletedSeries=%d", getMatchesFromRequest(r), deletedCount)
 	if deletedCount > 0 {
 		promql.ResetRollupResultCache()
+		ResetLabelValuesCache()
 	}
 	deleteDuration.UpdateDuration(startTime)
 	return nil
@@ -477,54 +501,30 @@ func LabelValuesHandler(startTime time.Time, labelName string, w http.ResponseWr
 		return err
 	}
 	matches := getMatchesFromRequest(r)
-	var labelValues []string
-	if len(matches) == 0 && len(etf) == 0 {
-		if len(r.Form["start"]) == 0 && len(r.Form["end"]) == 0 {
-			var err error
-			labelValues, err = netstorage.GetLabelValues(labelName, deadline)
-			if err != nil {
-				return fmt.Errorf(`cannot obtain label values for %q: %w`, labelName, err)
-			}
-		} else {
-			ct := startTime.UnixNano() / 1e6
-			end, err := searchutils.GetTime(r, "end", ct)
-			if err != nil {
-				return err
-			}
-			start, err := searchutils.GetTime(r, "start", end-defaultStep)
-			if err != nil {
-				return err
-			}
-			tr := storage.TimeRange{
-				MinTimestamp: start,
-				MaxTimestamp: end,
-			}
-			labelValues, err = netstorage.GetLabelValuesOnTimeRange(labelName, tr, deadline)
-			if err != nil {
-				return fmt.Errorf(`cannot obtain label values on time range for %q: %w`, labelName, err)
-			}
-		}
-	} else {
-		// Extended functionality that allows filtering by label filters and time range
-		// i.e. /api/v1/label/foo/values?match[]=foobar{baz="abc"}&start=...&end=...
-		// is equivalent to `label_values(foobar{baz="abc"}, foo)` call on the selected
-		// time range in Grafana templating.
-		if len(matches) == 0 {
-			matches = []string{fmt.Sprintf("{%s!=''}", labelName)}
-		}
+	hasTimeRange := len(r.Form["start"]) > 0 || len(r.Form["end"]) > 0
+	var start, end int64
+	if hasTimeRange || len(matches) > 0 || len(etf) > 0 {
 		ct := startTime.UnixNano() / 1e6
-		end, err := searchutils.GetTime(r, "end", ct)
+		end, err = searchutils.GetTime(r, "end", ct)
 		if err != nil {
 			return err
 		}
-		start, err := searchutils.GetTime(r, "start", end-defaultStep)
+		start, err = searchutils.GetTime(r, "start", end-defaultStep)
 		if err != nil {
 			return err
 		}
-		labelValues, err = labelValuesWithMatches(labelName, matches, etf, start, end, deadline)
+		start, end = alignLabelValuesTimeRange(start, end)
+	}
+	bb := labelValuesBufPool.Get()
+	defer labelValuesBufPool.Put(bb)
+	bb.B = marshalLabelValuesCacheKey(bb.B[:0], labelName, matches, etf, start, end)
+	labelValues, ok := getCachedLabelValues(bb.B)
+	if !ok {
+		labelValues, err = getLabelValues(labelName, matches, etf, hasTimeRange, start, end, deadline)
 		if err != nil {
-			return fmt.Errorf("cannot obtain label values for %q, match[]=%q, start=%d, end=%d: %w", labelName, matches, start, end, err)
+			return err
 		}
+		putCachedLabelValues(bb.B, labelValues)
 	}
 
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
@@ -538,6 +538,39 @@ func LabelValuesHandler(startTime time.Time, labelName string, w http.ResponseWr
 	return nil
 }
 
+func getLabelValues(labelName string, matches []string, etf []storage.TagFilter, hasTimeRange bool, start, end int64, deadline searchutils.Deadline) ([]string, error) {
+	if len(matches) == 0 && len(etf) == 0 {
+		if !hasTimeRange {
+			labelValues, err := netstorage.GetLabelValues(labelName, deadline)
+			if err != nil {
+				return nil, fmt.Errorf(`cannot obtain label values for %q: %w`, labelName, err)
+			}
+			return labelValues, nil
+		}
+		tr := storage.TimeRange{
+			MinTimestamp: start,
+			MaxTimestamp: end,
+		}
+		labelValues, err := netstorage.GetLabelValuesOnTimeRange(labelName, tr, deadline)
+		if err != nil {
+			return nil, fmt.Errorf(`cannot obtain label values on time range for %q: %w`, labelName, err)
+		}
+		return labelValues, nil
+	}
+	// Extended functionality that allows filtering by label filters and time range
+	// i.e. /api/v1/label/foo/values?match[]=foobar{baz="abc"}&start=...&end=...
+	// is equivalent to `label_values(foobar{baz="abc"}, foo)` call on the selected
+	// time range in Grafana templating.
+	if len(matches) == 0 {
+		matches = []string{fmt.Sprintf("{%s!=''}", labelName)}
+	}
+	labelValues, err := labelValuesWithMatches(labelName, matches, etf, start, end, deadline)
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain label values for %q, match[]=%q, start=%d, end=%d: %w", labelName, matches, start, end, err)
+	}
+	return labelValues, nil
+}
+
 func labelValuesWithMatches(labelName string, matches []string, etf []storage.TagFilter, start, end int64, deadline searchutils.Deadline) ([]string, error) {
 	tagFilterss, err := getTagFilterssFromMatches(matches)
 	if err != nil {
@@ -828,6 +861,94 @@ func SeriesCountHandler(startTime time.Time, w http.ResponseWriter, r *http.Requ
 
 var seriesCountDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/series/count"}`)
 
+// QueryExemplarsHandler processes /api/v1/query_exemplars request.
+//
+// See https://prometheus.io/docs/prometheus/latest/querying/api/#querying-exemplars
+func QueryExemplarsHandler(startTime time.Time, w http.ResponseWriter, r *http.Request) error {
+	ct := startTime.UnixNano() / 1e6
+	if err := r.ParseForm(); err != nil {
+		return fmt.Errorf("cannot parse form values: %w", err)
+	}
+	query := r.FormValue("query")
+	if len(query) == 0 {
+		return fmt.Errorf("missing `query` arg")
+	}
+	end, err := searchutils.GetTime(r, "end", ct)
+	if err != nil {
+		return err
+	}
+	start, err := searchutils.GetTime(r, "start", end-defaultStep)
+	if err != nil {
+		return err
+	}
+	if start > end {
+		return fmt.Errorf("start=%d cannot exceed end=%d", start, end)
+	}
+	deadline := searchutils.GetDeadlineForQuery(r, startTime)
+	tagFilterss, err := promql.ParseMetricSelectors(query)
+	if err != nil {
+		return fmt.Errorf("cannot parse query %q: %w", query, err)
+	}
+	etf, err := getEnforcedTagFiltersFromRequest(r)
+	if err != nil {
+		return err
+	}
+	tagFilterss = addEnforcedFiltersToTagFilterss(tagFilterss, etf)
+	tr := storage.TimeRange{
+		MinTimestamp: start,
+		MaxTimestamp: end,
+	}
+	ess, err := netstorage.SearchExemplars(tr, tagFilterss, deadline)
+	if err != nil {
+		return fmt.Errorf("cannot obtain exemplars for %q: %w", query, err)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	bw := bufferedwriter.Get(w)
+	defer bufferedwriter.Put(bw)
+	WriteQueryExemplarsResponse(bw, ess)
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	queryExemplarsDuration.UpdateDuration(startTime)
+	return nil
+}
+
+var queryExemplarsDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/query_exemplars"}`)
+
+// MetadataHandler processes /api/v1/metadata request.
+//
+// See https://prometheus.io/docs/prometheus/latest/querying/api/#querying-metric-metadata
+func MetadataHandler(startTime time.Time, w http.ResponseWriter, r *http.Request) error {
+	if err := r.ParseForm(); err != nil {
+		return fmt.Errorf("cannot parse form values: %w", err)
+	}
+	metric := r.FormValue("metric")
+	limit := 0
+	if limitStr := r.FormValue("limit"); len(limitStr) > 0 {
+		n, err := strconv.Atoi(limitStr)
+		if err != nil {
+			return fmt.Errorf("cannot parse `limit` arg %q: %w", limitStr, err)
+		}
+		limit = n
+	}
+	deadline := searchutils.GetDeadlineForQuery(r, startTime)
+	mms, err := netstorage.SearchMetadata(metric, limit, deadline)
+	if err != nil {
+		return fmt.Errorf("cannot obtain metadata: %w", err)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	bw := bufferedwriter.Get(w)
+	defer bufferedwriter.Put(bw)
+	WriteMetadataResponse(bw, mms)
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	metadataDuration.UpdateDuration(startTime)
+	return nil
+}
+
+var metadataDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/metadata"}`)
+
 // SeriesHandler processes /api/v1/series request.
 //
 // See https://prometheus.io/docs/prometheus/latest/querying/api/#finding-series-by-label-matchers
@@ -932,6 +1053,10 @@ func QueryHandler(startTime time.Time, w http.ResponseWriter, r *http.Request) e
 	if len(query) == 0 {
 		return fmt.Errorf("missing `query` arg")
 	}
+	query, err := applyQueryRules(query)
+	if err != nil {
+		return err
+	}
 	start, err := searchutils.GetTime(r, "time", ct)
 	if err != nil {
 		return err
@@ -948,6 +1073,7 @@ func QueryHandler(startTime time.Time, w http.ResponseWriter, r *http.Request) e
 		step = defaultStep
 	}
 	deadline := searchutils.GetDeadlineForQuery(r, startTime)
+	setColdStorageHeader(w, start-step, start)
 
 	if len(query) > maxQueryLen.N {
 		return fmt.Errorf("too long query; got %d bytes; mustn't exceed `-search.maxQueryLen=%d` bytes", len(query), maxQueryLen.N)
@@ -968,7 +1094,7 @@ func QueryHandler(startTime time.Time, w http.ResponseWriter, r *http.Request) e
 		start -= offset
 		end := start
 		start = end - window
-		if err := exportHandler(w, []string{childQuery}, etf, start, end, "promapi", 0, false, deadline); err != nil {
+		if err := exportHandler(w, []string{childQuery}, etf, start, end, "promapi", nil, 0, false, deadline); err != nil {
 			return fmt.Errorf("error when exporting data for query=%q on the time range (start=%d, end=%d): %w", childQuery, start, end, err)
 		}
 		queryDuration.UpdateDuration(startTime)
@@ -993,13 +1119,33 @@ func QueryHandler(startTime time.Time, w http.ResponseWriter, r *http.Request) e
 		start -= offset
 		end := start
 		start = end - window
-		if err := queryRangeHandler(startTime, w, childQuery, start, end, step, r, ct, etf); err != nil {
+		if err := queryRangeHandler(startTime, w, childQuery, start, end, step, r, ct, etf, responseFormatJSON); err != nil {
 			return fmt.Errorf("error when executing query=%q on the time range (start=%d, end=%d, step=%d): %w", childQuery, start, end, step, err)
 		}
 		queryDuration.UpdateDuration(startTime)
 		return nil
 	}
 
+	result, err := execInstantQuery(r, query, start, step, lookbackDelta, ct, etf, deadline)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	bw := bufferedwriter.Get(w)
+	defer bufferedwriter.Put(bw)
+	WriteQueryResponse(bw, result)
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	queryDuration.UpdateDuration(startTime)
+	return nil
+}
+
+var queryDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/query"}`)
+
+// execInstantQuery executes instant query at the given time start.
+func execInstantQuery(r *http.Request, query string, start, step, lookbackDelta, ct int64, etf []storage.TagFilter, deadline searchutils.Deadline) ([]netstorage.Result, error) {
 	queryOffset := getLatencyOffsetMilliseconds()
 	if !searchutils.GetBool(r, "nocache") && ct-start < queryOffset && start-ct < queryOffset {
 		// Adjust start time only if `nocache` arg isn't set.
@@ -1018,10 +1164,11 @@ func QueryHandler(startTime time.Time, w http.ResponseWriter, r *http.Request) e
 		Deadline:           deadline,
 		LookbackDelta:      lookbackDelta,
 		EnforcedTagFilters: etf,
+		Span:               tracing.SpanFromContext(r.Context()),
 	}
 	result, err := promql.Exec(&ec, query, true)
 	if err != nil {
-		return fmt.Errorf("error when executing query=%q for (time=%d, step=%d): %w", query, start, step, err)
+		return nil, fmt.Errorf("error when executing query=%q for (time=%d, step=%d): %w", query, start, step, err)
 	}
 	if queryOffset > 0 {
 		for i := range result {
@@ -1031,20 +1178,9 @@ func QueryHandler(startTime time.Time, w http.ResponseWriter, r *http.Request) e
 			}
 		}
 	}
-
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	bw := bufferedwriter.Get(w)
-	defer bufferedwriter.Put(bw)
-	WriteQueryResponse(bw, result)
-	if err := bw.Flush(); err != nil {
-		return err
-	}
-	queryDuration.UpdateDuration(startTime)
-	return nil
+	return result, nil
 }
 
-var queryDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/query"}`)
-
 func parseDuration(s string, step int64) (int64, error) {
 	if len(s) == 0 {
 		return 0, nil
@@ -1068,6 +1204,10 @@ func QueryRangeHandler(startTime time.Time, w http.ResponseWriter, r *http.Reque
 	if len(query) == 0 {
 		return fmt.Errorf("missing `query` arg")
 	}
+	query, err := applyQueryRules(query)
+	if err != nil {
+		return err
+	}
 	start, err := searchutils.GetTime(r, "start", ct-defaultStep)
 	if err != nil {
 		return err
@@ -1084,14 +1224,20 @@ func QueryRangeHandler(startTime time.Time, w http.ResponseWriter, r *http.Reque
 	if err != nil {
 		return err
 	}
-	if err := queryRangeHandler(startTime, w, query, start, end, step, r, ct, etf); err != nil {
+	format := getResponseFormat(r)
+	switch format {
+	case "", responseFormatJSON, responseFormatCSV, responseFormatNDJSON, responseFormatMsgpack:
+	default:
+		return unsupportedResponseFormatError(format, responseFormatJSON, responseFormatCSV, responseFormatNDJSON, responseFormatMsgpack)
+	}
+	if err := queryRangeHandler(startTime, w, query, start, end, step, r, ct, etf, format); err != nil {
 		return fmt.Errorf("error when executing query=%q on the time range (start=%d, end=%d, step=%d): %w", query, start, end, step, err)
 	}
 	queryRangeDuration.UpdateDuration(startTime)
 	return nil
 }
 
-func queryRangeHandler(startTime time.Time, w http.ResponseWriter, query string, start, end, step int64, r *http.Request, ct int64, etf []storage.TagFilter) error {
+func queryRangeHandler(startTime time.Time, w http.ResponseWriter, query string, start, end, step int64, r *http.Request, ct int64, etf []storage.TagFilter, format string) error {
 	deadline := searchutils.GetDeadlineForQuery(r, startTime)
 	mayCache := !searchutils.GetBool(r, "nocache")
 	lookbackDelta, err := getMaxLookback(r)
@@ -1106,9 +1252,17 @@ func queryRangeHandler(startTime time.Time, w http.ResponseWriter, query string,
 	if start > end {
 		end = start + defaultStep
 	}
+	step, err = adjustStepForMaxPoints(w, r, start, end, step)
+	if err != nil {
+		return err
+	}
+	if searchutils.GetBool(r, "align") {
+		start, end = promql.AlignStartEnd(start, end, step)
+	}
 	if err := promql.ValidateMaxPointsPerTimeseries(start, end, step); err != nil {
 		return err
 	}
+	setColdStorageHeader(w, start, end)
 	if mayCache {
 		start, end = promql.AdjustStartEnd(start, end, step)
 	}
@@ -1122,6 +1276,7 @@ func queryRangeHandler(startTime time.Time, w http.ResponseWriter, query string,
 		MayCache:           mayCache,
 		LookbackDelta:      lookbackDelta,
 		EnforcedTagFilters: etf,
+		Span:               tracing.SpanFromContext(r.Context()),
 	}
 	result, err := promql.Exec(&ec, query, false)
 	if err != nil {
@@ -1138,16 +1293,98 @@ func queryRangeHandler(startTime time.Time, w http.ResponseWriter, query string,
 	// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/153
 	result = removeEmptyValuesAndTimeseries(result)
 
-	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	bw := bufferedwriter.Get(w)
 	defer bufferedwriter.Put(bw)
-	WriteQueryRangeResponse(bw, result)
+	switch format {
+	case responseFormatCSV:
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		fieldNames := getCSVFieldNames(r)
+		for i := range result {
+			rs := &result[i]
+			WriteExportCSVLine(bw, &exportBlock{
+				mn:         &rs.MetricName,
+				timestamps: rs.Timestamps,
+				values:     rs.Values,
+			}, fieldNames)
+		}
+	case responseFormatNDJSON:
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		for i := range result {
+			rs := &result[i]
+			WriteExportJSONLine(bw, &exportBlock{
+				mn:         &rs.MetricName,
+				timestamps: rs.Timestamps,
+				values:     rs.Values,
+			})
+		}
+	case responseFormatMsgpack:
+		w.Header().Set("Content-Type", "application/msgpack")
+		var buf []byte
+		for i := range result {
+			rs := &result[i]
+			buf = appendMsgpackSeries(buf[:0], &rs.MetricName, rs.Values, rs.Timestamps)
+			_, _ = bw.Write(buf)
+		}
+	default:
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		WriteQueryRangeResponse(bw, result)
+	}
 	if err := bw.Flush(); err != nil {
 		return err
 	}
 	return nil
 }
 
+// adjustStepForMaxPoints increases step if the number of points per series on the time range [start ... end] exceeds the limit.
+//
+// The limit is set via `max_points_per_series` query arg. It cannot exceed -search.maxPointsPerTimeseries.
+// The step is adjusted to -search.maxPointsPerTimeseries if -search.autoAdjustStep is set.
+// The adjusted step in seconds is returned to the client in X-VictoriaMetrics-Adjusted-Step response header.
+// setColdStorageHeader sets `X-VictoriaMetrics-Cold-Storage` response header if the [start ... end] time range
+// overlaps partitions offloaded to -coldStorage.remotePath, since such queries may have higher latency.
+func setColdStorageHeader(w http.ResponseWriter, start, end int64) {
+	tr := storage.TimeRange{
+		MinTimestamp: start,
+		MaxTimestamp: end,
+	}
+	if vmstorage.IsColdTimeRange(tr) {
+		w.Header().Set("X-VictoriaMetrics-Cold-Storage", "true")
+	}
+}
+
+func adjustStepForMaxPoints(w http.ResponseWriter, r *http.Request, start, end, step int64) (int64, error) {
+	maxPoints := promql.MaxPointsPerTimeseries()
+	mustAdjust := *autoAdjustStep
+	if s := r.FormValue("max_points_per_series"); len(s) > 0 {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("cannot parse `max_points_per_series` arg %q: it must be a positive integer", s)
+		}
+		if n < maxPoints {
+			maxPoints = n
+		}
+		mustAdjust = true
+	}
+	if !mustAdjust {
+		return step, nil
+	}
+	align := searchutils.GetBool(r, "align")
+	startAligned, endAligned := start, end
+	if align {
+		startAligned, endAligned = promql.AlignStartEnd(start, end, step)
+	}
+	if (endAligned-startAligned)/step+1 <= int64(maxPoints) {
+		return step, nil
+	}
+	if align && maxPoints > 2 {
+		// The alignment may add up to two points at the time range edges.
+		maxPoints -= 2
+	}
+	step = promql.AdjustStepForMaxPoints(start, end, step, maxPoints)
+	w.Header().Set("X-VictoriaMetrics-Adjusted-Step", strconv.FormatFloat(float64(step)/1e3, 'f', -1, 64))
+	return step, nil
+}
+
 func removeEmptyValuesAndTimeseries(tss []netstorage.Result) []netstorage.Result {
 	dst := tss[:0]
 	for i := range tss {
@@ -3,6 +3,8 @@ package prometheus
 import (
 	"math"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"reflect"
 	"testing"
 
@@ -269,3 +271,46 @@ func Test_getEnforcedTagFiltersFromRequest(t *testing.T) {
 	f(t, &http.Request{},
 		nil, false)
 }
+
+func TestAdjustStepForMaxPoints(t *testing.T) {
+	f := func(args url.Values, start, end, step, stepExpected int64, headerExpected string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r := &http.Request{
+			Form: args,
+		}
+		newStep, err := adjustStepForMaxPoints(w, r, start, end, step)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if newStep != stepExpected {
+			t.Fatalf("unexpected step; got %d; want %d", newStep, stepExpected)
+		}
+		if h := w.Header().Get("X-VictoriaMetrics-Adjusted-Step"); h != headerExpected {
+			t.Fatalf("unexpected X-VictoriaMetrics-Adjusted-Step header; got %q; want %q", h, headerExpected)
+		}
+	}
+
+	// The step isn't adjusted by default
+	f(url.Values{}, 0, 90*24*3600*1000, 1000, 1000, "")
+
+	// The number of points doesn't exceed max_points_per_series
+	f(url.Values{"max_points_per_series": {"100"}}, 0, 3600*1000, 60000, 60000, "")
+
+	// The step is adjusted to max_points_per_series
+	f(url.Values{"max_points_per_series": {"61"}}, 0, 3600*1000, 1000, 60000, "60")
+
+	// The step is adjusted with alignment
+	f(url.Values{"max_points_per_series": {"61"}, "align": {"1"}}, 500, 3600*1000, 1000, 63000, "63")
+
+	// Invalid max_points_per_series
+	w := httptest.NewRecorder()
+	for _, s := range []string{"foo", "0", "-1"} {
+		r := &http.Request{
+			Form: url.Values{"max_points_per_series": {s}},
+		}
+		if _, err := adjustStepForMaxPoints(w, r, 0, 1000, 1); err == nil {
+			t.Fatalf("expecting non-nil error for max_points_per_series=%q", s)
+		}
+	}
+}
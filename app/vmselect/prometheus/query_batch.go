@@ -0,0 +1,143 @@
+package prometheus
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/bufferedwriter"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/cgroup"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/valyala/quicktemplate"
+)
+
+var maxBatchQueries = flag.Int("search.maxBatchQueries", 100, "The maximum number of queries in a single request to /api/v1/query_batch")
+
+// QueryBatchHandler processes /api/v1/query_batch request.
+//
+// It executes all the instant queries passed via `query` args concurrently at the same `time`
+// and returns a JSON array with /api/v1/query responses for each query in the order of `query` args.
+// Identical queries are executed only once.
+func QueryBatchHandler(startTime time.Time, w http.ResponseWriter, r *http.Request) error {
+	ct := startTime.UnixNano() / 1e6
+	if err := r.ParseForm(); err != nil {
+		return fmt.Errorf("cannot parse request form values: %w", err)
+	}
+	queries := r.Form["query"]
+	if len(queries) == 0 {
+		return fmt.Errorf("missing `query` arg")
+	}
+	if len(queries) > *maxBatchQueries {
+		return fmt.Errorf("too many queries in the batch; got %d; mustn't exceed `-search.maxBatchQueries=%d`", len(queries), *maxBatchQueries)
+	}
+	start, err := searchutils.GetTime(r, "time", ct)
+	if err != nil {
+		return err
+	}
+	lookbackDelta, err := getMaxLookback(r)
+	if err != nil {
+		return err
+	}
+	step, err := searchutils.GetDuration(r, "step", lookbackDelta)
+	if err != nil {
+		return err
+	}
+	if step <= 0 {
+		step = defaultStep
+	}
+	deadline := searchutils.GetDeadlineForQuery(r, startTime)
+	etf, err := getEnforcedTagFiltersFromRequest(r)
+	if err != nil {
+		return err
+	}
+
+	// Execute unique queries concurrently.
+	uniqQueries := make(map[string]*quicktemplate.ByteBuffer, len(queries))
+	for _, query := range queries {
+		uniqQueries[query] = nil
+	}
+	workCh := make(chan string, len(uniqQueries))
+	for query := range uniqQueries {
+		workCh <- query
+	}
+	close(workCh)
+	workers := cgroup.AvailableCPUs()
+	if workers > len(uniqQueries) {
+		workers = len(uniqQueries)
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for query := range workCh {
+				bb := quicktemplate.AcquireByteBuffer()
+				if err := execBatchQuery(bb, r, query, start, step, lookbackDelta, ct, etf, deadline); err != nil {
+					queryBatchErrors.Inc()
+					statusCode := http.StatusUnprocessableEntity
+					var esc *httpserver.ErrorWithStatusCode
+					if errors.As(err, &esc) {
+						statusCode = esc.StatusCode
+					}
+					bb.Reset()
+					WriteErrorResponse(bb, statusCode, err)
+				}
+				mu.Lock()
+				uniqQueries[query] = bb
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	bw := bufferedwriter.Get(w)
+	defer bufferedwriter.Put(bw)
+	_, _ = bw.Write([]byte(`{"status":"success","data":[`))
+	for i, query := range queries {
+		if i > 0 {
+			_, _ = bw.Write([]byte(","))
+		}
+		_, _ = bw.Write(uniqQueries[query].B)
+	}
+	_, _ = bw.Write([]byte(`]}`))
+	for _, bb := range uniqQueries {
+		quicktemplate.ReleaseByteBuffer(bb)
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	queryBatchDuration.UpdateDuration(startTime)
+	return nil
+}
+
+func execBatchQuery(bb *quicktemplate.ByteBuffer, r *http.Request, query string, start, step, lookbackDelta, ct int64, etf []storage.TagFilter, deadline searchutils.Deadline) error {
+	if len(query) == 0 {
+		return fmt.Errorf("missing `query` arg")
+	}
+	query, err := applyQueryRules(query)
+	if err != nil {
+		return err
+	}
+	if len(query) > maxQueryLen.N {
+		return fmt.Errorf("too long query; got %d bytes; mustn't exceed `-search.maxQueryLen=%d` bytes", len(query), maxQueryLen.N)
+	}
+	result, err := execInstantQuery(r, query, start, step, lookbackDelta, ct, etf, deadline)
+	if err != nil {
+		return err
+	}
+	WriteQueryResponse(bb, result)
+	return nil
+}
+
+var (
+	queryBatchDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/query_batch"}`)
+	queryBatchErrors   = metrics.NewCounter(`vm_query_batch_query_errors_total`)
+)
@@ -0,0 +1,130 @@
+package prometheus
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+type queryBatchResponse struct {
+	Status string
+	Data   []struct {
+		Status    string
+		ErrorType string
+		Error     string
+		Data      struct {
+			ResultType string
+			Result     []struct {
+				Value []interface{}
+			}
+		}
+	}
+}
+
+func TestQueryBatchHandlerSuccess(t *testing.T) {
+	queries := []string{
+		"1+1",
+		"foo(",
+		"vector(3)",
+		"",
+		"1+1",
+		"foo(",
+	}
+	errorsBefore := queryBatchErrors.Get()
+	resp := mustExecQueryBatch(t, url.Values{
+		"query": queries,
+		"time":  {"1600000000"},
+	})
+	if resp.Status != "success" {
+		t.Fatalf("unexpected status; got %q; want %q", resp.Status, "success")
+	}
+	if len(resp.Data) != len(queries) {
+		t.Fatalf("unexpected number of responses; got %d; want %d", len(resp.Data), len(queries))
+	}
+
+	// Responses must be returned in the order of queries, while failed queries mustn't affect other queries.
+	fSuccess := func(idx int, valueExpected string) {
+		t.Helper()
+		r := resp.Data[idx]
+		if r.Status != "success" {
+			t.Fatalf("unexpected status for query %q; got %q; want %q; error: %s", queries[idx], r.Status, "success", r.Error)
+		}
+		if r.Data.ResultType != "vector" {
+			t.Fatalf("unexpected resultType for query %q; got %q; want %q", queries[idx], r.Data.ResultType, "vector")
+		}
+		if len(r.Data.Result) != 1 || len(r.Data.Result[0].Value) != 2 {
+			t.Fatalf("unexpected result for query %q: %+v", queries[idx], r.Data.Result)
+		}
+		value := r.Data.Result[0].Value
+		if ts, ok := value[0].(float64); !ok || ts != 1600000000 {
+			t.Fatalf("unexpected timestamp for query %q; got %v; want %d", queries[idx], value[0], 1600000000)
+		}
+		if value[1] != valueExpected {
+			t.Fatalf("unexpected value for query %q; got %v; want %q", queries[idx], value[1], valueExpected)
+		}
+	}
+	fError := func(idx int, errorSubstr string) {
+		t.Helper()
+		r := resp.Data[idx]
+		if r.Status != "error" {
+			t.Fatalf("unexpected status for query %q; got %q; want %q", queries[idx], r.Status, "error")
+		}
+		if r.ErrorType != "422" {
+			t.Fatalf("unexpected errorType for query %q; got %q; want %q", queries[idx], r.ErrorType, "422")
+		}
+		if !strings.Contains(r.Error, errorSubstr) {
+			t.Fatalf("unexpected error for query %q; got %q; want containing %q", queries[idx], r.Error, errorSubstr)
+		}
+	}
+	fSuccess(0, "2")
+	fError(1, "foo(")
+	fSuccess(2, "3")
+	fError(3, "missing `query` arg")
+	fSuccess(4, "2")
+	fError(5, "foo(")
+
+	// Identical queries must be executed only once.
+	if n := queryBatchErrors.Get() - errorsBefore; n != 2 {
+		t.Fatalf("unexpected number of failed queries; got %d; want 2", n)
+	}
+}
+
+func TestQueryBatchHandlerFailure(t *testing.T) {
+	origMaxBatchQueries := *maxBatchQueries
+	*maxBatchQueries = 2
+	defer func() {
+		*maxBatchQueries = origMaxBatchQueries
+	}()
+
+	f := func(args url.Values) {
+		t.Helper()
+		r := httptest.NewRequest("POST", "/api/v1/query_batch?"+args.Encode(), nil)
+		w := httptest.NewRecorder()
+		if err := QueryBatchHandler(time.Now(), w, r); err == nil {
+			t.Fatalf("expecting non-nil error for args %q", args.Encode())
+		}
+	}
+	// Missing query
+	f(url.Values{})
+	// Too many queries
+	f(url.Values{"query": {"1", "2", "3"}})
+	// Invalid time
+	f(url.Values{"query": {"1"}, "time": {"foobar"}})
+}
+
+func mustExecQueryBatch(t *testing.T, args url.Values) *queryBatchResponse {
+	t.Helper()
+	r := httptest.NewRequest("POST", "/api/v1/query_batch?"+args.Encode(), nil)
+	w := httptest.NewRecorder()
+	if err := QueryBatchHandler(time.Now(), w, r); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	var resp queryBatchResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("cannot unmarshal response %q: %s", w.Body.String(), err)
+	}
+	return &resp
+}
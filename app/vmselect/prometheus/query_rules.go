@@ -0,0 +1,225 @@
+package prometheus
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/envtemplate"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/VictoriaMetrics/metricsql"
+	"gopkg.in/yaml.v2"
+)
+
+var queryRulesConfig = flag.String("search.queryRules", "", "Optional path to file with rules for rejecting or rewriting queries "+
+	"at /api/v1/query, /api/v1/query_range and /api/v1/query_batch. See https://victoriametrics.github.io/#query-rules")
+
+// QueryRule is a single rule in -search.queryRules file.
+type QueryRule struct {
+	// Regex is matched against the query. It matches anywhere in the query unless it contains `^` and `$` anchors.
+	Regex string `yaml:"regex,omitempty"`
+
+	// MetricNames contains metric names. The rule matches if the query selects any of these metrics.
+	MetricNames []string `yaml:"metric_names,omitempty"`
+
+	// Action is the action to perform for the matching query: `reject` or `rewrite`.
+	Action string `yaml:"action,omitempty"`
+
+	// Message is the error message returned to the client for `reject` action.
+	Message string `yaml:"message,omitempty"`
+
+	// Replacement is the replacement for Regex matches for `rewrite` action. It may refer to Regex capture groups via $1, $2, etc.
+	Replacement *string `yaml:"replacement,omitempty"`
+
+	// LabelFilters are label filters in curly braces to add to all the series selectors in the query for `rewrite` action.
+	LabelFilters string `yaml:"label_filters,omitempty"`
+}
+
+type parsedQueryRule struct {
+	re           *regexp.Regexp
+	metricNames  map[string]bool
+	action       string
+	message      string
+	replacement  *string
+	labelFilters []metricsql.LabelFilter
+
+	matches *metrics.Counter
+}
+
+var queryRules []*parsedQueryRule
+
+// InitQueryRules loads query rules from -search.queryRules.
+func InitQueryRules() {
+	if len(*queryRulesConfig) == 0 {
+		return
+	}
+	prs, err := loadQueryRules(*queryRulesConfig)
+	if err != nil {
+		logger.Fatalf("cannot load -search.queryRules: %s", err)
+	}
+	queryRules = prs
+}
+
+func loadQueryRules(path string) ([]*parsedQueryRule, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read query rules from %q: %w", path, err)
+	}
+	data = envtemplate.Replace(data)
+	prs, err := parseQueryRules(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse query rules from %q: %w", path, err)
+	}
+	return prs, nil
+}
+
+func parseQueryRules(data []byte) ([]*parsedQueryRule, error) {
+	var qrs []QueryRule
+	if err := yaml.UnmarshalStrict(data, &qrs); err != nil {
+		return nil, err
+	}
+	prs := make([]*parsedQueryRule, len(qrs))
+	for i := range qrs {
+		pr, err := parseQueryRule(&qrs[i])
+		if err != nil {
+			return nil, fmt.Errorf("error when parsing query rule #%d: %w", i+1, err)
+		}
+		pr.matches = metrics.GetOrCreateCounter(fmt.Sprintf(`vm_query_rule_matches_total{rule="%d",action=%q}`, i+1, pr.action))
+		prs[i] = pr
+	}
+	return prs, nil
+}
+
+func parseQueryRule(qr *QueryRule) (*parsedQueryRule, error) {
+	if len(qr.Regex) == 0 && len(qr.MetricNames) == 0 {
+		return nil, fmt.Errorf("missing `regex` or `metric_names`")
+	}
+	pr := &parsedQueryRule{
+		action:      qr.Action,
+		message:     qr.Message,
+		replacement: qr.Replacement,
+	}
+	if len(qr.Regex) > 0 {
+		re, err := regexp.Compile(qr.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse `regex` %q: %w", qr.Regex, err)
+		}
+		pr.re = re
+	}
+	if len(qr.MetricNames) > 0 {
+		pr.metricNames = make(map[string]bool, len(qr.MetricNames))
+		for _, metricName := range qr.MetricNames {
+			pr.metricNames[metricName] = true
+		}
+	}
+	switch pr.action {
+	case "":
+		pr.action = "reject"
+		fallthrough
+	case "reject":
+		if len(pr.message) == 0 {
+			pr.message = "the query is rejected by -search.queryRules"
+		}
+		if pr.replacement != nil || len(qr.LabelFilters) > 0 {
+			return nil, fmt.Errorf("`replacement` and `label_filters` cannot be set for `action: reject`")
+		}
+	case "rewrite":
+		if pr.replacement == nil && len(qr.LabelFilters) == 0 {
+			return nil, fmt.Errorf("missing `replacement` or `label_filters` for `action: rewrite`")
+		}
+		if pr.replacement != nil && pr.re == nil {
+			return nil, fmt.Errorf("`replacement` requires `regex`")
+		}
+		if len(qr.LabelFilters) > 0 {
+			e, err := metricsql.Parse(qr.LabelFilters)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse `label_filters` %q: %w", qr.LabelFilters, err)
+			}
+			me, ok := e.(*metricsql.MetricExpr)
+			if !ok || len(me.LabelFilters) == 0 || me.LabelFilters[0].Label == "__name__" {
+				return nil, fmt.Errorf("`label_filters` must contain label filters in curly braces without metric name; got %q", qr.LabelFilters)
+			}
+			pr.labelFilters = me.LabelFilters
+		}
+	default:
+		return nil, fmt.Errorf("unsupported `action` %q; supported values: reject, rewrite", pr.action)
+	}
+	return pr, nil
+}
+
+// applyQueryRules applies -search.queryRules to the given query.
+//
+// It returns the rewritten query or an error if the query is rejected.
+func applyQueryRules(query string) (string, error) {
+	return applyQueryRulesInternal(queryRules, query)
+}
+
+func applyQueryRulesInternal(prs []*parsedQueryRule, query string) (string, error) {
+	for _, pr := range prs {
+		if !pr.match(query) {
+			continue
+		}
+		pr.matches.Inc()
+		if pr.action == "reject" {
+			return "", &httpserver.ErrorWithStatusCode{
+				Err:        fmt.Errorf("query %q is rejected: %s", query, pr.message),
+				StatusCode: http.StatusBadRequest,
+			}
+		}
+		q, err := pr.rewrite(query)
+		if err != nil {
+			return "", fmt.Errorf("cannot rewrite query %q according to -search.queryRules: %w", query, err)
+		}
+		query = q
+	}
+	return query, nil
+}
+
+func (pr *parsedQueryRule) match(query string) bool {
+	if pr.re != nil && !pr.re.MatchString(query) {
+		return false
+	}
+	if len(pr.metricNames) == 0 {
+		return true
+	}
+	e, err := metricsql.Parse(query)
+	if err != nil {
+		// The query will fail later with the proper error message.
+		return false
+	}
+	found := false
+	metricsql.VisitAll(e, func(expr metricsql.Expr) {
+		me, ok := expr.(*metricsql.MetricExpr)
+		if !ok || len(me.LabelFilters) == 0 {
+			return
+		}
+		lf := &me.LabelFilters[0]
+		if lf.Label == "__name__" && !lf.IsRegexp && !lf.IsNegative && pr.metricNames[lf.Value] {
+			found = true
+		}
+	})
+	return found
+}
+
+func (pr *parsedQueryRule) rewrite(query string) (string, error) {
+	if pr.replacement != nil {
+		query = pr.re.ReplaceAllString(query, *pr.replacement)
+	}
+	if len(pr.labelFilters) == 0 {
+		return query, nil
+	}
+	e, err := metricsql.Parse(query)
+	if err != nil {
+		return "", err
+	}
+	metricsql.VisitAll(e, func(expr metricsql.Expr) {
+		if me, ok := expr.(*metricsql.MetricExpr); ok {
+			me.LabelFilters = append(me.LabelFilters, pr.labelFilters...)
+		}
+	})
+	return string(e.AppendString(nil)), nil
+}
@@ -0,0 +1,93 @@
+package prometheus
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+)
+
+func TestParseQueryRulesFailure(t *testing.T) {
+	f := func(data string) {
+		t.Helper()
+		if _, err := parseQueryRules([]byte(data)); err == nil {
+			t.Fatalf("expecting non-nil error for\n%s", data)
+		}
+	}
+	// Unknown field
+	f(`[{regex: foo, foo: bar}]`)
+	// Missing regex and metric_names
+	f(`[{action: reject}]`)
+	// Invalid regex
+	f(`[{regex: "foo("}]`)
+	// Unknown action
+	f(`[{regex: foo, action: drop}]`)
+	// replacement for reject action
+	f(`[{regex: foo, replacement: bar}]`)
+	// Missing replacement and label_filters for rewrite action
+	f(`[{regex: foo, action: rewrite}]`)
+	// replacement without regex
+	f(`[{metric_names: [foo], action: rewrite, replacement: bar}]`)
+	// Invalid label_filters
+	f(`[{metric_names: [foo], action: rewrite, label_filters: "{foo"}]`)
+	f(`[{metric_names: [foo], action: rewrite, label_filters: "sum(foo)"}]`)
+	f(`[{metric_names: [foo], action: rewrite, label_filters: "foo{bar=\"baz\"}"}]`)
+}
+
+func TestApplyQueryRules(t *testing.T) {
+	prs, err := parseQueryRules([]byte(`
+- regex: '\[\d+d\]'
+  message: "lookbehind windows in days aren't allowed"
+- metric_names: [node_cpu_seconds_total]
+  regex: '^rate\(node_cpu_seconds_total\[(\w+)\]\)$'
+  action: rewrite
+  replacement: 'max_over_time(rate(node_cpu_seconds_total[$1])[1h:5m])'
+- metric_names: [http_requests_total]
+  action: rewrite
+  label_filters: '{env="prod"}'
+- metric_names: [secret_metric]
+  action: reject
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	f := func(query, resultExpected string) {
+		t.Helper()
+		result, err := applyQueryRulesInternal(prs, query)
+		if err != nil {
+			t.Fatalf("unexpected error for query %q: %s", query, err)
+		}
+		if result != resultExpected {
+			t.Fatalf("unexpected result for query %q; got %q; want %q", query, result, resultExpected)
+		}
+	}
+	fReject := func(query string) {
+		t.Helper()
+		_, err := applyQueryRulesInternal(prs, query)
+		if err == nil {
+			t.Fatalf("expecting non-nil error for query %q", query)
+		}
+		var esc *httpserver.ErrorWithStatusCode
+		if !errors.As(err, &esc) || esc.StatusCode != http.StatusBadRequest {
+			t.Fatalf("unexpected error for query %q: %v", query, err)
+		}
+	}
+
+	// No matching rules
+	f("up", "up")
+	f("sum(rate(foo[5m]))", "sum(rate(foo[5m]))")
+	f("sum(rate(node_cpu_seconds_total[5m]))", "sum(rate(node_cpu_seconds_total[5m]))")
+
+	// Rewrite with regex replacement
+	f("rate(node_cpu_seconds_total[5m])", "max_over_time(rate(node_cpu_seconds_total[5m])[1h:5m])")
+
+	// Rewrite with label filters
+	f("sum(rate(http_requests_total[5m])) / sum(rate(http_requests_total{code=~\"5..\"}[5m]))",
+		`sum(rate(http_requests_total{env="prod"}[5m])) / sum(rate(http_requests_total{code=~"5..", env="prod"}[5m]))`)
+
+	// Reject
+	fReject("rate(foo[30d])")
+	fReject("sum(secret_metric) by (job)")
+	fReject("foo + on(job) secret_metric")
+}
@@ -0,0 +1,324 @@
+package prometheus
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/bufferedwriter"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+)
+
+var maxRemoteReadRequestSize = flagutil.NewBytes("search.maxRemoteReadRequestSize", 1024*1024, "The maximum size in bytes of a single Prometheus remote_read API request")
+
+const (
+	// samplesPerChunk is the maximum number of samples per XOR chunk in STREAMED_XOR_CHUNKS response.
+	// It is the same as in Prometheus TSDB.
+	samplesPerChunk = 120
+
+	// maxBytesInFrame is the maximum size of a single ChunkedReadResponse frame.
+	// It is the same as the default value for -storage.remote.read-max-bytes-in-frame in Prometheus.
+	maxBytesInFrame = 1024 * 1024
+)
+
+// RemoteReadHandler processes remote read request for Prometheus.
+//
+// Both SAMPLES and STREAMED_XOR_CHUNKS response types are supported.
+// See https://prometheus.io/docs/prometheus/latest/storage/#remote-storage-integrations
+func RemoteReadHandler(startTime time.Time, w http.ResponseWriter, r *http.Request) error {
+	if err := r.ParseForm(); err != nil {
+		return fmt.Errorf("cannot parse request form values: %w", err)
+	}
+	deadline := searchutils.GetDeadlineForExport(r, startTime)
+	etf, err := getEnforcedTagFiltersFromRequest(r)
+	if err != nil {
+		return err
+	}
+	rr, err := readRemoteReadRequest(r.Body)
+	if err != nil {
+		return err
+	}
+	responseType, err := getRemoteReadResponseType(rr.AcceptedResponseTypes)
+	if err != nil {
+		return err
+	}
+	tagFilterss := make([][]storage.TagFilter, len(rr.Queries))
+	for i := range rr.Queries {
+		tfs, err := remoteReadQueryToTagFilters(&rr.Queries[i])
+		if err != nil {
+			return err
+		}
+		tagFilterss[i] = append(tfs, etf...)
+	}
+	if responseType == prompb.ReadRequest_STREAMED_XOR_CHUNKS {
+		err = remoteReadStreamed(w, rr, tagFilterss, deadline)
+	} else {
+		err = remoteReadSamples(w, rr, tagFilterss, deadline)
+	}
+	if err != nil {
+		return err
+	}
+	remoteReadDuration.UpdateDuration(startTime)
+	return nil
+}
+
+var remoteReadDuration = metrics.NewSummary(`vm_request_duration_seconds{path="/api/v1/read"}`)
+
+func readRemoteReadRequest(r io.Reader) (*prompb.ReadRequest, error) {
+	lr := io.LimitReader(r, int64(maxRemoteReadRequestSize.N)+1)
+	compressed, err := ioutil.ReadAll(lr)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read remote_read request: %w", err)
+	}
+	if len(compressed) > maxRemoteReadRequestSize.N {
+		return nil, fmt.Errorf("too big packed request; mustn't exceed `-search.maxRemoteReadRequestSize=%d` bytes", maxRemoteReadRequestSize.N)
+	}
+	data, err := snappy.Decode(nil, compressed)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decompress remote_read request with size %d bytes: %w", len(compressed), err)
+	}
+	var rr prompb.ReadRequest
+	if err := rr.Unmarshal(data); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal remote_read request with size %d bytes: %w", len(data), err)
+	}
+	return &rr, nil
+}
+
+// getRemoteReadResponseType returns the first supported response type from accepted.
+//
+// SAMPLES response type is used if accepted is empty.
+func getRemoteReadResponseType(accepted []prompb.ReadRequest_ResponseType) (prompb.ReadRequest_ResponseType, error) {
+	if len(accepted) == 0 {
+		return prompb.ReadRequest_SAMPLES, nil
+	}
+	for _, rt := range accepted {
+		switch rt {
+		case prompb.ReadRequest_SAMPLES, prompb.ReadRequest_STREAMED_XOR_CHUNKS:
+			return rt, nil
+		}
+	}
+	return 0, fmt.Errorf("none of the accepted response types %v is supported; supported types: SAMPLES, STREAMED_XOR_CHUNKS", accepted)
+}
+
+func remoteReadQueryToTagFilters(q *prompb.Query) ([]storage.TagFilter, error) {
+	tfs := make([]storage.TagFilter, 0, len(q.Matchers))
+	for _, m := range q.Matchers {
+		var tf storage.TagFilter
+		if string(m.Name) != "__name__" {
+			tf.Key = append(tf.Key, m.Name...)
+		}
+		tf.Value = append(tf.Value, m.Value...)
+		switch m.Type {
+		case prompb.LabelMatcher_EQ:
+		case prompb.LabelMatcher_NEQ:
+			tf.IsNegative = true
+		case prompb.LabelMatcher_RE:
+			tf.IsRegexp = true
+		case prompb.LabelMatcher_NRE:
+			tf.IsRegexp = true
+			tf.IsNegative = true
+		default:
+			return nil, fmt.Errorf("unsupported label matcher type %d for label %q", m.Type, m.Name)
+		}
+		tfs = append(tfs, tf)
+	}
+	return tfs, nil
+}
+
+func remoteReadSamples(w http.ResponseWriter, rr *prompb.ReadRequest, tagFilterss [][]storage.TagFilter, deadline searchutils.Deadline) error {
+	var resp prompbmarshal.ReadResponse
+	for i := range rr.Queries {
+		q := &rr.Queries[i]
+		sq := storage.NewSearchQuery(q.StartTimestampMs, q.EndTimestampMs, [][]storage.TagFilter{tagFilterss[i]})
+		rss, err := netstorage.ProcessSearchQuery(sq, true, deadline)
+		if err != nil {
+			return fmt.Errorf("cannot fetch data for %q: %w", sq, err)
+		}
+		var tssLock sync.Mutex
+		var tss []prompbmarshal.TimeSeries
+		err = rss.RunParallel(func(rs *netstorage.Result, workerID uint) error {
+			samples := make([]prompbmarshal.Sample, len(rs.Timestamps))
+			for j, ts := range rs.Timestamps {
+				samples[j] = prompbmarshal.Sample{
+					Value:     rs.Values[j],
+					Timestamp: ts,
+				}
+			}
+			labels := metricNameToLabels(&rs.MetricName)
+			tssLock.Lock()
+			tss = append(tss, prompbmarshal.TimeSeries{
+				Labels:  labels,
+				Samples: samples,
+			})
+			tssLock.Unlock()
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("error during data fetching: %w", err)
+		}
+		sort.Slice(tss, func(i, j int) bool {
+			return compareLabels(tss[i].Labels, tss[j].Labels) < 0
+		})
+		resp.Results = append(resp.Results, prompbmarshal.QueryResult{
+			Timeseries: tss,
+		})
+	}
+	data := prompbmarshal.MarshalReadResponse(nil, &resp)
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	w.Header().Set("Content-Encoding", "snappy")
+	_, err := w.Write(snappy.Encode(nil, data))
+	return err
+}
+
+// seriesFrames contains marshaled ChunkedReadResponse frames for a single series.
+type seriesFrames struct {
+	labels []prompbmarshal.Label
+	frames []byte
+}
+
+func remoteReadStreamed(w http.ResponseWriter, rr *prompb.ReadRequest, tagFilterss [][]storage.TagFilter, deadline searchutils.Deadline) error {
+	w.Header().Set("Content-Type", "application/x-streamed-protobuf; proto=prometheus.ChunkedReadResponse")
+	bw := bufferedwriter.Get(w)
+	defer bufferedwriter.Put(bw)
+	for i := range rr.Queries {
+		q := &rr.Queries[i]
+		sq := storage.NewSearchQuery(q.StartTimestampMs, q.EndTimestampMs, [][]storage.TagFilter{tagFilterss[i]})
+		rss, err := netstorage.ProcessSearchQuery(sq, true, deadline)
+		if err != nil {
+			return fmt.Errorf("cannot fetch data for %q: %w", sq, err)
+		}
+		// Series must be streamed in sorted order, so collect compressed frames for all the series before sending them.
+		var sfsLock sync.Mutex
+		var sfs []seriesFrames
+		err = rss.RunParallel(func(rs *netstorage.Result, workerID uint) error {
+			labels := metricNameToLabels(&rs.MetricName)
+			frames, err := marshalChunkedSeries(nil, int64(i), labels, rs.Timestamps, rs.Values)
+			if err != nil {
+				return err
+			}
+			sfsLock.Lock()
+			sfs = append(sfs, seriesFrames{
+				labels: labels,
+				frames: frames,
+			})
+			sfsLock.Unlock()
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("error during data fetching: %w", err)
+		}
+		sort.Slice(sfs, func(i, j int) bool {
+			return compareLabels(sfs[i].labels, sfs[j].labels) < 0
+		})
+		for _, sf := range sfs {
+			if _, err := bw.Write(sf.frames); err != nil {
+				return err
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// marshalChunkedSeries appends ChunkedReadResponse frames with XOR chunks for the given series to dst and returns the result.
+//
+// Every frame contains up to maxBytesInFrame bytes of chunks data.
+func marshalChunkedSeries(dst []byte, queryIndex int64, labels []prompbmarshal.Label, timestamps []int64, values []float64) ([]byte, error) {
+	crr := prompbmarshal.ChunkedReadResponse{
+		ChunkedSeries: []prompbmarshal.ChunkedSeries{{
+			Labels: labels,
+		}},
+		QueryIndex: queryIndex,
+	}
+	cs := &crr.ChunkedSeries[0]
+	frameSize := 0
+	for len(timestamps) > 0 {
+		n := samplesPerChunk
+		if n > len(timestamps) {
+			n = len(timestamps)
+		}
+		c := chunkenc.NewXORChunk()
+		app, err := c.Appender()
+		if err != nil {
+			return nil, fmt.Errorf("cannot create XOR chunk appender: %w", err)
+		}
+		for j := 0; j < n; j++ {
+			app.Append(timestamps[j], values[j])
+		}
+		cs.Chunks = append(cs.Chunks, prompbmarshal.Chunk{
+			MinTimeMs: timestamps[0],
+			MaxTimeMs: timestamps[n-1],
+			Type:      prompbmarshal.Chunk_XOR,
+			Data:      c.Bytes(),
+		})
+		frameSize += len(c.Bytes())
+		timestamps = timestamps[n:]
+		values = values[n:]
+		if frameSize >= maxBytesInFrame || len(timestamps) == 0 {
+			dst = appendFrame(dst, &crr)
+			cs.Chunks = cs.Chunks[:0]
+			frameSize = 0
+		}
+	}
+	return dst, nil
+}
+
+var castagnoliTable = crc32.MakeTable(crc32.Castagnoli)
+
+// appendFrame appends crr to dst in the delimited format with varint size and big-endian CRC32 Castagnoli checksum.
+func appendFrame(dst []byte, crr *prompbmarshal.ChunkedReadResponse) []byte {
+	data := prompbmarshal.MarshalChunkedReadResponse(nil, crr)
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], uint64(len(data)))
+	dst = append(dst, tmp[:n]...)
+	var crc [4]byte
+	binary.BigEndian.PutUint32(crc[:], crc32.Checksum(data, castagnoliTable))
+	dst = append(dst, crc[:]...)
+	return append(dst, data...)
+}
+
+// metricNameToLabels returns labels sorted by name for mn.
+func metricNameToLabels(mn *storage.MetricName) []prompbmarshal.Label {
+	labels := make([]prompbmarshal.Label, 0, len(mn.Tags)+1)
+	labels = append(labels, prompbmarshal.Label{
+		Name:  "__name__",
+		Value: string(mn.MetricGroup),
+	})
+	for _, tag := range mn.Tags {
+		labels = append(labels, prompbmarshal.Label{
+			Name:  string(tag.Key),
+			Value: string(tag.Value),
+		})
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].Name < labels[j].Name
+	})
+	return labels
+}
+
+// compareLabels compares sorted labels a and b in the same way as Prometheus does.
+func compareLabels(a, b []prompbmarshal.Label) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if n := strings.Compare(a[i].Name, b[i].Name); n != 0 {
+			return n
+		}
+		if n := strings.Compare(a[i].Value, b[i].Value); n != 0 {
+			return n
+		}
+	}
+	return len(a) - len(b)
+}
@@ -0,0 +1,144 @@
+package prometheus
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"reflect"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	"github.com/prometheus/prometheus/tsdb/chunkenc"
+)
+
+func TestRemoteReadQueryToTagFilters(t *testing.T) {
+	q := &prompb.Query{
+		Matchers: []prompb.LabelMatcher{
+			{Type: prompb.LabelMatcher_EQ, Name: []byte("__name__"), Value: []byte("foo")},
+			{Type: prompb.LabelMatcher_NEQ, Name: []byte("job"), Value: []byte("a")},
+			{Type: prompb.LabelMatcher_RE, Name: []byte("env"), Value: []byte("prod|dev")},
+			{Type: prompb.LabelMatcher_NRE, Name: []byte("instance"), Value: []byte("x.+")},
+		},
+	}
+	tfs, err := remoteReadQueryToTagFilters(q)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	tfsExpected := []storage.TagFilter{
+		{Value: []byte("foo")},
+		{Key: []byte("job"), Value: []byte("a"), IsNegative: true},
+		{Key: []byte("env"), Value: []byte("prod|dev"), IsRegexp: true},
+		{Key: []byte("instance"), Value: []byte("x.+"), IsRegexp: true, IsNegative: true},
+	}
+	if !reflect.DeepEqual(tfs, tfsExpected) {
+		t.Fatalf("unexpected tag filters;\ngot\n%+v\nwant\n%+v", tfs, tfsExpected)
+	}
+
+	q.Matchers[0].Type = 42
+	if _, err := remoteReadQueryToTagFilters(q); err == nil {
+		t.Fatalf("expecting non-nil error for unsupported matcher type")
+	}
+}
+
+func TestGetRemoteReadResponseType(t *testing.T) {
+	f := func(accepted []prompb.ReadRequest_ResponseType, expected prompb.ReadRequest_ResponseType) {
+		t.Helper()
+		rt, err := getRemoteReadResponseType(accepted)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if rt != expected {
+			t.Fatalf("unexpected response type; got %d; want %d", rt, expected)
+		}
+	}
+	f(nil, prompb.ReadRequest_SAMPLES)
+	f([]prompb.ReadRequest_ResponseType{prompb.ReadRequest_STREAMED_XOR_CHUNKS, prompb.ReadRequest_SAMPLES}, prompb.ReadRequest_STREAMED_XOR_CHUNKS)
+	f([]prompb.ReadRequest_ResponseType{5, prompb.ReadRequest_SAMPLES}, prompb.ReadRequest_SAMPLES)
+
+	if _, err := getRemoteReadResponseType([]prompb.ReadRequest_ResponseType{5}); err == nil {
+		t.Fatalf("expecting non-nil error for unsupported response type")
+	}
+}
+
+func TestMarshalChunkedSeries(t *testing.T) {
+	labels := []prompbmarshal.Label{{Name: "__name__", Value: "foo"}}
+	var timestamps []int64
+	var values []float64
+	for i := 0; i < 2*samplesPerChunk+10; i++ {
+		timestamps = append(timestamps, int64(i)*1000)
+		values = append(values, float64(i))
+	}
+	data, err := marshalChunkedSeries(nil, 3, labels, timestamps, values)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// All the chunks must fit a single frame
+	size, n := binary.Uvarint(data)
+	if n <= 0 {
+		t.Fatalf("cannot read frame size")
+	}
+	data = data[n:]
+	if len(data) != 4+int(size) {
+		t.Fatalf("unexpected frame length; got %d; want %d", len(data), 4+size)
+	}
+	msg := data[4:]
+	if crc := binary.BigEndian.Uint32(data[:4]); crc != crc32.Checksum(msg, castagnoliTable) {
+		t.Fatalf("unexpected frame checksum")
+	}
+
+	// Verify the frame contents by marshaling the expected response
+	var chunks []prompbmarshal.Chunk
+	for len(timestamps) > 0 {
+		n := samplesPerChunk
+		if n > len(timestamps) {
+			n = len(timestamps)
+		}
+		c := chunkenc.NewXORChunk()
+		app, _ := c.Appender()
+		for i := 0; i < n; i++ {
+			app.Append(timestamps[i], values[i])
+		}
+		chunks = append(chunks, prompbmarshal.Chunk{
+			MinTimeMs: timestamps[0],
+			MaxTimeMs: timestamps[n-1],
+			Type:      prompbmarshal.Chunk_XOR,
+			Data:      c.Bytes(),
+		})
+		timestamps = timestamps[n:]
+		values = values[n:]
+	}
+	if len(chunks) != 3 {
+		t.Fatalf("unexpected number of chunks; got %d; want 3", len(chunks))
+	}
+	expected := prompbmarshal.MarshalChunkedReadResponse(nil, &prompbmarshal.ChunkedReadResponse{
+		ChunkedSeries: []prompbmarshal.ChunkedSeries{{
+			Labels: labels,
+			Chunks: chunks,
+		}},
+		QueryIndex: 3,
+	})
+	if !bytes.Equal(msg, expected) {
+		t.Fatalf("unexpected frame contents")
+	}
+}
+
+func TestCompareLabels(t *testing.T) {
+	f := func(a, b []prompbmarshal.Label, expected int) {
+		t.Helper()
+		n := compareLabels(a, b)
+		if (n < 0 && expected >= 0) || (n > 0 && expected <= 0) || (n == 0 && expected != 0) {
+			t.Fatalf("unexpected result; got %d; want %d", n, expected)
+		}
+	}
+	a := []prompbmarshal.Label{{Name: "__name__", Value: "foo"}}
+	b := []prompbmarshal.Label{{Name: "__name__", Value: "foo"}, {Name: "job", Value: "a"}}
+	c := []prompbmarshal.Label{{Name: "__name__", Value: "foo"}, {Name: "job", Value: "b"}}
+	f(a, a, 0)
+	f(a, b, -1)
+	f(b, a, 1)
+	f(b, c, -1)
+	f(c, b, 1)
+}
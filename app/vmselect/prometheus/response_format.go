@@ -0,0 +1,154 @@
+package prometheus
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+)
+
+// Response formats, which can be requested via `format` query arg or via `Accept` request header.
+const (
+	responseFormatJSON    = "json"
+	responseFormatCSV     = "csv"
+	responseFormatNDJSON  = "ndjson"
+	responseFormatMsgpack = "msgpack"
+)
+
+// defaultCSVColumns is used when `columns` query arg is missing in the request for CSV response.
+const defaultCSVColumns = "__name__,__timestamp__,__value__"
+
+// getResponseFormat returns response format for r.
+//
+// The format is obtained from `format` query arg. If it is missing, then the format is obtained from the first
+// supported media type in `Accept` request header. Empty string is returned if the format cannot be determined.
+func getResponseFormat(r *http.Request) string {
+	if format := r.FormValue("format"); len(format) > 0 {
+		return normalizeResponseFormat(format)
+	}
+	for _, mediaType := range strings.Split(r.Header.Get("Accept"), ",") {
+		if n := strings.IndexByte(mediaType, ';'); n >= 0 {
+			mediaType = mediaType[:n]
+		}
+		switch strings.ToLower(strings.TrimSpace(mediaType)) {
+		case "application/json":
+			return responseFormatJSON
+		case "text/csv":
+			return responseFormatCSV
+		case "application/x-ndjson", "application/ndjson", "application/jsonl", "application/x-jsonlines":
+			return responseFormatNDJSON
+		case "application/msgpack", "application/x-msgpack", "application/vnd.msgpack":
+			return responseFormatMsgpack
+		}
+	}
+	return ""
+}
+
+func normalizeResponseFormat(format string) string {
+	switch format {
+	case "jsonl", "jsonline":
+		return responseFormatNDJSON
+	default:
+		return format
+	}
+}
+
+// getCSVFieldNames returns CSV field names from `columns` query arg.
+//
+// See https://victoriametrics.github.io/#how-to-export-csv-data for the list of supported field names.
+func getCSVFieldNames(r *http.Request) []string {
+	columns := r.FormValue("columns")
+	if len(columns) == 0 {
+		columns = defaultCSVColumns
+	}
+	return strings.Split(columns, ",")
+}
+
+// appendMsgpackSeries appends msgpack-encoded map with `metric`, `values` and `timestamps` keys for the given series to dst.
+//
+// The map has the same structure as the JSON line returned from /api/v1/export.
+func appendMsgpackSeries(dst []byte, mn *storage.MetricName, values []float64, timestamps []int64) []byte {
+	dst = appendMsgpackMapHeader(dst, 3)
+
+	dst = appendMsgpackString(dst, "metric")
+	n := len(mn.Tags)
+	if len(mn.MetricGroup) > 0 {
+		n++
+	}
+	dst = appendMsgpackMapHeader(dst, n)
+	if len(mn.MetricGroup) > 0 {
+		dst = appendMsgpackString(dst, "__name__")
+		dst = appendMsgpackBytes(dst, mn.MetricGroup)
+	}
+	for i := range mn.Tags {
+		tag := &mn.Tags[i]
+		dst = appendMsgpackBytes(dst, tag.Key)
+		dst = appendMsgpackBytes(dst, tag.Value)
+	}
+
+	dst = appendMsgpackString(dst, "values")
+	dst = appendMsgpackArrayHeader(dst, len(values))
+	for _, v := range values {
+		bits := math.Float64bits(v)
+		dst = append(dst, 0xcb, byte(bits>>56), byte(bits>>48), byte(bits>>40), byte(bits>>32), byte(bits>>24), byte(bits>>16), byte(bits>>8), byte(bits))
+	}
+
+	dst = appendMsgpackString(dst, "timestamps")
+	dst = appendMsgpackArrayHeader(dst, len(timestamps))
+	for _, ts := range timestamps {
+		u := uint64(ts)
+		dst = append(dst, 0xd3, byte(u>>56), byte(u>>48), byte(u>>40), byte(u>>32), byte(u>>24), byte(u>>16), byte(u>>8), byte(u))
+	}
+	return dst
+}
+
+func appendMsgpackMapHeader(dst []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(dst, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return append(dst, 0xde, byte(n>>8), byte(n))
+	default:
+		return append(dst, 0xdf, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+}
+
+func appendMsgpackArrayHeader(dst []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(dst, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return append(dst, 0xdc, byte(n>>8), byte(n))
+	default:
+		return append(dst, 0xdd, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+}
+
+func appendMsgpackString(dst []byte, s string) []byte {
+	dst = appendMsgpackStringHeader(dst, len(s))
+	return append(dst, s...)
+}
+
+func appendMsgpackBytes(dst, b []byte) []byte {
+	dst = appendMsgpackStringHeader(dst, len(b))
+	return append(dst, b...)
+}
+
+func appendMsgpackStringHeader(dst []byte, n int) []byte {
+	switch {
+	case n < 32:
+		return append(dst, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		return append(dst, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		return append(dst, 0xda, byte(n>>8), byte(n))
+	default:
+		return append(dst, 0xdb, byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+}
+
+func unsupportedResponseFormatError(format string, supported ...string) error {
+	return fmt.Errorf("unsupported `format`=%q; supported values: %s", format, strings.Join(supported, ", "))
+}
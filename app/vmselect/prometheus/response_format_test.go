@@ -0,0 +1,102 @@
+package prometheus
+
+import (
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+)
+
+func TestGetResponseFormat(t *testing.T) {
+	f := func(format, accept, formatExpected string) {
+		t.Helper()
+		r := &http.Request{
+			Form:   url.Values{},
+			Header: http.Header{},
+		}
+		if format != "" {
+			r.Form.Set("format", format)
+		}
+		if accept != "" {
+			r.Header.Set("Accept", accept)
+		}
+		result := getResponseFormat(r)
+		if result != formatExpected {
+			t.Fatalf("unexpected format for format=%q, Accept=%q; got %q; want %q", format, accept, result, formatExpected)
+		}
+	}
+	f("", "", "")
+	f("", "*/*", "")
+	f("", "application/json, text/plain, */*", "json")
+	f("", "text/csv", "csv")
+	f("", "text/html;q=0.9, text/csv;charset=utf-8", "csv")
+	f("", "application/x-ndjson", "ndjson")
+	f("", "application/jsonl", "ndjson")
+	f("", "application/msgpack", "msgpack")
+	f("", "application/x-msgpack", "msgpack")
+
+	// format arg has priority over Accept header
+	f("csv", "application/json", "csv")
+	f("jsonl", "", "ndjson")
+	f("promapi", "text/csv", "promapi")
+	f("foobar", "", "foobar")
+}
+
+func TestGetCSVFieldNames(t *testing.T) {
+	f := func(columns, fieldNamesExpected string) {
+		t.Helper()
+		r := &http.Request{
+			Form: url.Values{},
+		}
+		if columns != "" {
+			r.Form.Set("columns", columns)
+		}
+		fieldNames := getCSVFieldNames(r)
+		if s := strings.Join(fieldNames, ","); s != fieldNamesExpected {
+			t.Fatalf("unexpected field names; got %q; want %q", s, fieldNamesExpected)
+		}
+	}
+	f("", "__name__,__timestamp__,__value__")
+	f("instance,__timestamp__:rfc3339,__value__", "instance,__timestamp__:rfc3339,__value__")
+}
+
+func TestAppendMsgpackSeries(t *testing.T) {
+	f := func(mn *storage.MetricName, values []float64, timestamps []int64, resultExpected string) {
+		t.Helper()
+		result := hex.EncodeToString(appendMsgpackSeries(nil, mn, values, timestamps))
+		if result != resultExpected {
+			t.Fatalf("unexpected result\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+	f(&storage.MetricName{}, nil, nil, "83"+
+		"a66d6574726963"+"80"+
+		"a676616c756573"+"90"+
+		"aa74696d657374616d7073"+"90")
+	f(&storage.MetricName{
+		MetricGroup: []byte("up"),
+		Tags: []storage.Tag{{
+			Key:   []byte("job"),
+			Value: []byte("vm"),
+		}},
+	}, []float64{1, -0.5}, []int64{1000, -1}, "83"+
+		"a66d6574726963"+"82"+"a85f5f6e616d655f5f"+"a27570"+"a36a6f62"+"a2766d"+
+		"a676616c756573"+"92"+"cb3ff0000000000000"+"cbbfe0000000000000"+
+		"aa74696d657374616d7073"+"92"+"d300000000000003e8"+"d3ffffffffffffffff")
+
+	// Long strings and arrays
+	mn := &storage.MetricName{
+		MetricGroup: []byte(strings.Repeat("x", 40)),
+	}
+	values := make([]float64, 20)
+	timestamps := make([]int64, 20)
+	result := appendMsgpackSeries(nil, mn, values, timestamps)
+	if !strings.Contains(hex.EncodeToString(result), "d928"+strings.Repeat("78", 40)) {
+		t.Fatalf("missing str8 header for long string in %x", result)
+	}
+	if !strings.Contains(hex.EncodeToString(result), "a676616c756573"+"dc0014") {
+		t.Fatalf("missing array16 header for long array in %x", result)
+	}
+}
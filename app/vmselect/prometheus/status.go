@@ -0,0 +1,92 @@
+package prometheus
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+)
+
+// prometheusCompatibleVersion is the Prometheus version returned from /api/v1/status/buildinfo.
+//
+// Grafana and other tools use this version for detecting the supported Prometheus querying API features.
+const prometheusCompatibleVersion = "2.24.0"
+
+var versionRe = regexp.MustCompile(`v\d+\.\d+\.\d+`)
+
+// BuildInfoHandler processes /api/v1/status/buildinfo request.
+//
+// See https://prometheus.io/docs/prometheus/latest/querying/api/#build-information
+func BuildInfoHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	WriteBuildInfoResponse(w)
+}
+
+// FlagsHandler processes /api/v1/status/flags request.
+//
+// Values for flags with secrets such as passwords and auth keys are replaced with `secret`.
+//
+// See https://prometheus.io/docs/prometheus/latest/querying/api/#flags
+func FlagsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	WriteFlagsResponse(w, getFlagValues(flag.CommandLine))
+}
+
+type flagValue struct {
+	name  string
+	value string
+}
+
+// getFlagValues returns values for all the flags in fs sorted by flag name.
+func getFlagValues(fs *flag.FlagSet) []flagValue {
+	var flags []flagValue
+	// VisitAll visits flags in lexicographical order.
+	fs.VisitAll(func(f *flag.Flag) {
+		value := f.Value.String()
+		if flagutil.IsSecretFlag(strings.ToLower(f.Name)) {
+			// Do not expose passwords and keys.
+			value = "secret"
+		}
+		flags = append(flags, flagValue{
+			name:  f.Name,
+			value: value,
+		})
+	})
+	return flags
+}
+
+// RuntimeInfoHandler processes /api/v1/status/runtimeinfo request.
+//
+// See https://prometheus.io/docs/prometheus/latest/querying/api/#runtime-information
+func RuntimeInfoHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	cwd, err := os.Getwd()
+	if err != nil {
+		cwd = ""
+	}
+	WriteRuntimeInfoResponse(w, cwd)
+}
+
+var processStartTime = time.Now()
+
+// getStorageRetention returns -retentionPeriod in Prometheus format, e.g. `30d`.
+func getStorageRetention() string {
+	f := flag.Lookup("retentionPeriod")
+	if f == nil {
+		return ""
+	}
+	d, ok := f.Value.(*flagutil.Duration)
+	if !ok {
+		return f.Value.String()
+	}
+	msecsPerDay := int64(24 * 3600 * 1000)
+	if d.Msecs%msecsPerDay == 0 {
+		return fmt.Sprintf("%dd", d.Msecs/msecsPerDay)
+	}
+	return (time.Duration(d.Msecs) * time.Millisecond).String()
+}
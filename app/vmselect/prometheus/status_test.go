@@ -0,0 +1,73 @@
+package prometheus
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"testing"
+)
+
+func TestWriteFlagsResponse(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.String("foo", "bar", "")
+	fs.String("httpAuth.password", "pass", "")
+	fs.String("search.resetCacheAuthKey", "key", "")
+	fs.Int("search.maxUniqueTimeseries", 300000, "")
+	fs.String("special", "a\"b\\c\x01<", "")
+	if err := fs.Parse([]string{"-foo=baz"}); err != nil {
+		t.Fatalf("cannot parse flags: %s", err)
+	}
+	var bb bytes.Buffer
+	WriteFlagsResponse(&bb, getFlagValues(fs))
+	var resp struct {
+		Status string
+		Data   map[string]string
+	}
+	if err := json.Unmarshal(bb.Bytes(), &resp); err != nil {
+		t.Fatalf("cannot unmarshal response %q: %s", bb.String(), err)
+	}
+	if resp.Status != "success" {
+		t.Fatalf("unexpected status; got %q; want %q", resp.Status, "success")
+	}
+	dataExpected := map[string]string{
+		"foo":                        "baz",
+		"httpAuth.password":          "secret",
+		"search.resetCacheAuthKey":   "secret",
+		"search.maxUniqueTimeseries": "300000",
+		"special":                    "a\"b\\c\x01<",
+	}
+	if len(resp.Data) != len(dataExpected) {
+		t.Fatalf("unexpected number of flags; got %d; want %d", len(resp.Data), len(dataExpected))
+	}
+	for k, v := range dataExpected {
+		if resp.Data[k] != v {
+			t.Fatalf("unexpected value for flag %q; got %q; want %q", k, resp.Data[k], v)
+		}
+	}
+}
+
+func TestWriteBuildInfoAndRuntimeInfoResponse(t *testing.T) {
+	f := func(write func(bb *bytes.Buffer), keysExpected []string) {
+		t.Helper()
+		var bb bytes.Buffer
+		write(&bb)
+		var resp struct {
+			Status string
+			Data   map[string]interface{}
+		}
+		if err := json.Unmarshal(bb.Bytes(), &resp); err != nil {
+			t.Fatalf("cannot unmarshal response %q: %s", bb.String(), err)
+		}
+		if resp.Status != "success" {
+			t.Fatalf("unexpected status; got %q; want %q", resp.Status, "success")
+		}
+		for _, k := range keysExpected {
+			if _, ok := resp.Data[k]; !ok {
+				t.Fatalf("missing %q key in response %q", k, bb.String())
+			}
+		}
+	}
+	f(func(bb *bytes.Buffer) { WriteBuildInfoResponse(bb) }, []string{"version", "revision", "branch", "buildUser", "buildDate", "goVersion"})
+	f(func(bb *bytes.Buffer) { WriteRuntimeInfoResponse(bb, "/foo\"bar") }, []string{"startTime", "CWD", "reloadConfigSuccess", "lastConfigTime",
+		"corruptionCount", "goroutineCount", "GOMAXPROCS", "GOGC", "GODEBUG", "storageRetention"})
+}
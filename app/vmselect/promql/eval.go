@@ -5,14 +5,17 @@ import (
 	"fmt"
 	"math"
 	"sync"
+	"sync/atomic"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
 	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/searchutils"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/cgroup"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/memory"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/tracing"
 	"github.com/VictoriaMetrics/metrics"
 	"github.com/VictoriaMetrics/metricsql"
 )
@@ -21,9 +24,24 @@ var (
 	disableCache           = flag.Bool("search.disableCache", false, "Whether to disable response caching. This may be useful during data backfilling")
 	maxPointsPerTimeseries = flag.Int("search.maxPointsPerTimeseries", 30e3, "The maximum points per a single timeseries returned from /api/v1/query_range. "+
 		"This option doesn't limit the number of scanned raw samples in the database. The main purpose of this option is to limit the number of per-series points "+
-		"returned to graphing UI such as Grafana. There is no sense in setting this limit to values significantly exceeding horizontal resoultion of the graph")
+		"returned to graphing UI such as Grafana. There is no sense in setting this limit to values significantly exceeding horizontal resoultion of the graph. "+
+		"The flag may be changed at runtime via /-/flags page")
 )
 
+// maxPointsPerTimeseriesValue contains -search.maxPointsPerTimeseries value, which may be changed at runtime.
+var maxPointsPerTimeseriesValue int64
+
+func init() {
+	flagutil.RegisterHotFlag("search.maxPointsPerTimeseries", func() error {
+		if *maxPointsPerTimeseries < 0 {
+			return fmt.Errorf("the value cannot be negative; got %d", *maxPointsPerTimeseries)
+		}
+		return nil
+	}, func() {
+		atomic.StoreInt64(&maxPointsPerTimeseriesValue, int64(*maxPointsPerTimeseries))
+	})
+}
+
 // The minimum number of points per timeseries for enabling time rounding.
 // This improves cache hit ratio for frequently requested queries over
 // big time ranges.
@@ -35,13 +53,38 @@ const minTimeseriesPointsForTimeRounding = 50
 // The number mustn't exceed -search.maxPointsPerTimeseries.
 func ValidateMaxPointsPerTimeseries(start, end, step int64) error {
 	points := (end-start)/step + 1
-	if uint64(points) > uint64(*maxPointsPerTimeseries) {
+	maxPoints := MaxPointsPerTimeseries()
+	if uint64(points) > uint64(maxPoints) {
 		return fmt.Errorf(`too many points for the given step=%d, start=%d and end=%d: %d; cannot exceed -search.maxPointsPerTimeseries=%d`,
-			step, start, end, uint64(points), *maxPointsPerTimeseries)
+			step, start, end, uint64(points), maxPoints)
 	}
 	return nil
 }
 
+// MaxPointsPerTimeseries returns the maximum number of points per time series, which can be returned from a query.
+//
+// See -search.maxPointsPerTimeseries.
+func MaxPointsPerTimeseries() int {
+	return int(atomic.LoadInt64(&maxPointsPerTimeseriesValue))
+}
+
+// AdjustStepForMaxPoints returns the minimum step, which is bigger or equal to the given step,
+// so the number of points per series on the time range [start ... end] doesn't exceed maxPoints.
+//
+// Steps exceeding a second are rounded up to whole seconds.
+func AdjustStepForMaxPoints(start, end, step int64, maxPoints int) int64 {
+	if maxPoints < 2 || (end-start)/step+1 <= int64(maxPoints) {
+		return step
+	}
+	// Round up the step, so (end-start)/newStep+1 <= maxPoints
+	n := int64(maxPoints - 1)
+	newStep := (end - start + n - 1) / n
+	if newStep > 1000 && newStep%1000 != 0 {
+		newStep += 1000 - newStep%1000
+	}
+	return newStep
+}
+
 // AdjustStartEnd adjusts start and end values, so response caching may be enabled.
 //
 // See EvalConfig.mayCache for details.
@@ -59,7 +102,7 @@ func AdjustStartEnd(start, end, step int64) (int64, int64) {
 
 	// Round start and end to values divisible by step in order
 	// to enable response caching (see EvalConfig.mayCache).
-	start, end = alignStartEnd(start, end, step)
+	start, end = AlignStartEnd(start, end, step)
 
 	// Make sure that the new number of points is the same as the initial number of points.
 	newPoints := (end-start)/step + 1
@@ -71,7 +114,8 @@ func AdjustStartEnd(start, end, step int64) (int64, int64) {
 	return start, end
 }
 
-func alignStartEnd(start, end, step int64) (int64, int64) {
+// AlignStartEnd rounds start down and end up to values divisible by step.
+func AlignStartEnd(start, end, step int64) (int64, int64) {
 	// Round start to the nearest smaller value divisible by step.
 	start -= start % step
 	// Round end to the nearest bigger value divisible by step.
@@ -103,6 +147,9 @@ type EvalConfig struct {
 
 	// EnforcedTagFilters used for apply additional label filters to query.
 	EnforcedTagFilters []storage.TagFilter
+
+	// Span is an optional tracing span for the query.
+	Span *tracing.Span
 }
 
 // newEvalConfig returns new EvalConfig copy from src.
@@ -115,6 +162,7 @@ func newEvalConfig(src *EvalConfig) *EvalConfig {
 	ec.MayCache = src.MayCache
 	ec.LookbackDelta = src.LookbackDelta
 	ec.EnforcedTagFilters = src.EnforcedTagFilters
+	ec.Span = src.Span
 
 	// do not copy src.timestamps - they must be generated again.
 	return &ec
@@ -549,7 +597,7 @@ func evalRollupFuncWithSubquery(ec *EvalConfig, name string, rf rollupFunc, expr
 		return nil, err
 	}
 	// unconditionally align start and end args to step for subquery as Prometheus does.
-	ecSQ.Start, ecSQ.End = alignStartEnd(ecSQ.Start, ecSQ.End, ecSQ.Step)
+	ecSQ.Start, ecSQ.End = AlignStartEnd(ecSQ.Start, ecSQ.End, ecSQ.Step)
 	tssSQ, err := evalExpr(ecSQ, re.Expr)
 	if err != nil {
 		return nil, err
@@ -693,11 +741,17 @@ func evalRollupFuncWithMetricExpr(ec *EvalConfig, name string, rf rollupFunc,
 		minTimestamp -= ec.Step
 	}
 	sq := storage.NewSearchQuery(minTimestamp, ec.End, [][]storage.TagFilter{tfs})
+	span := ec.Span.NewChild("storage.search")
+	span.SetAttribute("filters", string(me.AppendString(nil)))
 	rss, err := netstorage.ProcessSearchQuery(sq, true, ec.Deadline)
 	if err != nil {
+		span.SetError(err)
+		span.End()
 		return nil, err
 	}
 	rssLen := rss.Len()
+	span.SetIntAttribute("series", int64(rssLen))
+	span.End()
 	if rssLen == 0 {
 		rss.Cancel()
 		var tss []*timeseries
@@ -737,11 +791,20 @@ func evalRollupFuncWithMetricExpr(ec *EvalConfig, name string, rf rollupFunc,
 	rollupMemorySize := mulNoOverflow(rollupPoints, 16)
 	rml := getRollupMemoryLimiter()
 	if !rml.Get(uint64(rollupMemorySize)) {
+		if *spillToDisk && iafc == nil {
+			// Spill intermediate results to disk instead of returning the error.
+			// Do not cache the result, since it may occupy too much space in the cache.
+			tss, err := evalRollupWithSpill(name, rss, rcs, preFunc, sharedTimestamps, !rollupFuncsKeepMetricGroup[name], ec.Deadline)
+			if err != nil {
+				return nil, err
+			}
+			return mergeTimeseries(tssCached, tss, start, ec), nil
+		}
 		rss.Cancel()
 		return nil, fmt.Errorf("not enough memory for processing %d data points across %d time series with %d points in each time series; "+
 			"total available memory for concurrent requests: %d bytes; "+
 			"possible solutions are: reducing the number of matching time series; switching to node with more RAM; "+
-			"increasing -memory.allowedPercent; increasing `step` query arg (%gs)",
+			"increasing -memory.allowedPercent; increasing `step` query arg (%gs); enabling -search.spillToDisk",
 			rollupPoints, timeseriesLen*len(rcs), pointsPerTimeseries, rml.MaxSize, float64(ec.Step)/1e3)
 	}
 	defer rml.Put(uint64(rollupMemorySize))
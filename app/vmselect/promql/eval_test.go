@@ -0,0 +1,48 @@
+package promql
+
+import (
+	"testing"
+)
+
+func TestAdjustStepForMaxPoints(t *testing.T) {
+	f := func(start, end, step int64, maxPoints int, stepExpected int64) {
+		t.Helper()
+		newStep := AdjustStepForMaxPoints(start, end, step, maxPoints)
+		if newStep != stepExpected {
+			t.Fatalf("unexpected step for start=%d, end=%d, step=%d, maxPoints=%d; got %d; want %d", start, end, step, maxPoints, newStep, stepExpected)
+		}
+		if points := (end-start)/newStep + 1; points > int64(maxPoints) && maxPoints >= 2 {
+			t.Fatalf("too many points for the adjusted step=%d: %d; mustn't exceed %d", newStep, points, maxPoints)
+		}
+	}
+
+	// The number of points doesn't exceed maxPoints
+	f(0, 100, 10, 11, 10)
+	f(0, 100, 10, 100, 10)
+
+	// Too small maxPoints
+	f(0, 100, 10, 1, 10)
+
+	// Steps smaller than a second
+	f(0, 100, 1, 11, 10)
+	f(0, 101, 1, 11, 11)
+
+	// Steps bigger than a second are rounded to seconds
+	f(0, 90*24*3600*1000, 1000, 11000, 707000)
+	f(0, 3600*1000, 1000, 61, 60000)
+	f(0, 3600*1000, 1000, 60, 62000)
+}
+
+func TestAlignStartEnd(t *testing.T) {
+	f := func(start, end, step, startExpected, endExpected int64) {
+		t.Helper()
+		startAligned, endAligned := AlignStartEnd(start, end, step)
+		if startAligned != startExpected || endAligned != endExpected {
+			t.Fatalf("unexpected result for AlignStartEnd(%d, %d, %d); got (%d, %d); want (%d, %d)",
+				start, end, step, startAligned, endAligned, startExpected, endExpected)
+		}
+	}
+	f(0, 100, 10, 0, 100)
+	f(15, 95, 10, 10, 100)
+	f(1000, 1001, 1000, 1000, 2000)
+}
@@ -47,14 +47,25 @@ func Exec(ec *EvalConfig, q string, isFirstPointOnly bool) ([]netstorage.Result,
 
 	ec.validate()
 
+	parseSpan := ec.Span.NewChild("promql.parse")
 	e, err := parsePromQLWithCache(q)
+	parseSpan.SetError(err)
+	parseSpan.End()
 	if err != nil {
 		return nil, err
 	}
 
+	// Temporarily substitute ec.Span with evalSpan, so spans created during the evaluation become its children.
+	parentSpan := ec.Span
+	evalSpan := parentSpan.NewChild("promql.eval")
+	evalSpan.SetAttribute("query", q)
+	ec.Span = evalSpan
 	qid := activeQueriesV.Add(ec, q)
 	rv, err := evalExpr(ec, e)
 	activeQueriesV.Remove(qid)
+	ec.Span = parentSpan
+	evalSpan.SetError(err)
+	evalSpan.End()
 	if err != nil {
 		return nil, err
 	}
@@ -4787,6 +4787,82 @@ func TestExecSuccess(t *testing.T) {
 		resultExpected := []netstorage.Result{r1}
 		f(q, resultExpected)
 	})
+	t.Run(`fill_null()`, func(t *testing.T) {
+		t.Parallel()
+		q := `fill_null(time() < 1300 default time() > 1700, 0)`
+		r1 := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{1000, 1200, 0, 0, 1800, 2000},
+			Timestamps: timestampsExpected,
+		}
+		resultExpected := []netstorage.Result{r1}
+		f(q, resultExpected)
+	})
+	t.Run(`fill_null(scalar)`, func(t *testing.T) {
+		t.Parallel()
+		q := `fill_null(label_set(time() > 1500, "foo", "bar"), time()/10)`
+		r1 := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{100, 120, 140, 1600, 1800, 2000},
+			Timestamps: timestampsExpected,
+		}
+		r1.MetricName.Tags = []storage.Tag{{
+			Key:   []byte("foo"),
+			Value: []byte("bar"),
+		}}
+		resultExpected := []netstorage.Result{r1}
+		f(q, resultExpected)
+	})
+	t.Run(`interpolate_linear()`, func(t *testing.T) {
+		t.Parallel()
+		q := `interpolate_linear(label_set(time() < 1300 default time() > 1700, "__name__", "foobar", "x", "y"))`
+		r1 := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{1000, 1200, 1400, 1600, 1800, 2000},
+			Timestamps: timestampsExpected,
+		}
+		r1.MetricName.MetricGroup = []byte("foobar")
+		r1.MetricName.Tags = []storage.Tag{{
+			Key:   []byte("x"),
+			Value: []byte("y"),
+		}}
+		resultExpected := []netstorage.Result{r1}
+		f(q, resultExpected)
+	})
+	t.Run(`interpolate_linear(head_tail)`, func(t *testing.T) {
+		t.Parallel()
+		q := `interpolate_linear((time() > 1100 and time() < 1300) default (time() > 1500 and time() < 1700))`
+		r1 := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{nan, 1200, 1400, 1600, nan, nan},
+			Timestamps: timestampsExpected,
+		}
+		resultExpected := []netstorage.Result{r1}
+		f(q, resultExpected)
+	})
+	t.Run(`last_value_fill(seconds)`, func(t *testing.T) {
+		t.Parallel()
+		q := `last_value_fill(label_set(time() < 1300 default time() > 1700, "__name__", "foobar"), 400)`
+		r1 := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{1000, 1200, 1200, 1200, 1800, 2000},
+			Timestamps: timestampsExpected,
+		}
+		r1.MetricName.MetricGroup = []byte("foobar")
+		resultExpected := []netstorage.Result{r1}
+		f(q, resultExpected)
+	})
+	t.Run(`last_value_fill(duration)`, func(t *testing.T) {
+		t.Parallel()
+		q := `last_value_fill(time() < 1300, "3m20s")`
+		r1 := netstorage.Result{
+			MetricName: metricNameExpected,
+			Values:     []float64{1000, 1200, 1200, nan, nan, nan},
+			Timestamps: timestampsExpected,
+		}
+		resultExpected := []netstorage.Result{r1}
+		f(q, resultExpected)
+	})
 	t.Run(`distinct_over_time([500s])`, func(t *testing.T) {
 		t.Parallel()
 		q := `distinct_over_time((time() < 1700)[500s])`
@@ -6353,6 +6429,11 @@ func TestExecError(t *testing.T) {
 	f(`keep_last_value()`)
 	f(`keep_next_value()`)
 	f(`interpolate()`)
+	f(`fill_null()`)
+	f(`fill_null(1)`)
+	f(`interpolate_linear()`)
+	f(`last_value_fill(1)`)
+	f(`last_value_fill(1, "foo")`)
 	f(`distinct_over_time()`)
 	f(`distinct()`)
 	f(`alias()`)
@@ -61,3 +61,23 @@ func ParseMetricSelector(s string) ([]storage.TagFilter, error) {
 	tfs := toTagFilters(me.LabelFilters)
 	return tfs, nil
 }
+
+// ParseMetricSelectors parses PromQL query q and returns LabelFilters for all the metric selectors in q.
+func ParseMetricSelectors(q string) ([][]storage.TagFilter, error) {
+	expr, err := parsePromQLWithCache(q)
+	if err != nil {
+		return nil, err
+	}
+	var tagFilterss [][]storage.TagFilter
+	metricsql.VisitAll(expr, func(e metricsql.Expr) {
+		me, ok := e.(*metricsql.MetricExpr)
+		if !ok || len(me.LabelFilters) == 0 {
+			return
+		}
+		tagFilterss = append(tagFilterss, toTagFilters(me.LabelFilters))
+	})
+	if len(tagFilterss) == 0 {
+		return nil, fmt.Errorf("cannot find metric selectors in %q", q)
+	}
+	return tagFilterss, nil
+}
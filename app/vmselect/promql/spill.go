@@ -0,0 +1,414 @@
+package promql
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/netstorage"
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timerpool"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	spillToDisk = flag.Bool("search.spillToDisk", false, "Whether to spill intermediate rollup results to temporary files on disk for queries, "+
+		"which don't fit the memory budget for query processing, instead of returning `not enough memory` error. "+
+		"Only a single such query is processed at a time. See https://victoriametrics.github.io/#spilling-query-results-to-disk")
+	maxSpillSize = flagutil.NewBytes("search.maxSpillSize", 10*1024*1024*1024, "The maximum size of temporary files, which may be created for a single query "+
+		"when -search.spillToDisk is set")
+)
+
+// maxSpillBlockSize is the maximum size of in-memory rollup results before they are sorted and spilled to disk.
+const maxSpillBlockSize = 64 * 1024 * 1024
+
+// getSpillBlockSize returns the size of in-memory rollup results, which must be spilled to disk.
+//
+// The size is limited by the memory budget for rollup results, so queries with spilled results
+// don't occupy more memory than the rest of queries during the rollup evaluation.
+func getSpillBlockSize() int {
+	n := getRollupMemoryLimiter().MaxSize / 4
+	if n > maxSpillBlockSize {
+		n = maxSpillBlockSize
+	}
+	if n < 1024*1024 {
+		n = 1024 * 1024
+	}
+	return int(n)
+}
+
+// InitSpillDir initializes directory for temporary files created when -search.spillToDisk is set.
+//
+// It must be called before executing queries.
+func InitSpillDir(tmpDirPath string) {
+	spillDir = tmpDirPath + "/spill"
+	fs.MustRemoveAll(spillDir)
+	if err := fs.MkdirAllIfNotExist(spillDir); err != nil {
+		logger.Panicf("FATAL: cannot create %q: %s", spillDir, err)
+	}
+}
+
+var spillDir string
+
+// spillConcurrencyCh limits the number of concurrently executed queries with spilled results,
+// since the final result for such queries may occupy big amounts of memory.
+var spillConcurrencyCh = make(chan struct{}, 1)
+
+var (
+	spilledQueries = metrics.NewCounter(`vm_search_spilled_queries_total`)
+	spilledBytes   = metrics.NewCounter(`vm_search_spilled_bytes_total`)
+)
+
+// evalRollupWithSpill evaluates rcs over rss in the same way as evalRollupNoIncrementalAggregate does,
+// but it spills sorted blocks of intermediate results to temporary file when they exceed getSpillBlockSize().
+// The spilled blocks are merged into the final result after all the rss is processed.
+func evalRollupWithSpill(name string, rss *netstorage.Results, rcs []*rollupConfig,
+	preFunc func(values []float64, timestamps []int64), sharedTimestamps []int64, removeMetricGroup bool, deadline searchutils.Deadline) ([]*timeseries, error) {
+	if err := acquireSpillConcurrencySlot(deadline); err != nil {
+		rss.Cancel()
+		return nil, err
+	}
+	defer func() {
+		<-spillConcurrencyCh
+	}()
+	spilledQueries.Inc()
+
+	sw := &spillWriter{
+		pointsPerTimeseries: len(sharedTimestamps),
+		maxPendingSize:      getSpillBlockSize(),
+		maxSize:             uint64(maxSpillSize.N),
+	}
+	defer sw.MustClose()
+	var swLock sync.Mutex
+	addTimeseries := func(ts *timeseries) error {
+		swLock.Lock()
+		err := sw.Add(ts)
+		swLock.Unlock()
+		return err
+	}
+	err := rss.RunParallel(func(rs *netstorage.Result, workerID uint) error {
+		preFunc(rs.Values, rs.Timestamps)
+		ts := getTimeseries()
+		defer putTimeseries(ts)
+		for _, rc := range rcs {
+			if tsm := newTimeseriesMap(name, sharedTimestamps, &rs.MetricName); tsm != nil {
+				rc.DoTimeseriesMap(tsm, rs.Values, rs.Timestamps)
+				for _, ts := range tsm.m {
+					if err := addTimeseries(ts); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			ts.Reset()
+			doRollupForTimeseries(rc, ts, &rs.MetricName, rs.Values, rs.Timestamps, sharedTimestamps, removeMetricGroup)
+			if err := addTimeseries(ts); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify the merged results fit available memory.
+	resultSize := sw.ResultSize()
+	rml := getRollupMemoryLimiter()
+	if !rml.Get(resultSize) {
+		return nil, fmt.Errorf("not enough memory for merging %d time series with %d points in each time series spilled to disk; "+
+			"total available memory for concurrent requests: %d bytes; "+
+			"possible solutions are: reducing the number of matching time series; switching to node with more RAM; "+
+			"increasing -memory.allowedPercent; increasing `step` query arg", sw.seriesCount, sw.pointsPerTimeseries, rml.MaxSize)
+	}
+	defer rml.Put(resultSize)
+	return sw.Merge(sharedTimestamps)
+}
+
+// acquireSpillConcurrencySlot waits until a slot in spillConcurrencyCh is available.
+//
+// It returns an error if the deadline is exceeded or if the query is canceled while waiting.
+func acquireSpillConcurrencySlot(deadline searchutils.Deadline) error {
+	select {
+	case spillConcurrencyCh <- struct{}{}:
+		return nil
+	default:
+	}
+	t := timerpool.Get(time.Until(time.Unix(int64(deadline.Deadline()), 0)))
+	defer timerpool.Put(t)
+	select {
+	case spillConcurrencyCh <- struct{}{}:
+		return nil
+	case <-deadline.CancelCh():
+		return fmt.Errorf("the query has been canceled while waiting for other query with results spilled to disk: %s", deadline.String())
+	case <-t.C:
+		return fmt.Errorf("timeout exceeded while waiting for other query with results spilled to disk: %s", deadline.String())
+	}
+}
+
+// spillWriter collects rollup results and spills them to temporary file in sorted blocks.
+type spillWriter struct {
+	pointsPerTimeseries int
+	maxPendingSize      int
+	maxSize             uint64
+
+	// pending contains rollup results, which weren't spilled to disk yet.
+	pending     []spillEntry
+	pendingSize int
+
+	f      *os.File
+	bw     *bufio.Writer
+	blocks []spillBlock
+	size   uint64
+
+	// seriesCount is the number of time series added to sw.
+	seriesCount int
+
+	// metricNamesSize is the summary size of marshaled metric names for time series added to sw.
+	metricNamesSize uint64
+}
+
+type spillEntry struct {
+	metricName []byte
+	values     []float64
+}
+
+// spillBlock is the location of sorted block in the spill file.
+type spillBlock struct {
+	offset uint64
+	size   uint64
+}
+
+// Add adds ts to sw.
+//
+// ts may be re-used after returning from Add.
+func (sw *spillWriter) Add(ts *timeseries) error {
+	if len(ts.Values) != sw.pointsPerTimeseries {
+		logger.Panicf("BUG: unexpected number of values in timeseries; got %d; want %d", len(ts.Values), sw.pointsPerTimeseries)
+	}
+	e := spillEntry{
+		metricName: ts.MetricName.Marshal(nil),
+		values:     append([]float64{}, ts.Values...),
+	}
+	sw.pending = append(sw.pending, e)
+	sw.pendingSize += len(e.metricName) + 8*len(e.values)
+	sw.seriesCount++
+	sw.metricNamesSize += uint64(len(e.metricName))
+	if sw.pendingSize < sw.maxPendingSize {
+		return nil
+	}
+	return sw.flushPending()
+}
+
+func (sw *spillWriter) sortPending() {
+	sort.Slice(sw.pending, func(i, j int) bool {
+		return string(sw.pending[i].metricName) < string(sw.pending[j].metricName)
+	})
+}
+
+func (sw *spillWriter) flushPending() error {
+	if len(sw.pending) == 0 {
+		return nil
+	}
+	if sw.f == nil {
+		f, err := ioutil.TempFile(spillDir, "")
+		if err != nil {
+			return fmt.Errorf("cannot create temporary file for spilling query results: %w", err)
+		}
+		sw.f = f
+		sw.bw = bufio.NewWriterSize(f, 1024*1024)
+	}
+	sw.sortPending()
+	b := spillBlock{
+		offset: sw.size,
+	}
+	var buf []byte
+	for i := range sw.pending {
+		e := &sw.pending[i]
+		buf = encoding.MarshalVarUint64(buf[:0], uint64(len(e.metricName)))
+		buf = append(buf, e.metricName...)
+		buf = append(buf, float64ToByteSlice(e.values)...)
+		if sw.size+uint64(len(buf)) > sw.maxSize {
+			return fmt.Errorf("the size of temporary files for the query exceeds -search.maxSpillSize=%d bytes; "+
+				"possible solutions are: reducing the number of matching time series; increasing `step` query arg; increasing -search.maxSpillSize", sw.maxSize)
+		}
+		if _, err := sw.bw.Write(buf); err != nil {
+			return fmt.Errorf("cannot write query results to temporary file %q: %w", sw.f.Name(), err)
+		}
+		sw.size += uint64(len(buf))
+	}
+	b.size = sw.size - b.offset
+	sw.blocks = append(sw.blocks, b)
+	spilledBytes.Add(int(b.size))
+	sw.pending = sw.pending[:0]
+	sw.pendingSize = 0
+	return nil
+}
+
+// ResultSize returns the approximate size of results returned from Merge.
+func (sw *spillWriter) ResultSize() uint64 {
+	return sw.metricNamesSize + uint64(sw.seriesCount)*uint64(8*sw.pointsPerTimeseries)
+}
+
+// Merge returns the collected rollup results sorted by metric name.
+//
+// The caller must verify the results fit available memory with ResultSize before calling Merge.
+func (sw *spillWriter) Merge(sharedTimestamps []int64) ([]*timeseries, error) {
+	if sw.f == nil {
+		// Fast path - all the results fit in memory.
+		sw.sortPending()
+		tss := make([]*timeseries, 0, len(sw.pending))
+		for i := range sw.pending {
+			e := &sw.pending[i]
+			ts, err := newSpilledTimeseries(e.metricName, e.values, sharedTimestamps)
+			if err != nil {
+				return nil, err
+			}
+			tss = append(tss, ts)
+		}
+		return tss, nil
+	}
+
+	// Slow path - merge sorted blocks from the spill file.
+	if err := sw.flushPending(); err != nil {
+		return nil, err
+	}
+	if err := sw.bw.Flush(); err != nil {
+		return nil, fmt.Errorf("cannot flush query results to temporary file %q: %w", sw.f.Name(), err)
+	}
+	h := make(spillReaderHeap, 0, len(sw.blocks))
+	for _, b := range sw.blocks {
+		sr := &spillReader{
+			br:                  bufio.NewReaderSize(io.NewSectionReader(sw.f, int64(b.offset), int64(b.size)), 64*1024),
+			pointsPerTimeseries: sw.pointsPerTimeseries,
+		}
+		ok, err := sr.next()
+		if err != nil {
+			return nil, fmt.Errorf("cannot read query results from temporary file %q: %w", sw.f.Name(), err)
+		}
+		if ok {
+			h = append(h, sr)
+		}
+	}
+	heap.Init(&h)
+	var tss []*timeseries
+	for len(h) > 0 {
+		sr := h[0]
+		values := append([]float64{}, sr.values...)
+		ts, err := newSpilledTimeseries(sr.metricName, values, sharedTimestamps)
+		if err != nil {
+			return nil, err
+		}
+		tss = append(tss, ts)
+		ok, err := sr.next()
+		if err != nil {
+			return nil, fmt.Errorf("cannot read query results from temporary file %q: %w", sw.f.Name(), err)
+		}
+		if ok {
+			heap.Fix(&h, 0)
+		} else {
+			heap.Pop(&h)
+		}
+	}
+	return tss, nil
+}
+
+// MustClose removes the spill file if it was created.
+func (sw *spillWriter) MustClose() {
+	sw.pending = nil
+	if sw.f == nil {
+		return
+	}
+	fname := sw.f.Name()
+
+	// Remove the file at first, then close it.
+	// This way the OS shouldn't try to flush file contents to storage on close.
+	if err := os.Remove(fname); err != nil {
+		logger.Panicf("FATAL: cannot remove %q: %s", fname, err)
+	}
+	if err := sw.f.Close(); err != nil {
+		logger.Panicf("FATAL: cannot close %q: %s", fname, err)
+	}
+	sw.f = nil
+}
+
+func newSpilledTimeseries(metricName []byte, values []float64, sharedTimestamps []int64) (*timeseries, error) {
+	var ts timeseries
+	if err := ts.MetricName.Unmarshal(metricName); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal metric name from spilled query results: %w", err)
+	}
+	ts.Values = values
+	ts.Timestamps = sharedTimestamps
+	ts.denyReuse = true
+	return &ts, nil
+}
+
+type spillReader struct {
+	br                  *bufio.Reader
+	pointsPerTimeseries int
+
+	metricName []byte
+	values     []float64
+	valuesBuf  []byte
+}
+
+func (sr *spillReader) next() (bool, error) {
+	n, err := binary.ReadUvarint(sr.br)
+	if err == io.EOF {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	sr.metricName = append(sr.metricName[:0], make([]byte, n)...)
+	if _, err := io.ReadFull(sr.br, sr.metricName); err != nil {
+		return false, fmt.Errorf("cannot read metric name with %d bytes: %w", n, err)
+	}
+	valuesSize := 8 * sr.pointsPerTimeseries
+	sr.valuesBuf = append(sr.valuesBuf[:0], make([]byte, valuesSize)...)
+	if _, err := io.ReadFull(sr.br, sr.valuesBuf); err != nil {
+		return false, fmt.Errorf("cannot read %d values: %w", sr.pointsPerTimeseries, err)
+	}
+	sr.values = append(sr.values[:0], byteSliceToFloat64(sr.valuesBuf)...)
+	return true, nil
+}
+
+type spillReaderHeap []*spillReader
+
+func (h *spillReaderHeap) Len() int {
+	return len(*h)
+}
+
+func (h *spillReaderHeap) Less(i, j int) bool {
+	a := *h
+	return bytes.Compare(a[i].metricName, a[j].metricName) < 0
+}
+
+func (h *spillReaderHeap) Swap(i, j int) {
+	a := *h
+	a[i], a[j] = a[j], a[i]
+}
+
+func (h *spillReaderHeap) Push(x interface{}) {
+	*h = append(*h, x.(*spillReader))
+}
+
+func (h *spillReaderHeap) Pop() interface{} {
+	a := *h
+	v := a[len(a)-1]
+	*h = a[:len(a)-1]
+	return v
+}
@@ -0,0 +1,139 @@
+package promql
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/app/vmselect/searchutils"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+)
+
+func TestSpillWriter(t *testing.T) {
+	tmpDir := "TestSpillWriter"
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+	InitSpillDir(tmpDir)
+
+	f := func(seriesCount, maxPendingSize int, maxSize uint64) {
+		t.Helper()
+		sharedTimestamps := []int64{1000, 2000, 3000}
+		sw := &spillWriter{
+			pointsPerTimeseries: len(sharedTimestamps),
+			maxPendingSize:      maxPendingSize,
+			maxSize:             maxSize,
+		}
+		defer sw.MustClose()
+		var ts timeseries
+		for _, n := range rand.Perm(seriesCount) {
+			ts.Reset()
+			ts.MetricName.MetricGroup = []byte(fmt.Sprintf("metric_%05d", n))
+			ts.MetricName.AddTag("job", fmt.Sprintf("job_%d", n%3))
+			ts.Values = append(ts.Values[:0], float64(n), float64(n+1), float64(n+2))
+			ts.Timestamps = sharedTimestamps
+			if err := sw.Add(&ts); err != nil {
+				t.Fatalf("unexpected error when adding timeseries #%d: %s", n, err)
+			}
+		}
+		resultSizeExpected := uint64(0)
+		for i := 0; i < seriesCount; i++ {
+			var mn storage.MetricName
+			mn.MetricGroup = []byte(fmt.Sprintf("metric_%05d", i))
+			mn.AddTag("job", fmt.Sprintf("job_%d", i%3))
+			resultSizeExpected += uint64(len(mn.Marshal(nil)) + 8*len(sharedTimestamps))
+		}
+		if resultSize := sw.ResultSize(); resultSize != resultSizeExpected {
+			t.Fatalf("unexpected result size; got %d; want %d", resultSize, resultSizeExpected)
+		}
+		tss, err := sw.Merge(sharedTimestamps)
+		if err != nil {
+			t.Fatalf("unexpected error when merging results: %s", err)
+		}
+		if len(tss) != seriesCount {
+			t.Fatalf("unexpected number of timeseries; got %d; want %d", len(tss), seriesCount)
+		}
+		for i, ts := range tss {
+			metricGroupExpected := fmt.Sprintf("metric_%05d", i)
+			if string(ts.MetricName.MetricGroup) != metricGroupExpected {
+				t.Fatalf("unexpected metric name at position %d; got %q; want %q", i, ts.MetricName.MetricGroup, metricGroupExpected)
+			}
+			jobExpected := fmt.Sprintf("job_%d", i%3)
+			if job := ts.MetricName.GetTagValue("job"); string(job) != jobExpected {
+				t.Fatalf("unexpected job label at position %d; got %q; want %q", i, job, jobExpected)
+			}
+			valuesExpected := []float64{float64(i), float64(i + 1), float64(i + 2)}
+			if !reflect.DeepEqual(ts.Values, valuesExpected) {
+				t.Fatalf("unexpected values at position %d; got %v; want %v", i, ts.Values, valuesExpected)
+			}
+			if !reflect.DeepEqual(ts.Timestamps, sharedTimestamps) {
+				t.Fatalf("unexpected timestamps at position %d; got %v; want %v", i, ts.Timestamps, sharedTimestamps)
+			}
+		}
+	}
+
+	// All the results fit in memory
+	f(0, 1e6, 1e6)
+	f(100, 1e6, 1e6)
+
+	// Results are spilled to disk
+	f(1, 1, 1e6)
+	f(1000, 1000, 1e6)
+	f(1000, 1, 1e6)
+}
+
+func TestSpillWriterMaxSizeExceeded(t *testing.T) {
+	tmpDir := "TestSpillWriterMaxSizeExceeded"
+	defer func() {
+		_ = os.RemoveAll(tmpDir)
+	}()
+	InitSpillDir(tmpDir)
+
+	sharedTimestamps := []int64{1000}
+	sw := &spillWriter{
+		pointsPerTimeseries: len(sharedTimestamps),
+		maxPendingSize:      1,
+		maxSize:             100,
+	}
+	defer sw.MustClose()
+	var ts timeseries
+	ts.Values = []float64{1}
+	ts.Timestamps = sharedTimestamps
+	for i := 0; i < 100; i++ {
+		ts.MetricName.MetricGroup = []byte(fmt.Sprintf("metric_%d", i))
+		if err := sw.Add(&ts); err != nil {
+			if !strings.Contains(err.Error(), "-search.maxSpillSize") {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			return
+		}
+	}
+	t.Fatalf("expecting non-nil error when exceeding maxSize")
+}
+
+func TestAcquireSpillConcurrencySlot(t *testing.T) {
+	deadline := searchutils.NewDeadline(time.Now(), time.Minute, "")
+	if err := acquireSpillConcurrencySlot(deadline); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// The slot cannot be acquired until the deadline while it is occupied by other query.
+	deadline = searchutils.NewDeadline(time.Now(), 0, "-search.maxQueryDuration")
+	err := acquireSpillConcurrencySlot(deadline)
+	if err == nil {
+		t.Fatalf("expecting non-nil error when the slot is occupied")
+	}
+	if !strings.Contains(err.Error(), "timeout exceeded") {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	<-spillConcurrencyCh
+	if err := acquireSpillConcurrencySlot(deadline); err != nil {
+		t.Fatalf("unexpected error after the slot is released: %s", err)
+	}
+	<-spillConcurrencyCh
+}
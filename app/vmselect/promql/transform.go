@@ -26,6 +26,9 @@ var transformFuncsKeepMetricGroup = map[string]bool{
 	"keep_last_value":    true,
 	"keep_next_value":    true,
 	"interpolate":        true,
+	"fill_null":          true,
+	"interpolate_linear": true,
+	"last_value_fill":    true,
 	"running_min":        true,
 	"running_max":        true,
 	"running_avg":        true,
@@ -88,6 +91,9 @@ var transformFuncs = map[string]transformFunc{
 	"keep_last_value":    transformKeepLastValue,
 	"keep_next_value":    transformKeepNextValue,
 	"interpolate":        transformInterpolate,
+	"fill_null":          transformFillNull,
+	"interpolate_linear": transformInterpolateLinear,
+	"last_value_fill":    transformLastValueFill,
 	"start":              newTransformFuncZeroArgs(transformStart),
 	"end":                newTransformFuncZeroArgs(transformEnd),
 	"step":               newTransformFuncZeroArgs(transformStep),
@@ -926,6 +932,113 @@ func transformInterpolate(tfa *transformFuncArg) ([]*timeseries, error) {
 	return rvs, nil
 }
 
+func transformFillNull(tfa *transformFuncArg) ([]*timeseries, error) {
+	args := tfa.args
+	if err := expectTransformArgsNum(args, 2); err != nil {
+		return nil, err
+	}
+	fillValues, err := getScalar(args[1], 1)
+	if err != nil {
+		return nil, err
+	}
+	rvs := args[0]
+	for _, ts := range rvs {
+		values := ts.Values
+		for i, v := range values {
+			if math.IsNaN(v) {
+				values[i] = fillValues[i]
+			}
+		}
+	}
+	return rvs, nil
+}
+
+// transformInterpolateLinear fills gaps between non-empty points with linearly interpolated values.
+//
+// Unlike transformInterpolate, it leaves empty points at the start and at the end of time series as is.
+func transformInterpolateLinear(tfa *transformFuncArg) ([]*timeseries, error) {
+	args := tfa.args
+	if err := expectTransformArgsNum(args, 1); err != nil {
+		return nil, err
+	}
+	rvs := args[0]
+	for _, ts := range rvs {
+		values := ts.Values
+		timestamps := ts.Timestamps
+		prevIdx := -1
+		for i, v := range values {
+			if math.IsNaN(v) {
+				continue
+			}
+			if prevIdx >= 0 && i-prevIdx > 1 {
+				prevValue := values[prevIdx]
+				prevTimestamp := timestamps[prevIdx]
+				k := (v - prevValue) / float64(timestamps[i]-prevTimestamp)
+				for j := prevIdx + 1; j < i; j++ {
+					values[j] = prevValue + k*float64(timestamps[j]-prevTimestamp)
+				}
+			}
+			prevIdx = i
+		}
+	}
+	return rvs, nil
+}
+
+// transformLastValueFill fills empty points with the last non-empty value
+// if it is located not further than the given max_gap from the empty point.
+//
+// max_gap may be set either as a number of seconds or as a duration string such as "10m".
+func transformLastValueFill(tfa *transformFuncArg) ([]*timeseries, error) {
+	args := tfa.args
+	if err := expectTransformArgsNum(args, 2); err != nil {
+		return nil, err
+	}
+	maxGaps, err := getMaxGaps(args[1], tfa.ec.Step)
+	if err != nil {
+		return nil, err
+	}
+	rvs := args[0]
+	for _, ts := range rvs {
+		values := ts.Values
+		timestamps := ts.Timestamps
+		lastIdx := -1
+		for i, v := range values {
+			if !math.IsNaN(v) {
+				lastIdx = i
+				continue
+			}
+			if lastIdx >= 0 && float64(timestamps[i]-timestamps[lastIdx]) <= maxGaps[i] {
+				values[i] = values[lastIdx]
+			}
+		}
+	}
+	return rvs, nil
+}
+
+// getMaxGaps returns max gaps in milliseconds for each point from arg.
+func getMaxGaps(arg []*timeseries, step int64) ([]float64, error) {
+	if s, err := getString(arg, 1); err == nil {
+		d, err := metricsql.PositiveDurationValue(s, step)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse max_gap=%q: %w", s, err)
+		}
+		maxGaps := make([]float64, len(arg[0].Values))
+		for i := range maxGaps {
+			maxGaps[i] = float64(d)
+		}
+		return maxGaps, nil
+	}
+	secs, err := getScalar(arg, 1)
+	if err != nil {
+		return nil, err
+	}
+	maxGaps := make([]float64, len(secs))
+	for i, v := range secs {
+		maxGaps[i] = v * 1000
+	}
+	return maxGaps, nil
+}
+
 func newTransformFuncRunning(rf func(a, b float64, idx int) float64) transformFunc {
 	return func(tfa *transformFuncArg) ([]*timeseries, error) {
 		args := tfa.args
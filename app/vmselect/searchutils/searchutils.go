@@ -7,17 +7,35 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/metrics"
 	"github.com/VictoriaMetrics/metricsql"
 )
 
 var (
 	maxExportDuration = flag.Duration("search.maxExportDuration", time.Hour*24*30, "The maximum duration for /api/v1/export call")
-	maxQueryDuration  = flag.Duration("search.maxQueryDuration", time.Second*30, "The maximum duration for query execution")
+	maxQueryDuration  = flag.Duration("search.maxQueryDuration", time.Second*30, "The maximum duration for query execution. "+
+		"The flag may be changed at runtime via /-/flags page")
 )
 
+// maxQueryDurationMsecs contains -search.maxQueryDuration value in milliseconds, which may be changed at runtime.
+var maxQueryDurationMsecs int64
+
+func init() {
+	flagutil.RegisterHotFlag("search.maxQueryDuration", func() error {
+		if *maxQueryDuration < 0 {
+			return fmt.Errorf("the value cannot be negative; got %s", *maxQueryDuration)
+		}
+		return nil
+	}, func() {
+		atomic.StoreInt64(&maxQueryDurationMsecs, maxQueryDuration.Milliseconds())
+	})
+}
+
 func roundToSeconds(ms int64) int64 {
 	return ms - ms%1000
 }
@@ -110,16 +128,15 @@ func GetMaxQueryDuration(r *http.Request) time.Duration {
 	if err != nil {
 		dms = 0
 	}
-	d := time.Duration(dms) * time.Millisecond
-	if d <= 0 || d > *maxQueryDuration {
-		d = *maxQueryDuration
+	if dms <= 0 || dms > atomic.LoadInt64(&maxQueryDurationMsecs) {
+		dms = atomic.LoadInt64(&maxQueryDurationMsecs)
 	}
-	return d
+	return time.Duration(dms) * time.Millisecond
 }
 
 // GetDeadlineForQuery returns deadline for the given query r.
 func GetDeadlineForQuery(r *http.Request, startTime time.Time) Deadline {
-	dMax := maxQueryDuration.Milliseconds()
+	dMax := atomic.LoadInt64(&maxQueryDurationMsecs)
 	return getDeadlineWithMaxDuration(r, startTime, dMax, "-search.maxQueryDuration")
 }
 
@@ -138,7 +155,10 @@ func getDeadlineWithMaxDuration(r *http.Request, startTime time.Time, dMax int64
 		d = dMax
 	}
 	timeout := time.Duration(d) * time.Millisecond
-	return NewDeadline(startTime, timeout, flagHint)
+	deadline := NewDeadline(startTime, timeout, flagHint)
+	deadline.cancelCh = r.Context().Done()
+	deadline.canceled = new(uint32)
+	return deadline
 }
 
 // GetBool returns boolean value from the given argKey query arg.
@@ -158,6 +178,13 @@ type Deadline struct {
 
 	timeout  time.Duration
 	flagHint string
+
+	// cancelCh is closed when the client closes the connection.
+	cancelCh <-chan struct{}
+
+	// canceled is set to 1 when the cancellation is detected.
+	// It is shared among copies of the Deadline.
+	canceled *uint32
 }
 
 // NewDeadline returns deadline for the given timeout.
@@ -172,11 +199,33 @@ func NewDeadline(startTime time.Time, timeout time.Duration, flagHint string) De
 	}
 }
 
-// Exceeded returns true if deadline is exceeded.
+// Exceeded returns true if deadline is exceeded or if the request is canceled by client.
 func (d *Deadline) Exceeded() bool {
-	return fasttime.UnixTimestamp() > d.deadline
+	return fasttime.UnixTimestamp() > d.deadline || d.Canceled()
+}
+
+// Canceled returns true if the request is canceled by client.
+func (d *Deadline) Canceled() bool {
+	select {
+	case <-d.cancelCh:
+		if atomic.CompareAndSwapUint32(d.canceled, 0, 1) {
+			canceledRequests.Inc()
+		}
+		return true
+	default:
+		return false
+	}
 }
 
+// CancelCh returns a channel, which is closed when the request is canceled by client.
+//
+// It returns nil channel if the request cannot be canceled.
+func (d *Deadline) CancelCh() <-chan struct{} {
+	return d.cancelCh
+}
+
+var canceledRequests = metrics.NewCounter(`vm_search_canceled_total{layer="vmselect"}`)
+
 // Deadline returns deadline in unix timestamp seconds.
 func (d *Deadline) Deadline() uint64 {
 	return d.deadline
@@ -186,5 +235,8 @@ func (d *Deadline) Deadline() uint64 {
 func (d *Deadline) String() string {
 	startTime := time.Unix(int64(d.deadline), 0).Add(-d.timeout)
 	elapsed := time.Since(startTime)
+	if d.Canceled() {
+		return fmt.Sprintf("the request has been canceled by client after %.3f seconds", elapsed.Seconds())
+	}
 	return fmt.Sprintf("%.3f seconds (elapsed %.3f seconds); the timeout can be adjusted with `%s` command-line flag", d.timeout.Seconds(), elapsed.Seconds(), d.flagHint)
 }
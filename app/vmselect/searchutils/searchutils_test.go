@@ -1,10 +1,13 @@
 package searchutils
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestGetTimeSuccess(t *testing.T) {
@@ -76,3 +79,42 @@ func TestGetTimeError(t *testing.T) {
 	f("-292273086-05-16T16:47:07Z")
 	f("292277025-08-18T07:12:54.999999998Z")
 }
+
+func TestDeadlineCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r, err := http.NewRequestWithContext(ctx, "GET", "http://foo.bar/baz", nil)
+	if err != nil {
+		t.Fatalf("unexpected error in NewRequest: %s", err)
+	}
+	deadline := GetDeadlineForQuery(r, time.Now())
+	if deadline.Exceeded() {
+		t.Fatalf("deadline mustn't be exceeded before the request is canceled")
+	}
+	if deadline.Canceled() {
+		t.Fatalf("deadline mustn't be canceled before the request is canceled")
+	}
+
+	// Copies of the deadline must detect the cancellation too.
+	deadlineCopy := deadline
+	cancel()
+	if !deadline.Exceeded() || !deadlineCopy.Exceeded() {
+		t.Fatalf("deadline must be exceeded after the request is canceled")
+	}
+	if !deadline.Canceled() || !deadlineCopy.Canceled() {
+		t.Fatalf("deadline must be canceled after the request is canceled")
+	}
+	select {
+	case <-deadline.CancelCh():
+	default:
+		t.Fatalf("CancelCh must be closed after the request is canceled")
+	}
+	if s := deadline.String(); !strings.Contains(s, "canceled by client") {
+		t.Fatalf("unexpected string representation for canceled deadline: %q", s)
+	}
+
+	// Deadline without request cannot be canceled.
+	d := NewDeadline(time.Now(), time.Second, "-foo")
+	if d.Canceled() || d.CancelCh() != nil {
+		t.Fatalf("deadline without request mustn't be canceled")
+	}
+}
@@ -0,0 +1,630 @@
+package vmstorage
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/actions"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/common"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/fscommon"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/fslocal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	coldStorageRemotePath = flag.String("coldStorage.remotePath", "", "Optional path to object storage for offloading per-month partitions older than -coldStorage.offloadAfter. "+
+		"For example, s3://bucket/path/to/cold/storage or gs://bucket/path/to/cold/storage . Offloaded partitions are downloaded back on demand "+
+		"when queries touch them. See https://victoriametrics.github.io/#cold-storage")
+	coldStorageOffloadAfter = flagutil.NewDuration("coldStorage.offloadAfter", 3, "Per-month partitions with all the samples older than this duration "+
+		"are offloaded to -coldStorage.remotePath")
+	coldStorageCacheSize = flagutil.NewBytes("coldStorage.cacheSize", 10*1024*1024*1024, "The maximum size of partitions downloaded from -coldStorage.remotePath, "+
+		"which are kept locally for serving queries. The least recently queried partitions are offloaded back when the limit is exceeded")
+	coldStorageConcurrency = flag.Int("coldStorage.concurrency", 10, "The number of concurrent workers for uploading and downloading partitions "+
+		"to and from -coldStorage.remotePath")
+)
+
+// coldStorageMarkerFilename is the name of file, which is created in the directory for detached partition after the partition is offloaded.
+//
+// The file contains the path to the remote storage with the partition data.
+const coldStorageMarkerFilename = "cold_storage.ignore"
+
+const coldStorageCheckInterval = 10 * time.Minute
+
+// coldStorageMinCacheDuration is the minimum duration for keeping the fetched partition locally.
+//
+// This prevents from offloading the partition back right after it has been fetched for the query.
+const coldStorageMinCacheDuration = coldStorageCheckInterval
+
+// coldStorage offloads old partitions to -coldStorage.remotePath and fetches them back when they are queried.
+type coldStorage struct {
+	remotePath   string
+	detachedPath string
+
+	// mu protects pts and pins.
+	mu sync.Mutex
+
+	// pts contains partitions stored at remotePath by name.
+	pts map[string]*coldPartition
+
+	// pins contains time ranges for the currently executed queries.
+	//
+	// Partitions overlapping these time ranges mustn't be offloaded.
+	pins map[*storage.TimeRange]struct{}
+
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// coldPartition is a partition stored at -coldStorage.remotePath.
+type coldPartition struct {
+	name string
+	tr   storage.TimeRange
+
+	// local is set to true when the partition is downloaded from the remote storage and is attached to Storage.
+	local bool
+
+	// lastAccessTime is the last time in unix seconds when the partition has been queried.
+	lastAccessTime uint64
+
+	// fetchTime is the last time in unix seconds when the partition has been fetched from the remote storage.
+	fetchTime uint64
+
+	// pendingCh is non-nil while the partition is being offloaded or fetched. It is closed when the operation is finished.
+	pendingCh chan struct{}
+}
+
+var cs *coldStorage
+
+func startColdStorage() {
+	if len(*coldStorageRemotePath) == 0 {
+		cs = nil
+		return
+	}
+	cs = &coldStorage{
+		remotePath:   *coldStorageRemotePath,
+		detachedPath: Storage.DetachedPartitionsPath(),
+		pts:          make(map[string]*coldPartition),
+		pins:         make(map[*storage.TimeRange]struct{}),
+		stopCh:       make(chan struct{}),
+	}
+	if err := cs.loadOffloadedPartitions(); err != nil {
+		logger.Fatalf("cannot load partitions offloaded to -coldStorage.remotePath=%q: %s", cs.remotePath, err)
+	}
+	cs.wg.Add(1)
+	go func() {
+		defer cs.wg.Done()
+		cs.runOffloader()
+	}()
+	logger.Infof("started offloading partitions older than -coldStorage.offloadAfter=%s to -coldStorage.remotePath=%q; %d partitions are already offloaded",
+		coldStorageOffloadAfter, cs.remotePath, len(cs.pts))
+}
+
+func stopColdStorage() {
+	if cs == nil {
+		return
+	}
+	close(cs.stopCh)
+	cs.wg.Wait()
+}
+
+// loadOffloadedPartitions loads offloaded partitions from the directory with detached partitions.
+func (cs *coldStorage) loadOffloadedPartitions() error {
+	d, err := os.Open(cs.detachedPath)
+	if err != nil {
+		return fmt.Errorf("cannot open directory with detached partitions: %w", err)
+	}
+	defer fs.MustClose(d)
+	fis, err := d.Readdir(-1)
+	if err != nil {
+		return fmt.Errorf("cannot read directory with detached partitions %q: %w", cs.detachedPath, err)
+	}
+	for _, fi := range fis {
+		if !fs.IsDirOrSymlink(fi) {
+			continue
+		}
+		name := fi.Name()
+		ptPath := cs.detachedPath + "/" + name
+		if !fs.IsPathExist(ptPath + "/" + coldStorageMarkerFilename) {
+			// The partition has been detached manually.
+			continue
+		}
+		tr, err := partitionTimeRange(name)
+		if err != nil {
+			return err
+		}
+		// Remove leftovers from the interrupted offloading.
+		fs.MustRemoveAll(ptPath + "/small")
+		fs.MustRemoveAll(ptPath + "/big")
+		cs.pts[name] = &coldPartition{
+			name: name,
+			tr:   tr,
+		}
+	}
+	return nil
+}
+
+func (cs *coldStorage) runOffloader() {
+	t := time.NewTicker(coldStorageCheckInterval)
+	defer t.Stop()
+	for {
+		cs.offloadPartitions()
+		select {
+		case <-cs.stopCh:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// offloadPartitions offloads partitions older than -coldStorage.offloadAfter to the remote storage.
+//
+// It also offloads back the least recently queried partitions if their summary size exceeds -coldStorage.cacheSize
+// and deletes partitions outside -retentionPeriod from the remote storage.
+func (cs *coldStorage) offloadPartitions() {
+	WG.Add(1)
+	defer WG.Done()
+
+	now := int64(fasttime.UnixTimestamp() * 1000)
+	minAllowedTimestamp := now - retentionPeriod.Msecs
+	cs.deleteExpiredPartitions(minAllowedTimestamp)
+
+	pis, err := Storage.ListPartitions()
+	if err != nil {
+		logger.Errorf("cannot list partitions for offloading to -coldStorage.remotePath: %s", err)
+		return
+	}
+	offloadDeadline := now - coldStorageOffloadAfter.Msecs
+	var cached []*coldPartition
+	cachedSizes := make(map[string]uint64)
+	cachedSizeBytes := uint64(0)
+	for i := range pis {
+		pi := &pis[i]
+		if pi.Detached {
+			continue
+		}
+		tr, err := partitionTimeRange(pi.Name)
+		if err != nil {
+			logger.Errorf("cannot offload partition to -coldStorage.remotePath: %s", err)
+			continue
+		}
+		if tr.MaxTimestamp >= offloadDeadline || tr.MaxTimestamp < minAllowedTimestamp {
+			// Skip partitions outside -retentionPeriod, since they are dropped by Storage.
+			continue
+		}
+		cs.mu.Lock()
+		cp := cs.pts[pi.Name]
+		cs.mu.Unlock()
+		if cp != nil {
+			sizeBytes := pi.SmallSizeBytes + pi.BigSizeBytes
+			cached = append(cached, cp)
+			cachedSizes[cp.name] = sizeBytes
+			cachedSizeBytes += sizeBytes
+			continue
+		}
+		cs.offloadPartition(pi.Name, tr)
+		select {
+		case <-cs.stopCh:
+			return
+		default:
+		}
+	}
+
+	if cachedSizeBytes <= uint64(coldStorageCacheSize.N) {
+		return
+	}
+	minFetchTime := fasttime.UnixTimestamp() - uint64(coldStorageMinCacheDuration.Seconds())
+	cs.mu.Lock()
+	sort.Slice(cached, func(i, j int) bool {
+		return cached[i].lastAccessTime < cached[j].lastAccessTime
+	})
+	fetchTimes := make(map[string]uint64, len(cached))
+	for _, cp := range cached {
+		fetchTimes[cp.name] = cp.fetchTime
+	}
+	cs.mu.Unlock()
+	for _, cp := range cached {
+		if cachedSizeBytes <= uint64(coldStorageCacheSize.N) {
+			return
+		}
+		if fetchTimes[cp.name] > minFetchTime {
+			// Do not offload recently fetched partition, since it is likely to be queried again soon.
+			continue
+		}
+		if cs.offloadPartition(cp.name, cp.tr) {
+			cachedSizeBytes -= cachedSizes[cp.name]
+		}
+	}
+}
+
+// offloadPartition offloads partition with the given name and the given tr to the remote storage.
+//
+// It returns true if the partition has been successfully offloaded.
+func (cs *coldStorage) offloadPartition(name string, tr storage.TimeRange) bool {
+	cs.mu.Lock()
+	cp := cs.pts[name]
+	isNew := cp == nil
+	if isNew {
+		cp = &coldPartition{
+			name:  name,
+			tr:    tr,
+			local: true,
+		}
+		cs.pts[name] = cp
+	}
+	if cp.pendingCh != nil || !cp.local || cs.isPinnedLocked(&tr) {
+		if isNew {
+			delete(cs.pts, name)
+		}
+		cs.mu.Unlock()
+		return false
+	}
+	pendingCh := make(chan struct{})
+	cp.pendingCh = pendingCh
+	cs.mu.Unlock()
+
+	logger.Infof("offloading partition %q to -coldStorage.remotePath=%q", name, cs.remotePath)
+	startTime := time.Now()
+	err := cs.offload(name)
+	if err != nil {
+		coldStorageOffloadErrors.Inc()
+		logger.Errorf("cannot offload partition %q to -coldStorage.remotePath=%q: %s", name, cs.remotePath, err)
+	} else {
+		coldStorageOffloads.Inc()
+		logger.Infof("partition %q has been offloaded to -coldStorage.remotePath=%q in %.3f seconds", name, cs.remotePath, time.Since(startTime).Seconds())
+	}
+
+	cs.mu.Lock()
+	cp.local = err != nil
+	cp.pendingCh = nil
+	close(pendingCh)
+	if err != nil && isNew {
+		// The partition isn't stored at the remote storage, so it will be offloaded during the next check.
+		delete(cs.pts, name)
+	}
+	cs.mu.Unlock()
+	return err == nil
+}
+
+func (cs *coldStorage) offload(name string) error {
+	if err := Storage.DetachPartition(name); err != nil {
+		return err
+	}
+	ptPath := cs.detachedPath + "/" + name
+	if err := cs.upload(name, ptPath); err != nil {
+		// Attach the partition back, so it remains available for queries.
+		if errAttach := Storage.AttachPartition(name); errAttach != nil {
+			logger.Errorf("cannot attach partition %q back after unsuccessful offloading: %s", name, errAttach)
+		}
+		return err
+	}
+	if err := writeColdStorageMarker(ptPath, cs.remotePath); err != nil {
+		return err
+	}
+	fs.MustRemoveAll(ptPath + "/small")
+	fs.MustRemoveAll(ptPath + "/big")
+	return nil
+}
+
+func (cs *coldStorage) upload(name, ptPath string) error {
+	src := &fslocal.FS{
+		Dir: ptPath,
+	}
+	if err := src.Init(); err != nil {
+		return fmt.Errorf("cannot initialize local fs: %w", err)
+	}
+	defer src.MustStop()
+	dst, err := cs.newRemoteFS(name)
+	if err != nil {
+		return err
+	}
+	defer dst.MustStop()
+	b := &actions.Backup{
+		Concurrency: *coldStorageConcurrency,
+		Src:         src,
+		Dst:         dst,
+	}
+	return b.Run()
+}
+
+func (cs *coldStorage) download(name, ptPath string) error {
+	src, err := cs.newRemoteFS(name)
+	if err != nil {
+		return err
+	}
+	defer src.MustStop()
+	dst := &fslocal.FS{
+		Dir: ptPath,
+	}
+	if err := dst.Init(); err != nil {
+		return fmt.Errorf("cannot initialize local fs: %w", err)
+	}
+	defer dst.MustStop()
+	r := &actions.Restore{
+		Concurrency: *coldStorageConcurrency,
+		Src:         src,
+		Dst:         dst,
+	}
+	return r.Run()
+}
+
+func (cs *coldStorage) newRemoteFS(name string) (common.RemoteFS, error) {
+	path := cs.remotePath + "/" + name
+	rfs, err := actions.NewRemoteFS(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot initialize remote fs at %q: %w", path, err)
+	}
+	return rfs, nil
+}
+
+// deleteExpiredPartitions deletes partitions with all the samples older than minAllowedTimestamp from the remote storage.
+func (cs *coldStorage) deleteExpiredPartitions(minAllowedTimestamp int64) {
+	var expired []*coldPartition
+	cs.mu.Lock()
+	for _, cp := range cs.pts {
+		if cp.tr.MaxTimestamp >= minAllowedTimestamp || cp.pendingCh != nil {
+			continue
+		}
+		cp.pendingCh = make(chan struct{})
+		expired = append(expired, cp)
+	}
+	cs.mu.Unlock()
+
+	for _, cp := range expired {
+		logger.Infof("deleting partition %q outside -retentionPeriod=%s from -coldStorage.remotePath=%q", cp.name, retentionPeriod, cs.remotePath)
+		err := cs.deleteRemote(cp.name)
+		if err != nil {
+			coldStorageDeleteErrors.Inc()
+			logger.Errorf("cannot delete partition %q from -coldStorage.remotePath=%q: %s", cp.name, cs.remotePath, err)
+		} else {
+			coldStorageDeletes.Inc()
+			if !cp.local {
+				// Remove the directory with the marker file for the offloaded partition.
+				fs.MustRemoveAll(cs.detachedPath + "/" + cp.name)
+			}
+		}
+
+		cs.mu.Lock()
+		if err == nil {
+			delete(cs.pts, cp.name)
+		}
+		close(cp.pendingCh)
+		cp.pendingCh = nil
+		cs.mu.Unlock()
+	}
+}
+
+func (cs *coldStorage) deleteRemote(name string) error {
+	rfs, err := cs.newRemoteFS(name)
+	if err != nil {
+		return err
+	}
+	defer rfs.MustStop()
+	parts, err := rfs.ListParts()
+	if err != nil {
+		return fmt.Errorf("cannot list parts at %s: %w", rfs, err)
+	}
+	for _, p := range parts {
+		if err := rfs.DeletePart(p); err != nil {
+			return fmt.Errorf("cannot delete %s from %s: %w", &p, rfs, err)
+		}
+	}
+	for _, filename := range []string{fscommon.BackupCompleteFilename, fscommon.BackupManifestFilename} {
+		if err := rfs.DeleteFile(filename); err != nil {
+			return fmt.Errorf("cannot delete %q from %s: %w", filename, rfs, err)
+		}
+	}
+	if err := rfs.RemoveEmptyDirs(); err != nil {
+		return fmt.Errorf("cannot remove empty directories at %s: %w", rfs, err)
+	}
+	return nil
+}
+
+// fetchPartitions makes sure all the offloaded partitions on the given tr are available for querying.
+//
+// Partitions are downloaded from the remote storage if needed. Partitions on the given tr aren't offloaded
+// until the returned release func is called.
+func (cs *coldStorage) fetchPartitions(tr storage.TimeRange) (func(), error) {
+	minAllowedTimestamp := int64(fasttime.UnixTimestamp()*1000) - retentionPeriod.Msecs
+	pin := &tr
+	var names []string
+	cs.mu.Lock()
+	cs.pins[pin] = struct{}{}
+	for name, cp := range cs.pts {
+		if cp.tr.MaxTimestamp < minAllowedTimestamp || !timeRangesOverlap(&cp.tr, &tr) {
+			continue
+		}
+		names = append(names, name)
+	}
+	cs.mu.Unlock()
+	release := func() {
+		cs.mu.Lock()
+		delete(cs.pins, pin)
+		cs.mu.Unlock()
+	}
+	if len(names) == 0 {
+		return release, nil
+	}
+	coldStorageQueries.Inc()
+	sort.Strings(names)
+	for _, name := range names {
+		if err := cs.fetchPartition(name); err != nil {
+			release()
+			return nil, fmt.Errorf("cannot fetch partition %q from -coldStorage.remotePath=%q: %w", name, cs.remotePath, err)
+		}
+	}
+	return release, nil
+}
+
+// isPinnedLocked returns true if tr overlaps time ranges for the currently executed queries.
+//
+// cs.mu must be locked when calling this function.
+func (cs *coldStorage) isPinnedLocked(tr *storage.TimeRange) bool {
+	for pin := range cs.pins {
+		if timeRangesOverlap(pin, tr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (cs *coldStorage) fetchPartition(name string) error {
+	for {
+		cs.mu.Lock()
+		cp := cs.pts[name]
+		if cp == nil {
+			// The partition has been removed after unsuccessful offloading, so it is available locally.
+			cs.mu.Unlock()
+			return nil
+		}
+		if cp.pendingCh != nil {
+			// Wait until the pending operation on the partition is finished.
+			pendingCh := cp.pendingCh
+			cs.mu.Unlock()
+			<-pendingCh
+			continue
+		}
+		cp.lastAccessTime = fasttime.UnixTimestamp()
+		if cp.local {
+			cs.mu.Unlock()
+			return nil
+		}
+		pendingCh := make(chan struct{})
+		cp.pendingCh = pendingCh
+		cs.mu.Unlock()
+
+		logger.Infof("fetching partition %q from -coldStorage.remotePath=%q", name, cs.remotePath)
+		startTime := time.Now()
+		err := cs.fetch(name)
+		if err != nil {
+			coldStorageFetchErrors.Inc()
+		} else {
+			coldStorageFetches.Inc()
+			coldStorageFetchDuration.UpdateDuration(startTime)
+			logger.Infof("partition %q has been fetched from -coldStorage.remotePath=%q in %.3f seconds", name, cs.remotePath, time.Since(startTime).Seconds())
+		}
+
+		cs.mu.Lock()
+		cp.local = err == nil
+		if err == nil {
+			cp.fetchTime = fasttime.UnixTimestamp()
+		}
+		cp.pendingCh = nil
+		close(pendingCh)
+		cs.mu.Unlock()
+		return err
+	}
+}
+
+func (cs *coldStorage) fetch(name string) error {
+	ptPath := cs.detachedPath + "/" + name
+	if err := cs.download(name, ptPath); err != nil {
+		// The marker file may be deleted during the download, since it is missing in the remote storage. Restore it.
+		if errMarker := writeColdStorageMarker(ptPath, cs.remotePath); errMarker != nil {
+			logger.Errorf("cannot restore cold storage marker for partition %q: %s", name, errMarker)
+		}
+		return err
+	}
+	if err := Storage.AttachPartition(name); err != nil {
+		if errMarker := writeColdStorageMarker(ptPath, cs.remotePath); errMarker != nil {
+			logger.Errorf("cannot restore cold storage marker for partition %q: %s", name, errMarker)
+		}
+		return err
+	}
+	return nil
+}
+
+// isColdTimeRange returns true if tr overlaps partitions stored at the remote storage.
+func (cs *coldStorage) isColdTimeRange(tr storage.TimeRange) bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	for _, cp := range cs.pts {
+		if timeRangesOverlap(&cp.tr, &tr) {
+			return true
+		}
+	}
+	return false
+}
+
+func (cs *coldStorage) partitionsCount(local bool) int {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	n := 0
+	for _, cp := range cs.pts {
+		if cp.local == local {
+			n++
+		}
+	}
+	return n
+}
+
+func writeColdStorageMarker(ptPath, remotePath string) error {
+	path := ptPath + "/" + coldStorageMarkerFilename
+	if fs.IsPathExist(path) {
+		return nil
+	}
+	if err := fs.MkdirAllIfNotExist(ptPath); err != nil {
+		return err
+	}
+	return fs.WriteFileAtomically(path, []byte(remotePath))
+}
+
+// partitionTimeRange returns time range for the partition with the given name in the form YYYY_MM.
+func partitionTimeRange(name string) (storage.TimeRange, error) {
+	t, err := time.Parse("2006_01", name)
+	if err != nil {
+		return storage.TimeRange{}, fmt.Errorf("cannot parse partition name %q: %w", name, err)
+	}
+	return storage.TimeRange{
+		MinTimestamp: t.UnixNano() / 1e6,
+		MaxTimestamp: t.AddDate(0, 1, 0).UnixNano()/1e6 - 1,
+	}, nil
+}
+
+func timeRangesOverlap(a, b *storage.TimeRange) bool {
+	return a.MinTimestamp <= b.MaxTimestamp && b.MinTimestamp <= a.MaxTimestamp
+}
+
+// IsColdTimeRange returns true if tr overlaps partitions offloaded to -coldStorage.remotePath.
+//
+// Queries over such time ranges may have higher latency, since the partitions may need to be downloaded from the remote storage.
+func IsColdTimeRange(tr storage.TimeRange) bool {
+	if cs == nil {
+		return false
+	}
+	return cs.isColdTimeRange(tr)
+}
+
+var (
+	coldStorageOffloads      = metrics.NewCounter(`vm_cold_storage_offloads_total`)
+	coldStorageOffloadErrors = metrics.NewCounter(`vm_cold_storage_offload_errors_total`)
+	coldStorageFetches       = metrics.NewCounter(`vm_cold_storage_fetches_total`)
+	coldStorageFetchErrors   = metrics.NewCounter(`vm_cold_storage_fetch_errors_total`)
+	coldStorageFetchDuration = metrics.NewSummary(`vm_cold_storage_fetch_duration_seconds`)
+	coldStorageQueries       = metrics.NewCounter(`vm_cold_storage_queries_total`)
+	coldStorageDeletes       = metrics.NewCounter(`vm_cold_storage_deletes_total`)
+	coldStorageDeleteErrors  = metrics.NewCounter(`vm_cold_storage_delete_errors_total`)
+)
+
+var (
+	_ = metrics.NewGauge(`vm_cold_storage_partitions{state="remote"}`, func() float64 {
+		if cs == nil {
+			return 0
+		}
+		return float64(cs.partitionsCount(false))
+	})
+	_ = metrics.NewGauge(`vm_cold_storage_partitions{state="local"}`, func() float64 {
+		if cs == nil {
+			return 0
+		}
+		return float64(cs.partitionsCount(true))
+	})
+)
@@ -0,0 +1,129 @@
+package vmstorage
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storage"
+)
+
+func TestColdStorageFetchPartitionsPin(t *testing.T) {
+	cs := newTestColdStorage(t)
+	defer fs.MustRemoveAll(cs.detachedPath)
+
+	trPartition := mustPartitionTimeRange(t, "2020_01")
+	release, err := cs.fetchPartitions(storage.TimeRange{
+		MinTimestamp: trPartition.MinTimestamp + 1000,
+		MaxTimestamp: trPartition.MaxTimestamp + 1000,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// Partitions on the queried time range mustn't be offloaded until the query is finished.
+	if cs.offloadPartition("2020_01", trPartition) {
+		t.Fatalf("the pinned partition mustn't be offloaded")
+	}
+	if len(cs.pts) != 0 {
+		t.Fatalf("unexpected partitions registered after unsuccessful offloading: %d", len(cs.pts))
+	}
+	cs.mu.Lock()
+	if !cs.isPinnedLocked(&trPartition) {
+		t.Fatalf("expecting the partition to be pinned")
+	}
+	trOther := mustPartitionTimeRange(t, "2020_03")
+	if cs.isPinnedLocked(&trOther) {
+		t.Fatalf("unexpected pin for the partition outside the queried time range")
+	}
+	cs.mu.Unlock()
+
+	release()
+	cs.mu.Lock()
+	if cs.isPinnedLocked(&trPartition) {
+		t.Fatalf("the partition must be unpinned after release")
+	}
+	cs.mu.Unlock()
+}
+
+func TestColdStorageDeleteExpiredPartitions(t *testing.T) {
+	cs := newTestColdStorage(t)
+	defer fs.MustRemoveAll(cs.detachedPath)
+	remoteDir := cs.remotePath[len("fs://"):]
+	defer fs.MustRemoveAll(remoteDir)
+
+	f := func(name string, local bool) {
+		t.Helper()
+		ptPath := cs.detachedPath + "/" + name
+		if err := writeColdStorageMarker(ptPath, cs.remotePath); err != nil {
+			t.Fatalf("cannot write marker: %s", err)
+		}
+		remotePartPath := remoteDir + "/" + name + "/small/foo/data.bin"
+		if err := fs.MkdirAllIfNotExist(remotePartPath); err != nil {
+			t.Fatalf("cannot create remote dir: %s", err)
+		}
+		if err := ioutil.WriteFile(remotePartPath+"/0000000000000004_0000000000000000_0000000000000004", []byte("data"), 0600); err != nil {
+			t.Fatalf("cannot write remote part: %s", err)
+		}
+		if err := ioutil.WriteFile(remoteDir+"/"+name+"/backup_complete.ignore", []byte("ok"), 0600); err != nil {
+			t.Fatalf("cannot write remote file: %s", err)
+		}
+		cs.pts[name] = &coldPartition{
+			name:  name,
+			tr:    mustPartitionTimeRange(t, name),
+			local: local,
+		}
+	}
+	f("2019_12", false)
+	f("2020_01", true)
+	f("2020_02", false)
+
+	trRetention := mustPartitionTimeRange(t, "2020_02")
+	cs.deleteExpiredPartitions(trRetention.MinTimestamp)
+
+	for _, name := range []string{"2019_12", "2020_01"} {
+		if cs.pts[name] != nil {
+			t.Fatalf("partition %q outside retention must be removed", name)
+		}
+		if fs.IsPathExist(remoteDir + "/" + name) {
+			t.Fatalf("remote data for partition %q outside retention must be deleted", name)
+		}
+	}
+	if fs.IsPathExist(cs.detachedPath + "/2019_12") {
+		t.Fatalf("local dir for the offloaded partition outside retention must be deleted")
+	}
+	if cs.pts["2020_02"] == nil {
+		t.Fatalf("partition inside retention mustn't be removed")
+	}
+	if !fs.IsPathExist(remoteDir + "/2020_02/small/foo/data.bin/0000000000000004_0000000000000000_0000000000000004") {
+		t.Fatalf("remote data for partition inside retention mustn't be deleted")
+	}
+}
+
+func newTestColdStorage(t *testing.T) *coldStorage {
+	t.Helper()
+	detachedPath, err := ioutil.TempDir("", "cold-storage-detached")
+	if err != nil {
+		t.Fatalf("cannot create temporary dir: %s", err)
+	}
+	remotePath, err := ioutil.TempDir("", "cold-storage-remote")
+	if err != nil {
+		t.Fatalf("cannot create temporary dir: %s", err)
+	}
+	return &coldStorage{
+		remotePath:   "fs://" + remotePath,
+		detachedPath: detachedPath,
+		pts:          make(map[string]*coldPartition),
+		pins:         make(map[*storage.TimeRange]struct{}),
+		stopCh:       make(chan struct{}),
+	}
+}
+
+func mustPartitionTimeRange(t *testing.T, name string) storage.TimeRange {
+	t.Helper()
+	tr, err := partitionTimeRange(name)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return tr
+}
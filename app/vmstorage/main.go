@@ -8,6 +8,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/configcheck"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
@@ -24,6 +25,8 @@ var (
 	snapshotAuthKey   = flag.String("snapshotAuthKey", "", "authKey, which must be passed in query string to /snapshot* pages")
 	forceMergeAuthKey = flag.String("forceMergeAuthKey", "", "authKey, which must be passed in query string to /internal/force_merge pages")
 	forceFlushAuthKey = flag.String("forceFlushAuthKey", "", "authKey, which must be passed in query string to /internal/force_flush pages")
+	partitionsAuthKey = flag.String("partitionsAuthKey", "", "authKey, which must be passed in query string to /internal/partitions* pages")
+	indexdbAuthKey    = flag.String("indexdbAuthKey", "", "authKey, which must be passed in query string to /internal/indexdb/export and /internal/indexdb/import pages")
 
 	precisionBits = flag.Int("precisionBits", 64, "The number of precision bits to store per each value. Lower precision bits improves data compression at the cost of precision loss")
 
@@ -33,27 +36,87 @@ var (
 	finalMergeDelay = flag.Duration("finalMergeDelay", 0, "The delay before starting final merge for per-month partition after no new data is ingested into it. "+
 		"Final merge may require additional disk IO and CPU resources. Final merge may increase query speed and reduce disk space usage in some cases. "+
 		"Zero value disables final merge")
+	fsyncPolicy = flag.String("fsyncPolicy", "interval", "Policy for flushing recently ingested samples to persistent storage. Supported values: "+
+		"interval - flush samples every -fsyncInterval, so samples ingested during the last -fsyncInterval may be lost on power loss or unclean shutdown; "+
+		"always - flush samples before responding to the ingestion request. This provides the strongest durability guarantees at the cost of much higher disk IO and lower ingestion performance; "+
+		"never - flush samples only when they are merged with other data or on graceful shutdown. This reduces disk IO, but samples ingested since the last merge may be lost. "+
+		"See https://victoriametrics.github.io/#durability")
+	fsyncInterval = flag.Duration("fsyncInterval", 5*time.Second, "The interval for flushing recently ingested samples to persistent storage when -fsyncPolicy=interval. "+
+		"The interval is rounded to seconds")
 	bigMergeConcurrency   = flag.Int("bigMergeConcurrency", 0, "The maximum number of CPU cores to use for big merges. Default value is used if set to 0")
 	smallMergeConcurrency = flag.Int("smallMergeConcurrency", 0, "The maximum number of CPU cores to use for small merges. Default value is used if set to 0")
+	mergeBandwidthLimit   = flagutil.NewBytes("mergeBandwidthLimit", 0, "The maximum disk bandwidth in bytes per second for background merges of data parts. "+
+		"This may be useful for reducing the impact of merges on query latency on disks with limited IO. Merges for recently ingested in-memory data and indexdb merges aren't limited. "+
+		"There is no limit by default. The flag may be changed at runtime via /-/flags page")
+	bigMergeWindows = flagutil.NewArray("bigMergeWindow", "Optional daily time windows in UTC when big merges are allowed, in the format 'HH:MM-HH:MM'. "+
+		"For example, '-bigMergeWindow=22:00-06:00' allows big merges only at night. By default big merges are allowed at any time. "+
+		"Note that big merges started inside the window aren't interrupted when the window ends. The window doesn't apply to forced merges and indexdb merges")
+
+	minFreeDiskSpaceBytes = flagutil.NewBytes("storage.minFreeDiskSpaceBytes", 10e6, "The minimum free disk space at -storageDataPath after which the storage stops accepting new data "+
+		"and switches to read-only mode. Data ingestion requests are rejected with '507 Insufficient Storage' status code in read-only mode. "+
+		"The storage automatically switches back to read-write mode when enough free disk space becomes available. Zero value disables the limit")
+
+	exemplarsMaxCount = flag.Int("exemplars.maxCount", 0, "The maximum number of exemplars to keep in memory. Exemplars are received via Prometheus remote write protocol "+
+		"and via Prometheus exposition format if -promscrape.scrapeExemplars is set. The oldest exemplars are dropped when the limit is reached. "+
+		"Exemplars are lost on restart. Exemplars can be queried via /api/v1/query_exemplars. Zero value disables exemplars storage")
 
 	denyQueriesOutsideRetention = flag.Bool("denyQueriesOutsideRetention", false, "Whether to deny queries outside of the configured -retentionPeriod. "+
 		"When set, then /api/v1/query_range would return '503 Service Unavailable' error for queries with 'from' value outside -retentionPeriod. "+
 		"This may be useful when multiple data sources with distinct retentions are hidden behind query-tee")
 )
 
-// CheckTimeRange returns true if the given tr is denied for querying.
-func CheckTimeRange(tr storage.TimeRange) error {
-	if !*denyQueriesOutsideRetention {
-		return nil
+// CheckTimeRange returns non-nil error if the given tr is denied for querying.
+//
+// It also fetches partitions offloaded to -coldStorage.remotePath on the given tr if needed.
+// The returned release func must be called when the query is finished, so the fetched partitions could be offloaded back.
+func CheckTimeRange(tr storage.TimeRange) (func(), error) {
+	if *denyQueriesOutsideRetention {
+		minAllowedTimestamp := int64(fasttime.UnixTimestamp()*1000) - retentionPeriod.Msecs
+		if tr.MinTimestamp <= minAllowedTimestamp {
+			return nil, &httpserver.ErrorWithStatusCode{
+				Err:        fmt.Errorf("the given time range %s is outside the allowed -retentionPeriod=%s according to -denyQueriesOutsideRetention", &tr, retentionPeriod),
+				StatusCode: http.StatusServiceUnavailable,
+			}
+		}
 	}
-	minAllowedTimestamp := int64(fasttime.UnixTimestamp()*1000) - retentionPeriod.Msecs
-	if tr.MinTimestamp > minAllowedTimestamp {
-		return nil
+	if cs != nil {
+		// Make sure the partitions offloaded to -coldStorage.remotePath are available for the query.
+		return cs.fetchPartitions(tr)
 	}
-	return &httpserver.ErrorWithStatusCode{
-		Err:        fmt.Errorf("the given time range %s is outside the allowed -retentionPeriod=%s according to -denyQueriesOutsideRetention", &tr, retentionPeriod),
-		StatusCode: http.StatusServiceUnavailable,
+	return noopRelease, nil
+}
+
+func noopRelease() {}
+
+func init() {
+	flagutil.RegisterHotFlag("mergeBandwidthLimit", checkMergeBandwidthLimit, func() {
+		storage.SetMergeBandwidthLimit(int64(mergeBandwidthLimit.N))
+	})
+}
+
+// CheckFlags checks vmstorage command-line flags without opening the storage.
+//
+// The found errors are added to r.
+func CheckFlags(r *configcheck.Report) {
+	if err := encoding.CheckPrecisionBits(uint8(*precisionBits)); err != nil {
+		r.AddError("-precisionBits", err)
+	}
+	if err := storage.CheckFsyncPolicy(*fsyncPolicy, *fsyncInterval); err != nil {
+		r.AddError("-fsyncPolicy", err)
+	}
+	if err := storage.CheckBigMergeWindows(*bigMergeWindows); err != nil {
+		r.AddError("-bigMergeWindow", err)
+	}
+	if err := checkMergeBandwidthLimit(); err != nil {
+		r.AddError("-mergeBandwidthLimit", err)
+	}
+}
+
+func checkMergeBandwidthLimit() error {
+	if mergeBandwidthLimit.N < 0 {
+		return fmt.Errorf("the value cannot be negative; got %d", mergeBandwidthLimit.N)
 	}
+	return nil
 }
 
 // Init initializes vmstorage.
@@ -72,8 +135,15 @@ func InitWithoutMetrics(resetCacheIfNeeded func(mrs []storage.MetricRow)) {
 
 	resetResponseCacheIfNeeded = resetCacheIfNeeded
 	storage.SetFinalMergeDelay(*finalMergeDelay)
+	if err := storage.SetFsyncPolicy(*fsyncPolicy, *fsyncInterval); err != nil {
+		logger.Fatalf("invalid -fsyncPolicy: %s", err)
+	}
 	storage.SetBigMergeWorkersCount(*bigMergeConcurrency)
 	storage.SetSmallMergeWorkersCount(*smallMergeConcurrency)
+	storage.SetFreeDiskSpaceLimit(int64(minFreeDiskSpaceBytes.N))
+	if err := storage.SetBigMergeWindows(*bigMergeWindows); err != nil {
+		logger.Fatalf("invalid -bigMergeWindow: %s", err)
+	}
 
 	logger.Infof("opening storage at %q with -retentionPeriod=%s", *DataPath, retentionPeriod)
 	startTime := time.Now()
@@ -83,6 +153,13 @@ func InitWithoutMetrics(resetCacheIfNeeded func(mrs []storage.MetricRow)) {
 		logger.Fatalf("cannot open a storage at %s with -retentionPeriod=%s: %s", *DataPath, retentionPeriod, err)
 	}
 	Storage = strg
+	if *exemplarsMaxCount > 0 {
+		Exemplars = storage.NewExemplarStorage(*exemplarsMaxCount)
+	} else {
+		Exemplars = nil
+	}
+	Metadata = storage.NewMetadataStorage()
+	startColdStorage()
 
 	var m storage.Metrics
 	Storage.UpdateMetrics(&m)
@@ -106,6 +183,14 @@ var Storage *storage.Storage
 // Use syncwg instead of sync, since Add is called from concurrent goroutines.
 var WG syncwg.WaitGroup
 
+// Exemplars is an in-memory storage for exemplars.
+//
+// It is nil if -exemplars.maxCount isn't set.
+var Exemplars *storage.ExemplarStorage
+
+// Metadata is an in-memory storage for metric metadata.
+var Metadata *storage.MetadataStorage
+
 // resetResponseCacheIfNeeded is a callback for automatic resetting of response cache if needed.
 var resetResponseCacheIfNeeded func(mrs []storage.MetricRow)
 
@@ -137,9 +222,11 @@ func DeleteMetrics(tfss []*storage.TagFilters) (int, error) {
 }
 
 // SearchMetricNames returns metric names for the given tfss on the given tr.
-func SearchMetricNames(tfss []*storage.TagFilters, tr storage.TimeRange, maxMetrics int, deadline uint64) ([]storage.MetricName, error) {
+//
+// The search is canceled when cancelCh is closed.
+func SearchMetricNames(tfss []*storage.TagFilters, tr storage.TimeRange, maxMetrics int, deadline uint64, cancelCh <-chan struct{}) ([]storage.MetricName, error) {
 	WG.Add(1)
-	mns, err := Storage.SearchMetricNames(tfss, tr, maxMetrics, deadline)
+	mns, err := Storage.SearchMetricNames(tfss, tr, maxMetrics, deadline, cancelCh)
 	WG.Done()
 	return mns, err
 }
@@ -168,6 +255,11 @@ func SearchTagValuesOnTimeRange(tagKey []byte, tr storage.TimeRange, maxTagValue
 	return values, err
 }
 
+// AddIndexDBRotationHook registers f to be called after every indexdb rotation in the storage.
+func AddIndexDBRotationHook(f func()) {
+	Storage.AddIndexDBRotationHook(f)
+}
+
 // SearchTagValues searches for tag values for the given tagKey
 func SearchTagValues(tagKey []byte, maxTagValues int, deadline uint64) ([]string, error) {
 	WG.Add(1)
@@ -210,6 +302,41 @@ func GetTSDBStatusForDate(date uint64, topN int, deadline uint64) (*storage.TSDB
 	return status, err
 }
 
+// AddExemplar adds exemplar e for the time series with the given metricNameRaw.
+//
+// The exemplar is dropped if exemplars storage is disabled via -exemplars.maxCount.
+func AddExemplar(metricNameRaw []byte, e *storage.Exemplar) error {
+	if Exemplars == nil {
+		return nil
+	}
+	return Exemplars.Add(metricNameRaw, e)
+}
+
+// ExemplarsEnabled returns true if exemplars storage is enabled via -exemplars.maxCount.
+func ExemplarsEnabled() bool {
+	return Exemplars != nil
+}
+
+// SearchExemplars returns exemplars on the given tr for time series matching the given tfss.
+func SearchExemplars(tfss []*storage.TagFilters, tr storage.TimeRange) ([]storage.ExemplarSeries, error) {
+	if Exemplars == nil {
+		return nil, nil
+	}
+	return Exemplars.Search(tfss, tr)
+}
+
+// AddMetadata adds metadata for the given metricFamilyName received from the given source.
+func AddMetadata(metricFamilyName, metricType, help, unit, source string) {
+	Metadata.Add(metricFamilyName, metricType, help, unit, source)
+}
+
+// SearchMetadata returns up to limit metadata entries for the given metricFamilyName.
+//
+// Metadata for all the metric families is returned if metricFamilyName is empty.
+func SearchMetadata(metricFamilyName string, limit int) []storage.MetricMetadata {
+	return Metadata.Search(metricFamilyName, limit)
+}
+
 // GetSeriesCount returns the number of time series in the storage.
 func GetSeriesCount(deadline uint64) (uint64, error) {
 	WG.Add(1)
@@ -222,6 +349,7 @@ func GetSeriesCount(deadline uint64) (uint64, error) {
 func Stop() {
 	logger.Infof("gracefully closing the storage at %s", *DataPath)
 	startTime := time.Now()
+	stopColdStorage()
 	WG.WaitAndBlock()
 	Storage.MustClose()
 	logger.Infof("successfully closed the storage in %.3f seconds", time.Since(startTime).Seconds())
@@ -240,6 +368,7 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 		}
 		// Run force merge in background
 		partitionNamePrefix := r.FormValue("partition_prefix")
+		httpserver.LogAuditEvent(r, "force_merge", "partition_prefix=%q", partitionNamePrefix)
 		go func() {
 			activeForceMerges.Inc()
 			defer activeForceMerges.Dec()
@@ -258,10 +387,17 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 			httpserver.Errorf(w, r, "invalid authKey %q. It must match the value from -forceFlushAuthKey command line flag", authKey)
 			return true
 		}
+		httpserver.LogAuditEvent(r, "force_flush", "")
 		logger.Infof("flushing storage to make pending data available for reading")
 		Storage.DebugFlush()
 		return true
 	}
+	if strings.HasPrefix(path, "/internal/partitions") {
+		return partitionsHandler(w, r, path)
+	}
+	if strings.HasPrefix(path, "/internal/indexdb/") {
+		return indexdbHandler(w, r, path)
+	}
 	prometheusCompatibleResponse := false
 	if path == "/api/v1/admin/tsdb/snapshot" {
 		// Handle Prometheus API - https://prometheus.io/docs/prometheus/latest/querying/api/#snapshot .
@@ -292,6 +428,7 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 		} else {
 			fmt.Fprintf(w, `{"status":"ok","snapshot":%q}`, snapshotPath)
 		}
+		httpserver.LogAuditEvent(r, "snapshot_create", "snapshot=%q", snapshotPath)
 		return true
 	case "/list":
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
@@ -313,6 +450,7 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 	case "/delete":
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
 		snapshotName := r.FormValue("snapshot")
+		httpserver.LogAuditEvent(r, "snapshot_delete", "snapshot=%q", snapshotName)
 		if err := Storage.DeleteSnapshot(snapshotName); err != nil {
 			err = fmt.Errorf("cannot delete snapshot %q: %w", snapshotName, err)
 			jsonResponseError(w, err)
@@ -328,6 +466,7 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 			jsonResponseError(w, err)
 			return true
 		}
+		httpserver.LogAuditEvent(r, "snapshot_delete_all", "snapshots=%q", snapshots)
 		for _, snapshotName := range snapshots {
 			if err := Storage.DeleteSnapshot(snapshotName); err != nil {
 				err = fmt.Errorf("cannot delete snapshot %q: %w", snapshotName, err)
@@ -342,6 +481,99 @@ func RequestHandler(w http.ResponseWriter, r *http.Request) bool {
 	}
 }
 
+func partitionsHandler(w http.ResponseWriter, r *http.Request, path string) bool {
+	authKey := r.FormValue("authKey")
+	if authKey != *partitionsAuthKey {
+		httpserver.Errorf(w, r, "invalid authKey %q. It must match the value from -partitionsAuthKey command line flag", authKey)
+		return true
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	switch path {
+	case "/internal/partitions":
+		pis, err := Storage.ListPartitions()
+		if err != nil {
+			err = fmt.Errorf("cannot list partitions: %w", err)
+			jsonResponseError(w, err)
+			return true
+		}
+		fmt.Fprintf(w, `{"status":"ok","partitions":[`)
+		for i := range pis {
+			pi := &pis[i]
+			if i > 0 {
+				fmt.Fprintf(w, ",")
+			}
+			fmt.Fprintf(w, "\n"+`{"name":%q,"detached":%v,"sizeBytes":%d,"smallSizeBytes":%d,"bigSizeBytes":%d,"rowsCount":%d,"partsCount":%d}`,
+				pi.Name, pi.Detached, pi.SmallSizeBytes+pi.BigSizeBytes, pi.SmallSizeBytes, pi.BigSizeBytes,
+				pi.SmallRowsCount+pi.BigRowsCount, pi.SmallPartsCount+pi.BigPartsCount)
+		}
+		fmt.Fprintf(w, "\n]}")
+		return true
+	case "/internal/partitions/detach":
+		name := r.FormValue("name")
+		httpserver.LogAuditEvent(r, "partition_detach", "partition=%q", name)
+		if err := Storage.DetachPartition(name); err != nil {
+			err = fmt.Errorf("cannot detach partition %q: %w", name, err)
+			jsonResponseError(w, err)
+			return true
+		}
+		fmt.Fprintf(w, `{"status":"ok"}`)
+		return true
+	case "/internal/partitions/attach":
+		name := r.FormValue("name")
+		httpserver.LogAuditEvent(r, "partition_attach", "partition=%q", name)
+		if err := Storage.AttachPartition(name); err != nil {
+			err = fmt.Errorf("cannot attach partition %q: %w", name, err)
+			jsonResponseError(w, err)
+			return true
+		}
+		fmt.Fprintf(w, `{"status":"ok"}`)
+		return true
+	default:
+		return false
+	}
+}
+
+func indexdbHandler(w http.ResponseWriter, r *http.Request, path string) bool {
+	// Do not use r.FormValue, since it may consume request body with the imported entries.
+	authKey := r.URL.Query().Get("authKey")
+	if authKey != *indexdbAuthKey {
+		httpserver.Errorf(w, r, "invalid authKey %q. It must match the value from -indexdbAuthKey command line flag", authKey)
+		return true
+	}
+	switch path {
+	case "/internal/indexdb/export":
+		httpserver.LogAuditEvent(r, "indexdb_export", "")
+		startTime := time.Now()
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", "attachment; filename=indexdb.bin")
+		itemsCount, err := Storage.ExportIndexDB(w)
+		if err != nil {
+			// It is impossible to return error to the client, since the response body may be already sent.
+			logger.Errorf("cannot export indexdb after sending %d entries: %s", itemsCount, err)
+			return true
+		}
+		logger.Infof("exported %d indexdb entries in %.3f seconds", itemsCount, time.Since(startTime).Seconds())
+		return true
+	case "/internal/indexdb/import":
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if r.Method != http.MethodPost {
+			jsonResponseError(w, fmt.Errorf("unsupported method %q; use POST", r.Method))
+			return true
+		}
+		httpserver.LogAuditEvent(r, "indexdb_import", "")
+		itemsCount, err := Storage.ImportIndexDB(r.Body)
+		if err != nil {
+			err = fmt.Errorf("cannot import indexdb after adding %d entries: %w", itemsCount, err)
+			jsonResponseError(w, err)
+			return true
+		}
+		fmt.Fprintf(w, `{"status":"ok","entries":%d}`, itemsCount)
+		return true
+	default:
+		return false
+	}
+}
+
 var activeForceMerges = metrics.NewCounter("vm_active_force_merges")
 
 func registerStorageMetrics() {
@@ -520,6 +752,9 @@ func registerStorageMetrics() {
 	metrics.NewGauge(`vm_rows_ignored_total{reason="small_timestamp"}`, func() float64 {
 		return float64(m().TooSmallTimestampRows)
 	})
+	metrics.NewGauge(`vm_rows_ignored_total{reason="detached_partition"}`, func() float64 {
+		return float64(tm().DetachedPartitionRows)
+	})
 
 	metrics.NewGauge(`vm_concurrent_addrows_limit_reached_total`, func() float64 {
 		return float64(m().AddRowsConcurrencyLimitReached)
@@ -543,6 +778,9 @@ func registerStorageMetrics() {
 	metrics.NewGauge(`vm_concurrent_search_tsids_limit_timeout_total`, func() float64 {
 		return float64(m().SearchTSIDsConcurrencyLimitTimeout)
 	})
+	metrics.NewGauge(`vm_search_canceled_total{layer="vmstorage"}`, func() float64 {
+		return float64(m().SearchCanceled)
+	})
 	metrics.NewGauge(`vm_concurrent_search_tsids_capacity`, func() float64 {
 		return float64(m().SearchTSIDsConcurrencyCapacity)
 	})
@@ -550,10 +788,56 @@ func registerStorageMetrics() {
 		return float64(m().SearchTSIDsConcurrencyCurrent)
 	})
 
+	metrics.NewGauge(`vm_storage_is_read_only`, func() float64 {
+		return float64(m().IsReadOnly)
+	})
+	metrics.NewGauge(`vm_storage_read_only_rejected_rows_total`, func() float64 {
+		return float64(m().ReadOnlyRejectedRows)
+	})
+
+	mdm := func() *storage.MetadataStorageMetrics {
+		var m storage.MetadataStorageMetrics
+		Metadata.UpdateMetrics(&m)
+		return &m
+	}
+	metrics.NewGauge(`vm_metadata_metric_families`, func() float64 {
+		return float64(mdm().MetricFamilies)
+	})
+	metrics.NewGauge(`vm_metadata_updates_total`, func() float64 {
+		return float64(mdm().Updates)
+	})
+
+	if Exemplars != nil {
+		em := func() *storage.ExemplarStorageMetrics {
+			var m storage.ExemplarStorageMetrics
+			Exemplars.UpdateMetrics(&m)
+			return &m
+		}
+		metrics.NewGauge(`vm_exemplars`, func() float64 {
+			return float64(em().ExemplarsCount)
+		})
+		metrics.NewGauge(`vm_exemplars_capacity`, func() float64 {
+			return float64(em().ExemplarsCapacity)
+		})
+		metrics.NewGauge(`vm_exemplars_added_total`, func() float64 {
+			return float64(em().AddedExemplars)
+		})
+		metrics.NewGauge(`vm_exemplars_out_of_order_total`, func() float64 {
+			return float64(em().OutOfOrderExemplars)
+		})
+	}
+
 	metrics.NewGauge(`vm_search_delays_total`, func() float64 {
 		return float64(m().SearchDelays)
 	})
 
+	metrics.NewGauge(`vm_merge_bandwidth_limit_reached_total`, func() float64 {
+		return float64(m().MergeBandwidthLimitReached)
+	})
+	metrics.NewGauge(`vm_big_merges_paused`, func() float64 {
+		return float64(m().BigMergesPaused)
+	})
+
 	metrics.NewGauge(`vm_slow_row_inserts_total`, func() float64 {
 		return float64(m().SlowRowInserts)
 	})
@@ -18,7 +18,9 @@ require (
 	github.com/golang/snappy v0.0.2
 	github.com/influxdata/influxdb v1.8.4
 	github.com/klauspost/compress v1.11.7
+	github.com/lib/pq v1.9.0
 	github.com/mattn/go-runewidth v0.0.10 // indirect
+	github.com/pkg/sftp v1.12.0
 	github.com/prometheus/client_golang v1.9.0 // indirect
 	github.com/prometheus/procfs v0.6.0 // indirect
 	github.com/prometheus/prometheus v1.8.2-0.20201119142752-3ad25a6dc3d9
@@ -32,9 +34,13 @@ require (
 	github.com/valyala/histogram v1.1.2
 	github.com/valyala/quicktemplate v1.6.3
 	go.opencensus.io v0.22.6 // indirect
+	golang.org/x/crypto v0.0.0-20201221181555-eec23a3978ad
+	golang.org/x/net v0.0.0-20210119194325-5f4716e94777
 	golang.org/x/oauth2 v0.0.0-20210216194517-16ff1888fd2e
 	golang.org/x/sys v0.0.0-20210216163648-f7da38b97c65
 	google.golang.org/api v0.40.0
+	google.golang.org/grpc v1.35.0
+	google.golang.org/protobuf v1.25.0
 	gopkg.in/yaml.v2 v2.4.0
 )
 
@@ -3,6 +3,7 @@ package actions
 import (
 	"fmt"
 	"io"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -38,6 +39,14 @@ type Backup struct {
 	// Origin is optional origin for speeding up full backup if Dst points
 	// to empty dir.
 	Origin common.OriginFS
+
+	// PreviousPath is optional path to the previous backup, e.g. `s3://bucket/path/to/backup`.
+	//
+	// If set, then parts existing in the previous backup aren't stored at Dst.
+	// They are referenced from the previous backup via manifest file instead.
+	// The previous backup may be incremental too. In this case the parts are referenced
+	// from the backups holding them, so every backup in the chain can be restored on its own.
+	PreviousPath string
 }
 
 // Run runs b with the provided settings.
@@ -57,25 +66,227 @@ func (b *Backup) Run() error {
 	if err := dst.DeleteFile(fscommon.BackupCompleteFilename); err != nil {
 		return fmt.Errorf("cannot delete `backup complete` file at %s: %w", dst, err)
 	}
-	if err := runBackup(src, dst, origin, concurrency); err != nil {
+	// Re-use checksums for parts from the previous backup at dst, so they aren't re-calculated.
+	checksums := newPartChecksums()
+	if err := checksums.addFromManifest(dst); err != nil {
+		return err
+	}
+	if err := dst.DeleteFile(fscommon.BackupManifestFilename); err != nil {
+		return fmt.Errorf("cannot delete manifest file at %s: %w", dst, err)
+	}
+
+	srcParts, err := src.ListParts()
+	if err != nil {
+		return fmt.Errorf("cannot list src parts: %w", err)
+	}
+	logger.Infof("obtained %d parts from src %s", len(srcParts), src)
+
+	var prevParts map[common.Part]common.ManifestPart
+	if b.PreviousPath != "" {
+		prevParts, err = getPreviousParts(b.PreviousPath)
+		if err != nil {
+			return err
+		}
+		for _, mp := range prevParts {
+			if mp.Checksums != nil {
+				checksums.add(mp.Part(), mp.Checksums)
+			}
+		}
+	}
+	m, partsToStore := newManifest(srcParts, prevParts)
+	if b.PreviousPath != "" {
+		logger.Infof("referencing %d parts from previous backups; %d parts must be stored at dst %s", len(m.Parts)-len(partsToStore), len(partsToStore), dst)
+	}
+
+	if err := runBackup(src, dst, origin, partsToStore, concurrency, checksums); err != nil {
+		return err
+	}
+	if err := checksums.addFromSrc(src, srcParts, concurrency); err != nil {
+		return err
+	}
+	for i := range m.Parts {
+		mp := &m.Parts[i]
+		mp.Checksums = checksums.get(mp.Part())
+	}
+	data, err := m.Marshal()
+	if err != nil {
 		return err
 	}
+	if err := dst.CreateFile(fscommon.BackupManifestFilename, data); err != nil {
+		return fmt.Errorf("cannot create manifest file at %s: %w", dst, err)
+	}
 	if err := dst.CreateFile(fscommon.BackupCompleteFilename, []byte("ok")); err != nil {
 		return fmt.Errorf("cannot create `backup complete` file at %s: %w", dst, err)
 	}
 	return nil
 }
 
-func runBackup(src *fslocal.FS, dst common.RemoteFS, origin common.OriginFS, concurrency int) error {
-	startTime := time.Now()
+// getPreviousParts returns parts for the backup at the given path
+// together with locations of the backups holding these parts.
+func getPreviousParts(path string) (map[common.Part]common.ManifestPart, error) {
+	prev, err := NewRemoteFS(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open previous backup %q: %w", path, err)
+	}
+	defer prev.MustStop()
 
-	logger.Infof("starting backup from %s to %s using origin %s", src, dst, origin)
+	ok, err := prev.HasFile(fscommon.BackupCompleteFilename)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("cannot find %s file in previous backup %s; incremental backup can be made only on top of complete backup", fscommon.BackupCompleteFilename, prev)
+	}
+	parts := make(map[common.Part]common.ManifestPart)
+	ok, err = prev.HasFile(fscommon.BackupManifestFilename)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		// The previous backup is a full backup.
+		prevParts, err := prev.ListParts()
+		if err != nil {
+			return nil, fmt.Errorf("cannot list parts at previous backup %s: %w", prev, err)
+		}
+		for _, p := range prevParts {
+			if p.ActualSize == p.Size {
+				parts[p] = common.NewManifestPart(p, path, nil)
+			}
+		}
+		return parts, nil
+	}
+	data, err := prev.ReadFile(fscommon.BackupManifestFilename)
+	if err != nil {
+		return nil, err
+	}
+	m, err := common.ParseManifest(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read manifest from previous backup %s: %w", prev, err)
+	}
+	for _, mp := range m.Parts {
+		if mp.Location == "" {
+			mp.Location = path
+		}
+		parts[mp.Part()] = mp
+	}
+	return parts, nil
+}
 
-	srcParts, err := src.ListParts()
+// newManifest returns manifest for srcParts, which refers to prevParts if possible.
+//
+// It also returns srcParts, which must be stored in the backup with the manifest.
+func newManifest(srcParts []common.Part, prevParts map[common.Part]common.ManifestPart) (*common.Manifest, []common.Part) {
+	m := &common.Manifest{}
+	var partsToStore []common.Part
+	for _, p := range srcParts {
+		key := p
+		key.ActualSize = p.Size
+		prev, ok := prevParts[key]
+		if !ok {
+			partsToStore = append(partsToStore, p)
+		}
+		m.Parts = append(m.Parts, common.NewManifestPart(p, prev.Location, nil))
+	}
+	return m, partsToStore
+}
+
+// partChecksums holds checksums for backed up parts.
+type partChecksums struct {
+	mu sync.Mutex
+	m  map[common.Part][]uint64
+}
+
+func newPartChecksums() *partChecksums {
+	return &partChecksums{
+		m: make(map[common.Part][]uint64),
+	}
+}
+
+func (pc *partChecksums) add(p common.Part, checksums []uint64) {
+	p.ActualSize = p.Size
+	pc.mu.Lock()
+	pc.m[p] = checksums
+	pc.mu.Unlock()
+}
+
+func (pc *partChecksums) get(p common.Part) []uint64 {
+	p.ActualSize = p.Size
+	pc.mu.Lock()
+	checksums := pc.m[p]
+	pc.mu.Unlock()
+	return checksums
+}
+
+// addFromManifest adds checksums from the manifest at fs if it exists.
+func (pc *partChecksums) addFromManifest(fs common.RemoteFS) error {
+	ok, err := fs.HasFile(fscommon.BackupManifestFilename)
 	if err != nil {
-		return fmt.Errorf("cannot list src parts: %w", err)
+		return err
 	}
-	logger.Infof("obtained %d parts from src %s", len(srcParts), src)
+	if !ok {
+		return nil
+	}
+	data, err := fs.ReadFile(fscommon.BackupManifestFilename)
+	if err != nil {
+		return err
+	}
+	m, err := common.ParseManifest(data)
+	if err != nil {
+		// The manifest is going to be overwritten, so just ignore it.
+		logger.Errorf("cannot read manifest at %s: %s; ignoring it", fs, err)
+		return nil
+	}
+	for _, mp := range m.Parts {
+		if mp.Checksums != nil {
+			pc.add(mp.Part(), mp.Checksums)
+		}
+	}
+	return nil
+}
+
+// addFromSrc calculates checksums for parts without checksums by reading them from src.
+func (pc *partChecksums) addFromSrc(src *fslocal.FS, parts []common.Part, concurrency int) error {
+	var partsToRead []common.Part
+	for _, p := range parts {
+		if pc.get(p) == nil {
+			partsToRead = append(partsToRead, p)
+		}
+	}
+	if len(partsToRead) == 0 {
+		return nil
+	}
+	logger.Infof("calculating checksums for %d parts from src %s", len(partsToRead), src)
+	bytesRead := uint64(0)
+	readSize := getPartsSize(partsToRead)
+	return runParallel(concurrency, partsToRead, func(p common.Part) error {
+		rc, err := src.NewReadCloser(p)
+		if err != nil {
+			return fmt.Errorf("cannot create reader for %s from src %s: %w", &p, src, err)
+		}
+		cw := common.NewChecksumWriter()
+		sr := &statReader{
+			r:         rc,
+			bytesRead: &bytesRead,
+		}
+		_, err = io.Copy(cw, sr)
+		if errClose := rc.Close(); err == nil {
+			err = errClose
+		}
+		if err != nil {
+			return fmt.Errorf("cannot read %s from src %s: %w", &p, src, err)
+		}
+		pc.add(p, cw.Checksums())
+		return nil
+	}, func(elapsed time.Duration) {
+		n := atomic.LoadUint64(&bytesRead)
+		logger.Infof("calculated checksums for %d out of %d bytes from src %s in %s", n, readSize, src, elapsed)
+	})
+}
+
+func runBackup(src *fslocal.FS, dst common.RemoteFS, origin common.OriginFS, srcParts []common.Part, concurrency int, checksums *partChecksums) error {
+	startTime := time.Now()
+
+	logger.Infof("starting backup from %s to %s using origin %s", src, dst, origin)
 
 	dstParts, err := dst.ListParts()
 	if err != nil {
@@ -148,8 +359,9 @@ func runBackup(src *fslocal.FS, dst common.RemoteFS, origin common.OriginFS, con
 			if err != nil {
 				return fmt.Errorf("cannot create reader for %s from src %s: %w", &p, src, err)
 			}
+			cw := common.NewChecksumWriter()
 			sr := &statReader{
-				r:         rc,
+				r:         io.TeeReader(rc, cw),
 				bytesRead: &bytesUploaded,
 			}
 			if err := dst.UploadPart(p, sr); err != nil {
@@ -158,6 +370,7 @@ func runBackup(src *fslocal.FS, dst common.RemoteFS, origin common.OriginFS, con
 			if err = rc.Close(); err != nil {
 				return fmt.Errorf("cannot close reader for %s from src %s: %w", &p, src, err)
 			}
+			checksums.add(p, cw.Checksums())
 			return nil
 		}, func(elapsed time.Duration) {
 			n := atomic.LoadUint64(&bytesUploaded)
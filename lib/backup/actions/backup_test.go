@@ -0,0 +1,298 @@
+package actions
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/common"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/fscommon"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/fslocal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/fsnil"
+)
+
+func TestIncrementalBackupRestore(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "incremental-backup")
+	if err != nil {
+		t.Fatalf("cannot create temporary dir: %s", err)
+	}
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+
+	writeFiles := func(dir string, files map[string]string) {
+		t.Helper()
+		_ = os.RemoveAll(dir)
+		for name, data := range files {
+			path := filepath.Join(dir, name)
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatalf("cannot create dir: %s", err)
+			}
+			if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+				t.Fatalf("cannot write file: %s", err)
+			}
+		}
+	}
+	readFiles := func(dir string) map[string]string {
+		t.Helper()
+		files := make(map[string]string)
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || filepath.Base(path) == "flock.lock" {
+				return err
+			}
+			data, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			name, _ := filepath.Rel(dir, path)
+			files[name] = string(data)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("cannot read files: %s", err)
+		}
+		return files
+	}
+	srcDir := filepath.Join(tmpDir, "src")
+	backup := func(name, prevName string) {
+		t.Helper()
+		dst, err := NewRemoteFS("fs://" + filepath.Join(tmpDir, name))
+		if err != nil {
+			t.Fatalf("cannot create dst fs: %s", err)
+		}
+		b := &Backup{
+			Concurrency: 2,
+			Src:         &fslocal.FS{Dir: srcDir},
+			Dst:         dst,
+			Origin:      &fsnil.FS{},
+		}
+		if prevName != "" {
+			b.PreviousPath = "fs://" + filepath.Join(tmpDir, prevName)
+		}
+		if err := b.Run(); err != nil {
+			t.Fatalf("cannot make backup %q: %s", name, err)
+		}
+	}
+	restore := func(name string, expFiles map[string]string) {
+		t.Helper()
+		src, err := NewRemoteFS("fs://" + filepath.Join(tmpDir, name))
+		if err != nil {
+			t.Fatalf("cannot create src fs: %s", err)
+		}
+		dstDir := filepath.Join(tmpDir, "restore-"+name)
+		r := &Restore{
+			Concurrency: 2,
+			Src:         src,
+			Dst:         &fslocal.FS{Dir: dstDir},
+		}
+		if err := r.Run(); err != nil {
+			t.Fatalf("cannot restore from %q: %s", name, err)
+		}
+		if files := readFiles(dstDir); !reflect.DeepEqual(files, expFiles) {
+			t.Fatalf("unexpected files restored from %q;\ngot\n%v\nwant\n%v", name, files, expFiles)
+		}
+	}
+	storedParts := func(name string) []string {
+		t.Helper()
+		fs, err := NewRemoteFS("fs://" + filepath.Join(tmpDir, name))
+		if err != nil {
+			t.Fatalf("cannot create fs: %s", err)
+		}
+		parts, err := fs.ListParts()
+		if err != nil {
+			t.Fatalf("cannot list parts: %s", err)
+		}
+		common.SortParts(parts)
+		var paths []string
+		for _, p := range parts {
+			paths = append(paths, p.Path)
+		}
+		return paths
+	}
+
+	files1 := map[string]string{
+		"data/a":   "foo",
+		"data/b":   "bar",
+		"index/ic": "baz",
+	}
+	writeFiles(srcDir, files1)
+	backup("full", "")
+
+	files2 := map[string]string{
+		"data/a":   "foo",
+		"data/b":   "bar",
+		"data/c":   "qwerty",
+		"index/ic": "baz",
+	}
+	writeFiles(srcDir, files2)
+	backup("incr1", "full")
+	if paths := storedParts("incr1"); !reflect.DeepEqual(paths, []string{"data/c"}) {
+		t.Fatalf("unexpected parts stored in incremental backup: %q", paths)
+	}
+
+	files3 := map[string]string{
+		"data/a":   "foo",
+		"data/c":   "qwerty",
+		"data/d":   "asdf",
+		"index/ic": "updated",
+	}
+	writeFiles(srcDir, files3)
+	backup("incr2", "incr1")
+	if paths := storedParts("incr2"); !reflect.DeepEqual(paths, []string{"data/d", "index/ic"}) {
+		t.Fatalf("unexpected parts stored in incremental backup: %q", paths)
+	}
+
+	// every backup in the chain must be restorable
+	restore("full", files1)
+	restore("incr1", files2)
+	restore("incr2", files3)
+
+	// incremental backup on top of incomplete backup must fail
+	incomplete, err := NewRemoteFS("fs://" + filepath.Join(tmpDir, "incr2"))
+	if err != nil {
+		t.Fatalf("cannot create fs: %s", err)
+	}
+	if err := incomplete.DeleteFile(fscommon.BackupCompleteFilename); err != nil {
+		t.Fatalf("cannot delete file: %s", err)
+	}
+	if _, err := getPreviousParts("fs://" + filepath.Join(tmpDir, "incr2")); err == nil {
+		t.Fatalf("expected error when referencing incomplete backup")
+	}
+	// restore must fail if the backup referenced from the manifest is incomplete
+	src, err := NewRemoteFS("fs://" + filepath.Join(tmpDir, "incr1"))
+	if err != nil {
+		t.Fatalf("cannot create fs: %s", err)
+	}
+	full, err := NewRemoteFS("fs://" + filepath.Join(tmpDir, "full"))
+	if err != nil {
+		t.Fatalf("cannot create fs: %s", err)
+	}
+	if err := full.DeleteFile(fscommon.BackupCompleteFilename); err != nil {
+		t.Fatalf("cannot delete file: %s", err)
+	}
+	r := &Restore{
+		Src: src,
+		Dst: &fslocal.FS{Dir: filepath.Join(tmpDir, "restore-broken")},
+	}
+	if err := r.Run(); err == nil {
+		t.Fatalf("expected error when restoring from backup referring incomplete backup")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "verify-backup")
+	if err != nil {
+		t.Fatalf("cannot create temporary dir: %s", err)
+	}
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+
+	srcDir := filepath.Join(tmpDir, "src")
+	writeFile := func(name, data string) {
+		t.Helper()
+		path := filepath.Join(srcDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("cannot create dir: %s", err)
+		}
+		if err := ioutil.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatalf("cannot write file: %s", err)
+		}
+	}
+	newFS := func(name string) common.RemoteFS {
+		t.Helper()
+		fs, err := NewRemoteFS("fs://" + filepath.Join(tmpDir, name))
+		if err != nil {
+			t.Fatalf("cannot create fs: %s", err)
+		}
+		return fs
+	}
+	backup := func(name, prevName string) {
+		t.Helper()
+		b := &Backup{
+			Concurrency: 2,
+			Src:         &fslocal.FS{Dir: srcDir},
+			Dst:         newFS(name),
+			Origin:      &fsnil.FS{},
+		}
+		if prevName != "" {
+			b.PreviousPath = "fs://" + filepath.Join(tmpDir, prevName)
+		}
+		if err := b.Run(); err != nil {
+			t.Fatalf("cannot make backup %q: %s", name, err)
+		}
+	}
+	verify := func(name string, chunksPerPart int) error {
+		t.Helper()
+		v := &Verify{
+			Concurrency:   2,
+			Src:           newFS(name),
+			ChunksPerPart: chunksPerPart,
+		}
+		return v.Run()
+	}
+	partPath := func(name, path, data string) string {
+		p := common.Part{
+			Path:     path,
+			FileSize: uint64(len(data)),
+			Size:     uint64(len(data)),
+		}
+		return p.RemotePath(filepath.Join(tmpDir, name))
+	}
+
+	writeFile("data/a", "foobar")
+	writeFile("data/b", "baz")
+	backup("full", "")
+	writeFile("data/c", "qwerty")
+	backup("incr", "full")
+
+	for _, name := range []string{"full", "incr"} {
+		if err := verify(name, -1); err != nil {
+			t.Fatalf("unexpected error when verifying %q: %s", name, err)
+		}
+	}
+
+	// The manifest must contain checksums for all the parts, including the referenced parts.
+	data, err := newFS("incr").ReadFile(fscommon.BackupManifestFilename)
+	if err != nil {
+		t.Fatalf("cannot read manifest: %s", err)
+	}
+	m, err := common.ParseManifest(data)
+	if err != nil {
+		t.Fatalf("cannot parse manifest: %s", err)
+	}
+	if len(m.Parts) != 3 {
+		t.Fatalf("unexpected number of parts in the manifest; got %d; want 3", len(m.Parts))
+	}
+	for _, mp := range m.Parts {
+		if len(mp.Checksums) != 1 {
+			t.Fatalf("unexpected checksums for part %q: %v", mp.Path, mp.Checksums)
+		}
+	}
+
+	// Corrupt the part referenced from the incremental backup.
+	if err := ioutil.WriteFile(partPath("full", "data/a", "foobar"), []byte("foobaz"), 0600); err != nil {
+		t.Fatalf("cannot corrupt part: %s", err)
+	}
+	if err := verify("incr", 1); err == nil {
+		t.Fatalf("expecting non-nil error when verifying backup with corrupted part")
+	}
+	// Sizes are still valid, so the corrupted part cannot be detected without checksums verification.
+	if err := verify("incr", 0); err != nil {
+		t.Fatalf("unexpected error when verifying only part sizes: %s", err)
+	}
+
+	// Delete the part stored in the incremental backup.
+	if err := os.Remove(partPath("incr", "data/c", "qwerty")); err != nil {
+		t.Fatalf("cannot delete part: %s", err)
+	}
+	if err := verify("incr", 0); err == nil {
+		t.Fatalf("expecting non-nil error when verifying backup with missing part")
+	}
+
+	// Incomplete backup must fail verification.
+	if err := newFS("full").DeleteFile(fscommon.BackupCompleteFilename); err != nil {
+		t.Fatalf("cannot delete file: %s", err)
+	}
+	if err := verify("full", 0); err == nil {
+		t.Fatalf("expecting non-nil error when verifying incomplete backup")
+	}
+}
@@ -73,6 +73,15 @@ func (r *Restore) Run() error {
 	if err != nil {
 		return fmt.Errorf("cannot list src parts: %w", err)
 	}
+	ms, err := readManifest(src, srcParts, r.SkipBackupCompleteCheck)
+	if err != nil {
+		return err
+	}
+	if ms != nil {
+		defer ms.mustStop()
+		srcParts = ms.parts
+		logger.Infof("obtained %d parts from manifest at %s", len(srcParts), src)
+	}
 	logger.Infof("obtaining list of parts at %s", dst)
 	dstParts, err := dst.ListParts()
 	if err != nil {
@@ -81,33 +90,8 @@ func (r *Restore) Run() error {
 
 	backupSize := getPartsSize(srcParts)
 
-	// Validate srcParts. They must cover the whole files.
-	common.SortParts(srcParts)
-	offset := uint64(0)
-	var pOld common.Part
-	var path string
-	for _, p := range srcParts {
-		if p.Path != path {
-			if offset != pOld.FileSize {
-				return fmt.Errorf("invalid size for %q; got %d; want %d", path, offset, pOld.FileSize)
-			}
-			pOld = p
-			path = p.Path
-			offset = 0
-		}
-		if p.Offset < offset {
-			return fmt.Errorf("there is an overlap in %d bytes between %s and %s", offset-p.Offset, &pOld, &p)
-		}
-		if p.Offset > offset {
-			if offset == 0 {
-				return fmt.Errorf("there is a gap in %d bytes from file start to %s", p.Offset, &p)
-			}
-			return fmt.Errorf("there is a gap in %d bytes between %s and %s", p.Offset-offset, &pOld, &p)
-		}
-		if p.Size != p.ActualSize {
-			return fmt.Errorf("invalid size for %s; got %d; want %d", &p, p.ActualSize, p.Size)
-		}
-		offset += p.Size
+	if err := validatePartsCoverage(srcParts); err != nil {
+		return err
 	}
 
 	partsToDelete := common.PartsDifference(dstParts, srcParts)
@@ -163,6 +147,10 @@ func (r *Restore) Run() error {
 			// and to properly resume downloading of incomplete files on the next Restore.Run call.
 			common.SortParts(parts)
 			for _, p := range parts {
+				src := src
+				if ms != nil {
+					src = ms.partFS[p]
+				}
 				logger.Infof("downloading %s from %s to %s", &p, src, dst)
 				wc, err := dst.NewWriteCloser(p)
 				if err != nil {
@@ -205,3 +193,127 @@ func (sw *statWriter) Write(p []byte) (int, error) {
 	atomic.AddUint64(sw.bytesWritten, uint64(n))
 	return n, err
 }
+
+// manifestSources contains parts listed in the manifest of incremental backup
+// together with remote filesystems holding these parts.
+type manifestSources struct {
+	parts  []common.Part
+	partFS map[common.Part]common.RemoteFS
+
+	// fss contains filesystems for the previous backups referenced from the manifest.
+	fss []common.RemoteFS
+}
+
+func (ms *manifestSources) mustStop() {
+	for _, fs := range ms.fss {
+		fs.MustStop()
+	}
+}
+
+// readManifest reads manifest from src if it exists.
+//
+// srcParts must contain parts stored at src.
+// nil is returned if src doesn't contain manifest, i.e. it is a full backup.
+func readManifest(src common.RemoteFS, srcParts []common.Part, skipBackupCompleteCheck bool) (*manifestSources, error) {
+	ok, err := src.HasFile(fscommon.BackupManifestFilename)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, nil
+	}
+	data, err := src.ReadFile(fscommon.BackupManifestFilename)
+	if err != nil {
+		return nil, err
+	}
+	m, err := common.ParseManifest(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read manifest from %s: %w", src, err)
+	}
+
+	stored := make(map[common.Part]bool, len(srcParts))
+	for _, p := range srcParts {
+		stored[p] = true
+	}
+	ms := &manifestSources{
+		partFS: make(map[common.Part]common.RemoteFS, len(m.Parts)),
+	}
+	locations := make(map[string]common.RemoteFS)
+	for _, mp := range m.Parts {
+		p := mp.Part()
+		ms.parts = append(ms.parts, p)
+		if mp.Location == "" {
+			if !stored[p] {
+				ms.mustStop()
+				return nil, fmt.Errorf("cannot find %s listed in the manifest at %s", &p, src)
+			}
+			ms.partFS[p] = src
+			continue
+		}
+		fs := locations[mp.Location]
+		if fs == nil {
+			fs, err = newReferencedFS(mp.Location, skipBackupCompleteCheck)
+			if err != nil {
+				ms.mustStop()
+				return nil, fmt.Errorf("cannot open backup referenced from the manifest at %s: %w", src, err)
+			}
+			logger.Infof("the manifest at %s refers to parts from %s", src, fs)
+			locations[mp.Location] = fs
+			ms.fss = append(ms.fss, fs)
+		}
+		ms.partFS[p] = fs
+	}
+	return ms, nil
+}
+
+func newReferencedFS(path string, skipBackupCompleteCheck bool) (common.RemoteFS, error) {
+	fs, err := NewRemoteFS(path)
+	if err != nil {
+		return nil, err
+	}
+	if skipBackupCompleteCheck {
+		return fs, nil
+	}
+	ok, err := fs.HasFile(fscommon.BackupCompleteFilename)
+	if err != nil {
+		fs.MustStop()
+		return nil, err
+	}
+	if !ok {
+		fs.MustStop()
+		return nil, fmt.Errorf("cannot find %s file in %s; the referenced backup is incomplete", fscommon.BackupCompleteFilename, fs)
+	}
+	return fs, nil
+}
+
+// validatePartsCoverage verifies that parts cover the whole files.
+func validatePartsCoverage(parts []common.Part) error {
+	common.SortParts(parts)
+	offset := uint64(0)
+	var pOld common.Part
+	var path string
+	for _, p := range parts {
+		if p.Path != path {
+			if offset != pOld.FileSize {
+				return fmt.Errorf("invalid size for %q; got %d; want %d", path, offset, pOld.FileSize)
+			}
+			pOld = p
+			path = p.Path
+			offset = 0
+		}
+		if p.Offset < offset {
+			return fmt.Errorf("there is an overlap in %d bytes between %s and %s", offset-p.Offset, &pOld, &p)
+		}
+		if p.Offset > offset {
+			if offset == 0 {
+				return fmt.Errorf("there is a gap in %d bytes from file start to %s", p.Offset, &p)
+			}
+			return fmt.Errorf("there is a gap in %d bytes between %s and %s", p.Offset-offset, &pOld, &p)
+		}
+		if p.Size != p.ActualSize {
+			return fmt.Errorf("invalid size for %s; got %d; want %d", &p, p.ActualSize, p.Size)
+		}
+		offset += p.Size
+	}
+	return nil
+}
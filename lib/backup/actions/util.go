@@ -7,10 +7,13 @@ import (
 	"sync"
 	"time"
 
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/azremote"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/common"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/encryption"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/fsremote"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/gcsremote"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/s3remote"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/sftpremote"
 )
 
 var (
@@ -21,6 +24,28 @@ var (
 	configProfile = flag.String("configProfile", "", "Profile name for S3 configs. If no set, the value of the environment variable will be loaded (AWS_PROFILE or AWS_DEFAULT_PROFILE), "+
 		"or if both not set, DefaultSharedConfigProfile is used")
 	customS3Endpoint = flag.String("customS3Endpoint", "", "Custom S3 endpoint for use with S3-compatible storages (e.g. MinIO). S3 is used if not set")
+
+	azureAccountName = flag.String("azure.accountName", "", "The name of Azure storage account for azblob:// paths")
+	azureSASToken    = flag.String("azure.sasToken", "", "Shared access signature (SAS) token for azblob:// paths. "+
+		"Managed identity is used if not set. See https://docs.microsoft.com/en-us/azure/storage/common/storage-sas-overview")
+	azureManagedIdentityClientID = flag.String("azure.managedIdentityClientID", "", "Optional client id of user-assigned managed identity for azblob:// paths. "+
+		"System-assigned managed identity is used if not set. It is ignored if -azure.sasToken is set")
+	customAzureEndpoint = flag.String("customAzureEndpoint", "", "Custom Azure Blob Storage endpoint for azblob:// paths (e.g. Azurite). "+
+		"https://<azure.accountName>.blob.core.windows.net is used if not set")
+
+	sftpKeyFile        = flag.String("sftp.keyFile", "", "Path to file with private SSH key for sftp:// paths")
+	sftpPasswordFile   = flag.String("sftp.passwordFile", "", "Path to file with password for sftp:// paths")
+	sftpKnownHostsFile = flag.String("sftp.knownHostsFile", "", "Path to known_hosts file for verifying SFTP server host key for sftp:// paths. "+
+		"~/.ssh/known_hosts is used if not set")
+
+	encryptionKeyFile = flag.String("encryption.keyFile", "", "Optional path to file with base64-encoded 32-byte key for client-side AES-256-GCM encryption of backup data. "+
+		"The key can be generated with \"openssl rand -base64 32\" command. The same key must be used for restoring the backup. "+
+		"See also -encryption.awsKMSKeyID and -encryption.gcpKMSKeyName")
+	encryptionAWSKMSKeyID = flag.String("encryption.awsKMSKeyID", "", "Optional id, ARN or alias of AWS KMS key for client-side envelope encryption of backup data. "+
+		"AWS credentials are obtained in the same way as for S3. See also -encryption.keyFile and -encryption.gcpKMSKeyName")
+	encryptionGCPKMSKeyName = flag.String("encryption.gcpKMSKeyName", "", "Optional name of GCP KMS key for client-side envelope encryption of backup data "+
+		"in the form projects/<project>/locations/<location>/keyRings/<keyRing>/cryptoKeys/<key>. "+
+		"GCP credentials are obtained in the same way as for GCS. See also -encryption.keyFile and -encryption.awsKMSKeyID")
 )
 
 func runParallel(concurrency int, parts []common.Part, f func(p common.Part) error, progress func(elapsed time.Duration)) error {
@@ -176,13 +201,72 @@ func getPartsSize(parts []common.Part) uint64 {
 }
 
 // NewRemoteFS returns new remote fs from the given path.
+//
+// The returned fs encrypts backup data if one of -encryption.* flags is set.
 func NewRemoteFS(path string) (common.RemoteFS, error) {
+	fs, err := newRemoteFS(path)
+	if err != nil {
+		return nil, err
+	}
+	kw, err := getKeyWrapper()
+	if err != nil {
+		fs.MustStop()
+		return nil, err
+	}
+	if kw == nil {
+		return fs, nil
+	}
+	return encryption.NewFS(fs, kw), nil
+}
+
+func getKeyWrapper() (encryption.KeyWrapper, error) {
+	keyWrapperOnce.Do(func() {
+		keyWrapper, keyWrapperErr = newKeyWrapper()
+	})
+	return keyWrapper, keyWrapperErr
+}
+
+var (
+	keyWrapperOnce sync.Once
+	keyWrapper     encryption.KeyWrapper
+	keyWrapperErr  error
+)
+
+func newKeyWrapper() (encryption.KeyWrapper, error) {
+	n := 0
+	for _, s := range []string{*encryptionKeyFile, *encryptionAWSKMSKeyID, *encryptionGCPKMSKeyName} {
+		if len(s) > 0 {
+			n++
+		}
+	}
+	if n > 1 {
+		return nil, fmt.Errorf("only one of `-encryption.keyFile`, `-encryption.awsKMSKeyID` and `-encryption.gcpKMSKeyName` may be set")
+	}
+	switch {
+	case len(*encryptionKeyFile) > 0:
+		return encryption.NewKeyFileWrapper(*encryptionKeyFile)
+	case len(*encryptionAWSKMSKeyID) > 0:
+		cfg := &encryption.AWSKMSConfig{
+			KeyID:          *encryptionAWSKMSKeyID,
+			CredsFilePath:  *credsFilePath,
+			ConfigFilePath: *configFilePath,
+			ProfileName:    *configProfile,
+		}
+		return encryption.NewAWSKMSWrapper(cfg)
+	case len(*encryptionGCPKMSKeyName) > 0:
+		return encryption.NewGCPKMSWrapper(*encryptionGCPKMSKeyName, *credsFilePath)
+	default:
+		return nil, nil
+	}
+}
+
+func newRemoteFS(path string) (common.RemoteFS, error) {
 	if len(path) == 0 {
 		return nil, fmt.Errorf("path cannot be empty")
 	}
 	n := strings.Index(path, "://")
 	if n < 0 {
-		return nil, fmt.Errorf("Missing scheme in path %q. Supported schemes: `gcs://`, `s3://`, `fs://`", path)
+		return nil, fmt.Errorf("Missing scheme in path %q. Supported schemes: `gcs://`, `s3://`, `azblob://`, `sftp://`, `fs://`", path)
 	}
 	scheme := path[:n]
 	dir := path[n+len("://"):]
@@ -230,6 +314,48 @@ func NewRemoteFS(path string) (common.RemoteFS, error) {
 			return nil, fmt.Errorf("cannot initialize connection to s3: %w", err)
 		}
 		return fs, nil
+	case "azblob":
+		n := strings.Index(dir, "/")
+		if n < 0 {
+			return nil, fmt.Errorf("missing directory on the azblob container %q", dir)
+		}
+		container := dir[:n]
+		dir = dir[n:]
+		fs := &azremote.FS{
+			AccountName:             *azureAccountName,
+			Endpoint:                *customAzureEndpoint,
+			SASToken:                *azureSASToken,
+			ManagedIdentityClientID: *azureManagedIdentityClientID,
+			Container:               container,
+			Dir:                     dir,
+		}
+		if err := fs.Init(); err != nil {
+			return nil, fmt.Errorf("cannot initialize connection to azblob: %w", err)
+		}
+		return fs, nil
+	case "sftp":
+		n := strings.Index(dir, "/")
+		if n < 0 {
+			return nil, fmt.Errorf("missing directory on the sftp server %q", dir)
+		}
+		addr := dir[:n]
+		dir = dir[n:]
+		n = strings.LastIndex(addr, "@")
+		if n < 0 {
+			return nil, fmt.Errorf("missing user in sftp path %q; it must have the form sftp://user@host[:port]/path/to/dir", path)
+		}
+		fs := &sftpremote.FS{
+			User:               addr[:n],
+			Addr:               addr[n+1:],
+			Dir:                dir,
+			KeyFilePath:        *sftpKeyFile,
+			PasswordFilePath:   *sftpPasswordFile,
+			KnownHostsFilePath: *sftpKnownHostsFile,
+		}
+		if err := fs.Init(); err != nil {
+			return nil, fmt.Errorf("cannot initialize connection to sftp: %w", err)
+		}
+		return fs, nil
 	default:
 		return nil, fmt.Errorf("unsupported scheme %q", scheme)
 	}
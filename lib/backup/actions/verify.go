@@ -0,0 +1,244 @@
+package actions
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/common"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/fscommon"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+// Verify verifies backup according to the provided settings.
+//
+// It checks that the backup is complete, that all the parts listed in the backup manifest exist
+// and that the checksums for the part data match the checksums stored in the manifest.
+// Only the chunks with checksums are downloaded, so the backup isn't downloaded as a whole.
+type Verify struct {
+	// Concurrency is the number of concurrent workers during the verification.
+	// Concurrency=1 is used by default.
+	Concurrency int
+
+	// Src is the backup to verify.
+	Src common.RemoteFS
+
+	// ChunksPerPart is the number of randomly selected chunks to verify per each part.
+	//
+	// All the chunks are verified if ChunksPerPart is negative.
+	// Only the presence and sizes of parts are verified if ChunksPerPart is zero.
+	ChunksPerPart int
+}
+
+// Run runs v with the provided settings.
+//
+// It returns an error if the backup is incomplete or contains missing or corrupted parts.
+func (v *Verify) Run() error {
+	startTime := time.Now()
+	src := v.Src
+	vs := &verifyStats{}
+
+	logger.Infof("starting verification of %s", src)
+
+	ok, err := src.HasFile(fscommon.BackupCompleteFilename)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		vs.errorf("cannot find %s file in %s; the backup is incomplete", fscommon.BackupCompleteFilename, src)
+	}
+
+	srcParts, err := src.ListParts()
+	if err != nil {
+		return fmt.Errorf("cannot list parts at %s: %w", src, err)
+	}
+	logger.Infof("obtained %d parts from %s", len(srcParts), src)
+
+	var mps []common.ManifestPart
+	ok, err = src.HasFile(fscommon.BackupManifestFilename)
+	if err != nil {
+		return err
+	}
+	if ok {
+		data, err := src.ReadFile(fscommon.BackupManifestFilename)
+		if err != nil {
+			return err
+		}
+		m, err := common.ParseManifest(data)
+		if err != nil {
+			return fmt.Errorf("cannot read manifest from %s: %w", src, err)
+		}
+		mps = m.Parts
+		logger.Infof("obtained %d parts from manifest at %s", len(mps), src)
+	} else {
+		// Backups made by older vmbackup versions have no manifest.
+		// Verify only the presence and sizes of parts for them.
+		logger.Infof("cannot find manifest at %s; verifying only sizes of the stored parts", src)
+		for _, p := range srcParts {
+			mps = append(mps, common.NewManifestPart(p, "", nil))
+		}
+	}
+
+	// Verify that all the parts from the manifest exist.
+	locations := map[string]*verifyLocation{
+		"": newVerifyLocation(src, srcParts),
+	}
+	defer func() {
+		for location, vl := range locations {
+			if location != "" && vl.fs != nil {
+				vl.fs.MustStop()
+			}
+		}
+	}()
+	var parts []common.Part
+	partFS := make(map[common.Part]common.RemoteFS, len(mps))
+	var partsToCheck []common.ManifestPart
+	for _, mp := range mps {
+		p := mp.Part()
+		vl := locations[mp.Location]
+		if vl == nil {
+			vl = openVerifyLocation(mp.Location, vs)
+			locations[mp.Location] = vl
+		}
+		if vl.fs == nil {
+			vs.errorf("cannot verify %s, since the backup at %q holding it cannot be opened", &p, mp.Location)
+			continue
+		}
+		actualSize, ok := vl.sizes[p]
+		if !ok {
+			vs.errorf("missing %s at %s", &p, vl.fs)
+			continue
+		}
+		p.ActualSize = actualSize
+		parts = append(parts, p)
+		if actualSize != p.Size {
+			vs.errorf("invalid size for %s at %s; got %d bytes; want %d bytes", &p, vl.fs, actualSize, p.Size)
+			continue
+		}
+		partFS[p] = vl.fs
+		partsToCheck = append(partsToCheck, mp)
+	}
+	if vs.errors == 0 {
+		if err := validatePartsCoverage(parts); err != nil {
+			vs.errorf("the parts at %s don't cover the backed up files: %s", src, err)
+		}
+	}
+
+	// Verify checksums for the existing parts.
+	checksums := make(map[common.Part][]uint64, len(partsToCheck))
+	var checkParts []common.Part
+	for _, mp := range partsToCheck {
+		p := mp.Part()
+		if mp.Checksums == nil {
+			vs.unverifiedParts++
+			continue
+		}
+		checksums[p] = mp.Checksums
+		checkParts = append(checkParts, p)
+	}
+	if v.ChunksPerPart != 0 && len(checkParts) > 0 {
+		logger.Infof("verifying checksums for %d parts", len(checkParts))
+		var rndLock sync.Mutex
+		rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+		err = runParallel(v.Concurrency, checkParts, func(p common.Part) error {
+			mp := common.NewManifestPart(p, "", checksums[p])
+			idxs := make([]int, len(mp.Checksums))
+			for i := range idxs {
+				idxs[i] = i
+			}
+			if v.ChunksPerPart > 0 && v.ChunksPerPart < len(idxs) {
+				rndLock.Lock()
+				rnd.Shuffle(len(idxs), func(i, j int) {
+					idxs[i], idxs[j] = idxs[j], idxs[i]
+				})
+				rndLock.Unlock()
+				idxs = idxs[:v.ChunksPerPart]
+			}
+			fs := partFS[p]
+			for _, idx := range idxs {
+				offset, size := mp.ChunkRange(idx)
+				cw := common.NewChecksumWriter()
+				if err := fs.DownloadPartRange(p, offset, size, cw); err != nil {
+					vs.errorf("cannot download chunk [%d, %d) of %s from %s: %s", offset, offset+size, &p, fs, err)
+					return nil
+				}
+				atomic.AddUint64(&vs.bytesRead, size)
+				if got := cw.Checksums(); len(got) != 1 || got[0] != mp.Checksums[idx] {
+					vs.errorf("checksum mismatch for chunk [%d, %d) of %s at %s; the part is corrupted", offset, offset+size, &p, fs)
+					return nil
+				}
+			}
+			return nil
+		}, func(elapsed time.Duration) {
+			n := atomic.LoadUint64(&vs.bytesRead)
+			logger.Infof("verified checksums for %d bytes at %s in %s", n, src, elapsed)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if vs.unverifiedParts > 0 {
+		logger.Infof("%d parts have no checksums in the manifest at %s, so only their sizes are verified", vs.unverifiedParts, src)
+	}
+
+	logger.Infof("verified %d parts from %s in %.3f seconds; downloaded %d bytes; found %d problems",
+		len(mps), src, time.Since(startTime).Seconds(), vs.bytesRead, vs.errors)
+	if vs.errors > 0 {
+		return fmt.Errorf("found %d problems in %s; see the log above for details", vs.errors, src)
+	}
+	return nil
+}
+
+type verifyStats struct {
+	// bytesRead must be at the top of the struct for proper 64-bit alignment for atomic operations on 32-bit archs.
+	bytesRead uint64
+
+	errorsLock sync.Mutex
+	errors     int
+
+	unverifiedParts int
+}
+
+func (vs *verifyStats) errorf(format string, args ...interface{}) {
+	logger.Errorf(format, args...)
+	vs.errorsLock.Lock()
+	vs.errors++
+	vs.errorsLock.Unlock()
+}
+
+// verifyLocation contains sizes for parts stored at fs.
+type verifyLocation struct {
+	fs    common.RemoteFS
+	sizes map[common.Part]uint64
+}
+
+func newVerifyLocation(fs common.RemoteFS, parts []common.Part) *verifyLocation {
+	sizes := make(map[common.Part]uint64, len(parts))
+	for _, p := range parts {
+		actualSize := p.ActualSize
+		p.ActualSize = p.Size
+		sizes[p] = actualSize
+	}
+	return &verifyLocation{
+		fs:    fs,
+		sizes: sizes,
+	}
+}
+
+func openVerifyLocation(location string, vs *verifyStats) *verifyLocation {
+	fs, err := newReferencedFS(location, false)
+	if err != nil {
+		vs.errorf("cannot open backup %q referenced from the manifest: %s", location, err)
+		return &verifyLocation{}
+	}
+	parts, err := fs.ListParts()
+	if err != nil {
+		vs.errorf("cannot list parts at %s: %s", fs, err)
+		fs.MustStop()
+		return &verifyLocation{}
+	}
+	logger.Infof("obtained %d parts from %s referenced from the manifest", len(parts), fs)
+	return newVerifyLocation(fs, parts)
+}
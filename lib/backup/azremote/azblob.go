@@ -0,0 +1,500 @@
+package azremote
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/common"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/fscommon"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+// apiVersion is the version of Azure Blob Storage REST API.
+//
+// See https://docs.microsoft.com/en-us/rest/api/storageservices/versioning-for-the-azure-storage-services
+const apiVersion = "2020-10-02"
+
+// FS represents filesystem for backups in Azure Blob Storage.
+//
+// Init must be called before calling other FS methods.
+type FS struct {
+	// The name of Azure storage account.
+	AccountName string
+
+	// Blob service endpoint. https://<AccountName>.blob.core.windows.net is used if empty.
+	Endpoint string
+
+	// Shared access signature (SAS) token for authentication.
+	//
+	// Managed identity is used for authentication if empty.
+	SASToken string
+
+	// Client id of user-assigned managed identity.
+	//
+	// System-assigned managed identity is used if empty.
+	ManagedIdentityClientID string
+
+	// Container to use.
+	Container string
+
+	// Directory in the container to write to.
+	Dir string
+
+	client *http.Client
+
+	tokenLock     sync.Mutex
+	token         string
+	tokenDeadline time.Time
+}
+
+// Init initializes fs.
+//
+// The returned fs must be stopped when no long needed with MustStop call.
+func (fs *FS) Init() error {
+	if fs.client != nil {
+		logger.Panicf("BUG: Init is already called")
+	}
+	for strings.HasPrefix(fs.Dir, "/") {
+		fs.Dir = fs.Dir[1:]
+	}
+	if !strings.HasSuffix(fs.Dir, "/") {
+		fs.Dir += "/"
+	}
+	if len(fs.Endpoint) == 0 {
+		if len(fs.AccountName) == 0 {
+			return fmt.Errorf("Azure storage account name cannot be empty")
+		}
+		fs.Endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", fs.AccountName)
+	}
+	fs.Endpoint = strings.TrimRight(fs.Endpoint, "/")
+	fs.SASToken = strings.TrimPrefix(fs.SASToken, "?")
+	fs.client = &http.Client{}
+	if len(fs.SASToken) == 0 {
+		// Verify managed identity is available.
+		if _, err := fs.getToken(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MustStop stops fs.
+func (fs *FS) MustStop() {
+	fs.client = nil
+}
+
+// String returns human-readable description for fs.
+func (fs *FS) String() string {
+	return fmt.Sprintf("AzureBlob{endpoint: %q, container: %q, dir: %q}", fs.Endpoint, fs.Container, fs.Dir)
+}
+
+type listBlobsResult struct {
+	Blobs struct {
+		Blob []struct {
+			Name       string
+			Properties struct {
+				ContentLength int64 `xml:"Content-Length"`
+			}
+		}
+	}
+	NextMarker string
+}
+
+// ListParts returns all the parts for fs.
+func (fs *FS) ListParts() ([]common.Part, error) {
+	dir := fs.Dir
+	var parts []common.Part
+	marker := ""
+	for {
+		args := url.Values{}
+		args.Set("restype", "container")
+		args.Set("comp", "list")
+		args.Set("prefix", dir)
+		if len(marker) > 0 {
+			args.Set("marker", marker)
+		}
+		resp, err := fs.do("GET", fs.containerURL(args), nil, -1, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error when listing blobs inside dir %q at %s: %w", dir, fs, err)
+		}
+		var lbr listBlobsResult
+		err = xml.NewDecoder(resp.Body).Decode(&lbr)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse the list of blobs inside dir %q at %s: %w", dir, fs, err)
+		}
+		for _, b := range lbr.Blobs.Blob {
+			file := b.Name
+			if !strings.HasPrefix(file, dir) {
+				return nil, fmt.Errorf("unexpected prefix for blob %q; want %q", file, dir)
+			}
+			if fscommon.IgnorePath(file) {
+				continue
+			}
+			var p common.Part
+			if !p.ParseFromRemotePath(file[len(dir):]) {
+				logger.Infof("skipping unknown blob %q", file)
+				continue
+			}
+			p.ActualSize = uint64(b.Properties.ContentLength)
+			parts = append(parts, p)
+		}
+		if len(lbr.NextMarker) == 0 {
+			return parts, nil
+		}
+		marker = lbr.NextMarker
+	}
+}
+
+// DeletePart deletes part p from fs.
+func (fs *FS) DeletePart(p common.Part) error {
+	path := fs.path(p)
+	if err := fs.deleteBlob(path); err != nil {
+		return fmt.Errorf("cannot delete %q at %s (remote path %q): %w", p.Path, fs, path, err)
+	}
+	return nil
+}
+
+// RemoveEmptyDirs recursively removes empty dirs in fs.
+func (fs *FS) RemoveEmptyDirs() error {
+	// Azure Blob Storage has no directories, so nothing to remove.
+	return nil
+}
+
+// CopyPart copies p from srcFS to fs.
+func (fs *FS) CopyPart(srcFS common.OriginFS, p common.Part) error {
+	src, ok := srcFS.(*FS)
+	if !ok {
+		return fmt.Errorf("cannot perform server-side copying from %s to %s: both of them must be Azure Blob", srcFS, fs)
+	}
+	srcPath := src.path(p)
+	dstPath := fs.path(p)
+	// The source blob is authorized by its SAS token. Otherwise it must be located in the same storage account as fs,
+	// so it is authorized by the managed identity used for the request.
+	headers := map[string]string{
+		"x-ms-copy-source": src.blobURL(srcPath, true),
+	}
+	resp, err := fs.do("PUT", fs.blobURL(dstPath, false), nil, 0, headers)
+	if err != nil {
+		return fmt.Errorf("cannot copy %q from %s to %s: %w", p.Path, src, fs, err)
+	}
+	_ = resp.Body.Close()
+
+	// Wait until the copying is complete, since it may be performed asynchronously.
+	status := resp.Header.Get("x-ms-copy-status")
+	for status == "pending" {
+		time.Sleep(time.Second)
+		resp, err := fs.do("HEAD", fs.blobURL(dstPath, false), nil, -1, nil)
+		if err != nil {
+			return fmt.Errorf("cannot obtain copy status for %q at %s: %w", p.Path, fs, err)
+		}
+		_ = resp.Body.Close()
+		status = resp.Header.Get("x-ms-copy-status")
+	}
+	if status != "success" {
+		return fmt.Errorf("cannot copy %q from %s to %s: unexpected copy status %q", p.Path, src, fs, status)
+	}
+	return nil
+}
+
+// DownloadPart downloads part p from fs to w.
+func (fs *FS) DownloadPart(p common.Part, w io.Writer) error {
+	path := fs.path(p)
+	resp, err := fs.do("GET", fs.blobURL(path, false), nil, -1, nil)
+	if err != nil {
+		return fmt.Errorf("cannot open %q at %s (remote path %q): %w", p.Path, fs, path, err)
+	}
+	n, err := io.Copy(w, resp.Body)
+	if err1 := resp.Body.Close(); err1 != nil && err == nil {
+		err = err1
+	}
+	if err != nil {
+		return fmt.Errorf("cannot download %q from %s (remote path %q): %w", p.Path, fs, path, err)
+	}
+	if uint64(n) != p.Size {
+		return fmt.Errorf("wrong data size downloaded from %q at %s; got %d bytes; want %d bytes", p.Path, fs, n, p.Size)
+	}
+	return nil
+}
+
+// DownloadPartRange downloads size bytes starting from offset in part p from fs to w.
+func (fs *FS) DownloadPartRange(p common.Part, offset, size uint64, w io.Writer) error {
+	if size == 0 {
+		return nil
+	}
+	path := fs.path(p)
+	headers := map[string]string{
+		"x-ms-range": fmt.Sprintf("bytes=%d-%d", offset, offset+size-1),
+	}
+	resp, err := fs.do("GET", fs.blobURL(path, false), nil, -1, headers)
+	if err != nil {
+		return fmt.Errorf("cannot open %q at %s (remote path %q): %w", p.Path, fs, path, err)
+	}
+	n, err := io.Copy(w, resp.Body)
+	if err1 := resp.Body.Close(); err1 != nil && err == nil {
+		err = err1
+	}
+	if err != nil {
+		return fmt.Errorf("cannot download %q from %s (remote path %q): %w", p.Path, fs, path, err)
+	}
+	if uint64(n) != size {
+		return fmt.Errorf("wrong data size downloaded from %q at %s at offset %d; got %d bytes; want %d bytes", p.Path, fs, offset, n, size)
+	}
+	return nil
+}
+
+// UploadPart uploads part p from r to fs.
+func (fs *FS) UploadPart(p common.Part, r io.Reader) error {
+	path := fs.path(p)
+	sr := &statReader{
+		r: io.LimitReader(r, int64(p.Size)),
+	}
+	if err := fs.putBlob(path, sr, int64(p.Size)); err != nil {
+		return fmt.Errorf("cannot upload data to %q at %s (remote path %q): %w", p.Path, fs, path, err)
+	}
+	if uint64(sr.size) != p.Size {
+		return fmt.Errorf("wrong data size uploaded to %q at %s; got %d bytes; want %d bytes", p.Path, fs, sr.size, p.Size)
+	}
+	// Make sure r contains no more data than p.Size, since the body is limited to p.Size bytes.
+	if n, _ := io.ReadFull(r, make([]byte, 1)); n > 0 {
+		return fmt.Errorf("wrong data size uploaded to %q at %s; got more than %d bytes", p.Path, fs, p.Size)
+	}
+	return nil
+}
+
+// DeleteFile deletes filePath from fs if it exists.
+//
+// The function does nothing if the file doesn't exist.
+func (fs *FS) DeleteFile(filePath string) error {
+	path := fs.Dir + filePath
+	if err := fs.deleteBlob(path); err != nil {
+		if isNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("cannot delete %q at %s (remote path %q): %w", filePath, fs, path, err)
+	}
+	return nil
+}
+
+// CreateFile creates filePath at fs and puts data into it.
+//
+// The file is overwritten if it already exists.
+func (fs *FS) CreateFile(filePath string, data []byte) error {
+	path := fs.Dir + filePath
+	if err := fs.putBlob(path, bytes.NewReader(data), int64(len(data))); err != nil {
+		return fmt.Errorf("cannot upload data to %q at %s (remote path %q): %w", filePath, fs, path, err)
+	}
+	return nil
+}
+
+// ReadFile returns the contents of filePath at fs.
+func (fs *FS) ReadFile(filePath string) ([]byte, error) {
+	path := fs.Dir + filePath
+	resp, err := fs.do("GET", fs.blobURL(path, false), nil, -1, nil)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open %q at %s (remote path %q): %w", filePath, fs, path, err)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	if err1 := resp.Body.Close(); err1 != nil && err == nil {
+		err = err1
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %q at %s (remote path %q): %w", filePath, fs, path, err)
+	}
+	return data, nil
+}
+
+// HasFile returns true if filePath exists at fs.
+func (fs *FS) HasFile(filePath string) (bool, error) {
+	path := fs.Dir + filePath
+	resp, err := fs.do("HEAD", fs.blobURL(path, false), nil, -1, nil)
+	if err != nil {
+		if isNotFound(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("cannot obtain properties for %q at %s (remote path %q): %w", filePath, fs, path, err)
+	}
+	_ = resp.Body.Close()
+	return true, nil
+}
+
+func (fs *FS) putBlob(path string, r io.Reader, size int64) error {
+	headers := map[string]string{
+		"x-ms-blob-type": "BlockBlob",
+	}
+	resp, err := fs.do("PUT", fs.blobURL(path, false), r, size, headers)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	return nil
+}
+
+func (fs *FS) deleteBlob(path string) error {
+	resp, err := fs.do("DELETE", fs.blobURL(path, false), nil, -1, nil)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	return nil
+}
+
+func (fs *FS) path(p common.Part) string {
+	return p.RemotePath(fs.Dir)
+}
+
+func (fs *FS) containerURL(args url.Values) string {
+	return fmt.Sprintf("%s/%s?%s", fs.Endpoint, url.PathEscape(fs.Container), fs.withSAS(args.Encode()))
+}
+
+// blobURL returns url for the blob at the given path.
+//
+// SAS token is added to the url if withSAS is set or if the url is used for the request to fs.
+func (fs *FS) blobURL(path string, withSAS bool) string {
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	u := fmt.Sprintf("%s/%s/%s", fs.Endpoint, url.PathEscape(fs.Container), strings.Join(segments, "/"))
+	if withSAS || len(fs.SASToken) > 0 {
+		if q := fs.withSAS(""); len(q) > 0 {
+			u += "?" + q
+		}
+	}
+	return u
+}
+
+func (fs *FS) withSAS(query string) string {
+	if len(fs.SASToken) == 0 {
+		return query
+	}
+	if len(query) == 0 {
+		return fs.SASToken
+	}
+	return query + "&" + fs.SASToken
+}
+
+// statusError is returned when Azure Blob Storage responds with unexpected status code.
+type statusError struct {
+	statusCode int
+	body       []byte
+}
+
+func (se *statusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d; response body: %q", se.statusCode, se.body)
+}
+
+func isNotFound(err error) bool {
+	se, ok := err.(*statusError)
+	return ok && se.statusCode == http.StatusNotFound
+}
+
+// do performs the request to Azure Blob Storage and returns the response on success.
+//
+// The caller must close the response body. size must be set to -1 if the body is empty.
+func (fs *FS) do(method, u string, body io.Reader, size int64, headers map[string]string) (*http.Response, error) {
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create request: %w", err)
+	}
+	if size >= 0 {
+		req.ContentLength = size
+		if size == 0 {
+			req.Body = http.NoBody
+		}
+	}
+	req.Header.Set("x-ms-version", apiVersion)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	if len(fs.SASToken) == 0 {
+		token, err := fs.getToken()
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := fs.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		data, _ := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		return nil, &statusError{
+			statusCode: resp.StatusCode,
+			body:       data,
+		}
+	}
+	return resp, nil
+}
+
+// getToken returns OAuth token for the managed identity.
+//
+// See https://docs.microsoft.com/en-us/azure/active-directory/managed-identities-azure-resources/how-to-use-vm-token#get-a-token-using-http
+func (fs *FS) getToken() (string, error) {
+	fs.tokenLock.Lock()
+	defer fs.tokenLock.Unlock()
+	if len(fs.token) > 0 && time.Now().Before(fs.tokenDeadline) {
+		return fs.token, nil
+	}
+	args := url.Values{}
+	args.Set("api-version", "2018-02-01")
+	args.Set("resource", "https://storage.azure.com/")
+	if len(fs.ManagedIdentityClientID) > 0 {
+		args.Set("client_id", fs.ManagedIdentityClientID)
+	}
+	req, err := http.NewRequest("GET", "http://169.254.169.254/metadata/identity/oauth2/token?"+args.Encode(), nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot create request for managed identity token: %w", err)
+	}
+	req.Header.Set("Metadata", "true")
+	resp, err := fs.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("cannot obtain managed identity token; make sure managed identity is enabled or set SAS token: %w", err)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return "", fmt.Errorf("cannot read managed identity token: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code when obtaining managed identity token: %d; response body: %q", resp.StatusCode, data)
+	}
+	var t struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   string `json:"expires_in"`
+	}
+	if err := json.Unmarshal(data, &t); err != nil {
+		return "", fmt.Errorf("cannot parse managed identity token: %w", err)
+	}
+	expiresIn, err := strconv.ParseInt(t.ExpiresIn, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("cannot parse expires_in=%q for managed identity token: %w", t.ExpiresIn, err)
+	}
+	fs.token = t.AccessToken
+	// Refresh the token in advance, so it doesn't expire during long uploads.
+	fs.tokenDeadline = time.Now().Add(time.Duration(expiresIn)*time.Second - 5*time.Minute)
+	return fs.token, nil
+}
+
+type statReader struct {
+	r    io.Reader
+	size int64
+}
+
+func (sr *statReader) Read(p []byte) (int, error) {
+	n, err := sr.r.Read(p)
+	sr.size += int64(n)
+	return n, err
+}
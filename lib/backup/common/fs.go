@@ -42,6 +42,9 @@ type RemoteFS interface {
 	// DownloadPart must download part p from RemoteFS to w.
 	DownloadPart(p Part, w io.Writer) error
 
+	// DownloadPartRange must download size bytes starting from offset in part p from RemoteFS to w.
+	DownloadPartRange(p Part, offset, size uint64, w io.Writer) error
+
 	// UploadPart must upload part p from r to RemoteFS.
 	UploadPart(p Part, r io.Reader) error
 
@@ -53,4 +56,7 @@ type RemoteFS interface {
 
 	// HasFile returns true if filePath exists at RemoteFS.
 	HasFile(filePath string) (bool, error)
+
+	// ReadFile returns the contents of filePath at RemoteFS.
+	ReadFile(filePath string) ([]byte, error)
 }
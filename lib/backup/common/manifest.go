@@ -0,0 +1,154 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+
+	xxhash "github.com/cespare/xxhash/v2"
+)
+
+// Manifest describes the contents of incremental backup.
+//
+// It lists all the parts required for restoring the backup together with
+// locations of the backups holding these parts, so unchanged parts
+// aren't uploaded again, but are referenced from the previous backups instead.
+type Manifest struct {
+	Parts []ManifestPart `json:"parts"`
+}
+
+// ManifestPart is a part listed in Manifest.
+type ManifestPart struct {
+	Path     string `json:"path"`
+	FileSize uint64 `json:"file_size"`
+	Offset   uint64 `json:"offset"`
+	Size     uint64 `json:"size"`
+
+	// Location is the backup location holding the part data, e.g. `s3://bucket/path/to/backup`.
+	//
+	// Empty Location means the part is stored in the backup containing the manifest.
+	Location string `json:"location,omitempty"`
+
+	// Checksums contains xxhash checksums for the part data split into ChecksumChunkSize chunks.
+	//
+	// Checksums may be missing for parts backed up by older vmbackup versions.
+	Checksums []uint64 `json:"checksums,omitempty"`
+}
+
+// ChecksumChunkSize is the size of part chunks with checksums in Manifest.
+//
+// Chunks are small enough for verifying backups via ranged reads without downloading the whole parts.
+const ChecksumChunkSize = 16 * 1024 * 1024
+
+// NewManifestPart returns ManifestPart for p stored at the given location.
+func NewManifestPart(p Part, location string, checksums []uint64) ManifestPart {
+	return ManifestPart{
+		Path:      p.Path,
+		FileSize:  p.FileSize,
+		Offset:    p.Offset,
+		Size:      p.Size,
+		Location:  location,
+		Checksums: checksums,
+	}
+}
+
+// Part returns the part for mp.
+func (mp *ManifestPart) Part() Part {
+	return Part{
+		Path:       mp.Path,
+		FileSize:   mp.FileSize,
+		Offset:     mp.Offset,
+		Size:       mp.Size,
+		ActualSize: mp.Size,
+	}
+}
+
+// Marshal returns JSON representation of m.
+func (m *Manifest) Marshal() ([]byte, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal manifest: %w", err)
+	}
+	return data, nil
+}
+
+// ParseManifest parses manifest from data.
+func ParseManifest(data []byte) (*Manifest, error) {
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("cannot parse manifest: %w", err)
+	}
+	for i := range m.Parts {
+		mp := &m.Parts[i]
+		if mp.Path == "" {
+			return nil, fmt.Errorf("missing path for part #%d in manifest", i)
+		}
+		if mp.Offset+mp.Size > mp.FileSize {
+			return nil, fmt.Errorf("part %s exceeds file size", &Part{Path: mp.Path, FileSize: mp.FileSize, Offset: mp.Offset, Size: mp.Size})
+		}
+		if mp.Checksums != nil && uint64(len(mp.Checksums)) != checksumChunks(mp.Size) {
+			return nil, fmt.Errorf("unexpected number of checksums for part %s; got %d; want %d",
+				&Part{Path: mp.Path, FileSize: mp.FileSize, Offset: mp.Offset, Size: mp.Size}, len(mp.Checksums), checksumChunks(mp.Size))
+		}
+	}
+	return &m, nil
+}
+
+func checksumChunks(size uint64) uint64 {
+	return (size + ChecksumChunkSize - 1) / ChecksumChunkSize
+}
+
+// ChecksumWriter calculates checksums for ChecksumChunkSize chunks of data written to it.
+type ChecksumWriter struct {
+	d         *xxhash.Digest
+	n         int
+	checksums []uint64
+}
+
+// NewChecksumWriter returns new ChecksumWriter.
+func NewChecksumWriter() *ChecksumWriter {
+	return &ChecksumWriter{
+		d:         xxhash.New(),
+		checksums: []uint64{},
+	}
+}
+
+// Write calculates checksums for p.
+func (cw *ChecksumWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		m := ChecksumChunkSize - cw.n
+		if m > len(p) {
+			m = len(p)
+		}
+		_, _ = cw.d.Write(p[:m])
+		cw.n += m
+		p = p[m:]
+		if cw.n == ChecksumChunkSize {
+			cw.checksums = append(cw.checksums, cw.d.Sum64())
+			cw.d.Reset()
+			cw.n = 0
+		}
+	}
+	return n, nil
+}
+
+// Checksums returns checksums for the data written to cw.
+//
+// cw mustn't be used after the call.
+func (cw *ChecksumWriter) Checksums() []uint64 {
+	if cw.n > 0 {
+		cw.checksums = append(cw.checksums, cw.d.Sum64())
+		cw.n = 0
+	}
+	return cw.checksums
+}
+
+// ChunkRange returns offset and size for the chunk with the given checksum index in mp.
+func (mp *ManifestPart) ChunkRange(idx int) (uint64, uint64) {
+	offset := uint64(idx) * ChecksumChunkSize
+	size := mp.Size - offset
+	if size > ChecksumChunkSize {
+		size = ChecksumChunkSize
+	}
+	return offset, size
+}
@@ -0,0 +1,189 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/common"
+)
+
+// FS encrypts parts uploaded to the underlying RemoteFS and decrypts parts downloaded from it.
+//
+// Parts are stored in the underlying RemoteFS with encrypted sizes, so encrypted and unencrypted parts
+// never clash. Files such as `backup complete` file and manifest file are stored unencrypted,
+// since they contain no data.
+type FS struct {
+	fs common.RemoteFS
+	kw *cachingKeyWrapper
+
+	// dataKey is used for encrypting all the parts uploaded via FS.
+	// It is generated on the first upload.
+	dataKeyLock sync.Mutex
+	dataKey     []byte
+	wrappedKey  []byte
+}
+
+// NewFS returns FS, which encrypts data stored in fs with data keys wrapped by kw.
+func NewFS(fs common.RemoteFS, kw KeyWrapper) *FS {
+	return &FS{
+		fs: fs,
+		kw: newCachingKeyWrapper(kw),
+	}
+}
+
+// MustStop stops fs.
+func (fs *FS) MustStop() {
+	fs.fs.MustStop()
+}
+
+// String returns human-readable description for fs.
+func (fs *FS) String() string {
+	return fmt.Sprintf("encrypted %s with %s", fs.fs, fs.kw.kw)
+}
+
+// ListParts returns all the parts for fs.
+func (fs *FS) ListParts() ([]common.Part, error) {
+	parts, err := fs.fs.ListParts()
+	if err != nil {
+		return nil, err
+	}
+	for i := range parts {
+		p := &parts[i]
+		size, ok := PlaintextSize(p.Size)
+		if !ok {
+			return nil, fmt.Errorf("unexpected size for encrypted %s at %s; the part may be unencrypted", p, fs.fs)
+		}
+		actualSize := size
+		if p.ActualSize != p.Size {
+			// The encrypted part is broken, so mark the decrypted part as broken too.
+			actualSize = size + 1
+		}
+		p.Size = size
+		p.ActualSize = actualSize
+	}
+	return parts, nil
+}
+
+// DeletePart deletes part p from fs.
+func (fs *FS) DeletePart(p common.Part) error {
+	return fs.fs.DeletePart(encryptedPart(p))
+}
+
+// RemoveEmptyDirs recursively removes empty dirs in fs.
+func (fs *FS) RemoveEmptyDirs() error {
+	return fs.fs.RemoveEmptyDirs()
+}
+
+// CopyPart copies p from srcFS to fs.
+//
+// srcFS must be encrypted, since the part is copied as is.
+func (fs *FS) CopyPart(srcFS common.OriginFS, p common.Part) error {
+	src, ok := srcFS.(*FS)
+	if !ok {
+		return fmt.Errorf("cannot perform server-side copying from %s to %s: both of them must be encrypted", srcFS, fs)
+	}
+	return fs.fs.CopyPart(src.fs, encryptedPart(p))
+}
+
+// DownloadPart downloads part p from fs, decrypts it and writes the decrypted data to w.
+func (fs *FS) DownloadPart(p common.Part, w io.Writer) error {
+	dw := newDecryptWriter(w, fs.kw.UnwrapKey)
+	if err := fs.fs.DownloadPart(encryptedPart(p), dw); err != nil {
+		return err
+	}
+	if err := dw.Close(); err != nil {
+		return fmt.Errorf("cannot decrypt %s from %s: %w", &p, fs, err)
+	}
+	return nil
+}
+
+// DownloadPartRange downloads size bytes starting from offset in part p from fs and writes the decrypted data to w.
+//
+// Only the encrypted chunks holding the requested range are downloaded.
+func (fs *FS) DownloadPartRange(p common.Part, offset, size uint64, w io.Writer) error {
+	if size == 0 {
+		return nil
+	}
+	if offset+size > p.Size {
+		return fmt.Errorf("cannot download range [%d, %d) from %s at %s: the range exceeds part size", offset, offset+size, &p, fs)
+	}
+	ep := encryptedPart(p)
+	var bb bytes.Buffer
+	if err := fs.fs.DownloadPartRange(ep, 0, headerSize, &bb); err != nil {
+		return err
+	}
+	aead, err := parseHeader(bb.Bytes(), fs.kw.UnwrapKey)
+	if err != nil {
+		return fmt.Errorf("cannot decrypt %s from %s: %w", &p, fs, err)
+	}
+	_, encOffset, encSize := chunkRange(p.Size, offset, size)
+	rw := newRangeDecryptWriter(w, aead, p.Size, offset, size)
+	if err := fs.fs.DownloadPartRange(ep, encOffset, encSize, rw); err != nil {
+		return fmt.Errorf("cannot decrypt %s from %s: %w", &p, fs, err)
+	}
+	if rw.remaining > 0 {
+		return fmt.Errorf("cannot decrypt %s from %s: missing %d bytes at the end of range", &p, fs, rw.remaining)
+	}
+	return nil
+}
+
+// UploadPart encrypts data from r and uploads it to part p at fs.
+func (fs *FS) UploadPart(p common.Part, r io.Reader) error {
+	dataKey, wrappedKey, err := fs.getDataKey()
+	if err != nil {
+		return err
+	}
+	er, err := newEncryptReader(r, dataKey, wrappedKey)
+	if err != nil {
+		return fmt.Errorf("cannot encrypt %s for %s: %w", &p, fs, err)
+	}
+	return fs.fs.UploadPart(encryptedPart(p), er)
+}
+
+// DeleteFile deletes filePath from fs if it exists.
+func (fs *FS) DeleteFile(filePath string) error {
+	return fs.fs.DeleteFile(filePath)
+}
+
+// CreateFile creates filePath at fs and puts data into it.
+func (fs *FS) CreateFile(filePath string, data []byte) error {
+	return fs.fs.CreateFile(filePath, data)
+}
+
+// HasFile returns true if filePath exists at fs.
+func (fs *FS) HasFile(filePath string) (bool, error) {
+	return fs.fs.HasFile(filePath)
+}
+
+// ReadFile returns the contents of filePath at fs.
+func (fs *FS) ReadFile(filePath string) ([]byte, error) {
+	return fs.fs.ReadFile(filePath)
+}
+
+func (fs *FS) getDataKey() ([]byte, []byte, error) {
+	fs.dataKeyLock.Lock()
+	defer fs.dataKeyLock.Unlock()
+	if fs.dataKey != nil {
+		return fs.dataKey, fs.wrappedKey, nil
+	}
+	dataKey := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, nil, fmt.Errorf("cannot generate data key: %w", err)
+	}
+	wrappedKey, err := fs.kw.kw.WrapKey(dataKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot wrap data key with %s: %w", fs.kw.kw, err)
+	}
+	fs.dataKey = dataKey
+	fs.wrappedKey = wrappedKey
+	return dataKey, wrappedKey, nil
+}
+
+func encryptedPart(p common.Part) common.Part {
+	p.Size = EncryptedSize(p.Size)
+	p.ActualSize = p.Size
+	return p
+}
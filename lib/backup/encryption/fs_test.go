@@ -0,0 +1,155 @@
+package encryption
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/common"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/fsremote"
+)
+
+func TestFS(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "encrypted-fs")
+	if err != nil {
+		t.Fatalf("cannot create temporary dir: %s", err)
+	}
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+
+	newKeyWrapper := func(key string) KeyWrapper {
+		t.Helper()
+		path := filepath.Join(tmpDir, key+".key")
+		data := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte(key), dataKeySize/len(key)))
+		if err := ioutil.WriteFile(path, []byte(data+"\n"), 0600); err != nil {
+			t.Fatalf("cannot write key file: %s", err)
+		}
+		kw, err := NewKeyFileWrapper(path)
+		if err != nil {
+			t.Fatalf("cannot create key wrapper: %s", err)
+		}
+		return kw
+	}
+	kw := newKeyWrapper("abcd")
+	newFS := func(dir string, kw KeyWrapper) *FS {
+		return NewFS(&fsremote.FS{Dir: filepath.Join(tmpDir, dir)}, kw)
+	}
+
+	data := bytes.Repeat([]byte("foobar"), 50000)
+	p := common.Part{
+		Path:     "foo/bar",
+		FileSize: uint64(len(data)),
+		Size:     uint64(len(data)),
+	}
+	fs := newFS("backup", kw)
+	if err := fs.UploadPart(p, bytes.NewReader(data)); err != nil {
+		t.Fatalf("cannot upload part: %s", err)
+	}
+
+	// Verify the part is stored encrypted.
+	innerParts, err := fs.fs.ListParts()
+	if err != nil {
+		t.Fatalf("cannot list inner parts: %s", err)
+	}
+	if len(innerParts) != 1 || innerParts[0].Size != EncryptedSize(p.Size) {
+		t.Fatalf("unexpected inner parts: %v", innerParts)
+	}
+	var bb bytes.Buffer
+	if err := fs.fs.DownloadPart(innerParts[0], &bb); err != nil {
+		t.Fatalf("cannot download inner part: %s", err)
+	}
+	if bytes.Contains(bb.Bytes(), []byte("foobar")) {
+		t.Fatalf("the part isn't encrypted")
+	}
+
+	// Verify the part can be listed, copied and downloaded via encrypted fs.
+	parts, err := fs.ListParts()
+	if err != nil {
+		t.Fatalf("cannot list parts: %s", err)
+	}
+	expectedPart := p
+	expectedPart.ActualSize = p.Size
+	if len(parts) != 1 || parts[0] != expectedPart {
+		t.Fatalf("unexpected parts; got %v; want %v", parts, []common.Part{expectedPart})
+	}
+	fsCopy := newFS("copy", kw)
+	if err := fsCopy.CopyPart(fs, p); err != nil {
+		t.Fatalf("cannot copy part: %s", err)
+	}
+	bb.Reset()
+	if err := fsCopy.DownloadPart(p, &bb); err != nil {
+		t.Fatalf("cannot download part: %s", err)
+	}
+	if !bytes.Equal(bb.Bytes(), data) {
+		t.Fatalf("unexpected data downloaded")
+	}
+
+	// Server-side copy from unencrypted fs must fail.
+	if err := fsCopy.CopyPart(fs.fs, p); err == nil {
+		t.Fatalf("expecting non-nil error when copying from unencrypted fs")
+	}
+
+	// Download with another key must fail.
+	fsOther := newFS("backup", newKeyWrapper("efgh"))
+	if err := fsOther.DownloadPart(p, ioutil.Discard); err == nil {
+		t.Fatalf("expecting non-nil error when downloading with another key")
+	}
+}
+
+func TestFSDownloadPartRange(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "encrypted-fs-range")
+	if err != nil {
+		t.Fatalf("cannot create temporary dir: %s", err)
+	}
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+
+	keyPath := filepath.Join(tmpDir, "key")
+	key := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte("k"), dataKeySize))
+	if err := ioutil.WriteFile(keyPath, []byte(key), 0600); err != nil {
+		t.Fatalf("cannot write key file: %s", err)
+	}
+	kw, err := NewKeyFileWrapper(keyPath)
+	if err != nil {
+		t.Fatalf("cannot create key wrapper: %s", err)
+	}
+	fs := NewFS(&fsremote.FS{Dir: filepath.Join(tmpDir, "backup")}, kw)
+
+	data := make([]byte, 3*chunkSize+123)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	p := common.Part{
+		Path:     "foo/bar",
+		FileSize: uint64(len(data)),
+		Size:     uint64(len(data)),
+	}
+	if err := fs.UploadPart(p, bytes.NewReader(data)); err != nil {
+		t.Fatalf("cannot upload part: %s", err)
+	}
+
+	f := func(offset, size uint64) {
+		t.Helper()
+		var bb bytes.Buffer
+		if err := fs.DownloadPartRange(p, offset, size, &bb); err != nil {
+			t.Fatalf("cannot download range [%d, %d): %s", offset, offset+size, err)
+		}
+		if !bytes.Equal(bb.Bytes(), data[offset:offset+size]) {
+			t.Fatalf("unexpected data downloaded for range [%d, %d)", offset, offset+size)
+		}
+	}
+	f(0, 0)
+	f(0, 1)
+	f(0, chunkSize)
+	f(10, chunkSize)
+	f(chunkSize-1, 2)
+	f(chunkSize, chunkSize)
+	f(2*chunkSize+5, chunkSize+100)
+	f(3*chunkSize, 123)
+	f(0, p.Size)
+
+	if err := fs.DownloadPartRange(p, p.Size-1, 2, ioutil.Discard); err == nil {
+		t.Fatalf("expecting non-nil error when downloading range outside the part")
+	}
+}
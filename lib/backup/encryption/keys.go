@@ -0,0 +1,295 @@
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/kms"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// dataKeySize is the size of data key used for encrypting backup objects.
+const dataKeySize = 32
+
+// KeyWrapper wraps and unwraps data keys used for encrypting backup objects.
+type KeyWrapper interface {
+	// WrapKey encrypts dataKey, so it may be stored together with the encrypted data.
+	WrapKey(dataKey []byte) ([]byte, error)
+
+	// UnwrapKey decrypts wrappedKey returned from WrapKey.
+	UnwrapKey(wrappedKey []byte) ([]byte, error)
+
+	// String returns human-readable description for the KeyWrapper.
+	String() string
+}
+
+// NewKeyFileWrapper returns KeyWrapper, which uses the key from the given file.
+//
+// The file must contain base64-encoded 32-byte key. Such a key can be generated with `openssl rand -base64 32`.
+func NewKeyFileWrapper(path string) (KeyWrapper, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read encryption key file: %w", err)
+	}
+	key, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(data)))
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode base64-encoded encryption key from %q: %w", path, err)
+	}
+	if len(key) != dataKeySize {
+		return nil, fmt.Errorf("unexpected encryption key size in %q; got %d bytes; want %d bytes", path, len(key), dataKeySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &keyFileWrapper{
+		path: path,
+		aead: aead,
+	}, nil
+}
+
+type keyFileWrapper struct {
+	path string
+	aead cipher.AEAD
+}
+
+func (kw *keyFileWrapper) WrapKey(dataKey []byte) ([]byte, error) {
+	nonce := make([]byte, kw.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("cannot generate nonce: %w", err)
+	}
+	return kw.aead.Seal(nonce, nonce, dataKey, nil), nil
+}
+
+func (kw *keyFileWrapper) UnwrapKey(wrappedKey []byte) ([]byte, error) {
+	nonceSize := kw.aead.NonceSize()
+	if len(wrappedKey) < nonceSize {
+		return nil, fmt.Errorf("too short wrapped key; got %d bytes; want at least %d bytes", len(wrappedKey), nonceSize)
+	}
+	dataKey, err := kw.aead.Open(nil, wrappedKey[:nonceSize], wrappedKey[nonceSize:], nil)
+	if err != nil {
+		return nil, fmt.Errorf("the data is encrypted with another key: %w", err)
+	}
+	return dataKey, nil
+}
+
+func (kw *keyFileWrapper) String() string {
+	return fmt.Sprintf("keyFile{path: %q}", kw.path)
+}
+
+// AWSKMSConfig contains settings for AWS KMS.
+type AWSKMSConfig struct {
+	// KeyID is the id, ARN or alias of KMS key.
+	KeyID string
+
+	// Path to AWS credentials file.
+	CredsFilePath string
+
+	// Path to AWS configs file.
+	ConfigFilePath string
+
+	// The name of AWS config profile to use.
+	ProfileName string
+}
+
+// NewAWSKMSWrapper returns KeyWrapper, which uses AWS KMS key for wrapping data keys.
+func NewAWSKMSWrapper(cfg *AWSKMSConfig) (KeyWrapper, error) {
+	opts := session.Options{
+		SharedConfigState: session.SharedConfigEnable,
+		Profile:           cfg.ProfileName,
+	}
+	if len(cfg.CredsFilePath) > 0 {
+		opts.SharedConfigFiles = []string{
+			cfg.ConfigFilePath,
+			cfg.CredsFilePath,
+		}
+	}
+	sess, err := session.NewSessionWithOptions(opts)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create AWS session: %w", err)
+	}
+	return &awsKMSWrapper{
+		keyID: cfg.KeyID,
+		kms:   kms.New(sess),
+	}, nil
+}
+
+type awsKMSWrapper struct {
+	keyID string
+	kms   *kms.KMS
+}
+
+func (kw *awsKMSWrapper) WrapKey(dataKey []byte) ([]byte, error) {
+	input := &kms.EncryptInput{
+		KeyId:     aws.String(kw.keyID),
+		Plaintext: dataKey,
+	}
+	o, err := kw.kms.Encrypt(input)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encrypt data key with AWS KMS key %q: %w", kw.keyID, err)
+	}
+	return o.CiphertextBlob, nil
+}
+
+func (kw *awsKMSWrapper) UnwrapKey(wrappedKey []byte) ([]byte, error) {
+	input := &kms.DecryptInput{
+		KeyId:          aws.String(kw.keyID),
+		CiphertextBlob: wrappedKey,
+	}
+	o, err := kw.kms.Decrypt(input)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt data key with AWS KMS key %q: %w", kw.keyID, err)
+	}
+	return o.Plaintext, nil
+}
+
+func (kw *awsKMSWrapper) String() string {
+	return fmt.Sprintf("AWSKMS{keyID: %q}", kw.keyID)
+}
+
+// NewGCPKMSWrapper returns KeyWrapper, which uses GCP KMS key with the given keyName for wrapping data keys.
+//
+// keyName must have the form projects/<project>/locations/<location>/keyRings/<keyRing>/cryptoKeys/<key>.
+// Default credentials are used if credsFilePath is empty.
+func NewGCPKMSWrapper(keyName, credsFilePath string) (KeyWrapper, error) {
+	const scope = "https://www.googleapis.com/auth/cloudkms"
+	ctx := context.Background()
+	var client *http.Client
+	if len(credsFilePath) > 0 {
+		data, err := ioutil.ReadFile(credsFilePath)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read credsFile: %w", err)
+		}
+		creds, err := google.CredentialsFromJSON(ctx, data, scope)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse credsFile %q: %w", credsFilePath, err)
+		}
+		client = oauth2.NewClient(ctx, creds.TokenSource)
+	} else {
+		c, err := google.DefaultClient(ctx, scope)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create default GCP client: %w", err)
+		}
+		client = c
+	}
+	return &gcpKMSWrapper{
+		keyName: keyName,
+		client:  client,
+	}, nil
+}
+
+type gcpKMSWrapper struct {
+	keyName string
+	client  *http.Client
+}
+
+func (kw *gcpKMSWrapper) WrapKey(dataKey []byte) ([]byte, error) {
+	req := map[string]string{
+		"plaintext": base64.StdEncoding.EncodeToString(dataKey),
+	}
+	var resp struct {
+		Ciphertext string `json:"ciphertext"`
+	}
+	if err := kw.call("encrypt", req, &resp); err != nil {
+		return nil, err
+	}
+	wrappedKey, err := base64.StdEncoding.DecodeString(resp.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode ciphertext returned from GCP KMS: %w", err)
+	}
+	return wrappedKey, nil
+}
+
+func (kw *gcpKMSWrapper) UnwrapKey(wrappedKey []byte) ([]byte, error) {
+	req := map[string]string{
+		"ciphertext": base64.StdEncoding.EncodeToString(wrappedKey),
+	}
+	var resp struct {
+		Plaintext string `json:"plaintext"`
+	}
+	if err := kw.call("decrypt", req, &resp); err != nil {
+		return nil, err
+	}
+	dataKey, err := base64.StdEncoding.DecodeString(resp.Plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode plaintext returned from GCP KMS: %w", err)
+	}
+	return dataKey, nil
+}
+
+func (kw *gcpKMSWrapper) call(method string, req, resp interface{}) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("cannot marshal GCP KMS request: %w", err)
+	}
+	url := fmt.Sprintf("https://cloudkms.googleapis.com/v1/%s:%s", kw.keyName, method)
+	r, err := kw.client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("cannot %s data key with GCP KMS key %q: %w", method, kw.keyName, err)
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	_ = r.Body.Close()
+	if err != nil {
+		return fmt.Errorf("cannot read response from %q: %w", url, err)
+	}
+	if r.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code returned from %q: %d; want %d; response body: %q", url, r.StatusCode, http.StatusOK, body)
+	}
+	if err := json.Unmarshal(body, resp); err != nil {
+		return fmt.Errorf("cannot parse response from %q: %w", url, err)
+	}
+	return nil
+}
+
+func (kw *gcpKMSWrapper) String() string {
+	return fmt.Sprintf("GCPKMS{keyName: %q}", kw.keyName)
+}
+
+// cachingKeyWrapper caches unwrapped data keys, so KMS isn't called for every downloaded object.
+type cachingKeyWrapper struct {
+	kw KeyWrapper
+
+	mu    sync.Mutex
+	cache map[string][]byte
+}
+
+func newCachingKeyWrapper(kw KeyWrapper) *cachingKeyWrapper {
+	return &cachingKeyWrapper{
+		kw:    kw,
+		cache: make(map[string][]byte),
+	}
+}
+
+func (ckw *cachingKeyWrapper) UnwrapKey(wrappedKey []byte) ([]byte, error) {
+	ckw.mu.Lock()
+	defer ckw.mu.Unlock()
+	if dataKey, ok := ckw.cache[string(wrappedKey)]; ok {
+		return dataKey, nil
+	}
+	dataKey, err := ckw.kw.UnwrapKey(wrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(dataKey) != dataKeySize {
+		return nil, fmt.Errorf("unexpected data key size; got %d bytes; want %d bytes", len(dataKey), dataKeySize)
+	}
+	ckw.cache[string(wrappedKey)] = dataKey
+	return dataKey, nil
+}
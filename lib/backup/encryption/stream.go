@@ -0,0 +1,400 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// The format of encrypted object is the following:
+//
+// - header with headerSize bytes: magic | salt | wrapped data key length (uint16) | wrapped data key | zero padding
+// - a sequence of chunks sealed with AES-256-GCM. Every chunk except of the last one contains chunkSize bytes of plaintext.
+//
+// The object key is derived from the data key and the salt, so nonces may be generated from chunk numbers.
+// The last chunk is authenticated with distinct additional data, so truncated objects are detected.
+// The header has fixed size, so the encrypted object size depends only on the plaintext size.
+
+const (
+	magic      = "VMBKENC1"
+	saltSize   = 32
+	headerSize = 512
+	chunkSize  = 64 * 1024
+	tagSize    = 16
+	nonceSize  = 12
+
+	// maxWrappedKeySize is the maximum size of wrapped data key, which fits the header.
+	maxWrappedKeySize = headerSize - len(magic) - saltSize - 2
+)
+
+var (
+	lastChunkAD  = []byte{1}
+	otherChunkAD = []byte{0}
+)
+
+// EncryptedSize returns the size of encrypted object for the plaintext with the given size.
+func EncryptedSize(size uint64) uint64 {
+	chunks := (size + chunkSize - 1) / chunkSize
+	if chunks == 0 {
+		// Empty plaintext is stored as a single empty chunk.
+		chunks = 1
+	}
+	return headerSize + size + chunks*tagSize
+}
+
+// PlaintextSize returns the size of plaintext for encrypted object with the given size.
+//
+// false is returned if there is no plaintext, which encrypts to object with the given size.
+func PlaintextSize(size uint64) (uint64, bool) {
+	if size < headerSize+tagSize {
+		return 0, false
+	}
+	size -= headerSize
+	fullChunks := size / (chunkSize + tagSize)
+	tail := size % (chunkSize + tagSize)
+	if tail == 0 {
+		return fullChunks * chunkSize, true
+	}
+	if tail < tagSize || (tail == tagSize && fullChunks > 0) {
+		return 0, false
+	}
+	return fullChunks*chunkSize + tail - tagSize, true
+}
+
+func newObjectCipher(dataKey, salt []byte) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, dataKey)
+	mac.Write(salt)
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func chunkNonce(dst []byte, n uint64) []byte {
+	dst = dst[:nonceSize]
+	for i := range dst[:nonceSize-8] {
+		dst[i] = 0
+	}
+	binary.BigEndian.PutUint64(dst[nonceSize-8:], n)
+	return dst
+}
+
+// encryptReader encrypts data read from r.
+type encryptReader struct {
+	r    io.Reader
+	aead cipher.AEAD
+
+	// buf contains encrypted data, which isn't read yet.
+	buf    []byte
+	sealed []byte
+
+	// cur contains the plaintext chunk to encrypt next.
+	// isLast is set if cur is the last chunk.
+	cur    []byte
+	next   []byte
+	isLast bool
+	done   bool
+
+	nonce    []byte
+	chunkNum uint64
+}
+
+// newEncryptReader returns reader, which encrypts data from r with the given dataKey.
+//
+// wrappedKey is stored in the header, so the dataKey may be obtained during decryption.
+func newEncryptReader(r io.Reader, dataKey, wrappedKey []byte) (io.Reader, error) {
+	if len(wrappedKey) > maxWrappedKeySize {
+		return nil, fmt.Errorf("too big wrapped data key; got %d bytes; mustn't exceed %d bytes", len(wrappedKey), maxWrappedKeySize)
+	}
+	header := make([]byte, headerSize)
+	copy(header, magic)
+	salt := header[len(magic) : len(magic)+saltSize]
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, fmt.Errorf("cannot generate salt: %w", err)
+	}
+	binary.BigEndian.PutUint16(header[len(magic)+saltSize:], uint16(len(wrappedKey)))
+	copy(header[len(magic)+saltSize+2:], wrappedKey)
+
+	aead, err := newObjectCipher(dataKey, salt)
+	if err != nil {
+		return nil, err
+	}
+	er := &encryptReader{
+		r:      r,
+		aead:   aead,
+		buf:    header,
+		sealed: make([]byte, 0, chunkSize+tagSize),
+		cur:    make([]byte, chunkSize),
+		next:   make([]byte, chunkSize),
+		nonce:  make([]byte, nonceSize),
+	}
+	n, err := io.ReadFull(r, er.cur)
+	er.cur = er.cur[:n]
+	if err != nil {
+		if !isEOF(err) {
+			return nil, err
+		}
+		er.isLast = true
+	}
+	return er, nil
+}
+
+func (er *encryptReader) Read(p []byte) (int, error) {
+	if len(er.buf) == 0 {
+		if er.done {
+			return 0, io.EOF
+		}
+		if err := er.sealChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, er.buf)
+	er.buf = er.buf[n:]
+	return n, nil
+}
+
+func (er *encryptReader) sealChunk() error {
+	if er.isLast {
+		er.seal(true)
+		return nil
+	}
+	// Read the next chunk in order to determine whether the current chunk is the last one.
+	n, err := io.ReadFull(er.r, er.next[:chunkSize])
+	if err != nil && !isEOF(err) {
+		return err
+	}
+	if n == 0 {
+		er.seal(true)
+		return nil
+	}
+	er.seal(false)
+	er.cur, er.next = er.next[:n], er.cur
+	er.isLast = err != nil
+	return nil
+}
+
+func (er *encryptReader) seal(isLast bool) {
+	ad := otherChunkAD
+	if isLast {
+		ad = lastChunkAD
+		er.done = true
+	}
+	er.buf = er.aead.Seal(er.sealed[:0], chunkNonce(er.nonce, er.chunkNum), er.cur, ad)
+	er.chunkNum++
+}
+
+func isEOF(err error) bool {
+	return err == io.EOF || err == io.ErrUnexpectedEOF
+}
+
+// decryptWriter decrypts data written to it and writes the decrypted data to w.
+//
+// Close must be called after all the data is written in order to verify the last chunk.
+type decryptWriter struct {
+	w         io.Writer
+	unwrapKey func(wrappedKey []byte) ([]byte, error)
+
+	header []byte
+	aead   cipher.AEAD
+	buf    []byte
+	plain  []byte
+	nonce  []byte
+
+	chunkNum uint64
+}
+
+func newDecryptWriter(w io.Writer, unwrapKey func(wrappedKey []byte) ([]byte, error)) *decryptWriter {
+	return &decryptWriter{
+		w:         w,
+		unwrapKey: unwrapKey,
+		nonce:     make([]byte, nonceSize),
+	}
+}
+
+func (dw *decryptWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if dw.aead == nil {
+		m := headerSize - len(dw.header)
+		if m > len(p) {
+			m = len(p)
+		}
+		dw.header = append(dw.header, p[:m]...)
+		p = p[m:]
+		if len(dw.header) < headerSize {
+			return n, nil
+		}
+		if err := dw.initCipher(); err != nil {
+			return 0, err
+		}
+	}
+	for len(p) > 0 {
+		if len(dw.buf) == chunkSize+tagSize {
+			// The buffered chunk isn't the last one, since there is more data.
+			if err := dw.decryptChunk(otherChunkAD); err != nil {
+				return 0, err
+			}
+		}
+		m := chunkSize + tagSize - len(dw.buf)
+		if m > len(p) {
+			m = len(p)
+		}
+		dw.buf = append(dw.buf, p[:m]...)
+		p = p[m:]
+	}
+	return n, nil
+}
+
+// Close verifies and writes the last chunk.
+func (dw *decryptWriter) Close() error {
+	if dw.aead == nil {
+		return fmt.Errorf("unexpected end of encrypted data; missing header")
+	}
+	return dw.decryptChunk(lastChunkAD)
+}
+
+func (dw *decryptWriter) initCipher() error {
+	aead, err := parseHeader(dw.header, dw.unwrapKey)
+	if err != nil {
+		return err
+	}
+	dw.aead = aead
+	dw.buf = make([]byte, 0, chunkSize+tagSize)
+	dw.plain = make([]byte, 0, chunkSize)
+	return nil
+}
+
+// parseHeader returns cipher for the encrypted object with the given header.
+func parseHeader(header []byte, unwrapKey func(wrappedKey []byte) ([]byte, error)) (cipher.AEAD, error) {
+	if len(header) != headerSize || !bytes.Equal(header[:len(magic)], []byte(magic)) {
+		return nil, fmt.Errorf("unexpected header for encrypted data; the data isn't encrypted or it is corrupted")
+	}
+	salt := header[len(magic) : len(magic)+saltSize]
+	keyLen := int(binary.BigEndian.Uint16(header[len(magic)+saltSize:]))
+	if keyLen > maxWrappedKeySize {
+		return nil, fmt.Errorf("invalid size of wrapped data key in the header: %d bytes", keyLen)
+	}
+	wrappedKey := header[len(magic)+saltSize+2 : len(magic)+saltSize+2+keyLen]
+	dataKey, err := unwrapKey(wrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unwrap data key: %w", err)
+	}
+	return newObjectCipher(dataKey, salt)
+}
+
+func (dw *decryptWriter) decryptChunk(ad []byte) error {
+	plain, err := dw.aead.Open(dw.plain[:0], chunkNonce(dw.nonce, dw.chunkNum), dw.buf, ad)
+	if err != nil {
+		return fmt.Errorf("cannot decrypt chunk #%d: %w; the data is corrupted or truncated, or it is encrypted with another key", dw.chunkNum, err)
+	}
+	dw.chunkNum++
+	dw.buf = dw.buf[:0]
+	if _, err := dw.w.Write(plain); err != nil {
+		return err
+	}
+	return nil
+}
+
+// chunkRange returns the range of encrypted chunks holding plaintext bytes [offset, offset+size)
+// for the encrypted object with the given plaintext size.
+//
+// It returns the number of the first chunk and the offset and the size of the encrypted data for the chunks.
+func chunkRange(plainSize, offset, size uint64) (uint64, uint64, uint64) {
+	firstChunk := offset / chunkSize
+	lastChunk := (offset + size - 1) / chunkSize
+	encOffset := headerSize + firstChunk*(chunkSize+tagSize)
+	endOffset := (lastChunk + 1) * chunkSize
+	if endOffset > plainSize {
+		endOffset = plainSize
+	}
+	encSize := endOffset - firstChunk*chunkSize + (lastChunk-firstChunk+1)*tagSize
+	return firstChunk, encOffset, encSize
+}
+
+// rangeDecryptWriter decrypts the chunks written to it and writes plaintext bytes [offset, offset+size) to w.
+type rangeDecryptWriter struct {
+	w    io.Writer
+	aead cipher.AEAD
+
+	plainSize uint64
+	lastChunk uint64
+	chunkNum  uint64
+
+	// skip is the number of plaintext bytes to skip in the first chunk.
+	skip uint64
+
+	// remaining is the number of plaintext bytes to write to w.
+	remaining uint64
+
+	buf   []byte
+	plain []byte
+	nonce []byte
+}
+
+func newRangeDecryptWriter(w io.Writer, aead cipher.AEAD, plainSize, offset, size uint64) *rangeDecryptWriter {
+	firstChunk, _, _ := chunkRange(plainSize, offset, size)
+	lastChunk := uint64(0)
+	if plainSize > 0 {
+		lastChunk = (plainSize - 1) / chunkSize
+	}
+	return &rangeDecryptWriter{
+		w:         w,
+		aead:      aead,
+		plainSize: plainSize,
+		lastChunk: lastChunk,
+		chunkNum:  firstChunk,
+		skip:      offset - firstChunk*chunkSize,
+		remaining: size,
+		buf:       make([]byte, 0, chunkSize+tagSize),
+		plain:     make([]byte, 0, chunkSize),
+		nonce:     make([]byte, nonceSize),
+	}
+}
+
+func (rw *rangeDecryptWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if rw.remaining == 0 {
+			return 0, fmt.Errorf("unexpected data after the end of range")
+		}
+		chunkLen := rw.plainSize - rw.chunkNum*chunkSize
+		if chunkLen > chunkSize {
+			chunkLen = chunkSize
+		}
+		m := int(chunkLen+tagSize) - len(rw.buf)
+		if m > len(p) {
+			m = len(p)
+		}
+		rw.buf = append(rw.buf, p[:m]...)
+		p = p[m:]
+		if uint64(len(rw.buf)) < chunkLen+tagSize {
+			continue
+		}
+		ad := otherChunkAD
+		if rw.chunkNum == rw.lastChunk {
+			ad = lastChunkAD
+		}
+		plain, err := rw.aead.Open(rw.plain[:0], chunkNonce(rw.nonce, rw.chunkNum), rw.buf, ad)
+		if err != nil {
+			return 0, fmt.Errorf("cannot decrypt chunk #%d: %w; the data is corrupted, or it is encrypted with another key", rw.chunkNum, err)
+		}
+		rw.chunkNum++
+		rw.buf = rw.buf[:0]
+		plain = plain[rw.skip:]
+		rw.skip = 0
+		if uint64(len(plain)) > rw.remaining {
+			plain = plain[:rw.remaining]
+		}
+		rw.remaining -= uint64(len(plain))
+		if _, err := rw.w.Write(plain); err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,118 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"testing"
+)
+
+func TestEncryptedSize(t *testing.T) {
+	f := func(size uint64) {
+		t.Helper()
+		encSize := EncryptedSize(size)
+		plainSize, ok := PlaintextSize(encSize)
+		if !ok {
+			t.Fatalf("cannot obtain plaintext size for encrypted size %d", encSize)
+		}
+		if plainSize != size {
+			t.Fatalf("unexpected plaintext size for encrypted size %d; got %d; want %d", encSize, plainSize, size)
+		}
+	}
+	for _, size := range []uint64{0, 1, 100, chunkSize - 1, chunkSize, chunkSize + 1, 10 * chunkSize, 10*chunkSize + 123, 1 << 30} {
+		f(size)
+	}
+
+	// Invalid sizes
+	for _, encSize := range []uint64{0, 1, headerSize, headerSize + tagSize - 1, headerSize + chunkSize + tagSize + 1, headerSize + chunkSize + 2*tagSize} {
+		if _, ok := PlaintextSize(encSize); ok {
+			t.Fatalf("expecting invalid encrypted size %d", encSize)
+		}
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		t.Fatalf("cannot generate data key: %s", err)
+	}
+	wrappedKey := []byte("wrapped key")
+	unwrapKey := func(b []byte) ([]byte, error) {
+		if !bytes.Equal(b, wrappedKey) {
+			t.Fatalf("unexpected wrapped key; got %q; want %q", b, wrappedKey)
+		}
+		return dataKey, nil
+	}
+	encrypt := func(data []byte) []byte {
+		t.Helper()
+		r, err := newEncryptReader(bytes.NewReader(data), dataKey, wrappedKey)
+		if err != nil {
+			t.Fatalf("cannot create encrypt reader: %s", err)
+		}
+		encData, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("cannot encrypt data: %s", err)
+		}
+		return encData
+	}
+	decrypt := func(encData []byte) ([]byte, error) {
+		var bb bytes.Buffer
+		dw := newDecryptWriter(&bb, unwrapKey)
+		// Write data in small blocks in order to verify buffering.
+		for len(encData) > 0 {
+			n := 1000
+			if n > len(encData) {
+				n = len(encData)
+			}
+			if _, err := dw.Write(encData[:n]); err != nil {
+				return nil, err
+			}
+			encData = encData[n:]
+		}
+		if err := dw.Close(); err != nil {
+			return nil, err
+		}
+		return bb.Bytes(), nil
+	}
+	f := func(size int) {
+		t.Helper()
+		data := make([]byte, size)
+		if _, err := rand.Read(data); err != nil {
+			t.Fatalf("cannot generate data: %s", err)
+		}
+		encData := encrypt(data)
+		if uint64(len(encData)) != EncryptedSize(uint64(size)) {
+			t.Fatalf("unexpected encrypted size for %d bytes; got %d; want %d", size, len(encData), EncryptedSize(uint64(size)))
+		}
+		result, err := decrypt(encData)
+		if err != nil {
+			t.Fatalf("cannot decrypt %d bytes: %s", size, err)
+		}
+		if !bytes.Equal(result, data) {
+			t.Fatalf("unexpected data after decryption of %d bytes", size)
+		}
+
+		// Corrupted data
+		corrupted := append([]byte{}, encData...)
+		corrupted[len(corrupted)-1] ^= 1
+		if _, err := decrypt(corrupted); err == nil {
+			t.Fatalf("expecting non-nil error for corrupted data with %d bytes", size)
+		}
+
+		// Truncated data
+		if size > chunkSize {
+			n := headerSize + chunkSize + tagSize
+			if _, err := decrypt(encData[:n]); err == nil {
+				t.Fatalf("expecting non-nil error for truncated data with %d bytes", size)
+			}
+		}
+	}
+	for _, size := range []int{0, 1, 1000, chunkSize - 1, chunkSize, chunkSize + 1, 3*chunkSize + 12345} {
+		f(size)
+	}
+
+	// Missing header
+	if _, err := decrypt([]byte("foobar")); err == nil {
+		t.Fatalf("expecting non-nil error for missing header")
+	}
+}
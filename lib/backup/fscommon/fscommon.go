@@ -268,3 +268,7 @@ func IgnorePath(path string) bool {
 
 // BackupCompleteFilename is a filename, which is created in the destination fs when backup is complete.
 const BackupCompleteFilename = "backup_complete.ignore"
+
+// BackupManifestFilename is a filename, which is created in the destination fs for incremental backups
+// referring parts from the previous backups.
+const BackupManifestFilename = "backup_manifest.ignore"
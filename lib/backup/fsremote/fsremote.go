@@ -157,6 +157,26 @@ func (fs *FS) DownloadPart(p common.Part, w io.Writer) error {
 	return nil
 }
 
+// DownloadPartRange downloads size bytes starting from offset in part p from fs to w.
+func (fs *FS) DownloadPartRange(p common.Part, offset, size uint64, w io.Writer) error {
+	path := fs.path(p)
+	r, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("cannot open %q: %w", path, err)
+	}
+	n, err := io.Copy(w, io.NewSectionReader(r, int64(offset), int64(size)))
+	if err1 := r.Close(); err1 != nil && err == nil {
+		err = err1
+	}
+	if err != nil {
+		return fmt.Errorf("cannot download data from %q: %w", path, err)
+	}
+	if uint64(n) != size {
+		return fmt.Errorf("wrong data size downloaded from %q at offset %d; got %d bytes; want %d bytes", path, offset, n, size)
+	}
+	return nil
+}
+
 // UploadPart uploads p from r to fs.
 func (fs *FS) UploadPart(p common.Part, r io.Reader) error {
 	path := fs.path(p)
@@ -224,6 +244,16 @@ func (fs *FS) CreateFile(filePath string, data []byte) error {
 	return nil
 }
 
+// ReadFile returns the contents of filePath at fs.
+func (fs *FS) ReadFile(filePath string) ([]byte, error) {
+	path := filepath.Join(fs.Dir, filePath)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %q: %w", path, err)
+	}
+	return data, nil
+}
+
 // HasFile returns true if filePath exists at fs.
 func (fs *FS) HasFile(filePath string) (bool, error) {
 	path := filepath.Join(fs.Dir, filePath)
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"strings"
 
 	"cloud.google.com/go/storage"
@@ -176,6 +177,27 @@ func (fs *FS) DownloadPart(p common.Part, w io.Writer) error {
 	return nil
 }
 
+// DownloadPartRange downloads size bytes starting from offset in part p from fs to w.
+func (fs *FS) DownloadPartRange(p common.Part, offset, size uint64, w io.Writer) error {
+	o := fs.object(p)
+	ctx := context.Background()
+	r, err := o.NewRangeReader(ctx, int64(offset), int64(size))
+	if err != nil {
+		return fmt.Errorf("cannot open reader for %q at %s (remote path %q): %w", p.Path, fs, o.ObjectName(), err)
+	}
+	n, err := io.Copy(w, r)
+	if err1 := r.Close(); err1 != nil && err == nil {
+		err = err1
+	}
+	if err != nil {
+		return fmt.Errorf("cannot download %q from at %s (remote path %q): %w", p.Path, fs, o.ObjectName(), err)
+	}
+	if uint64(n) != size {
+		return fmt.Errorf("wrong data size downloaded from %q at %s at offset %d; got %d bytes; want %d bytes", p.Path, fs, offset, n, size)
+	}
+	return nil
+}
+
 // UploadPart uploads part p from r to fs.
 func (fs *FS) UploadPart(p common.Part, r io.Reader) error {
 	o := fs.object(p)
@@ -237,6 +259,25 @@ func (fs *FS) CreateFile(filePath string, data []byte) error {
 	return nil
 }
 
+// ReadFile returns the contents of filePath at fs.
+func (fs *FS) ReadFile(filePath string) ([]byte, error) {
+	path := fs.Dir + filePath
+	o := fs.bkt.Object(path)
+	ctx := context.Background()
+	r, err := o.NewReader(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open reader for %q at %s (remote path %q): %w", filePath, fs, o.ObjectName(), err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err1 := r.Close(); err1 != nil && err == nil {
+		err = err1
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %q at %s (remote path %q): %w", filePath, fs, o.ObjectName(), err)
+	}
+	return data, nil
+}
+
 // HasFile returns ture if filePath exists at fs.
 func (fs *FS) HasFile(filePath string) (bool, error) {
 	path := fs.Dir + filePath
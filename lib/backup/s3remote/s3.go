@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"strings"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/common"
@@ -214,6 +215,35 @@ func (fs *FS) DownloadPart(p common.Part, w io.Writer) error {
 	return nil
 }
 
+// DownloadPartRange downloads size bytes starting from offset in part p from fs to w.
+func (fs *FS) DownloadPartRange(p common.Part, offset, size uint64, w io.Writer) error {
+	if size == 0 {
+		return nil
+	}
+	path := fs.path(p)
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(fs.Bucket),
+		Key:    aws.String(path),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+size-1)),
+	}
+	o, err := fs.s3.GetObject(input)
+	if err != nil {
+		return fmt.Errorf("cannot open %q at %s (remote path %q): %w", p.Path, fs, path, err)
+	}
+	r := o.Body
+	n, err := io.Copy(w, r)
+	if err1 := r.Close(); err1 != nil && err == nil {
+		err = err1
+	}
+	if err != nil {
+		return fmt.Errorf("cannot download %q from at %s (remote path %q): %w", p.Path, fs, path, err)
+	}
+	if uint64(n) != size {
+		return fmt.Errorf("wrong data size downloaded from %q at %s at offset %d; got %d bytes; want %d bytes", p.Path, fs, offset, n, size)
+	}
+	return nil
+}
+
 // UploadPart uploads part p from r to fs.
 func (fs *FS) UploadPart(p common.Part, r io.Reader) error {
 	path := fs.path(p)
@@ -287,6 +317,27 @@ func (fs *FS) CreateFile(filePath string, data []byte) error {
 	return nil
 }
 
+// ReadFile returns the contents of filePath at fs.
+func (fs *FS) ReadFile(filePath string) ([]byte, error) {
+	path := fs.Dir + filePath
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(fs.Bucket),
+		Key:    aws.String(path),
+	}
+	o, err := fs.s3.GetObject(input)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open %q at %s (remote path %q): %w", filePath, fs, path, err)
+	}
+	data, err := ioutil.ReadAll(o.Body)
+	if err1 := o.Body.Close(); err1 != nil && err == nil {
+		err = err1
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %q at %s (remote path %q): %w", filePath, fs, path, err)
+	}
+	return data, nil
+}
+
 // HasFile returns true if filePath exists at fs.
 func (fs *FS) HasFile(filePath string) (bool, error) {
 	path := fs.Dir + filePath
@@ -0,0 +1,389 @@
+package sftpremote
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/common"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/backup/fscommon"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// FS represents filesystem for backups on SFTP server.
+//
+// Init must be called before calling other FS methods.
+type FS struct {
+	// User to log in as.
+	User string
+
+	// Addr is SFTP server address in the form host[:port].
+	Addr string
+
+	// Directory on SFTP server to write to.
+	Dir string
+
+	// Path to file with private SSH key for authentication.
+	KeyFilePath string
+
+	// Path to file with password for authentication.
+	PasswordFilePath string
+
+	// Path to known_hosts file for verifying SFTP server host key.
+	//
+	// ~/.ssh/known_hosts is used if empty.
+	KnownHostsFilePath string
+
+	conn   *ssh.Client
+	client *sftp.Client
+}
+
+// Init initializes fs.
+//
+// The returned fs must be stopped when no long needed with MustStop call.
+func (fs *FS) Init() error {
+	if fs.client != nil {
+		logger.Panicf("BUG: Init is already called")
+	}
+	fs.Dir = strings.TrimRight(fs.Dir, "/")
+	if len(fs.Dir) == 0 {
+		fs.Dir = "/"
+	}
+	if _, _, err := net.SplitHostPort(fs.Addr); err != nil {
+		fs.Addr = net.JoinHostPort(fs.Addr, "22")
+	}
+
+	var auth []ssh.AuthMethod
+	if len(fs.KeyFilePath) > 0 {
+		data, err := ioutil.ReadFile(fs.KeyFilePath)
+		if err != nil {
+			return fmt.Errorf("cannot read SSH key file: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			return fmt.Errorf("cannot parse SSH key from %q: %w", fs.KeyFilePath, err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if len(fs.PasswordFilePath) > 0 {
+		data, err := ioutil.ReadFile(fs.PasswordFilePath)
+		if err != nil {
+			return fmt.Errorf("cannot read SFTP password file: %w", err)
+		}
+		auth = append(auth, ssh.Password(strings.TrimRight(string(data), "\r\n")))
+	}
+	if len(auth) == 0 {
+		return fmt.Errorf("missing SFTP credentials; set SSH key file or password file")
+	}
+
+	knownHostsFilePath := fs.KnownHostsFilePath
+	if len(knownHostsFilePath) == 0 {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("cannot determine path to known_hosts file: %w", err)
+		}
+		knownHostsFilePath = homeDir + "/.ssh/known_hosts"
+	}
+	hostKeyCallback, err := knownhosts.New(knownHostsFilePath)
+	if err != nil {
+		return fmt.Errorf("cannot load known hosts from %q: %w", knownHostsFilePath, err)
+	}
+
+	cfg := &ssh.ClientConfig{
+		User:            fs.User,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         30 * time.Second,
+	}
+	conn, err := ssh.Dial("tcp", fs.Addr, cfg)
+	if err != nil {
+		return fmt.Errorf("cannot connect to SFTP server at %q: %w", fs.Addr, err)
+	}
+	client, err := sftp.NewClient(conn)
+	if err != nil {
+		_ = conn.Close()
+		return fmt.Errorf("cannot start SFTP session at %q: %w", fs.Addr, err)
+	}
+	fs.conn = conn
+	fs.client = client
+	return nil
+}
+
+// MustStop stops fs.
+func (fs *FS) MustStop() {
+	if err := fs.client.Close(); err != nil {
+		logger.Errorf("cannot close SFTP session at %s: %s", fs, err)
+	}
+	if err := fs.conn.Close(); err != nil {
+		logger.Errorf("cannot close SSH connection at %s: %s", fs, err)
+	}
+	fs.client = nil
+	fs.conn = nil
+}
+
+// String returns human-readable description for fs.
+func (fs *FS) String() string {
+	return fmt.Sprintf("SFTP{user: %q, addr: %q, dir: %q}", fs.User, fs.Addr, fs.Dir)
+}
+
+// ListParts returns all the parts for fs.
+func (fs *FS) ListParts() ([]common.Part, error) {
+	dir := fs.Dir
+	if _, err := fs.client.Stat(dir); err != nil {
+		if os.IsNotExist(err) {
+			// Return empty part list for non-existing directory.
+			// The directory will be created later.
+			return nil, nil
+		}
+		return nil, fmt.Errorf("cannot stat %q at %s: %w", dir, fs, err)
+	}
+	prefix := strings.TrimRight(dir, "/") + "/"
+	var parts []common.Part
+	w := fs.client.Walk(dir)
+	for w.Step() {
+		if err := w.Err(); err != nil {
+			return nil, fmt.Errorf("error when listing files at %s: %w", fs, err)
+		}
+		fi := w.Stat()
+		if fi.IsDir() {
+			continue
+		}
+		file := w.Path()
+		if !strings.HasPrefix(file, prefix) {
+			return nil, fmt.Errorf("unexpected prefix for file %q; want %q", file, prefix)
+		}
+		if fscommon.IgnorePath(file) {
+			continue
+		}
+		var p common.Part
+		if !p.ParseFromRemotePath(file[len(prefix):]) {
+			logger.Infof("skipping unknown file %q", file)
+			continue
+		}
+		p.ActualSize = uint64(fi.Size())
+		parts = append(parts, p)
+	}
+	return parts, nil
+}
+
+// DeletePart deletes part p from fs.
+func (fs *FS) DeletePart(p common.Part) error {
+	path := fs.path(p)
+	if err := fs.client.Remove(path); err != nil {
+		return fmt.Errorf("cannot delete %q at %s (remote path %q): %w", p.Path, fs, path, err)
+	}
+	return nil
+}
+
+// RemoveEmptyDirs recursively removes empty dirs in fs.
+func (fs *FS) RemoveEmptyDirs() error {
+	if _, err := fs.client.Stat(fs.Dir); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("cannot stat %q at %s: %w", fs.Dir, fs, err)
+	}
+	_, err := fs.removeEmptyDirs(fs.Dir)
+	return err
+}
+
+func (fs *FS) removeEmptyDirs(dir string) (bool, error) {
+	fis, err := fs.client.ReadDir(dir)
+	if err != nil {
+		return false, fmt.Errorf("cannot read dir %q at %s: %w", dir, fs, err)
+	}
+	dirEntries := 0
+	for _, fi := range fis {
+		if !fi.IsDir() {
+			dirEntries++
+			continue
+		}
+		ok, err := fs.removeEmptyDirs(path.Join(dir, fi.Name()))
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			dirEntries++
+		}
+	}
+	if dirEntries > 0 {
+		return false, nil
+	}
+	logger.Infof("removing empty dir %q at %s", dir, fs)
+	if err := fs.client.RemoveDirectory(dir); err != nil {
+		return false, fmt.Errorf("cannot remove %q at %s: %w", dir, fs, err)
+	}
+	return true, nil
+}
+
+// CopyPart copies p from srcFS to fs.
+//
+// SFTP has no server-side copying, so the data is copied via vmbackup host.
+func (fs *FS) CopyPart(srcFS common.OriginFS, p common.Part) error {
+	src, ok := srcFS.(*FS)
+	if !ok {
+		return fmt.Errorf("cannot perform copying from %s to %s: both of them must be SFTP", srcFS, fs)
+	}
+	srcPath := src.path(p)
+	r, err := src.client.Open(srcPath)
+	if err != nil {
+		return fmt.Errorf("cannot open %q at %s (remote path %q): %w", p.Path, src, srcPath, err)
+	}
+	err = fs.UploadPart(p, r)
+	if err1 := r.Close(); err1 != nil && err == nil {
+		err = err1
+	}
+	if err != nil {
+		return fmt.Errorf("cannot copy %q from %s to %s: %w", p.Path, src, fs, err)
+	}
+	return nil
+}
+
+// DownloadPart downloads part p from fs to w.
+func (fs *FS) DownloadPart(p common.Part, w io.Writer) error {
+	path := fs.path(p)
+	r, err := fs.client.Open(path)
+	if err != nil {
+		return fmt.Errorf("cannot open %q at %s (remote path %q): %w", p.Path, fs, path, err)
+	}
+	n, err := io.Copy(w, r)
+	if err1 := r.Close(); err1 != nil && err == nil {
+		err = err1
+	}
+	if err != nil {
+		return fmt.Errorf("cannot download %q from %s (remote path %q): %w", p.Path, fs, path, err)
+	}
+	if uint64(n) != p.Size {
+		return fmt.Errorf("wrong data size downloaded from %q at %s; got %d bytes; want %d bytes", p.Path, fs, n, p.Size)
+	}
+	return nil
+}
+
+// DownloadPartRange downloads size bytes starting from offset in part p from fs to w.
+func (fs *FS) DownloadPartRange(p common.Part, offset, size uint64, w io.Writer) error {
+	path := fs.path(p)
+	r, err := fs.client.Open(path)
+	if err != nil {
+		return fmt.Errorf("cannot open %q at %s (remote path %q): %w", p.Path, fs, path, err)
+	}
+	n, err := io.Copy(w, io.NewSectionReader(r, int64(offset), int64(size)))
+	if err1 := r.Close(); err1 != nil && err == nil {
+		err = err1
+	}
+	if err != nil {
+		return fmt.Errorf("cannot download %q from %s (remote path %q): %w", p.Path, fs, path, err)
+	}
+	if uint64(n) != size {
+		return fmt.Errorf("wrong data size downloaded from %q at %s at offset %d; got %d bytes; want %d bytes", p.Path, fs, offset, n, size)
+	}
+	return nil
+}
+
+// UploadPart uploads part p from r to fs.
+func (fs *FS) UploadPart(p common.Part, r io.Reader) error {
+	path := fs.path(p)
+	n, err := fs.writeFile(path, r)
+	if err != nil {
+		return fmt.Errorf("cannot upload data to %q at %s (remote path %q): %w", p.Path, fs, path, err)
+	}
+	if uint64(n) != p.Size {
+		_ = fs.client.Remove(path)
+		return fmt.Errorf("wrong data size uploaded to %q at %s; got %d bytes; want %d bytes", p.Path, fs, n, p.Size)
+	}
+	return nil
+}
+
+func (fs *FS) writeFile(filePath string, r io.Reader) (int64, error) {
+	if err := fs.client.MkdirAll(path.Dir(filePath)); err != nil {
+		return 0, fmt.Errorf("cannot create dir for %q: %w", filePath, err)
+	}
+	w, err := fs.client.Create(filePath)
+	if err != nil {
+		return 0, fmt.Errorf("cannot create %q: %w", filePath, err)
+	}
+	n, err := io.Copy(w, r)
+	if err1 := w.Close(); err1 != nil && err == nil {
+		err = err1
+	}
+	if err != nil {
+		_ = fs.client.Remove(filePath)
+		return 0, err
+	}
+	return n, nil
+}
+
+// DeleteFile deletes filePath from fs if it exists.
+//
+// The function does nothing if the file doesn't exist.
+func (fs *FS) DeleteFile(filePath string) error {
+	path := fs.filePath(filePath)
+	if err := fs.client.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("cannot delete %q at %s (remote path %q): %w", filePath, fs, path, err)
+	}
+	return nil
+}
+
+// CreateFile creates filePath at fs and puts data into it.
+//
+// The file is overwritten if it already exists.
+func (fs *FS) CreateFile(filePath string, data []byte) error {
+	path := fs.filePath(filePath)
+	n, err := fs.writeFile(path, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("cannot upload data to %q at %s (remote path %q): %w", filePath, fs, path, err)
+	}
+	if n != int64(len(data)) {
+		return fmt.Errorf("wrong data size uploaded to %q at %s; got %d bytes; want %d bytes", filePath, fs, n, len(data))
+	}
+	return nil
+}
+
+// ReadFile returns the contents of filePath at fs.
+func (fs *FS) ReadFile(filePath string) ([]byte, error) {
+	path := fs.filePath(filePath)
+	r, err := fs.client.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open %q at %s (remote path %q): %w", filePath, fs, path, err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err1 := r.Close(); err1 != nil && err == nil {
+		err = err1
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %q at %s (remote path %q): %w", filePath, fs, path, err)
+	}
+	return data, nil
+}
+
+// HasFile returns true if filePath exists at fs.
+func (fs *FS) HasFile(filePath string) (bool, error) {
+	path := fs.filePath(filePath)
+	fi, err := fs.client.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("cannot stat %q at %s (remote path %q): %w", filePath, fs, path, err)
+	}
+	if fi.IsDir() {
+		return false, fmt.Errorf("%q at %s (remote path %q) is a directory", filePath, fs, path)
+	}
+	return true, nil
+}
+
+func (fs *FS) filePath(name string) string {
+	return path.Join(fs.Dir, name)
+}
+
+func (fs *FS) path(p common.Part) string {
+	return p.RemotePath(fs.Dir)
+}
@@ -0,0 +1,116 @@
+package configcheck
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// IsSubcommand returns true if the first command-line arg equals to the given subcommand name, e.g. `check-config`.
+//
+// The subcommand is removed from os.Args, so the remaining command-line flags are parsed as usual.
+// This function must be called before envflag.Parse().
+func IsSubcommand(name string) bool {
+	if len(os.Args) < 2 || os.Args[1] != name {
+		return false
+	}
+	os.Args = append(os.Args[:1], os.Args[2:]...)
+	return true
+}
+
+// Issue is an error or a warning found during config check.
+type Issue struct {
+	// Source is the name of the checked command-line flag or config file.
+	Source string `json:"source"`
+
+	// Message is a human-readable description of the issue.
+	Message string `json:"message"`
+}
+
+// Report contains errors and warnings found during config check.
+//
+// Errors prevent from starting the app, while warnings point to suspicious settings.
+type Report struct {
+	Errors   []Issue `json:"errors"`
+	Warnings []Issue `json:"warnings"`
+}
+
+// AddError adds err found at the given source to r.
+func (r *Report) AddError(source string, err error) {
+	r.Errors = append(r.Errors, Issue{
+		Source:  source,
+		Message: err.Error(),
+	})
+}
+
+// AddWarning adds warning message found at the given source to r.
+func (r *Report) AddWarning(source, format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, Issue{
+		Source:  source,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// AddRedundantFlagWarnings adds warnings for command-line flags explicitly set to their default values.
+//
+// Such flags may prevent from automatic picking up of better defaults in new releases.
+func (r *Report) AddRedundantFlagWarnings() {
+	flag.Visit(func(f *flag.Flag) {
+		if f.Value.String() == f.DefValue {
+			r.AddWarning("-"+f.Name, "the flag is explicitly set to its default value %q; it is recommended removing it from command-line flags", f.DefValue)
+		}
+	})
+}
+
+// WriteJSON writes r in JSON to w.
+//
+// The output has the following format:
+//
+//	{"status":"success|error","errors":[{"source":"...","message":"..."}],"warnings":[...]}
+func (r *Report) WriteJSON(w io.Writer) error {
+	status := "success"
+	if len(r.Errors) > 0 {
+		status = "error"
+	}
+	resp := struct {
+		Status   string  `json:"status"`
+		Errors   []Issue `json:"errors"`
+		Warnings []Issue `json:"warnings"`
+	}{
+		Status:   status,
+		Errors:   r.Errors,
+		Warnings: r.Warnings,
+	}
+	// Always return arrays instead of null, so the output is easier to process in CI scripts.
+	if resp.Errors == nil {
+		resp.Errors = []Issue{}
+	}
+	if resp.Warnings == nil {
+		resp.Warnings = []Issue{}
+	}
+	data, err := json.Marshal(&resp)
+	if err != nil {
+		return fmt.Errorf("cannot marshal config check report: %w", err)
+	}
+	data = append(data, '\n')
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("cannot write config check report: %w", err)
+	}
+	return nil
+}
+
+// WriteAndExit writes r in JSON to stdout and exits with 0 status code if r has no errors.
+//
+// Otherwise it exits with 1 status code.
+func (r *Report) WriteAndExit() {
+	if err := r.WriteJSON(os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+	if len(r.Errors) > 0 {
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
@@ -0,0 +1,55 @@
+package configcheck
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestIsSubcommand(t *testing.T) {
+	origArgs := os.Args
+	defer func() {
+		os.Args = origArgs
+	}()
+
+	f := func(args []string, name string, resultExpected bool, argsExpected []string) {
+		t.Helper()
+		os.Args = append([]string{}, args...)
+		result := IsSubcommand(name)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for IsSubcommand(%q) with args %q; got %v; want %v", name, args, result, resultExpected)
+		}
+		if !reflect.DeepEqual(os.Args, argsExpected) {
+			t.Fatalf("unexpected args after IsSubcommand(%q); got %q; want %q", name, os.Args, argsExpected)
+		}
+	}
+	f([]string{"vmagent"}, "check-config", false, []string{"vmagent"})
+	f([]string{"vmagent", "-foo=bar"}, "check-config", false, []string{"vmagent", "-foo=bar"})
+	f([]string{"vmagent", "check-rules"}, "check-config", false, []string{"vmagent", "check-rules"})
+	f([]string{"vmagent", "-foo=bar", "check-config"}, "check-config", false, []string{"vmagent", "-foo=bar", "check-config"})
+	f([]string{"vmagent", "check-config"}, "check-config", true, []string{"vmagent"})
+	f([]string{"vmagent", "check-config", "-foo=bar", "-baz"}, "check-config", true, []string{"vmagent", "-foo=bar", "-baz"})
+}
+
+func TestReportWriteJSON(t *testing.T) {
+	f := func(r *Report, resultExpected string) {
+		t.Helper()
+		var bb bytes.Buffer
+		if err := r.WriteJSON(&bb); err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if result := bb.String(); result != resultExpected {
+			t.Fatalf("unexpected result\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+	f(&Report{}, `{"status":"success","errors":[],"warnings":[]}`+"\n")
+
+	var r Report
+	r.AddWarning("-foo", "the value %q is suspicious", "bar")
+	f(&r, `{"status":"success","errors":[],"warnings":[{"source":"-foo","message":"the value \"bar\" is suspicious"}]}`+"\n")
+
+	r.AddError("-baz", fmt.Errorf("cannot parse %q", "a\nb"))
+	f(&r, `{"status":"error","errors":[{"source":"-baz","message":"cannot parse \"a\\nb\""}],"warnings":[{"source":"-foo","message":"the value \"bar\" is suspicious"}]}`+"\n")
+}
@@ -0,0 +1,39 @@
+package zstd
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDecompressLimited(t *testing.T) {
+	f := func(dataLen, maxSize int, resultExpected bool) {
+		t.Helper()
+		data := bytes.Repeat([]byte("foobar"), dataLen/6)
+		compressed := CompressLevel(nil, data, 1)
+		prefix := []byte("prefix")
+		result, err := DecompressLimited(prefix, compressed, maxSize)
+		if ok := err == nil; ok != resultExpected {
+			t.Fatalf("unexpected result for dataLen=%d, maxSize=%d; got %v; want %v; err: %v", dataLen, maxSize, ok, resultExpected, err)
+		}
+		if !resultExpected {
+			if string(result) != "prefix" {
+				t.Fatalf("dst mustn't be changed on error; got %q", result)
+			}
+			return
+		}
+		if string(result[:len(prefix)]) != "prefix" {
+			t.Fatalf("unexpected prefix; got %q", result[:len(prefix)])
+		}
+		if !bytes.Equal(result[len(prefix):], data) {
+			t.Fatalf("unexpected decompressed data for dataLen=%d", dataLen)
+		}
+	}
+
+	f(0, 10, true)
+	f(600, 600, true)
+	f(64*1024, 1024*1024, true)
+
+	// Too big decompressed size
+	f(600, 599, false)
+	f(16*1024*1024, 1024*1024, false)
+}
@@ -0,0 +1,28 @@
+package zstd
+
+import (
+	"fmt"
+	"io"
+)
+
+// appendLimited appends decompressed data from r to dst and returns the result.
+//
+// It returns an error if the decompressed data exceeds maxSize bytes. dst is returned unchanged on error.
+func appendLimited(dst []byte, r io.Reader, maxSize int) ([]byte, error) {
+	dstLen := len(dst)
+	lr := io.LimitReader(r, int64(maxSize)+1)
+	var buf [64 * 1024]byte
+	for {
+		n, err := lr.Read(buf[:])
+		dst = append(dst, buf[:n]...)
+		if len(dst)-dstLen > maxSize {
+			return dst[:dstLen], fmt.Errorf("decompressed size exceeds %d bytes", maxSize)
+		}
+		if err == io.EOF {
+			return dst, nil
+		}
+		if err != nil {
+			return dst[:dstLen], err
+		}
+	}
+}
@@ -3,6 +3,8 @@
 package zstd
 
 import (
+	"bytes"
+
 	"github.com/valyala/gozstd"
 )
 
@@ -11,6 +13,17 @@ func Decompress(dst, src []byte) ([]byte, error) {
 	return gozstd.Decompress(dst, src)
 }
 
+// DecompressLimited appends decompressed src to dst and returns the result.
+//
+// It returns an error if the decompressed src exceeds maxSize bytes. The limit is checked while decompressing,
+// so src with too big decompressed size doesn't result in excess memory allocations.
+func DecompressLimited(dst, src []byte, maxSize int) ([]byte, error) {
+	zr := gozstd.NewReader(bytes.NewReader(src))
+	defer zr.Release()
+
+	return appendLimited(dst, zr, maxSize)
+}
+
 // CompressLevel appends compressed src to dst and returns the result.
 //
 // The given compressionLevel is used for the compression.
@@ -3,9 +3,11 @@
 package zstd
 
 import (
+	"bytes"
 	"sync"
 	"sync/atomic"
 
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/cgroup"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/klauspost/compress/zstd"
 )
@@ -35,6 +37,46 @@ func Decompress(dst, src []byte) ([]byte, error) {
 	return decoder.DecodeAll(src, dst)
 }
 
+// DecompressLimited appends decompressed src to dst and returns the result.
+//
+// It returns an error if the decompressed src exceeds maxSize bytes. The limit is checked while decompressing,
+// so src with too big decompressed size doesn't result in excess memory allocations.
+func DecompressLimited(dst, src []byte, maxSize int) ([]byte, error) {
+	d := getStreamDecoder()
+	defer putStreamDecoder(d)
+	if err := d.Reset(bytes.NewReader(src)); err != nil {
+		return dst, err
+	}
+	return appendLimited(dst, d, maxSize)
+}
+
+func getStreamDecoder() *zstd.Decoder {
+	select {
+	case d := <-streamDecodersCh:
+		return d
+	default:
+		d, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			logger.Panicf("BUG: failed to create ZSTD reader: %s", err)
+		}
+		return d
+	}
+}
+
+func putStreamDecoder(d *zstd.Decoder) {
+	select {
+	case streamDecodersCh <- d:
+	default:
+		// Stream decoders run background goroutines, so they must be closed when they aren't needed anymore.
+		d.Close()
+	}
+}
+
+// streamDecodersCh contains stream decoders for DecompressLimited.
+//
+// sync.Pool cannot be used here, since it doesn't close background goroutines for the dropped decoders.
+var streamDecodersCh = make(chan *zstd.Decoder, cgroup.AvailableCPUs())
+
 // CompressLevel appends compressed src to dst and returns the result.
 //
 // The given compressionLevel is used for the compression.
@@ -2,24 +2,89 @@ package envtemplate
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"os"
+	"regexp"
+	"strings"
 
 	"github.com/valyala/fasttemplate"
 )
 
 // Replace replaces `%{ENV_VAR}` placeholders in b with the corresponding ENV_VAR values.
+//
+// `%{ENV_VAR:-default}` placeholder is replaced with `default` if ENV_VAR is missing or empty.
+// Placeholders for missing env vars without defaults are left as is.
 func Replace(b []byte) []byte {
 	if !bytes.Contains(b, []byte("%{")) {
 		// Fast path - nothing to replace.
 		return b
 	}
-	s := fasttemplate.ExecuteFuncString(string(b), "%{", "}", func(w io.Writer, tag string) (int, error) {
-		v := os.Getenv(tag)
+	var missing []string
+	s := replace(string(b), "%{", &missing)
+	return []byte(s)
+}
+
+// Expand replaces `%{ENV_VAR}` and `${ENV_VAR}` placeholders in b with the corresponding ENV_VAR values.
+//
+// `${ENV_VAR}` placeholders are recognized only for ENV_VAR names consisting of uppercase letters, digits and underscores,
+// so `${1}` and `${name}` references to regexp capture groups in relabeling configs are left as is.
+// `%{ENV_VAR:-default}` and `${ENV_VAR:-default}` placeholders are replaced with `default` if ENV_VAR is missing or empty.
+//
+// If strict is set, then an error is returned if b contains placeholders for missing env vars without defaults.
+// Otherwise such placeholders are left as is.
+func Expand(b []byte, strict bool) ([]byte, error) {
+	if !bytes.Contains(b, []byte("%{")) && !bytes.Contains(b, []byte("${")) {
+		// Fast path - nothing to replace.
+		return b, nil
+	}
+	var missing []string
+	s := replace(string(b), "%{", &missing)
+	s = replace(s, "${", &missing)
+	if strict && len(missing) > 0 {
+		return nil, fmt.Errorf("missing env vars: %s; set these env vars or add defaults via `%%{ENV_VAR:-default}` syntax", strings.Join(missing, ", "))
+	}
+	return []byte(s), nil
+}
+
+var upperEnvNameRegexp = regexp.MustCompile(`^[A-Z_][A-Z0-9_]*$`)
+
+// replace replaces placeholders starting with startTag in s.
+//
+// Names of missing env vars without defaults are appended to missing.
+func replace(s, startTag string, missing *[]string) string {
+	return fasttemplate.ExecuteFuncString(s, startTag, "}", func(w io.Writer, tag string) (int, error) {
+		name := tag
+		defaultValue := ""
+		hasDefault := false
+		if n := strings.Index(tag, ":-"); n >= 0 {
+			name = tag[:n]
+			defaultValue = tag[n+2:]
+			hasDefault = true
+		}
+		if startTag == "${" && !upperEnvNameRegexp.MatchString(name) {
+			return w.Write([]byte(startTag + tag + "}"))
+		}
+		v := os.Getenv(name)
 		if v == "" {
-			v = "%{" + tag + "}"
+			if hasDefault {
+				v = defaultValue
+			} else {
+				if !containsString(*missing, name) {
+					*missing = append(*missing, name)
+				}
+				v = startTag + tag + "}"
+			}
 		}
 		return w.Write([]byte(v))
 	})
-	return []byte(s)
+}
+
+func containsString(a []string, s string) bool {
+	for _, x := range a {
+		if x == s {
+			return true
+		}
+	}
+	return false
 }
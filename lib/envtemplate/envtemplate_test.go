@@ -1,6 +1,7 @@
 package envtemplate
 
 import (
+	"os"
 	"testing"
 )
 
@@ -16,4 +17,66 @@ func TestReplace(t *testing.T) {
 	f("foo", "foo")
 	f("%{foo}", "%{foo}")
 	f("foo %{bar} %{baz}", "foo %{bar} %{baz}")
+	f("%{foo:-bar}", "bar")
+	f("${foo}", "${foo}")
+
+	if err := os.Setenv("ENVTEMPLATE_TEST_VAR", "qwe"); err != nil {
+		t.Fatalf("cannot set env var: %s", err)
+	}
+	defer func() {
+		_ = os.Unsetenv("ENVTEMPLATE_TEST_VAR")
+	}()
+	f("foo %{ENVTEMPLATE_TEST_VAR} bar", "foo qwe bar")
+	f("%{ENVTEMPLATE_TEST_VAR:-default}", "qwe")
+	f("${ENVTEMPLATE_TEST_VAR}", "${ENVTEMPLATE_TEST_VAR}")
+}
+
+func TestExpandSuccess(t *testing.T) {
+	if err := os.Setenv("ENVTEMPLATE_TEST_VAR", "qwe"); err != nil {
+		t.Fatalf("cannot set env var: %s", err)
+	}
+	defer func() {
+		_ = os.Unsetenv("ENVTEMPLATE_TEST_VAR")
+	}()
+	f := func(s string, strict bool, resultExpected string) {
+		t.Helper()
+		result, err := Expand([]byte(s), strict)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if string(result) != resultExpected {
+			t.Fatalf("unexpected result;\ngot\n%q\nwant\n%q", result, resultExpected)
+		}
+	}
+	f("", true, "")
+	f("foo", true, "foo")
+	f("%{ENVTEMPLATE_TEST_VAR} ${ENVTEMPLATE_TEST_VAR}", true, "qwe qwe")
+	f("%{ENVTEMPLATE_MISSING_VAR:-foo} ${ENVTEMPLATE_MISSING_VAR:-bar}", true, "foo bar")
+	f("${ENVTEMPLATE_MISSING_VAR:-}", true, "")
+
+	// References to regexp capture groups must be left as is.
+	f("${1}.${2}", true, "${1}.${2}")
+	f("${name}-${ENVTEMPLATE_TEST_VAR}", true, "${name}-qwe")
+
+	// Missing env vars are left as is in non-strict mode.
+	f("%{ENVTEMPLATE_MISSING_VAR} ${ENVTEMPLATE_MISSING_VAR}", false, "%{ENVTEMPLATE_MISSING_VAR} ${ENVTEMPLATE_MISSING_VAR}")
+
+	// Unterminated placeholder
+	f("foo ${BAR", true, "foo ${BAR")
+}
+
+func TestExpandFailure(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+		result, err := Expand([]byte(s), true)
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+		if result != nil {
+			t.Fatalf("expecting nil result; got %q", result)
+		}
+	}
+	f("%{ENVTEMPLATE_MISSING_VAR}")
+	f("${ENVTEMPLATE_MISSING_VAR}")
+	f("foo: ${ENVTEMPLATE_MISSING_VAR:-bar}\nbaz: %{ENVTEMPLATE_OTHER_MISSING_VAR}")
 }
@@ -0,0 +1,124 @@
+package flagutil
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// RegisterHotFlag allows changing the flag with the given name at runtime via SetHotFlag.
+//
+// validate is called after the flag value is parsed. The new value is rejected and the previous value is restored
+// if validate returns non-nil error. validate may be nil if the flag value doesn't need additional validation.
+//
+// onChange is called with the initial flag value and then every time the flag value is changed.
+// It must propagate the new value to the code using the flag in a thread-safe manner,
+// since the flag var itself mustn't be read after the startup.
+//
+// RegisterHotFlag must be called from init() functions after the flag is defined.
+func RegisterHotFlag(name string, validate func() error, onChange func()) {
+	f := flag.Lookup(name)
+	if f == nil {
+		panic(fmt.Errorf("BUG: cannot find flag -%s", name))
+	}
+	if _, ok := f.Value.(*hotValue); ok {
+		panic(fmt.Errorf("BUG: flag -%s is already registered as hot", name))
+	}
+	hv := &hotValue{
+		v:        f.Value,
+		validate: validate,
+		onChange: onChange,
+	}
+	f.Value = hv
+	if onChange != nil {
+		onChange()
+	}
+
+	hotFlagsLock.Lock()
+	hotFlags = append(hotFlags, name)
+	sort.Strings(hotFlags)
+	hotFlagsLock.Unlock()
+}
+
+var (
+	hotFlagsLock sync.Mutex
+	hotFlags     []string
+)
+
+// SetHotFlag sets the flag with the given name to the given value at runtime.
+//
+// The flag must be registered via RegisterHotFlag. The previous flag value is returned on success.
+func SetHotFlag(name, value string) (string, error) {
+	f := flag.Lookup(name)
+	if f == nil {
+		return "", fmt.Errorf("unknown flag -%s", name)
+	}
+	hv, ok := f.Value.(*hotValue)
+	if !ok {
+		return "", fmt.Errorf("flag -%s cannot be changed at runtime; supported flags: %s", name, getHotFlagNames())
+	}
+	return hv.swap(value)
+}
+
+// VisitHotFlags calls f for each flag registered via RegisterHotFlag in lexicographical order.
+func VisitHotFlags(f func(name, value string)) {
+	hotFlagsLock.Lock()
+	names := append([]string{}, hotFlags...)
+	hotFlagsLock.Unlock()
+	for _, name := range names {
+		f(name, flag.Lookup(name).Value.String())
+	}
+}
+
+func getHotFlagNames() []string {
+	hotFlagsLock.Lock()
+	defer hotFlagsLock.Unlock()
+	return append([]string{}, hotFlags...)
+}
+
+// hotValue wraps flag.Value for flags, which may be changed at runtime.
+type hotValue struct {
+	mu       sync.Mutex
+	v        flag.Value
+	validate func() error
+	onChange func()
+}
+
+// String implements flag.Value interface.
+func (hv *hotValue) String() string {
+	hv.mu.Lock()
+	defer hv.mu.Unlock()
+	if hv.v == nil {
+		// This is a zero value created by flag.PrintDefaults.
+		return ""
+	}
+	return hv.v.String()
+}
+
+// Set implements flag.Value interface.
+func (hv *hotValue) Set(value string) error {
+	_, err := hv.swap(value)
+	return err
+}
+
+func (hv *hotValue) swap(value string) (string, error) {
+	hv.mu.Lock()
+	defer hv.mu.Unlock()
+	prevValue := hv.v.String()
+	if err := hv.v.Set(value); err != nil {
+		// Restore the previous value, since it may be partially updated.
+		_ = hv.v.Set(prevValue)
+		return "", err
+	}
+	if hv.validate != nil {
+		if err := hv.validate(); err != nil {
+			_ = hv.v.Set(prevValue)
+			return "", fmt.Errorf("invalid value %q: %w", value, err)
+		}
+	}
+	if hv.onChange != nil {
+		hv.onChange()
+	}
+	return prevValue, nil
+}
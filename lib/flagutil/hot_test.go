@@ -0,0 +1,100 @@
+package flagutil
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var (
+	testHotInt      = flag.Int("testHotInt", 123, "test hot int flag")
+	testHotDuration = flag.Duration("testHotDuration", time.Second, "test hot duration flag")
+	testColdInt     = flag.Int("testColdInt", 1, "test flag, which cannot be changed at runtime")
+
+	testHotIntValue int64
+)
+
+func init() {
+	RegisterHotFlag("testHotInt", func() error {
+		if *testHotInt < 0 {
+			return fmt.Errorf("the value cannot be negative; got %d", *testHotInt)
+		}
+		return nil
+	}, func() {
+		atomic.StoreInt64(&testHotIntValue, int64(*testHotInt))
+	})
+	RegisterHotFlag("testHotDuration", nil, nil)
+}
+
+func TestSetHotFlagSuccess(t *testing.T) {
+	if n := atomic.LoadInt64(&testHotIntValue); n != 123 {
+		t.Fatalf("onChange must be called with the initial value; got %d; want 123", n)
+	}
+
+	prevValue, err := SetHotFlag("testHotInt", "456")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if prevValue != "123" {
+		t.Fatalf("unexpected previous value; got %q; want %q", prevValue, "123")
+	}
+	if n := atomic.LoadInt64(&testHotIntValue); n != 456 {
+		t.Fatalf("unexpected value after SetHotFlag; got %d; want 456", n)
+	}
+	if s := flag.Lookup("testHotInt").Value.String(); s != "456" {
+		t.Fatalf("unexpected flag value; got %q; want %q", s, "456")
+	}
+
+	// The flag value must be updated via flag.Set too.
+	if err := flag.Set("testHotInt", "789"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if n := atomic.LoadInt64(&testHotIntValue); n != 789 {
+		t.Fatalf("unexpected value after flag.Set; got %d; want 789", n)
+	}
+
+	if _, err := SetHotFlag("testHotDuration", "5m"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if s := flag.Lookup("testHotDuration").Value.String(); s != "5m0s" {
+		t.Fatalf("unexpected flag value; got %q; want %q", s, "5m0s")
+	}
+
+	var names []string
+	VisitHotFlags(func(name, value string) {
+		names = append(names, name+"="+value)
+	})
+	if s := strings.Join(names, ","); s != "testHotDuration=5m0s,testHotInt=789" {
+		t.Fatalf("unexpected hot flags; got %q", s)
+	}
+}
+
+func TestSetHotFlagFailure(t *testing.T) {
+	f := func(name, value string) {
+		t.Helper()
+		if _, err := SetHotFlag(name, value); err == nil {
+			t.Fatalf("expecting non-nil error for -%s=%q", name, value)
+		}
+	}
+	f("unknownFlag", "1")
+	f("testColdInt", "2")
+	f("testHotInt", "foobar")
+
+	if *testColdInt != 1 {
+		t.Fatalf("unexpected value for the flag, which cannot be changed at runtime; got %d; want 1", *testColdInt)
+	}
+
+	// The value rejected by validate callback mustn't be applied.
+	prevValue := *testHotInt
+	prevHotIntValue := atomic.LoadInt64(&testHotIntValue)
+	f("testHotInt", "-1")
+	if *testHotInt != prevValue {
+		t.Fatalf("unexpected value after the rejected update; got %d; want %d", *testHotInt, prevValue)
+	}
+	if n := atomic.LoadInt64(&testHotIntValue); n != prevHotIntValue {
+		t.Fatalf("onChange mustn't be called for the rejected value; got %d; want %d", n, prevHotIntValue)
+	}
+}
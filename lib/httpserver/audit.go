@@ -0,0 +1,54 @@
+package httpserver
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var auditLogMetrics = flag.Bool("auditLog.metrics", false, "Whether to export vm_audit_events_total{action,user} counters at /metrics page "+
+	"for administrative and destructive API calls such as series deletion, snapshot deletion, cache resets and config reloads. "+
+	"These calls are always logged with INFO level")
+
+// VMAuthUserHeader is the name of the header with the username authenticated by vmauth.
+//
+// vmauth sets this header when proxying requests to backends, so backends can log the caller identity in audit log.
+const VMAuthUserHeader = "X-VMAuth-User"
+
+// LogAuditEvent logs the given administrative or destructive action initiated by r.
+//
+// The log message contains the caller identity - the username authenticated by vmauth or the username from Basic Auth
+// and the remote address of the caller.
+// Optional details for the action can be passed via format and args.
+func LogAuditEvent(r *http.Request, action string, format string, args ...interface{}) {
+	user := getAuditUser(r)
+	details := fmt.Sprintf(format, args...)
+	logger.Infof("%s", getAuditMessage(r, action, user, details))
+	if *auditLogMetrics {
+		metrics.GetOrCreateCounter(getAuditMetricName(action, user)).Inc()
+	}
+}
+
+func getAuditMessage(r *http.Request, action, user, details string) string {
+	if len(details) > 0 {
+		details = "; " + details
+	}
+	return fmt.Sprintf("audit: action=%q, user=%q, path=%q, remoteAddr: %s%s", action, user, r.URL.Path, GetQuotedRemoteAddr(r), details)
+}
+
+func getAuditMetricName(action, user string) string {
+	return fmt.Sprintf(`vm_audit_events_total{action=%q,user=%q}`, action, user)
+}
+
+func getAuditUser(r *http.Request) string {
+	if user := r.Header.Get(VMAuthUserHeader); len(user) > 0 {
+		return user
+	}
+	if username, _, ok := r.BasicAuth(); ok {
+		return username
+	}
+	return ""
+}
@@ -0,0 +1,72 @@
+package httpserver
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+func TestGetAuditMessage(t *testing.T) {
+	f := func(headers map[string]string, basicAuthUser, action, details, messageExpected string) {
+		t.Helper()
+		r := httptest.NewRequest("POST", "/api/v1/admin/tsdb/delete_series", nil)
+		r.RemoteAddr = "1.2.3.4:5678"
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+		if len(basicAuthUser) > 0 {
+			r.SetBasicAuth(basicAuthUser, "password")
+		}
+		message := getAuditMessage(r, action, getAuditUser(r), details)
+		if message != messageExpected {
+			t.Fatalf("unexpected audit message;\ngot\n%s\nwant\n%s", message, messageExpected)
+		}
+	}
+	// Anonymous caller without details
+	f(nil, "", "delete_series", "",
+		`audit: action="delete_series", user="", path="/api/v1/admin/tsdb/delete_series", remoteAddr: "1.2.3.4:5678"`)
+
+	// User from Basic Auth with details
+	f(nil, "alice", "delete_series", `match[]=["foo"], deletedSeries=10`,
+		`audit: action="delete_series", user="alice", path="/api/v1/admin/tsdb/delete_series", remoteAddr: "1.2.3.4:5678"; match[]=["foo"], deletedSeries=10`)
+
+	// User authenticated by vmauth takes precedence over Basic Auth user
+	f(map[string]string{VMAuthUserHeader: "bob"}, "alice", "snapshot_delete", `snapshot="foo"`,
+		`audit: action="snapshot_delete", user="bob", path="/api/v1/admin/tsdb/delete_series", remoteAddr: "1.2.3.4:5678"; snapshot="foo"`)
+
+	// Untrusted user and X-Forwarded-For must be quoted
+	f(map[string]string{VMAuthUserHeader: "bob\", user=\"admin", "X-Forwarded-For": "5.6.7.8\n"}, "", "config_reload", "",
+		`audit: action="config_reload", user="bob\", user=\"admin", path="/api/v1/admin/tsdb/delete_series", remoteAddr: "1.2.3.4:5678", X-Forwarded-For: "5.6.7.8\n"`)
+}
+
+func TestLogAuditEventMetrics(t *testing.T) {
+	origAuditLogMetrics := *auditLogMetrics
+	defer func() {
+		*auditLogMetrics = origAuditLogMetrics
+	}()
+
+	r := httptest.NewRequest("POST", "/snapshot/delete", nil)
+	r.Header.Set(VMAuthUserHeader, "test-audit-user")
+	metricName := getAuditMetricName("snapshot_delete", "test-audit-user")
+	if metricName != `vm_audit_events_total{action="snapshot_delete",user="test-audit-user"}` {
+		t.Fatalf("unexpected metric name: %s", metricName)
+	}
+
+	counterBefore := metrics.GetOrCreateCounter(metricName).Get()
+
+	// Metrics mustn't be updated when -auditLog.metrics isn't set
+	*auditLogMetrics = false
+	LogAuditEvent(r, "snapshot_delete", "snapshot=%q", "foo")
+	LogAuditEvent(r, "snapshot_delete", "snapshot=%q", "foo")
+	if n := metrics.GetOrCreateCounter(metricName).Get() - counterBefore; n != 0 {
+		t.Fatalf("unexpected counter value with disabled -auditLog.metrics; got %d; want 0", n)
+	}
+
+	*auditLogMetrics = true
+	LogAuditEvent(r, "snapshot_delete", "snapshot=%q", "foo")
+	LogAuditEvent(r, "snapshot_delete", "snapshot=%q", "bar")
+	if n := metrics.GetOrCreateCounter(metricName).Get() - counterBefore; n != 2 {
+		t.Fatalf("unexpected counter value; got %d; want 2", n)
+	}
+}
@@ -0,0 +1,71 @@
+package httpserver
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var flagsAuthKey = flag.String("flagsAuthKey", "", "Auth key for /-/flags page, which allows changing a subset of command-line flags at runtime. "+
+	"It must be passed via authKey query arg. The page is disabled if the flag is empty")
+
+// flagsHandler processes /-/flags requests.
+//
+// GET request returns the current values for flags, which may be changed at runtime.
+// POST request with `name` and `value` query args changes the given flag.
+func flagsHandler(w http.ResponseWriter, r *http.Request) {
+	flagsRequests.Inc()
+	if len(*flagsAuthKey) == 0 {
+		http.Error(w, "The /-/flags page is disabled; set -flagsAuthKey command-line flag for enabling it", http.StatusForbidden)
+		return
+	}
+	if r.FormValue("authKey") != *flagsAuthKey {
+		http.Error(w, "The provided authKey doesn't match -flagsAuthKey", http.StatusUnauthorized)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		var flags []hotFlag
+		flagutil.VisitHotFlags(func(name, value string) {
+			flags = append(flags, hotFlag{
+				name:  name,
+				value: value,
+			})
+		})
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		writehotFlagsResponse(w, flags)
+	case http.MethodPost:
+		name := r.FormValue("name")
+		if len(name) == 0 {
+			Errorf(w, r, "missing `name` query arg")
+			return
+		}
+		value := r.FormValue("value")
+		prevValue, err := flagutil.SetHotFlag(name, value)
+		if err != nil {
+			flagsErrors.Inc()
+			Errorf(w, r, "cannot set -%s=%q: %s", name, value, err)
+			return
+		}
+		newValue := flag.Lookup(name).Value.String()
+		logger.Infof("flag -%s has been changed from %q to %q via /-/flags page; remoteAddr: %s", name, prevValue, newValue, GetQuotedRemoteAddr(r))
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		writehotFlagChangeResponse(w, name, prevValue, newValue)
+	default:
+		http.Error(w, fmt.Sprintf("unsupported method %q; supported methods: GET, POST", r.Method), http.StatusMethodNotAllowed)
+	}
+}
+
+type hotFlag struct {
+	name  string
+	value string
+}
+
+var (
+	flagsRequests = metrics.NewCounter(`vm_http_requests_total{path="/-/flags"}`)
+	flagsErrors   = metrics.NewCounter(`vm_http_request_errors_total{path="/-/flags"}`)
+)
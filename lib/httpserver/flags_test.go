@@ -0,0 +1,78 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+)
+
+var testHotString = flag.String("testHotString", "foo", "test hot string flag")
+
+func init() {
+	flagutil.RegisterHotFlag("testHotString", nil, nil)
+}
+
+func TestFlagsHandler(t *testing.T) {
+	origAuthKey := *flagsAuthKey
+	*flagsAuthKey = "secret"
+	*testHotString = "foo"
+	defer func() {
+		*flagsAuthKey = origAuthKey
+		*testHotString = "foo"
+	}()
+
+	doRequest := func(method string, args url.Values, dst interface{}) {
+		t.Helper()
+		args.Set("authKey", "secret")
+		r := httptest.NewRequest(method, "/-/flags?"+args.Encode(), nil)
+		w := httptest.NewRecorder()
+		flagsHandler(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("unexpected status code; got %d; want %d; response body: %q", w.Code, http.StatusOK, w.Body.String())
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), dst); err != nil {
+			t.Fatalf("cannot unmarshal response %q: %s", w.Body.String(), err)
+		}
+	}
+
+	// The value contains chars, which must be properly encoded in JSON.
+	value := "a\"b\\c\x01<"
+	var changeResp struct {
+		Status string
+		Data   struct {
+			Name          string
+			PreviousValue string
+			Value         string
+		}
+	}
+	doRequest("POST", url.Values{
+		"name":  {"testHotString"},
+		"value": {value},
+	}, &changeResp)
+	if changeResp.Status != "success" {
+		t.Fatalf("unexpected status; got %q; want %q", changeResp.Status, "success")
+	}
+	if changeResp.Data.Name != "testHotString" || changeResp.Data.PreviousValue != "foo" || changeResp.Data.Value != value {
+		t.Fatalf("unexpected response data: %+v", changeResp.Data)
+	}
+	if *testHotString != value {
+		t.Fatalf("unexpected flag value; got %q; want %q", *testHotString, value)
+	}
+
+	var flagsResp struct {
+		Status string
+		Data   map[string]string
+	}
+	doRequest("GET", url.Values{}, &flagsResp)
+	if flagsResp.Status != "success" {
+		t.Fatalf("unexpected status; got %q; want %q", flagsResp.Status, "success")
+	}
+	if v := flagsResp.Data["testHotString"]; v != value {
+		t.Fatalf("unexpected value for testHotString flag; got %q; want %q", v, value)
+	}
+}
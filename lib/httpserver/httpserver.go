@@ -19,8 +19,11 @@ import (
 	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/netutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/profiling"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/tracing"
 	"github.com/VictoriaMetrics/metrics"
 	"github.com/klauspost/compress/gzip"
 	"github.com/valyala/fastrand"
@@ -28,8 +31,13 @@ import (
 
 var (
 	tlsEnable   = flag.Bool("tls", false, "Whether to enable TLS (aka HTTPS) for incoming requests. -tlsCertFile and -tlsKeyFile must be set if -tls is set")
-	tlsCertFile = flag.String("tlsCertFile", "", "Path to file with TLS certificate. Used only if -tls is set. Prefer ECDSA certs instead of RSA certs, since RSA certs are slow")
-	tlsKeyFile  = flag.String("tlsKeyFile", "", "Path to file with TLS key. Used only if -tls is set")
+	tlsCertFile = flagutil.NewArray("tlsCertFile", "Path to file with TLS certificate. Used only if -tls is set. Prefer ECDSA certs instead of RSA certs, since RSA certs are slow. "+
+		"Multiple certificates may be set for serving distinct domains. In this case the certificate is selected by the server name requested by client via SNI, "+
+		"while the first certificate is used if there is no matching certificate")
+	tlsKeyFile = flagutil.NewArray("tlsKeyFile", "Path to file with TLS key. Used only if -tls is set. The number of -tlsKeyFile values must match the number of -tlsCertFile values")
+	mtlsCAFile = flag.String("mtlsCAFile", "", "Optional path to TLS Root CA for verifying client certificates. Used only if -tls is set. "+
+		"Client certificates are verified only if they are provided by clients unless -mtls is set")
+	mtlsEnable = flag.Bool("mtls", false, "Whether to require valid client certificate for https requests. Used only if -tls is set. See also -mtlsCAFile")
 
 	pathPrefix = flag.String("http.pathPrefix", "", "An optional prefix to add to all the paths handled by http server. For example, if '-http.pathPrefix=/foo/bar' is set, "+
 		"then all the http requests will be handled on '/foo/bar/*' paths. This may be useful for proxied requests. "+
@@ -37,7 +45,7 @@ var (
 	httpAuthUsername = flag.String("httpAuth.username", "", "Username for HTTP Basic Auth. The authentication is disabled if empty. See also -httpAuth.password")
 	httpAuthPassword = flag.String("httpAuth.password", "", "Password for HTTP Basic Auth. The authentication is disabled if -httpAuth.username is empty")
 	metricsAuthKey   = flag.String("metricsAuthKey", "", "Auth key for /metrics. It overrides httpAuth settings")
-	pprofAuthKey     = flag.String("pprofAuthKey", "", "Auth key for /debug/pprof. It overrides httpAuth settings")
+	pprofAuthKey     = flag.String("pprofAuthKey", "", "Auth key for /debug/pprof and /debug/profiles. It overrides httpAuth settings")
 
 	disableResponseCompression  = flag.Bool("http.disableResponseCompression", false, "Disable compression of HTTP responses for saving CPU resources. By default compression is enabled to save network bandwidth")
 	maxGracefulShutdownDuration = flag.Duration("http.maxGracefulShutdownDuration", 7*time.Second, "The maximum duration for graceful shutdown of HTTP server. "+
@@ -79,6 +87,10 @@ func Serve(addr string, rh RequestHandler) {
 	if *tlsEnable {
 		scheme = "https"
 	}
+	// Initialize tracing for request spans. This is no-op if tracing is already initialized or if it is disabled.
+	tracing.Init()
+	// Start capturing profiles on high memory usage. This is no-op if it is already started or if -profiling.dir isn't set.
+	profiling.Init()
 	logger.Infof("starting http server at %s://%s/", scheme, addr)
 	logger.Infof("pprof handlers are exposed at %s://%s/debug/pprof/", scheme, addr)
 	lnTmp, err := netutil.NewTCPListener(scheme, addr)
@@ -88,14 +100,12 @@ func Serve(addr string, rh RequestHandler) {
 	ln := net.Listener(lnTmp)
 
 	if *tlsEnable {
-		cert, err := tls.LoadX509KeyPair(*tlsCertFile, *tlsKeyFile)
+		tcl, err := newTLSConfigLoader()
 		if err != nil {
-			logger.Fatalf("cannot load TLS cert from tlsCertFile=%q, tlsKeyFile=%q: %s", *tlsCertFile, *tlsKeyFile, err)
+			logger.Fatalf("cannot load TLS config: %s", err)
 		}
 		cfg := &tls.Config{
-			Certificates:             []tls.Certificate{cert},
-			MinVersion:               tls.VersionTLS12,
-			PreferServerCipherSuites: true,
+			GetConfigForClient: tcl.getConfigForClient,
 		}
 		ln = tls.NewListener(ln, cfg)
 	}
@@ -235,6 +245,9 @@ func handlerWrapper(s *server, w http.ResponseWriter, r *http.Request, rh Reques
 		}
 		w.WriteHeader(status)
 		return
+	case "/-/flags":
+		flagsHandler(w, r)
+		return
 	case "/favicon.ico":
 		faviconRequests.Inc()
 		w.WriteHeader(http.StatusNoContent)
@@ -261,10 +274,23 @@ func handlerWrapper(s *server, w http.ResponseWriter, r *http.Request, rh Reques
 			pprofHandler(r.URL.Path[len("/debug/pprof/"):], w, r)
 			return
 		}
+		if r.URL.Path == "/debug/profiles" || strings.HasPrefix(r.URL.Path, "/debug/profiles/") {
+			profilesRequests.Inc()
+			if len(*pprofAuthKey) > 0 && r.FormValue("authKey") != *pprofAuthKey {
+				http.Error(w, "The provided authKey doesn't match -pprofAuthKey", http.StatusUnauthorized)
+				return
+			}
+			profilesHandler(r.URL.Path[len("/debug/profiles"):], w, r)
+			return
+		}
 
 		if !checkBasicAuth(w, r) {
 			return
 		}
+		if span := tracing.StartRequestSpan(r); span != nil {
+			r = r.WithContext(tracing.ContextWithSpan(r.Context(), span))
+			defer span.End()
+		}
 		if rh(w, r) {
 			return
 		}
@@ -0,0 +1,100 @@
+package httpserver
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/profiling"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// profilesHandler serves /debug/profiles/* requests for profile snapshots captured by lib/profiling.
+func profilesHandler(path string, w http.ResponseWriter, r *http.Request) {
+	switch path {
+	case "", "/", "/list":
+		profilesListRequests.Inc()
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		snapshots, err := profiling.ListSnapshots()
+		if err != nil {
+			profilesJSONResponseError(w, fmt.Errorf("cannot list profile snapshots: %w", err))
+			return
+		}
+		fmt.Fprintf(w, `{"status":"ok","snapshots":[`)
+		for i, snapshot := range snapshots {
+			if i > 0 {
+				fmt.Fprintf(w, ",")
+			}
+			fmt.Fprintf(w, "\n%q", snapshot)
+		}
+		fmt.Fprintf(w, "\n]}")
+	case "/create":
+		profilesCreateRequests.Inc()
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		snapshot, err := profiling.CreateSnapshot(profiling.ReasonManual)
+		if err != nil {
+			profilesJSONResponseError(w, fmt.Errorf("cannot create profile snapshot: %w", err))
+			return
+		}
+		LogAuditEvent(r, "profile_snapshot_create", "snapshot=%q", snapshot)
+		fmt.Fprintf(w, `{"status":"ok","snapshot":%q}`, snapshot)
+	case "/download":
+		profilesDownloadRequests.Inc()
+		var snapshots []string
+		if s := r.FormValue("snapshot"); len(s) > 0 {
+			snapshots = strings.Split(s, ",")
+		}
+		// Verify snapshot names before writing the response, so the error could be returned to the client.
+		existingSnapshots, err := profiling.ListSnapshots()
+		if err != nil {
+			Errorf(w, r, "cannot list profile snapshots: %s", err)
+			return
+		}
+		for _, snapshot := range snapshots {
+			if !containsString(existingSnapshots, snapshot) {
+				Errorf(w, r, "%s", &ErrorWithStatusCode{
+					Err:        fmt.Errorf("cannot find profile snapshot %q", snapshot),
+					StatusCode: http.StatusNotFound,
+				})
+				return
+			}
+		}
+		filename := "profiles.tar.gz"
+		if len(snapshots) == 1 {
+			filename = "profiles-" + snapshots[0] + ".tar.gz"
+		}
+		DisableResponseCompression(w)
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		if err := profiling.WriteBundle(w, snapshots); err != nil {
+			Errorf(w, r, "cannot write profile snapshots: %s", err)
+			return
+		}
+	default:
+		Errorf(w, r, "unsupported path requested: %q", "/debug/profiles"+path)
+		unsupportedRequestErrors.Inc()
+	}
+}
+
+func profilesJSONResponseError(w http.ResponseWriter, err error) {
+	logger.Errorf("%s", err)
+	w.WriteHeader(http.StatusInternalServerError)
+	fmt.Fprintf(w, `{"status":"error","msg":%q}`, err)
+}
+
+func containsString(a []string, s string) bool {
+	for _, x := range a {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	profilesRequests         = metrics.NewCounter(`vm_http_requests_total{path="/debug/profiles"}`)
+	profilesListRequests     = metrics.NewCounter(`vm_http_requests_total{path="/debug/profiles/list"}`)
+	profilesCreateRequests   = metrics.NewCounter(`vm_http_requests_total{path="/debug/profiles/create"}`)
+	profilesDownloadRequests = metrics.NewCounter(`vm_http_requests_total{path="/debug/profiles/download"}`)
+)
@@ -0,0 +1,163 @@
+package httpserver
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var tlsCheckInterval = flag.Duration("tlsCheckInterval", 5*time.Second, "Interval for checking for changes in -tlsCertFile, -tlsKeyFile and -mtlsCAFile. "+
+	"Updated files are automatically loaded without the need to restart the process, so short-living certificates could be rotated without downtime. "+
+	"Files are checked only during TLS handshakes for new connections. Zero value disables the check")
+
+// tlsConfigLoader loads TLS config for incoming connections from -tlsCertFile, -tlsKeyFile and -mtlsCAFile.
+//
+// The config is automatically reloaded when these files are changed.
+type tlsConfigLoader struct {
+	mu sync.Mutex
+
+	cfg *tls.Config
+
+	// lastCheckTime is the last time in unix seconds when the files were checked for changes.
+	lastCheckTime uint64
+
+	// modTimes contains modification times for files the cfg has been loaded from.
+	modTimes []time.Time
+}
+
+func newTLSConfigLoader() (*tlsConfigLoader, error) {
+	var tcl tlsConfigLoader
+	tcl.modTimes = getTLSFilesModTimes()
+	cfg, err := loadTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	tcl.cfg = cfg
+	tcl.lastCheckTime = fasttime.UnixTimestamp()
+	return &tcl, nil
+}
+
+// getConfigForClient implements tls.Config.GetConfigForClient callback.
+func (tcl *tlsConfigLoader) getConfigForClient(_ *tls.ClientHelloInfo) (*tls.Config, error) {
+	tcl.mu.Lock()
+	defer tcl.mu.Unlock()
+
+	checkInterval := uint64(tlsCheckInterval.Seconds())
+	currentTime := fasttime.UnixTimestamp()
+	if checkInterval == 0 || currentTime-tcl.lastCheckTime < checkInterval {
+		return tcl.cfg, nil
+	}
+	tcl.lastCheckTime = currentTime
+	modTimes := getTLSFilesModTimes()
+	if equalModTimes(modTimes, tcl.modTimes) {
+		return tcl.cfg, nil
+	}
+	// Remember modTimes even if the config cannot be loaded, so the error isn't logged on every TLS handshake.
+	// The config will be re-loaded on the next change of the files, e.g. when the key is updated after the cert.
+	tcl.modTimes = modTimes
+	cfg, err := loadTLSConfig()
+	if err != nil {
+		tlsConfigReloadErrors.Inc()
+		logger.Errorf("cannot reload TLS config; continuing using the previously loaded config; error: %s", err)
+		return tcl.cfg, nil
+	}
+	tlsConfigReloads.Inc()
+	logger.Infof("reloaded TLS config from -tlsCertFile=%q, -tlsKeyFile=%q, -mtlsCAFile=%q", tlsCertFile, tlsKeyFile, *mtlsCAFile)
+	tcl.cfg = cfg
+	return cfg, nil
+}
+
+var (
+	tlsConfigReloads      = metrics.NewCounter(`vm_tls_config_reloads_total`)
+	tlsConfigReloadErrors = metrics.NewCounter(`vm_tls_config_reload_errors_total`)
+)
+
+func getTLSFilesModTimes() []time.Time {
+	var paths []string
+	paths = append(paths, *tlsCertFile...)
+	paths = append(paths, *tlsKeyFile...)
+	paths = append(paths, *mtlsCAFile)
+	modTimes := make([]time.Time, len(paths))
+	for i, path := range paths {
+		if len(path) == 0 {
+			continue
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			// The error is returned from loadTLSConfig.
+			continue
+		}
+		modTimes[i] = fi.ModTime()
+	}
+	return modTimes
+}
+
+func equalModTimes(a, b []time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func loadTLSConfig() (*tls.Config, error) {
+	if len(*tlsCertFile) == 0 {
+		return nil, fmt.Errorf("missing -tlsCertFile")
+	}
+	if len(*tlsCertFile) != len(*tlsKeyFile) {
+		return nil, fmt.Errorf("the number of -tlsCertFile values must match the number of -tlsKeyFile values; got %d vs %d", len(*tlsCertFile), len(*tlsKeyFile))
+	}
+	certs := make([]tls.Certificate, len(*tlsCertFile))
+	for i, certFile := range *tlsCertFile {
+		keyFile := (*tlsKeyFile)[i]
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load TLS cert from -tlsCertFile=%q, -tlsKeyFile=%q: %w", certFile, keyFile, err)
+		}
+		certs[i] = cert
+	}
+	cfg := &tls.Config{
+		Certificates:             certs,
+		MinVersion:               tls.VersionTLS12,
+		PreferServerCipherSuites: true,
+	}
+	// The certificate is selected by SNI if multiple certificates are set. The first certificate is used by default.
+	// NameToCertificate is needed for SNI-based selection in Go before 1.14.
+	cfg.BuildNameToCertificate()
+	if err := setClientAuth(cfg); err != nil {
+		return nil, fmt.Errorf("cannot configure client certificate verification: %w", err)
+	}
+	return cfg, nil
+}
+
+func setClientAuth(cfg *tls.Config) error {
+	if len(*mtlsCAFile) > 0 {
+		data, err := ioutil.ReadFile(*mtlsCAFile)
+		if err != nil {
+			return fmt.Errorf("cannot read -mtlsCAFile=%q: %w", *mtlsCAFile, err)
+		}
+		cp := x509.NewCertPool()
+		if !cp.AppendCertsFromPEM(data) {
+			return fmt.Errorf("cannot parse data from -mtlsCAFile=%q", *mtlsCAFile)
+		}
+		cfg.ClientCAs = cp
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	if *mtlsEnable {
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package httpserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+)
+
+func TestTLSConfigLoaderReload(t *testing.T) {
+	dir := mustCreateTempDir(t)
+	defer mustRemoveAll(t, dir)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	mustWriteCert(t, certFile, keyFile, "foo-1", nil)
+	defer setTLSFlags([]string{certFile}, []string{keyFile})()
+
+	tcl, err := newTLSConfigLoader()
+	if err != nil {
+		t.Fatalf("cannot create TLS config loader: %s", err)
+	}
+	checkServedCert(t, tcl, "", "foo-1")
+
+	// Rotate the certificate.
+	mustWriteCert(t, certFile, keyFile, "foo-2", nil)
+	mustUpdateModTime(t, time.Minute, certFile, keyFile)
+
+	// The old certificate must be served until -tlsCheckInterval passes.
+	checkServedCert(t, tcl, "", "foo-1")
+
+	// The new certificate must be served after -tlsCheckInterval.
+	resetLastCheckTime(tcl)
+	checkServedCert(t, tcl, "", "foo-2")
+
+	// The previous certificate must be served if the updated files cannot be loaded,
+	// e.g. when the cert is updated before the key.
+	mustWriteCert(t, certFile, filepath.Join(dir, "new-key.pem"), "foo-3", nil)
+	mustUpdateModTime(t, 2*time.Minute, certFile)
+	resetLastCheckTime(tcl)
+	checkServedCert(t, tcl, "", "foo-2")
+
+	// The new certificate must be served after the key is updated.
+	if err := os.Rename(filepath.Join(dir, "new-key.pem"), keyFile); err != nil {
+		t.Fatalf("cannot update key file: %s", err)
+	}
+	mustUpdateModTime(t, 3*time.Minute, keyFile)
+	resetLastCheckTime(tcl)
+	checkServedCert(t, tcl, "", "foo-3")
+}
+
+func TestTLSConfigLoaderSNI(t *testing.T) {
+	dir := mustCreateTempDir(t)
+	defer mustRemoveAll(t, dir)
+
+	fooCertFile := filepath.Join(dir, "foo-cert.pem")
+	fooKeyFile := filepath.Join(dir, "foo-key.pem")
+	mustWriteCert(t, fooCertFile, fooKeyFile, "foo", []string{"foo.example.com"})
+	barCertFile := filepath.Join(dir, "bar-cert.pem")
+	barKeyFile := filepath.Join(dir, "bar-key.pem")
+	mustWriteCert(t, barCertFile, barKeyFile, "bar", []string{"bar.example.com", "*.bar.example.com"})
+	defer setTLSFlags([]string{fooCertFile, barCertFile}, []string{fooKeyFile, barKeyFile})()
+
+	tcl, err := newTLSConfigLoader()
+	if err != nil {
+		t.Fatalf("cannot create TLS config loader: %s", err)
+	}
+
+	// The certificate is selected by SNI.
+	checkServedCert(t, tcl, "foo.example.com", "foo")
+	checkServedCert(t, tcl, "bar.example.com", "bar")
+	checkServedCert(t, tcl, "baz.bar.example.com", "bar")
+
+	// The first certificate is used by default.
+	checkServedCert(t, tcl, "", "foo")
+	checkServedCert(t, tcl, "unknown.example.com", "foo")
+
+	// The certificate for the given SNI must be updated on rotation.
+	mustWriteCert(t, barCertFile, barKeyFile, "bar-2", []string{"bar.example.com"})
+	mustUpdateModTime(t, time.Minute, barCertFile, barKeyFile)
+	resetLastCheckTime(tcl)
+	checkServedCert(t, tcl, "bar.example.com", "bar-2")
+	checkServedCert(t, tcl, "foo.example.com", "foo")
+}
+
+func TestLoadTLSConfigFailure(t *testing.T) {
+	dir := mustCreateTempDir(t)
+	defer mustRemoveAll(t, dir)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	mustWriteCert(t, certFile, keyFile, "foo", nil)
+
+	f := func(certFiles, keyFiles []string) {
+		t.Helper()
+		restore := setTLSFlags(certFiles, keyFiles)
+		defer restore()
+		if _, err := loadTLSConfig(); err == nil {
+			t.Fatalf("expecting non-nil error for -tlsCertFile=%q, -tlsKeyFile=%q", certFiles, keyFiles)
+		}
+	}
+	f(nil, nil)
+	f([]string{certFile}, nil)
+	f([]string{certFile, certFile}, []string{keyFile})
+	f([]string{certFile}, []string{filepath.Join(dir, "missing.pem")})
+	f([]string{keyFile}, []string{certFile})
+}
+
+func checkServedCert(t *testing.T, tcl *tlsConfigLoader, serverName, commonNameExpected string) {
+	t.Helper()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		GetConfigForClient: tcl.getConfigForClient,
+	})
+	if err != nil {
+		t.Fatalf("cannot start TLS listener: %s", err)
+	}
+	defer func() {
+		_ = ln.Close()
+	}()
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		_ = c.(*tls.Conn).Handshake()
+		_ = c.Close()
+	}()
+	c, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		t.Fatalf("cannot establish TLS connection: %s", err)
+	}
+	defer func() {
+		_ = c.Close()
+	}()
+	certs := c.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		t.Fatalf("missing server certificate")
+	}
+	if commonName := certs[0].Subject.CommonName; commonName != commonNameExpected {
+		t.Fatalf("unexpected certificate served for server name %q; got %q; want %q", serverName, commonName, commonNameExpected)
+	}
+}
+
+func resetLastCheckTime(tcl *tlsConfigLoader) {
+	tcl.mu.Lock()
+	tcl.lastCheckTime = 0
+	tcl.mu.Unlock()
+}
+
+func setTLSFlags(certFiles, keyFiles []string) func() {
+	prevCertFiles, prevKeyFiles := *tlsCertFile, *tlsKeyFile
+	*tlsCertFile = flagutil.Array(certFiles)
+	*tlsKeyFile = flagutil.Array(keyFiles)
+	return func() {
+		*tlsCertFile = prevCertFiles
+		*tlsKeyFile = prevKeyFiles
+	}
+}
+
+func mustWriteCert(t *testing.T, certFile, keyFile, commonName string, dnsNames []string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("cannot generate key: %s", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject: pkix.Name{
+			CommonName: commonName,
+		},
+		DNSNames:  dnsNames,
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter:  time.Now().Add(time.Hour),
+		KeyUsage:  x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{
+			x509.ExtKeyUsageServerAuth,
+		},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("cannot create certificate: %s", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("cannot marshal key: %s", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := ioutil.WriteFile(certFile, certPEM, 0600); err != nil {
+		t.Fatalf("cannot write certificate: %s", err)
+	}
+	if err := ioutil.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		t.Fatalf("cannot write key: %s", err)
+	}
+}
+
+// mustUpdateModTime sets modification time for the given files to now+offset.
+//
+// This guarantees that the modification is detected regardless of the file system timestamp resolution.
+func mustUpdateModTime(t *testing.T, offset time.Duration, paths ...string) {
+	t.Helper()
+	modTime := time.Now().Add(offset)
+	for _, path := range paths {
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("cannot update modification time for %q: %s", path, err)
+		}
+	}
+}
+
+func mustCreateTempDir(t *testing.T) string {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "httpserver-tls")
+	if err != nil {
+		t.Fatalf("cannot create temporary dir: %s", err)
+	}
+	return dir
+}
+
+func mustRemoveAll(t *testing.T, dir string) {
+	t.Helper()
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatalf("cannot remove %q: %s", dir, err)
+	}
+}
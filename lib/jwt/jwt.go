@@ -0,0 +1,388 @@
+package jwt
+
+import (
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// VerifierConfig is the configuration for Verifier.
+type VerifierConfig struct {
+	// Issuer is OIDC issuer URL. The `iss` claim must match Issuer if it isn't empty.
+	//
+	// JWKS url is discovered via <Issuer>/.well-known/openid-configuration if JWKSURL is empty.
+	Issuer string
+
+	// JWKSURL is an optional url for fetching JSON Web Key Set.
+	JWKSURL string
+
+	// Audience is an optional audience, which must be present in `aud` claim.
+	Audience string
+
+	// RefreshInterval is the interval for refreshing JSON Web Key Set from JWKSURL.
+	RefreshInterval time.Duration
+}
+
+// Verifier verifies JWT tokens with the keys obtained from JSON Web Key Set.
+//
+// Verifier is safe to use from concurrently running goroutines.
+type Verifier struct {
+	issuer          string
+	audience        string
+	jwksURL         string
+	refreshInterval time.Duration
+
+	mu   sync.Mutex
+	keys map[string]crypto.PublicKey
+
+	// lastRefreshTime is the time of the last successful JWKS refresh.
+	lastRefreshTime time.Time
+
+	// nextRefreshTime is the earliest time for the next JWKS refresh.
+	nextRefreshTime time.Time
+
+	// refreshBackoff is the delay before the next refresh attempt after failed refreshes.
+	refreshBackoff time.Duration
+
+	// refreshCh is non-nil while JWKS refresh is in progress. It is closed when the refresh is complete.
+	refreshCh chan struct{}
+}
+
+// NewVerifier returns new Verifier for the given cfg.
+//
+// JSON Web Key Set is fetched on the first Verify call if it cannot be fetched in NewVerifier.
+func NewVerifier(cfg *VerifierConfig) (*Verifier, error) {
+	if len(cfg.Issuer) == 0 && len(cfg.JWKSURL) == 0 {
+		return nil, fmt.Errorf("issuer or jwksURL must be set")
+	}
+	jwksURL := cfg.JWKSURL
+	if len(jwksURL) == 0 {
+		u, err := discoverJWKSURL(cfg.Issuer)
+		if err != nil {
+			return nil, fmt.Errorf("cannot discover JWKS url for issuer %q: %w", cfg.Issuer, err)
+		}
+		jwksURL = u
+	}
+	refreshInterval := cfg.RefreshInterval
+	if refreshInterval <= 0 {
+		refreshInterval = time.Hour
+	}
+	v := &Verifier{
+		issuer:          cfg.Issuer,
+		audience:        cfg.Audience,
+		jwksURL:         jwksURL,
+		refreshInterval: refreshInterval,
+	}
+	if err := v.refreshKeys(); err != nil {
+		logger.Errorf("cannot fetch JWKS from %q: %s; it will be fetched again on the next JWT validation", jwksURL, err)
+	}
+	return v, nil
+}
+
+var jwksHTTPClient = &http.Client{
+	Timeout: 10 * time.Second,
+}
+
+func discoverJWKSURL(issuerURL string) (string, error) {
+	configURL := strings.TrimSuffix(issuerURL, "/") + "/.well-known/openid-configuration"
+	data, err := readURL(configURL)
+	if err != nil {
+		return "", err
+	}
+	var cfg struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return "", fmt.Errorf("cannot parse OpenID configuration obtained from %q: %w", configURL, err)
+	}
+	if len(cfg.JWKSURI) == 0 {
+		return "", fmt.Errorf("missing `jwks_uri` in OpenID configuration obtained from %q", configURL)
+	}
+	return cfg.JWKSURI, nil
+}
+
+// maxJWKSResponseSize is the maximum size of JWKS response.
+const maxJWKSResponseSize = 1024 * 1024
+
+func readURL(u string) ([]byte, error) {
+	resp, err := jwksHTTPClient.Get(u)
+	if err != nil {
+		return nil, fmt.Errorf("cannot fetch %q: %w", u, err)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxJWKSResponseSize+1))
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read response from %q: %w", u, err)
+	}
+	if len(data) > maxJWKSResponseSize {
+		return nil, fmt.Errorf("too big response from %q; it mustn't exceed %d bytes", u, maxJWKSResponseSize)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code when fetching %q: %d; want %d; response: %q", u, resp.StatusCode, http.StatusOK, data)
+	}
+	return data, nil
+}
+
+var (
+	jwksRefreshes      = metrics.NewCounter(`vm_jwks_refreshes_total`)
+	jwksRefreshErrors  = metrics.NewCounter(`vm_jwks_refresh_errors_total`)
+	jwtValidationFails = metrics.NewCounter(`vm_jwt_validation_errors_total`)
+)
+
+// minJWKSRefreshInterval is the minimum interval between JWKS refreshes triggered by tokens with unknown `kid`.
+//
+// It is also the initial backoff for retrying failed JWKS refreshes.
+const minJWKSRefreshInterval = 10 * time.Second
+
+// maxJWKSRefreshBackoff is the maximum backoff for retrying failed JWKS refreshes.
+const maxJWKSRefreshBackoff = 5 * time.Minute
+
+func (v *Verifier) refreshKeys() error {
+	keys, err := v.fetchKeys()
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err != nil {
+		// Back off exponentially, so unavailable JWKS url isn't hammered by requests with unknown `kid`.
+		v.refreshBackoff *= 2
+		if v.refreshBackoff < minJWKSRefreshInterval {
+			v.refreshBackoff = minJWKSRefreshInterval
+		}
+		if v.refreshBackoff > maxJWKSRefreshBackoff {
+			v.refreshBackoff = maxJWKSRefreshBackoff
+		}
+		v.nextRefreshTime = time.Now().Add(v.refreshBackoff)
+		return err
+	}
+	v.keys = keys
+	v.lastRefreshTime = time.Now()
+	v.nextRefreshTime = v.lastRefreshTime.Add(minJWKSRefreshInterval)
+	v.refreshBackoff = 0
+	return nil
+}
+
+func (v *Verifier) fetchKeys() (map[string]crypto.PublicKey, error) {
+	jwksRefreshes.Inc()
+	data, err := readURL(v.jwksURL)
+	if err != nil {
+		jwksRefreshErrors.Inc()
+		return nil, err
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		jwksRefreshErrors.Inc()
+		return nil, fmt.Errorf("cannot parse JWKS obtained from %q: %w", v.jwksURL, err)
+	}
+	return keys, nil
+}
+
+// startRefreshLocked starts background JWKS refresh unless it is already in progress.
+//
+// It returns a channel, which is closed when the refresh is complete.
+// v.mu must be locked when calling this function.
+func (v *Verifier) startRefreshLocked() chan struct{} {
+	if v.refreshCh != nil {
+		return v.refreshCh
+	}
+	ch := make(chan struct{})
+	v.refreshCh = ch
+	go func() {
+		if err := v.refreshKeys(); err != nil {
+			logger.Errorf("cannot refresh JWKS: %s", err)
+		}
+		v.mu.Lock()
+		v.refreshCh = nil
+		v.mu.Unlock()
+		close(ch)
+	}()
+	return ch
+}
+
+// getKey returns the key for the given kid.
+//
+// It refreshes keys if they are outdated or if the kid is missing.
+// Concurrent callers share a single refresh, while failed refreshes are retried with exponential backoff.
+// Outdated keys are refreshed in background, so callers with known kid aren't blocked by the refresh.
+func (v *Verifier) getKey(kid string) (crypto.PublicKey, error) {
+	v.mu.Lock()
+	key, ok := v.keys[kid]
+	refreshCh := v.refreshCh
+	if refreshCh == nil {
+		currentTime := time.Now()
+		if !currentTime.Before(v.nextRefreshTime) && (!ok || currentTime.Sub(v.lastRefreshTime) >= v.refreshInterval) {
+			refreshCh = v.startRefreshLocked()
+		}
+	}
+	v.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+	if refreshCh != nil {
+		<-refreshCh
+		v.mu.Lock()
+		key, ok = v.keys[kid]
+		v.mu.Unlock()
+	}
+	if !ok {
+		return nil, fmt.Errorf("cannot find key with kid=%q at %q", kid, v.jwksURL)
+	}
+	return key, nil
+}
+
+// Verify verifies the given token at currentTime and returns its claims.
+//
+// The following is verified:
+//
+//   - the token is signed by a key from JSON Web Key Set;
+//   - the token isn't expired according to `exp` claim and is already valid according to the optional `nbf` claim;
+//   - `iss` claim matches VerifierConfig.Issuer if it is set;
+//   - `aud` claim contains VerifierConfig.Audience if it is set.
+func (v *Verifier) Verify(token string, currentTime time.Time) (Claims, error) {
+	claims, err := v.verifyInternal(token, currentTime)
+	if err != nil {
+		jwtValidationFails.Inc()
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (v *Verifier) verifyInternal(token string, currentTime time.Time) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("unexpected number of dot-delimited parts in JWT; got %d; want 3", len(parts))
+	}
+	headerData, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode JWT header: %w", err)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(headerData, &header); err != nil {
+		return nil, fmt.Errorf("cannot parse JWT header: %w", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode JWT signature: %w", err)
+	}
+	key, err := v.getKey(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+	payloadData, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode JWT payload: %w", err)
+	}
+	var claims Claims
+	if err := json.Unmarshal(payloadData, &claims); err != nil {
+		return nil, fmt.Errorf("cannot parse JWT payload: %w", err)
+	}
+	if err := v.checkClaims(claims, currentTime); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (v *Verifier) checkClaims(claims Claims, currentTime time.Time) error {
+	ts := float64(currentTime.Unix())
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return fmt.Errorf("missing `exp` claim in JWT")
+	}
+	if ts >= exp {
+		return fmt.Errorf("JWT has been expired at %s", time.Unix(int64(exp), 0).UTC().Format(time.RFC3339))
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && ts < nbf {
+		return fmt.Errorf("JWT cannot be used before %s", time.Unix(int64(nbf), 0).UTC().Format(time.RFC3339))
+	}
+	if len(v.issuer) > 0 {
+		if iss, _ := claims["iss"].(string); iss != v.issuer {
+			return fmt.Errorf("unexpected `iss` claim in JWT; got %q; want %q", iss, v.issuer)
+		}
+	}
+	if len(v.audience) > 0 {
+		if !claims.Contains("aud", v.audience) {
+			return fmt.Errorf("missing %q in `aud` claim of JWT", v.audience)
+		}
+	}
+	return nil
+}
+
+// Claims contains claims from JWT payload.
+type Claims map[string]interface{}
+
+// GetStrings returns string values for the given claim name.
+//
+// The claim may contain either a string or a list of strings.
+func (claims Claims) GetStrings(name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		a := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				a = append(a, s)
+			}
+		}
+		return a
+	default:
+		return nil
+	}
+}
+
+// Contains returns true if the claim with the given name contains the given value.
+func (claims Claims) Contains(name, value string) bool {
+	for _, s := range claims.GetStrings(name) {
+		if s == value {
+			return true
+		}
+	}
+	return false
+}
+
+// GetTenant returns tenant id from the claim with the given name.
+//
+// The claim must contain a single tenant id in the form `accountID` or `accountID:projectID`.
+// See https://victoriametrics.github.io/Cluster-VictoriaMetrics.html#url-format
+func (claims Claims) GetTenant(name string) (string, error) {
+	tenants := claims.GetStrings(name)
+	if len(tenants) != 1 {
+		return "", fmt.Errorf("%q claim must contain a single tenant; got %d tenants", name, len(tenants))
+	}
+	tenant := tenants[0]
+	if !IsValidTenant(tenant) {
+		return "", fmt.Errorf("invalid tenant %q in %q claim; it must be in the form `accountID` or `accountID:projectID`", tenant, name)
+	}
+	return tenant, nil
+}
+
+// IsValidTenant returns true if tenant is in the form `accountID` or `accountID:projectID`.
+//
+// See https://victoriametrics.github.io/Cluster-VictoriaMetrics.html#url-format
+func IsValidTenant(tenant string) bool {
+	n := strings.IndexByte(tenant, ':')
+	if n < 0 {
+		return isUint32(tenant)
+	}
+	return isUint32(tenant[:n]) && isUint32(tenant[n+1:])
+}
+
+func isUint32(s string) bool {
+	_, err := strconv.ParseUint(s, 10, 32)
+	return err == nil
+}
@@ -0,0 +1,359 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestJWTVerifier(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("cannot generate RSA key: %s", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("cannot generate EC key: %s", err)
+	}
+	jwks := fmt.Sprintf(`{"keys":[
+{"kid":"rsa1","kty":"RSA","use":"sig","n":%q,"e":%q},
+{"kid":"ec1","kty":"EC","crv":"P-256","x":%q,"y":%q}
+]}`, encodeBigInt(rsaKey.N), encodeBigInt(big.NewInt(int64(rsaKey.E))), encodeBigInt(ecKey.X), encodeBigInt(ecKey.Y))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(jwks))
+	}))
+	defer srv.Close()
+
+	v, err := NewVerifier(&VerifierConfig{
+		Issuer:          "https://issuer",
+		JWKSURL:         srv.URL,
+		Audience:        "vmauth",
+		RefreshInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("cannot create verifier: %s", err)
+	}
+	currentTime := time.Unix(1600000000, 0)
+	validClaims := map[string]interface{}{
+		"iss":    "https://issuer",
+		"aud":    []string{"foo", "vmauth"},
+		"exp":    currentTime.Unix() + 60,
+		"sub":    "alice",
+		"groups": []string{"foo", "team-a"},
+		"tenant": "42:1",
+	}
+	signRSA := func(claims map[string]interface{}) string {
+		t.Helper()
+		return signJWT(t, "RS256", "rsa1", claims, func(digest []byte) []byte {
+			sig, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest)
+			if err != nil {
+				t.Fatalf("cannot sign JWT: %s", err)
+			}
+			return sig
+		})
+	}
+	signEC := func(claims map[string]interface{}) string {
+		t.Helper()
+		return signJWT(t, "ES256", "ec1", claims, func(digest []byte) []byte {
+			r, s, err := ecdsa.Sign(rand.Reader, ecKey, digest)
+			if err != nil {
+				t.Fatalf("cannot sign JWT: %s", err)
+			}
+			sig := make([]byte, 64)
+			r.FillBytes(sig[:32])
+			s.FillBytes(sig[32:])
+			return sig
+		})
+	}
+	fSuccess := func(token string) Claims {
+		t.Helper()
+		claims, err := v.Verify(token, currentTime)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		return claims
+	}
+	fFailure := func(token string) {
+		t.Helper()
+		if _, err := v.Verify(token, currentTime); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	claims := fSuccess(signRSA(validClaims))
+	if sub := claims.GetStrings("sub"); len(sub) != 1 || sub[0] != "alice" {
+		t.Fatalf("unexpected sub claim: %q", sub)
+	}
+	fSuccess(signEC(validClaims))
+
+	// Invalid tokens
+	fFailure("")
+	fFailure("foo.bar.baz")
+	token := signRSA(validClaims)
+	fFailure(token[:len(token)-4] + "AAAA")
+
+	// Expired token
+	fFailure(signRSA(withClaim(validClaims, "exp", currentTime.Unix()-1)))
+	fFailure(signRSA(withClaim(validClaims, "exp", nil)))
+
+	// Token from the future
+	fFailure(signRSA(withClaim(validClaims, "nbf", currentTime.Unix()+10)))
+
+	// Invalid issuer and audience
+	fFailure(signRSA(withClaim(validClaims, "iss", "https://another-issuer")))
+	fFailure(signRSA(withClaim(validClaims, "aud", "another-audience")))
+}
+
+func TestVerifierGetKeyRefresh(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("cannot generate EC key: %s", err)
+	}
+	jwks := fmt.Sprintf(`{"keys":[{"kid":"ec1","kty":"EC","crv":"P-256","x":%q,"y":%q}]}`, encodeBigInt(ecKey.X), encodeBigInt(ecKey.Y))
+	var requests uint64
+	var failRequests uint32
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// mu allows the test to hold responses in order to check concurrent getKey calls.
+		mu.Lock()
+		mu.Unlock()
+		atomic.AddUint64(&requests, 1)
+		if atomic.LoadUint32(&failRequests) != 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte(jwks))
+	}))
+	defer srv.Close()
+
+	v, err := NewVerifier(&VerifierConfig{
+		JWKSURL:         srv.URL,
+		RefreshInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("cannot create verifier: %s", err)
+	}
+	checkRequests := func(nExpected uint64) {
+		t.Helper()
+		if n := atomic.LoadUint64(&requests); n != nExpected {
+			t.Fatalf("unexpected number of JWKS requests; got %d; want %d", n, nExpected)
+		}
+	}
+	allowRefresh := func() {
+		v.mu.Lock()
+		v.nextRefreshTime = time.Time{}
+		v.mu.Unlock()
+	}
+	checkRequests(1)
+
+	// Known kid mustn't trigger refresh
+	if _, err := v.getKey("ec1"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	checkRequests(1)
+
+	// Unknown kid doesn't trigger refresh more frequently than minJWKSRefreshInterval
+	if _, err := v.getKey("missing"); err == nil {
+		t.Fatalf("expecting non-nil error for missing kid")
+	}
+	checkRequests(1)
+
+	// Concurrent getKey calls with unknown kid share a single refresh
+	allowRefresh()
+	mu.Lock()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = v.getKey("missing")
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+	mu.Unlock()
+	wg.Wait()
+	checkRequests(2)
+
+	// Failed refreshes are retried with exponential backoff
+	atomic.StoreUint32(&failRequests, 1)
+	for i := 0; i < 3; i++ {
+		allowRefresh()
+		if _, err := v.getKey("missing"); err == nil {
+			t.Fatalf("expecting non-nil error for missing kid")
+		}
+		// Subsequent calls mustn't hit JWKS url until the backoff expires
+		if _, err := v.getKey("missing"); err == nil {
+			t.Fatalf("expecting non-nil error for missing kid")
+		}
+		checkRequests(uint64(3 + i))
+		v.mu.Lock()
+		backoff := v.refreshBackoff
+		nextRefreshTime := v.nextRefreshTime
+		v.mu.Unlock()
+		backoffExpected := minJWKSRefreshInterval << uint(i)
+		if backoff != backoffExpected {
+			t.Fatalf("unexpected backoff after %d failed refreshes; got %s; want %s", i+1, backoff, backoffExpected)
+		}
+		if d := time.Until(nextRefreshTime); d <= backoffExpected-time.Second || d > backoffExpected {
+			t.Fatalf("unexpected next refresh time after %d failed refreshes; got %s from now; want %s", i+1, d, backoffExpected)
+		}
+	}
+
+	// Outdated keys are still usable while JWKS url is unavailable
+	v.mu.Lock()
+	v.lastRefreshTime = time.Time{}
+	v.mu.Unlock()
+	allowRefresh()
+	if _, err := v.getKey("ec1"); err != nil {
+		t.Fatalf("unexpected error for outdated key: %s", err)
+	}
+
+	// Successful refresh resets the backoff
+	atomic.StoreUint32(&failRequests, 0)
+	waitForRefresh(v)
+	allowRefresh()
+	if _, err := v.getKey("missing"); err == nil {
+		t.Fatalf("expecting non-nil error for missing kid")
+	}
+	v.mu.Lock()
+	backoff := v.refreshBackoff
+	v.mu.Unlock()
+	if backoff != 0 {
+		t.Fatalf("unexpected backoff after successful refresh; got %s; want 0", backoff)
+	}
+}
+
+func waitForRefresh(v *Verifier) {
+	v.mu.Lock()
+	ch := v.refreshCh
+	v.mu.Unlock()
+	if ch != nil {
+		<-ch
+	}
+}
+
+func TestClaimsGetTenant(t *testing.T) {
+	claims := Claims{
+		"tenant":  "42:1",
+		"tenants": []interface{}{"1", "2"},
+		"invalid": "foo",
+	}
+	tenant, err := claims.GetTenant("tenant")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if tenant != "42:1" {
+		t.Fatalf("unexpected tenant; got %q; want %q", tenant, "42:1")
+	}
+	for _, name := range []string{"missing", "tenants", "invalid"} {
+		if _, err := claims.GetTenant(name); err == nil {
+			t.Fatalf("expecting non-nil error for %q claim", name)
+		}
+	}
+}
+
+func TestIsValidTenant(t *testing.T) {
+	f := func(tenant string, resultExpected bool) {
+		t.Helper()
+		result := IsValidTenant(tenant)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for %q; got %v; want %v", tenant, result, resultExpected)
+		}
+	}
+	f("0", true)
+	f("42", true)
+	f("42:3", true)
+	f("4294967295:4294967295", true)
+	f("", false)
+	f("foo", false)
+	f("../1", false)
+	f("1:2:3", false)
+	f("1:", false)
+	f("4294967296", false)
+}
+
+func withClaim(claims map[string]interface{}, name string, value interface{}) map[string]interface{} {
+	m := make(map[string]interface{}, len(claims))
+	for k, v := range claims {
+		m[k] = v
+	}
+	if value == nil {
+		delete(m, name)
+	} else {
+		m[name] = value
+	}
+	return m
+}
+
+func signJWT(t *testing.T, alg, kid string, claims map[string]interface{}, sign func(digest []byte) []byte) string {
+	t.Helper()
+	header, err := json.Marshal(map[string]string{
+		"alg": alg,
+		"kid": kid,
+		"typ": "JWT",
+	})
+	if err != nil {
+		t.Fatalf("cannot marshal JWT header: %s", err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatalf("cannot marshal JWT claims: %s", err)
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sign(digest[:]))
+}
+
+func encodeBigInt(n *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(n.Bytes())
+}
+
+func TestVerifySignatureECCurveMismatch(t *testing.T) {
+	f := func(alg string, curve elliptic.Curve) {
+		t.Helper()
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			t.Fatalf("cannot generate EC key: %s", err)
+		}
+		signingInput := "foo.bar"
+		digest := sha256.Sum256([]byte(signingInput))
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			t.Fatalf("cannot sign: %s", err)
+		}
+		keySize := (curve.Params().BitSize + 7) / 8
+		sig := make([]byte, 2*keySize)
+		r.FillBytes(sig[:keySize])
+		s.FillBytes(sig[keySize:])
+		if err := verifySignature(alg, &key.PublicKey, signingInput, sig); err == nil {
+			t.Fatalf("expecting non-nil error for %s with key on %s curve", alg, curve.Params().Name)
+		}
+	}
+	f("ES256", elliptic.P384())
+	f("ES384", elliptic.P256())
+	f("ES512", elliptic.P256())
+	f("ES512", elliptic.P384())
+}
+
+func TestReadURLTooBigResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(make([]byte, maxJWKSResponseSize+1))
+	}))
+	defer srv.Close()
+	if _, err := readURL(srv.URL); err == nil {
+		t.Fatalf("expecting non-nil error for too big response")
+	}
+}
@@ -0,0 +1,88 @@
+package logger
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+var logDuplicates = newDuplicatesSuppressor()
+
+// duplicatesSuppressor suppresses duplicate log messages from the same location during the given interval.
+//
+// See -loggerSuppressDuplicatesInterval.
+type duplicatesSuppressor struct {
+	mu sync.Mutex
+	m  map[string]*duplicateEntry
+}
+
+type duplicateEntry struct {
+	level    string
+	location string
+	msg      string
+	interval time.Duration
+	deadline time.Time
+
+	// suppressed is the number of suppressed duplicates for msg until the deadline.
+	suppressed uint64
+}
+
+func (e *duplicateEntry) summary() string {
+	return fmt.Sprintf("%s (suppressed %d duplicate messages during the last %s)", e.msg, e.suppressed, e.interval)
+}
+
+func newDuplicatesSuppressor() *duplicatesSuppressor {
+	return &duplicatesSuppressor{
+		m: make(map[string]*duplicateEntry),
+	}
+}
+
+// needSuppress returns true if msg from the given location has been already logged during the given interval until now.
+//
+// It also returns an expired entry with suppressed duplicates if there is one for msg.
+// The caller must log the summary for the returned entry.
+func (ds *duplicatesSuppressor) needSuppress(level, location, msg string, interval time.Duration, now time.Time) (bool, *duplicateEntry) {
+	// fast path
+	if interval <= 0 {
+		return false, nil
+	}
+	key := location + "\x00" + msg
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	e := ds.m[key]
+	if e != nil && now.Before(e.deadline) {
+		e.suppressed++
+		return true, nil
+	}
+	ds.m[key] = &duplicateEntry{
+		level:    level,
+		location: location,
+		msg:      msg,
+		interval: interval,
+		deadline: now.Add(interval),
+	}
+	if e != nil && e.suppressed > 0 {
+		return false, e
+	}
+	return false, nil
+}
+
+// removeExpired removes entries expired until now and returns the removed entries with suppressed duplicates.
+//
+// The caller must log summaries for the returned entries.
+func (ds *duplicatesSuppressor) removeExpired(now time.Time) []*duplicateEntry {
+	var es []*duplicateEntry
+	ds.mu.Lock()
+	for key, e := range ds.m {
+		if now.Before(e.deadline) {
+			continue
+		}
+		delete(ds.m, key)
+		if e.suppressed > 0 {
+			es = append(es, e)
+		}
+	}
+	ds.mu.Unlock()
+	return es
+}
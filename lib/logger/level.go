@@ -0,0 +1,256 @@
+package logger
+
+import (
+	"flag"
+	"fmt"
+	"path"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+)
+
+var loggerLevel = newLevelFlag("loggerLevel", "INFO", "Minimum level of messages to log. Possible values: DEBUG, INFO, WARN, ERROR, FATAL, PANIC. "+
+	"The level can be overridden per component with component=LEVEL value, where component is the package path without lib/ or app/ prefix "+
+	"and with dots instead of slashes. The override is applied to the component and all its subcomponents. "+
+	"For example, -loggerLevel=WARN -loggerLevel=promscrape.discovery.kubernetes=DEBUG. "+
+	"The flag may be specified multiple times or it may contain comma-separated values. The flag may be changed at runtime via /-/flags page")
+
+func init() {
+	// levelFlag is safe for concurrent use, so there is no need in onChange callback.
+	flagutil.RegisterHotFlag("loggerLevel", nil, nil)
+}
+
+// levels contains supported log levels in ascending order.
+var levels = []string{"DEBUG", "INFO", "WARN", "ERROR", "FATAL", "PANIC"}
+
+func getLevelIndex(level string) int {
+	for i, s := range levels {
+		if s == level {
+			return i
+		}
+	}
+	return -1
+}
+
+type componentLevel struct {
+	component  string
+	levelIndex int
+}
+
+// levelFlag is a flag for -loggerLevel.
+type levelFlag struct {
+	// mu serializes Set calls and protects cmdlineValues and cmdlineParsed.
+	mu sync.Mutex
+
+	// defaultLevelIndex is the index for the default level in levels.
+	defaultLevelIndex int
+
+	// cmdlineValues contains values passed to Set until the command-line flags are parsed.
+	//
+	// They are merged, so -loggerLevel may be specified multiple times in the command line.
+	cmdlineValues []string
+
+	// cmdlineParsed is set to true after the command-line flags are parsed.
+	//
+	// Every Set call after that replaces the whole value, so per-component overrides may be removed at runtime.
+	cmdlineParsed bool
+
+	// cfg contains *levelConfig snapshot.
+	//
+	// The snapshot is replaced on every Set call, so it can be read without locks by shouldSkipLog.
+	cfg atomic.Value
+}
+
+// levelConfig is an immutable snapshot of -loggerLevel.
+type levelConfig struct {
+	// levelIndex is the index for the default level in levels.
+	levelIndex int
+
+	// componentLevels contains per-component overrides sorted by component length in descending order,
+	// so the first matching item is the most specific one.
+	componentLevels []componentLevel
+
+	// levelIndexByFile caches level indexes for caller files if componentLevels isn't empty.
+	levelIndexByFile sync.Map
+}
+
+var emptyLevelConfig = &levelConfig{}
+
+func (lf *levelFlag) getConfig() *levelConfig {
+	cfg, _ := lf.cfg.Load().(*levelConfig)
+	if cfg == nil {
+		return emptyLevelConfig
+	}
+	return cfg
+}
+
+func newLevelFlag(name, defaultLevel, description string) *levelFlag {
+	levelIndex := getLevelIndex(defaultLevel)
+	if levelIndex < 0 {
+		panic(fmt.Errorf("BUG: unsupported default level %q", defaultLevel))
+	}
+	lf := &levelFlag{
+		defaultLevelIndex: levelIndex,
+	}
+	lf.cfg.Store(&levelConfig{
+		levelIndex: levelIndex,
+	})
+	flag.Var(lf, name, description)
+	return lf
+}
+
+// finishCmdlineParsing must be called after the command-line flags are parsed.
+func (lf *levelFlag) finishCmdlineParsing() {
+	lf.mu.Lock()
+	lf.cmdlineParsed = true
+	lf.cmdlineValues = nil
+	lf.mu.Unlock()
+}
+
+// String implements flag.Value interface.
+func (lf *levelFlag) String() string {
+	cfg := lf.getConfig()
+	a := []string{levels[cfg.levelIndex]}
+	for _, cl := range cfg.componentLevels {
+		a = append(a, fmt.Sprintf("%s=%s", cl.component, levels[cl.levelIndex]))
+	}
+	return strings.Join(a, ",")
+}
+
+// Set implements flag.Value interface.
+//
+// It accepts comma-separated list of LEVEL or component=LEVEL items.
+// The new value replaces the previous value, except of repeated command-line flags, which are merged.
+// The previous value is left unchanged on error.
+func (lf *levelFlag) Set(value string) error {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+
+	values := []string{value}
+	if !lf.cmdlineParsed {
+		values = append(append([]string{}, lf.cmdlineValues...), value)
+	}
+	cfg, err := newLevelConfig(lf.defaultLevelIndex, values)
+	if err != nil {
+		return err
+	}
+	if !lf.cmdlineParsed {
+		lf.cmdlineValues = values
+	}
+	lf.cfg.Store(cfg)
+	return nil
+}
+
+// newLevelConfig returns levelConfig for the given values on top of the default level with the given defaultLevelIndex.
+//
+// Items in the later values override items in the previous values.
+func newLevelConfig(defaultLevelIndex int, values []string) (*levelConfig, error) {
+	cfg := &levelConfig{
+		levelIndex: defaultLevelIndex,
+	}
+	for _, item := range strings.Split(strings.Join(values, ","), ",") {
+		item = strings.TrimSpace(item)
+		if len(item) == 0 {
+			continue
+		}
+		component := ""
+		level := item
+		if n := strings.IndexByte(item, '='); n >= 0 {
+			component = strings.TrimSpace(item[:n])
+			level = strings.TrimSpace(item[n+1:])
+			if len(component) == 0 {
+				return nil, fmt.Errorf("missing component name in %q", item)
+			}
+		}
+		levelIndex := getLevelIndex(strings.ToUpper(level))
+		if levelIndex < 0 {
+			return nil, fmt.Errorf("unsupported level %q; supported values are: %s", level, strings.Join(levels, ", "))
+		}
+		if len(component) == 0 {
+			cfg.levelIndex = levelIndex
+			continue
+		}
+		cfg.setComponentLevel(component, levelIndex)
+	}
+	return cfg, nil
+}
+
+func (cfg *levelConfig) setComponentLevel(component string, levelIndex int) {
+	for i := range cfg.componentLevels {
+		if cfg.componentLevels[i].component == component {
+			cfg.componentLevels[i].levelIndex = levelIndex
+			return
+		}
+	}
+	cfg.componentLevels = append(cfg.componentLevels, componentLevel{
+		component:  component,
+		levelIndex: levelIndex,
+	})
+	sort.SliceStable(cfg.componentLevels, func(i, j int) bool {
+		return len(cfg.componentLevels[i].component) > len(cfg.componentLevels[j].component)
+	})
+}
+
+// getComponent returns component name for the given source file.
+//
+// For example, `promscrape.discovery.kubernetes` is returned for `<sourceRoot>/lib/promscrape/discovery/kubernetes/api.go`.
+func getComponent(file string) string {
+	if len(sourceRoot) > 0 && strings.HasPrefix(file, sourceRoot) {
+		file = file[len(sourceRoot):]
+	} else if n := strings.LastIndex(file, "/VictoriaMetrics/"); n >= 0 {
+		file = file[n+len("/VictoriaMetrics/"):]
+	}
+	dir := path.Dir(file)
+	if strings.HasPrefix(dir, "lib/") || strings.HasPrefix(dir, "app/") {
+		dir = dir[len("lib/"):]
+	}
+	return strings.ReplaceAll(dir, "/", ".")
+}
+
+// sourceRoot is the path to the root of VictoriaMetrics source code as seen in file names returned by runtime.Caller.
+var sourceRoot = func() string {
+	_, file, _, ok := runtime.Caller(0)
+	if !ok || !strings.HasSuffix(file, "lib/logger/level.go") {
+		return ""
+	}
+	return strings.TrimSuffix(file, "lib/logger/level.go")
+}()
+
+// shouldSkipLog returns true if messages with the given level must be skipped for the caller at the given skipframes.
+//
+// It doesn't take locks, since it is called on every log message.
+func shouldSkipLog(level string, skipframes int) bool {
+	levelIndex := getLevelIndex(level)
+	cfg := loggerLevel.getConfig()
+	if len(cfg.componentLevels) == 0 {
+		// Fast path - there is no need in determining the caller.
+		return levelIndex < cfg.levelIndex
+	}
+	_, file, _, ok := runtime.Caller(skipframes)
+	if !ok {
+		file = "???"
+	}
+	return levelIndex < cfg.getLevelIndexForFile(file)
+}
+
+func (cfg *levelConfig) getLevelIndexForFile(file string) int {
+	if v, ok := cfg.levelIndexByFile.Load(file); ok {
+		return v.(int)
+	}
+	levelIndex := cfg.getLevelIndexForComponent(getComponent(file))
+	cfg.levelIndexByFile.Store(file, levelIndex)
+	return levelIndex
+}
+
+func (cfg *levelConfig) getLevelIndexForComponent(component string) int {
+	for _, cl := range cfg.componentLevels {
+		if component == cl.component || strings.HasPrefix(component, cl.component+".") {
+			return cl.levelIndex
+		}
+	}
+	return cfg.levelIndex
+}
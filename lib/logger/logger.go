@@ -1,6 +1,8 @@
 package logger
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
@@ -17,7 +19,6 @@ import (
 )
 
 var (
-	loggerLevel    = flag.String("loggerLevel", "INFO", "Minimum level of errors to log. Possible values: INFO, WARN, ERROR, FATAL, PANIC")
 	loggerFormat   = flag.String("loggerFormat", "default", "Format for logs. Possible values: default, json")
 	loggerOutput   = flag.String("loggerOutput", "stderr", "Output for the logs. Supported values: stderr, stdout")
 	loggerTimezone = flag.String("loggerTimezone", "UTC", "Timezone to use for timestamps in logs. Timezone must be a valid IANA Time Zone. "+
@@ -28,6 +29,9 @@ var (
 		"are emitted per second, then the remaining errors are suppressed. Zero value disables the rate limit")
 	warnsPerSecondLimit = flag.Int("loggerWarnsPerSecondLimit", 0, "Per-second limit on the number of WARN messages. If more than the given number of warns "+
 		"are emitted per second, then the remaining warns are suppressed. Zero value disables the rate limit")
+	suppressDuplicatesInterval = flag.Duration("loggerSuppressDuplicatesInterval", 0, "The interval for suppressing duplicate WARN and ERROR messages from the same location. "+
+		"Only the first message is logged during the interval, while the number of suppressed duplicates is logged at the end of the interval. "+
+		"This may be useful for reducing the number of log messages for flapping errors such as service discovery reconnects. Zero value disables duplicates suppression")
 )
 
 // Init initializes the logger.
@@ -36,8 +40,8 @@ var (
 //
 // There is no need in calling Init from tests.
 func Init() {
+	loggerLevel.finishCmdlineParsing()
 	setLoggerOutput()
-	validateLoggerLevel()
 	validateLoggerFormat()
 	initTimezone()
 	go logLimiterCleaner()
@@ -68,15 +72,6 @@ func setLoggerOutput() {
 
 var output io.Writer = os.Stderr
 
-func validateLoggerLevel() {
-	switch *loggerLevel {
-	case "INFO", "WARN", "ERROR", "FATAL", "PANIC":
-	default:
-		// We cannot use logger.Panicf here, since the logger isn't initialized yet.
-		panic(fmt.Errorf("FATAL: unsupported `-loggerLevel` value: %q; supported values are: INFO, WARN, ERROR, FATAL, PANIC", *loggerLevel))
-	}
-}
-
 func validateLoggerFormat() {
 	switch *loggerFormat {
 	case "default", "json":
@@ -93,6 +88,13 @@ func StdErrorLogger() *log.Logger {
 	return stdErrorLogger
 }
 
+// Debugf logs debug message.
+//
+// Debug messages are logged only if -loggerLevel is set to DEBUG for the caller's component.
+func Debugf(format string, args ...interface{}) {
+	logLevel("DEBUG", format, args...)
+}
+
 // Infof logs info message.
 func Infof(format string, args ...interface{}) {
 	logLevel("INFO", format, args...)
@@ -133,7 +135,7 @@ func logLevel(level, format string, args ...interface{}) {
 }
 
 func logLevelSkipframes(skipframes int, level, format string, args ...interface{}) {
-	if shouldSkipLog(level) {
+	if shouldSkipLog(level, 3+skipframes) {
 		return
 	}
 	msg := fmt.Sprintf(format, args...)
@@ -144,6 +146,9 @@ func logLimiterCleaner() {
 	for {
 		time.Sleep(time.Second)
 		logLimiter.reset()
+		for _, e := range logDuplicates.removeExpired(time.Now()) {
+			writeLogMessage(e.level, e.location, e.summary())
+		}
 	}
 }
 
@@ -204,11 +209,6 @@ func (lw *logWriter) Write(p []byte) (int, error) {
 }
 
 func logMessage(level, msg string, skipframes int) {
-	timestamp := ""
-	if !*disableTimestamps {
-		timestamp = time.Now().In(timezone).Format("2006-01-02T15:04:05.000Z0700")
-	}
-	levelLowercase := strings.ToLower(level)
 	_, file, line, ok := runtime.Caller(skipframes)
 	if !ok {
 		file = "???"
@@ -220,8 +220,21 @@ func logMessage(level, msg string, skipframes int) {
 	}
 	location := fmt.Sprintf("%s:%d", file, line)
 
-	// rate limit ERROR and WARN log messages with given limit.
+	for len(msg) > 0 && msg[len(msg)-1] == '\n' {
+		msg = msg[:len(msg)-1]
+	}
+
 	if level == "ERROR" || level == "WARN" {
+		// suppress duplicate ERROR and WARN log messages from the same location.
+		ok, e := logDuplicates.needSuppress(level, location, msg, *suppressDuplicatesInterval, time.Now())
+		if ok {
+			return
+		}
+		if e != nil {
+			writeLogMessage(e.level, e.location, e.summary())
+		}
+
+		// rate limit ERROR and WARN log messages with given limit.
 		limit := uint64(*errorsPerSecondLimit)
 		if level == "WARN" {
 			limit = uint64(*warnsPerSecondLimit)
@@ -235,16 +248,22 @@ func logMessage(level, msg string, skipframes int) {
 		}
 	}
 
-	for len(msg) > 0 && msg[len(msg)-1] == '\n' {
-		msg = msg[:len(msg)-1]
+	writeLogMessage(level, location, msg)
+}
+
+func writeLogMessage(level, location, msg string) {
+	timestamp := ""
+	if !*disableTimestamps {
+		timestamp = time.Now().In(timezone).Format("2006-01-02T15:04:05.000Z0700")
 	}
+	levelLowercase := strings.ToLower(level)
 	var logMsg string
 	switch *loggerFormat {
 	case "json":
 		if *disableTimestamps {
-			logMsg = fmt.Sprintf(`{"level":%q,"caller":%q,"msg":%q}`+"\n", levelLowercase, location, msg)
+			logMsg = fmt.Sprintf(`{"level":%s,"caller":%s,"msg":%s}`+"\n", quoteJSON(levelLowercase), quoteJSON(location), quoteJSON(msg))
 		} else {
-			logMsg = fmt.Sprintf(`{"ts":%q,"level":%q,"caller":%q,"msg":%q}`+"\n", timestamp, levelLowercase, location, msg)
+			logMsg = fmt.Sprintf(`{"ts":%s,"level":%s,"caller":%s,"msg":%s}`+"\n", quoteJSON(timestamp), quoteJSON(levelLowercase), quoteJSON(location), quoteJSON(msg))
 		}
 	default:
 		if *disableTimestamps {
@@ -277,32 +296,16 @@ func logMessage(level, msg string, skipframes int) {
 
 var mu sync.Mutex
 
-func shouldSkipLog(level string) bool {
-	switch *loggerLevel {
-	case "WARN":
-		switch level {
-		case "WARN", "ERROR", "FATAL", "PANIC":
-			return false
-		default:
-			return true
-		}
-	case "ERROR":
-		switch level {
-		case "ERROR", "FATAL", "PANIC":
-			return false
-		default:
-			return true
-		}
-	case "FATAL":
-		switch level {
-		case "FATAL", "PANIC":
-			return false
-		default:
-			return true
-		}
-	case "PANIC":
-		return level != "PANIC"
-	default:
-		return false
+// quoteJSON returns s quoted as JSON string.
+//
+// It is used instead of %q, since %q may produce invalid JSON for strings with control chars or invalid utf-8.
+func quoteJSON(s string) string {
+	var bb bytes.Buffer
+	enc := json.NewEncoder(&bb)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(s); err != nil {
+		// This shouldn't happen, since json encoding of a string cannot fail.
+		return fmt.Sprintf("%q", s)
 	}
+	return strings.TrimSuffix(bb.String(), "\n")
 }
@@ -0,0 +1,197 @@
+package logger
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestLevelFlagSetSuccess(t *testing.T) {
+	f := func(values []string, resultExpected string) {
+		t.Helper()
+		lf := &levelFlag{}
+		for _, v := range values {
+			if err := lf.Set(v); err != nil {
+				t.Fatalf("unexpected error when setting %q: %s", v, err)
+			}
+		}
+		result := lf.String()
+		if result != resultExpected {
+			t.Fatalf("unexpected result; got %q; want %q", result, resultExpected)
+		}
+	}
+	f([]string{"INFO"}, "INFO")
+	f([]string{"warn"}, "WARN")
+	f([]string{"INFO", "ERROR"}, "ERROR")
+	f([]string{"promscrape.discovery.kubernetes=debug"}, "DEBUG,promscrape.discovery.kubernetes=DEBUG")
+	f([]string{"WARN", "promscrape=INFO", "promscrape.discovery.kubernetes=DEBUG"}, "WARN,promscrape.discovery.kubernetes=DEBUG,promscrape=INFO")
+	f([]string{"WARN,promscrape=INFO, storage = ERROR", "promscrape=DEBUG"}, "WARN,promscrape=DEBUG,storage=ERROR")
+}
+
+func TestLevelFlagSetFailure(t *testing.T) {
+	f := func(value string) {
+		t.Helper()
+		lf := &levelFlag{}
+		if err := lf.Set(value); err == nil {
+			t.Fatalf("expecting non-nil error for %q", value)
+		}
+	}
+	f("foobar")
+	f("promscrape=foobar")
+	f("=INFO")
+	f("INFO,promscrape")
+}
+
+func TestLevelFlagSetFailureKeepsPreviousValue(t *testing.T) {
+	lf := &levelFlag{}
+	if err := lf.Set("WARN,promscrape=DEBUG"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if err := lf.Set("ERROR,storage=foobar"); err == nil {
+		t.Fatalf("expecting non-nil error")
+	}
+	resultExpected := "WARN,promscrape=DEBUG"
+	if result := lf.String(); result != resultExpected {
+		t.Fatalf("unexpected value after failed Set; got %q; want %q", result, resultExpected)
+	}
+}
+
+func TestLevelFlagSetAfterCmdlineParsing(t *testing.T) {
+	lf := &levelFlag{
+		defaultLevelIndex: getLevelIndex("INFO"),
+	}
+	f := func(value, resultExpected string) {
+		t.Helper()
+		if err := lf.Set(value); err != nil {
+			t.Fatalf("unexpected error when setting %q: %s", value, err)
+		}
+		if result := lf.String(); result != resultExpected {
+			t.Fatalf("unexpected result after setting %q; got %q; want %q", value, result, resultExpected)
+		}
+	}
+
+	// Repeated command-line flags are merged.
+	f("WARN", "WARN")
+	f("promscrape=DEBUG", "WARN,promscrape=DEBUG")
+	lf.finishCmdlineParsing()
+
+	// Every value set at runtime replaces the previous value, so overrides may be removed.
+	f("storage=ERROR", "INFO,storage=ERROR")
+	f("WARN", "WARN")
+	f("ERROR,promscrape=INFO", "ERROR,promscrape=INFO")
+	f("promscrape=WARN", "INFO,promscrape=WARN")
+}
+
+func TestGetComponent(t *testing.T) {
+	f := func(file, componentExpected string) {
+		t.Helper()
+		component := getComponent(file)
+		if component != componentExpected {
+			t.Fatalf("unexpected component for %q; got %q; want %q", file, component, componentExpected)
+		}
+	}
+	f(sourceRoot+"lib/promscrape/discovery/kubernetes/api.go", "promscrape.discovery.kubernetes")
+	f(sourceRoot+"app/vmagent/remotewrite/client.go", "vmagent.remotewrite")
+	f("/root/go/src/github.com/VictoriaMetrics/VictoriaMetrics/lib/storage/storage.go", "storage")
+	f("???", ".")
+}
+
+func TestLevelFlagComponentLevels(t *testing.T) {
+	lf := &levelFlag{}
+	if err := lf.Set("WARN,promscrape=INFO,promscrape.discovery.kubernetes=DEBUG,promscrape.discovery=ERROR"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	f := func(component, levelExpected string) {
+		t.Helper()
+		level := levels[lf.getConfig().getLevelIndexForComponent(component)]
+		if level != levelExpected {
+			t.Fatalf("unexpected level for component %q; got %s; want %s", component, level, levelExpected)
+		}
+	}
+	f("storage", "WARN")
+	f("promscrape", "INFO")
+	f("promscrapefoo", "WARN")
+	f("promscrape.discovery", "ERROR")
+	f("promscrape.discovery.consul", "ERROR")
+	f("promscrape.discovery.kubernetes", "DEBUG")
+	f("promscrape.discovery.kubernetes.foo", "DEBUG")
+}
+
+func TestDuplicatesSuppressor(t *testing.T) {
+	ds := newDuplicatesSuppressor()
+	now := time.Unix(1000, 0)
+
+	// Disabled suppression
+	for i := 0; i < 3; i++ {
+		if ok, e := ds.needSuppress("ERROR", "foo.go:1", "error", 0, now); ok || e != nil {
+			t.Fatalf("unexpected suppression for disabled suppressor")
+		}
+	}
+
+	interval := 10 * time.Second
+	if ok, _ := ds.needSuppress("ERROR", "foo.go:1", "error", interval, now); ok {
+		t.Fatalf("the first message mustn't be suppressed")
+	}
+	for i := 0; i < 3; i++ {
+		if ok, _ := ds.needSuppress("ERROR", "foo.go:1", "error", interval, now.Add(time.Second)); !ok {
+			t.Fatalf("duplicate message must be suppressed")
+		}
+	}
+	// Messages with distinct text or location mustn't be suppressed.
+	if ok, _ := ds.needSuppress("ERROR", "foo.go:1", "another error", interval, now); ok {
+		t.Fatalf("message with distinct text mustn't be suppressed")
+	}
+	if ok, _ := ds.needSuppress("ERROR", "foo.go:2", "error", interval, now); ok {
+		t.Fatalf("message with distinct location mustn't be suppressed")
+	}
+
+	// The message must be logged after the interval together with the summary for suppressed duplicates.
+	ok, e := ds.needSuppress("ERROR", "foo.go:1", "error", interval, now.Add(interval))
+	if ok {
+		t.Fatalf("the message mustn't be suppressed after the interval")
+	}
+	if e == nil {
+		t.Fatalf("expecting non-nil entry with suppressed duplicates")
+	}
+	summaryExpected := "error (suppressed 3 duplicate messages during the last 10s)"
+	if summary := e.summary(); summary != summaryExpected {
+		t.Fatalf("unexpected summary; got %q; want %q", summary, summaryExpected)
+	}
+
+	// Suppress a duplicate and then verify that it is reported by removeExpired.
+	if ok, _ := ds.needSuppress("ERROR", "foo.go:1", "error", interval, now.Add(interval+time.Second)); !ok {
+		t.Fatalf("duplicate message must be suppressed")
+	}
+	if es := ds.removeExpired(now.Add(interval + time.Second)); len(es) != 0 {
+		t.Fatalf("unexpected expired entries with suppressed duplicates: %d", len(es))
+	}
+	es := ds.removeExpired(now.Add(2 * interval))
+	if len(es) != 1 {
+		t.Fatalf("unexpected number of expired entries with suppressed duplicates; got %d; want 1", len(es))
+	}
+	if es[0].suppressed != 1 || es[0].location != "foo.go:1" || es[0].level != "ERROR" {
+		t.Fatalf("unexpected expired entry: %+v", es[0])
+	}
+	if len(ds.m) != 0 {
+		t.Fatalf("expecting empty suppressor after removing expired entries; got %d entries", len(ds.m))
+	}
+}
+
+func TestQuoteJSON(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+		q := quoteJSON(s)
+		var result string
+		if err := json.Unmarshal([]byte(q), &result); err != nil {
+			t.Fatalf("cannot unmarshal quoted %q: %s", q, err)
+		}
+		if result != s {
+			t.Fatalf("unexpected unquoted string; got %q; want %q", result, s)
+		}
+	}
+	f("")
+	f("foo bar")
+	f(`"quoted" <victoriametrics-addr> & \ backslash`)
+	f("new\nline\ttab \x1b[31mcolor")
+	f("unicode: привет")
+}
@@ -515,6 +515,12 @@ func (tb *Table) mergePartsOptimal(pws []*partWrapper, stopCh <-chan struct{}) e
 //
 // This function is only for debugging and testing.
 func (tb *Table) DebugFlush() {
+	tb.FlushPendingItems()
+}
+
+// FlushPendingItems synchronously flushes all the added items to persistent storage,
+// so they survive unclean shutdown.
+func (tb *Table) FlushPendingItems() {
 	tb.flushRawItems(true)
 
 	// Wait for background flushers to finish.
@@ -29,6 +29,9 @@ type FastQueue struct {
 
 	lastInmemoryBlockReadTime uint64
 
+	// isPaused is set to true if readers must be blocked until Resume call.
+	isPaused bool
+
 	mustStop bool
 }
 
@@ -62,6 +65,49 @@ func (fq *FastQueue) UnblockAllReaders() {
 	fq.cond.Broadcast()
 }
 
+// Pause blocks all the readers until Resume call.
+//
+// Writers continue writing data to fq while it is paused.
+func (fq *FastQueue) Pause() {
+	fq.mu.Lock()
+	fq.isPaused = true
+	fq.mu.Unlock()
+}
+
+// Resume unblocks readers blocked after Pause call.
+func (fq *FastQueue) Resume() {
+	fq.mu.Lock()
+	defer fq.mu.Unlock()
+
+	fq.isPaused = false
+	fq.cond.Broadcast()
+}
+
+// IsPaused returns true if fq is paused with Pause call.
+func (fq *FastQueue) IsPaused() bool {
+	fq.mu.Lock()
+	defer fq.mu.Unlock()
+
+	return fq.isPaused
+}
+
+// MustDropPendingBlocks drops all the pending blocks from fq and returns the number of dropped bytes.
+//
+// Blocks, which are already read from fq, aren't dropped.
+func (fq *FastQueue) MustDropPendingBlocks() uint64 {
+	fq.mu.Lock()
+	defer fq.mu.Unlock()
+
+	n := fq.pendingInmemoryBytes
+	for len(fq.ch) > 0 {
+		bb := <-fq.ch
+		blockBufPool.Put(bb)
+	}
+	fq.pendingInmemoryBytes = 0
+	n += fq.pq.MustDropPendingBlocks()
+	return n
+}
+
 // MustClose unblocks all the readers.
 //
 // It is expected no new writers during and after the call.
@@ -162,6 +208,11 @@ func (fq *FastQueue) MustReadBlock(dst []byte) ([]byte, bool) {
 		if fq.mustStop {
 			return dst, false
 		}
+		if fq.isPaused {
+			// Wait until Resume or MustClose call.
+			fq.cond.Wait()
+			continue
+		}
 		if len(fq.ch) > 0 {
 			if n := fq.pq.GetPendingBytes(); n > 0 {
 				logger.Panicf("BUG: the file-based queue must be empty when the inmemory queue is non-empty; it contains %d pending bytes", n)
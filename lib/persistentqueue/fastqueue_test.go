@@ -182,6 +182,86 @@ func TestFastQueueReadUnblockByWrite(t *testing.T) {
 	mustDeleteDir(path)
 }
 
+func TestFastQueuePauseResume(t *testing.T) {
+	path := "fast-queue-pause-resume"
+	mustDeleteDir(path)
+
+	fq := MustOpenFastQueue(path, "foobar", 13, 0)
+	fq.Pause()
+	if !fq.IsPaused() {
+		t.Fatalf("expecting paused queue")
+	}
+	block := "foobar"
+	fq.MustWriteBlock([]byte(block))
+	resultCh := make(chan error)
+	go func() {
+		data, ok := fq.MustReadBlock(nil)
+		if !ok {
+			resultCh <- fmt.Errorf("unexpected ok=false")
+			return
+		}
+		if string(data) != block {
+			resultCh <- fmt.Errorf("unexpected block read; got %q; want %q", data, block)
+			return
+		}
+		resultCh <- nil
+	}()
+	select {
+	case err := <-resultCh:
+		t.Fatalf("the reader must be blocked on paused queue; got err=%v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	fq.Resume()
+	if fq.IsPaused() {
+		t.Fatalf("expecting resumed queue")
+	}
+	select {
+	case err := <-resultCh:
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timeout")
+	}
+	fq.MustClose()
+	mustDeleteDir(path)
+}
+
+func TestFastQueueDropPendingBlocks(t *testing.T) {
+	path := "fast-queue-drop-pending-blocks"
+	mustDeleteDir(path)
+
+	capacity := 10
+	fq := MustOpenFastQueue(path, "foobar", capacity, 0)
+	// Write more blocks than the in-memory queue can hold, so some of them go to the file-based queue.
+	for i := 0; i < 3*capacity; i++ {
+		fq.MustWriteBlock([]byte(fmt.Sprintf("block %d", i)))
+	}
+	pendingBytes := fq.GetPendingBytes()
+	if pendingBytes == 0 {
+		t.Fatalf("expecting non-zero pending bytes")
+	}
+	if n := fq.MustDropPendingBlocks(); n != pendingBytes {
+		t.Fatalf("unexpected number of dropped bytes; got %d; want %d", n, pendingBytes)
+	}
+	if n := fq.GetPendingBytes(); n != 0 {
+		t.Fatalf("unexpected number of pending bytes after drop; got %d; want 0", n)
+	}
+
+	// The queue must remain usable after the drop.
+	block := "new block"
+	fq.MustWriteBlock([]byte(block))
+	data, ok := fq.MustReadBlock(nil)
+	if !ok {
+		t.Fatalf("unexpected ok=false")
+	}
+	if string(data) != block {
+		t.Fatalf("unexpected block read; got %q; want %q", data, block)
+	}
+	fq.MustClose()
+	mustDeleteDir(path)
+}
+
 func TestFastQueueReadWriteConcurrent(t *testing.T) {
 	path := "fast-queue-read-write-concurrent"
 	mustDeleteDir(path)
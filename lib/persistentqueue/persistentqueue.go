@@ -128,6 +128,29 @@ func (q *Queue) GetPendingBytes() uint64 {
 	return n
 }
 
+// MustDropPendingBlocks drops all the pending blocks from q and returns the number of dropped bytes.
+func (q *Queue) MustDropPendingBlocks() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	n := q.writerOffset - q.readerOffset
+	bb := blockBufPool.Get()
+	for q.readerOffset < q.writerOffset {
+		var err error
+		bb.B, err = q.readBlockLocked(bb.B[:0])
+		if err != nil {
+			logger.Panicf("FATAL: cannot drop pending block: %s", err)
+		}
+		q.blocksDropped.Inc()
+		q.bytesDropped.Add(len(bb.B))
+	}
+	blockBufPool.Put(bb)
+	if err := q.flushMetainfoLocked(); err != nil {
+		logger.Panicf("FATAL: cannot flush metainfo: %s", err)
+	}
+	return n
+}
+
 // MustOpen opens persistent queue from the given path.
 //
 // If maxPendingBytes is greater than 0, then the max queue size is limited by this value.
@@ -0,0 +1,348 @@
+package profiling
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/memory"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	profilesDir = flag.String("profiling.dir", "", "Path to directory for storing heap, goroutine and CPU profiles captured on high memory usage "+
+		"or via /debug/profiles/create . Profiles capturing is disabled if empty. See also -profiling.memoryThresholdPercent")
+	maxSnapshots           = flag.Int("profiling.maxSnapshots", 5, "The maximum number of profile snapshots to keep at -profiling.dir. The oldest snapshots are deleted when the limit is exceeded")
+	memoryThresholdPercent = flag.Float64("profiling.memoryThresholdPercent", 80, "Percent of system memory used by the process, which triggers capturing profiles to -profiling.dir. "+
+		"Automatic capturing is disabled if set to 0. See also -profiling.minInterval")
+	checkInterval      = flag.Duration("profiling.checkInterval", 5*time.Second, "Interval for checking memory usage against -profiling.memoryThresholdPercent")
+	minInterval        = flag.Duration("profiling.minInterval", 10*time.Minute, "The minimum interval between profile snapshots triggered by -profiling.memoryThresholdPercent")
+	cpuProfileDuration = flag.Duration("profiling.cpuProfileDuration", 10*time.Second, "Duration for collecting CPU profile when capturing profile snapshot. "+
+		"CPU profile isn't collected if set to 0")
+)
+
+// Reasons for capturing profile snapshots.
+const (
+	ReasonMemory = "memory"
+	ReasonManual = "manual"
+)
+
+// Init starts watching memory usage for capturing profile snapshots if -profiling.dir is set.
+//
+// It is safe calling Init multiple times - subsequent calls are no-op.
+func Init() {
+	initOnce.Do(initInternal)
+}
+
+var initOnce sync.Once
+
+func initInternal() {
+	if len(*profilesDir) == 0 {
+		return
+	}
+	if *memoryThresholdPercent < 0 || *memoryThresholdPercent > 100 {
+		logger.Fatalf("-profiling.memoryThresholdPercent must be in the range [0..100]; got %g", *memoryThresholdPercent)
+	}
+	if err := fs.MkdirAllIfNotExist(*profilesDir); err != nil {
+		logger.Fatalf("cannot create -profiling.dir=%q: %s", *profilesDir, err)
+	}
+	removeTemporarySnapshots(*profilesDir)
+	if *memoryThresholdPercent == 0 {
+		return
+	}
+	totalMemory := memory.Allowed() + memory.Remaining()
+	threshold := uint64(float64(totalMemory) * *memoryThresholdPercent / 100)
+	logger.Infof("capturing profiles to -profiling.dir=%q when memory usage exceeds %d bytes according to -profiling.memoryThresholdPercent=%g",
+		*profilesDir, threshold, *memoryThresholdPercent)
+	go memoryWatcher(threshold)
+}
+
+func memoryWatcher(threshold uint64) {
+	t := time.NewTicker(*checkInterval)
+	defer t.Stop()
+	var lastSnapshotTime time.Time
+	for range t.C {
+		usage := getMemoryUsage()
+		if usage < threshold || time.Since(lastSnapshotTime) < *minInterval {
+			continue
+		}
+		lastSnapshotTime = time.Now()
+		logger.Warnf("memory usage %d bytes exceeds %d bytes according to -profiling.memoryThresholdPercent=%g; capturing profiles to -profiling.dir=%q",
+			usage, threshold, *memoryThresholdPercent, *profilesDir)
+		name, err := CreateSnapshot(ReasonMemory)
+		if err != nil {
+			logger.Errorf("cannot capture profiles: %s", err)
+			continue
+		}
+		logger.Infof("captured profiles to %q", filepath.Join(*profilesDir, name))
+	}
+}
+
+// getMemoryUsage returns the amount of memory obtained by Go runtime from the OS and not released back yet.
+func getMemoryUsage() uint64 {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return ms.Sys - ms.HeapReleased
+}
+
+var (
+	snapshotsCreatedMemory = metrics.NewCounter(`vm_profiling_snapshots_total{reason="memory"}`)
+	snapshotsCreatedManual = metrics.NewCounter(`vm_profiling_snapshots_total{reason="manual"}`)
+	snapshotErrors         = metrics.NewCounter(`vm_profiling_snapshot_errors_total`)
+)
+
+// snapshotLock prevents from concurrent snapshot creation and deletion.
+var snapshotLock sync.Mutex
+
+// CreateSnapshot captures heap, goroutine and CPU profiles to a new snapshot at -profiling.dir.
+//
+// reason must be either ReasonMemory or ReasonManual.
+// The oldest snapshots are deleted if the number of snapshots exceeds -profiling.maxSnapshots.
+// The name of the created snapshot is returned.
+func CreateSnapshot(reason string) (string, error) {
+	if len(*profilesDir) == 0 {
+		return "", fmt.Errorf("-profiling.dir must be set for capturing profiles")
+	}
+	snapshotLock.Lock()
+	defer snapshotLock.Unlock()
+
+	name, err := createSnapshot(*profilesDir, reason, *cpuProfileDuration)
+	if err != nil {
+		snapshotErrors.Inc()
+		return "", err
+	}
+	if reason == ReasonMemory {
+		snapshotsCreatedMemory.Inc()
+	} else {
+		snapshotsCreatedManual.Inc()
+	}
+	if err := removeOldSnapshots(*profilesDir, *maxSnapshots); err != nil {
+		logger.Errorf("cannot remove old profile snapshots: %s", err)
+	}
+	return name, nil
+}
+
+const tmpSuffix = ".tmp"
+
+func createSnapshot(dir, reason string, cpuDuration time.Duration) (string, error) {
+	now := time.Now().UTC()
+	name := now.Format("20060102T150405.000Z") + "-" + reason
+	tmpPath := filepath.Join(dir, name+tmpSuffix)
+	if err := fs.MkdirAllFailIfExist(tmpPath); err != nil {
+		return "", fmt.Errorf("cannot create directory for profile snapshot: %w", err)
+	}
+	md := &snapshotMetadata{
+		Reason:           reason,
+		Timestamp:        now.Format(time.RFC3339Nano),
+		MemoryUsageBytes: getMemoryUsage(),
+		Goroutines:       runtime.NumGoroutine(),
+	}
+	// The heap profile is captured first, since it is the most important one on high memory usage.
+	if err := writeProfile(filepath.Join(tmpPath, "heap.pprof"), "heap", 0); err != nil {
+		fs.MustRemoveAll(tmpPath)
+		return "", err
+	}
+	if err := writeProfile(filepath.Join(tmpPath, "goroutine.pprof"), "goroutine", 0); err != nil {
+		fs.MustRemoveAll(tmpPath)
+		return "", err
+	}
+	if err := writeProfile(filepath.Join(tmpPath, "goroutine.txt"), "goroutine", 2); err != nil {
+		fs.MustRemoveAll(tmpPath)
+		return "", err
+	}
+	if cpuDuration > 0 {
+		if err := writeCPUProfile(filepath.Join(tmpPath, "cpu.pprof"), cpuDuration); err != nil {
+			// CPU profile may be already collected via /debug/pprof/profile, so do not fail the whole snapshot.
+			md.CPUProfileError = err.Error()
+		}
+	}
+	data, err := json.MarshalIndent(md, "", "  ")
+	if err != nil {
+		logger.Panicf("BUG: unexpected error when marshaling snapshot metadata: %s", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmpPath, "metadata.json"), data, 0644); err != nil {
+		fs.MustRemoveAll(tmpPath)
+		return "", fmt.Errorf("cannot write snapshot metadata: %w", err)
+	}
+	if err := os.Rename(tmpPath, filepath.Join(dir, name)); err != nil {
+		fs.MustRemoveAll(tmpPath)
+		return "", fmt.Errorf("cannot rename %q to %q: %w", tmpPath, name, err)
+	}
+	return name, nil
+}
+
+type snapshotMetadata struct {
+	Reason           string `json:"reason"`
+	Timestamp        string `json:"timestamp"`
+	MemoryUsageBytes uint64 `json:"memoryUsageBytes"`
+	Goroutines       int    `json:"goroutines"`
+	CPUProfileError  string `json:"cpuProfileError,omitempty"`
+}
+
+func writeProfile(path, profileName string, debug int) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("cannot create file for %s profile: %w", profileName, err)
+	}
+	err = pprof.Lookup(profileName).WriteTo(f, debug)
+	fs.MustClose(f)
+	if err != nil {
+		return fmt.Errorf("cannot write %s profile to %q: %w", profileName, path, err)
+	}
+	return nil
+}
+
+func writeCPUProfile(path string, d time.Duration) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("cannot create file for cpu profile: %w", err)
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		fs.MustClose(f)
+		fs.MustRemoveAll(path)
+		return fmt.Errorf("cannot start cpu profile: %w", err)
+	}
+	time.Sleep(d)
+	pprof.StopCPUProfile()
+	fs.MustClose(f)
+	return nil
+}
+
+func removeTemporarySnapshots(dir string) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		logger.Fatalf("cannot read -profiling.dir=%q: %s", dir, err)
+	}
+	for _, fi := range fis {
+		if fi.IsDir() && strings.HasSuffix(fi.Name(), tmpSuffix) {
+			fs.MustRemoveAll(filepath.Join(dir, fi.Name()))
+		}
+	}
+}
+
+func removeOldSnapshots(dir string, maxSnapshots int) error {
+	names, err := listSnapshots(dir)
+	if err != nil {
+		return err
+	}
+	for len(names) > maxSnapshots && len(names) > 0 {
+		fs.MustRemoveAll(filepath.Join(dir, names[0]))
+		names = names[1:]
+	}
+	return nil
+}
+
+// ListSnapshots returns names for profile snapshots at -profiling.dir sorted by creation time.
+func ListSnapshots() ([]string, error) {
+	if len(*profilesDir) == 0 {
+		return nil, nil
+	}
+	return listSnapshots(*profilesDir)
+}
+
+func listSnapshots(dir string) ([]string, error) {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read directory with profile snapshots: %w", err)
+	}
+	var names []string
+	for _, fi := range fis {
+		if !fi.IsDir() || strings.HasSuffix(fi.Name(), tmpSuffix) {
+			continue
+		}
+		names = append(names, fi.Name())
+	}
+	// Snapshot names start with creation time, so they are sorted by creation time.
+	sort.Strings(names)
+	return names, nil
+}
+
+// WriteBundle writes tar.gz archive with the given profile snapshots from -profiling.dir to w.
+//
+// All the snapshots are written if names is empty.
+func WriteBundle(w io.Writer, names []string) error {
+	if len(*profilesDir) == 0 {
+		return fmt.Errorf("-profiling.dir must be set for capturing profiles")
+	}
+	snapshotLock.Lock()
+	defer snapshotLock.Unlock()
+	return writeBundle(w, *profilesDir, names)
+}
+
+func writeBundle(w io.Writer, dir string, names []string) error {
+	existingNames, err := listSnapshots(dir)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		names = existingNames
+	}
+	m := make(map[string]bool, len(existingNames))
+	for _, name := range existingNames {
+		m[name] = true
+	}
+	for _, name := range names {
+		// Verify the name in order to prevent from reading files outside dir.
+		if !m[name] {
+			return fmt.Errorf("cannot find profile snapshot %q", name)
+		}
+	}
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+	for _, name := range names {
+		if err := addSnapshotToTar(tw, dir, name); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("cannot finalize tar archive: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("cannot finalize gzip stream: %w", err)
+	}
+	return nil
+}
+
+func addSnapshotToTar(tw *tar.Writer, dir, name string) error {
+	snapshotPath := filepath.Join(dir, name)
+	fis, err := ioutil.ReadDir(snapshotPath)
+	if err != nil {
+		return fmt.Errorf("cannot read profile snapshot %q: %w", name, err)
+	}
+	for _, fi := range fis {
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(snapshotPath, fi.Name()))
+		if err != nil {
+			return fmt.Errorf("cannot read file from profile snapshot %q: %w", name, err)
+		}
+		hdr := &tar.Header{
+			Name:    name + "/" + fi.Name(),
+			Mode:    0644,
+			Size:    int64(len(data)),
+			ModTime: fi.ModTime(),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("cannot write tar header for %q: %w", hdr.Name, err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			return fmt.Errorf("cannot write %q to tar archive: %w", hdr.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package profiling
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCreateSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profiling-test")
+	if err != nil {
+		t.Fatalf("cannot create temporary dir: %s", err)
+	}
+	defer func() {
+		_ = os.RemoveAll(dir)
+	}()
+
+	// Leftovers from incomplete snapshots must be ignored.
+	if err := os.Mkdir(filepath.Join(dir, "foo"+tmpSuffix), 0755); err != nil {
+		t.Fatalf("cannot create temporary snapshot dir: %s", err)
+	}
+
+	var names []string
+	for i := 0; i < 3; i++ {
+		name, err := createSnapshot(dir, fmt.Sprintf("%s%d", ReasonManual, i), 0)
+		if err != nil {
+			t.Fatalf("cannot create snapshot: %s", err)
+		}
+		names = append(names, name)
+	}
+	namesGot, err := listSnapshots(dir)
+	if err != nil {
+		t.Fatalf("cannot list snapshots: %s", err)
+	}
+	if !reflect.DeepEqual(namesGot, names) {
+		t.Fatalf("unexpected snapshots; got %q; want %q", namesGot, names)
+	}
+
+	if err := removeOldSnapshots(dir, 2); err != nil {
+		t.Fatalf("cannot remove old snapshots: %s", err)
+	}
+	namesGot, err = listSnapshots(dir)
+	if err != nil {
+		t.Fatalf("cannot list snapshots: %s", err)
+	}
+	if !reflect.DeepEqual(namesGot, names[1:]) {
+		t.Fatalf("unexpected snapshots after removing old snapshots; got %q; want %q", namesGot, names[1:])
+	}
+
+	var bb bytes.Buffer
+	if err := writeBundle(&bb, dir, names[2:]); err != nil {
+		t.Fatalf("cannot write bundle: %s", err)
+	}
+	zr, err := gzip.NewReader(&bb)
+	if err != nil {
+		t.Fatalf("cannot open gzip stream: %s", err)
+	}
+	tr := tar.NewReader(zr)
+	var filesGot []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("cannot read tar archive: %s", err)
+		}
+		filesGot = append(filesGot, hdr.Name)
+	}
+	filesExpected := []string{
+		names[2] + "/goroutine.pprof",
+		names[2] + "/goroutine.txt",
+		names[2] + "/heap.pprof",
+		names[2] + "/metadata.json",
+	}
+	if !reflect.DeepEqual(filesGot, filesExpected) {
+		t.Fatalf("unexpected files in bundle; got %q; want %q", filesGot, filesExpected)
+	}
+
+	// Snapshots outside dir cannot be written to bundle.
+	for _, name := range []string{names[0], "../foo", "foo" + tmpSuffix} {
+		if err := writeBundle(ioutil.Discard, dir, []string{name}); err == nil {
+			t.Fatalf("expecting non-nil error when writing bundle for %q", name)
+		}
+	}
+}
@@ -18,6 +18,12 @@ type TLSConfig struct {
 	KeyFile            string `yaml:"key_file,omitempty"`
 	ServerName         string `yaml:"server_name,omitempty"`
 	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"`
+
+	// SPIFFEWorkloadAPISocket is an optional path to SPIFFE Workload API unix socket for obtaining auto-rotated client certificate.
+	SPIFFEWorkloadAPISocket string `yaml:"spiffe_workload_api_socket,omitempty"`
+
+	// ConsulConnect is an optional config for obtaining auto-rotated client certificate from Consul Connect.
+	ConsulConnect *ConsulConnectConfig `yaml:"consul_connect,omitempty"`
 }
 
 // BasicAuthConfig represents basic auth config.
@@ -39,12 +45,35 @@ type Config struct {
 	TLSCertificate        *tls.Certificate
 	TLSServerName         string
 	TLSInsecureSkipVerify bool
+
+	// Optional source for auto-rotated client certificate and trust bundle.
+	tlsCertSource certSource
+
+	// Optional function for obtaining `Authorization` header, which is refreshed from Kubernetes Secrets.
+	getAuthorization func() string
+}
+
+// GetAuthHeader returns the current value for `Authorization` header.
+//
+// It may differ from ac.Authorization if the header is built from Kubernetes Secrets, since they are periodically refreshed.
+func (ac *Config) GetAuthHeader() string {
+	if ac.getAuthorization != nil {
+		return ac.getAuthorization()
+	}
+	return ac.Authorization
 }
 
 // String returns human-(un)readable representation for cfg.
 func (ac *Config) String() string {
-	return fmt.Sprintf("Authorization=%s, TLSRootCA=%s, TLSCertificate=%s, TLSServerName=%s, TLSInsecureSkipVerify=%v",
-		ac.Authorization, ac.tlsRootCAString(), ac.tlsCertificateString(), ac.TLSServerName, ac.TLSInsecureSkipVerify)
+	return fmt.Sprintf("Authorization=%s, TLSRootCA=%s, TLSCertificate=%s, TLSServerName=%s, TLSInsecureSkipVerify=%v, TLSCertSource=%s",
+		ac.Authorization, ac.tlsRootCAString(), ac.tlsCertificateString(), ac.TLSServerName, ac.TLSInsecureSkipVerify, ac.tlsCertSourceString())
+}
+
+func (ac *Config) tlsCertSourceString() string {
+	if ac.tlsCertSource == nil {
+		return ""
+	}
+	return ac.tlsCertSource.String()
 }
 
 func (ac *Config) tlsRootCAString() string {
@@ -74,18 +103,55 @@ func (ac *Config) NewTLSConfig() *tls.Config {
 	}
 	tlsCfg.ServerName = ac.TLSServerName
 	tlsCfg.InsecureSkipVerify = ac.TLSInsecureSkipVerify
+	if cs := ac.tlsCertSource; cs != nil {
+		// The certificate is obtained on every TLS handshake, since it is rotated by cs.
+		tlsCfg.GetClientCertificate = func(_ *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return cs.getCertificate()
+		}
+		if !ac.TLSInsecureSkipVerify && ac.TLSRootCA == nil {
+			// Verify server certificates against the trust bundle from cs, since it may be rotated too.
+			// The standard verification is disabled, since it cannot use dynamically updated root CAs.
+			serverName := ac.TLSServerName
+			tlsCfg.InsecureSkipVerify = true
+			if _, ok := cs.(*secretCertSource); ok {
+				// Certificates from Kubernetes Secrets are usually issued for DNS names, so verify the server hostname like the standard verification does.
+				tlsCfg.VerifyConnection = func(state tls.ConnectionState) error {
+					dnsName := serverName
+					if dnsName == "" {
+						dnsName = state.ServerName
+					}
+					rawCerts := make([][]byte, len(state.PeerCertificates))
+					for i, cert := range state.PeerCertificates {
+						rawCerts[i] = cert.Raw
+					}
+					return verifyPeerCertificate(rawCerts, cs.getRootCAs(), dnsName)
+				}
+			} else {
+				tlsCfg.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+					return verifyPeerCertificate(rawCerts, cs.getRootCAs(), serverName)
+				}
+			}
+		}
+	}
 	return tlsCfg
 }
 
 // NewConfig creates auth config from the given args.
 func NewConfig(baseDir string, basicAuth *BasicAuthConfig, bearerToken, bearerTokenFile string, tlsConfig *TLSConfig) (*Config, error) {
 	var authorization string
+	var getAuthorization func() string
 	if basicAuth != nil {
 		if basicAuth.Username == "" {
 			return nil, fmt.Errorf("missing `username` in `basic_auth` section")
 		}
-		username := basicAuth.Username
-		password := basicAuth.Password
+		getUsername, err := getStringValue(basicAuth.Username)
+		if err != nil {
+			return nil, fmt.Errorf("cannot obtain `username` in `basic_auth` section: %w", err)
+		}
+		getPassword, err := getStringValue(basicAuth.Password)
+		if err != nil {
+			return nil, fmt.Errorf("cannot obtain `password` in `basic_auth` section: %w", err)
+		}
 		if basicAuth.PasswordFile != "" {
 			if basicAuth.Password != "" {
 				return nil, fmt.Errorf("both `password`=%q and `password_file`=%q are set in `basic_auth` section", basicAuth.Password, basicAuth.PasswordFile)
@@ -95,38 +161,68 @@ func NewConfig(baseDir string, basicAuth *BasicAuthConfig, bearerToken, bearerTo
 			if err != nil {
 				return nil, fmt.Errorf("cannot read password from `password_file`=%q set in `basic_auth` section: %w", basicAuth.PasswordFile, err)
 			}
-			password = pass
+			getPassword = func() string { return pass }
 		}
 		// See https://en.wikipedia.org/wiki/Basic_access_authentication
-		token := username + ":" + password
-		token64 := base64.StdEncoding.EncodeToString([]byte(token))
-		authorization = "Basic " + token64
+		getAuthorization = func() string {
+			token := getUsername() + ":" + getPassword()
+			token64 := base64.StdEncoding.EncodeToString([]byte(token))
+			return "Basic " + token64
+		}
 	}
-	if bearerTokenFile != "" {
-		if bearerToken != "" {
+	if bearerTokenFile != "" || bearerToken != "" {
+		if bearerToken != "" && bearerTokenFile != "" {
 			return nil, fmt.Errorf("both `bearer_token`=%q and `bearer_token_file`=%q are set", bearerToken, bearerTokenFile)
 		}
-		path := getFilepath(baseDir, bearerTokenFile)
-		token, err := readPasswordFromFile(path)
+		getBearerToken, err := getStringValue(bearerToken)
 		if err != nil {
-			return nil, fmt.Errorf("cannot read bearer token from `bearer_token_file`=%q: %w", bearerTokenFile, err)
+			return nil, fmt.Errorf("cannot obtain `bearer_token`: %w", err)
+		}
+		if bearerTokenFile != "" {
+			path := getFilepath(baseDir, bearerTokenFile)
+			token, err := readPasswordFromFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("cannot read bearer token from `bearer_token_file`=%q: %w", bearerTokenFile, err)
+			}
+			if token == "" {
+				// Empty `bearer_token_file` means missing bearer token.
+				getBearerToken = nil
+			} else {
+				getBearerToken = func() string { return token }
+			}
+		}
+		if getBearerToken != nil {
+			if getAuthorization != nil {
+				return nil, fmt.Errorf("cannot use both `basic_auth` and `bearer_token`")
+			}
+			getAuthorization = func() string {
+				return "Bearer " + getBearerToken()
+			}
 		}
-		bearerToken = token
 	}
-	if bearerToken != "" {
-		if authorization != "" {
-			return nil, fmt.Errorf("cannot use both `basic_auth` and `bearer_token`")
+	if getAuthorization != nil {
+		authorization = getAuthorization()
+		if !isSecretRef(bearerToken) && (basicAuth == nil || !isSecretRef(basicAuth.Username) && !isSecretRef(basicAuth.Password)) {
+			// The header cannot change, so there is no need in re-calculating it on every request.
+			getAuthorization = nil
 		}
-		authorization = "Bearer " + bearerToken
 	}
 	var tlsRootCA *x509.CertPool
 	var tlsCertificate *tls.Certificate
+	var tlsCertSource certSource
 	tlsServerName := ""
 	tlsInsecureSkipVerify := false
 	if tlsConfig != nil {
 		tlsServerName = tlsConfig.ServerName
 		tlsInsecureSkipVerify = tlsConfig.InsecureSkipVerify
-		if tlsConfig.CertFile != "" || tlsConfig.KeyFile != "" {
+		cs, err := getCertSource(baseDir, tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		tlsCertSource = cs
+		if hasSecretRefs(tlsConfig) {
+			// TLS certificates are obtained by tlsCertSource.
+		} else if tlsConfig.CertFile != "" || tlsConfig.KeyFile != "" {
 			certPath := getFilepath(baseDir, tlsConfig.CertFile)
 			keyPath := getFilepath(baseDir, tlsConfig.KeyFile)
 			cert, err := tls.LoadX509KeyPair(certPath, keyPath)
@@ -135,7 +231,7 @@ func NewConfig(baseDir string, basicAuth *BasicAuthConfig, bearerToken, bearerTo
 			}
 			tlsCertificate = &cert
 		}
-		if tlsConfig.CAFile != "" {
+		if tlsConfig.CAFile != "" && !hasSecretRefs(tlsConfig) {
 			path := getFilepath(baseDir, tlsConfig.CAFile)
 			data, err := ioutil.ReadFile(path)
 			if err != nil {
@@ -153,6 +249,8 @@ func NewConfig(baseDir string, basicAuth *BasicAuthConfig, bearerToken, bearerTo
 		TLSCertificate:        tlsCertificate,
 		TLSServerName:         tlsServerName,
 		TLSInsecureSkipVerify: tlsInsecureSkipVerify,
+		tlsCertSource:         tlsCertSource,
+		getAuthorization:      getAuthorization,
 	}
 	return ac, nil
 }
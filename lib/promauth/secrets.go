@@ -0,0 +1,232 @@
+package promauth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// SecretReader must return the value for the given key from the given Kubernetes Secret.
+type SecretReader func(namespace, name, key string) ([]byte, error)
+
+var (
+	secretReaderLock sync.Mutex
+	secretReader     SecretReader
+)
+
+// SetSecretReader sets sr for resolving `secret://namespace/name/key` references in auth configs.
+//
+// References cannot be resolved until SetSecretReader is called.
+func SetSecretReader(sr SecretReader) {
+	secretReaderLock.Lock()
+	secretReader = sr
+	secretReaderLock.Unlock()
+}
+
+const secretRefPrefix = "secret://"
+
+func isSecretRef(s string) bool {
+	return strings.HasPrefix(s, secretRefPrefix)
+}
+
+// readSecretRef reads the value for the given `secret://namespace/name/key` reference.
+func readSecretRef(ref string) ([]byte, error) {
+	parts := strings.Split(strings.TrimPrefix(ref, secretRefPrefix), "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return nil, fmt.Errorf("cannot parse %q; it must have the form `secret://namespace/name/key`", ref)
+	}
+	secretReaderLock.Lock()
+	sr := secretReader
+	secretReaderLock.Unlock()
+	if sr == nil {
+		return nil, fmt.Errorf("cannot resolve %q: references to Kubernetes Secrets aren't supported", ref)
+	}
+	data, err := sr(parts[0], parts[1], parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %q: %w", ref, err)
+	}
+	return data, nil
+}
+
+// secretRefreshInterval is the interval for re-reading Kubernetes Secrets referenced in auth configs.
+const secretRefreshInterval = 30 * time.Second
+
+var (
+	secretRefreshErrors = metrics.NewCounter(`vm_promauth_secret_refresh_errors_total`)
+
+	secretStringsLock sync.Mutex
+	secretStrings     = make(map[string]*secretString)
+)
+
+// secretString holds periodically refreshed string value for Kubernetes Secret reference.
+type secretString struct {
+	ref string
+
+	mu    sync.Mutex
+	value string
+}
+
+func (ss *secretString) get() string {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	return ss.value
+}
+
+func (ss *secretString) refresh() error {
+	data, err := readSecretRef(ss.ref)
+	if err != nil {
+		return err
+	}
+	value := strings.TrimRightFunc(string(data), unicode.IsSpace)
+	ss.mu.Lock()
+	ss.value = value
+	ss.mu.Unlock()
+	return nil
+}
+
+// getStringValue returns a function returning the current value for s.
+//
+// If s is a reference to Kubernetes Secret, then the returned function returns
+// the secret value, which is refreshed every secretRefreshInterval. Otherwise the returned function returns s.
+// Values are shared among all the configs with identical references, so they survive config reloads.
+func getStringValue(s string) (func() string, error) {
+	if !isSecretRef(s) {
+		return func() string { return s }, nil
+	}
+	secretStringsLock.Lock()
+	ss := secretStrings[s]
+	secretStringsLock.Unlock()
+	if ss == nil {
+		ssNew := &secretString{
+			ref: s,
+		}
+		// Read the secret before registering it, so invalid references are reported during config parsing.
+		if err := ssNew.refresh(); err != nil {
+			return nil, err
+		}
+		secretStringsLock.Lock()
+		ss = secretStrings[s]
+		if ss == nil {
+			ss = ssNew
+			secretStrings[s] = ss
+			if len(secretStrings) == 1 {
+				go runSecretStringsRefresher()
+			}
+		}
+		secretStringsLock.Unlock()
+	}
+	return ss.get, nil
+}
+
+func runSecretStringsRefresher() {
+	for {
+		time.Sleep(secretRefreshInterval)
+		secretStringsLock.Lock()
+		sss := make([]*secretString, 0, len(secretStrings))
+		for _, ss := range secretStrings {
+			sss = append(sss, ss)
+		}
+		secretStringsLock.Unlock()
+		for _, ss := range sss {
+			if err := ss.refresh(); err != nil {
+				secretRefreshErrors.Inc()
+				logger.Errorf("cannot refresh Kubernetes Secret: %s; continuing to use the previous value", err)
+			}
+		}
+	}
+}
+
+// secretCertSource obtains TLS client certificate and root CA from Kubernetes Secrets referenced in TLSConfig.
+//
+// Files are supported as well, so Secret references may be mixed with file paths.
+type secretCertSource struct {
+	*certHolder
+	baseDir  string
+	caFile   string
+	certFile string
+	keyFile  string
+}
+
+func hasSecretRefs(tlsConfig *TLSConfig) bool {
+	return isSecretRef(tlsConfig.CAFile) || isSecretRef(tlsConfig.CertFile) || isSecretRef(tlsConfig.KeyFile)
+}
+
+func newSecretCertSource(baseDir string, tlsConfig *TLSConfig) *secretCertSource {
+	s := &secretCertSource{
+		baseDir:  baseDir,
+		caFile:   tlsConfig.CAFile,
+		certFile: tlsConfig.CertFile,
+		keyFile:  tlsConfig.KeyFile,
+	}
+	s.certHolder = newCertHolder("secret", s.String())
+	go s.run()
+	return s
+}
+
+func (s *secretCertSource) String() string {
+	return fmt.Sprintf("secret{ca_file=%s, cert_file=%s, key_file=%s}", s.caFile, s.certFile, s.keyFile)
+}
+
+func (s *secretCertSource) run() {
+	for {
+		if err := s.refresh(); err != nil {
+			s.setError(err)
+			logger.Errorf("cannot obtain TLS certificates from %s: %s", s, err)
+		}
+		time.Sleep(secretRefreshInterval)
+	}
+}
+
+func (s *secretCertSource) refresh() error {
+	// An empty certificate means that the client certificate isn't sent to the server.
+	cert := &tls.Certificate{}
+	if s.certFile != "" || s.keyFile != "" {
+		certData, err := s.read(s.certFile)
+		if err != nil {
+			return fmt.Errorf("cannot read `cert_file`: %w", err)
+		}
+		keyData, err := s.read(s.keyFile)
+		if err != nil {
+			return fmt.Errorf("cannot read `key_file`: %w", err)
+		}
+		c, err := tls.X509KeyPair(certData, keyData)
+		if err != nil {
+			return fmt.Errorf("cannot load TLS certificate: %w", err)
+		}
+		cert = &c
+	}
+	var roots *x509.CertPool
+	if s.caFile != "" {
+		data, err := s.read(s.caFile)
+		if err != nil {
+			return fmt.Errorf("cannot read `ca_file`: %w", err)
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(data) {
+			return fmt.Errorf("cannot parse data from `ca_file` %q", s.caFile)
+		}
+	} else {
+		rs, err := x509.SystemCertPool()
+		if err != nil {
+			return fmt.Errorf("cannot load system root certificates: %w", err)
+		}
+		roots = rs
+	}
+	s.set(cert, roots)
+	return nil
+}
+
+func (s *secretCertSource) read(path string) ([]byte, error) {
+	if isSecretRef(path) {
+		return readSecretRef(path)
+	}
+	return ioutil.ReadFile(getFilepath(s.baseDir, path))
+}
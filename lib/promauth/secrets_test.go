@@ -0,0 +1,146 @@
+package promauth
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+type testSecrets struct {
+	mu sync.Mutex
+	m  map[string]string
+}
+
+func (ts *testSecrets) set(ref, value string) {
+	ts.mu.Lock()
+	ts.m[ref] = value
+	ts.mu.Unlock()
+}
+
+func (ts *testSecrets) read(namespace, name, key string) ([]byte, error) {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ref := fmt.Sprintf("secret://%s/%s/%s", namespace, name, key)
+	value, ok := ts.m[ref]
+	if !ok {
+		return nil, fmt.Errorf("missing %s", ref)
+	}
+	return []byte(value), nil
+}
+
+func TestNewConfigSecretsSuccess(t *testing.T) {
+	ts := &testSecrets{
+		m: map[string]string{
+			"secret://ns/token/value": "foo\n",
+			"secret://ns/auth/user":   "user",
+			"secret://ns/auth/pass":   "pass",
+		},
+	}
+	SetSecretReader(ts.read)
+	defer SetSecretReader(nil)
+
+	// bearer_token
+	ac, err := NewConfig(".", nil, "secret://ns/token/value", "", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ah := ac.GetAuthHeader(); ah != "Bearer foo" {
+		t.Fatalf("unexpected auth header; got %q; want %q", ah, "Bearer foo")
+	}
+	ts.set("secret://ns/token/value", "bar")
+	if err := secretStrings["secret://ns/token/value"].refresh(); err != nil {
+		t.Fatalf("cannot refresh secret: %s", err)
+	}
+	if ah := ac.GetAuthHeader(); ah != "Bearer bar" {
+		t.Fatalf("unexpected auth header after secret update; got %q; want %q", ah, "Bearer bar")
+	}
+
+	// basic_auth
+	ac, err = NewConfig(".", &BasicAuthConfig{
+		Username: "secret://ns/auth/user",
+		Password: "secret://ns/auth/pass",
+	}, "", "", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	ahExpected := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:pass"))
+	if ah := ac.GetAuthHeader(); ah != ahExpected {
+		t.Fatalf("unexpected auth header; got %q; want %q", ah, ahExpected)
+	}
+
+	// Static values mustn't be resolved.
+	ac, err = NewConfig(".", nil, "baz", "", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if ah := ac.GetAuthHeader(); ah != "Bearer baz" {
+		t.Fatalf("unexpected auth header; got %q; want %q", ah, "Bearer baz")
+	}
+}
+
+func TestNewConfigSecretsFailure(t *testing.T) {
+	f := func(bearerToken string) {
+		t.Helper()
+		if _, err := NewConfig(".", nil, bearerToken, "", nil); err == nil {
+			t.Fatalf("expecting non-nil error for bearer_token=%q", bearerToken)
+		}
+	}
+
+	// Secret reader isn't set
+	f("secret://ns/name/key")
+
+	ts := &testSecrets{
+		m: map[string]string{},
+	}
+	SetSecretReader(ts.read)
+	defer SetSecretReader(nil)
+
+	// Missing secret
+	f("secret://ns/name/missing")
+
+	// Invalid references
+	f("secret://ns/name")
+	f("secret://ns//key")
+	f("secret://ns/name/key/extra")
+}
+
+func TestSecretCertSource(t *testing.T) {
+	ca := newTestCert(t, "spiffe://example.org", nil)
+	leaf := newTestCert(t, "spiffe://example.org/vmagent", ca)
+	ts := &testSecrets{
+		m: map[string]string{
+			"secret://ns/tls/ca.crt":  ca.certPEM(),
+			"secret://ns/tls/tls.crt": leaf.certPEM(),
+			"secret://ns/tls/tls.key": leaf.keyPEM(t),
+		},
+	}
+	SetSecretReader(ts.read)
+	defer SetSecretReader(nil)
+
+	s := &secretCertSource{
+		certHolder: newCertHolder("secret", "test"),
+		caFile:     "secret://ns/tls/ca.crt",
+		certFile:   "secret://ns/tls/tls.crt",
+		keyFile:    "secret://ns/tls/tls.key",
+	}
+	if err := s.refresh(); err != nil {
+		t.Fatalf("cannot obtain certificates: %s", err)
+	}
+	cert, err := s.getCertificate()
+	if err != nil {
+		t.Fatalf("cannot obtain certificate: %s", err)
+	}
+	if len(cert.Certificate) != 1 || string(cert.Certificate[0]) != string(leaf.der) {
+		t.Fatalf("unexpected certificate obtained")
+	}
+	if err := verifyPeerCertificate([][]byte{leaf.der}, s.getRootCAs(), ""); err != nil {
+		t.Fatalf("cannot verify certificate against the obtained roots: %s", err)
+	}
+
+	// Broken key
+	ts.set("secret://ns/tls/tls.key", "foobar")
+	if err := s.refresh(); err == nil {
+		t.Fatalf("expecting non-nil error for broken key")
+	}
+}
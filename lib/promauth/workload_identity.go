@@ -0,0 +1,517 @@
+package promauth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// ConsulConnectConfig represents config for obtaining TLS client certificate from Consul Connect.
+//
+// See https://www.consul.io/api-docs/agent/connect#service-leaf-certificate
+type ConsulConnectConfig struct {
+	// Server is Consul agent address. It may contain scheme such as `https://consul:8501`. By default `localhost:8500` is used.
+	Server string `yaml:"server,omitempty"`
+
+	// Service is the name of the service to obtain leaf certificate for.
+	Service string `yaml:"service"`
+
+	// Token is an optional ACL token for Consul API.
+	Token string `yaml:"token,omitempty"`
+}
+
+// certSource provides auto-rotated TLS client certificate and trust bundle for verifying server certificates.
+type certSource interface {
+	// getCertificate returns the current client certificate.
+	getCertificate() (*tls.Certificate, error)
+
+	// getRootCAs returns the current trust bundle.
+	getRootCAs() *x509.CertPool
+
+	// waitReady waits until the first certificate is obtained or initialWaitTimeout passes.
+	waitReady()
+
+	// String returns human-readable description for the source.
+	String() string
+}
+
+var (
+	certSourcesLock sync.Mutex
+	certSources     = make(map[string]certSource)
+)
+
+// getCertSource returns certSource for the given tlsConfig.
+//
+// nil is returned if tlsConfig doesn't contain workload identity settings or references to Kubernetes Secrets.
+// Sources are shared among all the configs with identical settings, so they survive config reloads.
+func getCertSource(baseDir string, tlsConfig *TLSConfig) (certSource, error) {
+	hasSecrets := hasSecretRefs(tlsConfig)
+	if tlsConfig.SPIFFEWorkloadAPISocket == "" && tlsConfig.ConsulConnect == nil && !hasSecrets {
+		return nil, nil
+	}
+	if tlsConfig.SPIFFEWorkloadAPISocket != "" && tlsConfig.ConsulConnect != nil {
+		return nil, fmt.Errorf("`spiffe_workload_api_socket` cannot be used together with `consul_connect`")
+	}
+	if tlsConfig.CertFile != "" || tlsConfig.KeyFile != "" || hasSecrets {
+		if tlsConfig.SPIFFEWorkloadAPISocket != "" || tlsConfig.ConsulConnect != nil {
+			return nil, fmt.Errorf("`cert_file`, `key_file` and Secret references cannot be used together with `spiffe_workload_api_socket` or `consul_connect`")
+		}
+	}
+	var key string
+	var newSource func() certSource
+	if hasSecrets {
+		key = fmt.Sprintf("secret:%s/%s/%s/%s", baseDir, tlsConfig.CAFile, tlsConfig.CertFile, tlsConfig.KeyFile)
+		newSource = func() certSource {
+			return newSecretCertSource(baseDir, tlsConfig)
+		}
+	} else if tlsConfig.SPIFFEWorkloadAPISocket != "" {
+		socketPath := tlsConfig.SPIFFEWorkloadAPISocket
+		key = "spiffe:" + socketPath
+		newSource = func() certSource {
+			return newSPIFFESource(socketPath)
+		}
+	} else {
+		cc := tlsConfig.ConsulConnect
+		if cc.Service == "" {
+			return nil, fmt.Errorf("missing `service` in `consul_connect` section")
+		}
+		server := cc.Server
+		if server == "" {
+			server = "localhost:8500"
+		}
+		if !strings.Contains(server, "://") {
+			server = "http://" + server
+		}
+		if _, err := url.Parse(server); err != nil {
+			return nil, fmt.Errorf("cannot parse `server` in `consul_connect` section: %w", err)
+		}
+		key = "consul_connect:" + server + "/" + cc.Service + "/" + cc.Token
+		newSource = func() certSource {
+			return newConsulConnectSource(server, cc.Service, cc.Token)
+		}
+	}
+
+	certSourcesLock.Lock()
+	cs := certSources[key]
+	isNew := cs == nil
+	if isNew {
+		cs = newSource()
+		certSources[key] = cs
+	}
+	certSourcesLock.Unlock()
+	if isNew {
+		cs.waitReady()
+	}
+	return cs, nil
+}
+
+// verifyPeerCertificate verifies server certificate chain rawCerts against roots.
+//
+// The server hostname is verified only if serverName is set, since workload certificates
+// usually identify services via SPIFFE ID in URI SAN instead of DNS names.
+func verifyPeerCertificate(rawCerts [][]byte, roots *x509.CertPool, serverName string) error {
+	if roots == nil {
+		return fmt.Errorf("trust bundle isn't obtained yet")
+	}
+	if len(rawCerts) == 0 {
+		return fmt.Errorf("missing server certificate")
+	}
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, rawCert := range rawCerts {
+		cert, err := x509.ParseCertificate(rawCert)
+		if err != nil {
+			return fmt.Errorf("cannot parse server certificate: %w", err)
+		}
+		certs[i] = cert
+	}
+	opts := x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: x509.NewCertPool(),
+		DNSName:       serverName,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	for _, cert := range certs[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	if _, err := certs[0].Verify(opts); err != nil {
+		return fmt.Errorf("cannot verify server certificate: %w", err)
+	}
+	return nil
+}
+
+// certHolder holds the last obtained certificate and trust bundle.
+type certHolder struct {
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	roots   *x509.CertPool
+	lastErr error
+
+	readyOnce sync.Once
+	readyCh   chan struct{}
+
+	updates *metrics.Counter
+	errors  *metrics.Counter
+}
+
+func newCertHolder(sourceType, sourceName string) *certHolder {
+	return &certHolder{
+		readyCh: make(chan struct{}),
+		updates: metrics.GetOrCreateCounter(fmt.Sprintf(`vm_workload_cert_updates_total{type=%q, source=%q}`, sourceType, sourceName)),
+		errors:  metrics.GetOrCreateCounter(fmt.Sprintf(`vm_workload_cert_update_errors_total{type=%q, source=%q}`, sourceType, sourceName)),
+	}
+}
+
+// initialWaitTimeout is the maximum duration to wait for the first certificate when creating certSource.
+//
+// This reduces the number of failed requests immediately after the start.
+const initialWaitTimeout = 5 * time.Second
+
+func (ch *certHolder) waitReady() {
+	t := time.NewTimer(initialWaitTimeout)
+	select {
+	case <-ch.readyCh:
+		t.Stop()
+	case <-t.C:
+	}
+}
+
+func (ch *certHolder) set(cert *tls.Certificate, roots *x509.CertPool) {
+	ch.updates.Inc()
+	ch.mu.Lock()
+	ch.cert = cert
+	ch.roots = roots
+	ch.lastErr = nil
+	ch.mu.Unlock()
+	ch.readyOnce.Do(func() {
+		close(ch.readyCh)
+	})
+}
+
+func (ch *certHolder) setError(err error) {
+	ch.errors.Inc()
+	ch.mu.Lock()
+	ch.lastErr = err
+	ch.mu.Unlock()
+}
+
+func (ch *certHolder) getCertificate() (*tls.Certificate, error) {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	if ch.cert == nil {
+		if ch.lastErr != nil {
+			return nil, fmt.Errorf("client certificate isn't obtained yet: %w", ch.lastErr)
+		}
+		return nil, fmt.Errorf("client certificate isn't obtained yet")
+	}
+	return ch.cert, nil
+}
+
+func (ch *certHolder) getRootCAs() *x509.CertPool {
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+	return ch.roots
+}
+
+// spiffeSource obtains X509-SVID and trust bundle from SPIFFE Workload API.
+//
+// See https://github.com/spiffe/spiffe/blob/main/standards/SPIFFE_Workload_API.md
+type spiffeSource struct {
+	*certHolder
+	socketPath string
+}
+
+func newSPIFFESource(socketPath string) *spiffeSource {
+	s := &spiffeSource{
+		certHolder: newCertHolder("spiffe", socketPath),
+		socketPath: socketPath,
+	}
+	go s.run()
+	return s
+}
+
+func (s *spiffeSource) String() string {
+	return "spiffe_workload_api_socket=" + s.socketPath
+}
+
+// workloadAPIRetryInterval is the interval between reconnects to SPIFFE Workload API on errors.
+const workloadAPIRetryInterval = 5 * time.Second
+
+func (s *spiffeSource) run() {
+	for {
+		err := s.watch()
+		s.setError(err)
+		logger.Errorf("error when obtaining X509-SVID from SPIFFE Workload API at %q: %s; retrying in %s", s.socketPath, err, workloadAPIRetryInterval)
+		time.Sleep(workloadAPIRetryInterval)
+	}
+}
+
+// watch receives X509-SVID updates from SPIFFE Workload API until an error occurs.
+func (s *spiffeSource) watch() error {
+	conn, err := grpc.Dial("passthrough:///spiffe-workload-api", grpc.WithInsecure(),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", s.socketPath)
+		}))
+	if err != nil {
+		return fmt.Errorf("cannot connect to SPIFFE Workload API: %w", err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// See https://github.com/spiffe/spiffe/blob/main/standards/SPIFFE_Workload_API.md#6-the-workload-api-security-header
+	ctx = metadata.AppendToOutgoingContext(ctx, "workload.spiffe.io", "true")
+	sd := &grpc.StreamDesc{
+		StreamName:    "FetchX509SVID",
+		ServerStreams: true,
+	}
+	stream, err := conn.NewStream(ctx, sd, "/SpiffeWorkloadAPI/FetchX509SVID", grpc.ForceCodec(rawCodec{}))
+	if err != nil {
+		return fmt.Errorf("cannot call FetchX509SVID: %w", err)
+	}
+	// X509SVIDRequest is an empty message.
+	req := []byte{}
+	if err := stream.SendMsg(&req); err != nil {
+		return fmt.Errorf("cannot send X509SVIDRequest: %w", err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		return fmt.Errorf("cannot close request stream: %w", err)
+	}
+	for {
+		var resp []byte
+		if err := stream.RecvMsg(&resp); err != nil {
+			return fmt.Errorf("cannot receive X509SVIDResponse: %w", err)
+		}
+		cert, roots, err := parseX509SVIDResponse(resp)
+		if err != nil {
+			return err
+		}
+		s.set(cert, roots)
+	}
+}
+
+// rawCodec passes protobuf-encoded messages as is.
+//
+// This allows calling SPIFFE Workload API without generated protobuf code.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	return *v.(*[]byte), nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	dst := v.(*[]byte)
+	*dst = append((*dst)[:0], data...)
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return "proto"
+}
+
+// parseX509SVIDResponse returns client certificate and trust bundle from the first X509SVID in X509SVIDResponse message.
+//
+// See https://github.com/spiffe/go-spiffe/blob/main/v2/proto/spiffe/workload/workload.proto
+func parseX509SVIDResponse(data []byte) (*tls.Certificate, *x509.CertPool, error) {
+	// X509SVIDResponse.svids field
+	svid, err := getProtobufBytesField(data, 1)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot parse X509SVIDResponse: %w", err)
+	}
+	if svid == nil {
+		return nil, nil, fmt.Errorf("missing svids in X509SVIDResponse")
+	}
+	// X509SVID.x509_svid field
+	svidCerts, err := getProtobufBytesField(svid, 2)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot parse X509SVID: %w", err)
+	}
+	// X509SVID.x509_svid_key field
+	svidKey, err := getProtobufBytesField(svid, 3)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot parse X509SVID: %w", err)
+	}
+	// X509SVID.bundle field
+	bundle, err := getProtobufBytesField(svid, 4)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot parse X509SVID: %w", err)
+	}
+
+	certs, err := x509.ParseCertificates(svidCerts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot parse x509_svid: %w", err)
+	}
+	if len(certs) == 0 {
+		return nil, nil, fmt.Errorf("missing certificates in x509_svid")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(svidKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot parse x509_svid_key: %w", err)
+	}
+	cert := &tls.Certificate{
+		PrivateKey: key,
+		Leaf:       certs[0],
+	}
+	for _, c := range certs {
+		cert.Certificate = append(cert.Certificate, c.Raw)
+	}
+	bundleCerts, err := x509.ParseCertificates(bundle)
+	if err != nil {
+		return nil, nil, fmt.Errorf("cannot parse bundle: %w", err)
+	}
+	roots := x509.NewCertPool()
+	for _, c := range bundleCerts {
+		roots.AddCert(c)
+	}
+	return cert, roots, nil
+}
+
+// getProtobufBytesField returns the first value for length-delimited field with the given fieldNum from protobuf message data.
+//
+// nil is returned if the field is missing.
+func getProtobufBytesField(data []byte, fieldNum protowire.Number) ([]byte, error) {
+	for len(data) > 0 {
+		num, typ, n := protowire.ConsumeTag(data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+		if num == fieldNum && typ == protowire.BytesType {
+			v, n := protowire.ConsumeBytes(data)
+			if n < 0 {
+				return nil, protowire.ParseError(n)
+			}
+			if v == nil {
+				v = []byte{}
+			}
+			return v, nil
+		}
+		n = protowire.ConsumeFieldValue(num, typ, data)
+		if n < 0 {
+			return nil, protowire.ParseError(n)
+		}
+		data = data[n:]
+	}
+	return nil, nil
+}
+
+// consulConnectSource obtains leaf certificate and CA roots from Consul Connect.
+//
+// See https://www.consul.io/api-docs/agent/connect
+type consulConnectSource struct {
+	*certHolder
+	server  string
+	service string
+	token   string
+}
+
+func newConsulConnectSource(server, service, token string) *consulConnectSource {
+	s := &consulConnectSource{
+		certHolder: newCertHolder("consul_connect", server+"/"+service),
+		server:     server,
+		service:    service,
+		token:      token,
+	}
+	go s.run()
+	return s
+}
+
+func (s *consulConnectSource) String() string {
+	return fmt.Sprintf("consul_connect{server=%s, service=%s}", s.server, s.service)
+}
+
+// consulConnectRefreshInterval is the interval for refreshing leaf certificate and CA roots from Consul agent.
+//
+// Consul agent caches leaf certificates and renews them before the expiration, so frequent refreshes are cheap.
+const consulConnectRefreshInterval = time.Minute
+
+var consulConnectClient = &http.Client{
+	Timeout: 10 * time.Second,
+}
+
+func (s *consulConnectSource) run() {
+	for {
+		if err := s.refresh(); err != nil {
+			s.setError(err)
+			logger.Errorf("cannot obtain Consul Connect certificate for service %q from %q: %s", s.service, s.server, err)
+		}
+		time.Sleep(consulConnectRefreshInterval)
+	}
+}
+
+func (s *consulConnectSource) refresh() error {
+	var leaf struct {
+		CertPEM       string
+		PrivateKeyPEM string
+	}
+	if err := s.getJSON("/v1/agent/connect/ca/leaf/"+url.PathEscape(s.service), &leaf); err != nil {
+		return err
+	}
+	cert, err := tls.X509KeyPair([]byte(leaf.CertPEM), []byte(leaf.PrivateKeyPEM))
+	if err != nil {
+		return fmt.Errorf("cannot parse leaf certificate: %w", err)
+	}
+	var caRoots struct {
+		Roots []struct {
+			RootCert          string
+			IntermediateCerts []string
+		}
+	}
+	if err := s.getJSON("/v1/agent/connect/ca/roots", &caRoots); err != nil {
+		return err
+	}
+	roots := x509.NewCertPool()
+	for _, r := range caRoots.Roots {
+		if !roots.AppendCertsFromPEM([]byte(r.RootCert)) {
+			return fmt.Errorf("cannot parse CA root certificate")
+		}
+	}
+	if len(caRoots.Roots) == 0 {
+		return fmt.Errorf("missing CA roots")
+	}
+	s.set(&cert, roots)
+	return nil
+}
+
+func (s *consulConnectSource) getJSON(path string, dst interface{}) error {
+	u := s.server + path
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return fmt.Errorf("cannot create request to %q: %w", u, err)
+	}
+	if s.token != "" {
+		req.Header.Set("X-Consul-Token", s.token)
+	}
+	resp, err := consulConnectClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("cannot fetch %q: %w", u, err)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("cannot read response from %q: %w", u, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code when fetching %q: %d; want %d; response: %q", u, resp.StatusCode, http.StatusOK, data)
+	}
+	if err := json.Unmarshal(data, dst); err != nil {
+		return fmt.Errorf("cannot parse response from %q: %w", u, err)
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+package promauth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	der  []byte
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCert(t *testing.T, spiffeID string, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("cannot generate key: %s", err)
+	}
+	u, err := url.Parse(spiffeID)
+	if err != nil {
+		t.Fatalf("cannot parse SPIFFE ID: %s", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: spiffeID},
+		URIs:         []*url.URL{u},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+	}
+	parentCert := tmpl
+	parentKey := key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+	} else {
+		parentCert = parent.cert
+		parentKey = parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parentCert, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatalf("cannot create certificate: %s", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("cannot parse certificate: %s", err)
+	}
+	return &testCert{
+		cert: cert,
+		der:  der,
+		key:  key,
+	}
+}
+
+func (tc *testCert) certPEM() string {
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tc.der}))
+}
+
+func (tc *testCert) keyPEM(t *testing.T) string {
+	t.Helper()
+	der, err := x509.MarshalECPrivateKey(tc.key)
+	if err != nil {
+		t.Fatalf("cannot marshal key: %s", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+}
+
+func TestParseX509SVIDResponse(t *testing.T) {
+	ca := newTestCert(t, "spiffe://example.org", nil)
+	leaf := newTestCert(t, "spiffe://example.org/vmagent", ca)
+	key, err := x509.MarshalPKCS8PrivateKey(leaf.key)
+	if err != nil {
+		t.Fatalf("cannot marshal key: %s", err)
+	}
+
+	// Build X509SVIDResponse message.
+	var svid []byte
+	svid = protowire.AppendTag(svid, 1, protowire.BytesType)
+	svid = protowire.AppendString(svid, "spiffe://example.org/vmagent")
+	svid = protowire.AppendTag(svid, 2, protowire.BytesType)
+	svid = protowire.AppendBytes(svid, leaf.der)
+	svid = protowire.AppendTag(svid, 3, protowire.BytesType)
+	svid = protowire.AppendBytes(svid, key)
+	svid = protowire.AppendTag(svid, 4, protowire.BytesType)
+	svid = protowire.AppendBytes(svid, ca.der)
+	var resp []byte
+	resp = protowire.AppendTag(resp, 1, protowire.BytesType)
+	resp = protowire.AppendBytes(resp, svid)
+	// federated_bundles must be skipped.
+	resp = protowire.AppendTag(resp, 3, protowire.BytesType)
+	resp = protowire.AppendBytes(resp, []byte("foobar"))
+
+	cert, roots, err := parseX509SVIDResponse(resp)
+	if err != nil {
+		t.Fatalf("cannot parse X509SVIDResponse: %s", err)
+	}
+	if len(cert.Certificate) != 1 || cert.Leaf.URIs[0].String() != "spiffe://example.org/vmagent" {
+		t.Fatalf("unexpected certificate: %+v", cert.Leaf)
+	}
+	if err := verifyPeerCertificate([][]byte{leaf.der}, roots, ""); err != nil {
+		t.Fatalf("cannot verify certificate against the obtained bundle: %s", err)
+	}
+
+	// Missing svids
+	if _, _, err := parseX509SVIDResponse(nil); err == nil {
+		t.Fatalf("expecting non-nil error for empty X509SVIDResponse")
+	}
+	// Invalid message
+	if _, _, err := parseX509SVIDResponse([]byte{0x0a, 0xff}); err == nil {
+		t.Fatalf("expecting non-nil error for invalid X509SVIDResponse")
+	}
+}
+
+func TestConsulConnectSource(t *testing.T) {
+	ca := newTestCert(t, "spiffe://11111111-2222-3333-4444-555555555555.consul", nil)
+	leaf := newTestCert(t, "spiffe://11111111-2222-3333-4444-555555555555.consul/ns/default/dc/dc1/svc/vmagent", ca)
+	otherCA := newTestCert(t, "spiffe://other.consul", nil)
+	otherLeaf := newTestCert(t, "spiffe://other.consul/ns/default/dc/dc1/svc/foo", otherCA)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if token := r.Header.Get("X-Consul-Token"); token != "secret" {
+			http.Error(w, "unexpected token", http.StatusForbidden)
+			return
+		}
+		var resp interface{}
+		switch r.URL.Path {
+		case "/v1/agent/connect/ca/leaf/vmagent":
+			resp = map[string]string{
+				"CertPEM":       leaf.certPEM(),
+				"PrivateKeyPEM": leaf.keyPEM(t),
+			}
+		case "/v1/agent/connect/ca/roots":
+			resp = map[string]interface{}{
+				"Roots": []map[string]interface{}{{
+					"RootCert": ca.certPEM(),
+					"Active":   true,
+				}},
+			}
+		default:
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	defer srv.Close()
+
+	cs, err := getCertSource("", &TLSConfig{
+		ConsulConnect: &ConsulConnectConfig{
+			Server:  srv.URL,
+			Service: "vmagent",
+			Token:   "secret",
+		},
+	})
+	if err != nil {
+		t.Fatalf("cannot create cert source: %s", err)
+	}
+	cert, err := cs.getCertificate()
+	if err != nil {
+		t.Fatalf("cannot obtain certificate: %s", err)
+	}
+	if len(cert.Certificate) != 1 || string(cert.Certificate[0]) != string(leaf.der) {
+		t.Fatalf("unexpected certificate obtained")
+	}
+	roots := cs.getRootCAs()
+	if err := verifyPeerCertificate([][]byte{leaf.der}, roots, ""); err != nil {
+		t.Fatalf("cannot verify certificate against the obtained roots: %s", err)
+	}
+	if err := verifyPeerCertificate([][]byte{otherLeaf.der}, roots, ""); err == nil {
+		t.Fatalf("expecting non-nil error when verifying certificate from other trust domain")
+	}
+	if err := verifyPeerCertificate([][]byte{leaf.der}, nil, ""); err == nil {
+		t.Fatalf("expecting non-nil error when verifying certificate without roots")
+	}
+
+	// The source must be shared among configs with identical settings.
+	cs2, err := getCertSource("", &TLSConfig{
+		ConsulConnect: &ConsulConnectConfig{
+			Server:  srv.URL,
+			Service: "vmagent",
+			Token:   "secret",
+		},
+	})
+	if err != nil {
+		t.Fatalf("cannot create cert source: %s", err)
+	}
+	if cs2 != cs {
+		t.Fatalf("expecting shared cert source")
+	}
+}
+
+func TestGetCertSourceFailure(t *testing.T) {
+	f := func(tlsConfig *TLSConfig) {
+		t.Helper()
+		if _, err := getCertSource("", tlsConfig); err == nil {
+			t.Fatalf("expecting non-nil error for %+v", tlsConfig)
+		}
+	}
+	f(&TLSConfig{
+		SPIFFEWorkloadAPISocket: "/foo/bar",
+		ConsulConnect: &ConsulConnectConfig{
+			Service: "foo",
+		},
+	})
+	f(&TLSConfig{
+		SPIFFEWorkloadAPISocket: "/foo/bar",
+		CertFile:                "foo",
+		KeyFile:                 "bar",
+	})
+	f(&TLSConfig{
+		ConsulConnect: &ConsulConnectConfig{},
+	})
+}
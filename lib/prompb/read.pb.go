@@ -0,0 +1,263 @@
+// Code generated manually from remote.proto
+
+package prompb
+
+import (
+	"fmt"
+	"io"
+)
+
+// ReadRequest_ResponseType is the response type accepted by the client.
+type ReadRequest_ResponseType int32
+
+const (
+	// ReadRequest_SAMPLES is the server will return a single ReadResponse message with matched series that includes list of raw samples.
+	ReadRequest_SAMPLES ReadRequest_ResponseType = 0
+	// ReadRequest_STREAMED_XOR_CHUNKS is the server will stream a delimited ChunkedReadResponse message that contains XOR encoded chunks for a single series.
+	ReadRequest_STREAMED_XOR_CHUNKS ReadRequest_ResponseType = 1
+)
+
+// ReadRequest represents Prometheus remote read API request
+type ReadRequest struct {
+	Queries               []Query
+	AcceptedResponseTypes []ReadRequest_ResponseType
+}
+
+// Query is a single query in ReadRequest.
+type Query struct {
+	StartTimestampMs int64
+	EndTimestampMs   int64
+	Matchers         []LabelMatcher
+}
+
+// LabelMatcher_Type is the type of LabelMatcher.
+type LabelMatcher_Type int32
+
+const (
+	// LabelMatcher_EQ is `name="value"` matcher.
+	LabelMatcher_EQ LabelMatcher_Type = 0
+	// LabelMatcher_NEQ is `name!="value"` matcher.
+	LabelMatcher_NEQ LabelMatcher_Type = 1
+	// LabelMatcher_RE is `name=~"value"` matcher.
+	LabelMatcher_RE LabelMatcher_Type = 2
+	// LabelMatcher_NRE is `name!~"value"` matcher.
+	LabelMatcher_NRE LabelMatcher_Type = 3
+)
+
+// LabelMatcher specifies a rule, which can match or set of labels or not.
+type LabelMatcher struct {
+	Type  LabelMatcher_Type
+	Name  []byte
+	Value []byte
+}
+
+// Unmarshal unmarshals m from dAtA.
+//
+// m refers to dAtA after the call, so dAtA mustn't be modified while m is in use.
+func (m *ReadRequest) Unmarshal(dAtA []byte) error {
+	m.Queries = m.Queries[:0]
+	m.AcceptedResponseTypes = m.AcceptedResponseTypes[:0]
+	iNdEx := 0
+	for iNdEx < len(dAtA) {
+		preIndex := iNdEx
+		wire, n, err := readVarint(dAtA[iNdEx:])
+		if err != nil {
+			return err
+		}
+		iNdEx += n
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: ReadRequest: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch {
+		case fieldNum == 1 && wireType == 2:
+			data, n, err := readBytes(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			iNdEx += n
+			m.Queries = append(m.Queries, Query{})
+			q := &m.Queries[len(m.Queries)-1]
+			if err := q.Unmarshal(data); err != nil {
+				return fmt.Errorf("cannot unmarshal query: %w", err)
+			}
+		case fieldNum == 2 && wireType == 0:
+			v, n, err := readVarint(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			iNdEx += n
+			m.AcceptedResponseTypes = append(m.AcceptedResponseTypes, ReadRequest_ResponseType(v))
+		case fieldNum == 2 && wireType == 2:
+			// packed repeated enum
+			data, n, err := readBytes(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			iNdEx += n
+			for len(data) > 0 {
+				v, n, err := readVarint(data)
+				if err != nil {
+					return err
+				}
+				data = data[n:]
+				m.AcceptedResponseTypes = append(m.AcceptedResponseTypes, ReadRequest_ResponseType(v))
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipRemote(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 || iNdEx+skippy > len(dAtA) {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+	return nil
+}
+
+// Unmarshal unmarshals m from dAtA.
+func (m *Query) Unmarshal(dAtA []byte) error {
+	iNdEx := 0
+	for iNdEx < len(dAtA) {
+		preIndex := iNdEx
+		wire, n, err := readVarint(dAtA[iNdEx:])
+		if err != nil {
+			return err
+		}
+		iNdEx += n
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: Query: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch {
+		case fieldNum == 1 && wireType == 0:
+			v, n, err := readVarint(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			iNdEx += n
+			m.StartTimestampMs = int64(v)
+		case fieldNum == 2 && wireType == 0:
+			v, n, err := readVarint(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			iNdEx += n
+			m.EndTimestampMs = int64(v)
+		case fieldNum == 3 && wireType == 2:
+			data, n, err := readBytes(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			iNdEx += n
+			m.Matchers = append(m.Matchers, LabelMatcher{})
+			lm := &m.Matchers[len(m.Matchers)-1]
+			if err := lm.Unmarshal(data); err != nil {
+				return fmt.Errorf("cannot unmarshal label matcher: %w", err)
+			}
+		default:
+			// Hints (field 4) are ignored, since they are optional.
+			iNdEx = preIndex
+			skippy, err := skipRemote(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 || iNdEx+skippy > len(dAtA) {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+	return nil
+}
+
+// Unmarshal unmarshals m from dAtA.
+func (m *LabelMatcher) Unmarshal(dAtA []byte) error {
+	iNdEx := 0
+	for iNdEx < len(dAtA) {
+		preIndex := iNdEx
+		wire, n, err := readVarint(dAtA[iNdEx:])
+		if err != nil {
+			return err
+		}
+		iNdEx += n
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: LabelMatcher: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch {
+		case fieldNum == 1 && wireType == 0:
+			v, n, err := readVarint(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			iNdEx += n
+			m.Type = LabelMatcher_Type(v)
+		case fieldNum == 2 && wireType == 2:
+			data, n, err := readBytes(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			iNdEx += n
+			m.Name = data
+		case fieldNum == 3 && wireType == 2:
+			data, n, err := readBytes(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			iNdEx += n
+			m.Value = data
+		default:
+			iNdEx = preIndex
+			skippy, err := skipRemote(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 || iNdEx+skippy > len(dAtA) {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+	return nil
+}
+
+// readVarint reads varint from dAtA and returns it with the number of bytes read.
+func readVarint(dAtA []byte) (uint64, int, error) {
+	var v uint64
+	for i, shift := 0, uint(0); ; i, shift = i+1, shift+7 {
+		if shift >= 64 {
+			return 0, 0, errIntOverflowRemote
+		}
+		if i >= len(dAtA) {
+			return 0, 0, io.ErrUnexpectedEOF
+		}
+		b := dAtA[i]
+		v |= uint64(b&0x7F) << shift
+		if b < 0x80 {
+			return v, i + 1, nil
+		}
+	}
+}
+
+// readBytes reads length-delimited bytes from dAtA and returns them with the number of bytes read.
+func readBytes(dAtA []byte) ([]byte, int, error) {
+	size, n, err := readVarint(dAtA)
+	if err != nil {
+		return nil, 0, err
+	}
+	end := n + int(size)
+	if int(size) < 0 || end < n {
+		return nil, 0, errInvalidLengthRemote
+	}
+	if end > len(dAtA) {
+		return nil, 0, io.ErrUnexpectedEOF
+	}
+	return dAtA[n:end], end, nil
+}
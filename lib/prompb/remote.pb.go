@@ -10,9 +10,11 @@ import (
 // WriteRequest represents Prometheus remote write API request
 type WriteRequest struct {
 	Timeseries []TimeSeries
+	Metadata   []MetricMetadata
 
-	labelsPool  []Label
-	samplesPool []Sample
+	labelsPool    []Label
+	samplesPool   []Sample
+	exemplarsPool []Exemplar
 }
 
 // Unmarshal unmarshals m from dAtA.
@@ -78,11 +80,48 @@ func (m *WriteRequest) Unmarshal(dAtA []byte) error {
 			}
 			ts := &m.Timeseries[len(m.Timeseries)-1]
 			var err error
-			m.labelsPool, m.samplesPool, err = ts.Unmarshal(dAtA[iNdEx:postIndex], m.labelsPool, m.samplesPool)
+			m.labelsPool, m.samplesPool, m.exemplarsPool, err = ts.Unmarshal(dAtA[iNdEx:postIndex], m.labelsPool, m.samplesPool, m.exemplarsPool)
 			if err != nil {
 				return err
 			}
 			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Metadata", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return errIntOverflowRemote
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return errInvalidLengthRemote
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			if cap(m.Metadata) > len(m.Metadata) {
+				m.Metadata = m.Metadata[:len(m.Metadata)+1]
+			} else {
+				m.Metadata = append(m.Metadata, MetricMetadata{})
+			}
+			mm := &m.Metadata[len(m.Metadata)-1]
+			*mm = MetricMetadata{}
+			if err := mm.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipRemote(dAtA[iNdEx:])
@@ -0,0 +1,139 @@
+package prompb
+
+import (
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+)
+
+func TestWriteRequestUnmarshalExemplars(t *testing.T) {
+	wrm := &prompbmarshal.WriteRequest{
+		Timeseries: []prompbmarshal.TimeSeries{
+			{
+				Labels: []prompbmarshal.Label{
+					{Name: "__name__", Value: "foo_bucket"},
+					{Name: "le", Value: "0.5"},
+				},
+				Samples: []prompbmarshal.Sample{
+					{Value: 12, Timestamp: 1600096945479},
+				},
+				Exemplars: []prompbmarshal.Exemplar{
+					{
+						Labels: []prompbmarshal.Label{
+							{Name: "trace_id", Value: "abc"},
+						},
+						Value:     0.42,
+						Timestamp: 1600096945000,
+					},
+					{
+						Value:     0.3,
+						Timestamp: 1600096946000,
+					},
+				},
+			},
+			{
+				Labels: []prompbmarshal.Label{
+					{Name: "__name__", Value: "bar"},
+				},
+				Samples: []prompbmarshal.Sample{
+					{Value: 1, Timestamp: 1600096945479},
+				},
+			},
+		},
+	}
+	data, err := wrm.Marshal()
+	if err != nil {
+		t.Fatalf("cannot marshal WriteRequest: %s", err)
+	}
+
+	var wr WriteRequest
+	// Unmarshal twice in order to verify that the reused buffers are properly reset.
+	for i := 0; i < 2; i++ {
+		wr.Reset()
+		if err := wr.Unmarshal(data); err != nil {
+			t.Fatalf("cannot unmarshal WriteRequest: %s", err)
+		}
+		if len(wr.Timeseries) != 2 {
+			t.Fatalf("unexpected number of time series; got %d; want 2", len(wr.Timeseries))
+		}
+		ts := &wr.Timeseries[0]
+		if len(ts.Labels) != 2 || string(ts.Labels[1].Value) != "0.5" {
+			t.Fatalf("unexpected labels: %+v", ts.Labels)
+		}
+		if len(ts.Samples) != 1 || ts.Samples[0].Value != 12 {
+			t.Fatalf("unexpected samples: %+v", ts.Samples)
+		}
+		if len(ts.Exemplars) != 2 {
+			t.Fatalf("unexpected number of exemplars; got %d; want 2", len(ts.Exemplars))
+		}
+		e := &ts.Exemplars[0]
+		if len(e.Labels) != 1 || string(e.Labels[0].Name) != "trace_id" || string(e.Labels[0].Value) != "abc" {
+			t.Fatalf("unexpected exemplar labels: %+v", e.Labels)
+		}
+		if e.Value != 0.42 || e.Timestamp != 1600096945000 {
+			t.Fatalf("unexpected exemplar: value=%v, timestamp=%d", e.Value, e.Timestamp)
+		}
+		e = &ts.Exemplars[1]
+		if len(e.Labels) != 0 || e.Value != 0.3 || e.Timestamp != 1600096946000 {
+			t.Fatalf("unexpected exemplar: %+v", e)
+		}
+		ts = &wr.Timeseries[1]
+		if len(ts.Labels) != 1 || len(ts.Samples) != 1 || len(ts.Exemplars) != 0 {
+			t.Fatalf("unexpected time series: %+v", ts)
+		}
+	}
+}
+
+func TestWriteRequestUnmarshalMetadata(t *testing.T) {
+	wrm := &prompbmarshal.WriteRequest{
+		Timeseries: []prompbmarshal.TimeSeries{
+			{
+				Labels: []prompbmarshal.Label{
+					{Name: "__name__", Value: "foo_seconds_count"},
+				},
+				Samples: []prompbmarshal.Sample{
+					{Value: 3, Timestamp: 1600096945479},
+				},
+			},
+		},
+		Metadata: []prompbmarshal.MetricMetadata{
+			{
+				Type:             prompbmarshal.GetMetricMetadataType("histogram"),
+				MetricFamilyName: "foo_seconds",
+				Help:             "Foo duration",
+				Unit:             "seconds",
+			},
+			{
+				Type:             prompbmarshal.GetMetricMetadataType("untyped"),
+				MetricFamilyName: "bar",
+			},
+		},
+	}
+	data, err := wrm.Marshal()
+	if err != nil {
+		t.Fatalf("cannot marshal WriteRequest: %s", err)
+	}
+
+	var wr WriteRequest
+	// Unmarshal twice in order to verify that the reused buffers are properly reset.
+	for i := 0; i < 2; i++ {
+		wr.Reset()
+		if err := wr.Unmarshal(data); err != nil {
+			t.Fatalf("cannot unmarshal WriteRequest: %s", err)
+		}
+		if len(wr.Timeseries) != 1 || len(wr.Timeseries[0].Samples) != 1 {
+			t.Fatalf("unexpected time series: %+v", wr.Timeseries)
+		}
+		if len(wr.Metadata) != 2 {
+			t.Fatalf("unexpected number of metadata entries; got %d; want 2", len(wr.Metadata))
+		}
+		mm := &wr.Metadata[0]
+		if mm.Type.String() != "histogram" || string(mm.MetricFamilyName) != "foo_seconds" || string(mm.Help) != "Foo duration" || string(mm.Unit) != "seconds" {
+			t.Fatalf("unexpected metadata: type=%s, name=%q, help=%q, unit=%q", mm.Type, mm.MetricFamilyName, mm.Help, mm.Unit)
+		}
+		mm = &wr.Metadata[1]
+		if mm.Type.String() != "unknown" || string(mm.MetricFamilyName) != "bar" || len(mm.Help) != 0 || len(mm.Unit) != 0 {
+			t.Fatalf("unexpected metadata: type=%s, name=%q, help=%q, unit=%q", mm.Type, mm.MetricFamilyName, mm.Help, mm.Unit)
+		}
+	}
+}
@@ -15,10 +15,19 @@ type Sample struct {
 	Timestamp int64
 }
 
+// Exemplar is an exemplar for a timeseries.
+type Exemplar struct {
+	// Labels contain optional labels for the exemplar such as trace_id.
+	Labels    []Label
+	Value     float64
+	Timestamp int64
+}
+
 // TimeSeries is a timeseries.
 type TimeSeries struct {
-	Labels  []Label
-	Samples []Sample
+	Labels    []Label
+	Samples   []Sample
+	Exemplars []Exemplar
 }
 
 // Label is a timeseries label
@@ -27,6 +36,51 @@ type Label struct {
 	Value []byte
 }
 
+// MetricType is a type of a metric family.
+type MetricType int32
+
+// Metric types for MetricMetadata.
+const (
+	MetricTypeUnknown        MetricType = 0
+	MetricTypeCounter        MetricType = 1
+	MetricTypeGauge          MetricType = 2
+	MetricTypeHistogram      MetricType = 3
+	MetricTypeGaugeHistogram MetricType = 4
+	MetricTypeSummary        MetricType = 5
+	MetricTypeInfo           MetricType = 6
+	MetricTypeStateset       MetricType = 7
+)
+
+// String returns string representation for mt as used in `# TYPE` lines of Prometheus exposition format.
+func (mt MetricType) String() string {
+	switch mt {
+	case MetricTypeCounter:
+		return "counter"
+	case MetricTypeGauge:
+		return "gauge"
+	case MetricTypeHistogram:
+		return "histogram"
+	case MetricTypeGaugeHistogram:
+		return "gaugehistogram"
+	case MetricTypeSummary:
+		return "summary"
+	case MetricTypeInfo:
+		return "info"
+	case MetricTypeStateset:
+		return "stateset"
+	default:
+		return "unknown"
+	}
+}
+
+// MetricMetadata is metadata for a metric family.
+type MetricMetadata struct {
+	Type             MetricType
+	MetricFamilyName []byte
+	Help             []byte
+	Unit             []byte
+}
+
 // Unmarshal unmarshals sample from dAtA.
 func (m *Sample) Unmarshal(dAtA []byte) error {
 	l := len(dAtA)
@@ -110,9 +164,10 @@ func (m *Sample) Unmarshal(dAtA []byte) error {
 }
 
 // Unmarshal unmarshals timeseries from dAtA.
-func (m *TimeSeries) Unmarshal(dAtA []byte, dstLabels []Label, dstSamples []Sample) ([]Label, []Sample, error) {
+func (m *TimeSeries) Unmarshal(dAtA []byte, dstLabels []Label, dstSamples []Sample, dstExemplars []Exemplar) ([]Label, []Sample, []Exemplar, error) {
 	labelsStart := len(dstLabels)
 	samplesStart := len(dstSamples)
+	exemplarsStart := len(dstExemplars)
 
 	l := len(dAtA)
 	iNdEx := 0
@@ -121,10 +176,10 @@ func (m *TimeSeries) Unmarshal(dAtA []byte, dstLabels []Label, dstSamples []Samp
 		var wire uint64
 		for shift := uint(0); ; shift += 7 {
 			if shift >= 64 {
-				return dstLabels, dstSamples, errIntOverflowTypes
+				return dstLabels, dstSamples, dstExemplars, errIntOverflowTypes
 			}
 			if iNdEx >= l {
-				return dstLabels, dstSamples, io.ErrUnexpectedEOF
+				return dstLabels, dstSamples, dstExemplars, io.ErrUnexpectedEOF
 			}
 			b := dAtA[iNdEx]
 			iNdEx++
@@ -136,23 +191,23 @@ func (m *TimeSeries) Unmarshal(dAtA []byte, dstLabels []Label, dstSamples []Samp
 		fieldNum := int32(wire >> 3)
 		wireType := int(wire & 0x7)
 		if wireType == 4 {
-			return dstLabels, dstSamples, fmt.Errorf("proto: TimeSeries: wiretype end group for non-group")
+			return dstLabels, dstSamples, dstExemplars, fmt.Errorf("proto: TimeSeries: wiretype end group for non-group")
 		}
 		if fieldNum <= 0 {
-			return dstLabels, dstSamples, fmt.Errorf("proto: TimeSeries: illegal tag %d (wire type %d)", fieldNum, wire)
+			return dstLabels, dstSamples, dstExemplars, fmt.Errorf("proto: TimeSeries: illegal tag %d (wire type %d)", fieldNum, wire)
 		}
 		switch fieldNum {
 		case 1:
 			if wireType != 2 {
-				return dstLabels, dstSamples, fmt.Errorf("proto: wrong wireType = %d for field Labels", wireType)
+				return dstLabels, dstSamples, dstExemplars, fmt.Errorf("proto: wrong wireType = %d for field Labels", wireType)
 			}
 			var msglen int
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
-					return dstLabels, dstSamples, errIntOverflowTypes
+					return dstLabels, dstSamples, dstExemplars, errIntOverflowTypes
 				}
 				if iNdEx >= l {
-					return dstLabels, dstSamples, io.ErrUnexpectedEOF
+					return dstLabels, dstSamples, dstExemplars, io.ErrUnexpectedEOF
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
@@ -162,11 +217,11 @@ func (m *TimeSeries) Unmarshal(dAtA []byte, dstLabels []Label, dstSamples []Samp
 				}
 			}
 			if msglen < 0 {
-				return dstLabels, dstSamples, errInvalidLengthTypes
+				return dstLabels, dstSamples, dstExemplars, errInvalidLengthTypes
 			}
 			postIndex := iNdEx + msglen
 			if postIndex > l {
-				return dstLabels, dstSamples, io.ErrUnexpectedEOF
+				return dstLabels, dstSamples, dstExemplars, io.ErrUnexpectedEOF
 			}
 			if cap(dstLabels) > len(dstLabels) {
 				dstLabels = dstLabels[:len(dstLabels)+1]
@@ -175,20 +230,20 @@ func (m *TimeSeries) Unmarshal(dAtA []byte, dstLabels []Label, dstSamples []Samp
 			}
 			lb := &dstLabels[len(dstLabels)-1]
 			if err := lb.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
-				return dstLabels, dstSamples, err
+				return dstLabels, dstSamples, dstExemplars, err
 			}
 			iNdEx = postIndex
 		case 2:
 			if wireType != 2 {
-				return dstLabels, dstSamples, fmt.Errorf("proto: wrong wireType = %d for field Samples", wireType)
+				return dstLabels, dstSamples, dstExemplars, fmt.Errorf("proto: wrong wireType = %d for field Samples", wireType)
 			}
 			var msglen int
 			for shift := uint(0); ; shift += 7 {
 				if shift >= 64 {
-					return dstLabels, dstSamples, errIntOverflowTypes
+					return dstLabels, dstSamples, dstExemplars, errIntOverflowTypes
 				}
 				if iNdEx >= l {
-					return dstLabels, dstSamples, io.ErrUnexpectedEOF
+					return dstLabels, dstSamples, dstExemplars, io.ErrUnexpectedEOF
 				}
 				b := dAtA[iNdEx]
 				iNdEx++
@@ -198,11 +253,11 @@ func (m *TimeSeries) Unmarshal(dAtA []byte, dstLabels []Label, dstSamples []Samp
 				}
 			}
 			if msglen < 0 {
-				return dstLabels, dstSamples, errInvalidLengthTypes
+				return dstLabels, dstSamples, dstExemplars, errInvalidLengthTypes
 			}
 			postIndex := iNdEx + msglen
 			if postIndex > l {
-				return dstLabels, dstSamples, io.ErrUnexpectedEOF
+				return dstLabels, dstSamples, dstExemplars, io.ErrUnexpectedEOF
 			}
 			if cap(dstSamples) > len(dstSamples) {
 				dstSamples = dstSamples[:len(dstSamples)+1]
@@ -211,32 +266,184 @@ func (m *TimeSeries) Unmarshal(dAtA []byte, dstLabels []Label, dstSamples []Samp
 			}
 			s := &dstSamples[len(dstSamples)-1]
 			if err := s.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
-				return dstLabels, dstSamples, err
+				return dstLabels, dstSamples, dstExemplars, err
+			}
+			iNdEx = postIndex
+		case 3:
+			if wireType != 2 {
+				return dstLabels, dstSamples, dstExemplars, fmt.Errorf("proto: wrong wireType = %d for field Exemplars", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return dstLabels, dstSamples, dstExemplars, errIntOverflowTypes
+				}
+				if iNdEx >= l {
+					return dstLabels, dstSamples, dstExemplars, io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return dstLabels, dstSamples, dstExemplars, errInvalidLengthTypes
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return dstLabels, dstSamples, dstExemplars, io.ErrUnexpectedEOF
+			}
+			if cap(dstExemplars) > len(dstExemplars) {
+				dstExemplars = dstExemplars[:len(dstExemplars)+1]
+			} else {
+				dstExemplars = append(dstExemplars, Exemplar{})
+			}
+			e := &dstExemplars[len(dstExemplars)-1]
+			if err := e.Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return dstLabels, dstSamples, dstExemplars, err
 			}
 			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipTypes(dAtA[iNdEx:])
 			if err != nil {
-				return dstLabels, dstSamples, err
+				return dstLabels, dstSamples, dstExemplars, err
 			}
 			if skippy < 0 {
-				return dstLabels, dstSamples, errInvalidLengthTypes
+				return dstLabels, dstSamples, dstExemplars, errInvalidLengthTypes
 			}
 			if (iNdEx + skippy) > l {
-				return dstLabels, dstSamples, io.ErrUnexpectedEOF
+				return dstLabels, dstSamples, dstExemplars, io.ErrUnexpectedEOF
 			}
 			iNdEx += skippy
 		}
 	}
 
 	if iNdEx > l {
-		return dstLabels, dstSamples, io.ErrUnexpectedEOF
+		return dstLabels, dstSamples, dstExemplars, io.ErrUnexpectedEOF
 	}
 
 	m.Labels = dstLabels[labelsStart:]
 	m.Samples = dstSamples[samplesStart:]
-	return dstLabels, dstSamples, nil
+	m.Exemplars = dstExemplars[exemplarsStart:]
+	return dstLabels, dstSamples, dstExemplars, nil
+}
+
+// Unmarshal unmarshals Exemplar from dAtA.
+func (m *Exemplar) Unmarshal(dAtA []byte) error {
+	labels := m.Labels[:0]
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return errIntOverflowTypes
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: Exemplar: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: Exemplar: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Labels", wireType)
+			}
+			var msglen int
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return errIntOverflowTypes
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				msglen |= (int(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			if msglen < 0 {
+				return errInvalidLengthTypes
+			}
+			postIndex := iNdEx + msglen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			labels = append(labels, Label{})
+			if err := labels[len(labels)-1].Unmarshal(dAtA[iNdEx:postIndex]); err != nil {
+				return err
+			}
+			iNdEx = postIndex
+		case 2:
+			if wireType != 1 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Value", wireType)
+			}
+			var v uint64
+			if (iNdEx + 8) > l {
+				return io.ErrUnexpectedEOF
+			}
+			v = uint64(binary.LittleEndian.Uint64(dAtA[iNdEx:]))
+			iNdEx += 8
+			m.Value = float64(math.Float64frombits(v))
+		case 3:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Timestamp", wireType)
+			}
+			m.Timestamp = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return errIntOverflowTypes
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Timestamp |= int64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		default:
+			iNdEx = preIndex
+			skippy, err := skipTypes(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return errInvalidLengthTypes
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	m.Labels = labels
+	return nil
 }
 
 // Unmarshal unmarshals Label from dAtA.
@@ -349,6 +556,113 @@ func (m *Label) Unmarshal(dAtA []byte) error {
 	return nil
 }
 
+// Unmarshal unmarshals MetricMetadata from dAtA.
+func (m *MetricMetadata) Unmarshal(dAtA []byte) error {
+	l := len(dAtA)
+	iNdEx := 0
+	for iNdEx < l {
+		preIndex := iNdEx
+		var wire uint64
+		for shift := uint(0); ; shift += 7 {
+			if shift >= 64 {
+				return errIntOverflowTypes
+			}
+			if iNdEx >= l {
+				return io.ErrUnexpectedEOF
+			}
+			b := dAtA[iNdEx]
+			iNdEx++
+			wire |= uint64(b&0x7F) << shift
+			if b < 0x80 {
+				break
+			}
+		}
+		fieldNum := int32(wire >> 3)
+		wireType := int(wire & 0x7)
+		if wireType == 4 {
+			return fmt.Errorf("proto: MetricMetadata: wiretype end group for non-group")
+		}
+		if fieldNum <= 0 {
+			return fmt.Errorf("proto: MetricMetadata: illegal tag %d (wire type %d)", fieldNum, wire)
+		}
+		switch fieldNum {
+		case 1:
+			if wireType != 0 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Type", wireType)
+			}
+			m.Type = 0
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return errIntOverflowTypes
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				m.Type |= MetricType(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+		case 2, 4, 5:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field %d", wireType, fieldNum)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return errIntOverflowTypes
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= uint64(b&0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return errInvalidLengthTypes
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			switch fieldNum {
+			case 2:
+				m.MetricFamilyName = dAtA[iNdEx:postIndex]
+			case 4:
+				m.Help = dAtA[iNdEx:postIndex]
+			case 5:
+				m.Unit = dAtA[iNdEx:postIndex]
+			}
+			iNdEx = postIndex
+		default:
+			iNdEx = preIndex
+			skippy, err := skipTypes(dAtA[iNdEx:])
+			if err != nil {
+				return err
+			}
+			if skippy < 0 {
+				return errInvalidLengthTypes
+			}
+			if (iNdEx + skippy) > l {
+				return io.ErrUnexpectedEOF
+			}
+			iNdEx += skippy
+		}
+	}
+
+	if iNdEx > l {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
 func skipTypes(dAtA []byte) (n int, err error) {
 	l := len(dAtA)
 	iNdEx := 0
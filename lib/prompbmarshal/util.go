@@ -2,6 +2,7 @@ package prompbmarshal
 
 import (
 	"fmt"
+	"strings"
 )
 
 // MarshalWriteRequest marshals wr to dst and returns the result.
@@ -19,9 +20,52 @@ func MarshalWriteRequest(dst []byte, wr *WriteRequest) []byte {
 	return dst[:dstLen+n]
 }
 
+// MarshalReadResponse marshals rr to dst and returns the result.
+func MarshalReadResponse(dst []byte, rr *ReadResponse) []byte {
+	size := rr.Size()
+	dst, buf := grow(dst, size)
+	n, err := rr.MarshalToSizedBuffer(buf)
+	if err != nil {
+		panic(fmt.Errorf("BUG: unexpected error when marshaling ReadResponse: %w", err))
+	}
+	return dst[:len(dst)-size+n]
+}
+
+// MarshalChunkedReadResponse marshals crr to dst and returns the result.
+func MarshalChunkedReadResponse(dst []byte, crr *ChunkedReadResponse) []byte {
+	size := crr.Size()
+	dst, buf := grow(dst, size)
+	n, err := crr.MarshalToSizedBuffer(buf)
+	if err != nil {
+		panic(fmt.Errorf("BUG: unexpected error when marshaling ChunkedReadResponse: %w", err))
+	}
+	return dst[:len(dst)-size+n]
+}
+
+// grow extends dst by size bytes and returns the extended dst with the buffer for the added bytes.
+func grow(dst []byte, size int) ([]byte, []byte) {
+	dstLen := len(dst)
+	if n := size - (cap(dst) - dstLen); n > 0 {
+		dst = append(dst[:cap(dst)], make([]byte, n)...)
+	}
+	dst = dst[:dstLen+size]
+	return dst, dst[dstLen:]
+}
+
 // ResetWriteRequest resets wr.
 func ResetWriteRequest(wr *WriteRequest) {
 	wr.Timeseries = ResetTimeSeries(wr.Timeseries)
+	for i := range wr.Metadata {
+		wr.Metadata[i] = MetricMetadata{}
+	}
+	wr.Metadata = wr.Metadata[:0]
+}
+
+// GetMetricMetadataType returns MetricMetadata_MetricType for the given metricType from `# TYPE` line in Prometheus exposition format.
+//
+// MetricMetadata_UNKNOWN is returned for unknown metricType such as `untyped`.
+func GetMetricMetadataType(metricType string) MetricMetadata_MetricType {
+	return MetricMetadata_MetricType(MetricMetadata_MetricType_value[strings.ToUpper(metricType)])
 }
 
 // ResetTimeSeries clears all the GC references from tss and returns an empty tss ready for further use.
@@ -30,6 +74,7 @@ func ResetTimeSeries(tss []TimeSeries) []TimeSeries {
 		ts := tss[i]
 		ts.Labels = nil
 		ts.Samples = nil
+		ts.Exemplars = nil
 	}
 	return tss[:0]
 }
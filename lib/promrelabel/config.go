@@ -21,6 +21,12 @@ type RelabelConfig struct {
 	Modulus      uint64   `yaml:"modulus,omitempty"`
 	Replacement  *string  `yaml:"replacement,omitempty"`
 	Action       string   `yaml:"action,omitempty"`
+
+	// Match is Graphite-like template for matching metric names in `action: graphite`.
+	Match string `yaml:"match,omitempty"`
+
+	// Labels contains label templates for `action: graphite`.
+	Labels map[string]string `yaml:"labels,omitempty"`
 }
 
 // ParsedConfigs represents parsed relabel configs.
@@ -48,6 +54,34 @@ func (pcs *ParsedConfigs) String() string {
 	return sb.String()
 }
 
+// ReferencesLabel returns true if relabeling rules from pcs may read the label with the given name.
+//
+// The label is referenced if it is mentioned in `source_labels` or if its name matches `regex`
+// in `action: labelmap` or `action: labelmap_all`.
+func (pcs *ParsedConfigs) ReferencesLabel(name string) bool {
+	if pcs == nil {
+		return false
+	}
+	for _, prc := range pcs.prcs {
+		for _, sourceLabel := range prc.SourceLabels {
+			if sourceLabel == name {
+				return true
+			}
+		}
+		switch prc.Action {
+		case "labelmap":
+			if prc.matchString(name) {
+				return true
+			}
+		case "labelmap_all":
+			if prc.regexOriginal.MatchString(name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // LoadRelabelConfigs loads relabel configs from the given path.
 func LoadRelabelConfigs(path string) (*ParsedConfigs, error) {
 	data, err := ioutil.ReadFile(path)
@@ -128,6 +162,28 @@ func parseRelabelConfig(rc *RelabelConfig) (*parsedRelabelConfig, error) {
 	if action == "" {
 		action = "replace"
 	}
+	var graphiteMatchTemplate *graphiteMatchTemplate
+	if rc.Match != "" {
+		if action != "graphite" {
+			return nil, fmt.Errorf("`match` config cannot be applied to `action=%s`; it is applied only to `action=graphite`", action)
+		}
+		gmt, err := newGraphiteMatchTemplate(rc.Match)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse `match` %q: %w", rc.Match, err)
+		}
+		graphiteMatchTemplate = gmt
+	}
+	var graphiteLabelRules []graphiteLabelRule
+	if rc.Labels != nil {
+		if action != "graphite" {
+			return nil, fmt.Errorf("`labels` config cannot be applied to `action=%s`; it is applied only to `action=graphite`", action)
+		}
+		glrs, err := newGraphiteLabelRules(rc.Labels)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse `labels`: %w", err)
+		}
+		graphiteLabelRules = glrs
+	}
 	switch action {
 	case "replace":
 		if targetLabel == "" {
@@ -166,6 +222,16 @@ func parseRelabelConfig(rc *RelabelConfig) (*parsedRelabelConfig, error) {
 		if modulus < 1 {
 			return nil, fmt.Errorf("unexpected `modulus` for `action=hashmod`: %d; must be greater than 0", modulus)
 		}
+	case "graphite":
+		if graphiteMatchTemplate == nil {
+			return nil, fmt.Errorf("missing `match` for `action=graphite`; see https://victoriametrics.github.io/vmagent.html#graphite-relabeling")
+		}
+		if len(graphiteLabelRules) == 0 {
+			return nil, fmt.Errorf("missing `labels` for `action=graphite`; see https://victoriametrics.github.io/vmagent.html#graphite-relabeling")
+		}
+		if len(sourceLabels) > 0 || targetLabel != "" || rc.Regex != nil || rc.Replacement != nil {
+			return nil, fmt.Errorf("`source_labels`, `target_label`, `regex` and `replacement` cannot be used with `action=graphite`")
+		}
 	case "labelmap":
 	case "labelmap_all":
 	case "labeldrop":
@@ -185,5 +251,7 @@ func parseRelabelConfig(rc *RelabelConfig) (*parsedRelabelConfig, error) {
 		regexOriginal:                regexOriginalCompiled,
 		hasCaptureGroupInTargetLabel: strings.Contains(targetLabel, "$"),
 		hasCaptureGroupInReplacement: strings.Contains(replacement, "$"),
+		graphiteMatchTemplate:        graphiteMatchTemplate,
+		graphiteLabelRules:           graphiteLabelRules,
 	}, nil
 }
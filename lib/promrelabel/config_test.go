@@ -184,6 +184,70 @@ func TestParseRelabelConfigsFailure(t *testing.T) {
 			},
 		})
 	})
+	t.Run("graphite-missing-match", func(t *testing.T) {
+		f([]RelabelConfig{
+			{
+				Action: "graphite",
+				Labels: map[string]string{
+					"foo": "bar",
+				},
+			},
+		})
+	})
+	t.Run("graphite-missing-labels", func(t *testing.T) {
+		f([]RelabelConfig{
+			{
+				Action: "graphite",
+				Match:  "foo.*.bar",
+			},
+		})
+	})
+	t.Run("graphite-superflouous-source-labels", func(t *testing.T) {
+		f([]RelabelConfig{
+			{
+				Action:       "graphite",
+				Match:        "foo.*.bar",
+				Labels:       map[string]string{"job": "$1"},
+				SourceLabels: []string{"foo"},
+			},
+		})
+	})
+	t.Run("graphite-adjacent-stars", func(t *testing.T) {
+		f([]RelabelConfig{
+			{
+				Action: "graphite",
+				Match:  "foo.**.bar",
+				Labels: map[string]string{"job": "$1"},
+			},
+		})
+	})
+	t.Run("graphite-invalid-label-template", func(t *testing.T) {
+		f([]RelabelConfig{
+			{
+				Action: "graphite",
+				Match:  "foo.*.bar",
+				Labels: map[string]string{"job": "${1"},
+			},
+		})
+	})
+	t.Run("non-graphite-match", func(t *testing.T) {
+		f([]RelabelConfig{
+			{
+				Action:       "keep",
+				SourceLabels: []string{"foo"},
+				Match:        "foo.*",
+			},
+		})
+	})
+	t.Run("non-graphite-labels", func(t *testing.T) {
+		f([]RelabelConfig{
+			{
+				Action:       "keep",
+				SourceLabels: []string{"foo"},
+				Labels:       map[string]string{"job": "x"},
+			},
+		})
+	})
 	t.Run("invalid-action", func(t *testing.T) {
 		f([]RelabelConfig{
 			{
@@ -196,3 +260,38 @@ func TestParseRelabelConfigsFailure(t *testing.T) {
 func strPtr(s string) *string {
 	return &s
 }
+
+func TestParsedConfigsReferencesLabel(t *testing.T) {
+	pcs, err := ParseRelabelConfigsData([]byte(`
+- source_labels: [__meta_kubernetes_pod_name, __meta_kubernetes_namespace]
+  target_label: pod
+- action: labelmap
+  regex: __meta_kubernetes_pod_label_(.+)
+- action: labelmap_all
+  regex: annotation_prometheus_io
+- action: labeldrop
+  regex: __meta_kubernetes_node_.*
+`))
+	if err != nil {
+		t.Fatalf("cannot parse relabel configs: %s", err)
+	}
+	f := func(name string, resultExpected bool) {
+		t.Helper()
+		result := pcs.ReferencesLabel(name)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for ReferencesLabel(%q); got %v; want %v", name, result, resultExpected)
+		}
+	}
+	f("__meta_kubernetes_pod_name", true)
+	f("__meta_kubernetes_namespace", true)
+	f("__meta_kubernetes_pod_label_app", true)
+	f("__meta_kubernetes_pod_annotation_prometheus_io_scrape", true)
+	f("__meta_kubernetes_pod_labelpresent_app", false)
+	f("__meta_kubernetes_node_name", false)
+	f("__meta_kubernetes_pod_ip", false)
+
+	var pcsNil *ParsedConfigs
+	if pcsNil.ReferencesLabel("foo") {
+		t.Fatalf("nil ParsedConfigs mustn't reference labels")
+	}
+}
@@ -0,0 +1,226 @@
+package promrelabel
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// graphiteLabelRule is a rule for setting the label with grLabelName name from `labels` section of `action: graphite`.
+type graphiteLabelRule struct {
+	grLabelName string
+	grTemplate  *graphiteReplaceTemplate
+}
+
+func newGraphiteLabelRules(m map[string]string) ([]graphiteLabelRule, error) {
+	a := make([]graphiteLabelRule, 0, len(m))
+	for labelName, template := range m {
+		grt, err := newGraphiteReplaceTemplate(template)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse template for label %q: %w", labelName, err)
+		}
+		a = append(a, graphiteLabelRule{
+			grLabelName: labelName,
+			grTemplate:  grt,
+		})
+	}
+	// Sort the rules by label name in order to get deterministic results.
+	sort.Slice(a, func(i, j int) bool {
+		return a[i].grLabelName < a[j].grLabelName
+	})
+	return a, nil
+}
+
+type graphiteMatches struct {
+	a []string
+}
+
+var graphiteMatchesPool = &sync.Pool{
+	New: func() interface{} {
+		return &graphiteMatches{}
+	},
+}
+
+// graphiteMatchTemplate is a Graphite-like template for matching metric names such as `foo.*.bar`.
+//
+// Every `*` matches a non-empty part of the metric name without dots.
+type graphiteMatchTemplate struct {
+	sOrig string
+	parts []string
+}
+
+func (gmt *graphiteMatchTemplate) String() string {
+	return gmt.sOrig
+}
+
+func newGraphiteMatchTemplate(s string) (*graphiteMatchTemplate, error) {
+	if s == "" {
+		return nil, fmt.Errorf("`match` cannot be empty")
+	}
+	sOrig := s
+	var parts []string
+	for {
+		n := strings.IndexByte(s, '*')
+		if n < 0 {
+			parts = appendGraphiteMatchTemplateParts(parts, s)
+			break
+		}
+		parts = appendGraphiteMatchTemplateParts(parts, s[:n])
+		if len(parts) > 0 && parts[len(parts)-1] == "*" {
+			return nil, fmt.Errorf("`match` cannot contain adjacent `*` chars; got %q", sOrig)
+		}
+		parts = appendGraphiteMatchTemplateParts(parts, "*")
+		s = s[n+1:]
+	}
+	return &graphiteMatchTemplate{
+		sOrig: sOrig,
+		parts: parts,
+	}, nil
+}
+
+func appendGraphiteMatchTemplateParts(dst []string, s string) []string {
+	if len(s) == 0 {
+		// Skip empty part
+		return dst
+	}
+	return append(dst, s)
+}
+
+// Match matches s against gmt.
+//
+// On success it adds matched captures to dst and returns it with true.
+// On failure it returns false.
+//
+// dst[0] contains the whole s, while dst[N] contains the value matched by the N-th `*` in gmt.
+func (gmt *graphiteMatchTemplate) Match(dst []string, s string) ([]string, bool) {
+	dst = append(dst, s)
+	parts := gmt.parts
+	for i, part := range parts {
+		if part != "*" {
+			if !strings.HasPrefix(s, part) {
+				// Cannot match the current part
+				return dst, false
+			}
+			s = s[len(part):]
+			continue
+		}
+		// Search for the matching substring for '*' part.
+		n := -1
+		if i+1 < len(parts) {
+			// Match until the next literal part.
+			n = strings.Index(s, parts[i+1])
+		} else {
+			// The last part is '*', so it matches the rest of s.
+			n = len(s)
+		}
+		if n <= 0 {
+			// Cannot match the current part or it is empty.
+			return dst, false
+		}
+		match := s[:n]
+		if strings.IndexByte(match, '.') >= 0 {
+			// '*' cannot match dots.
+			return dst, false
+		}
+		dst = append(dst, match)
+		s = s[n:]
+	}
+	return dst, len(s) == 0
+}
+
+type graphiteReplaceTemplatePart struct {
+	n int
+	s string
+}
+
+// graphiteReplaceTemplate is a template for label values in `labels` section of `action: graphite`.
+//
+// It may contain `$N` or `${N}` placeholders, which are substituted with the N-th capture from graphiteMatchTemplate.
+type graphiteReplaceTemplate struct {
+	sOrig string
+	parts []graphiteReplaceTemplatePart
+}
+
+func (grt *graphiteReplaceTemplate) String() string {
+	return grt.sOrig
+}
+
+func newGraphiteReplaceTemplate(s string) (*graphiteReplaceTemplate, error) {
+	sOrig := s
+	var parts []graphiteReplaceTemplatePart
+	for {
+		n := strings.IndexByte(s, '$')
+		if n < 0 {
+			parts = appendGraphiteReplaceTemplateParts(parts, s, -1)
+			break
+		}
+		if n > 0 {
+			parts = appendGraphiteReplaceTemplateParts(parts, s[:n], -1)
+		}
+		s = s[n+1:]
+		if len(s) > 0 && s[0] == '{' {
+			// The index in the form ${123}
+			n = strings.IndexByte(s, '}')
+			if n < 0 {
+				return nil, fmt.Errorf("missing `}` in %q", sOrig)
+			}
+			idxStr := s[1:n]
+			s = s[n+1:]
+			idx, err := strconv.Atoi(idxStr)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse %q in %q: %w", idxStr, sOrig, err)
+			}
+			parts = appendGraphiteReplaceTemplateParts(parts, "${"+idxStr+"}", idx)
+		} else {
+			// The index in the form $123
+			n := 0
+			for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+				n++
+			}
+			if n == 0 {
+				// There is no index, so treat '$' as a literal char.
+				parts = appendGraphiteReplaceTemplateParts(parts, "$", -1)
+				continue
+			}
+			idxStr := s[:n]
+			s = s[n:]
+			idx, err := strconv.Atoi(idxStr)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse %q in %q: %w", idxStr, sOrig, err)
+			}
+			parts = appendGraphiteReplaceTemplateParts(parts, "$"+idxStr, idx)
+		}
+	}
+	return &graphiteReplaceTemplate{
+		sOrig: sOrig,
+		parts: parts,
+	}, nil
+}
+
+// Expand expands grt with the given matches into dst and returns it.
+//
+// Placeholders referring to missing matches are substituted with empty strings.
+func (grt *graphiteReplaceTemplate) Expand(dst []byte, matches []string) []byte {
+	for _, part := range grt.parts {
+		if n := part.n; n >= 0 {
+			if n < len(matches) {
+				dst = append(dst, matches[n]...)
+			}
+		} else {
+			dst = append(dst, part.s...)
+		}
+	}
+	return dst
+}
+
+func appendGraphiteReplaceTemplateParts(dst []graphiteReplaceTemplatePart, s string, n int) []graphiteReplaceTemplatePart {
+	if len(s) > 0 {
+		dst = append(dst, graphiteReplaceTemplatePart{
+			s: s,
+			n: n,
+		})
+	}
+	return dst
+}
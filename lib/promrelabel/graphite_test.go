@@ -0,0 +1,77 @@
+package promrelabel
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGraphiteTemplateMatchExpand(t *testing.T) {
+	f := func(matchTpl, s, replaceTpl, resultExpected string) {
+		t.Helper()
+		gmt, err := newGraphiteMatchTemplate(matchTpl)
+		if err != nil {
+			t.Fatalf("cannot parse match template %q: %s", matchTpl, err)
+		}
+		matches, _ := gmt.Match(nil, s)
+		grt, err := newGraphiteReplaceTemplate(replaceTpl)
+		if err != nil {
+			t.Fatalf("cannot parse replace template %q: %s", replaceTpl, err)
+		}
+		result := string(grt.Expand(nil, matches))
+		if result != resultExpected {
+			t.Fatalf("unexpected result; got %q; want %q", result, resultExpected)
+		}
+	}
+	f("test.*.*.counter", "test.foo.bar.counter", "${2}_total", "bar_total")
+	f("test.*.*.counter", "test.foo.bar.counter", "$1_total", "foo_total")
+	f("test.*.*.counter", "test.foo.bar.counter", "total_$0", "total_test.foo.bar.counter")
+	f("test.dispatcher.*.*.*", "test.dispatcher.foo.bar.baz", "$3-$2-$1", "baz-bar-foo")
+	f("*.signup.*.*", "foo.signup.bar.baz", "$1-${3}_$2_total", "foo-baz_bar_total")
+	f("foo.*", "foo.bar", "$ and $$ and ${5}x", "$ and $$ and x")
+}
+
+func TestGraphiteMatchTemplateMatch(t *testing.T) {
+	f := func(tpl, s string, matchesExpected []string, okExpected bool) {
+		t.Helper()
+		gmt, err := newGraphiteMatchTemplate(tpl)
+		if err != nil {
+			t.Fatalf("cannot parse template %q: %s", tpl, err)
+		}
+		matches, ok := gmt.Match(nil, s)
+		if ok != okExpected {
+			t.Fatalf("unexpected ok result for tpl=%q, s=%q; got %v; want %v", tpl, s, ok, okExpected)
+		}
+		if okExpected && !reflect.DeepEqual(matches, matchesExpected) {
+			t.Fatalf("unexpected matches for tpl=%q, s=%q; got\n%q\nwant\n%q", tpl, s, matches, matchesExpected)
+		}
+	}
+	f("foo", "foo", []string{"foo"}, true)
+	f("foo", "bar", nil, false)
+	f("foo", "foo.bar", nil, false)
+	f("foo.*", "foo", nil, false)
+	f("foo.*", "foo.", nil, false)
+	f("foo.*", "foo.bar", []string{"foo.bar", "bar"}, true)
+	f("foo.*", "foo.bar.baz", nil, false)
+	f("*", "foo", []string{"foo", "foo"}, true)
+	f("*", "foo.bar", nil, false)
+	f("*foo", "barfoo", []string{"barfoo", "bar"}, true)
+	f("foo*bar", "fooxbar", []string{"fooxbar", "x"}, true)
+	f("*.*", "foo.bar", []string{"foo.bar", "foo", "bar"}, true)
+	f("*.*.baz", "foo.bar.baz", []string{"foo.bar.baz", "foo", "bar"}, true)
+	f("*.bar", "foo.baz", nil, false)
+}
+
+func TestGraphiteTemplateFailure(t *testing.T) {
+	f := func(matchTpl, replaceTpl string) {
+		t.Helper()
+		_, errMatch := newGraphiteMatchTemplate(matchTpl)
+		_, errReplace := newGraphiteReplaceTemplate(replaceTpl)
+		if errMatch == nil && errReplace == nil {
+			t.Fatalf("expecting non-nil error for match=%q, replace=%q", matchTpl, replaceTpl)
+		}
+	}
+	f("", "$1")
+	f("foo**", "$1")
+	f("foo.*", "${1")
+	f("foo.*", "${x}")
+}
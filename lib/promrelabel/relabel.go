@@ -27,6 +27,9 @@ type parsedRelabelConfig struct {
 	regexOriginal                *regexp.Regexp
 	hasCaptureGroupInTargetLabel bool
 	hasCaptureGroupInReplacement bool
+
+	graphiteMatchTemplate *graphiteMatchTemplate
+	graphiteLabelRules    []graphiteLabelRule
 }
 
 // String returns human-readable representation for prc.
@@ -41,9 +44,19 @@ func (prc *parsedRelabelConfig) String() string {
 //
 // The returned labels at labels[labelsOffset:] are sorted.
 func (pcs *ParsedConfigs) Apply(labels []prompbmarshal.Label, labelsOffset int, isFinalize bool) []prompbmarshal.Label {
+	return pcs.ApplyCountMatches(labels, labelsOffset, isFinalize, nil)
+}
+
+// ApplyCountMatches is the same as Apply, but it also increments matches[i] if the i-th rule in pcs matches labels.
+//
+// matches must be either nil or contain at least pcs.Len() items.
+func (pcs *ParsedConfigs) ApplyCountMatches(labels []prompbmarshal.Label, labelsOffset int, isFinalize bool, matches []uint64) []prompbmarshal.Label {
 	if pcs != nil {
-		for _, prc := range pcs.prcs {
-			tmp := prc.apply(labels, labelsOffset)
+		for i, prc := range pcs.prcs {
+			tmp, matched := prc.apply(labels, labelsOffset)
+			if matched && matches != nil {
+				matches[i]++
+			}
 			if len(tmp) == labelsOffset {
 				// All the labels have been removed.
 				return tmp
@@ -111,10 +124,32 @@ func FinalizeLabels(dst, src []prompbmarshal.Label) []prompbmarshal.Label {
 
 // apply applies relabeling according to prc.
 //
+// It returns the updated labels and true if prc matches the labels.
+//
 // See https://prometheus.io/docs/prometheus/latest/configuration/configuration/#relabel_config
-func (prc *parsedRelabelConfig) apply(labels []prompbmarshal.Label, labelsOffset int) []prompbmarshal.Label {
+func (prc *parsedRelabelConfig) apply(labels []prompbmarshal.Label, labelsOffset int) ([]prompbmarshal.Label, bool) {
 	src := labels[labelsOffset:]
 	switch prc.Action {
+	case "graphite":
+		metricName := GetLabelValueByName(src, "__name__")
+		gm := graphiteMatchesPool.Get().(*graphiteMatches)
+		var ok bool
+		gm.a, ok = prc.graphiteMatchTemplate.Match(gm.a[:0], metricName)
+		if !ok {
+			// Fast path - name mismatch
+			graphiteMatchesPool.Put(gm)
+			return labels, false
+		}
+		// Slow path - extract labels from graphite metric name
+		bb := relabelBufPool.Get()
+		for _, gl := range prc.graphiteLabelRules {
+			bb.B = gl.grTemplate.Expand(bb.B[:0], gm.a)
+			valueStr := string(bb.B)
+			labels = setLabelValue(labels, labelsOffset, gl.grLabelName, valueStr)
+		}
+		relabelBufPool.Put(bb)
+		graphiteMatchesPool.Put(gm)
+		return labels, true
 	case "replace":
 		bb := relabelBufPool.Get()
 		bb.B = concatLabelValues(bb.B[:0], src, prc.SourceLabels, prc.Separator)
@@ -125,7 +160,7 @@ func (prc *parsedRelabelConfig) apply(labels []prompbmarshal.Label, labelsOffset
 				//   target_label: foobar
 				valueStr := string(bb.B)
 				relabelBufPool.Put(bb)
-				return setLabelValue(labels, labelsOffset, prc.TargetLabel, valueStr)
+				return setLabelValue(labels, labelsOffset, prc.TargetLabel, valueStr), true
 			}
 			if !prc.hasCaptureGroupInReplacement {
 				// Fast path for the rule that sets label value:
@@ -133,14 +168,14 @@ func (prc *parsedRelabelConfig) apply(labels []prompbmarshal.Label, labelsOffset
 				//   replacement: something-here
 				relabelBufPool.Put(bb)
 				labels = setLabelValue(labels, labelsOffset, prc.TargetLabel, prc.Replacement)
-				return labels
+				return labels, true
 			}
 		}
 		match := prc.Regex.FindSubmatchIndex(bb.B)
 		if match == nil {
 			// Fast path - nothing to replace.
 			relabelBufPool.Put(bb)
-			return labels
+			return labels, false
 		}
 		sourceStr := bytesutil.ToUnsafeString(bb.B)
 		nameStr := prc.TargetLabel
@@ -149,7 +184,7 @@ func (prc *parsedRelabelConfig) apply(labels []prompbmarshal.Label, labelsOffset
 		}
 		valueStr := prc.expandCaptureGroups(prc.Replacement, sourceStr, match)
 		relabelBufPool.Put(bb)
-		return setLabelValue(labels, labelsOffset, nameStr, valueStr)
+		return setLabelValue(labels, labelsOffset, nameStr, valueStr), true
 	case "replace_all":
 		bb := relabelBufPool.Get()
 		bb.B = concatLabelValues(bb.B[:0], src, prc.SourceLabels, prc.Separator)
@@ -159,7 +194,7 @@ func (prc *parsedRelabelConfig) apply(labels []prompbmarshal.Label, labelsOffset
 		if ok {
 			labels = setLabelValue(labels, labelsOffset, prc.TargetLabel, valueStr)
 		}
-		return labels
+		return labels, ok
 	case "keep_if_equal":
 		// Keep the entry if all the label values in source_labels are equal.
 		// For example:
@@ -169,9 +204,9 @@ func (prc *parsedRelabelConfig) apply(labels []prompbmarshal.Label, labelsOffset
 		//
 		// Would leave the entry if `foo` value equals `bar` value
 		if areEqualLabelValues(src, prc.SourceLabels) {
-			return labels
+			return labels, true
 		}
-		return labels[:labelsOffset]
+		return labels[:labelsOffset], false
 	case "drop_if_equal":
 		// Drop the entry if all the label values in source_labels are equal.
 		// For example:
@@ -181,49 +216,56 @@ func (prc *parsedRelabelConfig) apply(labels []prompbmarshal.Label, labelsOffset
 		//
 		// Would drop the entry if `foo` value equals `bar` value.
 		if areEqualLabelValues(src, prc.SourceLabels) {
-			return labels[:labelsOffset]
+			return labels[:labelsOffset], true
 		}
-		return labels
+		return labels, false
 	case "keep":
 		bb := relabelBufPool.Get()
 		bb.B = concatLabelValues(bb.B[:0], src, prc.SourceLabels, prc.Separator)
 		keep := prc.matchString(bytesutil.ToUnsafeString(bb.B))
 		relabelBufPool.Put(bb)
 		if !keep {
-			return labels[:labelsOffset]
+			return labels[:labelsOffset], false
 		}
-		return labels
+		return labels, true
 	case "drop":
 		bb := relabelBufPool.Get()
 		bb.B = concatLabelValues(bb.B[:0], src, prc.SourceLabels, prc.Separator)
 		drop := prc.matchString(bytesutil.ToUnsafeString(bb.B))
 		relabelBufPool.Put(bb)
 		if drop {
-			return labels[:labelsOffset]
+			return labels[:labelsOffset], true
 		}
-		return labels
+		return labels, false
 	case "hashmod":
 		bb := relabelBufPool.Get()
 		bb.B = concatLabelValues(bb.B[:0], src, prc.SourceLabels, prc.Separator)
 		h := xxhash.Sum64(bb.B) % prc.Modulus
 		value := strconv.Itoa(int(h))
 		relabelBufPool.Put(bb)
-		return setLabelValue(labels, labelsOffset, prc.TargetLabel, value)
+		return setLabelValue(labels, labelsOffset, prc.TargetLabel, value), true
 	case "labelmap":
+		matched := false
 		for i := range src {
 			label := &src[i]
 			labelName, ok := prc.replaceFullString(label.Name, prc.Replacement, prc.hasCaptureGroupInReplacement)
 			if ok {
 				labels = setLabelValue(labels, labelsOffset, labelName, label.Value)
+				matched = true
 			}
 		}
-		return labels
+		return labels, matched
 	case "labelmap_all":
+		matched := false
 		for i := range src {
 			label := &src[i]
-			label.Name, _ = prc.replaceStringSubmatches(label.Name, prc.Replacement, prc.hasCaptureGroupInReplacement)
+			var ok bool
+			label.Name, ok = prc.replaceStringSubmatches(label.Name, prc.Replacement, prc.hasCaptureGroupInReplacement)
+			if ok {
+				matched = true
+			}
 		}
-		return labels
+		return labels, matched
 	case "labeldrop":
 		keepSrc := true
 		for i := range src {
@@ -234,7 +276,7 @@ func (prc *parsedRelabelConfig) apply(labels []prompbmarshal.Label, labelsOffset
 			}
 		}
 		if keepSrc {
-			return labels
+			return labels, false
 		}
 		dst := labels[:labelsOffset]
 		for i := range src {
@@ -243,7 +285,7 @@ func (prc *parsedRelabelConfig) apply(labels []prompbmarshal.Label, labelsOffset
 				dst = append(dst, *label)
 			}
 		}
-		return dst
+		return dst, true
 	case "labelkeep":
 		keepSrc := true
 		for i := range src {
@@ -254,7 +296,7 @@ func (prc *parsedRelabelConfig) apply(labels []prompbmarshal.Label, labelsOffset
 			}
 		}
 		if keepSrc {
-			return labels
+			return labels, len(src) > 0
 		}
 		dst := labels[:labelsOffset]
 		for i := range src {
@@ -263,10 +305,10 @@ func (prc *parsedRelabelConfig) apply(labels []prompbmarshal.Label, labelsOffset
 				dst = append(dst, *label)
 			}
 		}
-		return dst
+		return dst, len(dst) > labelsOffset
 	default:
 		logger.Panicf("BUG: unknown `action`: %q", prc.Action)
-		return labels
+		return labels, false
 	}
 }
 
@@ -671,6 +671,48 @@ func TestApplyRelabelConfigs(t *testing.T) {
 			},
 		})
 	})
+	t.Run("graphite-match", func(t *testing.T) {
+		f(`
+- action: graphite
+  match: foo.*.baz
+  labels:
+    __name__: aaa
+    job: ${1}-zz
+`, []prompbmarshal.Label{
+			{
+				Name:  "__name__",
+				Value: "foo.bar.baz",
+			},
+		}, true, []prompbmarshal.Label{
+			{
+				Name:  "__name__",
+				Value: "aaa",
+			},
+			{
+				Name:  "job",
+				Value: "bar-zz",
+			},
+		})
+	})
+	t.Run("graphite-mismatch", func(t *testing.T) {
+		f(`
+- action: graphite
+  match: foo.*.baz
+  labels:
+    __name__: aaa
+    job: ${1}-zz
+`, []prompbmarshal.Label{
+			{
+				Name:  "__name__",
+				Value: "foo.bar.bazz",
+			},
+		}, true, []prompbmarshal.Label{
+			{
+				Name:  "__name__",
+				Value: "foo.bar.bazz",
+			},
+		})
+	})
 	t.Run("labeldrop", func(t *testing.T) {
 		f(`
 - action: labeldrop
@@ -837,6 +879,63 @@ func TestApplyRelabelConfigs(t *testing.T) {
 	})
 }
 
+func TestApplyCountMatches(t *testing.T) {
+	f := func(config string, labels []prompbmarshal.Label, matchesExpected []uint64) {
+		t.Helper()
+		pcs, err := ParseRelabelConfigsData([]byte(config))
+		if err != nil {
+			t.Fatalf("cannot parse %q: %s", config, err)
+		}
+		matches := make([]uint64, pcs.Len())
+		pcs.ApplyCountMatches(labels, 0, true, matches)
+		if !reflect.DeepEqual(matches, matchesExpected) {
+			t.Fatalf("unexpected matches; got\n%v\nwant\n%v", matches, matchesExpected)
+		}
+	}
+	labels := func() []prompbmarshal.Label {
+		return []prompbmarshal.Label{
+			{
+				Name:  "__name__",
+				Value: "foo",
+			},
+			{
+				Name:  "job",
+				Value: "bar",
+			},
+		}
+	}
+	f(`
+- action: keep
+  source_labels: [job]
+  regex: bar
+- action: replace
+  source_labels: [job]
+  regex: "baz"
+  target_label: x
+- action: labeldrop
+  regex: "instance"
+- action: labelmap
+  regex: "j(.+)"
+  replacement: "x_$1"
+`, labels(), []uint64{1, 0, 0, 1})
+
+	// Rules after the dropping rule aren't applied.
+	f(`
+- action: drop_if_equal
+  source_labels: [job, job]
+- action: keep
+  source_labels: [job]
+  regex: bar
+`, labels(), []uint64{1, 0})
+	f(`
+- action: keep_if_equal
+  source_labels: [__name__, job]
+- action: drop
+  source_labels: [job]
+  regex: bar
+`, labels(), []uint64{0, 0})
+}
+
 func TestFinalizeLabels(t *testing.T) {
 	f := func(labels, resultExpected []prompbmarshal.Label) {
 		t.Helper()
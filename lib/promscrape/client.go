@@ -1,12 +1,15 @@
 package promscrape
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"strings"
@@ -15,13 +18,21 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/common"
 	"github.com/VictoriaMetrics/fasthttp"
 	"github.com/VictoriaMetrics/metrics"
+	"golang.org/x/net/http2"
 )
 
 var (
 	maxScrapeSize = flagutil.NewBytes("promscrape.maxScrapeSize", 16*1024*1024, "The maximum size of scrape response in bytes to process from Prometheus targets. "+
 		"Bigger responses are rejected")
+	maxUnpackedScrapeSize = flagutil.NewBytes("promscrape.maxUnpackedScrapeSize", 0, "The maximum size of gzip-unpacked scrape response in bytes to process from Prometheus targets. "+
+		"Bigger responses are rejected. By default the limit equals to -promscrape.maxScrapeSize. This protects from targets returning too big compressed responses")
+	strictContentType = flag.Bool("promscrape.strictContentType", false, "Whether to reject scrape responses with Content-Type header other than "+
+		"'text/plain' or 'application/openmetrics-text'. This protects from parsing HTML error pages and other non-metrics responses as metrics. "+
+		"Responses without Content-Type header are accepted")
 	disableCompression = flag.Bool("promscrape.disableCompression", false, "Whether to disable sending 'Accept-Encoding: gzip' request headers to all the scrape targets. "+
 		"This may reduce CPU usage on scrape targets at the cost of higher network bandwidth utilization. "+
 		"It is possible to set 'disable_compression: true' individually per each 'scrape_config' section in '-promscrape.config' for fine grained control")
@@ -40,14 +51,16 @@ type client struct {
 
 	// sc (aka `stream client`) is used instead of hc if ScrapeWork.ParseStream is set.
 	// It may be useful for scraping targets with millions of metrics per target.
+	// sc is also used for all the requests if ScrapeWork.EnableHTTP2 is set.
 	sc *http.Client
 
 	scrapeURL          string
 	host               string
 	requestURI         string
-	authHeader         string
+	authConfig         *promauth.Config
 	disableCompression bool
 	disableKeepAlive   bool
+	enableHTTP2        bool
 }
 
 func newClient(sw *ScrapeWork) *client {
@@ -67,7 +80,7 @@ func newClient(sw *ScrapeWork) *client {
 			host += ":443"
 		}
 	}
-	dialFunc, err := newStatDialFunc(sw.ProxyURL, tlsCfg)
+	dialFunc, err := newStatDialFunc(sw.ProxyURL, tlsCfg, sw.UnixSocketPath)
 	if err != nil {
 		logger.Fatalf("cannot create dial func: %s", err)
 	}
@@ -84,7 +97,13 @@ func newClient(sw *ScrapeWork) *client {
 		MaxIdempotentRequestAttempts: 1,
 	}
 	var sc *http.Client
-	if *streamParse || sw.StreamParse {
+	if sw.EnableHTTP2 {
+		// fasthttp doesn't support HTTP/2, so use net/http client for all the requests.
+		sc = &http.Client{
+			Transport: newHTTP2Transport(tlsCfg, isTLS, sw.UnixSocketPath, *disableCompression || sw.DisableCompression),
+			Timeout:   sw.ScrapeTimeout,
+		}
+	} else if *streamParse || sw.StreamParse {
 		var proxy func(*http.Request) (*url.URL, error)
 		if proxyURL := sw.ProxyURL.URL(); proxyURL != nil {
 			proxy = http.ProxyURL(proxyURL)
@@ -97,7 +116,7 @@ func newClient(sw *ScrapeWork) *client {
 				IdleConnTimeout:     2 * sw.ScrapeInterval,
 				DisableCompression:  *disableCompression || sw.DisableCompression,
 				DisableKeepAlives:   *disableKeepAlive || sw.DisableKeepAlive,
-				DialContext:         statStdDial,
+				DialContext:         newStatStdDialFunc(sw.UnixSocketPath),
 			},
 			Timeout: sw.ScrapeTimeout,
 		}
@@ -108,9 +127,41 @@ func newClient(sw *ScrapeWork) *client {
 		scrapeURL:          sw.ScrapeURL,
 		host:               host,
 		requestURI:         requestURI,
-		authHeader:         sw.AuthConfig.Authorization,
+		authConfig:         sw.AuthConfig,
 		disableCompression: sw.DisableCompression,
 		disableKeepAlive:   sw.DisableKeepAlive,
+		enableHTTP2:        sw.EnableHTTP2,
+	}
+}
+
+// newHTTP2Transport returns HTTP/2 transport for scraping targets.
+//
+// Plaintext HTTP/2 (aka h2c) is used if isTLS is false.
+func newHTTP2Transport(tlsCfg *tls.Config, isTLS bool, unixSocketPath string, disableCompression bool) *http2.Transport {
+	dial := newStatStdDialFunc(unixSocketPath)
+	return &http2.Transport{
+		TLSClientConfig:    tlsCfg,
+		AllowHTTP:          !isTLS,
+		DisableCompression: disableCompression,
+		DialTLS: func(network, addr string, cfg *tls.Config) (net.Conn, error) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			conn, err := dial(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			if !isTLS {
+				return conn, nil
+			}
+			tlsConn := tls.Client(conn, cfg)
+			_ = tlsConn.SetDeadline(time.Now().Add(10 * time.Second))
+			if err := tlsConn.Handshake(); err != nil {
+				_ = tlsConn.Close()
+				return nil, fmt.Errorf("cannot perform TLS handshake with %q: %w", addr, err)
+			}
+			_ = tlsConn.SetDeadline(time.Time{})
+			return tlsConn, nil
+		},
 	}
 }
 
@@ -128,8 +179,8 @@ func (c *client) GetStreamReader() (*streamReader, error) {
 	// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/608 for details.
 	// Do not bloat the `Accept` header with OpenMetrics shit, since it looks like dead standard now.
 	req.Header.Set("Accept", "text/plain;version=0.0.4;q=1,*/*;q=0.1")
-	if c.authHeader != "" {
-		req.Header.Set("Authorization", c.authHeader)
+	if ah := c.authConfig.GetAuthHeader(); ah != "" {
+		req.Header.Set("Authorization", ah)
 	}
 	resp, err := c.sc.Do(req)
 	if err != nil {
@@ -141,8 +192,12 @@ func (c *client) GetStreamReader() (*streamReader, error) {
 		respBody, _ := ioutil.ReadAll(resp.Body)
 		_ = resp.Body.Close()
 		cancel()
-		return nil, fmt.Errorf("unexpected status code returned when scraping %q: %d; expecting %d; response body: %q",
-			c.scrapeURL, resp.StatusCode, http.StatusOK, respBody)
+		return nil, newStatusCodeError(c.scrapeURL, resp.StatusCode, respBody)
+	}
+	if err := c.checkContentType(resp.Header.Get("Content-Type")); err != nil {
+		_ = resp.Body.Close()
+		cancel()
+		return nil, err
 	}
 	scrapesOK.Inc()
 	return &streamReader{
@@ -152,6 +207,9 @@ func (c *client) GetStreamReader() (*streamReader, error) {
 }
 
 func (c *client) ReadData(dst []byte) ([]byte, error) {
+	if c.enableHTTP2 {
+		return c.readDataStd(dst)
+	}
 	deadline := time.Now().Add(c.hc.ReadTimeout)
 	req := fasthttp.AcquireRequest()
 	req.SetRequestURI(c.requestURI)
@@ -168,8 +226,8 @@ func (c *client) ReadData(dst []byte) ([]byte, error) {
 	if *disableKeepAlive || c.disableKeepAlive {
 		req.SetConnectionClose()
 	}
-	if c.authHeader != "" {
-		req.Header.Set("Authorization", c.authHeader)
+	if ah := c.authConfig.GetAuthHeader(); ah != "" {
+		req.Header.Set("Authorization", ah)
 	}
 	resp := fasthttp.AcquireResponse()
 	swapResponseBodies := len(dst) == 0
@@ -201,8 +259,9 @@ func (c *client) ReadData(dst []byte) ([]byte, error) {
 			return dst, fmt.Errorf("error when scraping %q with timeout %s: %w", c.scrapeURL, c.hc.ReadTimeout, err)
 		}
 		if err == fasthttp.ErrBodyTooLarge {
-			return dst, fmt.Errorf("the response from %q exceeds -promscrape.maxScrapeSize=%d; "+
+			err = fmt.Errorf("the response from %q exceeds -promscrape.maxScrapeSize=%d; "+
 				"either reduce the response size for the target or increase -promscrape.maxScrapeSize", c.scrapeURL, maxScrapeSize.N)
+			return dst, newScrapeError(scrapeErrorReasonResponseTooLarge, err)
 		}
 		return dst, fmt.Errorf("error when scraping %q: %w", c.scrapeURL, err)
 	}
@@ -210,31 +269,117 @@ func (c *client) ReadData(dst []byte) ([]byte, error) {
 		var err error
 		if swapResponseBodies {
 			zb := gunzipBufPool.Get()
-			zb.B, err = fasthttp.AppendGunzipBytes(zb.B[:0], dst)
+			zb.B, err = appendGunzipBytes(zb.B[:0], dst)
 			dst = append(dst[:0], zb.B...)
 			gunzipBufPool.Put(zb)
 		} else {
-			dst, err = fasthttp.AppendGunzipBytes(dst, resp.Body())
+			dst, err = appendGunzipBytes(dst, resp.Body())
+		}
+		if err == errUnpackedBodyTooLarge {
+			fasthttp.ReleaseResponse(resp)
+			scrapesUnpackedTooLarge.Inc()
+			err = fmt.Errorf("the unpacked response from %q exceeds -promscrape.maxUnpackedScrapeSize=%d; "+
+				"either reduce the response size for the target or increase -promscrape.maxUnpackedScrapeSize", c.scrapeURL, getMaxUnpackedScrapeSize())
+			return dst, newScrapeError(scrapeErrorReasonResponseTooLarge, err)
 		}
 		if err != nil {
 			fasthttp.ReleaseResponse(resp)
 			scrapesGunzipFailed.Inc()
-			return dst, fmt.Errorf("cannot ungzip response from %q: %w", c.scrapeURL, err)
+			return dst, newScrapeError(scrapeErrorReasonGzip, fmt.Errorf("cannot ungzip response from %q: %w", c.scrapeURL, err))
 		}
 		scrapesGunzipped.Inc()
 	} else if !swapResponseBodies {
 		dst = append(dst, resp.Body()...)
 	}
+	contentType := string(resp.Header.ContentType())
 	fasthttp.ReleaseResponse(resp)
 	if statusCode != fasthttp.StatusOK {
 		metrics.GetOrCreateCounter(fmt.Sprintf(`vm_promscrape_scrapes_total{status_code="%d"}`, statusCode)).Inc()
-		return dst, fmt.Errorf("unexpected status code returned when scraping %q: %d; expecting %d; response body: %q",
-			c.scrapeURL, statusCode, fasthttp.StatusOK, dst)
+		return dst, newStatusCodeError(c.scrapeURL, statusCode, dst)
+	}
+	if err := c.checkContentType(contentType); err != nil {
+		return dst, err
 	}
 	scrapesOK.Inc()
 	return dst, nil
 }
 
+// readDataStd appends the response from c.scrapeURL obtained via c.sc to dst and returns the result.
+func (c *client) readDataStd(dst []byte) ([]byte, error) {
+	sr, err := c.GetStreamReader()
+	if err != nil {
+		return dst, err
+	}
+	defer sr.MustClose()
+	bb := bytesutil.ByteBuffer{
+		B: dst,
+	}
+	n, err := bb.ReadFrom(io.LimitReader(sr, int64(maxScrapeSize.N)+1))
+	if err != nil {
+		return bb.B, fmt.Errorf("cannot read response from %q: %w", c.scrapeURL, err)
+	}
+	if n > int64(maxScrapeSize.N) {
+		err = fmt.Errorf("the response from %q exceeds -promscrape.maxScrapeSize=%d; "+
+			"either reduce the response size for the target or increase -promscrape.maxScrapeSize", c.scrapeURL, maxScrapeSize.N)
+		return bb.B, newScrapeError(scrapeErrorReasonResponseTooLarge, err)
+	}
+	return bb.B, nil
+}
+
+// checkContentType returns an error if -promscrape.strictContentType is set and the contentType isn't supported.
+func (c *client) checkContentType(contentType string) error {
+	if !*strictContentType || isSupportedContentType(contentType) {
+		return nil
+	}
+	scrapesInvalidContentType.Inc()
+	err := fmt.Errorf("unsupported Content-Type returned when scraping %q: %q; expecting 'text/plain' or 'application/openmetrics-text'; "+
+		"see -promscrape.strictContentType", c.scrapeURL, contentType)
+	return newScrapeError(scrapeErrorReasonInvalidContentType, err)
+}
+
+func isSupportedContentType(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	if n := strings.IndexByte(contentType, ';'); n >= 0 {
+		contentType = contentType[:n]
+	}
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	return contentType == "text/plain" || contentType == "application/openmetrics-text"
+}
+
+var errUnpackedBodyTooLarge = errors.New("too big unpacked body")
+
+func getMaxUnpackedScrapeSize() int {
+	if n := maxUnpackedScrapeSize.N; n > 0 {
+		return n
+	}
+	return maxScrapeSize.N
+}
+
+// appendGunzipBytes appends gunzipped src to dst and returns the result.
+//
+// errUnpackedBodyTooLarge is returned if the unpacked src exceeds -promscrape.maxUnpackedScrapeSize.
+func appendGunzipBytes(dst, src []byte) ([]byte, error) {
+	zr, err := common.GetGzipReader(bytes.NewReader(src))
+	if err != nil {
+		return dst, err
+	}
+	defer common.PutGzipReader(zr)
+	maxSize := getMaxUnpackedScrapeSize()
+	bb := bytesutil.ByteBuffer{
+		B: dst,
+	}
+	n, err := bb.ReadFrom(io.LimitReader(zr, int64(maxSize)+1))
+	if err != nil {
+		return bb.B, err
+	}
+	if n > int64(maxSize) {
+		return bb.B, errUnpackedBodyTooLarge
+	}
+	return bb.B, nil
+}
+
 var gunzipBufPool bytesutil.ByteBufferPool
 
 var (
@@ -243,6 +388,9 @@ var (
 	scrapesGunzipped    = metrics.NewCounter(`vm_promscrape_scrapes_gunziped_total`)
 	scrapesGunzipFailed = metrics.NewCounter(`vm_promscrape_scrapes_gunzip_failed_total`)
 	scrapeRetries       = metrics.NewCounter(`vm_promscrape_scrape_retries_total`)
+
+	scrapesUnpackedTooLarge   = metrics.NewCounter(`vm_promscrape_scrapes_unpacked_too_large_total`)
+	scrapesInvalidContentType = metrics.NewCounter(`vm_promscrape_scrapes_invalid_content_type_total`)
 )
 
 func doRequestWithPossibleRetry(hc *fasthttp.HostClient, req *fasthttp.Request, resp *fasthttp.Response, deadline time.Time) error {
@@ -0,0 +1,65 @@
+package promscrape
+
+import (
+	"bytes"
+	"compress/gzip"
+	"testing"
+)
+
+func TestIsSupportedContentType(t *testing.T) {
+	f := func(contentType string, resultExpected bool) {
+		t.Helper()
+		result := isSupportedContentType(contentType)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for isSupportedContentType(%q); got %v; want %v", contentType, result, resultExpected)
+		}
+	}
+	f("", true)
+	f("text/plain", true)
+	f("text/plain; version=0.0.4", true)
+	f("Text/Plain;charset=utf-8", true)
+	f("application/openmetrics-text; version=1.0.0; charset=utf-8", true)
+	f("text/html", false)
+	f("text/html; charset=utf-8", false)
+	f("application/json", false)
+	f("text/plainx", false)
+}
+
+func TestAppendGunzipBytes(t *testing.T) {
+	origMaxUnpackedScrapeSize := maxUnpackedScrapeSize.N
+	defer func() {
+		maxUnpackedScrapeSize.N = origMaxUnpackedScrapeSize
+	}()
+
+	var bb bytes.Buffer
+	zw := gzip.NewWriter(&bb)
+	data := bytes.Repeat([]byte("foo 123\n"), 100)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatalf("cannot compress data: %s", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("cannot close gzip writer: %s", err)
+	}
+	src := bb.Bytes()
+
+	// The unpacked data fits the limit.
+	maxUnpackedScrapeSize.N = len(data)
+	dst, err := appendGunzipBytes([]byte("prefix"), src)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if !bytes.Equal(dst, append([]byte("prefix"), data...)) {
+		t.Fatalf("unexpected unpacked data; got %q", dst)
+	}
+
+	// The unpacked data exceeds the limit.
+	maxUnpackedScrapeSize.N = len(data) - 1
+	if _, err := appendGunzipBytes(nil, src); err != errUnpackedBodyTooLarge {
+		t.Fatalf("unexpected error; got %v; want %v", err, errUnpackedBodyTooLarge)
+	}
+
+	// Invalid gzip data.
+	if _, err := appendGunzipBytes(nil, []byte("foobar")); err == nil {
+		t.Fatalf("expecting non-nil error for invalid gzip data")
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape/discovery/gce"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape/discovery/kubernetes"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape/discovery/openstack"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape/discoveryutils"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/proxy"
 	"github.com/VictoriaMetrics/metrics"
 	"gopkg.in/yaml.v2"
@@ -30,11 +31,16 @@ import (
 
 var (
 	strictParse = flag.Bool("promscrape.config.strictParse", false, "Whether to allow only supported fields in -promscrape.config . "+
-		"By default unsupported fields are silently skipped")
+		"By default unsupported fields are silently skipped. See also -promscrape.config.reportUnsupportedFields")
+	reportUnsupportedFields = flag.Bool("promscrape.config.reportUnsupportedFields", false, "Whether to log a warning with `job_name` and YAML path "+
+		"for every unsupported field found in -promscrape.config . This may be useful for validating Prometheus configs when migrating from Prometheus. "+
+		"Combine it with -promscrape.config.dryRun for checking the config without starting scrapers")
 	dryRun = flag.Bool("promscrape.config.dryRun", false, "Checks -promscrape.config file for errors and unsupported fields and then exits. "+
 		"Returns non-zero exit code on parsing errors and emits these errors to stderr. "+
 		"See also -promscrape.config.strictParse command-line flag. "+
 		"Pass -loggerLevel=ERROR if you don't need to see info messages in the output.")
+	strictEnv = flag.Bool("promscrape.config.strictEnv", false, "Whether to fail loading -promscrape.config and files referred by it if they contain '%{ENV_VAR}' or '${ENV_VAR}' placeholders "+
+		"for missing env vars without defaults. By default such placeholders are left as is. See https://victoriametrics.github.io/vmagent.html#environment-variables-in-configs")
 	dropOriginalLabels = flag.Bool("promscrape.dropOriginalLabels", false, "Whether to drop original labels for scrape targets at /targets and /api/v1/targets pages. "+
 		"This may be needed for reducing memory usage when original labels for big number of scrape targets occupy big amounts of memory. "+
 		"Note that this reduces debuggability for improper per-target relabeling configs")
@@ -45,8 +51,17 @@ type Config struct {
 	Global        GlobalConfig   `yaml:"global"`
 	ScrapeConfigs []ScrapeConfig `yaml:"scrape_configs"`
 
+	// ProbeConfigs contains configs for the built-in probers. They are supported only by lib/promscrape.
+	ProbeConfigs []ProbeConfig `yaml:"probe_configs,omitempty"`
+
+	// KubernetesCRDConfigs contains configs for discovering scrape jobs from prometheus-operator CRDs. They are supported only by lib/promscrape.
+	KubernetesCRDConfigs []*kubernetes.CRDConfig `yaml:"kubernetes_crd_configs,omitempty"`
+
 	// This is set to the directory from where the config has been loaded.
 	baseDir string
+
+	// crd holds the state for KubernetesCRDConfigs between getKubernetesCRDScrapeWork calls.
+	crd crdState
 }
 
 // GlobalConfig represents essential parts for `global` section of Prometheus config.
@@ -93,10 +108,23 @@ type ScrapeConfig struct {
 	DisableCompression  bool          `yaml:"disable_compression,omitempty"`
 	DisableKeepAlive    bool          `yaml:"disable_keepalive,omitempty"`
 	StreamParse         bool          `yaml:"stream_parse,omitempty"`
+	EnableHTTP2         bool          `yaml:"enable_http2,omitempty"`
 	ScrapeAlignInterval time.Duration `yaml:"scrape_align_interval,omitempty"`
 
+	// PruneMetaLabels enables dropping `__meta_*` labels, which aren't referenced by `relabel_configs`, from discovered targets.
+	PruneMetaLabels bool `yaml:"prune_meta_labels,omitempty"`
+
+	// ExtraLabels are added to all the targets of the `scrape_config` after relabeling.
+	ExtraLabels map[string]string `yaml:"extra_labels,omitempty"`
+
+	// MetricNormalization contains optional rules for renaming scraped metrics before `metric_relabel_configs`.
+	MetricNormalization *MetricNormalizationConfig `yaml:"metric_normalization,omitempty"`
+
 	// This is set in loadConfig
 	swc *scrapeWorkConfig
+
+	// This is set for `probe_configs` entries in loadConfig
+	probe *ProbeOptions
 }
 
 // FileSDConfig represents file-based service discovery config.
@@ -120,7 +148,10 @@ func loadStaticConfigs(path string) ([]StaticConfig, error) {
 	if err != nil {
 		return nil, fmt.Errorf("cannot read `static_configs` from %q: %w", path, err)
 	}
-	data = envtemplate.Replace(data)
+	data, err = expandEnvVars(data)
+	if err != nil {
+		return nil, fmt.Errorf("cannot expand env vars in %q: %w", path, err)
+	}
 	var stcs []StaticConfig
 	if err := yaml.UnmarshalStrict(data, &stcs); err != nil {
 		return nil, fmt.Errorf("cannot unmarshal `static_configs` from %q: %w", path, err)
@@ -141,12 +172,107 @@ func loadConfig(path string) (cfg *Config, data []byte, err error) {
 	return &cfgObj, data, nil
 }
 
+// loadConfigs loads Prometheus configs from the given paths and merges them into a single config.
+//
+// Every path may contain glob patterns such as `/etc/vmagent/conf.d/*.yml`.
+// The `global` section from every file is applied only to `scrape_configs` from the same file.
+// `job_name` values must be unique across all the loaded files.
+func loadConfigs(paths []string) (cfg *Config, data []byte, err error) {
+	files, err := getConfigFiles(paths)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(files) == 1 {
+		return loadConfig(files[0])
+	}
+	var cfgObj Config
+	jobFiles := make(map[string]string)
+	for i, path := range files {
+		cfgLocal, dataLocal, err := loadConfig(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		for j := range cfgLocal.ScrapeConfigs {
+			jobName := cfgLocal.ScrapeConfigs[j].JobName
+			if prevPath, ok := jobFiles[jobName]; ok && prevPath != path {
+				return nil, nil, fmt.Errorf("duplicate `job_name` %q found in Prometheus configs %q and %q; `job_name` must be unique across all the configs",
+					jobName, prevPath, path)
+			}
+			jobFiles[jobName] = path
+		}
+		if i == 0 {
+			cfgObj.Global = cfgLocal.Global
+			cfgObj.baseDir = cfgLocal.baseDir
+		}
+		cfgObj.ScrapeConfigs = append(cfgObj.ScrapeConfigs, cfgLocal.ScrapeConfigs...)
+		cfgObj.KubernetesCRDConfigs = append(cfgObj.KubernetesCRDConfigs, cfgLocal.KubernetesCRDConfigs...)
+		// Include file paths into data, so adding, removing or renaming of config files is detected as a config change.
+		data = append(data, "# "...)
+		data = append(data, path...)
+		data = append(data, '\n')
+		data = append(data, dataLocal...)
+		data = append(data, '\n')
+	}
+	return &cfgObj, data, nil
+}
+
+// getConfigFiles returns config file paths for the given paths after expanding glob patterns.
+func getConfigFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		if !strings.ContainsAny(path, "*?[") {
+			files = append(files, path)
+			continue
+		}
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid glob pattern %q: %w", path, err)
+		}
+		// Glob returns matches in lexical order, so the merged config doesn't depend on the order of files in the directory.
+		files = append(files, matches...)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("cannot find Prometheus configs at %q", paths)
+	}
+	return files, nil
+}
+
+// FindUnsupportedFields returns unsupported fields from -promscrape.config files.
+//
+// Every returned entry contains the path to the config file together with the unsupported field.
+func FindUnsupportedFields() ([]string, error) {
+	files, err := getConfigFiles(*promscrapeConfigFiles)
+	if err != nil {
+		return nil, err
+	}
+	var a []string
+	for _, path := range files {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read Prometheus config from %q: %w", path, err)
+		}
+		ufs, err := findUnsupportedFields(data)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse Prometheus config from %q: %w", path, err)
+		}
+		for i := range ufs {
+			a = append(a, fmt.Sprintf("file=%q, %s", path, &ufs[i]))
+		}
+	}
+	return a, nil
+}
+
 // IsDryRun returns true if -promscrape.config.dryRun command-line flag is set
 func IsDryRun() bool {
 	return *dryRun
 }
 
 func (cfg *Config) parse(data []byte, path string) error {
+	if *strictParse || *reportUnsupportedFields {
+		if err := checkUnsupportedFields(data, path); err != nil {
+			return err
+		}
+	}
 	if err := unmarshalMaybeStrict(data, cfg); err != nil {
 		return fmt.Errorf("cannot unmarshal data: %w", err)
 	}
@@ -155,6 +281,14 @@ func (cfg *Config) parse(data []byte, path string) error {
 		return fmt.Errorf("cannot obtain abs path for %q: %w", path, err)
 	}
 	cfg.baseDir = filepath.Dir(absPath)
+	// Probe configs are processed in the same way as scrape configs, so they support all the service discovery and relabeling options.
+	for i := range cfg.ProbeConfigs {
+		sc, err := cfg.ProbeConfigs[i].getScrapeConfig()
+		if err != nil {
+			return fmt.Errorf("cannot parse `probe_config` #%d: %w", i+1, err)
+		}
+		cfg.ScrapeConfigs = append(cfg.ScrapeConfigs, *sc)
+	}
 	for i := range cfg.ScrapeConfigs {
 		sc := &cfg.ScrapeConfigs[i]
 		swc, err := getScrapeWorkConfig(sc, cfg.baseDir, &cfg.Global)
@@ -163,12 +297,54 @@ func (cfg *Config) parse(data []byte, path string) error {
 		}
 		sc.swc = swc
 	}
+	for i, cc := range cfg.KubernetesCRDConfigs {
+		if cc == nil {
+			return fmt.Errorf("`kubernetes_crd_config` #%d cannot be empty", i+1)
+		}
+		if err := cc.Validate(); err != nil {
+			return fmt.Errorf("cannot parse `kubernetes_crd_config` #%d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// checkUnsupportedFields reports unsupported fields in Prometheus config data loaded from the given path.
+//
+// Unsupported fields are logged if -promscrape.config.reportUnsupportedFields is set.
+// An error listing all the unsupported fields is returned if -promscrape.config.strictParse is set.
+func checkUnsupportedFields(data []byte, path string) error {
+	ufs, err := findUnsupportedFields(data)
+	if err != nil {
+		return err
+	}
+	if len(ufs) == 0 {
+		return nil
+	}
+	if *reportUnsupportedFields {
+		for i := range ufs {
+			logger.Warnf("unsupported field in -promscrape.config=%q: %s", path, &ufs[i])
+		}
+	}
+	if *strictParse {
+		a := make([]string, len(ufs))
+		for i := range ufs {
+			a[i] = "{" + ufs[i].String() + "}"
+		}
+		return fmt.Errorf("found %d unsupported fields: %s; remove these fields or disable -promscrape.config.strictParse", len(ufs), strings.Join(a, ", "))
+	}
 	return nil
 }
 
+// expandEnvVars expands env var placeholders in data loaded from -promscrape.config or files referred by it.
+func expandEnvVars(data []byte) ([]byte, error) {
+	return envtemplate.Expand(data, *strictEnv)
+}
+
 func unmarshalMaybeStrict(data []byte, dst interface{}) error {
-	data = envtemplate.Replace(data)
-	var err error
+	data, err := expandEnvVars(data)
+	if err != nil {
+		return err
+	}
 	if *strictParse {
 		err = yaml.UnmarshalStrict(data, dst)
 	} else {
@@ -191,24 +367,28 @@ func (cfg *Config) getKubernetesSDScrapeWork(prev []*ScrapeWork) []*ScrapeWork {
 	dst := make([]*ScrapeWork, 0, len(prev))
 	for i := range cfg.ScrapeConfigs {
 		sc := &cfg.ScrapeConfigs[i]
+		if len(sc.KubernetesSDConfigs) == 0 {
+			continue
+		}
+		rs := discoveryutils.NewRefreshStatus("kubernetes_sd_configs", sc.swc.jobName)
 		dstLen := len(dst)
 		ok := true
 		for j := range sc.KubernetesSDConfigs {
 			sdc := &sc.KubernetesSDConfigs[j]
 			var okLocal bool
-			dst, okLocal = appendKubernetesScrapeWork(dst, sdc, cfg.baseDir, sc.swc)
+			dst, okLocal = appendKubernetesScrapeWork(dst, sdc, sc.swc.baseDir, sc.swc)
 			if ok {
 				ok = okLocal
 			}
 		}
-		if ok {
-			continue
-		}
-		swsPrev := swsPrevByJob[sc.swc.jobName]
-		if len(swsPrev) > 0 {
-			logger.Errorf("there were errors when discovering kubernetes targets for job %q, so preserving the previous targets", sc.swc.jobName)
-			dst = append(dst[:dstLen], swsPrev...)
+		if !ok {
+			swsPrev := swsPrevByJob[sc.swc.jobName]
+			if len(swsPrev) > 0 {
+				logger.Errorf("there were errors when discovering kubernetes targets for job %q, so preserving the previous targets", sc.swc.jobName)
+				dst = append(dst[:dstLen], swsPrev...)
+			}
 		}
+		rs.Finish(len(dst)-dstLen, ok)
 	}
 	return dst
 }
@@ -219,24 +399,28 @@ func (cfg *Config) getOpenStackSDScrapeWork(prev []*ScrapeWork) []*ScrapeWork {
 	dst := make([]*ScrapeWork, 0, len(prev))
 	for i := range cfg.ScrapeConfigs {
 		sc := &cfg.ScrapeConfigs[i]
+		if len(sc.OpenStackSDConfigs) == 0 {
+			continue
+		}
+		rs := discoveryutils.NewRefreshStatus("openstack_sd_configs", sc.swc.jobName)
 		dstLen := len(dst)
 		ok := true
 		for j := range sc.OpenStackSDConfigs {
 			sdc := &sc.OpenStackSDConfigs[j]
 			var okLocal bool
-			dst, okLocal = appendOpenstackScrapeWork(dst, sdc, cfg.baseDir, sc.swc)
+			dst, okLocal = appendOpenstackScrapeWork(dst, sdc, sc.swc.baseDir, sc.swc)
 			if ok {
 				ok = okLocal
 			}
 		}
-		if ok {
-			continue
-		}
-		swsPrev := swsPrevByJob[sc.swc.jobName]
-		if len(swsPrev) > 0 {
-			logger.Errorf("there were errors when discovering openstack targets for job %q, so preserving the previous targets", sc.swc.jobName)
-			dst = append(dst[:dstLen], swsPrev...)
+		if !ok {
+			swsPrev := swsPrevByJob[sc.swc.jobName]
+			if len(swsPrev) > 0 {
+				logger.Errorf("there were errors when discovering openstack targets for job %q, so preserving the previous targets", sc.swc.jobName)
+				dst = append(dst[:dstLen], swsPrev...)
+			}
 		}
+		rs.Finish(len(dst)-dstLen, ok)
 	}
 	return dst
 }
@@ -247,24 +431,28 @@ func (cfg *Config) getDockerSwarmSDScrapeWork(prev []*ScrapeWork) []*ScrapeWork
 	dst := make([]*ScrapeWork, 0, len(prev))
 	for i := range cfg.ScrapeConfigs {
 		sc := &cfg.ScrapeConfigs[i]
+		if len(sc.DockerSwarmConfigs) == 0 {
+			continue
+		}
+		rs := discoveryutils.NewRefreshStatus("dockerswarm_sd_configs", sc.swc.jobName)
 		dstLen := len(dst)
 		ok := true
 		for j := range sc.DockerSwarmConfigs {
 			sdc := &sc.DockerSwarmConfigs[j]
 			var okLocal bool
-			dst, okLocal = appendDockerSwarmScrapeWork(dst, sdc, cfg.baseDir, sc.swc)
+			dst, okLocal = appendDockerSwarmScrapeWork(dst, sdc, sc.swc.baseDir, sc.swc)
 			if ok {
 				ok = okLocal
 			}
 		}
-		if ok {
-			continue
-		}
-		swsPrev := swsPrevByJob[sc.swc.jobName]
-		if len(swsPrev) > 0 {
-			logger.Errorf("there were errors when discovering dockerswarm targets for job %q, so preserving the previous targets", sc.swc.jobName)
-			dst = append(dst[:dstLen], swsPrev...)
+		if !ok {
+			swsPrev := swsPrevByJob[sc.swc.jobName]
+			if len(swsPrev) > 0 {
+				logger.Errorf("there were errors when discovering dockerswarm targets for job %q, so preserving the previous targets", sc.swc.jobName)
+				dst = append(dst[:dstLen], swsPrev...)
+			}
 		}
+		rs.Finish(len(dst)-dstLen, ok)
 	}
 	return dst
 }
@@ -275,24 +463,28 @@ func (cfg *Config) getConsulSDScrapeWork(prev []*ScrapeWork) []*ScrapeWork {
 	dst := make([]*ScrapeWork, 0, len(prev))
 	for i := range cfg.ScrapeConfigs {
 		sc := &cfg.ScrapeConfigs[i]
+		if len(sc.ConsulSDConfigs) == 0 {
+			continue
+		}
+		rs := discoveryutils.NewRefreshStatus("consul_sd_configs", sc.swc.jobName)
 		dstLen := len(dst)
 		ok := true
 		for j := range sc.ConsulSDConfigs {
 			sdc := &sc.ConsulSDConfigs[j]
 			var okLocal bool
-			dst, okLocal = appendConsulScrapeWork(dst, sdc, cfg.baseDir, sc.swc)
+			dst, okLocal = appendConsulScrapeWork(dst, sdc, sc.swc.baseDir, sc.swc)
 			if ok {
 				ok = okLocal
 			}
 		}
-		if ok {
-			continue
-		}
-		swsPrev := swsPrevByJob[sc.swc.jobName]
-		if len(swsPrev) > 0 {
-			logger.Errorf("there were errors when discovering consul targets for job %q, so preserving the previous targets", sc.swc.jobName)
-			dst = append(dst[:dstLen], swsPrev...)
+		if !ok {
+			swsPrev := swsPrevByJob[sc.swc.jobName]
+			if len(swsPrev) > 0 {
+				logger.Errorf("there were errors when discovering consul targets for job %q, so preserving the previous targets", sc.swc.jobName)
+				dst = append(dst[:dstLen], swsPrev...)
+			}
 		}
+		rs.Finish(len(dst)-dstLen, ok)
 	}
 	return dst
 }
@@ -303,24 +495,28 @@ func (cfg *Config) getEurekaSDScrapeWork(prev []*ScrapeWork) []*ScrapeWork {
 	dst := make([]*ScrapeWork, 0, len(prev))
 	for i := range cfg.ScrapeConfigs {
 		sc := &cfg.ScrapeConfigs[i]
+		if len(sc.EurekaSDConfigs) == 0 {
+			continue
+		}
+		rs := discoveryutils.NewRefreshStatus("eureka_sd_configs", sc.swc.jobName)
 		dstLen := len(dst)
 		ok := true
 		for j := range sc.EurekaSDConfigs {
 			sdc := &sc.EurekaSDConfigs[j]
 			var okLocal bool
-			dst, okLocal = appendEurekaScrapeWork(dst, sdc, cfg.baseDir, sc.swc)
+			dst, okLocal = appendEurekaScrapeWork(dst, sdc, sc.swc.baseDir, sc.swc)
 			if ok {
 				ok = okLocal
 			}
 		}
-		if ok {
-			continue
-		}
-		swsPrev := swsPrevByJob[sc.swc.jobName]
-		if len(swsPrev) > 0 {
-			logger.Errorf("there were errors when discovering eureka targets for job %q, so preserving the previous targets", sc.swc.jobName)
-			dst = append(dst[:dstLen], swsPrev...)
+		if !ok {
+			swsPrev := swsPrevByJob[sc.swc.jobName]
+			if len(swsPrev) > 0 {
+				logger.Errorf("there were errors when discovering eureka targets for job %q, so preserving the previous targets", sc.swc.jobName)
+				dst = append(dst[:dstLen], swsPrev...)
+			}
 		}
+		rs.Finish(len(dst)-dstLen, ok)
 	}
 	return dst
 }
@@ -331,6 +527,10 @@ func (cfg *Config) getDNSSDScrapeWork(prev []*ScrapeWork) []*ScrapeWork {
 	dst := make([]*ScrapeWork, 0, len(prev))
 	for i := range cfg.ScrapeConfigs {
 		sc := &cfg.ScrapeConfigs[i]
+		if len(sc.DNSSDConfigs) == 0 {
+			continue
+		}
+		rs := discoveryutils.NewRefreshStatus("dns_sd_configs", sc.swc.jobName)
 		dstLen := len(dst)
 		ok := true
 		for j := range sc.DNSSDConfigs {
@@ -341,14 +541,14 @@ func (cfg *Config) getDNSSDScrapeWork(prev []*ScrapeWork) []*ScrapeWork {
 				ok = okLocal
 			}
 		}
-		if ok {
-			continue
-		}
-		swsPrev := swsPrevByJob[sc.swc.jobName]
-		if len(swsPrev) > 0 {
-			logger.Errorf("there were errors when discovering dns targets for job %q, so preserving the previous targets", sc.swc.jobName)
-			dst = append(dst[:dstLen], swsPrev...)
+		if !ok {
+			swsPrev := swsPrevByJob[sc.swc.jobName]
+			if len(swsPrev) > 0 {
+				logger.Errorf("there were errors when discovering dns targets for job %q, so preserving the previous targets", sc.swc.jobName)
+				dst = append(dst[:dstLen], swsPrev...)
+			}
 		}
+		rs.Finish(len(dst)-dstLen, ok)
 	}
 	return dst
 }
@@ -359,6 +559,10 @@ func (cfg *Config) getEC2SDScrapeWork(prev []*ScrapeWork) []*ScrapeWork {
 	dst := make([]*ScrapeWork, 0, len(prev))
 	for i := range cfg.ScrapeConfigs {
 		sc := &cfg.ScrapeConfigs[i]
+		if len(sc.EC2SDConfigs) == 0 {
+			continue
+		}
+		rs := discoveryutils.NewRefreshStatus("ec2_sd_configs", sc.swc.jobName)
 		dstLen := len(dst)
 		ok := true
 		for j := range sc.EC2SDConfigs {
@@ -369,14 +573,14 @@ func (cfg *Config) getEC2SDScrapeWork(prev []*ScrapeWork) []*ScrapeWork {
 				ok = okLocal
 			}
 		}
-		if ok {
-			continue
-		}
-		swsPrev := swsPrevByJob[sc.swc.jobName]
-		if len(swsPrev) > 0 {
-			logger.Errorf("there were errors when discovering ec2 targets for job %q, so preserving the previous targets", sc.swc.jobName)
-			dst = append(dst[:dstLen], swsPrev...)
+		if !ok {
+			swsPrev := swsPrevByJob[sc.swc.jobName]
+			if len(swsPrev) > 0 {
+				logger.Errorf("there were errors when discovering ec2 targets for job %q, so preserving the previous targets", sc.swc.jobName)
+				dst = append(dst[:dstLen], swsPrev...)
+			}
 		}
+		rs.Finish(len(dst)-dstLen, ok)
 	}
 	return dst
 }
@@ -387,6 +591,10 @@ func (cfg *Config) getGCESDScrapeWork(prev []*ScrapeWork) []*ScrapeWork {
 	dst := make([]*ScrapeWork, 0, len(prev))
 	for i := range cfg.ScrapeConfigs {
 		sc := &cfg.ScrapeConfigs[i]
+		if len(sc.GCESDConfigs) == 0 {
+			continue
+		}
+		rs := discoveryutils.NewRefreshStatus("gce_sd_configs", sc.swc.jobName)
 		dstLen := len(dst)
 		ok := true
 		for j := range sc.GCESDConfigs {
@@ -397,14 +605,14 @@ func (cfg *Config) getGCESDScrapeWork(prev []*ScrapeWork) []*ScrapeWork {
 				ok = okLocal
 			}
 		}
-		if ok {
-			continue
-		}
-		swsPrev := swsPrevByJob[sc.swc.jobName]
-		if len(swsPrev) > 0 {
-			logger.Errorf("there were errors when discovering gce targets for job %q, so preserving the previous targets", sc.swc.jobName)
-			dst = append(dst[:dstLen], swsPrev...)
+		if !ok {
+			swsPrev := swsPrevByJob[sc.swc.jobName]
+			if len(swsPrev) > 0 {
+				logger.Errorf("there were errors when discovering gce targets for job %q, so preserving the previous targets", sc.swc.jobName)
+				dst = append(dst[:dstLen], swsPrev...)
+			}
 		}
+		rs.Finish(len(dst)-dstLen, ok)
 	}
 	return dst
 }
@@ -424,10 +632,21 @@ func (cfg *Config) getFileSDScrapeWork(prev []*ScrapeWork) []*ScrapeWork {
 	dst := make([]*ScrapeWork, 0, len(prev))
 	for i := range cfg.ScrapeConfigs {
 		sc := &cfg.ScrapeConfigs[i]
+		if len(sc.FileSDConfigs) == 0 {
+			continue
+		}
+		rs := discoveryutils.NewRefreshStatus("file_sd_configs", sc.swc.jobName)
+		dstLen := len(dst)
+		ok := true
 		for j := range sc.FileSDConfigs {
 			sdc := &sc.FileSDConfigs[j]
-			dst = sdc.appendScrapeWork(dst, swsMapPrev, cfg.baseDir, sc.swc)
+			var okLocal bool
+			dst, okLocal = sdc.appendScrapeWork(dst, swsMapPrev, sc.swc.baseDir, sc.swc)
+			if ok {
+				ok = okLocal
+			}
 		}
+		rs.Finish(len(dst)-dstLen, ok)
 	}
 	return dst
 }
@@ -477,6 +696,9 @@ func getScrapeWorkConfig(sc *ScrapeConfig, baseDir string, globalCfg *GlobalConf
 	if scheme != "http" && scheme != "https" {
 		return nil, fmt.Errorf("unexpected `scheme` for `job_name` %q: %q; supported values: http or https", jobName, scheme)
 	}
+	if sc.EnableHTTP2 && sc.ProxyURL.URL() != nil {
+		return nil, fmt.Errorf("`enable_http2: true` cannot be used together with `proxy_url` for `job_name` %q", jobName)
+	}
 	params := sc.Params
 	ac, err := promauth.NewConfig(baseDir, sc.BasicAuth, sc.BearerToken, sc.BearerTokenFile, sc.TLSConfig)
 	if err != nil {
@@ -490,7 +712,12 @@ func getScrapeWorkConfig(sc *ScrapeConfig, baseDir string, globalCfg *GlobalConf
 	if err != nil {
 		return nil, fmt.Errorf("cannot parse `metric_relabel_configs` for `job_name` %q: %w", jobName, err)
 	}
+	metricNormalizer, err := newMetricNormalizer(sc.MetricNormalization)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse `metric_normalization` for `job_name` %q: %w", jobName, err)
+	}
 	swc := &scrapeWorkConfig{
+		baseDir:              baseDir,
 		scrapeInterval:       scrapeInterval,
 		scrapeTimeout:        scrapeTimeout,
 		jobName:              jobName,
@@ -504,16 +731,26 @@ func getScrapeWorkConfig(sc *ScrapeConfig, baseDir string, globalCfg *GlobalConf
 		externalLabels:       globalCfg.ExternalLabels,
 		relabelConfigs:       relabelConfigs,
 		metricRelabelConfigs: metricRelabelConfigs,
+		metricNormalizer:     metricNormalizer,
 		sampleLimit:          sc.SampleLimit,
 		disableCompression:   sc.DisableCompression,
 		disableKeepAlive:     sc.DisableKeepAlive,
 		streamParse:          sc.StreamParse,
+		enableHTTP2:          sc.EnableHTTP2,
+		probe:                sc.probe,
 		scrapeAlignInterval:  sc.ScrapeAlignInterval,
+		extraLabels:          sc.ExtraLabels,
+	}
+	if sc.PruneMetaLabels {
+		swc.metaLabelsFilter = newMetaLabelsFilter(relabelConfigs)
 	}
 	return swc, nil
 }
 
 type scrapeWorkConfig struct {
+	// baseDir is the directory of the config file containing the `scrape_config`.
+	// It is used for resolving relative paths in the `scrape_config`.
+	baseDir              string
 	scrapeInterval       time.Duration
 	scrapeTimeout        time.Duration
 	jobName              string
@@ -527,11 +764,18 @@ type scrapeWorkConfig struct {
 	externalLabels       map[string]string
 	relabelConfigs       *promrelabel.ParsedConfigs
 	metricRelabelConfigs *promrelabel.ParsedConfigs
+	metricNormalizer     *MetricNormalizer
 	sampleLimit          int
 	disableCompression   bool
 	disableKeepAlive     bool
 	streamParse          bool
+	enableHTTP2          bool
+	probe                *ProbeOptions
 	scrapeAlignInterval  time.Duration
+	extraLabels          map[string]string
+
+	// metaLabelsFilter is set if `prune_meta_labels: true` is set in `scrape_config`.
+	metaLabelsFilter *metaLabelsFilter
 }
 
 func appendKubernetesScrapeWork(dst []*ScrapeWork, sdc *kubernetes.SDConfig, baseDir string, swc *scrapeWorkConfig) ([]*ScrapeWork, bool) {
@@ -621,7 +865,8 @@ func appendScrapeWorkForTargetLabels(dst []*ScrapeWork, swc *scrapeWorkConfig, t
 	return dst
 }
 
-func (sdc *FileSDConfig) appendScrapeWork(dst []*ScrapeWork, swsMapPrev map[string][]*ScrapeWork, baseDir string, swc *scrapeWorkConfig) []*ScrapeWork {
+func (sdc *FileSDConfig) appendScrapeWork(dst []*ScrapeWork, swsMapPrev map[string][]*ScrapeWork, baseDir string, swc *scrapeWorkConfig) ([]*ScrapeWork, bool) {
+	ok := true
 	for _, file := range sdc.Files {
 		pathPattern := getFilepath(baseDir, file)
 		paths := []string{pathPattern}
@@ -631,6 +876,7 @@ func (sdc *FileSDConfig) appendScrapeWork(dst []*ScrapeWork, swsMapPrev map[stri
 			if err != nil {
 				// Do not return this error, since other files may contain valid scrape configs.
 				logger.Errorf("invalid pattern %q in `files` section: %s; skipping it", file, err)
+				ok = false
 				continue
 			}
 		}
@@ -645,6 +891,7 @@ func (sdc *FileSDConfig) appendScrapeWork(dst []*ScrapeWork, swsMapPrev map[stri
 				} else {
 					logger.Errorf("skipping loading `static_configs` from %q because of error: %s", path, err)
 				}
+				ok = false
 				continue
 			}
 			pathShort := path
@@ -663,7 +910,7 @@ func (sdc *FileSDConfig) appendScrapeWork(dst []*ScrapeWork, swsMapPrev map[stri
 			}
 		}
 	}
-	return dst
+	return dst, ok
 }
 
 func (stc *StaticConfig) appendScrapeWork(dst []*ScrapeWork, swc *scrapeWorkConfig, metaLabels map[string]string) []*ScrapeWork {
@@ -686,6 +933,9 @@ func (stc *StaticConfig) appendScrapeWork(dst []*ScrapeWork, swc *scrapeWorkConf
 
 func appendScrapeWork(dst []*ScrapeWork, swc *scrapeWorkConfig, target string, extraLabels, metaLabels map[string]string) ([]*ScrapeWork, error) {
 	labels := mergeLabels(swc.jobName, swc.scheme, target, swc.metricsPath, extraLabels, swc.externalLabels, metaLabels, swc.params)
+	if swc.metaLabelsFilter != nil {
+		labels = swc.metaLabelsFilter.apply(labels)
+	}
 	var originalLabels []prompbmarshal.Label
 	if !*dropOriginalLabels {
 		originalLabels = append([]prompbmarshal.Label{}, labels...)
@@ -716,12 +966,32 @@ func appendScrapeWork(dst []*ScrapeWork, swc *scrapeWorkConfig, target string, e
 		droppedTargetsMap.Register(originalLabels)
 		return dst, nil
 	}
-	if strings.Contains(addressRelabeled, "/") {
-		// Drop target with '/'
-		droppedTargetsMap.Register(originalLabels)
-		return dst, nil
+	// Targets with `unix:///path/to/socket` address are scraped via the given unix domain socket.
+	// The `localhost` host is used in the scrape url for such targets.
+	unixSocketPath := ""
+	scrapeHost := "localhost"
+	if strings.HasPrefix(addressRelabeled, "unix://") {
+		unixSocketPath = addressRelabeled[len("unix://"):]
+		if !strings.HasPrefix(unixSocketPath, "/") {
+			// Drop target with invalid unix socket path
+			droppedTargetsMap.Register(originalLabels)
+			return dst, nil
+		}
+		if swc.proxyURL.URL() != nil {
+			return dst, fmt.Errorf("`proxy_url` cannot be used for scraping target %q over unix socket for `job_name` %q", addressRelabeled, swc.jobName)
+		}
+	} else {
+		if strings.Contains(addressRelabeled, "/") {
+			// Drop target with '/'
+			droppedTargetsMap.Register(originalLabels)
+			return dst, nil
+		}
+		if swc.probe == nil || swc.probe.Prober != "icmp" {
+			// ICMP probes do not need port.
+			addressRelabeled = addMissingPort(schemeRelabeled, addressRelabeled)
+		}
+		scrapeHost = addressRelabeled
 	}
-	addressRelabeled = addMissingPort(schemeRelabeled, addressRelabeled)
 	metricsPathRelabeled := promrelabel.GetLabelValueByName(labels, "__metrics_path__")
 	if metricsPathRelabeled == "" {
 		metricsPathRelabeled = "/metrics"
@@ -735,7 +1005,7 @@ func appendScrapeWork(dst []*ScrapeWork, swc *scrapeWorkConfig, target string, e
 		optionalQuestion = ""
 	}
 	paramsStr := url.Values(paramsRelabeled).Encode()
-	scrapeURL := fmt.Sprintf("%s://%s%s%s%s", schemeRelabeled, addressRelabeled, metricsPathRelabeled, optionalQuestion, paramsStr)
+	scrapeURL := fmt.Sprintf("%s://%s%s%s%s", schemeRelabeled, scrapeHost, metricsPathRelabeled, optionalQuestion, paramsStr)
 	if _, err := url.Parse(scrapeURL); err != nil {
 		return dst, fmt.Errorf("invalid url %q for scheme=%q (%q), target=%q (%q), metrics_path=%q (%q) for `job_name` %q: %w",
 			scrapeURL, swc.scheme, schemeRelabeled, target, addressRelabeled, swc.metricsPath, metricsPathRelabeled, swc.jobName, err)
@@ -748,6 +1018,9 @@ func appendScrapeWork(dst []*ScrapeWork, swc *scrapeWorkConfig, target string, e
 		})
 		promrelabel.SortLabels(labels)
 	}
+	if len(swc.extraLabels) > 0 {
+		labels = addExtraLabels(labels, swc.extraLabels)
+	}
 	// Reduce memory usage by interning all the strings in labels.
 	internLabelStrings(labels)
 	dst = append(dst, &ScrapeWork{
@@ -761,10 +1034,14 @@ func appendScrapeWork(dst []*ScrapeWork, swc *scrapeWorkConfig, target string, e
 		ProxyURL:             swc.proxyURL,
 		AuthConfig:           swc.authConfig,
 		MetricRelabelConfigs: swc.metricRelabelConfigs,
+		MetricNormalizer:     swc.metricNormalizer,
 		SampleLimit:          swc.sampleLimit,
 		DisableCompression:   swc.disableCompression,
 		DisableKeepAlive:     swc.disableKeepAlive,
 		StreamParse:          swc.streamParse,
+		UnixSocketPath:       unixSocketPath,
+		EnableHTTP2:          swc.enableHTTP2,
+		Probe:                swc.probe,
 		ScrapeAlignInterval:  swc.scrapeAlignInterval,
 
 		jobNameOriginal: swc.jobName,
@@ -819,6 +1096,24 @@ func getParamsFromLabels(labels []prompbmarshal.Label, paramsOrig map[string][]s
 	return m
 }
 
+// addExtraLabels adds extraLabels to labels after relabeling.
+//
+// Labels with the same names are overridden by extraLabels.
+func addExtraLabels(labels []prompbmarshal.Label, extraLabels map[string]string) []prompbmarshal.Label {
+	for name, value := range extraLabels {
+		if label := promrelabel.GetLabelByName(labels, name); label != nil {
+			label.Value = value
+			continue
+		}
+		labels = append(labels, prompbmarshal.Label{
+			Name:  name,
+			Value: value,
+		})
+	}
+	promrelabel.SortLabels(labels)
+	return labels
+}
+
 func mergeLabels(job, scheme, target, metricsPath string, extraLabels, externalLabels, metaLabels map[string]string, params map[string][]string) []prompbmarshal.Label {
 	// See https://prometheus.io/docs/prometheus/latest/configuration/configuration/#relabel_config
 	m := make(map[string]string)
@@ -3,12 +3,14 @@ package promscrape
 import (
 	"crypto/tls"
 	"fmt"
+	"os"
 	"reflect"
 	"testing"
 	"time"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
 )
 
 func TestLoadStaticConfigs(t *testing.T) {
@@ -67,6 +69,39 @@ func TestLoadConfig(t *testing.T) {
 	}
 }
 
+func TestLoadConfigs(t *testing.T) {
+	cfg, _, err := loadConfigs([]string{"testdata/multi/*.yml"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(cfg.ScrapeConfigs) != 2 {
+		t.Fatalf("unexpected number of scrape configs; got %d; want 2", len(cfg.ScrapeConfigs))
+	}
+	swc1 := cfg.ScrapeConfigs[0].swc
+	if swc1.jobName != "team1" || swc1.scrapeInterval != 10*time.Second {
+		t.Fatalf("unexpected first scrape config: job_name=%q, scrape_interval=%s", swc1.jobName, swc1.scrapeInterval)
+	}
+	swc2 := cfg.ScrapeConfigs[1].swc
+	if swc2.jobName != "team2" || swc2.scrapeInterval != defaultScrapeInterval {
+		t.Fatalf("unexpected second scrape config: job_name=%q, scrape_interval=%s", swc2.jobName, swc2.scrapeInterval)
+	}
+	if swc2.authConfig.Authorization != "Bearer secret-pass" {
+		t.Fatalf("unexpected Authorization for the second scrape config: %q", swc2.authConfig.Authorization)
+	}
+
+	// Duplicate job_name across files
+	_, _, err = loadConfigs([]string{"testdata/multi/*.yml", "testdata/prometheus_duplicate_job.yml"})
+	if err == nil {
+		t.Fatalf("expecting non-nil error for duplicate job_name")
+	}
+
+	// Glob without matches
+	_, _, err = loadConfigs([]string{"testdata/non-existing-dir/*.yml"})
+	if err == nil {
+		t.Fatalf("expecting non-nil error for glob without matches")
+	}
+}
+
 func TestBlackboxExporter(t *testing.T) {
 	// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/684
 	data := `
@@ -213,6 +248,39 @@ func getStaticScrapeWork(data []byte, path string) ([]*ScrapeWork, error) {
 	return cfg.getStaticScrapeWork(), nil
 }
 
+func TestGetStaticScrapeWorkEnvVars(t *testing.T) {
+	if err := os.Setenv("PROMSCRAPE_TEST_HOST", "foo"); err != nil {
+		t.Fatalf("cannot set env var: %s", err)
+	}
+	defer func() {
+		_ = os.Unsetenv("PROMSCRAPE_TEST_HOST")
+	}()
+	data := `
+scrape_configs:
+- job_name: x
+  static_configs:
+  - targets: ["${PROMSCRAPE_TEST_HOST}:1234", "%{PROMSCRAPE_TEST_MISSING:-bar}:5678"]
+  relabel_configs:
+  - source_labels: [__address__]
+    regex: "(.+):.+"
+    target_label: host
+    replacement: "${1}"
+`
+	sws, err := getStaticScrapeWork([]byte(data), "non-existing-file")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(sws) != 2 {
+		t.Fatalf("unexpected number of scrape works; got %d; want 2", len(sws))
+	}
+	for i, hostExpected := range []string{"foo", "bar"} {
+		sw := sws[i]
+		if host := promrelabel.GetLabelValueByName(sw.Labels, "host"); host != hostExpected {
+			t.Fatalf("unexpected host label for target #%d; got %q; want %q", i, host, hostExpected)
+		}
+	}
+}
+
 func TestGetStaticScrapeWorkFailure(t *testing.T) {
 	f := func(data string) {
 		t.Helper()
@@ -244,6 +312,22 @@ scrape_configs:
   - targets: ["foo"]
 `)
 
+	// Unsupported kind in kubernetes_crd_configs
+	f(`
+kubernetes_crd_configs:
+- kinds: [prometheusrule]
+`)
+
+	// enable_http2 with proxy_url
+	f(`
+scrape_configs:
+- job_name: x
+  enable_http2: true
+  proxy_url: http://proxy:3128
+  static_configs:
+  - targets: ["foo"]
+`)
+
 	// Missing username in `basic_auth`
 	f(`
 scrape_configs:
@@ -1263,6 +1347,59 @@ scrape_configs:
 		},
 	})
 	f(`
+global:
+  external_labels:
+    region: us-east
+scrape_configs:
+- job_name: aaa
+  extra_labels:
+    cluster: prod
+    instance: foobar
+  relabel_configs:
+  - action: labeldrop
+    regex: cluster
+  static_configs:
+  - targets: ["a"]
+`, []*ScrapeWork{
+		{
+			ScrapeURL:      "http://a:80/metrics",
+			ScrapeInterval: defaultScrapeInterval,
+			ScrapeTimeout:  defaultScrapeTimeout,
+			Labels: []prompbmarshal.Label{
+				{
+					Name:  "__address__",
+					Value: "a",
+				},
+				{
+					Name:  "__metrics_path__",
+					Value: "/metrics",
+				},
+				{
+					Name:  "__scheme__",
+					Value: "http",
+				},
+				{
+					Name:  "cluster",
+					Value: "prod",
+				},
+				{
+					Name:  "instance",
+					Value: "foobar",
+				},
+				{
+					Name:  "job",
+					Value: "aaa",
+				},
+				{
+					Name:  "region",
+					Value: "us-east",
+				},
+			},
+			AuthConfig:      &promauth.Config{},
+			jobNameOriginal: "aaa",
+		},
+	})
+	f(`
 scrape_configs:
   - job_name: 'snmp'
     sample_limit: 100
@@ -1366,6 +1503,46 @@ scrape_configs:
 			AuthConfig:      &promauth.Config{},
 		},
 	})
+	f(`
+scrape_configs:
+- job_name: unix
+  enable_http2: true
+  metrics_path: /foo/metrics
+  static_configs:
+  - targets: ["unix:///var/run/exporter.sock"]
+`, []*ScrapeWork{
+		{
+			ScrapeURL:      "http://localhost/foo/metrics",
+			ScrapeInterval: defaultScrapeInterval,
+			ScrapeTimeout:  defaultScrapeTimeout,
+			Labels: []prompbmarshal.Label{
+				{
+					Name:  "__address__",
+					Value: "unix:///var/run/exporter.sock",
+				},
+				{
+					Name:  "__metrics_path__",
+					Value: "/foo/metrics",
+				},
+				{
+					Name:  "__scheme__",
+					Value: "http",
+				},
+				{
+					Name:  "instance",
+					Value: "unix:///var/run/exporter.sock",
+				},
+				{
+					Name:  "job",
+					Value: "unix",
+				},
+			},
+			UnixSocketPath:  "/var/run/exporter.sock",
+			EnableHTTP2:     true,
+			jobNameOriginal: "unix",
+			AuthConfig:      &promauth.Config{},
+		},
+	})
 }
 
 func equalStaticConfigForScrapeWorks(a, b []*ScrapeWork) bool {
@@ -0,0 +1,146 @@
+package promscrape
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/envtemplate"
+	"gopkg.in/yaml.v2"
+)
+
+// unsupportedField represents a field from -promscrape.config, which isn't supported by lib/promscrape.
+type unsupportedField struct {
+	// jobName is the `job_name` of the `scrape_config` containing the field.
+	//
+	// It is empty for fields outside `scrape_configs`.
+	jobName string
+
+	// path is the path to the field in YAML, such as `scrape_configs[0].relabel_configs[1].foo`.
+	path string
+}
+
+func (uf *unsupportedField) String() string {
+	return fmt.Sprintf("job_name=%q, path=%q", uf.jobName, uf.path)
+}
+
+// findUnsupportedFields returns all the fields from Prometheus config data, which aren't supported by Config.
+func findUnsupportedFields(data []byte) ([]unsupportedField, error) {
+	// Missing env vars are reported during config unmarshaling.
+	data, _ = envtemplate.Expand(data, false)
+	var v interface{}
+	if err := yaml.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal data: %w", err)
+	}
+	return appendUnsupportedFields(nil, v, reflect.TypeOf(Config{}), "", ""), nil
+}
+
+var (
+	unmarshalerType  = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+	scrapeConfigType = reflect.TypeOf(ScrapeConfig{})
+	probeConfigType  = reflect.TypeOf(ProbeConfig{})
+)
+
+func appendUnsupportedFields(dst []unsupportedField, v interface{}, t reflect.Type, path, jobName string) []unsupportedField {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if reflect.PtrTo(t).Implements(unmarshalerType) {
+		// Types with custom unmarshaling are checked by their UnmarshalYAML.
+		return dst
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := v.(map[interface{}]interface{})
+		if !ok {
+			// Type mismatch is reported during config unmarshaling.
+			return dst
+		}
+		if t == scrapeConfigType || t == probeConfigType {
+			jobName, _ = m["job_name"].(string)
+		}
+		fields := getSupportedFields(t)
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, fmt.Sprintf("%v", k))
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fieldPath := key
+			if path != "" {
+				fieldPath = path + "." + key
+			}
+			ft, ok := fields[key]
+			if !ok {
+				dst = append(dst, unsupportedField{
+					jobName: jobName,
+					path:    fieldPath,
+				})
+				continue
+			}
+			dst = appendUnsupportedFields(dst, m[key], ft, fieldPath, jobName)
+		}
+	case reflect.Slice, reflect.Array:
+		a, ok := v.([]interface{})
+		if !ok {
+			return dst
+		}
+		for i, item := range a {
+			dst = appendUnsupportedFields(dst, item, t.Elem(), fmt.Sprintf("%s[%d]", path, i), jobName)
+		}
+	case reflect.Map:
+		m, ok := v.(map[interface{}]interface{})
+		if !ok {
+			return dst
+		}
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, fmt.Sprintf("%v", k))
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			dst = appendUnsupportedFields(dst, m[key], t.Elem(), path+"."+key, jobName)
+		}
+	}
+	return dst
+}
+
+// getSupportedFields returns YAML field names with the corresponding types for the given struct type t.
+func getSupportedFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			// Skip unexported fields.
+			continue
+		}
+		tag := f.Tag.Get("yaml")
+		if tag == "-" {
+			continue
+		}
+		name := tag
+		opts := ""
+		if n := strings.IndexByte(tag, ','); n >= 0 {
+			name = tag[:n]
+			opts = tag[n+1:]
+		}
+		if strings.Contains(opts, "inline") {
+			ft := f.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				for k, v := range getSupportedFields(ft) {
+					fields[k] = v
+				}
+			}
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
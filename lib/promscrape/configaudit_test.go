@@ -0,0 +1,84 @@
+package promscrape
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindUnsupportedFields(t *testing.T) {
+	f := func(data string, ufsExpected []unsupportedField) {
+		t.Helper()
+		ufs, err := findUnsupportedFields([]byte(data))
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !reflect.DeepEqual(ufs, ufsExpected) {
+			t.Fatalf("unexpected unsupported fields\ngot\n%v\nwant\n%v", ufs, ufsExpected)
+		}
+	}
+	f(``, nil)
+	f(`
+global:
+  scrape_interval: 10s
+  external_labels:
+    foo: bar
+scrape_configs:
+- job_name: foo
+  proxy_url: http://proxy
+  static_configs:
+  - targets: ["host1:80"]
+    labels:
+      a: b
+  relabel_configs:
+  - source_labels: [__address__]
+    target_label: instance
+`, nil)
+	f(`
+global:
+  evaluation_interval: 10s
+rule_files: [foo.yml]
+scrape_configs:
+- job_name: foo
+  static_configs:
+  - targets: ["host1:80"]
+    foo: bar
+- job_name: bar
+  scrape_interval: 10s
+  unsupported_option: true
+  relabel_configs:
+  - source_labels: [__address__]
+    target_label: instance
+    bad_option: 1
+  kubernetes_sd_configs:
+  - role: pod
+    unknown_kubernetes_option: x
+`, []unsupportedField{
+		{
+			path: "global.evaluation_interval",
+		},
+		{
+			path: "rule_files",
+		},
+		{
+			jobName: "foo",
+			path:    "scrape_configs[0].static_configs[0].foo",
+		},
+		{
+			jobName: "bar",
+			path:    "scrape_configs[1].kubernetes_sd_configs[0].unknown_kubernetes_option",
+		},
+		{
+			jobName: "bar",
+			path:    "scrape_configs[1].relabel_configs[0].bad_option",
+		},
+		{
+			jobName: "bar",
+			path:    "scrape_configs[1].unsupported_option",
+		},
+	})
+
+	// Invalid YAML
+	if _, err := findUnsupportedFields([]byte("foo: [bar")); err == nil {
+		t.Fatalf("expecting non-nil error for invalid YAML")
+	}
+}
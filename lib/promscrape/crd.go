@@ -0,0 +1,95 @@
+package promscrape
+
+import (
+	"sync"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape/discovery/kubernetes"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape/discoveryutils"
+)
+
+// crdState holds the state for `kubernetes_crd_configs` between getKubernetesCRDScrapeWork calls.
+type crdState struct {
+	mu sync.Mutex
+
+	// jobsPrev contains scrape jobs obtained during the last successful discovery for each CRDConfig.
+	// They are used when prometheus-operator objects cannot be obtained from API server.
+	jobsPrev map[*kubernetes.CRDConfig][]*kubernetes.ScrapeJob
+
+	// swcs contains scrapeWorkConfig for each scrape job.
+	// kubernetes.GetCRDScrapeJobs returns the same jobs for unchanged objects, so swcs is re-used between calls.
+	swcs map[*kubernetes.ScrapeJob]*scrapeWorkConfig
+}
+
+// getKubernetesCRDScrapeWork returns `kubernetes_crd_configs` ScrapeWork from cfg.
+func (cfg *Config) getKubernetesCRDScrapeWork(prev []*ScrapeWork) []*ScrapeWork {
+	cs := &cfg.crd
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	swsPrevByJob := getSWSByJob(prev)
+	jobsPrev := make(map[*kubernetes.CRDConfig][]*kubernetes.ScrapeJob, len(cfg.KubernetesCRDConfigs))
+	swcs := make(map[*kubernetes.ScrapeJob]*scrapeWorkConfig)
+	dst := make([]*ScrapeWork, 0, len(prev))
+	for _, cc := range cfg.KubernetesCRDConfigs {
+		jobs, err := kubernetes.GetCRDScrapeJobs(cc, cfg.baseDir)
+		if err != nil {
+			logger.Errorf("error when discovering prometheus-operator objects: %s; using the previously discovered scrape jobs", err)
+			jobs = cs.jobsPrev[cc]
+		}
+		jobsPrev[cc] = jobs
+		for _, job := range jobs {
+			swc := cs.swcs[job]
+			if swc == nil {
+				swc, err = cfg.getCRDScrapeWorkConfig(job)
+				if err != nil {
+					logger.Errorf("skipping scrape job generated from prometheus-operator object: %s", err)
+					continue
+				}
+			}
+			swcs[job] = swc
+			if job.SDConfig == nil {
+				stc := &StaticConfig{
+					Targets: job.StaticTargets,
+					Labels:  job.StaticLabels,
+				}
+				dst = stc.appendScrapeWork(dst, swc, nil)
+				continue
+			}
+			rs := discoveryutils.NewRefreshStatus("kubernetes_crd_configs", swc.jobName)
+			dstLen := len(dst)
+			var ok bool
+			dst, ok = appendKubernetesScrapeWork(dst, job.SDConfig, cfg.baseDir, swc)
+			if !ok {
+				swsPrev := swsPrevByJob[swc.jobName]
+				if len(swsPrev) > 0 {
+					logger.Errorf("there were errors when discovering kubernetes targets for job %q, so preserving the previous targets", swc.jobName)
+					dst = append(dst[:dstLen], swsPrev...)
+				}
+			}
+			rs.Finish(len(dst)-dstLen, ok)
+		}
+	}
+	cs.jobsPrev = jobsPrev
+	cs.swcs = swcs
+	return dst
+}
+
+func (cfg *Config) getCRDScrapeWorkConfig(job *kubernetes.ScrapeJob) (*scrapeWorkConfig, error) {
+	sc := &ScrapeConfig{
+		JobName:              job.JobName,
+		ScrapeInterval:       job.ScrapeInterval,
+		ScrapeTimeout:        job.ScrapeTimeout,
+		MetricsPath:          job.MetricsPath,
+		HonorLabels:          job.HonorLabels,
+		HonorTimestamps:      job.HonorTimestamps,
+		Scheme:               job.Scheme,
+		Params:               job.Params,
+		BearerTokenFile:      job.BearerTokenFile,
+		TLSConfig:            job.TLSConfig,
+		RelabelConfigs:       job.RelabelConfigs,
+		MetricRelabelConfigs: job.MetricRelabelConfigs,
+		SampleLimit:          job.SampleLimit,
+	}
+	return getScrapeWorkConfig(sc, cfg.baseDir, &cfg.Global)
+}
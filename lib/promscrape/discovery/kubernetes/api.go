@@ -5,6 +5,7 @@ import (
 	"net"
 	"os"
 
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape/discoveryutils"
 )
@@ -73,5 +74,11 @@ func getAPIResponse(cfg *apiConfig, role, path string) ([]byte, error) {
 	if len(query) > 0 {
 		path += "?" + query
 	}
-	return cfg.client.GetAPIResponse(path)
+	logger.Debugf("requesting %s objects from kubernetes API server %q at %q", role, cfg.client.Addr(), path)
+	data, err := cfg.client.GetAPIResponse(path)
+	if err != nil {
+		return nil, err
+	}
+	logger.Debugf("received %d bytes with %s objects from kubernetes API server %q at %q", len(data), role, cfg.client.Addr(), path)
+	return data, nil
 }
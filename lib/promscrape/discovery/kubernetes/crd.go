@@ -0,0 +1,246 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/proxy"
+)
+
+// CRDConfig represents config for discovering scrape jobs from prometheus-operator CRDs.
+//
+// See https://github.com/prometheus-operator/prometheus-operator/blob/master/Documentation/design.md
+type CRDConfig struct {
+	APIServer       string                    `yaml:"api_server,omitempty"`
+	BasicAuth       *promauth.BasicAuthConfig `yaml:"basic_auth,omitempty"`
+	BearerToken     string                    `yaml:"bearer_token,omitempty"`
+	BearerTokenFile string                    `yaml:"bearer_token_file,omitempty"`
+	ProxyURL        proxy.URL                 `yaml:"proxy_url,omitempty"`
+	TLSConfig       *promauth.TLSConfig       `yaml:"tls_config,omitempty"`
+
+	// Namespaces limits namespaces for CRD objects. CRD objects are discovered in all the namespaces by default.
+	Namespaces Namespaces `yaml:"namespaces,omitempty"`
+
+	// Kinds contains CRD kinds to discover. Supported values: servicemonitor, podmonitor, probe. All the kinds are discovered by default.
+	Kinds []string `yaml:"kinds,omitempty"`
+
+	// Selector is an optional label selector for CRD objects. For example, `team=foo`.
+	Selector string `yaml:"selector,omitempty"`
+
+	mu sync.Mutex
+
+	// sdc is used for querying CRD objects from API server.
+	sdc *SDConfig
+
+	// jobs contains scrape jobs generated during the previous GetCRDScrapeJobs call.
+	// It is used for returning the same *ScrapeJob for unchanged CRD objects,
+	// so the discovery API clients are re-used between calls.
+	jobs map[string]*ScrapeJob
+}
+
+// ScrapeJob represents scrape job generated from prometheus-operator CRD object.
+type ScrapeJob struct {
+	JobName string
+
+	// SDConfig is set for jobs, which discover targets via Kubernetes API.
+	SDConfig *SDConfig
+
+	// StaticTargets and StaticLabels are set for jobs with static targets.
+	StaticTargets []string
+	StaticLabels  map[string]string
+
+	MetricsPath          string
+	Scheme               string
+	Params               map[string][]string
+	ScrapeInterval       time.Duration
+	ScrapeTimeout        time.Duration
+	HonorLabels          bool
+	HonorTimestamps      bool
+	BearerTokenFile      string
+	TLSConfig            *promauth.TLSConfig
+	SampleLimit          int
+	RelabelConfigs       []promrelabel.RelabelConfig
+	MetricRelabelConfigs []promrelabel.RelabelConfig
+}
+
+var supportedCRDKinds = []string{"servicemonitor", "podmonitor", "probe"}
+
+// Validate validates cc.
+func (cc *CRDConfig) Validate() error {
+	for _, kind := range cc.Kinds {
+		if !containsString(supportedCRDKinds, kind) {
+			return fmt.Errorf("unsupported kind %q; supported values: %s", kind, strings.Join(supportedCRDKinds, ", "))
+		}
+	}
+	return nil
+}
+
+func (cc *CRDConfig) hasKind(kind string) bool {
+	return len(cc.Kinds) == 0 || containsString(cc.Kinds, kind)
+}
+
+// newSDConfig returns SDConfig with the given role and namespaces, which uses the same API server and auth as cc.
+func (cc *CRDConfig) newSDConfig(role string, namespaces []string) *SDConfig {
+	return &SDConfig{
+		APIServer:       cc.APIServer,
+		Role:            role,
+		BasicAuth:       cc.BasicAuth,
+		BearerToken:     cc.BearerToken,
+		BearerTokenFile: cc.BearerTokenFile,
+		ProxyURL:        cc.ProxyURL,
+		TLSConfig:       cc.TLSConfig,
+		Namespaces: Namespaces{
+			Names: namespaces,
+		},
+	}
+}
+
+// GetCRDScrapeJobs returns scrape jobs for prometheus-operator CRD objects discovered according to cc.
+//
+// The returned jobs for unchanged CRD objects are the same between calls.
+func GetCRDScrapeJobs(cc *CRDConfig, baseDir string) ([]*ScrapeJob, error) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+
+	if cc.sdc == nil {
+		cc.sdc = cc.newSDConfig("", cc.Namespaces.Names)
+		if cc.Selector != "" {
+			for _, kind := range supportedCRDKinds {
+				cc.sdc.Selectors = append(cc.sdc.Selectors, Selector{
+					Role:  kind,
+					Label: cc.Selector,
+				})
+			}
+		}
+	}
+	cfg, err := getAPIConfig(cc.sdc, baseDir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create API config: %w", err)
+	}
+	jobs := make(map[string]*ScrapeJob)
+	var result []*ScrapeJob
+	addJob := func(key string, newJob func() (*ScrapeJob, error)) {
+		job := cc.jobs[key]
+		if job == nil {
+			j, err := newJob()
+			if err != nil {
+				logger.Errorf("skipping invalid prometheus-operator object: %s", err)
+				return
+			}
+			job = j
+		}
+		jobs[key] = job
+		result = append(result, job)
+	}
+	if cc.hasKind("servicemonitor") {
+		var sms []ServiceMonitor
+		if err := getCRDObjects(cfg, "servicemonitor", "servicemonitors", &sms); err != nil {
+			return nil, err
+		}
+		for i := range sms {
+			sm := &sms[i]
+			for j := range sm.Spec.Endpoints {
+				key := getCRDJobKey("servicemonitor", sm, j)
+				addJob(key, func() (*ScrapeJob, error) { return sm.newScrapeJob(cc, j) })
+			}
+		}
+	}
+	if cc.hasKind("podmonitor") {
+		var pms []PodMonitor
+		if err := getCRDObjects(cfg, "podmonitor", "podmonitors", &pms); err != nil {
+			return nil, err
+		}
+		for i := range pms {
+			pm := &pms[i]
+			for j := range pm.Spec.PodMetricsEndpoints {
+				key := getCRDJobKey("podmonitor", pm, j)
+				addJob(key, func() (*ScrapeJob, error) { return pm.newScrapeJob(cc, j) })
+			}
+		}
+	}
+	if cc.hasKind("probe") {
+		var probes []Probe
+		if err := getCRDObjects(cfg, "probe", "probes", &probes); err != nil {
+			return nil, err
+		}
+		for i := range probes {
+			p := &probes[i]
+			if p.Spec.Targets.StaticConfig != nil {
+				key := getCRDJobKey("probe-static", p, 0)
+				addJob(key, func() (*ScrapeJob, error) { return p.newStaticScrapeJob() })
+			}
+			if p.Spec.Targets.Ingress != nil {
+				key := getCRDJobKey("probe-ingress", p, 0)
+				addJob(key, func() (*ScrapeJob, error) { return p.newIngressScrapeJob(cc) })
+			}
+		}
+	}
+	cc.jobs = jobs
+	return result, nil
+}
+
+// getCRDJobKey returns a key for the scrape job generated from the given CRD object.
+func getCRDJobKey(kind string, obj interface{}, idx int) string {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		logger.Panicf("BUG: cannot marshal %s: %s", kind, err)
+	}
+	return fmt.Sprintf("%s/%d/%s", kind, idx, data)
+}
+
+// getCRDObjects reads CRD objects with the given kind from API server into dst.
+//
+// dst must point to a slice of the corresponding CRD objects.
+func getCRDObjects(cfg *apiConfig, kind, plural string, dst interface{}) error {
+	var paths []string
+	namespaces := cfg.namespaces
+	if len(namespaces) == 0 {
+		paths = append(paths, "/apis/monitoring.coreos.com/v1/"+plural)
+	} else {
+		// Query /apis/monitoring.coreos.com/v1/namespaces/* for each namespace.
+		// This fixes authorization issue at https://github.com/VictoriaMetrics/VictoriaMetrics/issues/432
+		cfgCopy := *cfg
+		cfgCopy.namespaces = nil
+		cfg = &cfgCopy
+		for _, ns := range namespaces {
+			paths = append(paths, fmt.Sprintf("/apis/monitoring.coreos.com/v1/namespaces/%s/%s", ns, plural))
+		}
+	}
+	var items []json.RawMessage
+	for _, path := range paths {
+		data, err := getAPIResponse(cfg, kind, path)
+		if err != nil {
+			return fmt.Errorf("cannot obtain %s objects from API server: %w", kind, err)
+		}
+		var list struct {
+			Items []json.RawMessage
+		}
+		if err := json.Unmarshal(data, &list); err != nil {
+			return fmt.Errorf("cannot unmarshal %s list from %q: %w", kind, data, err)
+		}
+		items = append(items, list.Items...)
+	}
+	data, err := json.Marshal(items)
+	if err != nil {
+		logger.Panicf("BUG: cannot marshal %s items: %s", kind, err)
+	}
+	if err := json.Unmarshal(data, dst); err != nil {
+		return fmt.Errorf("cannot unmarshal %s objects: %w", kind, err)
+	}
+	return nil
+}
+
+func containsString(a []string, s string) bool {
+	for _, x := range a {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
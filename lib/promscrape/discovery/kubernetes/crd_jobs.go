@@ -0,0 +1,492 @@
+package kubernetes
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape/discoveryutils"
+)
+
+// ServiceMonitor represents prometheus-operator ServiceMonitor.
+//
+// See https://github.com/prometheus-operator/prometheus-operator/blob/master/Documentation/api.md#servicemonitor
+type ServiceMonitor struct {
+	Metadata ObjectMeta
+	Spec     ServiceMonitorSpec
+}
+
+// ServiceMonitorSpec represents prometheus-operator ServiceMonitorSpec.
+//
+// See https://github.com/prometheus-operator/prometheus-operator/blob/master/Documentation/api.md#servicemonitorspec
+type ServiceMonitorSpec struct {
+	JobLabel          string
+	TargetLabels      []string
+	PodTargetLabels   []string
+	Endpoints         []CRDEndpoint
+	Selector          LabelSelector
+	NamespaceSelector NamespaceSelector
+	SampleLimit       int
+}
+
+// PodMonitor represents prometheus-operator PodMonitor.
+//
+// See https://github.com/prometheus-operator/prometheus-operator/blob/master/Documentation/api.md#podmonitor
+type PodMonitor struct {
+	Metadata ObjectMeta
+	Spec     PodMonitorSpec
+}
+
+// PodMonitorSpec represents prometheus-operator PodMonitorSpec.
+//
+// See https://github.com/prometheus-operator/prometheus-operator/blob/master/Documentation/api.md#podmonitorspec
+type PodMonitorSpec struct {
+	JobLabel            string
+	PodTargetLabels     []string
+	PodMetricsEndpoints []CRDEndpoint
+	Selector            LabelSelector
+	NamespaceSelector   NamespaceSelector
+	SampleLimit         int
+}
+
+// CRDEndpoint represents prometheus-operator Endpoint and PodMetricsEndpoint.
+//
+// Only file-based auth options are supported, since Secret objects aren't read.
+//
+// See https://github.com/prometheus-operator/prometheus-operator/blob/master/Documentation/api.md#endpoint
+type CRDEndpoint struct {
+	Port              string
+	TargetPort        interface{}
+	Path              string
+	Scheme            string
+	Params            map[string][]string
+	Interval          string
+	ScrapeTimeout     string
+	HonorLabels       bool
+	HonorTimestamps   *bool
+	BearerTokenFile   string
+	TLSConfig         *CRDTLSConfig
+	Relabelings       []promrelabel.RelabelConfig
+	MetricRelabelings []promrelabel.RelabelConfig
+}
+
+// CRDTLSConfig represents file-based options from prometheus-operator TLSConfig.
+//
+// See https://github.com/prometheus-operator/prometheus-operator/blob/master/Documentation/api.md#tlsconfig
+type CRDTLSConfig struct {
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+// Probe represents prometheus-operator Probe.
+//
+// See https://github.com/prometheus-operator/prometheus-operator/blob/master/Documentation/api.md#probe
+type Probe struct {
+	Metadata ObjectMeta
+	Spec     ProbeSpec
+}
+
+// ProbeSpec represents prometheus-operator ProbeSpec.
+//
+// See https://github.com/prometheus-operator/prometheus-operator/blob/master/Documentation/api.md#probespec
+type ProbeSpec struct {
+	JobName       string
+	ProberSpec    ProberSpec `json:"prober"`
+	Module        string
+	Targets       ProbeTargets
+	Interval      string
+	ScrapeTimeout string
+	SampleLimit   int
+}
+
+// ProberSpec represents prometheus-operator ProberSpec.
+//
+// See https://github.com/prometheus-operator/prometheus-operator/blob/master/Documentation/api.md#proberspec
+type ProberSpec struct {
+	URL    string
+	Scheme string
+	Path   string
+}
+
+// ProbeTargets represents prometheus-operator ProbeTargets.
+//
+// See https://github.com/prometheus-operator/prometheus-operator/blob/master/Documentation/api.md#probetargets
+type ProbeTargets struct {
+	StaticConfig *ProbeTargetStaticConfig
+	Ingress      *ProbeTargetIngress
+}
+
+// ProbeTargetStaticConfig represents prometheus-operator ProbeTargetStaticConfig.
+//
+// See https://github.com/prometheus-operator/prometheus-operator/blob/master/Documentation/api.md#probetargetstaticconfig
+type ProbeTargetStaticConfig struct {
+	Static            []string
+	Labels            map[string]string
+	RelabelingConfigs []promrelabel.RelabelConfig
+}
+
+// ProbeTargetIngress represents prometheus-operator ProbeTargetIngress.
+//
+// See https://github.com/prometheus-operator/prometheus-operator/blob/master/Documentation/api.md#probetargetingress
+type ProbeTargetIngress struct {
+	Selector          LabelSelector
+	NamespaceSelector NamespaceSelector
+	RelabelingConfigs []promrelabel.RelabelConfig
+}
+
+// LabelSelector represents k8s LabelSelector.
+//
+// See https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.17/#labelselector-v1-meta
+type LabelSelector struct {
+	MatchLabels      map[string]string
+	MatchExpressions []LabelSelectorRequirement
+}
+
+// LabelSelectorRequirement represents k8s LabelSelectorRequirement.
+//
+// See https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.17/#labelselectorrequirement-v1-meta
+type LabelSelectorRequirement struct {
+	Key      string
+	Operator string
+	Values   []string
+}
+
+// NamespaceSelector represents prometheus-operator NamespaceSelector.
+//
+// See https://github.com/prometheus-operator/prometheus-operator/blob/master/Documentation/api.md#namespaceselector
+type NamespaceSelector struct {
+	Any        bool
+	MatchNames []string
+}
+
+// getNamespaces returns namespaces for targets of the object from the given namespace.
+func (ns *NamespaceSelector) getNamespaces(namespace string) []string {
+	if ns.Any {
+		return nil
+	}
+	if len(ns.MatchNames) > 0 {
+		return ns.MatchNames
+	}
+	return []string{namespace}
+}
+
+func (sm *ServiceMonitor) newScrapeJob(cc *CRDConfig, idx int) (*ScrapeJob, error) {
+	ep := &sm.Spec.Endpoints[idx]
+	jobName := fmt.Sprintf("serviceMonitor/%s/%s/%d", sm.Metadata.Namespace, sm.Metadata.Name, idx)
+	job, err := ep.newScrapeJob(jobName)
+	if err != nil {
+		return nil, err
+	}
+	job.SDConfig = cc.newSDConfig("endpoints", sm.Spec.NamespaceSelector.getNamespaces(sm.Metadata.Namespace))
+	job.SampleLimit = sm.Spec.SampleLimit
+
+	rcs := appendLabelSelectorRelabelConfigs(nil, "__meta_kubernetes_service", &sm.Spec.Selector)
+	switch {
+	case ep.Port != "":
+		rcs = appendKeepRelabelConfig(rcs, "__meta_kubernetes_endpoint_port_name", regexp.QuoteMeta(ep.Port))
+	case ep.TargetPort != nil:
+		rcs = appendTargetPortRelabelConfig(rcs, ep.TargetPort)
+	}
+	rcs = appendCopyRelabelConfig(rcs, "__meta_kubernetes_namespace", "namespace")
+	rcs = appendCopyRelabelConfig(rcs, "__meta_kubernetes_service_name", "service")
+	rcs = appendCopyRelabelConfig(rcs, "__meta_kubernetes_pod_name", "pod")
+	rcs = appendCopyRelabelConfig(rcs, "__meta_kubernetes_pod_container_name", "container")
+	for _, label := range sm.Spec.TargetLabels {
+		rcs = appendCopyRelabelConfig(rcs, "__meta_kubernetes_service_label_"+discoveryutils.SanitizeLabelName(label), discoveryutils.SanitizeLabelName(label))
+	}
+	for _, label := range sm.Spec.PodTargetLabels {
+		rcs = appendCopyRelabelConfig(rcs, "__meta_kubernetes_pod_label_"+discoveryutils.SanitizeLabelName(label), discoveryutils.SanitizeLabelName(label))
+	}
+	rcs = appendCopyRelabelConfig(rcs, "__meta_kubernetes_service_name", "job")
+	if sm.Spec.JobLabel != "" {
+		rcs = appendCopyRelabelConfig(rcs, "__meta_kubernetes_service_label_"+discoveryutils.SanitizeLabelName(sm.Spec.JobLabel), "job")
+	}
+	rcs = appendEndpointLabelRelabelConfig(rcs, ep)
+	job.RelabelConfigs = append(rcs, job.RelabelConfigs...)
+	return job, nil
+}
+
+func (pm *PodMonitor) newScrapeJob(cc *CRDConfig, idx int) (*ScrapeJob, error) {
+	ep := &pm.Spec.PodMetricsEndpoints[idx]
+	jobName := fmt.Sprintf("podMonitor/%s/%s/%d", pm.Metadata.Namespace, pm.Metadata.Name, idx)
+	job, err := ep.newScrapeJob(jobName)
+	if err != nil {
+		return nil, err
+	}
+	job.SDConfig = cc.newSDConfig("pod", pm.Spec.NamespaceSelector.getNamespaces(pm.Metadata.Namespace))
+	job.SampleLimit = pm.Spec.SampleLimit
+
+	rcs := appendLabelSelectorRelabelConfigs(nil, "__meta_kubernetes_pod", &pm.Spec.Selector)
+	switch {
+	case ep.Port != "":
+		rcs = appendKeepRelabelConfig(rcs, "__meta_kubernetes_pod_container_port_name", regexp.QuoteMeta(ep.Port))
+	case ep.TargetPort != nil:
+		rcs = appendTargetPortRelabelConfig(rcs, ep.TargetPort)
+	}
+	rcs = appendCopyRelabelConfig(rcs, "__meta_kubernetes_namespace", "namespace")
+	rcs = appendCopyRelabelConfig(rcs, "__meta_kubernetes_pod_container_name", "container")
+	rcs = appendCopyRelabelConfig(rcs, "__meta_kubernetes_pod_name", "pod")
+	for _, label := range pm.Spec.PodTargetLabels {
+		rcs = appendCopyRelabelConfig(rcs, "__meta_kubernetes_pod_label_"+discoveryutils.SanitizeLabelName(label), discoveryutils.SanitizeLabelName(label))
+	}
+	rcs = appendReplacementRelabelConfig(rcs, "job", pm.Metadata.Namespace+"/"+pm.Metadata.Name)
+	if pm.Spec.JobLabel != "" {
+		rcs = appendCopyRelabelConfig(rcs, "__meta_kubernetes_pod_label_"+discoveryutils.SanitizeLabelName(pm.Spec.JobLabel), "job")
+	}
+	rcs = appendEndpointLabelRelabelConfig(rcs, ep)
+	job.RelabelConfigs = append(rcs, job.RelabelConfigs...)
+	return job, nil
+}
+
+func (ep *CRDEndpoint) newScrapeJob(jobName string) (*ScrapeJob, error) {
+	scrapeInterval, err := parseCRDDuration(ep.Interval)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse `interval` for %q: %w", jobName, err)
+	}
+	scrapeTimeout, err := parseCRDDuration(ep.ScrapeTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse `scrapeTimeout` for %q: %w", jobName, err)
+	}
+	job := &ScrapeJob{
+		JobName:              jobName,
+		MetricsPath:          ep.Path,
+		Scheme:               ep.Scheme,
+		Params:               ep.Params,
+		ScrapeInterval:       scrapeInterval,
+		ScrapeTimeout:        scrapeTimeout,
+		HonorLabels:          ep.HonorLabels,
+		BearerTokenFile:      ep.BearerTokenFile,
+		RelabelConfigs:       normalizeRelabelConfigs(ep.Relabelings),
+		MetricRelabelConfigs: normalizeRelabelConfigs(ep.MetricRelabelings),
+	}
+	if ep.HonorTimestamps != nil {
+		job.HonorTimestamps = *ep.HonorTimestamps
+	}
+	if tc := ep.TLSConfig; tc != nil {
+		job.TLSConfig = &promauth.TLSConfig{
+			CAFile:             tc.CAFile,
+			CertFile:           tc.CertFile,
+			KeyFile:            tc.KeyFile,
+			ServerName:         tc.ServerName,
+			InsecureSkipVerify: tc.InsecureSkipVerify,
+		}
+	}
+	return job, nil
+}
+
+func (p *Probe) newProbeScrapeJob(kind string) (*ScrapeJob, error) {
+	jobName := fmt.Sprintf("probe/%s/%s/%s", p.Metadata.Namespace, p.Metadata.Name, kind)
+	if p.Spec.ProberSpec.URL == "" {
+		return nil, fmt.Errorf("missing `prober.url` for %q", jobName)
+	}
+	scrapeInterval, err := parseCRDDuration(p.Spec.Interval)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse `interval` for %q: %w", jobName, err)
+	}
+	scrapeTimeout, err := parseCRDDuration(p.Spec.ScrapeTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse `scrapeTimeout` for %q: %w", jobName, err)
+	}
+	path := p.Spec.ProberSpec.Path
+	if path == "" {
+		path = "/probe"
+	}
+	job := &ScrapeJob{
+		JobName:        jobName,
+		MetricsPath:    path,
+		Scheme:         p.Spec.ProberSpec.Scheme,
+		ScrapeInterval: scrapeInterval,
+		ScrapeTimeout:  scrapeTimeout,
+		SampleLimit:    p.Spec.SampleLimit,
+	}
+	if p.Spec.Module != "" {
+		job.Params = map[string][]string{
+			"module": {p.Spec.Module},
+		}
+	}
+	return job, nil
+}
+
+// appendProbeRelabelConfigs appends relabel configs, which route the probe for __param_target to the prober, to rcs and returns the result.
+func (p *Probe) appendProbeRelabelConfigs(rcs []promrelabel.RelabelConfig) []promrelabel.RelabelConfig {
+	rcs = appendCopyRelabelConfig(rcs, "__param_target", "instance")
+	rcs = appendReplacementRelabelConfig(rcs, "__address__", p.Spec.ProberSpec.URL)
+	if p.Spec.JobName != "" {
+		rcs = appendReplacementRelabelConfig(rcs, "job", p.Spec.JobName)
+	}
+	return rcs
+}
+
+func (p *Probe) newStaticScrapeJob() (*ScrapeJob, error) {
+	job, err := p.newProbeScrapeJob("static")
+	if err != nil {
+		return nil, err
+	}
+	sc := p.Spec.Targets.StaticConfig
+	job.StaticTargets = sc.Static
+	job.StaticLabels = sc.Labels
+	var rcs []promrelabel.RelabelConfig
+	rcs = appendCopyRelabelConfig(rcs, "__address__", "__param_target")
+	rcs = append(rcs, normalizeRelabelConfigs(sc.RelabelingConfigs)...)
+	job.RelabelConfigs = p.appendProbeRelabelConfigs(rcs)
+	return job, nil
+}
+
+func (p *Probe) newIngressScrapeJob(cc *CRDConfig) (*ScrapeJob, error) {
+	job, err := p.newProbeScrapeJob("ingress")
+	if err != nil {
+		return nil, err
+	}
+	ig := p.Spec.Targets.Ingress
+	job.SDConfig = cc.newSDConfig("ingress", ig.NamespaceSelector.getNamespaces(p.Metadata.Namespace))
+	rcs := appendLabelSelectorRelabelConfigs(nil, "__meta_kubernetes_ingress", &ig.Selector)
+	rcs = append(rcs, promrelabel.RelabelConfig{
+		SourceLabels: []string{"__meta_kubernetes_ingress_scheme", "__address__", "__meta_kubernetes_ingress_path"},
+		Separator:    newString(";"),
+		Regex:        newString("(.+);(.+);(.+)"),
+		TargetLabel:  "__param_target",
+		Replacement:  newString("${1}://${2}${3}"),
+		Action:       "replace",
+	})
+	rcs = appendCopyRelabelConfig(rcs, "__meta_kubernetes_namespace", "namespace")
+	rcs = appendCopyRelabelConfig(rcs, "__meta_kubernetes_ingress_name", "ingress")
+	rcs = append(rcs, normalizeRelabelConfigs(ig.RelabelingConfigs)...)
+	job.RelabelConfigs = p.appendProbeRelabelConfigs(rcs)
+	return job, nil
+}
+
+// appendLabelSelectorRelabelConfigs appends relabel configs, which keep only targets matching ls, to rcs and returns the result.
+//
+// prefix is the prefix for meta labels with object labels such as `__meta_kubernetes_service`.
+func appendLabelSelectorRelabelConfigs(rcs []promrelabel.RelabelConfig, prefix string, ls *LabelSelector) []promrelabel.RelabelConfig {
+	keys := make([]string, 0, len(ls.MatchLabels))
+	for k := range ls.MatchLabels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		rcs = appendKeepRelabelConfig(rcs, prefix+"_label_"+discoveryutils.SanitizeLabelName(k), regexp.QuoteMeta(ls.MatchLabels[k]))
+	}
+	for _, e := range ls.MatchExpressions {
+		ln := discoveryutils.SanitizeLabelName(e.Key)
+		values := make([]string, len(e.Values))
+		for i, v := range e.Values {
+			values[i] = regexp.QuoteMeta(v)
+		}
+		switch e.Operator {
+		case "In":
+			rcs = appendKeepRelabelConfig(rcs, prefix+"_label_"+ln, strings.Join(values, "|"))
+		case "NotIn":
+			rcs = append(rcs, promrelabel.RelabelConfig{
+				SourceLabels: []string{prefix + "_label_" + ln},
+				Regex:        newString(strings.Join(values, "|")),
+				Action:       "drop",
+			})
+		case "Exists":
+			rcs = appendKeepRelabelConfig(rcs, prefix+"_labelpresent_"+ln, "true")
+		case "DoesNotExist":
+			rcs = append(rcs, promrelabel.RelabelConfig{
+				SourceLabels: []string{prefix + "_labelpresent_" + ln},
+				Regex:        newString("true"),
+				Action:       "drop",
+			})
+		}
+	}
+	return rcs
+}
+
+func appendTargetPortRelabelConfig(rcs []promrelabel.RelabelConfig, targetPort interface{}) []promrelabel.RelabelConfig {
+	switch v := targetPort.(type) {
+	case float64:
+		return appendKeepRelabelConfig(rcs, "__meta_kubernetes_pod_container_port_number", strconv.Itoa(int(v)))
+	case string:
+		return appendKeepRelabelConfig(rcs, "__meta_kubernetes_pod_container_port_name", regexp.QuoteMeta(v))
+	default:
+		return rcs
+	}
+}
+
+func appendEndpointLabelRelabelConfig(rcs []promrelabel.RelabelConfig, ep *CRDEndpoint) []promrelabel.RelabelConfig {
+	if ep.Port != "" {
+		return appendReplacementRelabelConfig(rcs, "endpoint", ep.Port)
+	}
+	switch v := ep.TargetPort.(type) {
+	case float64:
+		return appendReplacementRelabelConfig(rcs, "endpoint", strconv.Itoa(int(v)))
+	case string:
+		return appendReplacementRelabelConfig(rcs, "endpoint", v)
+	default:
+		return rcs
+	}
+}
+
+func appendKeepRelabelConfig(rcs []promrelabel.RelabelConfig, sourceLabel, regex string) []promrelabel.RelabelConfig {
+	return append(rcs, promrelabel.RelabelConfig{
+		SourceLabels: []string{sourceLabel},
+		Regex:        newString(regex),
+		Action:       "keep",
+	})
+}
+
+// appendCopyRelabelConfig appends relabel config, which copies non-empty sourceLabel to targetLabel, to rcs and returns the result.
+func appendCopyRelabelConfig(rcs []promrelabel.RelabelConfig, sourceLabel, targetLabel string) []promrelabel.RelabelConfig {
+	return append(rcs, promrelabel.RelabelConfig{
+		SourceLabels: []string{sourceLabel},
+		Regex:        newString("(.+)"),
+		TargetLabel:  targetLabel,
+		Replacement:  newString("$1"),
+		Action:       "replace",
+	})
+}
+
+func appendReplacementRelabelConfig(rcs []promrelabel.RelabelConfig, targetLabel, replacement string) []promrelabel.RelabelConfig {
+	return append(rcs, promrelabel.RelabelConfig{
+		TargetLabel: targetLabel,
+		Replacement: newString(replacement),
+		Action:      "replace",
+	})
+}
+
+// normalizeRelabelConfigs converts rcs from prometheus-operator format to Prometheus format.
+//
+// prometheus-operator accepts actions in any case, while Prometheus accepts only lowercase actions.
+func normalizeRelabelConfigs(rcs []promrelabel.RelabelConfig) []promrelabel.RelabelConfig {
+	if len(rcs) == 0 {
+		return nil
+	}
+	result := make([]promrelabel.RelabelConfig, len(rcs))
+	for i, rc := range rcs {
+		rc.Action = strings.ToLower(rc.Action)
+		result[i] = rc
+	}
+	return result
+}
+
+// parseCRDDuration parses duration in Prometheus format such as `30s` or `1m`.
+//
+// Zero duration is returned for empty s.
+func parseCRDDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("duration cannot be negative; got %s", s)
+	}
+	return d, nil
+}
+
+func newString(s string) *string {
+	return &s
+}
@@ -0,0 +1,301 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
+)
+
+func TestCRDConfigValidate(t *testing.T) {
+	f := func(kinds []string, isValid bool) {
+		t.Helper()
+		cc := &CRDConfig{
+			Kinds: kinds,
+		}
+		err := cc.Validate()
+		if isValid && err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if !isValid && err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+	f(nil, true)
+	f([]string{"servicemonitor", "probe"}, true)
+	f([]string{"ServiceMonitor"}, false)
+	f([]string{"prometheusrule"}, false)
+}
+
+func TestServiceMonitorNewScrapeJob(t *testing.T) {
+	data := `
+{
+  "metadata": {"name": "app", "namespace": "monitoring"},
+  "spec": {
+    "jobLabel": "app.kubernetes.io/name",
+    "targetLabels": ["team"],
+    "selector": {
+      "matchLabels": {"app": "foo"},
+      "matchExpressions": [{"key": "tier", "operator": "NotIn", "values": ["cache"]}]
+    },
+    "namespaceSelector": {"matchNames": ["default"]},
+    "sampleLimit": 1000,
+    "endpoints": [{
+      "port": "web",
+      "path": "/metrics2",
+      "interval": "15s",
+      "relabelings": [{"sourceLabels": ["__meta_kubernetes_pod_node_name"], "targetLabel": "node", "action": "Replace"}]
+    }]
+  }
+}`
+	var sm ServiceMonitor
+	if err := json.Unmarshal([]byte(data), &sm); err != nil {
+		t.Fatalf("cannot unmarshal ServiceMonitor: %s", err)
+	}
+	cc := &CRDConfig{
+		APIServer: "http://localhost:8080",
+	}
+	job, err := sm.newScrapeJob(cc, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if job.JobName != "serviceMonitor/monitoring/app/0" {
+		t.Fatalf("unexpected JobName: %q", job.JobName)
+	}
+	if job.MetricsPath != "/metrics2" {
+		t.Fatalf("unexpected MetricsPath: %q", job.MetricsPath)
+	}
+	if job.ScrapeInterval != 15*time.Second {
+		t.Fatalf("unexpected ScrapeInterval: %s", job.ScrapeInterval)
+	}
+	if job.SampleLimit != 1000 {
+		t.Fatalf("unexpected SampleLimit: %d", job.SampleLimit)
+	}
+	if job.SDConfig.Role != "endpoints" || job.SDConfig.APIServer != cc.APIServer {
+		t.Fatalf("unexpected SDConfig: %+v", job.SDConfig)
+	}
+	if !reflect.DeepEqual(job.SDConfig.Namespaces.Names, []string{"default"}) {
+		t.Fatalf("unexpected namespaces: %q", job.SDConfig.Namespaces.Names)
+	}
+	pcs, err := promrelabel.ParseRelabelConfigs(job.RelabelConfigs)
+	if err != nil {
+		t.Fatalf("cannot parse relabel configs: %s", err)
+	}
+
+	f := func(m map[string]string, resultExpected map[string]string) {
+		t.Helper()
+		labels := pcs.Apply(mapToLabels(m), 0, false)
+		labels = promrelabel.RemoveMetaLabels(nil, labels)
+		result := labelsToMap(labels)
+		if !reflect.DeepEqual(result, resultExpected) {
+			t.Fatalf("unexpected labels;\ngot\n%v\nwant\n%v", result, resultExpected)
+		}
+	}
+
+	// Matching target
+	f(map[string]string{
+		"__address__":                                            "10.0.0.1:8080",
+		"__meta_kubernetes_namespace":                            "default",
+		"__meta_kubernetes_service_name":                         "foo-svc",
+		"__meta_kubernetes_service_label_app":                    "foo",
+		"__meta_kubernetes_service_label_team":                   "infra",
+		"__meta_kubernetes_service_label_app_kubernetes_io_name": "foo-app",
+		"__meta_kubernetes_endpoint_port_name":                   "web",
+		"__meta_kubernetes_pod_name":                             "foo-1",
+		"__meta_kubernetes_pod_container_name":                   "main",
+		"__meta_kubernetes_pod_node_name":                        "node-1",
+	}, map[string]string{
+		"__address__": "10.0.0.1:8080",
+		"namespace":   "default",
+		"service":     "foo-svc",
+		"pod":         "foo-1",
+		"container":   "main",
+		"team":        "infra",
+		"job":         "foo-app",
+		"endpoint":    "web",
+		"node":        "node-1",
+	})
+
+	// Missing jobLabel
+	f(map[string]string{
+		"__address__":                          "10.0.0.1:8080",
+		"__meta_kubernetes_namespace":          "default",
+		"__meta_kubernetes_service_name":       "foo-svc",
+		"__meta_kubernetes_service_label_app":  "foo",
+		"__meta_kubernetes_endpoint_port_name": "web",
+	}, map[string]string{
+		"__address__": "10.0.0.1:8080",
+		"namespace":   "default",
+		"service":     "foo-svc",
+		"job":         "foo-svc",
+		"endpoint":    "web",
+	})
+
+	// Non-matching port
+	f(map[string]string{
+		"__address__":                          "10.0.0.1:9090",
+		"__meta_kubernetes_service_label_app":  "foo",
+		"__meta_kubernetes_endpoint_port_name": "grpc",
+	}, map[string]string{})
+
+	// Non-matching selector
+	f(map[string]string{
+		"__address__":                          "10.0.0.1:8080",
+		"__meta_kubernetes_service_label_app":  "bar",
+		"__meta_kubernetes_endpoint_port_name": "web",
+	}, map[string]string{})
+	f(map[string]string{
+		"__address__":                          "10.0.0.1:8080",
+		"__meta_kubernetes_service_label_app":  "foo",
+		"__meta_kubernetes_service_label_tier": "cache",
+		"__meta_kubernetes_endpoint_port_name": "web",
+	}, map[string]string{})
+}
+
+func TestPodMonitorNewScrapeJob(t *testing.T) {
+	data := `
+{
+  "metadata": {"name": "app", "namespace": "monitoring"},
+  "spec": {
+    "selector": {"matchExpressions": [{"key": "app", "operator": "Exists"}]},
+    "namespaceSelector": {"any": true},
+    "podMetricsEndpoints": [{"targetPort": 9100, "honorTimestamps": true}]
+  }
+}`
+	var pm PodMonitor
+	if err := json.Unmarshal([]byte(data), &pm); err != nil {
+		t.Fatalf("cannot unmarshal PodMonitor: %s", err)
+	}
+	job, err := pm.newScrapeJob(&CRDConfig{}, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if job.JobName != "podMonitor/monitoring/app/0" {
+		t.Fatalf("unexpected JobName: %q", job.JobName)
+	}
+	if !job.HonorTimestamps {
+		t.Fatalf("expecting HonorTimestamps")
+	}
+	if job.SDConfig.Role != "pod" || len(job.SDConfig.Namespaces.Names) != 0 {
+		t.Fatalf("unexpected SDConfig: %+v", job.SDConfig)
+	}
+	pcs, err := promrelabel.ParseRelabelConfigs(job.RelabelConfigs)
+	if err != nil {
+		t.Fatalf("cannot parse relabel configs: %s", err)
+	}
+	labels := pcs.Apply(mapToLabels(map[string]string{
+		"__address__":                                 "10.0.0.2:9100",
+		"__meta_kubernetes_namespace":                 "default",
+		"__meta_kubernetes_pod_name":                  "foo-1",
+		"__meta_kubernetes_pod_labelpresent_app":      "true",
+		"__meta_kubernetes_pod_container_port_number": "9100",
+	}), 0, false)
+	result := labelsToMap(promrelabel.RemoveMetaLabels(nil, labels))
+	resultExpected := map[string]string{
+		"__address__": "10.0.0.2:9100",
+		"namespace":   "default",
+		"pod":         "foo-1",
+		"job":         "monitoring/app",
+		"endpoint":    "9100",
+	}
+	if !reflect.DeepEqual(result, resultExpected) {
+		t.Fatalf("unexpected labels;\ngot\n%v\nwant\n%v", result, resultExpected)
+	}
+}
+
+func TestProbeNewStaticScrapeJob(t *testing.T) {
+	data := `
+{
+  "metadata": {"name": "blackbox", "namespace": "monitoring"},
+  "spec": {
+    "jobName": "http-probe",
+    "module": "http_2xx",
+    "prober": {"url": "blackbox-exporter:9115"},
+    "targets": {"staticConfig": {"static": ["https://example.com"], "labels": {"env": "prod"}}}
+  }
+}`
+	var p Probe
+	if err := json.Unmarshal([]byte(data), &p); err != nil {
+		t.Fatalf("cannot unmarshal Probe: %s", err)
+	}
+	job, err := p.newStaticScrapeJob()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if job.JobName != "probe/monitoring/blackbox/static" {
+		t.Fatalf("unexpected JobName: %q", job.JobName)
+	}
+	if job.MetricsPath != "/probe" {
+		t.Fatalf("unexpected MetricsPath: %q", job.MetricsPath)
+	}
+	if !reflect.DeepEqual(job.Params, map[string][]string{"module": {"http_2xx"}}) {
+		t.Fatalf("unexpected Params: %v", job.Params)
+	}
+	if !reflect.DeepEqual(job.StaticTargets, []string{"https://example.com"}) {
+		t.Fatalf("unexpected StaticTargets: %q", job.StaticTargets)
+	}
+	pcs, err := promrelabel.ParseRelabelConfigs(job.RelabelConfigs)
+	if err != nil {
+		t.Fatalf("cannot parse relabel configs: %s", err)
+	}
+	labels := pcs.Apply(mapToLabels(map[string]string{
+		"__address__": "https://example.com",
+		"env":         "prod",
+		"job":         job.JobName,
+	}), 0, false)
+	result := labelsToMap(labels)
+	resultExpected := map[string]string{
+		"__address__":    "blackbox-exporter:9115",
+		"__param_target": "https://example.com",
+		"instance":       "https://example.com",
+		"env":            "prod",
+		"job":            "http-probe",
+	}
+	if !reflect.DeepEqual(result, resultExpected) {
+		t.Fatalf("unexpected labels;\ngot\n%v\nwant\n%v", result, resultExpected)
+	}
+
+	// Missing prober url
+	p.Spec.ProberSpec.URL = ""
+	if _, err := p.newStaticScrapeJob(); err == nil {
+		t.Fatalf("expecting non-nil error for missing prober url")
+	}
+}
+
+func TestEndpointNewScrapeJobFailure(t *testing.T) {
+	f := func(ep *CRDEndpoint) {
+		t.Helper()
+		if _, err := ep.newScrapeJob("foo"); err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+	f(&CRDEndpoint{Interval: "foo"})
+	f(&CRDEndpoint{Interval: "-1s"})
+	f(&CRDEndpoint{ScrapeTimeout: "1x"})
+}
+
+func mapToLabels(m map[string]string) []prompbmarshal.Label {
+	var labels []prompbmarshal.Label
+	for k, v := range m {
+		labels = append(labels, prompbmarshal.Label{
+			Name:  k,
+			Value: v,
+		})
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].Name < labels[j].Name
+	})
+	return labels
+}
+
+func labelsToMap(labels []prompbmarshal.Label) map[string]string {
+	m := make(map[string]string, len(labels))
+	for _, label := range labels {
+		m[label.Name] = label.Value
+	}
+	return m
+}
@@ -118,6 +118,12 @@ type EndpointPort struct {
 // parseEndpointsList parses EndpointsList from data.
 func parseEndpointsList(data []byte) (*EndpointsList, error) {
 	var esl EndpointsList
+	if err := unmarshalEndpointsListFast(data, &esl); err == nil {
+		return &esl, nil
+	}
+	// Fall back to encoding/json on unexpected JSON structure.
+	fastJSONFallbacks.Inc()
+	esl = EndpointsList{}
 	if err := json.Unmarshal(data, &esl); err != nil {
 		return nil, fmt.Errorf("cannot unmarshal EndpointsList from %q: %w", data, err)
 	}
@@ -0,0 +1,289 @@
+package kubernetes
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape/discoveryutils"
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/valyala/fastjson"
+)
+
+// Fast decoders for the hot k8s object lists.
+//
+// Decoding with encoding/json takes the majority of CPU time for service discovery in big clusters with frequently changing objects,
+// so PodList, EndpointsList and ServiceList are decoded with fastjson. Only the fields used for generating target labels are decoded.
+// The fast decoders return an error on unexpected JSON structure. In this case the caller must fall back to encoding/json,
+// which handles all the corner cases and returns detailed error messages.
+
+var fastJSONParserPool fastjson.ParserPool
+
+var fastJSONFallbacks = metrics.NewCounter(`vm_promscrape_discovery_kubernetes_json_fallbacks_total`)
+
+// unmarshalListFast calls f for each item in the `items` array of k8s object list in data.
+func unmarshalListFast(data []byte, f func(d *fastDecoder, v *fastjson.Value)) error {
+	p := fastJSONParserPool.Get()
+	defer fastJSONParserPool.Put(p)
+	v, err := p.ParseBytes(data)
+	if err != nil {
+		return err
+	}
+	if v.Type() != fastjson.TypeObject {
+		return fmt.Errorf("unexpected JSON type for object list: %s", v.Type())
+	}
+	var d fastDecoder
+	for _, item := range d.array(v, "items") {
+		f(&d, item)
+		if d.err != nil {
+			return d.err
+		}
+	}
+	return d.err
+}
+
+func unmarshalPodListFast(data []byte, pl *PodList) error {
+	return unmarshalListFast(data, func(d *fastDecoder, v *fastjson.Value) {
+		var p Pod
+		d.objectMeta(d.object(v, "metadata"), &p.Metadata)
+		if spec := d.object(v, "spec"); spec != nil {
+			p.Spec.NodeName = d.string(spec, "nodeName")
+			p.Spec.Containers = d.containers(spec, "containers")
+			p.Spec.InitContainers = d.containers(spec, "initContainers")
+		}
+		if status := d.object(v, "status"); status != nil {
+			p.Status.Phase = d.string(status, "phase")
+			p.Status.PodIP = d.string(status, "podIP")
+			p.Status.HostIP = d.string(status, "hostIP")
+			for _, c := range d.array(status, "conditions") {
+				p.Status.Conditions = append(p.Status.Conditions, PodCondition{
+					Type:   d.string(c, "type"),
+					Status: d.string(c, "status"),
+				})
+			}
+		}
+		pl.Items = append(pl.Items, p)
+	})
+}
+
+func unmarshalEndpointsListFast(data []byte, epl *EndpointsList) error {
+	return unmarshalListFast(data, func(d *fastDecoder, v *fastjson.Value) {
+		var eps Endpoints
+		d.objectMeta(d.object(v, "metadata"), &eps.Metadata)
+		for _, s := range d.array(v, "subsets") {
+			var ess EndpointSubset
+			ess.Addresses = d.endpointAddresses(s, "addresses")
+			ess.NotReadyAddresses = d.endpointAddresses(s, "notReadyAddresses")
+			for _, port := range d.array(s, "ports") {
+				ess.Ports = append(ess.Ports, EndpointPort{
+					AppProtocol: d.string(port, "appProtocol"),
+					Name:        d.string(port, "name"),
+					Port:        d.int(port, "port"),
+					Protocol:    d.string(port, "protocol"),
+				})
+			}
+			eps.Subsets = append(eps.Subsets, ess)
+		}
+		epl.Items = append(epl.Items, eps)
+	})
+}
+
+func unmarshalServiceListFast(data []byte, sl *ServiceList) error {
+	return unmarshalListFast(data, func(d *fastDecoder, v *fastjson.Value) {
+		var s Service
+		d.objectMeta(d.object(v, "metadata"), &s.Metadata)
+		if spec := d.object(v, "spec"); spec != nil {
+			s.Spec.ClusterIP = d.string(spec, "clusterIP")
+			s.Spec.ExternalName = d.string(spec, "externalName")
+			s.Spec.Type = d.string(spec, "type")
+			for _, port := range d.array(spec, "ports") {
+				s.Spec.Ports = append(s.Spec.Ports, ServicePort{
+					Name:     d.string(port, "name"),
+					Protocol: d.string(port, "protocol"),
+					Port:     d.int(port, "port"),
+				})
+			}
+		}
+		sl.Items = append(sl.Items, s)
+	})
+}
+
+// fastDecoder decodes fields from fastjson values.
+//
+// It remembers the first error, so the caller may check it after decoding all the needed fields.
+// Missing fields and fields with null values are decoded into zero values like encoding/json does.
+type fastDecoder struct {
+	err error
+}
+
+func (d *fastDecoder) get(v *fastjson.Value, key string) *fastjson.Value {
+	if d.err != nil || v == nil {
+		return nil
+	}
+	x := v.Get(key)
+	if x == nil || x.Type() == fastjson.TypeNull {
+		return nil
+	}
+	return x
+}
+
+func (d *fastDecoder) setError(key string, x *fastjson.Value, err error) {
+	d.err = fmt.Errorf("cannot decode %q field from %s: %w", key, x, err)
+}
+
+func (d *fastDecoder) string(v *fastjson.Value, key string) string {
+	x := d.get(v, key)
+	if x == nil {
+		return ""
+	}
+	b, err := x.StringBytes()
+	if err != nil {
+		d.setError(key, x, err)
+		return ""
+	}
+	// Copy b, since it refers to the parser memory, which is re-used after returning the parser to the pool.
+	return string(b)
+}
+
+func (d *fastDecoder) int(v *fastjson.Value, key string) int {
+	x := d.get(v, key)
+	if x == nil {
+		return 0
+	}
+	n, err := x.Int()
+	if err != nil {
+		d.setError(key, x, err)
+		return 0
+	}
+	return n
+}
+
+func (d *fastDecoder) bool(v *fastjson.Value, key string) bool {
+	x := d.get(v, key)
+	if x == nil {
+		return false
+	}
+	b, err := x.Bool()
+	if err != nil {
+		d.setError(key, x, err)
+		return false
+	}
+	return b
+}
+
+func (d *fastDecoder) object(v *fastjson.Value, key string) *fastjson.Value {
+	x := d.get(v, key)
+	if x == nil {
+		return nil
+	}
+	if x.Type() != fastjson.TypeObject {
+		d.setError(key, x, fmt.Errorf("value doesn't contain object; it contains %s", x.Type()))
+		return nil
+	}
+	return x
+}
+
+func (d *fastDecoder) array(v *fastjson.Value, key string) []*fastjson.Value {
+	x := d.get(v, key)
+	if x == nil {
+		return nil
+	}
+	a, err := x.Array()
+	if err != nil {
+		d.setError(key, x, err)
+		return nil
+	}
+	for _, item := range a {
+		if item.Type() != fastjson.TypeObject {
+			d.setError(key, x, fmt.Errorf("array item doesn't contain object; it contains %s", item.Type()))
+			return nil
+		}
+	}
+	return a
+}
+
+func (d *fastDecoder) sortedLabels(v *fastjson.Value, key string) discoveryutils.SortedLabels {
+	x := d.object(v, key)
+	if x == nil {
+		return nil
+	}
+	o, _ := x.Object()
+	labels := make([]prompbmarshal.Label, 0, o.Len())
+	o.Visit(func(k []byte, lv *fastjson.Value) {
+		if d.err != nil {
+			return
+		}
+		b, err := lv.StringBytes()
+		if err != nil {
+			d.setError(key, x, err)
+			return
+		}
+		labels = append(labels, prompbmarshal.Label{
+			Name:  string(k),
+			Value: string(b),
+		})
+	})
+	if d.err != nil {
+		return nil
+	}
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].Name < labels[j].Name
+	})
+	return labels
+}
+
+func (d *fastDecoder) objectMeta(v *fastjson.Value, om *ObjectMeta) {
+	if v == nil {
+		return
+	}
+	om.Name = d.string(v, "name")
+	om.Namespace = d.string(v, "namespace")
+	om.UID = d.string(v, "uid")
+	om.Labels = d.sortedLabels(v, "labels")
+	om.Annotations = d.sortedLabels(v, "annotations")
+	for _, or := range d.array(v, "ownerReferences") {
+		om.OwnerReferences = append(om.OwnerReferences, OwnerReference{
+			Name:       d.string(or, "name"),
+			Controller: d.bool(or, "controller"),
+			Kind:       d.string(or, "kind"),
+		})
+	}
+}
+
+func (d *fastDecoder) containers(v *fastjson.Value, key string) []Container {
+	var cs []Container
+	for _, x := range d.array(v, key) {
+		c := Container{
+			Name: d.string(x, "name"),
+		}
+		for _, port := range d.array(x, "ports") {
+			c.Ports = append(c.Ports, ContainerPort{
+				Name:          d.string(port, "name"),
+				ContainerPort: d.int(port, "containerPort"),
+				Protocol:      d.string(port, "protocol"),
+			})
+		}
+		cs = append(cs, c)
+	}
+	return cs
+}
+
+func (d *fastDecoder) endpointAddresses(v *fastjson.Value, key string) []EndpointAddress {
+	var eas []EndpointAddress
+	for _, x := range d.array(v, key) {
+		ea := EndpointAddress{
+			Hostname: d.string(x, "hostname"),
+			IP:       d.string(x, "ip"),
+			NodeName: d.string(x, "nodeName"),
+		}
+		if tr := d.object(x, "targetRef"); tr != nil {
+			ea.TargetRef = ObjectReference{
+				Kind:      d.string(tr, "kind"),
+				Name:      d.string(tr, "name"),
+				Namespace: d.string(tr, "namespace"),
+			}
+		}
+		eas = append(eas, ea)
+	}
+	return eas
+}
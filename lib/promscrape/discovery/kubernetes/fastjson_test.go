@@ -0,0 +1,138 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const testPodListJSON = `{
+  "kind": "PodList",
+  "items": [
+    {
+      "metadata": {
+        "name": "app-1",
+        "namespace": "default",
+        "uid": "a1",
+        "labels": {"app": "foo", "tier": "backend"},
+        "annotations": {"prometheus.io/scrape": "true"},
+        "ownerReferences": [{"kind": "ReplicaSet", "name": "app", "controller": true}]
+      },
+      "spec": {
+        "nodeName": "node-1",
+        "containers": [{"name": "app", "image": "foo:latest", "ports": [{"name": "http", "containerPort": 8080, "protocol": "TCP"}]}],
+        "initContainers": [{"name": "init"}]
+      },
+      "status": {
+        "phase": "Running",
+        "podIP": "10.0.0.1",
+        "hostIP": "192.168.0.1",
+        "conditions": [{"type": "Ready", "status": "True", "lastProbeTime": null}]
+      }
+    },
+    {
+      "metadata": {"name": "app-2", "namespace": "default", "labels": {}},
+      "spec": {"nodeName": "node-2"},
+      "status": {"phase": "Pending"}
+    }
+  ]
+}`
+
+const testEndpointsListJSON = `{
+  "kind": "EndpointsList",
+  "items": [
+    {
+      "metadata": {"name": "app", "namespace": "default", "labels": {"app": "foo"}},
+      "subsets": [
+        {
+          "addresses": [{"ip": "10.0.0.1", "hostname": "app-1", "nodeName": "node-1", "targetRef": {"kind": "Pod", "name": "app-1", "namespace": "default"}}],
+          "notReadyAddresses": [{"ip": "10.0.0.2"}],
+          "ports": [{"name": "http", "port": 8080, "protocol": "TCP", "appProtocol": "http"}]
+        }
+      ]
+    }
+  ]
+}`
+
+const testServiceListJSON = `{
+  "kind": "ServiceList",
+  "items": [
+    {
+      "metadata": {"name": "app", "namespace": "default", "annotations": {"foo": "bar"}},
+      "spec": {
+        "clusterIP": "10.96.0.10",
+        "type": "ClusterIP",
+        "ports": [{"name": "http", "port": 80, "protocol": "TCP", "targetPort": "http"}]
+      }
+    },
+    {
+      "metadata": {"name": "ext", "namespace": "default"},
+      "spec": {"externalName": "example.com", "type": "ExternalName"}
+    }
+  ]
+}`
+
+func TestUnmarshalListFastMatchesEncodingJSON(t *testing.T) {
+	f := func(data string, fast func(data []byte) (interface{}, error), dst interface{}) {
+		t.Helper()
+		result, err := fast([]byte(data))
+		if err != nil {
+			t.Fatalf("unexpected error in fast decoder: %s", err)
+		}
+		if err := json.Unmarshal([]byte(data), dst); err != nil {
+			t.Fatalf("unexpected error in encoding/json: %s", err)
+		}
+		if !reflect.DeepEqual(result, dst) {
+			t.Fatalf("fast decoder result mismatch\ngot\n%#v\nwant\n%#v", result, dst)
+		}
+	}
+	f(testPodListJSON, func(data []byte) (interface{}, error) {
+		var pl PodList
+		err := unmarshalPodListFast(data, &pl)
+		return &pl, err
+	}, &PodList{})
+	f(testEndpointsListJSON, func(data []byte) (interface{}, error) {
+		var epl EndpointsList
+		err := unmarshalEndpointsListFast(data, &epl)
+		return &epl, err
+	}, &EndpointsList{})
+	f(testServiceListJSON, func(data []byte) (interface{}, error) {
+		var sl ServiceList
+		err := unmarshalServiceListFast(data, &sl)
+		return &sl, err
+	}, &ServiceList{})
+}
+
+func TestUnmarshalListFastFailure(t *testing.T) {
+	f := func(data string) {
+		t.Helper()
+		var pl PodList
+		if err := unmarshalPodListFast([]byte(data), &pl); err == nil {
+			t.Fatalf("expecting non-nil error for %s", data)
+		}
+	}
+	f(``)
+	f(`[]`)
+	f(`{"items":{}}`)
+	f(`{"items":[null]}`)
+	f(`{"items":[{"metadata":"foo"}]}`)
+	f(`{"items":[{"metadata":{"labels":{"foo":1}}}]}`)
+	f(`{"items":[{"spec":{"containers":[{"ports":[{"containerPort":"http"}]}]}}]}`)
+	f(`{"items":[{"metadata":{"ownerReferences":[{"controller":"true"}]}}]}`)
+}
+
+func TestParsePodListFallback(t *testing.T) {
+	// The fast decoder doesn't support null items, while encoding/json decodes them into zero values.
+	data := `{"items":[null,{"metadata":{"name":"foo"}}]}`
+	n := fastJSONFallbacks.Get()
+	pl, err := parsePodList([]byte(data))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(pl.Items) != 2 || pl.Items[1].Metadata.Name != "foo" {
+		t.Fatalf("unexpected pods: %#v", pl.Items)
+	}
+	if fastJSONFallbacks.Get() != n+1 {
+		t.Fatalf("expecting fallback to encoding/json")
+	}
+}
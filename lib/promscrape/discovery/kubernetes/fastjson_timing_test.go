@@ -0,0 +1,82 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func BenchmarkParsePodList(b *testing.B) {
+	data := []byte(newTestPodListJSON(1000))
+	b.Run("fastjson", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(data)))
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				var pl PodList
+				if err := unmarshalPodListFast(data, &pl); err != nil {
+					panic(fmt.Errorf("unexpected error: %w", err))
+				}
+			}
+		})
+	})
+	b.Run("encoding/json", func(b *testing.B) {
+		b.ReportAllocs()
+		b.SetBytes(int64(len(data)))
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				var pl PodList
+				if err := json.Unmarshal(data, &pl); err != nil {
+					panic(fmt.Errorf("unexpected error: %w", err))
+				}
+			}
+		})
+	})
+}
+
+// newTestPodListJSON returns PodList JSON with n pods resembling real pods with many fields unused by service discovery.
+func newTestPodListJSON(n int) string {
+	var items []string
+	for i := 0; i < n; i++ {
+		items = append(items, fmt.Sprintf(`{
+  "metadata": {
+    "name": "app-%d",
+    "namespace": "default",
+    "uid": "2a5b4b5d-%d",
+    "resourceVersion": "%d",
+    "creationTimestamp": "2021-03-16T20:44:30Z",
+    "labels": {"app": "foo", "pod-template-hash": "5d8f7b9c6", "tier": "backend"},
+    "annotations": {"prometheus.io/scrape": "true", "prometheus.io/port": "8080"},
+    "ownerReferences": [{"apiVersion": "apps/v1", "kind": "ReplicaSet", "name": "app-5d8f7b9c6", "uid": "b48dd901", "controller": true}]
+  },
+  "spec": {
+    "volumes": [{"name": "token", "secret": {"secretName": "default-token", "defaultMode": 420}}],
+    "containers": [{
+      "name": "app",
+      "image": "foo:latest",
+      "args": ["-httpListenAddr=:8080"],
+      "ports": [{"name": "http", "containerPort": 8080, "protocol": "TCP"}],
+      "resources": {"limits": {"cpu": "1", "memory": "1Gi"}},
+      "volumeMounts": [{"name": "token", "readOnly": true, "mountPath": "/var/run/secrets"}],
+      "imagePullPolicy": "Always"
+    }],
+    "restartPolicy": "Always",
+    "nodeName": "node-%d",
+    "schedulerName": "default-scheduler"
+  },
+  "status": {
+    "phase": "Running",
+    "conditions": [
+      {"type": "Initialized", "status": "True", "lastProbeTime": null, "lastTransitionTime": "2021-03-16T20:44:30Z"},
+      {"type": "Ready", "status": "True", "lastProbeTime": null, "lastTransitionTime": "2021-03-16T20:44:35Z"}
+    ],
+    "hostIP": "192.168.0.%d",
+    "podIP": "10.0.%d.%d",
+    "startTime": "2021-03-16T20:44:30Z",
+    "containerStatuses": [{"name": "app", "ready": true, "restartCount": 0, "image": "foo:latest"}]
+  }
+}`, i, i, i, i%10, i%256, i/256, i%256))
+	}
+	return `{"kind":"PodList","apiVersion":"v1","metadata":{"resourceVersion":"1"},"items":[` + strings.Join(items, ",") + `]}`
+}
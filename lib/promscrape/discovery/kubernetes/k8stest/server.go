@@ -0,0 +1,450 @@
+// Package k8stest provides fake Kubernetes API server for testing service discovery.
+package k8stest
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// EventType is the type of watch event.
+//
+// See https://kubernetes.io/docs/reference/using-api/api-concepts/#efficient-detection-of-changes
+type EventType string
+
+// Supported event types.
+const (
+	Added    EventType = "ADDED"
+	Modified EventType = "MODIFIED"
+	Deleted  EventType = "DELETED"
+)
+
+// Event is a scripted change for objects served by Server.
+type Event struct {
+	Type EventType
+
+	// Object is JSON-encoded k8s object. It must contain `metadata.name`.
+	Object string
+}
+
+// Server is a fake Kubernetes API server for tests.
+//
+// It serves objects registered via Apply at the given cluster-wide paths such as `/api/v1/pods`
+// or `/apis/discovery.k8s.io/v1beta1/endpointslices`. The following requests are supported:
+//
+//   - list: `GET <path>` and `GET <path with /namespaces/<ns>>`
+//   - get: `GET <path with /namespaces/<ns>>/<name>`
+//   - watch: list paths with `watch=1` query arg. Events are streamed starting after `resourceVersion` query arg.
+//     Synthetic ADDED events for the existing objects are sent first if `resourceVersion` is missing or zero.
+//
+// Responses for list and get requests are gzipped if the client accepts gzip.
+// Watch requests with `resourceVersion` older than the last Compact call receive `410 Gone` error event
+// in the same way as the real API server does. Label and field selectors are ignored.
+type Server struct {
+	// URL is the address of the server in the form http://ipaddr:port
+	URL string
+
+	s *httptest.Server
+
+	mu sync.Mutex
+
+	// rv is the resourceVersion of the last applied event.
+	rv int
+
+	// minRV is the minimum resourceVersion watches can be started from.
+	minRV int
+
+	// resources contains objects and event history per each cluster-wide path.
+	resources map[string]*resource
+
+	// changeCh is closed and re-created on every Apply call in order to notify watchers.
+	changeCh chan struct{}
+
+	// stopCh is closed on Close in order to stop watchers.
+	stopCh chan struct{}
+
+	requests []string
+}
+
+type resource struct {
+	// keys contains object keys in the order of addition.
+	keys    []string
+	objects map[string]map[string]interface{}
+	events  []storedEvent
+}
+
+type storedEvent struct {
+	rv        int
+	namespace string
+	data      []byte
+}
+
+// NewServer starts new fake Kubernetes API server.
+//
+// The caller must call Close when the server is no longer needed.
+func NewServer() *Server {
+	s := &Server{
+		resources: make(map[string]*resource),
+		changeCh:  make(chan struct{}),
+		stopCh:    make(chan struct{}),
+	}
+	s.s = httptest.NewServer(http.HandlerFunc(s.handle))
+	s.URL = s.s.URL
+	return s
+}
+
+// Close stops s and terminates all the active watch requests.
+func (s *Server) Close() {
+	close(s.stopCh)
+	s.s.Close()
+}
+
+// Apply applies the given events to objects at the given cluster-wide path and delivers them to active watchers.
+//
+// Every event increments the resourceVersion of s.
+func (s *Server) Apply(path string, events ...Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := s.resources[path]
+	if res == nil {
+		res = &resource{
+			objects: make(map[string]map[string]interface{}),
+		}
+		s.resources[path] = res
+	}
+	for _, e := range events {
+		if err := s.applyLocked(res, e); err != nil {
+			return err
+		}
+	}
+	close(s.changeCh)
+	s.changeCh = make(chan struct{})
+	return nil
+}
+
+// MustApply is like Apply, but panics on error.
+func (s *Server) MustApply(path string, events ...Event) {
+	if err := s.Apply(path, events...); err != nil {
+		panic(fmt.Errorf("BUG: %w", err))
+	}
+}
+
+func (s *Server) applyLocked(res *resource, e Event) error {
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(e.Object), &obj); err != nil {
+		return fmt.Errorf("cannot parse object %q: %w", e.Object, err)
+	}
+	md, _ := obj["metadata"].(map[string]interface{})
+	if md == nil {
+		md = make(map[string]interface{})
+		obj["metadata"] = md
+	}
+	name, _ := md["name"].(string)
+	if name == "" {
+		return fmt.Errorf("missing metadata.name in object %q", e.Object)
+	}
+	namespace, _ := md["namespace"].(string)
+	key := namespace + "/" + name
+	s.rv++
+	md["resourceVersion"] = strconv.Itoa(s.rv)
+	switch e.Type {
+	case Added, Modified:
+		if _, ok := res.objects[key]; !ok {
+			res.keys = append(res.keys, key)
+		}
+		res.objects[key] = obj
+	case Deleted:
+		if _, ok := res.objects[key]; !ok {
+			return fmt.Errorf("cannot delete missing object %q", key)
+		}
+		delete(res.objects, key)
+		keys := res.keys[:0]
+		for _, k := range res.keys {
+			if k != key {
+				keys = append(keys, k)
+			}
+		}
+		res.keys = keys
+	default:
+		return fmt.Errorf("unsupported event type %q", e.Type)
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"type":   e.Type,
+		"object": obj,
+	})
+	if err != nil {
+		return fmt.Errorf("cannot marshal event: %w", err)
+	}
+	res.events = append(res.events, storedEvent{
+		rv:        s.rv,
+		namespace: namespace,
+		data:      data,
+	})
+	return nil
+}
+
+// Compact drops the event history, so watch requests with resourceVersion older than the current one receive `410 Gone` error.
+//
+// This simulates etcd compaction at the API server.
+func (s *Server) Compact() {
+	s.mu.Lock()
+	s.minRV = s.rv
+	for _, res := range s.resources {
+		res.events = nil
+	}
+	s.mu.Unlock()
+}
+
+// ResourceVersion returns the resourceVersion of the last applied event.
+func (s *Server) ResourceVersion() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return strconv.Itoa(s.rv)
+}
+
+// Requests returns request uris received by s so far.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.requests...)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r.URL.RequestURI())
+	s.mu.Unlock()
+
+	path, namespace, name := splitPath(r.URL.Path)
+	s.mu.Lock()
+	res := s.resources[path]
+	s.mu.Unlock()
+	if res == nil {
+		writeStatus(w, r, http.StatusNotFound, "NotFound", fmt.Sprintf("the server could not find the requested resource %q", r.URL.Path))
+		return
+	}
+	if name != "" {
+		s.serveGet(w, r, res, namespace, name)
+		return
+	}
+	if v := r.FormValue("watch"); v == "1" || v == "true" {
+		s.serveWatch(w, r, res, namespace)
+		return
+	}
+	s.serveList(w, r, res, namespace)
+}
+
+func (s *Server) serveGet(w http.ResponseWriter, r *http.Request, res *resource, namespace, name string) {
+	s.mu.Lock()
+	obj, ok := res.objects[namespace+"/"+name]
+	var data []byte
+	var err error
+	if ok {
+		data, err = json.Marshal(obj)
+	}
+	s.mu.Unlock()
+	if !ok {
+		writeStatus(w, r, http.StatusNotFound, "NotFound", fmt.Sprintf("%q not found", name))
+		return
+	}
+	if err != nil {
+		writeStatus(w, r, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+	writeResponse(w, r, http.StatusOK, data)
+}
+
+func (s *Server) serveList(w http.ResponseWriter, r *http.Request, res *resource, namespace string) {
+	s.mu.Lock()
+	items := make([]interface{}, 0, len(res.keys))
+	for _, key := range res.keys {
+		if namespace != "" && !strings.HasPrefix(key, namespace+"/") {
+			continue
+		}
+		items = append(items, res.objects[key])
+	}
+	data, err := json.Marshal(map[string]interface{}{
+		"kind":       "List",
+		"apiVersion": "v1",
+		"metadata": map[string]interface{}{
+			"resourceVersion": strconv.Itoa(s.rv),
+		},
+		"items": items,
+	})
+	s.mu.Unlock()
+	if err != nil {
+		writeStatus(w, r, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+	writeResponse(w, r, http.StatusOK, data)
+}
+
+func (s *Server) serveWatch(w http.ResponseWriter, r *http.Request, res *resource, namespace string) {
+	rv := 0
+	if v := r.FormValue("resourceVersion"); v != "" && v != "0" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			writeStatus(w, r, http.StatusBadRequest, "BadRequest", fmt.Sprintf("cannot parse resourceVersion %q: %s", v, err))
+			return
+		}
+		rv = n
+	}
+	var timeoutCh <-chan time.Time
+	if v := r.FormValue("timeoutSeconds"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			writeStatus(w, r, http.StatusBadRequest, "BadRequest", fmt.Sprintf("cannot parse timeoutSeconds %q: %s", v, err))
+			return
+		}
+		t := time.NewTimer(time.Duration(n) * time.Second)
+		defer t.Stop()
+		timeoutCh = t.C
+	}
+	flusher, _ := w.(http.Flusher)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if rv == 0 {
+		// Start with synthetic ADDED events for the existing objects like the real API server does.
+		s.mu.Lock()
+		var events [][]byte
+		for _, key := range res.keys {
+			if namespace != "" && !strings.HasPrefix(key, namespace+"/") {
+				continue
+			}
+			data, err := json.Marshal(map[string]interface{}{
+				"type":   Added,
+				"object": res.objects[key],
+			})
+			if err != nil {
+				s.mu.Unlock()
+				return
+			}
+			events = append(events, data)
+		}
+		rv = s.rv
+		s.mu.Unlock()
+		for _, data := range events {
+			if _, err := w.Write(append(data, '\n')); err != nil {
+				return
+			}
+		}
+	}
+	for {
+		s.mu.Lock()
+		if rv != 0 && rv < s.minRV {
+			s.mu.Unlock()
+			// The real API server returns `410 Gone` via ERROR event for watch requests.
+			// See https://kubernetes.io/docs/reference/using-api/api-concepts/#410-gone-responses
+			data := mustMarshalStatus(http.StatusGone, "Expired", fmt.Sprintf("too old resource version: %d (%d)", rv, s.minRV))
+			fmt.Fprintf(w, `{"type":"ERROR","object":%s}`+"\n", data)
+			return
+		}
+		var events [][]byte
+		for _, e := range res.events {
+			if e.rv > rv && (namespace == "" || e.namespace == namespace) {
+				events = append(events, e.data)
+			}
+		}
+		if s.rv > rv {
+			rv = s.rv
+		}
+		changeCh := s.changeCh
+		s.mu.Unlock()
+
+		for _, data := range events {
+			if _, err := w.Write(append(data, '\n')); err != nil {
+				return
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		select {
+		case <-changeCh:
+		case <-timeoutCh:
+			return
+		case <-r.Context().Done():
+			return
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+// splitPath splits the given request path into cluster-wide path, namespace and object name.
+//
+// For example, `/api/v1/namespaces/default/pods/foo` is split into `/api/v1/pods`, `default` and `foo`.
+func splitPath(path string) (string, string, string) {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i := 0; i+2 < len(parts); i++ {
+		if parts[i] != "namespaces" {
+			continue
+		}
+		tail := parts[i+2:]
+		if len(tail) > 2 {
+			break
+		}
+		clusterPath := "/" + strings.Join(append(append([]string{}, parts[:i]...), tail[0]), "/")
+		name := ""
+		if len(tail) == 2 {
+			name = tail[1]
+		}
+		return clusterPath, parts[i+1], name
+	}
+	return path, "", ""
+}
+
+func writeStatus(w http.ResponseWriter, r *http.Request, statusCode int, reason, message string) {
+	writeResponse(w, r, statusCode, mustMarshalStatus(statusCode, reason, message))
+}
+
+func mustMarshalStatus(statusCode int, reason, message string) []byte {
+	data, err := json.Marshal(map[string]interface{}{
+		"kind":       "Status",
+		"apiVersion": "v1",
+		"status":     "Failure",
+		"message":    message,
+		"reason":     reason,
+		"code":       statusCode,
+	})
+	if err != nil {
+		panic(fmt.Errorf("BUG: cannot marshal status: %w", err))
+	}
+	return data
+}
+
+func writeResponse(w http.ResponseWriter, r *http.Request, statusCode int, data []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		w.WriteHeader(statusCode)
+		_, _ = w.Write(data)
+		return
+	}
+	w.Header().Set("Content-Encoding", "gzip")
+	w.WriteHeader(statusCode)
+	zw := gzip.NewWriter(w)
+	_, _ = zw.Write(data)
+	_ = zw.Close()
+}
+
+// ReadWatchEvents reads up to n events from the given watch response body.
+//
+// It is intended for verifying watch responses in tests.
+func ReadWatchEvents(r io.Reader, n int) ([]map[string]interface{}, error) {
+	d := json.NewDecoder(r)
+	var events []map[string]interface{}
+	for len(events) < n {
+		var e map[string]interface{}
+		if err := d.Decode(&e); err != nil {
+			return events, err
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
@@ -0,0 +1,143 @@
+package k8stest
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestServerListAndGet(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.MustApply("/api/v1/pods",
+		Event{Type: Added, Object: `{"metadata":{"name":"foo","namespace":"default"}}`},
+		Event{Type: Added, Object: `{"metadata":{"name":"bar","namespace":"kube-system"}}`},
+	)
+
+	f := func(path, acceptEncoding string, statusCodeExpected int, respExpected string) {
+		t.Helper()
+		req, err := http.NewRequest("GET", s.URL+path, nil)
+		if err != nil {
+			t.Fatalf("cannot create request: %s", err)
+		}
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		resp, err := http.DefaultTransport.RoundTrip(req)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != statusCodeExpected {
+			t.Fatalf("unexpected status code for %q; got %d; want %d", path, resp.StatusCode, statusCodeExpected)
+		}
+		r := resp.Body
+		if resp.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(resp.Body)
+			if err != nil {
+				t.Fatalf("cannot read gzipped response: %s", err)
+			}
+			r = zr
+		}
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatalf("cannot read response: %s", err)
+		}
+		if respExpected != "" && string(data) != respExpected {
+			t.Fatalf("unexpected response for %q\ngot\n%s\nwant\n%s", path, data, respExpected)
+		}
+	}
+
+	f("/api/v1/pods", "", http.StatusOK, `{"apiVersion":"v1","items":[`+
+		`{"metadata":{"name":"foo","namespace":"default","resourceVersion":"1"}},`+
+		`{"metadata":{"name":"bar","namespace":"kube-system","resourceVersion":"2"}}],`+
+		`"kind":"List","metadata":{"resourceVersion":"2"}}`)
+	f("/api/v1/namespaces/default/pods", "gzip", http.StatusOK, `{"apiVersion":"v1","items":[`+
+		`{"metadata":{"name":"foo","namespace":"default","resourceVersion":"1"}}],`+
+		`"kind":"List","metadata":{"resourceVersion":"2"}}`)
+	f("/api/v1/namespaces/kube-system/pods/bar", "gzip", http.StatusOK, `{"metadata":{"name":"bar","namespace":"kube-system","resourceVersion":"2"}}`)
+	f("/api/v1/namespaces/default/pods/bar", "", http.StatusNotFound, "")
+	f("/api/v1/services", "", http.StatusNotFound, "")
+
+	s.MustApply("/api/v1/pods",
+		Event{Type: Deleted, Object: `{"metadata":{"name":"foo","namespace":"default"}}`},
+	)
+	f("/api/v1/pods", "", http.StatusOK, `{"apiVersion":"v1","items":[`+
+		`{"metadata":{"name":"bar","namespace":"kube-system","resourceVersion":"2"}}],`+
+		`"kind":"List","metadata":{"resourceVersion":"3"}}`)
+
+	if err := s.Apply("/api/v1/pods", Event{Type: Added, Object: `{"metadata":{}}`}); err == nil {
+		t.Fatalf("expecting non-nil error for object without name")
+	}
+	if err := s.Apply("/api/v1/pods", Event{Type: Deleted, Object: `{"metadata":{"name":"missing"}}`}); err == nil {
+		t.Fatalf("expecting non-nil error for deleting missing object")
+	}
+}
+
+func TestServerWatch(t *testing.T) {
+	s := NewServer()
+	defer s.Close()
+	s.MustApply("/api/v1/pods",
+		Event{Type: Added, Object: `{"metadata":{"name":"foo","namespace":"default"}}`},
+	)
+
+	watch := func(query string) *http.Response {
+		t.Helper()
+		resp, err := http.Get(s.URL + "/api/v1/pods?watch=1&" + query)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected status code; got %d; want %d", resp.StatusCode, http.StatusOK)
+		}
+		return resp
+	}
+	checkEvents := func(resp *http.Response, typesExpected ...string) []map[string]interface{} {
+		t.Helper()
+		events, err := ReadWatchEvents(resp.Body, len(typesExpected))
+		if err != nil {
+			t.Fatalf("cannot read watch events: %s", err)
+		}
+		for i, e := range events {
+			if e["type"] != typesExpected[i] {
+				t.Fatalf("unexpected type for event #%d; got %v; want %s", i, e["type"], typesExpected[i])
+			}
+		}
+		return events
+	}
+
+	// Watch without resourceVersion starts with the existing objects.
+	resp := watch("")
+	checkEvents(resp, "ADDED")
+	s.MustApply("/api/v1/pods",
+		Event{Type: Modified, Object: `{"metadata":{"name":"foo","namespace":"default"},"spec":{"nodeName":"node1"}}`},
+	)
+	checkEvents(resp, "MODIFIED")
+	_ = resp.Body.Close()
+
+	// Watch from the given resourceVersion
+	resp = watch("resourceVersion=1")
+	checkEvents(resp, "MODIFIED")
+	_ = resp.Body.Close()
+
+	// Watch from compacted resourceVersion
+	s.MustApply("/api/v1/pods",
+		Event{Type: Deleted, Object: `{"metadata":{"name":"foo","namespace":"default"}}`},
+	)
+	s.Compact()
+	resp = watch("resourceVersion=2")
+	events := checkEvents(resp, "ERROR")
+	_ = resp.Body.Close()
+	status := events[0]["object"].(map[string]interface{})
+	if code := status["code"]; code != float64(http.StatusGone) {
+		t.Fatalf("unexpected code in ERROR event; got %v; want %d", code, http.StatusGone)
+	}
+
+	// Watch from the current resourceVersion after compaction
+	resp = watch("resourceVersion=" + s.ResourceVersion() + "&timeoutSeconds=1")
+	if _, err := ReadWatchEvents(resp.Body, 1); err == nil {
+		t.Fatalf("expecting non-nil error when reading events from the stream closed after timeoutSeconds")
+	}
+	_ = resp.Body.Close()
+}
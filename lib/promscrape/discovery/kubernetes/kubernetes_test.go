@@ -0,0 +1,62 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape/discovery/kubernetes/k8stest"
+)
+
+func TestGetLabelsFromAPIServer(t *testing.T) {
+	s := k8stest.NewServer()
+	defer s.Close()
+	s.MustApply("/api/v1/pods",
+		k8stest.Event{Type: k8stest.Added, Object: `{"metadata":{"name":"foo","namespace":"default"},"status":{"podIP":"10.0.0.1"},"spec":{"containers":[{"name":"app"}]}}`},
+		k8stest.Event{Type: k8stest.Added, Object: `{"metadata":{"name":"bar","namespace":"kube-system"},"status":{"podIP":"10.0.0.2"},"spec":{"containers":[{"name":"app"}]}}`},
+	)
+
+	f := func(sdc *SDConfig, addrsExpected []string) {
+		t.Helper()
+		ms, err := GetLabels(sdc, ".")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		var addrs []string
+		for _, m := range ms {
+			addrs = append(addrs, m["__address__"])
+		}
+		if len(addrs) != len(addrsExpected) {
+			t.Fatalf("unexpected addresses; got %q; want %q", addrs, addrsExpected)
+		}
+		for i := range addrs {
+			if addrs[i] != addrsExpected[i] {
+				t.Fatalf("unexpected addresses; got %q; want %q", addrs, addrsExpected)
+			}
+		}
+	}
+
+	f(&SDConfig{
+		APIServer: s.URL,
+		Role:      "pod",
+	}, []string{"10.0.0.1", "10.0.0.2"})
+	f(&SDConfig{
+		APIServer: s.URL,
+		Role:      "pod",
+		Namespaces: Namespaces{
+			Names: []string{"kube-system"},
+		},
+	}, []string{"10.0.0.2"})
+
+	// Deleted pods must disappear from discovered targets.
+	s.MustApply("/api/v1/pods",
+		k8stest.Event{Type: k8stest.Deleted, Object: `{"metadata":{"name":"foo","namespace":"default"}}`},
+	)
+	f(&SDConfig{
+		APIServer: s.URL,
+		Role:      "pod",
+	}, []string{"10.0.0.2"})
+
+	// Missing objects
+	if _, err := GetLabels(&SDConfig{APIServer: s.URL, Role: "node"}, "."); err == nil {
+		t.Fatalf("expecting non-nil error for missing nodes")
+	}
+}
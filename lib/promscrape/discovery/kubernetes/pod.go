@@ -117,6 +117,12 @@ type PodCondition struct {
 // parsePodList parses PodList from data.
 func parsePodList(data []byte) (*PodList, error) {
 	var pl PodList
+	if err := unmarshalPodListFast(data, &pl); err == nil {
+		return &pl, nil
+	}
+	// Fall back to encoding/json on unexpected JSON structure.
+	fastJSONFallbacks.Inc()
+	pl = PodList{}
 	if err := json.Unmarshal(data, &pl); err != nil {
 		return nil, fmt.Errorf("cannot unmarshal PodList from %q: %w", data, err)
 	}
@@ -0,0 +1,62 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
+)
+
+func init() {
+	promauth.SetSecretReader(readSecret)
+}
+
+// secretsSDConfig is used for reading Secrets referenced in auth configs.
+//
+// It has empty APIServer, so Secrets are read from the API server of the k8s cluster vmagent runs in.
+var secretsSDConfig = &SDConfig{}
+
+// readSecret returns the value for the given key from the given Secret.
+func readSecret(namespace, name, key string) ([]byte, error) {
+	cfg, err := getAPIConfig(secretsSDConfig, ".")
+	if err != nil {
+		return nil, fmt.Errorf("cannot create API config: %w", err)
+	}
+	return readSecretFromAPI(cfg, namespace, name, key)
+}
+
+func readSecretFromAPI(cfg *apiConfig, namespace, name, key string) ([]byte, error) {
+	path := fmt.Sprintf("/api/v1/namespaces/%s/secrets/%s", url.PathEscape(namespace), url.PathEscape(name))
+	data, err := cfg.client.GetAPIResponse(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot obtain secret %s/%s from API server: %w", namespace, name, err)
+	}
+	s, err := parseSecret(data)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := s.Data[key]
+	if !ok {
+		return nil, fmt.Errorf("missing key %q in secret %s/%s", key, namespace, name)
+	}
+	return value, nil
+}
+
+// Secret represents k8s secret.
+//
+// See https://kubernetes.io/docs/reference/generated/kubernetes-api/v1.17/#secret-v1-core
+type Secret struct {
+	Metadata ObjectMeta
+	// Data contains base64-decoded values.
+	Data map[string][]byte
+}
+
+func parseSecret(data []byte) (*Secret, error) {
+	var s Secret
+	if err := json.Unmarshal(data, &s); err != nil {
+		// Do not include data in the error message, since it contains secret values.
+		return nil, fmt.Errorf("cannot unmarshal Secret: %w", err)
+	}
+	return &s, nil
+}
@@ -0,0 +1,44 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape/discovery/kubernetes/k8stest"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promscrape/discoveryutils"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/proxy"
+)
+
+func TestReadSecretFromAPI(t *testing.T) {
+	s := k8stest.NewServer()
+	defer s.Close()
+	// "Zm9vYmFy" is base64-encoded "foobar"
+	s.MustApply("/api/v1/secrets", k8stest.Event{
+		Type:   k8stest.Added,
+		Object: `{"kind":"Secret","metadata":{"name":"creds","namespace":"monitoring"},"data":{"token":"Zm9vYmFy"}}`,
+	})
+	client, err := discoveryutils.NewClient(s.URL, nil, proxy.URL{})
+	if err != nil {
+		t.Fatalf("cannot create client: %s", err)
+	}
+	cfg := &apiConfig{
+		client: client,
+	}
+
+	value, err := readSecretFromAPI(cfg, "monitoring", "creds", "token")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if string(value) != "foobar" {
+		t.Fatalf("unexpected value; got %q; want %q", value, "foobar")
+	}
+
+	// Missing key
+	if _, err := readSecretFromAPI(cfg, "monitoring", "creds", "password"); err == nil {
+		t.Fatalf("expecting non-nil error for missing key")
+	}
+
+	// Missing secret
+	if _, err := readSecretFromAPI(cfg, "monitoring", "missing", "token"); err == nil {
+		t.Fatalf("expecting non-nil error for missing secret")
+	}
+}
@@ -91,6 +91,12 @@ type ServicePort struct {
 // parseServiceList parses ServiceList from data.
 func parseServiceList(data []byte) (*ServiceList, error) {
 	var sl ServiceList
+	if err := unmarshalServiceListFast(data, &sl); err == nil {
+		return &sl, nil
+	}
+	// Fall back to encoding/json on unexpected JSON structure.
+	fastJSONFallbacks.Inc()
+	sl = ServiceList{}
 	if err := json.Unmarshal(data, &sl); err != nil {
 		return nil, fmt.Errorf("cannot unmarshal ServiceList from %q: %w", data, err)
 	}
@@ -162,8 +162,10 @@ func (c *Client) getAPIResponseWithParamsAndClient(client *fasthttp.HostClient,
 	req.SetRequestURIBytes(u.RequestURI())
 	req.SetHost(c.hostPort)
 	req.Header.Set("Accept-Encoding", "gzip")
-	if c.ac != nil && c.ac.Authorization != "" {
-		req.Header.Set("Authorization", c.ac.Authorization)
+	if c.ac != nil {
+		if ah := c.ac.GetAuthHeader(); ah != "" {
+			req.Header.Set("Authorization", ah)
+		}
 	}
 
 	var resp fasthttp.Response
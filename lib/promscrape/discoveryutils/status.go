@@ -0,0 +1,49 @@
+package discoveryutils
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// RefreshStatus tracks a single refresh of service discovery targets for the given `job_name`.
+//
+// It exposes the following metrics with the same `type` and `job` labels for all the service discovery mechanisms:
+//
+//   - vm_promscrape_discovery_targets - the number of targets after relabeling
+//   - vm_promscrape_discovery_refresh_duration_seconds - the duration of refreshes
+//   - vm_promscrape_discovery_refreshes_total - the number of refreshes
+//   - vm_promscrape_discovery_refresh_errors_total - the number of failed refreshes
+//   - vm_promscrape_discovery_last_successful_refresh_timestamp_seconds - the timestamp of the last successful refresh
+type RefreshStatus struct {
+	sdType    string
+	job       string
+	startTime time.Time
+}
+
+// NewRefreshStatus starts tracking the refresh for the given sdType and job.
+//
+// sdType must match the name of `scrape_config` section such as `kubernetes_sd_configs`.
+func NewRefreshStatus(sdType, job string) RefreshStatus {
+	return RefreshStatus{
+		sdType:    sdType,
+		job:       job,
+		startTime: time.Now(),
+	}
+}
+
+// Finish updates service discovery metrics for rs.
+//
+// targets must contain the number of targets for the job after the refresh. ok must be set if the refresh was successful.
+func (rs RefreshStatus) Finish(targets int, ok bool) {
+	labels := fmt.Sprintf("{type=%q, job=%q}", rs.sdType, rs.job)
+	metrics.GetOrCreateHistogram("vm_promscrape_discovery_refresh_duration_seconds" + labels).UpdateDuration(rs.startTime)
+	metrics.GetOrCreateCounter("vm_promscrape_discovery_refreshes_total" + labels).Inc()
+	metrics.GetOrCreateCounter("vm_promscrape_discovery_targets" + labels).Set(uint64(targets))
+	if !ok {
+		metrics.GetOrCreateCounter("vm_promscrape_discovery_refresh_errors_total" + labels).Inc()
+		return
+	}
+	metrics.GetOrCreateCounter("vm_promscrape_discovery_last_successful_refresh_timestamp_seconds" + labels).Set(uint64(time.Now().Unix()))
+}
@@ -0,0 +1,30 @@
+package discoveryutils
+
+import (
+	"testing"
+
+	"github.com/VictoriaMetrics/metrics"
+)
+
+func TestRefreshStatus(t *testing.T) {
+	f := func(name string, valueExpected uint64) {
+		t.Helper()
+		value := metrics.GetOrCreateCounter(name).Get()
+		if value != valueExpected {
+			t.Fatalf("unexpected value for %s; got %d; want %d", name, value, valueExpected)
+		}
+	}
+
+	NewRefreshStatus("test_sd_configs", "foo").Finish(3, true)
+	f(`vm_promscrape_discovery_targets{type="test_sd_configs", job="foo"}`, 3)
+	f(`vm_promscrape_discovery_refreshes_total{type="test_sd_configs", job="foo"}`, 1)
+	f(`vm_promscrape_discovery_refresh_errors_total{type="test_sd_configs", job="foo"}`, 0)
+	if metrics.GetOrCreateCounter(`vm_promscrape_discovery_last_successful_refresh_timestamp_seconds{type="test_sd_configs", job="foo"}`).Get() == 0 {
+		t.Fatalf("missing timestamp for the last successful refresh")
+	}
+
+	NewRefreshStatus("test_sd_configs", "foo").Finish(2, false)
+	f(`vm_promscrape_discovery_targets{type="test_sd_configs", job="foo"}`, 2)
+	f(`vm_promscrape_discovery_refreshes_total{type="test_sd_configs", job="foo"}`, 2)
+	f(`vm_promscrape_discovery_refresh_errors_total{type="test_sd_configs", job="foo"}`, 1)
+}
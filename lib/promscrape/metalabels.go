@@ -0,0 +1,56 @@
+package promscrape
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// metaLabelsFilter drops `__meta_*` labels, which aren't referenced by relabeling rules.
+//
+// Service discovery may return big number of `__meta_*` labels per target such as all the pod annotations in Kubernetes.
+// These labels are stored in the original labels of every target, while most of them are never used by relabeling.
+// The filter reduces memory usage in this case.
+type metaLabelsFilter struct {
+	pcs *promrelabel.ParsedConfigs
+
+	// m caches ReferencesLabel results per label name, since the same label names are repeated across targets.
+	mu sync.Mutex
+	m  map[string]bool
+}
+
+func newMetaLabelsFilter(pcs *promrelabel.ParsedConfigs) *metaLabelsFilter {
+	return &metaLabelsFilter{
+		pcs: pcs,
+		m:   make(map[string]bool),
+	}
+}
+
+// apply removes unreferenced `__meta_*` labels from labels and returns the result.
+func (mlf *metaLabelsFilter) apply(labels []prompbmarshal.Label) []prompbmarshal.Label {
+	dst := labels[:0]
+	mlf.mu.Lock()
+	for _, label := range labels {
+		if strings.HasPrefix(label.Name, "__meta_") && !mlf.isReferencedLocked(label.Name) {
+			prunedMetaLabels.Inc()
+			continue
+		}
+		dst = append(dst, label)
+	}
+	mlf.mu.Unlock()
+	return dst
+}
+
+func (mlf *metaLabelsFilter) isReferencedLocked(name string) bool {
+	ok, found := mlf.m[name]
+	if !found {
+		ok = mlf.pcs.ReferencesLabel(name)
+		mlf.m[name] = ok
+	}
+	return ok
+}
+
+var prunedMetaLabels = metrics.NewCounter(`vm_promscrape_pruned_meta_labels_total`)
@@ -0,0 +1,59 @@
+package promscrape
+
+import (
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
+)
+
+func TestPruneMetaLabels(t *testing.T) {
+	f := func(pruneMetaLabels bool, originalLabelsExpected, labelsExpected string) {
+		t.Helper()
+		rcs, err := promrelabel.ParseRelabelConfigsData([]byte(`
+- source_labels: [__meta_kubernetes_pod_name]
+  target_label: pod
+- action: labelmap
+  regex: __meta_kubernetes_pod_label_(.+)
+`))
+		if err != nil {
+			t.Fatalf("cannot parse relabel configs: %s", err)
+		}
+		sc := &ScrapeConfig{
+			JobName:         "foo",
+			PruneMetaLabels: pruneMetaLabels,
+		}
+		swc, err := getScrapeWorkConfig(sc, ".", &GlobalConfig{})
+		if err != nil {
+			t.Fatalf("cannot create scrape work config: %s", err)
+		}
+		swc.relabelConfigs = rcs
+		if pruneMetaLabels {
+			swc.metaLabelsFilter = newMetaLabelsFilter(rcs)
+		}
+		sws := appendScrapeWorkForTargetLabels(nil, swc, []map[string]string{
+			{
+				"__address__":                                 "10.0.0.1:8080",
+				"__meta_kubernetes_pod_name":                  "app-1",
+				"__meta_kubernetes_pod_label_app":             "bar",
+				"__meta_kubernetes_pod_annotation_checksum":   "abcdef",
+				"__meta_kubernetes_pod_annotationpresent_foo": "true",
+			},
+		}, "kubernetes_sd_config")
+		if len(sws) != 1 {
+			t.Fatalf("unexpected number of scrape works; got %d; want 1", len(sws))
+		}
+		sw := sws[0]
+		if s := promLabelsString(sw.OriginalLabels); s != originalLabelsExpected {
+			t.Fatalf("unexpected original labels\ngot\n%s\nwant\n%s", s, originalLabelsExpected)
+		}
+		if s := promLabelsString(sw.Labels); s != labelsExpected {
+			t.Fatalf("unexpected labels\ngot\n%s\nwant\n%s", s, labelsExpected)
+		}
+	}
+
+	labelsExpected := `{__address__="10.0.0.1:8080",__metrics_path__="/metrics",__scheme__="http",app="bar",instance="10.0.0.1:8080",job="foo",pod="app-1"}`
+	f(false, `{__address__="10.0.0.1:8080",__meta_kubernetes_pod_annotation_checksum="abcdef",__meta_kubernetes_pod_annotationpresent_foo="true",`+
+		`__meta_kubernetes_pod_label_app="bar",__meta_kubernetes_pod_name="app-1",__metrics_path__="/metrics",__scheme__="http",job="foo"}`, labelsExpected)
+	f(true, `{__address__="10.0.0.1:8080",__meta_kubernetes_pod_label_app="bar",__meta_kubernetes_pod_name="app-1",`+
+		`__metrics_path__="/metrics",__scheme__="http",job="foo"}`, labelsExpected)
+}
@@ -0,0 +1,274 @@
+package promscrape
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	parser "github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/prometheus"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// MetricNormalizationConfig represents `metric_normalization` section of `scrape_config`.
+//
+// It is applied to scraped metrics before `metric_relabel_configs`.
+// See https://victoriametrics.github.io/vmagent.html#metric-normalization
+type MetricNormalizationConfig struct {
+	// AppendTotalToCounters enables appending `_total` suffix to counter names without this suffix.
+	//
+	// Counters are detected via `# TYPE` lines in the scraped response, so this option doesn't work in stream parsing mode.
+	AppendTotalToCounters bool `yaml:"append_total_to_counters,omitempty"`
+
+	// ConvertUnits enables converting metrics with well-known non-base units such as milliseconds or percent to base units.
+	ConvertUnits bool `yaml:"convert_units,omitempty"`
+
+	// Rules contains custom rules for renaming metrics. The first matching rule is applied.
+	Rules []MetricNormalizationRule `yaml:"rules,omitempty"`
+}
+
+// MetricNormalizationRule is a rule for renaming metric families and multiplying their values.
+type MetricNormalizationRule struct {
+	// Regex is an anchored regexp for metric family name.
+	//
+	// The family name is obtained from metric name by stripping `_bucket`, `_sum`, `_count`, `_total` or `_created` suffix.
+	Regex string `yaml:"regex"`
+
+	// Replacement is the new family name. It may refer to capture groups from Regex via $1, $2, etc.
+	//
+	// By default the family name is left unchanged.
+	Replacement *string `yaml:"replacement,omitempty"`
+
+	// Multiplier is an optional multiplier for sample values. By default values are left unchanged.
+	Multiplier *float64 `yaml:"multiplier,omitempty"`
+}
+
+// MetricNormalizer renames scraped metrics and multiplies their values according to MetricNormalizationConfig.
+type MetricNormalizer struct {
+	appendTotalToCounters bool
+	convertUnits          bool
+	rules                 []*metricNormalizationRule
+}
+
+type metricNormalizationRule struct {
+	re          *regexp.Regexp
+	replacement string
+	multiplier  float64
+}
+
+// unitConversion converts metric family with the given suffix to the base unit.
+type unitConversion struct {
+	suffix     string
+	baseSuffix string
+	multiplier float64
+}
+
+// unitConversions contains conversions to base units recommended by Prometheus naming conventions.
+//
+// See https://prometheus.io/docs/practices/naming/#base-units
+var unitConversions = []unitConversion{
+	{"_milliseconds", "_seconds", 1e-3},
+	{"_ms", "_seconds", 1e-3},
+	{"_microseconds", "_seconds", 1e-6},
+	{"_us", "_seconds", 1e-6},
+	{"_nanoseconds", "_seconds", 1e-9},
+	{"_ns", "_seconds", 1e-9},
+	{"_minutes", "_seconds", 60},
+	{"_hours", "_seconds", 3600},
+	{"_percent", "_ratio", 1e-2},
+}
+
+// familySuffixes contains suffixes, which are stripped from metric names in order to obtain metric family names.
+var familySuffixes = []string{"_bucket", "_sum", "_count", "_total", "_created"}
+
+func newMetricNormalizer(cfg *MetricNormalizationConfig) (*MetricNormalizer, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	mn := &MetricNormalizer{
+		appendTotalToCounters: cfg.AppendTotalToCounters,
+		convertUnits:          cfg.ConvertUnits,
+	}
+	for i := range cfg.Rules {
+		r := &cfg.Rules[i]
+		if len(r.Regex) == 0 {
+			return nil, fmt.Errorf("missing `regex` in rule #%d", i+1)
+		}
+		re, err := regexp.Compile("^(?:" + r.Regex + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse `regex` %q in rule #%d: %w", r.Regex, i+1, err)
+		}
+		replacement := "$0"
+		if r.Replacement != nil {
+			replacement = *r.Replacement
+		}
+		multiplier := 1.0
+		if r.Multiplier != nil {
+			multiplier = *r.Multiplier
+			if multiplier == 0 || math.IsNaN(multiplier) || math.IsInf(multiplier, 0) {
+				return nil, fmt.Errorf("`multiplier` in rule #%d must be a finite non-zero number; got %v", i+1, multiplier)
+			}
+		}
+		mn.rules = append(mn.rules, &metricNormalizationRule{
+			re:          re,
+			replacement: replacement,
+			multiplier:  multiplier,
+		})
+	}
+	return mn, nil
+}
+
+// String returns human-readable representation for mn.
+func (mn *MetricNormalizer) String() string {
+	if mn == nil {
+		return ""
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "append_total_to_counters=%v, convert_units=%v", mn.appendTotalToCounters, mn.convertUnits)
+	for _, r := range mn.rules {
+		fmt.Fprintf(&sb, ", {regex=%q, replacement=%q, multiplier=%v}", r.re.String(), r.replacement, r.multiplier)
+	}
+	return sb.String()
+}
+
+// needMetricTypes returns true if mn needs metric types from `# TYPE` lines.
+func (mn *MetricNormalizer) needMetricTypes() bool {
+	return mn != nil && mn.appendTotalToCounters
+}
+
+// normalizeName appends normalized name for the metric with the given name to dst and returns the result.
+//
+// isCounter must be set to true if the metric belongs to counter family.
+// It also returns the multiplier for metric values and the family suffix for the metric name.
+// The last returned value is false if the metric name doesn't need normalization. In this case dst is returned unchanged.
+func (mn *MetricNormalizer) normalizeName(dst []byte, name string, isCounter bool) ([]byte, float64, string, bool) {
+	dstLen := len(dst)
+	family, suffix := splitFamilySuffix(name)
+	multiplier := 1.0
+	renamed := false
+	for _, r := range mn.rules {
+		match := r.re.FindStringSubmatchIndex(family)
+		if match == nil {
+			continue
+		}
+		dst = r.re.ExpandString(dst, r.replacement, family, match)
+		multiplier = r.multiplier
+		renamed = true
+		break
+	}
+	if !renamed && mn.convertUnits {
+		for _, uc := range unitConversions {
+			if len(family) > len(uc.suffix) && strings.HasSuffix(family, uc.suffix) {
+				dst = append(dst, family[:len(family)-len(uc.suffix)]...)
+				dst = append(dst, uc.baseSuffix...)
+				multiplier = uc.multiplier
+				renamed = true
+				break
+			}
+		}
+	}
+	if !renamed {
+		dst = append(dst, family...)
+	}
+	dst = append(dst, suffix...)
+	if mn.appendTotalToCounters && isCounter && suffix != "_total" {
+		dst = append(dst, "_total"...)
+		renamed = true
+	}
+	if !renamed || string(dst[dstLen:]) == name && multiplier == 1 {
+		return dst[:dstLen], 1, suffix, false
+	}
+	return dst, multiplier, suffix, true
+}
+
+func splitFamilySuffix(name string) (string, string) {
+	for _, suffix := range familySuffixes {
+		if len(name) > len(suffix) && strings.HasSuffix(name, suffix) {
+			n := len(name) - len(suffix)
+			return name[:n], name[n:]
+		}
+	}
+	return name, ""
+}
+
+// normalizeRow normalizes metric name and value for r according to sw.Config.MetricNormalizer.
+//
+// The normalized name and label values are stored in wc.buf, so r may be used until wc is reset.
+func (sw *scrapeWork) normalizeRow(wc *writeRequestCtx, r *parser.Row) {
+	mn := sw.Config.MetricNormalizer
+	isCounter := sw.metricTypes[r.Metric] == "counter"
+	bufLen := len(wc.buf)
+	buf, multiplier, suffix, ok := mn.normalizeName(wc.buf, r.Metric, isCounter)
+	wc.buf = buf
+	if !ok {
+		return
+	}
+	r.Metric = bytesutil.ToUnsafeString(buf[bufLen:])
+	normalizedSamples.Inc()
+	if multiplier == 1 {
+		return
+	}
+	switch suffix {
+	case "_count", "_created":
+		// These series contain the number of observations and the creation timestamp, so they mustn't be multiplied.
+		return
+	case "_bucket":
+		// Bucket values contain the number of observations, while bucket bounds are stored in `le` label.
+		for i := range r.Tags {
+			tag := &r.Tags[i]
+			if tag.Key != "le" {
+				continue
+			}
+			v, err := strconv.ParseFloat(tag.Value, 64)
+			if err != nil || math.IsInf(v, 0) {
+				continue
+			}
+			bufLen := len(wc.buf)
+			wc.buf = strconv.AppendFloat(wc.buf, multiplyValue(v, multiplier), 'g', -1, 64)
+			tag.Value = bytesutil.ToUnsafeString(wc.buf[bufLen:])
+		}
+	default:
+		r.Value = multiplyValue(r.Value, multiplier)
+	}
+	if r.HasExemplar {
+		r.Exemplar.Value = multiplyValue(r.Exemplar.Value, multiplier)
+	}
+}
+
+// multiplyValue returns v*multiplier.
+//
+// It divides v by 1/multiplier for multipliers such as 0.001 in order to avoid rounding errors like 0.005000000000000001 for 5*0.001.
+func multiplyValue(v, multiplier float64) float64 {
+	if math.Abs(multiplier) < 1 {
+		d := 1 / multiplier
+		if d == math.Trunc(d) {
+			return v / d
+		}
+	}
+	return v * multiplier
+}
+
+// updateMetricTypes updates sw.metricTypes from the given metadata.
+//
+// sw.metricTypes refers to metadata strings, so it must be reset via resetMetricTypes before the metadata is released.
+func (sw *scrapeWork) updateMetricTypes(metadata []parser.Metadata) {
+	if sw.metricTypes == nil {
+		sw.metricTypes = make(map[string]string, len(metadata))
+	}
+	for i := range metadata {
+		md := &metadata[i]
+		if len(md.Type) > 0 {
+			sw.metricTypes[md.Metric] = md.Type
+		}
+	}
+}
+
+func (sw *scrapeWork) resetMetricTypes() {
+	for k := range sw.metricTypes {
+		delete(sw.metricTypes, k)
+	}
+}
+
+var normalizedSamples = metrics.NewCounter(`vm_promscrape_normalized_samples_total`)
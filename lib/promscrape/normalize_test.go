@@ -0,0 +1,156 @@
+package promscrape
+
+import (
+	"fmt"
+	"testing"
+
+	parser "github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/prometheus"
+	"gopkg.in/yaml.v2"
+)
+
+func TestNewMetricNormalizerFailure(t *testing.T) {
+	f := func(data string) {
+		t.Helper()
+		var cfg MetricNormalizationConfig
+		if err := yaml.UnmarshalStrict([]byte(data), &cfg); err != nil {
+			t.Fatalf("cannot unmarshal config: %s", err)
+		}
+		if _, err := newMetricNormalizer(&cfg); err == nil {
+			t.Fatalf("expecting non-nil error for config %q", data)
+		}
+	}
+	// Missing regex
+	f(`
+rules:
+- replacement: foo
+`)
+	// Invalid regex
+	f(`
+rules:
+- regex: "foo("
+`)
+	// Zero multiplier
+	f(`
+rules:
+- regex: foo
+  multiplier: 0
+`)
+}
+
+func TestMetricNormalizerNormalizeName(t *testing.T) {
+	mn := mustNewMetricNormalizer(`
+append_total_to_counters: true
+convert_units: true
+rules:
+- regex: "(.+)_kb"
+  replacement: "${1}_bytes"
+  multiplier: 1024
+- regex: "node_load.+"
+`)
+	f := func(name string, isCounter bool, nameExpected string, multiplierExpected float64, suffixExpected string) {
+		t.Helper()
+		prefix := []byte("prefix")
+		dst, multiplier, suffix, ok := mn.normalizeName(prefix, name, isCounter)
+		if string(dst[:len(prefix)]) != "prefix" {
+			t.Fatalf("normalizeName mustn't change dst prefix; got %q", dst)
+		}
+		result := string(dst[len(prefix):])
+		if !ok {
+			if len(dst) != len(prefix) {
+				t.Fatalf("unexpected name appended for unchanged metric %q: %q", name, result)
+			}
+			result = name
+		}
+		if result != nameExpected {
+			t.Fatalf("unexpected name for %q; got %q; want %q", name, result, nameExpected)
+		}
+		if multiplier != multiplierExpected {
+			t.Fatalf("unexpected multiplier for %q; got %v; want %v", name, multiplier, multiplierExpected)
+		}
+		if suffix != suffixExpected {
+			t.Fatalf("unexpected suffix for %q; got %q; want %q", name, suffix, suffixExpected)
+		}
+	}
+
+	// Unchanged names
+	f("foo", false, "foo", 1, "")
+	f("foo_total", true, "foo_total", 1, "_total")
+	f("node_load1", false, "node_load1", 1, "")
+	f("_ms", false, "_ms", 1, "")
+
+	// Counters
+	f("foo", true, "foo_total", 1, "")
+	f("errors_count", true, "errors_count_total", 1, "_count")
+
+	// Built-in unit conversions
+	f("request_duration_ms", false, "request_duration_seconds", 1e-3, "")
+	f("request_duration_milliseconds_bucket", false, "request_duration_seconds_bucket", 1e-3, "_bucket")
+	f("cpu_time_us_total", true, "cpu_time_seconds_total", 1e-6, "_total")
+	f("uptime_hours", true, "uptime_seconds_total", 3600, "")
+	f("disk_usage_percent", false, "disk_usage_ratio", 1e-2, "")
+
+	// Custom rules
+	f("memory_kb", false, "memory_bytes", 1024, "")
+	f("memory_kb_sum", false, "memory_bytes_sum", 1024, "_sum")
+}
+
+func TestScrapeWorkNormalizeRow(t *testing.T) {
+	f := func(rowStr string, metricTypes map[string]string, rowExpected string) {
+		t.Helper()
+		var rows parser.Rows
+		rows.UnmarshalWithErrLogger(rowStr, func(s string) {
+			t.Fatalf("cannot parse %q: %s", rowStr, s)
+		})
+		if len(rows.Rows) != 1 {
+			t.Fatalf("expecting a single row in %q; got %d rows", rowStr, len(rows.Rows))
+		}
+		r := &rows.Rows[0]
+		sw := &scrapeWork{
+			Config: &ScrapeWork{
+				MetricNormalizer: mustNewMetricNormalizer(`
+append_total_to_counters: true
+convert_units: true
+`),
+			},
+			metricTypes: metricTypes,
+		}
+		var wc writeRequestCtx
+		sw.normalizeRow(&wc, r)
+		result := r.Metric + "{"
+		for i, tag := range r.Tags {
+			if i > 0 {
+				result += ","
+			}
+			result += fmt.Sprintf("%s=%q", tag.Key, tag.Value)
+		}
+		result += fmt.Sprintf("} %g", r.Value)
+		if r.HasExemplar {
+			result += fmt.Sprintf(" # %g", r.Exemplar.Value)
+		}
+		if result != rowExpected {
+			t.Fatalf("unexpected row for %q;\ngot\n%s\nwant\n%s", rowStr, result, rowExpected)
+		}
+	}
+
+	f(`foo{bar="baz"} 123`, nil, `foo{bar="baz"} 123`)
+	f(`foo{bar="baz"} 123`, map[string]string{"foo": "counter"}, `foo_total{bar="baz"} 123`)
+	f(`foo{bar="baz"} 123`, map[string]string{"foo": "gauge"}, `foo{bar="baz"} 123`)
+	f(`latency_ms 5`, nil, `latency_seconds{} 0.005`)
+	f(`latency_ms_sum 1234`, nil, `latency_seconds_sum{} 1.234`)
+	f(`latency_ms_count 10`, nil, `latency_seconds_count{} 10`)
+	f(`latency_ms_created 1600000000`, nil, `latency_seconds_created{} 1.6e+09`)
+	f(`latency_ms_bucket{le="250"} 7 # {trace_id="abc"} 120`, nil, `latency_seconds_bucket{le="0.25"} 7 # 0.12`)
+	f(`latency_ms_bucket{le="+Inf"} 10`, nil, `latency_seconds_bucket{le="+Inf"} 10`)
+}
+
+func mustNewMetricNormalizer(data string) *MetricNormalizer {
+	var cfg MetricNormalizationConfig
+	if err := yaml.UnmarshalStrict([]byte(data), &cfg); err != nil {
+		panic(fmt.Errorf("cannot unmarshal %q: %w", data, err))
+	}
+	mn, err := newMetricNormalizer(&cfg)
+	if err != nil {
+		panic(fmt.Errorf("cannot parse %q: %w", data, err))
+	}
+	return mn
+}
@@ -0,0 +1,397 @@
+package promscrape
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+	"github.com/valyala/fastrand"
+)
+
+// ProbeConfig represents `probe_configs` section entry in -promscrape.config.
+//
+// It contains all the `scrape_config` options for discovering and relabeling targets
+// plus the options for the built-in prober, which checks the discovered targets.
+type ProbeConfig struct {
+	ScrapeConfig `yaml:",inline"`
+	ProbeOptions `yaml:",inline"`
+}
+
+// ProbeOptions contains options for the built-in prober.
+type ProbeOptions struct {
+	// Prober is the probe type. Supported values: http, tcp, icmp.
+	Prober string `yaml:"prober"`
+
+	// HTTP contains options for `prober: http`.
+	HTTP *ProbeHTTPOptions `yaml:"http,omitempty"`
+}
+
+// ProbeHTTPOptions contains options for `prober: http`.
+type ProbeHTTPOptions struct {
+	// Method is HTTP method for the probe. GET is used by default.
+	Method string `yaml:"method,omitempty"`
+
+	// ValidStatusCodes contains the list of status codes for successful probe. Any 2xx status code is accepted by default.
+	ValidStatusCodes []int `yaml:"valid_status_codes,omitempty"`
+
+	// NoFollowRedirects disables following redirects.
+	NoFollowRedirects bool `yaml:"no_follow_redirects,omitempty"`
+}
+
+// String returns human-readable representation for po.
+func (po *ProbeOptions) String() string {
+	if po == nil {
+		return ""
+	}
+	s := "prober=" + po.Prober
+	if h := po.HTTP; h != nil {
+		s += fmt.Sprintf(", method=%q, valid_status_codes=%v, no_follow_redirects=%v", h.Method, h.ValidStatusCodes, h.NoFollowRedirects)
+	}
+	return s
+}
+
+func (po *ProbeOptions) validate() error {
+	switch po.Prober {
+	case "http":
+	case "tcp", "icmp":
+		if po.HTTP != nil {
+			return fmt.Errorf("`http` section cannot be set for `prober: %s`", po.Prober)
+		}
+	case "":
+		return fmt.Errorf("missing `prober`; supported values: http, tcp, icmp")
+	default:
+		return fmt.Errorf("unsupported `prober`: %q; supported values: http, tcp, icmp", po.Prober)
+	}
+	if h := po.HTTP; h != nil {
+		for _, code := range h.ValidStatusCodes {
+			if code < 100 || code > 599 {
+				return fmt.Errorf("invalid status code in `valid_status_codes`: %d; it must be in the range [100..599]", code)
+			}
+		}
+	}
+	return nil
+}
+
+// getScrapeConfig returns `scrape_config` for pc.
+func (pc *ProbeConfig) getScrapeConfig() (*ScrapeConfig, error) {
+	if err := pc.ProbeOptions.validate(); err != nil {
+		return nil, fmt.Errorf("invalid `probe_config` for `job_name` %q: %w", pc.JobName, err)
+	}
+	sc := pc.ScrapeConfig
+	if sc.MetricsPath == "" {
+		// Probe the root path by default.
+		sc.MetricsPath = "/"
+	}
+	po := pc.ProbeOptions
+	sc.probe = &po
+	return &sc, nil
+}
+
+// prober performs probes for ScrapeWork with non-nil Probe.
+//
+// The probe results are returned from ReadData in Prometheus text exposition format,
+// so they are processed in the same way as the scraped metrics.
+type prober struct {
+	sw *ScrapeWork
+
+	// hc is used for `prober: http`
+	hc *http.Client
+
+	probesTotal   *metrics.Counter
+	probeFailures *metrics.Counter
+}
+
+func newProber(sw *ScrapeWork) *prober {
+	p := &prober{
+		sw:            sw,
+		probesTotal:   metrics.GetOrCreateCounter(fmt.Sprintf(`vm_promscrape_probes_total{prober=%q}`, sw.Probe.Prober)),
+		probeFailures: metrics.GetOrCreateCounter(fmt.Sprintf(`vm_promscrape_probe_failures_total{prober=%q}`, sw.Probe.Prober)),
+	}
+	if sw.Probe.Prober == "http" {
+		var tlsCfg *tls.Config
+		if strings.HasPrefix(sw.ScrapeURL, "https://") {
+			tlsCfg = sw.AuthConfig.NewTLSConfig()
+		}
+		var proxy func(*http.Request) (*url.URL, error)
+		if proxyURL := sw.ProxyURL.URL(); proxyURL != nil {
+			proxy = http.ProxyURL(proxyURL)
+		}
+		hc := &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig:     tlsCfg,
+				Proxy:               proxy,
+				TLSHandshakeTimeout: 10 * time.Second,
+				// Establish new connection for every probe in order to verify the whole request path.
+				DisableKeepAlives: true,
+				DialContext:       newStatStdDialFunc(sw.UnixSocketPath),
+			},
+			Timeout: sw.ScrapeTimeout,
+		}
+		if sw.Probe.HTTP != nil && sw.Probe.HTTP.NoFollowRedirects {
+			hc.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+				return http.ErrUseLastResponse
+			}
+		}
+		p.hc = hc
+	}
+	return p
+}
+
+// ReadData performs the probe and appends its results in Prometheus text exposition format to dst.
+//
+// Failed probes are reported via probe_success=0, so ReadData returns an error only if the probe cannot be performed.
+func (p *prober) ReadData(dst []byte) ([]byte, error) {
+	startTime := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), p.sw.ScrapeTimeout)
+	defer cancel()
+	var err error
+	switch p.sw.Probe.Prober {
+	case "http":
+		dst, err = p.probeHTTP(ctx, dst)
+	case "tcp":
+		err = p.probeTCP(ctx)
+	case "icmp":
+		err = p.probeICMP(ctx)
+	default:
+		logger.Panicf("BUG: unexpected prober: %q", p.sw.Probe.Prober)
+	}
+	success := 1
+	if err != nil {
+		success = 0
+		logger.Debugf("probe for %q from job %q with labels %s failed: %s", p.target(), p.sw.Job(), p.sw.LabelsString(), err)
+	}
+	p.probesTotal.Inc()
+	if success == 0 {
+		p.probeFailures.Inc()
+	}
+	dst = appendProbeMetric(dst, "probe_success", float64(success))
+	dst = appendProbeMetric(dst, "probe_duration_seconds", time.Since(startTime).Seconds())
+	return dst, nil
+}
+
+// GetStreamReader returns reader for the probe results.
+//
+// It is used if stream parsing is enabled for the probe.
+func (p *prober) GetStreamReader() (*streamReader, error) {
+	data, err := p.ReadData(nil)
+	if err != nil {
+		return nil, err
+	}
+	return &streamReader{
+		r:      ioutil.NopCloser(bytes.NewReader(data)),
+		cancel: func() {},
+	}, nil
+}
+
+// target returns the probed target.
+func (p *prober) target() string {
+	if p.sw.Probe.Prober == "http" {
+		return p.sw.ScrapeURL
+	}
+	return p.address()
+}
+
+// address returns host:port for the probed target.
+func (p *prober) address() string {
+	if p.sw.UnixSocketPath != "" {
+		return p.sw.UnixSocketPath
+	}
+	u, err := url.Parse(p.sw.ScrapeURL)
+	if err != nil {
+		logger.Panicf("BUG: cannot parse ScrapeURL=%q: %s", p.sw.ScrapeURL, err)
+	}
+	return u.Host
+}
+
+func (p *prober) probeHTTP(ctx context.Context, dst []byte) ([]byte, error) {
+	method := "GET"
+	if h := p.sw.Probe.HTTP; h != nil && h.Method != "" {
+		method = h.Method
+	}
+	req, err := http.NewRequestWithContext(ctx, method, p.sw.ScrapeURL, nil)
+	if err != nil {
+		return dst, fmt.Errorf("cannot create request for %q: %w", p.sw.ScrapeURL, err)
+	}
+	if ah := p.sw.AuthConfig.GetAuthHeader(); ah != "" {
+		req.Header.Set("Authorization", ah)
+	}
+	resp, err := p.hc.Do(req)
+	if err != nil {
+		return dst, fmt.Errorf("cannot perform request to %q: %w", p.sw.ScrapeURL, err)
+	}
+	n, err := io.Copy(ioutil.Discard, io.LimitReader(resp.Body, int64(maxScrapeSize.N)))
+	_ = resp.Body.Close()
+	dst = appendProbeMetric(dst, "probe_http_status_code", float64(resp.StatusCode))
+	dst = appendProbeMetric(dst, "probe_http_content_length", float64(n))
+	isSSL := 0
+	if resp.TLS != nil {
+		isSSL = 1
+		if expiry := getEarliestCertExpiry(resp.TLS); !expiry.IsZero() {
+			dst = appendProbeMetric(dst, "probe_ssl_earliest_cert_expiry", float64(expiry.Unix()))
+		}
+	}
+	dst = appendProbeMetric(dst, "probe_http_ssl", float64(isSSL))
+	if err != nil {
+		return dst, fmt.Errorf("cannot read response body from %q: %w", p.sw.ScrapeURL, err)
+	}
+	if !p.isValidStatusCode(resp.StatusCode) {
+		return dst, fmt.Errorf("unexpected status code returned from %q: %d", p.sw.ScrapeURL, resp.StatusCode)
+	}
+	return dst, nil
+}
+
+func (p *prober) isValidStatusCode(statusCode int) bool {
+	h := p.sw.Probe.HTTP
+	if h == nil || len(h.ValidStatusCodes) == 0 {
+		return statusCode/100 == 2
+	}
+	for _, code := range h.ValidStatusCodes {
+		if code == statusCode {
+			return true
+		}
+	}
+	return false
+}
+
+func getEarliestCertExpiry(cs *tls.ConnectionState) time.Time {
+	var expiry time.Time
+	for _, cert := range cs.PeerCertificates {
+		if expiry.IsZero() || cert.NotAfter.Before(expiry) {
+			expiry = cert.NotAfter
+		}
+	}
+	return expiry
+}
+
+func (p *prober) probeTCP(ctx context.Context) error {
+	dial := newStatStdDialFunc(p.sw.UnixSocketPath)
+	addr := p.address()
+	conn, err := dial(ctx, "tcp", addr)
+	if err != nil {
+		return fmt.Errorf("cannot connect to %q: %w", addr, err)
+	}
+	_ = conn.Close()
+	return nil
+}
+
+func (p *prober) probeICMP(ctx context.Context) error {
+	host := p.address()
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("cannot resolve %q: %w", host, err)
+	}
+	if len(ips) == 0 {
+		return fmt.Errorf("cannot find ip addresses for %q", host)
+	}
+	deadline, _ := ctx.Deadline()
+	return pingICMP(ips[0].IP, deadline)
+}
+
+// pingICMP sends ICMP echo request to ip and waits for the echo reply until the deadline.
+//
+// It requires permissions for opening raw sockets such as CAP_NET_RAW on Linux.
+func pingICMP(ip net.IP, deadline time.Time) error {
+	network := "ip4:icmp"
+	laddr := "0.0.0.0"
+	requestType := byte(8)
+	replyType := byte(0)
+	isIPv4 := ip.To4() != nil
+	if !isIPv4 {
+		network = "ip6:ipv6-icmp"
+		laddr = "::"
+		requestType = 128
+		replyType = 129
+	}
+	conn, err := net.ListenPacket(network, laddr)
+	if err != nil {
+		return fmt.Errorf("cannot open ICMP socket: %w; make sure vmagent has permissions for opening raw sockets (for example, CAP_NET_RAW on Linux)", err)
+	}
+	defer func() {
+		_ = conn.Close()
+	}()
+	if err := conn.SetDeadline(deadline); err != nil {
+		return fmt.Errorf("cannot set deadline for ICMP socket: %w", err)
+	}
+	id := uint16(fastrand.Uint32())
+	seq := uint16(atomic.AddUint32(&icmpSeq, 1))
+	req := marshalICMPEcho(nil, requestType, id, seq, isIPv4)
+	if _, err := conn.WriteTo(req, &net.IPAddr{IP: ip}); err != nil {
+		return fmt.Errorf("cannot send ICMP echo request to %s: %w", ip, err)
+	}
+	buf := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(buf)
+		if err != nil {
+			return fmt.Errorf("cannot read ICMP echo reply from %s: %w", ip, err)
+		}
+		if pa, ok := peer.(*net.IPAddr); ok && !pa.IP.Equal(ip) {
+			continue
+		}
+		if isICMPEchoReply(buf[:n], replyType, id, seq) {
+			return nil
+		}
+	}
+}
+
+var icmpSeq uint32
+
+// marshalICMPEcho appends ICMP echo request message with the given typ, id and seq to dst and returns the result.
+//
+// The checksum is calculated only for ICMPv4, since the kernel calculates it for ICMPv6.
+func marshalICMPEcho(dst []byte, typ byte, id, seq uint16, isIPv4 bool) []byte {
+	dstLen := len(dst)
+	dst = append(dst, typ, 0, 0, 0)
+	dst = append(dst, byte(id>>8), byte(id), byte(seq>>8), byte(seq))
+	dst = append(dst, "vmagent probe"...)
+	if isIPv4 {
+		cs := icmpChecksum(dst[dstLen:])
+		binary.BigEndian.PutUint16(dst[dstLen+2:], cs)
+	}
+	return dst
+}
+
+func isICMPEchoReply(b []byte, replyType byte, id, seq uint16) bool {
+	if len(b) < 8 || b[0] != replyType || b[1] != 0 {
+		return false
+	}
+	return binary.BigEndian.Uint16(b[4:]) == id && binary.BigEndian.Uint16(b[6:]) == seq
+}
+
+// icmpChecksum returns internet checksum for b according to RFC 1071.
+func icmpChecksum(b []byte) uint16 {
+	var sum uint32
+	for len(b) > 1 {
+		sum += uint32(b[0])<<8 | uint32(b[1])
+		b = b[2:]
+	}
+	if len(b) > 0 {
+		sum += uint32(b[0]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = (sum & 0xffff) + (sum >> 16)
+	}
+	return ^uint16(sum)
+}
+
+func appendProbeMetric(dst []byte, name string, value float64) []byte {
+	dst = append(dst, name...)
+	dst = append(dst, ' ')
+	dst = strconv.AppendFloat(dst, value, 'g', -1, 64)
+	return append(dst, '\n')
+}
@@ -0,0 +1,272 @@
+package promscrape
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promauth"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
+)
+
+func TestGetProbeScrapeWorkFailure(t *testing.T) {
+	f := func(data string) {
+		t.Helper()
+		sws, err := getStaticScrapeWork([]byte(data), "non-existing-file")
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+		if sws != nil {
+			t.Fatalf("expecting nil sws")
+		}
+	}
+
+	// Missing prober
+	f(`
+probe_configs:
+- job_name: x
+  static_configs:
+  - targets: ["foo"]
+`)
+
+	// Unsupported prober
+	f(`
+probe_configs:
+- job_name: x
+  prober: dns
+  static_configs:
+  - targets: ["foo"]
+`)
+
+	// http options for tcp prober
+	f(`
+probe_configs:
+- job_name: x
+  prober: tcp
+  http:
+    method: HEAD
+  static_configs:
+  - targets: ["foo:80"]
+`)
+
+	// Invalid status code
+	f(`
+probe_configs:
+- job_name: x
+  prober: http
+  http:
+    valid_status_codes: [2000]
+  static_configs:
+  - targets: ["foo"]
+`)
+}
+
+func TestGetProbeScrapeWorkSuccess(t *testing.T) {
+	f := func(data string, scrapeURLsExpected, instancesExpected []string, probersExpected []string) {
+		t.Helper()
+		sws, err := getStaticScrapeWork([]byte(data), "non-existing-file")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(sws) != len(scrapeURLsExpected) {
+			t.Fatalf("unexpected number of scrape works; got %d; want %d", len(sws), len(scrapeURLsExpected))
+		}
+		for i, sw := range sws {
+			if sw.ScrapeURL != scrapeURLsExpected[i] {
+				t.Fatalf("unexpected ScrapeURL #%d; got %q; want %q", i, sw.ScrapeURL, scrapeURLsExpected[i])
+			}
+			instance := promrelabel.GetLabelValueByName(sw.Labels, "instance")
+			if instance != instancesExpected[i] {
+				t.Fatalf("unexpected instance #%d; got %q; want %q", i, instance, instancesExpected[i])
+			}
+			prober := ""
+			if sw.Probe != nil {
+				prober = sw.Probe.Prober
+			}
+			if prober != probersExpected[i] {
+				t.Fatalf("unexpected prober #%d; got %q; want %q", i, prober, probersExpected[i])
+			}
+		}
+	}
+	f(`
+scrape_configs:
+- job_name: scrape
+  static_configs:
+  - targets: ["foo:1234"]
+probe_configs:
+- job_name: http
+  prober: http
+  scheme: https
+  static_configs:
+  - targets: ["example.com"]
+- job_name: tcp
+  prober: tcp
+  static_configs:
+  - targets: ["bar:5432"]
+- job_name: icmp
+  prober: icmp
+  static_configs:
+  - targets: ["baz"]
+`, []string{
+		"http://foo:1234/metrics",
+		"https://example.com:443/",
+		"http://bar:5432/",
+		"http://baz/",
+	}, []string{
+		"foo:1234",
+		"example.com:443",
+		"bar:5432",
+		"baz",
+	}, []string{
+		"",
+		"http",
+		"tcp",
+		"icmp",
+	})
+}
+
+func TestProberHTTP(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			fmt.Fprintf(w, "ok")
+		case "/redirect":
+			http.Redirect(w, r, "/ok", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+
+	f := func(path string, po *ProbeOptions, resultExpected string) {
+		t.Helper()
+		sw := &ScrapeWork{
+			ScrapeURL:     s.URL + path,
+			ScrapeTimeout: 5 * time.Second,
+			AuthConfig:    &promauth.Config{},
+			Probe:         po,
+		}
+		p := newProber(sw)
+		data, err := p.ReadData(nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		result := removeProbeDuration(string(data))
+		if result != resultExpected {
+			t.Fatalf("unexpected result;\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+	f("/ok", &ProbeOptions{
+		Prober: "http",
+	}, `probe_http_status_code 200
+probe_http_content_length 2
+probe_http_ssl 0
+probe_success 1
+`)
+	f("/not-found", &ProbeOptions{
+		Prober: "http",
+	}, `probe_http_status_code 404
+probe_http_content_length 0
+probe_http_ssl 0
+probe_success 0
+`)
+	f("/not-found", &ProbeOptions{
+		Prober: "http",
+		HTTP: &ProbeHTTPOptions{
+			ValidStatusCodes: []int{404},
+		},
+	}, `probe_http_status_code 404
+probe_http_content_length 0
+probe_http_ssl 0
+probe_success 1
+`)
+	f("/redirect", &ProbeOptions{
+		Prober: "http",
+	}, `probe_http_status_code 200
+probe_http_content_length 2
+probe_http_ssl 0
+probe_success 1
+`)
+	f("/redirect", &ProbeOptions{
+		Prober: "http",
+		HTTP: &ProbeHTTPOptions{
+			NoFollowRedirects: true,
+		},
+	}, `probe_http_status_code 302
+probe_http_content_length 26
+probe_http_ssl 0
+probe_success 0
+`)
+}
+
+func TestProberTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot start listener: %s", err)
+	}
+	addr := ln.Addr().String()
+
+	f := func(resultExpected string) {
+		t.Helper()
+		sw := &ScrapeWork{
+			ScrapeURL:     "http://" + addr + "/",
+			ScrapeTimeout: 5 * time.Second,
+			AuthConfig:    &promauth.Config{},
+			Probe: &ProbeOptions{
+				Prober: "tcp",
+			},
+		}
+		p := newProber(sw)
+		data, err := p.ReadData(nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		result := removeProbeDuration(string(data))
+		if result != resultExpected {
+			t.Fatalf("unexpected result;\ngot\n%s\nwant\n%s", result, resultExpected)
+		}
+	}
+	f("probe_success 1\n")
+	_ = ln.Close()
+	f("probe_success 0\n")
+}
+
+func TestMarshalICMPEcho(t *testing.T) {
+	b := marshalICMPEcho(nil, 8, 0x1234, 0x5678, true)
+	if b[0] != 8 || b[1] != 0 {
+		t.Fatalf("unexpected type and code: %d, %d", b[0], b[1])
+	}
+	// The checksum for the message with the valid checksum must be zero.
+	if cs := icmpChecksum(b); cs != 0 {
+		t.Fatalf("unexpected checksum for the marshaled message: %d; want 0", cs)
+	}
+	// Convert the request to reply.
+	b[0] = 0
+	if !isICMPEchoReply(b, 0, 0x1234, 0x5678) {
+		t.Fatalf("expecting echo reply")
+	}
+	if isICMPEchoReply(b, 0, 0x1234, 0x5679) {
+		t.Fatalf("unexpected echo reply for another seq")
+	}
+	if isICMPEchoReply(b, 129, 0x1234, 0x5678) {
+		t.Fatalf("unexpected echo reply for another type")
+	}
+	if isICMPEchoReply(b[:7], 0, 0x1234, 0x5678) {
+		t.Fatalf("unexpected echo reply for truncated message")
+	}
+}
+
+func removeProbeDuration(s string) string {
+	lines := strings.SplitAfter(s, "\n")
+	var a []string
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "probe_duration_seconds ") {
+			a = append(a, line)
+		}
+	}
+	return strings.Join(a, "")
+}
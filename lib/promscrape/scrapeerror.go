@@ -0,0 +1,94 @@
+package promscrape
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/VictoriaMetrics/fasthttp"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// Reasons for scrape errors.
+//
+// They are exposed via `reason` label at vm_promscrape_scrape_errors_total metric
+// and via `lastErrorReason` field at /api/v1/targets page.
+const (
+	scrapeErrorReasonDNS                = "dns"
+	scrapeErrorReasonConnectionRefused  = "connection_refused"
+	scrapeErrorReasonTimeout            = "timeout"
+	scrapeErrorReasonTLS                = "tls"
+	scrapeErrorReasonResponseTooLarge   = "response_too_large"
+	scrapeErrorReasonInvalidContentType = "invalid_content_type"
+	scrapeErrorReasonGzip               = "gzip"
+	scrapeErrorReasonParseError         = "parse_error"
+	scrapeErrorReasonOther              = "other"
+)
+
+// scrapeError is an error with the known reason for scrape failure.
+type scrapeError struct {
+	reason string
+	err    error
+}
+
+func (se *scrapeError) Error() string {
+	return se.err.Error()
+}
+
+func (se *scrapeError) Unwrap() error {
+	return se.err
+}
+
+func newScrapeError(reason string, err error) error {
+	return &scrapeError{
+		reason: reason,
+		err:    err,
+	}
+}
+
+// newStatusCodeError returns an error for unexpected statusCode returned from the given scrapeURL.
+func newStatusCodeError(scrapeURL string, statusCode int, body []byte) error {
+	err := fmt.Errorf("unexpected status code returned when scraping %q: %d; expecting %d; response body: %q",
+		scrapeURL, statusCode, fasthttp.StatusOK, body)
+	return newScrapeError(fmt.Sprintf("http_%d", statusCode), err)
+}
+
+// getScrapeErrorReason returns the reason for the given scrape error.
+func getScrapeErrorReason(err error) string {
+	var se *scrapeError
+	if errors.As(err, &se) {
+		return se.reason
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return scrapeErrorReasonDNS
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return scrapeErrorReasonConnectionRefused
+	}
+	if errors.Is(err, fasthttp.ErrTimeout) || errors.Is(err, fasthttp.ErrDialTimeout) || errors.Is(err, context.DeadlineExceeded) {
+		return scrapeErrorReasonTimeout
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return scrapeErrorReasonTimeout
+	}
+	var (
+		recordHeaderErr     tls.RecordHeaderError
+		unknownAuthorityErr x509.UnknownAuthorityError
+		certInvalidErr      x509.CertificateInvalidError
+		hostnameErr         x509.HostnameError
+	)
+	if errors.As(err, &recordHeaderErr) || errors.As(err, &unknownAuthorityErr) || errors.As(err, &certInvalidErr) || errors.As(err, &hostnameErr) {
+		return scrapeErrorReasonTLS
+	}
+	return scrapeErrorReasonOther
+}
+
+func incScrapeErrors(reason string) {
+	metrics.GetOrCreateCounter(fmt.Sprintf(`vm_promscrape_scrape_errors_total{reason=%q}`, reason)).Inc()
+}
@@ -0,0 +1,37 @@
+package promscrape
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/VictoriaMetrics/fasthttp"
+)
+
+func TestGetScrapeErrorReason(t *testing.T) {
+	f := func(err error, reasonExpected string) {
+		t.Helper()
+		reason := getScrapeErrorReason(err)
+		if reason != reasonExpected {
+			t.Fatalf("unexpected reason for %q; got %q; want %q", err, reason, reasonExpected)
+		}
+	}
+	f(fmt.Errorf("foobar"), scrapeErrorReasonOther)
+	f(newStatusCodeError("http://foo/metrics", 401, []byte("unauthorized")), "http_401")
+	f(fmt.Errorf("cannot read data: %w", newStatusCodeError("http://foo/metrics", 503, nil)), "http_503")
+	f(newScrapeError(scrapeErrorReasonResponseTooLarge, fmt.Errorf("too big")), scrapeErrorReasonResponseTooLarge)
+	f(fmt.Errorf("error when scraping: %w", fasthttp.ErrTimeout), scrapeErrorReasonTimeout)
+	f(fmt.Errorf("cannot scrape: %w", context.DeadlineExceeded), scrapeErrorReasonTimeout)
+	f(fmt.Errorf("error when scraping: %w", &net.DNSError{
+		Err:  "no such host",
+		Name: "foo.bar",
+	}), scrapeErrorReasonDNS)
+	f(fmt.Errorf("error when scraping: %w", &net.OpError{
+		Op:  "dial",
+		Net: "tcp4",
+		Err: os.NewSyscallError("connect", syscall.ECONNREFUSED),
+	}), scrapeErrorReasonConnectionRefused)
+}
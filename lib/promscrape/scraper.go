@@ -4,10 +4,12 @@ import (
 	"bytes"
 	"flag"
 	"fmt"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/procutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
@@ -41,18 +43,20 @@ var (
 	dockerswarmSDCheckInterval = flag.Duration("promscrape.dockerswarmSDCheckInterval", 30*time.Second, "Interval for checking for changes in dockerswarm. "+
 		"This works only if `dockerswarm_sd_configs` is configured in '-promscrape.config' file. "+
 		"See https://prometheus.io/docs/prometheus/latest/configuration/configuration/#dockerswarm_sd_config for details")
-	promscrapeConfigFile = flag.String("promscrape.config", "", "Optional path to Prometheus config file with 'scrape_configs' section containing targets to scrape. "+
-		"See https://victoriametrics.github.io/#how-to-scrape-prometheus-exporters-such-as-node-exporter for details")
+	promscrapeConfigFiles = flagutil.NewArray("promscrape.config", "Optional path to Prometheus config file with 'scrape_configs' section containing targets to scrape. "+
+		"See https://victoriametrics.github.io/#how-to-scrape-prometheus-exporters-such-as-node-exporter for details. "+
+		"The flag can be specified multiple times. The path may contain glob patterns such as '/etc/vmagent/conf.d/*.yml'. "+
+		"Configs from all the files are merged into a single config; `job_name` values must be unique across all the files")
 	suppressDuplicateScrapeTargetErrors = flag.Bool("promscrape.suppressDuplicateScrapeTargetErrors", false, "Whether to suppress `duplicate scrape target` errors; "+
 		"see https://victoriametrics.github.io/vmagent.html#troubleshooting for details")
 )
 
 // CheckConfig checks -promscrape.config for errors and unsupported options.
 func CheckConfig() error {
-	if *promscrapeConfigFile == "" {
+	if len(*promscrapeConfigFiles) == 0 {
 		return fmt.Errorf("missing -promscrape.config option")
 	}
-	_, _, err := loadConfig(*promscrapeConfigFile)
+	_, _, err := loadConfigs(*promscrapeConfigFiles)
 	return err
 }
 
@@ -64,7 +68,7 @@ func Init(pushData func(wr *prompbmarshal.WriteRequest)) {
 	scraperWG.Add(1)
 	go func() {
 		defer scraperWG.Done()
-		runScraper(*promscrapeConfigFile, pushData, globalStopCh)
+		runScraper(*promscrapeConfigFiles, pushData, globalStopCh)
 	}()
 }
 
@@ -82,14 +86,15 @@ var (
 	PendingScrapeConfigs int32
 )
 
-func runScraper(configFile string, pushData func(wr *prompbmarshal.WriteRequest), globalStopCh <-chan struct{}) {
-	if configFile == "" {
+func runScraper(configFiles []string, pushData func(wr *prompbmarshal.WriteRequest), globalStopCh <-chan struct{}) {
+	if len(configFiles) == 0 {
 		// Nothing to scrape.
 		return
 	}
 
+	configFile := strings.Join(configFiles, ",")
 	logger.Infof("reading Prometheus configs from %q", configFile)
-	cfg, data, err := loadConfig(configFile)
+	cfg, data, err := loadConfigs(configFiles)
 	if err != nil {
 		logger.Fatalf("cannot read %q: %s", configFile, err)
 	}
@@ -98,6 +103,7 @@ func runScraper(configFile string, pushData func(wr *prompbmarshal.WriteRequest)
 	scs.add("static_configs", 0, func(cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork { return cfg.getStaticScrapeWork() })
 	scs.add("file_sd_configs", *fileSDCheckInterval, func(cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork { return cfg.getFileSDScrapeWork(swsPrev) })
 	scs.add("kubernetes_sd_configs", *kubernetesSDCheckInterval, func(cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork { return cfg.getKubernetesSDScrapeWork(swsPrev) })
+	scs.add("kubernetes_crd_configs", *kubernetesSDCheckInterval, func(cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork { return cfg.getKubernetesCRDScrapeWork(swsPrev) })
 	scs.add("openstack_sd_configs", *openstackSDCheckInterval, func(cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork { return cfg.getOpenStackSDScrapeWork(swsPrev) })
 	scs.add("consul_sd_configs", *consul.SDCheckInterval, func(cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork { return cfg.getConsulSDScrapeWork(swsPrev) })
 	scs.add("eureka_sd_configs", *eurekaSDCheckInterval, func(cfg *Config, swsPrev []*ScrapeWork) []*ScrapeWork { return cfg.getEurekaSDScrapeWork(swsPrev) })
@@ -120,7 +126,7 @@ func runScraper(configFile string, pushData func(wr *prompbmarshal.WriteRequest)
 		select {
 		case <-sighupCh:
 			logger.Infof("SIGHUP received; reloading Prometheus configs from %q", configFile)
-			cfgNew, dataNew, err := loadConfig(configFile)
+			cfgNew, dataNew, err := loadConfigs(configFiles)
 			if err != nil {
 				logger.Errorf("cannot read %q on SIGHUP: %s; continuing with the previous config", configFile, err)
 				goto waitForChans
@@ -132,7 +138,7 @@ func runScraper(configFile string, pushData func(wr *prompbmarshal.WriteRequest)
 			cfg = cfgNew
 			data = dataNew
 		case <-tickerCh:
-			cfgNew, dataNew, err := loadConfig(configFile)
+			cfgNew, dataNew, err := loadConfigs(configFiles)
 			if err != nil {
 				logger.Errorf("cannot read %q: %s; continuing with the previous config", configFile, err)
 				goto waitForChans
@@ -360,11 +366,17 @@ func newScraper(sw *ScrapeWork, group string, pushData func(wr *prompbmarshal.Wr
 	sc := &scraper{
 		stopCh: make(chan struct{}),
 	}
-	c := newClient(sw)
 	sc.sw.Config = sw
 	sc.sw.ScrapeGroup = group
-	sc.sw.ReadData = c.ReadData
-	sc.sw.GetStreamReader = c.GetStreamReader
+	if sw.Probe != nil {
+		p := newProber(sw)
+		sc.sw.ReadData = p.ReadData
+		sc.sw.GetStreamReader = p.GetStreamReader
+	} else {
+		c := newClient(sw)
+		sc.sw.ReadData = c.ReadData
+		sc.sw.GetStreamReader = c.GetStreamReader
+	}
 	sc.sw.PushData = pushData
 	return sc
 }
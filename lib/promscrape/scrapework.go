@@ -25,8 +25,19 @@ import (
 var (
 	suppressScrapeErrors = flag.Bool("promscrape.suppressScrapeErrors", false, "Whether to suppress scrape errors logging. "+
 		"The last error for each target is always available at '/targets' page even if scrape errors logging is suppressed")
+	scrapeErrorsLogInterval = flag.Duration("promscrape.scrapeErrorsLogInterval", 0, "The minimum interval between logging scrape errors for each target. "+
+		"Errors occurred during this interval after the last logged error for the target aren't logged; the number of such errors is mentioned in the next logged error. "+
+		"By default all the scrape errors are logged. See also -promscrape.suppressScrapeErrors")
+	scrapeExemplars = flag.Bool("promscrape.scrapeExemplars", false, "Whether to collect exemplars exposed by scrape targets in OpenMetrics format "+
+		"and to send them to remote storage together with the scraped samples. See https://github.com/OpenObservability/OpenMetrics/blob/master/specification/OpenMetrics.md#exemplars")
+	scrapeMetadata = flag.Bool("promscrape.scrapeMetadata", false, "Whether to collect metric metadata from HELP, TYPE and UNIT comment lines exposed by scrape targets. "+
+		"The collected metadata is available at /api/v1/targets/metadata and it is sent to remote storage once per minute per each target. "+
+		"Metadata isn't collected from targets with enabled stream parsing mode")
 )
 
+// metadataSendInterval is the interval for sending the collected metadata to remote storage per each target.
+const metadataSendInterval = 60 * 1000
+
 // ScrapeWork represents a unit of work for scraping Prometheus metrics.
 //
 // It must be immutable during its lifetime, since it is read from concurrently running goroutines.
@@ -77,6 +88,9 @@ type ScrapeWork struct {
 	// Optional `metric_relabel_configs`.
 	MetricRelabelConfigs *promrelabel.ParsedConfigs
 
+	// Optional `metric_normalization`.
+	MetricNormalizer *MetricNormalizer
+
 	// The maximum number of metrics to scrape after relabeling.
 	SampleLimit int
 
@@ -89,6 +103,19 @@ type ScrapeWork struct {
 	// Whether to parse target responses in a streaming manner.
 	StreamParse bool
 
+	// Optional path to unix domain socket for scraping ScrapeURL.
+	//
+	// It is set for targets with `unix:///path/to/socket` address.
+	UnixSocketPath string
+
+	// Whether to scrape ScrapeURL over HTTP/2. Plaintext HTTP/2 (aka h2c) is used for http scheme.
+	EnableHTTP2 bool
+
+	// Optional options for the built-in prober.
+	//
+	// It is set for targets from `probe_configs`. Such targets are checked by the prober instead of scraping.
+	Probe *ProbeOptions
+
 	// The interval for aligning the first scrape.
 	ScrapeAlignInterval time.Duration
 
@@ -102,9 +129,11 @@ type ScrapeWork struct {
 func (sw *ScrapeWork) key() string {
 	// Do not take into account OriginalLabels.
 	key := fmt.Sprintf("ScrapeURL=%s, ScrapeInterval=%s, ScrapeTimeout=%s, HonorLabels=%v, HonorTimestamps=%v, Labels=%s, "+
-		"AuthConfig=%s, MetricRelabelConfigs=%s, SampleLimit=%d, DisableCompression=%v, DisableKeepAlive=%v, StreamParse=%v, ScrapeAlignInterval=%s",
+		"AuthConfig=%s, MetricRelabelConfigs=%s, MetricNormalizer={%s}, SampleLimit=%d, DisableCompression=%v, DisableKeepAlive=%v, StreamParse=%v, "+
+		"UnixSocketPath=%s, EnableHTTP2=%v, Probe={%s}, ScrapeAlignInterval=%s",
 		sw.ScrapeURL, sw.ScrapeInterval, sw.ScrapeTimeout, sw.HonorLabels, sw.HonorTimestamps, sw.LabelsString(),
-		sw.AuthConfig.String(), sw.MetricRelabelConfigs.String(), sw.SampleLimit, sw.DisableCompression, sw.DisableKeepAlive, sw.StreamParse, sw.ScrapeAlignInterval)
+		sw.AuthConfig.String(), sw.MetricRelabelConfigs.String(), sw.MetricNormalizer.String(), sw.SampleLimit, sw.DisableCompression, sw.DisableKeepAlive, sw.StreamParse,
+		sw.UnixSocketPath, sw.EnableHTTP2, sw.Probe.String(), sw.ScrapeAlignInterval)
 	return key
 }
 
@@ -171,6 +200,25 @@ type scrapeWork struct {
 	// prevRowsLen contains the number rows scraped during the previous scrape.
 	// It is used as a hint in order to reduce memory usage when parsing scrape responses.
 	prevRowsLen int
+
+	// errLogLock protects the fields below.
+	// It is needed because parse errors may be logged concurrently in stream parsing mode.
+	errLogLock sync.Mutex
+
+	// nextErrLogTime is the time when the next scrape error may be logged according to -promscrape.scrapeErrorsLogInterval.
+	nextErrLogTime time.Time
+
+	// suppressedErrLogs is the number of errors, which weren't logged since the last logged error.
+	suppressedErrLogs int
+
+	// lastParseError contains the last parse error occurred during the current scrape.
+	lastParseError string
+
+	// nextMetadataTimestamp is the timestamp in milliseconds for the next collection of metadata if -promscrape.scrapeMetadata is set.
+	nextMetadataTimestamp int64
+
+	// metricTypes contains metric types from `# TYPE` lines for the current scrape if Config.MetricNormalizer needs them.
+	metricTypes map[string]string
 }
 
 func (sw *scrapeWork) run(stopCh <-chan struct{}) {
@@ -225,20 +273,60 @@ func (sw *scrapeWork) run(stopCh <-chan struct{}) {
 	}
 }
 
+// logError is called for each line, which cannot be parsed during the scrape.
 func (sw *scrapeWork) logError(s string) {
-	if !*suppressScrapeErrors {
-		logger.ErrorfSkipframes(1, "error when scraping %q from job %q with labels %s: %s; "+
-			"scrape errors can be disabled by -promscrape.suppressScrapeErrors command-line flag",
-			sw.Config.ScrapeURL, sw.Config.Job(), sw.Config.LabelsString(), s)
-	}
+	incScrapeErrors(scrapeErrorReasonParseError)
+	sw.errLogLock.Lock()
+	sw.lastParseError = s
+	sw.errLogLock.Unlock()
+	sw.logScrapeError(scrapeErrorReasonParseError, s)
+}
+
+// popLastParseError returns the last parse error occurred during the current scrape and resets it.
+func (sw *scrapeWork) popLastParseError() string {
+	sw.errLogLock.Lock()
+	s := sw.lastParseError
+	sw.lastParseError = ""
+	sw.errLogLock.Unlock()
+	return s
 }
 
 func (sw *scrapeWork) scrapeAndLogError(scrapeTimestamp, realTimestamp int64) {
-	if err := sw.scrapeInternal(scrapeTimestamp, realTimestamp); err != nil && !*suppressScrapeErrors {
-		logger.Errorf("error when scraping %q from job %q with labels %s: %s", sw.Config.ScrapeURL, sw.Config.Job(), sw.Config.LabelsString(), err)
+	if err := sw.scrapeInternal(scrapeTimestamp, realTimestamp); err != nil {
+		reason := getScrapeErrorReason(err)
+		incScrapeErrors(reason)
+		sw.logScrapeError(reason, err.Error())
 	}
 }
 
+// logScrapeError logs errMsg with the given reason according to -promscrape.suppressScrapeErrors and -promscrape.scrapeErrorsLogInterval.
+func (sw *scrapeWork) logScrapeError(reason, errMsg string) {
+	if *suppressScrapeErrors {
+		return
+	}
+	suppressedErrLogs := 0
+	if d := *scrapeErrorsLogInterval; d > 0 {
+		currentTime := time.Now()
+		sw.errLogLock.Lock()
+		if currentTime.Before(sw.nextErrLogTime) {
+			sw.suppressedErrLogs++
+			sw.errLogLock.Unlock()
+			return
+		}
+		sw.nextErrLogTime = currentTime.Add(d)
+		suppressedErrLogs = sw.suppressedErrLogs
+		sw.suppressedErrLogs = 0
+		sw.errLogLock.Unlock()
+	}
+	if suppressedErrLogs > 0 {
+		errMsg = fmt.Sprintf("%s; %d errors for the target were suppressed since the previous logged error because of -promscrape.scrapeErrorsLogInterval=%s",
+			errMsg, suppressedErrLogs, *scrapeErrorsLogInterval)
+	}
+	logger.Errorf("error when scraping %q from job %q with labels %s (reason=%s): %s; "+
+		"scrape errors can be disabled by -promscrape.suppressScrapeErrors command-line flag",
+		sw.Config.ScrapeURL, sw.Config.Job(), sw.Config.LabelsString(), reason, errMsg)
+}
+
 var (
 	scrapeDuration              = metrics.NewHistogram("vm_promscrape_scrape_duration_seconds")
 	scrapeResponseSize          = metrics.NewHistogram("vm_promscrape_scrape_response_size_bytes")
@@ -267,12 +355,24 @@ func (sw *scrapeWork) scrapeInternal(scrapeTimestamp, realTimestamp int64) error
 	scrapeResponseSize.Update(float64(len(body.B)))
 	up := 1
 	wc := writeRequestCtxPool.Get(sw.prevRowsLen)
+	needMetadata := false
 	if err != nil {
 		up = 0
 		scrapesFailed.Inc()
 	} else {
 		bodyString := bytesutil.ToUnsafeString(body.B)
 		wc.rows.UnmarshalWithErrLogger(bodyString, sw.logError)
+		if *scrapeMetadata && realTimestamp >= sw.nextMetadataTimestamp {
+			wc.metadata = parser.AppendMetadata(wc.metadata[:0], bodyString)
+			needMetadata = true
+			sw.nextMetadataTimestamp = realTimestamp + metadataSendInterval
+		}
+		if sw.Config.MetricNormalizer.needMetricTypes() {
+			if !needMetadata {
+				wc.metadata = parser.AppendMetadata(wc.metadata[:0], bodyString)
+			}
+			sw.updateMetricTypes(wc.metadata)
+		}
 	}
 	srcRows := wc.rows.Rows
 	samplesScraped := len(srcRows)
@@ -305,16 +405,23 @@ func (sw *scrapeWork) scrapeInternal(scrapeTimestamp, realTimestamp int64) error
 	sw.addAutoTimeseries(wc, "scrape_samples_scraped", float64(samplesScraped), scrapeTimestamp)
 	sw.addAutoTimeseries(wc, "scrape_samples_post_metric_relabeling", float64(samplesPostRelabeling), scrapeTimestamp)
 	sw.addAutoTimeseries(wc, "scrape_series_added", float64(seriesAdded), scrapeTimestamp)
+	if needMetadata {
+		wc.addMetadata()
+	}
 	startTime := time.Now()
 	sw.PushData(&wc.writeRequest)
 	pushDataDuration.UpdateDuration(startTime)
 	sw.prevRowsLen = samplesScraped
+	tsmGlobal.Update(sw.Config, sw.ScrapeGroup, up == 1, realTimestamp, int64(duration*1000), err, sw.popLastParseError())
+	if needMetadata {
+		tsmGlobal.UpdateMetadata(sw.Config, wc.metadata)
+	}
+	sw.resetMetricTypes()
 	wc.reset()
 	writeRequestCtxPool.Put(wc)
 	// body must be released only after wc is released, since wc refers to body.
 	sw.prevBodyLen = len(body.B)
 	leveledbytebufferpool.Put(body)
-	tsmGlobal.Update(sw.Config, sw.ScrapeGroup, up == 1, realTimestamp, int64(duration*1000), err)
 	return err
 }
 
@@ -326,7 +433,7 @@ func (sw *scrapeWork) scrapeStream(scrapeTimestamp, realTimestamp int64) error {
 
 	sr, err := sw.GetStreamReader()
 	if err != nil {
-		err = fmt.Errorf("cannot read data: %s", err)
+		err = fmt.Errorf("cannot read data: %w", err)
 	} else {
 		var mu sync.Mutex
 		err = parser.ParseStream(sr, scrapeTimestamp, false, func(rows []parser.Row) error {
@@ -375,7 +482,7 @@ func (sw *scrapeWork) scrapeStream(scrapeTimestamp, realTimestamp int64) error {
 	sw.prevRowsLen = len(wc.rows.Rows)
 	wc.reset()
 	writeRequestCtxPool.Put(wc)
-	tsmGlobal.Update(sw.Config, sw.ScrapeGroup, up == 1, realTimestamp, int64(duration*1000), err)
+	tsmGlobal.Update(sw.Config, sw.ScrapeGroup, up == 1, realTimestamp, int64(duration*1000), err, sw.popLastParseError())
 	return err
 }
 
@@ -428,6 +535,11 @@ type writeRequestCtx struct {
 	writeRequest prompbmarshal.WriteRequest
 	labels       []prompbmarshal.Label
 	samples      []prompbmarshal.Sample
+	exemplars    []prompbmarshal.Exemplar
+	metadata     []parser.Metadata
+
+	// buf holds metric names and label values changed by metric normalization.
+	buf []byte
 }
 
 func (wc *writeRequestCtx) reset() {
@@ -439,6 +551,30 @@ func (wc *writeRequestCtx) resetNoRows() {
 	prompbmarshal.ResetWriteRequest(&wc.writeRequest)
 	wc.labels = wc.labels[:0]
 	wc.samples = wc.samples[:0]
+	for i := range wc.exemplars {
+		wc.exemplars[i] = prompbmarshal.Exemplar{}
+	}
+	wc.exemplars = wc.exemplars[:0]
+	for i := range wc.metadata {
+		wc.metadata[i] = parser.Metadata{}
+	}
+	wc.metadata = wc.metadata[:0]
+	wc.buf = wc.buf[:0]
+}
+
+// addMetadata adds wc.metadata to wc.writeRequest.
+func (wc *writeRequestCtx) addMetadata() {
+	mms := wc.writeRequest.Metadata[:0]
+	for i := range wc.metadata {
+		md := &wc.metadata[i]
+		mms = append(mms, prompbmarshal.MetricMetadata{
+			Type:             prompbmarshal.GetMetricMetadataType(md.Type),
+			MetricFamilyName: md.Metric,
+			Help:             md.Help,
+			Unit:             md.Unit,
+		})
+	}
+	wc.writeRequest.Metadata = mms
 }
 
 var writeRequestCtxPool leveledWriteRequestCtxPool
@@ -491,6 +627,9 @@ func (sw *scrapeWork) addAutoTimeseries(wc *writeRequestCtx, name string, value
 }
 
 func (sw *scrapeWork) addRowToTimeseries(wc *writeRequestCtx, r *parser.Row, timestamp int64, needRelabel bool) {
+	if needRelabel && sw.Config.MetricNormalizer != nil {
+		sw.normalizeRow(wc, r)
+	}
 	labelsLen := len(wc.labels)
 	wc.labels = appendLabels(wc.labels, r.Metric, r.Tags, sw.Config.Labels, sw.Config.HonorLabels)
 	if needRelabel {
@@ -511,11 +650,32 @@ func (sw *scrapeWork) addRowToTimeseries(wc *writeRequestCtx, r *parser.Row, tim
 		Value:     r.Value,
 		Timestamp: sampleTimestamp,
 	})
-	wr := &wc.writeRequest
-	wr.Timeseries = append(wr.Timeseries, prompbmarshal.TimeSeries{
+	ts := prompbmarshal.TimeSeries{
 		Labels:  wc.labels[labelsLen:],
 		Samples: wc.samples[len(wc.samples)-1:],
-	})
+	}
+	if r.HasExemplar && *scrapeExemplars {
+		exemplarLabelsLen := len(wc.labels)
+		for i := range r.Exemplar.Tags {
+			tag := &r.Exemplar.Tags[i]
+			wc.labels = append(wc.labels, prompbmarshal.Label{
+				Name:  tag.Key,
+				Value: tag.Value,
+			})
+		}
+		exemplarTimestamp := r.Exemplar.Timestamp
+		if exemplarTimestamp == 0 {
+			exemplarTimestamp = sampleTimestamp
+		}
+		wc.exemplars = append(wc.exemplars, prompbmarshal.Exemplar{
+			Labels:    wc.labels[exemplarLabelsLen:],
+			Value:     r.Exemplar.Value,
+			Timestamp: exemplarTimestamp,
+		})
+		ts.Exemplars = wc.exemplars[len(wc.exemplars)-1:]
+	}
+	wr := &wc.writeRequest
+	wr.Timeseries = append(wr.Timeseries, ts)
 }
 
 func appendLabels(dst []prompbmarshal.Label, metric string, src []parser.Tag, extraLabels []prompbmarshal.Label, honorLabels bool) []prompbmarshal.Label {
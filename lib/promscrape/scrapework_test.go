@@ -335,6 +335,40 @@ func TestScrapeWorkScrapeInternalSuccess(t *testing.T) {
 		scrape_samples_post_metric_relabeling 0 123
 		scrape_series_added 0 123
 	`)
+	f(`
+		# TYPE requests counter
+		requests{path="/"} 12
+		# TYPE latency_ms summary
+		latency_ms{quantile="0.5"} 250
+		latency_ms_sum 1500
+		latency_ms_count 10
+		# TYPE cpu_usage_percent gauge
+		cpu_usage_percent 42
+	`, &ScrapeWork{
+		MetricNormalizer: mustNewMetricNormalizer(`
+append_total_to_counters: true
+convert_units: true
+rules:
+- regex: "cpu_usage_percent"
+  replacement: "cpu_usage"
+  multiplier: 0.01
+`),
+		MetricRelabelConfigs: mustParseRelabelConfigs(`
+- action: drop
+  source_labels: [__name__]
+  regex: "latency_seconds_count"
+`),
+	}, `
+		requests_total{path="/"} 12 123
+		latency_seconds{quantile="0.5"} 0.25 123
+		latency_seconds_sum 1.5 123
+		cpu_usage 0.42 123
+		up 1 123
+		scrape_samples_scraped 5 123
+		scrape_duration_seconds 0 123
+		scrape_samples_post_metric_relabeling 4 123
+		scrape_series_added 4 123
+	`)
 }
 
 func parseData(data string) []prompbmarshal.TimeSeries {
@@ -21,7 +21,7 @@ func statStdDial(ctx context.Context, network, addr string) (net.Conn, error) {
 	dialsTotal.Inc()
 	if err != nil {
 		dialErrors.Inc()
-		if !netutil.TCP6Enabled() {
+		if network != "unix" && !netutil.TCP6Enabled() {
 			err = fmt.Errorf("%w; try -enableTCP6 command-line flag if you scrape ipv6 addresses", err)
 		}
 		return nil, err
@@ -33,6 +33,18 @@ func statStdDial(ctx context.Context, network, addr string) (net.Conn, error) {
 	return sc, nil
 }
 
+// newStatStdDialFunc returns dial func for net/http client.
+//
+// All the connections are established to unixSocketPath if it isn't empty.
+func newStatStdDialFunc(unixSocketPath string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	if unixSocketPath == "" {
+		return statStdDial
+	}
+	return func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return statStdDial(ctx, "unix", unixSocketPath)
+	}
+}
+
 func getStdDialer() *net.Dialer {
 	stdDialerOnce.Do(func() {
 		stdDialer = &net.Dialer{
@@ -49,17 +61,28 @@ var (
 	stdDialerOnce sync.Once
 )
 
-func newStatDialFunc(proxyURL proxy.URL, tlsConfig *tls.Config) (fasthttp.DialFunc, error) {
-	dialFunc, err := proxyURL.NewDialFunc(tlsConfig)
-	if err != nil {
-		return nil, err
+// newStatDialFunc returns dial func for fasthttp client.
+//
+// All the connections are established to unixSocketPath if it isn't empty.
+func newStatDialFunc(proxyURL proxy.URL, tlsConfig *tls.Config, unixSocketPath string) (fasthttp.DialFunc, error) {
+	var dialFunc fasthttp.DialFunc
+	if unixSocketPath != "" {
+		dialFunc = func(_ string) (net.Conn, error) {
+			return net.DialTimeout("unix", unixSocketPath, 5*time.Second)
+		}
+	} else {
+		df, err := proxyURL.NewDialFunc(tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		dialFunc = df
 	}
 	statDialFunc := func(addr string) (net.Conn, error) {
 		conn, err := dialFunc(addr)
 		dialsTotal.Inc()
 		if err != nil {
 			dialErrors.Inc()
-			if !netutil.TCP6Enabled() {
+			if unixSocketPath == "" && !netutil.TCP6Enabled() {
 				err = fmt.Errorf("%w; try -enableTCP6 command-line flag if you scrape ipv6 addresses", err)
 			}
 			return nil, err
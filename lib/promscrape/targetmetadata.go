@@ -0,0 +1,186 @@
+package promscrape
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
+	parser "github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/prometheus"
+	"github.com/VictoriaMetrics/metricsql"
+)
+
+// WriteAPIV1TargetsMetadata writes /api/v1/targets/metadata response for the given r to w.
+//
+// See https://prometheus.io/docs/prometheus/latest/querying/api/#querying-target-metadata
+func WriteAPIV1TargetsMetadata(w http.ResponseWriter, r *http.Request) error {
+	matchTarget := r.FormValue("match_target")
+	metric := r.FormValue("metric")
+	limit := 0
+	if limitStr := r.FormValue("limit"); len(limitStr) > 0 {
+		n, err := strconv.Atoi(limitStr)
+		if err != nil {
+			return fmt.Errorf("cannot parse `limit` arg %q: %w", limitStr, err)
+		}
+		limit = n
+	}
+	lfs, err := parseTargetMatcher(matchTarget)
+	if err != nil {
+		return fmt.Errorf("cannot parse match_target=%q: %w", matchTarget, err)
+	}
+	tms := tsmGlobal.getTargetsMetadata(lfs, metric, limit)
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	fmt.Fprintf(w, `{"status":"success","data":[`)
+	for i := range tms {
+		tm := &tms[i]
+		fmt.Fprintf(w, `{"target":`)
+		writeLabelsJSON(w, tm.targetLabels)
+		md := tm.md
+		fmt.Fprintf(w, `,"metric":%q,"type":%q,"help":%q,"unit":%q}`, md.Metric, md.Type, md.Help, md.Unit)
+		if i+1 < len(tms) {
+			fmt.Fprintf(w, `,`)
+		}
+	}
+	fmt.Fprintf(w, `]}`)
+	return nil
+}
+
+type targetMetadata struct {
+	targetLabels []prompbmarshal.Label
+	md           *parser.Metadata
+}
+
+// UpdateMetadata updates metadata for the given sw with the copy of mds.
+func (tsm *targetStatusMap) UpdateMetadata(sw *ScrapeWork, mds []parser.Metadata) {
+	mdsCopy := make([]parser.Metadata, len(mds))
+	for i := range mds {
+		src := &mds[i]
+		mdsCopy[i] = parser.Metadata{
+			Metric: copyString(src.Metric),
+			Type:   copyString(src.Type),
+			Help:   copyString(src.Help),
+			Unit:   copyString(src.Unit),
+		}
+	}
+	tsm.mu.Lock()
+	if ts := tsm.m[sw]; ts != nil {
+		ts.metadata = mdsCopy
+	}
+	tsm.mu.Unlock()
+}
+
+func copyString(s string) string {
+	return string(append([]byte{}, s...))
+}
+
+func (tsm *targetStatusMap) getTargetsMetadata(lfs []*targetLabelFilter, metric string, limit int) []targetMetadata {
+	var tms []targetMetadata
+	tsm.mu.Lock()
+	for sw, ts := range tsm.m {
+		if len(ts.metadata) == 0 {
+			continue
+		}
+		labels := promrelabel.FinalizeLabels(nil, sw.Labels)
+		if !matchTargetLabels(lfs, labels) {
+			continue
+		}
+		// ts.metadata is never modified after the assignment in UpdateMetadata,
+		// so it is safe to refer to its items after releasing the lock.
+		mds := ts.metadata
+		for i := range mds {
+			md := &mds[i]
+			if metric != "" && md.Metric != metric {
+				continue
+			}
+			tms = append(tms, targetMetadata{
+				targetLabels: labels,
+				md:           md,
+			})
+		}
+	}
+	tsm.mu.Unlock()
+
+	sort.Slice(tms, func(i, j int) bool {
+		a, b := tms[i], tms[j]
+		if a.md.Metric != b.md.Metric {
+			return a.md.Metric < b.md.Metric
+		}
+		return promLabelsString(a.targetLabels) < promLabelsString(b.targetLabels)
+	})
+	if limit > 0 && len(tms) > limit {
+		tms = tms[:limit]
+	}
+	return tms
+}
+
+// targetLabelFilter is a label filter from `match_target` query arg.
+type targetLabelFilter struct {
+	name       string
+	value      string
+	isNegative bool
+	re         *regexp.Regexp
+}
+
+func parseTargetMatcher(s string) ([]*targetLabelFilter, error) {
+	if s == "" {
+		return nil, nil
+	}
+	expr, err := metricsql.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	me, ok := expr.(*metricsql.MetricExpr)
+	if !ok {
+		return nil, fmt.Errorf("expecting label selector; got %q", expr.AppendString(nil))
+	}
+	lfs := make([]*targetLabelFilter, 0, len(me.LabelFilters))
+	for _, lf := range me.LabelFilters {
+		name := lf.Label
+		if name == "" {
+			name = "__name__"
+		}
+		f := &targetLabelFilter{
+			name:       name,
+			value:      lf.Value,
+			isNegative: lf.IsNegative,
+		}
+		if lf.IsRegexp {
+			re, err := regexp.Compile("^(?:" + lf.Value + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse regexp for label %q: %w", name, err)
+			}
+			f.re = re
+		}
+		lfs = append(lfs, f)
+	}
+	return lfs, nil
+}
+
+func (lf *targetLabelFilter) match(labels []prompbmarshal.Label) bool {
+	value := ""
+	for _, label := range labels {
+		if label.Name == lf.name {
+			value = label.Value
+			break
+		}
+	}
+	var ok bool
+	if lf.re != nil {
+		ok = lf.re.MatchString(value)
+	} else {
+		ok = value == lf.value
+	}
+	return ok != lf.isNegative
+}
+
+func matchTargetLabels(lfs []*targetLabelFilter, labels []prompbmarshal.Label) bool {
+	for _, lf := range lfs {
+		if !lf.match(labels) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,107 @@
+package promscrape
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
+// WriteAPIV1TargetsResolved writes /api/v1/targets/resolved response for the given r to w.
+//
+// The response contains scrape targets after service discovery and relabeling grouped by `job_name` from `scrape_configs`.
+// It contains only stable target properties, so it may be compared against golden files in CI.
+//
+// The response is in JSON by default. Pass `format=yaml` for YAML response.
+// Pass `job_name=<name>` for limiting the response to the given job.
+func WriteAPIV1TargetsResolved(w http.ResponseWriter, r *http.Request) error {
+	format := r.FormValue("format")
+	if format != "" && format != "json" && format != "yaml" {
+		return fmt.Errorf("unsupported `format` arg %q; supported values: json, yaml", format)
+	}
+	jobs := tsmGlobal.getResolvedJobs(r.FormValue("job_name"))
+	if format == "yaml" {
+		data, err := yaml.Marshal(jobs)
+		if err != nil {
+			return fmt.Errorf("cannot marshal resolved targets to YAML: %w", err)
+		}
+		w.Header().Set("Content-Type", "application/yaml; charset=utf-8")
+		_, err = w.Write(data)
+		return err
+	}
+	data, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return fmt.Errorf("cannot marshal resolved targets to JSON: %w", err)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	_, err = w.Write(data)
+	return err
+}
+
+// resolvedJob contains resolved scrape targets for a single `job_name`.
+type resolvedJob struct {
+	JobName string           `json:"jobName" yaml:"job_name"`
+	Targets []resolvedTarget `json:"targets" yaml:"targets"`
+}
+
+// resolvedTarget represents scrape target after service discovery and relabeling.
+type resolvedTarget struct {
+	ScrapeURL      string            `json:"scrapeUrl" yaml:"scrape_url"`
+	ScrapeInterval string            `json:"scrapeInterval" yaml:"scrape_interval"`
+	ScrapeTimeout  string            `json:"scrapeTimeout" yaml:"scrape_timeout"`
+	Labels         map[string]string `json:"labels" yaml:"labels"`
+}
+
+// getResolvedJobs returns resolved targets for the registered scrape works.
+//
+// Jobs are sorted by name, while targets are sorted by scrape url and labels, so the result doesn't depend on discovery order.
+// Only targets for the given jobNameFilter are returned if jobNameFilter isn't empty.
+func (tsm *targetStatusMap) getResolvedJobs(jobNameFilter string) []resolvedJob {
+	type keyedTarget struct {
+		key string
+		rt  resolvedTarget
+	}
+	byJob := make(map[string][]keyedTarget)
+	tsm.mu.Lock()
+	for sw := range tsm.m {
+		jobName := sw.jobNameOriginal
+		if jobNameFilter != "" && jobName != jobNameFilter {
+			continue
+		}
+		labels := make(map[string]string, len(sw.Labels))
+		for _, label := range sw.Labels {
+			labels[label.Name] = label.Value
+		}
+		byJob[jobName] = append(byJob[jobName], keyedTarget{
+			key: sw.ScrapeURL + promLabelsString(sw.Labels),
+			rt: resolvedTarget{
+				ScrapeURL:      sw.ScrapeURL,
+				ScrapeInterval: formatPromDuration(sw.ScrapeInterval),
+				ScrapeTimeout:  formatPromDuration(sw.ScrapeTimeout),
+				Labels:         labels,
+			},
+		})
+	}
+	tsm.mu.Unlock()
+
+	jobs := make([]resolvedJob, 0, len(byJob))
+	for jobName, kts := range byJob {
+		sort.Slice(kts, func(i, j int) bool {
+			return kts[i].key < kts[j].key
+		})
+		rts := make([]resolvedTarget, len(kts))
+		for i := range kts {
+			rts[i] = kts[i].rt
+		}
+		jobs = append(jobs, resolvedJob{
+			JobName: jobName,
+			Targets: rts,
+		})
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].JobName < jobs[j].JobName
+	})
+	return jobs
+}
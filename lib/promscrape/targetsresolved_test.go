@@ -0,0 +1,65 @@
+package promscrape
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+)
+
+func TestGetResolvedJobs(t *testing.T) {
+	tsm := newTargetStatusMap()
+	newScrapeWork := func(jobNameOriginal, job, scrapeURL string) *ScrapeWork {
+		return &ScrapeWork{
+			ScrapeURL:      scrapeURL,
+			ScrapeInterval: 30 * time.Second,
+			ScrapeTimeout:  10 * time.Second,
+			Labels: []prompbmarshal.Label{
+				{
+					Name:  "job",
+					Value: job,
+				},
+			},
+			jobNameOriginal: jobNameOriginal,
+		}
+	}
+	tsm.Register(newScrapeWork("foo", "foo", "http://host2/metrics"))
+	tsm.Register(newScrapeWork("foo", "foo", "http://host1/metrics"))
+	// The job label may be changed by relabeling, so targets must be grouped by the original job_name.
+	tsm.Register(newScrapeWork("bar", "relabeled", "http://host3/metrics"))
+
+	f := func(jobNameFilter string, jobsExpected []resolvedJob) {
+		t.Helper()
+		jobs := tsm.getResolvedJobs(jobNameFilter)
+		if !reflect.DeepEqual(jobs, jobsExpected) {
+			t.Fatalf("unexpected jobs for jobNameFilter=%q\ngot\n%+v\nwant\n%+v", jobNameFilter, jobs, jobsExpected)
+		}
+	}
+	newResolvedTarget := func(job, scrapeURL string) resolvedTarget {
+		return resolvedTarget{
+			ScrapeURL:      scrapeURL,
+			ScrapeInterval: "30s",
+			ScrapeTimeout:  "10s",
+			Labels: map[string]string{
+				"job": job,
+			},
+		}
+	}
+	jobBar := resolvedJob{
+		JobName: "bar",
+		Targets: []resolvedTarget{
+			newResolvedTarget("relabeled", "http://host3/metrics"),
+		},
+	}
+	jobFoo := resolvedJob{
+		JobName: "foo",
+		Targets: []resolvedTarget{
+			newResolvedTarget("foo", "http://host1/metrics"),
+			newResolvedTarget("foo", "http://host2/metrics"),
+		},
+	}
+	f("", []resolvedJob{jobBar, jobFoo})
+	f("foo", []resolvedJob{jobFoo})
+	f("missing", []resolvedJob{})
+}
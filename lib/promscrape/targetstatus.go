@@ -16,6 +16,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/promrelabel"
+	parser "github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/prometheus"
 )
 
 var maxDroppedTargets = flag.Int("promscrape.maxDroppedTargets", 1000, "The maximum number of `droppedTargets` shown at /api/v1/targets page. "+
@@ -38,19 +39,21 @@ func WriteHumanReadableTargetsStatus(w http.ResponseWriter, r *http.Request) {
 }
 
 // WriteAPIV1Targets writes /api/v1/targets to w according to https://prometheus.io/docs/prometheus/latest/querying/api/#targets
-func WriteAPIV1Targets(w io.Writer, state string) {
+//
+// Only targets for the given scrapePool are written if scrapePool isn't empty.
+func WriteAPIV1Targets(w io.Writer, state, scrapePool string) {
 	if state == "" {
 		state = "any"
 	}
 	fmt.Fprintf(w, `{"status":"success","data":{"activeTargets":`)
 	if state == "active" || state == "any" {
-		tsmGlobal.WriteActiveTargetsJSON(w)
+		tsmGlobal.WriteActiveTargetsJSON(w, scrapePool)
 	} else {
 		fmt.Fprintf(w, `[]`)
 	}
 	fmt.Fprintf(w, `,"droppedTargets":`)
 	if state == "dropped" || state == "any" {
-		droppedTargetsMap.WriteDroppedTargetsJSON(w)
+		droppedTargetsMap.WriteDroppedTargetsJSON(w, scrapePool)
 	} else {
 		fmt.Fprintf(w, `[]`)
 	}
@@ -88,7 +91,7 @@ func (tsm *targetStatusMap) Unregister(sw *ScrapeWork) {
 	tsm.mu.Unlock()
 }
 
-func (tsm *targetStatusMap) Update(sw *ScrapeWork, group string, up bool, scrapeTime, scrapeDuration int64, err error) {
+func (tsm *targetStatusMap) Update(sw *ScrapeWork, group string, up bool, scrapeTime, scrapeDuration int64, err error, lastParseError string) {
 	tsm.mu.Lock()
 	ts := tsm.m[sw]
 	if ts == nil {
@@ -102,6 +105,7 @@ func (tsm *targetStatusMap) Update(sw *ScrapeWork, group string, up bool, scrape
 	ts.scrapeTime = scrapeTime
 	ts.scrapeDuration = scrapeDuration
 	ts.err = err
+	ts.lastParseError = lastParseError
 	tsm.mu.Unlock()
 }
 
@@ -120,7 +124,9 @@ func (tsm *targetStatusMap) StatusByGroup(group string, up bool) int {
 }
 
 // WriteActiveTargetsJSON writes `activeTargets` contents to w according to https://prometheus.io/docs/prometheus/latest/querying/api/#targets
-func (tsm *targetStatusMap) WriteActiveTargetsJSON(w io.Writer) {
+//
+// Only targets for the given scrapePool are written if scrapePool isn't empty.
+func (tsm *targetStatusMap) WriteActiveTargetsJSON(w io.Writer, scrapePool string) {
 	tsm.mu.Lock()
 	type keyStatus struct {
 		key string
@@ -128,6 +134,9 @@ func (tsm *targetStatusMap) WriteActiveTargetsJSON(w io.Writer) {
 	}
 	kss := make([]keyStatus, 0, len(tsm.m))
 	for sw, st := range tsm.m {
+		if scrapePool != "" && sw.Job() != scrapePool {
+			continue
+		}
 		key := promLabelsString(sw.OriginalLabels)
 		kss = append(kss, keyStatus{
 			key: key,
@@ -149,15 +158,29 @@ func (tsm *targetStatusMap) WriteActiveTargetsJSON(w io.Writer) {
 		writeLabelsJSON(w, labelsFinalized)
 		fmt.Fprintf(w, `,"scrapePool":%q`, st.sw.Job())
 		fmt.Fprintf(w, `,"scrapeUrl":%q`, st.sw.ScrapeURL)
+		fmt.Fprintf(w, `,"globalUrl":%q`, st.sw.ScrapeURL)
 		errMsg := ""
+		errReason := ""
 		if st.err != nil {
 			errMsg = st.err.Error()
+			errReason = getScrapeErrorReason(st.err)
 		}
 		fmt.Fprintf(w, `,"lastError":%q`, errMsg)
-		fmt.Fprintf(w, `,"lastScrape":%q`, time.Unix(st.scrapeTime/1000, (st.scrapeTime%1000)*1e6).Format(time.RFC3339Nano))
+		fmt.Fprintf(w, `,"lastErrorReason":%q`, errReason)
+		fmt.Fprintf(w, `,"lastParseError":%q`, st.lastParseError)
+		lastScrape := "0001-01-01T00:00:00Z"
+		if st.scrapeTime > 0 {
+			lastScrape = time.Unix(st.scrapeTime/1000, (st.scrapeTime%1000)*1e6).Format(time.RFC3339Nano)
+		}
+		fmt.Fprintf(w, `,"lastScrape":%q`, lastScrape)
 		fmt.Fprintf(w, `,"lastScrapeDuration":%g`, (time.Millisecond * time.Duration(st.scrapeDuration)).Seconds())
+		fmt.Fprintf(w, `,"scrapeInterval":%q`, formatPromDuration(st.sw.ScrapeInterval))
+		fmt.Fprintf(w, `,"scrapeTimeout":%q`, formatPromDuration(st.sw.ScrapeTimeout))
 		state := "up"
-		if !st.up {
+		if st.scrapeTime == 0 {
+			// The target wasn't scraped yet.
+			state = "unknown"
+		} else if !st.up {
 			state = "down"
 		}
 		fmt.Fprintf(w, `,"health":%q}`, state)
@@ -179,6 +202,29 @@ func writeLabelsJSON(w io.Writer, labels []prompbmarshal.Label) {
 	fmt.Fprintf(w, `}`)
 }
 
+// formatPromDuration formats d in Prometheus duration format such as `1h30m` or `15s`.
+func formatPromDuration(d time.Duration) string {
+	ms := d.Milliseconds()
+	if ms == 0 {
+		return "0s"
+	}
+	var b []byte
+	f := func(unit int64, suffix string) {
+		if n := ms / unit; n > 0 {
+			b = strconv.AppendInt(b, n, 10)
+			b = append(b, suffix...)
+			ms -= n * unit
+		}
+	}
+	f(1000*60*60*24*7, "w")
+	f(1000*60*60*24, "d")
+	f(1000*60*60, "h")
+	f(1000*60, "m")
+	f(1000, "s")
+	f(1, "ms")
+	return string(b)
+}
+
 type targetStatus struct {
 	sw             *ScrapeWork
 	up             bool
@@ -186,6 +232,10 @@ type targetStatus struct {
 	scrapeTime     int64
 	scrapeDuration int64
 	err            error
+	lastParseError string
+
+	// metadata contains the last metadata collected from the target if -promscrape.scrapeMetadata is set.
+	metadata []parser.Metadata
 }
 
 func (st *targetStatus) getDurationFromLastScrape() time.Duration {
@@ -228,7 +278,9 @@ func (dt *droppedTargets) Register(originalLabels []prompbmarshal.Label) {
 }
 
 // WriteDroppedTargetsJSON writes `droppedTargets` contents to w according to https://prometheus.io/docs/prometheus/latest/querying/api/#targets
-func (dt *droppedTargets) WriteDroppedTargetsJSON(w io.Writer) {
+//
+// Only targets with `job` label matching the given scrapePool are written if scrapePool isn't empty.
+func (dt *droppedTargets) WriteDroppedTargetsJSON(w io.Writer, scrapePool string) {
 	dt.mu.Lock()
 	type keyStatus struct {
 		key            string
@@ -236,6 +288,9 @@ func (dt *droppedTargets) WriteDroppedTargetsJSON(w io.Writer) {
 	}
 	kss := make([]keyStatus, 0, len(dt.m))
 	for _, v := range dt.m {
+		if scrapePool != "" && promrelabel.GetLabelValueByName(v.originalLabels, "job") != scrapePool {
+			continue
+		}
 		key := promLabelsString(v.originalLabels)
 		kss = append(kss, keyStatus{
 			key:            key,
@@ -0,0 +1,85 @@
+package promscrape
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+)
+
+func TestFormatPromDuration(t *testing.T) {
+	f := func(d time.Duration, resultExpected string) {
+		t.Helper()
+		result := formatPromDuration(d)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for formatPromDuration(%s); got %q; want %q", d, result, resultExpected)
+		}
+	}
+	f(0, "0s")
+	f(500*time.Millisecond, "500ms")
+	f(15*time.Second, "15s")
+	f(time.Minute, "1m")
+	f(90*time.Minute, "1h30m")
+	f(25*time.Hour+1500*time.Millisecond, "1d1h1s500ms")
+	f(8*24*time.Hour, "1w1d")
+}
+
+func TestWriteActiveTargetsJSON(t *testing.T) {
+	tsm := newTargetStatusMap()
+	newScrapeWork := func(job, instance string) *ScrapeWork {
+		return &ScrapeWork{
+			ScrapeURL:      fmt.Sprintf("http://%s/metrics", instance),
+			ScrapeInterval: 30 * time.Second,
+			ScrapeTimeout:  10 * time.Second,
+			OriginalLabels: []prompbmarshal.Label{
+				{
+					Name:  "__address__",
+					Value: instance,
+				},
+				{
+					Name:  "job",
+					Value: job,
+				},
+			},
+			Labels: []prompbmarshal.Label{
+				{
+					Name:  "instance",
+					Value: instance,
+				},
+				{
+					Name:  "job",
+					Value: job,
+				},
+			},
+		}
+	}
+	swFoo := newScrapeWork("foo", "host1")
+	swBar := newScrapeWork("bar", "host2")
+	tsm.Register(swFoo)
+	tsm.Register(swBar)
+	tsm.Update(swBar, "bar", false, 1e12, 1500, newStatusCodeError("http://host2/metrics", 401, nil), `cannot unmarshal Prometheus line "foo{": missing tag value`)
+
+	f := func(scrapePool, resultExpected string) {
+		t.Helper()
+		var bb bytes.Buffer
+		tsm.WriteActiveTargetsJSON(&bb, scrapePool)
+		result := bb.String()
+		if result != resultExpected {
+			t.Fatalf("unexpected result for scrapePool=%q\ngot\n%s\nwant\n%s", scrapePool, result, resultExpected)
+		}
+	}
+	lastScrapeBar := time.Unix(1e9, 0).Format(time.RFC3339Nano)
+	jsonFoo := `{"discoveredLabels":{"__address__":"host1","job":"foo"},"labels":{"instance":"host1","job":"foo"},"scrapePool":"foo",` +
+		`"scrapeUrl":"http://host1/metrics","globalUrl":"http://host1/metrics","lastError":"","lastErrorReason":"","lastParseError":"","lastScrape":"0001-01-01T00:00:00Z",` +
+		`"lastScrapeDuration":0,"scrapeInterval":"30s","scrapeTimeout":"10s","health":"unknown"}`
+	jsonBar := `{"discoveredLabels":{"__address__":"host2","job":"bar"},"labels":{"instance":"host2","job":"bar"},"scrapePool":"bar",` +
+		`"scrapeUrl":"http://host2/metrics","globalUrl":"http://host2/metrics","lastError":"unexpected status code returned when scraping \"http://host2/metrics\": 401; expecting 200; response body: \"\"",` +
+		`"lastErrorReason":"http_401","lastParseError":"cannot unmarshal Prometheus line \"foo{\": missing tag value","lastScrape":"` + lastScrapeBar + `",` +
+		`"lastScrapeDuration":1.5,"scrapeInterval":"30s","scrapeTimeout":"10s","health":"down"}`
+	f("", `[`+jsonFoo+`,`+jsonBar+`]`)
+	f("foo", `[`+jsonFoo+`]`)
+	f("bar", `[`+jsonBar+`]`)
+	f("baz", `[]`)
+}
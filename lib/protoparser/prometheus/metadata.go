@@ -0,0 +1,104 @@
+package prometheus
+
+import (
+	"strings"
+)
+
+// Metadata contains metadata for a metric family.
+//
+// It is obtained from `# HELP`, `# TYPE` and `# UNIT` lines.
+// See https://github.com/prometheus/docs/blob/master/content/docs/instrumenting/exposition_formats.md#comments-help-text-and-type-information
+type Metadata struct {
+	Metric string
+	Type   string
+	Help   string
+	Unit   string
+}
+
+// AppendMetadata appends metadata from Prometheus exposition text s to dst and returns the result.
+//
+// Adjacent `# HELP`, `# TYPE` and `# UNIT` lines for the same metric family are merged into a single entry.
+//
+// Strings in the appended entries may refer to s, so s shouldn't be modified while dst is in use.
+func AppendMetadata(dst []Metadata, s string) []Metadata {
+	for len(s) > 0 {
+		n := strings.IndexByte(s, '\n')
+		line := s
+		if n < 0 {
+			s = ""
+		} else {
+			line = s[:n]
+			s = s[n+1:]
+		}
+		dst = appendMetadataLine(dst, line)
+	}
+	return dst
+}
+
+func appendMetadataLine(dst []Metadata, s string) []Metadata {
+	if len(s) > 0 && s[len(s)-1] == '\r' {
+		s = s[:len(s)-1]
+	}
+	s = skipLeadingWhitespace(s)
+	if len(s) == 0 || s[0] != '#' {
+		return dst
+	}
+	s = skipLeadingWhitespace(s[1:])
+	n := nextWhitespace(s)
+	if n < 0 {
+		return dst
+	}
+	kind := s[:n]
+	if kind != "HELP" && kind != "TYPE" && kind != "UNIT" {
+		// Skip ordinary comment
+		return dst
+	}
+	s = skipLeadingWhitespace(s[n+1:])
+	metric := s
+	value := ""
+	if n := nextWhitespace(s); n >= 0 {
+		metric = s[:n]
+		value = skipLeadingWhitespace(s[n+1:])
+	}
+	if len(metric) == 0 {
+		return dst
+	}
+	if len(dst) == 0 || dst[len(dst)-1].Metric != metric {
+		dst = append(dst, Metadata{
+			Metric: metric,
+		})
+	}
+	md := &dst[len(dst)-1]
+	switch kind {
+	case "HELP":
+		md.Help = unescapeHelp(value)
+	case "TYPE":
+		md.Type = strings.ToLower(skipTrailingWhitespace(value))
+	case "UNIT":
+		md.Unit = skipTrailingWhitespace(value)
+	}
+	return dst
+}
+
+func unescapeHelp(s string) string {
+	n := strings.IndexByte(s, '\\')
+	if n < 0 {
+		return s
+	}
+	b := make([]byte, 0, len(s))
+	for n >= 0 && n+1 < len(s) {
+		b = append(b, s[:n]...)
+		switch s[n+1] {
+		case 'n':
+			b = append(b, '\n')
+		case '\\', '"':
+			b = append(b, s[n+1])
+		default:
+			b = append(b, s[n:n+2]...)
+		}
+		s = s[n+2:]
+		n = strings.IndexByte(s, '\\')
+	}
+	b = append(b, s...)
+	return string(b)
+}
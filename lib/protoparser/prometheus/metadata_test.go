@@ -0,0 +1,59 @@
+package prometheus
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAppendMetadata(t *testing.T) {
+	f := func(s string, mdsExpected []Metadata) {
+		t.Helper()
+		mds := AppendMetadata(nil, s)
+		if !reflect.DeepEqual(mds, mdsExpected) {
+			t.Fatalf("unexpected metadata for %q;\ngot\n%+v\nwant\n%+v", s, mds, mdsExpected)
+		}
+	}
+
+	// Empty input
+	f("", nil)
+	f("foo 123\nbar{a=\"b\"} 34", nil)
+
+	// Ordinary comments must be skipped
+	f("# foo bar\n#\n# HELPER foo bar\n#HELP", nil)
+
+	// Single metric family
+	f(`# HELP http_requests_total The total number of HTTP requests.
+# TYPE http_requests_total counter
+http_requests_total{method="post",code="200"} 1027 1395066363000
+`, []Metadata{{
+		Metric: "http_requests_total",
+		Type:   "counter",
+		Help:   "The total number of HTTP requests.",
+	}})
+
+	// Multiple metric families with UNIT and windows line endings
+	f("# TYPE foo_seconds histogram\r\n# UNIT foo_seconds seconds\r\n# HELP foo_seconds Foo duration\r\nfoo_seconds_count 3\r\n"+
+		"# TYPE bar gauge \n  # HELP  bar\tBar\\\\baz\\nqwe\\\"x\\y\nbar 1\n# TYPE baz untyped", []Metadata{
+		{
+			Metric: "foo_seconds",
+			Type:   "histogram",
+			Help:   "Foo duration",
+			Unit:   "seconds",
+		},
+		{
+			Metric: "bar",
+			Type:   "gauge",
+			Help:   "Bar\\baz\nqwe\"x\\y",
+		},
+		{
+			Metric: "baz",
+			Type:   "untyped",
+		},
+	})
+
+	// HELP without text
+	f("# HELP foo\n# TYPE foo COUNTER", []Metadata{{
+		Metric: "foo",
+		Type:   "counter",
+	}})
+}
@@ -61,6 +61,21 @@ type Row struct {
 	Tags      []Tag
 	Value     float64
 	Timestamp int64
+
+	// HasExemplar is set to true if the row contains Exemplar.
+	HasExemplar bool
+
+	// Exemplar is an optional exemplar for the row.
+	//
+	// See https://github.com/OpenObservability/OpenMetrics/blob/master/specification/OpenMetrics.md#exemplars
+	Exemplar Exemplar
+}
+
+// Exemplar is an exemplar for Prometheus row.
+type Exemplar struct {
+	Tags      []Tag
+	Value     float64
+	Timestamp int64
 }
 
 func (r *Row) reset() {
@@ -68,6 +83,8 @@ func (r *Row) reset() {
 	r.Tags = nil
 	r.Value = 0
 	r.Timestamp = 0
+	r.HasExemplar = false
+	r.Exemplar = Exemplar{}
 }
 
 func skipTrailingComment(s string) string {
@@ -112,6 +129,10 @@ func (r *Row) unmarshal(s string, tagsPool []Tag, noEscapes bool) ([]Tag, error)
 	r.reset()
 	s = skipLeadingWhitespace(s)
 	n := strings.IndexByte(s, '{')
+	if n >= 0 && strings.IndexByte(s[:n], '#') >= 0 {
+		// The '{' belongs to trailing comment such as exemplar.
+		n = -1
+	}
 	if n >= 0 {
 		// Tags found. Parse them.
 		r.Metric = skipTrailingWhitespace(s[:n])
@@ -141,6 +162,16 @@ func (r *Row) unmarshal(s string, tagsPool []Tag, noEscapes bool) ([]Tag, error)
 		return tagsPool, fmt.Errorf("metric cannot be empty")
 	}
 	s = skipLeadingWhitespace(s)
+	if n := strings.Index(s, "# {"); n >= 0 {
+		// Parse optional exemplar. Invalid exemplars are ignored like other trailing comments.
+		tagsStart := len(tagsPool)
+		tagsPool, r.HasExemplar = r.Exemplar.unmarshal(s[n+len("# {"):], tagsPool, noEscapes)
+		if !r.HasExemplar {
+			tagsPool = tagsPool[:tagsStart]
+			r.Exemplar = Exemplar{}
+		}
+		s = s[:n]
+	}
 	s = skipTrailingComment(s)
 	if len(s) == 0 {
 		return tagsPool, fmt.Errorf("value cannot be empty")
@@ -183,6 +214,43 @@ func (r *Row) unmarshal(s string, tagsPool []Tag, noEscapes bool) ([]Tag, error)
 	return tagsPool, nil
 }
 
+// unmarshal unmarshals e from s in the format `{labels} value [timestamp]` without the leading `{`.
+//
+// It returns false if s contains invalid exemplar.
+func (e *Exemplar) unmarshal(s string, tagsPool []Tag, noEscapes bool) ([]Tag, bool) {
+	tagsStart := len(tagsPool)
+	s, tagsPool, err := unmarshalTags(tagsPool, s, noEscapes)
+	if err != nil {
+		return tagsPool, false
+	}
+	tags := tagsPool[tagsStart:]
+	e.Tags = tags[:len(tags):len(tags)]
+	s = skipTrailingWhitespace(skipLeadingWhitespace(s))
+	if len(s) == 0 {
+		return tagsPool, false
+	}
+	valueStr := s
+	timestampStr := ""
+	if n := nextWhitespace(s); n >= 0 {
+		valueStr = s[:n]
+		timestampStr = skipLeadingWhitespace(s[n+1:])
+	}
+	v, err := fastfloat.Parse(valueStr)
+	if err != nil {
+		return tagsPool, false
+	}
+	e.Value = v
+	if len(timestampStr) > 0 {
+		// Exemplar timestamps are always in seconds according to OpenMetrics.
+		ts, err := fastfloat.Parse(timestampStr)
+		if err != nil {
+			return tagsPool, false
+		}
+		e.Timestamp = int64(ts * 1000)
+	}
+	return tagsPool, true
+}
+
 var rowsReadScrape = metrics.NewCounter(`vm_protoparser_rows_read_total{type="promscrape"}`)
 
 func unmarshalRows(dst []Row, s string, tagsPool []Tag, noEscapes bool, errLogger func(s string)) ([]Row, []Tag) {
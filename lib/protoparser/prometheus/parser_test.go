@@ -220,7 +220,16 @@ cassandra_token_ownership_ratio 78.9`, &Rows{
 						Value: "#b",
 					},
 				},
-				Value: 17,
+				Value:       17,
+				HasExemplar: true,
+				Exemplar: Exemplar{
+					Tags: []Tag{{
+						Key:   "trace_id",
+						Value: "oHg5SJ#YRHA0",
+					}},
+					Value:     9.8,
+					Timestamp: 1520879607789,
+				},
 			},
 			{
 				Metric:    "abc",
@@ -234,6 +243,64 @@ cassandra_token_ownership_ratio 78.9`, &Rows{
 		},
 	})
 
+	// Exemplar without timestamp
+	f(`foo_bucket{le="0.5"} 3 123 # {trace_id="abc",span_id="def"} 0.25`, &Rows{
+		Rows: []Row{{
+			Metric: "foo_bucket",
+			Tags: []Tag{{
+				Key:   "le",
+				Value: "0.5",
+			}},
+			Value:       3,
+			Timestamp:   123000,
+			HasExemplar: true,
+			Exemplar: Exemplar{
+				Tags: []Tag{
+					{
+						Key:   "trace_id",
+						Value: "abc",
+					},
+					{
+						Key:   "span_id",
+						Value: "def",
+					},
+				},
+				Value: 0.25,
+			},
+		}},
+	})
+
+	// Exemplar for metric without labels
+	f(`foo_total 17 # {trace_id="abc"} 1`, &Rows{
+		Rows: []Row{{
+			Metric:      "foo_total",
+			Value:       17,
+			HasExemplar: true,
+			Exemplar: Exemplar{
+				Tags: []Tag{{
+					Key:   "trace_id",
+					Value: "abc",
+				}},
+				Value: 1,
+			},
+		}},
+	})
+
+	// Invalid exemplars are ignored
+	f(`foo 3 # {trace_id="abc"} bar
+	   bar 4 # {trace_id="abc`, &Rows{
+		Rows: []Row{
+			{
+				Metric: "foo",
+				Value:  3,
+			},
+			{
+				Metric: "bar",
+				Value:  4,
+			},
+		},
+	})
+
 	// "Infinity" word - this has been added in OpenMetrics.
 	// See https://github.com/OpenObservability/OpenMetrics/blob/master/OpenMetrics.md
 	// Checks for https://github.com/VictoriaMetrics/VictoriaMetrics/issues/924
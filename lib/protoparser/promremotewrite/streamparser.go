@@ -9,6 +9,7 @@ import (
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/cgroup"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding/zstd"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
@@ -18,10 +19,30 @@ import (
 
 var maxInsertRequestSize = flagutil.NewBytes("maxInsertRequestSize", 32*1024*1024, "The maximum size in bytes of a single Prometheus remote_write API request")
 
-// ParseStream parses Prometheus remote_write message req and calls callback for the parsed timeseries.
+// VMProtoVersion is the version of VictoriaMetrics remote write protocol supported by ParseStream.
 //
-// callback shouldn't hold tss after returning.
-func ParseStream(req *http.Request, callback func(tss []prompb.TimeSeries) error) error {
+// VictoriaMetrics remote write protocol is Prometheus remote write protocol with zstd compression instead of snappy.
+const VMProtoVersion = 1
+
+// WriteVMProtoVersion writes VMProtoVersion to w if r requests it via `get_vm_proto_version` query arg.
+//
+// It returns true if the version has been written.
+func WriteVMProtoVersion(w http.ResponseWriter, r *http.Request) bool {
+	if r.FormValue("get_vm_proto_version") == "" {
+		return false
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "%d", VMProtoVersion)
+	return true
+}
+
+// ParseStream parses Prometheus remote_write message req and calls callback for the parsed timeseries and metric metadata.
+//
+// req may be compressed with snappy according to Prometheus remote write protocol
+// or with zstd according to VictoriaMetrics remote write protocol if `Content-Encoding: zstd` header is set.
+//
+// callback shouldn't hold tss and mms after returning.
+func ParseStream(req *http.Request, callback func(tss []prompb.TimeSeries, mms []prompb.MetricMetadata) error) error {
 	ctx := getPushCtx(req.Body)
 	defer putPushCtx(ctx)
 	if err := ctx.Read(); err != nil {
@@ -34,9 +55,19 @@ func ParseStream(req *http.Request, callback func(tss []prompb.TimeSeries) error
 	bb := bodyBufferPool.Get()
 	defer bodyBufferPool.Put(bb)
 	var err error
-	bb.B, err = snappy.Decode(bb.B[:cap(bb.B)], ctx.reqBuf.B)
-	if err != nil {
-		return fmt.Errorf("cannot decompress request with length %d: %w", len(ctx.reqBuf.B), err)
+	if req.Header.Get("Content-Encoding") == "zstd" {
+		// The request is sent by vmagent with VictoriaMetrics remote write protocol.
+		// Limit the decompressed size, since zstd may compress data with very high ratio.
+		bb.B, err = zstd.DecompressLimited(bb.B[:0], ctx.reqBuf.B, maxInsertRequestSize.N)
+		if err != nil {
+			return fmt.Errorf("cannot decompress zstd-encoded request with length %d; the unpacked request mustn't exceed `-maxInsertRequestSize=%d` bytes: %w",
+				len(ctx.reqBuf.B), maxInsertRequestSize.N, err)
+		}
+	} else {
+		bb.B, err = snappy.Decode(bb.B[:cap(bb.B)], ctx.reqBuf.B)
+		if err != nil {
+			return fmt.Errorf("cannot decompress request with length %d: %w", len(ctx.reqBuf.B), err)
+		}
 	}
 	if len(bb.B) > maxInsertRequestSize.N {
 		return fmt.Errorf("too big unpacked request; mustn't exceed `-maxInsertRequestSize=%d` bytes; got %d bytes", maxInsertRequestSize.N, len(bb.B))
@@ -55,7 +86,7 @@ func ParseStream(req *http.Request, callback func(tss []prompb.TimeSeries) error
 	}
 	rowsRead.Add(rows)
 
-	if err := callback(tss); err != nil {
+	if err := callback(tss, wr.Metadata); err != nil {
 		return fmt.Errorf("error when processing imported data: %w", err)
 	}
 	return nil
@@ -0,0 +1,89 @@
+package promremotewrite
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding/zstd"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/golang/snappy"
+)
+
+func TestParseStream(t *testing.T) {
+	wr := &prompbmarshal.WriteRequest{
+		Timeseries: []prompbmarshal.TimeSeries{
+			{
+				Labels:  []prompbmarshal.Label{{Name: "__name__", Value: "foo"}},
+				Samples: []prompbmarshal.Sample{{Value: 1, Timestamp: 2}, {Value: 3, Timestamp: 4}},
+			},
+			{
+				Labels:  []prompbmarshal.Label{{Name: "__name__", Value: "bar"}, {Name: "job", Value: "x"}},
+				Samples: []prompbmarshal.Sample{{Value: 5, Timestamp: 6}},
+			},
+		},
+	}
+	data := prompbmarshal.MarshalWriteRequest(nil, wr)
+
+	f := func(body []byte, contentEncoding string) {
+		t.Helper()
+		req, err := http.NewRequest("POST", "http://localhost/api/v1/write", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("cannot create request: %s", err)
+		}
+		if contentEncoding != "" {
+			req.Header.Set("Content-Encoding", contentEncoding)
+		}
+		var names []string
+		samples := 0
+		err = ParseStream(req, func(tss []prompb.TimeSeries, mms []prompb.MetricMetadata) error {
+			for i := range tss {
+				names = append(names, string(tss[i].Labels[0].Value))
+				samples += len(tss[i].Samples)
+			}
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if len(names) != 2 || names[0] != "foo" || names[1] != "bar" {
+			t.Fatalf("unexpected series; got %q; want [foo bar]", names)
+		}
+		if samples != 3 {
+			t.Fatalf("unexpected number of samples; got %d; want 3", samples)
+		}
+	}
+	f(snappy.Encode(nil, data), "")
+	f(zstd.CompressLevel(nil, data, 1), "zstd")
+}
+
+func TestParseStreamFailure(t *testing.T) {
+	f := func(body []byte, contentEncoding string) {
+		t.Helper()
+		req, err := http.NewRequest("POST", "http://localhost/api/v1/write", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("cannot create request: %s", err)
+		}
+		if contentEncoding != "" {
+			req.Header.Set("Content-Encoding", contentEncoding)
+		}
+		err = ParseStream(req, func(tss []prompb.TimeSeries, mms []prompb.MetricMetadata) error {
+			t.Fatalf("unexpected callback call")
+			return nil
+		})
+		if err == nil {
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// Invalid compression
+	f([]byte("foobar"), "")
+	f([]byte("foobar"), "zstd")
+
+	// Too big unpacked request. zstd compresses zeros with very high ratio,
+	// so the packed request is much smaller than -maxInsertRequestSize.
+	zeros := make([]byte, maxInsertRequestSize.N+1)
+	f(snappy.Encode(nil, zeros), "")
+	f(zstd.CompressLevel(nil, zeros, 1), "zstd")
+}
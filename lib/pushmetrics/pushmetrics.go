@@ -0,0 +1,238 @@
+package pushmetrics
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/httpserver"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/prometheus"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+var (
+	pushURLs = flagutil.NewArray("pushmetrics.url", "Optional URL to push metrics exposed at /metrics page to. For example, http://victoria-metrics:8428/api/v1/import/prometheus "+
+		"or http://pushgateway:9091/metrics/job/victoria-metrics . Metrics are pushed in Prometheus text exposition format. "+
+		"By default metrics exposed at /metrics page aren't pushed anywhere")
+	pushInterval = flag.Duration("pushmetrics.interval", 10*time.Second, "Interval for pushing metrics to -pushmetrics.url")
+	extraLabels  = flagutil.NewArray("pushmetrics.extraLabel", "Optional label in the form 'name=value' to add to all the metrics pushed to -pushmetrics.url. "+
+		"For example, -pushmetrics.extraLabel=instance=foo adds instance=\"foo\" label to all the pushed metrics")
+)
+
+func init() {
+	// -pushmetrics.url may contain Basic Auth credentials.
+	flagutil.RegisterSecretFlag("pushmetrics.url")
+}
+
+// Init starts pushing metrics exposed at /metrics page to -pushmetrics.url.
+//
+// Init must be called after logger.Init. Stop must be called for pushing the final metrics before the app exit.
+func Init() {
+	if len(*pushURLs) == 0 {
+		return
+	}
+	if *pushInterval <= 0 {
+		logger.Fatalf("-pushmetrics.interval must be positive; got %s", *pushInterval)
+	}
+	labels, err := parseExtraLabels(*extraLabels)
+	if err != nil {
+		logger.Fatalf("cannot parse -pushmetrics.extraLabel: %s", err)
+	}
+	stopCh = make(chan struct{})
+	for _, pushURL := range *pushURLs {
+		u, err := url.Parse(pushURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			logger.Fatalf("invalid -pushmetrics.url=%q; it must start with http:// or https://", redactURL(pushURL))
+		}
+		p := &pusher{
+			url:         pushURL,
+			extraLabels: labels,
+		}
+		logger.Infof("pushing metrics exposed at /metrics page to -pushmetrics.url=%q every %s", p.redactedURL(), *pushInterval)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.run(*pushInterval)
+		}()
+	}
+}
+
+// Stop pushes the final metrics to -pushmetrics.url and stops pushing metrics.
+func Stop() {
+	if stopCh == nil {
+		return
+	}
+	close(stopCh)
+	wg.Wait()
+	stopCh = nil
+}
+
+var (
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+)
+
+type label struct {
+	name  string
+	value string
+}
+
+func parseExtraLabels(a []string) ([]label, error) {
+	var labels []label
+	for _, s := range a {
+		if len(s) == 0 {
+			continue
+		}
+		n := strings.IndexByte(s, '=')
+		if n <= 0 {
+			return nil, fmt.Errorf("missing label name in %q; it must contain label in the form `name=value`", s)
+		}
+		labels = append(labels, label{
+			name:  s[:n],
+			value: s[n+1:],
+		})
+	}
+	return labels, nil
+}
+
+var pushHTTPClient = &http.Client{
+	Timeout: 10 * time.Second,
+}
+
+var (
+	pushesTotal   = metrics.NewCounter(`vm_pushmetrics_requests_total`)
+	pushErrors    = metrics.NewCounter(`vm_pushmetrics_errors_total`)
+	pushDuration  = metrics.NewHistogram(`vm_pushmetrics_request_duration_seconds`)
+	pushBytesSent = metrics.NewCounter(`vm_pushmetrics_bytes_sent_total`)
+)
+
+type pusher struct {
+	url         string
+	extraLabels []label
+
+	bb   bytesutil.ByteBuffer
+	rows prometheus.Rows
+}
+
+func (p *pusher) run(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-stopCh:
+			// Push the final metrics, so they aren't lost on graceful shutdown of short-living apps such as vmbackup.
+			p.push()
+			return
+		case <-t.C:
+			p.push()
+		}
+	}
+}
+
+func (p *pusher) push() {
+	p.bb.Reset()
+	httpserver.WritePrometheusMetrics(&p.bb)
+	p.rows.Reset()
+	p.rows.Unmarshal(bytesutil.ToUnsafeString(p.bb.B))
+	body := marshalRows(nil, p.rows.Rows, p.extraLabels)
+
+	req, err := http.NewRequest("POST", p.url, bytes.NewReader(body))
+	if err != nil {
+		logger.Panicf("BUG: unexpected error from http.NewRequest(%q): %s", p.redactedURL(), err)
+	}
+	req.Header.Set("Content-Type", "text/plain")
+
+	pushesTotal.Inc()
+	pushBytesSent.Add(len(body))
+	startTime := time.Now()
+	resp, err := pushHTTPClient.Do(req)
+	pushDuration.UpdateDuration(startTime)
+	if err != nil {
+		pushErrors.Inc()
+		logger.Errorf("cannot push metrics to -pushmetrics.url=%q: %s", p.redactedURL(), err)
+		return
+	}
+	respBody, _ := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		pushErrors.Inc()
+		logger.Errorf("unexpected status code when pushing metrics to -pushmetrics.url=%q: %d; want 2xx; response body: %q",
+			p.redactedURL(), resp.StatusCode, respBody)
+	}
+}
+
+func (p *pusher) redactedURL() string {
+	return redactURL(p.url)
+}
+
+// redactURL hides Basic Auth password in u, so it could be safely logged.
+func redactURL(u string) string {
+	pu, err := url.Parse(u)
+	if err != nil || pu.User == nil {
+		return u
+	}
+	if _, ok := pu.User.Password(); ok {
+		pu.User = url.UserPassword(pu.User.Username(), "xxxxx")
+	}
+	return pu.String()
+}
+
+// marshalRows appends rows with extraLabels in Prometheus text exposition format to dst and returns the result.
+//
+// extraLabels override labels with the same names in rows.
+func marshalRows(dst []byte, rows []prometheus.Row, extraLabels []label) []byte {
+	for i := range rows {
+		r := &rows[i]
+		dst = append(dst, r.Metric...)
+		n := 0
+		for j := range r.Tags {
+			t := &r.Tags[j]
+			if hasLabel(extraLabels, t.Key) {
+				continue
+			}
+			dst = appendLabel(dst, n, t.Key, t.Value)
+			n++
+		}
+		for _, lb := range extraLabels {
+			dst = appendLabel(dst, n, lb.name, lb.value)
+			n++
+		}
+		if n > 0 {
+			dst = append(dst, '}')
+		}
+		dst = append(dst, ' ')
+		dst = strconv.AppendFloat(dst, r.Value, 'g', -1, 64)
+		dst = append(dst, '\n')
+	}
+	return dst
+}
+
+func appendLabel(dst []byte, n int, name, value string) []byte {
+	if n == 0 {
+		dst = append(dst, '{')
+	} else {
+		dst = append(dst, ',')
+	}
+	dst = append(dst, name...)
+	dst = append(dst, '=')
+	return strconv.AppendQuote(dst, value)
+}
+
+func hasLabel(labels []label, name string) bool {
+	for _, lb := range labels {
+		if lb.name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package ratelimiter
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/timerpool"
+)
+
+// RateLimiter limits the rate of some work, such as the number of bytes written to disk per second.
+//
+// It is safe calling RateLimiter methods from concurrently running goroutines.
+type RateLimiter struct {
+	// perSecondLimit is the maximum amount of work per second. Zero value disables the limit.
+	//
+	// It is accessed atomically, since it may be changed via SetPerSecondLimit.
+	perSecondLimit int64
+
+	mu sync.Mutex
+
+	// budget is the remaining amount of work, which may be registered until the deadline.
+	budget int64
+
+	// deadline is the time when the budget is replenished.
+	deadline time.Time
+
+	// limitReached is the number of times the limit has been reached.
+	limitReached uint64
+}
+
+// New returns a rate limiter with the given perSecondLimit.
+//
+// The limiter doesn't limit anything if perSecondLimit <= 0.
+func New(perSecondLimit int64) *RateLimiter {
+	return &RateLimiter{
+		perSecondLimit: perSecondLimit,
+	}
+}
+
+// SetPerSecondLimit changes the per-second limit for rl.
+//
+// Zero or negative perSecondLimit disables the limit.
+func (rl *RateLimiter) SetPerSecondLimit(perSecondLimit int64) {
+	if perSecondLimit < 0 {
+		perSecondLimit = 0
+	}
+	rl.mu.Lock()
+	atomic.StoreInt64(&rl.perSecondLimit, perSecondLimit)
+	if rl.budget > perSecondLimit {
+		rl.budget = perSecondLimit
+	}
+	rl.mu.Unlock()
+}
+
+// Register registers the given amount of work in rl.
+//
+// It blocks if the per-second limit is reached until the limit allows more work or until stopCh is closed.
+func (rl *RateLimiter) Register(n int, stopCh <-chan struct{}) {
+	if rl == nil || atomic.LoadInt64(&rl.perSecondLimit) <= 0 {
+		return
+	}
+	for {
+		d := rl.tryRegister(n)
+		if d <= 0 {
+			return
+		}
+		// Sleep without holding rl.mu, so concurrent callers and SetPerSecondLimit aren't blocked.
+		t := timerpool.Get(d)
+		select {
+		case <-stopCh:
+			timerpool.Put(t)
+			return
+		case <-t.C:
+			timerpool.Put(t)
+		}
+	}
+}
+
+// tryRegister registers n if rl has enough budget.
+//
+// Otherwise it returns the duration to wait before the next attempt.
+func (rl *RateLimiter) tryRegister(n int) time.Duration {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	if rl.perSecondLimit <= 0 {
+		// The limit has been disabled via SetPerSecondLimit.
+		return 0
+	}
+	for rl.budget <= 0 {
+		if d := time.Until(rl.deadline); d > 0 {
+			rl.limitReached++
+			return d
+		}
+		rl.budget += rl.perSecondLimit
+		rl.deadline = time.Now().Add(time.Second)
+	}
+	rl.budget -= int64(n)
+	return 0
+}
+
+// LimitReached returns the number of times the limit has been reached in rl.
+func (rl *RateLimiter) LimitReached() uint64 {
+	if rl == nil {
+		return 0
+	}
+	rl.mu.Lock()
+	n := rl.limitReached
+	rl.mu.Unlock()
+	return n
+}
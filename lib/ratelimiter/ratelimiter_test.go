@@ -0,0 +1,107 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterNoLimit(t *testing.T) {
+	stopCh := make(chan struct{})
+	var rl *RateLimiter
+	rl.Register(1e9, stopCh)
+	rl = New(0)
+	startTime := time.Now()
+	for i := 0; i < 100; i++ {
+		rl.Register(1e9, stopCh)
+	}
+	if d := time.Since(startTime); d > time.Second {
+		t.Fatalf("unexpected delay for rate limiter without limit: %s", d)
+	}
+	if n := rl.LimitReached(); n != 0 {
+		t.Fatalf("unexpected LimitReached; got %d; want 0", n)
+	}
+}
+
+func TestRateLimiterLimit(t *testing.T) {
+	stopCh := make(chan struct{})
+	rl := New(1000)
+	startTime := time.Now()
+	// The first second budget is consumed immediately, while the next 1000 bytes must be delayed for a second.
+	for i := 0; i < 20; i++ {
+		rl.Register(100, stopCh)
+	}
+	if d := time.Since(startTime); d < 900*time.Millisecond {
+		t.Fatalf("too small delay for rate limiter; got %s; want at least 900ms", d)
+	}
+	if n := rl.LimitReached(); n != 1 {
+		t.Fatalf("unexpected LimitReached; got %d; want 1", n)
+	}
+}
+
+func TestRateLimiterStop(t *testing.T) {
+	stopCh := make(chan struct{})
+	rl := New(1)
+	rl.Register(100, stopCh)
+	close(stopCh)
+	startTime := time.Now()
+	rl.Register(100, stopCh)
+	if d := time.Since(startTime); d > 500*time.Millisecond {
+		t.Fatalf("too big delay after closing stopCh: %s", d)
+	}
+}
+
+func TestRateLimiterSetPerSecondLimit(t *testing.T) {
+	stopCh := make(chan struct{})
+	rl := New(0)
+	rl.Register(1e9, stopCh)
+
+	// Enable the limit.
+	rl.SetPerSecondLimit(1000)
+	startTime := time.Now()
+	for i := 0; i < 20; i++ {
+		rl.Register(100, stopCh)
+	}
+	if d := time.Since(startTime); d < 900*time.Millisecond {
+		t.Fatalf("too small delay after enabling the limit; got %s; want at least 900ms", d)
+	}
+
+	// Disable the limit.
+	rl.SetPerSecondLimit(0)
+	startTime = time.Now()
+	for i := 0; i < 100; i++ {
+		rl.Register(1e9, stopCh)
+	}
+	if d := time.Since(startTime); d > time.Second {
+		t.Fatalf("unexpected delay after disabling the limit: %s", d)
+	}
+}
+
+func TestRateLimiterNoLockWhileWaiting(t *testing.T) {
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	rl := New(100)
+	rl.Register(100, stopCh)
+	doneCh := make(chan struct{})
+	go func() {
+		// This call must wait for the next second.
+		rl.Register(100, stopCh)
+		close(doneCh)
+	}()
+	// Give the goroutine a chance to start waiting.
+	time.Sleep(100 * time.Millisecond)
+
+	// Other methods mustn't be blocked while Register waits for the budget.
+	startTime := time.Now()
+	rl.SetPerSecondLimit(200)
+	if d := time.Since(startTime); d > 500*time.Millisecond {
+		t.Fatalf("SetPerSecondLimit is blocked by the waiting Register call for %s", d)
+	}
+	if n := rl.LimitReached(); n != 1 {
+		t.Fatalf("unexpected LimitReached; got %d; want 1", n)
+	}
+	select {
+	case <-doneCh:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout when waiting for Register call")
+	}
+}
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"sync/atomic"
 	"time"
 )
 
@@ -8,15 +9,16 @@ import (
 //
 // De-duplication is disabled if interval is 0.
 //
-// This function must be called before initializing the storage.
+// This function may be called at any time. The new interval is applied to the subsequent merges and queries.
 func SetMinScrapeIntervalForDeduplication(interval time.Duration) {
-	minScrapeInterval = interval.Milliseconds()
+	atomic.StoreInt64(&minScrapeIntervalMsecs, interval.Milliseconds())
 }
 
-var minScrapeInterval = int64(0)
+var minScrapeIntervalMsecs = int64(0)
 
 // DeduplicateSamples removes samples from src* if they are closer to each other than minScrapeInterval.
 func DeduplicateSamples(srcTimestamps []int64, srcValues []float64) ([]int64, []float64) {
+	minScrapeInterval := atomic.LoadInt64(&minScrapeIntervalMsecs)
 	if minScrapeInterval <= 0 {
 		return srcTimestamps, srcValues
 	}
@@ -48,6 +50,7 @@ func DeduplicateSamples(srcTimestamps []int64, srcValues []float64) ([]int64, []
 }
 
 func deduplicateSamplesDuringMerge(srcTimestamps, srcValues []int64) ([]int64, []int64) {
+	minScrapeInterval := atomic.LoadInt64(&minScrapeIntervalMsecs)
 	if minScrapeInterval <= 0 {
 		return srcTimestamps, srcValues
 	}
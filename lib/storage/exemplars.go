@@ -0,0 +1,241 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+)
+
+// Exemplar is an exemplar for a time series.
+//
+// See https://github.com/OpenObservability/OpenMetrics/blob/master/specification/OpenMetrics.md#exemplars
+type Exemplar struct {
+	// Tags contains exemplar labels such as trace_id.
+	Tags      []Tag
+	Value     float64
+	Timestamp int64
+}
+
+func (e *Exemplar) copyFrom(src *Exemplar) {
+	tags := e.Tags[:0]
+	for i := range src.Tags {
+		tags = append(tags, Tag{})
+		tags[len(tags)-1].copyFrom(&src.Tags[i])
+	}
+	e.Tags = tags
+	e.Value = src.Value
+	e.Timestamp = src.Timestamp
+}
+
+// equalIgnoreTimestamp returns true if e and other have identical tags and values.
+func (e *Exemplar) equalIgnoreTimestamp(other *Exemplar) bool {
+	if e.Value != other.Value || len(e.Tags) != len(other.Tags) {
+		return false
+	}
+	for i := range e.Tags {
+		if !e.Tags[i].Equal(&other.Tags[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// ExemplarSeries contains exemplars for a single time series.
+type ExemplarSeries struct {
+	MetricName MetricName
+
+	// Exemplars are sorted by timestamp.
+	Exemplars []Exemplar
+}
+
+// ExemplarStorage is an in-memory storage for the last exemplars.
+//
+// It holds up to maxCount exemplars. The oldest exemplars are overwritten by new exemplars
+// when the storage is full.
+type ExemplarStorage struct {
+	// Atomic counters must go at the top of the structure in order to properly align by 8 bytes on 32-bit archs.
+	// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/212 .
+	addedExemplars      uint64
+	outOfOrderExemplars uint64
+
+	mu sync.Mutex
+
+	// entries is a ring buffer of exemplars.
+	entries []exemplarEntry
+
+	// nextIdx is the index in entries for the next exemplar.
+	nextIdx int
+
+	// count is the number of used entries.
+	count int
+
+	// lastIdxs maps marshaled MetricName to the index of the last exemplar for the time series in entries.
+	lastIdxs map[string]int
+}
+
+type exemplarEntry struct {
+	// metricName is marshaled MetricName for the exemplar. It is empty for unused entries.
+	metricName []byte
+
+	exemplar Exemplar
+}
+
+// NewExemplarStorage returns new ExemplarStorage, which holds up to maxCount exemplars.
+func NewExemplarStorage(maxCount int) *ExemplarStorage {
+	if maxCount <= 0 {
+		logger.Panicf("BUG: maxCount must be positive; got %d", maxCount)
+	}
+	return &ExemplarStorage{
+		entries:  make([]exemplarEntry, maxCount),
+		lastIdxs: make(map[string]int),
+	}
+}
+
+// Add adds exemplar e for the time series with the given metricNameRaw to es.
+//
+// The exemplar is skipped if it has the same tags and value as the last exemplar for the same time series,
+// since scrape targets return the same exemplar on every scrape until a new exemplar is observed.
+// Exemplars with timestamps not exceeding the timestamp of the last exemplar
+// for the same time series are skipped too.
+func (es *ExemplarStorage) Add(metricNameRaw []byte, e *Exemplar) error {
+	mn := GetMetricName()
+	defer PutMetricName(mn)
+	if err := mn.unmarshalRaw(metricNameRaw); err != nil {
+		return fmt.Errorf("cannot unmarshal MetricNameRaw %q: %w", metricNameRaw, err)
+	}
+	mn.sortTags()
+	bb := exemplarKeyPool.Get()
+	defer exemplarKeyPool.Put(bb)
+	bb.B = mn.Marshal(bb.B[:0])
+
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	if idx, ok := es.lastIdxs[string(bb.B)]; ok {
+		last := &es.entries[idx].exemplar
+		if e.equalIgnoreTimestamp(last) {
+			return nil
+		}
+		if e.Timestamp <= last.Timestamp {
+			atomic.AddUint64(&es.outOfOrderExemplars, 1)
+			return nil
+		}
+	}
+
+	idx := es.nextIdx
+	ent := &es.entries[idx]
+	if len(ent.metricName) > 0 {
+		// Overwrite the oldest exemplar.
+		if lastIdx, ok := es.lastIdxs[string(ent.metricName)]; ok && lastIdx == idx {
+			delete(es.lastIdxs, string(ent.metricName))
+		}
+	} else {
+		es.count++
+	}
+	ent.metricName = append(ent.metricName[:0], bb.B...)
+	ent.exemplar.copyFrom(e)
+	es.lastIdxs[string(ent.metricName)] = idx
+	es.nextIdx++
+	if es.nextIdx >= len(es.entries) {
+		es.nextIdx = 0
+	}
+	atomic.AddUint64(&es.addedExemplars, 1)
+	return nil
+}
+
+var exemplarKeyPool bytesutil.ByteBufferPool
+
+// Search returns exemplars on the given tr for time series matching the given tfss.
+func (es *ExemplarStorage) Search(tfss []*TagFilters, tr TimeRange) ([]ExemplarSeries, error) {
+	tfsPtrss := make([][]*tagFilter, len(tfss))
+	for i, tfs := range tfss {
+		tfsPtrs := make([]*tagFilter, len(tfs.tfs))
+		for j := range tfs.tfs {
+			tfsPtrs[j] = &tfs.tfs[j]
+		}
+		tfsPtrss[i] = tfsPtrs
+	}
+
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	var kb bytesutil.ByteBuffer
+	var mn MetricName
+	m := make(map[string]*ExemplarSeries)
+	for i := range es.entries {
+		ent := &es.entries[i]
+		if len(ent.metricName) == 0 {
+			continue
+		}
+		e := &ent.exemplar
+		if e.Timestamp < tr.MinTimestamp || e.Timestamp > tr.MaxTimestamp {
+			continue
+		}
+		ser := m[string(ent.metricName)]
+		if ser == nil {
+			if err := mn.Unmarshal(ent.metricName); err != nil {
+				return nil, fmt.Errorf("cannot unmarshal metricName %q: %w", ent.metricName, err)
+			}
+			ok, err := matchTagFilterss(&mn, tfsPtrss, &kb)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+			ser = &ExemplarSeries{}
+			ser.MetricName.CopyFrom(&mn)
+			m[string(ent.metricName)] = ser
+		}
+		ser.Exemplars = append(ser.Exemplars, Exemplar{})
+		ser.Exemplars[len(ser.Exemplars)-1].copyFrom(e)
+	}
+
+	result := make([]ExemplarSeries, 0, len(m))
+	for _, ser := range m {
+		sort.Slice(ser.Exemplars, func(i, j int) bool {
+			return ser.Exemplars[i].Timestamp < ser.Exemplars[j].Timestamp
+		})
+		result = append(result, *ser)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].MetricName.String() < result[j].MetricName.String()
+	})
+	return result, nil
+}
+
+func matchTagFilterss(mn *MetricName, tfsPtrss [][]*tagFilter, kb *bytesutil.ByteBuffer) (bool, error) {
+	for _, tfsPtrs := range tfsPtrss {
+		ok, err := matchTagFilters(mn, tfsPtrs, kb)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ExemplarStorageMetrics contains essential metrics for ExemplarStorage.
+type ExemplarStorageMetrics struct {
+	ExemplarsCount      uint64
+	ExemplarsCapacity   uint64
+	AddedExemplars      uint64
+	OutOfOrderExemplars uint64
+}
+
+// UpdateMetrics updates m with metrics from es.
+func (es *ExemplarStorage) UpdateMetrics(m *ExemplarStorageMetrics) {
+	es.mu.Lock()
+	m.ExemplarsCount += uint64(es.count)
+	m.ExemplarsCapacity += uint64(len(es.entries))
+	es.mu.Unlock()
+
+	m.AddedExemplars += atomic.LoadUint64(&es.addedExemplars)
+	m.OutOfOrderExemplars += atomic.LoadUint64(&es.outOfOrderExemplars)
+}
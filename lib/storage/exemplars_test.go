@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
+)
+
+func TestExemplarStorageAddSearch(t *testing.T) {
+	es := NewExemplarStorage(10)
+	addExemplar := func(metricGroup, job string, value float64, timestamp int64) {
+		t.Helper()
+		labels := []prompb.Label{
+			{Name: []byte("job"), Value: []byte(job)},
+			{Name: []byte("__name__"), Value: []byte(metricGroup)},
+		}
+		metricNameRaw := MarshalMetricNameRaw(nil, labels)
+		e := &Exemplar{
+			Tags: []Tag{{
+				Key:   []byte("trace_id"),
+				Value: []byte(fmt.Sprintf("trace_%d", timestamp)),
+			}},
+			Value:     value,
+			Timestamp: timestamp,
+		}
+		if err := es.Add(metricNameRaw, e); err != nil {
+			t.Fatalf("cannot add exemplar: %s", err)
+		}
+	}
+	search := func(metricGroup string, tr TimeRange) []ExemplarSeries {
+		t.Helper()
+		tfs := NewTagFilters()
+		if err := tfs.Add(nil, []byte(metricGroup), false, false); err != nil {
+			t.Fatalf("cannot add tag filter: %s", err)
+		}
+		ess, err := es.Search([]*TagFilters{tfs}, tr)
+		if err != nil {
+			t.Fatalf("unexpected error in Search: %s", err)
+		}
+		return ess
+	}
+	getTimestamps := func(ser *ExemplarSeries) []int64 {
+		var timestamps []int64
+		for _, e := range ser.Exemplars {
+			timestamps = append(timestamps, e.Timestamp)
+		}
+		return timestamps
+	}
+
+	addExemplar("foo", "a", 1, 1000)
+	addExemplar("foo", "b", 2, 1000)
+	addExemplar("foo", "a", 3, 2000)
+	addExemplar("bar", "a", 4, 2000)
+
+	// Duplicate and out-of-order exemplars must be skipped.
+	addExemplar("foo", "a", 3, 2000)
+	addExemplar("foo", "a", 5, 1500)
+
+	// Repeated exemplar with a newer timestamp must be skipped.
+	if err := es.Add(MarshalMetricNameRaw(nil, []prompb.Label{
+		{Name: []byte("__name__"), Value: []byte("foo")},
+		{Name: []byte("job"), Value: []byte("a")},
+	}), &Exemplar{
+		Tags:      []Tag{{Key: []byte("trace_id"), Value: []byte("trace_2000")}},
+		Value:     3,
+		Timestamp: 2500,
+	}); err != nil {
+		t.Fatalf("cannot add exemplar: %s", err)
+	}
+
+	ess := search("foo", TimeRange{MinTimestamp: 0, MaxTimestamp: 3000})
+	if len(ess) != 2 {
+		t.Fatalf("unexpected number of series; got %d; want 2", len(ess))
+	}
+	if s := ess[0].MetricName.String(); s != `foo{job="a"}` {
+		t.Fatalf("unexpected first series: %s", s)
+	}
+	if ts := getTimestamps(&ess[0]); fmt.Sprint(ts) != "[1000 2000]" {
+		t.Fatalf("unexpected timestamps for the first series: %v", ts)
+	}
+	if s := ess[1].MetricName.String(); s != `foo{job="b"}` {
+		t.Fatalf("unexpected second series: %s", s)
+	}
+	if e := &ess[1].Exemplars[0]; e.Value != 2 || string(e.Tags[0].Value) != "trace_1000" {
+		t.Fatalf("unexpected exemplar for the second series: %+v", e)
+	}
+
+	// Search on the time range
+	ess = search("foo", TimeRange{MinTimestamp: 1500, MaxTimestamp: 3000})
+	if len(ess) != 1 {
+		t.Fatalf("unexpected number of series; got %d; want 1", len(ess))
+	}
+	if ts := getTimestamps(&ess[0]); fmt.Sprint(ts) != "[2000]" {
+		t.Fatalf("unexpected timestamps: %v", ts)
+	}
+
+	// The oldest exemplars must be overwritten when the storage is full.
+	for i := 0; i < 10; i++ {
+		addExemplar("baz", "a", float64(i), int64(3000+i))
+	}
+	if ess := search("foo", TimeRange{MinTimestamp: 0, MaxTimestamp: 1e6}); len(ess) != 0 {
+		t.Fatalf("expecting empty result after overwriting all the exemplars; got %d series", len(ess))
+	}
+	ess = search("baz", TimeRange{MinTimestamp: 0, MaxTimestamp: 1e6})
+	if len(ess) != 1 || len(ess[0].Exemplars) != 10 {
+		t.Fatalf("unexpected result for baz: %+v", ess)
+	}
+
+	// Exemplars for the overwritten series must be accepted again.
+	addExemplar("foo", "a", 1, 1000)
+	if ess := search("foo", TimeRange{MinTimestamp: 0, MaxTimestamp: 1e6}); len(ess) != 1 {
+		t.Fatalf("unexpected number of series; got %d; want 1", len(ess))
+	}
+
+	var m ExemplarStorageMetrics
+	es.UpdateMetrics(&m)
+	if m.ExemplarsCount != 10 {
+		t.Fatalf("unexpected ExemplarsCount; got %d; want 10", m.ExemplarsCount)
+	}
+	if m.AddedExemplars != 15 {
+		t.Fatalf("unexpected AddedExemplars; got %d; want 15", m.AddedExemplars)
+	}
+	if m.OutOfOrderExemplars != 1 {
+		t.Fatalf("unexpected OutOfOrderExemplars; got %d; want 1", m.OutOfOrderExemplars)
+	}
+}
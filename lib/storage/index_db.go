@@ -121,10 +121,18 @@ type indexDB struct {
 
 	// The minimum timestamp when queries with composite index can be used.
 	minTimestampForCompositeIndex int64
+
+	// The path to directory for persisting caches owned by db.
+	//
+	// Caches aren't persisted if cachePath is empty.
+	cachePath string
 }
 
 // openIndexDB opens index db from the given path with the given caches.
-func openIndexDB(path string, metricIDCache, metricNameCache, tsidCache *workingsetcache.Cache, minTimestampForCompositeIndex int64) (*indexDB, error) {
+//
+// Caches owned by the db are loaded from cachePath and are saved to cachePath on close.
+// Caches aren't persisted if cachePath is empty.
+func openIndexDB(path, cachePath string, metricIDCache, metricNameCache, tsidCache *workingsetcache.Cache, minTimestampForCompositeIndex int64) (*indexDB, error) {
 	if metricIDCache == nil {
 		logger.Panicf("BUG: metricIDCache must be non-nil")
 	}
@@ -142,7 +150,8 @@ func openIndexDB(path string, metricIDCache, metricNameCache, tsidCache *working
 
 	name := filepath.Base(path)
 
-	// Do not persist tagCache in files, since it is very volatile.
+	// tagCache entries remain valid after the restart only if tagFiltersKeyGen is restored.
+	// See Storage.mustLoadTagFiltersKeyGen.
 	mem := memory.Allowed()
 
 	db := &indexDB{
@@ -150,14 +159,15 @@ func openIndexDB(path string, metricIDCache, metricNameCache, tsidCache *working
 		tb:       tb,
 		name:     name,
 
-		tagCache:                       workingsetcache.New(mem/32, time.Hour),
+		tagCache:                       mustLoadIndexDBCache(cachePath, "tagFilters", mem/32),
 		metricIDCache:                  metricIDCache,
 		metricNameCache:                metricNameCache,
 		tsidCache:                      tsidCache,
-		uselessTagFiltersCache:         workingsetcache.New(mem/128, time.Hour),
-		durationsPerDateTagFilterCache: workingsetcache.New(mem/128, time.Hour),
+		uselessTagFiltersCache:         mustLoadIndexDBCache(cachePath, "uselessTagFilters", mem/128),
+		durationsPerDateTagFilterCache: mustLoadIndexDBCache(cachePath, "durationsPerDateTagFilter", mem/128),
 
 		minTimestampForCompositeIndex: minTimestampForCompositeIndex,
+		cachePath:                     cachePath,
 	}
 
 	is := db.getIndexSearch(noDeadline)
@@ -318,9 +328,12 @@ func (db *indexDB) decRef() {
 	db.SetExtDB(nil)
 
 	// Free space occupied by caches owned by db.
-	db.tagCache.Stop()
-	db.uselessTagFiltersCache.Stop()
-	db.durationsPerDateTagFilterCache.Stop()
+	// Persist the caches, so they could be re-used after the restart.
+	// There is no need in persisting caches for the db, which is going to be dropped.
+	mustDrop := atomic.LoadUint64(&db.mustDrop) != 0
+	mustSaveAndStopIndexDBCache(db.tagCache, db.cachePath, "tagFilters", mustDrop)
+	mustSaveAndStopIndexDBCache(db.uselessTagFiltersCache, db.cachePath, "uselessTagFilters", mustDrop)
+	mustSaveAndStopIndexDBCache(db.durationsPerDateTagFilterCache, db.cachePath, "durationsPerDateTagFilter", mustDrop)
 
 	db.tagCache = nil
 	db.metricIDCache = nil
@@ -329,15 +342,51 @@ func (db *indexDB) decRef() {
 	db.uselessTagFiltersCache = nil
 	db.durationsPerDateTagFilterCache = nil
 
-	if atomic.LoadUint64(&db.mustDrop) == 0 {
+	if !mustDrop {
 		return
 	}
 
 	logger.Infof("dropping indexDB %q", tbPath)
 	fs.MustRemoveAll(tbPath)
+	if db.cachePath != "" {
+		fs.MustRemoveAll(db.cachePath)
+	}
 	logger.Infof("indexDB %q has been dropped", tbPath)
 }
 
+func mustLoadIndexDBCache(cachePath, name string, sizeBytes int) *workingsetcache.Cache {
+	if cachePath == "" {
+		return workingsetcache.New(sizeBytes, time.Hour)
+	}
+	path := cachePath + "/" + name
+	startTime := time.Now()
+	c := workingsetcache.Load(path, sizeBytes, time.Hour)
+	var cs fastcache.Stats
+	c.UpdateStats(&cs)
+	if cs.EntriesCount > 0 {
+		logger.Infof("loaded %s cache from %q in %.3f seconds; entriesCount: %d; sizeBytes: %d",
+			name, path, time.Since(startTime).Seconds(), cs.EntriesCount, cs.BytesSize)
+	}
+	return c
+}
+
+func mustSaveAndStopIndexDBCache(c *workingsetcache.Cache, cachePath, name string, mustDrop bool) {
+	if cachePath == "" || mustDrop {
+		c.Stop()
+		return
+	}
+	path := cachePath + "/" + name
+	startTime := time.Now()
+	if err := c.Save(path); err != nil {
+		logger.Panicf("FATAL: cannot save %s cache to %q: %s", name, path, err)
+	}
+	var cs fastcache.Stats
+	c.UpdateStats(&cs)
+	c.Stop()
+	logger.Infof("saved %s cache to %q in %.3f seconds; entriesCount: %d; sizeBytes: %d",
+		name, path, time.Since(startTime).Seconds(), cs.EntriesCount, cs.BytesSize)
+}
+
 func (db *indexDB) getFromTagCache(key []byte) ([]TSID, bool) {
 	compressedBuf := tagBufPool.Get()
 	defer tagBufPool.Put(compressedBuf)
@@ -433,6 +482,19 @@ func invalidateTagCache() {
 
 var tagFiltersKeyGen uint64
 
+// restoreTagFiltersKeyGen restores tagFiltersKeyGen to the given gen, so tagCache entries
+// saved with this gen become visible again.
+//
+// tagFiltersKeyGen is never decreased, since this may expose stale tagCache entries.
+func restoreTagFiltersKeyGen(gen uint64) {
+	for {
+		n := atomic.LoadUint64(&tagFiltersKeyGen)
+		if n >= gen || atomic.CompareAndSwapUint64(&tagFiltersKeyGen, n, gen) {
+			return
+		}
+	}
+}
+
 func marshalTSIDs(dst []byte, tsids []TSID) []byte {
 	dst = encoding.MarshalUint64(dst, uint64(len(tsids)))
 	for i := range tsids {
@@ -495,6 +557,9 @@ type indexSearch struct {
 	// deadline in unix timestamp seconds for the given search.
 	deadline uint64
 
+	// cancelCh is closed when the given search must be canceled, e.g. when the client closes the connection.
+	cancelCh <-chan struct{}
+
 	// tsidByNameMisses and tsidByNameSkips is used for a performance
 	// hack in GetOrCreateTSIDByName. See the comment there.
 	tsidByNameMisses int
@@ -551,6 +616,7 @@ func (db *indexDB) putIndexSearch(is *indexSearch) {
 	is.kb.Reset()
 	is.mp.Reset()
 	is.deadline = 0
+	is.cancelCh = nil
 
 	// Do not reset tsidByNameMisses and tsidByNameSkips,
 	// since they are used in GetOrCreateTSIDByName across call boundaries.
@@ -716,6 +782,7 @@ func (is *indexSearch) searchTagKeysOnTimeRange(tks map[string]struct{}, tr Time
 			defer wg.Done()
 			tksLocal := make(map[string]struct{})
 			isLocal := is.db.getIndexSearch(is.deadline)
+			isLocal.cancelCh = is.cancelCh
 			err := isLocal.searchTagKeysOnDate(tksLocal, date, maxTagKeys)
 			is.db.putIndexSearch(isLocal)
 			mu.Lock()
@@ -752,7 +819,7 @@ func (is *indexSearch) searchTagKeysOnDate(tks map[string]struct{}, date uint64,
 	ts.Seek(prefix)
 	for len(tks) < maxTagKeys && ts.NextItem() {
 		if loopsPaceLimiter&paceLimiterFastIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.cancelCh); err != nil {
 				return err
 			}
 		}
@@ -831,7 +898,7 @@ func (is *indexSearch) searchTagKeys(tks map[string]struct{}, maxTagKeys int) er
 	ts.Seek(prefix)
 	for len(tks) < maxTagKeys && ts.NextItem() {
 		if loopsPaceLimiter&paceLimiterFastIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.cancelCh); err != nil {
 				return err
 			}
 		}
@@ -911,6 +978,7 @@ func (is *indexSearch) searchTagValuesOnTimeRange(tvs map[string]struct{}, tagKe
 			defer wg.Done()
 			tvsLocal := make(map[string]struct{})
 			isLocal := is.db.getIndexSearch(is.deadline)
+			isLocal.cancelCh = is.cancelCh
 			err := isLocal.searchTagValuesOnDate(tvsLocal, tagKey, date, maxTagValues)
 			is.db.putIndexSearch(isLocal)
 			mu.Lock()
@@ -948,7 +1016,7 @@ func (is *indexSearch) searchTagValuesOnDate(tvs map[string]struct{}, tagKey []b
 	ts.Seek(prefix)
 	for len(tvs) < maxTagValues && ts.NextItem() {
 		if loopsPaceLimiter&paceLimiterFastIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.cancelCh); err != nil {
 				return err
 			}
 		}
@@ -1033,7 +1101,7 @@ func (is *indexSearch) searchTagValues(tvs map[string]struct{}, tagKey []byte, m
 	ts.Seek(prefix)
 	for len(tvs) < maxTagValues && ts.NextItem() {
 		if loopsPaceLimiter&paceLimiterFastIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.cancelCh); err != nil {
 				return err
 			}
 		}
@@ -1127,6 +1195,7 @@ func (is *indexSearch) searchTagValueSuffixesForTimeRange(tvss map[string]struct
 			defer wg.Done()
 			tvssLocal := make(map[string]struct{})
 			isLocal := is.db.getIndexSearch(is.deadline)
+			isLocal.cancelCh = is.cancelCh
 			err := isLocal.searchTagValueSuffixesForDate(tvssLocal, date, tagKey, tagValuePrefix, delimiter, maxTagValueSuffixes)
 			is.db.putIndexSearch(isLocal)
 			mu.Lock()
@@ -1184,7 +1253,7 @@ func (is *indexSearch) searchTagValueSuffixesForPrefix(tvss map[string]struct{},
 	ts.Seek(prefix)
 	for len(tvss) < maxTagValueSuffixes && ts.NextItem() {
 		if loopsPaceLimiter&paceLimiterFastIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.cancelCh); err != nil {
 				return err
 			}
 		}
@@ -1262,7 +1331,7 @@ func (is *indexSearch) getSeriesCount() (uint64, error) {
 	ts.Seek(kb.B)
 	for ts.NextItem() {
 		if loopsPaceLimiter&paceLimiterFastIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.cancelCh); err != nil {
 				return 0, err
 			}
 		}
@@ -1334,7 +1403,7 @@ func (is *indexSearch) getTSDBStatusForDate(date uint64, topN int) (*TSDBStatus,
 	ts.Seek(prefix)
 	for ts.NextItem() {
 		if loopsPaceLimiter&paceLimiterFastIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.cancelCh); err != nil {
 				return nil, err
 			}
 		}
@@ -1638,7 +1707,9 @@ func (is *indexSearch) loadDeletedMetricIDs() (*uint64set.Set, error) {
 }
 
 // searchTSIDs returns sorted tsids matching the given tfss over the given tr.
-func (db *indexDB) searchTSIDs(tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64) ([]TSID, error) {
+//
+// The search is canceled with ErrSearchCanceled error when cancelCh is closed.
+func (db *indexDB) searchTSIDs(tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64, cancelCh <-chan struct{}) ([]TSID, error) {
 	if len(tfss) == 0 {
 		return nil, nil
 	}
@@ -1658,6 +1729,7 @@ func (db *indexDB) searchTSIDs(tfss []*TagFilters, tr TimeRange, maxMetrics int,
 
 	// Slow path - search for tsids in the db and extDB.
 	is := db.getIndexSearch(deadline)
+	is.cancelCh = cancelCh
 	localTSIDs, err := is.searchTSIDs(tfss, tr, maxMetrics)
 	db.putIndexSearch(is)
 	if err != nil {
@@ -1677,6 +1749,7 @@ func (db *indexDB) searchTSIDs(tfss []*TagFilters, tr TimeRange, maxMetrics int,
 			return
 		}
 		is := extDB.getIndexSearch(deadline)
+		is.cancelCh = cancelCh
 		extTSIDs, err = is.searchTSIDs(tfss, tr, maxMetrics)
 		extDB.putIndexSearch(is)
 
@@ -1836,7 +1909,7 @@ func (is *indexSearch) searchTSIDs(tfss []*TagFilters, tr TimeRange, maxMetrics
 	i := 0
 	for loopsPaceLimiter, metricID := range metricIDs {
 		if loopsPaceLimiter&paceLimiterSlowIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.cancelCh); err != nil {
 				return nil, err
 			}
 		}
@@ -1912,7 +1985,7 @@ func (is *indexSearch) updateMetricIDsByMetricNameMatch(metricIDs, srcMetricIDs
 	defer PutMetricName(mn)
 	for loopsPaceLimiter, metricID := range sortedMetricIDs {
 		if loopsPaceLimiter&paceLimiterSlowIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.cancelCh); err != nil {
 				return err
 			}
 		}
@@ -2415,7 +2488,7 @@ func (is *indexSearch) getMetricIDsForTagFilterSlow(tf *tagFilter, filter *uint6
 	ts.Seek(prefix)
 	for ts.NextItem() {
 		if loopsPaceLimiter&paceLimiterMediumIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.cancelCh); err != nil {
 				return loopsCount, err
 			}
 		}
@@ -2546,7 +2619,7 @@ func (is *indexSearch) updateMetricIDsForOrSuffixNoFilter(prefix []byte, maxMetr
 	ts.Seek(prefix)
 	for metricIDs.Len() < maxMetrics && ts.NextItem() {
 		if loopsPaceLimiter&paceLimiterFastIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.cancelCh); err != nil {
 				return loopsCount, err
 			}
 		}
@@ -2588,7 +2661,7 @@ func (is *indexSearch) updateMetricIDsForOrSuffixWithFilter(prefix []byte, metri
 	var metricID uint64
 	for ts.NextItem() {
 		if loopsPaceLimiter&paceLimiterMediumIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.cancelCh); err != nil {
 				return err
 			}
 		}
@@ -2691,6 +2764,7 @@ func (is *indexSearch) getMetricIDsForTimeRange(tr TimeRange, maxMetrics int) (*
 		go func(date uint64) {
 			defer wg.Done()
 			isLocal := is.db.getIndexSearch(is.deadline)
+			isLocal.cancelCh = is.cancelCh
 			m, err := isLocal.getMetricIDsForDate(date, maxMetrics)
 			is.db.putIndexSearch(isLocal)
 			mu.Lock()
@@ -2750,6 +2824,7 @@ func (is *indexSearch) tryUpdatingMetricIDsForDateRange(metricIDs *uint64set.Set
 		go func(date uint64) {
 			defer wg.Done()
 			isLocal := is.db.getIndexSearch(is.deadline)
+			isLocal.cancelCh = is.cancelCh
 			m, err := isLocal.getMetricIDsForDateAndFilters(date, tfs, maxMetrics)
 			is.db.putIndexSearch(isLocal)
 			mu.Lock()
@@ -3165,7 +3240,7 @@ func (is *indexSearch) updateMetricIDsForPrefix(prefix []byte, metricIDs *uint64
 	ts.Seek(prefix)
 	for ts.NextItem() {
 		if loopsPaceLimiter&paceLimiterFastIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.cancelCh); err != nil {
 				return err
 			}
 		}
@@ -0,0 +1,171 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding/zstd"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/mergeset"
+)
+
+// indexDBExportHeader is written at the beginning of indexdb export stream.
+//
+// The last byte is the format version.
+const indexDBExportHeader = "VMINDEXDB\x01"
+
+// maxIndexDBExportBlockSize is the maximum size of uncompressed block in indexdb export stream.
+const maxIndexDBExportBlockSize = 1024 * 1024
+
+// ExportIndexDB writes all the entries from the previous and the current indexdb to w.
+//
+// The exported entries contain MetricName -> TSID mappings together with all the other index entries,
+// so they can be imported into another Storage via ImportIndexDB before backfilling the data with the same TSIDs.
+//
+// It returns the number of exported entries.
+func (s *Storage) ExportIndexDB(w io.Writer) (int, error) {
+	if _, err := io.WriteString(w, indexDBExportHeader); err != nil {
+		return 0, fmt.Errorf("cannot write indexdb export header: %w", err)
+	}
+	iw := &indexDBExportWriter{
+		w: w,
+	}
+	idb := s.idb()
+	var errExt error
+	idb.doExtDB(func(extDB *indexDB) {
+		errExt = iw.writeItems(extDB.tb)
+	})
+	if errExt != nil {
+		return iw.itemsCount, fmt.Errorf("cannot export previous indexdb %q: %w", idb.name, errExt)
+	}
+	if err := iw.writeItems(idb.tb); err != nil {
+		return iw.itemsCount, fmt.Errorf("cannot export indexdb %q: %w", idb.name, err)
+	}
+	if err := iw.flush(); err != nil {
+		return iw.itemsCount, err
+	}
+	return iw.itemsCount, nil
+}
+
+type indexDBExportWriter struct {
+	w io.Writer
+
+	buf           []byte
+	compressedBuf []byte
+	itemsCount    int
+}
+
+func (iw *indexDBExportWriter) writeItems(tb *mergeset.Table) error {
+	var ts mergeset.TableSearch
+	ts.Init(tb)
+	defer ts.MustClose()
+	ts.Seek(nil)
+	for ts.NextItem() {
+		item := ts.Item
+		iw.buf = encoding.MarshalVarUint64(iw.buf, uint64(len(item)))
+		iw.buf = append(iw.buf, item...)
+		iw.itemsCount++
+		if len(iw.buf) >= maxIndexDBExportBlockSize {
+			if err := iw.flush(); err != nil {
+				return err
+			}
+		}
+	}
+	return ts.Error()
+}
+
+func (iw *indexDBExportWriter) flush() error {
+	if len(iw.buf) == 0 {
+		return nil
+	}
+	iw.compressedBuf = encoding.CompressZSTDLevel(iw.compressedBuf[:0], iw.buf, 1)
+	iw.buf = iw.buf[:0]
+	var lenBuf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(lenBuf[:], uint64(len(iw.compressedBuf)))
+	if _, err := iw.w.Write(lenBuf[:n]); err != nil {
+		return fmt.Errorf("cannot write block length: %w", err)
+	}
+	if _, err := iw.w.Write(iw.compressedBuf); err != nil {
+		return fmt.Errorf("cannot write block with %d bytes: %w", len(iw.compressedBuf), err)
+	}
+	return nil
+}
+
+// ImportIndexDB imports index entries exported via ExportIndexDB from r into the current indexdb.
+//
+// It is recommended importing the entries into empty Storage, since the imported MetricName -> TSID mappings
+// don't replace already existing mappings for the same metric names.
+//
+// It returns the number of imported entries.
+func (s *Storage) ImportIndexDB(r io.Reader) (int, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, len(indexDBExportHeader))
+	if _, err := io.ReadFull(br, header); err != nil {
+		return 0, fmt.Errorf("cannot read indexdb export header: %w", err)
+	}
+	if string(header) != indexDBExportHeader {
+		return 0, fmt.Errorf("unexpected indexdb export header; got %q; want %q", header, indexDBExportHeader)
+	}
+	idb := s.idb()
+	itemsCount := 0
+	var compressedBuf, buf []byte
+	var items [][]byte
+	for {
+		blockLen, err := binary.ReadUvarint(br)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return itemsCount, fmt.Errorf("cannot read block length: %w", err)
+		}
+		if blockLen > 2*maxIndexDBExportBlockSize {
+			return itemsCount, fmt.Errorf("too big block length: %d bytes; mustn't exceed %d bytes", blockLen, 2*maxIndexDBExportBlockSize)
+		}
+		compressedBuf = bytesutil.Resize(compressedBuf, int(blockLen))
+		if _, err := io.ReadFull(br, compressedBuf); err != nil {
+			return itemsCount, fmt.Errorf("cannot read block with %d bytes: %w", blockLen, err)
+		}
+		// Limit the decompressed block size, so crafted blocks with high compression ratio cannot exhaust memory.
+		buf, err = zstd.DecompressLimited(buf[:0], compressedBuf, 2*maxIndexDBExportBlockSize)
+		if err != nil {
+			return itemsCount, fmt.Errorf("cannot decompress block with %d bytes: %w", blockLen, err)
+		}
+		items = items[:0]
+		tail := buf
+		for len(tail) > 0 {
+			var itemLen uint64
+			tail, itemLen, err = encoding.UnmarshalVarUint64(tail)
+			if err != nil {
+				return itemsCount, fmt.Errorf("cannot unmarshal item length: %w", err)
+			}
+			if uint64(len(tail)) < itemLen {
+				return itemsCount, fmt.Errorf("too short block for item with %d bytes; got %d bytes", itemLen, len(tail))
+			}
+			items = append(items, tail[:itemLen])
+			tail = tail[itemLen:]
+		}
+		if err := idb.tb.AddItems(items); err != nil {
+			return itemsCount, fmt.Errorf("cannot add %d items to indexdb %q: %w", len(items), idb.name, err)
+		}
+		itemsCount += len(items)
+	}
+	idb.tb.FlushPendingItems()
+
+	// The imported entries may contain deleted metricIDs.
+	is := idb.getIndexSearch(noDeadline)
+	dmis, err := is.loadDeletedMetricIDs()
+	idb.putIndexSearch(is)
+	if err != nil {
+		return itemsCount, fmt.Errorf("cannot load deleted metricIDs after the import: %w", err)
+	}
+	idb.updateDeletedMetricIDs(dmis)
+
+	// Reset TagFilters -> TSIDs cache, since it may miss the imported TSIDs.
+	invalidateTagCache()
+	logger.Infof("imported %d entries into indexdb %q", itemsCount, idb.name)
+	return itemsCount, nil
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+)
+
+// MetricMetadata contains metadata for a metric family.
+//
+// See https://prometheus.io/docs/prometheus/latest/querying/api/#querying-metric-metadata
+type MetricMetadata struct {
+	MetricFamilyName string
+	Type             string
+	Help             string
+	Unit             string
+
+	// Source is the source of the metadata such as `promscrape` or `promremotewrite`.
+	Source string
+
+	// LastUpdateTimestamp is the unix timestamp in seconds for the last update of the metadata.
+	LastUpdateTimestamp uint64
+}
+
+// MetadataStorage is an in-memory storage for metric metadata.
+//
+// It holds the last received metadata per each metric family name.
+type MetadataStorage struct {
+	// Atomic counters must go at the top of the structure in order to properly align by 8 bytes on 32-bit archs.
+	// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/212 .
+	updates uint64
+
+	mu sync.Mutex
+	m  map[string]*MetricMetadata
+}
+
+// NewMetadataStorage returns new MetadataStorage.
+func NewMetadataStorage() *MetadataStorage {
+	return &MetadataStorage{
+		m: make(map[string]*MetricMetadata),
+	}
+}
+
+// Add adds metadata with the given args to ms.
+//
+// It overrides the previously added metadata for the same metricFamilyName.
+// Add makes copies of the passed strings, so they may refer to byte buffers, which are modified after returning from Add.
+func (ms *MetadataStorage) Add(metricFamilyName, metricType, help, unit, source string) {
+	if len(metricFamilyName) == 0 {
+		return
+	}
+	currentTimestamp := fasttime.UnixTimestamp()
+	ms.mu.Lock()
+	mm := ms.m[metricFamilyName]
+	if mm == nil {
+		mm = &MetricMetadata{
+			MetricFamilyName: copyString(metricFamilyName),
+		}
+		ms.m[mm.MetricFamilyName] = mm
+	}
+	if mm.Type != metricType {
+		mm.Type = copyString(metricType)
+	}
+	if mm.Help != help {
+		mm.Help = copyString(help)
+	}
+	if mm.Unit != unit {
+		mm.Unit = copyString(unit)
+	}
+	if mm.Source != source {
+		mm.Source = copyString(source)
+	}
+	mm.LastUpdateTimestamp = currentTimestamp
+	ms.mu.Unlock()
+	atomic.AddUint64(&ms.updates, 1)
+}
+
+func copyString(s string) string {
+	return string(bytesutil.ToUnsafeBytes(s))
+}
+
+// Search returns metadata for the given metricFamilyName.
+//
+// Metadata for all the metric families is returned if metricFamilyName is empty.
+// Up to limit entries sorted by metric family name are returned if limit > 0.
+func (ms *MetadataStorage) Search(metricFamilyName string, limit int) []MetricMetadata {
+	var mms []MetricMetadata
+	ms.mu.Lock()
+	if len(metricFamilyName) > 0 {
+		if mm := ms.m[metricFamilyName]; mm != nil {
+			mms = append(mms, *mm)
+		}
+	} else {
+		mms = make([]MetricMetadata, 0, len(ms.m))
+		for _, mm := range ms.m {
+			mms = append(mms, *mm)
+		}
+	}
+	ms.mu.Unlock()
+
+	sort.Slice(mms, func(i, j int) bool {
+		return mms[i].MetricFamilyName < mms[j].MetricFamilyName
+	})
+	if limit > 0 && len(mms) > limit {
+		mms = mms[:limit]
+	}
+	return mms
+}
+
+// MetadataStorageMetrics contains essential metrics for MetadataStorage.
+type MetadataStorageMetrics struct {
+	MetricFamilies uint64
+	Updates        uint64
+}
+
+// UpdateMetrics updates m with metrics from ms.
+func (ms *MetadataStorage) UpdateMetrics(m *MetadataStorageMetrics) {
+	ms.mu.Lock()
+	m.MetricFamilies += uint64(len(ms.m))
+	ms.mu.Unlock()
+
+	m.Updates += atomic.LoadUint64(&ms.updates)
+}
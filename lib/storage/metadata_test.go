@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+)
+
+func TestMetadataStorageAddSearch(t *testing.T) {
+	ms := NewMetadataStorage()
+
+	if mms := ms.Search("", 0); len(mms) != 0 {
+		t.Fatalf("expecting empty result for empty storage; got %+v", mms)
+	}
+
+	buf := []byte("http_requests_total")
+	ms.Add(bytesutil.ToUnsafeString(buf), "counter", "The total number of HTTP requests", "", "promscrape")
+	ms.Add("go_goroutines", "gauge", "Number of goroutines", "", "promscrape")
+	ms.Add("foo_seconds", "histogram", "Foo duration", "seconds", "promremotewrite")
+	ms.Add("", "gauge", "metadata without metric name must be ignored", "", "promscrape")
+
+	// The latest metadata must win.
+	ms.Add("go_goroutines", "gauge", "The number of goroutines that currently exist", "", "promremotewrite")
+
+	mms := ms.Search("", 0)
+	if len(mms) != 3 {
+		t.Fatalf("unexpected number of entries; got %d; want 3", len(mms))
+	}
+	names := []string{mms[0].MetricFamilyName, mms[1].MetricFamilyName, mms[2].MetricFamilyName}
+	if names[0] != "foo_seconds" || names[1] != "go_goroutines" || names[2] != "http_requests_total" {
+		t.Fatalf("unexpected metric family names: %q", names)
+	}
+	mm := &mms[1]
+	if mm.Type != "gauge" || mm.Help != "The number of goroutines that currently exist" || mm.Source != "promremotewrite" {
+		t.Fatalf("unexpected metadata for go_goroutines: %+v", mm)
+	}
+	if mm.LastUpdateTimestamp == 0 {
+		t.Fatalf("LastUpdateTimestamp must be set")
+	}
+	if mm := &mms[0]; mm.Unit != "seconds" || mm.Type != "histogram" {
+		t.Fatalf("unexpected metadata for foo_seconds: %+v", mm)
+	}
+
+	// Modification of the source buffer mustn't change the stored metadata.
+	copy(buf, "xxxx")
+	mms = ms.Search("http_requests_total", 0)
+	if len(mms) != 1 || mms[0].MetricFamilyName != "http_requests_total" || mms[0].Type != "counter" {
+		t.Fatalf("unexpected metadata for http_requests_total: %+v", mms)
+	}
+
+	// Search with limit
+	mms = ms.Search("", 2)
+	if len(mms) != 2 || mms[1].MetricFamilyName != "go_goroutines" {
+		t.Fatalf("unexpected result with limit=2: %+v", mms)
+	}
+
+	// Search for missing metric
+	if mms := ms.Search("missing", 0); len(mms) != 0 {
+		t.Fatalf("expecting empty result for missing metric; got %+v", mms)
+	}
+
+	var m MetadataStorageMetrics
+	ms.UpdateMetrics(&m)
+	if m.MetricFamilies != 3 {
+		t.Fatalf("unexpected MetricFamilies; got %d; want 3", m.MetricFamilies)
+	}
+	if m.Updates != 4 {
+		t.Fatalf("unexpected Updates; got %d; want 4", m.Updates)
+	}
+}
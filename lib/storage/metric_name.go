@@ -537,6 +537,28 @@ func (mn *MetricName) unmarshalRaw(src []byte) error {
 	return nil
 }
 
+// GetMetricGroupFromRaw returns metric group (aka `__name__` label value) from metricNameRaw encoded with MarshalMetricNameRaw.
+//
+// The returned metric group refers to metricNameRaw. It is empty if metricNameRaw has no metric group.
+func GetMetricGroupFromRaw(metricNameRaw []byte) ([]byte, error) {
+	src := metricNameRaw
+	for len(src) > 0 {
+		tail, key, err := unmarshalBytesFast(src)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode key: %w", err)
+		}
+		tail, value, err := unmarshalBytesFast(tail)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decode value: %w", err)
+		}
+		src = tail
+		if len(key) == 0 {
+			return value, nil
+		}
+	}
+	return nil, nil
+}
+
 func marshalBytesFast(dst []byte, s []byte) []byte {
 	dst = encoding.MarshalUint16(dst, uint16(len(s)))
 	dst = append(dst, s...)
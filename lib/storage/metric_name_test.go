@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompb"
 )
 
 func TestMetricNameString(t *testing.T) {
@@ -170,6 +172,28 @@ func TestMetricNameMarshalUnmarshalRaw(t *testing.T) {
 	}
 }
 
+func TestGetMetricGroupFromRaw(t *testing.T) {
+	f := func(labels []prompb.Label, expected string) {
+		t.Helper()
+		data := MarshalMetricNameRaw(nil, labels)
+		metricGroup, err := GetMetricGroupFromRaw(data)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err)
+		}
+		if string(metricGroup) != expected {
+			t.Fatalf("unexpected metric group; got %q; want %q", metricGroup, expected)
+		}
+	}
+	f(nil, "")
+	f([]prompb.Label{{Name: []byte("job"), Value: []byte("a")}}, "")
+	f([]prompb.Label{{Name: []byte("__name__"), Value: []byte("foo")}}, "foo")
+	f([]prompb.Label{{Name: []byte("job"), Value: []byte("a")}, {Name: nil, Value: []byte("bar")}}, "bar")
+
+	if _, err := GetMetricGroupFromRaw([]byte("x")); err == nil {
+		t.Fatalf("expecting non-nil error for invalid metricNameRaw")
+	}
+}
+
 func TestMetricNameCopyFrom(t *testing.T) {
 	var from MetricName
 	from.MetricGroup = []byte("group")
@@ -21,6 +21,7 @@ import (
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/memory"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/ratelimiter"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/storagepacelimiter"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/syncwg"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/uint64set"
@@ -105,7 +106,56 @@ const rawRowsFlushInterval = time.Second
 
 // The interval for flushing inmemory parts to persistent storage,
 // so they survive process crash.
-const inmemoryPartsFlushInterval = 5 * time.Second
+//
+// It may be changed via SetFsyncPolicy.
+var inmemoryPartsFlushInterval = 5 * time.Second
+
+// Supported policies for flushing recently added rows to persistent storage.
+const (
+	// FsyncPolicyInterval flushes recently added rows to persistent storage every inmemoryPartsFlushInterval.
+	FsyncPolicyInterval = "interval"
+
+	// FsyncPolicyAlways flushes the added rows to persistent storage before returning from Storage.AddRows.
+	//
+	// Concurrent Storage.AddRows calls share a single flush.
+	FsyncPolicyAlways = "always"
+
+	// FsyncPolicyNever doesn't flush recently added rows to persistent storage until they are merged with other parts
+	// or until the storage is closed.
+	FsyncPolicyNever = "never"
+)
+
+var fsyncPolicy = FsyncPolicyInterval
+
+// SetFsyncPolicy sets the policy for flushing recently added rows to persistent storage.
+//
+// The interval is used only for FsyncPolicyInterval. It is rounded to seconds.
+//
+// This function may be called only before Storage initialization.
+func SetFsyncPolicy(policy string, interval time.Duration) error {
+	if err := CheckFsyncPolicy(policy, interval); err != nil {
+		return err
+	}
+	if policy == FsyncPolicyInterval {
+		inmemoryPartsFlushInterval = interval
+	}
+	fsyncPolicy = policy
+	return nil
+}
+
+// CheckFsyncPolicy checks whether the given policy and interval may be passed to SetFsyncPolicy.
+func CheckFsyncPolicy(policy string, interval time.Duration) error {
+	switch policy {
+	case FsyncPolicyInterval:
+		if interval < time.Second {
+			return fmt.Errorf("fsync interval cannot be smaller than 1s; got %s", interval)
+		}
+	case FsyncPolicyAlways, FsyncPolicyNever:
+	default:
+		return fmt.Errorf("unsupported fsync policy %q; supported values: %s, %s, %s", policy, FsyncPolicyInterval, FsyncPolicyAlways, FsyncPolicyNever)
+	}
+	return nil
+}
 
 // partition represents a partition.
 type partition struct {
@@ -138,6 +188,10 @@ type partition struct {
 	// Used for deleting data outside the retention during background merge.
 	retentionMsecs int64
 
+	// isReadOnly points to Storage.isReadOnly. Background merges are paused while it is set,
+	// since they need additional disk space for the resulting parts.
+	isReadOnly *uint32
+
 	// Name is the name of the partition in the form YYYY_MM.
 	name string
 
@@ -147,6 +201,11 @@ type partition struct {
 	// partsLock protects smallParts and bigParts.
 	partsLock sync.Mutex
 
+	// partsMergedCond is signaled when parts are released after the merge.
+	//
+	// flushPendingRows waits on it until inmemory parts merged by background mergers are written to persistent storage.
+	partsMergedCond *sync.Cond
+
 	// Contains all the inmemoryPart plus file-based parts
 	// with small number of items (up to maxRowsCountPerSmallPart).
 	smallParts []*partWrapper
@@ -159,6 +218,11 @@ type partition struct {
 	// rawRows aren't used in search for performance reasons.
 	rawRows rawRowsShards
 
+	// rawRowsConvertLock is read-locked while rows taken from rawRows are converted into an inmemory part.
+	//
+	// flushPendingRows write-locks it in order to wait until all the taken rows are registered in smallParts.
+	rawRowsConvertLock sync.RWMutex
+
 	snapshotLock sync.RWMutex
 
 	stopCh chan struct{}
@@ -211,7 +275,7 @@ func (pw *partWrapper) decRef() {
 
 // createPartition creates new partition for the given timestamp and the given paths
 // to small and big partitions.
-func createPartition(timestamp int64, smallPartitionsPath, bigPartitionsPath string, getDeletedMetricIDs func() *uint64set.Set, retentionMsecs int64) (*partition, error) {
+func createPartition(timestamp int64, smallPartitionsPath, bigPartitionsPath string, getDeletedMetricIDs func() *uint64set.Set, retentionMsecs int64, isReadOnly *uint32) (*partition, error) {
 	name := timestampToPartitionName(timestamp)
 	smallPartsPath := filepath.Clean(smallPartitionsPath) + "/" + name
 	bigPartsPath := filepath.Clean(bigPartitionsPath) + "/" + name
@@ -224,7 +288,7 @@ func createPartition(timestamp int64, smallPartitionsPath, bigPartitionsPath str
 		return nil, fmt.Errorf("cannot create directories for big parts %q: %w", bigPartsPath, err)
 	}
 
-	pt := newPartition(name, smallPartsPath, bigPartsPath, getDeletedMetricIDs, retentionMsecs)
+	pt := newPartition(name, smallPartsPath, bigPartsPath, getDeletedMetricIDs, retentionMsecs, isReadOnly)
 	pt.tr.fromPartitionTimestamp(timestamp)
 	pt.startMergeWorkers()
 	pt.startRawRowsFlusher()
@@ -249,7 +313,7 @@ func (pt *partition) Drop() {
 }
 
 // openPartition opens the existing partition from the given paths.
-func openPartition(smallPartsPath, bigPartsPath string, getDeletedMetricIDs func() *uint64set.Set, retentionMsecs int64) (*partition, error) {
+func openPartition(smallPartsPath, bigPartsPath string, getDeletedMetricIDs func() *uint64set.Set, retentionMsecs int64, isReadOnly *uint32) (*partition, error) {
 	smallPartsPath = filepath.Clean(smallPartsPath)
 	bigPartsPath = filepath.Clean(bigPartsPath)
 
@@ -273,7 +337,7 @@ func openPartition(smallPartsPath, bigPartsPath string, getDeletedMetricIDs func
 		return nil, fmt.Errorf("cannot open big parts from %q: %w", bigPartsPath, err)
 	}
 
-	pt := newPartition(name, smallPartsPath, bigPartsPath, getDeletedMetricIDs, retentionMsecs)
+	pt := newPartition(name, smallPartsPath, bigPartsPath, getDeletedMetricIDs, retentionMsecs, isReadOnly)
 	pt.smallParts = smallParts
 	pt.bigParts = bigParts
 	if err := pt.tr.fromPartitionName(name); err != nil {
@@ -287,18 +351,20 @@ func openPartition(smallPartsPath, bigPartsPath string, getDeletedMetricIDs func
 	return pt, nil
 }
 
-func newPartition(name, smallPartsPath, bigPartsPath string, getDeletedMetricIDs func() *uint64set.Set, retentionMsecs int64) *partition {
+func newPartition(name, smallPartsPath, bigPartsPath string, getDeletedMetricIDs func() *uint64set.Set, retentionMsecs int64, isReadOnly *uint32) *partition {
 	p := &partition{
 		name:           name,
 		smallPartsPath: smallPartsPath,
 		bigPartsPath:   bigPartsPath,
 
 		getDeletedMetricIDs: getDeletedMetricIDs,
+		isReadOnly:          isReadOnly,
 		retentionMsecs:      retentionMsecs,
 
 		mergeIdx: uint64(time.Now().UnixNano()),
 		stopCh:   make(chan struct{}),
 	}
+	p.partsMergedCond = sync.NewCond(&p.partsLock)
 	p.rawRows.init()
 	return p
 }
@@ -506,12 +572,19 @@ func (rrs *rawRowsShard) addRows(pt *partition, rows []rawRow) {
 		rrss = append(rrss, rr)
 		rrs.lastFlushTime = fasttime.UnixTimestamp()
 	}
+	if len(rrss) > 0 {
+		pt.rawRowsConvertLock.RLock()
+	}
 	rrs.lock.Unlock()
 
+	if len(rrss) == 0 {
+		return
+	}
 	for _, rr := range rrss {
 		pt.addRowsPart(rr.rows)
 		putRawRows(rr)
 	}
+	pt.rawRowsConvertLock.RUnlock()
 }
 
 type rawRows struct {
@@ -770,12 +843,14 @@ func (rrs *rawRowsShard) flush(pt *partition, isFinal bool) {
 	if isFinal || currentTime-rrs.lastFlushTime > uint64(flushSeconds) {
 		rr = getRawRowsMaxSize()
 		rrs.rows, rr.rows = rr.rows, rrs.rows
+		pt.rawRowsConvertLock.RLock()
 	}
 	rrs.lock.Unlock()
 
 	if rr != nil {
 		pt.addRowsPart(rr.rows)
 		putRawRows(rr)
+		pt.rawRowsConvertLock.RUnlock()
 	}
 }
 
@@ -797,6 +872,10 @@ func (pt *partition) inmemoryPartsFlusher() {
 		case <-pt.stopCh:
 			return
 		case <-ticker.C:
+			if fsyncPolicy == FsyncPolicyNever {
+				// Inmemory parts are flushed to persistent storage during merges and on pt.MustClose.
+				continue
+			}
 			pwsBuf, err = pt.flushInmemoryParts(pwsBuf[:0], false)
 			if err != nil {
 				logger.Panicf("FATAL: cannot flush inmemory parts: %s", err)
@@ -831,6 +910,56 @@ func (pt *partition) flushInmemoryParts(dstPws []*partWrapper, force bool) ([]*p
 	return dstPws, nil
 }
 
+// flushPendingRows synchronously flushes all the rows added to pt to persistent storage.
+//
+// It is used for -fsyncPolicy=always.
+func (pt *partition) flushPendingRows() error {
+	pt.flushRawRows(true)
+
+	// Wait until rows taken from rawRows by concurrent goroutines are converted into inmemory parts.
+	pt.rawRowsConvertLock.Lock()
+	pt.rawRowsConvertLock.Unlock()
+
+	pt.partsLock.Lock()
+	pwsPending := make(map[*partWrapper]bool)
+	for _, pw := range pt.smallParts {
+		if pw.mp != nil {
+			pwsPending[pw] = true
+		}
+	}
+	for {
+		// Flush pending inmemory parts, which aren't merged at the moment, and wait until
+		// the remaining parts, which are merged by background mergers, are written to persistent storage.
+		var pwsToFlush []*partWrapper
+		hasMerges := false
+		for _, pw := range pt.smallParts {
+			if !pwsPending[pw] {
+				continue
+			}
+			if pw.isInMerge {
+				hasMerges = true
+				continue
+			}
+			pw.isInMerge = true
+			pwsToFlush = append(pwsToFlush, pw)
+		}
+		if len(pwsToFlush) > 0 {
+			pt.partsLock.Unlock()
+			if err := pt.mergePartsOptimal(pwsToFlush, nil); err != nil {
+				return fmt.Errorf("cannot flush %d inmemory parts: %w", len(pwsToFlush), err)
+			}
+			pt.partsLock.Lock()
+			continue
+		}
+		if !hasMerges {
+			break
+		}
+		pt.partsMergedCond.Wait()
+	}
+	pt.partsLock.Unlock()
+	return nil
+}
+
 func (pt *partition) mergePartsOptimal(pws []*partWrapper, stopCh <-chan struct{}) error {
 	defer func() {
 		// Remove isInMerge flag from pws.
@@ -840,6 +969,7 @@ func (pt *partition) mergePartsOptimal(pws []*partWrapper, stopCh <-chan struct{
 			// since it may be set to false in mergeParts below.
 			pw.isInMerge = false
 		}
+		pt.partsMergedCond.Broadcast()
 		pt.partsLock.Unlock()
 	}()
 	for len(pws) > defaultPartsToMerge {
@@ -889,6 +1019,15 @@ func appendAllPartsToMerge(dst, src []*partWrapper) []*partWrapper {
 	return dst
 }
 
+func hasInmemoryParts(pws []*partWrapper) bool {
+	for _, pw := range pws {
+		if pw.mp != nil {
+			return true
+		}
+	}
+	return false
+}
+
 func hasActiveMerges(pws []*partWrapper) bool {
 	for _, pw := range pws {
 		if pw.isInMerge {
@@ -957,6 +1096,9 @@ func (pt *partition) smallPartsMerger() {
 const (
 	minMergeSleepTime = 10 * time.Millisecond
 	maxMergeSleepTime = 10 * time.Second
+
+	// readOnlyMergeCheckInterval is the interval for checking whether merges may be resumed after leaving read-only mode.
+	readOnlyMergeCheckInterval = time.Second
 )
 
 func (pt *partition) partsMerger(mergerFunc func(isFinal bool) error) error {
@@ -965,6 +1107,17 @@ func (pt *partition) partsMerger(mergerFunc func(isFinal bool) error) error {
 	isFinal := false
 	t := time.NewTimer(sleepTime)
 	for {
+		if atomic.LoadUint32(pt.isReadOnly) != 0 {
+			// Pause merges while the storage is in read-only mode because of low free disk space.
+			// They are resumed when the free disk space is recovered.
+			select {
+			case <-pt.stopCh:
+				return nil
+			case <-t.C:
+				t.Reset(readOnlyMergeCheckInterval)
+			}
+			continue
+		}
 		err := mergerFunc(isFinal)
 		if err == nil {
 			// Try merging additional parts.
@@ -1016,6 +1169,125 @@ func SetFinalMergeDelay(delay time.Duration) {
 	finalMergeDelaySeconds = uint64(delay.Seconds() + 1)
 }
 
+// mergeRateLimiter limits the bandwidth for background merges of parts stored on disk.
+//
+// It doesn't limit the bandwidth until SetMergeBandwidthLimit is called with positive value.
+var mergeRateLimiter = ratelimiter.New(0)
+
+// SetMergeBandwidthLimit sets the maximum bandwidth in bytes per second for background merges of parts stored on disk.
+//
+// The limit is shared among all the partitions. It applies to all the merges of parts stored on disk,
+// including final merges and merges started via ForceMergePartitions. Merges for in-memory parts aren't limited,
+// since this may slow down data ingestion. Indexdb merges aren't limited too.
+//
+// This function may be called at any time. Zero or negative bytesPerSecond disables the limit.
+func SetMergeBandwidthLimit(bytesPerSecond int64) {
+	mergeRateLimiter.SetPerSecondLimit(bytesPerSecond)
+}
+
+// timeWindow is a daily time window in UTC.
+type timeWindow struct {
+	// start and end are offsets in minutes since the beginning of the day.
+	//
+	// end may be smaller than start if the window crosses midnight.
+	start int
+	end   int
+}
+
+// parseTimeWindow parses time window in the format `HH:MM-HH:MM`.
+func parseTimeWindow(s string) (timeWindow, error) {
+	n := strings.IndexByte(s, '-')
+	if n < 0 {
+		return timeWindow{}, fmt.Errorf("missing '-' in time window %q; expecting `HH:MM-HH:MM` format", s)
+	}
+	start, err := parseDayMinutes(s[:n])
+	if err != nil {
+		return timeWindow{}, fmt.Errorf("cannot parse start of time window %q: %w", s, err)
+	}
+	end, err := parseDayMinutes(s[n+1:])
+	if err != nil {
+		return timeWindow{}, fmt.Errorf("cannot parse end of time window %q: %w", s, err)
+	}
+	if start == end {
+		return timeWindow{}, fmt.Errorf("time window %q cannot be empty", s)
+	}
+	return timeWindow{
+		start: start,
+		end:   end,
+	}, nil
+}
+
+func parseDayMinutes(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("cannot parse %q as `HH:MM`: %w", s, err)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// contains returns true if t is inside tw.
+func (tw *timeWindow) contains(t time.Time) bool {
+	t = t.UTC()
+	minutes := t.Hour()*60 + t.Minute()
+	if tw.start < tw.end {
+		return minutes >= tw.start && minutes < tw.end
+	}
+	// The window crosses midnight.
+	return minutes >= tw.start || minutes < tw.end
+}
+
+// bigMergeWindows contains time windows when big merges are allowed.
+//
+// Big merges are allowed at any time if it is empty.
+var bigMergeWindows []timeWindow
+
+// SetBigMergeWindows sets daily time windows in UTC when background merges for big parts are allowed.
+//
+// Every window must have `HH:MM-HH:MM` format. Big merges are allowed at any time if windows is empty.
+//
+// The windows apply to background merges, which produce big parts, including merges of small parts into a big part.
+// They don't apply to merges started via ForceMergePartitions and to indexdb merges.
+//
+// This function may be called only before Storage initialization.
+func SetBigMergeWindows(windows []string) error {
+	tws, err := parseTimeWindows(windows)
+	if err != nil {
+		return err
+	}
+	bigMergeWindows = tws
+	return nil
+}
+
+// CheckBigMergeWindows checks whether the given windows may be passed to SetBigMergeWindows.
+func CheckBigMergeWindows(windows []string) error {
+	_, err := parseTimeWindows(windows)
+	return err
+}
+
+func parseTimeWindows(windows []string) ([]timeWindow, error) {
+	tws := make([]timeWindow, 0, len(windows))
+	for _, s := range windows {
+		tw, err := parseTimeWindow(s)
+		if err != nil {
+			return nil, err
+		}
+		tws = append(tws, tw)
+	}
+	return tws, nil
+}
+
+func isBigMergeAllowed(t time.Time) bool {
+	if len(bigMergeWindows) == 0 {
+		return true
+	}
+	for i := range bigMergeWindows {
+		if bigMergeWindows[i].contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
 func maxRowsByPath(path string) uint64 {
 	freeSpace := fs.MustGetFreeSpace(path)
 
@@ -1032,6 +1304,10 @@ func maxRowsByPath(path string) uint64 {
 }
 
 func (pt *partition) mergeBigParts(isFinal bool) error {
+	if !isBigMergeAllowed(time.Now()) {
+		// Postpone big merges until the next window from -bigMergeWindow.
+		return errNothingToMerge
+	}
 	maxRows := maxRowsByPath(pt.bigPartsPath)
 
 	pt.partsLock.Lock()
@@ -1051,13 +1327,19 @@ func (pt *partition) mergeSmallParts(isFinal bool) error {
 	atomicSetBool(&pt.bigMergeNeedFreeDiskSpace, needFreeSpace)
 
 	rowsCount := getRowsCount(pws)
-	if rowsCount > maxRowsPerSmallPart() {
+	bigMergeAllowed := isBigMergeAllowed(time.Now())
+	if rowsCount > maxRowsPerSmallPart() && bigMergeAllowed {
 		// Merge small parts to a big part.
 		return pt.mergeParts(pws, pt.stopCh)
 	}
 
 	// Make sure that the output small part fits small parts storage.
 	maxSmallPartRows := maxRowsByPath(pt.smallPartsPath)
+	if !bigMergeAllowed && maxSmallPartRows > maxRowsPerSmallPart() {
+		// Merges to big parts are postponed until the next window from -bigMergeWindow,
+		// so the output part must remain small.
+		maxSmallPartRows = maxRowsPerSmallPart()
+	}
 	if rowsCount <= maxSmallPartRows {
 		// Merge small parts to a small part.
 		return pt.mergeParts(pws, pt.stopCh)
@@ -1081,6 +1363,7 @@ func (pt *partition) releasePartsToMerge(pws []*partWrapper) {
 		}
 		pw.isInMerge = false
 	}
+	pt.partsMergedCond.Broadcast()
 	pt.partsLock.Unlock()
 }
 
@@ -1165,7 +1448,11 @@ func (pt *partition) mergeParts(pws []*partWrapper, stopCh <-chan struct{}) erro
 		atomic.AddUint64(&pt.activeSmallMerges, 1)
 	}
 	retentionDeadline := timestampFromTime(startTime) - pt.retentionMsecs
-	err := mergeBlockStreams(&ph, bsw, bsrs, stopCh, dmis, retentionDeadline, rowsMerged, rowsDeleted)
+	var rl *ratelimiter.RateLimiter
+	if !hasInmemoryParts(pws) {
+		rl = mergeRateLimiter
+	}
+	err := mergeBlockStreams(&ph, bsw, bsrs, stopCh, rl, dmis, retentionDeadline, rowsMerged, rowsDeleted)
 	if isBigPart {
 		atomic.AddUint64(&pt.activeBigMerges, ^uint64(0))
 	} else {
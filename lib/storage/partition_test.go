@@ -2,10 +2,73 @@ package storage
 
 import (
 	"math/rand"
+	"os"
 	"reflect"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
+func TestParseTimeWindowSuccess(t *testing.T) {
+	f := func(s string, twExpected timeWindow) {
+		t.Helper()
+		tw, err := parseTimeWindow(s)
+		if err != nil {
+			t.Fatalf("unexpected error when parsing %q: %s", s, err)
+		}
+		if tw != twExpected {
+			t.Fatalf("unexpected time window for %q; got %+v; want %+v", s, tw, twExpected)
+		}
+	}
+	f("00:00-06:30", timeWindow{start: 0, end: 6*60 + 30})
+	f("22:00-06:00", timeWindow{start: 22 * 60, end: 6 * 60})
+	f(" 12:15 - 13:45 ", timeWindow{start: 12*60 + 15, end: 13*60 + 45})
+}
+
+func TestParseTimeWindowFailure(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+		if _, err := parseTimeWindow(s); err == nil {
+			t.Fatalf("expecting non-nil error when parsing %q", s)
+		}
+	}
+	f("")
+	f("foobar")
+	f("12:00")
+	f("12:00-")
+	f("25:00-06:00")
+	f("12:00-12:60")
+	f("12:00-12:00")
+}
+
+func TestTimeWindowContains(t *testing.T) {
+	f := func(s, hhmm string, resultExpected bool) {
+		t.Helper()
+		tw, err := parseTimeWindow(s)
+		if err != nil {
+			t.Fatalf("unexpected error when parsing %q: %s", s, err)
+		}
+		ts, err := time.Parse("15:04", hhmm)
+		if err != nil {
+			t.Fatalf("cannot parse %q: %s", hhmm, err)
+		}
+		result := tw.contains(ts)
+		if result != resultExpected {
+			t.Fatalf("unexpected result for %q at %s; got %v; want %v", s, hhmm, result, resultExpected)
+		}
+	}
+	f("01:00-06:00", "00:59", false)
+	f("01:00-06:00", "01:00", true)
+	f("01:00-06:00", "05:59", true)
+	f("01:00-06:00", "06:00", false)
+	f("22:00-06:00", "21:59", false)
+	f("22:00-06:00", "22:00", true)
+	f("22:00-06:00", "23:59", true)
+	f("22:00-06:00", "00:00", true)
+	f("22:00-06:00", "05:59", true)
+	f("22:00-06:00", "06:00", false)
+}
+
 func TestPartitionMaxRowsByPath(t *testing.T) {
 	n := maxRowsByPath(".")
 	if n < 1e3 {
@@ -158,3 +221,128 @@ func newTestPartWrappersForRowsCount(rowsCount []uint64) []*partWrapper {
 	}
 	return pws
 }
+
+func TestPartitionPartsMergerReadOnly(t *testing.T) {
+	isReadOnly := uint32(1)
+	pt := &partition{
+		isReadOnly: &isReadOnly,
+		stopCh:     make(chan struct{}),
+	}
+	var mergerCalls uint64
+	doneCh := make(chan error, 1)
+	go func() {
+		doneCh <- pt.partsMerger(func(isFinal bool) error {
+			atomic.AddUint64(&mergerCalls, 1)
+			return errNothingToMerge
+		})
+	}()
+
+	// Merges must be paused in read-only mode.
+	time.Sleep(100 * time.Millisecond)
+	if n := atomic.LoadUint64(&mergerCalls); n != 0 {
+		t.Fatalf("unexpected merges in read-only mode; got %d merge calls", n)
+	}
+
+	// Merges must be resumed after leaving read-only mode.
+	atomic.StoreUint32(&isReadOnly, 0)
+	deadline := time.Now().Add(5 * readOnlyMergeCheckInterval)
+	for atomic.LoadUint64(&mergerCalls) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("merges weren't resumed after leaving read-only mode")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	close(pt.stopCh)
+	if err := <-doneCh; err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+}
+
+func TestPartitionFlushPendingRows(t *testing.T) {
+	const path = "TestPartitionFlushPendingRows"
+	defer func() {
+		_ = os.RemoveAll(path)
+	}()
+
+	// Pause background merges, so they do not interfere with the test.
+	isReadOnly := uint32(1)
+	timestamp := timestampFromTime(time.Now())
+	pt, err := createPartition(timestamp, path+"/small", path+"/big", nilGetDeletedMetricIDs, 31*msecsPerMonth, &isReadOnly)
+	if err != nil {
+		t.Fatalf("cannot create partition: %s", err)
+	}
+	defer pt.MustClose()
+
+	addRows := func(rowsCount int) {
+		t.Helper()
+		rows := make([]rawRow, rowsCount)
+		for i := range rows {
+			r := &rows[i]
+			r.TSID.MetricID = uint64(i)
+			r.Timestamp = timestamp
+			r.Value = float64(i)
+			r.PrecisionBits = defaultPrecisionBits
+		}
+		pt.AddRows(rows)
+	}
+	inmemoryPartsCount := func() int {
+		pt.partsLock.Lock()
+		defer pt.partsLock.Unlock()
+		n := 0
+		for _, pw := range pt.smallParts {
+			if pw.mp != nil {
+				n++
+			}
+		}
+		return n
+	}
+
+	// Pending rows must be flushed to persistent storage.
+	addRows(10)
+	if err := pt.flushPendingRows(); err != nil {
+		t.Fatalf("cannot flush pending rows: %s", err)
+	}
+	if n := inmemoryPartsCount(); n != 0 {
+		t.Fatalf("unexpected number of inmemory parts after the flush; got %d; want 0", n)
+	}
+
+	// flushPendingRows must wait until inmemory parts merged in background are written to persistent storage.
+	addRows(10)
+	pt.flushRawRows(true)
+	pt.partsLock.Lock()
+	var pwsInMerge []*partWrapper
+	for _, pw := range pt.smallParts {
+		if pw.mp != nil {
+			pw.isInMerge = true
+			pwsInMerge = append(pwsInMerge, pw)
+		}
+	}
+	pt.partsLock.Unlock()
+	if len(pwsInMerge) != 1 {
+		t.Fatalf("unexpected number of inmemory parts; got %d; want 1", len(pwsInMerge))
+	}
+	doneCh := make(chan error, 1)
+	go func() {
+		doneCh <- pt.flushPendingRows()
+	}()
+	select {
+	case err := <-doneCh:
+		t.Fatalf("flushPendingRows must wait until the merge is finished; err: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if err := pt.mergeParts(pwsInMerge, nil); err != nil {
+		t.Fatalf("cannot merge inmemory part: %s", err)
+	}
+	select {
+	case err := <-doneCh:
+		if err != nil {
+			t.Fatalf("cannot flush pending rows: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timeout when waiting for flushPendingRows")
+	}
+	if n := inmemoryPartsCount(); n != 0 {
+		t.Fatalf("unexpected number of inmemory parts after the flush; got %d; want 0", n)
+	}
+}
@@ -3,6 +3,7 @@ package storage
 import (
 	"fmt"
 	"io"
+	"sync/atomic"
 
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
@@ -77,6 +78,18 @@ func (br *BlockRef) MustReadBlock(dst *Block, fetchData bool) {
 	br.p.valuesFile.MustReadAt(dst.valuesData, int64(br.bh.ValuesBlockOffset))
 }
 
+// RowsCount returns the number of rows in the block referred by br.
+func (br *BlockRef) RowsCount() int {
+	return int(br.bh.RowsCount)
+}
+
+// SizeBytes returns the size of the block referred by br on disk.
+//
+// The size includes compressed timestamps, compressed values and block header.
+func (br *BlockRef) SizeBytes() uint64 {
+	return uint64(br.bh.TimestampsBlockSize) + uint64(br.bh.ValuesBlockSize) + uint64(marshaledBlockHeaderSize)
+}
+
 // MetricBlockRef contains reference to time series block for a single metric.
 type MetricBlockRef struct {
 	// The metric name
@@ -104,6 +117,9 @@ type Search struct {
 	// deadline in unix timestamp seconds for the current search.
 	deadline uint64
 
+	// cancelCh is closed when the current search must be canceled.
+	cancelCh <-chan struct{}
+
 	err error
 
 	needClosing bool
@@ -120,6 +136,7 @@ func (s *Search) reset() {
 	s.tr = TimeRange{}
 	s.tfss = nil
 	s.deadline = 0
+	s.cancelCh = nil
 	s.err = nil
 	s.needClosing = false
 	s.loops = 0
@@ -129,8 +146,10 @@ func (s *Search) reset() {
 //
 // MustClose must be called when the search is done.
 //
+// The search is canceled with ErrSearchCanceled error when cancelCh is closed. cancelCh may be nil.
+//
 // Init returns the upper bound on the number of found time series.
-func (s *Search) Init(storage *Storage, tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64) int {
+func (s *Search) Init(storage *Storage, tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64, cancelCh <-chan struct{}) int {
 	if s.needClosing {
 		logger.Panicf("BUG: missing MustClose call before the next call to Init")
 	}
@@ -139,11 +158,12 @@ func (s *Search) Init(storage *Storage, tfss []*TagFilters, tr TimeRange, maxMet
 	s.tr = tr
 	s.tfss = tfss
 	s.deadline = deadline
+	s.cancelCh = cancelCh
 	s.needClosing = true
 
-	tsids, err := storage.searchTSIDs(tfss, tr, maxMetrics, deadline)
+	tsids, err := storage.searchTSIDs(tfss, tr, maxMetrics, deadline, cancelCh)
 	if err == nil {
-		err = storage.prefetchMetricNames(tsids, deadline)
+		err = storage.prefetchMetricNames(tsids, deadline, cancelCh)
 	}
 	// It is ok to call Init on error from storage.searchTSIDs.
 	// Init must be called before returning because it will fail
@@ -183,7 +203,7 @@ func (s *Search) NextMetricBlock() bool {
 	}
 	for s.ts.NextBlock() {
 		if s.loops&paceLimiterSlowIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(s.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(s.deadline, s.cancelCh); err != nil {
 				s.err = err
 				return false
 			}
@@ -382,10 +402,16 @@ func (sq *SearchQuery) Unmarshal(src []byte) ([]byte, error) {
 	return src, nil
 }
 
-func checkSearchDeadlineAndPace(deadline uint64) error {
+func checkSearchDeadlineAndPace(deadline uint64, cancelCh <-chan struct{}) error {
 	if fasttime.UnixTimestamp() > deadline {
 		return ErrDeadlineExceeded
 	}
+	select {
+	case <-cancelCh:
+		atomic.AddUint64(&searchCanceled, 1)
+		return ErrSearchCanceled
+	default:
+	}
 	storagepacelimiter.Search.WaitIfNeeded()
 	return nil
 }
@@ -202,7 +202,7 @@ func testSearchInternal(st *Storage, tr TimeRange, mrs []MetricRow, accountsCoun
 		}
 
 		// Search
-		s.Init(st, []*TagFilters{tfs}, tr, 1e5, noDeadline)
+		s.Init(st, []*TagFilters{tfs}, tr, 1e5, noDeadline, nil)
 		var mbs []metricBlock
 		for s.NextMetricBlock() {
 			var b Block
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -44,6 +45,8 @@ type Storage struct {
 	addRowsConcurrencyLimitTimeout uint64
 	addRowsConcurrencyDroppedRows  uint64
 
+	readOnlyRejectedRows uint64
+
 	searchTSIDsConcurrencyLimitReached uint64
 	searchTSIDsConcurrencyLimitTimeout uint64
 
@@ -102,6 +105,11 @@ type Storage struct {
 	currHourMetricIDsUpdaterWG sync.WaitGroup
 	nextDayMetricIDsUpdaterWG  sync.WaitGroup
 	retentionWatcherWG         sync.WaitGroup
+	freeDiskSpaceWatcherWG     sync.WaitGroup
+
+	// isReadOnly is set to 1 when the storage has less than the free disk space limit.
+	// See SetFreeDiskSpaceLimit.
+	isReadOnly uint32
 
 	// The snapshotLock prevents from concurrent creation of snapshots,
 	// since this may result in snapshots without recently added data,
@@ -111,6 +119,52 @@ type Storage struct {
 
 	// The minimum timestamp when composite index search can be used.
 	minTimestampForCompositeIndex int64
+
+	// indexDBRotationHooks are called after every indexdb rotation.
+	// See AddIndexDBRotationHook.
+	indexDBRotationHooksLock sync.Mutex
+	indexDBRotationHooks     []func()
+
+	// syncLock protects the fields below, which are used by syncAddedRows for sharing a single flush
+	// among concurrent AddRows calls when -fsyncPolicy=always.
+	syncLock       sync.Mutex
+	syncCond       *sync.Cond
+	syncRequests   uint64
+	syncedRequests uint64
+	syncInProgress bool
+}
+
+// syncAddedRows flushes the rows added to s before the call to persistent storage.
+//
+// Concurrent callers are grouped, so a single flush covers the rows for all of them (aka group commit).
+// This amortizes disk IO and fsync calls across concurrent AddRows calls.
+func (s *Storage) syncAddedRows() {
+	s.syncLock.Lock()
+	s.syncRequests++
+	n := s.syncRequests
+	for s.syncedRequests < n {
+		if s.syncInProgress {
+			s.syncCond.Wait()
+			continue
+		}
+		// Flush the rows for all the callers registered so far.
+		// Callers registered after this point are covered by the next flush.
+		s.syncInProgress = true
+		syncRequests := s.syncRequests
+		s.syncLock.Unlock()
+
+		if err := s.tb.flushPendingRows(); err != nil {
+			logger.Panicf("FATAL: cannot flush added rows to persistent storage: %s", err)
+		}
+		// Flush the registered index entries, so the added rows remain searchable after unclean shutdown.
+		s.idb().tb.FlushPendingItems()
+
+		s.syncLock.Lock()
+		s.syncInProgress = false
+		s.syncedRequests = syncRequests
+		s.syncCond.Broadcast()
+	}
+	s.syncLock.Unlock()
 }
 
 // OpenStorage opens storage on the given path with the given retentionMsecs.
@@ -132,6 +186,7 @@ func OpenStorage(path string, retentionMsecs int64) (*Storage, error) {
 
 		stop: make(chan struct{}),
 	}
+	s.syncCond = sync.NewCond(&s.syncLock)
 	if err := fs.MkdirAllIfNotExist(path); err != nil {
 		return nil, fmt.Errorf("cannot create a directory for the storage at %q: %w", path, err)
 	}
@@ -184,16 +239,20 @@ func OpenStorage(path string, retentionMsecs int64) (*Storage, error) {
 	if err := fs.MkdirAllIfNotExist(idbSnapshotsPath); err != nil {
 		return nil, fmt.Errorf("cannot create %q: %w", idbSnapshotsPath, err)
 	}
-	idbCurr, idbPrev, err := openIndexDBTables(idbPath, s.metricIDCache, s.metricNameCache, s.tsidCache, s.minTimestampForCompositeIndex)
+	s.mustLoadTagFiltersKeyGen()
+	idbCurr, idbPrev, err := openIndexDBTables(idbPath, s.cachePath+"/indexdb", s.metricIDCache, s.metricNameCache, s.tsidCache, s.minTimestampForCompositeIndex)
 	if err != nil {
 		return nil, fmt.Errorf("cannot open indexdb tables at %q: %w", idbPath, err)
 	}
 	idbCurr.SetExtDB(idbPrev)
 	s.idbCurr.Store(idbCurr)
 
+	// Determine read-only mode before opening the table, so background merges aren't started on a disk with low free space.
+	s.updateReadOnlyMode()
+
 	// Load data
 	tablePath := path + "/data"
-	tb, err := openTable(tablePath, s.getDeletedMetricIDs, retentionMsecs)
+	tb, err := openTable(tablePath, s.getDeletedMetricIDs, retentionMsecs, &s.isReadOnly)
 	if err != nil {
 		s.idb().MustClose()
 		return nil, fmt.Errorf("cannot open table at %q: %w", tablePath, err)
@@ -203,6 +262,7 @@ func OpenStorage(path string, retentionMsecs int64) (*Storage, error) {
 	s.startCurrHourMetricIDsUpdater()
 	s.startNextDayMetricIDsUpdater()
 	s.startRetentionWatcher()
+	s.startFreeDiskSpaceWatcher()
 
 	return s, nil
 }
@@ -350,12 +410,19 @@ type Metrics struct {
 	AddRowsConcurrencyCapacity     uint64
 	AddRowsConcurrencyCurrent      uint64
 
+	IsReadOnly           uint64
+	ReadOnlyRejectedRows uint64
+
 	SearchTSIDsConcurrencyLimitReached uint64
 	SearchTSIDsConcurrencyLimitTimeout uint64
 	SearchTSIDsConcurrencyCapacity     uint64
 	SearchTSIDsConcurrencyCurrent      uint64
 
-	SearchDelays uint64
+	SearchDelays   uint64
+	SearchCanceled uint64
+
+	MergeBandwidthLimitReached uint64
+	BigMergesPaused            uint64
 
 	SlowRowInserts         uint64
 	SlowPerDayIndexInserts uint64
@@ -419,12 +486,23 @@ func (s *Storage) UpdateMetrics(m *Metrics) {
 	m.AddRowsConcurrencyCapacity = uint64(cap(addRowsConcurrencyCh))
 	m.AddRowsConcurrencyCurrent = uint64(len(addRowsConcurrencyCh))
 
+	if s.IsReadOnly() {
+		m.IsReadOnly = 1
+	}
+	m.ReadOnlyRejectedRows += atomic.LoadUint64(&s.readOnlyRejectedRows)
+
 	m.SearchTSIDsConcurrencyLimitReached += atomic.LoadUint64(&s.searchTSIDsConcurrencyLimitReached)
 	m.SearchTSIDsConcurrencyLimitTimeout += atomic.LoadUint64(&s.searchTSIDsConcurrencyLimitTimeout)
 	m.SearchTSIDsConcurrencyCapacity = uint64(cap(searchTSIDsConcurrencyCh))
 	m.SearchTSIDsConcurrencyCurrent = uint64(len(searchTSIDsConcurrencyCh))
 
 	m.SearchDelays = storagepacelimiter.Search.DelaysTotal()
+	m.SearchCanceled = atomic.LoadUint64(&searchCanceled)
+
+	m.MergeBandwidthLimitReached = mergeRateLimiter.LimitReached()
+	if !isBigMergeAllowed(time.Now()) {
+		m.BigMergesPaused = 1
+	}
 
 	m.SlowRowInserts += atomic.LoadUint64(&s.slowRowInserts)
 	m.SlowPerDayIndexInserts += atomic.LoadUint64(&s.slowPerDayIndexInserts)
@@ -484,6 +562,72 @@ func (s *Storage) UpdateMetrics(m *Metrics) {
 	s.tb.UpdateMetrics(&m.TableMetrics)
 }
 
+// SetFreeDiskSpaceLimit sets the minimum free disk space for the storage.
+//
+// The storage switches to read-only mode when the free disk space at its path becomes lower than the limit.
+// It automatically switches back to read-write mode when the free disk space becomes bigger than the limit.
+//
+// The limit is disabled if bytes is zero.
+func SetFreeDiskSpaceLimit(bytes int64) {
+	atomic.StoreUint64(&freeDiskSpaceLimitBytes, uint64(bytes))
+}
+
+var freeDiskSpaceLimitBytes uint64
+
+// ErrReadOnly is returned when adding rows to the storage in read-only mode.
+//
+// See SetFreeDiskSpaceLimit.
+var ErrReadOnly = errors.New("the storage is in read-only mode because of low free disk space; see -storage.minFreeDiskSpaceBytes command-line flag")
+
+// IsReadOnly returns true if the storage is in read-only mode.
+func (s *Storage) IsReadOnly() bool {
+	return atomic.LoadUint32(&s.isReadOnly) == 1
+}
+
+func (s *Storage) startFreeDiskSpaceWatcher() {
+	s.updateReadOnlyMode()
+	s.freeDiskSpaceWatcherWG.Add(1)
+	go func() {
+		s.freeDiskSpaceWatcher()
+		s.freeDiskSpaceWatcherWG.Done()
+	}()
+}
+
+func (s *Storage) freeDiskSpaceWatcher() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-ticker.C:
+			s.updateReadOnlyMode()
+		}
+	}
+}
+
+func (s *Storage) updateReadOnlyMode() {
+	limit := atomic.LoadUint64(&freeDiskSpaceLimitBytes)
+	if limit == 0 {
+		if atomic.CompareAndSwapUint32(&s.isReadOnly, 1, 0) {
+			logger.Infof("switching the storage at %q to read-write mode, since free disk space limit is disabled", s.path)
+		}
+		return
+	}
+	freeSpace := fs.MustGetFreeSpace(s.path)
+	if freeSpace < limit {
+		if atomic.CompareAndSwapUint32(&s.isReadOnly, 0, 1) {
+			logger.Warnf("switching the storage at %q to read-only mode, since it has less than -storage.minFreeDiskSpaceBytes=%d of free space: %d bytes left",
+				s.path, limit, freeSpace)
+		}
+		return
+	}
+	if atomic.CompareAndSwapUint32(&s.isReadOnly, 1, 0) {
+		logger.Infof("switching the storage at %q to read-write mode, since it has more than -storage.minFreeDiskSpaceBytes=%d of free space: %d bytes",
+			s.path, limit, freeSpace)
+	}
+}
+
 func (s *Storage) startRetentionWatcher() {
 	s.retentionWatcherWG.Add(1)
 	go func() {
@@ -556,7 +700,7 @@ func (s *Storage) mustRotateIndexDB() {
 	// Create new indexdb table.
 	newTableName := nextIndexDBTableName()
 	idbNewPath := s.path + "/indexdb/" + newTableName
-	idbNew, err := openIndexDB(idbNewPath, s.metricIDCache, s.metricNameCache, s.tsidCache, s.minTimestampForCompositeIndex)
+	idbNew, err := openIndexDB(idbNewPath, s.cachePath+"/indexdb/"+newTableName, s.metricIDCache, s.metricNameCache, s.tsidCache, s.minTimestampForCompositeIndex)
 	if err != nil {
 		logger.Panicf("FATAL: cannot create new indexDB at %q: %s", idbNewPath, err)
 	}
@@ -585,6 +729,27 @@ func (s *Storage) mustRotateIndexDB() {
 	// from prev idb remain valid after the rotation.
 
 	// There is no need in resetting nextDayMetricIDs, since it should be automatically reset every day.
+
+	s.runIndexDBRotationHooks()
+}
+
+// AddIndexDBRotationHook registers f to be called after every indexdb rotation.
+//
+// This allows invalidating caches outside the storage, which depend on indexdb contents.
+// For instance, caches for label names or label values.
+func (s *Storage) AddIndexDBRotationHook(f func()) {
+	s.indexDBRotationHooksLock.Lock()
+	s.indexDBRotationHooks = append(s.indexDBRotationHooks, f)
+	s.indexDBRotationHooksLock.Unlock()
+}
+
+func (s *Storage) runIndexDBRotationHooks() {
+	s.indexDBRotationHooksLock.Lock()
+	hooks := append([]func(){}, s.indexDBRotationHooks...)
+	s.indexDBRotationHooksLock.Unlock()
+	for _, f := range hooks {
+		f()
+	}
 }
 
 // MustClose closes the storage.
@@ -594,6 +759,7 @@ func (s *Storage) MustClose() {
 	close(s.stop)
 
 	s.retentionWatcherWG.Wait()
+	s.freeDiskSpaceWatcherWG.Wait()
 	s.currHourMetricIDsUpdaterWG.Wait()
 	s.nextDayMetricIDsUpdaterWG.Wait()
 
@@ -601,6 +767,7 @@ func (s *Storage) MustClose() {
 	s.idb().MustClose()
 
 	// Save caches.
+	s.mustSaveTagFiltersKeyGen()
 	s.mustSaveAndStopCache(s.tsidCache, "MetricName->TSID", "metricName_tsid")
 	s.mustSaveAndStopCache(s.metricIDCache, "MetricID->TSID", "metricID_tsid")
 	s.mustSaveAndStopCache(s.metricNameCache, "MetricID->MetricName", "metricID_metricName")
@@ -818,6 +985,46 @@ func loadMinTimestampForCompositeIndex(path string) (int64, error) {
 	return encoding.UnmarshalInt64(data), nil
 }
 
+// mustLoadTagFiltersKeyGen restores tagFiltersKeyGen saved by mustSaveTagFiltersKeyGen,
+// so tagCache entries persisted for indexdb tables remain valid after the restart.
+//
+// Persisted indexdb caches are dropped if the previous shutdown wasn't graceful,
+// since tagCache entries may be stale in this case.
+func (s *Storage) mustLoadTagFiltersKeyGen() {
+	path := s.cachePath + "/tag_filters_key_gen"
+	idbCachePath := s.cachePath + "/indexdb"
+	if !fs.IsPathExist(path) {
+		if fs.IsPathExist(idbCachePath) {
+			logger.Infof("dropping indexdb caches at %q, since the previous shutdown wasn't graceful", idbCachePath)
+			fs.MustRemoveAll(idbCachePath)
+		}
+		return
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		logger.Panicf("FATAL: cannot read %q: %s", path, err)
+	}
+	// Remove the file, so the persisted indexdb caches are dropped on the next start after unclean shutdown.
+	fs.MustRemoveAll(path)
+	if len(data) != 8 {
+		logger.Errorf("discarding %q, since it has unexpected size; got %d bytes; want 8 bytes", path, len(data))
+		fs.MustRemoveAll(idbCachePath)
+		return
+	}
+	restoreTagFiltersKeyGen(encoding.UnmarshalUint64(data))
+}
+
+// mustSaveTagFiltersKeyGen saves tagFiltersKeyGen, so it could be restored by mustLoadTagFiltersKeyGen.
+//
+// It must be called after all the indexdb tables are closed.
+func (s *Storage) mustSaveTagFiltersKeyGen() {
+	path := s.cachePath + "/tag_filters_key_gen"
+	data := encoding.MarshalUint64(nil, atomic.LoadUint64(&tagFiltersKeyGen))
+	if err := fs.WriteFileAtomically(path, data); err != nil {
+		logger.Panicf("FATAL: cannot write %d bytes to %q: %s", len(data), path, err)
+	}
+}
+
 func (s *Storage) mustLoadCache(info, name string, sizeBytes int) *workingsetcache.Cache {
 	path := s.cachePath + "/" + name
 	logger.Infof("loading %s cache from %q...", info, path)
@@ -857,16 +1064,19 @@ func nextRetentionDuration(retentionMsecs int64) time.Duration {
 }
 
 // SearchMetricNames returns metric names matching the given tfss on the given tr.
-func (s *Storage) SearchMetricNames(tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64) ([]MetricName, error) {
-	tsids, err := s.searchTSIDs(tfss, tr, maxMetrics, deadline)
+//
+// The search is canceled with ErrSearchCanceled error when cancelCh is closed. cancelCh may be nil.
+func (s *Storage) SearchMetricNames(tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64, cancelCh <-chan struct{}) ([]MetricName, error) {
+	tsids, err := s.searchTSIDs(tfss, tr, maxMetrics, deadline, cancelCh)
 	if err != nil {
 		return nil, err
 	}
-	if err = s.prefetchMetricNames(tsids, deadline); err != nil {
+	if err = s.prefetchMetricNames(tsids, deadline, cancelCh); err != nil {
 		return nil, err
 	}
 	idb := s.idb()
 	is := idb.getIndexSearch(deadline)
+	is.cancelCh = cancelCh
 	defer idb.putIndexSearch(is)
 	mns := make([]MetricName, 0, len(tsids))
 	var metricName []byte
@@ -892,7 +1102,7 @@ func (s *Storage) SearchMetricNames(tfss []*TagFilters, tr TimeRange, maxMetrics
 }
 
 // searchTSIDs returns sorted TSIDs for the given tfss and the given tr.
-func (s *Storage) searchTSIDs(tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64) ([]TSID, error) {
+func (s *Storage) searchTSIDs(tfss []*TagFilters, tr TimeRange, maxMetrics int, deadline uint64, cancelCh <-chan struct{}) ([]TSID, error) {
 	// Do not cache tfss -> tsids here, since the caching is performed
 	// on idb level.
 
@@ -914,6 +1124,10 @@ func (s *Storage) searchTSIDs(tfss []*TagFilters, tr TimeRange, maxMetrics int,
 		select {
 		case searchTSIDsConcurrencyCh <- struct{}{}:
 			timerpool.Put(t)
+		case <-cancelCh:
+			timerpool.Put(t)
+			atomic.AddUint64(&searchCanceled, 1)
+			return nil, ErrSearchCanceled
 		case <-t.C:
 			timerpool.Put(t)
 			atomic.AddUint64(&s.searchTSIDsConcurrencyLimitTimeout, 1)
@@ -921,7 +1135,7 @@ func (s *Storage) searchTSIDs(tfss []*TagFilters, tr TimeRange, maxMetrics int,
 				cap(searchTSIDsConcurrencyCh), timeout.Seconds())
 		}
 	}
-	tsids, err := s.idb().searchTSIDs(tfss, tr, maxMetrics, deadline)
+	tsids, err := s.idb().searchTSIDs(tfss, tr, maxMetrics, deadline, cancelCh)
 	<-searchTSIDsConcurrencyCh
 	if err != nil {
 		return nil, fmt.Errorf("error when searching tsids: %w", err)
@@ -939,7 +1153,7 @@ var (
 // prefetchMetricNames pre-fetches metric names for the given tsids into metricID->metricName cache.
 //
 // This should speed-up further searchMetricName calls for metricIDs from tsids.
-func (s *Storage) prefetchMetricNames(tsids []TSID, deadline uint64) error {
+func (s *Storage) prefetchMetricNames(tsids []TSID, deadline uint64, cancelCh <-chan struct{}) error {
 	if len(tsids) == 0 {
 		return nil
 	}
@@ -965,10 +1179,11 @@ func (s *Storage) prefetchMetricNames(tsids []TSID, deadline uint64) error {
 	var err error
 	idb := s.idb()
 	is := idb.getIndexSearch(deadline)
+	is.cancelCh = cancelCh
 	defer idb.putIndexSearch(is)
 	for loops, metricID := range metricIDs {
 		if loops&paceLimiterSlowIterationsMask == 0 {
-			if err := checkSearchDeadlineAndPace(is.deadline); err != nil {
+			if err := checkSearchDeadlineAndPace(is.deadline, is.cancelCh); err != nil {
 				return err
 			}
 		}
@@ -993,6 +1208,12 @@ func (s *Storage) prefetchMetricNames(tsids []TSID, deadline uint64) error {
 // ErrDeadlineExceeded is returned when the request times out.
 var ErrDeadlineExceeded = fmt.Errorf("deadline exceeded")
 
+// ErrSearchCanceled is returned when the search is canceled, e.g. when the client closes the connection.
+var ErrSearchCanceled = fmt.Errorf("search canceled")
+
+// searchCanceled is the number of searches canceled via cancelCh.
+var searchCanceled uint64
+
 // DeleteMetrics deletes all the metrics matching the given tfss.
 //
 // Returns the number of metrics deleted.
@@ -1286,17 +1507,51 @@ func (mr *MetricRow) Unmarshal(src []byte) ([]byte, error) {
 // ForceMergePartitions force-merges partitions in s with names starting from the given partitionNamePrefix.
 //
 // Partitions are merged sequentially in order to reduce load on the system.
+//
+// ErrReadOnly is returned if the storage is in read-only mode, since merges need additional disk space.
 func (s *Storage) ForceMergePartitions(partitionNamePrefix string) error {
+	if s.IsReadOnly() {
+		return ErrReadOnly
+	}
 	return s.tb.ForceMergePartitions(partitionNamePrefix)
 }
 
+// ListPartitions returns information about active and detached per-month partitions in s.
+func (s *Storage) ListPartitions() ([]PartitionInfo, error) {
+	return s.tb.ListPartitions()
+}
+
+// DetachPartition detaches per-month partition with the given name in the form YYYY_MM from s.
+//
+// The partition data is moved to `<-storageDataPath>/data/detached/YYYY_MM` directory.
+func (s *Storage) DetachPartition(name string) error {
+	return s.tb.DetachPartition(name)
+}
+
+// AttachPartition attaches per-month partition with the given name in the form YYYY_MM,
+// which has been previously detached via DetachPartition.
+func (s *Storage) AttachPartition(name string) error {
+	return s.tb.AttachPartition(name)
+}
+
+// DetachedPartitionsPath returns path to the directory with detached partitions.
+func (s *Storage) DetachedPartitionsPath() string {
+	return s.tb.detachedPath
+}
+
 var rowsAddedTotal uint64
 
 // AddRows adds the given mrs to s.
+//
+// ErrReadOnly is returned if the storage is in read-only mode.
 func (s *Storage) AddRows(mrs []MetricRow, precisionBits uint8) error {
 	if len(mrs) == 0 {
 		return nil
 	}
+	if s.IsReadOnly() {
+		atomic.AddUint64(&s.readOnlyRejectedRows, uint64(len(mrs)))
+		return ErrReadOnly
+	}
 
 	// Limit the number of concurrent goroutines that may add rows to the storage.
 	// This should prevent from out of memory errors and CPU trashing when too many
@@ -1333,6 +1588,11 @@ func (s *Storage) AddRows(mrs []MetricRow, precisionBits uint8) error {
 
 	<-addRowsConcurrencyCh
 
+	if fsyncPolicy == FsyncPolicyAlways {
+		// Wait outside addRowsConcurrencyCh, so concurrent callers may add their rows to the same flush.
+		s.syncAddedRows()
+	}
+
 	atomic.AddUint64(&rowsAddedTotal, uint64(len(mrs)))
 	return err
 }
@@ -1349,7 +1609,12 @@ var (
 //
 // The the MetricRow.Timestamp is used for registering the metric name starting from the given timestamp.
 // Th MetricRow.Value field is ignored.
+//
+// ErrReadOnly is returned if the storage is in read-only mode.
 func (s *Storage) RegisterMetricNames(mrs []MetricRow) error {
+	if s.IsReadOnly() {
+		return ErrReadOnly
+	}
 	var (
 		tsid       TSID
 		mn         MetricName
@@ -2007,7 +2272,7 @@ func (s *Storage) putTSIDToCache(tsid *TSID, metricName []byte) {
 	s.tsidCache.Set(metricName, buf)
 }
 
-func openIndexDBTables(path string, metricIDCache, metricNameCache, tsidCache *workingsetcache.Cache, minTimestampForCompositeIndex int64) (curr, prev *indexDB, err error) {
+func openIndexDBTables(path, cachePath string, metricIDCache, metricNameCache, tsidCache *workingsetcache.Cache, minTimestampForCompositeIndex int64) (curr, prev *indexDB, err error) {
 	if err := fs.MkdirAllIfNotExist(path); err != nil {
 		return nil, nil, fmt.Errorf("cannot create directory %q: %w", path, err)
 	}
@@ -2066,12 +2331,13 @@ func openIndexDBTables(path string, metricIDCache, metricNameCache, tsidCache *w
 	// Open the last two tables.
 	currPath := path + "/" + tableNames[len(tableNames)-1]
 
-	curr, err = openIndexDB(currPath, metricIDCache, metricNameCache, tsidCache, minTimestampForCompositeIndex)
+	mustRemoveObsoleteIndexDBCaches(cachePath, tableNames[len(tableNames)-2:])
+	curr, err = openIndexDB(currPath, cachePath+"/"+tableNames[len(tableNames)-1], metricIDCache, metricNameCache, tsidCache, minTimestampForCompositeIndex)
 	if err != nil {
 		return nil, nil, fmt.Errorf("cannot open curr indexdb table at %q: %w", currPath, err)
 	}
 	prevPath := path + "/" + tableNames[len(tableNames)-2]
-	prev, err = openIndexDB(prevPath, metricIDCache, metricNameCache, tsidCache, minTimestampForCompositeIndex)
+	prev, err = openIndexDB(prevPath, cachePath+"/"+tableNames[len(tableNames)-2], metricIDCache, metricNameCache, tsidCache, minTimestampForCompositeIndex)
 	if err != nil {
 		curr.MustClose()
 		return nil, nil, fmt.Errorf("cannot open prev indexdb table at %q: %w", prevPath, err)
@@ -2080,6 +2346,30 @@ func openIndexDBTables(path string, metricIDCache, metricNameCache, tsidCache *w
 	return curr, prev, nil
 }
 
+// mustRemoveObsoleteIndexDBCaches removes persisted caches for indexdb tables missing in tableNames.
+func mustRemoveObsoleteIndexDBCaches(cachePath string, tableNames []string) {
+	if !fs.IsPathExist(cachePath) {
+		return
+	}
+	fis, err := ioutil.ReadDir(cachePath)
+	if err != nil {
+		logger.Panicf("FATAL: cannot read indexdb caches dir %q: %s", cachePath, err)
+	}
+	for _, fi := range fis {
+		name := fi.Name()
+		isObsolete := true
+		for _, tn := range tableNames {
+			if name == tn {
+				isObsolete = false
+				break
+			}
+		}
+		if isObsolete {
+			fs.MustRemoveAll(cachePath + "/" + name)
+		}
+	}
+}
+
 var indexDBTableNameRegexp = regexp.MustCompile("^[0-9A-F]{16}$")
 
 func nextIndexDBTableName() string {
@@ -1,16 +1,22 @@
 package storage
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"math/rand"
 	"os"
 	"reflect"
 	"sort"
 	"strings"
+	"sync"
 	"testing"
 	"testing/quick"
 	"time"
 
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
 	"github.com/VictoriaMetrics/VictoriaMetrics/lib/uint64set"
 )
 
@@ -359,6 +365,55 @@ func TestStorageOpenClose(t *testing.T) {
 	}
 }
 
+func TestStoragePersistIndexDBCaches(t *testing.T) {
+	path := "TestStoragePersistIndexDBCaches"
+	s, err := OpenStorage(path, -1)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	idbName := s.idb().name
+	s.MustClose()
+
+	genPath := path + "/cache/tag_filters_key_gen"
+	if !fs.IsPathExist(genPath) {
+		t.Fatalf("missing %q after graceful shutdown", genPath)
+	}
+	tagCachePath := path + "/cache/indexdb/" + idbName + "/tagFilters"
+	if !fs.IsPathExist(tagCachePath) {
+		t.Fatalf("missing %q after graceful shutdown", tagCachePath)
+	}
+
+	// The persisted indexdb caches must be re-used after graceful shutdown.
+	s, err = OpenStorage(path, -1)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	if fs.IsPathExist(genPath) {
+		t.Fatalf("%q must be removed after the start", genPath)
+	}
+	if !fs.IsPathExist(tagCachePath) {
+		t.Fatalf("%q must be re-used after graceful shutdown", tagCachePath)
+	}
+	s.MustClose()
+
+	// The persisted indexdb caches must be dropped after unclean shutdown.
+	if err := os.Remove(genPath); err != nil {
+		t.Fatalf("cannot remove %q: %s", genPath, err)
+	}
+	s, err = OpenStorage(path, -1)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	if fs.IsPathExist(tagCachePath) {
+		t.Fatalf("%q must be dropped after unclean shutdown", tagCachePath)
+	}
+	s.MustClose()
+
+	if err := os.RemoveAll(path); err != nil {
+		t.Fatalf("cannot remove %q: %s", path, err)
+	}
+}
+
 func TestStorageOpenMultipleTimes(t *testing.T) {
 	path := "TestStorageOpenMultipleTimes"
 	s1, err := OpenStorage(path, -1)
@@ -613,7 +668,7 @@ func testStorageDeleteMetrics(s *Storage, workerNum int) error {
 	metricBlocksCount := func(tfs *TagFilters) int {
 		// Verify the number of blocks
 		n := 0
-		sr.Init(s, []*TagFilters{tfs}, tr, 1e5, noDeadline)
+		sr.Init(s, []*TagFilters{tfs}, tr, 1e5, noDeadline, nil)
 		for sr.NextMetricBlock() {
 			n++
 		}
@@ -832,7 +887,7 @@ func testStorageRegisterMetricNames(s *Storage) error {
 	if err := tfs.Add([]byte("add_id"), []byte("0"), false, false); err != nil {
 		return fmt.Errorf("unexpected error in TagFilters.Add: %w", err)
 	}
-	mns, err := s.SearchMetricNames([]*TagFilters{tfs}, tr, metricsPerAdd*addsCount*100+100, noDeadline)
+	mns, err := s.SearchMetricNames([]*TagFilters{tfs}, tr, metricsPerAdd*addsCount*100+100, noDeadline, nil)
 	if err != nil {
 		return fmt.Errorf("error in SearchMetricNames: %w", err)
 	}
@@ -853,6 +908,59 @@ func testStorageRegisterMetricNames(s *Storage) error {
 	return nil
 }
 
+func TestStorageReadOnly(t *testing.T) {
+	path := "TestStorageReadOnly"
+	s, err := OpenStorage(path, -1)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	defer SetFreeDiskSpaceLimit(0)
+
+	var mn MetricName
+	mn.MetricGroup = []byte("foo")
+	mrs := []MetricRow{{
+		MetricNameRaw: mn.marshalRaw(nil),
+		Timestamp:     time.Now().UnixNano() / 1e6,
+		Value:         123,
+	}}
+
+	// Switch to read-only mode, since free disk space cannot exceed the limit.
+	SetFreeDiskSpaceLimit(1 << 62)
+	s.updateReadOnlyMode()
+	if !s.IsReadOnly() {
+		t.Fatalf("expecting read-only storage")
+	}
+	if err := s.AddRows(mrs, defaultPrecisionBits); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("unexpected error when adding rows to read-only storage; got %v; want %v", err, ErrReadOnly)
+	}
+	if err := s.RegisterMetricNames(mrs); !errors.Is(err, ErrReadOnly) {
+		t.Fatalf("unexpected error when registering metric names in read-only storage; got %v; want %v", err, ErrReadOnly)
+	}
+	var m Metrics
+	s.UpdateMetrics(&m)
+	if m.IsReadOnly != 1 {
+		t.Fatalf("unexpected IsReadOnly; got %d; want 1", m.IsReadOnly)
+	}
+	if m.ReadOnlyRejectedRows != uint64(len(mrs)) {
+		t.Fatalf("unexpected ReadOnlyRejectedRows; got %d; want %d", m.ReadOnlyRejectedRows, len(mrs))
+	}
+
+	// Switch back to read-write mode after the limit is disabled.
+	SetFreeDiskSpaceLimit(0)
+	s.updateReadOnlyMode()
+	if s.IsReadOnly() {
+		t.Fatalf("expecting read-write storage")
+	}
+	if err := s.AddRows(mrs, defaultPrecisionBits); err != nil {
+		t.Fatalf("unexpected error when adding rows: %s", err)
+	}
+
+	s.MustClose()
+	if err := os.RemoveAll(path); err != nil {
+		t.Fatalf("cannot remove %q: %s", path, err)
+	}
+}
+
 func TestStorageAddRowsSerial(t *testing.T) {
 	path := "TestStorageAddRowsSerial"
 	s, err := OpenStorage(path, 0)
@@ -1045,6 +1153,27 @@ func TestStorageRotateIndexDB(t *testing.T) {
 	}
 }
 
+func TestStorageIndexDBRotationHooks(t *testing.T) {
+	path := "TestStorageIndexDBRotationHooks"
+	s, err := OpenStorage(path, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	var calls1, calls2 int
+	s.AddIndexDBRotationHook(func() { calls1++ })
+	s.AddIndexDBRotationHook(func() { calls2++ })
+	for i := 0; i < 3; i++ {
+		s.mustRotateIndexDB()
+	}
+	if calls1 != 3 || calls2 != 3 {
+		t.Fatalf("unexpected number of hook calls; got %d and %d; want 3 and 3", calls1, calls2)
+	}
+	s.MustClose()
+	if err := os.RemoveAll(path); err != nil {
+		t.Fatalf("cannot remove %q: %s", path, err)
+	}
+}
+
 func testStorageAddMetrics(s *Storage, workerNum int) error {
 	const rowsCount = 1e3
 
@@ -1087,3 +1216,372 @@ func containsString(a []string, s string) bool {
 	}
 	return false
 }
+
+func TestSetFsyncPolicy(t *testing.T) {
+	defer func() {
+		if err := SetFsyncPolicy(FsyncPolicyInterval, 5*time.Second); err != nil {
+			t.Fatalf("cannot restore fsync policy: %s", err)
+		}
+	}()
+	f := func(policy string, interval time.Duration, resultExpected bool) {
+		t.Helper()
+		err := SetFsyncPolicy(policy, interval)
+		if result := err == nil; result != resultExpected {
+			t.Fatalf("unexpected result for SetFsyncPolicy(%q, %s); got %v; want %v; err: %v", policy, interval, result, resultExpected, err)
+		}
+	}
+	f("", time.Second, false)
+	f("foobar", time.Second, false)
+	f(FsyncPolicyInterval, 0, false)
+	f(FsyncPolicyInterval, 100*time.Millisecond, false)
+	f(FsyncPolicyInterval, time.Second, true)
+	f(FsyncPolicyAlways, 0, true)
+	f(FsyncPolicyNever, 0, true)
+
+	// CheckFsyncPolicy mustn't change the current policy.
+	if err := CheckFsyncPolicy(FsyncPolicyAlways, 0); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if fsyncPolicy != FsyncPolicyNever {
+		t.Fatalf("unexpected fsync policy after CheckFsyncPolicy; got %q; want %q", fsyncPolicy, FsyncPolicyNever)
+	}
+	if err := CheckFsyncPolicy("foobar", 0); err == nil {
+		t.Fatalf("expecting non-nil error for unsupported fsync policy")
+	}
+}
+
+func TestCheckBigMergeWindows(t *testing.T) {
+	if err := CheckBigMergeWindows([]string{"01:00-05:00", "22:00-23:30"}); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(bigMergeWindows) != 0 {
+		t.Fatalf("CheckBigMergeWindows mustn't change big merge windows; got %d windows", len(bigMergeWindows))
+	}
+	if err := CheckBigMergeWindows([]string{"01:00-05:00", "foobar"}); err == nil {
+		t.Fatalf("expecting non-nil error for invalid window")
+	}
+}
+
+func TestStorageFsyncPolicyCrashRecovery(t *testing.T) {
+	defer func() {
+		if err := SetFsyncPolicy(FsyncPolicyInterval, 5*time.Second); err != nil {
+			t.Fatalf("cannot restore fsync policy: %s", err)
+		}
+	}()
+	const rowsCount = 1000
+	f := func(policy string, rowsExpectedAfterCrash uint64) {
+		t.Helper()
+		if err := SetFsyncPolicy(policy, 0); err != nil {
+			t.Fatalf("cannot set fsync policy: %s", err)
+		}
+		path := "TestStorageFsyncPolicyCrashRecovery"
+		crashPath := path + "-crash"
+		defer func() {
+			_ = os.RemoveAll(path)
+			_ = os.RemoveAll(crashPath)
+		}()
+		s, err := OpenStorage(path, 0)
+		if err != nil {
+			t.Fatalf("cannot open storage: %s", err)
+		}
+		mrs := make([]MetricRow, rowsCount)
+		var mn MetricName
+		timestamp := int64(fasttime.UnixTimestamp()) * 1000
+		for i := range mrs {
+			mn.MetricGroup = []byte(fmt.Sprintf("metric_%d", i))
+			mrs[i] = MetricRow{
+				MetricNameRaw: mn.marshalRaw(nil),
+				Timestamp:     timestamp - int64(i),
+				Value:         float64(i),
+			}
+		}
+		// Add rows from concurrent goroutines, so they share flushes with -fsyncPolicy=always.
+		const workers = 10
+		var wg sync.WaitGroup
+		errCh := make(chan error, workers)
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func(mrs []MetricRow) {
+				defer wg.Done()
+				for len(mrs) > 0 {
+					n := 10
+					if n > len(mrs) {
+						n = len(mrs)
+					}
+					if err := s.AddRows(mrs[:n], defaultPrecisionBits); err != nil {
+						errCh <- err
+						return
+					}
+					mrs = mrs[n:]
+				}
+			}(mrs[i*rowsCount/workers : (i+1)*rowsCount/workers])
+		}
+		wg.Wait()
+		close(errCh)
+		for err := range errCh {
+			t.Fatalf("cannot add rows: %s", err)
+		}
+
+		// Simulate unclean shutdown by copying the persisted data without closing the storage.
+		if err := createCrashCopy(s, crashPath); err != nil {
+			t.Fatalf("cannot copy storage directory: %s", err)
+		}
+		s.MustClose()
+
+		checkRows := func(path string, rowsExpected uint64) {
+			t.Helper()
+			s, err := OpenStorage(path, 0)
+			if err != nil {
+				t.Fatalf("cannot open storage at %q: %s", path, err)
+			}
+			defer s.MustClose()
+			var m Metrics
+			s.UpdateMetrics(&m)
+			if rowsCount := m.TableMetrics.SmallRowsCount + m.TableMetrics.BigRowsCount; rowsCount != rowsExpected {
+				t.Fatalf("unexpected number of rows at %q for -fsyncPolicy=%q; got %d; want %d", path, policy, rowsCount, rowsExpected)
+			}
+			if rowsExpected == 0 {
+				return
+			}
+			tfs := NewTagFilters()
+			if err := tfs.Add(nil, []byte("metric_.+"), false, true); err != nil {
+				t.Fatalf("cannot add tag filter: %s", err)
+			}
+			tr := TimeRange{
+				MinTimestamp: timestamp - rowsCount,
+				MaxTimestamp: timestamp,
+			}
+			mns, err := s.SearchMetricNames([]*TagFilters{tfs}, tr, 1e5, noDeadline, nil)
+			if err != nil {
+				t.Fatalf("cannot search metric names at %q: %s", path, err)
+			}
+			if uint64(len(mns)) != rowsExpected {
+				t.Fatalf("unexpected number of metric names at %q for -fsyncPolicy=%q; got %d; want %d", path, policy, len(mns), rowsExpected)
+			}
+		}
+		checkRows(crashPath, rowsExpectedAfterCrash)
+
+		// All the rows must be persisted after graceful shutdown.
+		checkRows(path, rowsCount)
+	}
+
+	// All the rows must survive unclean shutdown
+	f(FsyncPolicyAlways, rowsCount)
+
+	// Recently added rows are lost on unclean shutdown
+	f(FsyncPolicyNever, 0)
+}
+
+// createCrashCopy copies the data persisted by s to dstDir without flushing pending rows.
+//
+// The copy is created under snapshot locks, so it isn't modified by concurrent merges.
+// Index entries are flushed before copying, since they don't affect the number of rows in the copy.
+func createCrashCopy(s *Storage, dstDir string) error {
+	ptws := s.tb.GetPartitions(nil)
+	defer s.tb.PutPartitions(ptws)
+	for _, ptw := range ptws {
+		pt := ptw.pt
+		pt.snapshotLock.Lock()
+		err := pt.createSnapshot(pt.smallPartsPath, dstDir+"/data/small/"+pt.name)
+		if err == nil {
+			err = pt.createSnapshot(pt.bigPartsPath, dstDir+"/data/big/"+pt.name)
+		}
+		pt.snapshotLock.Unlock()
+		if err != nil {
+			return fmt.Errorf("cannot copy partition %q: %w", pt.name, err)
+		}
+	}
+	idb := s.idb()
+	if err := idb.tb.CreateSnapshotAt(dstDir + "/indexdb/" + idb.name); err != nil {
+		return fmt.Errorf("cannot copy curr indexdb: %w", err)
+	}
+	var err error
+	idb.doExtDB(func(extDB *indexDB) {
+		err = extDB.tb.CreateSnapshotAt(dstDir + "/indexdb/" + extDB.name)
+	})
+	if err != nil {
+		return fmt.Errorf("cannot copy prev indexdb: %w", err)
+	}
+	return fs.CopyDirectory(s.path+"/metadata", dstDir+"/metadata")
+}
+
+func TestStorageExportImportIndexDB(t *testing.T) {
+	const metricsCount = 1000
+	srcPath := "TestStorageExportImportIndexDB-src"
+	dstPath := "TestStorageExportImportIndexDB-dst"
+	defer func() {
+		_ = os.RemoveAll(srcPath)
+		_ = os.RemoveAll(dstPath)
+	}()
+	src, err := OpenStorage(srcPath, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	mrs := make([]MetricRow, metricsCount)
+	var mn MetricName
+	timestamp := int64(fasttime.UnixTimestamp()) * 1000
+	for i := range mrs {
+		mn.MetricGroup = []byte(fmt.Sprintf("metric_%d", i))
+		mn.Tags = []Tag{
+			{
+				Key:   []byte("job"),
+				Value: []byte(fmt.Sprintf("job_%d", i%10)),
+			},
+		}
+		mrs[i] = MetricRow{
+			MetricNameRaw: mn.marshalRaw(nil),
+			Timestamp:     timestamp - int64(i),
+			Value:         float64(i),
+		}
+	}
+	if err := src.AddRows(mrs, defaultPrecisionBits); err != nil {
+		t.Fatalf("cannot add rows: %s", err)
+	}
+	src.DebugFlush()
+
+	var bb bytes.Buffer
+	exportedCount, err := src.ExportIndexDB(&bb)
+	if err != nil {
+		t.Fatalf("cannot export indexdb: %s", err)
+	}
+	if exportedCount == 0 {
+		t.Fatalf("expecting non-zero number of exported entries")
+	}
+
+	dst, err := OpenStorage(dstPath, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	importedCount, err := dst.ImportIndexDB(&bb)
+	if err != nil {
+		t.Fatalf("cannot import indexdb: %s", err)
+	}
+	if importedCount != exportedCount {
+		t.Fatalf("unexpected number of imported entries; got %d; want %d", importedCount, exportedCount)
+	}
+
+	// Verify that the imported index contains the same MetricName -> TSID mappings.
+	for i := range mrs {
+		if err := mn.unmarshalRaw(mrs[i].MetricNameRaw); err != nil {
+			t.Fatalf("cannot unmarshal metric name: %s", err)
+		}
+		mn.sortTags()
+		metricName := mn.Marshal(nil)
+		var srcTSID, dstTSID TSID
+		if err := src.idb().getTSIDByNameNoCreate(&srcTSID, metricName); err != nil {
+			t.Fatalf("cannot obtain TSID for %s in the source storage: %s", &mn, err)
+		}
+		if err := dst.idb().getTSIDByNameNoCreate(&dstTSID, metricName); err != nil {
+			t.Fatalf("cannot obtain TSID for %s in the destination storage: %s", &mn, err)
+		}
+		if srcTSID != dstTSID {
+			t.Fatalf("unexpected TSID for %s; got %+v; want %+v", &mn, &dstTSID, &srcTSID)
+		}
+	}
+
+	// Verify that the imported index can be searched.
+	tfs := NewTagFilters()
+	if err := tfs.Add([]byte("job"), []byte("job_1"), false, false); err != nil {
+		t.Fatalf("cannot add tag filter: %s", err)
+	}
+	tr := TimeRange{
+		MinTimestamp: timestamp - metricsCount,
+		MaxTimestamp: timestamp,
+	}
+	mns, err := dst.SearchMetricNames([]*TagFilters{tfs}, tr, 1e5, noDeadline, nil)
+	if err != nil {
+		t.Fatalf("cannot search metric names: %s", err)
+	}
+	if len(mns) != metricsCount/10 {
+		t.Fatalf("unexpected number of metric names found; got %d; want %d", len(mns), metricsCount/10)
+	}
+
+	// Invalid export stream must be rejected.
+	if _, err := dst.ImportIndexDB(strings.NewReader("foobar")); err == nil {
+		t.Fatalf("expecting non-nil error when importing invalid data")
+	}
+
+	// Blocks with too big decompressed size must be rejected.
+	bb.Reset()
+	bb.WriteString(indexDBExportHeader)
+	compressedBlock := encoding.CompressZSTDLevel(nil, make([]byte, 2*maxIndexDBExportBlockSize+1), 1)
+	bb.Write(encoding.MarshalVarUint64(nil, uint64(len(compressedBlock))))
+	bb.Write(compressedBlock)
+	if _, err := dst.ImportIndexDB(&bb); err == nil {
+		t.Fatalf("expecting non-nil error when importing block with too big decompressed size")
+	}
+	src.MustClose()
+	dst.MustClose()
+}
+
+func TestStorageSearchCanceled(t *testing.T) {
+	path := "TestStorageSearchCanceled"
+	s, err := OpenStorage(path, 0)
+	if err != nil {
+		t.Fatalf("cannot open storage: %s", err)
+	}
+	defer func() {
+		s.MustClose()
+		if err := os.RemoveAll(path); err != nil {
+			t.Fatalf("cannot remove %q: %s", path, err)
+		}
+	}()
+	const metricsCount = 1000
+	mrs := make([]MetricRow, metricsCount)
+	var mn MetricName
+	timestamp := int64(fasttime.UnixTimestamp()) * 1000
+	for i := range mrs {
+		mn.MetricGroup = []byte(fmt.Sprintf("metric_%d", i))
+		mrs[i] = MetricRow{
+			MetricNameRaw: mn.marshalRaw(nil),
+			Timestamp:     timestamp,
+			Value:         float64(i),
+		}
+	}
+	if err := s.AddRows(mrs, defaultPrecisionBits); err != nil {
+		t.Fatalf("cannot add rows: %s", err)
+	}
+	s.DebugFlush()
+
+	tfs := NewTagFilters()
+	if err := tfs.Add(nil, []byte("metric_.+"), false, true); err != nil {
+		t.Fatalf("cannot add tag filter: %s", err)
+	}
+	tr := TimeRange{
+		MinTimestamp: timestamp - 1000,
+		MaxTimestamp: timestamp + 1000,
+	}
+	cancelCh := make(chan struct{})
+	close(cancelCh)
+
+	// The canceled search must return ErrSearchCanceled
+	var m Metrics
+	s.UpdateMetrics(&m)
+	searchCanceledPrev := m.SearchCanceled
+	if _, err := s.SearchMetricNames([]*TagFilters{tfs}, tr, 1e5, noDeadline, cancelCh); !errors.Is(err, ErrSearchCanceled) {
+		t.Fatalf("unexpected error for canceled search; got %v; want %v", err, ErrSearchCanceled)
+	}
+	var sr Search
+	sr.Init(s, []*TagFilters{tfs}, tr, 1e5, noDeadline, cancelCh)
+	if sr.NextMetricBlock() {
+		t.Fatalf("canceled search mustn't return blocks")
+	}
+	if err := sr.Error(); !errors.Is(err, ErrSearchCanceled) {
+		t.Fatalf("unexpected error for canceled search; got %v; want %v", err, ErrSearchCanceled)
+	}
+	sr.MustClose()
+	m.Reset()
+	s.UpdateMetrics(&m)
+	if m.SearchCanceled <= searchCanceledPrev {
+		t.Fatalf("SearchCanceled metric must be increased; got %d; previous value %d", m.SearchCanceled, searchCanceledPrev)
+	}
+
+	// The search without cancellation must succeed
+	mns, err := s.SearchMetricNames([]*TagFilters{tfs}, tr, 1e5, noDeadline, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if len(mns) != metricsCount {
+		t.Fatalf("unexpected number of metric names; got %d; want %d", len(mns), metricsCount)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -17,16 +18,34 @@ import (
 
 // table represents a single table with time series data.
 type table struct {
+	// Atomic counters must be at the top of struct for proper 8-byte alignment on 32-bit archs.
+	// See https://github.com/VictoriaMetrics/VictoriaMetrics/issues/212
+
+	// detachedPartitionRows is the number of rows skipped because they belong to detached partitions.
+	detachedPartitionRows uint64
+
 	path                string
 	smallPartitionsPath string
 	bigPartitionsPath   string
+	detachedPath        string
 
 	getDeletedMetricIDs func() *uint64set.Set
 	retentionMsecs      int64
 
+	// isReadOnly points to Storage.isReadOnly.
+	isReadOnly *uint32
+
 	ptws     []*partitionWrapper
 	ptwsLock sync.Mutex
 
+	// detachedPartitions contains names for detached partitions.
+	// New partitions with these names aren't created until they are attached back.
+	// It is protected by ptwsLock.
+	detachedPartitions map[string]bool
+
+	// partitionsMgmtLock serializes DetachPartition and AttachPartition calls.
+	partitionsMgmtLock sync.Mutex
+
 	flockF *os.File
 
 	stop chan struct{}
@@ -45,6 +64,9 @@ type partitionWrapper struct {
 	mustDrop uint64
 
 	pt *partition
+
+	// closedCh is closed after pt is closed.
+	closedCh chan struct{}
 }
 
 func (ptw *partitionWrapper) incRef() {
@@ -62,6 +84,7 @@ func (ptw *partitionWrapper) decRef() {
 
 	// refCount is zero. Close the partition.
 	ptw.pt.MustClose()
+	defer close(ptw.closedCh)
 
 	if atomic.LoadUint64(&ptw.mustDrop) == 0 {
 		ptw.pt = nil
@@ -82,7 +105,7 @@ func (ptw *partitionWrapper) scheduleToDrop() {
 // The table is created if it doesn't exist.
 //
 // Data older than the retentionMsecs may be dropped at any time.
-func openTable(path string, getDeletedMetricIDs func() *uint64set.Set, retentionMsecs int64) (*table, error) {
+func openTable(path string, getDeletedMetricIDs func() *uint64set.Set, retentionMsecs int64, isReadOnly *uint32) (*table, error) {
 	path = filepath.Clean(path)
 
 	// Create a directory for the table if it doesn't exist yet.
@@ -113,9 +136,17 @@ func openTable(path string, getDeletedMetricIDs func() *uint64set.Set, retention
 	if err := fs.MkdirAllIfNotExist(bigSnapshotsPath); err != nil {
 		return nil, fmt.Errorf("cannot create %q: %w", bigSnapshotsPath, err)
 	}
+	detachedPath := path + "/detached"
+	if err := fs.MkdirAllIfNotExist(detachedPath); err != nil {
+		return nil, fmt.Errorf("cannot create directory for detached partitions %q: %w", detachedPath, err)
+	}
+	detachedPartitions := make(map[string]bool)
+	if err := populatePartitionNames(detachedPath, detachedPartitions); err != nil {
+		return nil, err
+	}
 
 	// Open partitions.
-	pts, err := openPartitions(smallPartitionsPath, bigPartitionsPath, getDeletedMetricIDs, retentionMsecs)
+	pts, err := openPartitions(smallPartitionsPath, bigPartitionsPath, getDeletedMetricIDs, retentionMsecs, isReadOnly)
 	if err != nil {
 		return nil, fmt.Errorf("cannot open partitions in the table %q: %w", path, err)
 	}
@@ -124,9 +155,13 @@ func openTable(path string, getDeletedMetricIDs func() *uint64set.Set, retention
 		path:                path,
 		smallPartitionsPath: smallPartitionsPath,
 		bigPartitionsPath:   bigPartitionsPath,
+		detachedPath:        detachedPath,
 		getDeletedMetricIDs: getDeletedMetricIDs,
+		isReadOnly:          isReadOnly,
 		retentionMsecs:      retentionMsecs,
 
+		detachedPartitions: detachedPartitions,
+
 		flockF: flockF,
 
 		stop: make(chan struct{}),
@@ -184,6 +219,7 @@ func (tb *table) addPartitionNolock(pt *partition) {
 	ptw := &partitionWrapper{
 		pt:       pt,
 		refCount: 1,
+		closedCh: make(chan struct{}),
 	}
 	tb.ptws = append(tb.ptws, ptw)
 }
@@ -224,11 +260,26 @@ func (tb *table) flushRawRows() {
 	}
 }
 
+// flushPendingRows synchronously flushes all the rows added to tb to persistent storage.
+func (tb *table) flushPendingRows() error {
+	ptws := tb.GetPartitions(nil)
+	defer tb.PutPartitions(ptws)
+
+	for _, ptw := range ptws {
+		if err := ptw.pt.flushPendingRows(); err != nil {
+			return fmt.Errorf("cannot flush pending rows for partition %q: %w", ptw.pt.name, err)
+		}
+	}
+	return nil
+}
+
 // TableMetrics contains essential metrics for the table.
 type TableMetrics struct {
 	partitionMetrics
 
 	PartitionsRefCount uint64
+
+	DetachedPartitionRows uint64
 }
 
 // UpdateMetrics updates m with metrics from tb.
@@ -238,6 +289,7 @@ func (tb *table) UpdateMetrics(m *TableMetrics) {
 		ptw.pt.UpdateMetrics(&m.partitionMetrics)
 		m.PartitionsRefCount += atomic.LoadUint64(&ptw.refCount)
 	}
+	m.DetachedPartitionRows += atomic.LoadUint64(&tb.detachedPartitionRows)
 	tb.ptwsLock.Unlock()
 }
 
@@ -261,6 +313,234 @@ func (tb *table) ForceMergePartitions(partitionNamePrefix string) error {
 	return nil
 }
 
+// PartitionInfo contains information about a per-month partition.
+type PartitionInfo struct {
+	// Name is the partition name in the form YYYY_MM.
+	Name string
+
+	// Detached is set to true if the partition is detached.
+	Detached bool
+
+	SmallSizeBytes uint64
+	BigSizeBytes   uint64
+
+	SmallRowsCount uint64
+	BigRowsCount   uint64
+
+	SmallPartsCount uint64
+	BigPartsCount   uint64
+}
+
+// ListPartitions returns information about active and detached partitions in tb sorted by name.
+//
+// Only sizes are returned for detached partitions, since they aren't opened.
+func (tb *table) ListPartitions() ([]PartitionInfo, error) {
+	ptws := tb.GetPartitions(nil)
+	defer tb.PutPartitions(ptws)
+
+	var pis []PartitionInfo
+	for _, ptw := range ptws {
+		var m partitionMetrics
+		ptw.pt.UpdateMetrics(&m)
+		pis = append(pis, PartitionInfo{
+			Name:            ptw.pt.name,
+			SmallSizeBytes:  m.SmallSizeBytes,
+			BigSizeBytes:    m.BigSizeBytes,
+			SmallRowsCount:  m.SmallRowsCount,
+			BigRowsCount:    m.BigRowsCount,
+			SmallPartsCount: m.SmallPartsCount,
+			BigPartsCount:   m.BigPartsCount,
+		})
+	}
+
+	tb.partitionsMgmtLock.Lock()
+	defer tb.partitionsMgmtLock.Unlock()
+	ptNames := make(map[string]bool)
+	if err := populatePartitionNames(tb.detachedPath, ptNames); err != nil {
+		return nil, err
+	}
+	for ptName := range ptNames {
+		ptPath := tb.detachedPath + "/" + ptName
+		smallSizeBytes, err := getDirSizeBytes(ptPath + "/small")
+		if err != nil {
+			return nil, err
+		}
+		bigSizeBytes, err := getDirSizeBytes(ptPath + "/big")
+		if err != nil {
+			return nil, err
+		}
+		pis = append(pis, PartitionInfo{
+			Name:           ptName,
+			Detached:       true,
+			SmallSizeBytes: smallSizeBytes,
+			BigSizeBytes:   bigSizeBytes,
+		})
+	}
+	sort.Slice(pis, func(i, j int) bool {
+		return pis[i].Name < pis[j].Name
+	})
+	return pis, nil
+}
+
+func getDirSizeBytes(path string) (uint64, error) {
+	n := uint64(0)
+	err := filepath.Walk(path, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if fi.Mode().IsRegular() {
+			n += uint64(fi.Size())
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("cannot determine size for %q: %w", path, err)
+	}
+	return n, nil
+}
+
+// DetachPartition detaches partition with the given name from tb.
+//
+// The partition data is moved to the `detached` directory, so it may be archived or attached back later via AttachPartition.
+// New rows for the detached partition are skipped until it is attached back.
+func (tb *table) DetachPartition(name string) error {
+	var tr TimeRange
+	if err := tr.fromPartitionName(name); err != nil {
+		return err
+	}
+	tb.partitionsMgmtLock.Lock()
+	defer tb.partitionsMgmtLock.Unlock()
+
+	tb.ptwsLock.Lock()
+	var ptw *partitionWrapper
+	for i, x := range tb.ptws {
+		if x.pt.name == name {
+			ptw = x
+			tb.ptws = append(tb.ptws[:i], tb.ptws[i+1:]...)
+			break
+		}
+	}
+	if ptw == nil {
+		tb.ptwsLock.Unlock()
+		return fmt.Errorf("cannot find partition %q", name)
+	}
+	tb.detachedPartitions[name] = true
+	tb.ptwsLock.Unlock()
+
+	logger.Infof("detaching partition %q", name)
+	startTime := time.Now()
+	smallPartsPath := ptw.pt.smallPartsPath
+	bigPartsPath := ptw.pt.bigPartsPath
+
+	// Wait until the pending searches over the partition are finished and the partition is closed.
+	ptw.decRef()
+	<-ptw.closedCh
+
+	// Wait until all the pending transaction deletions are finished before moving partition directories.
+	pendingTxnDeletionsWG.Wait()
+
+	dstPath := tb.detachedPath + "/" + name
+	if err := fs.MkdirAllFailIfExist(dstPath); err != nil {
+		return fmt.Errorf("cannot create directory for detached partition %q: %w", name, err)
+	}
+	if err := os.Rename(smallPartsPath, dstPath+"/small"); err != nil {
+		return fmt.Errorf("cannot move %q to %q: %w", smallPartsPath, dstPath+"/small", err)
+	}
+	if err := os.Rename(bigPartsPath, dstPath+"/big"); err != nil {
+		return fmt.Errorf("cannot move %q to %q: %w", bigPartsPath, dstPath+"/big", err)
+	}
+	fs.MustSyncPath(dstPath)
+	fs.MustSyncPath(tb.detachedPath)
+	fs.MustSyncPath(tb.smallPartitionsPath)
+	fs.MustSyncPath(tb.bigPartitionsPath)
+	logger.Infof("partition %q has been detached to %q in %.3f seconds", name, dstPath, time.Since(startTime).Seconds())
+	return nil
+}
+
+// AttachPartition attaches partition with the given name, which has been previously detached via DetachPartition.
+//
+// The partition must be located in the `detached` directory.
+func (tb *table) AttachPartition(name string) error {
+	var tr TimeRange
+	if err := tr.fromPartitionName(name); err != nil {
+		return err
+	}
+	minTimestamp, _ := tb.getMinMaxTimestamps()
+	if tr.MaxTimestamp < minTimestamp {
+		return fmt.Errorf("partition %q is outside the configured retention", name)
+	}
+	tb.partitionsMgmtLock.Lock()
+	defer tb.partitionsMgmtLock.Unlock()
+
+	srcPath := tb.detachedPath + "/" + name
+	if !fs.IsPathExist(srcPath) {
+		return fmt.Errorf("cannot find detached partition %q at %q", name, srcPath)
+	}
+	tb.ptwsLock.Lock()
+	for _, ptw := range tb.ptws {
+		if ptw.pt.name == name {
+			tb.ptwsLock.Unlock()
+			return fmt.Errorf("partition %q already exists", name)
+		}
+	}
+	tb.ptwsLock.Unlock()
+
+	logger.Infof("attaching partition %q from %q", name, srcPath)
+	startTime := time.Now()
+	// Certain partition directories may be missing after restoring from backup, so create them.
+	if err := fs.MkdirAllIfNotExist(srcPath + "/small"); err != nil {
+		return err
+	}
+	if err := fs.MkdirAllIfNotExist(srcPath + "/big"); err != nil {
+		return err
+	}
+	smallPartsPath := tb.smallPartitionsPath + "/" + name
+	bigPartsPath := tb.bigPartitionsPath + "/" + name
+	if err := os.Rename(srcPath+"/small", smallPartsPath); err != nil {
+		return fmt.Errorf("cannot move %q to %q: %w", srcPath+"/small", smallPartsPath, err)
+	}
+	if err := os.Rename(srcPath+"/big", bigPartsPath); err != nil {
+		// Move small parts back, so the detached partition remains consistent.
+		moveDetachedPartitionDirsBack(srcPath, smallPartsPath, "")
+		return fmt.Errorf("cannot move %q to %q: %w", srcPath+"/big", bigPartsPath, err)
+	}
+	fs.MustSyncPath(tb.smallPartitionsPath)
+	fs.MustSyncPath(tb.bigPartitionsPath)
+	pt, err := openPartition(smallPartsPath, bigPartsPath, tb.getDeletedMetricIDs, tb.retentionMsecs, tb.isReadOnly)
+	if err != nil {
+		// Move the partition back, so it could be fixed and attached again.
+		moveDetachedPartitionDirsBack(srcPath, smallPartsPath, bigPartsPath)
+		return fmt.Errorf("cannot open partition %q: %w", name, err)
+	}
+	// The partition has been successfully opened, so the remaining files from the detached partition, if any, may be removed.
+	fs.MustRemoveAll(srcPath)
+
+	tb.ptwsLock.Lock()
+	tb.addPartitionNolock(pt)
+	delete(tb.detachedPartitions, name)
+	tb.ptwsLock.Unlock()
+	logger.Infof("partition %q has been attached in %.3f seconds", name, time.Since(startTime).Seconds())
+	return nil
+}
+
+// moveDetachedPartitionDirsBack moves partition directories at smallPartsPath and bigPartsPath back to srcPath after unsuccessful attaching.
+//
+// Empty bigPartsPath is skipped.
+func moveDetachedPartitionDirsBack(srcPath, smallPartsPath, bigPartsPath string) {
+	if err := os.Rename(smallPartsPath, srcPath+"/small"); err != nil {
+		logger.Errorf("cannot move %q back to %q: %s", smallPartsPath, srcPath+"/small", err)
+	}
+	if len(bigPartsPath) > 0 {
+		if err := os.Rename(bigPartsPath, srcPath+"/big"); err != nil {
+			logger.Errorf("cannot move %q back to %q: %s", bigPartsPath, srcPath+"/big", err)
+		}
+	}
+	fs.MustSyncPath(srcPath)
+}
+
 // AddRows adds the given rows to the table tb.
 func (tb *table) AddRows(rows []rawRow) error {
 	if len(rows) == 0 {
@@ -343,6 +623,11 @@ func (tb *table) AddRows(rows []rawRow) error {
 			// Silently skip row outside retention, since it should be deleted anyway.
 			continue
 		}
+		if tb.detachedPartitions[timestampToPartitionName(r.Timestamp)] {
+			// Skip row for detached partition, since it must be attached back before accepting new rows.
+			atomic.AddUint64(&tb.detachedPartitionRows, 1)
+			continue
+		}
 
 		// Make sure the partition for the r hasn't been added by another goroutines.
 		ptFound := false
@@ -357,7 +642,7 @@ func (tb *table) AddRows(rows []rawRow) error {
 			continue
 		}
 
-		pt, err := createPartition(r.Timestamp, tb.smallPartitionsPath, tb.bigPartitionsPath, tb.getDeletedMetricIDs, tb.retentionMsecs)
+		pt, err := createPartition(r.Timestamp, tb.smallPartitionsPath, tb.bigPartitionsPath, tb.getDeletedMetricIDs, tb.retentionMsecs, tb.isReadOnly)
 		if err != nil {
 			errors = append(errors, err)
 			continue
@@ -457,7 +742,7 @@ func (tb *table) PutPartitions(ptws []*partitionWrapper) {
 	}
 }
 
-func openPartitions(smallPartitionsPath, bigPartitionsPath string, getDeletedMetricIDs func() *uint64set.Set, retentionMsecs int64) ([]*partition, error) {
+func openPartitions(smallPartitionsPath, bigPartitionsPath string, getDeletedMetricIDs func() *uint64set.Set, retentionMsecs int64, isReadOnly *uint32) ([]*partition, error) {
 	// Certain partition directories in either `big` or `small` dir may be missing
 	// after restoring from backup. So populate partition names from both dirs.
 	ptNames := make(map[string]bool)
@@ -471,7 +756,7 @@ func openPartitions(smallPartitionsPath, bigPartitionsPath string, getDeletedMet
 	for ptName := range ptNames {
 		smallPartsPath := smallPartitionsPath + "/" + ptName
 		bigPartsPath := bigPartitionsPath + "/" + ptName
-		pt, err := openPartition(smallPartsPath, bigPartsPath, getDeletedMetricIDs, retentionMsecs)
+		pt, err := openPartition(smallPartsPath, bigPartsPath, getDeletedMetricIDs, retentionMsecs, isReadOnly)
 		if err != nil {
 			mustClosePartitions(pts)
 			return nil, fmt.Errorf("cannot open partition %q: %w", ptName, err)
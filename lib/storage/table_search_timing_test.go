@@ -48,7 +48,7 @@ func openBenchTable(b *testing.B, startTimestamp int64, rowsPerInsert, rowsCount
 		createBenchTable(b, path, startTimestamp, rowsPerInsert, rowsCount, tsidsCount)
 		createdBenchTables[path] = true
 	}
-	tb, err := openTable(path, nilGetDeletedMetricIDs, maxRetentionMsecs)
+	tb, err := openTable(path, nilGetDeletedMetricIDs, maxRetentionMsecs, &isReadOnlyTest)
 	if err != nil {
 		b.Fatalf("cnanot open table %q: %s", path, err)
 	}
@@ -71,7 +71,7 @@ var createdBenchTables = make(map[string]bool)
 func createBenchTable(b *testing.B, path string, startTimestamp int64, rowsPerInsert, rowsCount, tsidsCount int) {
 	b.Helper()
 
-	tb, err := openTable(path, nilGetDeletedMetricIDs, maxRetentionMsecs)
+	tb, err := openTable(path, nilGetDeletedMetricIDs, maxRetentionMsecs, &isReadOnlyTest)
 	if err != nil {
 		b.Fatalf("cannot open table %q: %s", path, err)
 	}
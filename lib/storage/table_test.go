@@ -3,6 +3,9 @@ package storage
 import (
 	"os"
 	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fasttime"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/fs"
 )
 
 func TestTableOpenClose(t *testing.T) {
@@ -17,7 +20,7 @@ func TestTableOpenClose(t *testing.T) {
 	}()
 
 	// Create a new table
-	tb, err := openTable(path, nilGetDeletedMetricIDs, retentionMsecs)
+	tb, err := openTable(path, nilGetDeletedMetricIDs, retentionMsecs, &isReadOnlyTest)
 	if err != nil {
 		t.Fatalf("cannot create new table: %s", err)
 	}
@@ -27,7 +30,7 @@ func TestTableOpenClose(t *testing.T) {
 
 	// Re-open created table multiple times.
 	for i := 0; i < 10; i++ {
-		tb, err := openTable(path, nilGetDeletedMetricIDs, retentionMsecs)
+		tb, err := openTable(path, nilGetDeletedMetricIDs, retentionMsecs, &isReadOnlyTest)
 		if err != nil {
 			t.Fatalf("cannot open created table: %s", err)
 		}
@@ -43,17 +46,130 @@ func TestTableOpenMultipleTimes(t *testing.T) {
 		_ = os.RemoveAll(path)
 	}()
 
-	tb1, err := openTable(path, nilGetDeletedMetricIDs, retentionMsecs)
+	tb1, err := openTable(path, nilGetDeletedMetricIDs, retentionMsecs, &isReadOnlyTest)
 	if err != nil {
 		t.Fatalf("cannot open table the first time: %s", err)
 	}
 	defer tb1.MustClose()
 
 	for i := 0; i < 10; i++ {
-		tb2, err := openTable(path, nilGetDeletedMetricIDs, retentionMsecs)
+		tb2, err := openTable(path, nilGetDeletedMetricIDs, retentionMsecs, &isReadOnlyTest)
 		if err == nil {
 			tb2.MustClose()
 			t.Fatalf("expecting non-nil error when opening already opened table")
 		}
 	}
 }
+
+func TestTableDetachAttachPartition(t *testing.T) {
+	const path = "TestTableDetachAttachPartition"
+	const retentionMsecs = 123 * msecsPerMonth
+
+	defer func() {
+		_ = os.RemoveAll(path)
+	}()
+
+	tb, err := openTable(path, nilGetDeletedMetricIDs, retentionMsecs, &isReadOnlyTest)
+	if err != nil {
+		t.Fatalf("cannot open table: %s", err)
+	}
+	timestamp := int64(fasttime.UnixTimestamp()) * 1000
+	name := timestampToPartitionName(timestamp)
+	addRows := func(rowsCount int) {
+		t.Helper()
+		rows := make([]rawRow, rowsCount)
+		for i := range rows {
+			r := &rows[i]
+			r.TSID.MetricID = uint64(i)
+			r.Timestamp = timestamp
+			r.Value = float64(i)
+			r.PrecisionBits = defaultPrecisionBits
+		}
+		if err := tb.AddRows(rows); err != nil {
+			t.Fatalf("cannot add rows: %s", err)
+		}
+		tb.flushRawRows()
+	}
+	checkPartitions := func(detached bool, rowsCountExpected uint64) {
+		t.Helper()
+		pis, err := tb.ListPartitions()
+		if err != nil {
+			t.Fatalf("cannot list partitions: %s", err)
+		}
+		if len(pis) != 1 {
+			t.Fatalf("unexpected number of partitions; got %d; want 1", len(pis))
+		}
+		pi := &pis[0]
+		if pi.Name != name {
+			t.Fatalf("unexpected partition name; got %q; want %q", pi.Name, name)
+		}
+		if pi.Detached != detached {
+			t.Fatalf("unexpected detached state for partition %q; got %v; want %v", name, pi.Detached, detached)
+		}
+		if rowsCount := pi.SmallRowsCount + pi.BigRowsCount; rowsCount != rowsCountExpected {
+			t.Fatalf("unexpected rows count for partition %q; got %d; want %d", name, rowsCount, rowsCountExpected)
+		}
+		if pi.SmallSizeBytes+pi.BigSizeBytes == 0 {
+			t.Fatalf("expecting non-zero size for partition %q", name)
+		}
+	}
+
+	addRows(100)
+	checkPartitions(false, 100)
+
+	if err := tb.DetachPartition("foobar"); err == nil {
+		t.Fatalf("expecting non-nil error when detaching partition with invalid name")
+	}
+	if err := tb.AttachPartition(name); err == nil {
+		t.Fatalf("expecting non-nil error when attaching non-detached partition")
+	}
+	if err := tb.DetachPartition(name); err != nil {
+		t.Fatalf("cannot detach partition %q: %s", name, err)
+	}
+	checkPartitions(true, 0)
+	if err := tb.DetachPartition(name); err == nil {
+		t.Fatalf("expecting non-nil error when detaching already detached partition")
+	}
+
+	// Rows for the detached partition must be skipped.
+	addRows(10)
+	checkPartitions(true, 0)
+
+	// The detached partition must survive table re-opening.
+	tb.MustClose()
+	tb, err = openTable(path, nilGetDeletedMetricIDs, retentionMsecs, &isReadOnlyTest)
+	if err != nil {
+		t.Fatalf("cannot re-open table: %s", err)
+	}
+	defer tb.MustClose()
+	checkPartitions(true, 0)
+
+	// The partition must remain detached if it cannot be opened.
+	brokenPartPath := path + "/detached/" + name + "/small/broken_part"
+	if err := os.MkdirAll(brokenPartPath, 0755); err != nil {
+		t.Fatalf("cannot create broken part dir: %s", err)
+	}
+	if err := tb.AttachPartition(name); err == nil {
+		t.Fatalf("expecting non-nil error when attaching partition with broken part")
+	}
+	checkPartitions(true, 0)
+	if !fs.IsPathExist(brokenPartPath) {
+		t.Fatalf("detached partition %q must be moved back after unsuccessful attaching", name)
+	}
+	if err := os.RemoveAll(brokenPartPath); err != nil {
+		t.Fatalf("cannot remove broken part dir: %s", err)
+	}
+
+	// Empty partition directories may be missing after restoring the detached partition from backup.
+	if err := os.RemoveAll(path + "/detached/" + name + "/big"); err != nil {
+		t.Fatalf("cannot remove big parts dir for detached partition %q: %s", name, err)
+	}
+	if err := tb.AttachPartition(name); err != nil {
+		t.Fatalf("cannot attach partition %q: %s", name, err)
+	}
+	checkPartitions(false, 100)
+
+	// New rows must be accepted after the partition is attached.
+	addRows(10)
+	checkPartitions(false, 110)
+}
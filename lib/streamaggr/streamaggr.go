@@ -0,0 +1,596 @@
+package streamaggr
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/bytesutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/encoding"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/envtemplate"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/VictoriaMetrics/metricsql"
+	"github.com/valyala/histogram"
+	"gopkg.in/yaml.v2"
+)
+
+// supportedOutputs contains the list of supported outputs for stream aggregation.
+var supportedOutputs = []string{
+	"sum_samples",
+	"count_samples",
+	"count_series",
+	"min",
+	"max",
+	"avg",
+	"last",
+	"quantiles(phi1, ..., phiN)",
+}
+
+// Config is a configuration for a single stream aggregation.
+type Config struct {
+	// Match is an optional series selector for the input samples to aggregate.
+	//
+	// All the input samples are aggregated if Match is empty.
+	Match string `yaml:"match,omitempty"`
+
+	// Interval is the interval for the aggregation.
+	//
+	// The aggregated stats is sent to remote storage once per Interval.
+	Interval string `yaml:"interval"`
+
+	// Outputs is a list of output aggregate functions to produce.
+	//
+	// See supportedOutputs for the list of supported outputs.
+	Outputs []string `yaml:"outputs"`
+
+	// By is an optional list of labels for grouping input series.
+	//
+	// All the labels except of By labels and metric name are dropped from the input series before the aggregation.
+	By []string `yaml:"by,omitempty"`
+
+	// Without is an optional list of labels to drop from the input series before the aggregation.
+	//
+	// Metric name is always preserved.
+	Without []string `yaml:"without,omitempty"`
+}
+
+// PushFunc must push tss to remote storage.
+//
+// tss cannot be used after PushFunc returns, so the func must make a copy of tss if needed.
+type PushFunc func(tss []prompbmarshal.TimeSeries)
+
+// Aggregators aggregates input samples according to the given configs.
+type Aggregators struct {
+	as []*aggregator
+}
+
+// LoadFromFile loads Aggregators from the given path and uses the given pushFunc for pushing the aggregated data.
+//
+// MustStop must be called on the returned Aggregators when they are no longer needed.
+func LoadFromFile(path string, pushFunc PushFunc) (*Aggregators, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read stream aggregation config from %q: %w", path, err)
+	}
+	data = envtemplate.Replace(data)
+	as, err := NewAggregatorsFromData(data, pushFunc)
+	if err != nil {
+		return nil, fmt.Errorf("cannot initialize stream aggregators from %q: %w", path, err)
+	}
+	return as, nil
+}
+
+// NewAggregatorsFromData initializes Aggregators from the given YAML data and uses the given pushFunc for pushing the aggregated data.
+//
+// MustStop must be called on the returned Aggregators when they are no longer needed.
+func NewAggregatorsFromData(data []byte, pushFunc PushFunc) (*Aggregators, error) {
+	var cfgs []*Config
+	if err := yaml.UnmarshalStrict(data, &cfgs); err != nil {
+		return nil, fmt.Errorf("cannot parse stream aggregation config: %w", err)
+	}
+	return NewAggregators(cfgs, pushFunc)
+}
+
+// NewAggregators initializes Aggregators from the given cfgs and uses the given pushFunc for pushing the aggregated data.
+//
+// MustStop must be called on the returned Aggregators when they are no longer needed.
+func NewAggregators(cfgs []*Config, pushFunc PushFunc) (*Aggregators, error) {
+	as := make([]*aggregator, len(cfgs))
+	for i, cfg := range cfgs {
+		a, err := newAggregator(cfg, pushFunc)
+		if err != nil {
+			// Stop already initialized aggregators before returning the error.
+			for _, a := range as[:i] {
+				a.MustStop()
+			}
+			return nil, fmt.Errorf("cannot initialize aggregator #%d: %w", i+1, err)
+		}
+		as[i] = a
+	}
+	return &Aggregators{
+		as: as,
+	}, nil
+}
+
+// MustStop stops a and flushes the aggregated data to pushFunc.
+func (a *Aggregators) MustStop() {
+	if a == nil {
+		return
+	}
+	for _, ag := range a.as {
+		ag.MustStop()
+	}
+}
+
+// Push pushes tss to a.
+//
+// It sets matchIdxs[i] to 1 if tss[i] matches at least a single aggregator, otherwise it sets matchIdxs[i] to 0.
+// The updated matchIdxs is returned.
+func (a *Aggregators) Push(tss []prompbmarshal.TimeSeries, matchIdxs []byte) []byte {
+	matchIdxs = bytesutil.Resize(matchIdxs, len(tss))
+	for i := range matchIdxs {
+		matchIdxs[i] = 0
+	}
+	if a == nil {
+		return matchIdxs
+	}
+	for _, ag := range a.as {
+		ag.Push(tss, matchIdxs)
+	}
+	return matchIdxs
+}
+
+// aggregator aggregates input series according to the config.
+type aggregator struct {
+	match    []*labelFilter
+	interval time.Duration
+	by       []string
+	without  []string
+	outputs  []aggrOutput
+	pushFunc PushFunc
+
+	// suffix contains a suffix, which is appended to the metric name of the aggregated series before output name.
+	suffix string
+
+	// needSeries is set to true if count_series output is requested.
+	needSeries bool
+
+	// needHistogram is set to true if quantiles output is requested.
+	needHistogram bool
+
+	mu sync.Mutex
+	m  map[string]*aggrState
+
+	wg     sync.WaitGroup
+	stopCh chan struct{}
+}
+
+type aggrOutput struct {
+	name string
+
+	// phis contains quantiles for quantiles output.
+	phis []float64
+}
+
+type aggrState struct {
+	// labels are the output labels for the aggregated series. They refer to the key in aggregator.m.
+	labels []prompbmarshal.Label
+
+	count uint64
+	sum   float64
+	min   float64
+	max   float64
+	last  float64
+
+	// series contains unique input series for count_series output.
+	series map[string]struct{}
+
+	// h contains samples for quantiles output.
+	h *histogram.Fast
+}
+
+func newAggregator(cfg *Config, pushFunc PushFunc) (*aggregator, error) {
+	if cfg.Interval == "" {
+		return nil, fmt.Errorf("missing `interval` option")
+	}
+	interval, err := time.ParseDuration(cfg.Interval)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse `interval: %q`: %w", cfg.Interval, err)
+	}
+	if interval < time.Second {
+		return nil, fmt.Errorf("`interval: %q` mustn't be smaller than 1s", cfg.Interval)
+	}
+	if len(cfg.By) > 0 && len(cfg.Without) > 0 {
+		return nil, fmt.Errorf("`by: %s` and `without: %s` options cannot be set simultaneously", cfg.By, cfg.Without)
+	}
+	match, err := parseMatch(cfg.Match)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse `match: %q`: %w", cfg.Match, err)
+	}
+	if len(cfg.Outputs) == 0 {
+		return nil, fmt.Errorf("`outputs` list must contain at least a single entry from the list %s", supportedOutputs)
+	}
+	a := &aggregator{
+		match:    match,
+		interval: interval,
+		by:       sortedCopy(cfg.By),
+		without:  sortedCopy(cfg.Without),
+		pushFunc: pushFunc,
+		m:        make(map[string]*aggrState),
+		stopCh:   make(chan struct{}),
+	}
+	for _, s := range cfg.Outputs {
+		o, err := parseOutput(s)
+		if err != nil {
+			return nil, err
+		}
+		switch o.name {
+		case "count_series":
+			a.needSeries = true
+		case "quantiles":
+			a.needHistogram = true
+		}
+		a.outputs = append(a.outputs, o)
+	}
+	suffix := ":" + cfg.Interval
+	if len(a.by) > 0 {
+		suffix += "_by_" + strings.Join(a.by, "_")
+	}
+	if len(a.without) > 0 {
+		suffix += "_without_" + strings.Join(a.without, "_")
+	}
+	a.suffix = suffix + "_"
+
+	a.wg.Add(1)
+	go func() {
+		defer a.wg.Done()
+		a.runFlusher()
+	}()
+	return a, nil
+}
+
+func parseOutput(s string) (aggrOutput, error) {
+	s = strings.TrimSpace(s)
+	switch s {
+	case "sum_samples", "count_samples", "count_series", "min", "max", "avg", "last":
+		return aggrOutput{
+			name: s,
+		}, nil
+	}
+	if !strings.HasPrefix(s, "quantiles(") || !strings.HasSuffix(s, ")") {
+		return aggrOutput{}, fmt.Errorf("unsupported output=%q; supported outputs: %s", s, supportedOutputs)
+	}
+	args := strings.Split(s[len("quantiles("):len(s)-1], ",")
+	phis := make([]float64, 0, len(args))
+	for _, arg := range args {
+		arg = strings.TrimSpace(arg)
+		phi, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return aggrOutput{}, fmt.Errorf("cannot parse phi=%q for output=%q: %w", arg, s, err)
+		}
+		if phi < 0 || phi > 1 {
+			return aggrOutput{}, fmt.Errorf("phi=%q for output=%q must be in the range [0..1]", arg, s)
+		}
+		phis = append(phis, phi)
+	}
+	return aggrOutput{
+		name: "quantiles",
+		phis: phis,
+	}, nil
+}
+
+func sortedCopy(a []string) []string {
+	if len(a) == 0 {
+		return nil
+	}
+	b := append([]string{}, a...)
+	sort.Strings(b)
+	return b
+}
+
+func (a *aggregator) runFlusher() {
+	t := time.NewTicker(a.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-a.stopCh:
+			return
+		case <-t.C:
+			a.flush()
+		}
+	}
+}
+
+// MustStop stops a and flushes the remaining aggregated data.
+func (a *aggregator) MustStop() {
+	close(a.stopCh)
+	a.wg.Wait()
+	a.flush()
+}
+
+// Push pushes tss to a and marks matching series at matchIdxs.
+func (a *aggregator) Push(tss []prompbmarshal.TimeSeries, matchIdxs []byte) {
+	var labels []prompbmarshal.Label
+	var key, seriesKey []byte
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for i := range tss {
+		ts := &tss[i]
+		if !matchLabels(a.match, ts.Labels) {
+			continue
+		}
+		matchIdxs[i] = 1
+		labels = a.getOutputLabels(labels[:0], ts.Labels)
+		key = marshalLabels(key[:0], labels)
+		s := a.m[string(key)]
+		if s == nil {
+			s = a.newAggrState(string(key))
+			a.m[string(key)] = s
+		}
+		for _, sample := range ts.Samples {
+			s.update(sample.Value)
+		}
+		if s.series != nil {
+			seriesKey = marshalLabels(seriesKey[:0], ts.Labels)
+			if _, ok := s.series[string(seriesKey)]; !ok {
+				s.series[string(seriesKey)] = struct{}{}
+			}
+		}
+	}
+}
+
+// getOutputLabels appends output labels for the given input labels to dst and returns the result.
+//
+// The returned labels are sorted by name.
+func (a *aggregator) getOutputLabels(dst, labels []prompbmarshal.Label) []prompbmarshal.Label {
+	dstLen := len(dst)
+	for _, label := range labels {
+		if label.Name != "__name__" {
+			if len(a.by) > 0 && !containsString(a.by, label.Name) {
+				continue
+			}
+			if containsString(a.without, label.Name) {
+				continue
+			}
+		}
+		dst = append(dst, label)
+	}
+	tmp := dst[dstLen:]
+	sort.Slice(tmp, func(i, j int) bool {
+		return tmp[i].Name < tmp[j].Name
+	})
+	return dst
+}
+
+func containsString(a []string, s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *aggregator) newAggrState(key string) *aggrState {
+	labels, err := unmarshalLabels(nil, key)
+	if err != nil {
+		logger.Panicf("BUG: cannot unmarshal labels from key=%q: %s", key, err)
+	}
+	s := &aggrState{
+		labels: labels,
+	}
+	if a.needSeries {
+		s.series = make(map[string]struct{})
+	}
+	if a.needHistogram {
+		s.h = histogram.GetFast()
+	}
+	return s
+}
+
+func (s *aggrState) update(v float64) {
+	if math.IsNaN(v) {
+		// Skip NaN values such as Prometheus staleness markers.
+		return
+	}
+	if s.count == 0 || v < s.min {
+		s.min = v
+	}
+	if s.count == 0 || v > s.max {
+		s.max = v
+	}
+	s.count++
+	s.sum += v
+	s.last = v
+	if s.h != nil {
+		s.h.Update(v)
+	}
+}
+
+func (a *aggregator) flush() {
+	a.mu.Lock()
+	m := a.m
+	a.m = make(map[string]*aggrState, len(m))
+	a.mu.Unlock()
+
+	if len(m) == 0 {
+		return
+	}
+	timestamp := time.Now().UnixNano() / 1e6
+	var tss []prompbmarshal.TimeSeries
+	var phiValues []float64
+	for _, s := range m {
+		if s.count == 0 {
+			// All the input samples were NaN.
+			continue
+		}
+		for _, o := range a.outputs {
+			switch o.name {
+			case "sum_samples":
+				tss = a.appendSeries(tss, s, o.name, nil, timestamp, s.sum)
+			case "count_samples":
+				tss = a.appendSeries(tss, s, o.name, nil, timestamp, float64(s.count))
+			case "count_series":
+				tss = a.appendSeries(tss, s, o.name, nil, timestamp, float64(len(s.series)))
+			case "min":
+				tss = a.appendSeries(tss, s, o.name, nil, timestamp, s.min)
+			case "max":
+				tss = a.appendSeries(tss, s, o.name, nil, timestamp, s.max)
+			case "avg":
+				tss = a.appendSeries(tss, s, o.name, nil, timestamp, s.sum/float64(s.count))
+			case "last":
+				tss = a.appendSeries(tss, s, o.name, nil, timestamp, s.last)
+			case "quantiles":
+				phiValues = s.h.Quantiles(phiValues[:0], o.phis)
+				for i, phi := range o.phis {
+					extraLabel := &prompbmarshal.Label{
+						Name:  "quantile",
+						Value: strconv.FormatFloat(phi, 'g', -1, 64),
+					}
+					tss = a.appendSeries(tss, s, o.name, extraLabel, timestamp, phiValues[i])
+				}
+			default:
+				logger.Panicf("BUG: unexpected output=%q", o.name)
+			}
+		}
+	}
+	for _, s := range m {
+		if s.h != nil {
+			histogram.PutFast(s.h)
+			s.h = nil
+		}
+	}
+	if len(tss) > 0 {
+		a.pushFunc(tss)
+	}
+}
+
+func (a *aggregator) appendSeries(tss []prompbmarshal.TimeSeries, s *aggrState, outputName string, extraLabel *prompbmarshal.Label,
+	timestamp int64, value float64) []prompbmarshal.TimeSeries {
+	labels := make([]prompbmarshal.Label, 0, len(s.labels)+1)
+	for _, label := range s.labels {
+		if label.Name == "__name__" {
+			label.Value = label.Value + a.suffix + outputName
+		}
+		labels = append(labels, label)
+	}
+	if extraLabel != nil {
+		labels = append(labels, *extraLabel)
+	}
+	return append(tss, prompbmarshal.TimeSeries{
+		Labels: labels,
+		Samples: []prompbmarshal.Sample{{
+			Timestamp: timestamp,
+			Value:     value,
+		}},
+	})
+}
+
+func marshalLabels(dst []byte, labels []prompbmarshal.Label) []byte {
+	for _, label := range labels {
+		dst = encoding.MarshalBytes(dst, bytesutil.ToUnsafeBytes(label.Name))
+		dst = encoding.MarshalBytes(dst, bytesutil.ToUnsafeBytes(label.Value))
+	}
+	return dst
+}
+
+// unmarshalLabels appends labels unmarshaled from key to dst and returns the result.
+//
+// The returned labels refer to key.
+func unmarshalLabels(dst []prompbmarshal.Label, key string) ([]prompbmarshal.Label, error) {
+	src := bytesutil.ToUnsafeBytes(key)
+	for len(src) > 0 {
+		tail, name, err := encoding.UnmarshalBytes(src)
+		if err != nil {
+			return dst, fmt.Errorf("cannot unmarshal label name: %w", err)
+		}
+		tail, value, err := encoding.UnmarshalBytes(tail)
+		if err != nil {
+			return dst, fmt.Errorf("cannot unmarshal label value: %w", err)
+		}
+		src = tail
+		dst = append(dst, prompbmarshal.Label{
+			Name:  bytesutil.ToUnsafeString(name),
+			Value: bytesutil.ToUnsafeString(value),
+		})
+	}
+	return dst, nil
+}
+
+// labelFilter is a label filter from the `match` option.
+type labelFilter struct {
+	name       string
+	value      string
+	isNegative bool
+	re         *regexp.Regexp
+}
+
+func parseMatch(s string) ([]*labelFilter, error) {
+	if s == "" {
+		return nil, nil
+	}
+	expr, err := metricsql.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	me, ok := expr.(*metricsql.MetricExpr)
+	if !ok {
+		return nil, fmt.Errorf("expecting series selector; got %q", expr.AppendString(nil))
+	}
+	lfs := make([]*labelFilter, 0, len(me.LabelFilters))
+	for _, lf := range me.LabelFilters {
+		name := lf.Label
+		if name == "" {
+			name = "__name__"
+		}
+		f := &labelFilter{
+			name:       name,
+			value:      lf.Value,
+			isNegative: lf.IsNegative,
+		}
+		if lf.IsRegexp {
+			re, err := regexp.Compile("^(?:" + lf.Value + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse regexp for label %q: %w", name, err)
+			}
+			f.re = re
+		}
+		lfs = append(lfs, f)
+	}
+	return lfs, nil
+}
+
+func (lf *labelFilter) match(labels []prompbmarshal.Label) bool {
+	value := ""
+	for _, label := range labels {
+		if label.Name == lf.name {
+			value = label.Value
+			break
+		}
+	}
+	var ok bool
+	if lf.re != nil {
+		ok = lf.re.MatchString(value)
+	} else {
+		ok = value == lf.value
+	}
+	return ok != lf.isNegative
+}
+
+func matchLabels(lfs []*labelFilter, labels []prompbmarshal.Label) bool {
+	for _, lf := range lfs {
+		if !lf.match(labels) {
+			return false
+		}
+	}
+	return true
+}
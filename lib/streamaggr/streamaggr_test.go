@@ -0,0 +1,288 @@
+package streamaggr
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/prompbmarshal"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/protoparser/prometheus"
+)
+
+func TestAggregatorsFailure(t *testing.T) {
+	f := func(config string) {
+		t.Helper()
+		pushFunc := func(tss []prompbmarshal.TimeSeries) {
+			panic(fmt.Errorf("pushFunc shouldn't be called"))
+		}
+		a, err := NewAggregatorsFromData([]byte(config), pushFunc)
+		if err == nil {
+			a.MustStop()
+			t.Fatalf("expecting non-nil error")
+		}
+	}
+
+	// Invalid config
+	f(`foobar`)
+
+	// Unknown option
+	f(`
+- interval: 1m
+  outputs: [sum_samples]
+  foo: bar
+`)
+
+	// Missing interval
+	f(`
+- outputs: [sum_samples]
+`)
+
+	// Invalid interval
+	f(`
+- interval: foo
+  outputs: [sum_samples]
+`)
+
+	// Too small interval
+	f(`
+- interval: 10ms
+  outputs: [sum_samples]
+`)
+
+	// Missing outputs
+	f(`
+- interval: 1m
+`)
+
+	// Unknown output
+	f(`
+- interval: 1m
+  outputs: [foobar]
+`)
+
+	// Invalid quantiles
+	f(`
+- interval: 1m
+  outputs: ["quantiles(foo)"]
+`)
+	f(`
+- interval: 1m
+  outputs: ["quantiles(1.5)"]
+`)
+
+	// Invalid match
+	f(`
+- interval: 1m
+  match: 'sum(foo)'
+  outputs: [sum_samples]
+`)
+	f(`
+- interval: 1m
+  match: '{foo=~"("}'
+  outputs: [sum_samples]
+`)
+
+	// Both by and without
+	f(`
+- interval: 1m
+  by: [job]
+  without: [instance]
+  outputs: [sum_samples]
+`)
+}
+
+func TestAggregatorsSuccess(t *testing.T) {
+	f := func(config, inputMetrics, outputMetricsExpected, matchIdxsStrExpected string) {
+		t.Helper()
+
+		// Initialize Aggregators
+		var tssOutput []prompbmarshal.TimeSeries
+		var tssOutputLock sync.Mutex
+		pushFunc := func(tss []prompbmarshal.TimeSeries) {
+			tssOutputLock.Lock()
+			tssOutput = append(tssOutput, tss...)
+			tssOutputLock.Unlock()
+		}
+		a, err := NewAggregatorsFromData([]byte(config), pushFunc)
+		if err != nil {
+			t.Fatalf("cannot initialize aggregators: %s", err)
+		}
+
+		// Push the inputMetrics to Aggregators
+		tssInput := mustParsePromMetrics(inputMetrics)
+		matchIdxs := a.Push(tssInput, nil)
+		a.MustStop()
+
+		// Verify matchIdxs equals to matchIdxsExpected
+		matchIdxsStr := ""
+		for _, v := range matchIdxs {
+			matchIdxsStr += fmt.Sprintf("%d", v)
+		}
+		if matchIdxsStr != matchIdxsStrExpected {
+			t.Fatalf("unexpected matchIdxs;\ngot\n%s\nwant\n%s", matchIdxsStr, matchIdxsStrExpected)
+		}
+
+		// Verify the tssOutput contains the expected metrics
+		tsStrings := make([]string, len(tssOutput))
+		for i, ts := range tssOutput {
+			tsStrings[i] = timeSeriesToString(ts)
+		}
+		sort.Strings(tsStrings)
+		outputMetrics := strings.Join(tsStrings, "")
+		if outputMetrics != outputMetricsExpected {
+			t.Fatalf("unexpected output metrics;\ngot\n%s\nwant\n%s", outputMetrics, outputMetricsExpected)
+		}
+	}
+
+	// Empty config
+	f(``, ``, ``, "")
+	f(``, `foo{bar="baz"} 1`, ``, "0")
+
+	// Aggregate all the series without grouping
+	f(`
+- interval: 1m
+  outputs: [count_samples, sum_samples, count_series, min, max, avg, last]
+`, `
+foo{job="a"} 1
+foo{job="b"} 2
+foo{job="a"} 5
+bar 3
+bar NaN
+`, `bar:1m_avg 3
+bar:1m_count_samples 1
+bar:1m_count_series 1
+bar:1m_last 3
+bar:1m_max 3
+bar:1m_min 3
+bar:1m_sum_samples 3
+foo:1m_avg{job="a"} 3
+foo:1m_avg{job="b"} 2
+foo:1m_count_samples{job="a"} 2
+foo:1m_count_samples{job="b"} 1
+foo:1m_count_series{job="a"} 1
+foo:1m_count_series{job="b"} 1
+foo:1m_last{job="a"} 5
+foo:1m_last{job="b"} 2
+foo:1m_max{job="a"} 5
+foo:1m_max{job="b"} 2
+foo:1m_min{job="a"} 1
+foo:1m_min{job="b"} 2
+foo:1m_sum_samples{job="a"} 6
+foo:1m_sum_samples{job="b"} 2
+`, "11111")
+
+	// Group by job with match
+	f(`
+- interval: 30s
+  match: '{__name__=~"foo|bar", env!="dev"}'
+  by: [job]
+  outputs: [sum_samples, count_series]
+`, `
+foo{job="a",instance="x",env="prod"} 1
+foo{job="a",instance="y"} 2
+foo{job="b",instance="x"} 4
+foo{job="a",instance="x",env="dev"} 100
+baz{job="a"} 1
+`, `foo:30s_by_job_count_series{job="a"} 2
+foo:30s_by_job_count_series{job="b"} 1
+foo:30s_by_job_sum_samples{job="a"} 3
+foo:30s_by_job_sum_samples{job="b"} 4
+`, "11100")
+
+	// Drop labels with without
+	f(`
+- interval: 1m
+  without: [instance, pod]
+  outputs: [max]
+`, `
+foo{job="a",instance="x",pod="1"} 1
+foo{job="a",instance="y",pod="2"} 3
+`, `foo:1m_without_instance_pod_max{job="a"} 3
+`, "11")
+
+	// Quantiles
+	f(`
+- interval: 1m
+  by: [job]
+  outputs: ["quantiles(0, 0.5, 1)"]
+`, `
+foo{job="a",instance="x"} 1
+foo{job="a",instance="y"} 2
+foo{job="a",instance="z"} 3
+`, `foo:1m_by_job_quantiles{job="a",quantile="0"} 1
+foo:1m_by_job_quantiles{job="a",quantile="0.5"} 2
+foo:1m_by_job_quantiles{job="a",quantile="1"} 3
+`, "111")
+
+	// Multiple aggregators
+	f(`
+- interval: 1m
+  match: foo
+  outputs: [count_samples]
+- interval: 5m
+  match: bar
+  outputs: [sum_samples]
+`, `
+foo 1
+bar 2
+baz 3
+`, `bar:5m_sum_samples 2
+foo:1m_count_samples 1
+`, "110")
+}
+
+func timeSeriesToString(ts prompbmarshal.TimeSeries) string {
+	labelsString := labelsToString(ts.Labels)
+	if len(ts.Samples) != 1 {
+		panic(fmt.Errorf("unexpected number of samples for %s: %d; want 1", labelsString, len(ts.Samples)))
+	}
+	return fmt.Sprintf("%s %v\n", labelsString, ts.Samples[0].Value)
+}
+
+func labelsToString(labels []prompbmarshal.Label) string {
+	metricName := ""
+	var a []string
+	for _, label := range labels {
+		if label.Name == "__name__" {
+			metricName = label.Value
+			continue
+		}
+		a = append(a, fmt.Sprintf("%s=%q", label.Name, label.Value))
+	}
+	if len(a) == 0 {
+		return metricName
+	}
+	sort.Strings(a)
+	return metricName + "{" + strings.Join(a, ",") + "}"
+}
+
+func mustParsePromMetrics(s string) []prompbmarshal.TimeSeries {
+	var rows prometheus.Rows
+	errLogger := func(s string) {
+		panic(fmt.Errorf("unexpected error when parsing Prometheus metrics: %s", s))
+	}
+	rows.UnmarshalWithErrLogger(s, errLogger)
+	var tss []prompbmarshal.TimeSeries
+	for _, row := range rows.Rows {
+		labels := []prompbmarshal.Label{{
+			Name:  "__name__",
+			Value: row.Metric,
+		}}
+		for _, tag := range row.Tags {
+			labels = append(labels, prompbmarshal.Label{
+				Name:  tag.Key,
+				Value: tag.Value,
+			})
+		}
+		tss = append(tss, prompbmarshal.TimeSeries{
+			Labels: labels,
+			Samples: []prompbmarshal.Sample{{
+				Timestamp: row.Timestamp,
+				Value:     row.Value,
+			}},
+		})
+	}
+	return tss
+}
@@ -0,0 +1,244 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/VictoriaMetrics/metrics"
+)
+
+// maxSpansPerRequest is the maximum number of spans to send in a single request to -tracing.otlpEndpoint.
+const maxSpansPerRequest = 1000
+
+// exporter sends spans to OTLP/HTTP endpoint in JSON encoding.
+//
+// See https://github.com/open-telemetry/opentelemetry-specification/blob/main/specification/protocol/otlp.md#otlphttp
+type exporter struct {
+	endpoint    string
+	headers     http.Header
+	serviceName string
+	hc          *http.Client
+
+	spansCh chan *Span
+	stopCh  chan struct{}
+}
+
+func newExporter(endpoint string, headers http.Header, serviceName string, maxPendingSpans int) *exporter {
+	if maxPendingSpans <= 0 {
+		maxPendingSpans = 1
+	}
+	return &exporter{
+		endpoint:    endpoint,
+		headers:     headers,
+		serviceName: serviceName,
+		hc: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+		spansCh: make(chan *Span, maxPendingSpans),
+		stopCh:  make(chan struct{}),
+	}
+}
+
+var (
+	spansExported  = metrics.NewCounter(`vm_tracing_spans_exported_total`)
+	spansDropped   = metrics.NewCounter(`vm_tracing_spans_dropped_total`)
+	exportErrors   = metrics.NewCounter(`vm_tracing_export_errors_total`)
+	exportDuration = metrics.NewHistogram(`vm_tracing_export_duration_seconds`)
+)
+
+func (e *exporter) add(s *Span) {
+	select {
+	case e.spansCh <- s:
+	default:
+		spansDropped.Inc()
+	}
+}
+
+func (e *exporter) run(flushInterval time.Duration) {
+	if flushInterval <= 0 {
+		flushInterval = time.Second
+	}
+	t := time.NewTicker(flushInterval)
+	defer t.Stop()
+	var spans []*Span
+	for {
+		select {
+		case <-e.stopCh:
+			// Send the remaining spans.
+			for {
+				select {
+				case s := <-e.spansCh:
+					spans = append(spans, s)
+					if len(spans) >= maxSpansPerRequest {
+						e.send(spans)
+						spans = spans[:0]
+					}
+				default:
+					e.send(spans)
+					return
+				}
+			}
+		case s := <-e.spansCh:
+			spans = append(spans, s)
+			if len(spans) >= maxSpansPerRequest {
+				e.send(spans)
+				spans = spans[:0]
+			}
+		case <-t.C:
+			e.send(spans)
+			spans = spans[:0]
+		}
+	}
+}
+
+func (e *exporter) send(spans []*Span) {
+	if len(spans) == 0 {
+		return
+	}
+	data := marshalSpans(e.serviceName, spans)
+	req, err := http.NewRequest("POST", e.endpoint, bytes.NewReader(data))
+	if err != nil {
+		logger.Panicf("BUG: unexpected error from http.NewRequest(%q): %s", e.endpoint, err)
+	}
+	for k, vs := range e.headers {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Content-Type", "application/json")
+	startTime := time.Now()
+	resp, err := e.hc.Do(req)
+	exportDuration.UpdateDuration(startTime)
+	if err != nil {
+		exportErrors.Inc()
+		spansDropped.Add(len(spans))
+		logger.Errorf("cannot send %d spans to -tracing.otlpEndpoint=%q: %s", len(spans), e.endpoint, err)
+		return
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		exportErrors.Inc()
+		spansDropped.Add(len(spans))
+		logger.Errorf("unexpected status code when sending %d spans to -tracing.otlpEndpoint=%q: %d; want 2xx; response body: %q",
+			len(spans), e.endpoint, resp.StatusCode, body)
+		return
+	}
+	spansExported.Add(len(spans))
+}
+
+// marshalSpans marshals spans into OTLP JSON for ExportTraceServiceRequest.
+//
+// See https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/collector/trace/v1/trace_service.proto
+func marshalSpans(serviceName string, spans []*Span) []byte {
+	jss := make([]jsonSpan, len(spans))
+	for i, s := range spans {
+		js := &jss[i]
+		js.TraceID = hex.EncodeToString(s.traceID[:])
+		js.SpanID = hex.EncodeToString(s.spanID[:])
+		if s.parentSpanID != [8]byte{} {
+			js.ParentSpanID = hex.EncodeToString(s.parentSpanID[:])
+		}
+		js.Name = s.name
+		js.Kind = s.kind
+		js.StartTimeUnixNano = strconv.FormatInt(s.startTime.UnixNano(), 10)
+		js.EndTimeUnixNano = strconv.FormatInt(s.endTime.UnixNano(), 10)
+		for _, a := range s.attributes {
+			js.Attributes = append(js.Attributes, newJSONAttribute(a))
+		}
+		if len(s.errMsg) > 0 {
+			js.Status = &jsonStatus{
+				// STATUS_CODE_ERROR
+				Code:    2,
+				Message: s.errMsg,
+			}
+		}
+	}
+	req := jsonExportRequest{
+		ResourceSpans: []jsonResourceSpans{{
+			Resource: jsonResource{
+				Attributes: []jsonAttribute{newJSONAttribute(attribute{
+					key:   "service.name",
+					value: serviceName,
+				})},
+			},
+			ScopeSpans: []jsonScopeSpans{{
+				Scope: jsonScope{
+					Name: "github.com/VictoriaMetrics/VictoriaMetrics/lib/tracing",
+				},
+				Spans: jss,
+			}},
+		}},
+	}
+	data, err := json.Marshal(&req)
+	if err != nil {
+		logger.Panicf("BUG: unexpected error when marshaling spans: %s", err)
+	}
+	return data
+}
+
+func newJSONAttribute(a attribute) jsonAttribute {
+	ja := jsonAttribute{
+		Key: a.key,
+	}
+	if a.isInt {
+		// int64 values are encoded as strings in OTLP JSON.
+		v := strconv.FormatInt(a.intValue, 10)
+		ja.Value.IntValue = &v
+	} else {
+		v := a.value
+		ja.Value.StringValue = &v
+	}
+	return ja
+}
+
+type jsonExportRequest struct {
+	ResourceSpans []jsonResourceSpans `json:"resourceSpans"`
+}
+
+type jsonResourceSpans struct {
+	Resource   jsonResource     `json:"resource"`
+	ScopeSpans []jsonScopeSpans `json:"scopeSpans"`
+}
+
+type jsonResource struct {
+	Attributes []jsonAttribute `json:"attributes"`
+}
+
+type jsonScopeSpans struct {
+	Scope jsonScope  `json:"scope"`
+	Spans []jsonSpan `json:"spans"`
+}
+
+type jsonScope struct {
+	Name string `json:"name"`
+}
+
+type jsonSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []jsonAttribute `json:"attributes,omitempty"`
+	Status            *jsonStatus     `json:"status,omitempty"`
+}
+
+type jsonAttribute struct {
+	Key   string `json:"key"`
+	Value struct {
+		StringValue *string `json:"stringValue,omitempty"`
+		IntValue    *string `json:"intValue,omitempty"`
+	} `json:"value"`
+}
+
+type jsonStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
@@ -0,0 +1,328 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/flagutil"
+	"github.com/VictoriaMetrics/VictoriaMetrics/lib/logger"
+	"github.com/valyala/fastrand"
+)
+
+var (
+	otlpEndpoint = flag.String("tracing.otlpEndpoint", "", "OTLP/HTTP endpoint for exporting OpenTelemetry traces in JSON encoding. For example, http://otel-collector:4318/v1/traces . "+
+		"Tracing is disabled if empty")
+	otlpHeaders = flagutil.NewArray("tracing.otlpHeaders", "Optional HTTP headers to send with every request to -tracing.otlpEndpoint in the form 'Name: value'. "+
+		"For example, 'Authorization: Bearer token' or 'X-Scope-OrgID: 42'")
+	serviceName = flag.String("tracing.serviceName", "", "The value for service.name resource attribute in exported traces. The executable name is used by default")
+	sampleRatio = flag.Float64("tracing.sampleRatio", 0.01, "The ratio of traced requests in the range [0..1] for requests without traceparent header. "+
+		"Requests with traceparent header are traced according to the sampled flag in the header")
+	flushInterval   = flag.Duration("tracing.flushInterval", 5*time.Second, "Interval for sending collected spans to -tracing.otlpEndpoint")
+	maxPendingSpans = flag.Int("tracing.maxPendingSpans", 10000, "The maximum number of spans waiting for sending to -tracing.otlpEndpoint. "+
+		"Newly finished spans are dropped if this limit is reached")
+)
+
+// Init initializes tracing if -tracing.otlpEndpoint is set.
+//
+// It is safe calling Init multiple times - subsequent calls are no-op.
+// Stop must be called when tracing is no longer needed.
+func Init() {
+	initOnce.Do(initInternal)
+}
+
+func initInternal() {
+	if len(*otlpEndpoint) == 0 {
+		return
+	}
+	if *sampleRatio < 0 || *sampleRatio > 1 {
+		logger.Fatalf("-tracing.sampleRatio must be in the range [0..1]; got %g", *sampleRatio)
+	}
+	headers, err := parseHeaders(*otlpHeaders)
+	if err != nil {
+		logger.Fatalf("cannot parse -tracing.otlpHeaders: %s", err)
+	}
+	name := *serviceName
+	if len(name) == 0 {
+		name = filepath.Base(os.Args[0])
+	}
+	e := newExporter(*otlpEndpoint, headers, name, *maxPendingSpans)
+	exporterWG.Add(1)
+	go func() {
+		defer exporterWG.Done()
+		e.run(*flushInterval)
+	}()
+	exporterV.Store(e)
+	logger.Infof("started exporting traces to -tracing.otlpEndpoint=%q with -tracing.sampleRatio=%g", *otlpEndpoint, *sampleRatio)
+}
+
+// Stop sends pending spans and stops tracing.
+//
+// Spans finished after Stop call are dropped.
+func Stop() {
+	stopOnce.Do(func() {
+		e := getExporter()
+		if e == nil {
+			return
+		}
+		close(e.stopCh)
+		exporterWG.Wait()
+	})
+}
+
+var (
+	initOnce   sync.Once
+	stopOnce   sync.Once
+	exporterV  atomic.Value
+	exporterWG sync.WaitGroup
+)
+
+// getExporter returns the exporter initialized in Init.
+//
+// nil is returned if tracing is disabled.
+func getExporter() *exporter {
+	e, _ := exporterV.Load().(*exporter)
+	return e
+}
+
+func parseHeaders(a []string) (http.Header, error) {
+	h := make(http.Header)
+	for _, s := range a {
+		n := strings.IndexByte(s, ':')
+		if n < 0 {
+			return nil, fmt.Errorf("missing ':' in header %q; expecting 'Name: value' format", s)
+		}
+		h.Add(strings.TrimSpace(s[:n]), strings.TrimSpace(s[n+1:]))
+	}
+	return h, nil
+}
+
+// Span kinds according to https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/trace/v1/trace.proto
+const (
+	spanKindInternal = 1
+	spanKindServer   = 2
+	spanKindClient   = 3
+)
+
+// Span is a single operation within a trace.
+//
+// All the methods of Span are no-op for nil Span, so nil Span may be used when the operation isn't traced.
+// A span mustn't be used after the End call.
+type Span struct {
+	traceID      [16]byte
+	spanID       [8]byte
+	parentSpanID [8]byte
+
+	name      string
+	kind      int
+	startTime time.Time
+	endTime   time.Time
+
+	attributes []attribute
+	errMsg     string
+}
+
+type attribute struct {
+	key      string
+	value    string
+	intValue int64
+	isInt    bool
+}
+
+// StartRequestSpan starts a server span for the incoming request r.
+//
+// The span becomes a child of the span from traceparent header if it is present in r.
+// See https://www.w3.org/TR/trace-context/#traceparent-header
+//
+// nil is returned if tracing is disabled or if the request isn't sampled.
+func StartRequestSpan(r *http.Request) *Span {
+	if getExporter() == nil {
+		return nil
+	}
+	var s *Span
+	if tp := r.Header.Get("traceparent"); len(tp) > 0 {
+		traceID, parentSpanID, sampled, ok := parseTraceParent(tp)
+		if ok {
+			if !sampled {
+				return nil
+			}
+			s = newSpan(r.URL.Path, spanKindServer)
+			s.traceID = traceID
+			s.parentSpanID = parentSpanID
+		}
+	}
+	if s == nil {
+		if !isSampled() {
+			return nil
+		}
+		s = newSpan(r.URL.Path, spanKindServer)
+		fillRandom(s.traceID[:])
+	}
+	s.SetAttribute("http.method", r.Method)
+	s.SetAttribute("http.target", r.URL.Path)
+	s.SetAttribute("net.peer.addr", r.RemoteAddr)
+	if ua := r.UserAgent(); len(ua) > 0 {
+		s.SetAttribute("http.user_agent", ua)
+	}
+	return s
+}
+
+// StartClientSpan starts a root client span with the given name for outgoing requests.
+//
+// Use InjectHeader for propagating the span to the remote side.
+// nil is returned if tracing is disabled or if the span isn't sampled.
+func StartClientSpan(name string) *Span {
+	if getExporter() == nil || !isSampled() {
+		return nil
+	}
+	s := newSpan(name, spanKindClient)
+	fillRandom(s.traceID[:])
+	return s
+}
+
+func isSampled() bool {
+	ratio := *sampleRatio
+	if ratio <= 0 {
+		return false
+	}
+	if ratio >= 1 {
+		return true
+	}
+	return float64(fastrand.Uint32()) < ratio*(1<<32)
+}
+
+func newSpan(name string, kind int) *Span {
+	s := &Span{
+		name:      name,
+		kind:      kind,
+		startTime: time.Now(),
+	}
+	fillRandom(s.spanID[:])
+	return s
+}
+
+func fillRandom(dst []byte) {
+	for {
+		for i := range dst {
+			dst[i] = byte(fastrand.Uint32())
+		}
+		for _, b := range dst {
+			if b != 0 {
+				// All-zero ids are invalid according to https://www.w3.org/TR/trace-context/
+				return
+			}
+		}
+	}
+}
+
+// parseTraceParent parses traceparent header value.
+//
+// See https://www.w3.org/TR/trace-context/#traceparent-header
+func parseTraceParent(s string) ([16]byte, [8]byte, bool, bool) {
+	var traceID [16]byte
+	var spanID [8]byte
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return traceID, spanID, false, false
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return traceID, spanID, false, false
+	}
+	if _, err := hex.Decode(traceID[:], []byte(parts[1])); err != nil || traceID == [16]byte{} {
+		return traceID, spanID, false, false
+	}
+	if _, err := hex.Decode(spanID[:], []byte(parts[2])); err != nil || spanID == [8]byte{} {
+		return traceID, spanID, false, false
+	}
+	var flags [1]byte
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return traceID, spanID, false, false
+	}
+	return traceID, spanID, flags[0]&1 != 0, true
+}
+
+// NewChild starts a child span with the given name.
+func (s *Span) NewChild(name string) *Span {
+	if s == nil {
+		return nil
+	}
+	child := newSpan(name, spanKindInternal)
+	child.traceID = s.traceID
+	child.parentSpanID = s.spanID
+	return child
+}
+
+// SetAttribute sets string attribute with the given key and value for s.
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	s.attributes = append(s.attributes, attribute{
+		key:   key,
+		value: value,
+	})
+}
+
+// SetIntAttribute sets integer attribute with the given key and value for s.
+func (s *Span) SetIntAttribute(key string, value int64) {
+	if s == nil {
+		return
+	}
+	s.attributes = append(s.attributes, attribute{
+		key:      key,
+		intValue: value,
+		isInt:    true,
+	})
+}
+
+// SetError marks s as failed with the given err.
+//
+// It is safe to pass nil err - in this case s isn't marked as failed.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.errMsg = err.Error()
+}
+
+// InjectHeader sets traceparent header for propagating s to the remote side via h.
+func (s *Span) InjectHeader(h http.Header) {
+	if s == nil {
+		return
+	}
+	h.Set("traceparent", fmt.Sprintf("00-%x-%x-01", s.traceID[:], s.spanID[:]))
+}
+
+// End finishes s and schedules it for sending to -tracing.otlpEndpoint.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.endTime = time.Now()
+	if e := getExporter(); e != nil {
+		e.add(s)
+	}
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpan returns a copy of ctx with the given s.
+func ContextWithSpan(ctx context.Context, s *Span) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, s)
+}
+
+// SpanFromContext returns span from ctx.
+//
+// nil is returned if ctx has no span.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanContextKey{}).(*Span)
+	return s
+}
@@ -0,0 +1,188 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseTraceParentSuccess(t *testing.T) {
+	f := func(s, traceIDExpected, spanIDExpected string, sampledExpected bool) {
+		t.Helper()
+		traceID, spanID, sampled, ok := parseTraceParent(s)
+		if !ok {
+			t.Fatalf("cannot parse %q", s)
+		}
+		if got := fmt.Sprintf("%x", traceID[:]); got != traceIDExpected {
+			t.Fatalf("unexpected traceID; got %q; want %q", got, traceIDExpected)
+		}
+		if got := fmt.Sprintf("%x", spanID[:]); got != spanIDExpected {
+			t.Fatalf("unexpected spanID; got %q; want %q", got, spanIDExpected)
+		}
+		if sampled != sampledExpected {
+			t.Fatalf("unexpected sampled; got %v; want %v", sampled, sampledExpected)
+		}
+	}
+	f("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", true)
+	f("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", false)
+	f(" 00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-03 ", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", true)
+
+	// Future versions may contain additional fields
+	f("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-foo", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", true)
+}
+
+func TestParseTraceParentFailure(t *testing.T) {
+	f := func(s string) {
+		t.Helper()
+		if _, _, _, ok := parseTraceParent(s); ok {
+			t.Fatalf("expecting failure when parsing %q", s)
+		}
+	}
+	f("")
+	f("foo")
+	f("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7")
+	f("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-foo")
+	f("ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	f("00-00000000000000000000000000000000-00f067aa0ba902b7-01")
+	f("00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01")
+	f("00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01")
+	f("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-0x")
+}
+
+func TestNilSpan(t *testing.T) {
+	var s *Span
+	child := s.NewChild("foo")
+	if child != nil {
+		t.Fatalf("expecting nil child for nil span")
+	}
+	s.SetAttribute("foo", "bar")
+	s.SetIntAttribute("foo", 123)
+	s.SetError(fmt.Errorf("error"))
+	h := make(http.Header)
+	s.InjectHeader(h)
+	if len(h) > 0 {
+		t.Fatalf("unexpected headers for nil span: %v", h)
+	}
+	s.End()
+
+	if s := SpanFromContext(context.Background()); s != nil {
+		t.Fatalf("expecting nil span for context without span")
+	}
+}
+
+func TestSpanPropagation(t *testing.T) {
+	parent := newSpan("parent", spanKindClient)
+	fillRandom(parent.traceID[:])
+	h := make(http.Header)
+	parent.InjectHeader(h)
+	traceID, spanID, sampled, ok := parseTraceParent(h.Get("traceparent"))
+	if !ok || !sampled {
+		t.Fatalf("cannot parse injected traceparent header %q", h.Get("traceparent"))
+	}
+	if traceID != parent.traceID || spanID != parent.spanID {
+		t.Fatalf("unexpected ids in traceparent header %q", h.Get("traceparent"))
+	}
+
+	child := parent.NewChild("child")
+	if child.traceID != parent.traceID {
+		t.Fatalf("unexpected traceID for child span")
+	}
+	if child.parentSpanID != parent.spanID {
+		t.Fatalf("unexpected parentSpanID for child span")
+	}
+	if child.spanID == parent.spanID {
+		t.Fatalf("child span must have distinct spanID")
+	}
+
+	ctx := ContextWithSpan(context.Background(), child)
+	if s := SpanFromContext(ctx); s != child {
+		t.Fatalf("unexpected span obtained from context")
+	}
+}
+
+func TestExporter(t *testing.T) {
+	reqCh := make(chan *jsonExportRequest, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("unexpected Content-Type; got %q; want %q", ct, "application/json")
+		}
+		if v := r.Header.Get("X-Scope-OrgID"); v != "42" {
+			t.Errorf("unexpected X-Scope-OrgID header; got %q; want %q", v, "42")
+		}
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("cannot read request body: %s", err)
+		}
+		var req jsonExportRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			t.Errorf("cannot parse request body %q: %s", data, err)
+		}
+		reqCh <- &req
+	}))
+	defer srv.Close()
+
+	headers, err := parseHeaders([]string{"X-Scope-OrgID: 42"})
+	if err != nil {
+		t.Fatalf("cannot parse headers: %s", err)
+	}
+	e := newExporter(srv.URL, headers, "test-service", 10)
+	doneCh := make(chan struct{})
+	go func() {
+		e.run(time.Hour)
+		close(doneCh)
+	}()
+
+	parent := newSpan("/api/v1/query", spanKindServer)
+	fillRandom(parent.traceID[:])
+	child := parent.NewChild("promql.eval")
+	child.SetAttribute("query", "up")
+	child.SetIntAttribute("series", 3)
+	child.SetError(fmt.Errorf("some error"))
+	child.endTime = time.Now()
+	e.add(child)
+	parent.endTime = time.Now()
+	e.add(parent)
+
+	// Pending spans must be sent on stop.
+	close(e.stopCh)
+	<-doneCh
+
+	var req *jsonExportRequest
+	select {
+	case req = <-reqCh:
+	default:
+		t.Fatalf("missing request to OTLP endpoint")
+	}
+	if len(req.ResourceSpans) != 1 {
+		t.Fatalf("unexpected number of resourceSpans; got %d; want 1", len(req.ResourceSpans))
+	}
+	rs := req.ResourceSpans[0]
+	if len(rs.Resource.Attributes) != 1 || rs.Resource.Attributes[0].Key != "service.name" || *rs.Resource.Attributes[0].Value.StringValue != "test-service" {
+		t.Fatalf("unexpected resource attributes: %+v", rs.Resource.Attributes)
+	}
+	if len(rs.ScopeSpans) != 1 || len(rs.ScopeSpans[0].Spans) != 2 {
+		t.Fatalf("unexpected scopeSpans: %+v", rs.ScopeSpans)
+	}
+	jsChild := rs.ScopeSpans[0].Spans[0]
+	jsParent := rs.ScopeSpans[0].Spans[1]
+	if jsParent.Name != "/api/v1/query" || jsParent.Kind != spanKindServer || jsParent.ParentSpanID != "" || jsParent.Status != nil {
+		t.Fatalf("unexpected parent span: %+v", jsParent)
+	}
+	if jsChild.Name != "promql.eval" || jsChild.TraceID != jsParent.TraceID || jsChild.ParentSpanID != jsParent.SpanID {
+		t.Fatalf("unexpected child span: %+v", jsChild)
+	}
+	if len(jsChild.TraceID) != 32 || len(jsChild.SpanID) != 16 {
+		t.Fatalf("unexpected ids in child span: %+v", jsChild)
+	}
+	if jsChild.Status == nil || jsChild.Status.Code != 2 || jsChild.Status.Message != "some error" {
+		t.Fatalf("unexpected status for child span: %+v", jsChild.Status)
+	}
+	if len(jsChild.Attributes) != 2 || *jsChild.Attributes[0].Value.StringValue != "up" || *jsChild.Attributes[1].Value.IntValue != "3" {
+		t.Fatalf("unexpected attributes for child span: %+v", jsChild.Attributes)
+	}
+}